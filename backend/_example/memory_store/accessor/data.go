@@ -39,6 +39,8 @@ type metaUser struct {
 	Verified     bool
 	Blocked      bool
 	BlockedUntil time.Time
+	Admin        bool
+	Moderator    bool
 	Details      engine.UserDetailEntry
 }
 
@@ -266,6 +268,14 @@ func (m *MemData) ListFlags(req engine.FlagRequest) (res []any, err error) {
 		}
 		return res, nil
 
+	case engine.Admin, engine.Moderator:
+		for _, u := range m.metaUsers {
+			if u.SiteID == req.Locator.SiteID && (req.Flag == engine.Admin && u.Admin || req.Flag == engine.Moderator && u.Moderator) {
+				res = append(res, u.UserID)
+			}
+		}
+		return res, nil
+
 	case engine.Blocked:
 		log.Printf("[INFO] metaUsers: %+v", m.metaUsers)
 		for _, u := range m.metaUsers {
@@ -284,7 +294,8 @@ func (m *MemData) ListFlags(req engine.FlagRequest) (res []any, err error) {
 // and all site's details listing under the same function (and not to extend engine interface by two separate functions).
 func (m *MemData) UserDetail(req engine.UserDetailRequest) ([]engine.UserDetailEntry, error) {
 	switch req.Detail {
-	case engine.UserEmail, engine.UserTelegram:
+	case engine.UserEmail, engine.UserTelegram, engine.UserDisplayName, engine.UserPronouns, engine.UserIgnored, engine.UserLevel, engine.UserBlockReason,
+		engine.UserPasskeys, engine.UserTOTP, engine.UserLinkedTo, engine.UserNotBefore:
 		if req.UserID == "" {
 			return nil, fmt.Errorf("userid cannot be empty in request for single detail")
 		}
@@ -336,6 +347,17 @@ func (m *MemData) Delete(req engine.DeleteRequest) error {
 		m.deleteUserDetail(req.Locator, req.UserID, engine.AllUserDetails)
 		return nil
 
+	case req.Locator.URL != "" && req.CommentID == "" && req.UserID == "" && req.UserDetail == "": // delete post
+		comments := m.match(m.posts[req.Locator.SiteID], func(c store.Comment) bool {
+			return c.Locator != req.Locator
+		})
+		if len(comments) == len(m.posts[req.Locator.SiteID]) {
+			return fmt.Errorf("post %s not found", req.Locator.URL)
+		}
+		m.posts[req.Locator.SiteID] = comments
+		delete(m.metaPosts, req.Locator)
+		return nil
+
 	case req.Locator.SiteID != "" && req.Locator.URL == "" && req.CommentID == "" && req.UserID == "" && req.UserDetail == "": // delete site
 		if _, ok := m.posts[req.Locator.SiteID]; !ok {
 			return fmt.Errorf("not found")
@@ -381,6 +403,16 @@ func (m *MemData) checkFlag(req engine.FlagRequest) (val bool) {
 			}
 			return meta.Verified
 		}
+	case engine.Admin, engine.Moderator:
+		if meta, ok := m.metaUsers[req.UserID]; ok {
+			if meta.SiteID != req.Locator.SiteID {
+				return false
+			}
+			if req.Flag == engine.Admin {
+				return meta.Admin
+			}
+			return meta.Moderator
+		}
 	case engine.ReadOnly:
 		if meta, ok := m.metaPosts[req.Locator]; ok {
 			return meta.ReadOnly
@@ -419,6 +451,16 @@ func (m *MemData) setFlag(req engine.FlagRequest) (res bool, err error) {
 		}
 		m.metaUsers[req.UserID] = meta
 
+	case engine.Admin, engine.Moderator:
+		meta := m.metaUsers[req.UserID]
+		meta.UserID, meta.SiteID = req.UserID, req.Locator.SiteID
+		if req.Flag == engine.Admin {
+			meta.Admin = status
+		} else {
+			meta.Moderator = status
+		}
+		m.metaUsers[req.UserID] = meta
+
 	case engine.ReadOnly:
 		info, ok := m.metaPosts[req.Locator]
 		if !ok {
@@ -446,6 +488,24 @@ func (m *MemData) getUserDetail(req engine.UserDetailRequest) []engine.UserDetai
 			return []engine.UserDetailEntry{{UserID: req.UserID, Email: meta.Details.Email}}
 		case engine.UserTelegram:
 			return []engine.UserDetailEntry{{UserID: req.UserID, Telegram: meta.Details.Telegram}}
+		case engine.UserDisplayName:
+			return []engine.UserDetailEntry{{UserID: req.UserID, DisplayName: meta.Details.DisplayName}}
+		case engine.UserPronouns:
+			return []engine.UserDetailEntry{{UserID: req.UserID, Pronouns: meta.Details.Pronouns}}
+		case engine.UserIgnored:
+			return []engine.UserDetailEntry{{UserID: req.UserID, Ignored: meta.Details.Ignored}}
+		case engine.UserLevel:
+			return []engine.UserDetailEntry{{UserID: req.UserID, Level: meta.Details.Level}}
+		case engine.UserBlockReason:
+			return []engine.UserDetailEntry{{UserID: req.UserID, BlockReason: meta.Details.BlockReason}}
+		case engine.UserPasskeys:
+			return []engine.UserDetailEntry{{UserID: req.UserID, Passkeys: meta.Details.Passkeys}}
+		case engine.UserTOTP:
+			return []engine.UserDetailEntry{{UserID: req.UserID, TOTP: meta.Details.TOTP}}
+		case engine.UserLinkedTo:
+			return []engine.UserDetailEntry{{UserID: req.UserID, LinkedTo: meta.Details.LinkedTo}}
+		case engine.UserNotBefore:
+			return []engine.UserDetailEntry{{UserID: req.UserID, NotBefore: meta.Details.NotBefore}}
 		}
 	}
 
@@ -480,6 +540,42 @@ func (m *MemData) setUserDetail(req engine.UserDetailRequest) []engine.UserDetai
 		entry.Details.Telegram = req.Update
 		m.metaUsers[req.UserID] = entry
 		return []engine.UserDetailEntry{{UserID: req.UserID, Telegram: req.Update}}
+	case engine.UserDisplayName:
+		entry.Details.DisplayName = req.Update
+		m.metaUsers[req.UserID] = entry
+		return []engine.UserDetailEntry{{UserID: req.UserID, DisplayName: req.Update}}
+	case engine.UserPronouns:
+		entry.Details.Pronouns = req.Update
+		m.metaUsers[req.UserID] = entry
+		return []engine.UserDetailEntry{{UserID: req.UserID, Pronouns: req.Update}}
+	case engine.UserIgnored:
+		entry.Details.Ignored = req.Update
+		m.metaUsers[req.UserID] = entry
+		return []engine.UserDetailEntry{{UserID: req.UserID, Ignored: req.Update}}
+	case engine.UserLevel:
+		entry.Details.Level = req.Update
+		m.metaUsers[req.UserID] = entry
+		return []engine.UserDetailEntry{{UserID: req.UserID, Level: req.Update}}
+	case engine.UserBlockReason:
+		entry.Details.BlockReason = req.Update
+		m.metaUsers[req.UserID] = entry
+		return []engine.UserDetailEntry{{UserID: req.UserID, BlockReason: req.Update}}
+	case engine.UserPasskeys:
+		entry.Details.Passkeys = req.Update
+		m.metaUsers[req.UserID] = entry
+		return []engine.UserDetailEntry{{UserID: req.UserID, Passkeys: req.Update}}
+	case engine.UserTOTP:
+		entry.Details.TOTP = req.Update
+		m.metaUsers[req.UserID] = entry
+		return []engine.UserDetailEntry{{UserID: req.UserID, TOTP: req.Update}}
+	case engine.UserLinkedTo:
+		entry.Details.LinkedTo = req.Update
+		m.metaUsers[req.UserID] = entry
+		return []engine.UserDetailEntry{{UserID: req.UserID, LinkedTo: req.Update}}
+	case engine.UserNotBefore:
+		entry.Details.NotBefore = req.Update
+		m.metaUsers[req.UserID] = entry
+		return []engine.UserDetailEntry{{UserID: req.UserID, NotBefore: req.Update}}
 	}
 
 	return []engine.UserDetailEntry{}
@@ -518,6 +614,24 @@ func (m *MemData) deleteUserDetail(locator store.Locator, userID string, userDet
 		entry.Details.Email = ""
 	case engine.UserTelegram:
 		entry.Details.Telegram = ""
+	case engine.UserDisplayName:
+		entry.Details.DisplayName = ""
+	case engine.UserPronouns:
+		entry.Details.Pronouns = ""
+	case engine.UserIgnored:
+		entry.Details.Ignored = ""
+	case engine.UserLevel:
+		entry.Details.Level = ""
+	case engine.UserBlockReason:
+		entry.Details.BlockReason = ""
+	case engine.UserPasskeys:
+		entry.Details.Passkeys = ""
+	case engine.UserTOTP:
+		entry.Details.TOTP = ""
+	case engine.UserLinkedTo:
+		entry.Details.LinkedTo = ""
+	case engine.UserNotBefore:
+		entry.Details.NotBefore = ""
 	case engine.AllUserDetails:
 		entry.Details = engine.UserDetailEntry{UserID: userID}
 	}
@@ -521,6 +521,32 @@ func TestMemData_FlagListVerified(t *testing.T) {
 	assert.Equal(t, 0, len(ids))
 }
 
+func TestMemData_FlagRoles(t *testing.T) {
+	b := prepMem(t)
+	setRole := func(flag engine.Flag, user string, status engine.FlagStatus) {
+		_, err := b.Flag(engine.FlagRequest{Flag: flag, Locator: store.Locator{SiteID: "radio-t"}, UserID: user, Update: status})
+		require.NoError(t, err)
+	}
+
+	setRole(engine.Admin, "u1", engine.FlagTrue)
+	setRole(engine.Moderator, "u2", engine.FlagTrue)
+	ids, err := b.ListFlags(engine.FlagRequest{Flag: engine.Moderator, Locator: store.Locator{SiteID: "radio-t"}})
+	require.NoError(t, err)
+	assert.Equal(t, []any{"u2"}, ids)
+
+	v, err := b.Flag(engine.FlagRequest{Flag: engine.Admin, Locator: store.Locator{SiteID: "radio-t"}, UserID: "u1"})
+	require.NoError(t, err)
+	assert.True(t, v)
+	v, err = b.Flag(engine.FlagRequest{Flag: engine.Admin, Locator: store.Locator{SiteID: "radio-t"}, UserID: "u2"})
+	require.NoError(t, err)
+	assert.False(t, v)
+
+	setRole(engine.Moderator, "u2", engine.FlagFalse)
+	ids, err = b.ListFlags(engine.FlagRequest{Flag: engine.Moderator, Locator: store.Locator{SiteID: "radio-t"}})
+	require.NoError(t, err)
+	assert.Empty(t, ids)
+}
+
 func TestMemData_FlagListBlocked(t *testing.T) {
 	synctest.Test(t, func(t *testing.T) {
 		b := prepMem(t)
@@ -650,6 +676,23 @@ func TestMemData_DeleteHard(t *testing.T) {
 	assert.Equal(t, store.User{Name: "deleted", ID: "deleted", Picture: "", Admin: false, Blocked: false, IP: ""}, res[0].User)
 }
 
+func TestMemData_DeletePost(t *testing.T) {
+	b := prepMem(t)
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	_, err := b.Flag(engine.FlagRequest{Flag: engine.ReadOnly, Locator: locator, Update: engine.FlagTrue})
+	require.NoError(t, err)
+
+	require.NoError(t, b.Delete(engine.DeleteRequest{Locator: locator}))
+	comments, err := b.Find(engine.FindRequest{Locator: locator, Sort: "time"})
+	require.NoError(t, err)
+	assert.Empty(t, comments, "post removed")
+	ro, err := b.Flag(engine.FlagRequest{Flag: engine.ReadOnly, Locator: locator})
+	require.NoError(t, err)
+	assert.False(t, ro, "read-only status removed")
+
+	assert.Error(t, b.Delete(engine.DeleteRequest{Locator: locator}), "no post")
+}
+
 func TestMemData_DeleteAll(t *testing.T) {
 	b := prepMem(t)
 	delReq := engine.DeleteRequest{Locator: store.Locator{SiteID: "radio-t"}}
@@ -0,0 +1,123 @@
+// Package blocklist syncs shared blocklist feeds, published by other remark42 instances or maintained by
+// the community, into the local sites.
+package blocklist
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark42/backend/app/store/service"
+)
+
+// maxFeedSize limits size of a single feed
+const maxFeedSize = 16 * 1024 * 1024
+
+// Store applies feeds to the site
+type Store interface {
+	SyncBlocklistFeed(siteID, feed string, users []service.ModeratedUser, allow []string) (blocked, unblocked int, err error)
+}
+
+// Syncer loads blocklist feeds and applies them to the sites. Each feed is a http(s) url or a local file with
+// json list of users in the format of remark42 moderation export, like "/api/v1/blocklist?site=site-id"
+// of another instance.
+type Syncer struct {
+	Feeds    []string
+	Sites    []string
+	Allow    []string // ids of users never blocked by feeds
+	Store    Store
+	Client   *http.Client        // used for url feeds, http.DefaultClient if not set
+	OnUpdate func(siteID string) // called for sites changed by the sync, optional
+}
+
+// Sync loads all feeds and applies them to all sites. Feeds failed to load are skipped,
+// users they blocked before stay blocked until the next successful sync.
+func (s *Syncer) Sync(ctx context.Context) error {
+	var errs []error
+	for _, feed := range s.Feeds {
+		users, err := s.load(ctx, feed)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("can't load blocklist feed %s: %w", feed, err))
+			continue
+		}
+		for _, siteID := range s.Sites {
+			blocked, unblocked, err := s.Store.SyncBlocklistFeed(siteID, feed, users, s.Allow)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("can't apply blocklist feed %s to %s: %w", feed, siteID, err))
+			}
+			if blocked+unblocked > 0 && s.OnUpdate != nil {
+				s.OnUpdate(siteID)
+			}
+			log.Printf("[DEBUG] blocklist feed %s applied to %s, %d blocked, %d unblocked", feed, siteID, blocked, unblocked)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Run syncs feeds immediately and then every period, until ctx canceled
+func (s *Syncer) Run(ctx context.Context, period time.Duration) {
+	log.Printf("[INFO] activate blocklist feeds sync, %d feeds, period %s", len(s.Feeds), period)
+	if err := s.Sync(ctx); err != nil {
+		log.Printf("[WARN] %v", err)
+	}
+	tick := time.NewTicker(period)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			if err := s.Sync(ctx); err != nil {
+				log.Printf("[WARN] %v", err)
+			}
+		case <-ctx.Done():
+			log.Print("[DEBUG] terminated blocklist feeds sync")
+			return
+		}
+	}
+}
+
+// load reads users list from the feed
+func (s *Syncer) load(ctx context.Context, feed string) ([]service.ModeratedUser, error) {
+	rd, err := s.open(ctx, feed)
+	if err != nil {
+		return nil, err
+	}
+	defer rd.Close()
+
+	users := []service.ModeratedUser{}
+	if err := json.NewDecoder(io.LimitReader(rd, maxFeedSize)).Decode(&users); err != nil {
+		return nil, fmt.Errorf("can't decode feed: %w", err)
+	}
+	return users, nil
+}
+
+// open returns reader of url or local file feed
+func (s *Syncer) open(ctx context.Context, feed string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(feed, "http://") && !strings.HasPrefix(feed, "https://") {
+		return os.Open(feed) //nolint:gosec // feed set by the server configuration
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feed, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.Body, nil
+}
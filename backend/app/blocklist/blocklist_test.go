@@ -0,0 +1,95 @@
+package blocklist
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store/service"
+)
+
+type storeMock struct {
+	mu    sync.Mutex
+	calls map[string][]service.ModeratedUser // by site and feed
+	err   error
+}
+
+func (m *storeMock) SyncBlocklistFeed(siteID, feed string, users []service.ModeratedUser, _ []string) (blocked, unblocked int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.calls == nil {
+		m.calls = map[string][]service.ModeratedUser{}
+	}
+	m.calls[siteID+" "+feed] = users
+	return len(users), 0, m.err
+}
+
+func TestSyncer_Sync(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/bad":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/broken":
+			_, _ = w.Write([]byte("not json"))
+		default:
+			_, _ = w.Write([]byte(`[{"id":"github_1","blocked":true},{"id":"github_2","blocked":true,"until":"2030-01-01T00:00:00Z"}]`))
+		}
+	}))
+	defer ts.Close()
+
+	file := filepath.Join(t.TempDir(), "feed.json")
+	require.NoError(t, os.WriteFile(file, []byte(`[]`), 0o600))
+
+	st := &storeMock{}
+	updated := []string{}
+	s := Syncer{Feeds: []string{ts.URL + "/feed", file}, Sites: []string{"site1", "site2"}, Store: st,
+		OnUpdate: func(siteID string) { updated = append(updated, siteID) }}
+	require.NoError(t, s.Sync(context.Background()))
+
+	require.Len(t, st.calls, 4)
+	users := st.calls["site2 "+ts.URL+"/feed"]
+	require.Len(t, users, 2)
+	assert.Equal(t, "github_1", users[0].ID)
+	assert.Equal(t, time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC), users[1].Until)
+	assert.Empty(t, st.calls["site1 "+file])
+	assert.Equal(t, []string{"site1", "site2"}, updated, "sites updated by the first feed only")
+
+	// failed feeds skipped
+	st.calls = nil
+	s.Feeds = []string{ts.URL + "/bad", ts.URL + "/broken", "/no/such/file", ts.URL + "/feed"}
+	err := s.Sync(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unexpected status 500")
+	assert.Contains(t, err.Error(), "can't decode feed")
+	assert.Contains(t, err.Error(), "no such file")
+	assert.Len(t, st.calls, 2)
+
+	st.err = errors.New("store error")
+	s.Feeds = []string{ts.URL + "/feed"}
+	assert.ErrorContains(t, s.Sync(context.Background()), "can't apply blocklist feed")
+}
+
+func TestSyncer_Run(t *testing.T) {
+	var count int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		atomic.AddInt32(&count, 1)
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer ts.Close()
+
+	s := Syncer{Feeds: []string{ts.URL}, Sites: []string{"site1"}, Store: &storeMock{}}
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Millisecond)
+	defer cancel()
+	s.Run(ctx, 50*time.Millisecond)
+	assert.GreaterOrEqual(t, atomic.LoadInt32(&count), int32(2), "synced on start and by ticker")
+}
@@ -0,0 +1,271 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	cache "github.com/go-pkgz/lcw/v2"
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/engine"
+	"github.com/umputun/remark42/backend/app/store/service"
+)
+
+// BenchCommand set of flags and command for load testing of the store engine and cache with synthetic workload.
+// It generates sites, posts and users, then measures throughput of comments creation, reads and votes,
+// so operators can size hardware and compare engines. Generated sites are named bench-1, bench-2 and so on,
+// and removed after the run unless --keep set.
+type BenchCommand struct {
+	Store StoreGroup `group:"store" namespace:"store" env-namespace:"STORE"`
+	Cache CacheGroup `group:"cache" namespace:"cache" env-namespace:"CACHE"`
+
+	Sites       int  `long:"sites" env:"BENCH_SITES" default:"1" description:"number of generated sites"`
+	Posts       int  `long:"posts" env:"BENCH_POSTS" default:"100" description:"posts per site"`
+	Users       int  `long:"users" env:"BENCH_USERS" default:"1000" description:"number of commenting users"`
+	Comments    int  `long:"comments" env:"BENCH_COMMENTS" default:"10000" description:"comments to create"`
+	Finds       int  `long:"finds" env:"BENCH_FINDS" default:"10000" description:"post reads to make"`
+	Votes       int  `long:"votes" env:"BENCH_VOTES" default:"10000" description:"votes to make"`
+	Concurrency int  `long:"concurrency" env:"BENCH_CONCURRENCY" default:"8" description:"parallel workers"`
+	Keep        bool `long:"keep" env:"BENCH_KEEP" description:"keep generated sites after the run"`
+
+	out io.Writer // report destination, stdout if not set
+	CommonOpts
+}
+
+// benchResult of a single phase
+type benchResult struct {
+	name      string
+	errors    int64
+	duration  time.Duration
+	latencies []time.Duration
+}
+
+// benchWords used to generate comments text
+var benchWords = strings.Fields(`the a comment post thanks great idea agree disagree why because however remark think
+	really interesting article point server release version bug fix works nice well done more less question answer`)
+
+// Execute runs benchmark with BenchCommand parameters, entry point for "bench" command
+func (bc *BenchCommand) Execute(_ []string) error {
+	if bc.Sites <= 0 || bc.Posts <= 0 || bc.Users < 2 || bc.Concurrency <= 0 {
+		return errors.New("sites, posts and concurrency should be positive, users at least 2")
+	}
+	if bc.out == nil {
+		bc.out = os.Stdout
+	}
+
+	sites := make([]string, bc.Sites)
+	for i := range sites {
+		sites[i] = fmt.Sprintf("bench-%d", i+1)
+	}
+	srvCmd := ServerCommand{Store: bc.Store, Cache: bc.Cache, Sites: sites}
+	storeEngine, err := srvCmd.makeDataStore()
+	if err != nil {
+		return fmt.Errorf("can't make data store: %w", err)
+	}
+	loadingCache, err := srvCmd.makeCache()
+	if err != nil {
+		_ = storeEngine.Close()
+		return fmt.Errorf("can't make cache: %w", err)
+	}
+	dataService := &service.DataStore{
+		Engine:         storeEngine,
+		EditDuration:   5 * time.Minute,
+		AdminStore:     admin.NewStaticKeyStore(bc.SharedSecret),
+		MaxCommentSize: 4096,
+		MaxVotes:       service.UnlimitedVotes,
+	}
+	defer func() {
+		if !bc.Keep {
+			bc.cleanup(storeEngine, sites)
+		}
+		if e := loadingCache.Close(); e != nil {
+			log.Printf("[WARN] failed to close cache, %v", e)
+		}
+		if e := dataService.Close(); e != nil {
+			log.Printf("[WARN] failed to close data store, %v", e)
+		}
+		if !bc.Keep && bc.Store.Type == "bolt" {
+			for _, siteID := range sites {
+				if e := os.Remove(fmt.Sprintf("%s/%s.db", bc.Store.Bolt.Path, siteID)); e != nil {
+					log.Printf("[WARN] can't remove generated site file, %v", e)
+				}
+			}
+		}
+	}()
+
+	log.Printf("[INFO] start benchmark of %s store and %s cache, %d sites, %d posts per site, %d users",
+		bc.Store.Type, bc.Cache.Type, bc.Sites, bc.Posts, bc.Users)
+	res := bc.run(dataService, loadingCache, sites)
+	bc.report(res)
+	return nil
+}
+
+// run makes all phases of the benchmark, each phase starts after the previous one completed
+func (bc *BenchCommand) run(dataService *service.DataStore, loadingCache LoadingCache, sites []string) []benchResult {
+	// posts and users popularity follows zipf distribution, few of them get most of the traffic
+	var zipfLock sync.Mutex
+	rnd := rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())) //nolint:gosec // synthetic data doesn't need crypto rand
+	postsZipf := rand.NewZipf(rnd, 1.1, 1, uint64(bc.Sites*bc.Posts-1))
+	usersZipf := rand.NewZipf(rnd, 1.1, 1, uint64(bc.Users-1))
+	pick := func() (locator store.Locator, user store.User) {
+		zipfLock.Lock()
+		p, u := int(postsZipf.Uint64()), int(usersZipf.Uint64())
+		zipfLock.Unlock()
+		locator = store.Locator{SiteID: sites[p%len(sites)], URL: fmt.Sprintf("https://bench.example.com/post-%d", p/len(sites))}
+		return locator, bc.user(u)
+	}
+
+	type created struct {
+		locator store.Locator
+		id      string
+		userID  string
+	}
+	var commentsLock sync.Mutex
+	comments := make([]created, 0, bc.Comments)
+	byPost := map[store.Locator][]string{}
+
+	flush := func(locator store.Locator) {
+		loadingCache.Flush(cache.Flusher(locator.SiteID).Scopes(locator.SiteID, locator.URL))
+	}
+
+	results := make([]benchResult, 0, 3)
+	results = append(results, bc.phase("create", bc.Comments, func(_ int) error {
+		locator, user := pick()
+		comment := store.Comment{Locator: locator, User: user, Text: bc.text(), PostTitle: "Bench post " + locator.URL}
+		commentsLock.Lock()
+		if ids := byPost[locator]; len(ids) > 0 && rand.IntN(10) < 3 { //nolint:gosec // 30% of comments are replies
+			comment.ParentID = ids[rand.IntN(len(ids))] //nolint:gosec // synthetic data doesn't need crypto rand
+		}
+		commentsLock.Unlock()
+		id, err := dataService.Create(comment)
+		if err != nil {
+			return err
+		}
+		flush(locator)
+		commentsLock.Lock()
+		comments = append(comments, created{locator: locator, id: id, userID: user.ID})
+		byPost[locator] = append(byPost[locator], id)
+		commentsLock.Unlock()
+		return nil
+	}))
+
+	results = append(results, bc.phase("find", bc.Finds, func(_ int) error {
+		locator, user := pick()
+		key := cache.NewKey(locator.SiteID).ID(locator.SiteID+locator.URL).Scopes(locator.SiteID, locator.URL)
+		_, err := loadingCache.Get(key, func() ([]byte, error) {
+			res, err := dataService.Find(locator, "-time", user)
+			if err != nil {
+				res = []store.Comment{} // post without comments, same as find api
+			}
+			return json.Marshal(res)
+		})
+		return err
+	}))
+
+	if len(comments) == 0 {
+		return results
+	}
+	results = append(results, bc.phase("vote", bc.Votes, func(_ int) error {
+		_, user := pick()
+		c := comments[rand.IntN(len(comments))] //nolint:gosec // synthetic data doesn't need crypto rand
+		// users can't vote for own comments
+		for user.ID == c.userID {
+			user = bc.user(rand.IntN(bc.Users)) //nolint:gosec // synthetic data doesn't need crypto rand
+		}
+		_, err := dataService.Vote(service.VoteReq{Locator: c.locator, CommentID: c.id, UserID: user.ID,
+			Val: rand.IntN(4) > 0}) //nolint:gosec // synthetic data doesn't need crypto rand
+		if err != nil {
+			return err
+		}
+		flush(c.locator)
+		return nil
+	}))
+	return results
+}
+
+// phase calls op n times by Concurrency workers and collects latencies
+func (bc *BenchCommand) phase(name string, n int, op func(i int) error) benchResult {
+	res := benchResult{name: name, latencies: make([]time.Duration, n)}
+	var next, errs atomic.Int64
+	var wg sync.WaitGroup
+	st := time.Now()
+	for range bc.Concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := int(next.Add(1) - 1); i < n; i = int(next.Add(1) - 1) {
+				opSt := time.Now()
+				if err := op(i); err != nil {
+					errs.Add(1)
+					log.Printf("[DEBUG] %s failed, %v", name, err)
+				}
+				res.latencies[i] = time.Since(opSt)
+			}
+		}()
+	}
+	wg.Wait()
+	res.duration = time.Since(st)
+	res.errors = errs.Load()
+	log.Printf("[INFO] %s completed, %d ops in %v", name, n, res.duration)
+	return res
+}
+
+// report prints results table
+func (bc *BenchCommand) report(results []benchResult) {
+	tw := tabwriter.NewWriter(bc.out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	_, _ = fmt.Fprintln(tw, "phase\tops\terrors\ttime\tops/s\tp50\tp95\tp99\t")
+	for _, r := range results {
+		lat := slices.Clone(r.latencies)
+		slices.Sort(lat)
+		opsRate := 0.0
+		if r.duration > 0 {
+			opsRate = float64(len(lat)) / r.duration.Seconds()
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%d\t%d\t%v\t%.0f\t%v\t%v\t%v\t\n", r.name, len(lat), r.errors,
+			r.duration.Round(time.Millisecond), opsRate, percentile(lat, 50), percentile(lat, 95), percentile(lat, 99))
+	}
+	_ = tw.Flush()
+}
+
+// cleanup removes generated sites
+func (bc *BenchCommand) cleanup(storeEngine engine.Interface, sites []string) {
+	for _, siteID := range sites {
+		if err := storeEngine.Delete(engine.DeleteRequest{Locator: store.Locator{SiteID: siteID}}); err != nil {
+			log.Printf("[WARN] can't remove generated site %s, %v", siteID, err)
+		}
+	}
+}
+
+// user returns generated user by index
+func (bc *BenchCommand) user(i int) store.User {
+	return store.User{ID: fmt.Sprintf("bench_%d", i), Name: fmt.Sprintf("Bench User %d", i), IP: fmt.Sprintf("10.0.%d.%d", i/256%256, i%256)}
+}
+
+// text returns random comment text of 5-80 words
+func (bc *BenchCommand) text() string {
+	words := make([]string, 5+rand.IntN(76)) //nolint:gosec // synthetic data doesn't need crypto rand
+	for i := range words {
+		words[i] = benchWords[rand.IntN(len(benchWords))] //nolint:gosec // synthetic data doesn't need crypto rand
+	}
+	return strings.Join(words, " ")
+}
+
+// percentile of sorted durations, rounded for reporting
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[(len(sorted)-1)*p/100].Round(time.Microsecond)
+}
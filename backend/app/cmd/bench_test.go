@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBench_Execute(t *testing.T) {
+	dir := t.TempDir()
+	out := bytes.Buffer{}
+	cmd := BenchCommand{out: &out}
+	cmd.SetCommon(CommonOpts{SharedSecret: "123456"})
+	p := flags.NewParser(&cmd, flags.Default)
+	_, err := p.ParseArgs([]string{"--store.bolt.path=" + dir, "--sites=2", "--posts=5", "--users=10",
+		"--comments=100", "--finds=200", "--votes=100", "--concurrency=4"})
+	require.NoError(t, err)
+	require.NoError(t, cmd.Execute(nil))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 4)
+	assert.Equal(t, []string{"phase", "ops", "errors", "time", "ops/s", "p50", "p95", "p99"}, strings.Fields(lines[0]))
+	for i, phase := range []string{"create", "find", "vote"} {
+		fields := strings.Fields(lines[i+1])
+		require.Len(t, fields, 8)
+		assert.Equal(t, phase, fields[0])
+	}
+	assert.Equal(t, []string{"create", "100", "0"}, strings.Fields(lines[1])[:3])
+	assert.Equal(t, []string{"find", "200", "0"}, strings.Fields(lines[2])[:3])
+	assert.Equal(t, "100", strings.Fields(lines[3])[1])
+
+	files, err := filepath.Glob(filepath.Join(dir, "bench-*.db"))
+	require.NoError(t, err)
+	assert.Empty(t, files, "generated sites removed")
+}
+
+func TestBench_ExecuteKeep(t *testing.T) {
+	dir := t.TempDir()
+	cmd := BenchCommand{out: &bytes.Buffer{}}
+	p := flags.NewParser(&cmd, flags.Default)
+	_, err := p.ParseArgs([]string{"--store.bolt.path=" + dir, "--cache.type=none", "--posts=2", "--users=3",
+		"--comments=10", "--finds=10", "--votes=0", "--keep"})
+	require.NoError(t, err)
+	require.NoError(t, cmd.Execute(nil))
+	_, err = os.Stat(filepath.Join(dir, "bench-1.db"))
+	assert.NoError(t, err, "generated site kept")
+}
+
+func TestBench_ExecuteFailed(t *testing.T) {
+	cmd := BenchCommand{out: &bytes.Buffer{}}
+	p := flags.NewParser(&cmd, flags.Default)
+	_, err := p.ParseArgs([]string{"--users=1"})
+	require.NoError(t, err)
+	assert.EqualError(t, cmd.Execute(nil), "sites, posts and concurrency should be positive, users at least 2")
+}
+
+func TestBench_percentile(t *testing.T) {
+	assert.Equal(t, 0*time.Second, percentile(nil, 50))
+	lat := make([]time.Duration, 100)
+	for i := range lat {
+		lat[i] = time.Duration(i+1) * time.Millisecond
+	}
+	assert.Equal(t, 50*time.Millisecond, percentile(lat, 50))
+	assert.Equal(t, 95*time.Millisecond, percentile(lat, 95))
+	assert.Equal(t, 100*time.Millisecond, percentile(lat, 100))
+}
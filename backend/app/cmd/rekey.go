@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	log "github.com/go-pkgz/lgr"
+)
+
+// RekeyCommand set of flags and command for re-encryption of sensitive user details with the current key,
+// used after rotation of encryption key. Server should run with the new key and the old one in the list of old keys.
+type RekeyCommand struct {
+	SupportCmdOpts
+	CommonOpts
+}
+
+// Execute runs re-encryption with RekeyCommand parameters, entry point for "rekey" command
+func (rc *RekeyCommand) Execute(_ []string) error {
+	log.Printf("[INFO] start re-encryption of user details, site %s", rc.Site)
+	resetEnv("SECRET", "ADMIN_PASSWD")
+
+	client := http.Client{}
+	defer client.CloseIdleConnections()
+	ctx, cancel := context.WithTimeout(context.Background(), rc.Timeout)
+	defer cancel()
+	rekeyURL := fmt.Sprintf("%s/api/v1/admin/reencrypt?site=%s", rc.RemarkURL, rc.Site)
+	req, err := http.NewRequest(http.MethodPost, rekeyURL, http.NoBody) //nolint:gosec // RemarkURL is operator CLI flag, not user input
+	if err != nil {
+		return fmt.Errorf("can't make re-encryption request for %s: %w", rekeyURL, err)
+	}
+	req.SetBasicAuth("admin", rc.AdminPasswd)
+
+	resp, err := client.Do(req.WithContext(ctx)) //nolint:gosec // see above
+	if err != nil {
+		return fmt.Errorf("request failed for %s: %w", rekeyURL, err)
+	}
+	defer func() {
+		if err = resp.Body.Close(); err != nil {
+			log.Printf("[WARN] failed to close response, %s", err)
+		}
+	}()
+	if resp.StatusCode >= 300 {
+		return responseError(resp)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("can't get response: %w", err)
+	}
+
+	log.Printf("[INFO] completed, status=%d, %s", resp.StatusCode, string(body))
+	return nil
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+)
+
+// RerenderCommand set of flags and command for re-rendering of all comments of the site from the original markdown
+// with the current formatter, used to fix comments rendered by older formatter with a bug. Re-rendering runs on the
+// server in background, the command waits for its completion.
+type RerenderCommand struct {
+	SupportCmdOpts
+	CommonOpts
+
+	pollInterval time.Duration
+}
+
+// rerenderStatus is the state of re-rendering reported by the server
+type rerenderStatus struct {
+	Running bool   `json:"running"`
+	Done    int    `json:"done"`
+	Total   int    `json:"total"`
+	Updated int    `json:"updated"`
+	Failed  int    `json:"failed"`
+	Error   string `json:"error"`
+}
+
+// Execute runs re-rendering with RerenderCommand parameters, entry point for "rerender" command
+func (rc *RerenderCommand) Execute(_ []string) error {
+	log.Printf("[INFO] start re-rendering of comments, site %s", rc.Site)
+	resetEnv("SECRET", "ADMIN_PASSWD")
+
+	client := http.Client{}
+	defer client.CloseIdleConnections()
+	ctx, cancel := context.WithTimeout(context.Background(), rc.Timeout)
+	defer cancel()
+	rerenderURL := fmt.Sprintf("%s/api/v1/admin/rerender?site=%s", rc.RemarkURL, rc.Site)
+
+	status, err := rc.call(ctx, &client, http.MethodPost, rerenderURL)
+	if err != nil {
+		return err
+	}
+
+	interval := rc.pollInterval
+	if interval == 0 {
+		interval = time.Second
+	}
+	for status.Running {
+		select {
+		case <-ctx.Done():
+		case <-time.After(interval):
+			status, err = rc.call(ctx, &client, http.MethodGet, rerenderURL)
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("re-rendering not completed in %v, still running on the server: %w", rc.Timeout, ctx.Err())
+		}
+		if err != nil {
+			return err
+		}
+		log.Printf("[DEBUG] re-rendered %d of %d posts", status.Done, status.Total)
+	}
+
+	if status.Error != "" {
+		return fmt.Errorf("re-rendering failed, %d posts of %d done, %d comments updated: %s", status.Done, status.Total,
+			status.Updated, status.Error)
+	}
+	log.Printf("[INFO] completed, %d posts, %d comments updated, %d failed", status.Total, status.Updated, status.Failed)
+	return nil
+}
+
+// call makes request to the re-rendering endpoint and returns reported status
+func (rc *RerenderCommand) call(ctx context.Context, client *http.Client, method, rerenderURL string) (rerenderStatus, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rerenderURL, http.NoBody) //nolint:gosec // RemarkURL is operator CLI flag, not user input
+	if err != nil {
+		return rerenderStatus{}, fmt.Errorf("can't make re-rendering request for %s: %w", rerenderURL, err)
+	}
+	req.SetBasicAuth("admin", rc.AdminPasswd)
+
+	resp, err := client.Do(req) //nolint:gosec // see above
+	if err != nil {
+		return rerenderStatus{}, fmt.Errorf("request failed for %s: %w", rerenderURL, err)
+	}
+	defer func() {
+		if err = resp.Body.Close(); err != nil {
+			log.Printf("[WARN] failed to close response, %s", err)
+		}
+	}()
+	if resp.StatusCode >= 300 {
+		return rerenderStatus{}, responseError(resp)
+	}
+
+	status := rerenderStatus{}
+	if err = json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return rerenderStatus{}, fmt.Errorf("can't decode re-rendering status: %w", err)
+	}
+	return status, nil
+}
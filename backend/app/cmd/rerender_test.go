@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRerender_Execute(t *testing.T) {
+	var polls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/admin/rerender", r.URL.Path)
+		assert.Equal(t, "remark", r.URL.Query().Get("site"))
+		auth, err := base64.StdEncoding.DecodeString(strings.Split(r.Header.Get("Authorization"), " ")[1])
+		require.NoError(t, err)
+		assert.Equal(t, "admin:secret", string(auth))
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusAccepted)
+			fmt.Fprint(w, `{"site":"remark","running":true,"total":3}`)
+			return
+		}
+		assert.Equal(t, http.MethodGet, r.Method)
+		if atomic.AddInt32(&polls, 1) < 2 {
+			fmt.Fprint(w, `{"site":"remark","running":true,"done":1,"total":3}`)
+			return
+		}
+		fmt.Fprint(w, `{"site":"remark","running":false,"done":3,"total":3,"updated":5}`)
+	}))
+	defer ts.Close()
+
+	cmd := RerenderCommand{pollInterval: time.Millisecond}
+	cmd.SetCommon(CommonOpts{RemarkURL: ts.URL, SharedSecret: "123456"})
+
+	p := flags.NewParser(&cmd, flags.Default)
+	_, err := p.ParseArgs([]string{"--site=remark", "--admin-passwd=secret"})
+	require.NoError(t, err)
+	assert.NoError(t, cmd.Execute(nil))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&polls))
+}
+
+func TestRerender_ExecuteFailed(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			fmt.Fprint(w, `{"site":"remark","running":true,"total":3}`)
+			return
+		}
+		fmt.Fprint(w, `{"site":"remark","running":false,"done":3,"total":3,"error":"can't get comments of post1"}`)
+	}))
+	defer ts.Close()
+
+	cmd := RerenderCommand{pollInterval: time.Millisecond}
+	cmd.SetCommon(CommonOpts{RemarkURL: ts.URL})
+	p := flags.NewParser(&cmd, flags.Default)
+	_, err := p.ParseArgs([]string{"--site=remark", "--admin-passwd=secret"})
+	require.NoError(t, err)
+	err = cmd.Execute(nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "can't get comments of post1")
+
+	ts2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error":"rendering is not set"}`)
+	}))
+	defer ts2.Close()
+	cmd.SetCommon(CommonOpts{RemarkURL: ts2.URL})
+	err = cmd.Execute(nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "rendering is not set")
+}
+
+func TestRerender_ExecuteTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `{"site":"remark","running":true,"total":3}`)
+	}))
+	defer ts.Close()
+
+	cmd := RerenderCommand{pollInterval: time.Millisecond}
+	cmd.SetCommon(CommonOpts{RemarkURL: ts.URL})
+	p := flags.NewParser(&cmd, flags.Default)
+	_, err := p.ParseArgs([]string{"--site=remark", "--admin-passwd=secret", "--timeout=50ms"})
+	require.NoError(t, err)
+	err = cmd.Execute(nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "still running on the server")
+}
@@ -3,17 +3,23 @@ package cmd
 import (
 	"context"
 	"crypto/sha1" //nolint:gosec // used only for stable ID hashing, not for security
+	"crypto/tls"
+	"crypto/x509"
 	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
+	"net/mail"
 	"net/url"
 	"os"
 	"os/signal"
 	"path"
 	"regexp"
 	"slices"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -34,17 +40,42 @@ import (
 	"github.com/go-pkgz/auth/v2/token"
 	cache "github.com/go-pkgz/lcw/v2"
 
+	"github.com/umputun/remark42/backend/app/blocklist"
+	"github.com/umputun/remark42/backend/app/geoip"
+	"github.com/umputun/remark42/backend/app/integrity"
+	"github.com/umputun/remark42/backend/app/iplist"
 	"github.com/umputun/remark42/backend/app/migrator"
+	"github.com/umputun/remark42/backend/app/msgbus"
 	"github.com/umputun/remark42/backend/app/notify"
+	"github.com/umputun/remark42/backend/app/plugin"
 	"github.com/umputun/remark42/backend/app/providers"
+	"github.com/umputun/remark42/backend/app/resilient"
+	"github.com/umputun/remark42/backend/app/rest"
 	"github.com/umputun/remark42/backend/app/rest/api"
+	"github.com/umputun/remark42/backend/app/rest/cdn"
 	"github.com/umputun/remark42/backend/app/rest/proxy"
+	"github.com/umputun/remark42/backend/app/rest/shadow"
 	"github.com/umputun/remark42/backend/app/safehttp"
+	"github.com/umputun/remark42/backend/app/scheduler"
+	"github.com/umputun/remark42/backend/app/sitemap"
 	"github.com/umputun/remark42/backend/app/store"
 	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/asset"
+	"github.com/umputun/remark42/backend/app/store/bot"
+	"github.com/umputun/remark42/backend/app/store/brigade"
+	"github.com/umputun/remark42/backend/app/store/cold"
 	"github.com/umputun/remark42/backend/app/store/engine"
+	"github.com/umputun/remark42/backend/app/store/event"
+	"github.com/umputun/remark42/backend/app/store/highlight"
 	"github.com/umputun/remark42/backend/app/store/image"
+	"github.com/umputun/remark42/backend/app/store/invite"
+	"github.com/umputun/remark42/backend/app/store/page"
+	"github.com/umputun/remark42/backend/app/store/poll"
+	"github.com/umputun/remark42/backend/app/store/quota"
+	"github.com/umputun/remark42/backend/app/store/schedule"
 	"github.com/umputun/remark42/backend/app/store/service"
+	"github.com/umputun/remark42/backend/app/store/settings"
+	"github.com/umputun/remark42/backend/app/store/suppress"
 	"github.com/umputun/remark42/backend/app/templates"
 )
 
@@ -56,44 +87,102 @@ type ServerCommand struct {
 	Store      StoreGroup      `group:"store" namespace:"store" env-namespace:"STORE"`
 	Avatar     AvatarGroup     `group:"avatar" namespace:"avatar" env-namespace:"AVATAR"`
 	Cache      CacheGroup      `group:"cache" namespace:"cache" env-namespace:"CACHE"`
+	CDN        CDNGroup        `group:"cdn" namespace:"cdn" env-namespace:"CDN"`
 	Admin      AdminGroup      `group:"admin" namespace:"admin" env-namespace:"ADMIN"`
 	Notify     NotifyGroup     `group:"notify" namespace:"notify" env-namespace:"NOTIFY"`
 	SMTP       SMTPGroup       `group:"smtp" namespace:"smtp" env-namespace:"SMTP"`
+	EmailAPI   EmailAPIGroup   `group:"email-api" namespace:"email-api" env-namespace:"EMAIL_API"`
+	Suppress   SuppressGroup   `group:"suppress" namespace:"suppress" env-namespace:"SUPPRESS"`
 	Telegram   TelegramGroup   `group:"telegram" namespace:"telegram" env-namespace:"TELEGRAM"`
 	Image      ImageGroup      `group:"image" namespace:"image" env-namespace:"IMAGE"`
 	SSL        SSLGroup        `group:"ssl" namespace:"ssl" env-namespace:"SSL"`
 	ImageProxy ImageProxyGroup `group:"image-proxy" namespace:"image-proxy" env-namespace:"IMAGE_PROXY"`
+	Profile    ProfileGroup    `group:"profile" namespace:"profile" env-namespace:"PROFILE"`
+	Lang       LangGroup       `group:"lang" namespace:"lang" env-namespace:"LANG"`
+	Welcome    WelcomeGroup    `group:"welcome" namespace:"welcome" env-namespace:"WELCOME"`
+	LateThread LateThreadGroup `group:"late-thread" namespace:"late-thread" env-namespace:"LATE_THREAD"`
+	Polls      PollsGroup      `group:"polls" namespace:"polls" env-namespace:"POLLS"`
+	Highlights HighlightsGroup `group:"highlights" namespace:"highlights" env-namespace:"HIGHLIGHTS"`
+	Events     EventsGroup     `group:"events" namespace:"events" env-namespace:"EVENTS"`
+	EventBus   EventBusGroup   `group:"event-bus" namespace:"event-bus" env-namespace:"EVENT_BUS"`
+	Quota      QuotaGroup      `group:"quota" namespace:"quota" env-namespace:"QUOTA"`
+	Invite     InviteGroup     `group:"invite" namespace:"invite" env-namespace:"INVITE"`
+	Bots       BotsGroup       `group:"bots" namespace:"bots" env-namespace:"BOTS"`
+	PageCheck  PageCheckGroup  `group:"page-check" namespace:"page-check" env-namespace:"PAGE_CHECK"`
+	Schedule   ScheduleGroup   `group:"schedule" namespace:"schedule" env-namespace:"SCHEDULE"`
+	Cold       ColdGroup       `group:"cold" namespace:"cold" env-namespace:"COLD"`
+	Integrity  IntegrityGroup  `group:"integrity" namespace:"integrity" env-namespace:"INTEGRITY"`
+	Pages      PagesGroup      `group:"pages" namespace:"pages" env-namespace:"PAGES"`
+	Settings   SettingsGroup   `group:"settings" namespace:"settings" env-namespace:"SETTINGS"`
+	PoW        PoWGroup        `group:"pow" namespace:"pow" env-namespace:"POW"`
+	Captcha    CaptchaGroup    `group:"captcha" namespace:"captcha" env-namespace:"CAPTCHA"`
+	Geo        GeoGroup        `group:"geo" namespace:"geo" env-namespace:"GEO"`
+	ExitNodes  ExitNodesGroup  `group:"exit-nodes" namespace:"exit-nodes" env-namespace:"EXIT_NODES"`
+	Reputation ReputationGroup `group:"reputation" namespace:"reputation" env-namespace:"REPUTATION"`
+	Levels     LevelsGroup     `group:"levels" namespace:"levels" env-namespace:"LEVELS"`
+	Brigade    BrigadeGroup    `group:"brigade" namespace:"brigade" env-namespace:"BRIGADE"`
+	PII        PIIGroup        `group:"pii" namespace:"pii" env-namespace:"PII"`
+	Encrypt    EncryptGroup    `group:"encrypt" namespace:"encrypt" env-namespace:"ENCRYPT"`
+	Blocklist  BlocklistGroup  `group:"blocklist" namespace:"blocklist" env-namespace:"BLOCKLIST"`
+	Shadow     ShadowGroup     `group:"shadow" namespace:"shadow" env-namespace:"SHADOW"`
+	Assets     AssetsGroup     `group:"assets" namespace:"assets" env-namespace:"ASSETS"`
+	CSP        CSPGroup        `group:"csp" namespace:"csp" env-namespace:"CSP"`
+	CORS       CORSGroup       `group:"cors" namespace:"cors" env-namespace:"CORS"`
+	Limits     LimitsGroup     `group:"limits" namespace:"limits" env-namespace:"LIMITS"`
+	Plugins    PluginsGroup    `group:"plugins" namespace:"plugins" env-namespace:"PLUGINS"`
+	Expr       ExprGroup       `group:"expr" namespace:"expr" env-namespace:"EXPR"`
 
 	Sites                      []string      `long:"site" env:"SITE" default:"remark" description:"site names" env-delim:","`
 	AnonymousVote              bool          `long:"anon-vote" env:"ANON_VOTE" description:"enable anonymous votes (works only with VOTES_IP enabled)"`
 	AdminPasswd                string        `long:"admin-passwd" env:"ADMIN_PASSWD" default:"" description:"admin basic auth password"`
 	BackupLocation             string        `long:"backup" env:"BACKUP_PATH" default:"./var/backup" description:"backups location"`
 	MaxBackupFiles             int           `long:"max-back" env:"MAX_BACKUP_FILES" default:"10" description:"max backups to keep"`
+	BackupVerify               bool          `long:"backup-verify" env:"BACKUP_VERIFY" description:"verify backups by test restore, alert admins on unusable ones"`
 	LegacyImageProxy           bool          `long:"img-proxy" env:"IMG_PROXY" description:"[deprecated, use image-proxy.http2https] enable image proxy"`
 	MinCommentSize             int           `long:"min-comment" env:"MIN_COMMENT_SIZE" default:"0" description:"min comment size"`
 	MaxCommentSize             int           `long:"max-comment" env:"MAX_COMMENT_SIZE" default:"2048" description:"max comment size"`
+	MaxCommentLinks            int           `long:"max-comment-links" env:"MAX_COMMENT_LINKS" default:"0" description:"max links in a comment, 0 for unlimited"`
+	MaxCommentImages           int           `long:"max-comment-images" env:"MAX_COMMENT_IMAGES" default:"0" description:"max images in a comment, 0 for unlimited"`
+	MaxQuoteRatio              float64       `long:"max-quote-ratio" env:"MAX_QUOTE_RATIO" default:"0" description:"max share of quoted text in a comment, 0..1, 0 for unlimited"`
 	MaxVotes                   int           `long:"max-votes" env:"MAX_VOTES" default:"-1" description:"maximum number of votes per comment"`
 	RestrictVoteIP             bool          `long:"votes-ip" env:"VOTES_IP" description:"restrict votes from the same ip"`
 	DurationVoteIP             time.Duration `long:"votes-ip-time" env:"VOTES_IP_TIME" default:"5m" description:"same ip vote duration"`
 	LowScore                   int           `long:"low-score" env:"LOW_SCORE" default:"-5" description:"low score threshold"`
 	CriticalScore              int           `long:"critical-score" env:"CRITICAL_SCORE" default:"-10" description:"critical score threshold"`
+	ControversyScore           float64       `long:"controversy-score" env:"CONTROVERSY_SCORE" default:"0" description:"controversy threshold of controversial comments, 0 - disabled"`
+	CollapseMode               string        `long:"collapse-mode" env:"COLLAPSE_MODE" description:"handling of comments scored below collapse-score" choice:"off" choice:"collapse" choice:"hide" default:"off"` // nolint
+	CollapseScore              int           `long:"collapse-score" env:"COLLAPSE_SCORE" default:"-5" description:"comments scored below it are collapsed or hidden"`
 	PositiveScore              bool          `long:"positive-score" env:"POSITIVE_SCORE" description:"enable positive score only"`
 	ReadOnlyAge                int           `long:"read-age" env:"READONLY_AGE" default:"0" description:"read-only age of comments, days"`
 	EditDuration               time.Duration `long:"edit-time" env:"EDIT_TIME" default:"5m" description:"edit window; set to 0 to disable comment editing and staged image cleanup"`
+	EditDurationVerified       time.Duration `long:"edit-time-verified" env:"EDIT_TIME_VERIFIED" description:"edit window for verified users, edit-time used if not set"`
+	EditDurationAdmin          time.Duration `long:"edit-time-admin" env:"EDIT_TIME_ADMIN" description:"edit window for admins' own comments, edit-time used if not set"`
+	AuthorDelete               string        `long:"author-delete" env:"AUTHOR_DELETE" description:"when authors can delete own comments" choice:"edit-window" choice:"always" choice:"tombstone" default:"edit-window"` // nolint
 	AdminEdit                  bool          `long:"admin-edit" env:"ADMIN_EDIT" description:"unlimited edit for admins"`
 	Port                       int           `long:"port" env:"REMARK_PORT" default:"8080" description:"port"`
 	Address                    string        `long:"address" env:"REMARK_ADDRESS" default:"" description:"listening address"`
+	AdminListen                string        `long:"admin-listen" env:"ADMIN_LISTEN" description:"address:port of separate admin server with admin api, admin api not served on public port if set"`
+	AdminPprof                 bool          `long:"admin-pprof" env:"ADMIN_PPROF" description:"serve profiler and runtime metrics on admin server to basic auth admin"`
+	UnixSocket                 string        `long:"unix-socket" env:"UNIX_SOCKET" description:"unix socket path to listen on instead of address and port"`
+	UnixSocketMode             string        `long:"unix-socket-mode" env:"UNIX_SOCKET_MODE" default:"0660" description:"permissions of unix socket file, octal"`
+	SocketActivation           bool          `long:"socket-activation" env:"SOCKET_ACTIVATION" description:"listen on socket passed by systemd socket activation instead of address and port"`
 	WebRoot                    string        `long:"web-root" env:"REMARK_WEB_ROOT" default:"./web" description:"web root directory"`
 	UpdateLimit                float64       `long:"update-limit" env:"UPDATE_LIMIT" default:"0.5" description:"updates/sec limit"`
 	TrustedProxies             []string      `long:"trusted-proxy" env:"TRUSTED_PROXY" description:"reverse-proxy networks (CIDR or IP) trusted to set the client IP; if unset, trusted from any client (see docs)" env-delim:","`
+	TrustedProxyHeader         string        `long:"trusted-proxy-header" env:"TRUSTED_PROXY_HEADER" description:"the only header trusted proxies set the client IP in, any if empty" choice:"" choice:"X-Real-IP" choice:"X-Forwarded-For" choice:"CF-Connecting-IP"` // nolint
 	RestrictedWords            []string      `long:"restricted-words" env:"RESTRICTED_WORDS" description:"words prohibited to use in comments" env-delim:","`
 	RestrictedNames            []string      `long:"restricted-names" env:"RESTRICTED_NAMES" description:"names prohibited to use by user" env-delim:","`
+	CannedResponses            []string      `long:"canned-response" env:"CANNED_RESPONSES" description:"default moderator canned responses, as id:text" env-delim:";"`
+	ClientStats                bool          `long:"client-stats" env:"CLIENT_STATS" description:"collect aggregated stats of commenting clients, browser families and referrer domains"`
+	Timezones                  []string      `long:"timezone" env:"TIMEZONE" description:"timezone for dates in emails and feeds, as zone for all sites or site:zone" env-delim:","`
 	EnableEmoji                bool          `long:"emoji" env:"EMOJI" description:"enable emoji"`
 	SimpleView                 bool          `long:"simple-view" env:"SIMPLE_VIEW" description:"minimal comment editor mode"`
 	ProxyCORS                  bool          `long:"proxy-cors" env:"PROXY_CORS" description:"disable internal CORS and delegate it to proxy"`
 	AllowedHosts               []string      `long:"allowed-hosts" env:"ALLOWED_HOSTS" description:"limit hosts/sources allowed to embed comments via CSP 'frame-ancestors'" env-delim:","`
 	SubscribersOnly            bool          `long:"subscribers-only" env:"SUBSCRIBERS_ONLY" description:"enable commenting only for Patreon subscribers"`
 	DisableSignature           bool          `long:"disable-signature" env:"DISABLE_SIGNATURE" description:"disable server signature in headers"`
+	Maintenance                bool          `long:"maintenance" env:"MAINTENANCE" description:"start in read-only maintenance mode for all sites, toggled by admin api at runtime"`
+	MaintenanceMessage         string        `long:"maintenance-message" env:"MAINTENANCE_MESSAGE" description:"message shown to users in maintenance mode"`
 	DisableFancyTextFormatting bool          `long:"disable-fancy-text-formatting" env:"DISABLE_FANCY_TEXT_FORMATTING" description:"disable fancy comments text formatting (replacement of quotes, dashes, fractions, etc)"`
 
 	Auth struct {
@@ -105,19 +194,37 @@ type ServerCommand struct {
 		SendJWTHeader bool   `long:"send-jwt-header" env:"SEND_JWT_HEADER" description:"send JWT as a header instead of server-set cookie; with this enabled, frontend stores the JWT in a client-side cookie (note: increases vulnerability to XSS attacks)"`
 		SameSite      string `long:"same-site" env:"SAME_SITE" description:"set same site policy for cookies" choice:"default" choice:"none" choice:"lax" choice:"strict" default:"default"` // nolint
 
+		JWTKeys []string `long:"jwt-key" env:"JWT_KEY" env-delim:"," description:"PEM private key files signing tokens for other services with RS256 or ES256, the first one signs, the rest are published for rotation"` // nolint
+
+		PreviousSecret    string        `long:"previous-secret" env:"PREVIOUS_SECRET" description:"previous shared secret, tokens signed with it accepted and re-signed during rotation"`
+		PreviousSecretTTL time.Duration `long:"previous-secret-ttl" env:"PREVIOUS_SECRET_TTL" default:"168h" description:"grace window of the previous secret since the server start"`
+
 		Apple     AppleGroup         `group:"apple" namespace:"apple" env-namespace:"APPLE" description:"Apple OAuth"`
 		Google    AuthGroup          `group:"google" namespace:"google" env-namespace:"GOOGLE" description:"Google OAuth"`
 		Github    AuthGroup          `group:"github" namespace:"github" env-namespace:"GITHUB" description:"Github OAuth"`
+		Gitlab    GitlabAuthGroup    `group:"gitlab" namespace:"gitlab" env-namespace:"GITLAB" description:"GitLab OAuth"`
 		Facebook  AuthGroup          `group:"facebook" namespace:"facebook" env-namespace:"FACEBOOK" description:"Facebook OAuth"`
 		Microsoft MicrosoftAuthGroup `group:"microsoft" namespace:"microsoft" env-namespace:"MICROSOFT" description:"Microsoft OAuth"`
 		Yandex    AuthGroup          `group:"yandex" namespace:"yandex" env-namespace:"YANDEX" description:"Yandex OAuth"`
 		Twitter   AuthGroup          `group:"twitter" namespace:"twitter" env-namespace:"TWITTER" description:"[deprecated, doesn't work] Twitter OAuth"`
 		Patreon   AuthGroup          `group:"patreon" namespace:"patreon" env-namespace:"PATREON" description:"Patreon OAuth"`
 		Discord   AuthGroup          `group:"discord" namespace:"discord" env-namespace:"DISCORD" description:"Discord OAuth"`
+		Twitch    AuthGroup          `group:"twitch" namespace:"twitch" env-namespace:"TWITCH" description:"Twitch OAuth"`
+		VK        AuthGroup          `group:"vk" namespace:"vk" env-namespace:"VK" description:"VK OAuth"`
+		WeChat    AuthGroup          `group:"wechat" namespace:"wechat" env-namespace:"WECHAT" description:"WeChat QR-code login"`
 		Custom    CustomAuthGroup    `group:"custom" namespace:"custom" env-namespace:"CUSTOM" description:"Custom OAuth2 provider"`
+		OIDC      OIDCAuthGroup      `group:"oidc" namespace:"oidc" env-namespace:"OIDC" description:"OpenID Connect provider"`
+		SAML      SAMLAuthGroup      `group:"saml" namespace:"saml" env-namespace:"SAML" description:"SAML 2.0 identity provider"`
+		LDAP      LDAPAuthGroup      `group:"ldap" namespace:"ldap" env-namespace:"LDAP" description:"LDAP or Active Directory direct provider"`
+		Mastodon  MastodonAuthGroup  `group:"mastodon" namespace:"mastodon" env-namespace:"MASTODON" description:"Mastodon and fediverse OAuth"`
+		Steam     SteamAuthGroup     `group:"steam" namespace:"steam" env-namespace:"STEAM" description:"Steam OpenID"`
+		Reddit    RedditAuthGroup    `group:"reddit" namespace:"reddit" env-namespace:"REDDIT" description:"Reddit OAuth"`
+		WebAuthn  WebAuthnAuthGroup  `group:"webauthn" namespace:"webauthn" env-namespace:"WEBAUTHN" description:"WebAuthn passkeys"`
+		SMS       SMSAuthGroup       `group:"sms" namespace:"sms" env-namespace:"SMS" description:"one-time code by SMS"`
 		Telegram  bool               `long:"telegram" env:"TELEGRAM" description:"Enable Telegram auth (using token from telegram.token)"`
 		Dev       bool               `long:"dev" env:"DEV" description:"enable dev (local) oauth2"`
 		Anonymous bool               `long:"anon" env:"ANON" description:"enable anonymous login"`
+		AnonLimit float64            `long:"anon-limit" env:"ANON_LIMIT" description:"comments per minute allowed to each anonymous user, unlimited if 0"`
 		Email     struct {
 			Enable       bool          `long:"enable" env:"ENABLE" description:"enable auth via email"`
 			From         string        `long:"from" env:"FROM" description:"from email address"`
@@ -137,12 +244,280 @@ type ServerCommand struct {
 
 	emailMsgTemplatePath          string // used only in tests
 	emailVerificationTemplatePath string // used only in tests
+
+	remotes []*resilient.Transport // transports of remote stores, made by makeRPCClient
 }
 
 // ImageProxyGroup defines options group for image proxy
 type ImageProxyGroup struct {
-	HTTP2HTTPS    bool `long:"http2https" env:"HTTP2HTTPS" description:"enable HTTP->HTTPS proxy"`
-	CacheExternal bool `long:"cache-external" env:"CACHE_EXTERNAL" description:"enable caching for external images"`
+	HTTP2HTTPS    bool   `long:"http2https" env:"HTTP2HTTPS" description:"enable HTTP->HTTPS proxy"`
+	CacheExternal bool   `long:"cache-external" env:"CACHE_EXTERNAL" description:"enable caching for external images"`
+	CDNOrigin     bool   `long:"cdn-origin" env:"CDN_ORIGIN" description:"serve external images on immutable content-hash paths for CDN"`
+	CDNURL        string `long:"cdn-url" env:"CDN_URL" description:"url of CDN in front of remark42 used in image links"`
+}
+
+// ProfileGroup defines options for user-selected display name and pronouns
+type ProfileGroup struct {
+	Enabled     bool     `long:"enabled" env:"ENABLED" description:"allow users to set display name and pronouns"`
+	UniqueNames bool     `long:"unique-names" env:"UNIQUE_NAMES" description:"reject display names used by another user"`
+	MaxNameLen  int      `long:"max-name-len" env:"MAX_NAME_LEN" default:"64" description:"max display name length"`
+	BannedNames []string `long:"banned-names" env:"BANNED_NAMES" description:"display names prohibited to use, in addition to restricted-names" env-delim:","`
+}
+
+// LangGroup defines options for per-language moderation rules
+type LangGroup struct {
+	Allowed         []string `long:"allowed" env:"ALLOWED" description:"allowed comment languages, all languages allowed if empty" env-delim:","`
+	Reject          bool     `long:"reject" env:"REJECT" description:"reject comments in not allowed languages instead of holding them for review"`
+	RestrictedWords []string `long:"restricted-words" env:"RESTRICTED_WORDS" description:"language-specific restricted words, as lang:word" env-delim:","`
+}
+
+// WelcomeGroup defines options for first-comment welcome workflow
+type WelcomeGroup struct {
+	Enabled bool   `long:"enabled" env:"ENABLED" description:"mark first comment of the user with new member badge"`
+	Message string `long:"message" env:"MESSAGE" description:"welcome message template emailed to the author of the first comment"`
+}
+
+// LateThreadGroup defines options for comments on old threads
+type LateThreadGroup struct {
+	Age            int  `long:"age" env:"AGE" default:"0" description:"mark comments on threads older than that as late, in months, disabled if 0"`
+	SuppressNotify bool `long:"suppress-notify" env:"SUPPRESS_NOTIFY" description:"don't notify thread watchers about late comments"`
+}
+
+// PollsGroup defines options for polls attached to posts
+type PollsGroup struct {
+	Enabled bool   `long:"enabled" env:"ENABLED" description:"enable polls attached to posts"`
+	File    string `long:"file" env:"FILE" default:"./var/polls.db" description:"polls bolt file location"`
+}
+
+// HighlightsGroup defines options for admin-curated highlighted comments
+type HighlightsGroup struct {
+	Enabled bool   `long:"enabled" env:"ENABLED" description:"enable highlighted comments"`
+	File    string `long:"file" env:"FILE" default:"./var/highlights.db" description:"highlights bolt file location"`
+}
+
+// EventsGroup defines options for the journal of domain events
+type EventsGroup struct {
+	Enabled bool          `long:"enabled" env:"ENABLED" description:"enable events journal"`
+	File    string        `long:"file" env:"FILE" default:"./var/events.db" description:"events bolt file location"`
+	Keep    time.Duration `long:"keep" env:"KEEP" default:"2160h" description:"keep events for the period, forever if 0"`
+}
+
+// EventBusGroup defines message bus domain events published to
+type EventBusGroup struct {
+	Type    string        `long:"type" env:"TYPE" description:"message bus type" choice:"none" choice:"nats" choice:"kafka" default:"none"` // nolint
+	Servers []string      `long:"servers" env:"SERVERS" description:"nats urls or kafka brokers" env-delim:","`
+	Topic   string        `long:"topic" env:"TOPIC" default:"remark42.{site}.{type}" description:"topic template, with {site} and {type} of event"`
+	Format  string        `long:"format" env:"FORMAT" description:"events format" choice:"json" choice:"avro" default:"json"`
+	Timeout time.Duration `long:"timeout" env:"TIMEOUT" default:"5s" description:"max time to connect and publish an event"`
+}
+
+// QuotaGroup defines per-site usage quotas with default limits and their enforcement
+type QuotaGroup struct {
+	Enabled       bool          `long:"enabled" env:"ENABLED" description:"enable per-site usage quotas"`
+	File          string        `long:"file" env:"FILE" default:"./var/quota.db" description:"quota bolt file location"`
+	Comments      int64         `long:"comments" env:"COMMENTS" default:"0" description:"comments per month per site, unlimited if 0"`
+	Notifications int64         `long:"notifications" env:"NOTIFICATIONS" default:"0" description:"notification sends per month per site, unlimited if 0"`
+	Storage       int64         `long:"storage" env:"STORAGE" default:"0" description:"comments text size per site, in bytes, unlimited if 0"`
+	Mode          string        `long:"mode" env:"MODE" description:"enforcement of quota" choice:"warn" choice:"throttle" choice:"block" default:"warn"` // nolint
+	Throttle      time.Duration `long:"throttle" env:"THROTTLE" default:"1m" description:"interval between allowed actions over quota in throttle mode"`
+	Thresholds    []int         `long:"thresholds" env:"THRESHOLDS" default:"80" default:"100" env-delim:"," description:"percents of limit to alert at"` // nolint
+	Webhook       string        `long:"webhook" env:"WEBHOOK" description:"url quota alerts posted to"`
+}
+
+// InviteGroup defines options for invitations of new admins
+type InviteGroup struct {
+	Enabled bool          `long:"enabled" env:"ENABLED" description:"enable admin invitations"`
+	File    string        `long:"file" env:"FILE" default:"./var/invites.db" description:"invitations bolt file location"`
+	TTL     time.Duration `long:"ttl" env:"TTL" default:"72h" description:"default lifetime of invitation"`
+}
+
+// BotsGroup defines options for bot accounts of integrations, authenticated by api keys
+type BotsGroup struct {
+	Enabled bool    `long:"enabled" env:"ENABLED" description:"enable bot accounts"`
+	File    string  `long:"file" env:"FILE" default:"./var/bots.db" description:"bots bolt file location"`
+	Limit   float64 `long:"limit" env:"LIMIT" default:"60" description:"requests per minute allowed to each bot, unlimited if 0"`
+}
+
+// PageCheckGroup defines options for confirming pages of new comments with endpoints of the sites' CMS
+type PageCheckGroup struct {
+	URLs     []string      `long:"url" env:"URL" env-delim:"," description:"endpoint confirming the page can be commented, as site:url"`
+	Timeout  time.Duration `long:"timeout" env:"TIMEOUT" default:"5s" description:"timeout of the endpoint call"`
+	TTL      time.Duration `long:"ttl" env:"TTL" default:"1m" description:"time responses of the endpoint cached for, no caching if 0"`
+	FailOpen bool          `long:"fail-open" env:"FAIL_OPEN" description:"accept comments if the endpoint fails"`
+}
+
+// ScheduleGroup defines options for moderation actions scheduled for later
+type ScheduleGroup struct {
+	Enabled bool          `long:"enabled" env:"ENABLED" description:"enable scheduled moderation actions"`
+	File    string        `long:"file" env:"FILE" default:"./var/schedule.db" description:"scheduled actions bolt file location"`
+	Period  time.Duration `long:"period" env:"PERIOD" default:"1m" description:"interval of checking for due actions"`
+}
+
+// ColdGroup defines options for cold storage of inactive posts
+type ColdGroup struct {
+	Enabled  bool          `long:"enabled" env:"ENABLED" description:"move inactive posts to cold storage"`
+	File     string        `long:"file" env:"FILE" default:"./var/cold.db" description:"cold storage bolt file location"`
+	Inactive time.Duration `long:"inactive" env:"INACTIVE" default:"8760h" description:"inactivity period of post to freeze"`
+	Period   time.Duration `long:"period" env:"PERIOD" default:"24h" description:"interval of checking for inactive posts"`
+}
+
+// IntegrityGroup defines options for nightly integrity check of stored comments
+type IntegrityGroup struct {
+	Enabled bool   `long:"enabled" env:"ENABLED" description:"check integrity of comments nightly and report issues to admins"`
+	At      string `long:"at" env:"AT" default:"03:00" description:"local time of the nightly integrity check, HH:MM"`
+}
+
+// PagesGroup defines options for per-post settings made by site owners
+type PagesGroup struct {
+	Enabled bool   `long:"enabled" env:"ENABLED" description:"enable per-post settings, like pinned order of comments"`
+	File    string `long:"file" env:"FILE" default:"./var/pages.db" description:"page settings bolt file location"`
+
+	Strict         bool          `long:"strict" env:"STRICT" description:"accept comments only on posts registered by admins, sitemaps or confirmed by page check"`
+	Sitemaps       []string      `long:"sitemap" env:"SITEMAP" env-delim:"," description:"sitemap registering posts of the site, as site:url"`
+	SitemapRefresh time.Duration `long:"sitemap-refresh" env:"SITEMAP_REFRESH" default:"1h" description:"sitemaps sync period"`
+}
+
+// PoWGroup defines options for proof-of-work challenge on anonymous comments, anonymous logins and verification emails
+type PoWGroup struct {
+	Enabled    bool          `long:"enabled" env:"ENABLED" description:"require proof-of-work for anonymous comments and verification emails"`
+	Difficulty int           `long:"difficulty" env:"DIFFICULTY" default:"18" description:"leading zero bits required from the solution hash"`
+	TTL        time.Duration `long:"ttl" env:"TTL" default:"10m" description:"challenge lifetime"`
+	AnonLogin  bool          `long:"anon-login" env:"ANON_LOGIN" description:"require proof-of-work for anonymous login"`
+}
+
+// CaptchaGroup defines options for captcha verification of anonymous logins and first comments of new users
+type CaptchaGroup struct {
+	Type      string `long:"type" env:"TYPE" description:"captcha provider, disabled if empty" choice:"" choice:"turnstile" choice:"hcaptcha"` // nolint
+	Secret    string `long:"secret" env:"SECRET" description:"secret key of the captcha provider"`
+	SiteKey   string `long:"site-key" env:"SITE_KEY" description:"site key of the captcha widget, passed to the frontend"`
+	AnonLogin bool   `long:"anon-login" env:"ANON_LOGIN" description:"require captcha for anonymous login"`
+	NewUser   bool   `long:"new-user" env:"NEW_USER" description:"require captcha for the first comment of the user on the site"`
+}
+
+// GeoGroup defines options for posting restrictions by country and autonomous system of the commenter's ip
+type GeoGroup struct {
+	CountryDB         string   `long:"country-db" env:"COUNTRY_DB" description:"GeoLite2-Country or compatible mmdb file"`
+	ASNDB             string   `long:"asn-db" env:"ASN_DB" description:"GeoLite2-ASN or compatible mmdb file"`
+	BlockCountries    []string `long:"block-country" env:"BLOCK_COUNTRY" env-delim:"," description:"reject comments from the country, ISO code or site:code"`
+	ModerateCountries []string `long:"moderate-country" env:"MODERATE_COUNTRY" env-delim:"," description:"hold comments from the country for review, ISO code or site:code"`
+	BlockASNs         []string `long:"block-asn" env:"BLOCK_ASN" env-delim:"," description:"reject comments from the autonomous system, asn or site:asn"`
+	ModerateASNs      []string `long:"moderate-asn" env:"MODERATE_ASN" env-delim:"," description:"hold comments from the autonomous system for review, asn or site:asn"`
+}
+
+// ExitNodesGroup defines options for comments from Tor exit nodes and known VPNs
+type ExitNodesGroup struct {
+	Tor     []string      `long:"tor" env:"TOR" env-delim:"," default:"allow" description:"comments from Tor exit nodes, allow, moderate or block, or site:action"`
+	TorList []string      `long:"tor-list" env:"TOR_LIST" env-delim:"," default:"https://check.torproject.org/torbulkexitlist" description:"Tor exit nodes list, url or file"`
+	VPN     []string      `long:"vpn" env:"VPN" env-delim:"," default:"allow" description:"comments from known VPNs, allow, moderate or block, or site:action"`
+	VPNList []string      `long:"vpn-list" env:"VPN_LIST" env-delim:"," description:"known VPN addresses list, url or file with ip or cidr per line"`
+	Refresh time.Duration `long:"refresh" env:"REFRESH" default:"1h" description:"lists refresh period"`
+}
+
+// ReputationGroup defines options for comments from ips with bad reputation, listed by DNSBLs or recently used by blocked users
+type ReputationGroup struct {
+	DNSBL     []string      `long:"dnsbl" env:"DNSBL" env-delim:"," description:"DNS-based block list zone, like zen.spamhaus.org"`
+	CacheTTL  time.Duration `long:"cache-ttl" env:"CACHE_TTL" default:"1h" description:"lifetime of cached DNSBL results"`
+	AbuseTTL  time.Duration `long:"abuse-ttl" env:"ABUSE_TTL" default:"24h" description:"how long ips of blocked users are risky, 0 to disable"`
+	Action    string        `long:"action" env:"ACTION" description:"comments from risky ips" choice:"allow" choice:"moderate" choice:"block" default:"allow"` // nolint
+	Challenge bool          `long:"challenge" env:"CHALLENGE" description:"require proof-of-work for comments from risky ips"`
+}
+
+// BlocklistGroup defines options for blocklists shared between instances
+type BlocklistGroup struct {
+	Publish bool          `long:"publish" env:"PUBLISH" description:"publish users blocked by admins as a feed for other instances"`
+	Feeds   []string      `long:"feed" env:"FEED" env-delim:"," description:"blocklist feed to sync, url or file"`
+	Allow   []string      `long:"allow" env:"ALLOW" env-delim:"," description:"user id never blocked by feeds"`
+	Refresh time.Duration `long:"refresh" env:"REFRESH" default:"1h" description:"feeds sync period"`
+}
+
+// SettingsGroup defines options for per-site settings changed at runtime, like edit and collapse policies
+type SettingsGroup struct {
+	File string `long:"file" env:"FILE" description:"per-site settings bolt file location, settings.db in store.bolt.path if not set"`
+}
+
+// ShadowGroup defines options for mirroring of read requests to a secondary instance
+type ShadowGroup struct {
+	URL    string  `long:"url" env:"URL" description:"base url of the secondary instance, like http://remark42-next:8080"`
+	Sample float64 `long:"sample" env:"SAMPLE" default:"0.01" description:"share of anonymous read requests mirrored, 0..1"`
+}
+
+// AssetsGroup defines options for branding assets of sites, like custom css and logos
+type AssetsGroup struct {
+	Enabled     bool   `long:"enabled" env:"ENABLED" description:"enable branding assets managed by admins"`
+	File        string `long:"file" env:"FILE" default:"./var/assets.db" description:"assets bolt file location"`
+	MaxSize     int    `long:"max-size" env:"MAX_SIZE" default:"262144" description:"max size of asset file"`
+	MaxSiteSize int    `long:"max-site-size" env:"MAX_SITE_SIZE" default:"2097152" description:"max total size of site's assets"`
+}
+
+// CSPGroup defines options for security headers, including Content-Security-Policy
+type CSPGroup struct {
+	SiteAncestors     []string `long:"site-ancestors" env:"SITE_ANCESTORS" env-delim:"," description:"sources allowed to embed comments of the site, as site:source, override allowed-hosts"`
+	ReferrerPolicy    string   `long:"referrer-policy" env:"REFERRER_POLICY" default:"strict-origin-when-cross-origin" description:"Referrer-Policy header"`
+	PermissionsPolicy string   `long:"permissions-policy" env:"PERMISSIONS_POLICY" description:"Permissions-Policy header, browser features not needed by comments disabled if not set"`
+	Report            bool     `long:"report" env:"REPORT" description:"collect CSP violation reports for admins"`
+}
+
+// CORSGroup defines options for cross-origin requests, admins can change policies of sites at runtime
+type CORSGroup struct {
+	Origins            []string `long:"origins" env:"ORIGINS" env-delim:"," default:"*" description:"origins allowed to make cross-origin requests"`
+	SiteOrigins        []string `long:"site-origins" env:"SITE_ORIGINS" env-delim:"," description:"origins allowed for the site, as site:origin, override origins"`
+	DisableCredentials bool     `long:"disable-credentials" env:"DISABLE_CREDENTIALS" description:"disallow cross-origin requests with credentials"`
+	MaxAge             int      `long:"max-age" env:"MAX_AGE" default:"300" description:"time browsers cache preflight responses, in seconds"`
+}
+
+// LimitsGroup defines body size limits and slow clients protection, separate for comment posting, image upload and import
+type LimitsGroup struct {
+	CommentBody       int64         `long:"comment-body" env:"COMMENT_BODY" default:"65536" description:"max body size of comment posting, in bytes"`
+	ImageBody         int64         `long:"image-body" env:"IMAGE_BODY" default:"33554432" description:"max body size of image upload, in bytes"`
+	ImportBody        int64         `long:"import-body" env:"IMPORT_BODY" default:"268435456" description:"max body size of import, in bytes"`
+	CommentTimeout    time.Duration `long:"comment-timeout" env:"COMMENT_TIMEOUT" default:"10s" description:"max time to read comment posting request"`
+	ImageTimeout      time.Duration `long:"image-timeout" env:"IMAGE_TIMEOUT" default:"30s" description:"max time to read image upload request"`
+	ImportTimeout     time.Duration `long:"import-timeout" env:"IMPORT_TIMEOUT" default:"30m" description:"max time to read import request"`
+	ReadHeaderTimeout time.Duration `long:"read-header-timeout" env:"READ_HEADER_TIMEOUT" default:"5s" description:"max time to read request headers"`
+	IdleTimeout       time.Duration `long:"idle-timeout" env:"IDLE_TIMEOUT" default:"30s" description:"max time to keep idle connection"`
+}
+
+// PluginsGroup defines options for WASM plugins run at hooks of comment processing
+type PluginsGroup struct {
+	Dir     string        `long:"dir" env:"DIR" description:"directory with *.wasm plugins, disabled if not set"`
+	Timeout time.Duration `long:"timeout" env:"TIMEOUT" default:"200ms" description:"max time of plugin's hook call"`
+	Memory  int           `long:"memory" env:"MEMORY" default:"64" description:"max memory of each plugin, in megabytes"`
+}
+
+// ExprGroup defines default expressions deciding moderation and notification routing of new comments
+type ExprGroup struct {
+	Moderation string `long:"moderation" env:"MODERATION" description:"expression returning publish, hold or reject"`
+	Notify     string `long:"notify" env:"NOTIFY" description:"expression returning list of notification destinations"`
+}
+
+// LevelsGroup defines options for automatic user levels
+type LevelsGroup struct {
+	MemberComments  int           `long:"member-comments" env:"MEMBER_COMMENTS" default:"0" description:"approved comments required for member level"`
+	MemberAge       time.Duration `long:"member-age" env:"MEMBER_AGE" default:"0s" description:"time since the first comment required for member level"`
+	TrustedComments int           `long:"trusted-comments" env:"TRUSTED_COMMENTS" default:"0" description:"approved comments required for trusted level"`
+	TrustedAge      time.Duration `long:"trusted-age" env:"TRUSTED_AGE" default:"0s" description:"time since the first comment required for trusted level"`
+	ModerateNew     bool          `long:"moderate-new" env:"MODERATE_NEW" description:"hold comments of users with new level for review"`
+	VoteWeights     []string      `long:"vote-weight" env:"VOTE_WEIGHT" env-delim:"," description:"weight of votes by voter's level, as level:weight, like verified:2"`
+}
+
+// BrigadeGroup defines options of vote brigading detection
+type BrigadeGroup struct {
+	Enabled bool          `long:"enabled" env:"ENABLED" description:"detect suspicious votes and alert admins"`
+	Window  time.Duration `long:"window" env:"WINDOW" default:"10m" description:"time window of suspicious votes"`
+	Votes   int           `long:"votes" env:"VOTES" default:"5" description:"votes for a comment from the same network or by new users to alert"`
+	Period  time.Duration `long:"period" env:"PERIOD" default:"1m" description:"interval of votes analysis"`
+}
+
+// PIIGroup defines options for minimization of stored personal data
+type PIIGroup struct {
+	Minimize bool   `long:"minimize" env:"MINIMIZE" description:"never store plain emails, keep salted hash and encrypted address only"`
+	Key      string `long:"key" env:"KEY" description:"key for email hashing and encryption, secret used if not set"`
+}
+
+// EncryptGroup defines options for encryption of sensitive user details at rest
+type EncryptGroup struct {
+	Key     string   `long:"key" env:"KEY" description:"key for encryption of emails, telegram ids and totp secrets, disabled if not set"`
+	OldKeys []string `long:"old-key" env:"OLD_KEY" description:"previous keys, used for decryption until rekey command re-encrypts details" env-delim:","`
 }
 
 // AppleGroup defines options for Apple auth params
@@ -166,6 +541,13 @@ type MicrosoftAuthGroup struct {
 	Tenant string `long:"tenant" env:"TENANT" description:"Azure AD tenant ID, domain, or 'common' (default)" default:"common"`
 }
 
+// GitlabAuthGroup defines options group for GitLab auth params, URL is set for self-hosted instances
+type GitlabAuthGroup struct {
+	CID  string `long:"cid" env:"CID" description:"OAuth client ID"`
+	CSEC string `long:"csec" env:"CSEC" description:"OAuth client secret"`
+	URL  string `long:"url" env:"URL" default:"https://gitlab.com" description:"GitLab instance URL"`
+}
+
 // CustomAuthGroup defines options group for custom OAuth2 provider params
 type CustomAuthGroup struct {
 	Name         string   `long:"name" env:"NAME" description:"custom provider name used in auth route"`
@@ -181,6 +563,95 @@ type CustomAuthGroup struct {
 	EmailField   string   `long:"email-field" env:"EMAIL_FIELD" default:"email" description:"user info field used as email"`
 }
 
+// OIDCAuthGroup defines options group for OpenID Connect provider, endpoints discovered from the issuer
+type OIDCAuthGroup struct {
+	Name    string        `long:"name" env:"NAME" default:"oidc" description:"OIDC provider name used in auth route"`
+	Issuer  string        `long:"issuer" env:"ISSUER" description:"OIDC issuer URL, provider disabled if not set"`
+	CID     string        `long:"cid" env:"CID" description:"OIDC client ID"`
+	CSEC    string        `long:"csec" env:"CSEC" description:"OIDC client secret"`
+	Scopes  []string      `long:"scopes" env:"SCOPES" env-delim:"," default:"openid" default:"profile" default:"email" description:"OIDC scopes"` // nolint
+	Timeout time.Duration `long:"timeout" env:"TIMEOUT" default:"10s" description:"OIDC discovery timeout"`
+}
+
+// SAMLAuthGroup defines options group for SAML 2.0 service provider, attributes of the identity provider's assertion
+// mapped to the user
+type SAMLAuthGroup struct {
+	IdPMetadata string        `long:"idp-metadata" env:"IDP_METADATA" description:"identity provider's metadata URL or file, provider disabled if not set"`
+	EntityID    string        `long:"entity-id" env:"ENTITY_ID" description:"service provider's entity ID, {url}/auth/saml/metadata if not set"`
+	IDAttr      string        `long:"id-attr" env:"ID_ATTR" description:"attribute with user ID, NameID if not set"`
+	NameAttr    string        `long:"name-attr" env:"NAME_ATTR" default:"displayName" description:"attribute with user name"`
+	EmailAttr   string        `long:"email-attr" env:"EMAIL_ATTR" default:"email" description:"attribute with user email"`
+	PictureAttr string        `long:"picture-attr" env:"PICTURE_ATTR" description:"attribute with user picture URL"`
+	Timeout     time.Duration `long:"timeout" env:"TIMEOUT" default:"10s" description:"identity provider's metadata loading timeout"`
+}
+
+// MastodonAuthGroup defines options group for Mastodon provider, OAuth apps are registered on allowed instances dynamically
+type MastodonAuthGroup struct {
+	Instances []string      `long:"instance" env:"INSTANCES" env-delim:"," description:"allowed instances, * for any, provider disabled if not set"`
+	AppName   string        `long:"app-name" env:"APP_NAME" default:"remark42" description:"name of OAuth app registered on instances"`
+	Timeout   time.Duration `long:"timeout" env:"TIMEOUT" default:"10s" description:"timeout of requests to instances"`
+}
+
+// SteamAuthGroup defines options group for Steam OpenID provider, persona name and avatar loaded with Steam Web API
+type SteamAuthGroup struct {
+	APIKey  string        `long:"api-key" env:"API_KEY" description:"Steam Web API key, provider disabled if not set"`
+	Timeout time.Duration `long:"timeout" env:"TIMEOUT" default:"10s" description:"timeout of requests to Steam"`
+}
+
+// RedditAuthGroup defines options group for Reddit provider, requests to Reddit made with the set User-Agent
+type RedditAuthGroup struct {
+	CID       string        `long:"cid" env:"CID" description:"Reddit app client ID"`
+	CSEC      string        `long:"csec" env:"CSEC" description:"Reddit app client secret"`
+	UserAgent string        `long:"user-agent" env:"USER_AGENT" description:"User-Agent of requests to Reddit, web:remark42:{revision} if not set"`
+	Duration  string        `long:"duration" env:"DURATION" choice:"temporary" choice:"permanent" default:"temporary" description:"duration of authorization requested"` //nolint
+	Timeout   time.Duration `long:"timeout" env:"TIMEOUT" default:"10s" description:"timeout of requests to Reddit"`
+}
+
+// WebAuthnAuthGroup defines options group for WebAuthn provider, passkeys kept with user details of the site
+type WebAuthnAuthGroup struct {
+	Enable  bool     `long:"enable" env:"ENABLE" description:"enable passkey registration and login"`
+	RPID    string   `long:"rp-id" env:"RP_ID" description:"relying party id, domain of passkeys, host of remark url if not set"`
+	RPName  string   `long:"rp-name" env:"RP_NAME" default:"remark42" description:"relying party name shown by authenticators"`
+	Origins []string `long:"origin" env:"ORIGINS" env-delim:"," description:"allowed origins of passkey requests, origin of remark url if not set"`
+}
+
+// SMSAuthGroup defines options group for login with one-time code sent by SMS with one of the senders
+type SMSAuthGroup struct {
+	Sender    string        `long:"sender" env:"SENDER" description:"sms sender" choice:"none" choice:"twilio" choice:"vonage" choice:"webhook" default:"none"` //nolint
+	From      string        `long:"from" env:"FROM" description:"sender phone number, twilio messaging service sid or vonage sender id"`
+	Template  string        `long:"template" env:"TEMPLATE" description:"message template with .User, .Code and .Site, default used if not set"`
+	RateLimit int           `long:"rate-limit" env:"RATE_LIMIT" default:"5" description:"codes sent to a phone number per hour, unlimited if 0"`
+	Timeout   time.Duration `long:"timeout" env:"TIMEOUT" default:"10s" description:"timeout of sender requests"`
+	Twilio    struct {
+		AccountSID string `long:"account-sid" env:"ACCOUNT_SID" description:"twilio account sid"`
+		AuthToken  string `long:"auth-token" env:"AUTH_TOKEN" description:"twilio auth token"`
+	} `group:"twilio" namespace:"twilio" env-namespace:"TWILIO"`
+	Vonage struct {
+		APIKey    string `long:"api-key" env:"API_KEY" description:"vonage api key"`
+		APISecret string `long:"api-secret" env:"API_SECRET" description:"vonage api secret"`
+	} `group:"vonage" namespace:"vonage" env-namespace:"VONAGE"`
+	Webhook struct {
+		URL     string   `long:"url" env:"URL" description:"url of sms gateway, message posted as json with to and text fields"`
+		Headers []string `long:"header" env:"HEADERS" env-delim:"," description:"http header of webhook requests, as Name:Value"`
+	} `group:"webhook" namespace:"webhook" env-namespace:"WEBHOOK"`
+}
+
+// LDAPAuthGroup defines options group for LDAP direct provider, checking users' passwords in the directory
+type LDAPAuthGroup struct {
+	URL                string        `long:"url" env:"URL" description:"ldap:// or ldaps:// server URL, provider disabled if not set"`
+	StartTLS           bool          `long:"starttls" env:"STARTTLS" description:"upgrade ldap:// connection with StartTLS"`
+	CACert             string        `long:"ca-cert" env:"CA_CERT" description:"PEM file with CA certificates of the server, system ones used if not set"`
+	InsecureSkipVerify bool          `long:"insecure_skip_verify" env:"INSECURE_SKIP_VERIFY" description:"skip certificate verification"`
+	BindDN             string        `long:"bind-dn" env:"BIND_DN" description:"service account DN searching for users, anonymous search if not set"`
+	BindPasswd         string        `long:"bind-passwd" env:"BIND_PASSWD" description:"service account password"`
+	BaseDN             string        `long:"base-dn" env:"BASE_DN" description:"base DN of users search"`
+	UserFilter         string        `long:"user-filter" env:"USER_FILTER" default:"(uid={user})" description:"users search filter, {user} replaced with the login"`
+	GroupAttr          string        `long:"group-attr" env:"GROUP_ATTR" default:"memberOf" description:"user attribute with DNs of user's groups"`
+	AdminGroups        []string      `long:"admin-group" env:"ADMIN_GROUP" env-delim:";" description:"DN of group which members are admins"`
+	AdminSites         []string      `long:"admin-site" env:"ADMIN_SITE" env-delim:"," description:"sites where members of admin groups are admins, the only site if not set"`
+	Timeout            time.Duration `long:"timeout" env:"TIMEOUT" default:"10s" description:"LDAP server timeout"`
+}
+
 // StoreGroup defines options group for store params
 type StoreGroup struct {
 	Type string `long:"type" env:"TYPE" description:"type of storage" choice:"bolt" choice:"rpc" default:"bolt"` // nolint
@@ -205,7 +676,13 @@ type ImageGroup struct {
 	MaxSize      int      `long:"max-size" env:"MAX_SIZE" default:"5000000" description:"max size of image file"`
 	ResizeWidth  int      `long:"resize-width" env:"RESIZE_WIDTH" default:"2400" description:"width of a resized image"`
 	ResizeHeight int      `long:"resize-height" env:"RESIZE_HEIGHT" default:"900" description:"height of a resized image"`
+	Thumbnails   []string `long:"thumbnails" env:"THUMBNAILS" env-delim:"," default:"160x160" default:"320x320" default:"640x640" description:"allowed thumbnail sizes, WIDTHxHEIGHT"` // nolint
+	ThumbCache   int64    `long:"thumbnails-cache" env:"THUMBNAILS_CACHE" default:"67108864" description:"max size of cached thumbnails"`
 	RPC          RPCGroup `group:"rpc" namespace:"rpc" env-namespace:"RPC"`
+	Caption      struct {
+		URL     string        `long:"url" env:"URL" description:"captioning webhook generating alt text of uploaded images"`
+		Timeout time.Duration `long:"timeout" env:"TIMEOUT" default:"10s" description:"captioning webhook timeout"`
+	} `group:"caption" namespace:"caption" env-namespace:"CAPTION"`
 }
 
 // AvatarGroup defines options group for avatar params
@@ -232,6 +709,21 @@ type CacheGroup struct {
 	} `group:"max" namespace:"max" env-namespace:"MAX"`
 }
 
+// CDNGroup defines options group for CDN in front of read endpoints, purged on invalidation of the cache
+type CDNGroup struct {
+	MaxAge  time.Duration `long:"max-age" env:"MAX_AGE" description:"time CDN keeps responses of read endpoints, caching hints disabled if not set"`
+	Purge   string        `long:"purge" env:"PURGE" choice:"none" choice:"fastly" choice:"cloudflare" default:"none" description:"CDN purged on invalidation"` // nolint
+	Timeout time.Duration `long:"timeout" env:"TIMEOUT" default:"10s" description:"timeout of purge requests"`
+	Fastly  struct {
+		ServiceID string `long:"service-id" env:"SERVICE_ID" description:"Fastly service ID"`
+		Token     string `long:"token" env:"TOKEN" description:"Fastly API token with purge_select scope"`
+	} `group:"fastly" namespace:"fastly" env-namespace:"FASTLY"`
+	Cloudflare struct {
+		ZoneID string `long:"zone-id" env:"ZONE_ID" description:"Cloudflare zone ID"`
+		Token  string `long:"token" env:"TOKEN" description:"Cloudflare API token with cache purge permission"`
+	} `group:"cloudflare" namespace:"cloudflare" env-namespace:"CLOUDFLARE"`
+}
+
 // AdminGroup defines options group for admin params
 type AdminGroup struct {
 	Type   string `long:"type" env:"TYPE" description:"type of admin store" choice:"shared" choice:"rpc" default:"shared"` //nolint
@@ -239,7 +731,15 @@ type AdminGroup struct {
 		Admins []string `long:"id" env:"ID" description:"admin(s) ids" env-delim:","`
 		Email  []string `long:"email" env:"EMAIL" description:"admin emails" env-delim:","`
 	} `group:"shared" namespace:"shared" env-namespace:"SHARED"`
-	RPC AdminRPCGroup `group:"rpc" namespace:"rpc" env-namespace:"RPC"`
+	RPC  AdminRPCGroup  `group:"rpc" namespace:"rpc" env-namespace:"RPC"`
+	TOTP AdminTOTPGroup `group:"totp" namespace:"totp" env-namespace:"TOTP"`
+}
+
+// AdminTOTPGroup defines options group for TOTP second factor of admins
+type AdminTOTPGroup struct {
+	Enable bool          `long:"enable" env:"ENABLE" description:"require TOTP second factor from admins"`
+	Issuer string        `long:"issuer" env:"ISSUER" default:"Remark42" description:"issuer shown by authenticator apps"`
+	TTL    time.Duration `long:"ttl" env:"TTL" default:"12h" description:"admin API allowed for after verified code"`
 }
 
 // TelegramGroup defines token for Telegram used in notify and auth modules
@@ -259,6 +759,28 @@ type SMTPGroup struct {
 	LoginAuth          bool          `long:"login_auth" env:"LOGIN_AUTH" description:"enable LOGIN auth instead of PLAIN"`
 	StartTLS           bool          `long:"starttls" env:"STARTTLS" description:"enable StartTLS"`
 	TimeOut            time.Duration `long:"timeout" env:"TIMEOUT" default:"10s" description:"SMTP TCP connection timeout"`
+	DKIMDomain         string        `long:"dkim_domain" env:"DKIM_DOMAIN" description:"DKIM signing domain"`
+	DKIMSelector       string        `long:"dkim_selector" env:"DKIM_SELECTOR" default:"remark42" description:"DKIM key selector"`
+	DKIMKey            string        `long:"dkim_key" env:"DKIM_KEY" description:"DKIM private key PEM file, messages are not signed if not set"`
+}
+
+// EmailAPIGroup defines options for sending emails with HTTP API of the provider instead of SMTP,
+// used in auth and notify modules
+type EmailAPIGroup struct {
+	Provider     string        `long:"provider" env:"PROVIDER" description:"email provider" choice:"none" choice:"ses" choice:"sendgrid" choice:"mailgun" choice:"postmark" default:"none"` //nolint
+	Key          string        `long:"key" env:"KEY" description:"API key, access key id for ses"`
+	Secret       string        `long:"secret" env:"SECRET" description:"secret access key for ses"`
+	Region       string        `long:"region" env:"REGION" description:"AWS region for ses, eu for mailgun EU region"`
+	Domain       string        `long:"domain" env:"DOMAIN" description:"sending domain for mailgun"`
+	Endpoint     string        `long:"endpoint" env:"ENDPOINT" description:"API base URL, provider's default if not set"`
+	Timeout      time.Duration `long:"timeout" env:"TIMEOUT" default:"10s" description:"API request timeout"`
+	EventsSecret string        `long:"events-secret" env:"EVENTS_SECRET" description:"secret of the bounces and complaints webhook, disabled if not set"`
+}
+
+// SuppressGroup defines options for suppression of email addresses after bounces and complaints
+type SuppressGroup struct {
+	Enabled bool   `long:"enabled" env:"ENABLED" description:"suppress emails to addresses reported by the email provider"`
+	File    string `long:"file" env:"FILE" default:"./var/suppress.db" description:"suppressed addresses bolt file location"`
 }
 
 // NotifyGroup defines options for notification
@@ -267,6 +789,7 @@ type NotifyGroup struct {
 	Users     []string `long:"users" env:"USERS" description:"types of user notifications" choice:"none" choice:"email" choice:"telegram" default:"none" env-delim:","`                                                        //nolint
 	Admins    []string `long:"admins" env:"ADMINS" description:"types of admin notifications" choice:"none" choice:"telegram" choice:"email" choice:"slack" choice:"webhook" default:"none" env-delim:","`                     //nolint
 	QueueSize int      `long:"queue" env:"QUEUE" description:"size of notification queue" default:"100"`
+	Collapse  []string `long:"collapse-window" env:"COLLAPSE_WINDOW" description:"window collapsing user notifications about a thread into one, as window for all sites or site:window" env-delim:","`
 	Telegram  struct {
 		Channel string        `long:"chan" env:"CHAN" description:"the ID of telegram channel for admin notifications"`
 		API     string        `long:"api" env:"API" default:"https://api.telegram.org/bot" description:"[deprecated, not used] telegram api prefix"`
@@ -274,9 +797,11 @@ type NotifyGroup struct {
 		Timeout time.Duration `long:"timeout" env:"TIMEOUT" default:"5s" description:"[deprecated, use --telegram.timeout] telegram timeout"`
 	} `group:"telegram" namespace:"telegram" env-namespace:"TELEGRAM"`
 	Email struct {
-		From                string `long:"from_address" env:"FROM" description:"from email address"`
-		VerificationSubject string `long:"verification_subj" env:"VERIFICATION_SUBJ" description:"verification message subject"`
-		AdminNotifications  bool   `long:"notify_admin" env:"ADMIN" description:"[deprecated, use --notify.admins=email] notify admin on new comments via ADMIN_SHARED_EMAIL"`
+		From                string   `long:"from_address" env:"FROM" description:"from email address"`
+		SiteFrom            []string `long:"site_from" env:"SITE_FROM" description:"from email address of the site, as site:address" env-delim:","`
+		ReplyTo             []string `long:"reply_to" env:"REPLY_TO" description:"reply-to email address, as address for all sites or site:address" env-delim:","`
+		VerificationSubject string   `long:"verification_subj" env:"VERIFICATION_SUBJ" description:"verification message subject"`
+		AdminNotifications  bool     `long:"notify_admin" env:"ADMIN" description:"[deprecated, use --notify.admins=email] notify admin on new comments via ADMIN_SHARED_EMAIL"`
 	} `group:"email" namespace:"email" env-namespace:"EMAIL"`
 	Slack struct {
 		Token   string `long:"token" env:"TOKEN" description:"slack token"`
@@ -298,6 +823,11 @@ type SSLGroup struct {
 	Key          string `long:"key" env:"KEY" description:"path to the key.pem file"`
 	ACMELocation string `long:"acme-location" env:"ACME_LOCATION" description:"dir where certificates will be stored by autocert manager" default:"./var/acme"`
 	ACMEEmail    string `long:"acme-email" env:"ACME_EMAIL" description:"admin email for certificate notifications"`
+	HTTP3        bool   `long:"http3" env:"HTTP3" description:"serve HTTP/3 (QUIC) on https port over udp"`
+
+	ClientCA         string   `long:"client-ca" env:"CLIENT_CA" description:"PEM file with CA certificates of client certificates"`
+	AdminCertRequire bool     `long:"admin-cert-required" env:"ADMIN_CERT_REQUIRED" description:"require client certificate for admin API"`
+	AdminCertUsers   []string `long:"admin-cert-user" env:"ADMIN_CERT_USERS" env-delim:"," description:"client certificate's common name mapped to user id, as cn:user_id"`
 }
 
 // RPCGroup defines options for remote modules (plugins)
@@ -306,6 +836,10 @@ type RPCGroup struct {
 	TimeOut      time.Duration `long:"timeout" env:"TIMEOUT" default:"5s" description:"http timeout"`
 	AuthUser     string        `long:"auth_user" env:"AUTH_USER" description:"basic auth user name"`
 	AuthPassword string        `long:"auth_passwd" env:"AUTH_PASSWD" description:"basic auth user password"`
+	Retries      int           `long:"retries" env:"RETRIES" default:"2" description:"retries of requests failed to reach the remote server"`
+	Backoff      time.Duration `long:"backoff" env:"BACKOFF" default:"100ms" description:"delay before the first retry, doubled for each next one"`
+	Breaker      int           `long:"breaker" env:"BREAKER" default:"5" description:"consecutive failures opening circuit breaker, 0 to disable"`
+	Cooldown     time.Duration `long:"breaker-cooldown" env:"BREAKER_COOLDOWN" default:"30s" description:"time circuit breaker stays open"`
 }
 
 // AdminRPCGroup defines options for remote admin store
@@ -333,6 +867,10 @@ type serverApp struct {
 	notifyService *notify.Service
 	imageService  *image.Service
 	authenticator *auth.Service
+	blocklistSync *blocklist.Syncer
+	sitemapSync   *sitemap.Syncer
+	scheduler     *scheduler.Scheduler
+	coldFreezer   *cold.Freezer
 	terminated    chan struct{}
 
 	authRefreshCache *authRefreshCache // stored only to close it properly on shutdown
@@ -510,15 +1048,27 @@ var reservedCustomProviderNames = map[string]struct{}{
 	"anonymous": {},
 	"google":    {},
 	"github":    {},
+	"gitlab":    {},
 	"facebook":  {},
 	"yandex":    {},
 	"twitter":   {},
 	"microsoft": {},
 	"patreon":   {},
 	"discord":   {},
+	"twitch":    {},
+	"vk":        {},
+	"wechat":    {},
 	"telegram":  {},
 	"dev":       {},
 	"apple":     {},
+	"saml":      {},
+	"ldap":      {},
+	"mastodon":  {},
+	"reddit":    {},
+	"steam":     {},
+	"webauthn":  {},
+	"sms":       {},
+	"bot":       {},
 }
 
 var validCustomProviderName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
@@ -557,6 +1107,68 @@ func customProviderSourceID(data provider.UserData, cfg CustomAuthGroup) string
 	return sourceID
 }
 
+// oidcDiscovery is a part of OpenID Provider Metadata used to set up the provider
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+}
+
+// discoverOIDC gets endpoints of OpenID Connect provider from its discovery document
+func discoverOIDC(ctx context.Context, client *http.Client, issuer string) (oidcDiscovery, error) {
+	issuer = strings.TrimSuffix(issuer, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, issuer+"/.well-known/openid-configuration", http.NoBody)
+	if err != nil {
+		return oidcDiscovery{}, fmt.Errorf("can't make discovery request: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return oidcDiscovery{}, fmt.Errorf("can't get discovery document: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return oidcDiscovery{}, fmt.Errorf("discovery document responded with status %d", resp.StatusCode)
+	}
+
+	res := oidcDiscovery{}
+	if err = json.NewDecoder(io.LimitReader(resp.Body, 1024*1024)).Decode(&res); err != nil {
+		return oidcDiscovery{}, fmt.Errorf("can't decode discovery document: %w", err)
+	}
+	if strings.TrimSuffix(res.Issuer, "/") != issuer {
+		return oidcDiscovery{}, fmt.Errorf("discovery document issuer %q doesn't match %q", res.Issuer, issuer)
+	}
+	if res.AuthorizationEndpoint == "" || res.TokenEndpoint == "" || res.UserinfoEndpoint == "" {
+		return oidcDiscovery{}, errors.New("discovery document has no authorization, token or userinfo endpoint")
+	}
+	return res, nil
+}
+
+// oidcUser maps standard claims of OIDC userinfo to the user, email is used only if verified explicitly.
+// Userinfo without subject makes the user without ID, rejected by the token validator.
+func oidcUser(name string, data provider.UserData) token.User {
+	if data.Value("sub") == "" {
+		log.Printf("[WARN] oidc provider %s returned userinfo without subject, rejected", name)
+		return token.User{}
+	}
+	hashID := token.HashID(sha1.New(), data.Value("sub")) //nolint:gosec // stable provider user id hash
+	user := token.User{
+		ID:      name + "_" + hashID,
+		Name:    data.Value("name"),
+		Picture: data.Value("picture"),
+	}
+	if data.Value("email_verified") == "true" {
+		user.Email = data.Value("email")
+	}
+	if user.Name == "" {
+		user.Name = data.Value("preferred_username")
+	}
+	if user.Name == "" {
+		user.Name = "noname_" + hashID[:4]
+	}
+	return user
+}
+
 func (c CustomAuthGroup) isConfigured() bool {
 	return c.Name != "" || c.CID != "" || c.CSEC != "" || c.AuthURL != "" || c.TokenURL != "" || c.InfoURL != "" ||
 		len(c.Scopes) > 0 || c.IDField != "sub" || c.NameField != "name" || c.PictureField != "picture" || c.EmailField != "email"
@@ -609,6 +1221,18 @@ func (s *ServerCommand) newServerApp(ctx context.Context) (*serverApp, error) {
 		log.Printf("[WARN] --trusted-proxy has a catch-all (0.0.0.0/0 or ::/0): forwarding headers are trusted from any client, re-opening the spoofing bypass; scope it to your proxy network")
 	}
 
+	if s.AdminListen != "" {
+		if _, _, err = net.SplitHostPort(s.AdminListen); err != nil {
+			return nil, fmt.Errorf("invalid --admin-listen %q: %w", s.AdminListen, err)
+		}
+		if s.SSL.AdminCertRequire || len(s.SSL.AdminCertUsers) > 0 {
+			return nil, errors.New("admin client certificates can't be used with --admin-listen, admin server doesn't use tls")
+		}
+	}
+	if s.AdminPprof && (s.AdminListen == "" || s.AdminPasswd == "") {
+		return nil, errors.New("--admin-pprof requires --admin-listen and --admin-passwd, profiler and metrics are served to basic auth admin only")
+	}
+
 	storeEngine, err := s.makeDataStore()
 	if err != nil {
 		return nil, fmt.Errorf("failed to make data store engine: %w", err)
@@ -625,6 +1249,11 @@ func (s *ServerCommand) newServerApp(ctx context.Context) (*serverApp, error) {
 	}
 	log.Printf("[DEBUG] image service for url=%s, EditDuration=%v", imageService.ImageAPI, imageService.EditDuration)
 
+	timezones, err := s.timezones()
+	if err != nil {
+		return nil, fmt.Errorf("failed to make timezones: %w", err)
+	}
+
 	dataService := &service.DataStore{
 		Engine:                 storeEngine,
 		EditDuration:           s.EditDuration,
@@ -637,28 +1266,263 @@ func (s *ServerCommand) newServerApp(ctx context.Context) (*serverApp, error) {
 		ImageService:           imageService,
 		TitleExtractor:         service.NewTitleExtractor(http.Client{Timeout: time.Second * 5, Transport: safehttp.Transport()}, s.getAllowedDomains()),
 		RestrictedWordsMatcher: service.NewRestrictedWordsMatcher(service.StaticRestrictedWordsLister{Words: s.RestrictedWords}),
+		ProfilePolicy: service.StaticProfilePolicyLister{ProfilePolicy: service.ProfilePolicy{
+			Enabled:       s.Profile.Enabled,
+			UniqueNames:   s.Profile.UniqueNames,
+			MaxNameLength: s.Profile.MaxNameLen,
+			BannedNames:   append(slices.Clone(s.Profile.BannedNames), s.RestrictedNames...),
+		}},
+		LanguagePolicy: service.StaticLanguagePolicyLister{LanguagePolicy: s.languagePolicy()},
+		EditPolicy: service.NewEditPolicies(service.EditPolicy{
+			Duration:         s.EditDuration,
+			VerifiedDuration: s.EditDurationVerified,
+			AdminDuration:    s.EditDurationAdmin,
+		}),
+		CollapsePolicy: service.NewCollapsePolicies(s.collapsePolicy()),
+		AuthorDeletePolicy: service.StaticAuthorDeletePolicyLister{AuthorDeletePolicy: service.AuthorDeletePolicy{
+			Mode: service.AuthorDeleteMode(s.AuthorDelete),
+		}},
+		ContentPolicy: service.StaticContentPolicyLister{ContentPolicy: service.ContentPolicy{
+			MinLength:     s.MinCommentSize,
+			MaxLength:     s.MaxCommentSize,
+			MaxLinks:      s.MaxCommentLinks,
+			MaxImages:     s.MaxCommentImages,
+			MaxQuoteRatio: s.MaxQuoteRatio,
+		}},
+		WelcomePolicy: service.StaticWelcomePolicyLister{WelcomePolicy: service.WelcomePolicy{
+			Enabled: s.Welcome.Enabled,
+			Message: s.Welcome.Message,
+		}},
+		LatePolicy: service.StaticLatePolicyLister{LatePolicy: service.LatePolicy{
+			Months:         s.LateThread.Age,
+			SuppressNotify: s.LateThread.SuppressNotify,
+		}},
+		CannedResponses: service.NewCannedResponses(s.cannedResponses()),
+		Timezone:        timezones,
+	}
+	if s.ClientStats {
+		dataService.ClientStats = service.NewClientStats()
 	}
 	dataService.RestrictSameIPVotes.Enabled = s.RestrictVoteIP
 	dataService.RestrictSameIPVotes.Duration = s.DurationVoteIP
 
+	if dataService.PollStore, err = s.makePollStore(); err != nil {
+		_ = dataService.Close()
+		return nil, fmt.Errorf("failed to make poll store: %w", err)
+	}
+	if dataService.HighlightStore, err = s.makeHighlightStore(); err != nil {
+		_ = dataService.Close()
+		return nil, fmt.Errorf("failed to make highlight store: %w", err)
+	}
+	if dataService.EventStore, err = s.makeEventStore(); err != nil {
+		_ = dataService.Close()
+		return nil, fmt.Errorf("failed to make event store: %w", err)
+	}
+	if dataService.EventPublisher, err = s.makeEventBus(); err != nil {
+		_ = dataService.Close()
+		return nil, fmt.Errorf("failed to make event bus: %w", err)
+	}
+	if dataService.Quotas, err = s.makeQuotas(); err != nil {
+		_ = dataService.Close()
+		return nil, fmt.Errorf("failed to make quotas: %w", err)
+	}
+	if dataService.InviteStore, err = s.makeInviteStore(); err != nil {
+		_ = dataService.Close()
+		return nil, fmt.Errorf("failed to make invite store: %w", err)
+	}
+	dataService.InviteTTL = s.Invite.TTL
+	if dataService.PageChecker, err = s.makePageChecker(); err != nil {
+		_ = dataService.Close()
+		return nil, fmt.Errorf("failed to make page checker: %w", err)
+	}
+	if dataService.BotStore, err = s.makeBotStore(); err != nil {
+		_ = dataService.Close()
+		return nil, fmt.Errorf("failed to make bot store: %w", err)
+	}
+	if dataService.ScheduleStore, err = s.makeScheduleStore(); err != nil {
+		_ = dataService.Close()
+		return nil, fmt.Errorf("failed to make schedule store: %w", err)
+	}
+	if dataService.ColdStore, err = s.makeColdStore(); err != nil {
+		_ = dataService.Close()
+		return nil, fmt.Errorf("failed to make cold store: %w", err)
+	}
+	if dataService.PageStore, err = s.makePageStore(); err != nil {
+		_ = dataService.Close()
+		return nil, fmt.Errorf("failed to make page store: %w", err)
+	}
+	if s.Pages.Strict && dataService.PageStore == nil {
+		_ = dataService.Close()
+		return nil, errors.New("strict pages mode requires pages.enabled")
+	}
+	dataService.StrictPages = s.Pages.Strict
+	if dataService.SuppressStore, err = s.makeSuppressStore(); err != nil {
+		_ = dataService.Close()
+		return nil, fmt.Errorf("failed to make suppress store: %w", err)
+	}
+	if dataService.AssetStore, err = s.makeAssetStore(); err != nil {
+		_ = dataService.Close()
+		return nil, fmt.Errorf("failed to make asset store: %w", err)
+	}
+	dataService.AssetLimits = service.AssetLimits{MaxSize: s.Assets.MaxSize, MaxSiteSize: s.Assets.MaxSiteSize}
+	if dataService.GeoLocator, err = s.makeGeoLocator(); err != nil {
+		_ = dataService.Close()
+		return nil, fmt.Errorf("failed to make geoip locator: %w", err)
+	}
+	if dataService.GeoPolicy, err = s.geoPolicy(); err != nil {
+		_ = dataService.Close()
+		return nil, fmt.Errorf("failed to make geo policy: %w", err)
+	}
+	exitNodePolicy, err := s.exitNodePolicy()
+	if err != nil {
+		_ = dataService.Close()
+		return nil, fmt.Errorf("failed to make exit nodes policy: %w", err)
+	}
+	dataService.ExitNodePolicy = exitNodePolicy
+	jobs := []*scheduler.Job{}
+	ipLists := s.makeExitNodeLists(exitNodePolicy)
+	if list, ok := ipLists["tor"]; ok {
+		dataService.TorExits = list
+	}
+	if list, ok := ipLists["vpn"]; ok {
+		dataService.VPNs = list
+	}
+	for _, name := range []string{"tor", "vpn"} {
+		if list, ok := ipLists[name]; ok {
+			job := list.Job(s.ExitNodes.Refresh)
+			jobs = append(jobs, &job)
+		}
+	}
+	dataService.RiskPolicy = service.StaticRiskPolicyLister{RiskPolicy: service.RiskPolicy{
+		Action:    service.NetworkAction(s.Reputation.Action),
+		Challenge: s.Reputation.Challenge,
+	}}
+	if len(s.Reputation.DNSBL) > 0 {
+		log.Printf("[INFO] check commenters ips against %v", s.Reputation.DNSBL)
+		dataService.DNSBL = &iplist.DNSBL{Zones: s.Reputation.DNSBL, TTL: s.Reputation.CacheTTL}
+	}
+	if s.Reputation.AbuseTTL > 0 {
+		dataService.AbuseIPs = &service.AbuseTable{TTL: s.Reputation.AbuseTTL}
+	}
+	dataService.LevelPolicy = service.StaticLevelPolicyLister{LevelPolicy: service.LevelPolicy{
+		MemberComments:  s.Levels.MemberComments,
+		MemberAge:       s.Levels.MemberAge,
+		TrustedComments: s.Levels.TrustedComments,
+		TrustedAge:      s.Levels.TrustedAge,
+		ModerateNew:     s.Levels.ModerateNew,
+	}}
+	dataService.VoteWeights = s.voteWeights()
+	if dataService.Brigades, err = s.makeBrigades(); err != nil {
+		_ = dataService.Close()
+		return nil, fmt.Errorf("failed to make brigading detector: %w", err)
+	}
+
+	if dataService.PII, err = s.makePIIVault(); err != nil {
+		_ = dataService.Close()
+		return nil, fmt.Errorf("failed to make pii vault: %w", err)
+	}
+	if dataService.DetailCipher, err = s.makeDetailCipher(); err != nil {
+		_ = dataService.Close()
+		return nil, fmt.Errorf("failed to make details cipher: %w", err)
+	}
+	exprPolicy := service.ExprPolicy{Moderation: s.Expr.Moderation, Notify: s.Expr.Notify}
+	if dataService.ExprPolicy, err = service.NewExprPolicies(exprPolicy); err != nil {
+		_ = dataService.Close()
+		return nil, fmt.Errorf("failed to make expression policies: %w", err)
+	}
+	if dataService.SettingsStore, err = s.makeSettingsStore(); err != nil {
+		_ = dataService.Close()
+		return nil, fmt.Errorf("failed to make settings store: %w", err)
+	}
+	if err = dataService.RestoreSettings(); err != nil {
+		_ = dataService.Close()
+		return nil, fmt.Errorf("failed to restore settings: %w", err)
+	}
+
 	loadingCache, err := s.makeCache()
 	if err != nil {
 		_ = dataService.Close()
 		return nil, fmt.Errorf("failed to make cache: %w", err)
 	}
+	cdnPurger, err := s.makeCDNPurger()
+	if err != nil {
+		_ = dataService.Close()
+		return nil, fmt.Errorf("failed to make cdn purger: %w", err)
+	}
+	if cdnPurger != nil {
+		loadingCache = &cdn.Cache{LoadingCache: loadingCache, Purger: cdnPurger, Timeout: s.CDN.Timeout}
+	}
 
 	avatarStore, err := s.makeAvatarStore()
 	if err != nil {
 		_ = dataService.Close()
 		return nil, fmt.Errorf("failed to make avatar store: %w", err)
 	}
+	ldapAuth, err := s.makeLDAPAuth()
+	if err != nil {
+		_ = dataService.Close()
+		return nil, fmt.Errorf("failed to make ldap auth: %w", err)
+	}
 	authRefreshCache := newAuthRefreshCache()
-	authenticator := s.getAuthenticator(dataService, avatarStore, adminStore, authRefreshCache)
+	authenticator := s.getAuthenticator(dataService, avatarStore, adminStore, authRefreshCache, ldapAuth)
+	if ldapAuth != nil {
+		authenticator.AddDirectProviderWithUserIDFunc(ldapAuth.Name, ldapAuth, ldapAuth.UserID)
+	}
 
 	telegramAuth := s.makeTelegramAuth(authenticator) // telegram auth requires TelegramAPI listener which is constructed below
 	telegramService := s.startTelegramAuthAndNotify(ctx, telegramAuth)
 
-	err = s.addAuthProviders(authenticator)
+	samlAuth, err := s.makeSAMLAuth(authenticator)
+	if err != nil {
+		_ = dataService.Close()
+		_ = authRefreshCache.Close()
+		return nil, fmt.Errorf("failed to make saml auth: %w", err)
+	}
+
+	if err = s.addMastodonAuth(authenticator); err != nil {
+		_ = dataService.Close()
+		_ = authRefreshCache.Close()
+		return nil, fmt.Errorf("failed to make mastodon auth: %w", err)
+	}
+
+	if err = s.addSteamAuth(authenticator); err != nil {
+		_ = dataService.Close()
+		_ = authRefreshCache.Close()
+		return nil, fmt.Errorf("failed to make steam auth: %w", err)
+	}
+
+	if err = s.addRedditAuth(authenticator); err != nil {
+		_ = dataService.Close()
+		_ = authRefreshCache.Close()
+		return nil, fmt.Errorf("failed to make reddit auth: %w", err)
+	}
+
+	if err = s.addVKAuth(authenticator); err != nil {
+		_ = dataService.Close()
+		_ = authRefreshCache.Close()
+		return nil, fmt.Errorf("failed to make vk auth: %w", err)
+	}
+
+	if err = s.addWeChatAuth(authenticator); err != nil {
+		_ = dataService.Close()
+		_ = authRefreshCache.Close()
+		return nil, fmt.Errorf("failed to make wechat auth: %w", err)
+	}
+
+	if err = s.addSMSAuth(authenticator); err != nil {
+		_ = dataService.Close()
+		_ = authRefreshCache.Close()
+		return nil, fmt.Errorf("failed to make sms auth: %w", err)
+	}
+
+	webauthnAuth, err := s.makeWebAuthnAuth(authenticator, dataService)
+	if err != nil {
+		_ = dataService.Close()
+		_ = authRefreshCache.Close()
+		return nil, fmt.Errorf("failed to make webauthn auth: %w", err)
+	}
+
+	err = s.addAuthProviders(authenticator, dataService.EmailSuppressed)
 	if err != nil {
 		_ = dataService.Close()
 		_ = authRefreshCache.Close()
@@ -678,25 +1542,36 @@ func (s *ServerCommand) newServerApp(ctx context.Context) (*serverApp, error) {
 		KeyStore:          adminStore,
 	}
 
-	notifyDestinations, err := s.makeNotifyDestinations(authenticator)
+	emailIdentities, err := s.emailIdentities()
+	if err != nil {
+		return nil, fmt.Errorf("failed to make email identities: %w", err)
+	}
+	notifyDestinations, err := s.makeNotifyDestinations(authenticator, dataService.SiteLocation, dataService.EmailToken,
+		dataService.EmailSuppressed, emailIdentities)
 	if err != nil {
 		log.Printf("[WARN] failed to prepare notify destinations, %s", err)
 	}
 
-	notifyService := s.makeNotifyService(dataService, notifyDestinations, telegramService)
+	notifyCollapse, err := s.notifyCollapse()
+	if err != nil {
+		return nil, fmt.Errorf("failed to make notification collapse windows: %w", err)
+	}
+	notifyService := s.makeNotifyService(dataService, notifyDestinations, telegramService, notifyCollapse)
 
 	imgProxy := &proxy.Image{
 		HTTP2HTTPS:    s.ImageProxy.HTTP2HTTPS,
 		CacheExternal: s.ImageProxy.CacheExternal,
+		CDNOrigin:     s.ImageProxy.CDNOrigin,
+		CDNURL:        s.ImageProxy.CDNURL,
 		RoutePath:     "/api/v1/img",
 		RemarkURL:     s.RemarkURL,
 		ImageService:  imageService,
 	}
-	emojiFmt := store.CommentConverterFunc(func(text string) string { return text })
+	converters := []store.CommentConverter{imgProxy}
 	if s.EnableEmoji {
-		emojiFmt = func(text string) string { return emoji.Sprint(text) }
+		converters = append(converters, store.CommentConverterFunc(func(text string) string { return emoji.Sprint(text) }))
 	}
-	commentFormatter := store.NewCommentFormatter(imgProxy, emojiFmt)
+	commentFormatter := store.NewCommentFormatter(converters...)
 
 	sslConfig, err := s.makeSSLConfig()
 	if err != nil {
@@ -704,30 +1579,113 @@ func (s *ServerCommand) newServerApp(ctx context.Context) (*serverApp, error) {
 		_ = authRefreshCache.Close()
 		return nil, fmt.Errorf("failed to make config of ssl server params: %w", err)
 	}
+	adminCert, err := s.makeAdminCertPolicy()
+	if err != nil {
+		_ = dataService.Close()
+		_ = authRefreshCache.Close()
+		return nil, fmt.Errorf("failed to make admin client certificate policy: %w", err)
+	}
 
-	srv := &api.Rest{
-		Version:                    s.Revision,
-		DataService:                dataService,
-		WebRoot:                    s.WebRoot,
-		WebFS:                      webFS,
-		RemarkURL:                  s.RemarkURL,
-		ImageProxy:                 imgProxy,
-		CommentFormatter:           commentFormatter,
-		Migrator:                   migr,
-		ReadOnlyAge:                s.ReadOnlyAge,
-		SharedSecret:               s.SharedSecret,
-		TrustedProxies:             trustedProxies,
-		Authenticator:              authenticator,
-		Cache:                      loadingCache,
-		NotifyService:              notifyService,
-		TelegramService:            telegramService,
-		SSLConfig:                  sslConfig,
+	adminTOTP := api.AdminTOTP{Enabled: s.Admin.TOTP.Enable, Issuer: s.Admin.TOTP.Issuer, TTL: s.Admin.TOTP.TTL,
+		SameSite: s.parseSameSite(s.Auth.SameSite)}
+
+	shadowMirror, err := s.makeShadow()
+	if err != nil {
+		_ = dataService.Close()
+		_ = authRefreshCache.Close()
+		return nil, fmt.Errorf("failed to make requests shadowing: %w", err)
+	}
+
+	corsPolicies, err := s.makeCORSPolicies()
+	if err != nil {
+		_ = dataService.Close()
+		_ = authRefreshCache.Close()
+		return nil, fmt.Errorf("failed to make cors policies: %w", err)
+	}
+	if err = corsPolicies.Restore(dataService.SettingsStore); err != nil {
+		_ = dataService.Close()
+		_ = authRefreshCache.Close()
+		return nil, fmt.Errorf("failed to restore cors policies: %w", err)
+	}
+
+	limits, err := s.makeLimits()
+	if err != nil {
+		_ = dataService.Close()
+		_ = authRefreshCache.Close()
+		return nil, fmt.Errorf("failed to make request limits: %w", err)
+	}
+
+	plugins, err := s.makePlugins()
+	if err != nil {
+		_ = dataService.Close()
+		_ = authRefreshCache.Close()
+		return nil, fmt.Errorf("failed to load plugins: %w", err)
+	}
+	dataService.Renderer = api.CommentRenderer{Formatter: commentFormatter, Plugins: plugins, Raw: s.DisableFancyTextFormatting}
+
+	captcha, err := s.makeCaptcha()
+	if err != nil {
+		_ = dataService.Close()
+		_ = authRefreshCache.Close()
+		return nil, fmt.Errorf("failed to make captcha: %w", err)
+	}
+
+	jwks, err := s.makeJWKS()
+	if err != nil {
+		_ = dataService.Close()
+		_ = authRefreshCache.Close()
+		return nil, fmt.Errorf("failed to make jwks: %w", err)
+	}
+
+	tokenRotation := s.makeTokenRotation(authenticator)
+
+	listener, err := s.makeListener()
+	if err != nil {
+		_ = dataService.Close()
+		_ = authRefreshCache.Close()
+		return nil, fmt.Errorf("failed to make listener: %w", err)
+	}
+
+	srv := &api.Rest{
+		Version:                    s.Revision,
+		DataService:                dataService,
+		WebRoot:                    s.WebRoot,
+		WebFS:                      webFS,
+		RemarkURL:                  s.RemarkURL,
+		ImageProxy:                 imgProxy,
+		CommentFormatter:           commentFormatter,
+		Migrator:                   migr,
+		ReadOnlyAge:                s.ReadOnlyAge,
+		SharedSecret:               s.SharedSecret,
+		TrustedProxies:             trustedProxies,
+		TrustedHeader:              s.TrustedProxyHeader,
+		Authenticator:              authenticator,
+		Cache:                      loadingCache,
+		CDNMaxAge:                  s.CDN.MaxAge,
+		NotifyService:              notifyService,
+		TelegramService:            telegramService,
+		SSLConfig:                  sslConfig,
+		AdminCert:                  adminCert,
+		AdminTOTP:                  adminTOTP,
+		AdminListen:                s.AdminListen,
+		AdminPprof:                 s.AdminPprof,
+		Listener:                   listener,
 		UpdateLimiter:              s.UpdateLimit,
 		ImageService:               imageService,
 		EmailNotifications:         contains("email", s.Notify.Users),
 		TelegramNotifications:      contains("telegram", s.Notify.Users) && telegramService != nil,
 		EmojiEnabled:               s.EnableEmoji,
 		AnonVote:                   s.AnonymousVote && s.RestrictVoteIP,
+		AnonLimit:                  s.Auth.AnonLimit,
+		BotLimit:                   s.Bots.Limit,
+		PoW:                        s.makePoW(),
+		AnonLoginPoW:               s.PoW.Enabled && s.PoW.AnonLogin,
+		Captcha:                    captcha,
+		AnonCaptcha:                s.Captcha.AnonLogin,
+		NewUserCaptcha:             s.Captcha.NewUser,
+		JWKS:                       jwks,
+		TokenRotation:              tokenRotation,
+		Maintenance:                rest.NewMaintenance(s.Maintenance, s.MaintenanceMessage),
 		SimpleView:                 s.SimpleView,
 		ProxyCORS:                  s.ProxyCORS,
 		AllowedAncestors:           s.AllowedHosts,
@@ -735,10 +1693,46 @@ func (s *ServerCommand) newServerApp(ctx context.Context) (*serverApp, error) {
 		SubscribersOnly:            s.SubscribersOnly,
 		DisableSignature:           s.DisableSignature,
 		DisableFancyTextFormatting: s.DisableFancyTextFormatting,
-		ExternalImageProxy:         s.ImageProxy.CacheExternal,
+		ExternalImageProxy:         s.ImageProxy.CacheExternal || s.ImageProxy.CDNOrigin,
+		PublishBlocklist:           s.Blocklist.Publish,
+		Shadow:                     shadowMirror,
+		CSPReports:                 s.makeCSPReports(),
+		SecurityHeaders:            s.securityHeaders(),
+		Remotes:                    s.remotes,
+		CORS:                       corsPolicies,
+		Limits:                     limits,
+		Plugins:                    plugins,
+		EmailEvents:                s.emailEvents(),
+	}
+	if samlAuth != nil {
+		srv.SAMLMetadata = http.HandlerFunc(samlAuth.MetadataHandler)
+	}
+	if webauthnAuth != nil {
+		srv.WebAuthnRegister = http.HandlerFunc(webauthnAuth.RegistrationHandler)
 	}
 
 	srv.ScoreThresholds.Low, srv.ScoreThresholds.Critical = s.LowScore, s.CriticalScore
+	srv.ScoreThresholds.Controversy = s.ControversyScore
+
+	sitemapSync, err := s.makeSitemapSyncer(dataService)
+	if err != nil {
+		_ = dataService.Close()
+		_ = authRefreshCache.Close()
+		if listener != nil {
+			_ = listener.Close()
+		}
+		return nil, fmt.Errorf("failed to make sitemap syncer: %w", err)
+	}
+	integrityJob, err := s.makeIntegrityJob(dataService, notifyService)
+	if err != nil {
+		_ = dataService.Close()
+		_ = authRefreshCache.Close()
+		if listener != nil {
+			_ = listener.Close()
+		}
+		return nil, fmt.Errorf("failed to make integrity checker: %w", err)
+	}
+	jobs = append(jobs, integrityJob, s.makeEventsCleanupJob(dataService.EventStore))
 
 	var devAuth *provider.DevAuthServer
 	if s.Auth.Dev {
@@ -746,6 +1740,9 @@ func (s *ServerCommand) newServerApp(ctx context.Context) (*serverApp, error) {
 		if errDevAuth != nil {
 			_ = dataService.Close()
 			_ = authRefreshCache.Close()
+			if listener != nil {
+				_ = listener.Close()
+			}
 			return nil, fmt.Errorf("can't make dev oauth2 server: %w", errDevAuth)
 		}
 		devAuth = da
@@ -764,9 +1761,175 @@ func (s *ServerCommand) newServerApp(ctx context.Context) (*serverApp, error) {
 		authenticator:    authenticator,
 		terminated:       make(chan struct{}),
 		authRefreshCache: authRefreshCache,
+		blocklistSync:    s.makeBlocklistSyncer(dataService, loadingCache),
+		sitemapSync:      sitemapSync,
+		scheduler:        s.makeScheduler(dataService, notifyService, loadingCache, jobs...),
+		coldFreezer:      s.makeColdFreezer(dataService, loadingCache),
 	}, nil
 }
 
+// languagePolicy makes language policy from lang options, restricted words set as lang:word pairs
+func (s *ServerCommand) languagePolicy() service.LanguagePolicy {
+	res := service.LanguagePolicy{Allowed: s.Lang.Allowed, Reject: s.Lang.Reject, RestrictedWords: map[string][]string{}}
+	for _, rw := range s.Lang.RestrictedWords {
+		lang, word, ok := strings.Cut(rw, ":")
+		if !ok || strings.TrimSpace(lang) == "" || strings.TrimSpace(word) == "" {
+			log.Printf("[WARN] invalid language restricted word %q, expected lang:word", rw)
+			continue
+		}
+		lang = strings.ToLower(strings.TrimSpace(lang))
+		res.RestrictedWords[lang] = append(res.RestrictedWords[lang], strings.TrimSpace(word))
+	}
+	return res
+}
+
+// voteWeights makes weights of votes by voter's level from level:weight pairs, invalid pairs skipped
+func (s *ServerCommand) voteWeights() service.VoteWeights {
+	res := service.VoteWeights{}
+	for _, vw := range s.Levels.VoteWeights {
+		level, weight, ok := strings.Cut(vw, ":")
+		lvl := store.UserLevel(strings.ToLower(strings.TrimSpace(level)))
+		w, err := strconv.ParseFloat(strings.TrimSpace(weight), 64)
+		if !ok || lvl.Rank() == 0 || err != nil || w < 0 {
+			log.Printf("[WARN] invalid vote weight %q, expected level:weight with non-negative weight", vw)
+			continue
+		}
+		res[lvl] = w
+	}
+	return res
+}
+
+// makeBrigades makes detector of vote brigading, nil if disabled
+func (s *ServerCommand) makeBrigades() (*brigade.Detector, error) {
+	if !s.Brigade.Enabled {
+		return nil, nil
+	}
+	if s.Brigade.Votes < 2 {
+		return nil, fmt.Errorf("brigade votes %d, should be at least 2", s.Brigade.Votes)
+	}
+	if s.Brigade.Window <= 0 || s.Brigade.Period <= 0 {
+		return nil, fmt.Errorf("brigade window %s and period %s should be positive", s.Brigade.Window, s.Brigade.Period)
+	}
+	return &brigade.Detector{Window: s.Brigade.Window, MinVotes: s.Brigade.Votes}, nil
+}
+
+// collapsePolicy makes default collapse policy of low-score comments, "off" mode disables it
+func (s *ServerCommand) collapsePolicy() service.CollapsePolicy {
+	res := service.CollapsePolicy{Mode: service.CollapseMode(s.CollapseMode), Threshold: s.CollapseScore}
+	if s.CollapseMode == "off" {
+		res.Mode = service.CollapseOff
+	}
+	return res
+}
+
+// securityHeaders makes configurable security headers from csp options, site ancestors set as site:source pairs
+func (s *ServerCommand) securityHeaders() api.SecurityHeaders {
+	res := api.SecurityHeaders{SiteAncestors: map[string][]string{}, ReferrerPolicy: s.CSP.ReferrerPolicy,
+		PermissionsPolicy: s.CSP.PermissionsPolicy}
+	for _, sa := range s.CSP.SiteAncestors {
+		siteID, source, ok := strings.Cut(sa, ":")
+		if !ok || strings.TrimSpace(siteID) == "" || strings.TrimSpace(source) == "" {
+			log.Printf("[WARN] invalid site ancestor %q, expected site:source", sa)
+			continue
+		}
+		siteID = strings.TrimSpace(siteID)
+		res.SiteAncestors[siteID] = append(res.SiteAncestors[siteID], strings.TrimSpace(source))
+	}
+	if s.ImageProxy.CDNOrigin && s.ImageProxy.CDNURL != "" {
+		res.ImgSources = []string{strings.TrimSuffix(s.ImageProxy.CDNURL, "/")}
+	}
+	return res
+}
+
+// makeCORSPolicies makes CORS policies from cors options, site origins set as site:origin pairs
+func (s *ServerCommand) makeCORSPolicies() (*rest.CORSPolicies, error) {
+	defaultPolicy := rest.CORSPolicy{Origins: s.CORS.Origins, Credentials: !s.CORS.DisableCredentials, MaxAge: s.CORS.MaxAge}
+	sites := map[string]rest.CORSPolicy{}
+	for _, so := range s.CORS.SiteOrigins {
+		siteID, origin, ok := strings.Cut(so, ":")
+		siteID, origin = strings.TrimSpace(siteID), strings.TrimSpace(origin)
+		if !ok || siteID == "" || origin == "" {
+			return nil, fmt.Errorf("invalid site origin %q, expected site:origin", so)
+		}
+		policy, ok := sites[siteID]
+		if !ok {
+			policy = rest.CORSPolicy{Credentials: defaultPolicy.Credentials, MaxAge: defaultPolicy.MaxAge}
+		}
+		policy.Origins = append(policy.Origins, origin)
+		sites[siteID] = policy
+	}
+	return rest.NewCORSPolicies(defaultPolicy, sites)
+}
+
+// makeLimits makes body size limits and timeouts of requests, all should be positive
+func (s *ServerCommand) makeLimits() (api.Limits, error) {
+	res := api.Limits{CommentBody: s.Limits.CommentBody, ImageBody: s.Limits.ImageBody, ImportBody: s.Limits.ImportBody,
+		CommentTimeout: s.Limits.CommentTimeout, ImageTimeout: s.Limits.ImageTimeout, ImportTimeout: s.Limits.ImportTimeout,
+		ReadHeaderTimeout: s.Limits.ReadHeaderTimeout, IdleTimeout: s.Limits.IdleTimeout}
+	if res.CommentBody <= 0 || res.ImageBody <= 0 || res.ImportBody <= 0 {
+		return api.Limits{}, fmt.Errorf("body limits should be positive, comment %d, image %d, import %d",
+			res.CommentBody, res.ImageBody, res.ImportBody)
+	}
+	for _, d := range []time.Duration{res.CommentTimeout, res.ImageTimeout, res.ImportTimeout, res.ReadHeaderTimeout, res.IdleTimeout} {
+		if d <= 0 {
+			return api.Limits{}, fmt.Errorf("timeouts should be positive, got %v", d)
+		}
+	}
+	return res, nil
+}
+
+// emailEvents makes settings of the webhook receiving bounces and complaints from the email provider
+func (s *ServerCommand) emailEvents() api.EmailEvents {
+	if !s.emailAPIEnabled() {
+		return api.EmailEvents{}
+	}
+	return api.EmailEvents{Provider: s.EmailAPI.Provider, Secret: s.EmailAPI.EventsSecret, Sites: s.Sites}
+}
+
+// makeCSPReports makes collector of CSP violation reports, nil if reporting disabled
+func (s *ServerCommand) makeCSPReports() *rest.CSPReports {
+	if !s.CSP.Report {
+		return nil
+	}
+	log.Print("[INFO] collect CSP violation reports")
+	return rest.NewCSPReports(100)
+}
+
+// cannedResponses makes default canned responses from options set as id:text pairs
+func (s *ServerCommand) cannedResponses() []service.CannedResponse {
+	res := []service.CannedResponse{}
+	for _, cr := range s.CannedResponses {
+		id, text, ok := strings.Cut(cr, ":")
+		if !ok || strings.TrimSpace(id) == "" || strings.TrimSpace(text) == "" {
+			log.Printf("[WARN] invalid canned response %q, expected id:text", cr)
+			continue
+		}
+		res = append(res, service.CannedResponse{ID: strings.TrimSpace(id), Text: strings.TrimSpace(text)})
+	}
+	return res
+}
+
+// timezones makes timezones of sites from "zone" (default for all sites) and "site:zone" entries
+func (s *ServerCommand) timezones() (service.StaticTimezoneLister, error) {
+	res := service.StaticTimezoneLister{Sites: map[string]*time.Location{}}
+	for _, tz := range s.Timezones {
+		siteID, zone, ok := strings.Cut(tz, ":")
+		if !ok {
+			siteID, zone = "", tz
+		}
+		loc, err := time.LoadLocation(strings.TrimSpace(zone))
+		if err != nil {
+			return service.StaticTimezoneLister{}, fmt.Errorf("invalid timezone %q: %w", tz, err)
+		}
+		if siteID = strings.TrimSpace(siteID); siteID == "" {
+			res.Default = loc
+			continue
+		}
+		res.Sites[siteID] = loc
+	}
+	return res, nil
+}
+
 // Extract domains from s.AllowedHosts and second level domain from s.RemarkURL.
 // It can be and IP like http://127.0.0.1 in which case we need to use whole IP as domain
 // Beware, if s.RemarkURL is in third-level domain like https://example.co.uk, co.uk will be returned.
@@ -868,6 +2031,21 @@ func (a *serverApp) run(ctx context.Context) error {
 	}
 
 	go a.imageService.Cleanup(ctx) // pictures cleanup for staging images
+	if a.blocklistSync != nil {
+		go a.blocklistSync.Run(ctx, a.Blocklist.Refresh)
+	}
+	if a.sitemapSync != nil {
+		go a.sitemapSync.Run(ctx, a.Pages.SitemapRefresh)
+	}
+	if a.scheduler != nil {
+		go a.scheduler.Run(ctx, a.Schedule.Period)
+	}
+	if a.coldFreezer != nil {
+		go a.coldFreezer.Run(ctx, a.Cold.Period)
+	}
+	if a.dataService.Brigades != nil {
+		go a.dataService.Brigades.Run(ctx, a.Brigade.Period)
+	}
 
 	a.restSrv.Run(a.Address, a.Port)
 
@@ -888,6 +2066,9 @@ func (a *serverApp) run(ctx context.Context) error {
 		log.Printf("[WARN] failed to close auth authRefreshCache, %s", e)
 	}
 	a.notifyService.Close()
+	if e := a.restSrv.Plugins.Close(context.Background()); e != nil {
+		log.Printf("[WARN] failed to close plugins, %s", e)
+	}
 	// call potentially infinite loop with cancellation after a minute as a safeguard
 	minuteCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
 	defer cancel()
@@ -912,10 +2093,36 @@ func (a *serverApp) activateBackup(ctx context.Context) {
 			KeepMax:        a.MaxBackupFiles,
 			Duration:       24 * time.Hour,
 		}
+		if a.BackupVerify {
+			backup.Verifier = &migrator.Verifier{Store: a.dataService, AdminStore: a.dataService.AdminStore}
+			backup.Notifier = a.notifyService
+		}
 		go backup.Do(ctx)
 	}
 }
 
+// makePIIVault creates vault sealing stored emails, nil if PII minimization is disabled
+func (s *ServerCommand) makePIIVault() (*service.PIIVault, error) {
+	if !s.PII.Minimize {
+		return nil, nil
+	}
+	key := s.PII.Key
+	if key == "" {
+		key = s.SharedSecret
+	}
+	log.Print("[INFO] pii minimization enabled, emails stored sealed")
+	return service.NewPIIVault(key)
+}
+
+// makeDetailCipher creates cipher for sensitive user details, nil if encryption is disabled
+func (s *ServerCommand) makeDetailCipher() (*service.DetailCipher, error) {
+	if s.Encrypt.Key == "" {
+		return nil, nil
+	}
+	log.Printf("[INFO] user details encrypted, %d old keys", len(s.Encrypt.OldKeys))
+	return service.NewDetailCipher(s.Encrypt.Key, s.Encrypt.OldKeys...)
+}
+
 // makeDataStore creates store for all sites
 func (s *ServerCommand) makeDataStore() (result engine.Interface, err error) {
 	log.Printf("[INFO] make data store, type=%s", s.Store.Type)
@@ -931,12 +2138,7 @@ func (s *ServerCommand) makeDataStore() (result engine.Interface, err error) {
 		}
 		result, err = engine.NewBoltDB(bolt.Options{Timeout: s.Store.Bolt.Timeout}, sites...)
 	case "rpc":
-		r := &engine.RPC{Client: jrpc.Client{
-			API:        s.Store.RPC.API,
-			Client:     http.Client{Timeout: s.Store.RPC.TimeOut},
-			AuthUser:   s.Store.RPC.AuthUser,
-			AuthPasswd: s.Store.RPC.AuthPassword,
-		}}
+		r := &engine.RPC{Client: s.makeRPCClient("store", s.Store.RPC)}
 		return r, nil
 	default:
 		return nil, fmt.Errorf("unsupported store type %s", s.Store.Type)
@@ -947,6 +2149,18 @@ func (s *ServerCommand) makeDataStore() (result engine.Interface, err error) {
 	return result, nil
 }
 
+// makeRPCClient makes client of remote store, with retries and circuit breaker
+func (s *ServerCommand) makeRPCClient(name string, g RPCGroup) jrpc.Client {
+	tr := &resilient.Transport{Name: name, Retries: g.Retries, Backoff: g.Backoff, Threshold: g.Breaker, Cooldown: g.Cooldown}
+	s.remotes = append(s.remotes, tr)
+	return jrpc.Client{
+		API:        g.API,
+		Client:     http.Client{Timeout: g.TimeOut, Transport: tr},
+		AuthUser:   g.AuthUser,
+		AuthPasswd: g.AuthPassword,
+	}
+}
+
 func (s *ServerCommand) makeAvatarStore() (avatar.Store, error) {
 	log.Printf("[INFO] make avatar store, type=%s", s.Avatar.Type)
 
@@ -967,127 +2181,698 @@ func (s *ServerCommand) makeAvatarStore() (avatar.Store, error) {
 	return nil, fmt.Errorf("unsupported avatar store type %s", s.Avatar.Type)
 }
 
-func (s *ServerCommand) makePicturesStore() (*image.Service, error) {
-	imageServiceParams := image.ServiceParams{
-		ImageAPI:     s.RemarkURL + "/api/v1/picture/",
-		ProxyAPI:     s.RemarkURL + "/api/v1/img",
-		EditDuration: s.EditDuration,
-		MaxSize:      s.Image.MaxSize,
-		MaxHeight:    s.Image.ResizeHeight,
-		MaxWidth:     s.Image.ResizeWidth,
+// makePollStore makes bolt poll store, nil if polls disabled
+func (s *ServerCommand) makePollStore() (poll.Store, error) {
+	if !s.Polls.Enabled {
+		return nil, nil
 	}
-	switch s.Image.Type {
-	case "bolt":
-		boltImageStore, err := image.NewBoltStorage(s.Image.Bolt.File, bolt.Options{})
-		if err != nil {
-			return nil, err
-		}
-		return image.NewService(boltImageStore, imageServiceParams), nil
-	case "fs":
-		if err := makeDirs(s.Image.FS.Path); err != nil {
-			return nil, fmt.Errorf("failed to create pictures store: %w", err)
-		}
-		return image.NewService(&image.FileSystem{
-			Location:   s.Image.FS.Path,
-			Staging:    s.Image.FS.Staging,
-			Partitions: s.Image.FS.Partitions,
-		}, imageServiceParams), nil
-	case "rpc":
-		return image.NewService(&image.RPC{
-			Client: jrpc.Client{
-				API:        s.Image.RPC.API,
-				Client:     http.Client{Timeout: s.Image.RPC.TimeOut},
-				AuthUser:   s.Image.RPC.AuthUser,
-				AuthPasswd: s.Image.RPC.AuthPassword,
-			}}, imageServiceParams), nil
+	if err := makeDirs(path.Dir(s.Polls.File)); err != nil {
+		return nil, err
 	}
-	return nil, fmt.Errorf("unsupported pictures store type %s", s.Image.Type)
+	pollStore, err := poll.NewBoltStorage(s.Polls.File, bolt.Options{Timeout: s.Store.Bolt.Timeout})
+	if err != nil {
+		return nil, err
+	}
+	return pollStore, nil
 }
 
-func (s *ServerCommand) makeAdminStore() (admin.Store, error) {
-	log.Printf("[INFO] make admin store, type=%s", s.Admin.Type)
+// makeHighlightStore makes bolt highlight store, nil if highlights disabled
+func (s *ServerCommand) makeHighlightStore() (highlight.Store, error) {
+	if !s.Highlights.Enabled {
+		return nil, nil
+	}
+	if err := makeDirs(path.Dir(s.Highlights.File)); err != nil {
+		return nil, err
+	}
+	highlightStore, err := highlight.NewBoltStorage(s.Highlights.File, bolt.Options{Timeout: s.Store.Bolt.Timeout})
+	if err != nil {
+		return nil, err
+	}
+	return highlightStore, nil
+}
 
-	switch s.Admin.Type {
-	case "shared":
-		sharedAdminEmail := ""
-		if len(s.Admin.Shared.Email) == 0 { // no admin email, use admin@domain
-			if u, err := url.Parse(s.RemarkURL); err == nil {
-				sharedAdminEmail = "admin@" + u.Host
-			}
-		} else {
-			sharedAdminEmail = s.Admin.Shared.Email[0]
-		}
-		return admin.NewStaticStore(s.SharedSecret, s.Sites, s.Admin.Shared.Admins, sharedAdminEmail), nil
-	case "rpc":
-		r := &admin.RPC{Client: jrpc.Client{
-			API:        s.Admin.RPC.API,
-			Client:     http.Client{Timeout: s.Admin.RPC.TimeOut},
-			AuthUser:   s.Admin.RPC.AuthUser,
-			AuthPasswd: s.Admin.RPC.AuthPassword,
-		}}
-		return r, nil
-	default:
-		return nil, fmt.Errorf("unsupported admin store type %s", s.Admin.Type)
+// makeEventStore makes bolt event store, nil if events journal disabled
+func (s *ServerCommand) makeEventStore() (event.Store, error) {
+	if !s.Events.Enabled {
+		return nil, nil
+	}
+	if err := makeDirs(path.Dir(s.Events.File)); err != nil {
+		return nil, err
+	}
+	eventStore, err := event.NewBoltStorage(s.Events.File, bolt.Options{Timeout: s.Store.Bolt.Timeout})
+	if err != nil {
+		return nil, err
 	}
+	return eventStore, nil
 }
 
-func (s *ServerCommand) makeCache() (LoadingCache, error) {
-	log.Printf("[INFO] make cache, type=%s", s.Cache.Type)
-	o := cache.NewOpts[[]byte]()
-	switch s.Cache.Type {
-	case "redis_pub_sub":
-		redisPubSub, err := eventbus.NewRedisPubSub(s.Cache.RedisAddr, "remark42-cache")
-		if err != nil {
-			return nil, fmt.Errorf("cache backend initialization, redis PubSub initialisation: %w", err)
-		}
-		backend, err := cache.NewLruCache(o.MaxCacheSize(s.Cache.Max.Size), o.MaxValSize(s.Cache.Max.Value),
-			o.MaxKeys(s.Cache.Max.Items), o.EventBus(redisPubSub))
-		if err != nil {
-			return nil, fmt.Errorf("cache backend initialization: %w", err)
-		}
-		return cache.NewScache[[]byte](backend), nil
-	case "mem":
-		backend, err := cache.NewLruCache(o.MaxCacheSize(s.Cache.Max.Size), o.MaxValSize(s.Cache.Max.Value),
-			o.MaxKeys(s.Cache.Max.Items))
-		if err != nil {
-			return nil, fmt.Errorf("cache backend initialization: %w", err)
-		}
-		return cache.NewScache[[]byte](backend), nil
-	case "none":
-		return cache.NewScache[[]byte](&cache.Nop[[]byte]{}), nil
+// makeInviteStore makes bolt store of admin invitations, nil if disabled
+func (s *ServerCommand) makeInviteStore() (invite.Store, error) {
+	if !s.Invite.Enabled {
+		return nil, nil
 	}
-	return nil, fmt.Errorf("unsupported cache type %s", s.Cache.Type)
+	if err := makeDirs(path.Dir(s.Invite.File)); err != nil {
+		return nil, err
+	}
+	inviteStore, err := invite.NewBoltStorage(s.Invite.File, bolt.Options{Timeout: s.Store.Bolt.Timeout})
+	if err != nil {
+		return nil, err
+	}
+	return inviteStore, nil
 }
 
-//nolint:gocyclo // simple code but many if checks
-func (s *ServerCommand) addAuthProviders(authenticator *auth.Service) error {
-	providersCount := 0
-	if s.Auth.Telegram {
-		providersCount++
+// makeBotStore makes bolt store of bot accounts, nil if disabled
+func (s *ServerCommand) makeBotStore() (bot.Store, error) {
+	if !s.Bots.Enabled {
+		return nil, nil
 	}
+	if err := makeDirs(path.Dir(s.Bots.File)); err != nil {
+		return nil, err
+	}
+	botStore, err := bot.NewBoltStorage(s.Bots.File, bolt.Options{Timeout: s.Store.Bolt.Timeout})
+	if err != nil {
+		return nil, err
+	}
+	return botStore, nil
+}
 
-	if s.Auth.Apple.CID != "" && s.Auth.Apple.TID != "" && s.Auth.Apple.KID != "" {
-		err := authenticator.AddAppleProvider(
-			provider.AppleConfig{
-				ClientID: s.Auth.Apple.CID,
-				TeamID:   s.Auth.Apple.TID,
-				KeyID:    s.Auth.Apple.KID,
-			},
-			provider.LoadApplePrivateKeyFromFile(s.Auth.Apple.PrivateKeyFilePath),
-		)
-		if err != nil {
-			return err
+// makePageChecker makes checker of pages with endpoints of the sites from "site:url" entries, nil if none set
+func (s *ServerCommand) makePageChecker() (*service.PageWebhook, error) {
+	if len(s.PageCheck.URLs) == 0 {
+		return nil, nil
+	}
+	urls := map[string]string{}
+	for _, entry := range s.PageCheck.URLs {
+		siteID, endpoint, ok := strings.Cut(entry, ":")
+		siteID, endpoint = strings.TrimSpace(siteID), strings.TrimSpace(endpoint)
+		if !ok || siteID == "" {
+			return nil, fmt.Errorf("no site in %q, expected site:url", entry)
 		}
-		providersCount++
+		if u, err := url.Parse(endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid page check url in %q", entry)
+		}
+		urls[siteID] = endpoint
 	}
-	if s.Auth.Google.CID != "" && s.Auth.Google.CSEC != "" {
-		authenticator.AddProvider("google", s.Auth.Google.CID, s.Auth.Google.CSEC)
-		providersCount++
+	log.Printf("[INFO] page check enabled for %d site(s), fail-open=%v", len(urls), s.PageCheck.FailOpen)
+	return service.NewPageWebhook(urls, http.Client{Timeout: s.PageCheck.Timeout}, s.PageCheck.TTL, s.PageCheck.FailOpen), nil
+}
+
+// makeSuppressStore makes bolt store of suppressed email addresses, nil if disabled
+func (s *ServerCommand) makeSuppressStore() (suppress.Store, error) {
+	if !s.Suppress.Enabled {
+		return nil, nil
 	}
-	if s.Auth.Github.CID != "" && s.Auth.Github.CSEC != "" {
+	if err := makeDirs(path.Dir(s.Suppress.File)); err != nil {
+		return nil, err
+	}
+	suppressStore, err := suppress.NewBoltStorage(s.Suppress.File, bolt.Options{Timeout: s.Store.Bolt.Timeout})
+	if err != nil {
+		return nil, err
+	}
+	return suppressStore, nil
+}
+
+// makeScheduleStore makes bolt store of scheduled moderation actions, nil if disabled
+func (s *ServerCommand) makeScheduleStore() (schedule.Store, error) {
+	if !s.Schedule.Enabled {
+		return nil, nil
+	}
+	if s.Schedule.Period <= 0 {
+		return nil, fmt.Errorf("invalid schedule period %s", s.Schedule.Period)
+	}
+	if err := makeDirs(path.Dir(s.Schedule.File)); err != nil {
+		return nil, err
+	}
+	scheduleStore, err := schedule.NewBoltStorage(s.Schedule.File, bolt.Options{Timeout: s.Store.Bolt.Timeout})
+	if err != nil {
+		return nil, err
+	}
+	return scheduleStore, nil
+}
+
+// makeColdStore makes bolt store of inactive posts, nil if disabled
+func (s *ServerCommand) makeColdStore() (cold.Store, error) {
+	if !s.Cold.Enabled {
+		return nil, nil
+	}
+	if s.Cold.Period <= 0 || s.Cold.Inactive <= 0 {
+		return nil, fmt.Errorf("invalid cold storage period %s or inactivity %s", s.Cold.Period, s.Cold.Inactive)
+	}
+	if err := makeDirs(path.Dir(s.Cold.File)); err != nil {
+		return nil, err
+	}
+	coldStore, err := cold.NewBoltStorage(s.Cold.File, bolt.Options{Timeout: s.Store.Bolt.Timeout})
+	if err != nil {
+		return nil, err
+	}
+	return coldStore, nil
+}
+
+// makePageStore makes bolt store of per-post settings, nil if disabled
+func (s *ServerCommand) makePageStore() (page.Store, error) {
+	if !s.Pages.Enabled {
+		return nil, nil
+	}
+	if err := makeDirs(path.Dir(s.Pages.File)); err != nil {
+		return nil, err
+	}
+	pageStore, err := page.NewBoltStorage(s.Pages.File, bolt.Options{Timeout: s.Store.Bolt.Timeout})
+	if err != nil {
+		return nil, err
+	}
+	return pageStore, nil
+}
+
+// makeSettingsStore makes bolt store of per-site settings changed at runtime
+func (s *ServerCommand) makeSettingsStore() (settings.Store, error) {
+	file := s.Settings.File
+	if file == "" {
+		file = path.Join(s.Store.Bolt.Path, "settings.db") // next to the bolt files of sites
+	}
+	if err := makeDirs(path.Dir(file)); err != nil {
+		return nil, err
+	}
+	settingsStore, err := settings.NewBoltStorage(file, bolt.Options{Timeout: s.Store.Bolt.Timeout})
+	if err != nil {
+		return nil, err
+	}
+	return settingsStore, nil
+}
+
+// makeQuotas makes per-site usage quotas, nil if disabled
+func (s *ServerCommand) makeQuotas() (*service.Quotas, error) {
+	if !s.Quota.Enabled {
+		return nil, nil
+	}
+	for _, t := range s.Quota.Thresholds {
+		if t <= 0 || t > 100 {
+			return nil, fmt.Errorf("invalid quota threshold %d%%", t)
+		}
+	}
+	if err := makeDirs(path.Dir(s.Quota.File)); err != nil {
+		return nil, err
+	}
+	quotaStore, err := quota.NewBoltStorage(s.Quota.File, bolt.Options{Timeout: s.Store.Bolt.Timeout})
+	if err != nil {
+		return nil, err
+	}
+	return service.NewQuotas(quotaStore, service.QuotaParams{
+		Limits:     quota.Limits{Comments: s.Quota.Comments, Notifications: s.Quota.Notifications, Storage: s.Quota.Storage},
+		Mode:       s.Quota.Mode,
+		Throttle:   s.Quota.Throttle,
+		Thresholds: s.Quota.Thresholds,
+		Webhook:    s.Quota.Webhook,
+		Client:     &http.Client{Timeout: 10 * time.Second},
+	}), nil
+}
+
+// makeEventBus makes publisher of domain events to nats or kafka, nil if disabled
+func (s *ServerCommand) makeEventBus() (service.EventPublisher, error) {
+	if s.EventBus.Type == "" || s.EventBus.Type == "none" {
+		return nil, nil
+	}
+	if len(s.EventBus.Servers) == 0 {
+		return nil, errors.New("no event bus servers")
+	}
+	opts := msgbus.Options{Topic: s.EventBus.Topic, Timeout: s.EventBus.Timeout}
+	if s.EventBus.Format == "avro" {
+		encoder, err := msgbus.NewAvro()
+		if err != nil {
+			return nil, err
+		}
+		opts.Encoder = encoder
+	}
+
+	var pub msgbus.Publisher
+	switch s.EventBus.Type {
+	case "nats":
+		natsPub, err := msgbus.NewNATS(msgbus.NATSParams{URLs: s.EventBus.Servers, Timeout: s.EventBus.Timeout})
+		if err != nil {
+			return nil, err
+		}
+		pub = natsPub
+	case "kafka":
+		pub = msgbus.NewKafka(msgbus.KafkaParams{Brokers: s.EventBus.Servers, Timeout: s.EventBus.Timeout})
+	default:
+		return nil, fmt.Errorf("unsupported event bus type %s", s.EventBus.Type)
+	}
+	return msgbus.NewService(pub, opts), nil
+}
+
+// makeAssetStore makes bolt asset store, nil if assets disabled
+func (s *ServerCommand) makeAssetStore() (asset.Store, error) {
+	if !s.Assets.Enabled {
+		return nil, nil
+	}
+	if err := makeDirs(path.Dir(s.Assets.File)); err != nil {
+		return nil, err
+	}
+	assetStore, err := asset.NewBoltStorage(s.Assets.File, bolt.Options{Timeout: s.Store.Bolt.Timeout})
+	if err != nil {
+		return nil, err
+	}
+	return assetStore, nil
+}
+
+// makeExitNodeLists makes Tor exit nodes and VPN lists, "tor" and "vpn" keys set only for the lists used by the policy
+func (s *ServerCommand) makeExitNodeLists(policy service.StaticExitNodePolicyLister) map[string]*iplist.List {
+	res := map[string]*iplist.List{}
+	client := &http.Client{Timeout: 30 * time.Second}
+	if policy.Uses("tor") && len(s.ExitNodes.TorList) > 0 {
+		res["tor"] = &iplist.List{Name: "tor", Sources: s.ExitNodes.TorList, Client: client}
+	}
+	if policy.Uses("vpn") {
+		if len(s.ExitNodes.VPNList) == 0 {
+			log.Printf("[WARN] vpn policy %v set without vpn list, ignored", s.ExitNodes.VPN)
+			return res
+		}
+		res["vpn"] = &iplist.List{Name: "vpn", Sources: s.ExitNodes.VPNList, Client: client}
+	}
+	return res
+}
+
+// makeBlocklistSyncer makes syncer of blocklist feeds into all sites, nil if no feeds set.
+// Cache of the site flushed on changes, as comments of blocked users rendered differently.
+func (s *ServerCommand) makeBlocklistSyncer(dataService *service.DataStore, loadingCache LoadingCache) *blocklist.Syncer {
+	if len(s.Blocklist.Feeds) == 0 {
+		return nil
+	}
+	return &blocklist.Syncer{
+		Feeds:    s.Blocklist.Feeds,
+		Sites:    s.Sites,
+		Allow:    s.Blocklist.Allow,
+		Store:    dataService,
+		Client:   &http.Client{Timeout: 30 * time.Second},
+		OnUpdate: func(siteID string) { cdn.Flush(loadingCache, siteID, siteID) },
+	}
+}
+
+// makeSitemapSyncer makes syncer of sitemaps registering posts from "site:url" entries, nil if none set
+func (s *ServerCommand) makeSitemapSyncer(dataService *service.DataStore) (*sitemap.Syncer, error) {
+	if len(s.Pages.Sitemaps) == 0 {
+		return nil, nil
+	}
+	if dataService.PageStore == nil {
+		return nil, errors.New("sitemaps require pages.enabled")
+	}
+	sitemaps := map[string]string{}
+	for _, entry := range s.Pages.Sitemaps {
+		siteID, sitemapURL, ok := strings.Cut(entry, ":")
+		siteID, sitemapURL = strings.TrimSpace(siteID), strings.TrimSpace(sitemapURL)
+		if !ok || siteID == "" {
+			return nil, fmt.Errorf("no site in %q, expected site:url", entry)
+		}
+		if u, err := url.Parse(sitemapURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid sitemap url in %q", entry)
+		}
+		sitemaps[siteID] = sitemapURL
+	}
+	return &sitemap.Syncer{Sitemaps: sitemaps, Store: dataService, Client: &http.Client{Timeout: 30 * time.Second}}, nil
+}
+
+// makeScheduler makes runner of scheduled moderation actions and the given jobs, nil jobs skipped.
+// Returns nil if scheduled actions disabled and there are no jobs.
+func (s *ServerCommand) makeScheduler(dataService *service.DataStore, notifyService *notify.Service, loadingCache LoadingCache,
+	jobs ...*scheduler.Job) *scheduler.Scheduler {
+	res := &scheduler.Scheduler{
+		Notifier: notifyService,
+		OnUpdate: func(siteID string) { cdn.Flush(loadingCache, siteID, siteID) },
+	}
+	if dataService.ScheduleStore != nil {
+		res.Store = dataService
+	}
+	for _, j := range jobs {
+		if j != nil {
+			res.Add(*j)
+		}
+	}
+	if res.Store == nil && !res.HasJobs() {
+		return nil
+	}
+	return res
+}
+
+// makeColdFreezer makes runner moving inactive posts to cold storage, nil if disabled
+func (s *ServerCommand) makeColdFreezer(dataService *service.DataStore, loadingCache LoadingCache) *cold.Freezer {
+	if dataService.ColdStore == nil {
+		return nil
+	}
+	return &cold.Freezer{
+		Store:    dataService,
+		Sites:    s.Sites,
+		Inactive: s.Cold.Inactive,
+		OnUpdate: func(siteID string) { cdn.Flush(loadingCache, siteID, siteID) },
+	}
+}
+
+// makeIntegrityJob makes nightly job of integrity checks reporting to admins, nil if disabled
+func (s *ServerCommand) makeIntegrityJob(dataService *service.DataStore, notifyService *notify.Service) (*scheduler.Job, error) {
+	if !s.Integrity.Enabled {
+		return nil, nil
+	}
+	at, err := time.Parse("15:04", s.Integrity.At)
+	if err != nil {
+		return nil, fmt.Errorf("invalid integrity check time %q, expected HH:MM", s.Integrity.At)
+	}
+	checker := &integrity.Checker{Store: dataService, Notifier: notifyService, Sites: s.Sites, RemarkURL: s.RemarkURL}
+	return &scheduler.Job{
+		Name: "integrity check",
+		Next: scheduler.Daily(time.Duration(at.Hour())*time.Hour + time.Duration(at.Minute())*time.Minute),
+		Run:  func(context.Context) { checker.Do() },
+	}, nil
+}
+
+// makeEventsCleanupJob makes hourly job removing events older than the retention period, nil if events kept forever
+func (s *ServerCommand) makeEventsCleanupJob(eventStore event.Store) *scheduler.Job {
+	if eventStore == nil || s.Events.Keep <= 0 {
+		return nil
+	}
+	return &scheduler.Job{
+		Name:  "events cleanup",
+		Next:  scheduler.Every(time.Hour),
+		Start: true,
+		Run: func(context.Context) {
+			removed, err := eventStore.Cleanup(time.Now().Add(-s.Events.Keep))
+			if err != nil {
+				log.Printf("[WARN] failed to clean up events, %v", err)
+				return
+			}
+			if removed > 0 {
+				log.Printf("[INFO] removed %d events older than %v", removed, s.Events.Keep)
+			}
+		},
+	}
+}
+
+// makeShadow makes mirror of read requests to the secondary instance, nil if shadow url not set
+func (s *ServerCommand) makeShadow() (*shadow.Mirror, error) {
+	if s.Shadow.URL == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(s.Shadow.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid shadow url %q", s.Shadow.URL)
+	}
+	if s.Shadow.Sample <= 0 || s.Shadow.Sample > 1 {
+		return nil, fmt.Errorf("shadow sample %v out of range (0..1]", s.Shadow.Sample)
+	}
+	log.Printf("[INFO] mirror %.2f%% of read requests to %s", s.Shadow.Sample*100, s.Shadow.URL)
+	return &shadow.Mirror{URL: s.Shadow.URL, SampleRate: s.Shadow.Sample, Client: &http.Client{Timeout: 10 * time.Second}}, nil
+}
+
+// makePlugins loads WASM plugins from plugins dir, nil if not set
+func (s *ServerCommand) makePlugins() (*plugin.Manager, error) {
+	if s.Plugins.Dir == "" {
+		return nil, nil
+	}
+	if s.Plugins.Memory <= 0 || s.Plugins.Memory >= 4096 {
+		return nil, fmt.Errorf("plugins memory %dM out of range 1..4095", s.Plugins.Memory)
+	}
+	log.Printf("[INFO] load plugins from %s", s.Plugins.Dir)
+	return plugin.New(context.Background(), s.Plugins.Dir,
+		plugin.Options{Timeout: s.Plugins.Timeout, MemoryLimit: uint32(s.Plugins.Memory) * 1024 * 1024}) //nolint:gosec // checked above
+}
+
+// geoPolicy makes geo policies of sites from "value" (default for all sites) and "site:value" entries
+func (s *ServerCommand) geoPolicy() (service.StaticGeoPolicyLister, error) {
+	res := service.StaticGeoPolicyLister{Sites: map[string]service.GeoPolicy{}}
+	sites := map[string]*service.GeoPolicy{}
+	policy := func(siteID string) *service.GeoPolicy {
+		if siteID == "" {
+			return &res.Default
+		}
+		if _, ok := sites[siteID]; !ok {
+			sites[siteID] = &service.GeoPolicy{}
+		}
+		return sites[siteID]
+	}
+	for _, entry := range s.Geo.BlockCountries {
+		siteID, country := siteEntry(entry)
+		p := policy(siteID)
+		p.BlockCountries = append(p.BlockCountries, country)
+	}
+	for _, entry := range s.Geo.ModerateCountries {
+		siteID, country := siteEntry(entry)
+		p := policy(siteID)
+		p.ModerateCountries = append(p.ModerateCountries, country)
+	}
+	parseASN := func(entry string) (string, uint, error) {
+		siteID, value := siteEntry(entry)
+		asn, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return "", 0, fmt.Errorf("invalid asn %q", entry)
+		}
+		return siteID, uint(asn), nil
+	}
+	for _, entry := range s.Geo.BlockASNs {
+		siteID, asn, err := parseASN(entry)
+		if err != nil {
+			return service.StaticGeoPolicyLister{}, err
+		}
+		p := policy(siteID)
+		p.BlockASNs = append(p.BlockASNs, asn)
+	}
+	for _, entry := range s.Geo.ModerateASNs {
+		siteID, asn, err := parseASN(entry)
+		if err != nil {
+			return service.StaticGeoPolicyLister{}, err
+		}
+		p := policy(siteID)
+		p.ModerateASNs = append(p.ModerateASNs, asn)
+	}
+	for siteID, p := range sites {
+		res.Sites[siteID] = *p
+	}
+	return res, nil
+}
+
+// exitNodePolicy makes exit nodes policies of sites from "action" (default for all sites) and "site:action" entries
+func (s *ServerCommand) exitNodePolicy() (service.StaticExitNodePolicyLister, error) {
+	res := service.StaticExitNodePolicyLister{Sites: map[string]service.ExitNodePolicy{}}
+	parse := func(entries []string, set func(p *service.ExitNodePolicy, a service.NetworkAction)) error {
+		for _, entry := range entries {
+			siteID, value := siteEntry(entry)
+			a := service.NetworkAction(value)
+			if a != service.NetworkAllow && a != service.NetworkModerate && a != service.NetworkBlock {
+				return fmt.Errorf("invalid action %q, expected allow, moderate or block", entry)
+			}
+			if siteID == "" {
+				set(&res.Default, a)
+				continue
+			}
+			p := res.Sites[siteID]
+			set(&p, a)
+			res.Sites[siteID] = p
+		}
+		return nil
+	}
+	if err := parse(s.ExitNodes.Tor, func(p *service.ExitNodePolicy, a service.NetworkAction) { p.Tor = a }); err != nil {
+		return service.StaticExitNodePolicyLister{}, fmt.Errorf("tor: %w", err)
+	}
+	if err := parse(s.ExitNodes.VPN, func(p *service.ExitNodePolicy, a service.NetworkAction) { p.VPN = a }); err != nil {
+		return service.StaticExitNodePolicyLister{}, fmt.Errorf("vpn: %w", err)
+	}
+	return res, nil
+}
+
+// siteEntry splits "site:value" entry, site is empty for "value" entry applied to all sites
+func siteEntry(entry string) (siteID, value string) {
+	siteID, value, ok := strings.Cut(entry, ":")
+	if !ok {
+		siteID, value = "", entry
+	}
+	return strings.TrimSpace(siteID), strings.TrimSpace(value)
+}
+
+// makeGeoLocator makes ip locator from country and asn databases, nil if none set
+func (s *ServerCommand) makeGeoLocator() (service.GeoLocator, error) {
+	if s.Geo.CountryDB == "" && s.Geo.ASNDB == "" {
+		return nil, nil
+	}
+	locator, err := geoip.New(s.Geo.CountryDB, s.Geo.ASNDB)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[INFO] geoip enabled, country db %q, asn db %q", s.Geo.CountryDB, s.Geo.ASNDB)
+	return locator, nil
+}
+
+func (s *ServerCommand) makePicturesStore() (*image.Service, error) {
+	imageServiceParams := image.ServiceParams{
+		ImageAPI:     s.RemarkURL + "/api/v1/picture/",
+		ProxyAPI:     s.RemarkURL + "/api/v1/img",
+		EditDuration: s.EditDuration,
+		MaxSize:      s.Image.MaxSize,
+		MaxHeight:    s.Image.ResizeHeight,
+		MaxWidth:     s.Image.ResizeWidth,
+
+		ThumbnailCacheSize: s.Image.ThumbCache,
+	}
+	for _, v := range s.Image.Thumbnails {
+		size, err := image.ParseThumbnailSize(strings.TrimSpace(v))
+		if err != nil {
+			return nil, err
+		}
+		imageServiceParams.ThumbnailSizes = append(imageServiceParams.ThumbnailSizes, size)
+	}
+	if s.Image.Caption.URL != "" {
+		log.Printf("[INFO] captioning of uploaded images enabled, url=%s", s.Image.Caption.URL)
+		imageServiceParams.Captioner = &image.CaptionWebhook{URL: s.Image.Caption.URL, Timeout: s.Image.Caption.Timeout}
+	}
+	switch s.Image.Type {
+	case "bolt":
+		boltImageStore, err := image.NewBoltStorage(s.Image.Bolt.File, bolt.Options{})
+		if err != nil {
+			return nil, err
+		}
+		return image.NewService(boltImageStore, imageServiceParams), nil
+	case "fs":
+		if err := makeDirs(s.Image.FS.Path); err != nil {
+			return nil, fmt.Errorf("failed to create pictures store: %w", err)
+		}
+		return image.NewService(&image.FileSystem{
+			Location:   s.Image.FS.Path,
+			Staging:    s.Image.FS.Staging,
+			Partitions: s.Image.FS.Partitions,
+		}, imageServiceParams), nil
+	case "rpc":
+		return image.NewService(&image.RPC{Client: s.makeRPCClient("image", s.Image.RPC)}, imageServiceParams), nil
+	}
+	return nil, fmt.Errorf("unsupported pictures store type %s", s.Image.Type)
+}
+
+func (s *ServerCommand) makeAdminStore() (admin.Store, error) {
+	log.Printf("[INFO] make admin store, type=%s", s.Admin.Type)
+
+	switch s.Admin.Type {
+	case "shared":
+		sharedAdminEmail := ""
+		if len(s.Admin.Shared.Email) == 0 { // no admin email, use admin@domain
+			if u, err := url.Parse(s.RemarkURL); err == nil {
+				sharedAdminEmail = "admin@" + u.Host
+			}
+		} else {
+			sharedAdminEmail = s.Admin.Shared.Email[0]
+		}
+		return admin.NewStaticStore(s.SharedSecret, s.Sites, s.Admin.Shared.Admins, sharedAdminEmail), nil
+	case "rpc":
+		r := &admin.RPC{Client: s.makeRPCClient("admin", s.Admin.RPC.RPCGroup)}
+		return r, nil
+	default:
+		return nil, fmt.Errorf("unsupported admin store type %s", s.Admin.Type)
+	}
+}
+
+func (s *ServerCommand) makeCache() (LoadingCache, error) {
+	log.Printf("[INFO] make cache, type=%s", s.Cache.Type)
+	o := cache.NewOpts[[]byte]()
+	switch s.Cache.Type {
+	case "redis_pub_sub":
+		redisPubSub, err := eventbus.NewRedisPubSub(s.Cache.RedisAddr, "remark42-cache")
+		if err != nil {
+			return nil, fmt.Errorf("cache backend initialization, redis PubSub initialisation: %w", err)
+		}
+		backend, err := cache.NewLruCache(o.MaxCacheSize(s.Cache.Max.Size), o.MaxValSize(s.Cache.Max.Value),
+			o.MaxKeys(s.Cache.Max.Items), o.EventBus(redisPubSub))
+		if err != nil {
+			return nil, fmt.Errorf("cache backend initialization: %w", err)
+		}
+		return cache.NewScache[[]byte](backend), nil
+	case "mem":
+		backend, err := cache.NewLruCache(o.MaxCacheSize(s.Cache.Max.Size), o.MaxValSize(s.Cache.Max.Value),
+			o.MaxKeys(s.Cache.Max.Items))
+		if err != nil {
+			return nil, fmt.Errorf("cache backend initialization: %w", err)
+		}
+		return cache.NewScache[[]byte](backend), nil
+	case "none":
+		return cache.NewScache[[]byte](&cache.Nop[[]byte]{}), nil
+	}
+	return nil, fmt.Errorf("unsupported cache type %s", s.Cache.Type)
+}
+
+// makeCDNPurger makes purger of CDN set to purge, nil if purge disabled
+func (s *ServerCommand) makeCDNPurger() (cdn.Purger, error) {
+	client := &http.Client{Timeout: s.CDN.Timeout}
+	switch s.CDN.Purge {
+	case "fastly":
+		if s.CDN.Fastly.ServiceID == "" || s.CDN.Fastly.Token == "" {
+			return nil, errors.New("fastly service id and token required")
+		}
+		log.Printf("[INFO] purge fastly service %s on invalidation", s.CDN.Fastly.ServiceID)
+		return &cdn.Fastly{ServiceID: s.CDN.Fastly.ServiceID, Token: s.CDN.Fastly.Token, Client: client}, nil
+	case "cloudflare":
+		if s.CDN.Cloudflare.ZoneID == "" || s.CDN.Cloudflare.Token == "" {
+			return nil, errors.New("cloudflare zone id and token required")
+		}
+		log.Printf("[INFO] purge cloudflare zone %s on invalidation", s.CDN.Cloudflare.ZoneID)
+		return &cdn.Cloudflare{ZoneID: s.CDN.Cloudflare.ZoneID, Token: s.CDN.Cloudflare.Token, Client: client}, nil
+	}
+	return nil, nil
+}
+
+//nolint:gocyclo // simple code but many if checks
+func (s *ServerCommand) addAuthProviders(authenticator *auth.Service, suppressed func(address string) bool) error {
+	providersCount := 0
+	if s.Auth.Telegram {
+		providersCount++
+	}
+	if s.Auth.SAML.IdPMetadata != "" {
+		providersCount++
+	}
+	if s.Auth.LDAP.URL != "" {
+		providersCount++
+	}
+	if len(s.Auth.Mastodon.Instances) > 0 {
+		providersCount++
+	}
+	if s.Auth.Steam.APIKey != "" {
+		providersCount++
+	}
+	if s.Auth.Reddit.CID != "" && s.Auth.Reddit.CSEC != "" {
+		providersCount++
+	}
+	if s.Auth.VK.CID != "" && s.Auth.VK.CSEC != "" {
+		providersCount++
+	}
+	if s.Auth.WeChat.CID != "" && s.Auth.WeChat.CSEC != "" {
+		providersCount++
+	}
+	if s.Auth.WebAuthn.Enable {
+		providersCount++
+	}
+	if s.Auth.SMS.Sender != "" && s.Auth.SMS.Sender != "none" {
+		providersCount++
+	}
+
+	if s.Auth.Apple.CID != "" && s.Auth.Apple.TID != "" && s.Auth.Apple.KID != "" {
+		err := authenticator.AddAppleProvider(
+			provider.AppleConfig{
+				ClientID: s.Auth.Apple.CID,
+				TeamID:   s.Auth.Apple.TID,
+				KeyID:    s.Auth.Apple.KID,
+			},
+			provider.LoadApplePrivateKeyFromFile(s.Auth.Apple.PrivateKeyFilePath),
+		)
+		if err != nil {
+			return err
+		}
+		providersCount++
+	}
+	if s.Auth.Google.CID != "" && s.Auth.Google.CSEC != "" {
+		authenticator.AddProvider("google", s.Auth.Google.CID, s.Auth.Google.CSEC)
+		providersCount++
+	}
+	if s.Auth.Github.CID != "" && s.Auth.Github.CSEC != "" {
 		authenticator.AddProvider("github", s.Auth.Github.CID, s.Auth.Github.CSEC)
 		providersCount++
 	}
+	if s.Auth.Gitlab.CID != "" && s.Auth.Gitlab.CSEC != "" {
+		if err := s.addGitlabProvider(authenticator); err != nil {
+			return fmt.Errorf("failed to add gitlab provider: %w", err)
+		}
+		providersCount++
+	}
 	if s.Auth.Facebook.CID != "" && s.Auth.Facebook.CSEC != "" {
 		authenticator.AddProvider("facebook", s.Auth.Facebook.CID, s.Auth.Facebook.CSEC)
 		providersCount++
@@ -1112,6 +2897,10 @@ func (s *ServerCommand) addAuthProviders(authenticator *auth.Service) error {
 		authenticator.AddProvider("discord", s.Auth.Discord.CID, s.Auth.Discord.CSEC)
 		providersCount++
 	}
+	if s.Auth.Twitch.CID != "" && s.Auth.Twitch.CSEC != "" {
+		s.addTwitchProvider(authenticator)
+		providersCount++
+	}
 
 	if s.Auth.Custom.isConfigured() {
 		missing := s.Auth.Custom.missingRequired()
@@ -1152,6 +2941,13 @@ func (s *ServerCommand) addAuthProviders(authenticator *auth.Service) error {
 		providersCount++
 	}
 
+	if s.Auth.OIDC.Issuer != "" {
+		if err := s.addOIDCProvider(authenticator); err != nil {
+			return fmt.Errorf("failed to add oidc provider: %w", err)
+		}
+		providersCount++
+	}
+
 	if s.Auth.Dev {
 		log.Print("[INFO] dev access enabled")
 		u, errURL := url.Parse(s.RemarkURL)
@@ -1178,7 +2974,26 @@ func (s *ServerCommand) addAuthProviders(authenticator *auth.Service) error {
 			Subject:            s.Auth.Email.Subject,
 			ContentType:        s.Auth.Email.ContentType,
 		}
-		sndr := sender.NewEmailClient(params, log.Default())
+		var sndr provider.Sender = sender.NewEmailClient(params, log.Default())
+		if s.emailAPIEnabled() {
+			emailAPI, err := s.makeEmailAPI()
+			if err != nil {
+				return fmt.Errorf("failed to make email api for verification: %w", err)
+			}
+			sndr = &emailSender{sender: emailAPI, from: s.Auth.Email.From, subject: s.Auth.Email.Subject}
+		}
+		if !s.emailAPIEnabled() && s.SMTP.DKIMKey != "" {
+			dkim, err := s.makeDKIM()
+			if err != nil {
+				return fmt.Errorf("failed to make dkim signer for verification: %w", err)
+			}
+			smtpParams := s.smtpParams()
+			smtpParams.ContentType = s.Auth.Email.ContentType
+			sndr = &emailSender{sender: notify.NewSMTP(smtpParams, dkim), from: s.Auth.Email.From, subject: s.Auth.Email.Subject}
+		}
+		if s.Suppress.Enabled {
+			sndr = &suppressedSender{Sender: sndr, suppressed: suppressed}
+		}
 		tmpl, err := templates.Read(s.Auth.Email.MsgTemplate)
 		if err != nil {
 			return err
@@ -1213,18 +3028,63 @@ func (s *ServerCommand) addAuthProviders(authenticator *auth.Service) error {
 			}
 			return true, nil
 		}),
-			// custom user ID generator, used to distinguish anonymous users with the same login
-			// coming from different IPs
-			func(user string, r *http.Request) string {
-				return user + r.RemoteAddr
-			})
+			s.anonUserID)
+	}
+
+	if providersCount == 0 {
+		log.Printf("[WARN] no auth providers defined")
+	}
+
+	return nil
+}
+
+// makePoW makes proof-of-work challenge issuer, nil if disabled
+func (s *ServerCommand) makePoW() *rest.PoW {
+	if !s.PoW.Enabled {
+		return nil
+	}
+	log.Printf("[INFO] proof-of-work enabled, difficulty=%d", s.PoW.Difficulty)
+	return rest.NewPoW(s.SharedSecret, s.PoW.Difficulty, s.PoW.TTL)
+}
+
+// makeCaptcha makes captcha verifier of the provider, nil if disabled
+func (s *ServerCommand) makeCaptcha() (*rest.Captcha, error) {
+	if s.Captcha.Type == "" {
+		return nil, nil
 	}
+	if !s.Captcha.AnonLogin && !s.Captcha.NewUser {
+		log.Printf("[WARN] captcha %s set, but neither anonymous login nor new users require it", s.Captcha.Type)
+	}
+	log.Printf("[INFO] captcha enabled, type=%s, anon-login=%v, new-user=%v", s.Captcha.Type, s.Captcha.AnonLogin, s.Captcha.NewUser)
+	return rest.NewCaptcha(s.Captcha.Type, s.Captcha.Secret, s.Captcha.SiteKey)
+}
 
-	if providersCount == 0 {
-		log.Printf("[WARN] no auth providers defined")
+// makeJWKS makes signer of tokens for other services with asymmetric keys, nil if no keys set
+func (s *ServerCommand) makeJWKS() (*rest.JWKS, error) {
+	if len(s.Auth.JWTKeys) == 0 {
+		return nil, nil
 	}
+	log.Printf("[INFO] asymmetric tokens enabled, %d key(s), jwks published at %s/.well-known/jwks.json", len(s.Auth.JWTKeys), s.RemarkURL)
+	return rest.NewJWKS(s.Auth.TTL.JWT, s.Auth.JWTKeys...)
+}
 
-	return nil
+// makeTokenRotation makes rotation of the shared secret accepting tokens signed with the previous secret
+// for the grace window since the server start
+func (s *ServerCommand) makeTokenRotation(authenticator *auth.Service) *rest.TokenRotation {
+	until := time.Now().Add(s.Auth.PreviousSecretTTL)
+	if s.Auth.PreviousSecret != "" {
+		log.Printf("[INFO] secret rotation enabled, tokens of the previous secret accepted until %s", until.Format(time.RFC3339))
+	}
+	return rest.NewTokenRotation(authenticator.TokenService(), s.Auth.PreviousSecret, until)
+}
+
+// anonUserID is a custom user ID generator for anonymous login. Users with device identity issued by the server
+// keep the same ID regardless of the name and IP, others distinguished by login and IP.
+func (s *ServerCommand) anonUserID(user string, r *http.Request) string {
+	if id, ok := rest.DeviceID(r.URL.Query().Get(rest.DeviceParam), s.SharedSecret); ok {
+		return "device:" + id
+	}
+	return user + r.RemoteAddr
 }
 
 // creates and registers telegram auth, which we need separately from other auth providers
@@ -1244,7 +3104,314 @@ func (s *ServerCommand) makeTelegramAuth(authenticator *auth.Service) providers.
 	return nil
 }
 
-func (s *ServerCommand) makeNotifyService(dataStore *service.DataStore, destinations []notify.Destination, telegram *notify.Telegram) *notify.Service {
+// makeSAMLAuth creates and registers SAML service provider, nil if disabled.
+// Provider is returned separately as its metadata is served by rest server.
+func (s *ServerCommand) makeSAMLAuth(authenticator *auth.Service) (*providers.SAML, error) {
+	if s.Auth.SAML.IdPMetadata == "" {
+		return nil, nil
+	}
+	md, err := s.loadSAMLMetadata()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load identity provider's metadata: %w", err)
+	}
+	res, err := providers.NewSAML(providers.SAMLParams{
+		URL:          s.RemarkURL,
+		EntityID:     s.Auth.SAML.EntityID,
+		Issuer:       "remark42",
+		IdPMetadata:  md,
+		IDAttr:       s.Auth.SAML.IDAttr,
+		NameAttr:     s.Auth.SAML.NameAttr,
+		EmailAttr:    s.Auth.SAML.EmailAttr,
+		PictureAttr:  s.Auth.SAML.PictureAttr,
+		TokenService: authenticator.TokenService(),
+		AvatarSaver:  authenticator.AvatarProxy(),
+		AllowedRedirectHosts: token.AllowedHostsFunc(func() ([]string, error) {
+			return s.getAllowedRedirectHosts(), nil
+		}),
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[INFO] %s, entity id %s", res, res.EntityID)
+	authenticator.AddCustomHandler(res)
+	return res, nil
+}
+
+// addMastodonAuth creates and registers Mastodon provider if any instance is allowed
+func (s *ServerCommand) addMastodonAuth(authenticator *auth.Service) error {
+	if len(s.Auth.Mastodon.Instances) == 0 {
+		return nil
+	}
+	res, err := providers.NewMastodon(providers.MastodonParams{
+		URL:          s.RemarkURL,
+		Issuer:       "remark42",
+		AppName:      s.Auth.Mastodon.AppName,
+		Instances:    s.Auth.Mastodon.Instances,
+		Client:       &http.Client{Timeout: s.Auth.Mastodon.Timeout, Transport: safehttp.Transport()},
+		TokenService: authenticator.TokenService(),
+		AvatarSaver:  authenticator.AvatarProxy(),
+		AllowedRedirectHosts: token.AllowedHostsFunc(func() ([]string, error) {
+			return s.getAllowedRedirectHosts(), nil
+		}),
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("[INFO] %s", res)
+	authenticator.AddCustomHandler(res)
+	return nil
+}
+
+// addSteamAuth creates and registers Steam provider if Steam Web API key is set
+func (s *ServerCommand) addSteamAuth(authenticator *auth.Service) error {
+	if s.Auth.Steam.APIKey == "" {
+		return nil
+	}
+	res, err := providers.NewSteam(providers.SteamParams{
+		URL:          s.RemarkURL,
+		Issuer:       "remark42",
+		APIKey:       s.Auth.Steam.APIKey,
+		Client:       &http.Client{Timeout: s.Auth.Steam.Timeout},
+		TokenService: authenticator.TokenService(),
+		AvatarSaver:  authenticator.AvatarProxy(),
+		AllowedRedirectHosts: token.AllowedHostsFunc(func() ([]string, error) {
+			return s.getAllowedRedirectHosts(), nil
+		}),
+	})
+	if err != nil {
+		return err
+	}
+	log.Print("[INFO] steam provider added")
+	authenticator.AddCustomHandler(res)
+	return nil
+}
+
+// addSMSAuth creates and registers SMS provider if sms sender is set
+func (s *ServerCommand) addSMSAuth(authenticator *auth.Service) error {
+	client := &http.Client{Timeout: s.Auth.SMS.Timeout}
+	var sndr providers.SMSSender
+	switch s.Auth.SMS.Sender {
+	case "", "none":
+		return nil
+	case "twilio":
+		if s.Auth.SMS.Twilio.AccountSID == "" || s.Auth.SMS.Twilio.AuthToken == "" || s.Auth.SMS.From == "" {
+			return errors.New("twilio account sid, auth token and sender number are required")
+		}
+		sndr = &providers.TwilioSMS{AccountSID: s.Auth.SMS.Twilio.AccountSID, AuthToken: s.Auth.SMS.Twilio.AuthToken,
+			From: s.Auth.SMS.From, Client: client}
+	case "vonage":
+		if s.Auth.SMS.Vonage.APIKey == "" || s.Auth.SMS.Vonage.APISecret == "" || s.Auth.SMS.From == "" {
+			return errors.New("vonage api key, api secret and sender id are required")
+		}
+		sndr = &providers.VonageSMS{APIKey: s.Auth.SMS.Vonage.APIKey, APISecret: s.Auth.SMS.Vonage.APISecret,
+			From: s.Auth.SMS.From, Client: client}
+	case "webhook":
+		if s.Auth.SMS.Webhook.URL == "" {
+			return errors.New("sms webhook url is required")
+		}
+		sndr = &providers.WebhookSMS{URL: s.Auth.SMS.Webhook.URL, Headers: s.Auth.SMS.Webhook.Headers, Client: client}
+	default:
+		return fmt.Errorf("unknown sms sender %q", s.Auth.SMS.Sender)
+	}
+	res, err := providers.NewSMS(providers.SMSParams{
+		URL:          s.RemarkURL,
+		Issuer:       "remark42",
+		Sender:       sndr,
+		Template:     s.Auth.SMS.Template,
+		RateLimit:    s.Auth.SMS.RateLimit,
+		TokenService: authenticator.TokenService(),
+		AvatarSaver:  authenticator.AvatarProxy(),
+		AllowedRedirectHosts: token.AllowedHostsFunc(func() ([]string, error) {
+			return s.getAllowedRedirectHosts(), nil
+		}),
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("[INFO] sms provider added with %s sender", s.Auth.SMS.Sender)
+	authenticator.AddCustomHandler(res)
+	return nil
+}
+
+// addRedditAuth creates and registers Reddit provider if client id and secret are set
+func (s *ServerCommand) addRedditAuth(authenticator *auth.Service) error {
+	if s.Auth.Reddit.CID == "" || s.Auth.Reddit.CSEC == "" {
+		return nil
+	}
+	userAgent := s.Auth.Reddit.UserAgent
+	if userAgent == "" {
+		userAgent = "web:remark42:" + s.Revision
+	}
+	res, err := providers.NewReddit(providers.RedditParams{
+		URL:          s.RemarkURL,
+		Issuer:       "remark42",
+		Cid:          s.Auth.Reddit.CID,
+		Csecret:      s.Auth.Reddit.CSEC,
+		UserAgent:    userAgent,
+		Duration:     s.Auth.Reddit.Duration,
+		Client:       &http.Client{Timeout: s.Auth.Reddit.Timeout},
+		TokenService: authenticator.TokenService(),
+		AvatarSaver:  authenticator.AvatarProxy(),
+		AllowedRedirectHosts: token.AllowedHostsFunc(func() ([]string, error) {
+			return s.getAllowedRedirectHosts(), nil
+		}),
+	})
+	if err != nil {
+		return err
+	}
+	log.Print("[INFO] reddit provider added")
+	authenticator.AddCustomHandler(res)
+	return nil
+}
+
+// addVKAuth creates and registers VK provider if app id and secure key are set
+func (s *ServerCommand) addVKAuth(authenticator *auth.Service) error {
+	if s.Auth.VK.CID == "" || s.Auth.VK.CSEC == "" {
+		return nil
+	}
+	res, err := providers.NewVK(providers.VKParams{
+		URL:          s.RemarkURL,
+		Issuer:       "remark42",
+		Cid:          s.Auth.VK.CID,
+		Csecret:      s.Auth.VK.CSEC,
+		TokenService: authenticator.TokenService(),
+		AvatarSaver:  authenticator.AvatarProxy(),
+		AllowedRedirectHosts: token.AllowedHostsFunc(func() ([]string, error) {
+			return s.getAllowedRedirectHosts(), nil
+		}),
+	})
+	if err != nil {
+		return err
+	}
+	log.Print("[INFO] vk provider added")
+	authenticator.AddCustomHandler(res)
+	return nil
+}
+
+// addWeChatAuth creates and registers WeChat provider if appid and secret are set
+func (s *ServerCommand) addWeChatAuth(authenticator *auth.Service) error {
+	if s.Auth.WeChat.CID == "" || s.Auth.WeChat.CSEC == "" {
+		return nil
+	}
+	res, err := providers.NewWeChat(providers.WeChatParams{
+		URL:          s.RemarkURL,
+		Issuer:       "remark42",
+		AppID:        s.Auth.WeChat.CID,
+		Secret:       s.Auth.WeChat.CSEC,
+		TokenService: authenticator.TokenService(),
+		AvatarSaver:  authenticator.AvatarProxy(),
+		AllowedRedirectHosts: token.AllowedHostsFunc(func() ([]string, error) {
+			return s.getAllowedRedirectHosts(), nil
+		}),
+	})
+	if err != nil {
+		return err
+	}
+	log.Print("[INFO] wechat provider added")
+	authenticator.AddCustomHandler(res)
+	return nil
+}
+
+// makeWebAuthnAuth creates and registers WebAuthn provider, nil if disabled. Passkey registration
+// handler of the provider is served by rest server.
+func (s *ServerCommand) makeWebAuthnAuth(authenticator *auth.Service, dataService *service.DataStore) (*providers.WebAuthn, error) {
+	if !s.Auth.WebAuthn.Enable {
+		return nil, nil
+	}
+	res, err := providers.NewWebAuthn(providers.WebAuthnParams{
+		URL:          s.RemarkURL,
+		Issuer:       "remark42",
+		RPID:         s.Auth.WebAuthn.RPID,
+		RPName:       s.Auth.WebAuthn.RPName,
+		Origins:      s.Auth.WebAuthn.Origins,
+		Store:        dataService,
+		TokenService: authenticator.TokenService(),
+		AvatarSaver:  authenticator.AvatarProxy(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[INFO] %s", res)
+	authenticator.AddCustomHandler(res)
+	return res, nil
+}
+
+// makeLDAPAuth creates LDAP credential checker, nil if disabled. It is made before authenticator
+// as admin groups membership is checked on claims update.
+func (s *ServerCommand) makeLDAPAuth() (*providers.LDAP, error) {
+	if s.Auth.LDAP.URL == "" {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: s.Auth.LDAP.InsecureSkipVerify, MinVersion: tls.VersionTLS12} //nolint:gosec // set by user
+	if s.Auth.LDAP.CACert != "" {
+		pem, err := os.ReadFile(s.Auth.LDAP.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ca certificates: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no ca certificates in %s", s.Auth.LDAP.CACert)
+		}
+	}
+	if len(s.Auth.LDAP.AdminGroups) > 0 {
+		// admin groups grant the role on the listed sites only, the single configured site is assumed if not set
+		if len(s.Auth.LDAP.AdminSites) == 0 && len(s.Sites) != 1 {
+			return nil, errors.New("ldap admin sites should be set with multiple sites")
+		}
+		if len(s.Auth.LDAP.AdminSites) == 0 {
+			s.Auth.LDAP.AdminSites = s.Sites
+		}
+		for _, site := range s.Auth.LDAP.AdminSites {
+			if !slices.Contains(s.Sites, site) {
+				return nil, fmt.Errorf("unknown ldap admin site %q", site)
+			}
+		}
+	}
+	res, err := providers.NewLDAP(providers.LDAPParams{
+		URL:          s.Auth.LDAP.URL,
+		StartTLS:     s.Auth.LDAP.StartTLS,
+		TLSConfig:    tlsConfig,
+		Timeout:      s.Auth.LDAP.Timeout,
+		BindDN:       s.Auth.LDAP.BindDN,
+		BindPassword: s.Auth.LDAP.BindPasswd,
+		BaseDN:       s.Auth.LDAP.BaseDN,
+		UserFilter:   s.Auth.LDAP.UserFilter,
+		GroupAttr:    s.Auth.LDAP.GroupAttr,
+		AdminGroups:  s.Auth.LDAP.AdminGroups,
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[INFO] ldap auth enabled, url=%s, starttls=%v, admin groups=%d, admin sites=%v", s.Auth.LDAP.URL, s.Auth.LDAP.StartTLS,
+		len(s.Auth.LDAP.AdminGroups), s.Auth.LDAP.AdminSites)
+	return res, nil
+}
+
+// loadSAMLMetadata reads identity provider's metadata from the URL or file
+func (s *ServerCommand) loadSAMLMetadata() ([]byte, error) {
+	src := s.Auth.SAML.IdPMetadata
+	if !strings.HasPrefix(src, "http://") && !strings.HasPrefix(src, "https://") {
+		return os.ReadFile(src) //nolint:gosec // file set by user
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.Auth.SAML.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := (&http.Client{Timeout: s.Auth.SAML.Timeout}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s responded with status %d", src, resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 10*1024*1024))
+}
+
+func (s *ServerCommand) makeNotifyService(dataStore *service.DataStore, destinations []notify.Destination, telegram *notify.Telegram,
+	collapse notify.CollapseWindows) *notify.Service {
 	if destinations == nil {
 		destinations = []notify.Destination{}
 	}
@@ -1255,13 +3422,87 @@ func (s *ServerCommand) makeNotifyService(dataStore *service.DataStore, destinat
 
 	if len(destinations) > 0 {
 		log.Printf("[INFO] make notify, for users: %s, for admins: %s", s.Notify.Users, s.Notify.Admins)
-		return notify.NewService(dataStore, s.Notify.QueueSize, destinations...)
+		res := notify.NewService(dataStore, s.Notify.QueueSize, destinations...)
+		res.Collapse = collapse
+		if dataStore.Quotas != nil {
+			res.Quota = dataStore
+		}
+		return res
 	}
 	return notify.NopService
 }
 
+// notifyCollapse makes collapse windows of sites from "window" (default for all sites) and "site:window" entries
+func (s *ServerCommand) notifyCollapse() (notify.CollapseWindows, error) {
+	res := notify.CollapseWindows{Sites: map[string]time.Duration{}}
+	for _, w := range s.Notify.Collapse {
+		siteID, window, ok := strings.Cut(w, ":")
+		if !ok {
+			siteID, window = "", w
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(window))
+		if err != nil || d < 0 {
+			return notify.CollapseWindows{}, fmt.Errorf("invalid collapse window %q", w)
+		}
+		if siteID = strings.TrimSpace(siteID); siteID == "" {
+			res.Default = d
+			continue
+		}
+		res.Sites[siteID] = d
+	}
+	return res, nil
+}
+
+// emailIdentities makes from and reply-to addresses of emails from "site:address" entries
+// and "address" (default for all sites) reply-to entry, sites and addresses are validated
+func (s *ServerCommand) emailIdentities() (notify.EmailIdentities, error) {
+	res := notify.EmailIdentities{Sites: map[string]notify.EmailIdentity{}}
+	parse := func(entry string, siteRequired bool) (siteID, address string, err error) {
+		siteID, address, ok := strings.Cut(entry, ":")
+		if !ok {
+			siteID, address = "", entry
+		}
+		siteID, address = strings.TrimSpace(siteID), strings.TrimSpace(address)
+		if siteID == "" && siteRequired {
+			return "", "", fmt.Errorf("no site in %q, expected site:address", entry)
+		}
+		if siteID != "" && !contains(siteID, s.Sites) {
+			return "", "", fmt.Errorf("unknown site %q in %q", siteID, entry)
+		}
+		if _, err = mail.ParseAddress(address); err != nil {
+			return "", "", fmt.Errorf("invalid email address in %q: %w", entry, err)
+		}
+		return siteID, address, nil
+	}
+
+	for _, entry := range s.Notify.Email.SiteFrom {
+		siteID, address, err := parse(entry, true)
+		if err != nil {
+			return notify.EmailIdentities{}, err
+		}
+		identity := res.Sites[siteID]
+		identity.From = address
+		res.Sites[siteID] = identity
+	}
+	for _, entry := range s.Notify.Email.ReplyTo {
+		siteID, address, err := parse(entry, false)
+		if err != nil {
+			return notify.EmailIdentities{}, err
+		}
+		if siteID == "" {
+			res.ReplyTo = address
+			continue
+		}
+		identity := res.Sites[siteID]
+		identity.ReplyTo = address
+		res.Sites[siteID] = identity
+	}
+	return res, nil
+}
+
 // constructs list of notify destinations except for telegram, returns empty list in case of error
-func (s *ServerCommand) makeNotifyDestinations(authenticator *auth.Service) ([]notify.Destination, error) {
+func (s *ServerCommand) makeNotifyDestinations(authenticator *auth.Service, siteLocation func(string) *time.Location,
+	emailToken func(string) string, suppressed func(string) bool, identities notify.EmailIdentities) ([]notify.Destination, error) {
 	destinations := make([]notify.Destination, 0)
 
 	if contains("webhook", s.Notify.Admins) {
@@ -1297,11 +3538,15 @@ func (s *ServerCommand) makeNotifyDestinations(authenticator *auth.Service) ([]n
 			VerificationTemplatePath: s.emailVerificationTemplatePath, From: s.Notify.Email.From,
 			VerificationSubject: s.Notify.Email.VerificationSubject,
 			UnsubscribeURL:      s.RemarkURL + "/email/unsubscribe.html",
+			ManageURL:           s.RemarkURL + "/web/unsubscribe",
+			Suppressed:          suppressed,
+			Location:            siteLocation,
+			Identities:          identities,
 			// TODO: uncomment after #560 frontend part is ready and URL is known
 			// subscribeURL:        s.RemarkURL + "/subscribe.html?token=",
 			TokenGenFn: func(userID, email, site string) (string, error) {
 				claims := token.Claims{
-					Handshake: &token.Handshake{ID: userID + "::" + email},
+					Handshake: &token.Handshake{ID: userID + "::" + emailToken(email)},
 					RegisteredClaims: jwt.RegisteredClaims{
 						Audience:  jwt.ClaimStrings{site},
 						ExpiresAt: jwt.NewNumericDate(time.Now().Add(100 * 365 * 24 * time.Hour)),
@@ -1319,20 +3564,26 @@ func (s *ServerCommand) makeNotifyDestinations(authenticator *auth.Service) ([]n
 		if contains("email", s.Notify.Admins) {
 			emailParams.AdminEmails = s.Admin.Shared.Email
 		}
-		smtpParams := ntf.SMTPParams{
-			Host:               s.SMTP.Host,
-			Port:               s.SMTP.Port,
-			TLS:                s.SMTP.TLS,
-			StartTLS:           s.SMTP.StartTLS,
-			InsecureSkipVerify: s.SMTP.InsecureSkipVerify,
-			LoginAuth:          s.SMTP.LoginAuth,
-			Username:           s.SMTP.Username,
-			Password:           s.SMTP.Password,
-			TimeOut:            s.SMTP.TimeOut,
-			ContentType:        "text/html",
-			Charset:            "UTF-8",
+		smtpParams := s.smtpParams()
+		smtpParams.ContentType = "text/html"
+		if s.SMTP.DKIMKey != "" {
+			dkim, err := s.makeDKIM()
+			if err != nil {
+				return destinations, fmt.Errorf("failed to make dkim signer: %w", err)
+			}
+			emailParams.DKIM = dkim
+		}
+		var emailService *notify.Email
+		var err error
+		if s.emailAPIEnabled() {
+			emailAPI, errAPI := s.makeEmailAPI()
+			if errAPI != nil {
+				return destinations, fmt.Errorf("failed to make email api: %w", errAPI)
+			}
+			emailService, err = notify.NewAPIEmail(emailParams, emailAPI)
+		} else {
+			emailService, err = notify.NewEmail(emailParams, smtpParams)
 		}
-		emailService, err := notify.NewEmail(emailParams, smtpParams)
 		if err != nil {
 			return destinations, fmt.Errorf("failed to create email notification destination: %w", err)
 		}
@@ -1342,6 +3593,253 @@ func (s *ServerCommand) makeNotifyDestinations(authenticator *auth.Service) ([]n
 	return destinations, nil
 }
 
+// emailAPIEnabled checks if emails are sent with the provider's API instead of SMTP
+func (s *ServerCommand) emailAPIEnabled() bool {
+	return s.EmailAPI.Provider != "" && s.EmailAPI.Provider != "none"
+}
+
+// makeEmailAPI makes client of the email provider's API
+func (s *ServerCommand) makeEmailAPI() (*notify.EmailAPI, error) {
+	return notify.NewEmailAPI(notify.EmailAPIParams{
+		Provider: s.EmailAPI.Provider,
+		Key:      s.EmailAPI.Key,
+		Secret:   s.EmailAPI.Secret,
+		Region:   s.EmailAPI.Region,
+		Domain:   s.EmailAPI.Domain,
+		Endpoint: s.EmailAPI.Endpoint,
+		Timeout:  s.EmailAPI.Timeout,
+	})
+}
+
+// addOIDCProvider adds OpenID Connect provider with endpoints discovered from the issuer
+func (s *ServerCommand) addOIDCProvider(authenticator *auth.Service) error {
+	name := strings.ToLower(strings.TrimSpace(s.Auth.OIDC.Name))
+	if !isValidCustomProviderName(name) {
+		return fmt.Errorf("provider name %q is invalid, expected pattern %q", name, validCustomProviderName.String())
+	}
+	if isReservedCustomProviderName(name) || (s.Auth.Custom.isConfigured() && strings.EqualFold(s.Auth.Custom.Name, name)) {
+		return fmt.Errorf("provider name %q is already used", name)
+	}
+	if s.Auth.OIDC.CID == "" || s.Auth.OIDC.CSEC == "" {
+		return errors.New("client id and secret are required")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.Auth.OIDC.Timeout)
+	defer cancel()
+	endpoints, err := discoverOIDC(ctx, &http.Client{Timeout: s.Auth.OIDC.Timeout}, s.Auth.OIDC.Issuer)
+	if err != nil {
+		return fmt.Errorf("failed to discover %s: %w", s.Auth.OIDC.Issuer, err)
+	}
+	log.Printf("[INFO] oidc provider %s with issuer %s", name, endpoints.Issuer)
+
+	authenticator.AddCustomProvider(name, auth.Client{Cid: s.Auth.OIDC.CID, Csecret: s.Auth.OIDC.CSEC}, provider.CustomHandlerOpt{
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  endpoints.AuthorizationEndpoint,
+			TokenURL: endpoints.TokenEndpoint,
+		},
+		InfoURL: endpoints.UserinfoEndpoint,
+		Scopes:  s.Auth.OIDC.Scopes,
+		MapUserFn: func(data provider.UserData, _ []byte) token.User {
+			return oidcUser(name, data)
+		},
+	})
+	return nil
+}
+
+// addGitlabProvider adds GitLab provider, gitlab.com or self-hosted instance set by URL
+func (s *ServerCommand) addGitlabProvider(authenticator *auth.Service) error {
+	u, err := url.Parse(strings.TrimSuffix(strings.TrimSpace(s.Auth.Gitlab.URL), "/"))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid gitlab url %q", s.Auth.Gitlab.URL)
+	}
+	log.Printf("[INFO] gitlab provider with instance %s", u.String())
+
+	authenticator.AddCustomProvider("gitlab", auth.Client{Cid: s.Auth.Gitlab.CID, Csecret: s.Auth.Gitlab.CSEC}, provider.CustomHandlerOpt{
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  u.String() + "/oauth/authorize",
+			TokenURL: u.String() + "/oauth/token",
+		},
+		InfoURL: u.String() + "/api/v4/user",
+		Scopes:  []string{"read_user"},
+		MapUserFn: func(data provider.UserData, _ []byte) token.User {
+			return gitlabUser(u.Host, data)
+		},
+	})
+	return nil
+}
+
+// gitlabUser maps GitLab user to the user. Ids of users are unique within the instance only,
+// so ids of self-hosted instances are prefixed by the host to not clash with gitlab.com ones.
+func gitlabUser(host string, data provider.UserData) token.User {
+	sourceID := data.Value("id")
+	if !strings.EqualFold(host, "gitlab.com") {
+		sourceID = strings.ToLower(host) + ":" + sourceID
+	}
+	hashID := token.HashID(sha1.New(), sourceID) //nolint:gosec // stable provider user id hash
+	user := token.User{
+		ID:      "gitlab_" + hashID,
+		Name:    data.Value("name"),
+		Picture: data.Value("avatar_url"),
+		Email:   data.Value("email"),
+	}
+	if user.Name == "" {
+		user.Name = data.Value("username")
+	}
+	if user.Name == "" {
+		user.Name = "noname_" + hashID[:4]
+	}
+	return user
+}
+
+// addTwitchProvider adds Twitch provider. User is loaded from OpenID Connect userinfo endpoint, as Helix API
+// requires Client-Id header; the claims of userinfo are requested on authorization, openid scope is the only needed.
+func (s *ServerCommand) addTwitchProvider(authenticator *auth.Service) {
+	claims := url.Values{"claims": {`{"userinfo":{"preferred_username":null,"picture":null}}`}}
+	authenticator.AddCustomProvider("twitch", auth.Client{Cid: s.Auth.Twitch.CID, Csecret: s.Auth.Twitch.CSEC}, provider.CustomHandlerOpt{
+		Endpoint: oauth2.Endpoint{
+			AuthURL:   "https://id.twitch.tv/oauth2/authorize?" + claims.Encode(),
+			TokenURL:  "https://id.twitch.tv/oauth2/token",
+			AuthStyle: oauth2.AuthStyleInParams,
+		},
+		InfoURL:   "https://id.twitch.tv/oauth2/userinfo",
+		Scopes:    []string{"openid"},
+		MapUserFn: func(data provider.UserData, _ []byte) token.User { return twitchUser(data) },
+	})
+}
+
+// twitchUser maps claims of Twitch userinfo to the user
+func twitchUser(data provider.UserData) token.User {
+	hashID := token.HashID(sha1.New(), data.Value("sub")) //nolint:gosec // stable provider user id hash
+	user := token.User{
+		ID:      "twitch_" + hashID,
+		Name:    data.Value("preferred_username"),
+		Picture: data.Value("picture"),
+	}
+	if user.Name == "" {
+		user.Name = "noname_" + hashID[:4]
+	}
+	return user
+}
+
+// smtpParams makes parameters of SMTP server connection
+func (s *ServerCommand) smtpParams() ntf.SMTPParams {
+	return ntf.SMTPParams{
+		Host:               s.SMTP.Host,
+		Port:               s.SMTP.Port,
+		TLS:                s.SMTP.TLS,
+		StartTLS:           s.SMTP.StartTLS,
+		InsecureSkipVerify: s.SMTP.InsecureSkipVerify,
+		LoginAuth:          s.SMTP.LoginAuth,
+		Username:           s.SMTP.Username,
+		Password:           s.SMTP.Password,
+		TimeOut:            s.SMTP.TimeOut,
+		Charset:            "UTF-8",
+	}
+}
+
+// makeDKIM makes DKIM signer of messages sent with SMTP
+func (s *ServerCommand) makeDKIM() (*notify.DKIM, error) {
+	key, err := os.ReadFile(s.SMTP.DKIMKey)
+	if err != nil {
+		return nil, fmt.Errorf("can't read dkim key: %w", err)
+	}
+	return notify.NewDKIM(s.SMTP.DKIMDomain, s.SMTP.DKIMSelector, key)
+}
+
+// emailSender sends verification emails of auth with the provider's API or signed with DKIM
+type emailSender struct {
+	sender        notify.EmailSender
+	from, subject string
+}
+
+// Send sends the verification email to the address
+func (e *emailSender) Send(address, text string) error {
+	destination := fmt.Sprintf("mailto:%s?from=%s&subject=%s", url.PathEscape(address),
+		url.QueryEscape(e.from), url.QueryEscape(e.subject))
+	return e.sender.Send(context.Background(), destination, text)
+}
+
+// suppressedSender rejects verification emails of auth to suppressed addresses
+type suppressedSender struct {
+	provider.Sender
+	suppressed func(address string) bool
+}
+
+// Send sends the verification email unless the address is suppressed
+func (s *suppressedSender) Send(address, text string) error {
+	if s.suppressed(address) {
+		return errors.New("email address is suppressed after bounces or complaints")
+	}
+	return s.Sender.Send(address, text)
+}
+
+// makeListener makes listener of the rest server on unix socket or on socket passed by systemd,
+// nil if rest server listens on address and port
+func (s *ServerCommand) makeListener() (net.Listener, error) {
+	if s.UnixSocket == "" && !s.SocketActivation {
+		return nil, nil
+	}
+	if s.UnixSocket != "" && s.SocketActivation {
+		return nil, errors.New("unix socket can't be used with socket activation")
+	}
+	if s.SSL.Type != "none" {
+		return nil, errors.New("unix socket and socket activation require ssl type none")
+	}
+	if s.SocketActivation {
+		return systemdListener()
+	}
+
+	mode, err := strconv.ParseUint(s.UnixSocketMode, 8, 32)
+	if err != nil || mode > 0o777 {
+		return nil, fmt.Errorf("invalid unix socket mode %q", s.UnixSocketMode)
+	}
+	// socket file left by previous run prevents listening, removed if it is a socket
+	if fi, e := os.Lstat(s.UnixSocket); e == nil && fi.Mode()&os.ModeSocket != 0 {
+		if e = os.Remove(s.UnixSocket); e != nil {
+			return nil, fmt.Errorf("can't remove stale unix socket %s: %w", s.UnixSocket, e)
+		}
+	}
+	listener, err := net.Listen("unix", s.UnixSocket)
+	if err != nil {
+		return nil, fmt.Errorf("can't listen on unix socket: %w", err)
+	}
+	if err = os.Chmod(s.UnixSocket, os.FileMode(mode)); err != nil {
+		_ = listener.Close()
+		return nil, fmt.Errorf("can't set mode of unix socket: %w", err)
+	}
+	log.Printf("[INFO] listen on unix socket %s", s.UnixSocket)
+	return listener, nil
+}
+
+// systemdListener makes listener from the first socket passed by systemd, see sd_listen_fds(3)
+func systemdListener() (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, errors.New("no sockets passed by systemd")
+	}
+	fds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || fds < 1 {
+		return nil, errors.New("no sockets passed by systemd")
+	}
+	if fds > 1 {
+		log.Printf("[WARN] %d sockets passed by systemd, only the first one is used", fds)
+	}
+	// not inherited by child processes
+	_ = os.Unsetenv("LISTEN_PID")
+	_ = os.Unsetenv("LISTEN_FDS")
+	_ = os.Unsetenv("LISTEN_FDNAMES")
+
+	const listenFdsStart = 3
+	f := os.NewFile(listenFdsStart, "systemd-socket")
+	defer f.Close() //nolint:errcheck // listener uses duplicate of the descriptor
+	listener, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("can't listen on socket passed by systemd: %w", err)
+	}
+	log.Printf("[INFO] listen on socket %s passed by systemd", listener.Addr())
+	return listener, nil
+}
+
 // constructs Telegram notify service
 func (s *ServerCommand) makeTelegramNotify() (*notify.Telegram, error) {
 	if contains("telegram", s.Notify.Admins) && s.Notify.Telegram.Channel == "" {
@@ -1388,11 +3886,52 @@ func (s *ServerCommand) makeSSLConfig() (config api.SSLConfig, err error) {
 			config.ACMEEmail = "admin@" + u.Hostname()
 		}
 	}
+
+	if s.SSL.HTTP3 {
+		if config.SSLMode == api.None {
+			return config, errors.New("http3 requires ssl type static or auto")
+		}
+		config.HTTP3 = true
+	}
+
+	if s.SSL.ClientCA != "" {
+		if config.SSLMode == api.None {
+			return config, errors.New("client certificates require ssl type static or auto")
+		}
+		pem, e := os.ReadFile(s.SSL.ClientCA)
+		if e != nil {
+			return config, fmt.Errorf("failed to read client ca certificates: %w", e)
+		}
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(pem) {
+			return config, fmt.Errorf("no client ca certificates in %s", s.SSL.ClientCA)
+		}
+	}
 	return config, err
 }
 
+// makeAdminCertPolicy makes client certificate policy of admin API, certificates are verified with ssl.client-ca
+func (s *ServerCommand) makeAdminCertPolicy() (api.AdminCertPolicy, error) {
+	res := api.AdminCertPolicy{Required: s.SSL.AdminCertRequire, Users: map[string]string{}}
+	for _, u := range s.SSL.AdminCertUsers {
+		cn, userID, ok := strings.Cut(strings.TrimSpace(u), ":")
+		if !ok || strings.TrimSpace(cn) == "" || strings.TrimSpace(userID) == "" {
+			return api.AdminCertPolicy{}, fmt.Errorf("bad admin certificate user %q, expected cn:user_id", u)
+		}
+		res.Users[strings.TrimSpace(cn)] = strings.TrimSpace(userID)
+	}
+	if (res.Required || len(res.Users) > 0) && s.SSL.ClientCA == "" {
+		return api.AdminCertPolicy{}, errors.New("admin client certificates require ssl.client-ca")
+	}
+	if res.Required || len(res.Users) > 0 {
+		log.Printf("[INFO] admin client certificates: required=%v, mapped users=%d", res.Required, len(res.Users))
+	}
+	return res, nil
+}
+
 // getAuthenticator creates new authenticator service, which doesn't have any auth providers enabled
-func (s *ServerCommand) getAuthenticator(ds *service.DataStore, avas avatar.Store, admns admin.Store, authRefreshCache *authRefreshCache) *auth.Service {
+func (s *ServerCommand) getAuthenticator(ds *service.DataStore, avas avatar.Store, admns admin.Store, authRefreshCache *authRefreshCache,
+	ldapAuth *providers.LDAP) *auth.Service {
 	return auth.NewService(auth.Opts{
 		URL:            strings.TrimSuffix(s.RemarkURL, "/"),
 		Issuer:         "remark42",
@@ -1420,7 +3959,18 @@ func (s *ServerCommand) getAuthenticator(ds *service.DataStore, avas avatar.Stor
 			}
 			audience := c.Audience[0]
 
-			c.User.SetAdmin(ds.IsAdmin(audience, c.User.ID))
+			// logins with linked ids made as the canonical user
+			if linked, err := ds.LinkedUser(audience, c.User.ID); err == nil && linked != "" {
+				log.Printf("[DEBUG] login of %s made as linked %s", c.User.ID, linked)
+				c.User.ID = linked
+			}
+
+			role := ds.UserRole(audience, c.User.ID) // moderators get admin status, site management checked by the role
+			if role == "" && ldapAuth != nil && slices.Contains(s.Auth.LDAP.AdminSites, audience) && ldapAuth.IsAdmin(*c.User) {
+				role = service.RoleAdmin // members of ldap admin groups, on admin sites only
+			}
+			c.User.SetRole(role)
+			c.User.SetAdmin(role != "")
 			c.User.SetBoolAttr("blocked", ds.IsBlocked(audience, c.User.ID))
 			var err error
 			c.User.Email, err = ds.GetUserEmail(audience, c.User.ID)
@@ -1444,12 +3994,19 @@ func (s *ServerCommand) getAuthenticator(ds *service.DataStore, avas avatar.Stor
 		}),
 		AdminPasswd: s.AdminPasswd,
 		Validator: token.ValidatorFunc(func(_ string, claims token.Claims) bool { // check on each auth call (in middleware)
-			if claims.User == nil {
+			if claims.User == nil || claims.User.ID == "" {
 				return false
 			}
 			if claims.User.Audience == "" { // reject empty aud, made with old (pre 0.8.x) version of auth package
 				return false
 			}
+			var issued time.Time
+			if claims.IssuedAt != nil {
+				issued = claims.IssuedAt.Time
+			}
+			if ds.IsTokenRevoked(claims.User.Audience, claims.User.ID, issued) { // logged out everywhere
+				return false
+			}
 			return !claims.User.BoolAttr("blocked")
 		}),
 		JWTQuery:          "jwt", // change default from "token" as it used for deleteme
@@ -2,19 +2,33 @@ package cmd
 
 import (
 	"context"
+	crand "crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1" //nolint:gosec // same hash as the provider
 	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"io"
+	"math/big"
 	"math/rand"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"testing"
 	"time"
 
+	"github.com/go-pkgz/auth/v2"
 	"github.com/go-pkgz/auth/v2/provider"
 	"github.com/go-pkgz/auth/v2/token"
 	"github.com/golang-jwt/jwt/v5"
@@ -23,6 +37,16 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/umputun/remark42/backend/app/notify"
+	"github.com/umputun/remark42/backend/app/rest"
+	"github.com/umputun/remark42/backend/app/rest/api"
+	"github.com/umputun/remark42/backend/app/rest/cdn"
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/event"
+	"github.com/umputun/remark42/backend/app/store/image"
+	"github.com/umputun/remark42/backend/app/store/service"
 )
 
 func TestServerApp(t *testing.T) {
@@ -120,11 +144,23 @@ func TestServerApp_CustomOAuthProvider(t *testing.T) {
 	app.Wait()
 }
 
-func TestServerApp_AnonMode(t *testing.T) {
+func TestServerApp_OIDCProvider(t *testing.T) {
+	var issuer string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/realms/main/.well-known/openid-configuration", r.URL.Path)
+		_, _ = fmt.Fprintf(w, `{"issuer":%q,"authorization_endpoint":"%[1]s/auth","token_endpoint":"%[1]s/token",
+			"userinfo_endpoint":"%[1]s/userinfo"}`, issuer)
+	}))
+	defer ts.Close()
+	issuer = ts.URL + "/realms/main"
+
 	port := chooseRandomUnusedPort()
 	app, ctx, cancel := prepServerApp(t, func(o ServerCommand) ServerCommand {
 		o.Port = port
-		o.Auth.Anonymous = true
+		o.Auth.OIDC.Name = "keycloak"
+		o.Auth.OIDC.Issuer = issuer
+		o.Auth.OIDC.CID = "cid"
+		o.Auth.OIDC.CSEC = "csec"
 		return o
 	})
 
@@ -132,812 +168,2546 @@ func TestServerApp_AnonMode(t *testing.T) {
 	waitForHTTPServerStart(port)
 
 	providers := app.restSrv.Authenticator.Providers()
-	require.Equal(t, 11+1, len(providers), "extra auth provider for anon")
-	assert.Equal(t, "anonymous", providers[len(providers)-1].Name(), "anon auth provider")
+	require.Equal(t, 11+1, len(providers), "extra auth provider")
+	assert.Equal(t, "keycloak", providers[len(providers)-2].Name(), "oidc auth provider")
 
-	client := http.Client{Timeout: 10 * time.Second}
-	defer client.CloseIdleConnections()
+	cancel()
+	app.Wait()
+}
 
-	// send ping
-	resp, err := client.Get(fmt.Sprintf("http://localhost:%d/api/v1/ping", port))
+func TestServerApp_SAMLProvider(t *testing.T) {
+	key, err := rsa.GenerateKey(crand.Reader, 2048)
 	require.NoError(t, err)
-	defer resp.Body.Close()
-	assert.Equal(t, http.StatusOK, resp.StatusCode)
-	body, err := io.ReadAll(resp.Body)
-	assert.NoError(t, err)
-	assert.Equal(t, "pong", string(body))
-
-	// try to login with good name
-	resp, err = client.Get(fmt.Sprintf("http://localhost:%d/auth/anonymous/login?user=blah123&aud=remark", port))
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "idp.example.com"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(crand.Reader, tmpl, tmpl, &key.PublicKey, key)
 	require.NoError(t, err)
-	defer resp.Body.Close()
-	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = fmt.Fprintf(w, `<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata" entityID="https://idp.example.com">
+			<md:IDPSSODescriptor><md:KeyDescriptor><ds:KeyInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:X509Data>
+			<ds:X509Certificate>%s</ds:X509Certificate></ds:X509Data></ds:KeyInfo></md:KeyDescriptor>
+			<md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect" Location="https://idp.example.com/sso"/>
+			</md:IDPSSODescriptor></md:EntityDescriptor>`, base64.StdEncoding.EncodeToString(der))
+	}))
+	defer ts.Close()
 
-	// try to add a comment as good anonymous
-	req, err := http.NewRequest("POST", fmt.Sprintf("http://localhost:%d/api/v1/comment?site=remark", port),
-		strings.NewReader(`{"text": "test 123", "locator":{"url": "https://radio-t.com/blah1", "site": "remark"}}`))
-	require.NoError(t, err)
+	port := chooseRandomUnusedPort()
+	app, ctx, cancel := prepServerApp(t, func(o ServerCommand) ServerCommand {
+		o.Port = port
+		o.Auth.SAML.IdPMetadata = ts.URL + "/metadata"
+		return o
+	})
 
-	tkn, claims := getAuthFromCookie(t, app, resp)
-	require.NotEmpty(t, tkn)
-	assert.False(t, claims.User.BoolAttr("blocked"), "should not be blocked")
-	req.Header.Add("X-JWT", tkn)
-	resp, err = client.Do(req)
-	require.NoError(t, err)
-	defer resp.Body.Close()
-	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	go func() { _ = app.run(ctx) }()
+	waitForHTTPServerStart(port)
 
-	// try to login with non-latin name
-	time.Sleep(time.Second)
-	resp, err = client.Get(fmt.Sprintf("http://localhost:%d/auth/anonymous/login?user=Раз_Два%20%20Три_34567&aud=remark", port))
+	names := []string{}
+	for _, p := range app.restSrv.Authenticator.Providers() {
+		names = append(names, p.Name())
+	}
+	assert.Contains(t, names, "saml")
+
+	resp, err := http.Get(fmt.Sprintf("http://localhost:%d/auth/saml/metadata", port))
 	require.NoError(t, err)
-	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
 	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), `entityID="https://demo.remark42.com/auth/saml/metadata"`)
 
-	// try to login with bad name
-	time.Sleep(time.Second)
-	resp, err = client.Get(fmt.Sprintf("http://localhost:%d/auth/anonymous/login?user=**blah123&aud=remark", port))
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err = client.Get(fmt.Sprintf("http://localhost:%d/auth/saml/login?site=remark", port))
 	require.NoError(t, err)
-	defer resp.Body.Close()
-	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	assert.True(t, strings.HasPrefix(resp.Header.Get("Location"), "https://idp.example.com/sso?RelayState="))
 
-	// try to login with short name
-	time.Sleep(time.Second)
-	resp, err = client.Get(fmt.Sprintf("http://localhost:%d/auth/anonymous/login?user=bl%%20%%20&aud=remark", port))
+	cancel()
+	app.Wait()
+}
+
+func Test_loadSAMLMetadata(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte("<md/>"))
+	}))
+	defer ts.Close()
+
+	s := ServerCommand{}
+	s.Auth.SAML.Timeout = time.Second
+	s.Auth.SAML.IdPMetadata = ts.URL + "/metadata"
+	md, err := s.loadSAMLMetadata()
 	require.NoError(t, err)
-	defer resp.Body.Close()
-	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Equal(t, "<md/>", string(md))
 
-	// try to login with name what have space in prefix
-	time.Sleep(time.Second)
-	resp, err = client.Get(fmt.Sprintf("http://localhost:%d/auth/anonymous/login?user=%%20somebody&aud=remark", port))
+	s.Auth.SAML.IdPMetadata = ts.URL + "/missing"
+	_, err = s.loadSAMLMetadata()
+	assert.EqualError(t, err, ts.URL+"/missing responded with status 404")
+
+	fname := filepath.Join(t.TempDir(), "idp.xml")
+	require.NoError(t, os.WriteFile(fname, []byte("<md/>"), 0o600))
+	s.Auth.SAML.IdPMetadata = fname
+	md, err = s.loadSAMLMetadata()
 	require.NoError(t, err)
-	defer resp.Body.Close()
-	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Equal(t, "<md/>", string(md))
 
-	// try to login with name what have space in suffix
-	time.Sleep(time.Second)
-	resp, err = client.Get(fmt.Sprintf("http://localhost:%d/auth/anonymous/login?user=somebody%%20&aud=remark", port))
+	s.Auth.SAML.IdPMetadata = fname + ".bad"
+	_, err = s.loadSAMLMetadata()
+	assert.Error(t, err)
+
+	_, err = s.makeSAMLAuth(nil)
+	assert.ErrorContains(t, err, "failed to load identity provider's metadata")
+	s.Auth.SAML.IdPMetadata = ""
+	res, err := s.makeSAMLAuth(nil)
 	require.NoError(t, err)
-	defer resp.Body.Close()
-	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Nil(t, res)
+}
 
-	// try to login with long name
-	time.Sleep(time.Second)
-	ln := strings.Repeat("x", 65)
-	resp, err = client.Get(fmt.Sprintf("http://localhost:%d/auth/anonymous/login?user=%s&aud=remark", port, ln))
+func TestServerApp_LDAPProvider(t *testing.T) {
+	port := chooseRandomUnusedPort()
+	app, ctx, cancel := prepServerApp(t, func(o ServerCommand) ServerCommand {
+		o.Port = port
+		o.Auth.LDAP.URL = "ldap://127.0.0.1:1"
+		o.Auth.LDAP.BaseDN = "dc=example,dc=com"
+		o.Auth.LDAP.UserFilter = "(uid={user})"
+		o.Auth.LDAP.Timeout = 100 * time.Millisecond
+		return o
+	})
+
+	go func() { _ = app.run(ctx) }()
+	waitForHTTPServerStart(port)
+
+	names := []string{}
+	for _, p := range app.restSrv.Authenticator.Providers() {
+		names = append(names, p.Name())
+	}
+	assert.Contains(t, names, "ldap")
+
+	// directory is not reachable, login fails without granting access
+	resp, err := http.Get(fmt.Sprintf("http://localhost:%d/auth/ldap/login?user=john&passwd=secret&aud=remark", port))
 	require.NoError(t, err)
-	defer resp.Body.Close()
-	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
 
-	// try to login with admin name
-	time.Sleep(time.Second)
-	resp, err = client.Get(fmt.Sprintf("http://localhost:%d/auth/anonymous/login?user=umpUtun&aud=remark", port))
+	cancel()
+	app.Wait()
+}
+
+func Test_makeLDAPAuth(t *testing.T) {
+	s := ServerCommand{}
+	s.Sites = []string{"remark"}
+	res, err := s.makeLDAPAuth()
 	require.NoError(t, err)
-	defer resp.Body.Close()
-	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Nil(t, res, "disabled without url")
+
+	s.Auth.LDAP.URL = "ldaps://ldap.example.com"
+	s.Auth.LDAP.BaseDN = "dc=example,dc=com"
+	s.Auth.LDAP.UserFilter = "(sAMAccountName={user})"
+	s.Auth.LDAP.GroupAttr = "memberOf"
+	s.Auth.LDAP.AdminGroups = []string{"cn=admins,dc=example,dc=com"}
+	res, err = s.makeLDAPAuth()
+	require.NoError(t, err)
+	require.NotNil(t, res)
+	assert.Equal(t, "ldap", res.Name)
+	assert.Nil(t, res.TLSConfig.RootCAs, "system ca used")
+	assert.Equal(t, []string{"remark"}, s.Auth.LDAP.AdminSites, "the only site")
+
+	s.Sites = []string{"remark", "other"}
+	s.Auth.LDAP.AdminSites = nil
+	_, err = s.makeLDAPAuth()
+	assert.EqualError(t, err, "ldap admin sites should be set with multiple sites")
+	s.Auth.LDAP.AdminSites = []string{"other", "bad"}
+	_, err = s.makeLDAPAuth()
+	assert.EqualError(t, err, `unknown ldap admin site "bad"`)
+	s.Auth.LDAP.AdminSites = []string{"other"}
+	_, err = s.makeLDAPAuth()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"other"}, s.Auth.LDAP.AdminSites)
 
-	// try to add a comment as anonymous with admin name
-	time.Sleep(time.Second)
-	req, err = http.NewRequest("POST", fmt.Sprintf("http://localhost:%d/api/v1/comment?site=remark", port),
-		strings.NewReader(`{"text": "test 123", "locator":{"url": "https://radio-t.com/blah1", "site": "remark"}}`))
+	key, err := rsa.GenerateKey(crand.Reader, 2048)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "ca.example.com"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(crand.Reader, tmpl, tmpl, &key.PublicKey, key)
 	require.NoError(t, err)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	s.Auth.LDAP.CACert = caFile
+	res, err = s.makeLDAPAuth()
+	require.NoError(t, err)
+	assert.NotNil(t, res.TLSConfig.RootCAs)
+
+	require.NoError(t, os.WriteFile(caFile, []byte("not a pem"), 0o600))
+	_, err = s.makeLDAPAuth()
+	assert.EqualError(t, err, "no ca certificates in "+caFile)
+	s.Auth.LDAP.CACert = caFile + ".missing"
+	_, err = s.makeLDAPAuth()
+	assert.ErrorContains(t, err, "failed to read ca certificates")
+
+	s.Auth.LDAP.CACert = ""
+	s.Auth.LDAP.UserFilter = "(uid=john)"
+	_, err = s.makeLDAPAuth()
+	assert.EqualError(t, err, `ldap user filter "(uid=john)" should have {user} placeholder`)
+}
 
-	tkn, claims = getAuthFromCookie(t, app, resp)
-	require.NotEmpty(t, tkn)
-	assert.True(t, claims.User.BoolAttr("blocked"), "should be blocked")
-	req.Header.Add("X-JWT", tkn)
-	resp, err = client.Do(req)
+func TestServerApp_OIDCProviderErrors(t *testing.T) {
+	tbl := []struct {
+		oidc OIDCAuthGroup
+		err  string
+	}{
+		{OIDCAuthGroup{Name: "google", Issuer: "https://example.com", CID: "cid", CSEC: "csec"}, `provider name "google" is already used`},
+		{OIDCAuthGroup{Name: "custom", Issuer: "https://example.com", CID: "cid", CSEC: "csec"}, `provider name "custom" is already used`},
+		{OIDCAuthGroup{Name: "bad name", Issuer: "https://example.com", CID: "cid", CSEC: "csec"}, `provider name "bad name" is invalid`},
+		{OIDCAuthGroup{Name: "oidc", Issuer: "https://example.com", CID: "cid"}, "client id and secret are required"},
+		{OIDCAuthGroup{Name: "oidc", Issuer: "http://127.0.0.1:1", CID: "cid", CSEC: "csec", Timeout: time.Second},
+			"failed to discover http://127.0.0.1:1: can't get discovery document"},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.err, func(t *testing.T) {
+			s := ServerCommand{}
+			s.Auth.OIDC = tt.oidc
+			s.Auth.Custom = CustomAuthGroup{Name: "custom"}
+			err := s.addOIDCProvider(nil)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
+
+func Test_discoverOIDC(t *testing.T) {
+	var doc string
+	status := http.StatusOK
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/.well-known/openid-configuration", r.URL.Path)
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(doc))
+	}))
+	defer ts.Close()
+
+	doc = fmt.Sprintf(`{"issuer":"%[1]s/","authorization_endpoint":"%[1]s/auth","token_endpoint":"%[1]s/token",
+		"userinfo_endpoint":"%[1]s/userinfo"}`, ts.URL)
+	res, err := discoverOIDC(context.Background(), http.DefaultClient, ts.URL)
 	require.NoError(t, err)
-	defer resp.Body.Close()
-	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, oidcDiscovery{Issuer: ts.URL + "/", AuthorizationEndpoint: ts.URL + "/auth",
+		TokenEndpoint: ts.URL + "/token", UserinfoEndpoint: ts.URL + "/userinfo"}, res)
+
+	doc = `{"issuer":"https://idp.example.com","authorization_endpoint":"https://idp.example.com/auth"}`
+	_, err = discoverOIDC(context.Background(), http.DefaultClient, ts.URL)
+	assert.EqualError(t, err, fmt.Sprintf(`discovery document issuer "https://idp.example.com" doesn't match %q`, ts.URL))
+
+	doc = fmt.Sprintf(`{"issuer":%q,"authorization_endpoint":"%[1]s/auth"}`, ts.URL)
+	_, err = discoverOIDC(context.Background(), http.DefaultClient, ts.URL+"/")
+	assert.EqualError(t, err, "discovery document has no authorization, token or userinfo endpoint")
+
+	doc = `not json`
+	_, err = discoverOIDC(context.Background(), http.DefaultClient, ts.URL)
+	assert.ErrorContains(t, err, "can't decode discovery document")
+
+	status = http.StatusNotFound
+	_, err = discoverOIDC(context.Background(), http.DefaultClient, ts.URL)
+	assert.EqualError(t, err, "discovery document responded with status 404")
+}
+
+func Test_oidcUser(t *testing.T) {
+	user := oidcUser("keycloak", provider.UserData{"sub": "123", "name": "Alice", "preferred_username": "alice",
+		"email": "alice@example.com", "email_verified": true, "picture": "https://example.com/alice.png"})
+	assert.Equal(t, token.User{ID: "keycloak_" + token.HashID(sha1.New(), "123"), Name: "Alice",
+		Email: "alice@example.com", Picture: "https://example.com/alice.png"}, user)
+
+	user = oidcUser("keycloak", provider.UserData{"sub": "123", "preferred_username": "alice", "email": "alice@example.com",
+		"email_verified": false})
+	assert.Equal(t, "alice", user.Name)
+	assert.Empty(t, user.Email, "unverified email is not used")
+
+	user = oidcUser("oidc", provider.UserData{"sub": "123"})
+	assert.True(t, strings.HasPrefix(user.Name, "noname_"), user.Name)
+	assert.Empty(t, user.Email)
+
+	user = oidcUser("oidc", provider.UserData{"sub": "123", "email": "alice@example.com"})
+	assert.Empty(t, user.Email, "email without verification claim is not used")
+	user = oidcUser("oidc", provider.UserData{"sub": "123", "email": "alice@example.com", "email_verified": "true"})
+	assert.Equal(t, "alice@example.com", user.Email)
+
+	user = oidcUser("oidc", provider.UserData{"name": "Alice", "email": "alice@example.com", "email_verified": true})
+	assert.Equal(t, token.User{}, user, "no subject")
+	user = oidcUser("oidc", provider.UserData{"sub": "", "name": "Alice"})
+	assert.Empty(t, user.ID, "empty subject")
+}
+
+func TestServerApp_GitlabProvider(t *testing.T) {
+	port := chooseRandomUnusedPort()
+	app, ctx, cancel := prepServerApp(t, func(o ServerCommand) ServerCommand {
+		o.Port = port
+		o.Auth.Gitlab = GitlabAuthGroup{CID: "cid", CSEC: "csec", URL: "https://gitlab.example.com/"}
+		return o
+	})
+
+	go func() { _ = app.run(ctx) }()
+	waitForHTTPServerStart(port)
+
+	names := []string{}
+	for _, p := range app.restSrv.Authenticator.Providers() {
+		names = append(names, p.Name())
+	}
+	assert.Len(t, names, 11+1, "extra auth provider")
+	assert.Contains(t, names, "gitlab")
 
 	cancel()
 	app.Wait()
 }
 
-func getAuthFromCookie(t *testing.T, app *serverApp, resp *http.Response) (tkn string, claims token.Claims) {
-	var err error
-	for _, c := range resp.Cookies() {
-		if c.Name == "JWT" {
-			tkn = c.Value
-			claims, err = app.restSrv.Authenticator.TokenService().Parse(c.Value)
-			require.NoError(t, err)
-		}
+func TestServerApp_GitlabProviderErrors(t *testing.T) {
+	for _, u := range []string{"gitlab.example.com", "ftp://gitlab.example.com", "https://", "http://bad host"} {
+		s := ServerCommand{}
+		s.Auth.Gitlab = GitlabAuthGroup{CID: "cid", CSEC: "csec", URL: u}
+		assert.EqualError(t, s.addGitlabProvider(nil), fmt.Sprintf("invalid gitlab url %q", u))
 	}
-	return tkn, claims
 }
 
-func TestServerApp_WithSSL(t *testing.T) {
-	opts := ServerCommand{}
-	sslPort := chooseRandomUnusedPort()
-	opts.SetCommon(CommonOpts{RemarkURL: fmt.Sprintf("https://localhost:%d", sslPort), SharedSecret: "123456"})
-
-	// prepare options
-	p := flags.NewParser(&opts, flags.Default)
+func TestServerApp_MastodonProvider(t *testing.T) {
 	port := chooseRandomUnusedPort()
-	_, err := p.ParseArgs([]string{"--admin-passwd=password", "--port=" + strconv.Itoa(port), "--store.bolt.path=/tmp/xyz", "--backup=/tmp",
-		"--avatar.type=bolt", "--avatar.bolt.file=/tmp/ava-test.db",
-		"--ssl.type=static", "--ssl.cert=testdata/cert.pem", "--ssl.key=testdata/key.pem",
-		"--ssl.port=" + strconv.Itoa(sslPort), "--image.fs.path=/tmp"})
-	require.NoError(t, err)
-	defer os.Remove("/tmp/xyz")
-	defer os.Remove("/tmp/xyz/remark.db")
-	defer os.Remove("/tmp/ava-test.db")
-
-	// create app
-	app, err := opts.newServerApp(context.Background())
-	require.NoError(t, err)
+	app, ctx, cancel := prepServerApp(t, func(o ServerCommand) ServerCommand {
+		o.Port = port
+		o.Auth.Mastodon.Instances = []string{"mastodon.social", "fosstodon.org"}
+		return o
+	})
 
-	ctx, cancel := context.WithCancel(context.Background())
 	go func() { _ = app.run(ctx) }()
-	waitForHTTPSServerStart(sslPort)
-
-	client := http.Client{
-		// prevent http redirect
-		CheckRedirect: func(*http.Request, []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
+	waitForHTTPServerStart(port)
 
-		// allow self-signed certificate
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
+	names := []string{}
+	for _, p := range app.restSrv.Authenticator.Providers() {
+		names = append(names, p.Name())
 	}
-	defer client.CloseIdleConnections()
+	assert.Len(t, names, 11+1, "extra auth provider")
+	assert.Contains(t, names, "mastodon")
 
-	// check http to https redirect response
-	resp, err := client.Get(fmt.Sprintf("http://localhost:%d/blah?param=1", port))
+	resp, err := http.Get(fmt.Sprintf("http://localhost:%d/auth/mastodon/login?site=remark", port))
 	require.NoError(t, err)
-	defer resp.Body.Close()
-	assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
-	assert.Equal(t, fmt.Sprintf("https://localhost:%d/blah?param=1", sslPort), resp.Header.Get("Location"))
-
-	// check https server
-	resp, err = client.Get(fmt.Sprintf("https://localhost:%d/ping", sslPort))
+	body, err := io.ReadAll(resp.Body)
 	require.NoError(t, err)
-	defer resp.Body.Close()
+	require.NoError(t, resp.Body.Close())
 	assert.Equal(t, http.StatusOK, resp.StatusCode)
-	body, err := io.ReadAll(resp.Body)
-	assert.NoError(t, err)
-	assert.Equal(t, "pong", string(body))
+	assert.Contains(t, string(body), `name="instance"`, "instance is asked")
 
 	cancel()
 	app.Wait()
+
+	s := ServerCommand{}
+	s.Auth.Mastodon.Instances = []string{"mastodon.social/about"}
+	assert.EqualError(t, s.addMastodonAuth(auth.NewService(auth.Opts{})), `bad instance "mastodon.social/about": not a host name`)
 }
 
-func TestServerApp_WithRemote(t *testing.T) {
-	opts := ServerCommand{}
-	opts.SetCommon(CommonOpts{RemarkURL: "https://demo.remark42.com", SharedSecret: "123456"})
+func Test_gitlabUser(t *testing.T) {
+	data := provider.UserData{"id": float64(12345), "username": "alice", "name": "Alice", "email": "alice@example.com",
+		"avatar_url": "https://gitlab.com/uploads/alice.png"}
+	user := gitlabUser("gitlab.com", data)
+	assert.Equal(t, token.User{ID: "gitlab_" + token.HashID(sha1.New(), "12345"), Name: "Alice",
+		Email: "alice@example.com", Picture: "https://gitlab.com/uploads/alice.png"}, user)
 
-	// prepare options
-	p := flags.NewParser(&opts, flags.Default)
-	port := chooseRandomUnusedPort()
-	_, err := p.ParseArgs([]string{"--admin-passwd=password", "--cache.type=none",
-		"--store.type=rpc", "--store.rpc.api=http://127.0.0.1",
-		"--port=" + strconv.Itoa(port), "--avatar.fs.path=/tmp",
-		"--admin.type=rpc", "--admin.rpc.secret_per_site", "--admin.rpc.api=http://127.0.0.1"})
-	require.NoError(t, err)
-	opts.Auth.Github.CSEC, opts.Auth.Github.CID = "csec", "cid"
-	opts.BackupLocation, opts.Image.FS.Path = "/tmp", "/tmp"
+	selfHosted := gitlabUser("GitLab.Example.com", data)
+	assert.Equal(t, "gitlab_"+token.HashID(sha1.New(), "gitlab.example.com:12345"), selfHosted.ID,
+		"self-hosted id doesn't clash with gitlab.com")
 
-	// create app
-	app, err := opts.newServerApp(context.Background())
-	require.NoError(t, err)
+	user = gitlabUser("gitlab.com", provider.UserData{"id": float64(1), "username": "bob"})
+	assert.Equal(t, "bob", user.Name)
+
+	user = gitlabUser("gitlab.com", provider.UserData{"id": float64(1)})
+	assert.True(t, strings.HasPrefix(user.Name, "noname_"), user.Name)
+}
+
+func TestServerApp_TwitchProvider(t *testing.T) {
+	port := chooseRandomUnusedPort()
+	app, ctx, cancel := prepServerApp(t, func(o ServerCommand) ServerCommand {
+		o.Port = port
+		o.Auth.Twitch = AuthGroup{CID: "cid", CSEC: "csec"}
+		return o
+	})
 
-	ctx, cancel := context.WithCancel(context.Background())
 	go func() { _ = app.run(ctx) }()
 	waitForHTTPServerStart(port)
 
-	// send ping
-	resp, err := http.Get(fmt.Sprintf("http://localhost:%d/api/v1/ping", port))
-	defer http.DefaultClient.CloseIdleConnections()
+	names := []string{}
+	for _, p := range app.restSrv.Authenticator.Providers() {
+		names = append(names, p.Name())
+	}
+	assert.Len(t, names, 11+1, "extra auth provider")
+	assert.Contains(t, names, "twitch")
+
+	client := http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(fmt.Sprintf("http://localhost:%d/auth/twitch/login?site=remark", port))
 	require.NoError(t, err)
-	defer resp.Body.Close()
-	assert.Equal(t, http.StatusOK, resp.StatusCode)
-	body, err := io.ReadAll(resp.Body)
-	assert.NoError(t, err)
-	assert.Equal(t, "pong", string(body))
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, "id.twitch.tv", loc.Host)
+	assert.Equal(t, "openid", loc.Query().Get("scope"))
+	assert.Equal(t, `{"userinfo":{"preferred_username":null,"picture":null}}`, loc.Query().Get("claims"))
+	assert.Equal(t, "cid", loc.Query().Get("client_id"))
 
 	cancel()
 	app.Wait()
 }
 
-func TestServerApp_Failed(t *testing.T) {
-	opts := ServerCommand{}
-	opts.SetCommon(CommonOpts{RemarkURL: "https://demo.remark42.com", SharedSecret: "123456"})
+func Test_twitchUser(t *testing.T) {
+	user := twitchUser(provider.UserData{"sub": "12345", "preferred_username": "streamer",
+		"picture": "https://static-cdn.jtvnw.net/user-default-pictures/1.png"})
+	assert.Equal(t, token.User{ID: "twitch_" + token.HashID(sha1.New(), "12345"), Name: "streamer",
+		Picture: "https://static-cdn.jtvnw.net/user-default-pictures/1.png"}, user)
 
-	p := flags.NewParser(&opts, flags.Default)
+	user = twitchUser(provider.UserData{"sub": "12345"})
+	assert.True(t, strings.HasPrefix(user.Name, "noname_"), user.Name)
+}
 
-	// RO bolt location
-	_, err := p.ParseArgs([]string{"--backup=/tmp", "--store.bolt.path=/dev/null", "--image.fs.path=/tmp"})
-	assert.NoError(t, err)
-	_, err = opts.newServerApp(context.Background())
-	assert.EqualError(t, err, "failed to make data store engine: failed to create bolt store: can't make directory /dev/null: mkdir /dev/null: not a directory")
-	t.Log(err)
+func TestServerApp_SteamProvider(t *testing.T) {
+	port := chooseRandomUnusedPort()
+	app, ctx, cancel := prepServerApp(t, func(o ServerCommand) ServerCommand {
+		o.Port = port
+		o.Auth.Steam.APIKey = "steam-key"
+		return o
+	})
 
-	// RO backup location
-	opts = ServerCommand{}
-	opts.SetCommon(CommonOpts{RemarkURL: "https://demo.remark42.com", SharedSecret: "123456"})
+	go func() { _ = app.run(ctx) }()
+	waitForHTTPServerStart(port)
 
-	_, err = p.ParseArgs([]string{"--store.bolt.path=/tmp", "--backup=/dev/null/not-writable"})
-	assert.NoError(t, err)
-	defer os.Remove("/tmp/remark.db")
-	_, err = opts.newServerApp(context.Background())
-	assert.EqualError(t, err, "failed to create backup store: can't make directory /dev/null/not-writable: mkdir /dev/null: not a directory")
-	t.Log(err)
+	names := []string{}
+	for _, p := range app.restSrv.Authenticator.Providers() {
+		names = append(names, p.Name())
+	}
+	assert.Len(t, names, 11+1, "extra auth provider")
+	assert.Contains(t, names, "steam")
 
-	// invalid url
-	opts = ServerCommand{}
-	opts.SetCommon(CommonOpts{RemarkURL: "demo.remark42.com", SharedSecret: "123456"})
+	client := http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(fmt.Sprintf("http://localhost:%d/auth/steam/login?site=remark", port))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	assert.True(t, strings.HasPrefix(resp.Header.Get("Location"), "https://steamcommunity.com/openid/login?"))
 
-	_, err = p.ParseArgs([]string{"--backup=/tmp", "----store.bolt.path=/tmp"})
-	assert.NoError(t, err)
-	_, err = opts.newServerApp(context.Background())
-	assert.EqualError(t, err, "invalid remark42 url demo.remark42.com")
-	t.Log(err)
+	cancel()
+	app.Wait()
+}
 
-	// invalid trusted proxy CIDR fails fast, before any resource is created
-	opts = ServerCommand{}
-	opts.SetCommon(CommonOpts{RemarkURL: "https://demo.remark42.com", SharedSecret: "123456"})
-	p = flags.NewParser(&opts, flags.Default)
-	_, err = p.ParseArgs([]string{"--backup=/tmp", "--trusted-proxy=nonsense"})
-	assert.NoError(t, err)
-	_, err = opts.newServerApp(context.Background())
-	assert.EqualError(t, err, `invalid --trusted-proxy: invalid trusted proxy "nonsense"`)
-	t.Log(err)
+func TestServerApp_SMSProvider(t *testing.T) {
+	var sent int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&sent, 1)
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+	}))
+	defer ts.Close()
 
-	// wrong store type
-	opts = ServerCommand{}
-	opts.SetCommon(CommonOpts{RemarkURL: "https://demo.remark42.com", SharedSecret: "123456"})
+	port := chooseRandomUnusedPort()
+	app, ctx, cancel := prepServerApp(t, func(o ServerCommand) ServerCommand {
+		o.Port = port
+		o.Auth.SMS.Sender = "webhook"
+		o.Auth.SMS.Webhook.URL = ts.URL
+		o.Auth.SMS.Webhook.Headers = []string{"Authorization:Bearer secret"}
+		o.Auth.SMS.RateLimit = 1
+		return o
+	})
 
-	_, err = p.ParseArgs([]string{"--backup=/tmp", "--store.type=blah"})
-	assert.Error(t, err, "blah is invalid type")
+	go func() { _ = app.run(ctx) }()
+	waitForHTTPServerStart(port)
 
-	opts.Store.Type = "blah"
-	_, err = opts.newServerApp(context.Background())
-	assert.EqualError(t, err, "failed to make data store engine: unsupported store type blah")
-	t.Log(err)
+	names := []string{}
+	for _, p := range app.restSrv.Authenticator.Providers() {
+		names = append(names, p.Name())
+	}
+	assert.Len(t, names, 11+1, "extra auth provider")
+	assert.Contains(t, names, "sms")
 
-	// wrong redis location
-	opts = ServerCommand{}
-	opts.SetCommon(CommonOpts{RemarkURL: "https://demo.remark42.com", SharedSecret: "123456"})
-	p = flags.NewParser(&opts, flags.Default)
-	_, err = p.ParseArgs([]string{"--store.bolt.path=/tmp", "--cache.type=redis_pub_sub", "--cache.redis_addr=wrong_address"})
-	assert.NoError(t, err)
-	_, err = opts.newServerApp(context.Background())
-	assert.EqualError(t, err,
-		"failed to make cache: cache backend initialization, redis PubSub initialisation: "+
-			"problem subscribing to channel remark42-cache on address wrong_address: "+
-			"dial tcp: address wrong_address: missing port in address")
-	t.Log(err)
+	resp, err := http.Get(fmt.Sprintf("http://localhost:%d/auth/sms/login?site=remark&user=dev&address=%%2B15551234567", port))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&sent))
 
-	// wrong apple private key type
-	opts = ServerCommand{}
-	opts.SetCommon(CommonOpts{RemarkURL: "https://demo.remark42.com", SharedSecret: "123456"})
-	p = flags.NewParser(&opts, flags.Default)
-	_, err = p.ParseArgs([]string{"--auth.apple.cid=123", "--auth.apple.tid=123",
-		"--auth.apple.kid=123", "--auth.apple.private-key-filepath=testdata/apple-bad.p8"})
-	assert.NoError(t, err)
-	_, err = opts.newServerApp(context.Background())
-	assert.EqualError(t, err,
-		"failed to make authenticator: an AppleProvider creating failed: "+
-			"provided private key is not ECDSA")
-	t.Log(err)
+	resp, err = http.Get(fmt.Sprintf("http://localhost:%d/auth/sms/login?site=remark&user=dev&address=%%2B15551234567", port))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&sent))
 
-	// incomplete custom oauth config
-	opts = ServerCommand{}
-	opts.SetCommon(CommonOpts{RemarkURL: "https://demo.remark42.com", SharedSecret: "123456"})
-	p = flags.NewParser(&opts, flags.Default)
-	_, err = p.ParseArgs([]string{"--store.bolt.path=/tmp", "--backup=/tmp", "--image.fs.path=/tmp", "--auth.custom.name=oidc", "--auth.custom.cid=123"})
-	assert.NoError(t, err)
-	_, err = opts.newServerApp(context.Background())
-	assert.EqualError(t, err,
-		"failed to make authenticator: custom oauth provider configuration is incomplete, missing: "+
-			"AUTH_CUSTOM_CSEC, AUTH_CUSTOM_AUTH_URL, AUTH_CUSTOM_TOKEN_URL, AUTH_CUSTOM_INFO_URL")
-	t.Log(err)
+	cancel()
+	app.Wait()
 }
 
-func TestIsReservedCustomProviderName(t *testing.T) {
-	reserved := []string{
-		"email", "anonymous", "google", "github", "facebook", "yandex", "twitter",
-		"microsoft", "patreon", "discord", "telegram", "dev", "apple",
+func TestServerCommand_addSMSAuthErrors(t *testing.T) {
+	tbl := []struct {
+		sender string
+		err    string
+	}{
+		{"twilio", "twilio account sid, auth token and sender number are required"},
+		{"vonage", "vonage api key, api secret and sender id are required"},
+		{"webhook", "sms webhook url is required"},
+		{"unknown", `unknown sms sender "unknown"`},
 	}
-
-	for _, name := range reserved {
-		t.Run(name, func(t *testing.T) {
-			assert.True(t, isReservedCustomProviderName(name))
+	for _, tt := range tbl {
+		t.Run(tt.sender, func(t *testing.T) {
+			s := ServerCommand{}
+			s.Auth.SMS.Sender = tt.sender
+			assert.EqualError(t, s.addSMSAuth(nil), tt.err)
 		})
 	}
-
-	assert.False(t, isReservedCustomProviderName("oidc"))
+	assert.NoError(t, (&ServerCommand{}).addSMSAuth(nil))
 }
 
-func TestIsValidCustomProviderName(t *testing.T) {
-	valid := []string{"oidc", "codeberg", "provider_1", "provider-1", "a1"}
-	for _, name := range valid {
-		t.Run("valid_"+name, func(t *testing.T) {
-			assert.True(t, isValidCustomProviderName(name))
-		})
-	}
+func TestServerApp_RedditProvider(t *testing.T) {
+	port := chooseRandomUnusedPort()
+	app, ctx, cancel := prepServerApp(t, func(o ServerCommand) ServerCommand {
+		o.Port = port
+		o.Auth.Reddit.CID = "reddit-cid"
+		o.Auth.Reddit.CSEC = "reddit-csec"
+		o.Auth.Reddit.Duration = "permanent"
+		return o
+	})
 
-	invalid := []string{"", " has-space", "has space", "Uppercase", "provider!", "-provider", "_provider"}
-	for _, name := range invalid {
-		t.Run("invalid_"+strings.ReplaceAll(name, " ", "_"), func(t *testing.T) {
-			assert.False(t, isValidCustomProviderName(name))
-		})
+	go func() { _ = app.run(ctx) }()
+	waitForHTTPServerStart(port)
+
+	names := []string{}
+	for _, p := range app.restSrv.Authenticator.Providers() {
+		names = append(names, p.Name())
 	}
-}
+	assert.Len(t, names, 11+1, "extra auth provider")
+	assert.Contains(t, names, "reddit")
 
-func TestCustomProviderSourceID(t *testing.T) {
-	cfg := CustomAuthGroup{IDField: "sub", EmailField: "email", NameField: "name", PictureField: "picture"}
+	client := http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(fmt.Sprintf("http://localhost:%d/auth/reddit/login?site=remark", port))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, "https://www.reddit.com/api/v1/authorize", loc.Scheme+"://"+loc.Host+loc.Path)
+	assert.Equal(t, "reddit-cid", loc.Query().Get("client_id"))
+	assert.Equal(t, "permanent", loc.Query().Get("duration"))
 
-	assert.Equal(t, "user-1", customProviderSourceID(provider.UserData{"sub": "user-1", "email": "a@example.com"}, cfg))
-	assert.Equal(t, "a@example.com", customProviderSourceID(provider.UserData{"email": "a@example.com"}, cfg))
-	assert.Equal(t, "alice", customProviderSourceID(provider.UserData{"name": "alice"}, cfg))
-	assert.Equal(t, "https://example.com/avatar.png", customProviderSourceID(provider.UserData{"picture": "https://example.com/avatar.png"}, cfg))
-	assert.Equal(t, `{"login":"alice"}`, customProviderSourceID(provider.UserData{"login": "alice"}, cfg))
-	assert.Equal(t, "{}", customProviderSourceID(provider.UserData{}, cfg))
+	cancel()
+	app.Wait()
 }
 
-func TestServerApp_InvalidCustomOAuthProviderName(t *testing.T) {
-	baseArgs := []string{
-		"--store.bolt.path=/tmp",
-		"--backup=/tmp",
-		"--image.fs.path=/tmp",
-		"--auth.custom.cid=123",
-		"--auth.custom.csec=456",
-		"--auth.custom.auth-url=https://example.com/oauth2/authorize",
-		"--auth.custom.token-url=https://example.com/oauth2/token",
-		"--auth.custom.info-url=https://example.com/oauth2/userinfo",
-	}
+func TestServerApp_VKProvider(t *testing.T) {
+	port := chooseRandomUnusedPort()
+	app, ctx, cancel := prepServerApp(t, func(o ServerCommand) ServerCommand {
+		o.Port = port
+		o.Auth.VK.CID = "123"
+		o.Auth.VK.CSEC = "vk-key"
+		return o
+	})
 
-	t.Run("reserved", func(t *testing.T) {
-		opts := ServerCommand{}
-		opts.SetCommon(CommonOpts{RemarkURL: "https://demo.remark42.com", SharedSecret: "123456"})
-		p := flags.NewParser(&opts, flags.Default)
-		_, err := p.ParseArgs(append(baseArgs, "--auth.custom.name=twitter"))
-		require.NoError(t, err)
+	go func() { _ = app.run(ctx) }()
+	waitForHTTPServerStart(port)
 
-		_, err = opts.newServerApp(context.Background())
-		assert.EqualError(t, err, `failed to make authenticator: custom oauth provider name "twitter" is reserved`)
-	})
+	names := []string{}
+	for _, p := range app.restSrv.Authenticator.Providers() {
+		names = append(names, p.Name())
+	}
+	assert.Len(t, names, 11+1, "extra auth provider")
+	assert.Contains(t, names, "vk")
 
-	t.Run("not_url_safe", func(t *testing.T) {
-		opts := ServerCommand{}
-		opts.SetCommon(CommonOpts{RemarkURL: "https://demo.remark42.com", SharedSecret: "123456"})
-		p := flags.NewParser(&opts, flags.Default)
-		_, err := p.ParseArgs(append(baseArgs, "--auth.custom.name=bad name"))
-		require.NoError(t, err)
+	client := http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(fmt.Sprintf("http://localhost:%d/auth/vk/login?site=remark", port))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, "https://oauth.vk.com/authorize", loc.Scheme+"://"+loc.Host+loc.Path)
+	assert.Equal(t, "email", loc.Query().Get("scope"))
 
-		_, err = opts.newServerApp(context.Background())
-		assert.EqualError(t, err, `failed to make authenticator: custom oauth provider name "bad name" is invalid, expected pattern "^[a-z0-9][a-z0-9_-]*$"`)
-	})
+	cancel()
+	app.Wait()
 }
 
-func TestServerApp_Shutdown(t *testing.T) {
+func TestServerApp_WeChatProvider(t *testing.T) {
+	port := chooseRandomUnusedPort()
 	app, ctx, cancel := prepServerApp(t, func(o ServerCommand) ServerCommand {
-		o.Port = chooseRandomUnusedPort()
+		o.Port = port
+		o.Auth.WeChat.CID = "wx123"
+		o.Auth.WeChat.CSEC = "wechat-secret"
 		return o
 	})
-	time.AfterFunc(100*time.Millisecond, func() {
-		cancel()
-	})
-	st := time.Now()
-	err := app.run(ctx)
-	assert.NoError(t, err)
-	assert.True(t, time.Since(st).Seconds() < 1, "should take about 100msec")
-	app.Wait()
-}
 
-func TestServerApp_MainSignal(t *testing.T) {
-	done := make(chan struct{})
-	go func() {
-		<-done
-		time.Sleep(250 * time.Millisecond)
-		err := syscall.Kill(syscall.Getpid(), syscall.SIGTERM)
-		require.NoError(t, err)
-	}()
+	go func() { _ = app.run(ctx) }()
+	waitForHTTPServerStart(port)
 
-	s := ServerCommand{}
-	s.SetCommon(CommonOpts{RemarkURL: "https://demo.remark42.com", SharedSecret: "123456"})
+	names := []string{}
+	for _, p := range app.restSrv.Authenticator.Providers() {
+		names = append(names, p.Name())
+	}
+	assert.Len(t, names, 11+1, "extra auth provider")
+	assert.Contains(t, names, "wechat")
 
-	p := flags.NewParser(&s, flags.Default)
-	port := chooseRandomUnusedPort()
-	args := []string{"test", "--store.bolt.path=/tmp/xyz", "--backup=/tmp", "--avatar.type=bolt",
-		"--avatar.bolt.file=/tmp/ava-test.db", "--port=" + strconv.Itoa(port), "--image.fs.path=/tmp"}
-	defer os.Remove("/tmp/xyz")
-	defer os.Remove("/tmp/xyz/remark.db")
-	defer os.Remove("/tmp/ava-test.db")
-	_, err := p.ParseArgs(args)
+	client := http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(fmt.Sprintf("http://localhost:%d/auth/wechat/login?site=remark", port))
 	require.NoError(t, err)
-	st := time.Now()
-	close(done)
-	err = s.Execute(args)
-	assert.NoError(t, err, "execute should be without errors")
-	assert.True(t, time.Since(st).Seconds() < 5, "should take under five sec", time.Since(st).Seconds())
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, "https://open.weixin.qq.com/connect/qrconnect", loc.Scheme+"://"+loc.Host+loc.Path)
+	assert.Equal(t, "wx123", loc.Query().Get("appid"))
+	assert.Equal(t, "snsapi_login", loc.Query().Get("scope"))
+
+	cancel()
+	app.Wait()
 }
 
-func TestServerApp_RunCanceledBeforeRESTStart(t *testing.T) {
+func TestServerApp_WebAuthnProvider(t *testing.T) {
 	port := chooseRandomUnusedPort()
 	app, ctx, cancel := prepServerApp(t, func(o ServerCommand) ServerCommand {
 		o.Port = port
+		o.Auth.WebAuthn.Enable = true
+		o.Auth.WebAuthn.RPName = "Blog"
 		return o
 	})
-	cancel()
 
-	errCh := make(chan error, 1)
-	go func() { errCh <- app.run(ctx) }()
+	go func() { _ = app.run(ctx) }()
+	waitForHTTPServerStart(port)
 
-	select {
-	case err := <-errCh:
-		require.NoError(t, err)
-		app.Wait()
-	case <-time.After(time.Second):
-		waitForHTTPServerStart(port)
-		app.restSrv.Shutdown()
-		select {
-		case <-errCh:
-			app.Wait()
-		case <-time.After(time.Second):
-			t.Fatal("server app did not stop after forced REST shutdown")
-		}
-		t.Fatal("server app should exit when context is canceled before REST server starts")
+	names := []string{}
+	for _, p := range app.restSrv.Authenticator.Providers() {
+		names = append(names, p.Name())
 	}
-}
+	assert.Len(t, names, 11+1, "extra auth provider")
+	assert.Contains(t, names, "webauthn")
+
+	resp, err := http.Get(fmt.Sprintf("http://localhost:%d/auth/webauthn/login?site=remark", port))
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+	assert.Contains(t, string(body), `"rpId":"demo.remark42.com"`)
+	assert.Contains(t, string(body), `"state":`)
+
+	resp, err = http.Post(fmt.Sprintf("http://localhost:%d/auth/webauthn/register/begin?site=remark", port),
+		"application/json", strings.NewReader(`{"name":"user1"}`))
+	require.NoError(t, err)
+	body, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+	assert.Contains(t, string(body), `"rp":{"name":"Blog","id":"demo.remark42.com"}`)
+
+	resp, err = http.Get(fmt.Sprintf("http://localhost:%d/auth/webauthn/register/begin?site=remark", port))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.NotEqual(t, http.StatusOK, resp.StatusCode, "registration is post only")
+
+	cancel()
+	app.Wait()
+}
+
+func TestServerApp_AdminListen(t *testing.T) {
+	port, adminPort := chooseRandomUnusedPort(), chooseRandomUnusedPort()
+	app, ctx, cancel := prepServerApp(t, func(o ServerCommand) ServerCommand {
+		o.Port = port
+		o.AdminListen = fmt.Sprintf("127.0.0.1:%d", adminPort)
+		return o
+	})
+
+	go func() { _ = app.run(ctx) }()
+	waitForHTTPServerStart(port)
+	waitForHTTPServerStart(adminPort)
+
+	resp, err := http.Get(fmt.Sprintf("http://localhost:%d/api/v1/admin/blocked?site=remark", port))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode, "admin api not public")
+
+	resp, err = http.Get(fmt.Sprintf("http://127.0.0.1:%d/api/v1/admin/blocked?site=remark", adminPort))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "admin api served, auth required")
+
+	cancel()
+	app.Wait()
+}
+
+func TestServerApp_AnonMode(t *testing.T) {
+	port := chooseRandomUnusedPort()
+	app, ctx, cancel := prepServerApp(t, func(o ServerCommand) ServerCommand {
+		o.Port = port
+		o.Auth.Anonymous = true
+		return o
+	})
+
+	go func() { _ = app.run(ctx) }()
+	waitForHTTPServerStart(port)
+
+	providers := app.restSrv.Authenticator.Providers()
+	require.Equal(t, 11+1, len(providers), "extra auth provider for anon")
+	assert.Equal(t, "anonymous", providers[len(providers)-1].Name(), "anon auth provider")
+
+	client := http.Client{Timeout: 10 * time.Second}
+	defer client.CloseIdleConnections()
+
+	// send ping
+	resp, err := client.Get(fmt.Sprintf("http://localhost:%d/api/v1/ping", port))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "pong", string(body))
+
+	// try to login with good name
+	resp, err = client.Get(fmt.Sprintf("http://localhost:%d/auth/anonymous/login?user=blah123&aud=remark", port))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// try to add a comment as good anonymous
+	req, err := http.NewRequest("POST", fmt.Sprintf("http://localhost:%d/api/v1/comment?site=remark", port),
+		strings.NewReader(`{"text": "test 123", "locator":{"url": "https://radio-t.com/blah1", "site": "remark"}}`))
+	require.NoError(t, err)
+
+	tkn, claims := getAuthFromCookie(t, app, resp)
+	require.NotEmpty(t, tkn)
+	assert.False(t, claims.User.BoolAttr("blocked"), "should not be blocked")
+	req.Header.Add("X-JWT", tkn)
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	// try to login with non-latin name
+	time.Sleep(time.Second)
+	resp, err = client.Get(fmt.Sprintf("http://localhost:%d/auth/anonymous/login?user=Раз_Два%20%20Три_34567&aud=remark", port))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// try to login with bad name
+	time.Sleep(time.Second)
+	resp, err = client.Get(fmt.Sprintf("http://localhost:%d/auth/anonymous/login?user=**blah123&aud=remark", port))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// try to login with short name
+	time.Sleep(time.Second)
+	resp, err = client.Get(fmt.Sprintf("http://localhost:%d/auth/anonymous/login?user=bl%%20%%20&aud=remark", port))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// try to login with name what have space in prefix
+	time.Sleep(time.Second)
+	resp, err = client.Get(fmt.Sprintf("http://localhost:%d/auth/anonymous/login?user=%%20somebody&aud=remark", port))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// try to login with name what have space in suffix
+	time.Sleep(time.Second)
+	resp, err = client.Get(fmt.Sprintf("http://localhost:%d/auth/anonymous/login?user=somebody%%20&aud=remark", port))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// try to login with long name
+	time.Sleep(time.Second)
+	ln := strings.Repeat("x", 65)
+	resp, err = client.Get(fmt.Sprintf("http://localhost:%d/auth/anonymous/login?user=%s&aud=remark", port, ln))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// try to login with admin name
+	time.Sleep(time.Second)
+	resp, err = client.Get(fmt.Sprintf("http://localhost:%d/auth/anonymous/login?user=umpUtun&aud=remark", port))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// try to add a comment as anonymous with admin name
+	time.Sleep(time.Second)
+	req, err = http.NewRequest("POST", fmt.Sprintf("http://localhost:%d/api/v1/comment?site=remark", port),
+		strings.NewReader(`{"text": "test 123", "locator":{"url": "https://radio-t.com/blah1", "site": "remark"}}`))
+	require.NoError(t, err)
+
+	tkn, claims = getAuthFromCookie(t, app, resp)
+	require.NotEmpty(t, tkn)
+	assert.True(t, claims.User.BoolAttr("blocked"), "should be blocked")
+	req.Header.Add("X-JWT", tkn)
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	cancel()
+	app.Wait()
+}
+
+func getAuthFromCookie(t *testing.T, app *serverApp, resp *http.Response) (tkn string, claims token.Claims) {
+	var err error
+	for _, c := range resp.Cookies() {
+		if c.Name == "JWT" {
+			tkn = c.Value
+			claims, err = app.restSrv.Authenticator.TokenService().Parse(c.Value)
+			require.NoError(t, err)
+		}
+	}
+	return tkn, claims
+}
+
+func TestServerApp_WithSSL(t *testing.T) {
+	opts := ServerCommand{}
+	sslPort := chooseRandomUnusedPort()
+	opts.SetCommon(CommonOpts{RemarkURL: fmt.Sprintf("https://localhost:%d", sslPort), SharedSecret: "123456"})
+
+	// prepare options
+	p := flags.NewParser(&opts, flags.Default)
+	port := chooseRandomUnusedPort()
+	_, err := p.ParseArgs([]string{"--admin-passwd=password", "--port=" + strconv.Itoa(port), "--store.bolt.path=/tmp/xyz", "--backup=/tmp",
+		"--avatar.type=bolt", "--avatar.bolt.file=/tmp/ava-test.db",
+		"--ssl.type=static", "--ssl.cert=testdata/cert.pem", "--ssl.key=testdata/key.pem",
+		"--ssl.port=" + strconv.Itoa(sslPort), "--image.fs.path=/tmp"})
+	require.NoError(t, err)
+	defer os.Remove("/tmp/xyz")
+	defer os.Remove("/tmp/xyz/remark.db")
+	defer os.Remove("/tmp/ava-test.db")
+
+	// create app
+	app, err := opts.newServerApp(context.Background())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { _ = app.run(ctx) }()
+	waitForHTTPSServerStart(sslPort)
+
+	client := http.Client{
+		// prevent http redirect
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+
+		// allow self-signed certificate
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+	defer client.CloseIdleConnections()
+
+	// check http to https redirect response
+	resp, err := client.Get(fmt.Sprintf("http://localhost:%d/blah?param=1", port))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+	assert.Equal(t, fmt.Sprintf("https://localhost:%d/blah?param=1", sslPort), resp.Header.Get("Location"))
+
+	// check https server
+	resp, err = client.Get(fmt.Sprintf("https://localhost:%d/ping", sslPort))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "pong", string(body))
+
+	cancel()
+	app.Wait()
+}
+
+func TestServerApp_WithRemote(t *testing.T) {
+	opts := ServerCommand{}
+	opts.SetCommon(CommonOpts{RemarkURL: "https://demo.remark42.com", SharedSecret: "123456"})
+
+	// prepare options
+	p := flags.NewParser(&opts, flags.Default)
+	port := chooseRandomUnusedPort()
+	_, err := p.ParseArgs([]string{"--admin-passwd=password", "--cache.type=none",
+		"--store.type=rpc", "--store.rpc.api=http://127.0.0.1",
+		"--port=" + strconv.Itoa(port), "--avatar.fs.path=/tmp",
+		"--admin.type=rpc", "--admin.rpc.secret_per_site", "--admin.rpc.api=http://127.0.0.1", "--admin.rpc.breaker=0"})
+	require.NoError(t, err)
+	opts.Auth.Github.CSEC, opts.Auth.Github.CID = "csec", "cid"
+	opts.BackupLocation, opts.Image.FS.Path = "/tmp", "/tmp"
+
+	// create app
+	app, err := opts.newServerApp(context.Background())
+	require.NoError(t, err)
+	require.Len(t, opts.remotes, 2, "store and admin remote transports")
+	assert.Equal(t, "store", opts.remotes[0].Name)
+	assert.Equal(t, 2, opts.remotes[0].Retries)
+	assert.Equal(t, 100*time.Millisecond, opts.remotes[0].Backoff)
+	assert.Equal(t, 5, opts.remotes[0].Threshold)
+	assert.Equal(t, 30*time.Second, opts.remotes[0].Cooldown)
+	assert.Equal(t, "admin", opts.remotes[1].Name)
+	assert.Equal(t, 0, opts.remotes[1].Threshold)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { _ = app.run(ctx) }()
+	waitForHTTPServerStart(port)
+
+	// send ping
+	resp, err := http.Get(fmt.Sprintf("http://localhost:%d/api/v1/ping", port))
+	defer http.DefaultClient.CloseIdleConnections()
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "pong", string(body))
+
+	cancel()
+	app.Wait()
+}
+
+func TestServerApp_Failed(t *testing.T) {
+	opts := ServerCommand{}
+	opts.SetCommon(CommonOpts{RemarkURL: "https://demo.remark42.com", SharedSecret: "123456"})
+
+	p := flags.NewParser(&opts, flags.Default)
+
+	// RO bolt location
+	_, err := p.ParseArgs([]string{"--backup=/tmp", "--store.bolt.path=/dev/null", "--image.fs.path=/tmp"})
+	assert.NoError(t, err)
+	_, err = opts.newServerApp(context.Background())
+	assert.EqualError(t, err, "failed to make data store engine: failed to create bolt store: can't make directory /dev/null: mkdir /dev/null: not a directory")
+	t.Log(err)
+
+	// RO backup location
+	opts = ServerCommand{}
+	opts.SetCommon(CommonOpts{RemarkURL: "https://demo.remark42.com", SharedSecret: "123456"})
+
+	_, err = p.ParseArgs([]string{"--store.bolt.path=/tmp", "--backup=/dev/null/not-writable"})
+	assert.NoError(t, err)
+	defer os.Remove("/tmp/remark.db")
+	_, err = opts.newServerApp(context.Background())
+	assert.EqualError(t, err, "failed to create backup store: can't make directory /dev/null/not-writable: mkdir /dev/null: not a directory")
+	t.Log(err)
+
+	// invalid url
+	opts = ServerCommand{}
+	opts.SetCommon(CommonOpts{RemarkURL: "demo.remark42.com", SharedSecret: "123456"})
+
+	_, err = p.ParseArgs([]string{"--backup=/tmp", "----store.bolt.path=/tmp"})
+	assert.NoError(t, err)
+	_, err = opts.newServerApp(context.Background())
+	assert.EqualError(t, err, "invalid remark42 url demo.remark42.com")
+	t.Log(err)
+
+	// invalid trusted proxy CIDR fails fast, before any resource is created
+	opts = ServerCommand{}
+	opts.SetCommon(CommonOpts{RemarkURL: "https://demo.remark42.com", SharedSecret: "123456"})
+	p = flags.NewParser(&opts, flags.Default)
+	_, err = p.ParseArgs([]string{"--backup=/tmp", "--trusted-proxy=nonsense"})
+	assert.NoError(t, err)
+	_, err = opts.newServerApp(context.Background())
+	assert.EqualError(t, err, `invalid --trusted-proxy: invalid trusted proxy "nonsense"`)
+	t.Log(err)
+
+	// admin listen address without port
+	opts = ServerCommand{}
+	opts.SetCommon(CommonOpts{RemarkURL: "https://demo.remark42.com", SharedSecret: "123456"})
+	p = flags.NewParser(&opts, flags.Default)
+	_, err = p.ParseArgs([]string{"--backup=/tmp", "--admin-listen=127.0.0.1"})
+	assert.NoError(t, err)
+	_, err = opts.newServerApp(context.Background())
+	assert.EqualError(t, err, `invalid --admin-listen "127.0.0.1": address 127.0.0.1: missing port in address`)
+	t.Log(err)
+
+	opts = ServerCommand{}
+	opts.SetCommon(CommonOpts{RemarkURL: "https://demo.remark42.com", SharedSecret: "123456"})
+	p = flags.NewParser(&opts, flags.Default)
+	_, err = p.ParseArgs([]string{"--backup=/tmp", "--admin-listen=127.0.0.1:8081", "--ssl.admin-cert-required"})
+	assert.NoError(t, err)
+	_, err = opts.newServerApp(context.Background())
+	assert.EqualError(t, err, "admin client certificates can't be used with --admin-listen, admin server doesn't use tls")
+
+	opts = ServerCommand{}
+	opts.SetCommon(CommonOpts{RemarkURL: "https://demo.remark42.com", SharedSecret: "123456"})
+	p = flags.NewParser(&opts, flags.Default)
+	_, err = p.ParseArgs([]string{"--backup=/tmp", "--admin-listen=127.0.0.1:8081", "--admin-pprof"})
+	assert.NoError(t, err)
+	_, err = opts.newServerApp(context.Background())
+	assert.EqualError(t, err, "--admin-pprof requires --admin-listen and --admin-passwd, profiler and metrics are served to basic auth admin only")
+
+	// wrong store type
+	opts = ServerCommand{}
+	opts.SetCommon(CommonOpts{RemarkURL: "https://demo.remark42.com", SharedSecret: "123456"})
+
+	_, err = p.ParseArgs([]string{"--backup=/tmp", "--store.type=blah"})
+	assert.Error(t, err, "blah is invalid type")
+
+	opts.Store.Type = "blah"
+	_, err = opts.newServerApp(context.Background())
+	assert.EqualError(t, err, "failed to make data store engine: unsupported store type blah")
+	t.Log(err)
+
+	// invalid moderation expression
+	opts = ServerCommand{}
+	opts.SetCommon(CommonOpts{RemarkURL: "https://demo.remark42.com", SharedSecret: "123456"})
+	p = flags.NewParser(&opts, flags.Default)
+	_, err = p.ParseArgs([]string{"--store.bolt.path=/tmp", "--expr.moderation=comment.links + 1"})
+	assert.NoError(t, err)
+	_, err = opts.newServerApp(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to make expression policies: invalid default expression policy: invalid moderation expression")
+
+	// wrong redis location
+	opts = ServerCommand{}
+	opts.SetCommon(CommonOpts{RemarkURL: "https://demo.remark42.com", SharedSecret: "123456"})
+	p = flags.NewParser(&opts, flags.Default)
+	_, err = p.ParseArgs([]string{"--store.bolt.path=/tmp", "--cache.type=redis_pub_sub", "--cache.redis_addr=wrong_address"})
+	assert.NoError(t, err)
+	_, err = opts.newServerApp(context.Background())
+	assert.EqualError(t, err,
+		"failed to make cache: cache backend initialization, redis PubSub initialisation: "+
+			"problem subscribing to channel remark42-cache on address wrong_address: "+
+			"dial tcp: address wrong_address: missing port in address")
+	t.Log(err)
+
+	// wrong apple private key type
+	opts = ServerCommand{}
+	opts.SetCommon(CommonOpts{RemarkURL: "https://demo.remark42.com", SharedSecret: "123456"})
+	p = flags.NewParser(&opts, flags.Default)
+	_, err = p.ParseArgs([]string{"--auth.apple.cid=123", "--auth.apple.tid=123",
+		"--auth.apple.kid=123", "--auth.apple.private-key-filepath=testdata/apple-bad.p8"})
+	assert.NoError(t, err)
+	_, err = opts.newServerApp(context.Background())
+	assert.EqualError(t, err,
+		"failed to make authenticator: an AppleProvider creating failed: "+
+			"provided private key is not ECDSA")
+	t.Log(err)
+
+	// incomplete custom oauth config
+	opts = ServerCommand{}
+	opts.SetCommon(CommonOpts{RemarkURL: "https://demo.remark42.com", SharedSecret: "123456"})
+	p = flags.NewParser(&opts, flags.Default)
+	_, err = p.ParseArgs([]string{"--store.bolt.path=/tmp", "--backup=/tmp", "--image.fs.path=/tmp", "--auth.custom.name=oidc", "--auth.custom.cid=123"})
+	assert.NoError(t, err)
+	_, err = opts.newServerApp(context.Background())
+	assert.EqualError(t, err,
+		"failed to make authenticator: custom oauth provider configuration is incomplete, missing: "+
+			"AUTH_CUSTOM_CSEC, AUTH_CUSTOM_AUTH_URL, AUTH_CUSTOM_TOKEN_URL, AUTH_CUSTOM_INFO_URL")
+	t.Log(err)
+}
+
+func TestIsReservedCustomProviderName(t *testing.T) {
+	reserved := []string{
+		"email", "anonymous", "google", "github", "gitlab", "facebook", "yandex", "twitter",
+		"microsoft", "patreon", "discord", "telegram", "dev", "apple", "saml", "ldap", "mastodon",
+		"steam", "twitch", "reddit", "vk", "wechat", "webauthn", "sms",
+	}
+
+	for _, name := range reserved {
+		t.Run(name, func(t *testing.T) {
+			assert.True(t, isReservedCustomProviderName(name))
+		})
+	}
+
+	assert.False(t, isReservedCustomProviderName("oidc"))
+}
+
+func TestIsValidCustomProviderName(t *testing.T) {
+	valid := []string{"oidc", "codeberg", "provider_1", "provider-1", "a1"}
+	for _, name := range valid {
+		t.Run("valid_"+name, func(t *testing.T) {
+			assert.True(t, isValidCustomProviderName(name))
+		})
+	}
+
+	invalid := []string{"", " has-space", "has space", "Uppercase", "provider!", "-provider", "_provider"}
+	for _, name := range invalid {
+		t.Run("invalid_"+strings.ReplaceAll(name, " ", "_"), func(t *testing.T) {
+			assert.False(t, isValidCustomProviderName(name))
+		})
+	}
+}
+
+func TestCustomProviderSourceID(t *testing.T) {
+	cfg := CustomAuthGroup{IDField: "sub", EmailField: "email", NameField: "name", PictureField: "picture"}
+
+	assert.Equal(t, "user-1", customProviderSourceID(provider.UserData{"sub": "user-1", "email": "a@example.com"}, cfg))
+	assert.Equal(t, "a@example.com", customProviderSourceID(provider.UserData{"email": "a@example.com"}, cfg))
+	assert.Equal(t, "alice", customProviderSourceID(provider.UserData{"name": "alice"}, cfg))
+	assert.Equal(t, "https://example.com/avatar.png", customProviderSourceID(provider.UserData{"picture": "https://example.com/avatar.png"}, cfg))
+	assert.Equal(t, `{"login":"alice"}`, customProviderSourceID(provider.UserData{"login": "alice"}, cfg))
+	assert.Equal(t, "{}", customProviderSourceID(provider.UserData{}, cfg))
+}
+
+func TestServerApp_InvalidCustomOAuthProviderName(t *testing.T) {
+	baseArgs := []string{
+		"--store.bolt.path=/tmp",
+		"--backup=/tmp",
+		"--image.fs.path=/tmp",
+		"--auth.custom.cid=123",
+		"--auth.custom.csec=456",
+		"--auth.custom.auth-url=https://example.com/oauth2/authorize",
+		"--auth.custom.token-url=https://example.com/oauth2/token",
+		"--auth.custom.info-url=https://example.com/oauth2/userinfo",
+	}
+
+	t.Run("reserved", func(t *testing.T) {
+		opts := ServerCommand{}
+		opts.SetCommon(CommonOpts{RemarkURL: "https://demo.remark42.com", SharedSecret: "123456"})
+		p := flags.NewParser(&opts, flags.Default)
+		_, err := p.ParseArgs(append(baseArgs, "--auth.custom.name=twitter"))
+		require.NoError(t, err)
+
+		_, err = opts.newServerApp(context.Background())
+		assert.EqualError(t, err, `failed to make authenticator: custom oauth provider name "twitter" is reserved`)
+	})
+
+	t.Run("not_url_safe", func(t *testing.T) {
+		opts := ServerCommand{}
+		opts.SetCommon(CommonOpts{RemarkURL: "https://demo.remark42.com", SharedSecret: "123456"})
+		p := flags.NewParser(&opts, flags.Default)
+		_, err := p.ParseArgs(append(baseArgs, "--auth.custom.name=bad name"))
+		require.NoError(t, err)
+
+		_, err = opts.newServerApp(context.Background())
+		assert.EqualError(t, err, `failed to make authenticator: custom oauth provider name "bad name" is invalid, expected pattern "^[a-z0-9][a-z0-9_-]*$"`)
+	})
+}
+
+func TestServerApp_Shutdown(t *testing.T) {
+	app, ctx, cancel := prepServerApp(t, func(o ServerCommand) ServerCommand {
+		o.Port = chooseRandomUnusedPort()
+		return o
+	})
+	time.AfterFunc(100*time.Millisecond, func() {
+		cancel()
+	})
+	st := time.Now()
+	err := app.run(ctx)
+	assert.NoError(t, err)
+	assert.True(t, time.Since(st).Seconds() < 1, "should take about 100msec")
+	app.Wait()
+}
+
+func TestServerApp_MainSignal(t *testing.T) {
+	done := make(chan struct{})
+	go func() {
+		<-done
+		time.Sleep(250 * time.Millisecond)
+		err := syscall.Kill(syscall.Getpid(), syscall.SIGTERM)
+		require.NoError(t, err)
+	}()
+
+	s := ServerCommand{}
+	s.SetCommon(CommonOpts{RemarkURL: "https://demo.remark42.com", SharedSecret: "123456"})
+
+	p := flags.NewParser(&s, flags.Default)
+	port := chooseRandomUnusedPort()
+	args := []string{"test", "--store.bolt.path=/tmp/xyz", "--backup=/tmp", "--avatar.type=bolt",
+		"--avatar.bolt.file=/tmp/ava-test.db", "--port=" + strconv.Itoa(port), "--image.fs.path=/tmp"}
+	defer os.Remove("/tmp/xyz")
+	defer os.Remove("/tmp/xyz/remark.db")
+	defer os.Remove("/tmp/ava-test.db")
+	_, err := p.ParseArgs(args)
+	require.NoError(t, err)
+	st := time.Now()
+	close(done)
+	err = s.Execute(args)
+	assert.NoError(t, err, "execute should be without errors")
+	assert.True(t, time.Since(st).Seconds() < 5, "should take under five sec", time.Since(st).Seconds())
+}
+
+func TestServerApp_RunCanceledBeforeRESTStart(t *testing.T) {
+	port := chooseRandomUnusedPort()
+	app, ctx, cancel := prepServerApp(t, func(o ServerCommand) ServerCommand {
+		o.Port = port
+		return o
+	})
+	cancel()
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- app.run(ctx) }()
+
+	select {
+	case err := <-errCh:
+		require.NoError(t, err)
+		app.Wait()
+	case <-time.After(time.Second):
+		waitForHTTPServerStart(port)
+		app.restSrv.Shutdown()
+		select {
+		case <-errCh:
+			app.Wait()
+		case <-time.After(time.Second):
+			t.Fatal("server app did not stop after forced REST shutdown")
+		}
+		t.Fatal("server app should exit when context is canceled before REST server starts")
+	}
+}
 
 func TestServerApp_DeprecatedArgs(t *testing.T) {
 	s := ServerCommand{}
 	s.SetCommon(CommonOpts{RemarkURL: "https://demo.remark42.com", SharedSecret: "123456"})
 
-	p := flags.NewParser(&s, flags.Default)
-	args := []string{
-		"test",
-		"--notify.type=email",
-		"--notify.type=telegram",
-		"--notify.users=none",
-		"--notify.admins=none",
-		"--img-proxy",
-		"--notify.email.notify_admin",
-		"--auth.email.host=smtp.example.org",
-		"--auth.email.port=666",
-		"--auth.email.tls",
-		"--auth.email.user=test_user",
-		"--auth.email.passwd=test_password",
-		"--auth.email.timeout=15s",
-		"--auth.email.template=file.tmpl",
-		"--notify.telegram.token=abcd",
-		"--notify.telegram.timeout=3m",
-		"--notify.telegram.api=http://example.org",
-		"--auth.twitter.cid=123",
-		"--auth.twitter.csec=456",
+	p := flags.NewParser(&s, flags.Default)
+	args := []string{
+		"test",
+		"--notify.type=email",
+		"--notify.type=telegram",
+		"--notify.users=none",
+		"--notify.admins=none",
+		"--img-proxy",
+		"--notify.email.notify_admin",
+		"--auth.email.host=smtp.example.org",
+		"--auth.email.port=666",
+		"--auth.email.tls",
+		"--auth.email.user=test_user",
+		"--auth.email.passwd=test_password",
+		"--auth.email.timeout=15s",
+		"--auth.email.template=file.tmpl",
+		"--notify.telegram.token=abcd",
+		"--notify.telegram.timeout=3m",
+		"--notify.telegram.api=http://example.org",
+		"--auth.twitter.cid=123",
+		"--auth.twitter.csec=456",
+	}
+	assert.Empty(t, s.SMTP.Host)
+	assert.Empty(t, s.SMTP.Port)
+	assert.Empty(t, s.SMTP.TLS)
+	assert.Empty(t, s.SMTP.Username)
+	assert.Empty(t, s.SMTP.Password)
+	assert.Empty(t, s.SMTP.TimeOut)
+	_, err := p.ParseArgs(args)
+	require.NoError(t, err)
+	deprecatedFlags := s.HandleDeprecatedFlags()
+	assert.ElementsMatch(t,
+		[]DeprecatedFlag{
+			{Old: "auth.email.host", New: "smtp.host", Version: "1.5"},
+			{Old: "auth.email.port", New: "smtp.port", Version: "1.5"},
+			{Old: "auth.email.tls", New: "smtp.tls", Version: "1.5"},
+			{Old: "auth.email.user", New: "smtp.username", Version: "1.5"},
+			{Old: "auth.email.passwd", New: "smtp.password", Version: "1.5"},
+			{Old: "auth.email.timeout", New: "smtp.timeout", Version: "1.5"},
+			{Old: "auth.email.template", Version: "1.5"},
+			{Old: "img-proxy", New: "image-proxy.http2https", Version: "1.5"},
+			{Old: "notify.email.notify_admin", New: "notify.admins=email", Version: "1.9"},
+			{Old: "notify.type", New: "notify.(users|admins)", Version: "1.9"},
+			{Old: "notify.telegram.token", New: "telegram.token", Version: "1.9"},
+			{Old: "notify.telegram.timeout", New: "telegram.timeout", Version: "1.9"},
+			{Old: "notify.telegram.api", Version: "1.9"},
+			{Old: "auth.twitter.cid", Version: "1.14"},
+			{Old: "auth.twitter.csec", Version: "1.14"},
+		},
+		deprecatedFlags)
+	assert.Equal(t, "smtp.example.org", s.SMTP.Host)
+	assert.Equal(t, 666, s.SMTP.Port)
+	assert.Equal(t, true, s.SMTP.TLS)
+	assert.Equal(t, "test_user", s.SMTP.Username)
+	assert.Equal(t, "test_password", s.SMTP.Password)
+	assert.Equal(t, 15*time.Second, s.SMTP.TimeOut)
+}
+
+func TestServerApp_DeprecatedArgsCollisions(t *testing.T) {
+	s := ServerCommand{}
+	s.SetCommon(CommonOpts{RemarkURL: "https://demo.remark42.com", SharedSecret: "123456"})
+
+	p := flags.NewParser(&s, flags.Default)
+	args := []string{
+		"test",
+		"--auth.email.host=smtp-old.example.org",
+		"--smtp.host=smtp-new.example.org",
+		"--auth.email.port=666",
+		"--smtp.port=999",
+		"--auth.email.user=test_user",
+		"--smtp.username=new_test_user",
+		"--auth.email.passwd=test_password",
+		"--smtp.password=new_test_password",
+		"--auth.email.timeout=15s",
+		"--smtp.timeout=20s",
+		"--notify.type=telegram",
+		"--notify.users=telegram",
+		"--notify.admins=none",
+		"--notify.telegram.token=abcd",
+		"--telegram.token=dcba",
+		"--notify.telegram.timeout=3m",
+		"--telegram.timeout=5m",
+	}
+	_, err := p.ParseArgs(args)
+	require.NoError(t, err)
+	deprecatedFlagsCollisions := s.findDeprecatedFlagsCollisions()
+	assert.ElementsMatch(t,
+		[]DeprecatedFlag{
+			{Old: "notify.type", New: "notify.(users|admins)", Collision: true},
+			{Old: "auth.email.host", New: "smtp.host", Collision: true},
+			{Old: "auth.email.port", New: "smtp.port", Collision: true},
+			{Old: "auth.email.user", New: "smtp.username", Collision: true},
+			{Old: "auth.email.passwd", New: "smtp.password", Collision: true},
+			{Old: "auth.email.timeout", New: "smtp.timeout", Collision: true},
+			{Old: "notify.telegram.token", New: "telegram.token", Collision: true},
+			{Old: "notify.telegram.timeout", New: "telegram.timeout", Collision: true},
+		},
+		deprecatedFlagsCollisions)
+
+	// case which should return nothing
+	s = ServerCommand{}
+	s.SetCommon(CommonOpts{RemarkURL: "https://demo.remark42.com", SharedSecret: "123456"})
+	p = flags.NewParser(&s, flags.Default)
+	args = []string{
+		"test",
+		"--auth.email.host=smtp-old.example.org",
+		"--smtp.host=''",
+	}
+	_, err = p.ParseArgs(args)
+	require.NoError(t, err)
+	deprecatedFlagsCollisions = s.findDeprecatedFlagsCollisions()
+	assert.Empty(t, []DeprecatedFlag{}, deprecatedFlagsCollisions)
+}
+
+func Test_ACMEEmail(t *testing.T) {
+	cmd := ServerCommand{}
+	cmd.SetCommon(CommonOpts{RemarkURL: "https://remark.com:443", SharedSecret: "123456"})
+	p := flags.NewParser(&cmd, flags.Default)
+	args := []string{"--ssl.type=auto"}
+	_, err := p.ParseArgs(args)
+	require.NoError(t, err)
+	cfg, err := cmd.makeSSLConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "admin@remark.com", cfg.ACMEEmail)
+
+	cmd = ServerCommand{}
+	cmd.SetCommon(CommonOpts{RemarkURL: "https://remark.com", SharedSecret: "123456"})
+	p = flags.NewParser(&cmd, flags.Default)
+	args = []string{"--ssl.type=auto", "--ssl.acme-email=adminname@adminhost.com"}
+	_, err = p.ParseArgs(args)
+	require.NoError(t, err)
+	cfg, err = cmd.makeSSLConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "adminname@adminhost.com", cfg.ACMEEmail)
+
+	cmd = ServerCommand{}
+	cmd.SetCommon(CommonOpts{RemarkURL: "https://remark.com", SharedSecret: "123456"})
+	p = flags.NewParser(&cmd, flags.Default)
+	args = []string{"--ssl.type=auto", "--admin.type=shared", "--admin.shared.email=superadmin@admin.com"}
+	_, err = p.ParseArgs(args)
+	require.NoError(t, err)
+	cfg, err = cmd.makeSSLConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "superadmin@admin.com", cfg.ACMEEmail)
+
+	cmd = ServerCommand{}
+	cmd.SetCommon(CommonOpts{RemarkURL: "https://remark.com:443", SharedSecret: "123456"})
+	p = flags.NewParser(&cmd, flags.Default)
+	args = []string{"--ssl.type=auto", "--admin.type=shared"}
+	_, err = p.ParseArgs(args)
+	require.NoError(t, err)
+	cfg, err = cmd.makeSSLConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "admin@remark.com", cfg.ACMEEmail)
+}
+
+func Test_makeSSLConfigClientCA(t *testing.T) {
+	cmd := ServerCommand{}
+	cmd.SSL = SSLGroup{Type: "static", Cert: "testdata/cert.pem", Key: "testdata/key.pem", ClientCA: "testdata/cert.pem"}
+	cfg, err := cmd.makeSSLConfig()
+	require.NoError(t, err)
+	assert.NotNil(t, cfg.ClientCAs)
+
+	cmd.SSL.ClientCA = "testdata/key.pem"
+	_, err = cmd.makeSSLConfig()
+	assert.EqualError(t, err, "no client ca certificates in testdata/key.pem")
+
+	cmd.SSL.ClientCA = "testdata/no-such-file.pem"
+	_, err = cmd.makeSSLConfig()
+	assert.ErrorContains(t, err, "failed to read client ca certificates")
+
+	cmd.SSL = SSLGroup{Type: "none", ClientCA: "testdata/cert.pem"}
+	_, err = cmd.makeSSLConfig()
+	assert.EqualError(t, err, "client certificates require ssl type static or auto")
+}
+
+func Test_makeSSLConfigHTTP3(t *testing.T) {
+	cmd := ServerCommand{}
+	cmd.SSL = SSLGroup{Type: "static", Cert: "testdata/cert.pem", Key: "testdata/key.pem", HTTP3: true}
+	cfg, err := cmd.makeSSLConfig()
+	require.NoError(t, err)
+	assert.True(t, cfg.HTTP3)
+
+	cmd.SSL = SSLGroup{Type: "none", HTTP3: true}
+	_, err = cmd.makeSSLConfig()
+	assert.EqualError(t, err, "http3 requires ssl type static or auto")
+}
+
+func Test_makeListener(t *testing.T) {
+	s := ServerCommand{SSL: SSLGroup{Type: "none"}, UnixSocketMode: "0660"}
+	listener, err := s.makeListener()
+	require.NoError(t, err)
+	assert.Nil(t, listener, "address and port used")
+
+	// stale socket of previous run replaced
+	sock := filepath.Join(t.TempDir(), "remark42.sock")
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: sock, Net: "unix"})
+	require.NoError(t, err)
+	stale.SetUnlinkOnClose(false)
+	require.NoError(t, stale.Close())
+
+	s.UnixSocket = sock
+	listener, err = s.makeListener()
+	require.NoError(t, err)
+	defer listener.Close()
+	fi, err := os.Stat(sock)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o660), fi.Mode().Perm())
+
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { _, _ = w.Write([]byte("ok")) }),
+		ReadHeaderTimeout: time.Second}
+	go func() { _ = srv.Serve(listener) }()
+	defer srv.Close()
+	client := http.Client{Transport: &http.Transport{DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, "unix", sock)
+	}}}
+	resp, err := client.Get("http://remark42/ping")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, "ok", string(body))
+
+	s = ServerCommand{SSL: SSLGroup{Type: "none"}, UnixSocket: filepath.Join(t.TempDir(), "bad.sock"), UnixSocketMode: "0999"}
+	_, err = s.makeListener()
+	assert.EqualError(t, err, `invalid unix socket mode "0999"`)
+
+	s = ServerCommand{SSL: SSLGroup{Type: "static"}, UnixSocket: sock}
+	_, err = s.makeListener()
+	assert.EqualError(t, err, "unix socket and socket activation require ssl type none")
+
+	s = ServerCommand{SSL: SSLGroup{Type: "none"}, UnixSocket: sock, SocketActivation: true}
+	_, err = s.makeListener()
+	assert.EqualError(t, err, "unix socket can't be used with socket activation")
+
+	// sockets passed to another process
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	t.Setenv("LISTEN_FDS", "1")
+	s = ServerCommand{SSL: SSLGroup{Type: "none"}, SocketActivation: true}
+	_, err = s.makeListener()
+	assert.EqualError(t, err, "no sockets passed by systemd")
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "0")
+	_, err = s.makeListener()
+	assert.EqualError(t, err, "no sockets passed by systemd")
+}
+
+func Test_makeAdminCertPolicy(t *testing.T) {
+	cmd := ServerCommand{}
+	policy, err := cmd.makeAdminCertPolicy()
+	require.NoError(t, err)
+	assert.Equal(t, api.AdminCertPolicy{Users: map[string]string{}}, policy)
+
+	cmd.SSL = SSLGroup{ClientCA: "testdata/cert.pem", AdminCertRequire: true, AdminCertUsers: []string{"ops:github_ops", " backup bot : email_bot "}}
+	policy, err = cmd.makeAdminCertPolicy()
+	require.NoError(t, err)
+	assert.Equal(t, api.AdminCertPolicy{Required: true, Users: map[string]string{"ops": "github_ops", "backup bot": "email_bot"}}, policy)
+
+	cmd.SSL.AdminCertUsers = []string{"ops"}
+	_, err = cmd.makeAdminCertPolicy()
+	assert.EqualError(t, err, `bad admin certificate user "ops", expected cn:user_id`)
+
+	cmd.SSL = SSLGroup{AdminCertRequire: true}
+	_, err = cmd.makeAdminCertPolicy()
+	assert.EqualError(t, err, "admin client certificates require ssl.client-ca")
+}
+
+func TestServerAuthHooks(t *testing.T) {
+	port := chooseRandomUnusedPort()
+	app, ctx, cancel := prepServerApp(t, func(o ServerCommand) ServerCommand {
+		o.Port = port
+		return o
+	})
+
+	go func() { _ = app.run(ctx) }()
+	waitForHTTPServerStart(port)
+
+	// make a token for user dev
+	tkService := app.restSrv.Authenticator.TokenService()
+	tkService.TokenDuration = time.Second
+
+	claims := token.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{"remark"},
+			Issuer:    "remark",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Second)),
+			NotBefore: jwt.NewNumericDate(time.Now().Add(-1 * time.Minute)),
+		},
+		User: &token.User{
+			ID:   "github_dev",
+			Name: "developer one",
+		},
+	}
+	tk, err := tkService.Token(claims)
+	require.NoError(t, err)
+	t.Log(tk)
+
+	client := http.Client{Timeout: 10 * time.Second}
+	defer client.CloseIdleConnections()
+
+	// add comment
+	req, err := http.NewRequest("POST", fmt.Sprintf("http://localhost:%d/api/v1/comment?site=remark", port),
+		strings.NewReader(`{"text": "test 123", "locator":{"url": "https://radio-t.com/p/2018/12/29/podcast-630/", "site": "remark"}}`))
+	require.NoError(t, err)
+	req.Header.Set("X-JWT", tk)
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusCreated, resp.StatusCode, "non-blocked user able to post")
+
+	// try to add comment with no-aud claim
+	badClaimsNoAud := claims
+	badClaimsNoAud.Audience = jwt.ClaimStrings{""}
+	tkNoAud, err := tkService.Token(badClaimsNoAud)
+	require.NoError(t, err)
+	t.Logf("no-aud claims: %s", tkNoAud)
+	req, err = http.NewRequest("POST", fmt.Sprintf("http://localhost:%d/api/v1/comment?site=remark", port),
+		strings.NewReader(`{"text": "test 123", "locator":{"url": "https://radio-t.com/p/2018/12/29/podcast-631/",
+	"site": "remark"}}`))
+	require.NoError(t, err)
+	req.Header.Set("X-JWT", tkNoAud)
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "user without aud claim rejected, \n"+tkNoAud+"\n"+string(body))
+
+	// try to add comment with multiple auds
+	badClaimsMultipleAud := claims
+	badClaimsMultipleAud.Audience = jwt.ClaimStrings{"remark", "second_aud"}
+	tkMultipleAuds, err := tkService.Token(badClaimsMultipleAud)
+	require.NoError(t, err)
+	t.Logf("multiple aud claims: %s", tkMultipleAuds)
+	req, err = http.NewRequest("POST", fmt.Sprintf("http://localhost:%d/api/v1/comment?site=remark", port),
+		strings.NewReader(`{"text": "test 123", "locator":{"url": "https://radio-t.com/p/2018/12/29/podcast-631/",
+	"site": "remark"}}`))
+	require.NoError(t, err)
+	req.Header.Set("X-JWT", tkMultipleAuds)
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	body, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "user with multiple auds claim rejected, \n"+tkMultipleAuds+"\n"+string(body))
+
+	// try to add comment without user set
+	badClaimsNoUser := claims
+	badClaimsNoUser.Audience = jwt.ClaimStrings{"remark"}
+	badClaimsNoUser.User = nil
+	tkNoUser, err := tkService.Token(badClaimsNoUser)
+	require.NoError(t, err)
+	t.Logf("no user claims: %s", tkNoUser)
+	req, err = http.NewRequest("POST", fmt.Sprintf("http://localhost:%d/api/v1/comment?site=remark", port),
+		strings.NewReader(`{"text": "test 123", "locator":{"url": "https://radio-t.com/p/2018/12/29/podcast-631/",
+	"site": "remark"}}`))
+	require.NoError(t, err)
+	req.Header.Set("X-JWT", tkNoUser)
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	body, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "user without user information rejected, \n"+tkNoUser+"\n"+string(body))
+
+	// block user github_dev as admin
+	req, err = http.NewRequest(http.MethodPut,
+		fmt.Sprintf("http://localhost:%d/api/v1/admin/user/github_dev?site=remark&block=1&ttl=10d", port), http.NoBody)
+	assert.NoError(t, err)
+	req.SetBasicAuth("admin", "password")
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "user github_dev blocked")
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	t.Log(string(b))
+
+	// try add a comment with blocked user
+	req, err = http.NewRequest("POST", fmt.Sprintf("http://localhost:%d/api/v1/comment?site=remark", port),
+		strings.NewReader(`{"text": "test 123 blah", "locator":{"url": "https://radio-t.com/blah1", "site": "remark"}}`))
+	require.NoError(t, err)
+	req.Header.Set("X-JWT", tk)
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	body, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.True(t, resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusUnauthorized,
+		"blocked user can't post, \n"+tk+"\n"+string(body))
+
+	cancel()
+	app.Wait()
+	client.CloseIdleConnections()
+}
+
+func TestServerAuthRevokedTokens(t *testing.T) {
+	port := chooseRandomUnusedPort()
+	app, ctx, cancel := prepServerApp(t, func(o ServerCommand) ServerCommand {
+		o.Port = port
+		o.Auth.PreviousSecret = "old secret"
+		return o
+	})
+
+	go func() { _ = app.run(ctx) }()
+	waitForHTTPServerStart(port)
+
+	tkService := app.restSrv.Authenticator.TokenService()
+	oldService := token.NewService(tkService.Opts)
+	oldService.SecretReader = token.SecretFunc(func(string) (string, error) { return "old secret", nil })
+	makeTokenWith := func(ts *token.Service, issued time.Time) string {
+		tk, err := ts.Token(token.Claims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Audience:  jwt.ClaimStrings{"remark"},
+				Issuer:    "remark",
+				IssuedAt:  jwt.NewNumericDate(issued),
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			},
+			User: &token.User{ID: "github_dev", Name: "developer one"},
+		})
+		require.NoError(t, err)
+		return tk
+	}
+	makeToken := func(issued time.Time) string { return makeTokenWith(tkService, issued) }
+
+	client := http.Client{Timeout: 10 * time.Second}
+	defer client.CloseIdleConnections()
+	getUser := func(tk string) int {
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:%d/api/v1/user?site=remark", port), http.NoBody)
+		require.NoError(t, err)
+		req.Header.Set("X-JWT", tk)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp.StatusCode
+	}
+
+	oldToken := makeToken(time.Now().Add(-time.Hour))
+	assert.Equal(t, http.StatusOK, getUser(oldToken))
+	rotatedToken := makeTokenWith(oldService, time.Now().Add(-time.Hour)) // signed with the previous secret
+	assert.Equal(t, http.StatusOK, getUser(rotatedToken))
+
+	// log out github_dev everywhere as admin
+	req, err := http.NewRequest(http.MethodPost,
+		fmt.Sprintf("http://localhost:%d/api/v1/admin/user/github_dev/logout?site=remark", port), http.NoBody)
+	require.NoError(t, err)
+	req.SetBasicAuth("admin", "password")
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	assert.Equal(t, http.StatusUnauthorized, getUser(oldToken), "token issued before revocation rejected")
+	assert.Equal(t, http.StatusUnauthorized, getUser(rotatedToken), "re-signed token of the previous secret rejected")
+	assert.Equal(t, http.StatusOK, getUser(makeToken(time.Now())), "new login accepted")
+
+	noID, err := tkService.Token(token.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Audience: jwt.ClaimStrings{"remark"}, Issuer: "remark",
+			IssuedAt: jwt.NewNumericDate(time.Now()), ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))},
+		User: &token.User{Name: "no id"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, getUser(noID), "user without id rejected")
+
+	cancel()
+	app.Wait()
+	client.CloseIdleConnections()
+}
+
+func TestServerCommand_parseSameSite(t *testing.T) {
+	tbl := []struct {
+		inp string
+		res http.SameSite
+	}{
+		{"", http.SameSiteDefaultMode},
+		{"default", http.SameSiteDefaultMode},
+		{"blah", http.SameSiteDefaultMode},
+		{"none", http.SameSiteNoneMode},
+		{"lax", http.SameSiteLaxMode},
+		{"strict", http.SameSiteStrictMode},
+	}
+
+	cmd := ServerCommand{}
+	for i, tt := range tbl {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			assert.Equal(t, tt.res, cmd.parseSameSite(tt.inp))
+		})
+	}
+}
+
+func Test_splitAtCommas(t *testing.T) {
+	tbl := []struct {
+		inp string
+		res []string
+	}{
+		{"a string", []string{"a string"}},
+		{"vv1, vv2, vv3", []string{"vv1", "vv2", "vv3"}},
+		{`"vv1, blah", vv2, vv3`, []string{"vv1, blah", "vv2", "vv3"}},
+		{
+			`Access-Control-Allow-Headers:"DNT,X-CustomHeader,Keep-Alive,User-Agent,X-Requested-With,If-Modified-Since,Cache-Control,Content-Type",header123:val, foo:"bar1,bar2"`,
+			[]string{"Access-Control-Allow-Headers:\"DNT,X-CustomHeader,Keep-Alive,User-Agent,X-Requested-With,If-Modified-Since,Cache-Control,Content-Type\"", "header123:val", "foo:\"bar1,bar2\""},
+		},
+		{"", []string{}},
+	}
+
+	for i, tt := range tbl {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			assert.Equal(t, tt.res, splitAtCommas(tt.inp))
+		})
 	}
-	assert.Empty(t, s.SMTP.Host)
-	assert.Empty(t, s.SMTP.Port)
-	assert.Empty(t, s.SMTP.TLS)
-	assert.Empty(t, s.SMTP.Username)
-	assert.Empty(t, s.SMTP.Password)
-	assert.Empty(t, s.SMTP.TimeOut)
-	_, err := p.ParseArgs(args)
+}
+
+func Test_getAllowedDomains(t *testing.T) {
+	tbl := []struct {
+		s              ServerCommand
+		allowedDomains []string
+	}{
+		// correct example, parsed and returned as allowed domain
+		{ServerCommand{AllowedHosts: []string{}, CommonOpts: CommonOpts{RemarkURL: "https://remark42.example.org"}}, []string{"example.org"}},
+		{ServerCommand{AllowedHosts: []string{}, CommonOpts: CommonOpts{RemarkURL: "http://remark42.example.org"}}, []string{"example.org"}},
+		{ServerCommand{AllowedHosts: []string{}, CommonOpts: CommonOpts{RemarkURL: "http://localhost"}}, []string{"localhost"}},
+		// incorrect URLs, so Hostname is empty but returned list doesn't include empty string as it would allow any domain
+		{ServerCommand{AllowedHosts: []string{}, CommonOpts: CommonOpts{RemarkURL: "bad hostname"}}, []string{}},
+		{ServerCommand{AllowedHosts: []string{}, CommonOpts: CommonOpts{RemarkURL: "not_a_hostname"}}, []string{}},
+		// test removal of 'self', multiple AllowedHosts. No deduplication is expected
+		{ServerCommand{AllowedHosts: []string{"'self'", "example.org", "test.example.org", "remark42.com"}, CommonOpts: CommonOpts{RemarkURL: "https://example.org"}}, []string{"example.org", "test.example.org", "remark42.com", "example.org"}},
+	}
+	for i, tt := range tbl {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			assert.Equal(t, tt.allowedDomains, tt.s.getAllowedDomains())
+		})
+	}
+}
+
+func Test_languagePolicy(t *testing.T) {
+	s := ServerCommand{Lang: LangGroup{Allowed: []string{"en", "de"}, Reject: true,
+		RestrictedWords: []string{"en:spam", " DE : schrott ", "en:scam", "bad", ":empty", "ru:"}}}
+	policy := s.languagePolicy()
+	assert.Equal(t, []string{"en", "de"}, policy.Allowed)
+	assert.True(t, policy.Reject)
+	assert.Equal(t, map[string][]string{"en": {"spam", "scam"}, "de": {"schrott"}}, policy.RestrictedWords)
+}
+
+func Test_voteWeights(t *testing.T) {
+	s := ServerCommand{Levels: LevelsGroup{VoteWeights: []string{"verified:2", " New : 0.5 ", "trusted:-1", "admin:3", "member", "member:x"}}}
+	assert.Equal(t, service.VoteWeights{store.LevelVerified: 2, store.LevelNew: 0.5}, s.voteWeights())
+}
+
+func Test_makeBrigades(t *testing.T) {
+	s := ServerCommand{Brigade: BrigadeGroup{Window: 10 * time.Minute, Votes: 5, Period: time.Minute}}
+	d, err := s.makeBrigades()
 	require.NoError(t, err)
-	deprecatedFlags := s.HandleDeprecatedFlags()
-	assert.ElementsMatch(t,
-		[]DeprecatedFlag{
-			{Old: "auth.email.host", New: "smtp.host", Version: "1.5"},
-			{Old: "auth.email.port", New: "smtp.port", Version: "1.5"},
-			{Old: "auth.email.tls", New: "smtp.tls", Version: "1.5"},
-			{Old: "auth.email.user", New: "smtp.username", Version: "1.5"},
-			{Old: "auth.email.passwd", New: "smtp.password", Version: "1.5"},
-			{Old: "auth.email.timeout", New: "smtp.timeout", Version: "1.5"},
-			{Old: "auth.email.template", Version: "1.5"},
-			{Old: "img-proxy", New: "image-proxy.http2https", Version: "1.5"},
-			{Old: "notify.email.notify_admin", New: "notify.admins=email", Version: "1.9"},
-			{Old: "notify.type", New: "notify.(users|admins)", Version: "1.9"},
-			{Old: "notify.telegram.token", New: "telegram.token", Version: "1.9"},
-			{Old: "notify.telegram.timeout", New: "telegram.timeout", Version: "1.9"},
-			{Old: "notify.telegram.api", Version: "1.9"},
-			{Old: "auth.twitter.cid", Version: "1.14"},
-			{Old: "auth.twitter.csec", Version: "1.14"},
-		},
-		deprecatedFlags)
-	assert.Equal(t, "smtp.example.org", s.SMTP.Host)
-	assert.Equal(t, 666, s.SMTP.Port)
-	assert.Equal(t, true, s.SMTP.TLS)
-	assert.Equal(t, "test_user", s.SMTP.Username)
-	assert.Equal(t, "test_password", s.SMTP.Password)
-	assert.Equal(t, 15*time.Second, s.SMTP.TimeOut)
+	assert.Nil(t, d, "disabled")
+
+	s.Brigade.Enabled = true
+	d, err = s.makeBrigades()
+	require.NoError(t, err)
+	require.NotNil(t, d)
+	assert.Equal(t, 10*time.Minute, d.Window)
+	assert.Equal(t, 5, d.MinVotes)
+
+	s.Brigade.Votes = 1
+	_, err = s.makeBrigades()
+	require.EqualError(t, err, "brigade votes 1, should be at least 2")
+
+	s.Brigade.Votes, s.Brigade.Period = 5, 0
+	_, err = s.makeBrigades()
+	require.EqualError(t, err, "brigade window 10m0s and period 0s should be positive")
 }
 
-func TestServerApp_DeprecatedArgsCollisions(t *testing.T) {
+func Test_collapsePolicy(t *testing.T) {
+	s := ServerCommand{CollapseMode: "off", CollapseScore: -5}
+	assert.Equal(t, service.CollapsePolicy{Mode: service.CollapseOff, Threshold: -5}, s.collapsePolicy())
+	s.CollapseMode = "hide"
+	assert.Equal(t, service.CollapsePolicy{Mode: service.CollapseHide, Threshold: -5}, s.collapsePolicy())
+}
+
+func Test_securityHeaders(t *testing.T) {
+	s := ServerCommand{CSP: CSPGroup{SiteAncestors: []string{"blog:https://blog.example.com", " blog : 'self' ",
+		"news:https://news.example.com:8443", "bad", ":https://empty.example.com", "site:"}, ReferrerPolicy: "no-referrer"}}
+	res := s.securityHeaders()
+	assert.Equal(t, map[string][]string{"blog": {"https://blog.example.com", "'self'"}, "news": {"https://news.example.com:8443"}},
+		res.SiteAncestors)
+	assert.Equal(t, "no-referrer", res.ReferrerPolicy)
+	assert.Empty(t, res.PermissionsPolicy)
+	assert.Empty(t, res.ReportURI)
+	assert.Empty(t, res.ImgSources)
+
+	s.ImageProxy = ImageProxyGroup{CDNOrigin: true, CDNURL: "https://cdn.example.com/"}
+	assert.Equal(t, []string{"https://cdn.example.com"}, s.securityHeaders().ImgSources)
+
+	assert.Nil(t, s.makeCSPReports())
+	s.CSP.Report = true
+	assert.NotNil(t, s.makeCSPReports())
+}
+
+func Test_makeCORSPolicies(t *testing.T) {
+	s := ServerCommand{CORS: CORSGroup{Origins: []string{"*"}, MaxAge: 300, SiteOrigins: []string{"blog:https://blog.example.com",
+		" blog : https://www.blog.example.com ", "news:https://news.example.com:8443"}}}
+	res, err := s.makeCORSPolicies()
+	require.NoError(t, err)
+	assert.Equal(t, rest.CORSPolicy{Origins: []string{"*"}, Credentials: true, MaxAge: 300}, res.Policy("other"))
+	assert.Equal(t, rest.CORSPolicy{Origins: []string{"https://blog.example.com", "https://www.blog.example.com"}, Credentials: true,
+		MaxAge: 300}, res.Policy("blog"))
+	assert.Equal(t, []string{"https://news.example.com:8443"}, res.Policy("news").Origins)
+
+	s.CORS.DisableCredentials = true
+	res, err = s.makeCORSPolicies()
+	require.NoError(t, err)
+	assert.False(t, res.Policy("blog").Credentials)
+
+	for _, bad := range []CORSGroup{{SiteOrigins: []string{"blog"}}, {SiteOrigins: []string{":https://example.com"}},
+		{SiteOrigins: []string{"blog:blog.example.com"}}, {Origins: []string{"*", "https://example.com"}}, {MaxAge: -1}} {
+		s = ServerCommand{CORS: bad}
+		_, err = s.makeCORSPolicies()
+		assert.Error(t, err, bad)
+	}
+}
+
+func Test_makeCDNPurger(t *testing.T) {
+	s := ServerCommand{CDN: CDNGroup{Purge: "none", Timeout: time.Second}}
+	res, err := s.makeCDNPurger()
+	require.NoError(t, err)
+	assert.Nil(t, res)
+
+	s.CDN.Purge = "fastly"
+	_, err = s.makeCDNPurger()
+	assert.EqualError(t, err, "fastly service id and token required")
+	s.CDN.Fastly.ServiceID, s.CDN.Fastly.Token = "svc", "token"
+	res, err = s.makeCDNPurger()
+	require.NoError(t, err)
+	assert.IsType(t, &cdn.Fastly{}, res)
+	assert.Equal(t, "svc", res.(*cdn.Fastly).ServiceID)
+
+	s.CDN.Purge = "cloudflare"
+	_, err = s.makeCDNPurger()
+	assert.EqualError(t, err, "cloudflare zone id and token required")
+	s.CDN.Cloudflare.ZoneID, s.CDN.Cloudflare.Token = "zone", "token"
+	res, err = s.makeCDNPurger()
+	require.NoError(t, err)
+	assert.Equal(t, "zone", res.(*cdn.Cloudflare).ZoneID)
+	assert.Equal(t, time.Second, res.(*cdn.Cloudflare).Client.Timeout)
+}
+
+func Test_makeLimits(t *testing.T) {
+	s := ServerCommand{Limits: LimitsGroup{CommentBody: 1024, ImageBody: 2048, ImportBody: 4096, CommentTimeout: time.Second,
+		ImageTimeout: 2 * time.Second, ImportTimeout: time.Hour, ReadHeaderTimeout: 3 * time.Second, IdleTimeout: time.Minute}}
+	res, err := s.makeLimits()
+	require.NoError(t, err)
+	assert.Equal(t, api.Limits{CommentBody: 1024, ImageBody: 2048, ImportBody: 4096, CommentTimeout: time.Second,
+		ImageTimeout: 2 * time.Second, ImportTimeout: time.Hour, ReadHeaderTimeout: 3 * time.Second, IdleTimeout: time.Minute}, res)
+
+	s.Limits.ImageBody = 0
+	_, err = s.makeLimits()
+	assert.EqualError(t, err, "body limits should be positive, comment 1024, image 0, import 4096")
+
+	s.Limits.ImageBody, s.Limits.ImportTimeout = 2048, -time.Second
+	_, err = s.makeLimits()
+	assert.EqualError(t, err, "timeouts should be positive, got -1s")
+}
+
+func Test_makePlugins(t *testing.T) {
+	s := ServerCommand{Plugins: PluginsGroup{Timeout: time.Second, Memory: 64}}
+	res, err := s.makePlugins()
+	require.NoError(t, err)
+	assert.Nil(t, res, "disabled without dir")
+
+	s.Plugins.Dir = t.TempDir()
+	res, err = s.makePlugins()
+	require.NoError(t, err)
+	require.NotNil(t, res)
+	require.NoError(t, res.Close(context.Background()))
+
+	s.Plugins.Memory = 0
+	_, err = s.makePlugins()
+	require.EqualError(t, err, "plugins memory 0M out of range 1..4095")
+
+	s.Plugins.Memory = 64
+	require.NoError(t, os.WriteFile(filepath.Join(s.Plugins.Dir, "bad.wasm"), []byte("bad"), 0o600))
+	_, err = s.makePlugins()
+	require.Error(t, err)
+}
+
+func Test_cannedResponses(t *testing.T) {
+	s := ServerCommand{CannedResponses: []string{"civil:please, keep it civil", " offtopic : off-topic: not related ", "bad", ":empty", "id:"}}
+	assert.Equal(t, []service.CannedResponse{{ID: "civil", Text: "please, keep it civil"}, {ID: "offtopic", Text: "off-topic: not related"}},
+		s.cannedResponses())
+	assert.Equal(t, []service.CannedResponse{}, (&ServerCommand{}).cannedResponses())
+}
+
+func Test_anonUserID(t *testing.T) {
 	s := ServerCommand{}
-	s.SetCommon(CommonOpts{RemarkURL: "https://demo.remark42.com", SharedSecret: "123456"})
+	s.SharedSecret = "secret"
+	tkn, err := rest.MakeDeviceToken("secret")
+	require.NoError(t, err)
+	id, ok := rest.DeviceID(tkn, "secret")
+	require.True(t, ok)
+
+	r := httptest.NewRequest(http.MethodGet, "/auth/anonymous/login?user=name1&device="+tkn, http.NoBody)
+	r.RemoteAddr = "10.0.0.1:1234"
+	assert.Equal(t, "device:"+id, s.anonUserID("name1", r))
+	r.RemoteAddr = "10.0.0.2:1234"
+	assert.Equal(t, "device:"+id, s.anonUserID("name2", r), "same device, another name and ip")
+
+	r = httptest.NewRequest(http.MethodGet, "/auth/anonymous/login?user=name1&device=bad.token", http.NoBody)
+	r.RemoteAddr = "10.0.0.1:1234"
+	assert.Equal(t, "name110.0.0.1:1234", s.anonUserID("name1", r), "invalid device token")
+}
 
-	p := flags.NewParser(&s, flags.Default)
-	args := []string{
-		"test",
-		"--auth.email.host=smtp-old.example.org",
-		"--smtp.host=smtp-new.example.org",
-		"--auth.email.port=666",
-		"--smtp.port=999",
-		"--auth.email.user=test_user",
-		"--smtp.username=new_test_user",
-		"--auth.email.passwd=test_password",
-		"--smtp.password=new_test_password",
-		"--auth.email.timeout=15s",
-		"--smtp.timeout=20s",
-		"--notify.type=telegram",
-		"--notify.users=telegram",
-		"--notify.admins=none",
-		"--notify.telegram.token=abcd",
-		"--telegram.token=dcba",
-		"--notify.telegram.timeout=3m",
-		"--telegram.timeout=5m",
+func Test_makePoW(t *testing.T) {
+	s := ServerCommand{}
+	assert.Nil(t, s.makePoW(), "disabled")
+	s.SharedSecret = "secret"
+	s.PoW = PoWGroup{Enabled: true, Difficulty: 10, TTL: time.Minute}
+	pow := s.makePoW()
+	require.NotNil(t, pow)
+	assert.Equal(t, 10, pow.Difficulty())
+}
+
+func Test_makeCaptcha(t *testing.T) {
+	s := ServerCommand{}
+	captcha, err := s.makeCaptcha()
+	require.NoError(t, err)
+	assert.Nil(t, captcha, "disabled")
+
+	s.Captcha = CaptchaGroup{Type: "turnstile", AnonLogin: true}
+	_, err = s.makeCaptcha()
+	assert.EqualError(t, err, "captcha secret is required")
+
+	s.Captcha.Secret, s.Captcha.SiteKey = "secret", "site-key"
+	captcha, err = s.makeCaptcha()
+	require.NoError(t, err)
+	assert.Equal(t, &rest.Captcha{Type: "turnstile", Secret: "secret", SiteKey: "site-key"}, captcha)
+}
+
+func Test_makeJWKS(t *testing.T) {
+	s := ServerCommand{}
+	jwks, err := s.makeJWKS()
+	require.NoError(t, err)
+	assert.Nil(t, jwks, "disabled")
+
+	key, err := rsa.GenerateKey(crand.Reader, 2048)
+	require.NoError(t, err)
+	keyFile := filepath.Join(t.TempDir(), "jwt.pem")
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0o600))
+	s.Auth.JWTKeys = []string{keyFile}
+	s.Auth.TTL.JWT = time.Minute
+	jwks, err = s.makeJWKS()
+	require.NoError(t, err)
+	require.NotNil(t, jwks)
+	_, expires, err := jwks.Token(token.User{ID: "github_123"}, "remark42")
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), expires, time.Second)
+
+	s.Auth.JWTKeys = []string{keyFile, "/dev/null"}
+	_, err = s.makeJWKS()
+	assert.Error(t, err)
+}
+
+func Test_makeTokenRotation(t *testing.T) {
+	s := ServerCommand{}
+	s.Auth.PreviousSecretTTL = time.Hour
+	authenticator := auth.NewService(auth.Opts{SecretReader: token.SecretFunc(func(string) (string, error) { return "secret", nil })})
+	assert.False(t, s.makeTokenRotation(authenticator).Active(), "no previous secret")
+
+	s.Auth.PreviousSecret = "old secret"
+	r := s.makeTokenRotation(authenticator)
+	assert.True(t, r.Active())
+	old := token.NewService(token.Opts{SecretReader: token.SecretFunc(func(string) (string, error) { return "old secret", nil })})
+	tkn, err := old.Token(token.Claims{RegisteredClaims: jwt.RegisteredClaims{Audience: jwt.ClaimStrings{"remark"}}, User: &token.User{ID: "github_123"}})
+	require.NoError(t, err)
+	claims, err := r.Parse(tkn)
+	require.NoError(t, err)
+	assert.Equal(t, "github_123", claims.User.ID)
+
+	s.Auth.PreviousSecretTTL = 0
+	assert.False(t, s.makeTokenRotation(authenticator).Active(), "grace window over")
+}
+
+func Test_timezones(t *testing.T) {
+	s := ServerCommand{Timezones: []string{"Europe/Berlin", "site1:Asia/Tokyo", " site2 : UTC "}}
+	res, err := s.timezones()
+	require.NoError(t, err)
+	require.NotNil(t, res.Default)
+	assert.Equal(t, "Europe/Berlin", res.Default.String())
+	assert.Equal(t, "Asia/Tokyo", res.Sites["site1"].String())
+	assert.Equal(t, "UTC", res.Sites["site2"].String())
+
+	res, err = (&ServerCommand{}).timezones()
+	require.NoError(t, err)
+	assert.Nil(t, res.Default)
+	assert.Empty(t, res.Sites)
+
+	_, err = (&ServerCommand{Timezones: []string{"site1:Mars/Olympus"}}).timezones()
+	assert.ErrorContains(t, err, `invalid timezone "site1:Mars/Olympus"`)
+}
+
+func Test_notifyCollapse(t *testing.T) {
+	s := ServerCommand{}
+	s.Notify.Collapse = []string{"2m", "site1:10m", " site2 : 0s "}
+	res, err := s.notifyCollapse()
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Minute, res.Default)
+	assert.Equal(t, map[string]time.Duration{"site1": 10 * time.Minute, "site2": 0}, res.Sites)
+
+	res, err = (&ServerCommand{}).notifyCollapse()
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), res.Window("site1"), "disabled by default")
+
+	s.Notify.Collapse = []string{"site1:soon"}
+	_, err = s.notifyCollapse()
+	assert.ErrorContains(t, err, `invalid collapse window "site1:soon"`)
+	s.Notify.Collapse = []string{"-1m"}
+	_, err = s.notifyCollapse()
+	assert.Error(t, err)
+}
+
+func Test_emailIdentities(t *testing.T) {
+	s := ServerCommand{Sites: []string{"blog", "forum"}}
+	s.Notify.Email.SiteFrom = []string{"blog:Blog <blog@example.com>", " forum : forum@example.net "}
+	s.Notify.Email.ReplyTo = []string{"support@example.org", "forum:\"Forum mods\" <mods@example.net>"}
+	res, err := s.emailIdentities()
+	require.NoError(t, err)
+	assert.Equal(t, notify.EmailIdentities{ReplyTo: "support@example.org", Sites: map[string]notify.EmailIdentity{
+		"blog":  {From: "Blog <blog@example.com>"},
+		"forum": {From: "forum@example.net", ReplyTo: `"Forum mods" <mods@example.net>`},
+	}}, res)
+
+	res, err = (&ServerCommand{}).emailIdentities()
+	require.NoError(t, err)
+	assert.Equal(t, notify.EmailIdentities{Sites: map[string]notify.EmailIdentity{}}, res, "not set by default")
+
+	tbl := []struct {
+		siteFrom, replyTo []string
+		err               string
+	}{
+		{[]string{"blog@example.com"}, nil, `no site in "blog@example.com", expected site:address`},
+		{[]string{"news:news@example.com"}, nil, `unknown site "news" in "news:news@example.com"`},
+		{nil, []string{"news:news@example.com"}, `unknown site "news" in "news:news@example.com"`},
+		{[]string{"blog:not an address"}, nil, `invalid email address in "blog:not an address"`},
+		{nil, []string{"forum:"}, `invalid email address in "forum:"`},
 	}
-	_, err := p.ParseArgs(args)
+	for _, tt := range tbl {
+		t.Run(tt.err, func(t *testing.T) {
+			s.Notify.Email.SiteFrom, s.Notify.Email.ReplyTo = tt.siteFrom, tt.replyTo
+			_, err := s.emailIdentities()
+			assert.ErrorContains(t, err, tt.err)
+		})
+	}
+}
+
+func Test_emailAPI(t *testing.T) {
+	var received map[string]any
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/email", r.URL.Path)
+		assert.Equal(t, "key123", r.Header.Get("X-Postmark-Server-Token"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer ts.Close()
+
+	s := ServerCommand{Sites: []string{"site1"}}
+	assert.False(t, s.emailAPIEnabled())
+	assert.Equal(t, api.EmailEvents{}, s.emailEvents(), "disabled without provider")
+
+	s.EmailAPI = EmailAPIGroup{Provider: "postmark", Key: "key123", Endpoint: ts.URL, EventsSecret: "secret"}
+	assert.True(t, s.emailAPIEnabled())
+	assert.Equal(t, api.EmailEvents{Provider: "postmark", Secret: "secret", Sites: []string{"site1"}}, s.emailEvents())
+
+	emailAPI, err := s.makeEmailAPI()
 	require.NoError(t, err)
-	deprecatedFlagsCollisions := s.findDeprecatedFlagsCollisions()
-	assert.ElementsMatch(t,
-		[]DeprecatedFlag{
-			{Old: "notify.type", New: "notify.(users|admins)", Collision: true},
-			{Old: "auth.email.host", New: "smtp.host", Collision: true},
-			{Old: "auth.email.port", New: "smtp.port", Collision: true},
-			{Old: "auth.email.user", New: "smtp.username", Collision: true},
-			{Old: "auth.email.passwd", New: "smtp.password", Collision: true},
-			{Old: "auth.email.timeout", New: "smtp.timeout", Collision: true},
-			{Old: "notify.telegram.token", New: "telegram.token", Collision: true},
-			{Old: "notify.telegram.timeout", New: "telegram.timeout", Collision: true},
-		},
-		deprecatedFlagsCollisions)
+	sndr := &emailSender{sender: emailAPI, from: "Remark42 <remark@example.com>", subject: "confirm & login"}
+	require.NoError(t, sndr.Send("user+1@example.com", "<p>token</p>"))
+	assert.Equal(t, "user+1@example.com", received["To"])
+	assert.Equal(t, "Remark42 <remark@example.com>", received["From"])
+	assert.Equal(t, "confirm & login", received["Subject"])
+	assert.Equal(t, "<p>token</p>", received["HtmlBody"])
+
+	s.EmailAPI = EmailAPIGroup{Provider: "mailgun", Key: "key123"}
+	_, err = s.makeEmailAPI()
+	assert.EqualError(t, err, "domain is required for mailgun")
+}
 
-	// case which should return nothing
-	s = ServerCommand{}
-	s.SetCommon(CommonOpts{RemarkURL: "https://demo.remark42.com", SharedSecret: "123456"})
-	p = flags.NewParser(&s, flags.Default)
-	args = []string{
-		"test",
-		"--auth.email.host=smtp-old.example.org",
-		"--smtp.host=''",
+func Test_makeDKIM(t *testing.T) {
+	key, err := rsa.GenerateKey(crand.Reader, 2048)
+	require.NoError(t, err)
+	keyFile := filepath.Join(t.TempDir(), "dkim.pem")
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0o600))
+
+	s := ServerCommand{SMTP: SMTPGroup{DKIMDomain: "example.com", DKIMSelector: "remark42", DKIMKey: keyFile}}
+	dkim, err := s.makeDKIM()
+	require.NoError(t, err)
+	assert.Equal(t, "dkim: example.com with selector remark42", dkim.String())
+
+	s.SMTP.DKIMDomain = ""
+	_, err = s.makeDKIM()
+	assert.EqualError(t, err, "dkim domain and selector are required")
+
+	s.SMTP.DKIMKey = "/tmp/no-such-dkim.pem"
+	_, err = s.makeDKIM()
+	assert.ErrorContains(t, err, "can't read dkim key")
+}
+
+func Test_makeSuppressStore(t *testing.T) {
+	s := ServerCommand{}
+	suppressStore, err := s.makeSuppressStore()
+	require.NoError(t, err)
+	assert.Nil(t, suppressStore, "suppression disabled")
+
+	s.Suppress = SuppressGroup{Enabled: true, File: t.TempDir() + "/sub/suppress.db"}
+	suppressStore, err = s.makeSuppressStore()
+	require.NoError(t, err)
+	require.NotNil(t, suppressStore)
+	assert.NoError(t, suppressStore.Close())
+}
+
+func Test_suppressedSender(t *testing.T) {
+	var sent []string
+	sndr := &suppressedSender{
+		Sender:     provider.SenderFunc(func(address, _ string) error { sent = append(sent, address); return nil }),
+		suppressed: func(address string) bool { return address == "bad@example.com" },
 	}
-	_, err = p.ParseArgs(args)
+	require.NoError(t, sndr.Send("good@example.com", "text"))
+	require.EqualError(t, sndr.Send("bad@example.com", "text"), "email address is suppressed after bounces or complaints")
+	assert.Equal(t, []string{"good@example.com"}, sent)
+}
+
+func Test_makePollStore(t *testing.T) {
+	s := ServerCommand{}
+	pollStore, err := s.makePollStore()
+	require.NoError(t, err)
+	assert.Nil(t, pollStore, "polls disabled")
+
+	s.Polls = PollsGroup{Enabled: true, File: t.TempDir() + "/sub/polls.db"}
+	pollStore, err = s.makePollStore()
+	require.NoError(t, err)
+	require.NotNil(t, pollStore)
+	assert.NoError(t, pollStore.Close())
+}
+
+func Test_makeHighlightStore(t *testing.T) {
+	s := ServerCommand{}
+	highlightStore, err := s.makeHighlightStore()
+	require.NoError(t, err)
+	assert.Nil(t, highlightStore, "highlights disabled")
+
+	s.Highlights = HighlightsGroup{Enabled: true, File: t.TempDir() + "/sub/highlights.db"}
+	highlightStore, err = s.makeHighlightStore()
+	require.NoError(t, err)
+	require.NotNil(t, highlightStore)
+	assert.NoError(t, highlightStore.Close())
+}
+
+func Test_makeEventStore(t *testing.T) {
+	s := ServerCommand{}
+	eventStore, err := s.makeEventStore()
+	require.NoError(t, err)
+	assert.Nil(t, eventStore, "events journal disabled")
+
+	s.Events = EventsGroup{Enabled: true, File: t.TempDir() + "/sub/events.db"}
+	eventStore, err = s.makeEventStore()
+	require.NoError(t, err)
+	require.NotNil(t, eventStore)
+	assert.NoError(t, eventStore.Close())
+}
+
+func Test_makeInviteStore(t *testing.T) {
+	s := ServerCommand{}
+	inviteStore, err := s.makeInviteStore()
+	require.NoError(t, err)
+	assert.Nil(t, inviteStore, "invitations disabled")
+
+	s.Invite = InviteGroup{Enabled: true, File: t.TempDir() + "/sub/invites.db"}
+	inviteStore, err = s.makeInviteStore()
 	require.NoError(t, err)
-	deprecatedFlagsCollisions = s.findDeprecatedFlagsCollisions()
-	assert.Empty(t, []DeprecatedFlag{}, deprecatedFlagsCollisions)
+	require.NotNil(t, inviteStore)
+	assert.NoError(t, inviteStore.Close())
 }
 
-func Test_ACMEEmail(t *testing.T) {
-	cmd := ServerCommand{}
-	cmd.SetCommon(CommonOpts{RemarkURL: "https://remark.com:443", SharedSecret: "123456"})
-	p := flags.NewParser(&cmd, flags.Default)
-	args := []string{"--ssl.type=auto"}
-	_, err := p.ParseArgs(args)
+func Test_makeBotStore(t *testing.T) {
+	s := ServerCommand{}
+	botStore, err := s.makeBotStore()
 	require.NoError(t, err)
-	cfg, err := cmd.makeSSLConfig()
+	assert.Nil(t, botStore, "bots disabled")
+
+	s.Bots = BotsGroup{Enabled: true, File: t.TempDir() + "/sub/bots.db"}
+	botStore, err = s.makeBotStore()
 	require.NoError(t, err)
-	assert.Equal(t, "admin@remark.com", cfg.ACMEEmail)
+	require.NotNil(t, botStore)
+	assert.NoError(t, botStore.Close())
+}
 
-	cmd = ServerCommand{}
-	cmd.SetCommon(CommonOpts{RemarkURL: "https://remark.com", SharedSecret: "123456"})
-	p = flags.NewParser(&cmd, flags.Default)
-	args = []string{"--ssl.type=auto", "--ssl.acme-email=adminname@adminhost.com"}
-	_, err = p.ParseArgs(args)
+func Test_makePageChecker(t *testing.T) {
+	s := ServerCommand{}
+	checker, err := s.makePageChecker()
 	require.NoError(t, err)
-	cfg, err = cmd.makeSSLConfig()
+	assert.Nil(t, checker, "disabled")
+
+	s.PageCheck = PageCheckGroup{URLs: []string{"https://cms.example.com/check"}}
+	_, err = s.makePageChecker()
+	assert.EqualError(t, err, `invalid page check url in "https://cms.example.com/check"`, "cut at scheme")
+	s.PageCheck.URLs = []string{"cms.example.com"}
+	_, err = s.makePageChecker()
+	assert.EqualError(t, err, `no site in "cms.example.com", expected site:url`)
+
+	s.PageCheck = PageCheckGroup{URLs: []string{"site1:https://cms.example.com/check", " site2 : http://cms2.local/check?key=1"},
+		Timeout: time.Second, TTL: time.Minute}
+	checker, err = s.makePageChecker()
 	require.NoError(t, err)
-	assert.Equal(t, "adminname@adminhost.com", cfg.ACMEEmail)
+	require.NotNil(t, checker)
+	assert.Equal(t, map[string]string{"site1": "https://cms.example.com/check", "site2": "http://cms2.local/check?key=1"}, checker.URLs)
+	assert.NoError(t, checker.Close())
+}
 
-	cmd = ServerCommand{}
-	cmd.SetCommon(CommonOpts{RemarkURL: "https://remark.com", SharedSecret: "123456"})
-	p = flags.NewParser(&cmd, flags.Default)
-	args = []string{"--ssl.type=auto", "--admin.type=shared", "--admin.shared.email=superadmin@admin.com"}
-	_, err = p.ParseArgs(args)
+func Test_makeScheduleStore(t *testing.T) {
+	s := ServerCommand{}
+	scheduleStore, err := s.makeScheduleStore()
 	require.NoError(t, err)
-	cfg, err = cmd.makeSSLConfig()
+	assert.Nil(t, scheduleStore, "scheduled actions disabled")
+	assert.Nil(t, s.makeScheduler(&service.DataStore{}, notify.NopService, nil))
+
+	s.Schedule = ScheduleGroup{Enabled: true, File: t.TempDir() + "/sub/schedule.db"}
+	_, err = s.makeScheduleStore()
+	require.EqualError(t, err, "invalid schedule period 0s")
+
+	s.Schedule.Period = time.Minute
+	scheduleStore, err = s.makeScheduleStore()
 	require.NoError(t, err)
-	assert.Equal(t, "superadmin@admin.com", cfg.ACMEEmail)
+	require.NotNil(t, scheduleStore)
+	assert.NotNil(t, s.makeScheduler(&service.DataStore{ScheduleStore: scheduleStore}, notify.NopService, nil))
+	assert.NoError(t, scheduleStore.Close())
+}
 
-	cmd = ServerCommand{}
-	cmd.SetCommon(CommonOpts{RemarkURL: "https://remark.com:443", SharedSecret: "123456"})
-	p = flags.NewParser(&cmd, flags.Default)
-	args = []string{"--ssl.type=auto", "--admin.type=shared"}
-	_, err = p.ParseArgs(args)
+func Test_makeColdStore(t *testing.T) {
+	s := ServerCommand{}
+	coldStore, err := s.makeColdStore()
 	require.NoError(t, err)
-	cfg, err = cmd.makeSSLConfig()
+	assert.Nil(t, coldStore, "cold storage disabled")
+	assert.Nil(t, s.makeColdFreezer(&service.DataStore{}, nil))
+
+	s.Cold = ColdGroup{Enabled: true, File: t.TempDir() + "/sub/cold.db", Period: time.Hour}
+	_, err = s.makeColdStore()
+	require.EqualError(t, err, "invalid cold storage period 1h0m0s or inactivity 0s")
+
+	s.Cold.Inactive = 365 * 24 * time.Hour
+	s.Sites = []string{"site1"}
+	coldStore, err = s.makeColdStore()
 	require.NoError(t, err)
-	assert.Equal(t, "admin@remark.com", cfg.ACMEEmail)
+	require.NotNil(t, coldStore)
+	f := s.makeColdFreezer(&service.DataStore{ColdStore: coldStore}, nil)
+	require.NotNil(t, f)
+	assert.Equal(t, []string{"site1"}, f.Sites)
+	assert.Equal(t, 365*24*time.Hour, f.Inactive)
+	assert.NoError(t, coldStore.Close())
 }
 
-func TestServerAuthHooks(t *testing.T) {
-	port := chooseRandomUnusedPort()
-	app, ctx, cancel := prepServerApp(t, func(o ServerCommand) ServerCommand {
-		o.Port = port
-		return o
-	})
+func Test_makePageStore(t *testing.T) {
+	s := ServerCommand{}
+	pageStore, err := s.makePageStore()
+	require.NoError(t, err)
+	assert.Nil(t, pageStore, "page settings disabled")
 
-	go func() { _ = app.run(ctx) }()
-	waitForHTTPServerStart(port)
+	s.Pages = PagesGroup{Enabled: true, File: t.TempDir() + "/sub/pages.db"}
+	pageStore, err = s.makePageStore()
+	require.NoError(t, err)
+	require.NotNil(t, pageStore)
+	assert.NoError(t, pageStore.Close())
+}
 
-	// make a token for user dev
-	tkService := app.restSrv.Authenticator.TokenService()
-	tkService.TokenDuration = time.Second
+func Test_makeQuotas(t *testing.T) {
+	s := ServerCommand{}
+	q, err := s.makeQuotas()
+	require.NoError(t, err)
+	assert.Nil(t, q, "quotas disabled")
 
-	claims := token.Claims{
-		RegisteredClaims: jwt.RegisteredClaims{
-			Audience:  jwt.ClaimStrings{"remark"},
-			Issuer:    "remark",
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Second)),
-			NotBefore: jwt.NewNumericDate(time.Now().Add(-1 * time.Minute)),
-		},
-		User: &token.User{
-			ID:   "github_dev",
-			Name: "developer one",
-		},
-	}
-	tk, err := tkService.Token(claims)
+	s.Quota = QuotaGroup{Enabled: true, File: t.TempDir() + "/sub/quota.db", Comments: 100, Mode: "block",
+		Thresholds: []int{80, 120}}
+	_, err = s.makeQuotas()
+	require.EqualError(t, err, "invalid quota threshold 120%")
+
+	s.Quota.Thresholds = []int{80, 100}
+	q, err = s.makeQuotas()
 	require.NoError(t, err)
-	t.Log(tk)
+	require.NotNil(t, q)
+	info, err := q.Info("site1")
+	require.NoError(t, err)
+	assert.Equal(t, "block", info.Mode)
+	assert.Equal(t, int64(100), info.Limits.Comments)
+	assert.NoError(t, q.Close())
+}
 
-	client := http.Client{Timeout: 10 * time.Second}
-	defer client.CloseIdleConnections()
+func Test_makeEventBus(t *testing.T) {
+	s := ServerCommand{}
+	pub, err := s.makeEventBus()
+	require.NoError(t, err)
+	assert.Nil(t, pub, "disabled by default")
 
-	// add comment
-	req, err := http.NewRequest("POST", fmt.Sprintf("http://localhost:%d/api/v1/comment?site=remark", port),
-		strings.NewReader(`{"text": "test 123", "locator":{"url": "https://radio-t.com/p/2018/12/29/podcast-630/", "site": "remark"}}`))
+	s.EventBus = EventBusGroup{Type: "kafka", Topic: "events", Format: "json", Timeout: time.Second}
+	_, err = s.makeEventBus()
+	require.EqualError(t, err, "no event bus servers")
+
+	s.EventBus.Servers = []string{"127.0.0.1:1"}
+	pub, err = s.makeEventBus()
 	require.NoError(t, err)
-	req.Header.Set("X-JWT", tk)
-	resp, err := client.Do(req)
+	require.NotNil(t, pub)
+	assert.NoError(t, pub.Close())
+
+	s.EventBus.Format = "avro"
+	pub, err = s.makeEventBus()
 	require.NoError(t, err)
-	require.NoError(t, resp.Body.Close())
-	assert.Equal(t, http.StatusCreated, resp.StatusCode, "non-blocked user able to post")
+	assert.NoError(t, pub.Close())
 
-	// try to add comment with no-aud claim
-	badClaimsNoAud := claims
-	badClaimsNoAud.Audience = jwt.ClaimStrings{""}
-	tkNoAud, err := tkService.Token(badClaimsNoAud)
+	s.EventBus = EventBusGroup{Type: "nats", Servers: []string{"nats://127.0.0.1:1"}, Timeout: 100 * time.Millisecond}
+	_, err = s.makeEventBus()
+	assert.ErrorContains(t, err, "can't connect to nats nats://127.0.0.1:1")
+}
+
+func Test_makeAssetStore(t *testing.T) {
+	s := ServerCommand{}
+	assetStore, err := s.makeAssetStore()
 	require.NoError(t, err)
-	t.Logf("no-aud claims: %s", tkNoAud)
-	req, err = http.NewRequest("POST", fmt.Sprintf("http://localhost:%d/api/v1/comment?site=remark", port),
-		strings.NewReader(`{"text": "test 123", "locator":{"url": "https://radio-t.com/p/2018/12/29/podcast-631/",
-	"site": "remark"}}`))
+	assert.Nil(t, assetStore, "assets disabled")
+
+	s.Assets = AssetsGroup{Enabled: true, File: t.TempDir() + "/sub/assets.db"}
+	assetStore, err = s.makeAssetStore()
 	require.NoError(t, err)
-	req.Header.Set("X-JWT", tkNoAud)
-	resp, err = client.Do(req)
+	require.NotNil(t, assetStore)
+	assert.NoError(t, assetStore.Close())
+}
+
+func Test_makePicturesStoreThumbnails(t *testing.T) {
+	s := ServerCommand{Image: ImageGroup{Type: "bolt", Thumbnails: []string{"160x160", " 320x240"}}}
+	s.Image.Bolt.File = t.TempDir() + "/pictures.db"
+	svc, err := s.makePicturesStore()
 	require.NoError(t, err)
-	body, err := io.ReadAll(resp.Body)
+	assert.Equal(t, []image.ThumbnailSize{{Width: 160, Height: 160}, {Width: 320, Height: 240}}, svc.ThumbnailSizes)
+
+	s.Image.Thumbnails = []string{"160"}
+	_, err = s.makePicturesStore()
+	assert.EqualError(t, err, `invalid thumbnail size "160", expected WIDTHxHEIGHT`)
+}
+
+func Test_makeGeoLocator(t *testing.T) {
+	s := ServerCommand{}
+	locator, err := s.makeGeoLocator()
 	require.NoError(t, err)
-	require.NoError(t, resp.Body.Close())
-	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "user without aud claim rejected, \n"+tkNoAud+"\n"+string(body))
+	assert.Nil(t, locator, "geoip disabled")
 
-	// try to add comment with multiple auds
-	badClaimsMultipleAud := claims
-	badClaimsMultipleAud.Audience = jwt.ClaimStrings{"remark", "second_aud"}
-	tkMultipleAuds, err := tkService.Token(badClaimsMultipleAud)
+	s.Geo = GeoGroup{CountryDB: "/no-such-dir/country.mmdb"}
+	_, err = s.makeGeoLocator()
+	assert.Error(t, err)
+}
+
+func Test_makePIIVault(t *testing.T) {
+	s := ServerCommand{}
+	vault, err := s.makePIIVault()
 	require.NoError(t, err)
-	t.Logf("multiple aud claims: %s", tkMultipleAuds)
-	req, err = http.NewRequest("POST", fmt.Sprintf("http://localhost:%d/api/v1/comment?site=remark", port),
-		strings.NewReader(`{"text": "test 123", "locator":{"url": "https://radio-t.com/p/2018/12/29/podcast-631/",
-	"site": "remark"}}`))
+	assert.Nil(t, vault, "pii minimization disabled")
+
+	s.PII.Minimize = true
+	_, err = s.makePIIVault()
+	assert.Error(t, err, "no key and no secret")
+
+	s.SharedSecret = "secret"
+	vault, err = s.makePIIVault()
 	require.NoError(t, err)
-	req.Header.Set("X-JWT", tkMultipleAuds)
-	resp, err = client.Do(req)
+	withSecret := vault.Hash("user@example.com")
+
+	s.PII.Key = "pii-key"
+	vault, err = s.makePIIVault()
 	require.NoError(t, err)
-	body, err = io.ReadAll(resp.Body)
+	assert.NotEqual(t, withSecret, vault.Hash("user@example.com"), "key used instead of secret")
+}
+
+func Test_makeDetailCipher(t *testing.T) {
+	s := ServerCommand{}
+	c, err := s.makeDetailCipher()
 	require.NoError(t, err)
-	require.NoError(t, resp.Body.Close())
-	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "user with multiple auds claim rejected, \n"+tkMultipleAuds+"\n"+string(body))
+	assert.Nil(t, c, "encryption disabled")
 
-	// try to add comment without user set
-	badClaimsNoUser := claims
-	badClaimsNoUser.Audience = jwt.ClaimStrings{"remark"}
-	badClaimsNoUser.User = nil
-	tkNoUser, err := tkService.Token(badClaimsNoUser)
+	s.Encrypt = EncryptGroup{Key: "new-key", OldKeys: []string{""}}
+	_, err = s.makeDetailCipher()
+	assert.Error(t, err, "empty old key")
+
+	s.Encrypt.OldKeys = []string{"old-key"}
+	c, err = s.makeDetailCipher()
 	require.NoError(t, err)
-	t.Logf("no user claims: %s", tkNoUser)
-	req, err = http.NewRequest("POST", fmt.Sprintf("http://localhost:%d/api/v1/comment?site=remark", port),
-		strings.NewReader(`{"text": "test 123", "locator":{"url": "https://radio-t.com/p/2018/12/29/podcast-631/",
-	"site": "remark"}}`))
+	old, err := service.NewDetailCipher("old-key")
 	require.NoError(t, err)
-	req.Header.Set("X-JWT", tkNoUser)
-	resp, err = client.Do(req)
+	enc, err := old.Encrypt("12345")
 	require.NoError(t, err)
-	body, err = io.ReadAll(resp.Body)
+	val, err := c.Decrypt(enc)
 	require.NoError(t, err)
-	require.NoError(t, resp.Body.Close())
-	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "user without user information rejected, \n"+tkNoUser+"\n"+string(body))
+	assert.Equal(t, "12345", val)
+	assert.False(t, c.IsCurrent(enc))
+}
 
-	// block user github_dev as admin
-	req, err = http.NewRequest(http.MethodPut,
-		fmt.Sprintf("http://localhost:%d/api/v1/admin/user/github_dev?site=remark&block=1&ttl=10d", port), http.NoBody)
-	assert.NoError(t, err)
-	req.SetBasicAuth("admin", "password")
-	resp, err = client.Do(req)
+func Test_makeExitNodeLists(t *testing.T) {
+	s := ServerCommand{ExitNodes: ExitNodesGroup{Tor: []string{"allow"}, TorList: []string{"https://example.com/tor"}, VPN: []string{"allow"}}}
+	policy, err := s.exitNodePolicy()
 	require.NoError(t, err)
-	assert.Equal(t, http.StatusOK, resp.StatusCode, "user github_dev blocked")
-	b, err := io.ReadAll(resp.Body)
+	assert.Empty(t, s.makeExitNodeLists(policy), "all allowed")
+
+	s.ExitNodes.Tor, s.ExitNodes.VPN = []string{"allow", "blog:block"}, []string{"moderate"}
+	policy, err = s.exitNodePolicy()
 	require.NoError(t, err)
-	require.NoError(t, resp.Body.Close())
-	t.Log(string(b))
+	lists := s.makeExitNodeLists(policy)
+	require.Len(t, lists, 1, "no vpn list")
+	assert.Equal(t, []string{"https://example.com/tor"}, lists["tor"].Sources, "tor list used by blog")
+
+	s.ExitNodes.VPNList = []string{"/srv/vpn.txt"}
+	lists = s.makeExitNodeLists(policy)
+	require.Len(t, lists, 2)
+	assert.Equal(t, []string{"/srv/vpn.txt"}, lists["vpn"].Sources)
+	assert.Equal(t, "vpn", lists["vpn"].Name)
+}
 
-	// try add a comment with blocked user
-	req, err = http.NewRequest("POST", fmt.Sprintf("http://localhost:%d/api/v1/comment?site=remark", port),
-		strings.NewReader(`{"text": "test 123 blah", "locator":{"url": "https://radio-t.com/blah1", "site": "remark"}}`))
+func Test_exitNodePolicy(t *testing.T) {
+	s := ServerCommand{ExitNodes: ExitNodesGroup{Tor: []string{"moderate", "blog:allow", " forum : block"}, VPN: []string{"allow", "forum:moderate"}}}
+	policy, err := s.exitNodePolicy()
 	require.NoError(t, err)
-	req.Header.Set("X-JWT", tk)
-	resp, err = client.Do(req)
+	assert.Equal(t, service.ExitNodePolicy{Tor: service.NetworkModerate, VPN: service.NetworkAllow}, policy.Default)
+	assert.Equal(t, map[string]service.ExitNodePolicy{
+		"blog":  {Tor: service.NetworkAllow},
+		"forum": {Tor: service.NetworkBlock, VPN: service.NetworkModerate},
+	}, policy.Sites)
+
+	s.ExitNodes.VPN = []string{"blog:deny"}
+	_, err = s.exitNodePolicy()
+	require.EqualError(t, err, `vpn: invalid action "blog:deny", expected allow, moderate or block`)
+}
+
+func Test_geoPolicy(t *testing.T) {
+	s := ServerCommand{Geo: GeoGroup{BlockCountries: []string{"XX", "blog:YY", "blog:ZZ"}, ModerateCountries: []string{"forum:US"},
+		BlockASNs: []string{"100", "forum:200"}, ModerateASNs: []string{"blog: 300"}}}
+	policy, err := s.geoPolicy()
 	require.NoError(t, err)
-	body, err = io.ReadAll(resp.Body)
+	assert.Equal(t, service.GeoPolicy{BlockCountries: []string{"XX"}, BlockASNs: []uint{100}}, policy.Default)
+	assert.Equal(t, map[string]service.GeoPolicy{
+		"blog":  {BlockCountries: []string{"YY", "ZZ"}, ModerateASNs: []uint{300}},
+		"forum": {ModerateCountries: []string{"US"}, BlockASNs: []uint{200}},
+	}, policy.Sites)
+
+	s.Geo.ModerateASNs = []string{"blog:AS300"}
+	_, err = s.geoPolicy()
+	require.EqualError(t, err, `invalid asn "blog:AS300"`)
+}
+
+func Test_makeBlocklistSyncer(t *testing.T) {
+	s := ServerCommand{Sites: []string{"remark", "blog"}}
+	assert.Nil(t, s.makeBlocklistSyncer(nil, nil), "no feeds")
+
+	s.Blocklist = BlocklistGroup{Feeds: []string{"https://example.com/api/v1/blocklist?site=remark"}, Allow: []string{"github_123"}}
+	syncer := s.makeBlocklistSyncer(&service.DataStore{}, nil)
+	require.NotNil(t, syncer)
+	assert.Equal(t, []string{"https://example.com/api/v1/blocklist?site=remark"}, syncer.Feeds)
+	assert.Equal(t, []string{"remark", "blog"}, syncer.Sites)
+	assert.Equal(t, []string{"github_123"}, syncer.Allow)
+	assert.NotNil(t, syncer.OnUpdate)
+}
+
+func Test_makeIntegrityJob(t *testing.T) {
+	s := ServerCommand{}
+	job, err := s.makeIntegrityJob(&service.DataStore{}, notify.NopService)
 	require.NoError(t, err)
-	require.NoError(t, resp.Body.Close())
-	assert.True(t, resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusUnauthorized,
-		"blocked user can't post, \n"+tk+"\n"+string(body))
+	assert.Nil(t, job, "integrity check disabled")
 
-	cancel()
-	app.Wait()
-	client.CloseIdleConnections()
+	s.Integrity = IntegrityGroup{Enabled: true, At: "3am"}
+	_, err = s.makeIntegrityJob(&service.DataStore{}, notify.NopService)
+	require.EqualError(t, err, `invalid integrity check time "3am", expected HH:MM`)
+
+	s.Integrity.At = "03:30"
+	job, err = s.makeIntegrityJob(&service.DataStore{}, notify.NopService)
+	require.NoError(t, err)
+	require.NotNil(t, job)
+	assert.Equal(t, "integrity check", job.Name)
+	ts := time.Date(2026, 10, 15, 12, 0, 0, 0, time.Local)
+	assert.Equal(t, time.Date(2026, 10, 16, 3, 30, 0, 0, time.Local), job.Next(ts), "nightly")
+
+	sch := s.makeScheduler(&service.DataStore{}, notify.NopService, nil, job)
+	require.NotNil(t, sch, "scheduler runs the job without scheduled actions")
+	assert.True(t, sch.HasJobs())
+	assert.Nil(t, sch.Store)
 }
 
-func TestServerCommand_parseSameSite(t *testing.T) {
-	tbl := []struct {
-		inp string
-		res http.SameSite
-	}{
-		{"", http.SameSiteDefaultMode},
-		{"default", http.SameSiteDefaultMode},
-		{"blah", http.SameSiteDefaultMode},
-		{"none", http.SameSiteNoneMode},
-		{"lax", http.SameSiteLaxMode},
-		{"strict", http.SameSiteStrictMode},
-	}
+func Test_makeEventsCleanupJob(t *testing.T) {
+	s := ServerCommand{Events: EventsGroup{Keep: time.Hour}}
+	assert.Nil(t, s.makeEventsCleanupJob(nil), "events journal disabled")
 
-	cmd := ServerCommand{}
-	for i, tt := range tbl {
-		t.Run(strconv.Itoa(i), func(t *testing.T) {
-			assert.Equal(t, tt.res, cmd.parseSameSite(tt.inp))
-		})
-	}
+	eventStore, err := event.NewBoltStorage(filepath.Join(t.TempDir(), "events.db"), bolt.Options{})
+	require.NoError(t, err)
+	defer eventStore.Close()
+	_, err = eventStore.Append(event.Event{Type: event.CommentCreated, SiteID: "remark", Timestamp: time.Now().Add(-2 * time.Hour)})
+	require.NoError(t, err)
+	_, err = eventStore.Append(event.Event{Type: event.CommentCreated, SiteID: "remark", Timestamp: time.Now()})
+	require.NoError(t, err)
+
+	s.Events.Keep = 0
+	assert.Nil(t, s.makeEventsCleanupJob(eventStore), "events kept forever")
+
+	s.Events.Keep = time.Hour
+	job := s.makeEventsCleanupJob(eventStore)
+	require.NotNil(t, job)
+	assert.Equal(t, "events cleanup", job.Name)
+	assert.True(t, job.Start)
+	job.Run(context.Background())
+	events, err := eventStore.List("remark", 0, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 1, "old event removed")
+	assert.Equal(t, uint64(2), events[0].ID)
 }
 
-func Test_splitAtCommas(t *testing.T) {
-	tbl := []struct {
-		inp string
-		res []string
-	}{
-		{"a string", []string{"a string"}},
-		{"vv1, vv2, vv3", []string{"vv1", "vv2", "vv3"}},
-		{`"vv1, blah", vv2, vv3`, []string{"vv1, blah", "vv2", "vv3"}},
-		{
-			`Access-Control-Allow-Headers:"DNT,X-CustomHeader,Keep-Alive,User-Agent,X-Requested-With,If-Modified-Since,Cache-Control,Content-Type",header123:val, foo:"bar1,bar2"`,
-			[]string{"Access-Control-Allow-Headers:\"DNT,X-CustomHeader,Keep-Alive,User-Agent,X-Requested-With,If-Modified-Since,Cache-Control,Content-Type\"", "header123:val", "foo:\"bar1,bar2\""},
-		},
-		{"", []string{}},
-	}
+func Test_makeSitemapSyncer(t *testing.T) {
+	s := ServerCommand{}
+	syncer, err := s.makeSitemapSyncer(&service.DataStore{})
+	require.NoError(t, err)
+	assert.Nil(t, syncer, "no sitemaps")
 
-	for i, tt := range tbl {
-		t.Run(strconv.Itoa(i), func(t *testing.T) {
-			assert.Equal(t, tt.res, splitAtCommas(tt.inp))
-		})
-	}
+	s.Pages.Sitemaps = []string{"remark:https://remark42.com/sitemap.xml"}
+	_, err = s.makeSitemapSyncer(&service.DataStore{})
+	assert.EqualError(t, err, "sitemaps require pages.enabled")
+
+	s.Pages.Enabled, s.Pages.File = true, t.TempDir()+"/pages.db"
+	pageStore, err := s.makePageStore()
+	require.NoError(t, err)
+	defer pageStore.Close()
+	ds := &service.DataStore{PageStore: pageStore}
+	s.Pages.Sitemaps = []string{"remark:https://remark42.com/sitemap.xml", " blog : https://blog.example.com/sitemap_index.xml "}
+	syncer, err = s.makeSitemapSyncer(ds)
+	require.NoError(t, err)
+	require.NotNil(t, syncer)
+	assert.Equal(t, map[string]string{"remark": "https://remark42.com/sitemap.xml", "blog": "https://blog.example.com/sitemap_index.xml"},
+		syncer.Sitemaps)
+
+	s.Pages.Sitemaps = []string{"https://remark42.com/sitemap.xml"}
+	_, err = s.makeSitemapSyncer(ds)
+	assert.EqualError(t, err, `invalid sitemap url in "https://remark42.com/sitemap.xml"`)
+	s.Pages.Sitemaps = []string{":https://remark42.com/sitemap.xml"}
+	_, err = s.makeSitemapSyncer(ds)
+	assert.EqualError(t, err, `no site in ":https://remark42.com/sitemap.xml", expected site:url`)
 }
 
-func Test_getAllowedDomains(t *testing.T) {
-	tbl := []struct {
-		s              ServerCommand
-		allowedDomains []string
-	}{
-		// correct example, parsed and returned as allowed domain
-		{ServerCommand{AllowedHosts: []string{}, CommonOpts: CommonOpts{RemarkURL: "https://remark42.example.org"}}, []string{"example.org"}},
-		{ServerCommand{AllowedHosts: []string{}, CommonOpts: CommonOpts{RemarkURL: "http://remark42.example.org"}}, []string{"example.org"}},
-		{ServerCommand{AllowedHosts: []string{}, CommonOpts: CommonOpts{RemarkURL: "http://localhost"}}, []string{"localhost"}},
-		// incorrect URLs, so Hostname is empty but returned list doesn't include empty string as it would allow any domain
-		{ServerCommand{AllowedHosts: []string{}, CommonOpts: CommonOpts{RemarkURL: "bad hostname"}}, []string{}},
-		{ServerCommand{AllowedHosts: []string{}, CommonOpts: CommonOpts{RemarkURL: "not_a_hostname"}}, []string{}},
-		// test removal of 'self', multiple AllowedHosts. No deduplication is expected
-		{ServerCommand{AllowedHosts: []string{"'self'", "example.org", "test.example.org", "remark42.com"}, CommonOpts: CommonOpts{RemarkURL: "https://example.org"}}, []string{"example.org", "test.example.org", "remark42.com", "example.org"}},
-	}
-	for i, tt := range tbl {
-		t.Run(strconv.Itoa(i), func(t *testing.T) {
-			assert.Equal(t, tt.allowedDomains, tt.s.getAllowedDomains())
-		})
-	}
+func Test_makeShadow(t *testing.T) {
+	s := ServerCommand{}
+	m, err := s.makeShadow()
+	require.NoError(t, err)
+	assert.Nil(t, m, "no url")
+
+	s.Shadow = ShadowGroup{URL: "http://remark42-next:8080", Sample: 0.1}
+	m, err = s.makeShadow()
+	require.NoError(t, err)
+	require.NotNil(t, m)
+	assert.Equal(t, "http://remark42-next:8080", m.URL)
+	assert.InDelta(t, 0.1, m.SampleRate, 0.0001)
+	assert.NotNil(t, m.Client)
+
+	s.Shadow = ShadowGroup{URL: "remark42-next:8080", Sample: 0.1}
+	_, err = s.makeShadow()
+	require.EqualError(t, err, `invalid shadow url "remark42-next:8080"`)
+
+	s.Shadow = ShadowGroup{URL: "http://remark42-next:8080", Sample: 1.5}
+	_, err = s.makeShadow()
+	require.EqualError(t, err, "shadow sample 1.5 out of range (0..1]")
 }
 
 func Test_getAllowedRedirectHosts(t *testing.T) {
@@ -0,0 +1,78 @@
+// Package geoip resolves country and autonomous system (ASN) of ip addresses with local MaxMind DB files,
+// i.e. GeoLite2-Country and GeoLite2-ASN. No network calls are made.
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Info is the location of ip address, empty fields for unknown values
+type Info struct {
+	Country string // ISO 3166-1 alpha-2 code, upper case
+	ASN     uint   // autonomous system number
+}
+
+// Service resolves ip addresses with country and/or asn databases
+type Service struct {
+	country *Reader
+	asn     *Reader
+}
+
+// New makes Service from country and asn mmdb files, any of them can be empty but not both.
+// A single file with both country and asn data (e.g. GeoIP2-Enterprise) can be passed twice.
+func New(countryFile, asnFile string) (*Service, error) {
+	if countryFile == "" && asnFile == "" {
+		return nil, fmt.Errorf("no geoip database files")
+	}
+	res := &Service{}
+	var err error
+	if countryFile != "" {
+		if res.country, err = Open(countryFile); err != nil {
+			return nil, err
+		}
+	}
+	if asnFile != "" {
+		if res.asn, err = Open(asnFile); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// Lookup returns country and asn of the ip
+func (s *Service) Lookup(ip string) (Info, error) {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return Info{}, fmt.Errorf("invalid ip %q", ip)
+	}
+	res := Info{}
+	if s.country != nil {
+		rec, err := s.country.Lookup(addr)
+		if err != nil {
+			return Info{}, fmt.Errorf("can't lookup country of %s: %w", ip, err)
+		}
+		res.Country = countryCode(rec)
+	}
+	if s.asn != nil {
+		rec, err := s.asn.Lookup(addr)
+		if err != nil {
+			return Info{}, fmt.Errorf("can't lookup asn of %s: %w", ip, err)
+		}
+		res.ASN = toUint(rec["autonomous_system_number"])
+	}
+	return res, nil
+}
+
+// countryCode returns iso code of the country, registered country is used for records without it (e.g. anycast networks)
+func countryCode(rec map[string]any) string {
+	for _, key := range []string{"country", "registered_country"} {
+		if c, ok := rec[key].(map[string]any); ok {
+			if code, ok := c["iso_code"].(string); ok && code != "" {
+				return strings.ToUpper(code)
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,65 @@
+package geoip
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_Lookup(t *testing.T) {
+	dir := t.TempDir()
+	countryFile, asnFile := filepath.Join(dir, "country.mmdb"), filepath.Join(dir, "asn.mmdb")
+	require.NoError(t, os.WriteFile(countryFile, buildMMDB(t, 6, 24, []testNet{
+		{cidr: "1.2.3.0/24", data: map[string]any{"country": map[string]any{"iso_code": "de"}}},
+		{cidr: "5.6.0.0/16", data: map[string]any{"registered_country": map[string]any{"iso_code": "US"}}},
+		{cidr: "2001:db8::/32", data: map[string]any{"country": map[string]any{"iso_code": "NL"}}},
+	}), 0o600))
+	require.NoError(t, os.WriteFile(asnFile, buildMMDB(t, 6, 28, []testNet{
+		{cidr: "1.2.0.0/16", data: map[string]any{"autonomous_system_number": uint32(64500),
+			"autonomous_system_organization": "Some Hosting"}},
+	}), 0o600))
+
+	svc, err := New(countryFile, asnFile)
+	require.NoError(t, err)
+
+	tbl := []struct {
+		ip  string
+		res Info
+	}{
+		{"1.2.3.4", Info{Country: "DE", ASN: 64500}},
+		{"1.2.4.4", Info{ASN: 64500}},
+		{"5.6.7.8", Info{Country: "US"}},
+		{"2001:db8::1", Info{Country: "NL"}},
+		{"127.0.0.1", Info{}},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.ip, func(t *testing.T) {
+			res, err := svc.Lookup(tt.ip)
+			require.NoError(t, err)
+			assert.Equal(t, tt.res, res)
+		})
+	}
+
+	_, err = svc.Lookup("bad-ip")
+	assert.EqualError(t, err, `invalid ip "bad-ip"`)
+
+	svc, err = New("", asnFile)
+	require.NoError(t, err)
+	res, err := svc.Lookup("1.2.3.4")
+	require.NoError(t, err)
+	assert.Equal(t, Info{ASN: 64500}, res, "asn only")
+}
+
+func TestService_New(t *testing.T) {
+	_, err := New("", "")
+	assert.EqualError(t, err, "no geoip database files")
+
+	_, err = New("/no-such-dir/country.mmdb", "")
+	assert.Error(t, err)
+
+	_, err = New("", "/no-such-dir/asn.mmdb")
+	assert.Error(t, err)
+}
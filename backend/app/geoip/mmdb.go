@@ -0,0 +1,295 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"os"
+)
+
+// metadataMarker starts metadata section at the end of mmdb file
+var metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+const maxDecodeDepth = 32 // nested maps, arrays and pointers limit, protects from loops in broken files
+
+// Reader makes lookups in MaxMind DB (mmdb) file, like GeoLite2-Country or GeoLite2-ASN.
+// The whole file is kept in memory.
+type Reader struct {
+	tree       []byte
+	data       decoder
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	ipv4Start  uint // node of ipv4 addresses in ipv6 tree
+}
+
+// Open reads mmdb file
+func Open(fileName string) (*Reader, error) {
+	buf, err := os.ReadFile(fileName) //nolint:gosec // file name from the server configuration
+	if err != nil {
+		return nil, fmt.Errorf("can't read mmdb file %s: %w", fileName, err)
+	}
+	return NewReader(buf)
+}
+
+// NewReader makes Reader from mmdb file content
+func NewReader(buf []byte) (*Reader, error) {
+	idx := bytes.LastIndex(buf, metadataMarker)
+	if idx < 0 {
+		return nil, errors.New("invalid mmdb file, no metadata")
+	}
+	meta, _, err := decoder{buf: buf[idx+len(metadataMarker):]}.decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("can't decode mmdb metadata: %w", err)
+	}
+	m, ok := meta.(map[string]any)
+	if !ok {
+		return nil, errors.New("invalid mmdb metadata")
+	}
+	r := &Reader{nodeCount: toUint(m["node_count"]), recordSize: toUint(m["record_size"]), ipVersion: toUint(m["ip_version"])}
+	if r.recordSize != 24 && r.recordSize != 28 && r.recordSize != 32 {
+		return nil, fmt.Errorf("unsupported mmdb record size %d", r.recordSize)
+	}
+	if r.ipVersion != 4 && r.ipVersion != 6 {
+		return nil, fmt.Errorf("unsupported mmdb ip version %d", r.ipVersion)
+	}
+	treeSize := r.nodeCount * r.recordSize / 4
+	if treeSize+16 > uint(idx) {
+		return nil, errors.New("invalid mmdb file, search tree exceeds file size")
+	}
+	r.tree = buf[:treeSize]
+	r.data = decoder{buf: buf[treeSize+16 : idx]}
+
+	if r.ipVersion == 6 { // ipv4 addresses are in ::/96 subtree
+		for i := 0; i < 96 && r.ipv4Start < r.nodeCount; i++ {
+			r.ipv4Start = r.readNode(r.ipv4Start, 0)
+		}
+	}
+	return r, nil
+}
+
+// Lookup returns the record of the ip, nil if not found
+func (r *Reader) Lookup(ip net.IP) (map[string]any, error) {
+	if len(ip) != net.IPv4len && len(ip) != net.IPv6len {
+		return nil, fmt.Errorf("invalid ip %v", ip)
+	}
+	node := uint(0)
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, node = ip4, r.ipv4Start
+	} else if r.ipVersion == 4 {
+		return nil, nil // ipv6 address in ipv4 only database
+	}
+
+	for i := 0; i < len(ip)*8 && node < r.nodeCount; i++ {
+		bit := uint(ip[i/8]>>(7-uint(i%8))) & 1
+		node = r.readNode(node, bit)
+	}
+	if node == r.nodeCount {
+		return nil, nil
+	}
+	if node < r.nodeCount {
+		return nil, errors.New("invalid mmdb search tree")
+	}
+	v, _, err := r.data.decode(node-r.nodeCount-16, 0)
+	if err != nil {
+		return nil, fmt.Errorf("can't decode mmdb record: %w", err)
+	}
+	rec, ok := v.(map[string]any)
+	if !ok {
+		return nil, errors.New("invalid mmdb record")
+	}
+	return rec, nil
+}
+
+// readNode returns left (bit 0) or right (bit 1) record of the node
+func (r *Reader) readNode(node, bit uint) uint {
+	b := r.tree
+	switch r.recordSize {
+	case 24:
+		off := node*6 + bit*3
+		return uint(b[off])<<16 | uint(b[off+1])<<8 | uint(b[off+2])
+	case 28:
+		off := node * 7
+		if bit == 0 {
+			return (uint(b[off+3])&0xF0)<<20 | uint(b[off])<<16 | uint(b[off+1])<<8 | uint(b[off+2])
+		}
+		return (uint(b[off+3])&0x0F)<<24 | uint(b[off+4])<<16 | uint(b[off+5])<<8 | uint(b[off+6])
+	default:
+		off := node*8 + bit*4
+		return uint(binary.BigEndian.Uint32(b[off : off+4]))
+	}
+}
+
+// decoder decodes mmdb data section values
+type decoder struct {
+	buf []byte
+}
+
+// mmdb data types
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+// decode returns value at offset and offset of the next value
+func (d decoder) decode(offset uint, depth int) (val any, next uint, err error) {
+	if depth > maxDecodeDepth {
+		return nil, 0, errors.New("mmdb data nested too deep")
+	}
+	ctrl, offset, err := d.bytes(offset, 1)
+	if err != nil {
+		return nil, 0, err
+	}
+	typ := uint(ctrl[0] >> 5)
+	if typ == typePointer {
+		ptr, next, e := d.pointer(ctrl[0], offset)
+		if e != nil {
+			return nil, 0, e
+		}
+		val, _, e = d.decode(ptr, depth+1)
+		return val, next, e
+	}
+	if typ == typeExtended {
+		ext, off, e := d.bytes(offset, 1)
+		if e != nil {
+			return nil, 0, e
+		}
+		typ, offset = 7+uint(ext[0]), off
+	}
+
+	size := uint(ctrl[0] & 0x1f)
+	if size >= 29 {
+		b, off, e := d.bytes(offset, size-28)
+		if e != nil {
+			return nil, 0, e
+		}
+		size = [...]uint{29, 285, 65821}[size-29] + toUintBytes(b)
+		offset = off
+	}
+
+	switch typ {
+	case typeMap:
+		res := make(map[string]any, size)
+		for range size {
+			k, off, e := d.decode(offset, depth+1)
+			if e != nil {
+				return nil, 0, e
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, errors.New("invalid mmdb map key")
+			}
+			if res[key], offset, e = d.decode(off, depth+1); e != nil {
+				return nil, 0, e
+			}
+		}
+		return res, offset, nil
+	case typeArray:
+		res := make([]any, 0, size)
+		for range size {
+			v, off, e := d.decode(offset, depth+1)
+			if e != nil {
+				return nil, 0, e
+			}
+			res, offset = append(res, v), off
+		}
+		return res, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	}
+
+	b, next, err := d.bytes(offset, size)
+	if err != nil {
+		return nil, 0, err
+	}
+	switch typ {
+	case typeString:
+		return string(b), next, nil
+	case typeBytes:
+		return bytes.Clone(b), next, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, errors.New("invalid mmdb double size")
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), next, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, errors.New("invalid mmdb float size")
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(b)), next, nil
+	case typeUint16, typeUint32, typeUint64:
+		if size > 8 {
+			return nil, 0, errors.New("invalid mmdb uint size")
+		}
+		return uint64(toUintBytes(b)), next, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, errors.New("invalid mmdb int32 size")
+		}
+		return int32(uint32(toUintBytes(b))), next, nil //nolint:gosec // int32 is stored as uint32 bits
+	case typeUint128:
+		return new(big.Int).SetBytes(b), next, nil
+	}
+	return nil, 0, fmt.Errorf("unsupported mmdb data type %d", typ)
+}
+
+// pointer returns offset the pointer points to and offset of the next value
+func (d decoder) pointer(ctrl byte, offset uint) (ptr, next uint, err error) {
+	ss, vvv := uint(ctrl>>3)&0x3, uint(ctrl&0x7)
+	b, next, err := d.bytes(offset, ss+1)
+	if err != nil {
+		return 0, 0, err
+	}
+	switch ss {
+	case 0:
+		ptr = vvv<<8 | toUintBytes(b)
+	case 1:
+		ptr = (vvv<<16 | toUintBytes(b)) + 2048
+	case 2:
+		ptr = (vvv<<24 | toUintBytes(b)) + 526336
+	default:
+		ptr = toUintBytes(b)
+	}
+	return ptr, next, nil
+}
+
+// bytes returns size bytes at offset and offset after them
+func (d decoder) bytes(offset, size uint) (b []byte, next uint, err error) {
+	if offset+size > uint(len(d.buf)) || offset+size < offset {
+		return nil, 0, errors.New("unexpected end of mmdb data")
+	}
+	return d.buf[offset : offset+size], offset + size, nil
+}
+
+func toUintBytes(b []byte) uint {
+	res := uint(0)
+	for _, v := range b {
+		res = res<<8 | uint(v)
+	}
+	return res
+}
+
+func toUint(v any) uint {
+	if u, ok := v.(uint64); ok {
+		return uint(u)
+	}
+	return 0
+}
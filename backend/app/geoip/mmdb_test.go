@@ -0,0 +1,342 @@
+package geoip
+
+import (
+	"encoding/binary"
+	"math"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReader_Lookup(t *testing.T) {
+	nets := []testNet{
+		{cidr: "1.2.3.0/24", data: map[string]any{"country": map[string]any{"iso_code": "DE"}}},
+		{cidr: "10.0.0.0/8", data: map[string]any{"country": mmdbPointer(9), "autonomous_system_number": uint32(64500)}}, // pointer to the first record country
+		{cidr: "2001:db8::/32", data: map[string]any{"country": map[string]any{"iso_code": "NL"}}},
+	}
+	for _, ipVersion := range []uint{4, 6} {
+		for _, recordSize := range []uint{24, 28, 32} {
+			t.Run("", func(t *testing.T) {
+				r, err := NewReader(buildMMDB(t, ipVersion, recordSize, nets))
+				require.NoError(t, err)
+
+				rec, err := r.Lookup(net.ParseIP("1.2.3.4"))
+				require.NoError(t, err)
+				assert.Equal(t, map[string]any{"country": map[string]any{"iso_code": "DE"}}, rec)
+
+				rec, err = r.Lookup(net.ParseIP("10.20.30.40"))
+				require.NoError(t, err)
+				assert.Equal(t, map[string]any{"country": map[string]any{"iso_code": "DE"},
+					"autonomous_system_number": uint64(64500)}, rec, "pointer resolved")
+
+				rec, err = r.Lookup(net.ParseIP("1.2.4.1"))
+				require.NoError(t, err)
+				assert.Nil(t, rec, "not in db")
+
+				rec, err = r.Lookup(net.ParseIP("2001:db8::1"))
+				require.NoError(t, err)
+				if ipVersion == 4 {
+					assert.Nil(t, rec, "ipv6 not supported by ipv4 db")
+					return
+				}
+				assert.Equal(t, map[string]any{"country": map[string]any{"iso_code": "NL"}}, rec)
+
+				rec, err = r.Lookup(net.ParseIP("2001:db9::1"))
+				require.NoError(t, err)
+				assert.Nil(t, rec)
+			})
+		}
+	}
+}
+
+func TestReader_Open(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "test.mmdb")
+	require.NoError(t, os.WriteFile(fileName, buildMMDB(t, 6, 24,
+		[]testNet{{cidr: "1.2.3.0/24", data: map[string]any{"v": "ok"}}}), 0o600))
+
+	r, err := Open(fileName)
+	require.NoError(t, err)
+	rec, err := r.Lookup(net.ParseIP("1.2.3.4"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"v": "ok"}, rec)
+
+	_, err = Open(filepath.Join(t.TempDir(), "no-such.mmdb"))
+	assert.Error(t, err)
+}
+
+func TestReader_Invalid(t *testing.T) {
+	_, err := NewReader([]byte("something"))
+	assert.EqualError(t, err, "invalid mmdb file, no metadata")
+
+	meta := func(m map[string]any) []byte { return append(slices.Clone(metadataMarker), encodeMMDB(m)...) }
+
+	_, err = NewReader(meta(map[string]any{"node_count": uint32(1), "record_size": uint16(20), "ip_version": uint16(4)}))
+	assert.EqualError(t, err, "unsupported mmdb record size 20")
+
+	_, err = NewReader(meta(map[string]any{"node_count": uint32(1), "record_size": uint16(24), "ip_version": uint16(5)}))
+	assert.EqualError(t, err, "unsupported mmdb ip version 5")
+
+	_, err = NewReader(meta(map[string]any{"node_count": uint32(100), "record_size": uint16(24), "ip_version": uint16(4)}))
+	assert.EqualError(t, err, "invalid mmdb file, search tree exceeds file size")
+
+	_, err = NewReader(meta(map[string]any{"node_count": "bad"})[:len(metadataMarker)+3])
+	assert.ErrorContains(t, err, "can't decode mmdb metadata")
+
+	_, err = NewReader(append(slices.Clone(metadataMarker), encodeMMDB("str")...))
+	assert.EqualError(t, err, "invalid mmdb metadata")
+
+	r, err := NewReader(buildMMDB(t, 4, 24, []testNet{{cidr: "1.2.3.0/24", data: "not a map"}}))
+	require.NoError(t, err)
+	_, err = r.Lookup(net.ParseIP("1.2.3.4"))
+	assert.EqualError(t, err, "invalid mmdb record")
+	_, err = r.Lookup(net.IP{1, 2, 3})
+	assert.EqualError(t, err, "invalid ip ?010203")
+}
+
+func TestDecoder(t *testing.T) {
+	tbl := []struct {
+		name string
+		buf  []byte
+		res  any
+	}{
+		{"string", encodeMMDB("blah"), "blah"},
+		{"long string", encodeMMDB(string(make([]byte, 300))), string(make([]byte, 300))},
+		{"uint16", encodeMMDB(uint16(513)), uint64(513)},
+		{"uint32 zero", encodeMMDB(uint32(0)), uint64(0)},
+		{"uint64", encodeMMDB(uint64(1) << 40), uint64(1) << 40},
+		{"bool", encodeMMDB(true), true},
+		{"array", encodeMMDB([]any{"a", uint16(1), false}), []any{"a", uint64(1), false}},
+		{"map", encodeMMDB(map[string]any{"k": map[string]any{"n": []any{}}}), map[string]any{"k": map[string]any{"n": []any{}}}},
+		{"double", encodeMMDB(1.5), 1.5},
+		{"float", binary.BigEndian.AppendUint32([]byte{0x04, 0x08}, math.Float32bits(2.5)), float32(2.5)},
+		{"int32", []byte{0x04, 0x01, 0xff, 0xff, 0xff, 0xfe}, int32(-2)},
+		{"bytes", []byte{0x82, 0x01, 0x02}, []byte{1, 2}},
+		{"uint128", []byte{0x02, 0x03, 0x01, 0x00}, big.NewInt(256)},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			v, next, err := decoder{buf: tt.buf}.decode(0, 0)
+			require.NoError(t, err)
+			assert.Equal(t, tt.res, v)
+			assert.Equal(t, uint(len(tt.buf)), next)
+		})
+	}
+
+	// pointers of all sizes
+	for _, ptr := range []uint{5, 3000, 600000, 1 << 27} {
+		buf := encodeMMDB(mmdbPointer(ptr))
+		p, next, err := decoder{buf: buf}.pointer(buf[0], 1)
+		require.NoError(t, err)
+		assert.Equal(t, ptr, p)
+		assert.Equal(t, uint(len(buf)), next)
+	}
+
+	// errors
+	for _, buf := range [][]byte{
+		{},                                // empty
+		{0x44, 'a'},                       // truncated string
+		{0x00},                            // truncated extended type
+		{0x5d},                            // truncated size
+		{0x61, 0x44},                      // truncated map key
+		{0xe1, 0x44, 'a', 0x41},           // map with non string key
+		{0x01, 0x04},                      // array with truncated value
+		{0x20},                            // truncated pointer
+		{0x20, 0x00},                      // pointer loop
+		{0x00, 0x05},                      // unsupported container type
+		{0x61, 0x01, 0x02},                // double with wrong size
+		{0x01, 0x08},                      // float with wrong size
+		{0xa9, 1, 2, 3, 4, 5, 6, 7, 8, 9}, // uint with wrong size
+		{0x05, 0x01, 1, 2, 3, 4, 5},       // int32 with wrong size
+	} {
+		_, _, err := decoder{buf: buf}.decode(0, 0)
+		assert.Error(t, err, "%x", buf)
+	}
+}
+
+// mmdbPointer is encoded as pointer to data section offset
+type mmdbPointer uint
+
+type testNet struct {
+	cidr string
+	data any
+}
+
+// buildMMDB makes mmdb file with given networks, ipv4 networks placed in ::/96 subtree for ipv6 database
+func buildMMDB(t *testing.T, ipVersion, recordSize uint, nets []testNet) []byte {
+	type node struct {
+		children [2]*node
+		data     int
+	}
+	root := &node{data: -1}
+	var data []byte
+	for _, n := range nets {
+		_, ipNet, err := net.ParseCIDR(n.cidr)
+		require.NoError(t, err)
+		ip, ones := ipNet.IP, 0
+		ones, _ = ipNet.Mask.Size()
+		var bits []byte
+		if ip4 := ip.To4(); ip4 != nil && ipVersion == 6 {
+			bits = make([]byte, 96)
+			ip = ip4
+		} else if ip4 == nil && ipVersion == 4 {
+			continue
+		}
+		for i := range ones {
+			bits = append(bits, ip[i/8]>>(7-uint(i%8))&1)
+		}
+		cur := root
+		for _, b := range bits {
+			if cur.children[b] == nil {
+				cur.children[b] = &node{data: -1}
+			}
+			cur = cur.children[b]
+		}
+		cur.data = len(data)
+		data = append(data, encodeMMDB(n.data)...)
+	}
+
+	// number inner nodes, leaves are data records
+	var nodes []*node
+	ids := map[*node]uint{}
+	queue := []*node{root}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		ids[n] = uint(len(nodes))
+		nodes = append(nodes, n)
+		for _, c := range n.children {
+			if c != nil && c.data < 0 {
+				queue = append(queue, c)
+			}
+		}
+	}
+	nodeCount := uint(len(nodes))
+	record := func(c *node) uint {
+		switch {
+		case c == nil:
+			return nodeCount
+		case c.data >= 0:
+			return nodeCount + 16 + uint(c.data)
+		default:
+			return ids[c]
+		}
+	}
+
+	var res []byte
+	for _, n := range nodes {
+		l, r := record(n.children[0]), record(n.children[1])
+		switch recordSize {
+		case 24:
+			res = append(res, byte(l>>16), byte(l>>8), byte(l), byte(r>>16), byte(r>>8), byte(r))
+		case 28:
+			res = append(res, byte(l>>16), byte(l>>8), byte(l), byte(l>>24)<<4|byte(r>>24)&0x0f, byte(r>>16), byte(r>>8), byte(r))
+		default:
+			res = binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(res, uint32(l)), uint32(r))
+		}
+	}
+	res = append(res, make([]byte, 16)...)
+	res = append(res, data...)
+	res = append(res, metadataMarker...)
+	return append(res, encodeMMDB(map[string]any{
+		"node_count": uint32(nodeCount), "record_size": uint16(recordSize), "ip_version": uint16(ipVersion),
+		"database_type": "Test", "languages": []any{"en"}, "binary_format_major_version": uint16(2),
+		"build_epoch": uint64(1700000000),
+	})...)
+}
+
+// encodeMMDB encodes value in mmdb data section format
+func encodeMMDB(v any) []byte {
+	ctrl := func(typ, size uint) []byte {
+		var res []byte
+		first := byte(typ << 5)
+		if typ > 7 {
+			first = 0
+		}
+		var ext []byte
+		switch {
+		case size < 29:
+			first |= byte(size)
+		case size < 285:
+			first |= 29
+			ext = []byte{byte(size - 29)}
+		case size < 65821:
+			first |= 30
+			ext = []byte{byte((size - 285) >> 8), byte(size - 285)}
+		default:
+			first |= 31
+			ext = []byte{byte((size - 65821) >> 16), byte((size - 65821) >> 8), byte(size - 65821)}
+		}
+		res = append(res, first)
+		if typ > 7 {
+			res = append(res, byte(typ-7))
+		}
+		return append(res, ext...)
+	}
+	uintBytes := func(u uint64) []byte {
+		b := binary.BigEndian.AppendUint64(nil, u)
+		for len(b) > 0 && b[0] == 0 {
+			b = b[1:]
+		}
+		return b
+	}
+
+	switch val := v.(type) {
+	case string:
+		return append(ctrl(typeString, uint(len(val))), val...)
+	case uint16:
+		b := uintBytes(uint64(val))
+		return append(ctrl(typeUint16, uint(len(b))), b...)
+	case uint32:
+		b := uintBytes(uint64(val))
+		return append(ctrl(typeUint32, uint(len(b))), b...)
+	case uint64:
+		b := uintBytes(val)
+		return append(ctrl(typeUint64, uint(len(b))), b...)
+	case float64:
+		return binary.BigEndian.AppendUint64(ctrl(typeDouble, 8), math.Float64bits(val))
+	case bool:
+		if val {
+			return ctrl(typeBool, 1)
+		}
+		return ctrl(typeBool, 0)
+	case []any:
+		res := ctrl(typeArray, uint(len(val)))
+		for _, item := range val {
+			res = append(res, encodeMMDB(item)...)
+		}
+		return res
+	case map[string]any:
+		res := ctrl(typeMap, uint(len(val)))
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			res = append(res, encodeMMDB(k)...)
+			res = append(res, encodeMMDB(val[k])...)
+		}
+		return res
+	case mmdbPointer:
+		p := uint(val)
+		switch {
+		case p < 2048:
+			return []byte{byte(typePointer<<5) | byte(p>>8), byte(p)}
+		case p < 526336:
+			p -= 2048
+			return []byte{byte(typePointer<<5) | 1<<3 | byte(p>>16), byte(p >> 8), byte(p)}
+		case p < 134744064:
+			p -= 526336
+			return []byte{byte(typePointer<<5) | 2<<3 | byte(p>>24), byte(p >> 16), byte(p >> 8), byte(p)}
+		default:
+			return binary.BigEndian.AppendUint32([]byte{byte(typePointer<<5) | 3<<3}, uint32(p))
+		}
+	}
+	panic("unsupported type")
+}
@@ -0,0 +1,64 @@
+// Package integrity checks consistency of the stored comments and reports found issues to admins.
+package integrity
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark42/backend/app/notify"
+	"github.com/umputun/remark42/backend/app/store/service"
+)
+
+// Store checks integrity of the site
+type Store interface {
+	CheckIntegrity(siteID string) (service.IntegrityReport, error)
+}
+
+// Notifier sends messages to admins
+type Notifier interface {
+	SubmitAdminMessage(msg notify.AdminMessage)
+}
+
+// Checker runs integrity check of the sites and sends report to admins if any issues found
+type Checker struct {
+	Store     Store
+	Notifier  Notifier // optional, reports only kept by Store if not set
+	Sites     []string
+	RemarkURL string // used for the link to the report details
+}
+
+// Do checks all sites, one by one. Run nightly by the scheduler.
+func (c *Checker) Do() {
+	for _, siteID := range c.Sites {
+		report, err := c.Store.CheckIntegrity(siteID)
+		if err != nil {
+			log.Printf("[WARN] integrity check of %s failed, %v", siteID, err)
+			continue
+		}
+		if report.Total() == 0 || c.Notifier == nil {
+			continue
+		}
+		c.Notifier.SubmitAdminMessage(notify.AdminMessage{SiteID: siteID,
+			Subject: fmt.Sprintf("Integrity check of %s found %d issues", siteID, report.Total()),
+			Text:    c.summary(report)})
+	}
+}
+
+// summary makes text of the report with number of issues by kind and the link to details
+func (c *Checker) summary(report service.IntegrityReport) string {
+	kinds := make([]string, 0, len(report.Counts))
+	for kind := range report.Counts {
+		kinds = append(kinds, kind)
+	}
+	slices.Sort(kinds)
+	lines := []string{fmt.Sprintf("Checked %d posts and %d comments.", report.Posts, report.Comments)}
+	for _, kind := range kinds {
+		lines = append(lines, fmt.Sprintf("%s: %d", kind, report.Counts[kind]))
+	}
+	lines = append(lines, "Details: "+c.RemarkURL+"/api/v1/admin/integrity?site="+url.QueryEscape(report.SiteID))
+	return strings.Join(lines, "\n")
+}
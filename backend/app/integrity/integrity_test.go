@@ -0,0 +1,53 @@
+package integrity
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/umputun/remark42/backend/app/notify"
+	"github.com/umputun/remark42/backend/app/store/service"
+)
+
+type mockStore struct {
+	mu      sync.Mutex
+	calls   []string
+	reports map[string]service.IntegrityReport
+}
+
+func (m *mockStore) CheckIntegrity(siteID string) (service.IntegrityReport, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, siteID)
+	report, ok := m.reports[siteID]
+	if !ok {
+		return service.IntegrityReport{}, errors.New("unknown site")
+	}
+	return report, nil
+}
+
+type mockNotifier struct{ msgs []notify.AdminMessage }
+
+func (m *mockNotifier) SubmitAdminMessage(msg notify.AdminMessage) { m.msgs = append(m.msgs, msg) }
+
+func TestChecker_Do(t *testing.T) {
+	st := &mockStore{reports: map[string]service.IntegrityReport{
+		"site1": {SiteID: "site1", Posts: 2, Comments: 10, Counts: map[string]int{}},
+		"site 2": {SiteID: "site 2", Posts: 3, Comments: 20,
+			Counts: map[string]int{service.IssueOrphan: 2, service.IssueCount: 1}},
+	}}
+	ntf := &mockNotifier{}
+	c := Checker{Store: st, Notifier: ntf, Sites: []string{"site1", "site 2", "bad"}, RemarkURL: "https://remark.example.com"}
+
+	c.Do()
+	assert.Equal(t, []string{"site1", "site 2", "bad"}, st.calls)
+	assert.Equal(t, []notify.AdminMessage{{SiteID: "site 2", Subject: "Integrity check of site 2 found 3 issues",
+		Text: "Checked 3 posts and 20 comments.\ncount: 1\norphan: 2\n" +
+			"Details: https://remark.example.com/api/v1/admin/integrity?site=site+2"}}, ntf.msgs, "only sites with issues reported")
+
+	c.Notifier = nil
+	c.Do()
+	assert.Len(t, st.calls, 6, "checked without notifier")
+}
@@ -0,0 +1,141 @@
+package iplist
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+)
+
+const maxDNSBLCache = 10000 // cached lookup results, expired ones dropped when reached
+
+// Resolver looks up addresses of the host, like net.Resolver
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// DNSBL checks ips against DNS-based block lists, like zen.spamhaus.org. An ip is listed if any zone
+// resolves its reversed address to 127.0.0.0/8. Results are cached for TTL, failed lookups are not cached.
+type DNSBL struct {
+	Zones    []string
+	Resolver Resolver      // net.DefaultResolver if not set
+	TTL      time.Duration // lifetime of cached results, 1h if not set
+	Timeout  time.Duration // timeout of a lookup in all zones, 2s if not set
+
+	mu    sync.Mutex
+	cache map[netip.Addr]dnsblEntry
+}
+
+type dnsblEntry struct {
+	listed  bool
+	expires time.Time
+}
+
+// Contains checks if ip is listed by any of the zones
+func (d *DNSBL) Contains(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || len(d.Zones) == 0 {
+		return false
+	}
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() {
+		return false
+	}
+
+	d.mu.Lock()
+	if e, ok := d.cache[addr]; ok && time.Now().Before(e.expires) {
+		d.mu.Unlock()
+		return e.listed
+	}
+	d.mu.Unlock()
+
+	listed, err := d.lookup(addr)
+	if err != nil {
+		log.Printf("[WARN] dnsbl lookup of %s failed, %v", addr, err)
+		return false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.cache == nil || len(d.cache) >= maxDNSBLCache {
+		d.cache = d.dropExpired()
+	}
+	ttl := d.TTL
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+	d.cache[addr] = dnsblEntry{listed: listed, expires: time.Now().Add(ttl)}
+	return listed
+}
+
+// lookup queries all zones for the address, stops on the first listing. Fails if no zone answered.
+func (d *DNSBL) lookup(addr netip.Addr) (bool, error) {
+	resolver := d.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	timeout := d.Timeout
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var errs []error
+	for _, zone := range d.Zones {
+		addrs, err := resolver.LookupHost(ctx, reverseAddr(addr)+"."+strings.Trim(zone, "."))
+		if err != nil {
+			var dnsErr *net.DNSError
+			if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+				continue // not listed
+			}
+			errs = append(errs, fmt.Errorf("zone %s: %w", zone, err))
+			continue
+		}
+		for _, a := range addrs {
+			if res, e := netip.ParseAddr(a); e == nil && res.Is4() && res.As4()[0] == 127 {
+				return true, nil
+			}
+		}
+	}
+	if len(errs) == len(d.Zones) {
+		return false, errors.Join(errs...)
+	}
+	return false, nil
+}
+
+// dropExpired returns cache without expired entries, empty if all entries are still valid to keep its size limited
+func (d *DNSBL) dropExpired() map[netip.Addr]dnsblEntry {
+	res := map[netip.Addr]dnsblEntry{}
+	now := time.Now()
+	for k, v := range d.cache {
+		if now.Before(v.expires) {
+			res[k] = v
+		}
+	}
+	if len(res) >= maxDNSBLCache {
+		return map[netip.Addr]dnsblEntry{}
+	}
+	return res
+}
+
+// reverseAddr makes dnsbl query name of the address, reversed octets for ipv4 and reversed nibbles for ipv6
+func reverseAddr(addr netip.Addr) string {
+	if addr.Is4() {
+		b := addr.As4()
+		return fmt.Sprintf("%d.%d.%d.%d", b[3], b[2], b[1], b[0])
+	}
+	b := addr.As16()
+	const hexDigits = "0123456789abcdef"
+	res := make([]string, 0, 32)
+	for i := len(b) - 1; i >= 0; i-- {
+		res = append(res, string(hexDigits[b[i]&0x0f]), string(hexDigits[b[i]>>4]))
+	}
+	return strings.Join(res, ".")
+}
@@ -0,0 +1,110 @@
+package iplist
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type resolverMock struct {
+	mu      sync.Mutex
+	records map[string][]string
+	fail    map[string]bool
+	queries []string
+}
+
+func (m *resolverMock) LookupHost(_ context.Context, host string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queries = append(m.queries, host)
+	if m.fail[host] {
+		return nil, errors.New("timeout")
+	}
+	if res, ok := m.records[host]; ok {
+		return res, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func TestDNSBL_Contains(t *testing.T) {
+	res := &resolverMock{records: map[string][]string{
+		"4.3.2.1.bl.example.com":    {"127.0.0.2"},
+		"5.3.2.1.other.example.com": {"127.0.0.4"},
+		"6.3.2.1.bl.example.com":    {"10.0.0.1"}, // not a listing answer
+		"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.bl.example.com": {"127.0.0.2"},
+	}}
+	d := DNSBL{Zones: []string{"bl.example.com", "other.example.com."}, Resolver: res}
+
+	tbl := []struct {
+		ip  string
+		res bool
+	}{
+		{"1.2.3.4", true},
+		{"::ffff:1.2.3.4", true},
+		{"1.2.3.5", true},
+		{"1.2.3.6", false},
+		{"1.2.3.7", false},
+		{"2001:db8::1", true},
+		{"2001:db8::2", false},
+		{"127.0.0.1", false},
+		{"10.0.0.1", false},
+		{"bad", false},
+		{"", false},
+	}
+	for _, tt := range tbl {
+		assert.Equal(t, tt.res, d.Contains(tt.ip), tt.ip)
+	}
+
+	res.queries = nil
+	assert.True(t, d.Contains("1.2.3.4"))
+	assert.False(t, d.Contains("1.2.3.7"))
+	assert.Empty(t, res.queries, "results cached")
+
+	d.mu.Lock()
+	for k, v := range d.cache {
+		v.expires = time.Now().Add(-time.Second)
+		d.cache[k] = v
+	}
+	d.mu.Unlock()
+	assert.True(t, d.Contains("1.2.3.4"))
+	assert.Equal(t, []string{"4.3.2.1.bl.example.com"}, res.queries, "expired result looked up again")
+}
+
+func TestDNSBL_Failures(t *testing.T) {
+	res := &resolverMock{records: map[string][]string{"4.3.2.1.other.example.com": {"127.0.0.2"}},
+		fail: map[string]bool{"4.3.2.1.bl.example.com": true, "5.3.2.1.bl.example.com": true}}
+	d := DNSBL{Zones: []string{"bl.example.com", "other.example.com"}, Resolver: res}
+	assert.True(t, d.Contains("1.2.3.4"), "listed by the zone answered")
+
+	d.Zones = []string{"bl.example.com"}
+	assert.False(t, d.Contains("1.2.3.5"))
+	d.mu.Lock()
+	_, cached := d.cache[netip.MustParseAddr("1.2.3.5")]
+	d.mu.Unlock()
+	assert.False(t, cached, "failed lookup not cached")
+
+	assert.False(t, (&DNSBL{Resolver: res}).Contains("1.2.3.4"), "no zones")
+}
+
+func TestDNSBL_CacheLimit(t *testing.T) {
+	d := DNSBL{Zones: []string{"bl.example.com"}, Resolver: &resolverMock{}}
+	d.cache = map[netip.Addr]dnsblEntry{}
+	for i := range maxDNSBLCache {
+		d.cache[netip.AddrFrom4([4]byte{1, byte(i >> 16), byte(i >> 8), byte(i)})] = dnsblEntry{expires: time.Now().Add(time.Hour)}
+	}
+	assert.False(t, d.Contains("2.2.2.2"))
+	require.Len(t, d.cache, 1, "cache reset when full of valid entries")
+}
+
+func TestReverseAddr(t *testing.T) {
+	assert.Equal(t, "4.3.2.1", reverseAddr(netip.MustParseAddr("1.2.3.4")))
+	assert.Equal(t, "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2",
+		reverseAddr(netip.MustParseAddr("2001:db8::1")))
+}
@@ -0,0 +1,137 @@
+// Package iplist provides lists of ip addresses and networks, like Tor exit nodes or known VPN ranges,
+// loaded from urls or local files and refreshed periodically by the scheduler, and checks of ips against DNS-based block lists.
+package iplist
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark42/backend/app/scheduler"
+)
+
+// TorExitList is the list of Tor exit nodes published by the Tor project
+const TorExitList = "https://check.torproject.org/torbulkexitlist"
+
+// List is a set of ips and networks loaded from sources. Each source is a http(s) url or a local file
+// with an ip or cidr per line, empty lines and lines starting with # ignored. Lines of Tor exit-addresses
+// format ("ExitAddress <ip> <date>") are supported as well.
+type List struct {
+	Name    string
+	Sources []string
+	Client  *http.Client // used for url sources, http.DefaultClient if not set
+
+	mu    sync.RWMutex
+	addrs map[netip.Addr]struct{}
+	nets  []netip.Prefix
+}
+
+// Contains checks if ip is in the list
+func (l *List) Contains(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if _, ok := l.addrs[addr]; ok {
+		return true
+	}
+	for _, n := range l.nets {
+		if n.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Refresh reloads the list from all sources. The current list is kept if any source fails.
+func (l *List) Refresh(ctx context.Context) error {
+	addrs, nets := map[netip.Addr]struct{}{}, []netip.Prefix{}
+	for _, src := range l.Sources {
+		if err := l.load(ctx, src, addrs, &nets); err != nil {
+			return fmt.Errorf("can't load %s list from %s: %w", l.Name, src, err)
+		}
+	}
+	l.mu.Lock()
+	l.addrs, l.nets = addrs, nets
+	l.mu.Unlock()
+	log.Printf("[DEBUG] %s list refreshed, %d addresses, %d networks", l.Name, len(addrs), len(nets))
+	return nil
+}
+
+// Job returns scheduler job refreshing the list on start and then every period, previous list kept on errors
+func (l *List) Job(period time.Duration) scheduler.Job {
+	return scheduler.Job{Name: l.Name + " list refresh", Next: scheduler.Every(period), Start: true,
+		Run: func(ctx context.Context) {
+			if err := l.Refresh(ctx); err != nil {
+				log.Printf("[WARN] %v, previous list kept", err)
+			}
+		}}
+}
+
+// load reads the source and adds its entries to addrs and nets
+func (l *List) load(ctx context.Context, src string, addrs map[netip.Addr]struct{}, nets *[]netip.Prefix) error {
+	rd, err := l.open(ctx, src)
+	if err != nil {
+		return err
+	}
+	defer rd.Close()
+
+	scanner := bufio.NewScanner(rd)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		entry := fields[0]
+		if entry == "ExitAddress" && len(fields) > 1 {
+			entry = fields[1]
+		}
+		if strings.Contains(entry, "/") {
+			if p, e := netip.ParsePrefix(entry); e == nil {
+				*nets = append(*nets, p.Masked())
+			}
+			continue
+		}
+		if addr, e := netip.ParseAddr(entry); e == nil {
+			addrs[addr.Unmap()] = struct{}{}
+		}
+	}
+	return scanner.Err()
+}
+
+// open returns reader of url or local file source
+func (l *List) open(ctx context.Context, src string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(src, "http://") && !strings.HasPrefix(src, "https://") {
+		return os.Open(src) //nolint:gosec // source set by the server configuration
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	client := l.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.Body, nil
+}
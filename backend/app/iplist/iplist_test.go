@@ -0,0 +1,87 @@
+package iplist
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestList_Refresh(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/bad" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte("# tor exits\n1.1.1.1\n\nExitNode 63F4\nExitAddress 2.2.2.2 2024-01-01 10:00:00\n2001:db8::1\n"))
+	}))
+	defer ts.Close()
+
+	file := filepath.Join(t.TempDir(), "vpn.txt")
+	require.NoError(t, os.WriteFile(file, []byte("10.0.0.0/8 some vpn\n2001:db9::/32\nbad-entry\n300.1.1.1/8\n"), 0o600))
+
+	l := List{Name: "test", Sources: []string{ts.URL + "/list", file}}
+	assert.False(t, l.Contains("1.1.1.1"), "not loaded yet")
+	require.NoError(t, l.Refresh(context.Background()))
+
+	tbl := []struct {
+		ip  string
+		res bool
+	}{
+		{"1.1.1.1", true},
+		{"::ffff:1.1.1.1", true},
+		{"2.2.2.2", true},
+		{"2001:db8::1", true},
+		{"10.20.30.40", true},
+		{"2001:db9::5", true},
+		{"3.3.3.3", false},
+		{"2001:db8::2", false},
+		{"bad-ip", false},
+		{"", false},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.ip, func(t *testing.T) {
+			assert.Equal(t, tt.res, l.Contains(tt.ip))
+		})
+	}
+
+	l.Sources = append(l.Sources, ts.URL+"/bad")
+	assert.ErrorContains(t, l.Refresh(context.Background()), "unexpected status 500")
+	assert.True(t, l.Contains("1.1.1.1"), "previous list kept")
+
+	l.Sources = []string{filepath.Join(t.TempDir(), "no-such.txt")}
+	assert.Error(t, l.Refresh(context.Background()))
+	assert.True(t, l.Contains("10.1.1.1"), "previous list kept")
+}
+
+func TestList_Job(t *testing.T) {
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if calls.Add(1) > 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte("1.1.1.1\n"))
+	}))
+	defer ts.Close()
+
+	l := List{Name: "test", Sources: []string{ts.URL}, Client: ts.Client()}
+	job := l.Job(time.Hour)
+	assert.Equal(t, "test list refresh", job.Name)
+	assert.True(t, job.Start, "refreshed on start")
+	now := time.Now()
+	assert.Equal(t, now.Add(time.Hour), job.Next(now))
+
+	job.Run(context.Background())
+	assert.True(t, l.Contains("1.1.1.1"))
+	job.Run(context.Background())
+	assert.Equal(t, int32(2), calls.Load())
+	assert.True(t, l.Contains("1.1.1.1"), "previous list kept")
+}
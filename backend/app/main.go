@@ -16,13 +16,16 @@ import (
 
 // Opts with all cli commands and flags
 type Opts struct {
-	ServerCmd  cmd.ServerCommand  `command:"server"`
-	ImportCmd  cmd.ImportCommand  `command:"import"`
-	BackupCmd  cmd.BackupCommand  `command:"backup"`
-	RestoreCmd cmd.RestoreCommand `command:"restore"`
-	AvatarCmd  cmd.AvatarCommand  `command:"avatar"`
-	CleanupCmd cmd.CleanupCommand `command:"cleanup"`
-	RemapCmd   cmd.RemapCommand   `command:"remap"`
+	ServerCmd   cmd.ServerCommand   `command:"server"`
+	ImportCmd   cmd.ImportCommand   `command:"import"`
+	BackupCmd   cmd.BackupCommand   `command:"backup"`
+	RestoreCmd  cmd.RestoreCommand  `command:"restore"`
+	AvatarCmd   cmd.AvatarCommand   `command:"avatar"`
+	CleanupCmd  cmd.CleanupCommand  `command:"cleanup"`
+	RemapCmd    cmd.RemapCommand    `command:"remap"`
+	RekeyCmd    cmd.RekeyCommand    `command:"rekey"`
+	RerenderCmd cmd.RerenderCommand `command:"rerender"`
+	BenchCmd    cmd.BenchCommand    `command:"bench"`
 
 	RemarkURL string `long:"url" env:"REMARK_URL" required:"true" description:"url to remark"`
 	// SharedSecret is only used in server command, but defined for all commands for historical reasons
@@ -27,6 +27,7 @@ func Test_Main(t *testing.T) {
 
 	port := chooseRandomUnusedPort()
 	os.Args = []string{"test", "server", "--secret=123456", "--store.bolt.path=" + dir, "--backup=/tmp",
+		"--settings.file=" + t.TempDir() + "/settings.db",
 		"--avatar.fs.path=" + dir, "--port=" + strconv.Itoa(port), "--url=https://demo.remark42.com", "--dbg", "--notify.type=none"}
 
 	done := make(chan struct{})
@@ -78,6 +79,7 @@ func TestMain_WithWebhook(t *testing.T) {
 
 	port := chooseRandomUnusedPort()
 	os.Args = []string{"test", "server", "--secret=123456", "--store.bolt.path=" + dir, "--backup=/tmp",
+		"--settings.file=" + t.TempDir() + "/settings.db",
 		"--avatar.fs.path=" + dir, "--port=" + strconv.Itoa(port), "--url=https://demo.remark42.com", "--dbg",
 		"--admin-passwd=password", "--site=remark", "--notify.admins=webhook"}
 
@@ -10,6 +10,8 @@ import (
 	"time"
 
 	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark42/backend/app/notify"
 )
 
 // AutoBackup struct handles daily backups params for siteID
@@ -19,6 +21,13 @@ type AutoBackup struct {
 	SiteID         string
 	KeepMax        int
 	Duration       time.Duration
+	Verifier       *Verifier // restores each backup and compares it with the live store, optional
+	Notifier       Notifier  // alerts admins about unusable backups, optional
+}
+
+// Notifier sends messages to admins
+type Notifier interface {
+	SubmitAdminMessage(msg notify.AdminMessage)
 }
 
 // Do runs daily export to local files, keeps up to keepMax backups for given siteID
@@ -31,7 +40,7 @@ func (ab AutoBackup) Do(ctx context.Context) {
 	for {
 		select {
 		case <-tick.C:
-			if _, err := ab.makeBackup(); err != nil {
+			if err := ab.backup(); err != nil {
 				log.Printf("[WARN] auto-backup for %s failed, %s", ab.SiteID, err)
 				continue
 			}
@@ -44,6 +53,64 @@ func (ab AutoBackup) Do(ctx context.Context) {
 	}
 }
 
+// backup makes the backup and verifies it if Verifier set. Unusable backup returned as error,
+// so older backups are kept.
+func (ab AutoBackup) backup() error {
+	if ab.Verifier == nil {
+		_, err := ab.makeBackup()
+		return err
+	}
+	before, err := ab.Verifier.Digest(ab.SiteID)
+	if err != nil {
+		log.Printf("[WARN] can't get digest of %s, backup not verified, %v", ab.SiteID, err)
+		_, err = ab.makeBackup()
+		return err
+	}
+	backupFile, err := ab.makeBackup()
+	if err != nil {
+		return err
+	}
+	return ab.verify(backupFile, before)
+}
+
+// verify restores the backup and compares it with the live store before and after the backup.
+// The comparison is inconclusive if the store changed during the backup and the backup doesn't match it.
+func (ab AutoBackup) verify(backupFile string, before Digest) error {
+	restored, err := ab.Verifier.Restore(backupFile, ab.SiteID)
+	if err != nil {
+		return ab.alert(backupFile, fmt.Sprintf("backup can't be restored, %v", err))
+	}
+	if restored == before {
+		log.Printf("[INFO] backup %s verified, %d posts, %d comments", backupFile, restored.Posts, restored.Comments)
+		return nil
+	}
+	after, err := ab.Verifier.Digest(ab.SiteID)
+	if err != nil {
+		log.Printf("[WARN] can't get digest of %s, backup not verified, %v", ab.SiteID, err)
+		return nil
+	}
+	if restored == after {
+		log.Printf("[INFO] backup %s verified, %d posts, %d comments", backupFile, restored.Posts, restored.Comments)
+		return nil
+	}
+	if before != after {
+		log.Printf("[WARN] %s changed during backup, backup %s not verified", ab.SiteID, backupFile)
+		return nil
+	}
+	return ab.alert(backupFile, fmt.Sprintf("restored backup doesn't match the store: posts %d of %d, comments %d of %d, "+
+		"users %d of %d, checksum %s instead of %s", restored.Posts, before.Posts, restored.Comments, before.Comments,
+		restored.Users, before.Users, restored.Checksum, before.Checksum))
+}
+
+// alert notifies admins about unusable backup and returns it as error
+func (ab AutoBackup) alert(backupFile, details string) error {
+	if ab.Notifier != nil {
+		ab.Notifier.SubmitAdminMessage(notify.AdminMessage{SiteID: ab.SiteID, Subject: "Backup of " + ab.SiteID + " is unusable",
+			Text: fmt.Sprintf("Backup %s failed verification: %s.\nOlder backups are kept.", backupFile, details)})
+	}
+	return fmt.Errorf("backup %s failed verification: %s", backupFile, details)
+}
+
 func (ab AutoBackup) makeBackup() (string, error) {
 	log.Printf("[DEBUG] make backup for %s", ab.SiteID)
 	backupFile := fmt.Sprintf("%s/backup-%s-%s.gz", ab.BackupLocation, ab.SiteID, time.Now().Format("20060102"))
@@ -0,0 +1,106 @@
+package migrator
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/engine"
+	"github.com/umputun/remark42/backend/app/store/service"
+)
+
+// Verifier checks backups by restoring them into a scratch store and comparing the result with the live store
+type Verifier struct {
+	Store      Store       // live store
+	AdminStore admin.Store // keys of the sites, used by the scratch store
+	TempDir    string      // location of scratch stores, system temp directory if empty
+}
+
+// Digest summarizes the site's data: numbers of records and checksum of comments
+type Digest struct {
+	Posts    int    `json:"posts"`
+	Comments int    `json:"comments"`
+	Users    int    `json:"users"` // users with meta data, like blocked or verified
+	Checksum string `json:"checksum"`
+}
+
+// Digest returns digest of the site in the live store
+func (v *Verifier) Digest(siteID string) (Digest, error) {
+	return digest(v.Store, siteID)
+}
+
+// Restore imports the gzipped backup into a scratch store, removed afterward, and returns digest of the restored site
+func (v *Verifier) Restore(backupFile, siteID string) (Digest, error) {
+	dir, err := os.MkdirTemp(v.TempDir, "remark42-verify-")
+	if err != nil {
+		return Digest{}, fmt.Errorf("can't make scratch directory: %w", err)
+	}
+	defer os.RemoveAll(dir) //nolint:errcheck // nothing to do with the error
+
+	eng, err := engine.NewBoltDB(bolt.Options{Timeout: 30 * time.Second},
+		engine.BoltSite{SiteID: siteID, FileName: filepath.Join(dir, siteID+".db")})
+	if err != nil {
+		return Digest{}, fmt.Errorf("can't make scratch store: %w", err)
+	}
+	scratch := &service.DataStore{Engine: eng, AdminStore: v.AdminStore}
+	defer scratch.Close() //nolint:errcheck // scratch store removed anyway
+
+	fh, err := os.Open(backupFile) //nolint:gosec // file made by backup
+	if err != nil {
+		return Digest{}, fmt.Errorf("can't open backup file %s: %w", backupFile, err)
+	}
+	defer fh.Close() //nolint:errcheck // read only
+	gz, err := gzip.NewReader(fh)
+	if err != nil {
+		return Digest{}, fmt.Errorf("can't read gz %s: %w", backupFile, err)
+	}
+	if _, err = (&Native{DataStore: scratch}).Import(gz, siteID); err != nil {
+		return Digest{}, fmt.Errorf("can't import %s: %w", backupFile, err)
+	}
+	return digest(scratch, siteID)
+}
+
+// digest counts posts, comments and users with meta data of the site and makes checksum of comments,
+// in the same order the export uses
+func digest(s Store, siteID string) (Digest, error) {
+	res := Digest{}
+	users, _, err := s.Metas(siteID)
+	if err != nil {
+		return Digest{}, fmt.Errorf("can't get meta of %s: %w", siteID, err)
+	}
+	res.Users = len(users)
+
+	posts, err := s.List(siteID, 0, 0)
+	if err != nil {
+		return Digest{}, fmt.Errorf("can't list posts of %s: %w", siteID, err)
+	}
+	sort.Slice(posts, func(i, j int) bool { return posts[i].URL < posts[j].URL })
+	h := sha256.New()
+	for _, p := range posts {
+		comments, e := s.Find(store.Locator{SiteID: siteID, URL: p.URL}, "time", adminUser)
+		if e != nil {
+			return Digest{}, fmt.Errorf("can't get comments of %s: %w", p.URL, e)
+		}
+		res.Posts++
+		res.Comments += len(comments)
+		for _, c := range comments {
+			for _, field := range []string{p.URL, c.ID, c.ParentID, c.User.ID, c.Text, strconv.FormatBool(c.Deleted),
+				c.Timestamp.UTC().Format(time.RFC3339Nano)} {
+				_, _ = h.Write([]byte(field))
+				_, _ = h.Write([]byte{0})
+			}
+		}
+	}
+	res.Checksum = hex.EncodeToString(h.Sum(nil))
+	return res, nil
+}
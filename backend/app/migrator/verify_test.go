@@ -0,0 +1,167 @@
+package migrator
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/umputun/remark42/backend/app/notify"
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/cold"
+	"github.com/umputun/remark42/backend/app/store/service"
+)
+
+type mockNotifier struct{ msgs []notify.AdminMessage }
+
+func (m *mockNotifier) SubmitAdminMessage(msg notify.AdminMessage) { m.msgs = append(m.msgs, msg) }
+
+func TestVerifier_Restore(t *testing.T) {
+	b, teardown := prep(t) // write 2 comments
+	defer teardown()
+	require.NoError(t, b.SetVerified("radio-t", "user1", true))
+	require.NoError(t, b.SetBlock("radio-t", "user2", true, time.Hour))
+	_, err := b.Create(store.Comment{ID: "reply", ParentID: "efbc17f177ee1a1c0ee6e1e025749966ec071adc", Text: "reply",
+		Locator: store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}, User: store.User{ID: "user3", Name: "user3"}})
+	require.NoError(t, err)
+
+	loc := t.TempDir()
+	v := &Verifier{Store: b, AdminStore: b.AdminStore, TempDir: t.TempDir()}
+	live, err := v.Digest("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, 2, live.Posts)
+	assert.Equal(t, 3, live.Comments)
+	assert.Equal(t, 2, live.Users)
+	assert.Len(t, live.Checksum, 64)
+
+	bk := AutoBackup{BackupLocation: loc, SiteID: "radio-t", Exporter: &Native{DataStore: b}}
+	backupFile, err := bk.makeBackup()
+	require.NoError(t, err)
+	restored, err := v.Restore(backupFile, "radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, live, restored)
+	entries, err := os.ReadDir(v.TempDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries, "scratch store removed")
+
+	// changed comment makes different checksum
+	_, err = b.EditComment(store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}, "reply", service.EditRequest{Text: "edited"})
+	require.NoError(t, err)
+	changed, err := v.Digest("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, live.Comments, changed.Comments)
+	assert.NotEqual(t, live.Checksum, changed.Checksum)
+
+	// broken backups
+	notGz := filepath.Join(loc, "not-gz.gz")
+	require.NoError(t, os.WriteFile(notGz, []byte("blah"), 0o600))
+	_, err = v.Restore(notGz, "radio-t")
+	assert.ErrorContains(t, err, "can't read gz")
+
+	notJSON := filepath.Join(loc, "not-json.gz")
+	fh, err := os.Create(notJSON) //nolint:gosec // test file
+	require.NoError(t, err)
+	gz := gzip.NewWriter(fh)
+	_, err = gz.Write([]byte("not json"))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	require.NoError(t, fh.Close())
+	_, err = v.Restore(notJSON, "radio-t")
+	assert.ErrorContains(t, err, "can't import")
+
+	_, err = v.Restore(filepath.Join(loc, "missing.gz"), "radio-t")
+	assert.ErrorContains(t, err, "can't open backup file")
+}
+
+func TestVerifier_ColdPosts(t *testing.T) {
+	b, teardown := prep(t) // write 2 comments
+	defer teardown()
+	v := &Verifier{Store: b, AdminStore: b.AdminStore, TempDir: t.TempDir()}
+	live, err := v.Digest("radio-t")
+	require.NoError(t, err)
+
+	b.ColdStore, err = cold.NewBoltStorage(filepath.Join(t.TempDir(), "cold.db"), bolt.Options{})
+	require.NoError(t, err)
+	require.NoError(t, b.SetReadOnly(store.Locator{SiteID: "radio-t", URL: "https://radio-t.com"}, true))
+	frozen, err := b.FreezePosts("radio-t", -time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, 2, frozen)
+
+	digest, err := v.Digest("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, live, digest, "frozen posts included")
+
+	bk := AutoBackup{BackupLocation: t.TempDir(), SiteID: "radio-t", Exporter: &Native{DataStore: b}}
+	backupFile, err := bk.makeBackup()
+	require.NoError(t, err)
+	restored, err := v.Restore(backupFile, "radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, live, restored, "frozen posts exported")
+
+	buf := bytes.Buffer{}
+	_, err = (&Native{DataStore: b}).Export(&buf, "radio-t")
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), `{"url":"https://radio-t.com","read_only":true}`, "read-only status exported")
+}
+
+func TestBackup_Verify(t *testing.T) {
+	b, teardown := prep(t) // write 2 comments
+	defer teardown()
+	loc := t.TempDir()
+	ntf := &mockNotifier{}
+	bk := AutoBackup{BackupLocation: loc, SiteID: "radio-t", KeepMax: 3, Exporter: &Native{DataStore: b},
+		Verifier: &Verifier{Store: b, AdminStore: b.AdminStore, TempDir: t.TempDir()}, Notifier: ntf}
+
+	require.NoError(t, bk.backup())
+	assert.Empty(t, ntf.msgs, "backup verified")
+
+	// backup made by the exporter missing comments doesn't match the store
+	bk.Exporter = &partialExporter{Native: Native{DataStore: b}}
+	err := bk.backup()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "restored backup doesn't match the store: posts 1 of 2, comments 1 of 2, users 0 of 0")
+	require.Len(t, ntf.msgs, 1)
+	assert.Equal(t, "radio-t", ntf.msgs[0].SiteID)
+	assert.Equal(t, "Backup of radio-t is unusable", ntf.msgs[0].Subject)
+	assert.Contains(t, ntf.msgs[0].Text, "Older backups are kept.")
+
+	bk.Exporter = &mockExporter{}
+	err = bk.backup()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "backup can't be restored")
+	assert.Len(t, ntf.msgs, 2)
+
+	bk.Verifier = nil
+	assert.NoError(t, bk.backup(), "not verified")
+	assert.Len(t, ntf.msgs, 2)
+}
+
+// partialExporter exports only the first post of the site
+type partialExporter struct {
+	Native
+}
+
+func (p *partialExporter) Export(w io.Writer, siteID string) (int, error) {
+	if err := p.exportMeta(siteID, w); err != nil {
+		return 0, err
+	}
+	comments, err := p.DataStore.Find(store.Locator{SiteID: siteID, URL: "https://radio-t.com"}, "time", adminUser)
+	if err != nil {
+		return 0, err
+	}
+	enc := json.NewEncoder(w)
+	for _, c := range comments {
+		if err = enc.Encode(c); err != nil {
+			return 0, err
+		}
+	}
+	return len(comments), nil
+}
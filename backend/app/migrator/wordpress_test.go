@@ -84,7 +84,8 @@ func TestWordPress_Convert(t *testing.T) {
 			SiteID: "testWP",
 			URL:    "https://realmenweardress.es/2010/07/do-you-rp/",
 		},
-		Text: `<p>[…] I know I’m a bit loony with my attachment to my bankers.  I’m glad I’m not the only one. […]</p>` + "\n",
+		Text:      `<p>[…] I know I’m a bit loony with my attachment to my bankers.  I’m glad I’m not the only one. […]</p>` + "\n",
+		PlainText: `[…] I know I’m a bit loony with my attachment to my bankers.  I’m glad I’m not the only one. […]`,
 		User: store.User{
 			Name: "Wednesday Reading &laquo; Cynwise&#039;s Battlefield Manual",
 			ID:   "wordpress_" + store.EncodeID("Wednesday Reading &laquo; Cynwise&#039;s Battlefield Manual"),
@@ -93,6 +94,7 @@ func TestWordPress_Convert(t *testing.T) {
 		Imported: true,
 	}
 	exp1.Timestamp, _ = time.Parse(wpTimeLayout, "2010-07-21 14:02:08")
+	exp1.RenderKey = store.NewCommentFormatter(&wp).RenderKey(false)
 	assert.Equal(t, exp1, comments[1])
 }
 
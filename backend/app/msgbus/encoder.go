@@ -0,0 +1,92 @@
+package msgbus
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hamba/avro/v2"
+
+	"github.com/umputun/remark42/backend/app/store/event"
+)
+
+// Encoder defines format of published events
+type Encoder interface {
+	fmt.Stringer
+	Encode(e event.Event) ([]byte, error)
+	ContentType() string
+}
+
+// JSON encodes events to json, the same as returned by events API
+type JSON struct{}
+
+// Encode event to json
+func (JSON) Encode(e event.Event) ([]byte, error) { return json.Marshal(e) }
+
+// ContentType of json events
+func (JSON) ContentType() string { return "application/json" }
+
+func (JSON) String() string { return "json" }
+
+// AvroSchema is the schema of avro-encoded events. Type specific data is kept as json object in data field,
+// as its fields differ between event types.
+const AvroSchema = `{
+	"type": "record",
+	"name": "Event",
+	"namespace": "com.remark42",
+	"fields": [
+		{"name": "id", "type": "long"},
+		{"name": "type", "type": "string"},
+		{"name": "site", "type": "string"},
+		{"name": "url", "type": "string", "default": ""},
+		{"name": "comment_id", "type": "string", "default": ""},
+		{"name": "user_id", "type": "string", "default": ""},
+		{"name": "data", "type": "string", "default": ""},
+		{"name": "time", "type": {"type": "long", "logicalType": "timestamp-millis"}}
+	]
+}`
+
+// Avro encodes events to avro binary with AvroSchema, without schema registry framing
+type Avro struct {
+	schema avro.Schema
+}
+
+// avroEvent is the event in the form of AvroSchema
+type avroEvent struct {
+	ID        int64     `avro:"id"`
+	Type      string    `avro:"type"`
+	SiteID    string    `avro:"site"`
+	URL       string    `avro:"url"`
+	CommentID string    `avro:"comment_id"`
+	UserID    string    `avro:"user_id"`
+	Data      string    `avro:"data"`
+	Timestamp time.Time `avro:"time"`
+}
+
+// NewAvro makes avro encoder with AvroSchema
+func NewAvro() (*Avro, error) {
+	schema, err := avro.Parse(AvroSchema)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse avro schema: %w", err)
+	}
+	return &Avro{schema: schema}, nil
+}
+
+// Encode event to avro
+func (a *Avro) Encode(e event.Event) ([]byte, error) {
+	rec := avroEvent{ID: int64(e.ID), Type: e.Type, SiteID: e.SiteID, URL: e.URL, CommentID: e.CommentID, //nolint:gosec // id fits
+		UserID: e.UserID, Timestamp: e.Timestamp}
+	if len(e.Data) > 0 {
+		data, err := json.Marshal(e.Data)
+		if err != nil {
+			return nil, fmt.Errorf("can't marshal data: %w", err)
+		}
+		rec.Data = string(data)
+	}
+	return avro.Marshal(a.schema, rec)
+}
+
+// ContentType of avro events
+func (a *Avro) ContentType() string { return "avro/binary" }
+
+func (a *Avro) String() string { return "avro" }
@@ -0,0 +1,47 @@
+package msgbus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hamba/avro/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store/event"
+)
+
+func TestJSON(t *testing.T) {
+	e := event.Event{ID: 5, Type: event.CommentPinned, SiteID: "site1", CommentID: "c1", Data: map[string]any{"status": true},
+		Timestamp: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+	data, err := JSON{}.Encode(e)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"id":5,"type":"comment.pinned","site":"site1","comment_id":"c1","data":{"status":true},
+		"time":"2026-01-01T12:00:00Z"}`, string(data))
+	assert.Equal(t, "application/json", JSON{}.ContentType())
+	assert.Equal(t, "json", JSON{}.String())
+}
+
+func TestAvro(t *testing.T) {
+	enc, err := NewAvro()
+	require.NoError(t, err)
+	assert.Equal(t, "avro/binary", enc.ContentType())
+	assert.Equal(t, "avro", enc.String())
+
+	ts := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	data, err := enc.Encode(event.Event{ID: 5, Type: event.CommentVoted, SiteID: "site1", URL: "https://example.com/post",
+		CommentID: "c1", UserID: "u1", Data: map[string]any{"value": true}, Timestamp: ts})
+	require.NoError(t, err)
+
+	res := avroEvent{}
+	require.NoError(t, avro.Unmarshal(avro.MustParse(AvroSchema), data, &res))
+	assert.Equal(t, avroEvent{ID: 5, Type: event.CommentVoted, SiteID: "site1", URL: "https://example.com/post", CommentID: "c1",
+		UserID: "u1", Data: `{"value":true}`, Timestamp: ts}, res)
+
+	data, err = enc.Encode(event.Event{ID: 6, Type: event.UserDeleted, SiteID: "site1", Timestamp: ts})
+	require.NoError(t, err)
+	res = avroEvent{}
+	require.NoError(t, avro.Unmarshal(avro.MustParse(AvroSchema), data, &res))
+	assert.Empty(t, res.Data, "no data")
+	assert.Equal(t, event.UserDeleted, res.Type)
+}
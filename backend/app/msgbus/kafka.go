@@ -0,0 +1,56 @@
+package msgbus
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Kafka publishes events to Kafka topics, partitioned by site. Topics should exist, unless brokers create them.
+type Kafka struct {
+	writer  *kafka.Writer
+	brokers string
+}
+
+// KafkaParams defines connection to Kafka brokers
+type KafkaParams struct {
+	Brokers []string      // host:port of bootstrap brokers
+	Timeout time.Duration // read and write timeout
+}
+
+// NewKafka makes kafka publisher. Brokers are connected on the first publish.
+func NewKafka(params KafkaParams) *Kafka {
+	w := &kafka.Writer{
+		Addr:         kafka.TCP(params.Brokers...),
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		MaxAttempts:  3,
+		BatchTimeout: 10 * time.Millisecond,
+		ReadTimeout:  params.Timeout,
+		WriteTimeout: params.Timeout,
+	}
+	return &Kafka{writer: w, brokers: strings.Join(params.Brokers, ",")}
+}
+
+// Publish sends the message to the topic, keyed by site to keep events of the site in one partition
+func (k *Kafka) Publish(ctx context.Context, msg Message) error {
+	m := kafka.Message{Topic: msg.Topic, Key: []byte(msg.Key), Value: msg.Payload,
+		Headers: []kafka.Header{{Key: "content-type", Value: []byte(msg.ContentType)}}}
+	if msg.ID != "" {
+		m.Headers = append(m.Headers, kafka.Header{Key: "id", Value: []byte(msg.ID)})
+	}
+	if err := k.writer.WriteMessages(ctx, m); err != nil {
+		return fmt.Errorf("can't publish to %s: %w", msg.Topic, err)
+	}
+	return nil
+}
+
+// Close flushes pending messages and closes connections
+func (k *Kafka) Close() error {
+	return k.writer.Close()
+}
+
+func (k *Kafka) String() string { return "kafka " + k.brokers }
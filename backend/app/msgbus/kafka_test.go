@@ -0,0 +1,22 @@
+package msgbus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKafka_PublishError(t *testing.T) {
+	k := NewKafka(KafkaParams{Brokers: []string{"127.0.0.1:1", "127.0.0.1:2"}, Timeout: 100 * time.Millisecond})
+	assert.Equal(t, "kafka 127.0.0.1:1,127.0.0.1:2", k.String())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err := k.Publish(ctx, Message{Topic: "events", Key: "site1", Payload: []byte("{}")})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "can't publish to events")
+	require.NoError(t, k.Close())
+}
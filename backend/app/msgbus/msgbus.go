@@ -0,0 +1,130 @@
+// Package msgbus publishes domain events to a message bus, like NATS JetStream or Kafka, so external
+// consumers can follow comments activity without polling the REST API.
+package msgbus
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark42/backend/app/store/event"
+)
+
+// Publisher defines interface of a message bus driver
+type Publisher interface {
+	fmt.Stringer
+	// Publish sends the message to the topic, key is used for partitioning and deduplication
+	Publish(ctx context.Context, msg Message) error
+	Close() error
+}
+
+// Message is an encoded event to publish
+type Message struct {
+	Topic       string
+	Key         string // site of the event, keeps events of the site in order
+	ID          string // unique id of the event, site:id, empty for events not journaled
+	ContentType string
+	Payload     []byte
+}
+
+// Options defines topics and format of published events
+type Options struct {
+	Topic     string        // topic template, {site} and {type} replaced by event's site and type, dots in type kept
+	Encoder   Encoder       // JSON by default
+	QueueSize int           // events waiting to be published, extra ones dropped, 1000 by default
+	Timeout   time.Duration // max time to publish an event, 5s by default
+}
+
+// Service publishes submitted events in background, in order of submission. Safe for concurrent use.
+type Service struct {
+	pub   Publisher
+	opts  Options
+	queue chan event.Event
+	done  chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+const defaultTopic = "remark42.{site}.{type}"
+
+// NewService makes event publishing service and starts its background publishing
+func NewService(pub Publisher, opts Options) *Service {
+	if opts.Topic == "" {
+		opts.Topic = defaultTopic
+	}
+	if opts.Encoder == nil {
+		opts.Encoder = JSON{}
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 1000
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	res := &Service{pub: pub, opts: opts, queue: make(chan event.Event, opts.QueueSize), done: make(chan struct{})}
+	go res.do()
+	log.Printf("[INFO] create message bus service with %s, topic %s, format %s", pub, opts.Topic, opts.Encoder)
+	return res
+}
+
+// Submit queues the event for publishing, drops it if the queue is full
+func (s *Service) Submit(e event.Event) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.queue <- e:
+	default:
+		log.Printf("[WARN] message bus queue is full, dropped %s of %s", e.Type, e.SiteID)
+	}
+}
+
+// Close publishes queued events and closes the publisher
+func (s *Service) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.queue)
+	s.mu.Unlock()
+	<-s.done
+	return s.pub.Close()
+}
+
+func (s *Service) do() {
+	defer close(s.done)
+	for e := range s.queue {
+		if err := s.publish(e); err != nil {
+			log.Printf("[WARN] failed to publish %s of %s, %v", e.Type, e.SiteID, err)
+		}
+	}
+}
+
+// publish encodes the event and sends it to the topic made from the template
+func (s *Service) publish(e event.Event) error {
+	payload, err := s.opts.Encoder.Encode(e)
+	if err != nil {
+		return fmt.Errorf("can't encode event: %w", err)
+	}
+	msg := Message{Topic: Topic(s.opts.Topic, e), Key: e.SiteID, ContentType: s.opts.Encoder.ContentType(), Payload: payload}
+	if e.ID > 0 {
+		msg.ID = fmt.Sprintf("%s:%d", e.SiteID, e.ID)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.opts.Timeout)
+	defer cancel()
+	return s.pub.Publish(ctx, msg)
+}
+
+// Topic makes topic of the event from the template, replacing {site} and {type}
+func Topic(template string, e event.Event) string {
+	return strings.NewReplacer("{site}", e.SiteID, "{type}", e.Type).Replace(template)
+}
@@ -0,0 +1,109 @@
+package msgbus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store/event"
+)
+
+func TestService_Publish(t *testing.T) {
+	pub := &mockPublisher{}
+	s := NewService(pub, Options{})
+	ts := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	s.Submit(event.Event{ID: 1, Type: event.CommentCreated, SiteID: "site1", CommentID: "c1", Timestamp: ts})
+	s.Submit(event.Event{Type: event.UserBlocked, SiteID: "site2", UserID: "u1", Timestamp: ts})
+	require.Eventually(t, func() bool { return len(pub.get()) == 2 }, time.Second, time.Millisecond)
+	pub.setFail()
+	s.Submit(event.Event{ID: 2, Type: event.CommentVoted, SiteID: "site1", Timestamp: ts})
+	require.NoError(t, s.Close())
+	require.NoError(t, s.Close(), "second close ignored")
+	s.Submit(event.Event{ID: 3, Type: event.CommentVoted, SiteID: "site1"})
+
+	msgs := pub.get()
+	require.Len(t, msgs, 2, "failed one logged")
+	assert.Equal(t, "remark42.site1.comment.created", msgs[0].Topic)
+	assert.Equal(t, "site1", msgs[0].Key)
+	assert.Equal(t, "site1:1", msgs[0].ID)
+	assert.Equal(t, "application/json", msgs[0].ContentType)
+	e := event.Event{}
+	require.NoError(t, json.Unmarshal(msgs[0].Payload, &e))
+	assert.Equal(t, event.Event{ID: 1, Type: event.CommentCreated, SiteID: "site1", CommentID: "c1", Timestamp: ts}, e)
+
+	assert.Equal(t, "remark42.site2.user.blocked", msgs[1].Topic)
+	assert.Empty(t, msgs[1].ID, "not journaled")
+	assert.True(t, pub.closed)
+}
+
+func TestService_QueueFull(t *testing.T) {
+	pub := &mockPublisher{block: make(chan struct{})}
+	s := NewService(pub, Options{QueueSize: 1, Topic: "events"})
+	s.Submit(event.Event{ID: 1, SiteID: "site1"}) // taken by publisher and blocked
+	require.Eventually(t, func() bool { return len(s.queue) == 0 }, time.Second, time.Millisecond)
+	s.Submit(event.Event{ID: 2, SiteID: "site1"}) // queued
+	s.Submit(event.Event{ID: 3, SiteID: "site1"}) // dropped
+	close(pub.block)
+	require.NoError(t, s.Close())
+
+	msgs := pub.get()
+	require.Len(t, msgs, 2)
+	assert.Equal(t, "site1:1", msgs[0].ID)
+	assert.Equal(t, "site1:2", msgs[1].ID)
+	assert.Equal(t, "events", msgs[1].Topic)
+}
+
+func TestTopic(t *testing.T) {
+	e := event.Event{Type: event.CommentCreated, SiteID: "blog"}
+	assert.Equal(t, "remark42.blog.comment.created", Topic(defaultTopic, e))
+	assert.Equal(t, "comments-blog", Topic("comments-{site}", e))
+	assert.Equal(t, "events", Topic("events", e))
+}
+
+type mockPublisher struct {
+	mu     sync.Mutex
+	msgs   []Message
+	fail   bool
+	closed bool
+	block  chan struct{}
+}
+
+func (m *mockPublisher) Publish(_ context.Context, msg Message) error {
+	if m.block != nil {
+		<-m.block
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.fail {
+		return errors.New("failed")
+	}
+	m.msgs = append(m.msgs, msg)
+	return nil
+}
+
+func (m *mockPublisher) setFail() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.fail = true
+}
+
+func (m *mockPublisher) get() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.msgs
+}
+
+func (m *mockPublisher) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	return nil
+}
+
+func (m *mockPublisher) String() string { return "mock" }
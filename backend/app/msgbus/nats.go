@@ -0,0 +1,62 @@
+package msgbus
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// NATS publishes events to NATS JetStream. Subjects should be bound to a stream, created by operator.
+type NATS struct {
+	conn *nats.Conn
+	js   jetstream.JetStream
+	urls string
+}
+
+// NATSParams defines connection to NATS servers
+type NATSParams struct {
+	URLs    []string      // nats://host:port, tried in order
+	Timeout time.Duration // connection timeout
+}
+
+// NewNATS connects to NATS servers
+func NewNATS(params NATSParams) (*NATS, error) {
+	urls := strings.Join(params.URLs, ",")
+	conn, err := nats.Connect(urls, nats.Name("remark42"), nats.Timeout(params.Timeout), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, fmt.Errorf("can't connect to nats %s: %w", urls, err)
+	}
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("can't make jetstream context: %w", err)
+	}
+	return &NATS{conn: conn, js: js, urls: urls}, nil
+}
+
+// Publish sends the message to the subject and waits for the stream's ack. Message id is set as Nats-Msg-Id,
+// for deduplication of events published twice by JetStream.
+func (n *NATS) Publish(ctx context.Context, msg Message) error {
+	m := nats.NewMsg(msg.Topic)
+	m.Data = msg.Payload
+	m.Header.Set("Content-Type", msg.ContentType)
+	m.Header.Set("Remark42-Site", msg.Key)
+	if msg.ID != "" {
+		m.Header.Set(jetstream.MsgIDHeader, msg.ID)
+	}
+	if _, err := n.js.PublishMsg(ctx, m); err != nil {
+		return fmt.Errorf("can't publish to %s: %w", msg.Topic, err)
+	}
+	return nil
+}
+
+// Close drains and closes the connection
+func (n *NATS) Close() error {
+	return n.conn.Drain()
+}
+
+func (n *NATS) String() string { return "nats " + n.urls }
@@ -0,0 +1,15 @@
+package msgbus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNATS_ConnectError(t *testing.T) {
+	_, err := NewNATS(NATSParams{URLs: []string{"nats://127.0.0.1:1"}, Timeout: 100 * time.Millisecond})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "can't connect to nats nats://127.0.0.1:1")
+}
@@ -0,0 +1,122 @@
+package notify
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+)
+
+// CollapseWindows defines windows collapsing notifications of the user about the same thread, per site.
+// The first notification starts the window and is sent immediately, the following ones of the window are held
+// and sent at its end as a single one with the latest comment and the number of collapsed ones, starting the next
+// window. Zero window sends notifications immediately.
+type CollapseWindows struct {
+	Default time.Duration            // window for sites not listed
+	Sites   map[string]time.Duration // windows of the sites
+}
+
+// Window returns the collapse window of the site
+func (w CollapseWindows) Window(siteID string) time.Duration {
+	if win, ok := w.Sites[siteID]; ok {
+		return win
+	}
+	return w.Default
+}
+
+// collapseKey identifies notifications collapsed together, a thread for the target of the destination
+type collapseKey struct {
+	destination string // "email" or "telegram"
+	target      string // email address or telegram id
+	siteID      string
+	url         string
+}
+
+// heldNotification collects notifications of the window
+type heldNotification struct {
+	req   Request // request of the latest comment
+	count int     // number of held notifications, zero if nothing to send at the end of the window
+	timer *time.Timer
+}
+
+// collapser holds notifications of users until their window is over, released ones sent to the queue. Thread safe.
+type collapser struct {
+	mu      sync.Mutex
+	held    map[collapseKey]*heldNotification
+	queue   chan<- Request
+	stopped bool
+}
+
+// hold keeps notification of the request for targets of the destination with open window, and starts the window
+// for other targets. Returns targets to notify now, all of them if collapsing is stopped.
+func (c *collapser) hold(req Request, destination string, targets []string, window time.Duration) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stopped {
+		return targets
+	}
+	if c.held == nil {
+		c.held = map[collapseKey]*heldNotification{}
+	}
+	res := []string{}
+	for _, target := range targets {
+		key := collapseKey{destination: destination, target: target, siteID: req.Comment.Locator.SiteID, url: req.Comment.Locator.URL}
+		if h, ok := c.held[key]; ok {
+			h.req, h.count = req, h.count+1
+			continue
+		}
+		c.held[key] = &heldNotification{timer: time.AfterFunc(window, func() { c.release(key, window) })}
+		res = append(res, target)
+	}
+	return res
+}
+
+// release sends the single notification collapsing ones held for the key and starts the next window,
+// the window is closed if nothing held
+func (c *collapser) release(key collapseKey, window time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h, ok := c.held[key]
+	if !ok || c.stopped {
+		return
+	}
+	if h.count == 0 {
+		delete(c.held, key)
+		return
+	}
+
+	req := h.req
+	req.Emails, req.Telegrams = nil, nil
+	switch key.destination {
+	case "email":
+		req.Emails = []string{key.target}
+	case "telegram":
+		req.Telegrams = []string{key.target}
+	}
+	req.Destinations = []string{key.destination}
+	req.Welcome, req.welcomeEmail = "", ""
+	req.usersOnly, req.collapsed = true, h.count-1
+	h.req, h.count = Request{}, 0
+	h.timer.Reset(window)
+	select {
+	case c.queue <- req:
+	default:
+		log.Printf("[WARN] can't send collapsed notification to queue, %+v", req.Comment)
+	}
+}
+
+// stop drops held notifications, none released after the call
+func (c *collapser) stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stopped = true
+	dropped := 0
+	for _, h := range c.held {
+		h.timer.Stop()
+		dropped += h.count
+	}
+	if dropped > 0 {
+		log.Printf("[WARN] dropped %d held notifications", dropped)
+	}
+	c.held = nil
+}
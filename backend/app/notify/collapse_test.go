@@ -0,0 +1,140 @@
+package notify
+
+import (
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store"
+)
+
+// emailMockDest is a mock destination named as email one
+type emailMockDest struct {
+	*MockDest
+}
+
+func (m emailMockDest) String() string { return "email: mock" }
+
+func TestCollapseWindows(t *testing.T) {
+	w := CollapseWindows{Default: time.Minute, Sites: map[string]time.Duration{"s1": time.Hour, "s2": 0}}
+	assert.Equal(t, time.Hour, w.Window("s1"))
+	assert.Equal(t, time.Duration(0), w.Window("s2"), "disabled for the site")
+	assert.Equal(t, time.Minute, w.Window("s3"))
+	assert.Equal(t, time.Duration(0), CollapseWindows{}.Window("s1"))
+}
+
+func TestService_Collapse(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		dest := emailMockDest{&MockDest{id: 1}}
+		dataStore := &mockStore{data: map[string]store.Comment{}, userDetails: map[string]string{"u1": "u1@example.com"}}
+		loc := store.Locator{SiteID: "s1", URL: "https://example.com/post1"}
+		dataStore.data["p1"] = store.Comment{ID: "p1", Locator: loc, User: store.User{ID: "u1"}}
+		dataStore.data["p2"] = store.Comment{ID: "p2", ParentID: "p1", Locator: loc, User: store.User{ID: "u2"}}
+		dataStore.data["p3"] = store.Comment{ID: "p3", ParentID: "p1", Locator: loc, User: store.User{ID: "u3"}}
+		dataStore.data["p4"] = store.Comment{ID: "p4", ParentID: "p1", Locator: loc, User: store.User{ID: "u4"}}
+
+		s := NewService(dataStore, 10, dest)
+		s.Collapse = CollapseWindows{Sites: map[string]time.Duration{"s1": time.Minute}}
+		s.Submit(Request{Comment: dataStore.data["p2"], Welcome: "hi"})
+		synctest.Wait()
+		res := dest.Get()
+		require.Len(t, res, 1)
+		assert.Equal(t, []string{"u1@example.com"}, res[0].Emails, "first notification of the window sent immediately")
+		assert.False(t, res[0].usersOnly)
+
+		time.Sleep(10 * time.Second)
+		s.Submit(Request{Comment: dataStore.data["p3"]})
+		time.Sleep(10 * time.Second)
+		s.Submit(Request{Comment: dataStore.data["p4"]})
+		synctest.Wait()
+		res = dest.Get()
+		require.Len(t, res, 3, "comments notified for admins")
+		assert.Empty(t, res[1].Emails, "user notification held")
+		assert.Empty(t, res[2].Emails, "user notification held")
+
+		time.Sleep(40 * time.Second)
+		synctest.Wait()
+		res = dest.Get()
+		require.Len(t, res, 4, "single notification at the end of the window")
+		assert.Equal(t, "p4", res[3].Comment.ID, "latest comment")
+		assert.Equal(t, "p1", res[3].parent.ID)
+		assert.Equal(t, []string{"u1@example.com"}, res[3].Emails)
+		assert.Empty(t, res[3].Telegrams)
+		assert.Equal(t, []string{"email"}, res[3].Destinations)
+		assert.Equal(t, 1, res[3].collapsed)
+		assert.True(t, res[3].usersOnly)
+		assert.Empty(t, res[3].Welcome)
+
+		// next window started by the released notification, single held notification isn't collapsed
+		s.Submit(Request{Comment: dataStore.data["p2"]})
+		synctest.Wait()
+		res = dest.Get()
+		require.Len(t, res, 5)
+		assert.Empty(t, res[4].Emails, "held in the next window")
+		time.Sleep(time.Minute)
+		synctest.Wait()
+		res = dest.Get()
+		require.Len(t, res, 6)
+		assert.Equal(t, "p2", res[5].Comment.ID)
+		assert.Equal(t, 0, res[5].collapsed)
+
+		// window without notifications closed, the next one sent immediately
+		time.Sleep(time.Minute + time.Second)
+		s.Submit(Request{Comment: dataStore.data["p3"]})
+		synctest.Wait()
+		res = dest.Get()
+		require.Len(t, res, 7)
+		assert.Equal(t, []string{"u1@example.com"}, res[6].Emails)
+		time.Sleep(time.Minute)
+		synctest.Wait()
+		assert.Len(t, dest.Get(), 7, "nothing held")
+
+		// no window for the site
+		p5 := store.Comment{ID: "p5", ParentID: "p1", Locator: store.Locator{SiteID: "s2", URL: loc.URL}, User: store.User{ID: "u2"}}
+		s.Submit(Request{Comment: p5})
+		synctest.Wait()
+		res = dest.Get()
+		require.Len(t, res, 8)
+		assert.Equal(t, []string{"u1@example.com"}, res[7].Emails, "sent immediately")
+
+		// held notifications dropped on close
+		s.Submit(Request{Comment: dataStore.data["p2"]})
+		s.Submit(Request{Comment: dataStore.data["p4"]})
+		synctest.Wait()
+		s.Close()
+		time.Sleep(time.Minute)
+		synctest.Wait()
+		assert.Len(t, dest.Get(), 10)
+	})
+}
+
+func TestService_CollapseDestinations(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		dest := emailMockDest{&MockDest{id: 1}}
+		dataStore := &mockStore{data: map[string]store.Comment{}, userDetails: map[string]string{"u1": "u1"}}
+		loc := store.Locator{SiteID: "s1", URL: "https://example.com/post1"}
+		dataStore.data["p1"] = store.Comment{ID: "p1", Locator: loc, User: store.User{ID: "u1"}}
+		dataStore.data["p2"] = store.Comment{ID: "p2", ParentID: "p1", Locator: loc, User: store.User{ID: "u2"}}
+
+		s := NewService(dataStore, 10, dest)
+		s.Collapse = CollapseWindows{Default: time.Minute}
+		s.Submit(Request{Comment: dataStore.data["p2"], Destinations: []string{"email"}})
+		s.Submit(Request{Comment: dataStore.data["p2"], Destinations: []string{"email"}})
+		synctest.Wait()
+		res := dest.Get()
+		require.Len(t, res, 2)
+		assert.Equal(t, []string{"u1"}, res[0].Emails, "first sent")
+		assert.Empty(t, res[1].Emails, "held")
+		assert.Equal(t, []string{"u1"}, res[1].Telegrams, "not held as not sent to telegram")
+
+		time.Sleep(time.Minute)
+		synctest.Wait()
+		res = dest.Get()
+		require.Len(t, res, 3)
+		assert.Equal(t, []string{"u1"}, res[2].Emails)
+		s.Close()
+	})
+}
@@ -0,0 +1,198 @@
+package notify
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Delivery is a record of the notification sent to a destination, kept for debugging of delivery problems
+type Delivery struct {
+	ID          string    `json:"id"`
+	Destination string    `json:"destination"` // destination's name, like "email" or "telegram"
+	Kind        string    `json:"kind"`        // "comment", "verification", "message" or "admin"
+	SiteID      string    `json:"site"`
+	CommentID   string    `json:"comment_id,omitempty"`
+	UserID      string    `json:"user_id,omitempty"` // user verifying email or receiving message
+	Status      string    `json:"status"`            // "sent" or "failed"
+	Error       string    `json:"error,omitempty"`   // error with the destination's response snippet, if failed
+	LatencyMs   int64     `json:"latency_ms"`
+	Retries     int       `json:"retries"` // number of resends
+	Time        time.Time `json:"time"`    // time of the last attempt
+
+	seq   int64
+	dest  Destination
+	req   *Request
+	verif *VerificationRequest
+	msg   *UserMessage
+	admin *AdminMessage
+}
+
+// Delivery kinds and statuses
+const (
+	DeliveryComment      = "comment"
+	DeliveryVerification = "verification"
+	DeliveryMessage      = "message"
+	DeliveryAdmin        = "admin"
+	DeliverySent         = "sent"
+	DeliveryFailed       = "failed"
+)
+
+const deliveriesLimit = 50 // recent deliveries kept per destination
+const deliveryErrorLimit = 256
+
+// ErrDeliveryNotFound returned by Resend for unknown or evicted delivery
+var ErrDeliveryNotFound = errors.New("delivery not found")
+
+// deliveryLog keeps recent deliveries of each destination. Thread safe.
+type deliveryLog struct {
+	mu      sync.Mutex
+	lastID  int64
+	records map[string][]*Delivery // destination name -> deliveries, oldest first
+}
+
+// Deliveries returns recent deliveries of the site, newest first, filtered by destination's name if set
+func (s *Service) Deliveries(siteID, destination string) []Delivery {
+	s.deliveries.mu.Lock()
+	defer s.deliveries.mu.Unlock()
+	res := []Delivery{}
+	for dest, records := range s.deliveries.records {
+		if destination != "" && dest != destination {
+			continue
+		}
+		for _, d := range records {
+			if d.SiteID == siteID {
+				res = append(res, *d)
+			}
+		}
+	}
+	slices.SortFunc(res, func(a, b Delivery) int { return cmp.Or(b.Time.Compare(a.Time), cmp.Compare(b.seq, a.seq)) })
+	return res
+}
+
+// Resend sends the notification of the site's delivery to the same destination again, synchronously,
+// and returns the delivery updated with the result.
+func (s *Service) Resend(ctx context.Context, siteID, id string) (Delivery, error) {
+	s.deliveries.mu.Lock()
+	var rec *Delivery
+	for _, records := range s.deliveries.records {
+		if idx := slices.IndexFunc(records, func(d *Delivery) bool { return d.ID == id && d.SiteID == siteID }); idx >= 0 {
+			rec = records[idx]
+		}
+	}
+	s.deliveries.mu.Unlock()
+	if rec == nil {
+		return Delivery{}, ErrDeliveryNotFound
+	}
+
+	st := time.Now()
+	var err error
+	switch {
+	case rec.req != nil:
+		err = rec.dest.Send(ctx, *rec.req)
+	case rec.verif != nil:
+		err = rec.dest.SendVerification(ctx, *rec.verif)
+	case rec.msg != nil:
+		if ms, ok := rec.dest.(MessageSender); ok {
+			err = ms.SendMessage(ctx, *rec.msg)
+		}
+	case rec.admin != nil:
+		if as, ok := rec.dest.(AdminMessageSender); ok {
+			err = as.SendAdminMessage(ctx, *rec.admin)
+		}
+	}
+
+	s.deliveries.mu.Lock()
+	defer s.deliveries.mu.Unlock()
+	rec.Retries++
+	rec.setResult(st, err)
+	return *rec, err
+}
+
+// send sends the request to the destination, counted by the site's quota, and records the delivery
+func (s *Service) send(d Destination, req Request) error {
+	if s.Quota != nil && !s.Quota.UseNotifyQuota(req.Comment.Locator.SiteID) {
+		return nil // rejection logged by quota
+	}
+	st := time.Now()
+	err := d.Send(s.ctx, req)
+	s.record(&Delivery{Destination: destinationName(d), Kind: DeliveryComment, SiteID: req.Comment.Locator.SiteID,
+		CommentID: req.Comment.ID, dest: d, req: &req}, st, err)
+	return err
+}
+
+// sendVerification sends the verification request to the destination and records the delivery
+func (s *Service) sendVerification(d Destination, req VerificationRequest) error {
+	st := time.Now()
+	err := d.SendVerification(s.ctx, req)
+	s.record(&Delivery{Destination: destinationName(d), Kind: DeliveryVerification, SiteID: req.SiteID,
+		UserID: req.User, dest: d, verif: &req}, st, err)
+	return err
+}
+
+// sendMessage sends the message to the destination, counted by the site's quota, and records the delivery
+func (s *Service) sendMessage(d Destination, ms MessageSender, msg UserMessage) error {
+	if s.Quota != nil && !s.Quota.UseNotifyQuota(msg.SiteID) {
+		return nil // rejection logged by quota
+	}
+	st := time.Now()
+	err := ms.SendMessage(s.ctx, msg)
+	s.record(&Delivery{Destination: destinationName(d), Kind: DeliveryMessage, SiteID: msg.SiteID,
+		UserID: msg.UserID, dest: d, msg: &msg}, st, err)
+	return err
+}
+
+// sendAdminMessage sends the admin message to the destination and records the delivery
+func (s *Service) sendAdminMessage(d Destination, as AdminMessageSender, msg AdminMessage) error {
+	st := time.Now()
+	err := as.SendAdminMessage(s.ctx, msg)
+	s.record(&Delivery{Destination: destinationName(d), Kind: DeliveryAdmin, SiteID: msg.SiteID, dest: d, admin: &msg}, st, err)
+	return err
+}
+
+// record adds the delivery to the log, evicting the oldest one of the destination above the limit
+func (s *Service) record(rec *Delivery, st time.Time, err error) {
+	rec.setResult(st, err)
+	s.deliveries.mu.Lock()
+	defer s.deliveries.mu.Unlock()
+	if s.deliveries.records == nil {
+		s.deliveries.records = map[string][]*Delivery{}
+	}
+	s.deliveries.lastID++
+	rec.seq, rec.ID = s.deliveries.lastID, strconv.FormatInt(s.deliveries.lastID, 10)
+	records := append(s.deliveries.records[rec.Destination], rec)
+	if len(records) > deliveriesLimit {
+		records = slices.Delete(records, 0, len(records)-deliveriesLimit)
+	}
+	s.deliveries.records[rec.Destination] = records
+}
+
+// setResult sets status, error and latency of the attempt started at st
+func (d *Delivery) setResult(st time.Time, err error) {
+	d.Time, d.LatencyMs, d.Status, d.Error = time.Now(), time.Since(st).Milliseconds(), DeliverySent, ""
+	if err != nil {
+		d.Status, d.Error = DeliveryFailed, truncateError(err)
+	}
+}
+
+// destinationName returns short name of the destination, first word of its description. Full description
+// is not exposed as it may contain credentials, like webhook headers.
+func destinationName(d Destination) string {
+	name, _, _ := strings.Cut(d.String(), " ")
+	return strings.ToLower(strings.TrimSuffix(name, ":"))
+}
+
+// truncateError returns error message cut to deliveryErrorLimit runes, as it may include the whole response
+func truncateError(err error) string {
+	msg := []rune(err.Error())
+	if len(msg) <= deliveryErrorLimit {
+		return string(msg)
+	}
+	return fmt.Sprintf("%s...", string(msg[:deliveryErrorLimit]))
+}
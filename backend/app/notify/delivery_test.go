@@ -0,0 +1,98 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/synctest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store"
+)
+
+func TestService_Deliveries(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		d1, d2 := &MockDest{id: 1}, &failDest{}
+		s := NewService(nil, 10, d1, d2)
+
+		s.Submit(Request{Comment: store.Comment{ID: "100", Locator: store.Locator{SiteID: "site1"}}})
+		synctest.Wait()
+		s.SubmitVerification(VerificationRequest{SiteID: "site1", User: "user1", Token: "token"})
+		synctest.Wait()
+		s.Submit(Request{Comment: store.Comment{ID: "200", Locator: store.Locator{SiteID: "site2"}}})
+		synctest.Wait()
+
+		res := s.Deliveries("site1", "")
+		require.Len(t, res, 4)
+		assert.Equal(t, DeliveryVerification, res[0].Kind, "newest first")
+		assert.Equal(t, DeliveryComment, res[3].Kind)
+		assert.Equal(t, "100", res[3].CommentID)
+
+		res = s.Deliveries("site1", "mock")
+		require.Len(t, res, 2)
+		assert.Equal(t, "mock", res[0].Destination)
+		assert.Equal(t, DeliverySent, res[0].Status)
+		assert.Equal(t, "user1", res[0].UserID)
+		assert.Empty(t, res[0].Error)
+
+		res = s.Deliveries("site2", "fail")
+		require.Len(t, res, 1)
+		assert.Equal(t, DeliveryFailed, res[0].Status)
+		assert.Equal(t, strings.Repeat("x", deliveryErrorLimit)+"...", res[0].Error, "long error truncated")
+		assert.Equal(t, 0, res[0].Retries)
+		assert.Empty(t, s.Deliveries("site3", ""))
+
+		_, err := s.Resend(context.Background(), "site1", res[0].ID)
+		assert.ErrorIs(t, err, ErrDeliveryNotFound, "delivery of another site")
+		_, err = s.Resend(context.Background(), "site2", "bad")
+		assert.ErrorIs(t, err, ErrDeliveryNotFound)
+
+		d2.ok.Store(true)
+		resent, err := s.Resend(context.Background(), "site2", res[0].ID)
+		require.NoError(t, err)
+		assert.Equal(t, DeliverySent, resent.Status)
+		assert.Empty(t, resent.Error)
+		assert.Equal(t, 1, resent.Retries)
+		assert.Equal(t, resent, s.Deliveries("site2", "fail")[0])
+		assert.Equal(t, int32(4), d2.calls.Load(), "resent to the same destination")
+		s.Close()
+	})
+}
+
+func TestService_DeliveriesLimit(t *testing.T) {
+	s := &Service{ctx: context.Background()}
+	d := &MockDest{}
+	for range deliveriesLimit + 5 {
+		require.NoError(t, s.send(d, Request{Comment: store.Comment{Locator: store.Locator{SiteID: "site1"}}}))
+	}
+	res := s.Deliveries("site1", "mock")
+	require.Len(t, res, deliveriesLimit)
+	assert.Equal(t, "55", res[0].ID)
+	assert.Equal(t, "6", res[deliveriesLimit-1].ID, "oldest evicted")
+	assert.Empty(t, NopService.Deliveries("site1", ""))
+}
+
+// failDest fails to send with long error till ok set
+type failDest struct {
+	ok    atomic.Bool
+	calls atomic.Int32
+}
+
+func (f *failDest) Send(context.Context, Request) error {
+	f.calls.Add(1)
+	if f.ok.Load() {
+		return nil
+	}
+	return errors.New(strings.Repeat("x", 1000))
+}
+
+func (f *failDest) SendVerification(context.Context, VerificationRequest) error {
+	f.calls.Add(1)
+	return nil
+}
+
+func (f *failDest) String() string { return "fail destination" }
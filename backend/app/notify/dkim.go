@@ -0,0 +1,170 @@
+package notify
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dkimHeaders are headers signed if present in the message. List-Unsubscribe ones must be signed
+// for one-click unsubscribe, RFC 8058.
+var dkimHeaders = []string{"From", "To", "Subject", "Date", "Reply-To", "In-Reply-To", "MIME-Version",
+	"Content-Type", "Content-Transfer-Encoding", "List-Unsubscribe", "List-Unsubscribe-Post"}
+
+// DKIM signs messages with DomainKeys Identified Mail signature, RFC 6376, using relaxed canonicalization
+// of headers and body. Supports RSA (rsa-sha256) and Ed25519 (ed25519-sha256, RFC 8463) keys.
+type DKIM struct {
+	Domain   string // signing domain, "d=" tag
+	Selector string // selector of the public key in DNS, "s=" tag
+	signer   crypto.Signer
+	algo     string
+}
+
+// NewDKIM makes DKIM signer with PEM encoded private key, PKCS#1 RSA or PKCS#8 RSA and Ed25519 ones
+func NewDKIM(domain, selector string, keyPEM []byte) (*DKIM, error) {
+	if domain == "" || selector == "" {
+		return nil, errors.New("dkim domain and selector are required")
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("no pem encoded dkim key")
+	}
+	var key any
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported dkim key type %q", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't parse dkim key: %w", err)
+	}
+
+	res := DKIM{Domain: domain, Selector: selector}
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		res.signer, res.algo = k, "rsa-sha256"
+	case ed25519.PrivateKey:
+		res.signer, res.algo = k, "ed25519-sha256"
+	default:
+		return nil, fmt.Errorf("unsupported dkim key %T", key)
+	}
+	return &res, nil
+}
+
+// Sign returns the message with DKIM-Signature header added on top. Line breaks of the message are
+// converted to CRLF, so the signed message is sent exactly as signed.
+func (d *DKIM) Sign(msg []byte, ts time.Time) ([]byte, error) {
+	msg = bytes.ReplaceAll(bytes.ReplaceAll(msg, []byte("\r\n"), []byte("\n")), []byte("\n"), []byte("\r\n"))
+	header, body, ok := bytes.Cut(msg, []byte("\r\n\r\n"))
+	if !ok {
+		header, body = bytes.TrimSuffix(msg, []byte("\r\n")), nil
+	}
+	fields := splitHeader(string(header))
+
+	bodyHash := sha256.Sum256(dkimRelaxedBody(body))
+	signed := []string{}
+	hashed := strings.Builder{}
+	for _, name := range dkimHeaders {
+		for _, f := range fields {
+			if fieldName, _, _ := strings.Cut(f, ":"); strings.EqualFold(strings.TrimSpace(fieldName), name) {
+				signed = append(signed, name)
+				hashed.WriteString(dkimRelaxedHeader(f))
+				break
+			}
+		}
+	}
+
+	sigHeader := "DKIM-Signature: v=1; a=" + d.algo + "; c=relaxed/relaxed; d=" + d.Domain + "; s=" + d.Selector +
+		"; t=" + strconv.FormatInt(ts.Unix(), 10) + ";\r\n\th=" + strings.Join(signed, ":") +
+		";\r\n\tbh=" + base64.StdEncoding.EncodeToString(bodyHash[:]) + ";\r\n\tb="
+	hashed.WriteString(strings.TrimSuffix(dkimRelaxedHeader(sigHeader), "\r\n"))
+
+	digest := sha256.Sum256([]byte(hashed.String()))
+	var sig []byte
+	var err error
+	if d.algo == "ed25519-sha256" {
+		sig, err = d.signer.Sign(rand.Reader, digest[:], crypto.Hash(0))
+	} else {
+		sig, err = d.signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't sign message: %w", err)
+	}
+
+	res := bytes.Buffer{}
+	res.WriteString(sigHeader)
+	res.WriteString(foldBase64(base64.StdEncoding.EncodeToString(sig)))
+	res.WriteString("\r\n")
+	res.Write(msg)
+	return res.Bytes(), nil
+}
+
+func (d *DKIM) String() string {
+	return fmt.Sprintf("dkim: %s with selector %s", d.Domain, d.Selector)
+}
+
+// splitHeader splits header block to fields, keeping folded lines of the field together
+func splitHeader(header string) []string {
+	res := []string{}
+	for line := range strings.SplitSeq(header, "\r\n") {
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(res) > 0 {
+			res[len(res)-1] += "\r\n" + line
+			continue
+		}
+		res = append(res, line)
+	}
+	return res
+}
+
+// dkimWSP matches sequences of whitespace, reduced to a single space by relaxed canonicalization
+var dkimWSP = regexp.MustCompile(`[ \t]+`)
+
+// dkimRelaxedHeader canonicalizes header field with "relaxed" algorithm, RFC 6376 section 3.4.2
+func dkimRelaxedHeader(field string) string {
+	name, value, _ := strings.Cut(field, ":")
+	value = dkimWSP.ReplaceAllString(strings.ReplaceAll(value, "\r\n", ""), " ")
+	return strings.ToLower(strings.TrimRight(name, " \t")) + ":" + strings.Trim(value, " ") + "\r\n"
+}
+
+// dkimRelaxedBody canonicalizes body with "relaxed" algorithm, RFC 6376 section 3.4.4
+func dkimRelaxedBody(body []byte) []byte {
+	lines := strings.Split(string(body), "\r\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(dkimWSP.ReplaceAllString(line, " "), " ")
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+// foldBase64 folds long signature value to lines of 72 characters
+func foldBase64(val string) string {
+	const width = 72
+	res := strings.Builder{}
+	for len(val) > width {
+		res.WriteString(val[:width] + "\r\n\t")
+		val = val[width:]
+	}
+	res.WriteString(val)
+	return res.String()
+}
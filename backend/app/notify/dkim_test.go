@@ -0,0 +1,138 @@
+package notify
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDKIM_Canonicalization(t *testing.T) {
+	// example from RFC 6376, section 3.4.5
+	assert.Equal(t, "a:X\r\n", dkimRelaxedHeader("A: X"))
+	assert.Equal(t, "b:Y Z\r\n", dkimRelaxedHeader("B : Y\t\r\n\tZ  "))
+	assert.Equal(t, " C\r\nD E\r\n", string(dkimRelaxedBody([]byte(" C \r\nD \t E\r\n\r\n\r\n"))))
+	assert.Empty(t, dkimRelaxedBody([]byte("\r\n\r\n")))
+	assert.Equal(t, "text\r\n", string(dkimRelaxedBody([]byte("text"))))
+}
+
+func TestNewDKIM(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	pkcs1 := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})
+	d, err := NewDKIM("example.com", "mail", pkcs1)
+	require.NoError(t, err)
+	assert.Equal(t, "rsa-sha256", d.algo)
+	assert.Equal(t, "dkim: example.com with selector mail", d.String())
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(edKey)
+	require.NoError(t, err)
+	d, err = NewDKIM("example.com", "mail", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	require.NoError(t, err)
+	assert.Equal(t, "ed25519-sha256", d.algo)
+
+	_, err = NewDKIM("", "mail", pkcs1)
+	require.EqualError(t, err, "dkim domain and selector are required")
+	_, err = NewDKIM("example.com", "mail", []byte("not a key"))
+	require.EqualError(t, err, "no pem encoded dkim key")
+	_, err = NewDKIM("example.com", "mail", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte("123")}))
+	require.EqualError(t, err, `unsupported dkim key type "PUBLIC KEY"`)
+	_, err = NewDKIM("example.com", "mail", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("123")}))
+	require.ErrorContains(t, err, "can't parse dkim key")
+}
+
+func TestDKIM_Sign(t *testing.T) {
+	msg := "From: Remark42 <notify@example.com>\nTo: user@example.com\nSubject: =?utf-8?b?TmV3IHJlcGx5?=\n" +
+		"List-Unsubscribe-Post: List-Unsubscribe=One-Click\nList-Unsubscribe: <https://example.com/unsubscribe?tkn=1>\n" +
+		"X-Mailer: not signed\nContent-Type: text/html; charset=\"UTF-8\"\n\n<p>hello  world</p>\n\n"
+	ts := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	d, err := NewDKIM("example.com", "mail", pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}))
+	require.NoError(t, err)
+	signed, err := d.Sign([]byte(msg), ts)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(signed), "DKIM-Signature: v=1; a=rsa-sha256; c=relaxed/relaxed; d=example.com; "+
+		"s=mail; t=1767323045;\r\n\th=From:To:Subject:Content-Type:List-Unsubscribe:List-Unsubscribe-Post;\r\n"))
+	assert.True(t, strings.HasSuffix(string(signed), "\r\n\r\n<p>hello  world</p>\r\n\r\n"), "line breaks converted to CRLF")
+	require.NoError(t, verifyDKIM(string(signed), &rsaKey.PublicKey))
+
+	tampered := strings.Replace(string(signed), "hello", "hacked", 1)
+	require.EqualError(t, verifyDKIM(tampered, &rsaKey.PublicKey), "body hash mismatch")
+	tampered = strings.Replace(string(signed), "user@example.com", "other@example.com", 1)
+	require.Error(t, verifyDKIM(tampered, &rsaKey.PublicKey), "signed header changed")
+	unsigned := strings.Replace(string(signed), "X-Mailer: not signed", "X-Mailer: changed", 1)
+	require.NoError(t, verifyDKIM(unsigned, &rsaKey.PublicKey), "header not signed")
+
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(edKey)
+	require.NoError(t, err)
+	d, err = NewDKIM("example.com", "mail", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	require.NoError(t, err)
+	signed, err = d.Sign([]byte(msg), ts)
+	require.NoError(t, err)
+	assert.Contains(t, string(signed), "a=ed25519-sha256;")
+	require.NoError(t, verifyDKIM(string(signed), edPub))
+}
+
+// verifyDKIM checks the first DKIM-Signature of the message made by DKIM.Sign
+func verifyDKIM(msg string, pub crypto.PublicKey) error {
+	header, body, _ := strings.Cut(msg, "\r\n\r\n")
+	fields := splitHeader(header)
+	sigField := fields[0]
+	tags := map[string]string{}
+	for tag := range strings.SplitSeq(strings.TrimPrefix(sigField, "DKIM-Signature:"), ";") {
+		k, v, _ := strings.Cut(tag, "=")
+		tags[strings.TrimSpace(k)] = regexp.MustCompile(`\s+`).ReplaceAllString(v, "")
+	}
+
+	bodyHash := sha256.Sum256(dkimRelaxedBody([]byte(body)))
+	if base64.StdEncoding.EncodeToString(bodyHash[:]) != tags["bh"] {
+		return errors.New("body hash mismatch")
+	}
+
+	hashed := strings.Builder{}
+	for name := range strings.SplitSeq(tags["h"], ":") {
+		for _, f := range fields[1:] {
+			if n, _, _ := strings.Cut(f, ":"); strings.EqualFold(strings.TrimSpace(n), name) {
+				hashed.WriteString(dkimRelaxedHeader(f))
+				break
+			}
+		}
+	}
+	noSig := regexp.MustCompile(`b=[^;]*$`).ReplaceAllString(sigField, "b=")
+	hashed.WriteString(strings.TrimSuffix(dkimRelaxedHeader(noSig), "\r\n"))
+	digest := sha256.Sum256([]byte(hashed.String()))
+	sig, err := base64.StdEncoding.DecodeString(tags["b"])
+	if err != nil {
+		return err
+	}
+
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig)
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, digest[:], sig) {
+			return errors.New("bad ed25519 signature")
+		}
+		return nil
+	}
+	return errors.New("unsupported key")
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"html/template"
 	"net/url"
+	"strings"
 	"time"
 
 	log "github.com/go-pkgz/lgr"
@@ -26,15 +27,62 @@ type EmailParams struct {
 	VerificationTemplatePath string   // path to verification template
 	SubscribeURL             string   // full subscribe handler URL
 	UnsubscribeURL           string   // full unsubscribe handler URL
+	ManageURL                string   // full subscriptions management page URL, the link isn't added if not set
+
+	Location   func(siteID string) *time.Location // site timezone for dates in messages, dates kept as is if not set
+	Suppressed func(address string) bool          // checks if emails to the address are suppressed, not checked if not set
+
+	DKIM       *DKIM           // signs messages sent with SMTP, not signed if not set
+	Identities EmailIdentities // from and reply-to addresses of sites, From is used for all sites if not set
 
 	TokenGenFn func(userID, email, site string) (string, error) // unsubscribe token generation function
 }
 
+// EmailIdentities are from and reply-to addresses of emails, per site
+type EmailIdentities struct {
+	ReplyTo string                   // reply-to address of all sites, not set if empty
+	Sites   map[string]EmailIdentity // addresses of sites, overriding From of EmailParams and ReplyTo
+}
+
+// EmailIdentity is from and reply-to addresses of site's emails, empty ones are not overridden
+type EmailIdentity struct {
+	From    string
+	ReplyTo string
+}
+
+// site returns from and reply-to addresses of the site's emails
+func (e EmailIdentities) site(siteID, from string) (siteFrom, replyTo string) {
+	siteFrom, replyTo = from, e.ReplyTo
+	if identity, ok := e.Sites[siteID]; ok {
+		if identity.From != "" {
+			siteFrom = identity.From
+		}
+		if identity.ReplyTo != "" {
+			replyTo = identity.ReplyTo
+		}
+	}
+	return siteFrom, replyTo
+}
+
+// hasReplyTo checks if reply-to address is set for any site
+func (e EmailIdentities) hasReplyTo() bool {
+	if e.ReplyTo != "" {
+		return true
+	}
+	for _, identity := range e.Sites {
+		if identity.ReplyTo != "" {
+			return true
+		}
+	}
+	return false
+}
+
 // Email implements notify.Destination for email
 type Email struct {
 	*ntf.Email
 
 	EmailParams
+	sender     EmailSender        // smtp client or provider's api
 	msgTmpl    *template.Template // parsed request message template
 	verifyTmpl *template.Template // parsed verification message template
 }
@@ -54,6 +102,8 @@ type msgTmplData struct {
 	PostTitle         string
 	Email             string
 	UnsubscribeLink   string
+	ManageLink        string
+	Collapsed         int // number of earlier comments collapsed into the notification
 	ForAdmin          bool
 }
 
@@ -95,6 +145,7 @@ const (
 	defaultEmailTimeout                  = 10 * time.Second
 	defaultEmailTemplatePath             = "email_reply.html.tmpl"
 	defaultEmailVerificationTemplatePath = "email_confirmation_subscription.html.tmpl"
+	welcomeSubject                       = "Welcome to the discussion"
 )
 
 // NewEmail makes new Email object, returns error in case of e.MsgTemplate or e.VerificationTemplate parsing error
@@ -105,15 +156,13 @@ func NewEmail(emailParams EmailParams, smtpParams ntf.SMTPParams) (*Email, error
 	}
 
 	res := Email{Email: ntf.NewEmail(smtpParams), EmailParams: emailParams}
-
-	if res.VerificationSubject == "" {
-		res.VerificationSubject = defaultVerificationSubject
+	res.sender = res.Email
+	if emailParams.DKIM != nil || emailParams.Identities.hasReplyTo() {
+		// go-pkgz/notify client doesn't sign messages and can't set Reply-To header
+		res.sender = NewSMTP(smtpParams, emailParams.DKIM)
 	}
-
-	// initialize templates
-	err := res.setTemplates()
-	if err != nil {
-		return nil, fmt.Errorf("can't set templates: %w", err)
+	if err := res.init(); err != nil {
+		return nil, err
 	}
 
 	log.Printf("[DEBUG] Create new email notifier for server %s with user %s, timeout=%s",
@@ -122,6 +171,35 @@ func NewEmail(emailParams EmailParams, smtpParams ntf.SMTPParams) (*Email, error
 	return &res, nil
 }
 
+// NewAPIEmail makes new Email object sending messages with the email provider's API instead of SMTP
+func NewAPIEmail(emailParams EmailParams, api *EmailAPI) (*Email, error) {
+	res := Email{EmailParams: emailParams, sender: api}
+	if err := res.init(); err != nil {
+		return nil, err
+	}
+	log.Printf("[DEBUG] Create new email notifier with %s api", api.Provider)
+	return &res, nil
+}
+
+// init sets defaults and templates
+func (e *Email) init() error {
+	if e.VerificationSubject == "" {
+		e.VerificationSubject = defaultVerificationSubject
+	}
+	if err := e.setTemplates(); err != nil {
+		return fmt.Errorf("can't set templates: %w", err)
+	}
+	return nil
+}
+
+// String describes the destination, SMTP server or the provider's api
+func (e *Email) String() string {
+	if e.sender == nil && e.Email != nil {
+		return e.Email.String()
+	}
+	return fmt.Sprint(e.sender)
+}
+
 func (e *Email) setTemplates() error {
 	var err error
 	var msgTmplFile, verifyTmplFile []byte
@@ -151,7 +229,7 @@ func (e *Email) setTemplates() error {
 }
 
 // Send email about comment reply to Request.Emails and Email.AdminEmails
-// if they're set.
+// if they're set, and welcome message to the comment author if it's set and author has email.
 // Thread safe
 func (e *Email) Send(ctx context.Context, req Request) error {
 	select {
@@ -163,6 +241,9 @@ func (e *Email) Send(ctx context.Context, req Request) error {
 	var errs []error
 
 	for _, email := range req.Emails {
+		if e.suppressed(email) {
+			continue
+		}
 		err := e.buildAndSendMessage(ctx, req, email, false)
 		if err != nil {
 			errs = append(errs, fmt.Errorf("problem sending user email notification to %q: %w", email, err))
@@ -170,12 +251,85 @@ func (e *Email) Send(ctx context.Context, req Request) error {
 	}
 
 	for _, email := range e.AdminEmails {
+		if req.usersOnly {
+			break
+		}
+		if e.suppressed(email) {
+			continue
+		}
 		err := e.buildAndSendMessage(ctx, req, email, true)
 		if err != nil {
 			errs = append(errs, fmt.Errorf("problem sending admin email notification to %q: %w", email, err))
 		}
 	}
 
+	if req.Welcome != "" && req.welcomeEmail != "" && !e.suppressed(req.welcomeEmail) {
+		if err := e.sendWelcome(ctx, req); err != nil {
+			errs = append(errs, fmt.Errorf("problem sending welcome email to %q: %w", req.welcomeEmail, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// sendWelcome sends welcome message to the author of the first comment, message is plain text
+func (e *Email) sendWelcome(ctx context.Context, req Request) error {
+	log.Printf("[DEBUG] send welcome via %s, comment id %s", e, req.Comment.ID)
+	body := strings.ReplaceAll(template.HTMLEscapeString(req.Welcome), "\n", "<br>\n")
+	return repeater.NewFixed(5, time.Millisecond*250).Do(
+		ctx,
+		func() error {
+			return e.sender.Send(
+				ctx,
+				e.destination(req.welcomeEmail, req.Comment.Locator.SiteID, welcomeSubject, ""),
+				body,
+			)
+		})
+}
+
+// SendMessage sends plain text message to the user's email, resolved on submit
+func (e *Email) SendMessage(ctx context.Context, msg UserMessage) error {
+	if msg.email == "" {
+		return fmt.Errorf("no email for message to %s", msg.UserID)
+	}
+	if e.suppressed(msg.email) {
+		return nil
+	}
+	log.Printf("[DEBUG] send message via %s to %s", e, msg.UserID)
+	body := strings.ReplaceAll(template.HTMLEscapeString(msg.Text), "\n", "<br>\n")
+	return repeater.NewFixed(5, time.Millisecond*250).Do(
+		ctx,
+		func() error {
+			return e.sender.Send(
+				ctx,
+				e.destination(msg.email, msg.SiteID, msg.Subject, ""),
+				body,
+			)
+		})
+}
+
+// SendAdminMessage sends plain text message to AdminEmails
+func (e *Email) SendAdminMessage(ctx context.Context, msg AdminMessage) error {
+	log.Printf("[DEBUG] send admin message via %s, %q", e, msg.Subject)
+	body := strings.ReplaceAll(template.HTMLEscapeString(msg.Text), "\n", "<br>\n")
+	var errs []error
+	for _, email := range e.AdminEmails {
+		if e.suppressed(email) {
+			continue
+		}
+		err := repeater.NewFixed(5, time.Millisecond*250).Do(
+			ctx,
+			func() error {
+				return e.sender.Send(
+					ctx,
+					e.destination(email, msg.SiteID, msg.Subject, ""),
+					body,
+				)
+			})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("problem sending admin message to %s: %w", email, err))
+		}
+	}
 	return errors.Join(errs...)
 }
 
@@ -189,14 +343,9 @@ func (e *Email) buildAndSendMessage(ctx context.Context, req Request, email stri
 	return repeater.NewFixed(5, time.Millisecond*250).Do(
 		ctx,
 		func() error {
-			return e.Email.Send(
+			return e.sender.Send(
 				ctx,
-				fmt.Sprintf("mailto:%s?from=%s&unsubscribeLink=%s&subject=%s",
-					email,
-					url.QueryEscape(e.From),
-					url.QueryEscape(msg.unsubscribeLink),
-					url.QueryEscape(msg.subject),
-				),
+				e.destination(email, req.Comment.Locator.SiteID, msg.subject, msg.unsubscribeLink),
 				msg.body,
 			)
 		})
@@ -209,6 +358,9 @@ func (e *Email) SendVerification(ctx context.Context, req VerificationRequest) e
 		// this means we can't send this request via Email
 		return nil
 	}
+	if e.suppressed(req.Email) {
+		return nil
+	}
 	select {
 	case <-ctx.Done():
 		return fmt.Errorf("sending message to %q aborted due to canceled context", req.User)
@@ -224,18 +376,36 @@ func (e *Email) SendVerification(ctx context.Context, req VerificationRequest) e
 	return repeater.NewFixed(5, time.Millisecond*250).Do(
 		ctx,
 		func() error {
-			return e.Email.Send(
+			return e.sender.Send(
 				ctx,
-				fmt.Sprintf("mailto:%s?from=%s&subject=%s",
-					req.Email,
-					url.QueryEscape(e.From),
-					url.QueryEscape(e.VerificationSubject),
-				),
+				e.destination(req.Email, req.SiteID, e.VerificationSubject, ""),
 				msg,
 			)
 		})
 }
 
+// destination makes "mailto:" destination of the email with from and reply-to addresses of the site
+func (e *Email) destination(email, siteID, subject, unsubscribeLink string) string {
+	from, replyTo := e.Identities.site(siteID, e.From)
+	res := fmt.Sprintf("mailto:%s?from=%s", email, url.QueryEscape(from))
+	if replyTo != "" {
+		res += "&replyTo=" + url.QueryEscape(replyTo)
+	}
+	if unsubscribeLink != "" {
+		res += "&unsubscribeLink=" + url.QueryEscape(unsubscribeLink)
+	}
+	return res + "&subject=" + url.QueryEscape(subject)
+}
+
+// suppressed checks if emails to the address are suppressed after bounces or complaints
+func (e *Email) suppressed(address string) bool {
+	if e.Suppressed == nil || !e.Suppressed(address) {
+		return false
+	}
+	log.Printf("[DEBUG] skip email to suppressed address via %s", e)
+	return true
+}
+
 // buildVerificationMessage generates verification email message based on given input
 func (e *Email) buildVerificationMessage(user, email, token, site string) (string, error) {
 	msg := bytes.Buffer{}
@@ -252,6 +422,17 @@ func (e *Email) buildVerificationMessage(user, email, token, site string) (strin
 	return msg.String(), nil
 }
 
+// siteTime converts time to the timezone of the site, keeps it as is if timezone not set
+func (e *Email) siteTime(ts time.Time, siteID string) time.Time {
+	if e.Location == nil {
+		return ts
+	}
+	if loc := e.Location(siteID); loc != nil {
+		return ts.In(loc)
+	}
+	return ts
+}
+
 type commentMessage struct {
 	subject         string
 	body            string
@@ -264,6 +445,9 @@ func (e *Email) buildMessageFromRequest(req Request, email string, forAdmin bool
 	if forAdmin {
 		subject = "New comment to your site"
 	}
+	if req.collapsed > 0 && !forAdmin {
+		subject = fmt.Sprintf("%d new comments in the thread", req.collapsed+1)
+	}
 	if req.Comment.PostTitle != "" {
 		subject += fmt.Sprintf(" for %q", req.Comment.PostTitle)
 	}
@@ -272,9 +456,13 @@ func (e *Email) buildMessageFromRequest(req Request, email string, forAdmin bool
 	if err != nil {
 		return commentMessage{}, fmt.Errorf("error creating token for unsubscribe link: %w", err)
 	}
-	unsubscribeLink := e.UnsubscribeURL + "?site=" + req.Comment.Locator.SiteID + "&tkn=" + token
+	unsubscribeLink := e.UnsubscribeURL + "?site=" + url.QueryEscape(req.Comment.Locator.SiteID) + "&tkn=" + token
+	manageLink := ""
+	if e.ManageURL != "" {
+		manageLink = e.ManageURL + "?site=" + url.QueryEscape(req.Comment.Locator.SiteID) + "&tkn=" + token
+	}
 	if forAdmin {
-		unsubscribeLink = ""
+		unsubscribeLink, manageLink = "", ""
 	}
 
 	commentURLPrefix := req.Comment.Locator.URL + uiNav
@@ -284,10 +472,12 @@ func (e *Email) buildMessageFromRequest(req Request, email string, forAdmin bool
 		UserPicture:     req.Comment.User.Picture,
 		CommentText:     emailSafeHTML(req.Comment.Text),
 		CommentLink:     commentURLPrefix + req.Comment.ID,
-		CommentDate:     req.Comment.Timestamp,
+		CommentDate:     e.siteTime(req.Comment.Timestamp, req.Comment.Locator.SiteID),
 		PostTitle:       req.Comment.PostTitle,
 		Email:           email,
 		UnsubscribeLink: unsubscribeLink,
+		ManageLink:      manageLink,
+		Collapsed:       req.collapsed,
 		ForAdmin:        forAdmin,
 	}
 	// in case of message to admin, parent message might be empty
@@ -296,7 +486,7 @@ func (e *Email) buildMessageFromRequest(req Request, email string, forAdmin bool
 		tmplData.ParentUserPicture = req.parent.User.Picture
 		tmplData.ParentCommentText = emailSafeHTML(req.parent.Text)
 		tmplData.ParentCommentLink = commentURLPrefix + req.parent.ID
-		tmplData.ParentCommentDate = req.parent.Timestamp
+		tmplData.ParentCommentDate = e.siteTime(req.parent.Timestamp, req.Comment.Locator.SiteID)
 	}
 	err = e.msgTmpl.Execute(&msg, tmplData)
 	if err != nil {
@@ -4,7 +4,10 @@ import (
 	"context"
 	"fmt"
 	"html/template"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	ntf "github.com/go-pkgz/notify"
 	"github.com/stretchr/testify/assert"
@@ -196,6 +199,206 @@ admin@example.org
 	assert.Empty(t, msg.unsubscribeLink)
 }
 
+func TestEmail_BuildMessageWithLocation(t *testing.T) {
+	email, err := NewEmail(EmailParams{
+		From:            "from@example.org",
+		MsgTemplatePath: "testdata/msg.html.tmpl",
+	}, ntf.SMTPParams{})
+	require.NoError(t, err)
+	email.TokenGenFn = TokenGenFn
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+
+	req := Request{
+		Comment: store.Comment{ID: "999", User: store.User{ID: "1", Name: "test_user"}, Locator: store.Locator{SiteID: "site1"},
+			Timestamp: time.Date(2026, 1, 2, 10, 30, 0, 0, time.UTC)},
+		Emails: []string{"test@example.org"},
+	}
+	msg, err := email.buildMessageFromRequest(req, req.Emails[0], false)
+	require.NoError(t, err)
+	assert.Contains(t, msg.body, "02.01.2026 at 10:30", "kept as is without location")
+
+	email.Location = func(siteID string) *time.Location {
+		if siteID == "site1" {
+			return berlin
+		}
+		return nil
+	}
+	msg, err = email.buildMessageFromRequest(req, req.Emails[0], false)
+	require.NoError(t, err)
+	assert.Contains(t, msg.body, "02.01.2026 at 11:30", "site timezone")
+
+	req.Comment.Locator.SiteID = "site2"
+	msg, err = email.buildMessageFromRequest(req, req.Emails[0], false)
+	require.NoError(t, err)
+	assert.Contains(t, msg.body, "02.01.2026 at 10:30", "no timezone for the site")
+}
+
+func TestEmail_BuildMessageManageLink(t *testing.T) {
+	email, err := NewEmail(EmailParams{From: "from@example.org", UnsubscribeURL: "https://remark42.com/email/unsubscribe.html"},
+		ntf.SMTPParams{})
+	require.NoError(t, err)
+	email.TokenGenFn = TokenGenFn
+
+	req := Request{
+		Comment: store.Comment{ID: "999", User: store.User{ID: "1", Name: "test_user"}, Locator: store.Locator{SiteID: "site1"}},
+		Emails:  []string{"test@example.org"},
+	}
+	msg, err := email.buildMessageFromRequest(req, req.Emails[0], false)
+	require.NoError(t, err)
+	assert.Contains(t, msg.body, "https://remark42.com/email/unsubscribe.html?site=site1&amp;tkn=token")
+	assert.NotContains(t, msg.body, "Manage subscriptions", "no management page configured")
+
+	email.ManageURL = "https://remark42.com/web/unsubscribe"
+	msg, err = email.buildMessageFromRequest(req, req.Emails[0], false)
+	require.NoError(t, err)
+	assert.Contains(t, msg.body, `href="https://remark42.com/web/unsubscribe?site=site1&amp;tkn=token">Manage subscriptions</a>`)
+	assert.Equal(t, "https://remark42.com/email/unsubscribe.html?site=site1&tkn=token", msg.unsubscribeLink,
+		"one-click unsubscribe header kept")
+
+	msg, err = email.buildMessageFromRequest(req, "admin@example.org", true)
+	require.NoError(t, err)
+	assert.NotContains(t, msg.body, "Manage subscriptions", "no link for admin")
+}
+
+func TestEmail_SendSuppressed(t *testing.T) {
+	email, err := NewEmail(EmailParams{From: "from@example.org", AdminEmails: []string{"admin@example.org", "bad-admin@example.org"},
+		Suppressed: func(address string) bool { return strings.HasPrefix(address, "bad") }}, ntf.SMTPParams{})
+	require.NoError(t, err)
+	email.TokenGenFn = TokenGenFn
+	sender := &recordingSender{}
+	email.sender = sender
+
+	req := Request{
+		Comment: store.Comment{ID: "999", User: store.User{ID: "1", Name: "test_user"}, PostTitle: "test_title"},
+		Emails:  []string{"good@example.org", "bad@example.org"}, Welcome: "welcome", welcomeEmail: "bad-author@example.org",
+	}
+	require.NoError(t, email.Send(context.Background(), req))
+	require.NoError(t, email.SendMessage(context.Background(), UserMessage{UserID: "1", Text: "hi", email: "bad@example.org"}))
+	require.NoError(t, email.SendVerification(context.Background(), VerificationRequest{User: "1", Email: "bad@example.org", Token: "t"}))
+	require.Len(t, sender.destinations, 2)
+	assert.True(t, strings.HasPrefix(sender.destinations[0], "mailto:good@example.org?"))
+	assert.True(t, strings.HasPrefix(sender.destinations[1], "mailto:admin@example.org?"))
+}
+
+func TestEmail_SendIdentities(t *testing.T) {
+	email, err := NewEmail(EmailParams{From: "Remark42 <notify@example.org>", Identities: EmailIdentities{
+		ReplyTo: "support@example.org",
+		Sites: map[string]EmailIdentity{
+			"blog":  {From: "Blog <blog@example.com>"},
+			"forum": {From: "Forum <forum@example.net>", ReplyTo: "mods@example.net"},
+		}}}, ntf.SMTPParams{})
+	require.NoError(t, err)
+	assert.IsType(t, &SMTP{}, email.sender, "smtp client supporting reply-to")
+	email.TokenGenFn = TokenGenFn
+	sender := &recordingSender{}
+	email.sender = sender
+
+	req := Request{
+		Comment: store.Comment{ID: "999", User: store.User{ID: "1", Name: "test_user"}, Locator: store.Locator{SiteID: "forum"}},
+		Emails:  []string{"user@example.org"},
+	}
+	require.NoError(t, email.Send(context.Background(), req))
+	require.NoError(t, email.SendMessage(context.Background(), UserMessage{SiteID: "blog", UserID: "1", Subject: "hi", Text: "hi",
+		email: "user@example.org"}))
+	require.NoError(t, email.SendVerification(context.Background(), VerificationRequest{SiteID: "remark", User: "1",
+		Email: "user@example.org", Token: "t"}))
+	require.Len(t, sender.destinations, 3)
+
+	u, err := url.Parse(sender.destinations[0])
+	require.NoError(t, err)
+	assert.Equal(t, "Forum <forum@example.net>", u.Query().Get("from"))
+	assert.Equal(t, "mods@example.net", u.Query().Get("replyTo"))
+	assert.True(t, strings.HasPrefix(u.Query().Get("unsubscribeLink"), "?site=forum&tkn="), u.Query().Get("unsubscribeLink"))
+	assert.Equal(t, "mailto:user@example.org?from=Blog+%3Cblog%40example.com%3E&replyTo=support%40example.org&subject=hi",
+		sender.destinations[1])
+	assert.Equal(t, "mailto:user@example.org?from=Remark42+%3Cnotify%40example.org%3E&replyTo=support%40example.org"+
+		"&subject=Email+verification", sender.destinations[2], "site without identity")
+
+	email, err = NewEmail(EmailParams{From: "notify@example.org", Identities: EmailIdentities{
+		Sites: map[string]EmailIdentity{"blog": {From: "blog@example.com"}}}}, ntf.SMTPParams{})
+	require.NoError(t, err)
+	assert.IsType(t, &ntf.Email{}, email.sender, "go-pkgz/notify client without reply-to")
+}
+
+// recordingSender keeps destinations of sent emails
+type recordingSender struct {
+	destinations []string
+}
+
+func (r *recordingSender) Send(_ context.Context, destination, _ string) error {
+	r.destinations = append(r.destinations, destination)
+	return nil
+}
+
+func TestEmail_SendCollapsed(t *testing.T) {
+	email, err := NewEmail(EmailParams{From: "from@example.org", AdminEmails: []string{"admin@example.org"}}, ntf.SMTPParams{})
+	require.NoError(t, err)
+	email.TokenGenFn = TokenGenFn
+
+	req := Request{
+		Comment: store.Comment{ID: "999", User: store.User{ID: "1", Name: "test_user"}, PostTitle: "test_title"},
+		Emails:  []string{"test@example.org"}, usersOnly: true, collapsed: 2,
+	}
+	err = email.Send(context.Background(), req)
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "admin email notification", "admin already notified")
+
+	msg, err := email.buildMessageFromRequest(req, req.Emails[0], false)
+	require.NoError(t, err)
+	assert.Equal(t, `3 new comments in the thread for "test_title"`, msg.subject)
+	assert.Contains(t, msg.body, "+2 more new comments in the thread")
+
+	req.collapsed = 0
+	msg, err = email.buildMessageFromRequest(req, req.Emails[0], false)
+	require.NoError(t, err)
+	assert.Equal(t, `New reply to your comment for "test_title"`, msg.subject)
+	assert.NotContains(t, msg.body, "more new comments")
+}
+
+func TestEmail_SendWelcome(t *testing.T) {
+	email, err := NewEmail(EmailParams{
+		From:                     "from@example.org",
+		VerificationTemplatePath: "testdata/verification.html.tmpl",
+		MsgTemplatePath:          "testdata/msg.html.tmpl",
+	}, ntf.SMTPParams{})
+	require.NoError(t, err)
+	email.TokenGenFn = TokenGenFn
+
+	req := Request{Comment: store.Comment{ID: "999", User: store.User{ID: "1", Name: "test_user"}}, Welcome: "welcome!"}
+	assert.NoError(t, email.Send(context.Background(), req), "no email for the author, nothing sent")
+
+	req.welcomeEmail = "test@example.org"
+	assert.Contains(t, email.Send(context.Background(), req).Error(), "problem sending welcome email to \"test@example.org\"")
+}
+
+func TestEmail_SendMessage(t *testing.T) {
+	email, err := NewEmail(EmailParams{
+		From:                     "from@example.org",
+		VerificationTemplatePath: "testdata/verification.html.tmpl",
+		MsgTemplatePath:          "testdata/msg.html.tmpl",
+	}, ntf.SMTPParams{})
+	require.NoError(t, err)
+
+	msg := UserMessage{SiteID: "remark", UserID: "1", Subject: "unblocked", Text: "you can comment again"}
+	assert.EqualError(t, email.SendMessage(context.Background(), msg), "no email for message to 1")
+
+	msg.email = "test@example.org"
+	assert.Error(t, email.SendMessage(context.Background(), msg), "no smtp server to send to")
+}
+
+func TestEmail_SendAdminMessage(t *testing.T) {
+	email, err := NewEmail(EmailParams{From: "from@example.org", MsgTemplatePath: "testdata/msg.html.tmpl"}, ntf.SMTPParams{})
+	require.NoError(t, err)
+	msg := AdminMessage{SiteID: "remark", Subject: "integrity check", Text: "2 issues found"}
+	assert.NoError(t, email.SendAdminMessage(context.Background(), msg), "no admin emails")
+
+	email.AdminEmails = []string{"admin@example.org"}
+	err = email.SendAdminMessage(context.Background(), msg)
+	require.Error(t, err, "no smtp server to send to")
+	assert.Contains(t, err.Error(), "problem sending admin message to admin@example.org")
+}
+
 func TestEmail_CommentTextSanitizedForEmail(t *testing.T) {
 	// comment HTML reaching the email path is sanitized by the store-level UGC policy,
 	// which permits <a> and <img>. The email must drop both so a comment can't inject
@@ -0,0 +1,336 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// EmailSender sends the text to "mailto:" destination with "from", "subject" and "unsubscribeLink"
+// query parameters, like SMTP client of go-pkgz/notify
+type EmailSender interface {
+	Send(ctx context.Context, destination, text string) error
+}
+
+// email API providers
+const (
+	EmailProviderSES      = "ses"
+	EmailProviderSendGrid = "sendgrid"
+	EmailProviderMailgun  = "mailgun"
+	EmailProviderPostmark = "postmark"
+)
+
+const emailAPIErrorLimit = 512 // bytes of provider's response kept in the error
+
+// listUnsubscribePost is the value of List-Unsubscribe-Post header for one-click unsubscribe, RFC 8058.
+// Unsubscribe link accepts POST request sent by the mail client.
+const listUnsubscribePost = "List-Unsubscribe=One-Click"
+
+// EmailAPIParams contain settings of the email provider's HTTP API
+type EmailAPIParams struct {
+	Provider string        // one of EmailProvider* constants
+	Key      string        // API key, access key id for SES
+	Secret   string        // secret access key for SES
+	Region   string        // AWS region for SES, "eu" for Mailgun EU region
+	Domain   string        // sending domain for Mailgun
+	Endpoint string        // base URL of the API, provider's default if not set
+	Timeout  time.Duration // request timeout, 10s if not set
+}
+
+// EmailAPI sends emails with HTTP API of the email provider, for hosts blocking outbound SMTP.
+// Messages are sent as HTML, the unsubscribe link is passed as one-click List-Unsubscribe header.
+type EmailAPI struct {
+	EmailAPIParams
+	client *http.Client
+	now    func() time.Time // used for SES request signing
+}
+
+// emailAPIMessage is the parsed message to send
+type emailAPIMessage struct {
+	from, replyTo, subject, unsubscribeLink, html string
+	to                                            []string
+}
+
+// NewEmailAPI makes EmailAPI for the provider, checking required params
+func NewEmailAPI(params EmailAPIParams) (*EmailAPI, error) {
+	if params.Key == "" {
+		return nil, fmt.Errorf("api key is required for %s", params.Provider)
+	}
+	endpoint := ""
+	switch params.Provider {
+	case EmailProviderSES:
+		if params.Secret == "" || params.Region == "" {
+			return nil, fmt.Errorf("secret and region are required for %s", params.Provider)
+		}
+		endpoint = "https://email." + params.Region + ".amazonaws.com"
+	case EmailProviderSendGrid:
+		endpoint = "https://api.sendgrid.com"
+	case EmailProviderMailgun:
+		if params.Domain == "" {
+			return nil, fmt.Errorf("domain is required for %s", params.Provider)
+		}
+		endpoint = "https://api.mailgun.net"
+		if params.Region == "eu" {
+			endpoint = "https://api.eu.mailgun.net"
+		}
+	case EmailProviderPostmark:
+		endpoint = "https://api.postmarkapp.com"
+	default:
+		return nil, fmt.Errorf("unknown email provider %q", params.Provider)
+	}
+	if params.Endpoint == "" {
+		params.Endpoint = endpoint
+	}
+	params.Endpoint = strings.TrimSuffix(params.Endpoint, "/")
+	if params.Timeout <= 0 {
+		params.Timeout = defaultEmailTimeout
+	}
+	return &EmailAPI{EmailAPIParams: params, client: &http.Client{Timeout: params.Timeout}, now: time.Now}, nil
+}
+
+// Send sends the text to the "mailto:" destination
+func (e *EmailAPI) Send(ctx context.Context, destination, text string) error {
+	msg, err := parseMailto(destination)
+	if err != nil {
+		return err
+	}
+	msg.html = text
+
+	var req *http.Request
+	switch e.Provider {
+	case EmailProviderSES:
+		req, err = e.sesRequest(ctx, msg)
+	case EmailProviderSendGrid:
+		req, err = e.sendGridRequest(ctx, msg)
+	case EmailProviderMailgun:
+		req, err = e.mailgunRequest(ctx, msg)
+	case EmailProviderPostmark:
+		req, err = e.postmarkRequest(ctx, msg)
+	default:
+		err = fmt.Errorf("unknown email provider %q", e.Provider)
+	}
+	if err != nil {
+		return fmt.Errorf("can't make %s request: %w", e.Provider, err)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s request failed: %w", e.Provider, err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // read-only body
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, emailAPIErrorLimit))
+		return fmt.Errorf("%s responded with status %d: %s", e.Provider, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func (e *EmailAPI) String() string {
+	return fmt.Sprintf("email: with %s api at %s", e.Provider, e.Endpoint)
+}
+
+// sendGridRequest makes request of SendGrid v3 mail send API
+func (e *EmailAPI) sendGridRequest(ctx context.Context, msg emailAPIMessage) (*http.Request, error) {
+	type address struct {
+		Email string `json:"email"`
+		Name  string `json:"name,omitempty"`
+	}
+	from, err := mail.ParseAddress(msg.from)
+	if err != nil {
+		return nil, fmt.Errorf("bad from address %q: %w", msg.from, err)
+	}
+	to := make([]address, 0, len(msg.to))
+	for _, addr := range msg.to {
+		to = append(to, address{Email: addr})
+	}
+	payload := map[string]any{
+		"personalizations": []map[string]any{{"to": to}},
+		"from":             address{Email: from.Address, Name: from.Name},
+		"subject":          msg.subject,
+		"content":          []map[string]string{{"type": "text/html", "value": msg.html}},
+	}
+	if msg.replyTo != "" {
+		replyTo, e := mail.ParseAddress(msg.replyTo)
+		if e != nil {
+			return nil, fmt.Errorf("bad reply-to address %q: %w", msg.replyTo, e)
+		}
+		payload["reply_to"] = address{Email: replyTo.Address, Name: replyTo.Name}
+	}
+	if msg.unsubscribeLink != "" {
+		payload["headers"] = map[string]string{"List-Unsubscribe": "<" + msg.unsubscribeLink + ">",
+			"List-Unsubscribe-Post": listUnsubscribePost}
+	}
+	req, err := jsonRequest(ctx, e.Endpoint+"/v3/mail/send", payload)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+e.Key)
+	return req, nil
+}
+
+// mailgunRequest makes request of Mailgun messages API
+func (e *EmailAPI) mailgunRequest(ctx context.Context, msg emailAPIMessage) (*http.Request, error) {
+	form := url.Values{}
+	form.Set("from", msg.from)
+	form.Set("to", strings.Join(msg.to, ","))
+	form.Set("subject", msg.subject)
+	form.Set("html", msg.html)
+	if msg.replyTo != "" {
+		form.Set("h:Reply-To", msg.replyTo)
+	}
+	if msg.unsubscribeLink != "" {
+		form.Set("h:List-Unsubscribe", "<"+msg.unsubscribeLink+">")
+		form.Set("h:List-Unsubscribe-Post", listUnsubscribePost)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.Endpoint+"/v3/"+url.PathEscape(e.Domain)+"/messages",
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth("api", e.Key)
+	return req, nil
+}
+
+// postmarkRequest makes request of Postmark email API
+func (e *EmailAPI) postmarkRequest(ctx context.Context, msg emailAPIMessage) (*http.Request, error) {
+	payload := map[string]any{
+		"From":          msg.from,
+		"To":            strings.Join(msg.to, ","),
+		"Subject":       msg.subject,
+		"HtmlBody":      msg.html,
+		"MessageStream": "outbound",
+	}
+	if msg.replyTo != "" {
+		payload["ReplyTo"] = msg.replyTo
+	}
+	if msg.unsubscribeLink != "" {
+		payload["Headers"] = unsubscribeHeaders(msg.unsubscribeLink)
+	}
+	req, err := jsonRequest(ctx, e.Endpoint+"/email", payload)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-Postmark-Server-Token", e.Key)
+	return req, nil
+}
+
+// sesRequest makes request of Amazon SES v2 SendEmail API, signed with AWS signature version 4
+func (e *EmailAPI) sesRequest(ctx context.Context, msg emailAPIMessage) (*http.Request, error) {
+	content := map[string]any{
+		"Subject": map[string]string{"Data": msg.subject, "Charset": "UTF-8"},
+		"Body":    map[string]any{"Html": map[string]string{"Data": msg.html, "Charset": "UTF-8"}},
+	}
+	if msg.unsubscribeLink != "" {
+		content["Headers"] = unsubscribeHeaders(msg.unsubscribeLink)
+	}
+	payload := map[string]any{
+		"FromEmailAddress": msg.from,
+		"Destination":      map[string]any{"ToAddresses": msg.to},
+		"Content":          map[string]any{"Simple": content},
+	}
+	if msg.replyTo != "" {
+		payload["ReplyToAddresses"] = []string{msg.replyTo}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.Endpoint+"/v2/email/outbound-emails", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	signAWSv4(req, body, e.Key, e.Secret, e.Region, "ses", e.now())
+	return req, nil
+}
+
+// unsubscribeHeaders makes one-click unsubscribe headers, RFC 8058, as list of name and value pairs
+func unsubscribeHeaders(link string) []map[string]string {
+	return []map[string]string{
+		{"Name": "List-Unsubscribe", "Value": "<" + link + ">"},
+		{"Name": "List-Unsubscribe-Post", "Value": listUnsubscribePost},
+	}
+}
+
+// jsonRequest makes POST request with the payload marshaled to json
+func jsonRequest(ctx context.Context, endpoint string, payload any) (*http.Request, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// signAWSv4 adds AWS signature version 4 of the request to its Authorization header,
+// signed headers are host and x-amz-date, the request has no query
+func signAWSv4(req *http.Request, body []byte, key, secret, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	payloadHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{req.Method, path, req.URL.RawQuery,
+		"host:" + req.URL.Host + "\nx-amz-date:" + amzDate + "\n", "host;x-amz-date", hex.EncodeToString(payloadHash[:])}, "\n")
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	signature := hex.EncodeToString(hmacSHA256(awsSigningKey(secret, date, region, service), stringToSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+key+"/"+scope+", SignedHeaders=host;x-amz-date, Signature="+signature)
+}
+
+// awsSigningKey derives AWS signature version 4 signing key for the date, region and service
+func awsSigningKey(secret, date, region, service string) []byte {
+	res := hmacSHA256([]byte("AWS4"+secret), date)
+	res = hmacSHA256(res, region)
+	res = hmacSHA256(res, service)
+	return hmacSHA256(res, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// parseMailto parses "mailto:" destination, same as go-pkgz/notify email client does
+func parseMailto(destination string) (emailAPIMessage, error) {
+	u, err := url.Parse(destination)
+	if err != nil {
+		return emailAPIMessage{}, err
+	}
+	if u.Scheme != "mailto" {
+		return emailAPIMessage{}, fmt.Errorf("unsupported scheme %s, should be mailto", u.Scheme)
+	}
+	addresses, err := mail.ParseAddressList(u.Opaque)
+	if err != nil {
+		return emailAPIMessage{}, fmt.Errorf("problem parsing email recipients: %w", err)
+	}
+	res := emailAPIMessage{from: u.Query().Get("from"), replyTo: u.Query().Get("replyTo"), subject: u.Query().Get("subject"),
+		unsubscribeLink: u.Query().Get("unsubscribeLink")}
+	for _, addr := range addresses {
+		res.to = append(res.to, addr.Address)
+	}
+	return res, nil
+}
@@ -0,0 +1,154 @@
+package notify
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewEmailAPI(t *testing.T) {
+	tbl := []struct {
+		params   EmailAPIParams
+		endpoint string
+		err      string
+	}{
+		{EmailAPIParams{Provider: "sendgrid", Key: "k"}, "https://api.sendgrid.com", ""},
+		{EmailAPIParams{Provider: "postmark", Key: "k"}, "https://api.postmarkapp.com", ""},
+		{EmailAPIParams{Provider: "mailgun", Key: "k", Domain: "mg.example.com"}, "https://api.mailgun.net", ""},
+		{EmailAPIParams{Provider: "mailgun", Key: "k", Domain: "mg.example.com", Region: "eu"}, "https://api.eu.mailgun.net", ""},
+		{EmailAPIParams{Provider: "ses", Key: "k", Secret: "s", Region: "eu-west-1"}, "https://email.eu-west-1.amazonaws.com", ""},
+		{EmailAPIParams{Provider: "sendgrid", Key: "k", Endpoint: "http://localhost:8080/"}, "http://localhost:8080", ""},
+		{EmailAPIParams{Provider: "sendgrid"}, "", "api key is required for sendgrid"},
+		{EmailAPIParams{Provider: "mailgun", Key: "k"}, "", "domain is required for mailgun"},
+		{EmailAPIParams{Provider: "ses", Key: "k", Region: "eu-west-1"}, "", "secret and region are required for ses"},
+		{EmailAPIParams{Provider: "smtp", Key: "k"}, "", `unknown email provider "smtp"`},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.params.Provider+tt.endpoint, func(t *testing.T) {
+			res, err := NewEmailAPI(tt.params)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.endpoint, res.Endpoint)
+			assert.Equal(t, defaultEmailTimeout, res.Timeout)
+		})
+	}
+}
+
+func TestEmailAPI_Send(t *testing.T) {
+	var req *http.Request
+	var body string
+	status := http.StatusOK
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		req, body = r, string(b)
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"message":"bad request"}`))
+	}))
+	defer ts.Close()
+
+	dest := "mailto:user@example.com?from=" + "%22Remark42%22+%3Cnotify%40example.com%3E" +
+		"&replyTo=support%40example.com&subject=New+reply&unsubscribeLink=https%3A%2F%2Fremark42.example.com%2Funsubscribe%3Ftkn%3D1"
+	send := func(params EmailAPIParams) error {
+		params.Endpoint = ts.URL
+		api, err := NewEmailAPI(params)
+		require.NoError(t, err)
+		api.now = func() time.Time { return time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC) }
+		return api.Send(context.Background(), dest, "<p>hello</p>")
+	}
+
+	require.NoError(t, send(EmailAPIParams{Provider: "sendgrid", Key: "sg-key"}))
+	assert.Equal(t, "/v3/mail/send", req.URL.Path)
+	assert.Equal(t, "Bearer sg-key", req.Header.Get("Authorization"))
+	assert.JSONEq(t, `{"personalizations":[{"to":[{"email":"user@example.com"}]}],
+		"from":{"email":"notify@example.com","name":"Remark42"},"reply_to":{"email":"support@example.com"},"subject":"New reply",
+		"content":[{"type":"text/html","value":"<p>hello</p>"}],
+		"headers":{"List-Unsubscribe":"<https://remark42.example.com/unsubscribe?tkn=1>",
+		"List-Unsubscribe-Post":"List-Unsubscribe=One-Click"}}`, body)
+
+	require.NoError(t, send(EmailAPIParams{Provider: "mailgun", Key: "mg-key", Domain: "mg.example.com"}))
+	assert.Equal(t, "/v3/mg.example.com/messages", req.URL.Path)
+	user, pass, ok := req.BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, "api", user)
+	assert.Equal(t, "mg-key", pass)
+	form, err := url.ParseQuery(body)
+	require.NoError(t, err)
+	assert.Equal(t, `"Remark42" <notify@example.com>`, form.Get("from"))
+	assert.Equal(t, "user@example.com", form.Get("to"))
+	assert.Equal(t, "New reply", form.Get("subject"))
+	assert.Equal(t, "<p>hello</p>", form.Get("html"))
+	assert.Equal(t, "support@example.com", form.Get("h:Reply-To"))
+	assert.Equal(t, "<https://remark42.example.com/unsubscribe?tkn=1>", form.Get("h:List-Unsubscribe"))
+	assert.Equal(t, "List-Unsubscribe=One-Click", form.Get("h:List-Unsubscribe-Post"))
+
+	require.NoError(t, send(EmailAPIParams{Provider: "postmark", Key: "pm-key"}))
+	assert.Equal(t, "/email", req.URL.Path)
+	assert.Equal(t, "pm-key", req.Header.Get("X-Postmark-Server-Token"))
+	assert.JSONEq(t, `{"From":"\"Remark42\" <notify@example.com>","To":"user@example.com","Subject":"New reply",
+		"HtmlBody":"<p>hello</p>","MessageStream":"outbound","ReplyTo":"support@example.com",
+		"Headers":[{"Name":"List-Unsubscribe","Value":"<https://remark42.example.com/unsubscribe?tkn=1>"},
+		{"Name":"List-Unsubscribe-Post","Value":"List-Unsubscribe=One-Click"}]}`, body)
+
+	require.NoError(t, send(EmailAPIParams{Provider: "ses", Key: "AKID", Secret: "secret", Region: "eu-west-1"}))
+	assert.Equal(t, "/v2/email/outbound-emails", req.URL.Path)
+	assert.Equal(t, "20260102T030405Z", req.Header.Get("X-Amz-Date"))
+	assert.True(t, strings.HasPrefix(req.Header.Get("Authorization"),
+		"AWS4-HMAC-SHA256 Credential=AKID/20260102/eu-west-1/ses/aws4_request, SignedHeaders=host;x-amz-date, Signature="))
+	payload := map[string]any{}
+	require.NoError(t, json.Unmarshal([]byte(body), &payload))
+	assert.Equal(t, `"Remark42" <notify@example.com>`, payload["FromEmailAddress"])
+	assert.Equal(t, map[string]any{"ToAddresses": []any{"user@example.com"}}, payload["Destination"])
+	assert.Equal(t, []any{"support@example.com"}, payload["ReplyToAddresses"])
+
+	status = http.StatusBadRequest
+	err = send(EmailAPIParams{Provider: "postmark", Key: "pm-key"})
+	assert.EqualError(t, err, `postmark responded with status 400: {"message":"bad request"}`)
+
+	api, err := NewEmailAPI(EmailAPIParams{Provider: "postmark", Key: "pm-key", Endpoint: ts.URL})
+	require.NoError(t, err)
+	assert.Error(t, api.Send(context.Background(), "https://example.com", "text"), "not mailto")
+	assert.Error(t, api.Send(context.Background(), "mailto:bad", "text"), "bad address")
+	assert.Equal(t, "email: with postmark api at "+ts.URL, api.String())
+}
+
+func TestEmail_WithAPI(t *testing.T) {
+	var body string
+	ts := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		body = string(b)
+	}))
+	defer ts.Close()
+
+	api, err := NewEmailAPI(EmailAPIParams{Provider: "postmark", Key: "pm-key", Endpoint: ts.URL})
+	require.NoError(t, err)
+	email, err := NewAPIEmail(EmailParams{From: "notify@example.com"}, api)
+	require.NoError(t, err)
+	assert.Equal(t, "email: with postmark api at "+ts.URL, email.String())
+	assert.Equal(t, "email", destinationName(email))
+
+	msg := UserMessage{SiteID: "remark", UserID: "1", Subject: "unblocked", Text: "you can comment again", email: "user@example.com"}
+	require.NoError(t, email.SendMessage(context.Background(), msg))
+	assert.Contains(t, body, `"To":"user@example.com"`)
+	assert.Contains(t, body, `"Subject":"unblocked"`)
+}
+
+func TestAWSSigningKey(t *testing.T) {
+	// example from AWS documentation on deriving the signing key
+	key := awsSigningKey("wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "20120215", "us-east-1", "iam")
+	assert.Equal(t, "f4780e2d9f65fa895f9c67b32ce1baf0b0d8a43505a000a1a9e090d414db404d", hex.EncodeToString(key))
+}
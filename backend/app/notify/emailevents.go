@@ -0,0 +1,163 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// kinds of email events
+const (
+	EmailBounce    = "bounce"
+	EmailComplaint = "complaint"
+)
+
+// EmailEvent is a permanent bounce or spam complaint about the address, reported by the email provider
+type EmailEvent struct {
+	Address string `json:"address"`
+	Kind    string `json:"kind"`
+}
+
+// snsHost matches hosts of Amazon SNS, the only ones allowed in SES subscription confirmation
+var snsHost = regexp.MustCompile(`^sns\.[a-z0-9-]+\.amazonaws\.com$`)
+
+// ParseEmailEvents parses webhook payload of the provider to permanent bounces and complaints, other events,
+// like delivery or temporary failure, are ignored. For Amazon SNS subscription of SES notifications returns
+// URL to confirm the subscription.
+func ParseEmailEvents(provider string, body []byte) (events []EmailEvent, confirmURL string, err error) {
+	switch provider {
+	case EmailProviderSES:
+		return parseSESEvents(body)
+	case EmailProviderSendGrid:
+		events, err = parseSendGridEvents(body)
+	case EmailProviderMailgun:
+		events, err = parseMailgunEvents(body)
+	case EmailProviderPostmark:
+		events, err = parsePostmarkEvents(body)
+	default:
+		err = fmt.Errorf("unknown email provider %q", provider)
+	}
+	return events, "", err
+}
+
+// parseSESEvents parses SES notification delivered by Amazon SNS
+func parseSESEvents(body []byte) ([]EmailEvent, string, error) {
+	envelope := struct {
+		Type         string
+		Message      string
+		SubscribeURL string
+	}{}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, "", fmt.Errorf("can't decode sns message: %w", err)
+	}
+	switch envelope.Type {
+	case "SubscriptionConfirmation":
+		u, err := url.Parse(envelope.SubscribeURL)
+		if err != nil || u.Scheme != "https" || !snsHost.MatchString(u.Host) {
+			return nil, "", fmt.Errorf("bad subscription url %q", envelope.SubscribeURL)
+		}
+		return nil, envelope.SubscribeURL, nil
+	case "Notification":
+	default:
+		return nil, "", nil
+	}
+
+	type recipient struct {
+		EmailAddress string `json:"emailAddress"`
+	}
+	msg := struct {
+		NotificationType string `json:"notificationType"` // set by identity notifications
+		EventType        string `json:"eventType"`        // set by configuration set event publishing
+		Bounce           struct {
+			BounceType        string      `json:"bounceType"`
+			BouncedRecipients []recipient `json:"bouncedRecipients"`
+		} `json:"bounce"`
+		Complaint struct {
+			ComplainedRecipients []recipient `json:"complainedRecipients"`
+		} `json:"complaint"`
+	}{}
+	if err := json.Unmarshal([]byte(envelope.Message), &msg); err != nil {
+		return nil, "", fmt.Errorf("can't decode ses notification: %w", err)
+	}
+
+	var res []EmailEvent
+	switch strings.ToLower(msg.NotificationType + msg.EventType) {
+	case "bounce":
+		if msg.Bounce.BounceType != "Permanent" {
+			return nil, "", nil
+		}
+		for _, r := range msg.Bounce.BouncedRecipients {
+			res = append(res, EmailEvent{Address: r.EmailAddress, Kind: EmailBounce})
+		}
+	case "complaint":
+		for _, r := range msg.Complaint.ComplainedRecipients {
+			res = append(res, EmailEvent{Address: r.EmailAddress, Kind: EmailComplaint})
+		}
+	}
+	return res, "", nil
+}
+
+// parseSendGridEvents parses batch of SendGrid event webhook, blocked messages are temporary failures
+func parseSendGridEvents(body []byte) ([]EmailEvent, error) {
+	events := []struct {
+		Email string `json:"email"`
+		Event string `json:"event"`
+		Type  string `json:"type"`
+	}{}
+	if err := json.Unmarshal(body, &events); err != nil {
+		return nil, fmt.Errorf("can't decode sendgrid events: %w", err)
+	}
+	var res []EmailEvent
+	for _, e := range events {
+		switch {
+		case e.Event == "bounce" && e.Type != "blocked":
+			res = append(res, EmailEvent{Address: e.Email, Kind: EmailBounce})
+		case e.Event == "spamreport":
+			res = append(res, EmailEvent{Address: e.Email, Kind: EmailComplaint})
+		}
+	}
+	return res, nil
+}
+
+// parseMailgunEvents parses Mailgun webhook, failures with temporary severity are retried by Mailgun
+func parseMailgunEvents(body []byte) ([]EmailEvent, error) {
+	payload := struct {
+		EventData struct {
+			Event     string `json:"event"`
+			Severity  string `json:"severity"`
+			Recipient string `json:"recipient"`
+		} `json:"event-data"`
+	}{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("can't decode mailgun event: %w", err)
+	}
+	e := payload.EventData
+	switch {
+	case e.Event == "failed" && e.Severity == "permanent":
+		return []EmailEvent{{Address: e.Recipient, Kind: EmailBounce}}, nil
+	case e.Event == "complained":
+		return []EmailEvent{{Address: e.Recipient, Kind: EmailComplaint}}, nil
+	}
+	return nil, nil
+}
+
+// parsePostmarkEvents parses Postmark bounce and spam complaint webhooks
+func parsePostmarkEvents(body []byte) ([]EmailEvent, error) {
+	payload := struct {
+		RecordType string
+		Type       string
+		Email      string
+	}{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("can't decode postmark event: %w", err)
+	}
+	switch {
+	case payload.RecordType == "Bounce" && (payload.Type == "HardBounce" || payload.Type == "BadEmailAddress"):
+		return []EmailEvent{{Address: payload.Email, Kind: EmailBounce}}, nil
+	case payload.RecordType == "SpamComplaint":
+		return []EmailEvent{{Address: payload.Email, Kind: EmailComplaint}}, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,74 @@
+package notify
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEmailEvents(t *testing.T) {
+	sns := func(msg string) string {
+		b, err := json.Marshal(map[string]string{"Type": "Notification", "Message": msg})
+		require.NoError(t, err)
+		return string(b)
+	}
+	tbl := []struct {
+		name, provider, body string
+		res                  []EmailEvent
+		err                  bool
+	}{
+		{"ses bounce", "ses", sns(`{"notificationType":"Bounce","bounce":{"bounceType":"Permanent",` +
+			`"bouncedRecipients":[{"emailAddress":"a@example.com"},{"emailAddress":"b@example.com"}]}}`),
+			[]EmailEvent{{"a@example.com", EmailBounce}, {"b@example.com", EmailBounce}}, false},
+		{"ses transient bounce", "ses", sns(`{"notificationType":"Bounce","bounce":{"bounceType":"Transient",` +
+			`"bouncedRecipients":[{"emailAddress":"a@example.com"}]}}`), nil, false},
+		{"ses complaint event", "ses", sns(`{"eventType":"Complaint","complaint":{"complainedRecipients":[{"emailAddress":"a@example.com"}]}}`),
+			[]EmailEvent{{"a@example.com", EmailComplaint}}, false},
+		{"ses delivery", "ses", sns(`{"notificationType":"Delivery"}`), nil, false},
+		{"ses bad message", "ses", sns(`bad`), nil, true},
+		{"ses unsubscribe", "ses", `{"Type":"UnsubscribeConfirmation"}`, nil, false},
+		{"sendgrid", "sendgrid", `[{"email":"a@example.com","event":"bounce","type":"bounce"},` +
+			`{"email":"b@example.com","event":"bounce","type":"blocked"},{"email":"c@example.com","event":"delivered"},` +
+			`{"email":"d@example.com","event":"spamreport"}]`,
+			[]EmailEvent{{"a@example.com", EmailBounce}, {"d@example.com", EmailComplaint}}, false},
+		{"sendgrid bad", "sendgrid", `{}`, nil, true},
+		{"mailgun permanent", "mailgun", `{"event-data":{"event":"failed","severity":"permanent","recipient":"a@example.com"}}`,
+			[]EmailEvent{{"a@example.com", EmailBounce}}, false},
+		{"mailgun temporary", "mailgun", `{"event-data":{"event":"failed","severity":"temporary","recipient":"a@example.com"}}`, nil, false},
+		{"mailgun complaint", "mailgun", `{"event-data":{"event":"complained","recipient":"a@example.com"}}`,
+			[]EmailEvent{{"a@example.com", EmailComplaint}}, false},
+		{"postmark hard bounce", "postmark", `{"RecordType":"Bounce","Type":"HardBounce","Email":"a@example.com"}`,
+			[]EmailEvent{{"a@example.com", EmailBounce}}, false},
+		{"postmark soft bounce", "postmark", `{"RecordType":"Bounce","Type":"SoftBounce","Email":"a@example.com"}`, nil, false},
+		{"postmark complaint", "postmark", `{"RecordType":"SpamComplaint","Email":"a@example.com"}`,
+			[]EmailEvent{{"a@example.com", EmailComplaint}}, false},
+		{"postmark bad", "postmark", `bad`, nil, true},
+		{"unknown", "smtp", `{}`, nil, true},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			res, confirm, err := ParseEmailEvents(tt.provider, []byte(tt.body))
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.res, res)
+			assert.Empty(t, confirm)
+		})
+	}
+}
+
+func TestParseEmailEvents_SESSubscription(t *testing.T) {
+	_, confirm, err := ParseEmailEvents("ses", []byte(`{"Type":"SubscriptionConfirmation",`+
+		`"SubscribeURL":"https://sns.eu-west-1.amazonaws.com/?Action=ConfirmSubscription&Token=123"}`))
+	require.NoError(t, err)
+	assert.Equal(t, "https://sns.eu-west-1.amazonaws.com/?Action=ConfirmSubscription&Token=123", confirm)
+
+	for _, u := range []string{"http://sns.eu-west-1.amazonaws.com/", "https://sns.eu-west-1.amazonaws.com.example.com/", "https://example.com/"} {
+		_, _, err = ParseEmailEvents("ses", []byte(`{"Type":"SubscriptionConfirmation","SubscribeURL":"`+u+`"}`))
+		assert.Error(t, err, u)
+	}
+}
@@ -4,6 +4,7 @@ package notify
 import (
 	"context"
 	"fmt"
+	"slices"
 	"sync"
 	"sync/atomic"
 
@@ -18,6 +19,13 @@ type Service struct {
 	destinations      []Destination
 	queue             chan Request
 	verificationQueue chan VerificationRequest
+	messageQueue      chan UserMessage
+	adminQueue        chan AdminMessage
+	deliveries        deliveryLog
+	pending           collapser
+
+	Collapse CollapseWindows // windows collapsing notifications of the user about the thread, disabled if not set
+	Quota    QuotaChecker    // counts sends of comment notifications and user messages per site, not limited if not set
 
 	closed uint32 // non-zero means closed. uses uint instead of bool for atomic
 	ctx    context.Context
@@ -38,15 +46,26 @@ type Store interface {
 	GetUserTelegram(siteID, userID string) (string, error)
 }
 
+// QuotaChecker checks quota of the site's notification sends and counts the send, false if the send rejected
+type QuotaChecker interface {
+	UseNotifyQuota(siteID string) bool
+}
+
 // used for email and telegram retrieval from user details
 type getUserDetail func(string, string) (string, error)
 
 // Request notification for a Comment
 type Request struct {
-	Comment   store.Comment
-	parent    store.Comment
-	Emails    []string
-	Telegrams []string
+	Comment      store.Comment
+	parent       store.Comment
+	Emails       []string
+	Telegrams    []string
+	Welcome      string   // welcome message for the first comment of the user, sent to the comment author
+	SkipWatchers bool     // don't notify users watching the thread, i.e. authors of parent comments
+	Destinations []string // names of destinations to send to, like "email" or "telegram", all if nil
+	welcomeEmail string
+	usersOnly    bool // notify users only, admins got notified about the comment already
+	collapsed    int  // number of earlier comments collapsed into the notification
 }
 
 // VerificationRequest notification for user
@@ -57,6 +76,32 @@ type VerificationRequest struct {
 	Token  string
 }
 
+// UserMessage is a plain text message to the user of the site, like notice of the scheduled unblock
+type UserMessage struct {
+	SiteID  string
+	UserID  string
+	Subject string
+	Text    string
+	email   string
+}
+
+// MessageSender is implemented by destinations able to send messages to users
+type MessageSender interface {
+	SendMessage(context.Context, UserMessage) error
+}
+
+// AdminMessage is a plain text message to admins of the site, like report of a background job
+type AdminMessage struct {
+	SiteID  string
+	Subject string
+	Text    string
+}
+
+// AdminMessageSender is implemented by destinations able to send messages to admins
+type AdminMessageSender interface {
+	SendAdminMessage(context.Context, AdminMessage) error
+}
+
 const defaultQueueSize = 100
 const uiNav = "#remark42__comment-"
 
@@ -70,10 +115,13 @@ func NewService(dataService Store, size int, destinations ...Destination) *Servi
 		dataService:       dataService,
 		queue:             make(chan Request, size),
 		verificationQueue: make(chan VerificationRequest, size),
+		messageQueue:      make(chan UserMessage, size),
+		adminQueue:        make(chan AdminMessage, size),
 		destinations:      destinations,
 		ctx:               ctx,
 		cancel:            cancel,
 	}
+	res.pending.queue = res.queue
 	if len(destinations) > 0 {
 		go res.do()
 	}
@@ -89,9 +137,31 @@ func (s *Service) Submit(req Request) {
 	if s.dataService != nil && req.Comment.ParentID != "" {
 		if p, err := s.dataService.Get(req.Comment.Locator, req.Comment.ParentID, store.User{}); err == nil {
 			req.parent = p
-			req.Emails = s.getNotificationTargets(req, p, s.dataService.GetUserEmail)
-			req.Telegrams = s.getNotificationTargets(req, p, s.dataService.GetUserTelegram)
+			if !req.SkipWatchers {
+				req.Emails = s.getNotificationTargets(req, p, s.dataService.GetUserEmail)
+				req.Telegrams = s.getNotificationTargets(req, p, s.dataService.GetUserTelegram)
+			}
+		}
+	}
+	if req.Comment.Visibility == store.VisibilityPrivate {
+		// private reply is sent to its recipient only, not to admins and broadcast destinations
+		req.usersOnly = true
+		req.Destinations = privateDestinations(req.Destinations)
+	}
+	if win := s.Collapse.Window(req.Comment.Locator.SiteID); win > 0 {
+		if req.Destinations == nil || slices.Contains(req.Destinations, "email") {
+			req.Emails = s.pending.hold(req, "email", req.Emails, win)
 		}
+		if req.Destinations == nil || slices.Contains(req.Destinations, "telegram") {
+			req.Telegrams = s.pending.hold(req, "telegram", req.Telegrams, win)
+		}
+	}
+	if s.dataService != nil && req.Welcome != "" {
+		email, err := s.dataService.GetUserEmail(req.Comment.Locator.SiteID, req.Comment.User.ID)
+		if err != nil {
+			log.Printf("[WARN] can't read email for welcome message to %s, %v", req.Comment.User.ID, err)
+		}
+		req.welcomeEmail = email
 	}
 	select {
 	case s.queue <- req:
@@ -120,7 +190,8 @@ func (s *Service) getNotificationTargets(
 			result = append(result, detail)
 		}
 	}
-	if notifyComment.ParentID != "" {
+	// private reply reaches the author of the parent comment only
+	if notifyComment.ParentID != "" && req.Comment.Visibility != store.VisibilityPrivate {
 		if p, err := s.dataService.Get(req.Comment.Locator, notifyComment.ParentID, store.User{}); err == nil {
 			result = append(result, s.getNotificationTargets(req, p, getUserDetail)...)
 		}
@@ -128,6 +199,17 @@ func (s *Service) getNotificationTargets(
 	return deduplicateStrings(result)
 }
 
+// privateDestinations limits destinations of private reply to the ones notifying users directly
+func privateDestinations(destinations []string) []string {
+	res := []string{}
+	for _, d := range []string{"email", "telegram"} {
+		if destinations == nil || slices.Contains(destinations, d) {
+			res = append(res, d)
+		}
+	}
+	return res
+}
+
 // SubmitVerification to internal channel if not busy, drop if can't send
 func (s *Service) SubmitVerification(req VerificationRequest) {
 	if len(s.destinations) == 0 || atomic.LoadUint32(&s.closed) != 0 {
@@ -140,6 +222,36 @@ func (s *Service) SubmitVerification(req VerificationRequest) {
 	}
 }
 
+// SubmitMessage to internal channel if not busy, drop if can't send or the user has no email
+func (s *Service) SubmitMessage(msg UserMessage) {
+	if len(s.destinations) == 0 || atomic.LoadUint32(&s.closed) != 0 || s.dataService == nil {
+		return
+	}
+	email, err := s.dataService.GetUserEmail(msg.SiteID, msg.UserID)
+	if err != nil || email == "" {
+		log.Printf("[DEBUG] no email for message to %s on %s, %v", msg.UserID, msg.SiteID, err)
+		return
+	}
+	msg.email = email
+	select {
+	case s.messageQueue <- msg:
+	default:
+		log.Printf("[WARN] can't send message to queue, %q for %s", msg.Subject, msg.UserID)
+	}
+}
+
+// SubmitAdminMessage to internal channel if not busy, drop if can't send
+func (s *Service) SubmitAdminMessage(msg AdminMessage) {
+	if len(s.destinations) == 0 || atomic.LoadUint32(&s.closed) != 0 {
+		return
+	}
+	select {
+	case s.adminQueue <- msg:
+	default:
+		log.Printf("[WARN] can't send admin message to queue, %q for %s", msg.Subject, msg.SiteID)
+	}
+}
+
 // Close queue channel and wait for completion
 func (s *Service) Close() {
 	if s.queue != nil {
@@ -150,8 +262,11 @@ func (s *Service) Close() {
 		default:
 		}
 		log.Print("[DEBUG] close notifier")
+		s.pending.stop()
 		close(s.queue)
 		close(s.verificationQueue)
+		close(s.messageQueue)
+		close(s.adminQueue)
 		s.cancel()
 		<-s.ctx.Done()
 	}
@@ -167,10 +282,13 @@ func (s *Service) do() {
 			if !ok {
 				return
 			}
-			wg.Add(len(s.destinations))
 			for _, dest := range s.destinations {
+				if c.Destinations != nil && !slices.Contains(c.Destinations, destinationName(dest)) {
+					continue
+				}
+				wg.Add(1)
 				go func(d Destination) {
-					if err := d.Send(s.ctx, c); err != nil {
+					if err := s.send(d, c); err != nil {
 						log.Printf("[WARN] failed to send to %s, %s", d, err)
 					}
 					wg.Done()
@@ -184,13 +302,49 @@ func (s *Service) do() {
 			wg.Add(len(s.destinations))
 			for _, dest := range s.destinations {
 				go func(d Destination) {
-					if err := d.SendVerification(s.ctx, v); err != nil {
+					if err := s.sendVerification(d, v); err != nil {
 						log.Printf("[WARN] failed to send to %s, %s", d, err)
 					}
 					wg.Done()
 				}(dest)
 			}
 			wg.Wait()
+		case m, ok := <-s.messageQueue:
+			if !ok {
+				return
+			}
+			for _, dest := range s.destinations {
+				ms, isSender := dest.(MessageSender)
+				if !isSender {
+					continue
+				}
+				wg.Add(1)
+				go func(d Destination, ms MessageSender) {
+					if err := s.sendMessage(d, ms, m); err != nil {
+						log.Printf("[WARN] failed to send to %s, %s", d, err)
+					}
+					wg.Done()
+				}(dest, ms)
+			}
+			wg.Wait()
+		case m, ok := <-s.adminQueue:
+			if !ok {
+				return
+			}
+			for _, dest := range s.destinations {
+				as, isSender := dest.(AdminMessageSender)
+				if !isSender {
+					continue
+				}
+				wg.Add(1)
+				go func(d Destination, as AdminMessageSender) {
+					if err := s.sendAdminMessage(d, as, m); err != nil {
+						log.Printf("[WARN] failed to send to %s, %s", d, err)
+					}
+					wg.Done()
+				}(dest, as)
+			}
+			wg.Wait()
 		case <-s.ctx.Done():
 			return
 		}
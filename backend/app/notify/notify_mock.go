@@ -12,6 +12,8 @@ import (
 type MockDest struct {
 	data             []Request
 	verificationData []VerificationRequest
+	messages         []UserMessage
+	adminMessages    []AdminMessage
 	id               int
 	closed           bool
 	lock             sync.Mutex
@@ -52,6 +54,24 @@ func (m *MockDest) SendVerification(ctx context.Context, v VerificationRequest)
 	return nil
 }
 
+// SendMessage mock
+func (m *MockDest) SendMessage(_ context.Context, msg UserMessage) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.messages = append(m.messages, msg)
+	log.Printf("sent message %s -> %d", msg.UserID, m.id)
+	return nil
+}
+
+// SendAdminMessage mock
+func (m *MockDest) SendAdminMessage(_ context.Context, msg AdminMessage) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.adminMessages = append(m.adminMessages, msg)
+	log.Printf("sent admin message %q -> %d", msg.Subject, m.id)
+	return nil
+}
+
 // Get mock
 func (m *MockDest) Get() []Request {
 	m.lock.Lock()
@@ -82,3 +102,21 @@ func (m *MockDest) String() string {
 	defer m.lock.Unlock()
 	return fmt.Sprintf("mock id=%d, closed=%v", m.id, m.closed)
 }
+
+// GetMessages mock
+func (m *MockDest) GetMessages() []UserMessage {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	res := make([]UserMessage, len(m.messages))
+	copy(res, m.messages)
+	return res
+}
+
+// GetAdminMessages mock
+func (m *MockDest) GetAdminMessages() []AdminMessage {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	res := make([]AdminMessage, len(m.adminMessages))
+	copy(res, m.adminMessages)
+	return res
+}
@@ -1,7 +1,9 @@
 package notify
 
 import (
+	"context"
 	"fmt"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"testing/synctest"
@@ -219,6 +221,186 @@ func TestService_EmailRetrieval(t *testing.T) {
 	})
 }
 
+func TestService_WelcomeEmailRetrieval(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		dest := &MockDest{id: 1}
+		dataStore := &mockStore{data: map[string]store.Comment{}, userDetails: map[string]string{}}
+		dataStore.data["c1"] = store.Comment{ID: "c1", User: store.User{ID: "u1"}, NewMember: true}
+		dataStore.data["c2"] = store.Comment{ID: "c2", User: store.User{ID: "u2"}, NewMember: true}
+		dataStore.userDetails["u1"] = "u1@example.com"
+
+		s := NewService(dataStore, 1, dest)
+		s.Submit(Request{Comment: dataStore.data["c1"], Welcome: "welcome!"})
+		synctest.Wait()
+		s.Submit(Request{Comment: dataStore.data["c2"], Welcome: "welcome!"})
+		synctest.Wait()
+
+		destRes := dest.Get()
+		require.Equal(t, 2, len(destRes))
+		assert.Equal(t, "u1@example.com", destRes[0].welcomeEmail)
+		assert.Empty(t, destRes[1].welcomeEmail, "no email for u2")
+		assert.Empty(t, destRes[0].Emails, "not a reply")
+		s.Close()
+	})
+}
+
+func TestService_Quota(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		d1, d2 := &MockDest{id: 1}, &MockDest{id: 2}
+		s := NewService(nil, 1, d1, d2)
+		q := &mockQuota{limit: 3}
+		s.Quota = q
+
+		s.Submit(Request{Comment: store.Comment{ID: "100", Locator: store.Locator{SiteID: "remark"}}})
+		synctest.Wait()
+		s.Submit(Request{Comment: store.Comment{ID: "101", Locator: store.Locator{SiteID: "remark"}}})
+		synctest.Wait()
+		s.Close()
+
+		assert.Equal(t, 4, q.calls, "counted per send to each destination")
+		assert.Len(t, append(d1.Get(), d2.Get()...), 3, "send over quota rejected")
+		assert.Len(t, s.Deliveries("remark", ""), 3, "rejected send not recorded")
+	})
+}
+
+// mockQuota allows limit sends
+type mockQuota struct {
+	mu    sync.Mutex
+	calls int
+	limit int
+}
+
+func (m *mockQuota) UseNotifyQuota(siteID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls++
+	return siteID == "remark" && m.calls <= m.limit
+}
+
+func TestService_SubmitMessage(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		dest := &MockDest{id: 1}
+		dataStore := &mockStore{data: map[string]store.Comment{}, userDetails: map[string]string{"u1": "u1@example.com"}}
+		s := NewService(dataStore, 1, dest)
+
+		s.SubmitMessage(UserMessage{SiteID: "remark", UserID: "u1", Subject: "unblocked", Text: "you can comment again"})
+		synctest.Wait()
+		s.SubmitMessage(UserMessage{SiteID: "remark", UserID: "u2", Subject: "unblocked"})
+		synctest.Wait()
+
+		msgs := dest.GetMessages()
+		require.Len(t, msgs, 1, "no message for user without email")
+		assert.Equal(t, "u1", msgs[0].UserID)
+		assert.Equal(t, "u1@example.com", msgs[0].email)
+		assert.Empty(t, dest.Get(), "not a comment notification")
+
+		deliveries := s.Deliveries("remark", "")
+		require.Len(t, deliveries, 1)
+		assert.Equal(t, DeliveryMessage, deliveries[0].Kind)
+		assert.Equal(t, "u1", deliveries[0].UserID)
+		s.Close()
+		s.SubmitMessage(UserMessage{SiteID: "remark", UserID: "u1"}) // safe to send after close
+	})
+}
+
+func TestService_SubmitAdminMessage(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		dest := &MockDest{id: 1}
+		s := NewService(nil, 1, dest)
+
+		s.SubmitAdminMessage(AdminMessage{SiteID: "remark", Subject: "integrity check", Text: "2 issues found"})
+		synctest.Wait()
+
+		msgs := dest.GetAdminMessages()
+		require.Len(t, msgs, 1)
+		assert.Equal(t, AdminMessage{SiteID: "remark", Subject: "integrity check", Text: "2 issues found"}, msgs[0])
+		assert.Empty(t, dest.GetMessages(), "not a user message")
+
+		deliveries := s.Deliveries("remark", "")
+		require.Len(t, deliveries, 1)
+		assert.Equal(t, DeliveryAdmin, deliveries[0].Kind)
+		d, err := s.Resend(context.Background(), "remark", deliveries[0].ID)
+		require.NoError(t, err)
+		assert.Equal(t, 1, d.Retries)
+		assert.Len(t, dest.GetAdminMessages(), 2, "resent")
+		s.Close()
+		s.SubmitAdminMessage(AdminMessage{SiteID: "remark"}) // safe to send after close
+	})
+}
+
+func TestService_SkipWatchers(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		dest := &MockDest{id: 1}
+		dataStore := &mockStore{data: map[string]store.Comment{}, userDetails: map[string]string{}}
+		dataStore.data["p1"] = store.Comment{ID: "p1", User: store.User{ID: "u1"}}
+		dataStore.data["p2"] = store.Comment{ID: "p2", ParentID: "p1", User: store.User{ID: "u2"}, Late: true}
+		dataStore.userDetails["u1"] = "u1@example.com"
+
+		s := NewService(dataStore, 1, dest)
+		s.Submit(Request{Comment: dataStore.data["p2"], SkipWatchers: true})
+		synctest.Wait()
+		s.Submit(Request{Comment: dataStore.data["p2"]})
+		synctest.Wait()
+
+		destRes := dest.Get()
+		require.Equal(t, 2, len(destRes))
+		assert.Equal(t, "p1", destRes[0].parent.ID)
+		assert.Empty(t, destRes[0].Emails, "watchers skipped")
+		assert.Empty(t, destRes[0].Telegrams, "watchers skipped")
+		assert.Equal(t, []string{"u1@example.com"}, destRes[1].Emails)
+		s.Close()
+	})
+}
+
+func TestService_PrivateReply(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		d1, d2 := &MockDest{id: 1}, emailMockDest{&MockDest{id: 2}}
+		dataStore := &mockStore{data: map[string]store.Comment{}, userDetails: map[string]string{}}
+		dataStore.data["p1"] = store.Comment{ID: "p1", User: store.User{ID: "u1"}}
+		dataStore.data["p2"] = store.Comment{ID: "p2", ParentID: "p1", User: store.User{ID: "u2"}}
+		dataStore.data["p3"] = store.Comment{ID: "p3", ParentID: "p2", User: store.User{ID: "u3"},
+			Visibility: store.VisibilityPrivate, PrivateTo: "u2"}
+		dataStore.userDetails["u1"] = "u1@example.com"
+		dataStore.userDetails["u2"] = "u2@example.com"
+
+		s := NewService(dataStore, 1, d1, d2)
+		s.Submit(Request{Comment: dataStore.data["p3"]})
+		synctest.Wait()
+		s.Submit(Request{Comment: dataStore.data["p3"], Destinations: []string{"mock", "telegram"}})
+		synctest.Wait()
+		s.Close()
+
+		assert.Empty(t, d1.Get(), "not sent to broadcast destination")
+		res := d2.Get()
+		require.Len(t, res, 1, "sent to email only when allowed")
+		assert.Equal(t, []string{"u2@example.com"}, res[0].Emails, "recipient only, without watchers up the thread")
+		assert.True(t, res[0].usersOnly, "not sent to admins")
+	})
+}
+
+func TestService_Destinations(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		d1, d2 := &MockDest{id: 1}, &failDest{}
+		d2.ok.Store(true)
+		s := NewService(nil, 1, d1, d2)
+		s.Submit(Request{Comment: store.Comment{ID: "100"}})
+		synctest.Wait()
+		s.Submit(Request{Comment: store.Comment{ID: "101"}, Destinations: []string{"mock"}})
+		synctest.Wait()
+		s.Submit(Request{Comment: store.Comment{ID: "102"}, Destinations: []string{"fail", "email"}})
+		synctest.Wait()
+		s.Submit(Request{Comment: store.Comment{ID: "103"}, Destinations: []string{}})
+		synctest.Wait()
+		s.Close()
+
+		res := d1.Get()
+		require.Len(t, res, 2)
+		assert.Equal(t, "100", res[0].Comment.ID)
+		assert.Equal(t, "101", res[1].Comment.ID)
+		assert.Equal(t, int32(2), d2.calls.Load(), "100 and 102 sent to fail destination")
+	})
+}
+
 func TestService_Recursive(t *testing.T) {
 	synctest.Test(t, func(t *testing.T) {
 		dest := &MockDest{id: 1}
@@ -51,6 +51,13 @@ func (s *Slack) Send(ctx context.Context, req Request) error {
 	return s.Slack.Send(ctx, destination, "New comment from "+user)
 }
 
+// SendAdminMessage sends the message to Slack channel
+func (s *Slack) SendAdminMessage(ctx context.Context, msg AdminMessage) error {
+	log.Printf("[DEBUG] send slack admin message, %q", msg.Subject)
+	destination := fmt.Sprintf("slack:%s?title=%s&attachmentText=%s", s.channelName, url.QueryEscape(msg.Subject), url.QueryEscape(msg.Text))
+	return s.Slack.Send(ctx, destination, msg.Subject)
+}
+
 // SendVerification is not implemented for Slack
 func (s *Slack) SendVerification(_ context.Context, _ VerificationRequest) error {
 	return nil
@@ -29,6 +29,13 @@ func TestSlack_Send(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestSlack_SendAdminMessage(t *testing.T) {
+	ts := NewSlack("", "")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, ts.SendAdminMessage(ctx, AdminMessage{SiteID: "remark", Subject: "integrity check", Text: "2 issues found"}))
+}
+
 func TestSlack_Name(t *testing.T) {
 	tb := NewSlack("", "test-channel")
 	assert.Equal(t, "slack notifications destination for channel test-channel", tb.String())
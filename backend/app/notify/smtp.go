@@ -0,0 +1,229 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"github.com/go-pkgz/email"
+	ntf "github.com/go-pkgz/notify"
+)
+
+// SMTP sends emails with SMTP server same as go-pkgz/notify client does, adding Reply-To header
+// and signing messages with DKIM if it's set. Message is built by go-pkgz/email and completed
+// right before its data is passed to the server.
+type SMTP struct {
+	ntf.SMTPParams
+	dkim *DKIM
+	now  func() time.Time
+}
+
+// NewSMTP makes SMTP client signing messages with the DKIM key, messages are not signed if dkim is nil
+func NewSMTP(smtpParams ntf.SMTPParams, dkim *DKIM) *SMTP {
+	if smtpParams.TimeOut <= 0 {
+		smtpParams.TimeOut = defaultEmailTimeout
+	}
+	return &SMTP{SMTPParams: smtpParams, dkim: dkim, now: time.Now}
+}
+
+// Send sends the text to "mailto:" destination with "from", "replyTo", "subject" and "unsubscribeLink" query parameters
+func (s *SMTP) Send(ctx context.Context, destination, text string) error {
+	msg, err := parseMailto(destination)
+	if err != nil {
+		return fmt.Errorf("problem parsing destination: %w", err)
+	}
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+
+	client := &smtpClient{SMTPParams: s.SMTPParams, dkim: s.dkim, now: s.now}
+	if msg.replyTo != "" {
+		replyTo, e := mail.ParseAddress(msg.replyTo)
+		if e != nil {
+			return fmt.Errorf("bad reply-to address %q: %w", msg.replyTo, e)
+		}
+		client.replyTo = replyTo.String()
+	}
+	opts := []email.Option{email.SMTP(client), email.TimeOut(s.TimeOut)}
+	if s.Username != "" {
+		opts = append(opts, email.Auth(s.Username, s.Password))
+	}
+	if s.ContentType != "" {
+		opts = append(opts, email.ContentType(s.ContentType))
+	}
+	if s.Charset != "" {
+		opts = append(opts, email.Charset(s.Charset))
+	}
+	if s.LoginAuth {
+		opts = append(opts, email.LoginAuth())
+	}
+	if s.Port != 0 {
+		opts = append(opts, email.Port(s.Port))
+	}
+	params := email.Params{From: msg.from, To: msg.to, Subject: msg.subject, UnsubscribeLink: msg.unsubscribeLink}
+	if err = email.NewSender(s.Host, opts...).Send(text, params); err != nil {
+		return err
+	}
+	// go-pkgz/email only logs failed close of message data, the message is not sent then
+	return client.dataErr
+}
+
+func (s *SMTP) String() string {
+	str := fmt.Sprintf("email: with username '%s' at server %s:%d", s.Username, s.Host, s.Port)
+	if s.TLS {
+		str += " with TLS"
+	}
+	if s.StartTLS {
+		str += " with StartTLS"
+	}
+	if s.dkim != nil {
+		str += ", signed by " + s.dkim.String()
+	}
+	return str
+}
+
+// smtpClient is SMTP client of a single message, connecting on the first command
+// and completing message data on its close
+type smtpClient struct {
+	ntf.SMTPParams
+	dkim    *DKIM
+	now     func() time.Time
+	replyTo string // encoded Reply-To address, header not added if empty
+	client  *smtp.Client
+	dataErr error // error of signing or writing the message
+}
+
+func (c *smtpClient) Auth(a smtp.Auth) error {
+	cl, err := c.connect()
+	if err != nil {
+		return err
+	}
+	return cl.Auth(a)
+}
+
+func (c *smtpClient) Mail(from string) error {
+	cl, err := c.connect()
+	if err != nil {
+		return err
+	}
+	return cl.Mail(from)
+}
+
+func (c *smtpClient) Rcpt(to string) error {
+	cl, err := c.connect()
+	if err != nil {
+		return err
+	}
+	return cl.Rcpt(to)
+}
+
+// Data returns writer completing the message when it's closed
+func (c *smtpClient) Data() (io.WriteCloser, error) {
+	cl, err := c.connect()
+	if err != nil {
+		return nil, err
+	}
+	w, err := cl.Data()
+	if err != nil {
+		return nil, err
+	}
+	return &messageWriter{WriteCloser: w, client: c}, nil
+}
+
+func (c *smtpClient) Quit() error {
+	if c.client == nil {
+		return nil
+	}
+	return c.client.Quit()
+}
+
+func (c *smtpClient) Close() error {
+	if c.client == nil {
+		return nil
+	}
+	return c.client.Close()
+}
+
+// connect dials SMTP server, same as go-pkgz/email does
+func (c *smtpClient) connect() (*smtp.Client, error) {
+	if c.client != nil {
+		return c.client, nil
+	}
+	addr := net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+	tlsConf := &tls.Config{
+		InsecureSkipVerify: c.InsecureSkipVerify, //nolint:gosec // set explicitly by user
+		ServerName:         c.Host,
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	var conn net.Conn
+	var err error
+	if c.TLS {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: c.TimeOut}, "tcp", addr, tlsConf)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, c.TimeOut)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial smtp %s: %w", addr, err)
+	}
+	cl, err := smtp.NewClient(conn, c.Host)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to make smtp client for %s: %w", addr, err)
+	}
+	if c.StartTLS && !c.TLS {
+		if err = cl.StartTLS(tlsConf); err != nil {
+			_ = cl.Close()
+			return nil, fmt.Errorf("failed to start tls: %w", err)
+		}
+	}
+	c.client = cl
+	return cl, nil
+}
+
+// messageWriter keeps the message and writes it with Reply-To header and signed on close
+type messageWriter struct {
+	io.WriteCloser
+	client *smtpClient
+	buf    bytes.Buffer
+}
+
+func (w *messageWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *messageWriter) Close() error {
+	w.client.dataErr = w.writeMessage()
+	return w.client.dataErr
+}
+
+// writeMessage completes and sends the message, connection is dropped on failure to not end incomplete message
+func (w *messageWriter) writeMessage() error {
+	msg := w.buf.Bytes()
+	if w.client.replyTo != "" {
+		msg = append([]byte("Reply-To: "+w.client.replyTo+"\n"), msg...)
+	}
+	if w.client.dkim != nil {
+		signed, err := w.client.dkim.Sign(msg, w.client.now())
+		if err != nil {
+			_ = w.client.client.Close()
+			return err
+		}
+		msg = signed
+	}
+	if _, err := w.WriteCloser.Write(msg); err != nil {
+		_ = w.client.client.Close()
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	if err := w.WriteCloser.Close(); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	ntf "github.com/go-pkgz/notify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSMTP_Send(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	dkim, err := NewDKIM("example.com", "mail", pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}))
+	require.NoError(t, err)
+
+	srv := startFakeSMTP(t)
+	host, port := srv.addr()
+	client := NewSMTP(ntf.SMTPParams{Host: host, Port: port, ContentType: "text/html", Charset: "UTF-8"}, dkim)
+	assert.Equal(t, "email: with username '' at server 127.0.0.1:"+strconv.Itoa(port)+", signed by dkim: example.com with selector mail",
+		client.String())
+
+	err = client.Send(context.Background(), "mailto:user@example.com?from=notify%40example.com&subject=New+reply"+
+		"&unsubscribeLink=https%3A%2F%2Fexample.com%2Funsubscribe%3Ftkn%3D1", "<p>hello</p>")
+	require.NoError(t, err)
+	msg := <-srv.messages
+	assert.Equal(t, "notify@example.com", msg.from)
+	assert.Equal(t, []string{"user@example.com"}, msg.to)
+	assert.True(t, strings.HasPrefix(msg.data, "DKIM-Signature: v=1; a=rsa-sha256;"), msg.data)
+	assert.Contains(t, msg.data, "h=From:To:Subject:Date:MIME-Version:Content-Type:Content-Transfer-Encoding:"+
+		"List-Unsubscribe:List-Unsubscribe-Post;")
+	assert.Contains(t, msg.data, "List-Unsubscribe: <https://example.com/unsubscribe?tkn=1>\r\n")
+	require.NoError(t, verifyDKIM(msg.data, &rsaKey.PublicKey))
+
+	email, err := NewEmail(EmailParams{From: "notify@example.com", DKIM: dkim}, ntf.SMTPParams{Host: host, Port: port})
+	require.NoError(t, err)
+	assert.Contains(t, email.String(), "signed by dkim: example.com")
+	require.NoError(t, email.SendMessage(context.Background(), UserMessage{UserID: "1", Text: "hi", email: "user@example.com"}))
+	msg = <-srv.messages
+	require.NoError(t, verifyDKIM(msg.data, &rsaKey.PublicKey))
+
+	client = NewSMTP(ntf.SMTPParams{Host: host, Port: port}, nil)
+	assert.Equal(t, "email: with username '' at server 127.0.0.1:"+strconv.Itoa(port), client.String())
+	err = client.Send(context.Background(), "mailto:user@example.com?from=notify%40example.com&subject=hi"+
+		"&replyTo=%22Sup%C3%A9rieur%22+%3Csupport%40example.com%3E", "text")
+	require.NoError(t, err)
+	msg = <-srv.messages
+	assert.True(t, strings.HasPrefix(msg.data, "Reply-To: =?utf-8?q?Sup=C3=A9rieur?= <support@example.com>\r\nFrom: notify@example.com\r\n"),
+		msg.data)
+	assert.NotContains(t, msg.data, "DKIM-Signature")
+	assert.ErrorContains(t, client.Send(context.Background(), "mailto:user@example.com?from=notify%40example.com&replyTo=bad", "text"),
+		"bad reply-to address")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, client.Send(ctx, "mailto:user@example.com", "text"), context.Canceled)
+	assert.Error(t, client.Send(context.Background(), "https://example.com", "text"), "not mailto")
+
+	client = NewSMTP(ntf.SMTPParams{Host: "127.0.0.1", Port: 1}, dkim)
+	assert.ErrorContains(t, client.Send(context.Background(), "mailto:user@example.com?from=notify%40example.com", "text"),
+		"failed to dial smtp")
+}
+
+// fakeSMTP accepts messages and passes them to the channel
+type fakeSMTP struct {
+	ln       net.Listener
+	messages chan fakeMessage
+}
+
+type fakeMessage struct {
+	from string
+	to   []string
+	data string
+}
+
+func startFakeSMTP(t *testing.T) *fakeSMTP {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	res := &fakeSMTP{ln: ln, messages: make(chan fakeMessage, 10)}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, e := ln.Accept()
+			if e != nil {
+				return
+			}
+			go res.serve(conn)
+		}
+	}()
+	return res
+}
+
+func (f *fakeSMTP) addr() (host string, port int) {
+	a := f.ln.Addr().(*net.TCPAddr)
+	return a.IP.String(), a.Port
+}
+
+func (f *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(s string) { _, _ = conn.Write([]byte(s + "\r\n")) }
+	reply("220 localhost ESMTP")
+	msg := fakeMessage{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			msg.from = strings.Trim(strings.TrimSpace(line)[len("MAIL FROM:"):], "<>")
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			msg.to = append(msg.to, strings.Trim(strings.TrimSpace(line)[len("RCPT TO:"):], "<>"))
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			data := strings.Builder{}
+			for {
+				l, e := r.ReadString('\n')
+				if e != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(l, "."))
+			}
+			msg.data = data.String()
+			f.messages <- msg
+			msg = fakeMessage{}
+			reply("250 OK")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
@@ -51,7 +51,7 @@ func (t *Telegram) Send(ctx context.Context, req Request) error {
 
 	msg := t.buildMessage(req)
 
-	if t.AdminChannelID != "" {
+	if t.AdminChannelID != "" && !req.usersOnly {
 		err := t.Telegram.Send(ctx, fmt.Sprintf("telegram:%s?parseMode=HTML", t.AdminChannelID), msg)
 		if err != nil {
 			errs = append(errs,
@@ -77,6 +77,18 @@ func (t *Telegram) Send(ctx context.Context, req Request) error {
 	return errors.Join(errs...)
 }
 
+// SendAdminMessage sends the message to the admin channel, if set
+func (t *Telegram) SendAdminMessage(ctx context.Context, msg AdminMessage) error {
+	if t.AdminChannelID == "" {
+		return nil
+	}
+	text := fmt.Sprintf("<b>%s</b>\n\n%s", ntf.EscapeTelegramText(msg.Subject), ntf.EscapeTelegramText(msg.Text))
+	if err := t.Telegram.Send(ctx, fmt.Sprintf("telegram:%s?parseMode=HTML", t.AdminChannelID), text); err != nil {
+		return fmt.Errorf("problem sending admin message to %s: %w", t.AdminChannelID, err)
+	}
+	return nil
+}
+
 // buildMessage generates message for generic notification about new comment
 func (t *Telegram) buildMessage(req Request) string {
 	commentURLPrefix := req.Comment.Locator.URL + uiNav
@@ -93,6 +105,10 @@ func (t *Telegram) buildMessage(req Request) string {
 		msg += fmt.Sprintf("\n\n\"<i>%s</i>\"", pruneHTML(ntf.TelegramSupportedHTML(req.parent.Text), commentTextLengthLimit))
 	}
 
+	if req.collapsed > 0 {
+		msg += fmt.Sprintf("\n\n<i>+%d more new comments in the thread</i>", req.collapsed)
+	}
+
 	if req.Comment.PostTitle != "" {
 		msg += fmt.Sprintf("\n\n↦  <a href=%q>%s</a>", req.Comment.Locator.URL, ntf.EscapeTelegramText(req.Comment.PostTitle))
 	}
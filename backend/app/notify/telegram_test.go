@@ -6,6 +6,7 @@ import (
 
 	ntf "github.com/go-pkgz/notify"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/umputun/remark42/backend/app/store"
 )
@@ -63,8 +64,38 @@ some text
 <b>Lorem ipsum <i>dolor sit amet</i>, consectetur adipiscing <code>elit, sed do eiusmod tempor incididunt</code> ut...</b>`, res)
 }
 
+func TestTelegram_SendCollapsed(t *testing.T) {
+	tb := Telegram{AdminChannelID: "remark_test", UserNotifications: true, Telegram: &ntf.Telegram{}}
+	c := store.Comment{Text: "some text", ID: "999", PostTitle: "title", Locator: store.Locator{URL: "http://example.org/"}}
+	c.User.Name = "from"
+	req := Request{Comment: c, Telegrams: []string{"test_user_channel"}, usersOnly: true, collapsed: 2}
+
+	err := tb.Send(context.Background(), req)
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "admin telegram notification", "admin already notified")
+
+	assert.Equal(t, `<a href="http://example.org/#remark42__comment-999">from</a>
+
+some text
+
+<i>+2 more new comments in the thread</i>
+
+↦  <a href="http://example.org/">title</a>`, tb.buildMessage(req))
+}
+
 func TestTelegram_SendVerification(t *testing.T) {
 	tb := Telegram{}
 	// empty VerificationRequest should return no error and do nothing, as well as any other
 	assert.NoError(t, tb.SendVerification(context.Background(), VerificationRequest{}))
 }
+
+func TestTelegram_SendAdminMessage(t *testing.T) {
+	tb := Telegram{Telegram: &ntf.Telegram{}} // broken sender due to unset API
+	msg := AdminMessage{SiteID: "remark", Subject: "integrity check", Text: "2 issues <found>"}
+	assert.NoError(t, tb.SendAdminMessage(context.Background(), msg), "no admin channel")
+
+	tb.AdminChannelID = "remark_test"
+	err := tb.SendAdminMessage(context.Background(), msg)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "problem sending admin message to remark_test")
+}
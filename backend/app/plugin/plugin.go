@@ -0,0 +1,336 @@
+// Package plugin runs WASM plugins provided by operators at hook points of comment processing, to customize
+// behavior without recompiling remark42. Plugins are run by embedded wazero runtime, with no access to files,
+// network, environment or real clock. The only host function is remark42.log(ptr, len i32) writing a message
+// to the server log.
+//
+// A plugin exports memory, alloc(size i32) i32 returning a pointer of allocated buffer, and any of hook functions:
+//   - pre_save(ptr, len i32) i64 - called with comment before it is validated and saved, can change comment's
+//     markdown text or reject the comment
+//   - post_render(ptr, len i32) i64 - called with comment rendered to html, can change the html. The result is
+//     sanitized as any comment html
+//   - on_vote(ptr, len i32) i64 - called with vote before it is counted, can reject the vote
+//
+// Hook's input is json written to the buffer allocated by alloc. The result is json of Result located at
+// ptr<<32|len packed to i64, or 0 to keep everything as is. Reactor modules are initialized with _initialize.
+// Plugins are chained in the order of their file names, text changed by one passed to the next.
+package plugin
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// Hook points
+const (
+	HookPreSave    = "pre_save"
+	HookPostRender = "post_render"
+	HookOnVote     = "on_vote"
+)
+
+// ErrRejected returned by hooks rejecting comment or vote, wrapped with the reason
+var ErrRejected = errors.New("rejected by plugin")
+
+// Comment is comment's data passed to pre_save and post_render hooks
+type Comment struct {
+	ID       string `json:"id,omitempty"`
+	ParentID string `json:"parent_id,omitempty"`
+	SiteID   string `json:"site"`
+	URL      string `json:"url"`
+	UserID   string `json:"user_id"`
+	UserName string `json:"user_name"`
+	Text     string `json:"text"` // markdown for pre_save, html for post_render
+}
+
+// Vote is vote's data passed to on_vote hook
+type Vote struct {
+	CommentID string `json:"comment_id"`
+	SiteID    string `json:"site"`
+	URL       string `json:"url"`
+	UserID    string `json:"user_id"`
+	Value     bool   `json:"value"` // true for up-vote
+}
+
+// Result returned by hooks
+type Result struct {
+	Text   string `json:"text,omitempty"`   // new text of the comment, unchanged if empty
+	Reject string `json:"reject,omitempty"` // reason to reject the comment or vote, accepted if empty
+}
+
+// Options defines limits of plugins
+type Options struct {
+	Timeout     time.Duration // max time of a hook call, 200ms by default
+	MemoryLimit uint32        // max memory of each plugin in bytes, 64M by default
+}
+
+// Manager runs loaded plugins at hook points. Methods are safe for concurrent use and do nothing on nil Manager.
+type Manager struct {
+	runtime wazero.Runtime
+	timeout time.Duration
+	plugins []*plugin
+}
+
+// plugin is a compiled module with lazily made instance. The instance is not safe for concurrent calls,
+// and dropped on any failure, as its state is unknown after trap or timeout.
+type plugin struct {
+	name     string
+	sum      string // hash of the module
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+	hooks    map[string]bool
+
+	mu       sync.Mutex
+	instance api.Module
+}
+
+// New loads all *.wasm plugins from the directory, in order of their names
+func New(ctx context.Context, dir string, opts Options) (*Manager, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.wasm"))
+	if err != nil {
+		return nil, fmt.Errorf("can't list plugins in %s: %w", dir, err)
+	}
+	slices.Sort(files)
+	if opts.Timeout <= 0 {
+		opts.Timeout = 200 * time.Millisecond
+	}
+	if opts.MemoryLimit == 0 {
+		opts.MemoryLimit = 64 * 1024 * 1024
+	}
+
+	cfg := wazero.NewRuntimeConfig().WithCloseOnContextDone(true).WithMemoryLimitPages(max(opts.MemoryLimit/65536, 1))
+	res := &Manager{runtime: wazero.NewRuntimeWithConfig(ctx, cfg), timeout: opts.Timeout}
+	if err = res.instantiateHost(ctx); err != nil {
+		_ = res.runtime.Close(ctx)
+		return nil, err
+	}
+
+	for _, file := range files {
+		p, err := res.load(ctx, file)
+		if err != nil {
+			_ = res.runtime.Close(ctx)
+			return nil, err
+		}
+		res.plugins = append(res.plugins, p)
+		log.Printf("[INFO] loaded plugin %s, hooks %v", p.name, p.hookNames())
+	}
+	return res, nil
+}
+
+// PreSave runs pre_save hooks with the comment, returns comment's text changed by plugins.
+// Returns error wrapping ErrRejected if a plugin rejected the comment.
+func (m *Manager) PreSave(ctx context.Context, c Comment) (string, error) {
+	return m.runText(ctx, HookPreSave, c)
+}
+
+// PostRender runs post_render hooks with the rendered comment, returns comment's html changed by plugins
+func (m *Manager) PostRender(ctx context.Context, c Comment) string {
+	res, err := m.runText(ctx, HookPostRender, c)
+	if err != nil { // post_render can't reject, keep the rendered html
+		log.Printf("[WARN] %v", err)
+		return c.Text
+	}
+	return res
+}
+
+// PostRenderKey identifies loaded plugins with post_render hook, changed with any of them updated.
+// Empty if there are no such plugins.
+func (m *Manager) PostRenderKey() string {
+	if m == nil {
+		return ""
+	}
+	res := []string{}
+	for _, p := range m.plugins {
+		if p.hooks[HookPostRender] {
+			res = append(res, p.name+":"+p.sum)
+		}
+	}
+	return strings.Join(res, ",")
+}
+
+// OnVote runs on_vote hooks with the vote, returns error wrapping ErrRejected if a plugin rejected it
+func (m *Manager) OnVote(ctx context.Context, v Vote) error {
+	if m == nil {
+		return nil
+	}
+	for _, p := range m.plugins {
+		res, err := m.call(ctx, p, HookOnVote, v)
+		if err != nil {
+			log.Printf("[WARN] plugin %s failed on %s, %v", p.name, HookOnVote, err)
+			continue
+		}
+		if res.Reject != "" {
+			return fmt.Errorf("%w %s: %s", ErrRejected, p.name, res.Reject)
+		}
+	}
+	return nil
+}
+
+// Close releases all plugins
+func (m *Manager) Close(ctx context.Context) error {
+	if m == nil {
+		return nil
+	}
+	return m.runtime.Close(ctx)
+}
+
+// runText runs text changing hook of all plugins, passing the text changed by one to the next.
+// Failed plugins are skipped, so a broken plugin can't stop commenting.
+func (m *Manager) runText(ctx context.Context, hook string, c Comment) (string, error) {
+	if m == nil {
+		return c.Text, nil
+	}
+	for _, p := range m.plugins {
+		res, err := m.call(ctx, p, hook, c)
+		if err != nil {
+			log.Printf("[WARN] plugin %s failed on %s, %v", p.name, hook, err)
+			continue
+		}
+		if res.Reject != "" {
+			return c.Text, fmt.Errorf("%w %s: %s", ErrRejected, p.name, res.Reject)
+		}
+		if res.Text != "" {
+			c.Text = res.Text
+		}
+	}
+	return c.Text, nil
+}
+
+// call runs the hook of the plugin with json of the input, limited by timeout. Plugins without the hook skipped.
+func (m *Manager) call(ctx context.Context, p *plugin, hook string, input any) (Result, error) {
+	if !p.hooks[hook] {
+		return Result{}, nil
+	}
+	data, err := json.Marshal(input)
+	if err != nil {
+		return Result{}, fmt.Errorf("can't marshal input: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out, err := p.invoke(ctx, hook, data)
+	if err != nil {
+		if p.instance != nil {
+			_ = p.instance.Close(context.Background())
+			p.instance = nil
+		}
+		return Result{}, err
+	}
+	res := Result{}
+	if len(out) == 0 {
+		return res, nil
+	}
+	if err = json.Unmarshal(out, &res); err != nil {
+		return Result{}, fmt.Errorf("can't unmarshal result: %w", err)
+	}
+	return res, nil
+}
+
+// invoke passes data to the hook of plugin's instance and returns the output, instantiates plugin if needed.
+// Should be called under plugin's lock.
+func (p *plugin) invoke(ctx context.Context, hook string, data []byte) ([]byte, error) {
+	if p.instance == nil {
+		cfg := wazero.NewModuleConfig().WithName("plugin " + p.name).WithStartFunctions("_initialize")
+		inst, err := p.runtime.InstantiateModule(ctx, p.compiled, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("can't instantiate: %w", err)
+		}
+		p.instance = inst
+	}
+
+	alloc := p.instance.ExportedFunction("alloc")
+	if alloc == nil {
+		return nil, errors.New("alloc not exported")
+	}
+	ret, err := alloc.Call(ctx, uint64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("can't allocate input: %w", err)
+	}
+	ptr := uint32(ret[0])
+	if !p.instance.Memory().Write(ptr, data) {
+		return nil, fmt.Errorf("input out of memory range, ptr %d, len %d", ptr, len(data))
+	}
+
+	ret, err = p.instance.ExportedFunction(hook).Call(ctx, uint64(ptr), uint64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("call failed: %w", err)
+	}
+	if ret[0] == 0 {
+		return nil, nil
+	}
+	outPtr, outLen := uint32(ret[0]>>32), uint32(ret[0])
+	out, ok := p.instance.Memory().Read(outPtr, outLen)
+	if !ok {
+		return nil, fmt.Errorf("result out of memory range, ptr %d, len %d", outPtr, outLen)
+	}
+	return slices.Clone(out), nil
+}
+
+// load compiles the plugin file and checks its exports
+func (m *Manager) load(ctx context.Context, file string) (*plugin, error) {
+	data, err := os.ReadFile(file) //nolint:gosec // plugins dir set by operator
+	if err != nil {
+		return nil, fmt.Errorf("can't read plugin %s: %w", file, err)
+	}
+	compiled, err := m.runtime.CompileModule(ctx, data)
+	if err != nil {
+		return nil, fmt.Errorf("can't compile plugin %s: %w", file, err)
+	}
+
+	p := &plugin{name: strings.TrimSuffix(filepath.Base(file), ".wasm"), sum: fmt.Sprintf("%x", sha256.Sum256(data))[:12],
+		runtime: m.runtime, compiled: compiled, hooks: map[string]bool{}}
+	exports := compiled.ExportedFunctions()
+	for _, hook := range []string{HookPreSave, HookPostRender, HookOnVote} {
+		if _, ok := exports[hook]; ok {
+			p.hooks[hook] = true
+		}
+	}
+	if _, ok := exports["alloc"]; !ok {
+		return nil, fmt.Errorf("plugin %s doesn't export alloc", p.name)
+	}
+	if len(p.hooks) == 0 {
+		return nil, fmt.Errorf("plugin %s doesn't export any of hooks %s, %s, %s", p.name, HookPreSave, HookPostRender, HookOnVote)
+	}
+	return p, nil
+}
+
+// instantiateHost makes host functions available to plugins, wasi without any access and remark42.log
+func (m *Manager) instantiateHost(ctx context.Context) error {
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, m.runtime); err != nil {
+		return fmt.Errorf("can't instantiate wasi: %w", err)
+	}
+	logFn := func(_ context.Context, mod api.Module, ptr, size uint32) {
+		if msg, ok := mod.Memory().Read(ptr, min(size, 1024)); ok {
+			log.Printf("[INFO] %s: %s", mod.Name(), msg)
+		}
+	}
+	_, err := m.runtime.NewHostModuleBuilder("remark42").NewFunctionBuilder().WithFunc(logFn).Export("log").Instantiate(ctx)
+	if err != nil {
+		return fmt.Errorf("can't instantiate host module: %w", err)
+	}
+	return nil
+}
+
+// hookNames returns sorted names of plugin's hooks
+func (p *plugin) hookNames() []string {
+	res := make([]string, 0, len(p.hooks))
+	for hook := range p.hooks {
+		res = append(res, hook)
+	}
+	slices.Sort(res)
+	return res
+}
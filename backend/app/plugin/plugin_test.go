@@ -0,0 +1,126 @@
+package plugin
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if buildOnce.dir != "" {
+		_ = os.RemoveAll(buildOnce.dir)
+	}
+	os.Exit(code)
+}
+
+func TestManager_Hooks(t *testing.T) {
+	m, err := New(context.Background(), pluginsDir(t), Options{Timeout: time.Second})
+	require.NoError(t, err)
+	defer m.Close(context.Background())
+	require.Len(t, m.plugins, 1)
+	assert.Equal(t, "test", m.plugins[0].name)
+	assert.Equal(t, []string{HookOnVote, HookPostRender, HookPreSave}, m.plugins[0].hookNames())
+	assert.Regexp(t, `^test:[0-9a-f]{12}$`, m.PostRenderKey())
+
+	ctx := context.Background()
+	text, err := m.PreSave(ctx, Comment{SiteID: "site1", Text: "some badword here"})
+	require.NoError(t, err)
+	assert.Equal(t, "some *** here", text)
+
+	text, err = m.PreSave(ctx, Comment{SiteID: "site1", Text: "clean text"})
+	require.NoError(t, err)
+	assert.Equal(t, "clean text", text, "unchanged")
+
+	_, err = m.PreSave(ctx, Comment{SiteID: "site1", Text: "buy spam"})
+	require.ErrorIs(t, err, ErrRejected)
+	assert.EqualError(t, err, "rejected by plugin test: no spam")
+
+	assert.Equal(t, "<p>about <b>remark42</b></p>", m.PostRender(ctx, Comment{Text: "<p>about remark42</p>"}))
+	assert.Equal(t, "<p>other</p>", m.PostRender(ctx, Comment{Text: "<p>other</p>"}))
+
+	require.NoError(t, m.OnVote(ctx, Vote{CommentID: "c1", Value: true}))
+	err = m.OnVote(ctx, Vote{CommentID: "c1", Value: false})
+	require.ErrorIs(t, err, ErrRejected)
+	assert.EqualError(t, err, "rejected by plugin test: down-votes disabled")
+}
+
+func TestManager_Timeout(t *testing.T) {
+	m, err := New(context.Background(), pluginsDir(t), Options{Timeout: 500 * time.Millisecond})
+	require.NoError(t, err)
+	defer m.Close(context.Background())
+	ctx := context.Background()
+
+	// instantiate plugin before the looping call, to keep initialization out of the timeout
+	_, err = m.PreSave(ctx, Comment{Text: "warm up"})
+	require.NoError(t, err)
+
+	st := time.Now()
+	text, err := m.PreSave(ctx, Comment{Text: "endless loop"})
+	require.NoError(t, err, "failed plugin skipped")
+	assert.Equal(t, "endless loop", text)
+	assert.Less(t, time.Since(st), 5*time.Second)
+
+	text, err = m.PreSave(ctx, Comment{Text: "badword"})
+	require.NoError(t, err)
+	assert.Equal(t, "***", text, "plugin instantiated again after timeout")
+}
+
+func TestManager_Nil(t *testing.T) {
+	var m *Manager
+	text, err := m.PreSave(context.Background(), Comment{Text: "spam"})
+	require.NoError(t, err)
+	assert.Equal(t, "spam", text)
+	assert.Equal(t, "html", m.PostRender(context.Background(), Comment{Text: "html"}))
+	require.NoError(t, m.OnVote(context.Background(), Vote{}))
+	assert.Empty(t, m.PostRenderKey())
+	require.NoError(t, m.Close(context.Background()))
+}
+
+func TestManager_LoadErrors(t *testing.T) {
+	m, err := New(context.Background(), t.TempDir(), Options{})
+	require.NoError(t, err, "no plugins is fine")
+	assert.Empty(t, m.plugins)
+	assert.Empty(t, m.PostRenderKey())
+	require.NoError(t, m.Close(context.Background()))
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bad.wasm"), []byte("not wasm"), 0o600))
+	_, err = New(context.Background(), dir, Options{})
+	assert.ErrorContains(t, err, "can't compile plugin")
+
+	// minimal valid module without exports
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bad.wasm"), []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}, 0o600))
+	_, err = New(context.Background(), dir, Options{})
+	assert.EqualError(t, err, "plugin bad doesn't export alloc")
+}
+
+var buildOnce struct {
+	sync.Once
+	dir string
+	err error
+	out []byte
+}
+
+// pluginsDir builds testdata/plugin to wasm once and returns directory with it
+func pluginsDir(t *testing.T) string {
+	buildOnce.Do(func() {
+		buildOnce.dir, buildOnce.err = os.MkdirTemp("", "remark42-plugins")
+		if buildOnce.err != nil {
+			return
+		}
+		cmd := exec.Command("go", "build", "-buildmode=c-shared", "-o", filepath.Join(buildOnce.dir, "test.wasm"), "main.go")
+		cmd.Dir = filepath.Join("testdata", "plugin")
+		cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+		buildOnce.out, buildOnce.err = cmd.CombinedOutput()
+	})
+	require.NoError(t, buildOnce.err, string(buildOnce.out))
+	return buildOnce.dir
+}
@@ -0,0 +1,85 @@
+// Test plugin, built with GOOS=wasip1 GOARCH=wasm go build -buildmode=c-shared.
+// Rejects comments with "spam", masks "badword", loops forever on "loop", emphasizes "remark42" in rendered html
+// and rejects down-votes.
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"unsafe"
+)
+
+var buffers = map[uintptr][]byte{} // keep allocated input buffers from gc
+var out []byte                     // the last result
+
+//go:wasmimport remark42 log
+func hostLog(ptr unsafe.Pointer, size uint32)
+
+//go:wasmexport alloc
+func alloc(size uint32) uint32 {
+	buf := make([]byte, max(size, 1))
+	ptr := uintptr(unsafe.Pointer(&buf[0]))
+	buffers[ptr] = buf
+	return uint32(ptr)
+}
+
+//go:wasmexport pre_save
+func preSave(ptr, size uint32) uint64 {
+	var c struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(input(ptr, size), &c); err != nil {
+		return result(map[string]string{"reject": err.Error()})
+	}
+	switch {
+	case strings.Contains(c.Text, "loop"):
+		for {
+		}
+	case strings.Contains(c.Text, "spam"):
+		logMsg("spam rejected")
+		return result(map[string]string{"reject": "no spam"})
+	case strings.Contains(c.Text, "badword"):
+		return result(map[string]string{"text": strings.ReplaceAll(c.Text, "badword", "***")})
+	}
+	return 0
+}
+
+//go:wasmexport post_render
+func postRender(ptr, size uint32) uint64 {
+	var c struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(input(ptr, size), &c); err != nil || !strings.Contains(c.Text, "remark42") {
+		return 0
+	}
+	return result(map[string]string{"text": strings.ReplaceAll(c.Text, "remark42", "<b>remark42</b>")})
+}
+
+//go:wasmexport on_vote
+func onVote(ptr, size uint32) uint64 {
+	var v struct {
+		Value bool `json:"value"`
+	}
+	if err := json.Unmarshal(input(ptr, size), &v); err != nil || v.Value {
+		return 0
+	}
+	return result(map[string]string{"reject": "down-votes disabled"})
+}
+
+func input(ptr, size uint32) []byte {
+	buf := buffers[uintptr(ptr)]
+	delete(buffers, uintptr(ptr))
+	return buf[:size]
+}
+
+func result(v any) uint64 {
+	out, _ = json.Marshal(v)
+	return uint64(uintptr(unsafe.Pointer(&out[0])))<<32 | uint64(len(out))
+}
+
+func logMsg(msg string) {
+	data := []byte(msg)
+	hostLog(unsafe.Pointer(&data[0]), uint32(len(data)))
+}
+
+func main() {}
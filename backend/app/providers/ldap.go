@@ -0,0 +1,271 @@
+package providers
+
+// LDAP credential checker for direct auth provider, authenticating users against Active Directory
+// or OpenLDAP. User is found by service account (or anonymously) with search filter and then bound
+// with its own password. Members of admin groups get admin role.
+
+import (
+	"crypto/sha1" //nolint:gosec // used for user id hashing, same as other auth providers
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/go-pkgz/auth/v2/token"
+	log "github.com/go-pkgz/lgr"
+)
+
+const (
+	ldapUserPlaceholder = "{user}"
+	ldapAdminTTL        = 5 * time.Minute // time admin group membership is trusted without lookup
+)
+
+// errLDAPUserNotFound returned if search found no entry for user
+var errLDAPUserNotFound = errors.New("user not found")
+
+// LDAPParams defines parameters of LDAP credential checker
+type LDAPParams struct {
+	Name      string      // provider name, used as user id prefix
+	URL       string      // ldap://host:389 or ldaps://host:636
+	StartTLS  bool        // upgrade ldap:// connection with StartTLS
+	TLSConfig *tls.Config // custom CA or skip of verification, defaults if nil
+	Timeout   time.Duration
+
+	BindDN       string // service account searching for users, anonymous search if empty
+	BindPassword string
+	BaseDN       string   // search base of users
+	UserFilter   string   // search filter of user with {user} placeholder for the user name
+	GroupAttr    string   // attribute with groups of user, memberOf if empty
+	AdminGroups  []string // DNs of groups which members get admin role
+}
+
+// LDAP checks credentials of users in LDAP directory, implements provider.CredChecker.
+// Admin group membership is checked on login and cached for ldapAdminTTL, expired entries
+// refreshed with lookup by service account. Admin role is not granted if the lookup fails.
+type LDAP struct {
+	LDAPParams
+	url       *url.URL
+	tlsConfig *tls.Config
+	now       func() time.Time
+
+	admins struct {
+		sync.Mutex
+		data map[string]ldapAdmin
+	}
+}
+
+type ldapAdmin struct {
+	admin   bool
+	checked time.Time
+}
+
+// NewLDAP makes LDAP credential checker
+func NewLDAP(params LDAPParams) (*LDAP, error) {
+	u, err := url.Parse(params.URL)
+	if err != nil {
+		return nil, fmt.Errorf("bad ldap url: %w", err)
+	}
+	if u.Scheme != "ldap" && u.Scheme != "ldaps" {
+		return nil, fmt.Errorf("ldap url should start with ldap:// or ldaps://, got %q", params.URL)
+	}
+	if params.StartTLS && u.Scheme == "ldaps" {
+		return nil, errors.New("starttls can't be used with ldaps://")
+	}
+	if params.BaseDN == "" {
+		return nil, errors.New("ldap base dn is not set")
+	}
+	if !strings.Contains(params.UserFilter, ldapUserPlaceholder) {
+		return nil, fmt.Errorf("ldap user filter %q should have %s placeholder", params.UserFilter, ldapUserPlaceholder)
+	}
+	if _, err = ldap.CompileFilter(strings.ReplaceAll(params.UserFilter, ldapUserPlaceholder, "user")); err != nil {
+		return nil, fmt.Errorf("bad ldap user filter %q: %w", params.UserFilter, err)
+	}
+	if params.Name == "" {
+		params.Name = "ldap"
+	}
+	if params.GroupAttr == "" {
+		params.GroupAttr = "memberOf"
+	}
+	tlsConfig := &tls.Config{} //nolint:gosec // min version set below
+	if params.TLSConfig != nil {
+		tlsConfig = params.TLSConfig.Clone()
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = u.Hostname()
+	}
+	if tlsConfig.MinVersion == 0 {
+		tlsConfig.MinVersion = tls.VersionTLS12
+	}
+	res := &LDAP{LDAPParams: params, url: u, tlsConfig: tlsConfig, now: time.Now}
+	res.admins.data = map[string]ldapAdmin{}
+	return res, nil
+}
+
+// Check verifies user's password by binding as the user found by the filter
+func (l *LDAP) Check(user, password string) (ok bool, err error) {
+	user = strings.TrimSpace(user)
+	if user == "" || password == "" { // empty password makes unauthenticated bind, successful for any user
+		return false, nil
+	}
+
+	conn, err := l.dial()
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close() //nolint:errcheck // nothing to do with the error
+
+	entry, err := l.findUser(conn, user)
+	if errors.Is(err, errLDAPUserNotFound) {
+		log.Printf("[INFO] ldap user %q not found", user)
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	err = conn.Bind(entry.DN, password)
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		log.Printf("[INFO] wrong password of ldap user %q", user)
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("can't bind ldap user %q: %w", user, err)
+	}
+
+	l.setAdmin(l.UserID(user, nil), l.isAdminEntry(entry))
+	return true, nil
+}
+
+// UserID makes user id from the user name, case-insensitive as LDAP directories are.
+// Implements provider.UserIDFunc, the request is not used.
+func (l *LDAP) UserID(user string, _ *http.Request) string {
+	return strings.ToLower(strings.TrimSpace(user))
+}
+
+// IsAdmin checks if the user logged in with LDAP is a member of admin groups
+func (l *LDAP) IsAdmin(user token.User) bool {
+	if len(l.AdminGroups) == 0 {
+		return false
+	}
+	key := l.UserID(user.Name, nil)
+	if user.ID != l.Name+"_"+token.HashID(sha1.New(), key) {
+		return false // not ldap user or name doesn't match the id
+	}
+
+	l.admins.Lock()
+	cached, ok := l.admins.data[key]
+	l.admins.Unlock()
+	if ok && l.now().Sub(cached.checked) < ldapAdminTTL {
+		return cached.admin
+	}
+
+	admin, err := l.lookupAdmin(key)
+	if err != nil {
+		log.Printf("[WARN] can't check ldap admin groups of %q, %v", user.Name, err)
+		return false // cached membership expired, the user could be removed from admin groups meanwhile
+	}
+	l.setAdmin(key, admin)
+	return admin
+}
+
+// lookupAdmin finds the user with service account and checks its groups
+func (l *LDAP) lookupAdmin(user string) (bool, error) {
+	conn, err := l.dial()
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close() //nolint:errcheck // nothing to do with the error
+
+	entry, err := l.findUser(conn, user)
+	if errors.Is(err, errLDAPUserNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return l.isAdminEntry(entry), nil
+}
+
+// dial connects to the server, upgrading ldap:// connection with StartTLS if requested.
+// Timeout applies to the connection and to each request.
+func (l *LDAP) dial() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(l.url.String(), ldap.DialWithDialer(&net.Dialer{Timeout: l.Timeout}), ldap.DialWithTLSConfig(l.tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("can't connect to %s: %w", l.url.Host, err)
+	}
+	if l.Timeout > 0 {
+		conn.SetTimeout(l.Timeout)
+	}
+	if l.StartTLS {
+		if err = conn.StartTLS(l.tlsConfig); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("starttls failed: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// findUser binds service account and searches for the single entry of the user
+func (l *LDAP) findUser(conn *ldap.Conn, user string) (*ldap.Entry, error) {
+	if l.BindDN != "" {
+		if err := conn.Bind(l.BindDN, l.BindPassword); err != nil {
+			return nil, fmt.Errorf("can't bind ldap service account: %w", err)
+		}
+	}
+	filter := strings.ReplaceAll(l.UserFilter, ldapUserPlaceholder, ldap.EscapeFilter(user))
+	req := ldap.NewSearchRequest(l.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false, filter,
+		[]string{l.GroupAttr}, nil)
+	res, err := conn.Search(req)
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, fmt.Errorf("ldap user %q is ambiguous, too many entries found", user)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't search ldap user %q: %w", user, err)
+	}
+	switch len(res.Entries) {
+	case 0:
+		return nil, errLDAPUserNotFound
+	case 1:
+		return res.Entries[0], nil
+	default:
+		return nil, fmt.Errorf("ldap user %q is ambiguous, %d entries found", user, len(res.Entries))
+	}
+}
+
+// isAdminEntry checks if any of the entry's groups is admin group, DNs compared case-insensitively
+func (l *LDAP) isAdminEntry(entry *ldap.Entry) bool {
+	for _, group := range entry.GetEqualFoldAttributeValues(l.GroupAttr) {
+		if slices.ContainsFunc(l.AdminGroups, func(g string) bool { return strings.EqualFold(normalizeDN(g), normalizeDN(group)) }) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *LDAP) setAdmin(user string, admin bool) {
+	l.admins.Lock()
+	defer l.admins.Unlock()
+	now := l.now()
+	for k, v := range l.admins.data { // drop expired entries to keep the map small
+		if now.Sub(v.checked) >= ldapAdminTTL {
+			delete(l.admins.data, k)
+		}
+	}
+	l.admins.data[user] = ldapAdmin{admin: admin, checked: now}
+}
+
+// normalizeDN removes spaces around RDNs, i.e. "cn=admins, dc=example" becomes "cn=admins,dc=example"
+func normalizeDN(dn string) string {
+	parts := strings.Split(dn, ",")
+	for i, p := range parts {
+		parts[i] = strings.TrimSpace(p)
+	}
+	return strings.Join(parts, ",")
+}
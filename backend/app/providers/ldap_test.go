@@ -0,0 +1,369 @@
+package providers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1" //nolint:gosec // used for user id hashing
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/go-pkgz/auth/v2/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewLDAP(t *testing.T) {
+	l, err := NewLDAP(LDAPParams{URL: "ldap://localhost", BaseDN: "dc=example,dc=com", UserFilter: "(uid={user})"})
+	require.NoError(t, err)
+	assert.Equal(t, "ldap", l.Name)
+	assert.Equal(t, "memberOf", l.GroupAttr)
+
+	tbl := []struct {
+		params LDAPParams
+		err    string
+	}{
+		{LDAPParams{URL: "http://localhost", BaseDN: "dc=x", UserFilter: "(uid={user})"},
+			`ldap url should start with ldap:// or ldaps://, got "http://localhost"`},
+		{LDAPParams{URL: "ldaps://localhost", StartTLS: true, BaseDN: "dc=x", UserFilter: "(uid={user})"},
+			"starttls can't be used with ldaps://"},
+		{LDAPParams{URL: "ldap://localhost", UserFilter: "(uid={user})"}, "ldap base dn is not set"},
+		{LDAPParams{URL: "ldap://localhost", BaseDN: "dc=x", UserFilter: "(uid=john)"},
+			`ldap user filter "(uid=john)" should have {user} placeholder`},
+		{LDAPParams{URL: "ldap://localhost", BaseDN: "dc=x", UserFilter: "(uid={user}"},
+			`bad ldap user filter "(uid={user}": LDAP Result Code 201 "Filter Compile Error": ldap: unexpected end of filter`},
+	}
+	for _, tt := range tbl {
+		_, err = NewLDAP(tt.params)
+		assert.EqualError(t, err, tt.err)
+	}
+}
+
+func TestLDAP_Check(t *testing.T) {
+	srv := startFakeLDAP(t, nil, false)
+	l, err := NewLDAP(LDAPParams{URL: "ldap://" + srv.addr(), BindDN: "cn=service,dc=example,dc=com", BindPassword: "svc-secret",
+		BaseDN: "dc=example,dc=com", UserFilter: "(&(objectClass=person)(|(uid={user})(mail={user})))",
+		AdminGroups: []string{"cn=Admins, ou=groups, dc=example, dc=com"}, Timeout: time.Second})
+	require.NoError(t, err)
+
+	ok, err := l.Check("john", "john-secret")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = l.Check(" John ", "john-secret")
+	require.NoError(t, err)
+	assert.True(t, ok, "user name trimmed, directory is case-insensitive")
+
+	ok, err = l.Check("john", "bad")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = l.Check("nobody", "john-secret")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = l.Check("*", "john-secret")
+	require.NoError(t, err)
+	assert.False(t, ok, "filter injection escaped")
+
+	searches := srv.searches.Load()
+	ok, err = l.Check("john", "")
+	require.NoError(t, err)
+	assert.False(t, ok, "empty password rejected without bind")
+	assert.Equal(t, searches, srv.searches.Load())
+
+	_, err = l.Check("shared@example.com", "whatever")
+	require.EqualError(t, err, `ldap user "shared@example.com" is ambiguous, 2 entries found`)
+
+	l.BindPassword = "bad"
+	_, err = l.Check("john", "john-secret")
+	require.EqualError(t, err, `can't bind ldap service account: LDAP Result Code 49 "Invalid Credentials": invalid credentials`)
+
+	srv.close()
+	_, err = l.Check("john", "john-secret")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "can't connect to")
+}
+
+func TestLDAP_IsAdmin(t *testing.T) {
+	srv := startFakeLDAP(t, nil, false)
+	l, err := NewLDAP(LDAPParams{URL: "ldap://" + srv.addr(), BaseDN: "dc=example,dc=com", UserFilter: "(uid={user})",
+		AdminGroups: []string{"cn=admins,ou=groups,dc=example,dc=com"}, Timeout: time.Second})
+	require.NoError(t, err)
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+
+	john := token.User{Name: "John", ID: "ldap_" + token.HashID(sha1.New(), "john")}
+	mary := token.User{Name: "mary", ID: "ldap_" + token.HashID(sha1.New(), "mary")}
+
+	ok, err := l.Check("John", "john-secret")
+	require.NoError(t, err)
+	require.True(t, ok)
+	searches := srv.searches.Load()
+	assert.True(t, l.IsAdmin(john))
+	assert.Equal(t, searches, srv.searches.Load(), "membership cached on login")
+
+	assert.False(t, l.IsAdmin(token.User{Name: "John", ID: "github_" + token.HashID(sha1.New(), "john")}), "not ldap user")
+	assert.False(t, l.IsAdmin(token.User{Name: "mary", ID: john.ID}), "name doesn't match id")
+
+	assert.False(t, l.IsAdmin(mary), "looked up without login")
+	assert.Equal(t, searches+1, srv.searches.Load())
+	assert.False(t, l.IsAdmin(mary))
+	assert.Equal(t, searches+1, srv.searches.Load(), "lookup result cached")
+
+	// membership rechecked after cache expiration
+	srv.setGroups("john", nil)
+	now = now.Add(ldapAdminTTL)
+	assert.False(t, l.IsAdmin(john))
+	srv.setGroups("john", []string{"cn=admins,ou=groups,dc=example,dc=com"})
+	now = now.Add(ldapAdminTTL)
+	assert.True(t, l.IsAdmin(john))
+
+	// cached membership used until expiration, admin role withdrawn if directory is unavailable after it
+	srv.close()
+	now = now.Add(ldapAdminTTL - time.Second)
+	assert.True(t, l.IsAdmin(john))
+	now = now.Add(time.Second)
+	assert.False(t, l.IsAdmin(john))
+	assert.False(t, l.IsAdmin(john), "not cached")
+
+	l.AdminGroups = nil
+	assert.False(t, l.IsAdmin(john), "no admin groups")
+}
+
+func TestLDAP_TLS(t *testing.T) {
+	serverTLS, clientTLS := testLDAPTLS(t)
+
+	srv := startFakeLDAP(t, serverTLS, false)
+	l, err := NewLDAP(LDAPParams{URL: "ldap://" + srv.addr(), StartTLS: true, TLSConfig: clientTLS,
+		BaseDN: "dc=example,dc=com", UserFilter: "(uid={user})", Timeout: time.Second})
+	require.NoError(t, err)
+	ok, err := l.Check("john", "john-secret")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, srv.tlsUsed.Load())
+
+	l, err = NewLDAP(LDAPParams{URL: "ldap://" + srv.addr(), StartTLS: true,
+		BaseDN: "dc=example,dc=com", UserFilter: "(uid={user})", Timeout: time.Second})
+	require.NoError(t, err)
+	_, err = l.Check("john", "john-secret")
+	require.Error(t, err, "server certificate not trusted")
+	assert.Contains(t, err.Error(), "certificate signed by unknown authority")
+
+	plain := startFakeLDAP(t, nil, false)
+	l, err = NewLDAP(LDAPParams{URL: "ldap://" + plain.addr(), StartTLS: true, TLSConfig: clientTLS,
+		BaseDN: "dc=example,dc=com", UserFilter: "(uid={user})", Timeout: time.Second})
+	require.NoError(t, err)
+	_, err = l.Check("john", "john-secret")
+	require.EqualError(t, err, `starttls failed: LDAP Result Code 2 "Protocol Error": starttls is not supported`)
+
+	ldaps := startFakeLDAP(t, serverTLS, true)
+	l, err = NewLDAP(LDAPParams{URL: "ldaps://" + ldaps.addr(), TLSConfig: clientTLS,
+		BaseDN: "dc=example,dc=com", UserFilter: "(uid={user})", Timeout: time.Second})
+	require.NoError(t, err)
+	ok, err = l.Check("john", "john-secret")
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+// fakeLDAP is LDAP server with static directory, supporting bind, search and StartTLS
+type fakeLDAP struct {
+	t           *testing.T
+	ln          net.Listener
+	tlsConfig   *tls.Config // StartTLS supported if set
+	implicitTLS bool        // ldaps
+	searches    atomic.Int32
+	tlsUsed     atomic.Bool
+
+	mu    sync.Mutex
+	users []fakeLDAPUser
+}
+
+type fakeLDAPUser struct {
+	uid, mail, dn, password string
+	groups                  []string
+}
+
+func startFakeLDAP(t *testing.T, tlsConfig *tls.Config, implicitTLS bool) *fakeLDAP {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &fakeLDAP{t: t, ln: ln, tlsConfig: tlsConfig, implicitTLS: implicitTLS, users: []fakeLDAPUser{
+		{uid: "service", dn: "cn=service,dc=example,dc=com", password: "svc-secret"},
+		{uid: "john", mail: "john@example.com", dn: "uid=john,ou=people,dc=example,dc=com", password: "john-secret",
+			groups: []string{"cn=users,ou=groups,dc=example,dc=com", "cn=admins,ou=groups,dc=example,dc=com"}},
+		{uid: "mary", mail: "shared@example.com", dn: "uid=mary,ou=people,dc=example,dc=com", password: "mary-secret",
+			groups: []string{"cn=users,ou=groups,dc=example,dc=com"}},
+		{uid: "bob", mail: "shared@example.com", dn: "uid=bob,ou=people,dc=example,dc=com", password: "bob-secret"},
+	}}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	t.Cleanup(s.close)
+	return s
+}
+
+func (s *fakeLDAP) addr() string { return s.ln.Addr().String() }
+
+func (s *fakeLDAP) close() { _ = s.ln.Close() }
+
+func (s *fakeLDAP) setGroups(uid string, groups []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.users {
+		if s.users[i].uid == uid {
+			s.users[i].groups = groups
+		}
+	}
+}
+
+func (s *fakeLDAP) serve(conn net.Conn) {
+	if s.implicitTLS {
+		conn = tls.Server(conn, s.tlsConfig)
+	}
+	defer conn.Close()
+	var rw io.ReadWriter = conn
+	reply := func(id int64, op *ber.Packet) {
+		msg := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "message")
+		msg.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "id"))
+		msg.AppendChild(op)
+		_, err := rw.Write(msg.Bytes())
+		assert.NoError(s.t, err)
+	}
+	result := func(tag ber.Tag, code int, msg string) *ber.Packet {
+		op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "result")
+		op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "code"))
+		op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "dn"))
+		op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, msg, "message"))
+		return op
+	}
+
+	for {
+		msg, err := ber.ReadPacket(rw)
+		if err != nil {
+			return
+		}
+		require.Len(s.t, msg.Children, 2)
+		id, ok := msg.Children[0].Value.(int64)
+		require.True(s.t, ok)
+		op := msg.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationUnbindRequest:
+			return
+		case ldap.ApplicationExtendedRequest:
+			assert.Equal(s.t, "1.3.6.1.4.1.1466.20037", op.Children[0].Data.String(), "starttls oid")
+			if s.tlsConfig == nil {
+				reply(id, result(ldap.ApplicationExtendedResponse, ldap.LDAPResultProtocolError, "starttls is not supported"))
+				continue
+			}
+			reply(id, result(ldap.ApplicationExtendedResponse, ldap.LDAPResultSuccess, ""))
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err = tlsConn.Handshake(); err != nil {
+				return
+			}
+			s.tlsUsed.Store(true)
+			rw = tlsConn
+		case ldap.ApplicationBindRequest:
+			code, text := ldap.LDAPResultInvalidCredentials, "invalid credentials"
+			for _, u := range s.directory() {
+				if u.dn == op.Children[1].Data.String() && u.password == op.Children[2].Data.String() {
+					code, text = ldap.LDAPResultSuccess, ""
+				}
+			}
+			reply(id, result(ldap.ApplicationBindResponse, int(code), text))
+		case ldap.ApplicationSearchRequest:
+			s.searches.Add(1)
+			sizeLimit, ok := op.Children[3].Value.(int64)
+			require.True(s.t, ok)
+			filter, err := ldap.DecompileFilter(op.Children[6])
+			require.NoError(s.t, err)
+			withGroups := false
+			for _, a := range op.Children[7].Children {
+				withGroups = withGroups || a.Data.String() == "memberOf"
+			}
+			found := int64(0)
+			for _, u := range s.directory() {
+				if u.uid == "service" || !fakeLDAPMatch(filter, u) {
+					continue
+				}
+				if found++; found > sizeLimit {
+					break
+				}
+				entry := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "entry")
+				entry.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, u.dn, "dn"))
+				attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attributes")
+				if withGroups && len(u.groups) > 0 {
+					attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attribute")
+					attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "memberOf", "type"))
+					values := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "values")
+					for _, g := range u.groups {
+						values.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, g, "value"))
+					}
+					attr.AppendChild(values)
+					attrs.AppendChild(attr)
+				}
+				entry.AppendChild(attrs)
+				reply(id, entry)
+			}
+			if found > sizeLimit {
+				reply(id, result(ldap.ApplicationSearchResultDone, ldap.LDAPResultSizeLimitExceeded, ""))
+				continue
+			}
+			reply(id, result(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess, ""))
+		default:
+			s.t.Errorf("unexpected ldap operation %d", op.Tag)
+			return
+		}
+	}
+}
+
+func (s *fakeLDAP) directory() []fakeLDAPUser {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]fakeLDAPUser{}, s.users...)
+}
+
+// fakeLDAPMatch checks if the filter has equality match of uid or mail with the user's value, case-insensitive
+func fakeLDAPMatch(filter string, u fakeLDAPUser) bool {
+	f := strings.ToLower(filter)
+	for attr, v := range map[string]string{"uid": u.uid, "mail": u.mail} {
+		if v != "" && strings.Contains(f, "("+attr+"="+strings.ToLower(v)+")") {
+			return true
+		}
+	}
+	return false
+}
+
+// testLDAPTLS makes server config with self-signed certificate for 127.0.0.1 and client config trusting it
+func testLDAPTLS(t *testing.T) (server, client *tls.Config) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "ldap.example.com"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}, MinVersion: tls.VersionTLS12},
+		&tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+}
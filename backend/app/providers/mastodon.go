@@ -0,0 +1,423 @@
+package providers
+
+// Mastodon provider, logging fediverse users in with their account on Mastodon or compatible
+// (Pleroma, Akkoma, GoToSocial) instance entered by the user. OAuth app is registered on the
+// instance dynamically on the first login with it, as there is no central place to get client
+// credentials from.
+
+import (
+	"crypto/sha1" //nolint:gosec // used for user id hashing, same as other auth providers
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-pkgz/auth/v2/provider"
+	"github.com/go-pkgz/auth/v2/token"
+	log "github.com/go-pkgz/lgr"
+	R "github.com/go-pkgz/rest"
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/umputun/remark42/backend/app/rest"
+	"github.com/umputun/remark42/backend/app/safehttp"
+)
+
+const (
+	mastodonScope           = "read:accounts"
+	mastodonAnyInstance     = "*"
+	mastodonRequestLifetime = 30 * time.Minute // time for user to log in on the instance
+	mastodonMaxRequests     = 10000            // max number of pending login requests
+	mastodonMaxApps         = 1000             // max number of instances with registered app kept in memory
+	mastodonMaxResponseSize = 1024 * 1024      // max size of instance's response
+)
+
+// MastodonParams defines parameters of Mastodon provider
+type MastodonParams struct {
+	URL       string       // remark42 url, callback is at URL/auth/mastodon/callback
+	Issuer    string       // issuer of jwt tokens
+	AppName   string       // name of OAuth app registered on instances, shown to users on authorization
+	Instances []string     // hosts of allowed instances, "*" allows any instance
+	Client    *http.Client // client of instance requests, with SSRF-safe transport if nil
+
+	TokenService         provider.TokenService
+	AvatarSaver          provider.AvatarSaver
+	AllowedRedirectHosts token.AllowedHosts
+}
+
+// Mastodon implements OAuth login with Mastodon instance as auth provider with login, callback and logout handlers.
+// Credentials of apps registered on instances and pending login requests are kept in memory.
+type Mastodon struct {
+	MastodonParams
+	now func() time.Time
+
+	apps struct {
+		sync.Mutex
+		data map[string]mastodonApp
+	}
+	requests *pendingStore[mastodonRequest]
+}
+
+// mastodonApp is OAuth app registered on the instance
+type mastodonApp struct {
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+}
+
+// mastodonRequest is pending login request
+type mastodonRequest struct {
+	instance string
+	from     string
+	aud      string
+	session  bool
+	noAva    bool
+	expires  time.Time
+}
+
+// mastodonAccount is the part of account returned by verify_credentials used to make the user
+type mastodonAccount struct {
+	ID          string `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+	Avatar      string `json:"avatar"`
+}
+
+// mastodonInstanceForm is shown on login without the instance to ask the user for it
+var mastodonInstanceForm = template.Must(template.New("mastodon").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Log in with Mastodon</title></head>
+<body style="font-family: sans-serif; max-width: 24em; margin: 3em auto; padding: 0 1em">
+<form method="get" action="{{.Action}}">
+{{range $k, $v := .Query}}{{range $v}}<input type="hidden" name="{{$k}}" value="{{.}}">{{end}}{{end}}
+<label for="instance">Your instance</label>
+<p><input id="instance" name="instance" placeholder="mastodon.social" autofocus required style="width: 100%"></p>
+{{if .Error}}<p style="color: #c00">{{.Error}}</p>{{end}}
+<p><button type="submit">Log in</button></p>
+</form></body></html>
+`))
+
+// NewMastodon makes Mastodon provider
+func NewMastodon(params MastodonParams) (*Mastodon, error) {
+	params.URL = strings.TrimSuffix(params.URL, "/")
+	instances := []string{}
+	for _, inst := range params.Instances {
+		if inst = strings.TrimSpace(inst); inst == mastodonAnyInstance {
+			instances = append(instances, inst)
+			continue
+		}
+		host, err := normalizeInstance(inst)
+		if err != nil {
+			return nil, fmt.Errorf("bad instance %q: %w", inst, err)
+		}
+		instances = append(instances, host)
+	}
+	if len(instances) == 0 {
+		return nil, errors.New("no allowed instances")
+	}
+	params.Instances = instances
+	if params.AppName == "" {
+		params.AppName = "remark42"
+	}
+	if params.Client == nil {
+		params.Client = &http.Client{Timeout: 10 * time.Second, Transport: safehttp.Transport()}
+	}
+	res := &Mastodon{MastodonParams: params, now: time.Now}
+	res.apps.data = map[string]mastodonApp{}
+	res.requests = newPendingStore(mastodonMaxRequests, errTooManyRequests, func(r mastodonRequest) time.Time { return r.expires })
+	return res, nil
+}
+
+// Name returns provider name
+func (m *Mastodon) Name() string { return "mastodon" }
+
+// String returns provider description
+func (m *Mastodon) String() string {
+	return "mastodon with instances " + strings.Join(m.Instances, ", ")
+}
+
+func (m *Mastodon) callbackURL() string { return m.URL + "/auth/mastodon/callback" }
+
+// LoginHandler redirects to the authorization page of the instance set by "instance" query param,
+// the form asking for the instance is shown if it is not set and more than one instance is allowed
+func (m *Mastodon) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	instance := r.URL.Query().Get("instance")
+	if instance == "" && len(m.Instances) == 1 && m.Instances[0] != mastodonAnyInstance {
+		instance = m.Instances[0]
+	}
+	if instance == "" {
+		m.renderInstanceForm(w, r, "")
+		return
+	}
+	host, err := normalizeInstance(instance)
+	if err != nil || !m.allowedInstance(host) {
+		m.renderInstanceForm(w, r, fmt.Sprintf("Logging in with %s is not allowed", instance))
+		return
+	}
+
+	app, err := m.app(host)
+	if err != nil {
+		log.Printf("[WARN] can't register mastodon app on %s, %v", host, err)
+		m.renderInstanceForm(w, r, fmt.Sprintf("Can't connect to %s", host))
+		return
+	}
+
+	aud := r.URL.Query().Get("site") // legacy, for back compat
+	if aud == "" {
+		aud = r.URL.Query().Get("aud")
+	}
+	req := mastodonRequest{
+		instance: host,
+		from:     r.URL.Query().Get("from"),
+		aud:      aud,
+		session:  r.URL.Query().Get("session") != "" && r.URL.Query().Get("session") != "0",
+		noAva:    r.URL.Query().Get("noava") == "1",
+		expires:  m.now().Add(mastodonRequestLifetime),
+	}
+	state := randomID()
+	if err = m.requests.add(state, req, m.now()); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusTooManyRequests, err, "can't start mastodon login", rest.ErrActionRejected)
+		return
+	}
+
+	q := url.Values{
+		"client_id":     {app.ClientID},
+		"redirect_uri":  {m.callbackURL()},
+		"response_type": {"code"},
+		"scope":         {mastodonScope},
+		"state":         {state},
+	}
+	http.Redirect(w, r, "https://"+host+"/oauth/authorize?"+q.Encode(), http.StatusFound)
+}
+
+// AuthHandler handles callback from the instance, gets the account with the authorization code and sets the token
+func (m *Mastodon) AuthHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := m.requests.take(r.URL.Query().Get("state"), m.now())
+	if !ok {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, errors.New("unknown state"), "unknown or expired login request",
+			rest.ErrNoAccess)
+		return
+	}
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, fmt.Errorf("no code, %s", r.URL.Query().Get("error")),
+			"login rejected by instance", rest.ErrNoAccess)
+		return
+	}
+	m.apps.Lock()
+	app, ok := m.apps.data[req.instance]
+	m.apps.Unlock()
+	if !ok {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, errors.New("no app of instance"), "unknown or expired login request",
+			rest.ErrNoAccess)
+		return
+	}
+
+	acc, err := m.account(req.instance, app, code)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, err, "can't get mastodon account", rest.ErrNoAccess)
+		return
+	}
+	u := mastodonUser(req.instance, acc)
+
+	if req.noAva {
+		u.Picture = "" // reset picture on no avatar request
+	}
+	if m.AvatarSaver != nil {
+		if u.Picture, err = m.AvatarSaver.Put(u, m.Client); err != nil {
+			rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "failed to save avatar to proxy", rest.ErrInternal)
+			return
+		}
+	}
+
+	claims := token.Claims{
+		User: &u,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:   m.Issuer,
+			ID:       randomID(),
+			Audience: []string{req.aud},
+		},
+		SessionOnly:  req.session,
+		NoAva:        req.noAva,
+		AuthProvider: &token.AuthProvider{Name: m.Name()},
+	}
+	if _, err = m.TokenService.Set(w, claims); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "failed to set token", rest.ErrInternal)
+		return
+	}
+	log.Printf("[DEBUG] mastodon login of user %s from %s", u.ID, req.instance)
+
+	if req.from != "" && allowedRedirect(m.URL, m.AllowedRedirectHosts, req.from) {
+		http.Redirect(w, r, req.from, http.StatusSeeOther)
+		return
+	}
+	R.RenderJSON(w, &u)
+}
+
+// LogoutHandler resets the token
+func (m *Mastodon) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if _, _, err := m.TokenService.Get(r); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, err, "logout not allowed", rest.ErrNoAccess)
+		return
+	}
+	m.TokenService.Reset(w)
+}
+
+func (m *Mastodon) renderInstanceForm(w http.ResponseWriter, r *http.Request, errMsg string) {
+	query := r.URL.Query()
+	query.Del("instance")
+	data := struct {
+		Action string
+		Query  url.Values
+		Error  string
+	}{Action: m.URL + "/auth/mastodon/login", Query: query, Error: errMsg}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if errMsg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	if err := mastodonInstanceForm.Execute(w, data); err != nil {
+		log.Printf("[WARN] can't render mastodon instance form, %v", err)
+	}
+}
+
+// allowedInstance checks the instance is in the allowed list
+func (m *Mastodon) allowedInstance(host string) bool {
+	return slices.Contains(m.Instances, mastodonAnyInstance) || slices.Contains(m.Instances, host)
+}
+
+// app returns OAuth app of the instance, registering it on the first use
+func (m *Mastodon) app(host string) (mastodonApp, error) {
+	m.apps.Lock()
+	app, ok := m.apps.data[host]
+	m.apps.Unlock()
+	if ok {
+		return app, nil
+	}
+
+	form := url.Values{
+		"client_name":   {m.AppName},
+		"redirect_uris": {m.callbackURL()},
+		"scopes":        {mastodonScope},
+		"website":       {m.URL},
+	}
+	if err := m.post(host, "/api/v1/apps", form, &app); err != nil {
+		return mastodonApp{}, err
+	}
+	if app.ClientID == "" || app.ClientSecret == "" {
+		return mastodonApp{}, errors.New("no client credentials in response")
+	}
+	log.Printf("[INFO] mastodon app registered on %s", host)
+
+	m.apps.Lock()
+	defer m.apps.Unlock()
+	if len(m.apps.data) >= mastodonMaxApps {
+		for k := range m.apps.data { // drop any app, it will be registered again if needed
+			delete(m.apps.data, k)
+			break
+		}
+	}
+	m.apps.data[host] = app
+	return app, nil
+}
+
+// account exchanges authorization code for the access token and gets the account with it
+func (m *Mastodon) account(host string, app mastodonApp, code string) (mastodonAccount, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"client_id":     {app.ClientID},
+		"client_secret": {app.ClientSecret},
+		"redirect_uri":  {m.callbackURL()},
+		"scope":         {mastodonScope},
+	}
+	tkn := struct {
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := m.post(host, "/oauth/token", form, &tkn); err != nil {
+		return mastodonAccount{}, fmt.Errorf("can't get access token: %w", err)
+	}
+	if tkn.AccessToken == "" {
+		return mastodonAccount{}, errors.New("no access token in response")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "https://"+host+"/api/v1/accounts/verify_credentials", http.NoBody)
+	if err != nil {
+		return mastodonAccount{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+tkn.AccessToken)
+	acc := mastodonAccount{}
+	if err = m.do(req, &acc); err != nil {
+		return mastodonAccount{}, fmt.Errorf("can't get account: %w", err)
+	}
+	if acc.ID == "" {
+		return mastodonAccount{}, errors.New("no account id in response")
+	}
+	return acc, nil
+}
+
+func (m *Mastodon) post(host, path string, form url.Values, res any) error {
+	req, err := http.NewRequest(http.MethodPost, "https://"+host+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return m.do(req, res)
+}
+
+func (m *Mastodon) do(req *http.Request, res any) error {
+	req.Header.Set("Accept", "application/json")
+	resp, err := m.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck // nothing to do with the error
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s responded with status %d", req.URL.Path, resp.StatusCode)
+	}
+	if err = json.NewDecoder(io.LimitReader(resp.Body, mastodonMaxResponseSize)).Decode(res); err != nil {
+		return fmt.Errorf("can't decode response of %s: %w", req.URL.Path, err)
+	}
+	return nil
+}
+
+// mastodonUser makes the user from the account. Account ids are unique within the instance only,
+// so the id of the user is made with the instance.
+func mastodonUser(host string, acc mastodonAccount) token.User {
+	u := token.User{
+		ID:      "mastodon_" + token.HashID(sha1.New(), host+":"+acc.ID),
+		Name:    strings.TrimSpace(acc.DisplayName),
+		Picture: acc.Avatar,
+	}
+	if u.Name == "" {
+		u.Name = acc.Username
+	}
+	if u.Name == "" {
+		u.Name = "noname_" + u.ID[9:13]
+	}
+	return u
+}
+
+// normalizeInstance gets the instance host from the value entered by the user, which may be
+// the instance URL or the full handle of the account, like @user@mastodon.social
+func normalizeInstance(instance string) (string, error) {
+	instance = strings.ToLower(strings.TrimSpace(instance))
+	instance = strings.TrimPrefix(instance, "https://")
+	instance = strings.TrimSuffix(instance, "/")
+	if i := strings.LastIndex(instance, "@"); i >= 0 {
+		instance = instance[i+1:]
+	}
+	u, err := url.Parse("https://" + instance)
+	if err != nil || u.Host != instance || u.Hostname() == "" {
+		return "", errors.New("not a host name")
+	}
+	if ip := net.ParseIP(u.Hostname()); ip == nil && !strings.Contains(u.Hostname(), ".") {
+		return "", errors.New("not a fully qualified host name")
+	}
+	return instance, nil
+}
@@ -0,0 +1,221 @@
+package providers
+
+import (
+	"crypto/sha1" //nolint:gosec // same hashing of user id as in provider
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-pkgz/auth/v2/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewMastodon(t *testing.T) {
+	m, err := NewMastodon(MastodonParams{URL: "https://remark42.example.com/", Instances: []string{" Mastodon.Social ", "*"}})
+	require.NoError(t, err)
+	assert.Equal(t, "mastodon", m.Name())
+	assert.Equal(t, "mastodon with instances mastodon.social, *", m.String())
+	assert.Equal(t, "https://remark42.example.com/auth/mastodon/callback", m.callbackURL())
+	assert.Equal(t, "remark42", m.AppName)
+	assert.NotNil(t, m.Client)
+
+	_, err = NewMastodon(MastodonParams{URL: "https://remark42.example.com"})
+	assert.EqualError(t, err, "no allowed instances")
+	_, err = NewMastodon(MastodonParams{URL: "https://remark42.example.com", Instances: []string{"mastodon.social/about"}})
+	assert.EqualError(t, err, `bad instance "mastodon.social/about": not a host name`)
+}
+
+func TestMastodon_LoginAndCallback(t *testing.T) {
+	var registered, authorized int32
+	var instance string
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/apps":
+			atomic.AddInt32(&registered, 1)
+			require.NoError(t, r.ParseForm())
+			assert.Equal(t, "Blog comments", r.PostForm.Get("client_name"))
+			assert.Equal(t, "https://remark42.example.com/auth/mastodon/callback", r.PostForm.Get("redirect_uris"))
+			assert.Equal(t, "read:accounts", r.PostForm.Get("scopes"))
+			_, _ = w.Write([]byte(`{"id":"1","client_id":"cid","client_secret":"csec"}`))
+		case "/oauth/token":
+			atomic.AddInt32(&authorized, 1)
+			require.NoError(t, r.ParseForm())
+			assert.Equal(t, "authorization_code", r.PostForm.Get("grant_type"))
+			assert.Equal(t, "cid", r.PostForm.Get("client_id"))
+			assert.Equal(t, "csec", r.PostForm.Get("client_secret"))
+			if r.PostForm.Get("code") != "good-code" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			_, _ = w.Write([]byte(`{"access_token":"tkn","token_type":"Bearer"}`))
+		case "/api/v1/accounts/verify_credentials":
+			assert.Equal(t, "Bearer tkn", r.Header.Get("Authorization"))
+			_, _ = fmt.Fprintf(w, `{"id":"109","username":"alice","acct":"alice","display_name":"Alice",
+				"avatar":"https://%s/avatars/alice.png"}`, instance)
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+	}))
+	defer ts.Close()
+	instance = strings.TrimPrefix(ts.URL, "https://")
+
+	tokens := &mockTokenService{}
+	m, err := NewMastodon(MastodonParams{URL: "https://remark42.example.com", AppName: "Blog comments",
+		Instances: []string{instance}, Client: ts.Client(), TokenService: tokens,
+		AllowedRedirectHosts: token.AllowedHostsFunc(func() ([]string, error) { return []string{"blog.example.com"}, nil }),
+		AvatarSaver: avatarSaverFunc(func(u token.User, client *http.Client) (string, error) {
+			assert.Equal(t, "https://"+instance+"/avatars/alice.png", u.Picture)
+			assert.NotNil(t, client)
+			return "https://remark42.example.com/api/v1/avatar/" + u.ID + ".image", nil
+		})})
+	require.NoError(t, err)
+
+	// the only allowed instance is used without asking for it
+	state := testMastodonLogin(t, m, instance, "from=https%3A%2F%2Fblog.example.com%2Fpost&site=remark&session=1")
+	rr := httptest.NewRecorder()
+	m.AuthHandler(rr, httptest.NewRequest(http.MethodGet, "/auth/mastodon/callback?code=good-code&state="+state, http.NoBody))
+	require.Equal(t, http.StatusSeeOther, rr.Code, rr.Body.String())
+	assert.Equal(t, "https://blog.example.com/post", rr.Header().Get("Location"))
+
+	userID := "mastodon_" + token.HashID(sha1.New(), instance+":109")
+	require.NotNil(t, tokens.claims.User)
+	assert.Equal(t, token.User{ID: userID, Name: "Alice",
+		Picture: "https://remark42.example.com/api/v1/avatar/" + userID + ".image"}, *tokens.claims.User)
+	assert.Equal(t, []string{"remark"}, []string(tokens.claims.Audience))
+	assert.True(t, tokens.claims.SessionOnly)
+	assert.Equal(t, "mastodon", tokens.claims.AuthProvider.Name)
+
+	// state can't be used twice
+	rr = httptest.NewRecorder()
+	m.AuthHandler(rr, httptest.NewRequest(http.MethodGet, "/auth/mastodon/callback?code=good-code&state="+state, http.NoBody))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	// the app is registered once, rejected code is an error
+	state = testMastodonLogin(t, m, instance, "instance=%40bob%40"+url.QueryEscape(instance)+"&site=remark")
+	rr = httptest.NewRecorder()
+	m.AuthHandler(rr, httptest.NewRequest(http.MethodGet, "/auth/mastodon/callback?code=bad-code&state="+state, http.NoBody))
+	assert.Equal(t, http.StatusForbidden, rr.Code, rr.Body.String())
+	assert.Contains(t, rr.Body.String(), "can't get mastodon account")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&registered))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&authorized))
+
+	// login denied by user on the instance
+	state = testMastodonLogin(t, m, instance, "site=remark")
+	rr = httptest.NewRecorder()
+	m.AuthHandler(rr, httptest.NewRequest(http.MethodGet, "/auth/mastodon/callback?error=access_denied&state="+state, http.NoBody))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "login rejected by instance")
+}
+
+func TestMastodon_InstanceForm(t *testing.T) {
+	m, err := NewMastodon(MastodonParams{URL: "https://remark42.example.com", Instances: []string{"mastodon.social", "fosstodon.org"}})
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	m.LoginHandler(rr, httptest.NewRequest(http.MethodGet, `/auth/mastodon/login?site=remark&from=https%3A%2F%2Fblog.example.com%2F%22%3E`,
+		http.NoBody))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "text/html; charset=utf-8", rr.Header().Get("Content-Type"))
+	assert.Contains(t, rr.Body.String(), `action="https://remark42.example.com/auth/mastodon/login"`)
+	assert.Contains(t, rr.Body.String(), `<input type="hidden" name="site" value="remark">`)
+	assert.Contains(t, rr.Body.String(), `value="https://blog.example.com/&#34;&gt;"`, "values escaped")
+
+	rr = httptest.NewRecorder()
+	m.LoginHandler(rr, httptest.NewRequest(http.MethodGet, "/auth/mastodon/login?site=remark&instance=evil.example.com", http.NoBody))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Logging in with evil.example.com is not allowed")
+	assert.NotContains(t, rr.Body.String(), `name="instance" value`, "instance is asked again")
+
+	// any instance allowed, registration fails on unreachable instance
+	m, err = NewMastodon(MastodonParams{URL: "https://remark42.example.com", Instances: []string{"*"},
+		Client: &http.Client{Timeout: time.Second}})
+	require.NoError(t, err)
+	rr = httptest.NewRecorder()
+	m.LoginHandler(rr, httptest.NewRequest(http.MethodGet, "/auth/mastodon/login?instance=127.0.0.1:1", http.NoBody))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Can&#39;t connect to 127.0.0.1:1")
+}
+
+func TestMastodon_Logout(t *testing.T) {
+	tokens := &mockTokenService{claims: token.Claims{User: &token.User{ID: "mastodon_123"}}}
+	m, err := NewMastodon(MastodonParams{URL: "https://remark42.example.com", Instances: []string{"*"}, TokenService: tokens})
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	m.LogoutHandler(rr, httptest.NewRequest(http.MethodGet, "/auth/mastodon/logout", http.NoBody))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Nil(t, tokens.claims.User)
+}
+
+func TestMastodon_Requests(t *testing.T) {
+	m, err := NewMastodon(MastodonParams{URL: "https://remark42.example.com", Instances: []string{"*"}})
+	require.NoError(t, err)
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	m.now = func() time.Time { return now }
+
+	require.NoError(t, m.requests.add("expired", mastodonRequest{expires: now.Add(-time.Second)}, now))
+	_, ok := m.requests.take("expired", now)
+	assert.False(t, ok)
+
+	for i := range mastodonMaxRequests - 1 {
+		m.requests.data[fmt.Sprintf("r%d", i)] = mastodonRequest{expires: now.Add(time.Minute)}
+	}
+	require.NoError(t, m.requests.add("last", mastodonRequest{expires: now.Add(time.Minute)}, now))
+	assert.EqualError(t, m.requests.add("extra", mastodonRequest{expires: now.Add(time.Minute)}, now), "too many pending login requests")
+	now = now.Add(2 * time.Minute)
+	assert.NoError(t, m.requests.add("extra", mastodonRequest{expires: now.Add(time.Minute)}, now), "expired requests dropped")
+	assert.Len(t, m.requests.data, 1)
+}
+
+func TestNormalizeInstance(t *testing.T) {
+	tbl := []struct {
+		in, res string
+	}{
+		{"mastodon.social", "mastodon.social"},
+		{" https://Mastodon.Social/ ", "mastodon.social"},
+		{"@alice@mastodon.social", "mastodon.social"},
+		{"alice@fosstodon.org", "fosstodon.org"},
+		{"social.example.com:8443", "social.example.com:8443"},
+		{"127.0.0.1:1", "127.0.0.1:1"},
+	}
+	for _, tt := range tbl {
+		res, err := normalizeInstance(tt.in)
+		require.NoError(t, err, tt.in)
+		assert.Equal(t, tt.res, res, tt.in)
+	}
+	for _, bad := range []string{"", "localhost", "http://mastodon.social", "mastodon.social/about", "mastodon.social?x=1",
+		"a b.com", "user:pass@", "mastodon.social#x"} {
+		_, err := normalizeInstance(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestMastodonUser(t *testing.T) {
+	u := mastodonUser("mastodon.social", mastodonAccount{ID: "1", Username: "alice", DisplayName: " ", Avatar: "https://a/1.png"})
+	assert.Equal(t, token.User{ID: "mastodon_" + token.HashID(sha1.New(), "mastodon.social:1"), Name: "alice",
+		Picture: "https://a/1.png"}, u)
+	other := mastodonUser("fosstodon.org", mastodonAccount{ID: "1"})
+	assert.NotEqual(t, u.ID, other.ID, "same account id on other instance is another user")
+	assert.True(t, strings.HasPrefix(other.Name, "noname_"), other.Name)
+}
+
+// testMastodonLogin calls login handler and returns the state of the request from the redirect to the instance
+func testMastodonLogin(t *testing.T, m *Mastodon, instance, query string) string {
+	rr := httptest.NewRecorder()
+	m.LoginHandler(rr, httptest.NewRequest(http.MethodGet, "/auth/mastodon/login?"+query, http.NoBody))
+	require.Equal(t, http.StatusFound, rr.Code, rr.Body.String())
+	u, err := url.Parse(rr.Header().Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, "https://"+instance+"/oauth/authorize", u.Scheme+"://"+u.Host+u.Path)
+	assert.Equal(t, "cid", u.Query().Get("client_id"))
+	assert.Equal(t, "code", u.Query().Get("response_type"))
+	assert.Equal(t, "read:accounts", u.Query().Get("scope"))
+	assert.Equal(t, "https://remark42.example.com/auth/mastodon/callback", u.Query().Get("redirect_uri"))
+	require.NotEmpty(t, u.Query().Get("state"))
+	return u.Query().Get("state")
+}
@@ -0,0 +1,66 @@
+package providers
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// errTooManyRequests returned by providers when the store of pending login requests is full
+var errTooManyRequests = errors.New("too many pending login requests")
+
+// pendingStore keeps pending requests of login flows, like OAuth states or sent codes, in memory by key.
+// The number of requests is limited, expired requests removed when the limit is reached. Thread safe.
+type pendingStore[T any] struct {
+	maxSize int
+	errFull error             // returned when there are too many unexpired requests
+	expires func(T) time.Time // expiration time of the request
+
+	mu   sync.Mutex
+	data map[string]T
+}
+
+// newPendingStore makes store limited to maxSize requests
+func newPendingStore[T any](maxSize int, errFull error, expires func(T) time.Time) *pendingStore[T] {
+	return &pendingStore[T]{maxSize: maxSize, errFull: errFull, expires: expires, data: map[string]T{}}
+}
+
+// add keeps the request by key, replacing the previous request of the key
+func (p *pendingStore[T]) add(key string, req T, now time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.data[key]; !ok && len(p.data) >= p.maxSize {
+		for k, v := range p.data {
+			if now.After(p.expires(v)) {
+				delete(p.data, k)
+			}
+		}
+		if len(p.data) >= p.maxSize {
+			return p.errFull
+		}
+	}
+	p.data[key] = req
+	return nil
+}
+
+// take returns the request and removes it, so it can't be used twice. Expired request is removed and not returned.
+func (p *pendingStore[T]) take(key string, now time.Time) (res T, ok bool) {
+	p.update(key, func(req T, found bool) bool {
+		if found && !now.After(p.expires(req)) {
+			res, ok = req, true
+		}
+		return false
+	})
+	return res, ok
+}
+
+// update calls fn with the request of the key under the lock, found is false if there is no such request.
+// The request is removed unless fn returns true.
+func (p *pendingStore[T]) update(key string, fn func(req T, found bool) (keep bool)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	req, found := p.data[key]
+	if !fn(req, found) {
+		delete(p.data, key)
+	}
+}
@@ -0,0 +1,62 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPendingStore(t *testing.T) {
+	type req struct {
+		val     string
+		expires time.Time
+	}
+	p := newPendingStore(3, errors.New("full"), func(r req) time.Time { return r.expires })
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	require.NoError(t, p.add("k1", req{val: "v1", expires: now.Add(time.Minute)}, now))
+	res, ok := p.take("k1", now)
+	require.True(t, ok)
+	assert.Equal(t, "v1", res.val)
+	_, ok = p.take("k1", now)
+	assert.False(t, ok, "taken once")
+
+	require.NoError(t, p.add("expired", req{expires: now.Add(-time.Second)}, now))
+	_, ok = p.take("expired", now)
+	assert.False(t, ok)
+	assert.Empty(t, p.data, "expired request removed")
+
+	for i := range 3 {
+		require.NoError(t, p.add(fmt.Sprintf("k%d", i), req{expires: now.Add(time.Minute)}, now))
+	}
+	assert.EqualError(t, p.add("extra", req{expires: now.Add(time.Minute)}, now), "full")
+	assert.NoError(t, p.add("k1", req{val: "new", expires: now.Add(time.Minute)}, now), "replaced")
+	now = now.Add(2 * time.Minute)
+	assert.NoError(t, p.add("extra", req{expires: now.Add(time.Minute)}, now), "expired requests dropped")
+	assert.Len(t, p.data, 1)
+}
+
+func TestPendingStore_Update(t *testing.T) {
+	p := newPendingStore(10, errors.New("full"), func(n *int) time.Time { return time.Time{} })
+	n := 0
+	require.NoError(t, p.add("k", &n, time.Time{}))
+
+	p.update("k", func(req *int, found bool) bool {
+		require.True(t, found)
+		*req++
+		return true
+	})
+	assert.Equal(t, 1, n)
+	assert.Len(t, p.data, 1, "kept")
+
+	p.update("k", func(req *int, found bool) bool { return false })
+	assert.Empty(t, p.data, "removed")
+	p.update("k", func(req *int, found bool) bool {
+		assert.False(t, found)
+		return false
+	})
+}
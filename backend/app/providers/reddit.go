@@ -0,0 +1,317 @@
+package providers
+
+// Reddit provider, logging users in with Reddit OAuth2. Reddit rejects API requests without
+// descriptive User-Agent and authenticates apps on token endpoint with basic auth only, so the
+// flow is made here instead of generic OAuth2 provider. Tokens are not used after the login, the
+// refresh token issued for permanent duration is revoked right away.
+
+import (
+	"crypto/sha1" //nolint:gosec // used for user id hashing, same as other auth providers
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-pkgz/auth/v2/provider"
+	"github.com/go-pkgz/auth/v2/token"
+	log "github.com/go-pkgz/lgr"
+	R "github.com/go-pkgz/rest"
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/umputun/remark42/backend/app/rest"
+)
+
+const (
+	redditAuthURL         = "https://www.reddit.com/api/v1/authorize"
+	redditTokenURL        = "https://www.reddit.com/api/v1/access_token"
+	redditRevokeURL       = "https://www.reddit.com/api/v1/revoke_token"
+	redditMeURL           = "https://oauth.reddit.com/api/v1/me"
+	redditScope           = "identity"
+	redditRequestLifetime = 30 * time.Minute // time for user to log in on reddit
+	redditMaxRequests     = 10000            // max number of pending login requests
+	redditMaxResponseSize = 1024 * 1024      // max size of reddit's response
+)
+
+// RedditParams defines parameters of Reddit provider
+type RedditParams struct {
+	URL       string       // remark42 url, callback is at URL/auth/reddit/callback
+	Issuer    string       // issuer of jwt tokens
+	Cid       string       // client id of reddit app
+	Csecret   string       // client secret of reddit app
+	UserAgent string       // User-Agent of requests to reddit, like "web:remark42:v1.14 (by /u/someone)"
+	Duration  string       // duration of authorization, "temporary" or "permanent", temporary if not set
+	Client    *http.Client // client of reddit requests, with 10s timeout if nil
+
+	TokenService         provider.TokenService
+	AvatarSaver          provider.AvatarSaver
+	AllowedRedirectHosts token.AllowedHosts
+}
+
+// Reddit implements OAuth2 login with Reddit as auth provider with login, callback and logout handlers.
+// Pending login requests are kept in memory.
+type Reddit struct {
+	RedditParams
+	now       func() time.Time
+	authURL   string
+	tokenURL  string
+	revokeURL string
+	meURL     string
+
+	requests *pendingStore[redditRequest]
+}
+
+// redditRequest is pending login request
+type redditRequest struct {
+	from    string
+	aud     string
+	session bool
+	noAva   bool
+	expires time.Time
+}
+
+// redditAccount is the part of account returned by /api/v1/me used to make the user
+type redditAccount struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	IconImg      string `json:"icon_img"`
+	SnoovatarImg string `json:"snoovatar_img"`
+}
+
+// redditToken is the response of token endpoint
+type redditToken struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	Error        string `json:"error"`
+}
+
+// NewReddit makes Reddit provider
+func NewReddit(params RedditParams) (*Reddit, error) {
+	if params.Cid == "" || params.Csecret == "" {
+		return nil, errors.New("no reddit client id or secret")
+	}
+	switch params.Duration {
+	case "":
+		params.Duration = "temporary"
+	case "temporary", "permanent":
+	default:
+		return nil, fmt.Errorf("unknown reddit duration %q", params.Duration)
+	}
+	if params.UserAgent == "" {
+		params.UserAgent = "web:remark42"
+	}
+	params.URL = strings.TrimSuffix(params.URL, "/")
+	if params.Client == nil {
+		params.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	res := &Reddit{RedditParams: params, now: time.Now,
+		authURL: redditAuthURL, tokenURL: redditTokenURL, revokeURL: redditRevokeURL, meURL: redditMeURL}
+	res.requests = newPendingStore(redditMaxRequests, errTooManyRequests, func(r redditRequest) time.Time { return r.expires })
+	return res, nil
+}
+
+// Name returns provider name
+func (rd *Reddit) Name() string { return "reddit" }
+
+func (rd *Reddit) callbackURL() string { return rd.URL + "/auth/reddit/callback" }
+
+// LoginHandler redirects to the authorization page of Reddit
+func (rd *Reddit) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	aud := r.URL.Query().Get("site") // legacy, for back compat
+	if aud == "" {
+		aud = r.URL.Query().Get("aud")
+	}
+	req := redditRequest{
+		from:    r.URL.Query().Get("from"),
+		aud:     aud,
+		session: r.URL.Query().Get("session") != "" && r.URL.Query().Get("session") != "0",
+		noAva:   r.URL.Query().Get("noava") == "1",
+		expires: rd.now().Add(redditRequestLifetime),
+	}
+	state := randomID()
+	if err := rd.requests.add(state, req, rd.now()); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusTooManyRequests, err, "can't start reddit login", rest.ErrActionRejected)
+		return
+	}
+
+	q := url.Values{
+		"client_id":     {rd.Cid},
+		"response_type": {"code"},
+		"state":         {state},
+		"redirect_uri":  {rd.callbackURL()},
+		"duration":      {rd.Duration},
+		"scope":         {redditScope},
+	}
+	http.Redirect(w, r, rd.authURL+"?"+q.Encode(), http.StatusFound)
+}
+
+// AuthHandler handles callback from Reddit, gets the account with the authorization code and sets the token
+func (rd *Reddit) AuthHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := rd.requests.take(r.URL.Query().Get("state"), rd.now())
+	if !ok {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, errors.New("unknown state"), "unknown or expired login request",
+			rest.ErrNoAccess)
+		return
+	}
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, fmt.Errorf("no code, %s", r.URL.Query().Get("error")),
+			"login rejected by reddit", rest.ErrNoAccess)
+		return
+	}
+
+	acc, err := rd.account(code)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, err, "can't get reddit account", rest.ErrNoAccess)
+		return
+	}
+	u := redditUser(acc)
+
+	if req.noAva {
+		u.Picture = "" // reset picture on no avatar request
+	}
+	if rd.AvatarSaver != nil {
+		if u.Picture, err = rd.AvatarSaver.Put(u, rd.Client); err != nil {
+			rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "failed to save avatar to proxy", rest.ErrInternal)
+			return
+		}
+	}
+
+	claims := token.Claims{
+		User: &u,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:   rd.Issuer,
+			ID:       randomID(),
+			Audience: []string{req.aud},
+		},
+		SessionOnly:  req.session,
+		NoAva:        req.noAva,
+		AuthProvider: &token.AuthProvider{Name: rd.Name()},
+	}
+	if _, err = rd.TokenService.Set(w, claims); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "failed to set token", rest.ErrInternal)
+		return
+	}
+	log.Printf("[DEBUG] reddit login of user %s", u.ID)
+
+	if req.from != "" && allowedRedirect(rd.URL, rd.AllowedRedirectHosts, req.from) {
+		http.Redirect(w, r, req.from, http.StatusSeeOther)
+		return
+	}
+	R.RenderJSON(w, &u)
+}
+
+// LogoutHandler resets the token
+func (rd *Reddit) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if _, _, err := rd.TokenService.Get(r); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, err, "logout not allowed", rest.ErrNoAccess)
+		return
+	}
+	rd.TokenService.Reset(w)
+}
+
+// account exchanges authorization code for the access token and gets the account with it.
+// Refresh token of permanent authorization is revoked as it is not used.
+func (rd *Reddit) account(code string) (redditAccount, error) {
+	form := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {rd.callbackURL()},
+	}
+	tkn := redditToken{}
+	if err := rd.post(rd.tokenURL, form, &tkn); err != nil {
+		return redditAccount{}, fmt.Errorf("can't get access token: %w", err)
+	}
+	// reddit responds with 200 and error in the body on bad code
+	if tkn.Error != "" || tkn.AccessToken == "" {
+		return redditAccount{}, fmt.Errorf("no access token in response, %s", tkn.Error)
+	}
+	if tkn.RefreshToken != "" {
+		defer rd.revoke(tkn.RefreshToken)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, rd.meURL, http.NoBody)
+	if err != nil {
+		return redditAccount{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+tkn.AccessToken)
+	acc := redditAccount{}
+	if err = rd.do(req, &acc); err != nil {
+		return redditAccount{}, fmt.Errorf("can't get account: %w", err)
+	}
+	if acc.ID == "" {
+		return redditAccount{}, errors.New("no account id in response")
+	}
+	return acc, nil
+}
+
+// revoke revokes refresh token, revoking all access tokens made with it as well
+func (rd *Reddit) revoke(refreshToken string) {
+	form := url.Values{"token": {refreshToken}, "token_type_hint": {"refresh_token"}}
+	req, err := http.NewRequest(http.MethodPost, rd.revokeURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		log.Printf("[WARN] can't make reddit token revocation request, %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", rd.UserAgent)
+	req.SetBasicAuth(rd.Cid, rd.Csecret)
+	resp, err := rd.Client.Do(req)
+	if err != nil {
+		log.Printf("[WARN] can't revoke reddit token, %v", err)
+		return
+	}
+	defer resp.Body.Close() //nolint:errcheck // nothing to do with the error
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		log.Printf("[WARN] reddit token revocation responded with status %d", resp.StatusCode)
+	}
+}
+
+// post makes request to token endpoint, authenticating the app with basic auth
+func (rd *Reddit) post(u string, form url.Values, res any) error {
+	req, err := http.NewRequest(http.MethodPost, u, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(rd.Cid, rd.Csecret)
+	return rd.do(req, res)
+}
+
+func (rd *Reddit) do(req *http.Request, res any) error {
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", rd.UserAgent)
+	resp, err := rd.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck // nothing to do with the error
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s responded with status %d", req.URL.Path, resp.StatusCode)
+	}
+	if err = json.NewDecoder(io.LimitReader(resp.Body, redditMaxResponseSize)).Decode(res); err != nil {
+		return fmt.Errorf("can't decode response of %s: %w", req.URL.Path, err)
+	}
+	return nil
+}
+
+// redditUser makes the user from the account. Avatar urls of reddit are html-escaped,
+// snoovatar is used if the user has no icon.
+func redditUser(acc redditAccount) token.User {
+	u := token.User{
+		ID:      "reddit_" + token.HashID(sha1.New(), acc.ID),
+		Name:    acc.Name,
+		Picture: html.UnescapeString(acc.IconImg),
+	}
+	if u.Picture == "" {
+		u.Picture = html.UnescapeString(acc.SnoovatarImg)
+	}
+	if u.Name == "" {
+		u.Name = "noname_" + u.ID[7:11]
+	}
+	return u
+}
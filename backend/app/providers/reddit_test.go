@@ -0,0 +1,184 @@
+package providers
+
+import (
+	"crypto/sha1" //nolint:gosec // same hashing of user id as in provider
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-pkgz/auth/v2/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewReddit(t *testing.T) {
+	rd, err := NewReddit(RedditParams{URL: "https://remark42.example.com/", Cid: "cid", Csecret: "csec"})
+	require.NoError(t, err)
+	assert.Equal(t, "reddit", rd.Name())
+	assert.Equal(t, "https://remark42.example.com/auth/reddit/callback", rd.callbackURL())
+	assert.Equal(t, "temporary", rd.Duration)
+	assert.Equal(t, "web:remark42", rd.UserAgent)
+	assert.NotNil(t, rd.Client)
+
+	_, err = NewReddit(RedditParams{URL: "https://remark42.example.com", Cid: "cid"})
+	assert.EqualError(t, err, "no reddit client id or secret")
+	_, err = NewReddit(RedditParams{URL: "https://remark42.example.com", Cid: "cid", Csecret: "csec", Duration: "forever"})
+	assert.EqualError(t, err, `unknown reddit duration "forever"`)
+}
+
+func TestReddit_LoginAndCallback(t *testing.T) {
+	var revoked int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "web:remark42:test (by /u/admin)", r.Header.Get("User-Agent"))
+		switch r.URL.Path {
+		case "/api/v1/access_token":
+			user, pass, ok := r.BasicAuth()
+			assert.True(t, ok)
+			assert.Equal(t, "cid", user)
+			assert.Equal(t, "csec", pass)
+			require.NoError(t, r.ParseForm())
+			assert.Equal(t, "authorization_code", r.PostForm.Get("grant_type"))
+			assert.Equal(t, "https://remark42.example.com/auth/reddit/callback", r.PostForm.Get("redirect_uri"))
+			if r.PostForm.Get("code") != "good-code" {
+				_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"access_token":"tkn","token_type":"bearer","refresh_token":"rtkn","scope":"identity"}`))
+		case "/api/v1/revoke_token":
+			atomic.AddInt32(&revoked, 1)
+			require.NoError(t, r.ParseForm())
+			assert.Equal(t, "rtkn", r.PostForm.Get("token"))
+			assert.Equal(t, "refresh_token", r.PostForm.Get("token_type_hint"))
+			w.WriteHeader(http.StatusNoContent)
+		case "/api/v1/me":
+			assert.Equal(t, "Bearer tkn", r.Header.Get("Authorization"))
+			_, _ = w.Write([]byte(`{"id":"abc12","name":"spez",
+				"icon_img":"https://styles.redditmedia.com/spez.png?width=256&amp;s=1"}`))
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+	}))
+	defer ts.Close()
+
+	tokens := &mockTokenService{}
+	rd := testReddit(t, ts, tokens)
+	rd.AvatarSaver = avatarSaverFunc(func(u token.User, client *http.Client) (string, error) {
+		assert.Equal(t, "https://styles.redditmedia.com/spez.png?width=256&s=1", u.Picture)
+		assert.NotNil(t, client)
+		return "https://remark42.example.com/api/v1/avatar/" + u.ID + ".image", nil
+	})
+
+	state := testRedditLogin(t, rd, "from=https%3A%2F%2Fblog.example.com%2Fpost&site=remark&session=1")
+	rr := httptest.NewRecorder()
+	rd.AuthHandler(rr, testRedditCallback(state, "good-code"))
+	require.Equal(t, http.StatusSeeOther, rr.Code, rr.Body.String())
+	assert.Equal(t, "https://blog.example.com/post", rr.Header().Get("Location"))
+
+	userID := "reddit_" + token.HashID(sha1.New(), "abc12")
+	require.NotNil(t, tokens.claims.User)
+	assert.Equal(t, token.User{ID: userID, Name: "spez",
+		Picture: "https://remark42.example.com/api/v1/avatar/" + userID + ".image"}, *tokens.claims.User)
+	assert.Equal(t, []string{"remark"}, []string(tokens.claims.Audience))
+	assert.True(t, tokens.claims.SessionOnly)
+	assert.Equal(t, "reddit", tokens.claims.AuthProvider.Name)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&revoked), "refresh token revoked")
+
+	// state can't be used twice
+	rr = httptest.NewRecorder()
+	rd.AuthHandler(rr, testRedditCallback(state, "good-code"))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "unknown or expired login request")
+
+	// code rejected by reddit
+	state = testRedditLogin(t, rd, "site=remark")
+	rr = httptest.NewRecorder()
+	rd.AuthHandler(rr, testRedditCallback(state, "bad-code"))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "can't get reddit account")
+
+	// login denied by user
+	state = testRedditLogin(t, rd, "site=remark")
+	rr = httptest.NewRecorder()
+	rd.AuthHandler(rr, httptest.NewRequest(http.MethodGet, "/auth/reddit/callback?error=access_denied&state="+state, http.NoBody))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "login rejected by reddit")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&revoked))
+}
+
+func TestReddit_Logout(t *testing.T) {
+	tokens := &mockTokenService{claims: token.Claims{User: &token.User{ID: "reddit_123"}}}
+	rd, err := NewReddit(RedditParams{URL: "https://remark42.example.com", Cid: "cid", Csecret: "csec", TokenService: tokens})
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	rd.LogoutHandler(rr, httptest.NewRequest(http.MethodGet, "/auth/reddit/logout", http.NoBody))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Nil(t, tokens.claims.User)
+}
+
+func TestReddit_Requests(t *testing.T) {
+	rd, err := NewReddit(RedditParams{URL: "https://remark42.example.com", Cid: "cid", Csecret: "csec"})
+	require.NoError(t, err)
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	rd.now = func() time.Time { return now }
+
+	require.NoError(t, rd.requests.add("expired", redditRequest{expires: now.Add(-time.Second)}, now))
+	_, ok := rd.requests.take("expired", now)
+	assert.False(t, ok)
+
+	for i := range redditMaxRequests - 1 {
+		rd.requests.data[fmt.Sprintf("r%d", i)] = redditRequest{expires: now.Add(time.Minute)}
+	}
+	require.NoError(t, rd.requests.add("last", redditRequest{expires: now.Add(time.Minute)}, now))
+	assert.EqualError(t, rd.requests.add("extra", redditRequest{expires: now.Add(time.Minute)}, now), "too many pending login requests")
+	now = now.Add(2 * time.Minute)
+	assert.NoError(t, rd.requests.add("extra", redditRequest{expires: now.Add(time.Minute)}, now), "expired requests dropped")
+	assert.Len(t, rd.requests.data, 1)
+}
+
+func TestRedditUser(t *testing.T) {
+	u := redditUser(redditAccount{ID: "abc12", SnoovatarImg: "https://i.redd.it/snoovatar/a.png?x=1&amp;y=2"})
+	assert.Equal(t, "reddit_"+token.HashID(sha1.New(), "abc12"), u.ID)
+	assert.Equal(t, "noname_"+u.ID[7:11], u.Name)
+	assert.Equal(t, "https://i.redd.it/snoovatar/a.png?x=1&y=2", u.Picture)
+}
+
+func testReddit(t *testing.T, ts *httptest.Server, tokens *mockTokenService) *Reddit {
+	rd, err := NewReddit(RedditParams{URL: "https://remark42.example.com", Cid: "cid", Csecret: "csec",
+		UserAgent: "web:remark42:test (by /u/admin)", Duration: "permanent", Client: ts.Client(), TokenService: tokens,
+		AllowedRedirectHosts: token.AllowedHostsFunc(func() ([]string, error) {
+			return []string{"blog.example.com"}, nil
+		})})
+	require.NoError(t, err)
+	rd.authURL = ts.URL + "/api/v1/authorize"
+	rd.tokenURL = ts.URL + "/api/v1/access_token"
+	rd.revokeURL = ts.URL + "/api/v1/revoke_token"
+	rd.meURL = ts.URL + "/api/v1/me"
+	return rd
+}
+
+// testRedditLogin starts login and returns state passed to reddit
+func testRedditLogin(t *testing.T, rd *Reddit, query string) string {
+	rr := httptest.NewRecorder()
+	rd.LoginHandler(rr, httptest.NewRequest(http.MethodGet, "/auth/reddit/login?"+query, http.NoBody))
+	require.Equal(t, http.StatusFound, rr.Code)
+	loc, err := url.Parse(rr.Header().Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, rd.authURL, loc.Scheme+"://"+loc.Host+loc.Path)
+	assert.Equal(t, "cid", loc.Query().Get("client_id"))
+	assert.Equal(t, "code", loc.Query().Get("response_type"))
+	assert.Equal(t, "permanent", loc.Query().Get("duration"))
+	assert.Equal(t, "identity", loc.Query().Get("scope"))
+	assert.Equal(t, "https://remark42.example.com/auth/reddit/callback", loc.Query().Get("redirect_uri"))
+	state := loc.Query().Get("state")
+	require.NotEmpty(t, state)
+	return state
+}
+
+func testRedditCallback(state, code string) *http.Request {
+	q := url.Values{"state": {state}, "code": {code}}
+	return httptest.NewRequest(http.MethodGet, "/auth/reddit/callback?"+q.Encode(), http.NoBody)
+}
@@ -0,0 +1,616 @@
+package providers
+
+// SAML 2.0 service provider, logging users in with corporate identity providers. Authentication request
+// is sent with HTTP-Redirect binding and the signed response is received with HTTP-POST binding
+// by the callback handler, as implemented by most identity providers.
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"crypto/sha1" //nolint:gosec // used for user id hashing, same as other auth providers
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/go-pkgz/auth/v2/provider"
+	"github.com/go-pkgz/auth/v2/token"
+	log "github.com/go-pkgz/lgr"
+	R "github.com/go-pkgz/rest"
+	"github.com/golang-jwt/jwt/v5"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/russellhaering/goxmldsig/etreeutils"
+
+	"github.com/umputun/remark42/backend/app/rest"
+)
+
+const (
+	nsSAMLMetadata  = "urn:oasis:names:tc:SAML:2.0:metadata"
+	nsSAMLProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	nsSAMLAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+
+	samlBindingRedirect = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	samlBindingPOST     = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	samlStatusSuccess   = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	samlBearer          = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+
+	samlRequestLifetime = 30 * time.Minute // time for user to log in with identity provider
+	samlMaxRequests     = 10000            // max number of pending login requests
+	samlMaxResponseSize = 1024 * 1024      // max size of posted response form
+	samlClockSkew       = 3 * time.Minute  // allowed difference of identity provider's clock
+)
+
+// SAMLParams defines parameters of SAML service provider
+type SAMLParams struct {
+	URL         string // remark42 url, assertion consumer service is at URL/auth/saml/callback
+	EntityID    string // service provider's entity id, URL/auth/saml/metadata if empty
+	Issuer      string // issuer of jwt tokens
+	IdPMetadata []byte // identity provider's metadata
+
+	IDAttr      string // attribute with user id, NameID used if empty
+	NameAttr    string // attribute with user name
+	EmailAttr   string // attribute with user email
+	PictureAttr string // attribute with user picture url
+
+	TokenService         provider.TokenService
+	AvatarSaver          provider.AvatarSaver
+	AllowedRedirectHosts token.AllowedHosts
+}
+
+// SAML implements SAML 2.0 service provider as auth provider with login, callback and logout handlers.
+// Pending login requests kept in memory, keyed by relay state passed back by identity provider,
+// as the response is posted cross-site and cookies may be not sent with it.
+type SAML struct {
+	SAMLParams
+	idp samlIdP
+	now func() time.Time
+
+	requests *pendingStore[samlRequest]
+}
+
+// samlIdP is identity provider, parsed from its metadata
+type samlIdP struct {
+	entityID string
+	ssoURL   string // single sign-on service with HTTP-Redirect binding
+	certs    []*x509.Certificate
+}
+
+// samlRequest is pending login request
+type samlRequest struct {
+	id      string
+	from    string
+	aud     string
+	session bool
+	noAva   bool
+	expires time.Time
+}
+
+// samlMetadata is identity provider's metadata, only fields used by service provider
+type samlMetadata struct {
+	XMLName  xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntityDescriptor"`
+	EntityID string   `xml:"entityID,attr"`
+	IdP      []struct {
+		Keys []struct {
+			Use     string `xml:"use,attr"`
+			KeyInfo struct {
+				X509Data struct {
+					Certs []string `xml:"http://www.w3.org/2000/09/xmldsig# X509Certificate"`
+				} `xml:"http://www.w3.org/2000/09/xmldsig# X509Data"`
+			} `xml:"http://www.w3.org/2000/09/xmldsig# KeyInfo"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:metadata KeyDescriptor"`
+		SSO []struct {
+			Binding  string `xml:"Binding,attr"`
+			Location string `xml:"Location,attr"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:metadata SingleSignOnService"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:metadata IDPSSODescriptor"`
+}
+
+// NewSAML makes SAML service provider for identity provider from its metadata
+func NewSAML(params SAMLParams) (*SAML, error) {
+	params.URL = strings.TrimSuffix(params.URL, "/")
+	if params.EntityID == "" {
+		params.EntityID = params.URL + "/auth/saml/metadata"
+	}
+	idp, err := parseSAMLMetadata(params.IdPMetadata)
+	if err != nil {
+		return nil, fmt.Errorf("bad identity provider metadata: %w", err)
+	}
+	res := &SAML{SAMLParams: params, idp: idp, now: time.Now}
+	res.requests = newPendingStore(samlMaxRequests, errTooManyRequests, func(r samlRequest) time.Time { return r.expires })
+	return res, nil
+}
+
+func parseSAMLMetadata(data []byte) (samlIdP, error) {
+	md := samlMetadata{}
+	if err := xml.Unmarshal(data, &md); err != nil {
+		return samlIdP{}, err
+	}
+	if md.EntityID == "" || len(md.IdP) == 0 {
+		return samlIdP{}, errors.New("no identity provider's entity descriptor")
+	}
+	res := samlIdP{entityID: md.EntityID}
+	for _, idp := range md.IdP {
+		for _, key := range idp.Keys {
+			if key.Use != "" && key.Use != "signing" {
+				continue
+			}
+			for _, c := range key.KeyInfo.X509Data.Certs {
+				der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(c), ""))
+				if err != nil {
+					return samlIdP{}, fmt.Errorf("bad signing certificate: %w", err)
+				}
+				cert, err := x509.ParseCertificate(der)
+				if err != nil {
+					return samlIdP{}, fmt.Errorf("bad signing certificate: %w", err)
+				}
+				res.certs = append(res.certs, cert)
+			}
+		}
+		for _, sso := range idp.SSO {
+			if sso.Binding == samlBindingRedirect && res.ssoURL == "" {
+				res.ssoURL = sso.Location
+			}
+		}
+	}
+	if len(res.certs) == 0 {
+		return samlIdP{}, errors.New("no signing certificates")
+	}
+	if res.ssoURL == "" {
+		return samlIdP{}, errors.New("no single sign-on service with HTTP-Redirect binding")
+	}
+	return res, nil
+}
+
+// Name of the provider
+func (s *SAML) Name() string { return "saml" }
+
+// String representation of the provider
+func (s *SAML) String() string { return "saml with identity provider " + s.idp.entityID }
+
+// acsURL returns url of assertion consumer service
+func (s *SAML) acsURL() string { return s.URL + "/auth/saml/callback" }
+
+// LoginHandler redirects user to identity provider with authentication request - GET /login
+func (s *SAML) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	aud := r.URL.Query().Get("site") // legacy, for back compat
+	if aud == "" {
+		aud = r.URL.Query().Get("aud")
+	}
+	req := samlRequest{
+		id:      "_" + randomID(),
+		from:    r.URL.Query().Get("from"),
+		aud:     aud,
+		session: r.URL.Query().Get("session") != "" && r.URL.Query().Get("session") != "0",
+		noAva:   r.URL.Query().Get("noava") == "1",
+		expires: s.now().Add(samlRequestLifetime),
+	}
+	relayState := randomID()
+	if err := s.requests.add(relayState, req, s.now()); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusTooManyRequests, err, "can't start saml login", rest.ErrActionRejected)
+		return
+	}
+
+	loginURL, err := s.authnRequestURL(req.id, relayState)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't make saml request", rest.ErrInternal)
+		return
+	}
+	http.Redirect(w, r, loginURL, http.StatusFound)
+}
+
+// AuthHandler checks response posted by identity provider, sets token and redirects to "from" url - POST /callback
+func (s *SAML) AuthHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		rest.SendErrorJSON(w, r, http.StatusMethodNotAllowed, errors.New("method not allowed"), "saml response should be posted",
+			rest.ErrDecode)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, samlMaxResponseSize)
+	if err := r.ParseForm(); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't parse saml response form", rest.ErrDecode)
+		return
+	}
+	req, ok := s.requests.take(r.PostForm.Get("RelayState"), s.now())
+	if !ok {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, errors.New("unknown relay state"), "unknown or expired login request",
+			rest.ErrNoAccess)
+		return
+	}
+	data, err := base64.StdEncoding.DecodeString(r.PostForm.Get("SAMLResponse"))
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't decode saml response", rest.ErrDecode)
+		return
+	}
+	u, err := s.parseResponse(data, req.id)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, err, "rejected saml response", rest.ErrNoAccess)
+		return
+	}
+
+	if req.noAva {
+		u.Picture = "" // reset picture on no avatar request
+	}
+	if s.AvatarSaver != nil {
+		if u.Picture, err = s.AvatarSaver.Put(u, &http.Client{Timeout: 5 * time.Second}); err != nil {
+			rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "failed to save avatar to proxy", rest.ErrInternal)
+			return
+		}
+	}
+
+	claims := token.Claims{
+		User: &u,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:   s.Issuer,
+			ID:       randomID(),
+			Audience: []string{req.aud},
+		},
+		SessionOnly:  req.session,
+		NoAva:        req.noAva,
+		AuthProvider: &token.AuthProvider{Name: s.Name()},
+	}
+	if _, err = s.TokenService.Set(w, claims); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "failed to set token", rest.ErrInternal)
+		return
+	}
+	log.Printf("[DEBUG] saml login of user %s", u.ID)
+
+	if req.from != "" && allowedRedirect(s.URL, s.AllowedRedirectHosts, req.from) {
+		http.Redirect(w, r, req.from, http.StatusSeeOther)
+		return
+	}
+	R.RenderJSON(w, &u)
+}
+
+// LogoutHandler resets token - GET /logout
+func (s *SAML) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if _, _, err := s.TokenService.Get(r); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, err, "logout not allowed", rest.ErrNoAccess)
+		return
+	}
+	s.TokenService.Reset(w)
+}
+
+// MetadataHandler returns service provider's metadata to register it with identity provider - GET /auth/saml/metadata
+func (s *SAML) MetadataHandler(w http.ResponseWriter, _ *http.Request) {
+	md := `<md:EntityDescriptor xmlns:md="` + nsSAMLMetadata + `" entityID="` + xmlEscape(s.EntityID) + `">` +
+		`<md:SPSSODescriptor AuthnRequestsSigned="false" WantAssertionsSigned="true" protocolSupportEnumeration="` +
+		nsSAMLProtocol + `">` +
+		`<md:NameIDFormat>urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified</md:NameIDFormat>` +
+		`<md:AssertionConsumerService Binding="` + samlBindingPOST + `" Location="` + xmlEscape(s.acsURL()) +
+		`" index="0" isDefault="true"/>` +
+		`</md:SPSSODescriptor></md:EntityDescriptor>`
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	_, _ = w.Write([]byte(xml.Header + md))
+}
+
+// authnRequestURL makes url of identity provider's sign-on service with deflated authentication request
+func (s *SAML) authnRequestURL(id, relayState string) (string, error) {
+	authnRequest := `<samlp:AuthnRequest xmlns:samlp="` + nsSAMLProtocol + `" xmlns:saml="` + nsSAMLAssertion +
+		`" ID="` + id + `" Version="2.0" IssueInstant="` + s.now().UTC().Format(time.RFC3339) +
+		`" Destination="` + xmlEscape(s.idp.ssoURL) + `" AssertionConsumerServiceURL="` + xmlEscape(s.acsURL()) +
+		`" ProtocolBinding="` + samlBindingPOST + `">` +
+		`<saml:Issuer>` + xmlEscape(s.EntityID) + `</saml:Issuer>` +
+		`<samlp:NameIDPolicy AllowCreate="true"/></samlp:AuthnRequest>`
+
+	buf := bytes.Buffer{}
+	fw, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err = fw.Write([]byte(authnRequest)); err != nil {
+		return "", err
+	}
+	if err = fw.Close(); err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(s.idp.ssoURL)
+	if err != nil {
+		return "", fmt.Errorf("bad sign-on service url: %w", err)
+	}
+	q := u.Query()
+	q.Set("SAMLRequest", base64.StdEncoding.EncodeToString(buf.Bytes()))
+	q.Set("RelayState", relayState)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// parseResponse validates signed response to the request and makes user from its assertion
+func (s *SAML) parseResponse(data []byte, requestID string) (token.User, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		return token.User{}, fmt.Errorf("bad response: %w", err)
+	}
+	for _, t := range doc.Child {
+		if _, ok := t.(*etree.Directive); ok {
+			return token.User{}, errors.New("bad response: DTD is not allowed")
+		}
+	}
+	resp := samlNode{doc.Root()}
+	if !resp.is(nsSAMLProtocol, "Response") || resp.attr("Version") != "2.0" {
+		return token.User{}, errors.New("not a saml 2.0 response")
+	}
+
+	// either assertion or the whole response must be signed, both signatures verified if present.
+	// data taken from signed elements returned by verification, not from the posted document,
+	// so the signed element can't be wrapped around another one
+	var err error
+	signed := false
+	if resp.child(dsig.Namespace, "Signature").Element != nil {
+		if resp, err = s.verifySignature(resp); err != nil {
+			return token.User{}, err
+		}
+		signed = true
+	}
+	if dest := resp.attr("Destination"); dest != "" && dest != s.acsURL() {
+		return token.User{}, fmt.Errorf("unexpected destination %q", dest)
+	}
+	if resp.attr("InResponseTo") != requestID {
+		return token.User{}, errors.New("response to another request")
+	}
+	if status := resp.child(nsSAMLProtocol, "Status").child(nsSAMLProtocol, "StatusCode").attr("Value"); status != samlStatusSuccess {
+		return token.User{}, fmt.Errorf("login failed with status %q", status)
+	}
+	if issuer := resp.child(nsSAMLAssertion, "Issuer"); issuer.Element != nil && issuer.text() != s.idp.entityID {
+		return token.User{}, fmt.Errorf("unexpected issuer %q", issuer.text())
+	}
+	if resp.child(nsSAMLAssertion, "EncryptedAssertion").Element != nil {
+		return token.User{}, errors.New("encrypted assertions are not supported")
+	}
+	assertions := resp.childrenNamed(nsSAMLAssertion, "Assertion")
+	if len(assertions) != 1 {
+		return token.User{}, fmt.Errorf("expected one assertion, got %d", len(assertions))
+	}
+	assertion := assertions[0]
+	if assertion.child(dsig.Namespace, "Signature").Element != nil {
+		if assertion, err = s.verifySignature(assertion); err != nil {
+			return token.User{}, err
+		}
+		signed = true
+	}
+	if !signed {
+		return token.User{}, errors.New("response is not signed")
+	}
+
+	if issuer := assertion.child(nsSAMLAssertion, "Issuer").text(); issuer != s.idp.entityID {
+		return token.User{}, fmt.Errorf("unexpected assertion issuer %q", issuer)
+	}
+	if err = s.checkSubject(assertion.child(nsSAMLAssertion, "Subject"), requestID); err != nil {
+		return token.User{}, err
+	}
+	if err = s.checkConditions(assertion.child(nsSAMLAssertion, "Conditions")); err != nil {
+		return token.User{}, err
+	}
+	return s.makeUser(assertion)
+}
+
+// verifySignature checks enveloped signature of the element with identity provider's certificates,
+// valid at the current time, and returns the signed element
+func (s *SAML) verifySignature(n samlNode) (samlNode, error) {
+	// namespaces declared by ancestors copied to the element, as it is verified out of the document
+	nsCtx, err := etreeutils.NSBuildParentContext(n.Element)
+	if err != nil {
+		return samlNode{}, fmt.Errorf("bad namespaces of %s: %w", n.Tag, err)
+	}
+	el, err := etreeutils.NSDetatch(nsCtx, n.Element)
+	if err != nil {
+		return samlNode{}, fmt.Errorf("bad namespaces of %s: %w", n.Tag, err)
+	}
+	vc := dsig.NewDefaultValidationContext(&dsig.MemoryX509CertificateStore{Roots: s.idp.certs})
+	vc.Clock = dsig.NewFakeClockAt(s.now())
+	if el, err = vc.Validate(el); err != nil {
+		return samlNode{}, fmt.Errorf("bad signature of %s: %w", n.Tag, err)
+	}
+	return samlNode{el}, nil
+}
+
+// checkSubject checks there is bearer confirmation of the subject for this service provider and request
+func (s *SAML) checkSubject(subject samlNode, requestID string) error {
+	if subject.Element == nil {
+		return errors.New("no subject in assertion")
+	}
+	now := s.now()
+	for _, sc := range subject.childrenNamed(nsSAMLAssertion, "SubjectConfirmation") {
+		data := sc.child(nsSAMLAssertion, "SubjectConfirmationData")
+		if sc.attr("Method") != samlBearer || data.Element == nil {
+			continue
+		}
+		if data.attr("Recipient") != s.acsURL() {
+			continue
+		}
+		if irt := data.attr("InResponseTo"); irt != "" && irt != requestID {
+			continue
+		}
+		notOnOrAfter, err := time.Parse(time.RFC3339Nano, data.attr("NotOnOrAfter"))
+		if err != nil || !now.Before(notOnOrAfter.Add(samlClockSkew)) {
+			continue
+		}
+		if nb := data.attr("NotBefore"); nb != "" {
+			if notBefore, e := time.Parse(time.RFC3339Nano, nb); e != nil || now.Add(samlClockSkew).Before(notBefore) {
+				continue
+			}
+		}
+		return nil
+	}
+	return errors.New("no valid bearer subject confirmation")
+}
+
+// checkConditions checks validity period and audience restrictions of assertion
+func (s *SAML) checkConditions(conditions samlNode) error {
+	if conditions.Element == nil {
+		return errors.New("no conditions in assertion")
+	}
+	now := s.now()
+	if nb := conditions.attr("NotBefore"); nb != "" {
+		notBefore, err := time.Parse(time.RFC3339Nano, nb)
+		if err != nil {
+			return fmt.Errorf("bad NotBefore: %w", err)
+		}
+		if now.Add(samlClockSkew).Before(notBefore) {
+			return errors.New("assertion is not yet valid")
+		}
+	}
+	if na := conditions.attr("NotOnOrAfter"); na != "" {
+		notOnOrAfter, err := time.Parse(time.RFC3339Nano, na)
+		if err != nil {
+			return fmt.Errorf("bad NotOnOrAfter: %w", err)
+		}
+		if !now.Before(notOnOrAfter.Add(samlClockSkew)) {
+			return errors.New("assertion expired")
+		}
+	}
+
+	restrictions := conditions.childrenNamed(nsSAMLAssertion, "AudienceRestriction")
+	if len(restrictions) == 0 {
+		return errors.New("no audience restriction in assertion")
+	}
+	for _, ar := range restrictions {
+		found := false
+		for _, aud := range ar.childrenNamed(nsSAMLAssertion, "Audience") {
+			if aud.text() == s.EntityID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.New("assertion is for another audience")
+		}
+	}
+	return nil
+}
+
+// makeUser makes user from name id and attributes of assertion
+func (s *SAML) makeUser(assertion samlNode) (token.User, error) {
+	attrs := map[string]string{}
+	for _, st := range assertion.childrenNamed(nsSAMLAssertion, "AttributeStatement") {
+		for _, a := range st.childrenNamed(nsSAMLAssertion, "Attribute") {
+			value := a.child(nsSAMLAssertion, "AttributeValue").text()
+			for _, name := range []string{a.attr("Name"), a.attr("FriendlyName")} {
+				if _, ok := attrs[name]; name != "" && !ok {
+					attrs[name] = value
+				}
+			}
+		}
+	}
+
+	sourceID := assertion.child(nsSAMLAssertion, "Subject").child(nsSAMLAssertion, "NameID").text()
+	if s.IDAttr != "" {
+		sourceID = attrs[s.IDAttr]
+	}
+	if sourceID == "" {
+		return token.User{}, errors.New("no user id in assertion")
+	}
+
+	u := token.User{
+		ID:      "saml_" + token.HashID(sha1.New(), sourceID),
+		Name:    attrs[s.NameAttr],
+		Email:   attrs[s.EmailAttr],
+		Picture: attrs[s.PictureAttr],
+	}
+	if u.Name == "" {
+		u.Name = "noname_" + u.ID[5:9]
+	}
+	return u, nil
+}
+
+// samlNode is element of parsed document with nil-safe lookups of namespaced children and attributes
+type samlNode struct {
+	*etree.Element
+}
+
+// is checks namespace and local name of the element
+func (n samlNode) is(space, local string) bool {
+	return n.Element != nil && n.Tag == local && n.NamespaceURI() == space
+}
+
+// attr returns value of the attribute without namespace
+func (n samlNode) attr(local string) string {
+	if n.Element == nil {
+		return ""
+	}
+	for _, a := range n.Attr {
+		if a.Space == "" && a.Key == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// childrenNamed returns child elements with the namespace and local name
+func (n samlNode) childrenNamed(space, local string) []samlNode {
+	if n.Element == nil {
+		return nil
+	}
+	var res []samlNode
+	for _, c := range n.ChildElements() {
+		if c := (samlNode{c}); c.is(space, local) {
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+// child returns the first child element with the namespace and local name, empty node if not found
+func (n samlNode) child(space, local string) samlNode {
+	if res := n.childrenNamed(space, local); len(res) > 0 {
+		return res[0]
+	}
+	return samlNode{}
+}
+
+// text returns trimmed text content of the element
+func (n samlNode) text() string {
+	if n.Element == nil {
+		return ""
+	}
+	return strings.TrimSpace(n.Text())
+}
+
+// allowedRedirect checks "from" url is remark42 itself or one of allowed hosts, same as other auth providers do
+func allowedRedirect(serviceURL string, allowed token.AllowedHosts, from string) bool {
+	if allowed == nil {
+		return true
+	}
+	if fn, ok := allowed.(token.AllowedHostsFunc); ok && fn == nil {
+		return true
+	}
+	u, err := url.Parse(from)
+	if err != nil || u.Hostname() == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	if svc, e := url.Parse(serviceURL); e == nil && strings.EqualFold(svc.Hostname(), u.Hostname()) {
+		return true
+	}
+	hosts, err := allowed.Get()
+	if err != nil {
+		return false
+	}
+	for _, h := range hosts {
+		if strings.EqualFold(h, u.Hostname()) || strings.EqualFold(h, u.Host) {
+			return true
+		}
+	}
+	return false
+}
+
+// randomID returns random hex string, used for request ids, states and token ids
+func randomID() string {
+	b := make([]byte, 20)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// xmlEscape escapes text for element content and attribute values
+func xmlEscape(s string) string {
+	buf := bytes.Buffer{}
+	_ = xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
@@ -0,0 +1,438 @@
+package providers
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1" //nolint:gosec // same hashing of user id as in provider
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/go-pkgz/auth/v2/token"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testSAMLIdP = "https://idp.example.com"
+	testSAMLACS = "https://remark42.example.com/auth/saml/callback"
+)
+
+var testSAMLNow = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func TestNewSAML(t *testing.T) {
+	_, cert := testSigningCert(t)
+	s, err := NewSAML(SAMLParams{URL: "https://remark42.example.com/", IdPMetadata: testSAMLMetadata(cert)})
+	require.NoError(t, err)
+	assert.Equal(t, "saml", s.Name())
+	assert.Equal(t, "saml with identity provider https://idp.example.com", s.String())
+	assert.Equal(t, "https://remark42.example.com/auth/saml/metadata", s.EntityID)
+	assert.Equal(t, "https://idp.example.com/sso?tenant=1", s.idp.ssoURL)
+	require.Len(t, s.idp.certs, 1)
+	assert.True(t, cert.Equal(s.idp.certs[0]))
+
+	s, err = NewSAML(SAMLParams{URL: "https://remark42.example.com", EntityID: "remark42", IdPMetadata: testSAMLMetadata(cert)})
+	require.NoError(t, err)
+	assert.Equal(t, "remark42", s.EntityID)
+
+	tbl := []struct {
+		md, err string
+	}{
+		{"not xml", "bad identity provider metadata: EOF"},
+		{`<EntityDescriptor xmlns="urn:oasis:names:tc:SAML:2.0:metadata" entityID="idp"/>`,
+			"bad identity provider metadata: no identity provider's entity descriptor"},
+		{strings.Replace(string(testSAMLMetadata(cert)), `use="signing"`, `use="encryption"`, 1),
+			"bad identity provider metadata: no signing certificates"},
+		{strings.Replace(string(testSAMLMetadata(cert)), "HTTP-Redirect", "HTTP-Artifact", 1),
+			"bad identity provider metadata: no single sign-on service with HTTP-Redirect binding"},
+		{strings.Replace(string(testSAMLMetadata(cert)), "<ds:X509Certificate>", "<ds:X509Certificate>AAAA", 1),
+			"bad identity provider metadata: bad signing certificate: x509: malformed certificate"},
+	}
+	for _, tt := range tbl {
+		_, err = NewSAML(SAMLParams{URL: "https://remark42.example.com", IdPMetadata: []byte(tt.md)})
+		assert.EqualError(t, err, tt.err)
+	}
+}
+
+func TestSAML_LoginAndCallback(t *testing.T) {
+	key, cert := testSigningCert(t)
+	tokens := &mockTokenService{}
+	s := testSAML(t, cert, tokens)
+	s.AllowedRedirectHosts = token.AllowedHostsFunc(func() ([]string, error) { return []string{"blog.example.com"}, nil })
+	s.AvatarSaver = avatarSaverFunc(func(u token.User, _ *http.Client) (string, error) {
+		return "https://remark42.example.com/api/v1/avatar/" + u.ID + ".image", nil
+	})
+
+	relayState, reqID := testSAMLLogin(t, s, "from=https%3A%2F%2Fblog.example.com%2Fpost&site=remark&session=1")
+
+	form := url.Values{"RelayState": {relayState}, "SAMLResponse": {testSAMLResponse(t, key, reqID, nil)}}
+	rr := httptest.NewRecorder()
+	s.AuthHandler(rr, testSAMLPost(form))
+	require.Equal(t, http.StatusSeeOther, rr.Code, rr.Body.String())
+	assert.Equal(t, "https://blog.example.com/post", rr.Header().Get("Location"))
+
+	claims := tokens.claims
+	require.NotNil(t, claims.User)
+	assert.Equal(t, "saml_"+token.HashID(sha1.New(), "john@corp.example.com"), claims.User.ID)
+	assert.Equal(t, "John Doe", claims.User.Name)
+	assert.Equal(t, "john.doe@corp.example.com", claims.User.Email)
+	assert.Equal(t, "https://remark42.example.com/api/v1/avatar/"+claims.User.ID+".image", claims.User.Picture)
+	assert.Equal(t, []string{"remark"}, []string(claims.Audience))
+	assert.Equal(t, "remark42", claims.Issuer)
+	assert.True(t, claims.SessionOnly)
+	assert.Equal(t, "saml", claims.AuthProvider.Name)
+
+	// response can't be used twice
+	rr = httptest.NewRecorder()
+	s.AuthHandler(rr, testSAMLPost(form))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "unknown or expired login request")
+
+	// disallowed redirect, user returned instead
+	relayState, reqID = testSAMLLogin(t, s, "from=https%3A%2F%2Fevil.example.com%2F&noava=1")
+	form = url.Values{"RelayState": {relayState}, "SAMLResponse": {testSAMLResponse(t, key, reqID, nil)}}
+	rr = httptest.NewRecorder()
+	s.AuthHandler(rr, testSAMLPost(form))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Contains(t, rr.Body.String(), `"name":"John Doe"`)
+	assert.True(t, tokens.claims.NoAva)
+	assert.False(t, tokens.claims.SessionOnly)
+
+	// rejected response
+	relayState, reqID = testSAMLLogin(t, s, "")
+	form = url.Values{"RelayState": {relayState}, "SAMLResponse": {testSAMLResponse(t, key, reqID+"x", nil)}}
+	rr = httptest.NewRecorder()
+	s.AuthHandler(rr, testSAMLPost(form))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "rejected saml response")
+
+	// expired request
+	relayState, reqID = testSAMLLogin(t, s, "")
+	s.now = func() time.Time { return testSAMLNow.Add(time.Hour) }
+	form = url.Values{"RelayState": {relayState}, "SAMLResponse": {testSAMLResponse(t, key, reqID, nil)}}
+	rr = httptest.NewRecorder()
+	s.AuthHandler(rr, testSAMLPost(form))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	rr = httptest.NewRecorder()
+	s.AuthHandler(rr, httptest.NewRequest(http.MethodGet, "/auth/saml/callback", http.NoBody))
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+
+	rr = httptest.NewRecorder()
+	s.LogoutHandler(rr, httptest.NewRequest(http.MethodGet, "/auth/saml/logout", http.NoBody))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Nil(t, tokens.claims.User)
+	tokens.getErr = errors.New("no token")
+	rr = httptest.NewRecorder()
+	s.LogoutHandler(rr, httptest.NewRequest(http.MethodGet, "/auth/saml/logout", http.NoBody))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+}
+
+func TestSAML_TooManyRequests(t *testing.T) {
+	_, cert := testSigningCert(t)
+	s := testSAML(t, cert, &mockTokenService{})
+	for i := 0; i < samlMaxRequests; i++ {
+		s.requests.data[randomID()] = samlRequest{expires: testSAMLNow.Add(time.Minute)}
+	}
+	rr := httptest.NewRecorder()
+	s.LoginHandler(rr, httptest.NewRequest(http.MethodGet, "/auth/saml/login", http.NoBody))
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+
+	s.now = func() time.Time { return testSAMLNow.Add(2 * time.Minute) }
+	rr = httptest.NewRecorder()
+	s.LoginHandler(rr, httptest.NewRequest(http.MethodGet, "/auth/saml/login", http.NoBody))
+	assert.Equal(t, http.StatusFound, rr.Code, "expired requests removed")
+	assert.Len(t, s.requests.data, 1)
+}
+
+func TestSAML_parseResponse(t *testing.T) {
+	key, cert := testSigningCert(t)
+	s := testSAML(t, cert, &mockTokenService{})
+
+	u, err := s.parseResponse(testSAMLResponseXML(t, key, "_req", nil), "_req")
+	require.NoError(t, err)
+	assert.Equal(t, "John Doe", u.Name)
+
+	// whole response signed instead of assertion
+	resp := testSAMLResponseDoc("_req", testSAMLAssertion("_req"))
+	u, err = s.parseResponse([]byte(signXML(t, resp, key)), "_req")
+	require.NoError(t, err)
+	assert.Equal(t, "john.doe@corp.example.com", u.Email)
+
+	// assertion signed with ECDSA key
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ecSigner := testKey{Signer: ecKey, cert: testCert(t, ecKey)}
+	u, err = testSAML(t, ecSigner.cert, &mockTokenService{}).parseResponse(testSAMLResponseXML(t, ecSigner, "_req", nil), "_req")
+	require.NoError(t, err)
+	assert.Equal(t, "John Doe", u.Name)
+
+	// assertion using namespace declared by the response
+	inherited := strings.Replace(signXML(t, testSAMLAssertion("_req"), key), `<saml:Assertion xmlns:saml="`+nsSAMLAssertion+`"`,
+		"<saml:Assertion", 1)
+	require.NotContains(t, inherited, "xmlns:saml")
+	u, err = s.parseResponse([]byte(testSAMLResponseDoc("_req", inherited)), "_req")
+	require.NoError(t, err)
+	assert.Equal(t, "John Doe", u.Name)
+
+	// id and name taken from attributes
+	s.IDAttr, s.NameAttr = "uid", "urn:oid:2.5.4.3"
+	u, err = s.parseResponse(testSAMLResponseXML(t, key, "_req", nil), "_req")
+	require.NoError(t, err)
+	assert.Equal(t, "saml_"+token.HashID(sha1.New(), "jdoe"), u.ID)
+	assert.Equal(t, "noname_"+u.ID[5:9], u.Name, "no such attribute")
+	s.IDAttr, s.NameAttr = "", "displayName"
+
+	otherKey, _ := testSigningCert(t)
+
+	// signed assertion moved out of place and replaced by another one with the same id
+	signedAssertion := signXML(t, testSAMLAssertion("_req"), key)
+	evil := strings.Replace(signedAssertion, "John Doe", "Admin", 1)
+	wrapped := strings.Replace(testSAMLResponseDoc("_req", evil), "<samlp:Status>",
+		"<samlp:Extensions>"+signedAssertion+"</samlp:Extensions><samlp:Status>", 1)
+
+	tbl := []struct {
+		resp []byte
+		err  string
+	}{
+		{[]byte("<samlp:Response"), "bad response: XML syntax error on line 1: unexpected EOF"},
+		{[]byte(`<!DOCTYPE r [<!ENTITY x "y">]><r/>`), "bad response: DTD is not allowed"},
+		{[]byte(`<Response xmlns="urn:oasis:names:tc:SAML:2.0:protocol" Version="1.1"/>`), "not a saml 2.0 response"},
+		{testSAMLResponseXML(t, key, "_other", nil), "response to another request"},
+		{testSAMLResponseXML(t, key, "_req", strings.NewReplacer(`Destination="`+testSAMLACS, `Destination="https://evil.example.com`)),
+			`unexpected destination "https://evil.example.com"`},
+		{testSAMLResponseXML(t, key, "_req", strings.NewReplacer("status:Success", "status:Requester")),
+			`login failed with status "urn:oasis:names:tc:SAML:2.0:status:Requester"`},
+		{[]byte(testSAMLResponseDoc("_req", "")), "expected one assertion, got 0"},
+		{[]byte(testSAMLResponseDoc("_req", "<saml:EncryptedAssertion/>")), "encrypted assertions are not supported"},
+		{[]byte(testSAMLResponseDoc("_req", testSAMLAssertion("_req"))), "response is not signed"},
+		{[]byte(testSAMLResponseDoc("_req", strings.Replace(signedAssertion, "John Doe", "Admin", 1))), "bad signature of Assertion: Signature could not be verified"},
+		{[]byte(testSAMLResponseDoc("_req", signXML(t, testSAMLAssertion("_req"), otherKey))),
+			"bad signature of Assertion: Could not verify certificate against trusted certs"},
+		{[]byte(wrapped), "bad signature of Assertion: Signature could not be verified"},
+		{testSAMLResponseXML(t, key, "_req", strings.NewReplacer("<saml:Issuer>"+testSAMLIdP, "<saml:Issuer>https://evil.example.com")),
+			`unexpected issuer "https://evil.example.com"`},
+		{testSAMLResponseXML(t, key, "_req", strings.NewReplacer(`Recipient="`+testSAMLACS, `Recipient="https://evil.example.com`)),
+			"no valid bearer subject confirmation"},
+		{testSAMLResponseXML(t, key, "_req", strings.NewReplacer("cm:bearer", "cm:holder-of-key")),
+			"no valid bearer subject confirmation"},
+		{testSAMLResponseXML(t, key, "_req", strings.NewReplacer(`NotOnOrAfter="2026-01-02T03:09:05Z" Recipient`,
+			`NotOnOrAfter="2026-01-02T02:59:05Z" Recipient`)), "no valid bearer subject confirmation"},
+		{testSAMLResponseXML(t, key, "_req", strings.NewReplacer(`NotBefore="2026-01-02T03:03:05Z"`, `NotBefore="2026-01-02T03:09:05Z"`)),
+			"assertion is not yet valid"},
+		{testSAMLResponseXML(t, key, "_req", strings.NewReplacer(`NotBefore="2026-01-02T03:03:05Z" NotOnOrAfter="2026-01-02T03:09:05Z"`,
+			`NotBefore="2026-01-02T03:03:05Z" NotOnOrAfter="2026-01-02T02:59:05Z"`)), "assertion expired"},
+		{testSAMLResponseXML(t, key, "_req", strings.NewReplacer("<saml:Audience>https://remark42", "<saml:Audience>https://other")),
+			"assertion is for another audience"},
+		{testSAMLResponseXML(t, key, "_req", strings.NewReplacer("<saml:NameID>john@corp.example.com</saml:NameID>",
+			"<saml:NameID/>")), "no user id in assertion"},
+	}
+	for _, tt := range tbl {
+		_, err = s.parseResponse(tt.resp, "_req")
+		assert.EqualError(t, err, tt.err, string(tt.resp))
+	}
+
+	// clock skew allowed
+	s.now = func() time.Time { return testSAMLNow.Add(7 * time.Minute) }
+	_, err = s.parseResponse(testSAMLResponseXML(t, key, "_req", nil), "_req")
+	require.NoError(t, err)
+
+	// certificate of identity provider expired
+	s.now = func() time.Time { return testSAMLNow.Add(25 * time.Hour) }
+	_, err = s.parseResponse(testSAMLResponseXML(t, key, "_req", nil), "_req")
+	require.EqualError(t, err, "bad signature of Assertion: Cert is not valid at this time")
+}
+
+func TestSAML_Metadata(t *testing.T) {
+	_, cert := testSigningCert(t)
+	s := testSAML(t, cert, &mockTokenService{})
+	rr := httptest.NewRecorder()
+	s.MetadataHandler(rr, httptest.NewRequest(http.MethodGet, "/auth/saml/metadata", http.NoBody))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/samlmetadata+xml", rr.Header().Get("Content-Type"))
+	doc := etree.NewDocument()
+	require.NoError(t, doc.ReadFromBytes(rr.Body.Bytes()))
+	md := samlNode{doc.Root()}
+	assert.True(t, md.is(nsSAMLMetadata, "EntityDescriptor"))
+	assert.Equal(t, "https://remark42.example.com/auth/saml/metadata", md.attr("entityID"))
+	acs := md.child(nsSAMLMetadata, "SPSSODescriptor").child(nsSAMLMetadata, "AssertionConsumerService")
+	assert.Equal(t, testSAMLACS, acs.attr("Location"))
+	assert.Equal(t, samlBindingPOST, acs.attr("Binding"))
+}
+
+// testSAMLLogin calls login handler and returns relay state and id of authentication request
+func testSAMLLogin(t *testing.T, s *SAML, query string) (relayState, reqID string) {
+	rr := httptest.NewRecorder()
+	s.LoginHandler(rr, httptest.NewRequest(http.MethodGet, "/auth/saml/login?"+query, http.NoBody))
+	require.Equal(t, http.StatusFound, rr.Code, rr.Body.String())
+	loc, err := url.Parse(rr.Header().Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, "idp.example.com", loc.Host)
+	assert.Equal(t, "1", loc.Query().Get("tenant"))
+
+	deflated, err := base64.StdEncoding.DecodeString(loc.Query().Get("SAMLRequest"))
+	require.NoError(t, err)
+	data, err := io.ReadAll(flate.NewReader(bytes.NewReader(deflated)))
+	require.NoError(t, err)
+	doc := etree.NewDocument()
+	require.NoError(t, doc.ReadFromBytes(data))
+	req := samlNode{doc.Root()}
+	assert.True(t, req.is(nsSAMLProtocol, "AuthnRequest"))
+	assert.Equal(t, testSAMLACS, req.attr("AssertionConsumerServiceURL"))
+	assert.Equal(t, "https://idp.example.com/sso?tenant=1", req.attr("Destination"))
+	assert.Equal(t, "https://remark42.example.com/auth/saml/metadata", req.child(nsSAMLAssertion, "Issuer").text())
+	return loc.Query().Get("RelayState"), req.attr("ID")
+}
+
+func testSAMLPost(form url.Values) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/auth/saml/callback", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req
+}
+
+func testSAML(t *testing.T, cert *x509.Certificate, tokens *mockTokenService) *SAML {
+	s, err := NewSAML(SAMLParams{URL: "https://remark42.example.com", Issuer: "remark42", IdPMetadata: testSAMLMetadata(cert),
+		NameAttr: "displayName", EmailAttr: "email", PictureAttr: "picture", TokenService: tokens})
+	require.NoError(t, err)
+	s.now = func() time.Time { return testSAMLNow }
+	return s
+}
+
+func testSAMLMetadata(cert *x509.Certificate) []byte {
+	return []byte(`<?xml version="1.0"?>
+<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata" xmlns:ds="http://www.w3.org/2000/09/xmldsig#" entityID="` +
+		testSAMLIdP + `">
+  <md:IDPSSODescriptor protocolSupportEnumeration="urn:oasis:names:tc:SAML:2.0:protocol">
+    <md:KeyDescriptor use="signing"><ds:KeyInfo><ds:X509Data><ds:X509Certificate>
+` + base64.StdEncoding.EncodeToString(cert.Raw) + `
+    </ds:X509Certificate></ds:X509Data></ds:KeyInfo></md:KeyDescriptor>
+    <md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST" Location="https://idp.example.com/post"/>
+    <md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect" Location="https://idp.example.com/sso?tenant=1"/>
+  </md:IDPSSODescriptor>
+</md:EntityDescriptor>`)
+}
+
+// testSAMLResponse returns encoded response with assertion signed by the key, replacer applied to assertion before signing
+func testSAMLResponse(t *testing.T, key testKey, reqID string, replacer *strings.Replacer) string {
+	return base64.StdEncoding.EncodeToString(testSAMLResponseXML(t, key, reqID, replacer))
+}
+
+func testSAMLResponseXML(t *testing.T, key testKey, reqID string, replacer *strings.Replacer) []byte {
+	assertion := testSAMLAssertion(reqID)
+	resp := testSAMLResponseDoc(reqID, "%ASSERTION%")
+	if replacer != nil {
+		assertion, resp = replacer.Replace(assertion), replacer.Replace(resp)
+	}
+	return []byte(strings.Replace(resp, "%ASSERTION%", signXML(t, assertion, key), 1))
+}
+
+func testSAMLResponseDoc(reqID, assertion string) string {
+	return `<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ` +
+		`ID="_resp" Version="2.0" IssueInstant="2026-01-02T03:04:00Z" Destination="` + testSAMLACS + `" InResponseTo="` + reqID + `">` +
+		`<saml:Issuer>` + testSAMLIdP + `</saml:Issuer>` +
+		`<samlp:Status><samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Success"/></samlp:Status>` +
+		assertion + `</samlp:Response>`
+}
+
+func testSAMLAssertion(reqID string) string {
+	return `<saml:Assertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="_a1" Version="2.0" IssueInstant="2026-01-02T03:04:00Z">
+  <saml:Issuer>` + testSAMLIdP + `</saml:Issuer>
+  <saml:Subject>
+    <saml:NameID>john@corp.example.com</saml:NameID>
+    <saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer">
+      <saml:SubjectConfirmationData InResponseTo="` + reqID + `" NotOnOrAfter="2026-01-02T03:09:05Z" Recipient="` + testSAMLACS + `"/>
+    </saml:SubjectConfirmation>
+  </saml:Subject>
+  <saml:Conditions NotBefore="2026-01-02T03:03:05Z" NotOnOrAfter="2026-01-02T03:09:05Z">
+    <saml:AudienceRestriction><saml:Audience>https://remark42.example.com/auth/saml/metadata</saml:Audience></saml:AudienceRestriction>
+  </saml:Conditions>
+  <saml:AttributeStatement>
+    <saml:Attribute Name="urn:oid:2.16.840.1.113730.3.1.241" FriendlyName="displayName">
+      <saml:AttributeValue>John Doe</saml:AttributeValue>
+    </saml:Attribute>
+    <saml:Attribute Name="email"><saml:AttributeValue>john.doe@corp.example.com</saml:AttributeValue></saml:Attribute>
+    <saml:Attribute Name="uid"><saml:AttributeValue>jdoe</saml:AttributeValue></saml:Attribute>
+  </saml:AttributeStatement>
+</saml:Assertion>`
+}
+
+// testKey is identity provider's signing key with its certificate
+type testKey struct {
+	crypto.Signer
+	cert *x509.Certificate
+}
+
+// signXML adds enveloped signature to the root element of the document, referencing it by id
+func signXML(t *testing.T, doc string, key testKey) string {
+	d := etree.NewDocument()
+	require.NoError(t, d.ReadFromString(doc))
+	ctx, err := dsig.NewSigningContext(key.Signer, [][]byte{key.cert.Raw})
+	require.NoError(t, err)
+	ctx.Canonicalizer = dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+	signed, err := ctx.SignEnveloped(d.Root())
+	require.NoError(t, err)
+	d.SetRoot(signed)
+	res, err := d.WriteToString()
+	require.NoError(t, err)
+	return res
+}
+
+func testSigningCert(t *testing.T) (testKey, *x509.Certificate) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	cert := testCert(t, key)
+	return testKey{Signer: key, cert: cert}, cert
+}
+
+// testCert makes self-signed certificate valid around the time of test responses
+func testCert(t *testing.T, key crypto.Signer) *x509.Certificate {
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.example.com"},
+		NotBefore:    testSAMLNow.Add(-time.Hour),
+		NotAfter:     testSAMLNow.Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+type mockTokenService struct {
+	claims token.Claims
+	getErr error
+}
+
+func (m *mockTokenService) Parse(string) (token.Claims, error) { return m.claims, nil }
+
+func (m *mockTokenService) Set(_ http.ResponseWriter, claims token.Claims) (token.Claims, error) {
+	m.claims = claims
+	return claims, nil
+}
+
+func (m *mockTokenService) Get(*http.Request) (token.Claims, string, error) {
+	return m.claims, "", m.getErr
+}
+
+func (m *mockTokenService) Reset(http.ResponseWriter) { m.claims = token.Claims{} }
+
+type avatarSaverFunc func(u token.User, client *http.Client) (string, error)
+
+func (f avatarSaverFunc) Put(u token.User, client *http.Client) (string, error) { return f(u, client) }
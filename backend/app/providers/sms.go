@@ -0,0 +1,279 @@
+package providers
+
+// SMS provider, logging users in with one-time code sent to their phone number. It works like email
+// verification: the first login request with user name and phone number sends the code, and the second
+// one with the code and the same number logs the user in. Codes and sent messages are kept in memory.
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha1" //nolint:gosec // used for user id hashing, same as other auth providers
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/go-pkgz/auth/v2/provider"
+	"github.com/go-pkgz/auth/v2/token"
+	log "github.com/go-pkgz/lgr"
+	R "github.com/go-pkgz/rest"
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/umputun/remark42/backend/app/rest"
+)
+
+const (
+	smsCodeLifetime    = 10 * time.Minute // time for user to enter the code
+	smsCodeAttempts    = 5                // wrong codes allowed before the code is dropped
+	smsMaxRequests     = 10000            // max number of pending codes and rate-limited numbers
+	smsDefaultTemplate = "{{.Code}} is your login code for {{.Site}}"
+)
+
+// smsPhone matches phone number in E.164 format
+var smsPhone = regexp.MustCompile(`^\+[1-9]\d{6,14}$`)
+
+// SMSSender delivers text message to the phone number
+type SMSSender interface {
+	Send(ctx context.Context, phone, text string) error
+}
+
+// SMSParams defines parameters of SMS provider
+type SMSParams struct {
+	URL        string        // remark42 url, used to check redirect of the login
+	Issuer     string        // issuer of jwt tokens
+	Sender     SMSSender     // sender of the messages with codes
+	Template   string        // text template of the message with .User, .Code and .Site, default used if empty
+	RateLimit  int           // max messages sent to a phone number during RateWindow, unlimited if 0
+	RateWindow time.Duration // window of rate limit, one hour if 0
+
+	TokenService         provider.TokenService
+	AvatarSaver          provider.AvatarSaver
+	AllowedRedirectHosts token.AllowedHosts
+}
+
+// SMS implements login with one-time code sent by SMS as auth provider with login and logout handlers
+type SMS struct {
+	SMSParams
+	now  func() time.Time
+	tmpl *template.Template
+
+	requests *pendingStore[*smsRequest] // pending codes by phone number
+	sent     struct {
+		sync.Mutex
+		data map[string][]time.Time // times of messages sent by phone number
+	}
+}
+
+// smsRequest is pending login request waiting for the code
+type smsRequest struct {
+	user     string
+	code     string
+	aud      string
+	from     string
+	session  bool
+	attempts int
+	expires  time.Time
+}
+
+// NewSMS makes SMS provider
+func NewSMS(params SMSParams) (*SMS, error) {
+	if params.Sender == nil {
+		return nil, errors.New("no sms sender")
+	}
+	if params.Template == "" {
+		params.Template = smsDefaultTemplate
+	}
+	tmpl, err := template.New("sms").Parse(params.Template)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse sms template: %w", err)
+	}
+	if params.RateWindow <= 0 {
+		params.RateWindow = time.Hour
+	}
+	params.URL = strings.TrimSuffix(params.URL, "/")
+	res := &SMS{SMSParams: params, now: time.Now, tmpl: tmpl}
+	res.requests = newPendingStore(smsMaxRequests, errTooManyRequests, func(r *smsRequest) time.Time { return r.expires })
+	res.sent.data = map[string][]time.Time{}
+	return res, nil
+}
+
+// Name returns provider name
+func (s *SMS) Name() string { return "sms" }
+
+// LoginHandler sends the code to the phone number if there is no code in the request, and logs the user in otherwise.
+// GET /login?site=site&user=name&address=+15551234567 sends the code,
+// GET /login?address=+15551234567&token=123456 checks it.
+func (s *SMS) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("token") == "" {
+		s.sendCode(w, r)
+		return
+	}
+
+	phone := normalizePhone(r.URL.Query().Get("address"))
+	req, err := s.checkCode(phone, r.URL.Query().Get("token"))
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, err, "failed to verify code", rest.ErrNoAccess)
+		return
+	}
+
+	u := token.User{ID: "sms_" + token.HashID(sha1.New(), phone), Name: req.user}
+	if s.AvatarSaver != nil {
+		if u.Picture, err = s.AvatarSaver.Put(u, nil); err != nil {
+			rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "failed to save avatar to proxy", rest.ErrInternal)
+			return
+		}
+	}
+
+	claims := token.Claims{
+		User: &u,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:   s.Issuer,
+			ID:       randomID(),
+			Audience: []string{req.aud},
+		},
+		SessionOnly:  req.session || r.URL.Query().Get("sess") == "1",
+		AuthProvider: &token.AuthProvider{Name: s.Name()},
+	}
+	if _, err = s.TokenService.Set(w, claims); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "failed to set token", rest.ErrInternal)
+		return
+	}
+	log.Printf("[DEBUG] sms login of user %s", u.ID)
+
+	if req.from != "" && allowedRedirect(s.URL, s.AllowedRedirectHosts, req.from) {
+		http.Redirect(w, r, req.from, http.StatusTemporaryRedirect)
+		return
+	}
+	R.RenderJSON(w, &u)
+}
+
+// AuthHandler does nothing, there is no callback in sms login
+func (s *SMS) AuthHandler(http.ResponseWriter, *http.Request) {}
+
+// LogoutHandler resets the token
+func (s *SMS) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if _, _, err := s.TokenService.Get(r); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, err, "logout not allowed", rest.ErrNoAccess)
+		return
+	}
+	s.TokenService.Reset(w)
+}
+
+// sendCode makes the code for the phone number and sends it, the previous code of the number is replaced
+func (s *SMS) sendCode(w http.ResponseWriter, r *http.Request) {
+	user := strings.TrimSpace(r.URL.Query().Get("user"))
+	phone := normalizePhone(r.URL.Query().Get("address"))
+	if user == "" || len(user) > 64 || !smsPhone.MatchString(phone) {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, errors.New("wrong request"), "can't get user and phone number",
+			rest.ErrDecode)
+		return
+	}
+	if err := s.allowSend(phone); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusTooManyRequests, err, "can't send code", rest.ErrActionRejected)
+		return
+	}
+
+	aud := r.URL.Query().Get("site") // legacy, for back compat
+	if aud == "" {
+		aud = r.URL.Query().Get("aud")
+	}
+	req := &smsRequest{
+		user:    user,
+		code:    randomCode(),
+		aud:     aud,
+		from:    r.URL.Query().Get("from"),
+		session: r.URL.Query().Get("session") != "" && r.URL.Query().Get("session") != "0",
+		expires: s.now().Add(smsCodeLifetime),
+	}
+
+	buf := bytes.Buffer{}
+	tmplData := struct{ User, Code, Site string }{User: user, Code: req.code, Site: aud}
+	if err := s.tmpl.Execute(&buf, tmplData); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't execute sms template", rest.ErrInternal)
+		return
+	}
+	if err := s.requests.add(phone, req, s.now()); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusTooManyRequests, err, "can't send code", rest.ErrActionRejected)
+		return
+	}
+	if err := s.Sender.Send(r.Context(), phone, buf.String()); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "failed to send code", rest.ErrInternal)
+		return
+	}
+	R.RenderJSON(w, R.JSON{"user": user, "address": phone})
+}
+
+// allowSend records the message to the phone number, or rejects it if the number is over the rate limit
+func (s *SMS) allowSend(phone string) error {
+	if s.RateLimit <= 0 {
+		return nil
+	}
+	s.sent.Lock()
+	defer s.sent.Unlock()
+	now := s.now()
+	cutoff := now.Add(-s.RateWindow)
+	if len(s.sent.data) >= smsMaxRequests {
+		for k, v := range s.sent.data {
+			if v[len(v)-1].Before(cutoff) {
+				delete(s.sent.data, k)
+			}
+		}
+	}
+	times := s.sent.data[phone]
+	for len(times) > 0 && times[0].Before(cutoff) {
+		times = times[1:]
+	}
+	if len(times) >= s.RateLimit {
+		s.sent.data[phone] = times
+		return fmt.Errorf("too many codes sent to the phone number, limit is %d per %v", s.RateLimit, s.RateWindow)
+	}
+	if len(s.sent.data) >= smsMaxRequests && len(times) == 0 {
+		return errors.New("too many phone numbers")
+	}
+	s.sent.data[phone] = append(times, now)
+	return nil
+}
+
+// checkCode returns pending request of the phone number if the code matches it. The request is removed on success,
+// on expiration and after too many wrong codes, so the code can't be used twice or guessed.
+func (s *SMS) checkCode(phone, code string) (res smsRequest, err error) {
+	now := s.now()
+	s.requests.update(phone, func(req *smsRequest, found bool) bool {
+		switch {
+		case !found:
+			err = errors.New("no code sent to the phone number")
+			return false
+		case now.After(req.expires):
+			err = errors.New("code expired")
+			return false
+		case subtle.ConstantTimeCompare([]byte(req.code), []byte(strings.TrimSpace(code))) != 1:
+			req.attempts++
+			err = errors.New("wrong code")
+			return req.attempts < smsCodeAttempts
+		}
+		res = *req
+		return false
+	})
+	return res, err
+}
+
+// normalizePhone removes spaces, dashes, dots and parentheses people use to format phone numbers
+func normalizePhone(phone string) string {
+	return strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "").Replace(strings.TrimSpace(phone))
+}
+
+// randomCode makes six-digit code
+func randomCode() string {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return randomID()[:6] // never happens, crypto/rand doesn't fail
+	}
+	return fmt.Sprintf("%06d", n.Int64())
+}
@@ -0,0 +1,196 @@
+package providers
+
+import (
+	"context"
+	"crypto/sha1" //nolint:gosec // same hashing of user id as in provider
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/go-pkgz/auth/v2/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSMS(t *testing.T) {
+	s, err := NewSMS(SMSParams{URL: "https://remark42.example.com/", Sender: &mockSMSSender{}})
+	require.NoError(t, err)
+	assert.Equal(t, "sms", s.Name())
+	assert.Equal(t, "https://remark42.example.com", s.URL)
+	assert.Equal(t, time.Hour, s.RateWindow)
+
+	_, err = NewSMS(SMSParams{URL: "https://remark42.example.com"})
+	assert.EqualError(t, err, "no sms sender")
+
+	_, err = NewSMS(SMSParams{Sender: &mockSMSSender{}, Template: "{{.Code"})
+	assert.ErrorContains(t, err, "can't parse sms template")
+}
+
+func TestSMS_Login(t *testing.T) {
+	sender := &mockSMSSender{}
+	tokens := &mockTokenService{}
+	s, err := NewSMS(SMSParams{URL: "https://remark42.example.com", Issuer: "remark42", Sender: sender,
+		Template: "{{.User}}, code {{.Code}} for {{.Site}}", TokenService: tokens})
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	s.LoginHandler(rr, httptest.NewRequest("GET", "/auth/sms/login?site=remark&user=dev&address=%2B1+(555)+123-4567", http.NoBody))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.JSONEq(t, `{"user":"dev","address":"+15551234567"}`, rr.Body.String())
+	require.Len(t, sender.sent, 1)
+	assert.Equal(t, "+15551234567", sender.sent[0].phone)
+	m := regexp.MustCompile(`^dev, code (\d{6}) for remark$`).FindStringSubmatch(sender.sent[0].text)
+	require.NotNil(t, m, sender.sent[0].text)
+
+	rr = httptest.NewRecorder()
+	s.LoginHandler(rr, httptest.NewRequest("GET", "/auth/sms/login?address=%2B15551234567&token="+m[1], http.NoBody))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	u := token.User{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &u))
+	assert.Equal(t, token.User{ID: "sms_" + token.HashID(sha1.New(), "+15551234567"), Name: "dev"}, u)
+	assert.Equal(t, []string{"remark"}, []string(tokens.claims.Audience))
+	assert.Equal(t, "sms", tokens.claims.AuthProvider.Name)
+	assert.False(t, tokens.claims.SessionOnly)
+
+	// code can't be used twice
+	rr = httptest.NewRecorder()
+	s.LoginHandler(rr, httptest.NewRequest("GET", "/auth/sms/login?address=%2B15551234567&token="+m[1], http.NoBody))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+}
+
+func TestSMS_LoginRedirect(t *testing.T) {
+	sender := &mockSMSSender{}
+	s, err := NewSMS(SMSParams{URL: "https://remark42.example.com", Sender: sender, TokenService: &mockTokenService{},
+		AllowedRedirectHosts: token.AllowedHostsFunc(func() ([]string, error) { return []string{"blog.example.com"}, nil })})
+	require.NoError(t, err)
+
+	for _, tc := range []struct{ from, location string }{
+		{from: "https://blog.example.com/post", location: "https://blog.example.com/post"},
+		{from: "https://evil.example.com/post", location: ""},
+	} {
+		sender.sent = nil
+		rr := httptest.NewRecorder()
+		s.LoginHandler(rr, httptest.NewRequest("GET", "/auth/sms/login?site=remark&user=dev&address=%2B15551234567&from="+
+			tc.from, http.NoBody))
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		code := regexp.MustCompile(`\d{6}`).FindString(sender.sent[0].text)
+
+		rr = httptest.NewRecorder()
+		s.LoginHandler(rr, httptest.NewRequest("GET", "/auth/sms/login?address=%2B15551234567&token="+code, http.NoBody))
+		assert.Equal(t, tc.location, rr.Header().Get("Location"))
+	}
+}
+
+func TestSMS_LoginRejected(t *testing.T) {
+	sender := &mockSMSSender{}
+	s, err := NewSMS(SMSParams{Sender: sender, TokenService: &mockTokenService{}})
+	require.NoError(t, err)
+
+	for _, q := range []string{"user=dev", "user=dev&address=15551234567", "address=%2B15551234567", "user=dev&address=%2B123"} {
+		rr := httptest.NewRecorder()
+		s.LoginHandler(rr, httptest.NewRequest("GET", "/auth/sms/login?"+q, http.NoBody))
+		assert.Equal(t, http.StatusBadRequest, rr.Code, q)
+	}
+	assert.Empty(t, sender.sent)
+
+	rr := httptest.NewRecorder()
+	s.LoginHandler(rr, httptest.NewRequest("GET", "/auth/sms/login?address=%2B15551234567&token=123456", http.NoBody))
+	assert.Equal(t, http.StatusForbidden, rr.Code, "no code sent")
+
+	sender.err = errors.New("gateway down")
+	rr = httptest.NewRecorder()
+	s.LoginHandler(rr, httptest.NewRequest("GET", "/auth/sms/login?user=dev&address=%2B15551234567", http.NoBody))
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+}
+
+func TestSMS_CheckCode(t *testing.T) {
+	s, err := NewSMS(SMSParams{Sender: &mockSMSSender{}})
+	require.NoError(t, err)
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	require.NoError(t, s.requests.add("+15551234567", &smsRequest{user: "dev", code: "123456", expires: now.Add(time.Minute)}, now))
+	for range smsCodeAttempts - 1 {
+		_, err = s.checkCode("+15551234567", "000000")
+		assert.EqualError(t, err, "wrong code")
+	}
+	req, err := s.checkCode("+15551234567", " 123456 ")
+	require.NoError(t, err)
+	assert.Equal(t, "dev", req.user)
+
+	// code dropped after too many wrong attempts
+	require.NoError(t, s.requests.add("+15551234567", &smsRequest{code: "123456", expires: now.Add(time.Minute)}, now))
+	for range smsCodeAttempts {
+		_, err = s.checkCode("+15551234567", "000000")
+		assert.EqualError(t, err, "wrong code")
+	}
+	_, err = s.checkCode("+15551234567", "123456")
+	assert.EqualError(t, err, "no code sent to the phone number")
+
+	require.NoError(t, s.requests.add("+15551234567", &smsRequest{code: "123456", expires: now.Add(-time.Second)}, now))
+	_, err = s.checkCode("+15551234567", "123456")
+	assert.EqualError(t, err, "code expired")
+}
+
+func TestSMS_RateLimit(t *testing.T) {
+	sender := &mockSMSSender{}
+	s, err := NewSMS(SMSParams{Sender: sender, RateLimit: 2, TokenService: &mockTokenService{}})
+	require.NoError(t, err)
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	send := func(phone string) int {
+		rr := httptest.NewRecorder()
+		s.LoginHandler(rr, httptest.NewRequest("GET", "/auth/sms/login?user=dev&address="+phone, http.NoBody))
+		return rr.Code
+	}
+	assert.Equal(t, http.StatusOK, send("%2B15551234567"))
+	now = now.Add(10 * time.Minute)
+	assert.Equal(t, http.StatusOK, send("%2B15551234567"))
+	assert.Equal(t, http.StatusTooManyRequests, send("%2B15551234567"))
+	assert.Equal(t, http.StatusOK, send("%2B15557654321"), "other number not limited")
+	assert.Len(t, sender.sent, 3)
+
+	now = now.Add(51 * time.Minute) // first message out of the window
+	assert.Equal(t, http.StatusOK, send("%2B15551234567"))
+	assert.Equal(t, http.StatusTooManyRequests, send("%2B15551234567"))
+}
+
+func TestSMS_Logout(t *testing.T) {
+	tokens := &mockTokenService{claims: token.Claims{User: &token.User{ID: "sms_123"}}}
+	s, err := NewSMS(SMSParams{Sender: &mockSMSSender{}, TokenService: tokens})
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	s.LogoutHandler(rr, httptest.NewRequest("GET", "/auth/sms/logout", http.NoBody))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Nil(t, tokens.claims.User)
+
+	tokens.getErr = errors.New("no token")
+	rr = httptest.NewRecorder()
+	s.LogoutHandler(rr, httptest.NewRequest("GET", "/auth/sms/logout", http.NoBody))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+}
+
+func TestRandomCode(t *testing.T) {
+	for range 100 {
+		assert.Regexp(t, `^\d{6}$`, randomCode())
+	}
+}
+
+type mockSMSSender struct {
+	sent []struct{ phone, text string }
+	err  error
+}
+
+func (m *mockSMSSender) Send(_ context.Context, phone, text string) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.sent = append(m.sent, struct{ phone, text string }{phone: phone, text: text})
+	return nil
+}
@@ -0,0 +1,161 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	twilioAPIURL       = "https://api.twilio.com/2010-04-01"
+	vonageAPIURL       = "https://rest.nexmo.com/sms/json"
+	smsMaxResponseSize = 64 * 1024 // max size of sms api response
+)
+
+// TwilioSMS sends messages with Twilio Programmable Messaging API
+type TwilioSMS struct {
+	AccountSID string
+	AuthToken  string
+	From       string       // sender phone number or messaging service sid
+	Client     *http.Client // client of api requests, with 10s timeout if nil
+	apiURL     string
+}
+
+// Send sends the message to the phone number
+func (t *TwilioSMS) Send(ctx context.Context, phone, text string) error {
+	form := url.Values{"To": {phone}, "Body": {text}}
+	if strings.HasPrefix(t.From, "MG") {
+		form.Set("MessagingServiceSid", t.From)
+	} else {
+		form.Set("From", t.From)
+	}
+	apiURL := t.apiURL
+	if apiURL == "" {
+		apiURL = twilioAPIURL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		apiURL+"/Accounts/"+url.PathEscape(t.AccountSID)+"/Messages.json", strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("can't make twilio request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(t.AccountSID, t.AuthToken)
+	return smsDo(t.Client, req, "twilio", nil)
+}
+
+// VonageSMS sends messages with Vonage (Nexmo) SMS API
+type VonageSMS struct {
+	APIKey    string
+	APISecret string
+	From      string       // sender phone number or alphanumeric sender id
+	Client    *http.Client // client of api requests, with 10s timeout if nil
+	apiURL    string
+}
+
+// Send sends the message to the phone number
+func (v *VonageSMS) Send(ctx context.Context, phone, text string) error {
+	form := url.Values{
+		"api_key":    {v.APIKey},
+		"api_secret": {v.APISecret},
+		"from":       {v.From},
+		"to":         {strings.TrimPrefix(phone, "+")},
+		"text":       {text},
+		"type":       {"unicode"},
+	}
+	apiURL := v.apiURL
+	if apiURL == "" {
+		apiURL = vonageAPIURL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("can't make vonage request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	// vonage responds with 200 on failed messages as well, status of each message part is in the body
+	return smsDo(v.Client, req, "vonage", func(body []byte) error {
+		resp := struct {
+			Messages []struct {
+				Status    string `json:"status"`
+				ErrorText string `json:"error-text"`
+			} `json:"messages"`
+		}{}
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return fmt.Errorf("can't decode vonage response: %w", err)
+		}
+		if len(resp.Messages) == 0 {
+			return errors.New("no messages in vonage response")
+		}
+		for _, m := range resp.Messages {
+			if m.Status != "0" {
+				return fmt.Errorf("vonage rejected message with status %s: %s", m.Status, m.ErrorText)
+			}
+		}
+		return nil
+	})
+}
+
+// WebhookSMS sends messages as JSON with "to" and "text" fields posted to the URL,
+// for SMS gateways without dedicated sender
+type WebhookSMS struct {
+	URL     string
+	Headers []string     // extra headers of the request, as Name:Value
+	Client  *http.Client // client of webhook requests, with 10s timeout if nil
+}
+
+// Send sends the message to the phone number
+func (h *WebhookSMS) Send(ctx context.Context, phone, text string) error {
+	body, err := json.Marshal(struct {
+		To   string `json:"to"`
+		Text string `json:"text"`
+	}{To: phone, Text: text})
+	if err != nil {
+		return fmt.Errorf("can't marshal sms webhook request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("can't make sms webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for _, hdr := range h.Headers {
+		name, value, ok := strings.Cut(hdr, ":")
+		if !ok {
+			return fmt.Errorf("bad sms webhook header %q", hdr)
+		}
+		req.Header.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	return smsDo(h.Client, req, "sms webhook", nil)
+}
+
+// smsDo makes the request to sms api and checks the response status, and the body with check func if it's set
+func smsDo(client *http.Client, req *http.Request, name string, check func(body []byte) error) error {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s request failed: %w", name, err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // nothing to do with the error
+	body, err := io.ReadAll(io.LimitReader(resp.Body, smsMaxResponseSize))
+	if err != nil {
+		return fmt.Errorf("can't read %s response: %w", name, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		if msg := strings.TrimSpace(string(body)); msg != "" {
+			return fmt.Errorf("%s responded with status %d: %s", name, resp.StatusCode, msg)
+		}
+		return fmt.Errorf("%s responded with status %d", name, resp.StatusCode)
+	}
+	if check != nil {
+		return check(body)
+	}
+	return nil
+}
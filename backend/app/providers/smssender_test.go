@@ -0,0 +1,97 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTwilioSMS_Send(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/Accounts/AC123/Messages.json", r.URL.Path)
+		user, passwd, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "AC123", user)
+		if passwd != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"code":20003,"message":"Authenticate"}`))
+			return
+		}
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "+15551234567", r.PostForm.Get("To"))
+		assert.Equal(t, "code 123456", r.PostForm.Get("Body"))
+		assert.Equal(t, "+15550000000", r.PostForm.Get("From"))
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer ts.Close()
+
+	s := &TwilioSMS{AccountSID: "AC123", AuthToken: "secret", From: "+15550000000", apiURL: ts.URL}
+	require.NoError(t, s.Send(context.Background(), "+15551234567", "code 123456"))
+
+	s.AuthToken = "bad"
+	err := s.Send(context.Background(), "+15551234567", "code 123456")
+	assert.EqualError(t, err, `twilio responded with status 401: {"code":20003,"message":"Authenticate"}`)
+}
+
+func TestTwilioSMS_SendMessagingService(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "MG123", r.PostForm.Get("MessagingServiceSid"))
+		assert.Empty(t, r.PostForm.Get("From"))
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer ts.Close()
+
+	s := &TwilioSMS{AccountSID: "AC123", AuthToken: "secret", From: "MG123", apiURL: ts.URL}
+	require.NoError(t, s.Send(context.Background(), "+15551234567", "code 123456"))
+}
+
+func TestVonageSMS_Send(t *testing.T) {
+	status := "0"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "key", r.PostForm.Get("api_key"))
+		assert.Equal(t, "secret", r.PostForm.Get("api_secret"))
+		assert.Equal(t, "remark42", r.PostForm.Get("from"))
+		assert.Equal(t, "15551234567", r.PostForm.Get("to"))
+		assert.Equal(t, "code 123456", r.PostForm.Get("text"))
+		_, _ = w.Write([]byte(`{"message-count":"1","messages":[{"status":"` + status + `","error-text":"Throttled"}]}`))
+	}))
+	defer ts.Close()
+
+	s := &VonageSMS{APIKey: "key", APISecret: "secret", From: "remark42", apiURL: ts.URL}
+	require.NoError(t, s.Send(context.Background(), "+15551234567", "code 123456"))
+
+	status = "1"
+	err := s.Send(context.Background(), "+15551234567", "code 123456")
+	assert.EqualError(t, err, "vonage rejected message with status 1: Throttled")
+}
+
+func TestWebhookSMS_Send(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		req := struct{ To, Text string }{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "+15551234567", req.To)
+		if req.Text == "fail" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		assert.Equal(t, "code 123456", req.Text)
+	}))
+	defer ts.Close()
+
+	s := &WebhookSMS{URL: ts.URL, Headers: []string{"Authorization: Bearer token"}}
+	require.NoError(t, s.Send(context.Background(), "+15551234567", "code 123456"))
+	assert.EqualError(t, s.Send(context.Background(), "+15551234567", "fail"), "sms webhook responded with status 502")
+
+	s.Headers = []string{"bad header"}
+	assert.EqualError(t, s.Send(context.Background(), "+15551234567", "code 123456"), `bad sms webhook header "bad header"`)
+}
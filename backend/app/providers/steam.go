@@ -0,0 +1,286 @@
+package providers
+
+// Steam provider, logging users in with OpenID 2.0 of Steam community. The assertion of Steam is
+// verified by Steam itself with check_authentication request, persona name and avatar of the
+// user are loaded with Steam Web API.
+
+import (
+	"bufio"
+	"crypto/sha1" //nolint:gosec // used for user id hashing, same as other auth providers
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-pkgz/auth/v2/provider"
+	"github.com/go-pkgz/auth/v2/token"
+	log "github.com/go-pkgz/lgr"
+	R "github.com/go-pkgz/rest"
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/umputun/remark42/backend/app/rest"
+)
+
+const (
+	steamOpenIDURL        = "https://steamcommunity.com/openid/login"
+	steamSummariesURL     = "https://api.steampowered.com/ISteamUser/GetPlayerSummaries/v0002/"
+	steamOpenIDNS         = "http://specs.openid.net/auth/2.0"
+	steamIdentifierSelect = "http://specs.openid.net/auth/2.0/identifier_select"
+	steamRequestLifetime  = 30 * time.Minute // time for user to log in on steam
+	steamMaxRequests      = 10000            // max number of pending login requests
+	steamMaxResponseSize  = 1024 * 1024      // max size of steam's response
+)
+
+// steamClaimedID matches claimed id of steam user with SteamID64
+var steamClaimedID = regexp.MustCompile(`^https://steamcommunity\.com/openid/id/(7656119\d{10})$`)
+
+// SteamParams defines parameters of Steam provider
+type SteamParams struct {
+	URL    string       // remark42 url, callback is at URL/auth/steam/callback
+	Issuer string       // issuer of jwt tokens
+	APIKey string       // Steam Web API key to get persona name and avatar of the user
+	Client *http.Client // client of steam requests, with 10s timeout if nil
+
+	TokenService         provider.TokenService
+	AvatarSaver          provider.AvatarSaver
+	AllowedRedirectHosts token.AllowedHosts
+}
+
+// Steam implements OpenID 2.0 login with Steam as auth provider with login, callback and logout handlers.
+// Pending login requests are kept in memory.
+type Steam struct {
+	SteamParams
+	now          func() time.Time
+	openIDURL    string
+	summariesURL string
+
+	requests *pendingStore[steamRequest]
+}
+
+// steamRequest is pending login request
+type steamRequest struct {
+	from    string
+	aud     string
+	session bool
+	noAva   bool
+	expires time.Time
+}
+
+// steamPlayer is the part of player summary used to make the user
+type steamPlayer struct {
+	SteamID     string `json:"steamid"`
+	PersonaName string `json:"personaname"`
+	AvatarFull  string `json:"avatarfull"`
+}
+
+// NewSteam makes Steam provider
+func NewSteam(params SteamParams) (*Steam, error) {
+	if params.APIKey == "" {
+		return nil, errors.New("no steam web api key")
+	}
+	params.URL = strings.TrimSuffix(params.URL, "/")
+	if params.Client == nil {
+		params.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	res := &Steam{SteamParams: params, now: time.Now, openIDURL: steamOpenIDURL, summariesURL: steamSummariesURL}
+	res.requests = newPendingStore(steamMaxRequests, errTooManyRequests, func(r steamRequest) time.Time { return r.expires })
+	return res, nil
+}
+
+// Name returns provider name
+func (s *Steam) Name() string { return "steam" }
+
+func (s *Steam) callbackURL() string { return s.URL + "/auth/steam/callback" }
+
+// LoginHandler redirects to the login page of Steam
+func (s *Steam) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	aud := r.URL.Query().Get("site") // legacy, for back compat
+	if aud == "" {
+		aud = r.URL.Query().Get("aud")
+	}
+	req := steamRequest{
+		from:    r.URL.Query().Get("from"),
+		aud:     aud,
+		session: r.URL.Query().Get("session") != "" && r.URL.Query().Get("session") != "0",
+		noAva:   r.URL.Query().Get("noava") == "1",
+		expires: s.now().Add(steamRequestLifetime),
+	}
+	state := randomID()
+	if err := s.requests.add(state, req, s.now()); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusTooManyRequests, err, "can't start steam login", rest.ErrActionRejected)
+		return
+	}
+
+	q := url.Values{
+		"openid.ns":         {steamOpenIDNS},
+		"openid.mode":       {"checkid_setup"},
+		"openid.return_to":  {s.returnTo(state)},
+		"openid.realm":      {s.URL},
+		"openid.identity":   {steamIdentifierSelect},
+		"openid.claimed_id": {steamIdentifierSelect},
+	}
+	http.Redirect(w, r, s.openIDURL+"?"+q.Encode(), http.StatusFound)
+}
+
+// AuthHandler handles callback from Steam, verifies the assertion and sets the token
+func (s *Steam) AuthHandler(w http.ResponseWriter, r *http.Request) {
+	state := r.URL.Query().Get("state")
+	req, ok := s.requests.take(state, s.now())
+	if !ok {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, errors.New("unknown state"), "unknown or expired login request",
+			rest.ErrNoAccess)
+		return
+	}
+
+	steamID, err := s.verify(r.URL.Query(), state)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, err, "can't verify steam login", rest.ErrNoAccess)
+		return
+	}
+	player, err := s.player(steamID)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, err, "can't get steam player", rest.ErrNoAccess)
+		return
+	}
+	u := steamUser(player)
+
+	if req.noAva {
+		u.Picture = "" // reset picture on no avatar request
+	}
+	if s.AvatarSaver != nil {
+		if u.Picture, err = s.AvatarSaver.Put(u, s.Client); err != nil {
+			rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "failed to save avatar to proxy", rest.ErrInternal)
+			return
+		}
+	}
+
+	claims := token.Claims{
+		User: &u,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:   s.Issuer,
+			ID:       randomID(),
+			Audience: []string{req.aud},
+		},
+		SessionOnly:  req.session,
+		NoAva:        req.noAva,
+		AuthProvider: &token.AuthProvider{Name: s.Name()},
+	}
+	if _, err = s.TokenService.Set(w, claims); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "failed to set token", rest.ErrInternal)
+		return
+	}
+	log.Printf("[DEBUG] steam login of user %s", u.ID)
+
+	if req.from != "" && allowedRedirect(s.URL, s.AllowedRedirectHosts, req.from) {
+		http.Redirect(w, r, req.from, http.StatusSeeOther)
+		return
+	}
+	R.RenderJSON(w, &u)
+}
+
+// LogoutHandler resets the token
+func (s *Steam) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if _, _, err := s.TokenService.Get(r); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, err, "logout not allowed", rest.ErrNoAccess)
+		return
+	}
+	s.TokenService.Reset(w)
+}
+
+func (s *Steam) returnTo(state string) string {
+	return s.callbackURL() + "?" + url.Values{"state": {state}}.Encode()
+}
+
+// verify checks the positive assertion is made by Steam for this login request and returns SteamID64 of the user.
+// Fields identifying the user and the request should be signed, the signature is checked by Steam.
+func (s *Steam) verify(q url.Values, state string) (string, error) {
+	if mode := q.Get("openid.mode"); mode != "id_res" {
+		return "", fmt.Errorf("unexpected mode %q", mode)
+	}
+	if q.Get("openid.ns") != steamOpenIDNS || q.Get("openid.op_endpoint") != s.openIDURL {
+		return "", errors.New("not a steam assertion")
+	}
+	if q.Get("openid.return_to") != s.returnTo(state) {
+		return "", errors.New("return_to mismatch")
+	}
+	m := steamClaimedID.FindStringSubmatch(q.Get("openid.claimed_id"))
+	if m == nil || q.Get("openid.identity") != q.Get("openid.claimed_id") {
+		return "", fmt.Errorf("bad claimed id %q", q.Get("openid.claimed_id"))
+	}
+	signed := strings.Split(q.Get("openid.signed"), ",")
+	for _, f := range []string{"op_endpoint", "claimed_id", "identity", "return_to", "response_nonce"} {
+		if !slices.Contains(signed, f) {
+			return "", fmt.Errorf("%s is not signed", f)
+		}
+	}
+
+	form := url.Values{}
+	for k, v := range q {
+		if strings.HasPrefix(k, "openid.") {
+			form[k] = v
+		}
+	}
+	form.Set("openid.mode", "check_authentication")
+	resp, err := s.Client.PostForm(s.openIDURL, form)
+	if err != nil {
+		return "", fmt.Errorf("can't check authentication: %w", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // nothing to do with the error
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("check authentication responded with status %d", resp.StatusCode)
+	}
+	// response is in key-value form, one key:value per line
+	scanner := bufio.NewScanner(io.LimitReader(resp.Body, steamMaxResponseSize))
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == "is_valid:true" {
+			return m[1], nil
+		}
+	}
+	return "", errors.New("assertion is not valid")
+}
+
+// player gets summary of the player with Steam Web API
+func (s *Steam) player(steamID string) (steamPlayer, error) {
+	q := url.Values{"key": {s.APIKey}, "steamids": {steamID}}
+	resp, err := s.Client.Get(s.summariesURL + "?" + q.Encode())
+	if err != nil {
+		return steamPlayer{}, fmt.Errorf("can't get player summary: %w", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // nothing to do with the error
+	if resp.StatusCode != http.StatusOK {
+		return steamPlayer{}, fmt.Errorf("player summary responded with status %d", resp.StatusCode)
+	}
+	res := struct {
+		Response struct {
+			Players []steamPlayer `json:"players"`
+		} `json:"response"`
+	}{}
+	if err = json.NewDecoder(io.LimitReader(resp.Body, steamMaxResponseSize)).Decode(&res); err != nil {
+		return steamPlayer{}, fmt.Errorf("can't decode player summary: %w", err)
+	}
+	for _, p := range res.Response.Players {
+		if p.SteamID == steamID {
+			return p, nil
+		}
+	}
+	return steamPlayer{}, fmt.Errorf("no summary of player %s", steamID)
+}
+
+// steamUser makes the user from the player summary, id of the user made from SteamID64
+func steamUser(p steamPlayer) token.User {
+	u := token.User{
+		ID:      "steam_" + token.HashID(sha1.New(), p.SteamID),
+		Name:    strings.TrimSpace(p.PersonaName),
+		Picture: p.AvatarFull,
+	}
+	if u.Name == "" {
+		u.Name = "noname_" + u.ID[6:10]
+	}
+	return u
+}
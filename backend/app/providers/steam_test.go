@@ -0,0 +1,219 @@
+package providers
+
+import (
+	"crypto/sha1" //nolint:gosec // same hashing of user id as in provider
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-pkgz/auth/v2/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSteamID = "76561197960287930"
+
+func TestNewSteam(t *testing.T) {
+	s, err := NewSteam(SteamParams{URL: "https://remark42.example.com/", APIKey: "key"})
+	require.NoError(t, err)
+	assert.Equal(t, "steam", s.Name())
+	assert.Equal(t, "https://remark42.example.com/auth/steam/callback", s.callbackURL())
+	assert.NotNil(t, s.Client)
+
+	_, err = NewSteam(SteamParams{URL: "https://remark42.example.com"})
+	assert.EqualError(t, err, "no steam web api key")
+}
+
+func TestSteam_LoginAndCallback(t *testing.T) {
+	var checked int32
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/openid/login":
+			atomic.AddInt32(&checked, 1)
+			require.NoError(t, r.ParseForm())
+			assert.Equal(t, "check_authentication", r.PostForm.Get("openid.mode"))
+			if r.PostForm.Get("openid.sig") != "good-sig" {
+				_, _ = w.Write([]byte("ns:http://specs.openid.net/auth/2.0\nis_valid:false\n"))
+				return
+			}
+			_, _ = w.Write([]byte("ns:http://specs.openid.net/auth/2.0\nis_valid:true\n"))
+		case "/summaries":
+			assert.Equal(t, "api-key", r.URL.Query().Get("key"))
+			_, _ = fmt.Fprintf(w, `{"response":{"players":[{"steamid":%q,"personaname":"Gabe ",
+				"avatarfull":"https://avatars.steamstatic.com/full.jpg"}]}}`, r.URL.Query().Get("steamids"))
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+	}))
+	defer ts.Close()
+
+	tokens := &mockTokenService{}
+	s := testSteam(t, ts, tokens)
+	s.AvatarSaver = avatarSaverFunc(func(u token.User, client *http.Client) (string, error) {
+		assert.Equal(t, "https://avatars.steamstatic.com/full.jpg", u.Picture)
+		assert.NotNil(t, client)
+		return "https://remark42.example.com/api/v1/avatar/" + u.ID + ".image", nil
+	})
+
+	state := testSteamLogin(t, s, "from=https%3A%2F%2Fblog.example.com%2Fpost&site=remark&session=1")
+	rr := httptest.NewRecorder()
+	s.AuthHandler(rr, testSteamCallback(s, state, "good-sig", nil))
+	require.Equal(t, http.StatusSeeOther, rr.Code, rr.Body.String())
+	assert.Equal(t, "https://blog.example.com/post", rr.Header().Get("Location"))
+
+	userID := "steam_" + token.HashID(sha1.New(), testSteamID)
+	require.NotNil(t, tokens.claims.User)
+	assert.Equal(t, token.User{ID: userID, Name: "Gabe",
+		Picture: "https://remark42.example.com/api/v1/avatar/" + userID + ".image"}, *tokens.claims.User)
+	assert.Equal(t, []string{"remark"}, []string(tokens.claims.Audience))
+	assert.True(t, tokens.claims.SessionOnly)
+	assert.Equal(t, "steam", tokens.claims.AuthProvider.Name)
+
+	// state can't be used twice
+	rr = httptest.NewRecorder()
+	s.AuthHandler(rr, testSteamCallback(s, state, "good-sig", nil))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "unknown or expired login request")
+
+	// signature rejected by steam
+	state = testSteamLogin(t, s, "site=remark")
+	rr = httptest.NewRecorder()
+	s.AuthHandler(rr, testSteamCallback(s, state, "bad-sig", nil))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "can't verify steam login")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&checked))
+
+	// assertion checked before asking steam
+	tbl := []struct {
+		name string
+		set  url.Values
+	}{
+		{"mode", url.Values{"openid.mode": {"cancel"}}},
+		{"endpoint", url.Values{"openid.op_endpoint": {"https://evil.example.com/openid/login"}}},
+		{"return to", url.Values{"openid.return_to": {"https://remark42.example.com/auth/steam/callback?state=other"}}},
+		{"claimed id", url.Values{"openid.claimed_id": {"https://evil.example.com/openid/id/" + testSteamID}}},
+		{"identity", url.Values{"openid.identity": {"https://steamcommunity.com/openid/id/76561197960287931"}}},
+		{"signed", url.Values{"openid.signed": {"signed,op_endpoint,identity,return_to,response_nonce"}}},
+	}
+	for _, tt := range tbl {
+		state = testSteamLogin(t, s, "site=remark")
+		rr = httptest.NewRecorder()
+		s.AuthHandler(rr, testSteamCallback(s, state, "good-sig", tt.set))
+		assert.Equal(t, http.StatusForbidden, rr.Code, tt.name)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&checked))
+}
+
+func TestSteam_Player(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("steamids") {
+		case "1":
+			_, _ = w.Write([]byte(`{"response":{"players":[]}}`))
+		case "2":
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			_, _ = w.Write([]byte(`{"response":`))
+		}
+	}))
+	defer ts.Close()
+	s := testSteam(t, ts, &mockTokenService{})
+
+	_, err := s.player("1")
+	assert.EqualError(t, err, "no summary of player 1")
+	_, err = s.player("2")
+	assert.EqualError(t, err, "player summary responded with status 403")
+	_, err = s.player("3")
+	assert.ErrorContains(t, err, "can't decode player summary")
+}
+
+func TestSteam_Logout(t *testing.T) {
+	tokens := &mockTokenService{claims: token.Claims{User: &token.User{ID: "steam_123"}}}
+	s, err := NewSteam(SteamParams{URL: "https://remark42.example.com", APIKey: "key", TokenService: tokens})
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	s.LogoutHandler(rr, httptest.NewRequest(http.MethodGet, "/auth/steam/logout", http.NoBody))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Nil(t, tokens.claims.User)
+}
+
+func TestSteam_Requests(t *testing.T) {
+	s, err := NewSteam(SteamParams{URL: "https://remark42.example.com", APIKey: "key"})
+	require.NoError(t, err)
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	require.NoError(t, s.requests.add("expired", steamRequest{expires: now.Add(-time.Second)}, now))
+	_, ok := s.requests.take("expired", now)
+	assert.False(t, ok)
+
+	for i := range steamMaxRequests - 1 {
+		s.requests.data[fmt.Sprintf("r%d", i)] = steamRequest{expires: now.Add(time.Minute)}
+	}
+	require.NoError(t, s.requests.add("last", steamRequest{expires: now.Add(time.Minute)}, now))
+	assert.EqualError(t, s.requests.add("extra", steamRequest{expires: now.Add(time.Minute)}, now), "too many pending login requests")
+	now = now.Add(2 * time.Minute)
+	assert.NoError(t, s.requests.add("extra", steamRequest{expires: now.Add(time.Minute)}, now), "expired requests dropped")
+	assert.Len(t, s.requests.data, 1)
+}
+
+func TestSteamUser(t *testing.T) {
+	u := steamUser(steamPlayer{SteamID: testSteamID, PersonaName: " ", AvatarFull: "https://a/1.jpg"})
+	assert.Equal(t, "steam_"+token.HashID(sha1.New(), testSteamID), u.ID)
+	assert.Equal(t, "noname_"+u.ID[6:10], u.Name)
+	assert.Equal(t, "https://a/1.jpg", u.Picture)
+}
+
+func testSteam(t *testing.T, ts *httptest.Server, tokens *mockTokenService) *Steam {
+	s, err := NewSteam(SteamParams{URL: "https://remark42.example.com", APIKey: "api-key", Client: ts.Client(),
+		TokenService: tokens,
+		AllowedRedirectHosts: token.AllowedHostsFunc(func() ([]string, error) {
+			return []string{"blog.example.com"}, nil
+		})})
+	require.NoError(t, err)
+	s.openIDURL = ts.URL + "/openid/login"
+	s.summariesURL = ts.URL + "/summaries"
+	return s
+}
+
+// testSteamLogin starts login and returns state passed to steam in return_to
+func testSteamLogin(t *testing.T, s *Steam, query string) string {
+	rr := httptest.NewRecorder()
+	s.LoginHandler(rr, httptest.NewRequest(http.MethodGet, "/auth/steam/login?"+query, http.NoBody))
+	require.Equal(t, http.StatusFound, rr.Code)
+	loc, err := url.Parse(rr.Header().Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, s.openIDURL, loc.Scheme+"://"+loc.Host+loc.Path)
+	assert.Equal(t, "checkid_setup", loc.Query().Get("openid.mode"))
+	assert.Equal(t, "https://remark42.example.com", loc.Query().Get("openid.realm"))
+	assert.Equal(t, "http://specs.openid.net/auth/2.0/identifier_select", loc.Query().Get("openid.claimed_id"))
+	returnTo, err := url.Parse(loc.Query().Get("openid.return_to"))
+	require.NoError(t, err)
+	state := returnTo.Query().Get("state")
+	require.NotEmpty(t, state)
+	return state
+}
+
+// testSteamCallback makes callback request with positive assertion of steam, overridden by set values
+func testSteamCallback(s *Steam, state, sig string, set url.Values) *http.Request {
+	q := url.Values{
+		"state":                 {state},
+		"openid.ns":             {"http://specs.openid.net/auth/2.0"},
+		"openid.mode":           {"id_res"},
+		"openid.op_endpoint":    {s.openIDURL},
+		"openid.claimed_id":     {"https://steamcommunity.com/openid/id/" + testSteamID},
+		"openid.identity":       {"https://steamcommunity.com/openid/id/" + testSteamID},
+		"openid.return_to":      {s.returnTo(state)},
+		"openid.response_nonce": {"2026-01-02T03:04:05Zabc"},
+		"openid.assoc_handle":   {"1234567890"},
+		"openid.signed":         {"signed,op_endpoint,claimed_id,identity,return_to,response_nonce,assoc_handle"},
+		"openid.sig":            {sig},
+	}
+	for k, v := range set {
+		q[k] = v
+	}
+	return httptest.NewRequest(http.MethodGet, "/auth/steam/callback?"+q.Encode(), http.NoBody)
+}
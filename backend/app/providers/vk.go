@@ -0,0 +1,289 @@
+package providers
+
+// VK provider, logging users in with VK (VKontakte) OAuth. Email of the user is returned by VK
+// with the access token, not by API, and only if the user allowed it, so the flow is made here
+// instead of generic OAuth2 provider. The user is logged in without email if it is not allowed.
+
+import (
+	"crypto/sha1" //nolint:gosec // used for user id hashing, same as other auth providers
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-pkgz/auth/v2/provider"
+	"github.com/go-pkgz/auth/v2/token"
+	log "github.com/go-pkgz/lgr"
+	R "github.com/go-pkgz/rest"
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/umputun/remark42/backend/app/rest"
+)
+
+const (
+	vkAuthURL         = "https://oauth.vk.com/authorize"
+	vkTokenURL        = "https://oauth.vk.com/access_token"
+	vkUsersURL        = "https://api.vk.com/method/users.get"
+	vkAPIVersion      = "5.131"
+	vkScope           = "email"
+	vkRequestLifetime = 30 * time.Minute // time for user to log in on vk
+	vkMaxRequests     = 10000            // max number of pending login requests
+	vkMaxResponseSize = 1024 * 1024      // max size of vk's response
+)
+
+// VKParams defines parameters of VK provider
+type VKParams struct {
+	URL     string       // remark42 url, callback is at URL/auth/vk/callback
+	Issuer  string       // issuer of jwt tokens
+	Cid     string       // id of vk app
+	Csecret string       // secure key of vk app
+	Client  *http.Client // client of vk requests, with 10s timeout if nil
+
+	TokenService         provider.TokenService
+	AvatarSaver          provider.AvatarSaver
+	AllowedRedirectHosts token.AllowedHosts
+}
+
+// VK implements OAuth login with VK as auth provider with login, callback and logout handlers.
+// Pending login requests are kept in memory.
+type VK struct {
+	VKParams
+	now      func() time.Time
+	authURL  string
+	tokenURL string
+	usersURL string
+
+	requests *pendingStore[vkRequest]
+}
+
+// vkRequest is pending login request
+type vkRequest struct {
+	from    string
+	aud     string
+	session bool
+	noAva   bool
+	expires time.Time
+}
+
+// vkAccount is the part of user returned by users.get used to make the user, with email from the token response
+type vkAccount struct {
+	ID         int64  `json:"id"`
+	FirstName  string `json:"first_name"`
+	LastName   string `json:"last_name"`
+	ScreenName string `json:"screen_name"`
+	Photo      string `json:"photo_200"`
+	Email      string `json:"-"`
+}
+
+// NewVK makes VK provider
+func NewVK(params VKParams) (*VK, error) {
+	if params.Cid == "" || params.Csecret == "" {
+		return nil, errors.New("no vk app id or secure key")
+	}
+	params.URL = strings.TrimSuffix(params.URL, "/")
+	if params.Client == nil {
+		params.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	res := &VK{VKParams: params, now: time.Now, authURL: vkAuthURL, tokenURL: vkTokenURL, usersURL: vkUsersURL}
+	res.requests = newPendingStore(vkMaxRequests, errTooManyRequests, func(r vkRequest) time.Time { return r.expires })
+	return res, nil
+}
+
+// Name returns provider name
+func (v *VK) Name() string { return "vk" }
+
+func (v *VK) callbackURL() string { return v.URL + "/auth/vk/callback" }
+
+// LoginHandler redirects to the authorization page of VK
+func (v *VK) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	aud := r.URL.Query().Get("site") // legacy, for back compat
+	if aud == "" {
+		aud = r.URL.Query().Get("aud")
+	}
+	req := vkRequest{
+		from:    r.URL.Query().Get("from"),
+		aud:     aud,
+		session: r.URL.Query().Get("session") != "" && r.URL.Query().Get("session") != "0",
+		noAva:   r.URL.Query().Get("noava") == "1",
+		expires: v.now().Add(vkRequestLifetime),
+	}
+	state := randomID()
+	if err := v.requests.add(state, req, v.now()); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusTooManyRequests, err, "can't start vk login", rest.ErrActionRejected)
+		return
+	}
+
+	q := url.Values{
+		"client_id":     {v.Cid},
+		"redirect_uri":  {v.callbackURL()},
+		"response_type": {"code"},
+		"display":       {"page"},
+		"scope":         {vkScope},
+		"state":         {state},
+		"v":             {vkAPIVersion},
+	}
+	http.Redirect(w, r, v.authURL+"?"+q.Encode(), http.StatusFound)
+}
+
+// AuthHandler handles callback from VK, gets the account with the authorization code and sets the token
+func (v *VK) AuthHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := v.requests.take(r.URL.Query().Get("state"), v.now())
+	if !ok {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, errors.New("unknown state"), "unknown or expired login request",
+			rest.ErrNoAccess)
+		return
+	}
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, fmt.Errorf("no code, %s", r.URL.Query().Get("error")),
+			"login rejected by vk", rest.ErrNoAccess)
+		return
+	}
+
+	acc, err := v.account(code)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, err, "can't get vk account", rest.ErrNoAccess)
+		return
+	}
+	u := vkUser(acc)
+
+	if req.noAva {
+		u.Picture = "" // reset picture on no avatar request
+	}
+	if v.AvatarSaver != nil {
+		if u.Picture, err = v.AvatarSaver.Put(u, v.Client); err != nil {
+			rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "failed to save avatar to proxy", rest.ErrInternal)
+			return
+		}
+	}
+
+	claims := token.Claims{
+		User: &u,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:   v.Issuer,
+			ID:       randomID(),
+			Audience: []string{req.aud},
+		},
+		SessionOnly:  req.session,
+		NoAva:        req.noAva,
+		AuthProvider: &token.AuthProvider{Name: v.Name()},
+	}
+	if _, err = v.TokenService.Set(w, claims); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "failed to set token", rest.ErrInternal)
+		return
+	}
+	log.Printf("[DEBUG] vk login of user %s", u.ID)
+
+	if req.from != "" && allowedRedirect(v.URL, v.AllowedRedirectHosts, req.from) {
+		http.Redirect(w, r, req.from, http.StatusSeeOther)
+		return
+	}
+	R.RenderJSON(w, &u)
+}
+
+// LogoutHandler resets the token
+func (v *VK) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if _, _, err := v.TokenService.Get(r); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, err, "logout not allowed", rest.ErrNoAccess)
+		return
+	}
+	v.TokenService.Reset(w)
+}
+
+// account exchanges authorization code for the access token and gets the account with it.
+// Email comes with the token if the user allowed it.
+func (v *VK) account(code string) (vkAccount, error) {
+	q := url.Values{
+		"client_id":     {v.Cid},
+		"client_secret": {v.Csecret},
+		"redirect_uri":  {v.callbackURL()},
+		"code":          {code},
+	}
+	tkn := struct {
+		AccessToken string `json:"access_token"`
+		UserID      int64  `json:"user_id"`
+		Email       string `json:"email"`
+		Error       string `json:"error"`
+		Description string `json:"error_description"`
+	}{}
+	if err := v.get(v.tokenURL+"?"+q.Encode(), &tkn); err != nil {
+		return vkAccount{}, fmt.Errorf("can't get access token: %w", err)
+	}
+	if tkn.Error != "" || tkn.AccessToken == "" || tkn.UserID == 0 {
+		return vkAccount{}, fmt.Errorf("no access token in response, %s %s", tkn.Error, tkn.Description)
+	}
+
+	q = url.Values{
+		"user_ids":     {strconv.FormatInt(tkn.UserID, 10)},
+		"fields":       {"photo_200,screen_name"},
+		"access_token": {tkn.AccessToken},
+		"v":            {vkAPIVersion},
+	}
+	users := struct {
+		Response []vkAccount `json:"response"`
+		Error    *struct {
+			Code int    `json:"error_code"`
+			Msg  string `json:"error_msg"`
+		} `json:"error"`
+	}{}
+	if err := v.get(v.usersURL+"?"+q.Encode(), &users); err != nil {
+		return vkAccount{}, fmt.Errorf("can't get user: %w", err)
+	}
+	// vk api responds with 200 and error in the body
+	if users.Error != nil {
+		return vkAccount{}, fmt.Errorf("can't get user, error %d: %s", users.Error.Code, users.Error.Msg)
+	}
+	if len(users.Response) == 0 || users.Response[0].ID != tkn.UserID {
+		return vkAccount{}, fmt.Errorf("no user %d in response", tkn.UserID)
+	}
+	acc := users.Response[0]
+	acc.Email = tkn.Email
+	return acc, nil
+}
+
+// get makes request to vk, token endpoint responds with 401 and error in the body on bad code
+func (v *VK) get(u string, res any) error {
+	req, err := http.NewRequest(http.MethodGet, u, http.NoBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := v.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck // nothing to do with the error
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusUnauthorized && resp.StatusCode != http.StatusBadRequest {
+		return fmt.Errorf("%s responded with status %d", req.URL.Path, resp.StatusCode)
+	}
+	if err = json.NewDecoder(io.LimitReader(resp.Body, vkMaxResponseSize)).Decode(res); err != nil {
+		return fmt.Errorf("can't decode response of %s: %w", req.URL.Path, err)
+	}
+	return nil
+}
+
+// vkUser makes the user from the account. Placeholder photo of users without avatar is not used,
+// screen name is used if the user has no name.
+func vkUser(acc vkAccount) token.User {
+	u := token.User{
+		ID:      "vk_" + token.HashID(sha1.New(), strconv.FormatInt(acc.ID, 10)),
+		Name:    strings.TrimSpace(acc.FirstName + " " + acc.LastName),
+		Picture: acc.Photo,
+		Email:   acc.Email,
+	}
+	if strings.Contains(u.Picture, "/images/camera_") || strings.Contains(u.Picture, "/images/deactivated_") {
+		u.Picture = ""
+	}
+	if u.Name == "" {
+		u.Name = acc.ScreenName
+	}
+	if u.Name == "" {
+		u.Name = "noname_" + u.ID[3:7]
+	}
+	return u
+}
@@ -0,0 +1,208 @@
+package providers
+
+import (
+	"crypto/sha1" //nolint:gosec // same hashing of user id as in provider
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-pkgz/auth/v2/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewVK(t *testing.T) {
+	v, err := NewVK(VKParams{URL: "https://remark42.example.com/", Cid: "123", Csecret: "key"})
+	require.NoError(t, err)
+	assert.Equal(t, "vk", v.Name())
+	assert.Equal(t, "https://remark42.example.com/auth/vk/callback", v.callbackURL())
+	assert.NotNil(t, v.Client)
+
+	_, err = NewVK(VKParams{URL: "https://remark42.example.com", Cid: "123"})
+	assert.EqualError(t, err, "no vk app id or secure key")
+}
+
+func TestVK_LoginAndCallback(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/access_token":
+			assert.Equal(t, "123", r.URL.Query().Get("client_id"))
+			assert.Equal(t, "key", r.URL.Query().Get("client_secret"))
+			assert.Equal(t, "https://remark42.example.com/auth/vk/callback", r.URL.Query().Get("redirect_uri"))
+			switch r.URL.Query().Get("code") {
+			case "good-code":
+				_, _ = w.Write([]byte(`{"access_token":"tkn","expires_in":86400,"user_id":1,"email":"durov@example.com"}`))
+			case "no-email":
+				_, _ = w.Write([]byte(`{"access_token":"tkn","expires_in":86400,"user_id":1}`))
+			default:
+				w.WriteHeader(http.StatusUnauthorized)
+				_, _ = w.Write([]byte(`{"error":"invalid_grant","error_description":"Code is invalid or expired."}`))
+			}
+		case "/users.get":
+			assert.Equal(t, "tkn", r.URL.Query().Get("access_token"))
+			assert.Equal(t, "1", r.URL.Query().Get("user_ids"))
+			assert.Equal(t, "5.131", r.URL.Query().Get("v"))
+			_, _ = w.Write([]byte(`{"response":[{"id":1,"first_name":"Pavel","last_name":"Durov","screen_name":"durov",
+				"photo_200":"https://sun1-1.userapi.com/durov.jpg"}]}`))
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+	}))
+	defer ts.Close()
+
+	tokens := &mockTokenService{}
+	v := testVK(t, ts, tokens)
+	v.AvatarSaver = avatarSaverFunc(func(u token.User, client *http.Client) (string, error) {
+		assert.Equal(t, "https://sun1-1.userapi.com/durov.jpg", u.Picture)
+		assert.NotNil(t, client)
+		return "https://remark42.example.com/api/v1/avatar/" + u.ID + ".image", nil
+	})
+
+	state := testVKLogin(t, v, "from=https%3A%2F%2Fblog.example.com%2Fpost&site=remark&session=1")
+	rr := httptest.NewRecorder()
+	v.AuthHandler(rr, testVKCallback(state, "good-code"))
+	require.Equal(t, http.StatusSeeOther, rr.Code, rr.Body.String())
+	assert.Equal(t, "https://blog.example.com/post", rr.Header().Get("Location"))
+
+	userID := "vk_" + token.HashID(sha1.New(), "1")
+	require.NotNil(t, tokens.claims.User)
+	assert.Equal(t, token.User{ID: userID, Name: "Pavel Durov", Email: "durov@example.com",
+		Picture: "https://remark42.example.com/api/v1/avatar/" + userID + ".image"}, *tokens.claims.User)
+	assert.Equal(t, []string{"remark"}, []string(tokens.claims.Audience))
+	assert.True(t, tokens.claims.SessionOnly)
+	assert.Equal(t, "vk", tokens.claims.AuthProvider.Name)
+
+	// state can't be used twice
+	rr = httptest.NewRecorder()
+	v.AuthHandler(rr, testVKCallback(state, "good-code"))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "unknown or expired login request")
+
+	// email not allowed by the user
+	state = testVKLogin(t, v, "site=remark")
+	rr = httptest.NewRecorder()
+	v.AuthHandler(rr, testVKCallback(state, "no-email"))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, userID, tokens.claims.User.ID)
+	assert.Empty(t, tokens.claims.User.Email)
+
+	// code rejected by vk
+	state = testVKLogin(t, v, "site=remark")
+	rr = httptest.NewRecorder()
+	v.AuthHandler(rr, testVKCallback(state, "bad-code"))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "can't get vk account")
+
+	// login denied by user
+	state = testVKLogin(t, v, "site=remark")
+	rr = httptest.NewRecorder()
+	v.AuthHandler(rr, httptest.NewRequest(http.MethodGet, "/auth/vk/callback?error=access_denied&state="+state, http.NoBody))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "login rejected by vk")
+}
+
+func TestVK_Account(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/access_token":
+			_, _ = fmt.Fprintf(w, `{"access_token":"tkn","user_id":%s}`, r.URL.Query().Get("code"))
+		case "/users.get":
+			switch r.URL.Query().Get("user_ids") {
+			case "1":
+				_, _ = w.Write([]byte(`{"error":{"error_code":5,"error_msg":"User authorization failed"}}`))
+			case "2":
+				_, _ = w.Write([]byte(`{"response":[]}`))
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}
+	}))
+	defer ts.Close()
+	v := testVK(t, ts, &mockTokenService{})
+
+	_, err := v.account("1")
+	assert.EqualError(t, err, "can't get user, error 5: User authorization failed")
+	_, err = v.account("2")
+	assert.EqualError(t, err, "no user 2 in response")
+	_, err = v.account("3")
+	assert.EqualError(t, err, "can't get user: /users.get responded with status 500")
+}
+
+func TestVK_Logout(t *testing.T) {
+	tokens := &mockTokenService{claims: token.Claims{User: &token.User{ID: "vk_123"}}}
+	v, err := NewVK(VKParams{URL: "https://remark42.example.com", Cid: "123", Csecret: "key", TokenService: tokens})
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	v.LogoutHandler(rr, httptest.NewRequest(http.MethodGet, "/auth/vk/logout", http.NoBody))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Nil(t, tokens.claims.User)
+}
+
+func TestVK_Requests(t *testing.T) {
+	v, err := NewVK(VKParams{URL: "https://remark42.example.com", Cid: "123", Csecret: "key"})
+	require.NoError(t, err)
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	v.now = func() time.Time { return now }
+
+	require.NoError(t, v.requests.add("expired", vkRequest{expires: now.Add(-time.Second)}, now))
+	_, ok := v.requests.take("expired", now)
+	assert.False(t, ok)
+
+	for i := range vkMaxRequests - 1 {
+		v.requests.data[fmt.Sprintf("r%d", i)] = vkRequest{expires: now.Add(time.Minute)}
+	}
+	require.NoError(t, v.requests.add("last", vkRequest{expires: now.Add(time.Minute)}, now))
+	assert.EqualError(t, v.requests.add("extra", vkRequest{expires: now.Add(time.Minute)}, now), "too many pending login requests")
+	now = now.Add(2 * time.Minute)
+	assert.NoError(t, v.requests.add("extra", vkRequest{expires: now.Add(time.Minute)}, now), "expired requests dropped")
+	assert.Len(t, v.requests.data, 1)
+}
+
+func TestVKUser(t *testing.T) {
+	u := vkUser(vkAccount{ID: 42, ScreenName: "id42", Photo: "https://vk.com/images/camera_200.png"})
+	assert.Equal(t, "vk_"+token.HashID(sha1.New(), "42"), u.ID)
+	assert.Equal(t, "id42", u.Name)
+	assert.Empty(t, u.Picture, "placeholder photo dropped")
+
+	u = vkUser(vkAccount{ID: 42, FirstName: " ", Photo: "https://vk.com/images/deactivated_200.png"})
+	assert.Equal(t, "noname_"+u.ID[3:7], u.Name)
+	assert.Empty(t, u.Picture)
+}
+
+func testVK(t *testing.T, ts *httptest.Server, tokens *mockTokenService) *VK {
+	v, err := NewVK(VKParams{URL: "https://remark42.example.com", Cid: "123", Csecret: "key", Client: ts.Client(),
+		TokenService: tokens,
+		AllowedRedirectHosts: token.AllowedHostsFunc(func() ([]string, error) {
+			return []string{"blog.example.com"}, nil
+		})})
+	require.NoError(t, err)
+	v.authURL = ts.URL + "/authorize"
+	v.tokenURL = ts.URL + "/access_token"
+	v.usersURL = ts.URL + "/users.get"
+	return v
+}
+
+// testVKLogin starts login and returns state passed to vk
+func testVKLogin(t *testing.T, v *VK, query string) string {
+	rr := httptest.NewRecorder()
+	v.LoginHandler(rr, httptest.NewRequest(http.MethodGet, "/auth/vk/login?"+query, http.NoBody))
+	require.Equal(t, http.StatusFound, rr.Code)
+	loc, err := url.Parse(rr.Header().Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, v.authURL, loc.Scheme+"://"+loc.Host+loc.Path)
+	assert.Equal(t, "123", loc.Query().Get("client_id"))
+	assert.Equal(t, "code", loc.Query().Get("response_type"))
+	assert.Equal(t, "email", loc.Query().Get("scope"))
+	assert.Equal(t, "https://remark42.example.com/auth/vk/callback", loc.Query().Get("redirect_uri"))
+	state := loc.Query().Get("state")
+	require.NotEmpty(t, state)
+	return state
+}
+
+func testVKCallback(state, code string) *http.Request {
+	q := url.Values{"state": {state}, "code": {code}}
+	return httptest.NewRequest(http.MethodGet, "/auth/vk/callback?"+q.Encode(), http.NoBody)
+}
@@ -0,0 +1,356 @@
+package providers
+
+// WebAuthn provider, passwordless login with passkeys. Registration makes a new account with the name
+// chosen by the user and a discoverable (resident) credential, so the login doesn't need the user name:
+// the authenticator returns the user handle, which is remark42 user id. Credentials are kept with user
+// details of the site, the account of one site can't be used to log in to another one.
+// Both ceremonies are two-step: begin returns options for navigator.credentials and the state id,
+// finish gets the state id in the query and the credential json made by the browser in the body.
+
+import (
+	"crypto/sha1" //nolint:gosec // used for user id hashing, same as other auth providers
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-pkgz/auth/v2/provider"
+	"github.com/go-pkgz/auth/v2/token"
+	log "github.com/go-pkgz/lgr"
+	R "github.com/go-pkgz/rest"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/umputun/remark42/backend/app/rest"
+)
+
+const (
+	webauthnRequestLifetime = 5 * time.Minute // time for user to complete the ceremony with authenticator
+	webauthnMaxRequests     = 10000           // max number of pending ceremonies
+	webauthnMaxBodySize     = 64 * 1024       // max size of credential json sent by the browser
+	webauthnMaxNameLen      = 64              // max length of user name in runes
+	webauthnUserPrefix      = "webauthn_"
+)
+
+// WebAuthnStore keeps credentials of webauthn users, opaque to the store
+type WebAuthnStore interface {
+	Passkeys(siteID, userID string) (string, error)
+	SetPasskeys(siteID, userID, passkeys string) error
+}
+
+// WebAuthnParams defines parameters of WebAuthn provider
+type WebAuthnParams struct {
+	URL     string   // remark42 url, relying party id and origin made of it if not set
+	Issuer  string   // issuer of jwt tokens
+	RPID    string   // relying party id, domain of credentials
+	RPName  string   // relying party name shown by authenticators, remark42 if empty
+	Origins []string // origins allowed to make credentials, remark42 url origin if empty
+	Store   WebAuthnStore
+
+	TokenService provider.TokenService
+	AvatarSaver  provider.AvatarSaver
+}
+
+// WebAuthn implements passkey login as auth provider with login, callback and logout handlers,
+// and registration handler. Pending ceremonies are kept in memory.
+type WebAuthn struct {
+	WebAuthnParams
+	now     func() time.Time
+	relying *webauthn.WebAuthn
+
+	requests *pendingStore[webauthnRequest]
+}
+
+// webauthnRequest is pending registration or login ceremony
+type webauthnRequest struct {
+	register bool
+	session  webauthn.SessionData
+	user     webauthnUser // registered user, empty for login
+	aud      string
+	sessOnly bool
+	expires  time.Time
+}
+
+// webauthnAccount is stored account of webauthn user
+type webauthnAccount struct {
+	Name        string                `json:"name"`
+	Credentials []webauthn.Credential `json:"credentials"`
+}
+
+// webauthnUser implements webauthn.User for the account
+type webauthnUser struct {
+	id string
+	webauthnAccount
+}
+
+func (u webauthnUser) WebAuthnID() []byte                         { return []byte(u.id) }
+func (u webauthnUser) WebAuthnName() string                       { return u.Name }
+func (u webauthnUser) WebAuthnDisplayName() string                { return u.Name }
+func (u webauthnUser) WebAuthnCredentials() []webauthn.Credential { return u.Credentials }
+
+// NewWebAuthn makes WebAuthn provider
+func NewWebAuthn(params WebAuthnParams) (*WebAuthn, error) {
+	if params.Store == nil {
+		return nil, errors.New("no webauthn credentials store")
+	}
+	params.URL = strings.TrimSuffix(params.URL, "/")
+	u, err := url.Parse(params.URL)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse remark url %s: %w", params.URL, err)
+	}
+	if params.RPID == "" {
+		params.RPID = u.Hostname()
+	}
+	if params.RPName == "" {
+		params.RPName = "remark42"
+	}
+	if len(params.Origins) == 0 {
+		params.Origins = []string{u.Scheme + "://" + u.Host}
+	}
+	relying, err := webauthn.New(&webauthn.Config{RPID: params.RPID, RPDisplayName: params.RPName, RPOrigins: params.Origins})
+	if err != nil {
+		return nil, fmt.Errorf("can't make webauthn relying party: %w", err)
+	}
+	res := &WebAuthn{WebAuthnParams: params, now: time.Now, relying: relying}
+	res.requests = newPendingStore(webauthnMaxRequests, errors.New("too many pending webauthn requests"),
+		func(r webauthnRequest) time.Time { return r.expires })
+	return res, nil
+}
+
+// Name returns provider name
+func (p *WebAuthn) Name() string { return "webauthn" }
+
+// String returns provider description for logging
+func (p *WebAuthn) String() string {
+	return fmt.Sprintf("webauthn provider, rp id %s, origins %v", p.RPID, p.Origins)
+}
+
+// LoginHandler begins discoverable login, responds with the state and the options for navigator.credentials.get
+func (p *WebAuthn) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	aud := webauthnSite(r)
+	if aud == "" {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, errors.New("no site"), "site is required", rest.ErrActionRejected)
+		return
+	}
+	assertion, session, err := p.relying.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationPreferred))
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't begin webauthn login", rest.ErrInternal)
+		return
+	}
+	state := randomID()
+	req := webauthnRequest{session: *session, aud: aud, sessOnly: webauthnSessionOnly(r), expires: p.now().Add(webauthnRequestLifetime)}
+	if err = p.requests.add(state, req, p.now()); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusTooManyRequests, err, "can't begin webauthn login", rest.ErrActionRejected)
+		return
+	}
+	R.RenderJSON(w, struct {
+		State string `json:"state"`
+		*protocol.CredentialAssertion
+	}{State: state, CredentialAssertion: assertion})
+}
+
+// AuthHandler finishes login with the assertion made by the authenticator, updates the signature counter
+// of the credential and sets the token
+func (p *WebAuthn) AuthHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := p.requests.take(r.URL.Query().Get("state"), p.now())
+	if !ok || req.register {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, errors.New("unknown state"), "unknown or expired login request",
+			rest.ErrNoAccess)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, webauthnMaxBodySize)
+
+	found, cred, err := p.relying.FinishPasskeyLogin(func(_, userHandle []byte) (webauthn.User, error) {
+		return p.loadUser(req.aud, string(userHandle))
+	}, req.session, r)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, webauthnError(err), "passkey rejected", rest.ErrNoAccess)
+		return
+	}
+	user := found.(webauthnUser)
+	if cred.Authenticator.CloneWarning {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, fmt.Errorf("signature counter of %s went back", user.id),
+			"passkey may be cloned", rest.ErrNoAccess)
+		return
+	}
+	for i := range user.Credentials {
+		if string(user.Credentials[i].ID) == string(cred.ID) {
+			user.Credentials[i] = *cred
+		}
+	}
+	if err = p.saveUser(req.aud, user); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't save passkey", rest.ErrInternal)
+		return
+	}
+	p.setToken(w, r, req, user)
+}
+
+// LogoutHandler resets the token
+func (p *WebAuthn) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if _, _, err := p.TokenService.Get(r); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, err, "logout not allowed", rest.ErrNoAccess)
+		return
+	}
+	p.TokenService.Reset(w)
+}
+
+// RegistrationHandler serves /auth/webauthn/register/begin, making options for navigator.credentials.create
+// for the new account with the name from json body, and /auth/webauthn/register/finish, storing
+// the credential made by the authenticator and setting the token
+func (p *WebAuthn) RegistrationHandler(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/register/begin"):
+		p.beginRegistration(w, r)
+	case strings.HasSuffix(r.URL.Path, "/register/finish"):
+		p.finishRegistration(w, r)
+	default:
+		rest.SendErrorJSON(w, r, http.StatusNotFound, errors.New("unknown path"), "not found", rest.ErrActionRejected)
+	}
+}
+
+func (p *WebAuthn) beginRegistration(w http.ResponseWriter, r *http.Request) {
+	aud := webauthnSite(r)
+	if aud == "" {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, errors.New("no site"), "site is required", rest.ErrActionRejected)
+		return
+	}
+	body := struct {
+		Name string `json:"name"`
+	}{}
+	if err := json.NewDecoder(io.LimitReader(r.Body, webauthnMaxBodySize)).Decode(&body); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't decode registration request", rest.ErrDecode)
+		return
+	}
+	name := strings.TrimSpace(body.Name)
+	if name == "" || utf8.RuneCountInString(name) > webauthnMaxNameLen {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, fmt.Errorf("bad name %q", name), "invalid user name", rest.ErrActionRejected)
+		return
+	}
+
+	user := webauthnUser{id: webauthnUserPrefix + token.HashID(sha1.New(), randomID()), webauthnAccount: webauthnAccount{Name: name}}
+	creation, session, err := p.relying.BeginRegistration(user,
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired))
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't begin webauthn registration", rest.ErrInternal)
+		return
+	}
+	state := randomID()
+	req := webauthnRequest{register: true, session: *session, user: user, aud: aud, sessOnly: webauthnSessionOnly(r),
+		expires: p.now().Add(webauthnRequestLifetime)}
+	if err = p.requests.add(state, req, p.now()); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusTooManyRequests, err, "can't begin webauthn registration", rest.ErrActionRejected)
+		return
+	}
+	R.RenderJSON(w, struct {
+		State string `json:"state"`
+		*protocol.CredentialCreation
+	}{State: state, CredentialCreation: creation})
+}
+
+func (p *WebAuthn) finishRegistration(w http.ResponseWriter, r *http.Request) {
+	req, ok := p.requests.take(r.URL.Query().Get("state"), p.now())
+	if !ok || !req.register {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, errors.New("unknown state"), "unknown or expired registration request",
+			rest.ErrNoAccess)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, webauthnMaxBodySize)
+
+	cred, err := p.relying.FinishRegistration(req.user, req.session, r)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, webauthnError(err), "passkey rejected", rest.ErrNoAccess)
+		return
+	}
+	user := req.user
+	user.Credentials = []webauthn.Credential{*cred}
+	if err = p.saveUser(req.aud, user); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't save passkey", rest.ErrInternal)
+		return
+	}
+	log.Printf("[INFO] webauthn user %s registered on %s", user.id, req.aud)
+	p.setToken(w, r, req, user)
+}
+
+// setToken sets the token of the user, with identicon avatar if avatar saver defined
+func (p *WebAuthn) setToken(w http.ResponseWriter, r *http.Request, req webauthnRequest, user webauthnUser) {
+	u := token.User{ID: user.id, Name: user.Name}
+	if p.AvatarSaver != nil {
+		var err error
+		if u.Picture, err = p.AvatarSaver.Put(u, nil); err != nil {
+			rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "failed to save avatar to proxy", rest.ErrInternal)
+			return
+		}
+	}
+
+	claims := token.Claims{
+		User: &u,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:   p.Issuer,
+			ID:       randomID(),
+			Audience: []string{req.aud},
+		},
+		SessionOnly:  req.sessOnly,
+		AuthProvider: &token.AuthProvider{Name: p.Name()},
+	}
+	if _, err := p.TokenService.Set(w, claims); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "failed to set token", rest.ErrInternal)
+		return
+	}
+	log.Printf("[DEBUG] webauthn login of user %s", u.ID)
+	R.RenderJSON(w, &u)
+}
+
+// loadUser returns stored account of the user with credentials
+func (p *WebAuthn) loadUser(siteID, userID string) (webauthnUser, error) {
+	if !strings.HasPrefix(userID, webauthnUserPrefix) {
+		return webauthnUser{}, fmt.Errorf("user %q is not webauthn user", userID)
+	}
+	stored, err := p.Store.Passkeys(siteID, userID)
+	if err != nil {
+		return webauthnUser{}, fmt.Errorf("can't load passkeys of %s: %w", userID, err)
+	}
+	if stored == "" {
+		return webauthnUser{}, fmt.Errorf("no passkeys of %s", userID)
+	}
+	user := webauthnUser{id: userID}
+	if err = json.Unmarshal([]byte(stored), &user.webauthnAccount); err != nil {
+		return webauthnUser{}, fmt.Errorf("can't decode passkeys of %s: %w", userID, err)
+	}
+	return user, nil
+}
+
+// saveUser stores account of the user with credentials
+func (p *WebAuthn) saveUser(siteID string, user webauthnUser) error {
+	data, err := json.Marshal(user.webauthnAccount)
+	if err != nil {
+		return fmt.Errorf("can't encode passkeys of %s: %w", user.id, err)
+	}
+	return p.Store.SetPasskeys(siteID, user.id, string(data))
+}
+
+// webauthnSite returns site of the request, from site or aud query param
+func webauthnSite(r *http.Request) string {
+	if site := r.URL.Query().Get("site"); site != "" { // legacy, for back compat
+		return site
+	}
+	return r.URL.Query().Get("aud")
+}
+
+func webauthnSessionOnly(r *http.Request) bool {
+	return r.URL.Query().Get("session") != "" && r.URL.Query().Get("session") != "0"
+}
+
+// webauthnError adds debug info of protocol error, not included in its message
+func webauthnError(err error) error {
+	var perr *protocol.Error
+	if errors.As(err, &perr) && perr.DevInfo != "" {
+		return fmt.Errorf("%w: %s", err, perr.DevInfo)
+	}
+	return err
+}
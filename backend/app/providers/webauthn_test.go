@@ -0,0 +1,418 @@
+package providers
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-pkgz/auth/v2/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewWebAuthn(t *testing.T) {
+	p, err := NewWebAuthn(WebAuthnParams{URL: "https://remark42.example.com:8443/", Store: &memPasskeys{}})
+	require.NoError(t, err)
+	assert.Equal(t, "webauthn", p.Name())
+	assert.Equal(t, "remark42.example.com", p.RPID)
+	assert.Equal(t, "remark42", p.RPName)
+	assert.Equal(t, []string{"https://remark42.example.com:8443"}, p.Origins)
+	assert.Equal(t, "webauthn provider, rp id remark42.example.com, origins [https://remark42.example.com:8443]", p.String())
+
+	p, err = NewWebAuthn(WebAuthnParams{URL: "https://remark42.example.com", RPID: "example.com", RPName: "Blog",
+		Origins: []string{"https://example.com"}, Store: &memPasskeys{}})
+	require.NoError(t, err)
+	assert.Equal(t, "example.com", p.RPID)
+	assert.Equal(t, "Blog", p.RPName)
+	assert.Equal(t, []string{"https://example.com"}, p.Origins)
+
+	_, err = NewWebAuthn(WebAuthnParams{URL: "https://remark42.example.com"})
+	assert.EqualError(t, err, "no webauthn credentials store")
+}
+
+func TestWebAuthn_RegisterAndLogin(t *testing.T) {
+	tokens := &mockTokenService{}
+	store := &memPasskeys{}
+	p := testWebAuthn(t, store, tokens)
+	p.AvatarSaver = avatarSaverFunc(func(u token.User, client *http.Client) (string, error) {
+		assert.Empty(t, u.Picture, "identicon made for webauthn user")
+		assert.Nil(t, client)
+		return "https://remark42.example.com/api/v1/avatar/" + u.ID + ".image", nil
+	})
+	authr := newTestAuthenticator(t)
+
+	// registration
+	rr := httptest.NewRecorder()
+	p.RegistrationHandler(rr, httptest.NewRequest(http.MethodPost, "/auth/webauthn/register/begin?site=remark&session=1",
+		strings.NewReader(`{"name":" John Doe "}`)))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	creation := struct {
+		State     string `json:"state"`
+		PublicKey struct {
+			Challenge string `json:"challenge"`
+			RP        struct {
+				ID   string `json:"id"`
+				Name string `json:"name"`
+			} `json:"rp"`
+			User struct {
+				ID   string `json:"id"`
+				Name string `json:"name"`
+			} `json:"user"`
+			AuthenticatorSelection struct {
+				ResidentKey string `json:"residentKey"`
+			} `json:"authenticatorSelection"`
+		} `json:"publicKey"`
+	}{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &creation))
+	require.NotEmpty(t, creation.State)
+	assert.Equal(t, "remark42.example.com", creation.PublicKey.RP.ID)
+	assert.Equal(t, "remark42", creation.PublicKey.RP.Name)
+	assert.Equal(t, "John Doe", creation.PublicKey.User.Name)
+	assert.Equal(t, "required", creation.PublicKey.AuthenticatorSelection.ResidentKey)
+	userHandle, err := base64.RawURLEncoding.DecodeString(creation.PublicKey.User.ID)
+	require.NoError(t, err)
+	userID := string(userHandle)
+	assert.True(t, strings.HasPrefix(userID, "webauthn_"), userID)
+
+	rr = httptest.NewRecorder()
+	p.RegistrationHandler(rr, httptest.NewRequest(http.MethodPost, "/auth/webauthn/register/finish?state="+creation.State,
+		authr.create(t, creation.PublicKey.Challenge, userHandle)))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	expUser := token.User{ID: userID, Name: "John Doe", Picture: "https://remark42.example.com/api/v1/avatar/" + userID + ".image"}
+	require.NotNil(t, tokens.claims.User)
+	assert.Equal(t, expUser, *tokens.claims.User)
+	assert.Equal(t, []string{"remark"}, []string(tokens.claims.Audience))
+	assert.True(t, tokens.claims.SessionOnly)
+	assert.Equal(t, "webauthn", tokens.claims.AuthProvider.Name)
+	account := store.account(t, "remark", userID)
+	assert.Equal(t, "John Doe", account.Name)
+	require.Len(t, account.Credentials, 1)
+	assert.Equal(t, authr.credID, account.Credentials[0].ID)
+
+	// registration state can't be used twice
+	rr = httptest.NewRecorder()
+	p.RegistrationHandler(rr, httptest.NewRequest(http.MethodPost, "/auth/webauthn/register/finish?state="+creation.State,
+		authr.create(t, creation.PublicKey.Challenge, userHandle)))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "unknown or expired registration request")
+
+	// login
+	tokens.claims = token.Claims{}
+	state, challenge := testWebAuthnLogin(t, p, "site=remark")
+	authr.counter = 1
+	rr = httptest.NewRecorder()
+	p.AuthHandler(rr, httptest.NewRequest(http.MethodPost, "/auth/webauthn/callback?state="+state, authr.get(t, challenge)))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	require.NotNil(t, tokens.claims.User)
+	assert.Equal(t, expUser, *tokens.claims.User)
+	assert.False(t, tokens.claims.SessionOnly)
+	assert.Equal(t, uint32(1), store.account(t, "remark", userID).Credentials[0].Authenticator.SignCount, "counter updated")
+
+	// login state can't be used twice
+	rr = httptest.NewRecorder()
+	p.AuthHandler(rr, httptest.NewRequest(http.MethodPost, "/auth/webauthn/callback?state="+state, authr.get(t, challenge)))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "unknown or expired login request")
+
+	// signature counter not increased
+	state, challenge = testWebAuthnLogin(t, p, "site=remark")
+	rr = httptest.NewRecorder()
+	p.AuthHandler(rr, httptest.NewRequest(http.MethodPost, "/auth/webauthn/callback?state="+state, authr.get(t, challenge)))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "passkey may be cloned")
+
+	// passkey of another site
+	state, challenge = testWebAuthnLogin(t, p, "aud=other")
+	authr.counter = 2
+	rr = httptest.NewRecorder()
+	p.AuthHandler(rr, httptest.NewRequest(http.MethodPost, "/auth/webauthn/callback?state="+state, authr.get(t, challenge)))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "passkey rejected")
+
+	// unknown key
+	state, challenge = testWebAuthnLogin(t, p, "site=remark")
+	other := newTestAuthenticator(t)
+	rr = httptest.NewRecorder()
+	p.AuthHandler(rr, httptest.NewRequest(http.MethodPost, "/auth/webauthn/callback?state="+state, other.get(t, challenge)))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "passkey rejected")
+}
+
+func TestWebAuthn_Rejected(t *testing.T) {
+	p := testWebAuthn(t, &memPasskeys{}, &mockTokenService{})
+	authr := newTestAuthenticator(t)
+
+	tbl := []struct {
+		path, body string
+		code       int
+		msg        string
+	}{
+		{"/auth/webauthn/register/begin", `{"name":"user"}`, http.StatusBadRequest, "site is required"},
+		{"/auth/webauthn/register/begin?site=remark", `{"name":"  "}`, http.StatusBadRequest, "invalid user name"},
+		{"/auth/webauthn/register/begin?site=remark", `{"name":"` + strings.Repeat("я", 65) + `"}`, http.StatusBadRequest,
+			"invalid user name"},
+		{"/auth/webauthn/register/begin?site=remark", `{"name":`, http.StatusBadRequest, "can't decode registration request"},
+		{"/auth/webauthn/register/finish?state=unknown", `{}`, http.StatusForbidden, "unknown or expired registration request"},
+		{"/auth/webauthn/register/other", `{}`, http.StatusNotFound, "not found"},
+	}
+	for i, tt := range tbl {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			p.RegistrationHandler(rr, httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body)))
+			assert.Equal(t, tt.code, rr.Code)
+			assert.Contains(t, rr.Body.String(), tt.msg)
+		})
+	}
+
+	rr := httptest.NewRecorder()
+	p.LoginHandler(rr, httptest.NewRequest(http.MethodGet, "/auth/webauthn/login", http.NoBody))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "site is required")
+
+	// login state can't finish registration and vice versa
+	state, challenge := testWebAuthnLogin(t, p, "site=remark")
+	rr = httptest.NewRecorder()
+	p.RegistrationHandler(rr, httptest.NewRequest(http.MethodPost, "/auth/webauthn/register/finish?state="+state,
+		authr.create(t, challenge, []byte("webauthn_123"))))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	rr = httptest.NewRecorder()
+	p.RegistrationHandler(rr, httptest.NewRequest(http.MethodPost, "/auth/webauthn/register/begin?site=remark",
+		strings.NewReader(`{"name":"user"}`)))
+	require.Equal(t, http.StatusOK, rr.Code)
+	creation := struct {
+		State string `json:"state"`
+	}{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &creation))
+	rr = httptest.NewRecorder()
+	p.AuthHandler(rr, httptest.NewRequest(http.MethodPost, "/auth/webauthn/callback?state="+creation.State, authr.get(t, "abc")))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "unknown or expired login request")
+
+	// challenge of another ceremony
+	state, _ = testWebAuthnLogin(t, p, "site=remark")
+	rr = httptest.NewRecorder()
+	p.AuthHandler(rr, httptest.NewRequest(http.MethodPost, "/auth/webauthn/callback?state="+state, authr.get(t, "abc")))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "passkey rejected")
+}
+
+func TestWebAuthn_LoadUser(t *testing.T) {
+	store := &memPasskeys{}
+	p := testWebAuthn(t, store, &mockTokenService{})
+
+	_, err := p.loadUser("remark", "github_123")
+	assert.EqualError(t, err, `user "github_123" is not webauthn user`)
+	_, err = p.loadUser("remark", "webauthn_123")
+	assert.EqualError(t, err, "no passkeys of webauthn_123")
+	_, err = p.loadUser("bad", "webauthn_123")
+	assert.EqualError(t, err, "can't load passkeys of webauthn_123: site bad not found")
+
+	require.NoError(t, store.SetPasskeys("remark", "webauthn_123", "{bad"))
+	_, err = p.loadUser("remark", "webauthn_123")
+	assert.ErrorContains(t, err, "can't decode passkeys of webauthn_123")
+
+	require.NoError(t, p.saveUser("remark", webauthnUser{id: "webauthn_123", webauthnAccount: webauthnAccount{Name: "user"}}))
+	u, err := p.loadUser("remark", "webauthn_123")
+	require.NoError(t, err)
+	assert.Equal(t, "webauthn_123", string(u.WebAuthnID()))
+	assert.Equal(t, "user", u.WebAuthnName())
+	assert.Equal(t, "user", u.WebAuthnDisplayName())
+	assert.Empty(t, u.WebAuthnCredentials())
+}
+
+func TestWebAuthn_Logout(t *testing.T) {
+	tokens := &mockTokenService{claims: token.Claims{User: &token.User{ID: "webauthn_123"}}}
+	p := testWebAuthn(t, &memPasskeys{}, tokens)
+	rr := httptest.NewRecorder()
+	p.LogoutHandler(rr, httptest.NewRequest(http.MethodGet, "/auth/webauthn/logout", http.NoBody))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Nil(t, tokens.claims.User)
+}
+
+func TestWebAuthn_Requests(t *testing.T) {
+	p := testWebAuthn(t, &memPasskeys{}, &mockTokenService{})
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	p.now = func() time.Time { return now }
+
+	require.NoError(t, p.requests.add("expired", webauthnRequest{expires: now.Add(-time.Second)}, now))
+	_, ok := p.requests.take("expired", now)
+	assert.False(t, ok)
+
+	for i := range webauthnMaxRequests - 1 {
+		p.requests.data[fmt.Sprintf("r%d", i)] = webauthnRequest{expires: now.Add(time.Minute)}
+	}
+	require.NoError(t, p.requests.add("last", webauthnRequest{expires: now.Add(time.Minute)}, now))
+	assert.EqualError(t, p.requests.add("extra", webauthnRequest{expires: now.Add(time.Minute)}, now), "too many pending webauthn requests")
+	now = now.Add(2 * time.Minute)
+	assert.NoError(t, p.requests.add("extra", webauthnRequest{expires: now.Add(time.Minute)}, now), "expired requests dropped")
+	assert.Len(t, p.requests.data, 1)
+}
+
+func testWebAuthn(t *testing.T, store WebAuthnStore, tokens *mockTokenService) *WebAuthn {
+	p, err := NewWebAuthn(WebAuthnParams{URL: "https://remark42.example.com", Issuer: "remark42", Store: store, TokenService: tokens})
+	require.NoError(t, err)
+	return p
+}
+
+// testWebAuthnLogin begins login and returns the state and the challenge
+func testWebAuthnLogin(t *testing.T, p *WebAuthn, query string) (state, challenge string) {
+	rr := httptest.NewRecorder()
+	p.LoginHandler(rr, httptest.NewRequest(http.MethodGet, "/auth/webauthn/login?"+query, http.NoBody))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assertion := struct {
+		State     string `json:"state"`
+		PublicKey struct {
+			Challenge        string            `json:"challenge"`
+			RPID             string            `json:"rpId"`
+			AllowCredentials []json.RawMessage `json:"allowCredentials"`
+			UserVerification string            `json:"userVerification"`
+		} `json:"publicKey"`
+	}{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &assertion))
+	assert.Equal(t, "remark42.example.com", assertion.PublicKey.RPID)
+	assert.Empty(t, assertion.PublicKey.AllowCredentials, "discoverable login")
+	assert.Equal(t, "preferred", assertion.PublicKey.UserVerification)
+	require.NotEmpty(t, assertion.State)
+	require.NotEmpty(t, assertion.PublicKey.Challenge)
+	return assertion.State, assertion.PublicKey.Challenge
+}
+
+// memPasskeys is in-memory WebAuthnStore, fails for site "bad"
+type memPasskeys struct {
+	data map[string]string
+}
+
+func (m *memPasskeys) Passkeys(siteID, userID string) (string, error) {
+	if siteID == "bad" {
+		return "", errors.New("site bad not found")
+	}
+	return m.data[siteID+"/"+userID], nil
+}
+
+func (m *memPasskeys) SetPasskeys(siteID, userID, passkeys string) error {
+	if m.data == nil {
+		m.data = map[string]string{}
+	}
+	m.data[siteID+"/"+userID] = passkeys
+	return nil
+}
+
+func (m *memPasskeys) account(t *testing.T, siteID, userID string) webauthnAccount {
+	var res webauthnAccount
+	require.NoError(t, json.Unmarshal([]byte(m.data[siteID+"/"+userID]), &res))
+	return res
+}
+
+// testAuthenticator is a software authenticator with P-256 key, making "none" attestation
+type testAuthenticator struct {
+	key        *ecdsa.PrivateKey
+	credID     []byte
+	userHandle []byte
+	counter    uint32
+}
+
+const (
+	testWebAuthnRPID   = "remark42.example.com"
+	testWebAuthnOrigin = "https://remark42.example.com"
+)
+
+func newTestAuthenticator(t *testing.T) *testAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	credID := make([]byte, 16)
+	_, err = rand.Read(credID)
+	require.NoError(t, err)
+	return &testAuthenticator{key: key, credID: credID}
+}
+
+// create makes the credential json of registration, as sent by the browser
+func (a *testAuthenticator) create(t *testing.T, challenge string, userHandle []byte) *bytes.Reader {
+	a.userHandle = userHandle
+	pub, err := a.key.PublicKey.ECDH()
+	require.NoError(t, err)
+	point := pub.Bytes() // uncompressed, 0x04 | x | y
+
+	// COSE key, {1: 2 (EC2), 3: -7 (ES256), -1: 1 (P-256), -2: x, -3: y}
+	coseKey := []byte{0xa5, 0x01, 0x02, 0x03, 0x26, 0x20, 0x01, 0x21}
+	coseKey = append(append(coseKey, cborBytes(point[1:33])...), 0x22)
+	coseKey = append(coseKey, cborBytes(point[33:])...)
+
+	authData := a.authData(0x45) // user present, user verified, attested credential data
+	authData = append(authData, make([]byte, 16)...)
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.credID))) //nolint:gosec // 16 bytes
+	authData = append(append(authData, a.credID...), coseKey...)
+
+	// {"fmt": "none", "attStmt": {}, "authData": authData}
+	attObj := append([]byte{0xa3, 0x63}, "fmt"...)
+	attObj = append(append(attObj, 0x64), "none"...)
+	attObj = append(append(attObj, 0x67), "attStmt"...)
+	attObj = append(append(attObj, 0xa0, 0x68), "authData"...)
+	attObj = append(attObj, cborBytes(authData)...)
+
+	return a.credential(t, map[string]string{
+		"clientDataJSON":    b64url(a.clientData(t, "webauthn.create", challenge)),
+		"attestationObject": b64url(attObj),
+	})
+}
+
+// get makes the credential json of login, as sent by the browser
+func (a *testAuthenticator) get(t *testing.T, challenge string) *bytes.Reader {
+	authData := a.authData(0x05) // user present, user verified
+	clientData := a.clientData(t, "webauthn.get", challenge)
+	clientHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientHash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	require.NoError(t, err)
+	return a.credential(t, map[string]string{
+		"clientDataJSON":    b64url(clientData),
+		"authenticatorData": b64url(authData),
+		"signature":         b64url(sig),
+		"userHandle":        b64url(a.userHandle),
+	})
+}
+
+func (a *testAuthenticator) authData(flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(testWebAuthnRPID))
+	res := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(res, a.counter)
+}
+
+func (a *testAuthenticator) clientData(t *testing.T, typ, challenge string) []byte {
+	res, err := json.Marshal(map[string]string{"type": typ, "challenge": challenge, "origin": testWebAuthnOrigin})
+	require.NoError(t, err)
+	return res
+}
+
+func (a *testAuthenticator) credential(t *testing.T, resp map[string]string) *bytes.Reader {
+	res, err := json.Marshal(map[string]any{"id": b64url(a.credID), "rawId": b64url(a.credID), "type": "public-key",
+		"response": resp})
+	require.NoError(t, err)
+	return bytes.NewReader(res)
+}
+
+// cborBytes encodes byte string of up to 64k as cbor
+func cborBytes(b []byte) []byte {
+	switch {
+	case len(b) < 24:
+		return append([]byte{0x40 | byte(len(b))}, b...)
+	case len(b) < 256:
+		return append([]byte{0x58, byte(len(b))}, b...)
+	default:
+		return append(binary.BigEndian.AppendUint16([]byte{0x59}, uint16(len(b))), b...) //nolint:gosec // checked by caller
+	}
+}
+
+func b64url(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
@@ -0,0 +1,303 @@
+package providers
+
+// WeChat provider, logging users in with WeChat QR-code web login (snsapi_login). WeChat uses
+// non-standard appid and secret parameters instead of client_id and client_secret and responds
+// with errors in the body of 200 response, so the flow is made here instead of generic OAuth2 provider.
+// User id is made of UnionID, the same for all apps of the WeChat Open Platform account, so
+// the user keeps the id if the site switches to another app. OpenID, unique per app, is used
+// if the app is not bound to an Open Platform account and UnionID is not returned.
+
+import (
+	"crypto/sha1" //nolint:gosec // used for user id hashing, same as other auth providers
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-pkgz/auth/v2/provider"
+	"github.com/go-pkgz/auth/v2/token"
+	log "github.com/go-pkgz/lgr"
+	R "github.com/go-pkgz/rest"
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/umputun/remark42/backend/app/rest"
+)
+
+const (
+	wechatAuthURL         = "https://open.weixin.qq.com/connect/qrconnect"
+	wechatTokenURL        = "https://api.weixin.qq.com/sns/oauth2/access_token"
+	wechatUserURL         = "https://api.weixin.qq.com/sns/userinfo"
+	wechatScope           = "snsapi_login"
+	wechatRequestLifetime = 30 * time.Minute // time for user to scan the code and log in
+	wechatMaxRequests     = 10000            // max number of pending login requests
+	wechatMaxResponseSize = 1024 * 1024      // max size of wechat's response
+)
+
+// WeChatParams defines parameters of WeChat provider
+type WeChatParams struct {
+	URL    string       // remark42 url, callback is at URL/auth/wechat/callback
+	Issuer string       // issuer of jwt tokens
+	AppID  string       // appid of website application on WeChat Open Platform
+	Secret string       // secret of the application
+	Lang   string       // language of userinfo response, en if empty
+	Client *http.Client // client of wechat requests, with 10s timeout if nil
+
+	TokenService         provider.TokenService
+	AvatarSaver          provider.AvatarSaver
+	AllowedRedirectHosts token.AllowedHosts
+}
+
+// WeChat implements QR-code login with WeChat as auth provider with login, callback and logout handlers.
+// Pending login requests are kept in memory.
+type WeChat struct {
+	WeChatParams
+	now      func() time.Time
+	authURL  string
+	tokenURL string
+	userURL  string
+
+	requests *pendingStore[wechatRequest]
+}
+
+// wechatRequest is pending login request
+type wechatRequest struct {
+	from    string
+	aud     string
+	session bool
+	noAva   bool
+	expires time.Time
+}
+
+// wechatAccount is the part of userinfo used to make the user
+type wechatAccount struct {
+	OpenID     string `json:"openid"`
+	UnionID    string `json:"unionid"`
+	Nickname   string `json:"nickname"`
+	HeadImgURL string `json:"headimgurl"`
+}
+
+// wechatError is error returned by wechat api in the body of 200 response
+type wechatError struct {
+	ErrCode int    `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+}
+
+func (e wechatError) err() error {
+	if e.ErrCode == 0 {
+		return nil
+	}
+	return fmt.Errorf("error %d: %s", e.ErrCode, e.ErrMsg)
+}
+
+// NewWeChat makes WeChat provider
+func NewWeChat(params WeChatParams) (*WeChat, error) {
+	if params.AppID == "" || params.Secret == "" {
+		return nil, errors.New("no wechat appid or secret")
+	}
+	params.URL = strings.TrimSuffix(params.URL, "/")
+	if params.Lang == "" {
+		params.Lang = "en"
+	}
+	if params.Client == nil {
+		params.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	res := &WeChat{WeChatParams: params, now: time.Now, authURL: wechatAuthURL, tokenURL: wechatTokenURL, userURL: wechatUserURL}
+	res.requests = newPendingStore(wechatMaxRequests, errTooManyRequests, func(r wechatRequest) time.Time { return r.expires })
+	return res, nil
+}
+
+// Name returns provider name
+func (c *WeChat) Name() string { return "wechat" }
+
+func (c *WeChat) callbackURL() string { return c.URL + "/auth/wechat/callback" }
+
+// LoginHandler redirects to the QR-code login page of WeChat
+func (c *WeChat) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	aud := r.URL.Query().Get("site") // legacy, for back compat
+	if aud == "" {
+		aud = r.URL.Query().Get("aud")
+	}
+	req := wechatRequest{
+		from:    r.URL.Query().Get("from"),
+		aud:     aud,
+		session: r.URL.Query().Get("session") != "" && r.URL.Query().Get("session") != "0",
+		noAva:   r.URL.Query().Get("noava") == "1",
+		expires: c.now().Add(wechatRequestLifetime),
+	}
+	state := randomID()
+	if err := c.requests.add(state, req, c.now()); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusTooManyRequests, err, "can't start wechat login", rest.ErrActionRejected)
+		return
+	}
+
+	q := url.Values{
+		"appid":         {c.AppID},
+		"redirect_uri":  {c.callbackURL()},
+		"response_type": {"code"},
+		"scope":         {wechatScope},
+		"state":         {state},
+	}
+	// wechat documents the link with the fragment, it is required by the login page
+	http.Redirect(w, r, c.authURL+"?"+q.Encode()+"#wechat_redirect", http.StatusFound)
+}
+
+// AuthHandler handles callback from WeChat, gets the account with the authorization code and sets the token.
+// WeChat calls back without code if the user declined the login.
+func (c *WeChat) AuthHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := c.requests.take(r.URL.Query().Get("state"), c.now())
+	if !ok {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, errors.New("unknown state"), "unknown or expired login request",
+			rest.ErrNoAccess)
+		return
+	}
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, errors.New("no code"), "login rejected by wechat", rest.ErrNoAccess)
+		return
+	}
+
+	acc, err := c.account(code)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, err, "can't get wechat account", rest.ErrNoAccess)
+		return
+	}
+	u := wechatUser(acc)
+
+	if req.noAva {
+		u.Picture = "" // reset picture on no avatar request
+	}
+	if c.AvatarSaver != nil {
+		if u.Picture, err = c.AvatarSaver.Put(u, c.Client); err != nil {
+			rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "failed to save avatar to proxy", rest.ErrInternal)
+			return
+		}
+	}
+
+	claims := token.Claims{
+		User: &u,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:   c.Issuer,
+			ID:       randomID(),
+			Audience: []string{req.aud},
+		},
+		SessionOnly:  req.session,
+		NoAva:        req.noAva,
+		AuthProvider: &token.AuthProvider{Name: c.Name()},
+	}
+	if _, err = c.TokenService.Set(w, claims); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "failed to set token", rest.ErrInternal)
+		return
+	}
+	log.Printf("[DEBUG] wechat login of user %s", u.ID)
+
+	if req.from != "" && allowedRedirect(c.URL, c.AllowedRedirectHosts, req.from) {
+		http.Redirect(w, r, req.from, http.StatusSeeOther)
+		return
+	}
+	R.RenderJSON(w, &u)
+}
+
+// LogoutHandler resets the token
+func (c *WeChat) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if _, _, err := c.TokenService.Get(r); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, err, "logout not allowed", rest.ErrNoAccess)
+		return
+	}
+	c.TokenService.Reset(w)
+}
+
+// account exchanges authorization code for the access token and gets the account with it
+func (c *WeChat) account(code string) (wechatAccount, error) {
+	q := url.Values{
+		"appid":      {c.AppID},
+		"secret":     {c.Secret},
+		"code":       {code},
+		"grant_type": {"authorization_code"},
+	}
+	tkn := struct {
+		wechatError
+		AccessToken string `json:"access_token"`
+		OpenID      string `json:"openid"`
+		UnionID     string `json:"unionid"`
+	}{}
+	if err := c.get(c.tokenURL+"?"+q.Encode(), &tkn); err != nil {
+		return wechatAccount{}, fmt.Errorf("can't get access token: %w", err)
+	}
+	if err := tkn.err(); err != nil {
+		return wechatAccount{}, fmt.Errorf("can't get access token, %w", err)
+	}
+	if tkn.AccessToken == "" || tkn.OpenID == "" {
+		return wechatAccount{}, errors.New("no access token in response")
+	}
+
+	q = url.Values{
+		"access_token": {tkn.AccessToken},
+		"openid":       {tkn.OpenID},
+		"lang":         {c.Lang},
+	}
+	user := struct {
+		wechatError
+		wechatAccount
+	}{}
+	if err := c.get(c.userURL+"?"+q.Encode(), &user); err != nil {
+		return wechatAccount{}, fmt.Errorf("can't get user: %w", err)
+	}
+	if err := user.err(); err != nil {
+		return wechatAccount{}, fmt.Errorf("can't get user, %w", err)
+	}
+	if user.OpenID != tkn.OpenID {
+		return wechatAccount{}, fmt.Errorf("no user %s in response", tkn.OpenID)
+	}
+	acc := user.wechatAccount
+	if acc.UnionID == "" {
+		acc.UnionID = tkn.UnionID // returned with the token, if the app is bound to an Open Platform account
+	}
+	return acc, nil
+}
+
+// get makes request to wechat, all responses are 200 with errors in the body
+func (c *WeChat) get(u string, res any) error {
+	req, err := http.NewRequest(http.MethodGet, u, http.NoBody)
+	if err != nil {
+		return err
+	}
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck // nothing to do with the error
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s responded with status %d", req.URL.Path, resp.StatusCode)
+	}
+	// wechat responds with text/plain content type, the body is json anyway
+	if err = json.NewDecoder(io.LimitReader(resp.Body, wechatMaxResponseSize)).Decode(res); err != nil {
+		return fmt.Errorf("can't decode response of %s: %w", req.URL.Path, err)
+	}
+	return nil
+}
+
+// wechatUser makes the user from the account, with id of UnionID if known, OpenID otherwise.
+// Avatar links are http, upgraded to https supported by wechat's image servers.
+func wechatUser(acc wechatAccount) token.User {
+	id := acc.UnionID
+	if id == "" {
+		log.Printf("[DEBUG] no unionid of wechat user, openid used as id")
+		id = "openid:" + acc.OpenID
+	}
+	u := token.User{
+		ID:      "wechat_" + token.HashID(sha1.New(), id),
+		Name:    strings.TrimSpace(acc.Nickname),
+		Picture: acc.HeadImgURL,
+	}
+	if strings.HasPrefix(u.Picture, "http://") {
+		u.Picture = "https://" + strings.TrimPrefix(u.Picture, "http://")
+	}
+	if u.Name == "" {
+		u.Name = "noname_" + u.ID[7:11]
+	}
+	return u
+}
@@ -0,0 +1,221 @@
+package providers
+
+import (
+	"crypto/sha1" //nolint:gosec // same hashing of user id as in provider
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-pkgz/auth/v2/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewWeChat(t *testing.T) {
+	c, err := NewWeChat(WeChatParams{URL: "https://remark42.example.com/", AppID: "wx123", Secret: "secret"})
+	require.NoError(t, err)
+	assert.Equal(t, "wechat", c.Name())
+	assert.Equal(t, "https://remark42.example.com/auth/wechat/callback", c.callbackURL())
+	assert.Equal(t, "en", c.Lang)
+	assert.NotNil(t, c.Client)
+
+	_, err = NewWeChat(WeChatParams{URL: "https://remark42.example.com", AppID: "wx123"})
+	assert.EqualError(t, err, "no wechat appid or secret")
+}
+
+func TestWeChat_LoginAndCallback(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain") // as wechat does
+		switch r.URL.Path {
+		case "/access_token":
+			assert.Equal(t, "wx123", r.URL.Query().Get("appid"))
+			assert.Equal(t, "secret", r.URL.Query().Get("secret"))
+			assert.Equal(t, "authorization_code", r.URL.Query().Get("grant_type"))
+			switch r.URL.Query().Get("code") {
+			case "good-code":
+				_, _ = w.Write([]byte(`{"access_token":"tkn","expires_in":7200,"refresh_token":"rt","openid":"o1",` +
+					`"scope":"snsapi_login","unionid":"u1"}`))
+			default:
+				_, _ = w.Write([]byte(`{"errcode":40029,"errmsg":"invalid code"}`))
+			}
+		case "/userinfo":
+			assert.Equal(t, "tkn", r.URL.Query().Get("access_token"))
+			assert.Equal(t, "o1", r.URL.Query().Get("openid"))
+			assert.Equal(t, "en", r.URL.Query().Get("lang"))
+			_, _ = w.Write([]byte(`{"openid":"o1","nickname":"Xiao Ming","sex":1,"province":"","city":"","country":"CN",` +
+				`"headimgurl":"http://thirdwx.qlogo.cn/mmopen/abc/132","privilege":[],"unionid":"u1"}`))
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+	}))
+	defer ts.Close()
+
+	tokens := &mockTokenService{}
+	c := testWeChat(t, ts, tokens)
+	c.AvatarSaver = avatarSaverFunc(func(u token.User, client *http.Client) (string, error) {
+		assert.Equal(t, "https://thirdwx.qlogo.cn/mmopen/abc/132", u.Picture)
+		assert.NotNil(t, client)
+		return "https://remark42.example.com/api/v1/avatar/" + u.ID + ".image", nil
+	})
+
+	state := testWeChatLogin(t, c, "from=https%3A%2F%2Fblog.example.com%2Fpost&site=remark&session=1")
+	rr := httptest.NewRecorder()
+	c.AuthHandler(rr, testWeChatCallback(state, "good-code"))
+	require.Equal(t, http.StatusSeeOther, rr.Code, rr.Body.String())
+	assert.Equal(t, "https://blog.example.com/post", rr.Header().Get("Location"))
+
+	userID := "wechat_" + token.HashID(sha1.New(), "u1")
+	require.NotNil(t, tokens.claims.User)
+	assert.Equal(t, token.User{ID: userID, Name: "Xiao Ming",
+		Picture: "https://remark42.example.com/api/v1/avatar/" + userID + ".image"}, *tokens.claims.User)
+	assert.Equal(t, []string{"remark"}, []string(tokens.claims.Audience))
+	assert.True(t, tokens.claims.SessionOnly)
+	assert.Equal(t, "wechat", tokens.claims.AuthProvider.Name)
+
+	// state can't be used twice
+	rr = httptest.NewRecorder()
+	c.AuthHandler(rr, testWeChatCallback(state, "good-code"))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "unknown or expired login request")
+
+	// code rejected by wechat with 200 response
+	state = testWeChatLogin(t, c, "site=remark")
+	rr = httptest.NewRecorder()
+	c.AuthHandler(rr, testWeChatCallback(state, "bad-code"))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "can't get wechat account")
+
+	// login declined by user, callback without code
+	state = testWeChatLogin(t, c, "site=remark")
+	rr = httptest.NewRecorder()
+	c.AuthHandler(rr, httptest.NewRequest(http.MethodGet, "/auth/wechat/callback?state="+state, http.NoBody))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "login rejected by wechat")
+}
+
+func TestWeChat_Account(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/access_token":
+			switch code := r.URL.Query().Get("code"); code {
+			case "token-unionid":
+				_, _ = w.Write([]byte(`{"access_token":"tkn","openid":"o1","unionid":"u1"}`))
+			case "no-token":
+				_, _ = w.Write([]byte(`{"openid":"o1"}`))
+			default:
+				_, _ = fmt.Fprintf(w, `{"access_token":"tkn","openid":%q}`, code)
+			}
+		case "/userinfo":
+			switch r.URL.Query().Get("openid") {
+			case "o1":
+				_, _ = w.Write([]byte(`{"openid":"o1","nickname":"user1"}`))
+			case "o2":
+				_, _ = w.Write([]byte(`{"errcode":40003,"errmsg":"invalid openid"}`))
+			case "o3":
+				_, _ = w.Write([]byte(`{"openid":"other"}`))
+			default:
+				w.WriteHeader(http.StatusBadGateway)
+			}
+		}
+	}))
+	defer ts.Close()
+	c := testWeChat(t, ts, &mockTokenService{})
+
+	acc, err := c.account("token-unionid")
+	require.NoError(t, err)
+	assert.Equal(t, wechatAccount{OpenID: "o1", UnionID: "u1", Nickname: "user1"}, acc, "unionid of token response used")
+
+	acc, err = c.account("o1")
+	require.NoError(t, err)
+	assert.Empty(t, acc.UnionID)
+
+	_, err = c.account("no-token")
+	assert.EqualError(t, err, "no access token in response")
+	_, err = c.account("o2")
+	assert.EqualError(t, err, "can't get user, error 40003: invalid openid")
+	_, err = c.account("o3")
+	assert.EqualError(t, err, "no user o3 in response")
+	_, err = c.account("o4")
+	assert.EqualError(t, err, "can't get user: /userinfo responded with status 502")
+}
+
+func TestWeChat_Logout(t *testing.T) {
+	tokens := &mockTokenService{claims: token.Claims{User: &token.User{ID: "wechat_123"}}}
+	c, err := NewWeChat(WeChatParams{URL: "https://remark42.example.com", AppID: "wx123", Secret: "secret", TokenService: tokens})
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	c.LogoutHandler(rr, httptest.NewRequest(http.MethodGet, "/auth/wechat/logout", http.NoBody))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Nil(t, tokens.claims.User)
+}
+
+func TestWeChat_Requests(t *testing.T) {
+	c, err := NewWeChat(WeChatParams{URL: "https://remark42.example.com", AppID: "wx123", Secret: "secret"})
+	require.NoError(t, err)
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	require.NoError(t, c.requests.add("expired", wechatRequest{expires: now.Add(-time.Second)}, now))
+	_, ok := c.requests.take("expired", now)
+	assert.False(t, ok)
+
+	for i := range wechatMaxRequests - 1 {
+		c.requests.data[fmt.Sprintf("r%d", i)] = wechatRequest{expires: now.Add(time.Minute)}
+	}
+	require.NoError(t, c.requests.add("last", wechatRequest{expires: now.Add(time.Minute)}, now))
+	assert.EqualError(t, c.requests.add("extra", wechatRequest{expires: now.Add(time.Minute)}, now), "too many pending login requests")
+	now = now.Add(2 * time.Minute)
+	assert.NoError(t, c.requests.add("extra", wechatRequest{expires: now.Add(time.Minute)}, now), "expired requests dropped")
+	assert.Len(t, c.requests.data, 1)
+}
+
+func TestWeChatUser(t *testing.T) {
+	u := wechatUser(wechatAccount{OpenID: "o1", UnionID: "u1", Nickname: " user1 "})
+	assert.Equal(t, token.User{ID: "wechat_" + token.HashID(sha1.New(), "u1"), Name: "user1"}, u)
+
+	u = wechatUser(wechatAccount{OpenID: "o1"})
+	assert.Equal(t, "wechat_"+token.HashID(sha1.New(), "openid:o1"), u.ID, "openid used without unionid")
+	assert.Equal(t, "noname_"+u.ID[7:11], u.Name)
+	assert.NotEqual(t, u.ID, wechatUser(wechatAccount{UnionID: "o1"}).ID, "openid and unionid never collide")
+}
+
+func testWeChat(t *testing.T, ts *httptest.Server, tokens *mockTokenService) *WeChat {
+	c, err := NewWeChat(WeChatParams{URL: "https://remark42.example.com", AppID: "wx123", Secret: "secret", Client: ts.Client(),
+		TokenService: tokens,
+		AllowedRedirectHosts: token.AllowedHostsFunc(func() ([]string, error) {
+			return []string{"blog.example.com"}, nil
+		})})
+	require.NoError(t, err)
+	c.authURL = ts.URL + "/qrconnect"
+	c.tokenURL = ts.URL + "/access_token"
+	c.userURL = ts.URL + "/userinfo"
+	return c
+}
+
+// testWeChatLogin starts login and returns state passed to wechat
+func testWeChatLogin(t *testing.T, c *WeChat, query string) string {
+	rr := httptest.NewRecorder()
+	c.LoginHandler(rr, httptest.NewRequest(http.MethodGet, "/auth/wechat/login?"+query, http.NoBody))
+	require.Equal(t, http.StatusFound, rr.Code)
+	assert.True(t, strings.HasSuffix(rr.Header().Get("Location"), "#wechat_redirect"))
+	loc, err := url.Parse(rr.Header().Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, c.authURL, loc.Scheme+"://"+loc.Host+loc.Path)
+	assert.Equal(t, "wx123", loc.Query().Get("appid"))
+	assert.Empty(t, loc.Query().Get("client_id"))
+	assert.Equal(t, "code", loc.Query().Get("response_type"))
+	assert.Equal(t, "snsapi_login", loc.Query().Get("scope"))
+	assert.Equal(t, "https://remark42.example.com/auth/wechat/callback", loc.Query().Get("redirect_uri"))
+	state := loc.Query().Get("state")
+	require.NotEmpty(t, state)
+	return state
+}
+
+func testWeChatCallback(state, code string) *http.Request {
+	q := url.Values{"state": {state}, "code": {code}}
+	return httptest.NewRequest(http.MethodGet, "/auth/wechat/callback?"+q.Encode(), http.NoBody)
+}
@@ -0,0 +1,190 @@
+// Package resilient provides HTTP transport for remote stores, retrying requests failed before reaching
+// the remote server and protecting it with a circuit breaker, so transient network or backend blips
+// don't turn into user-visible errors and a failed backend isn't hammered by requests.
+package resilient
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+)
+
+// ErrBreakerOpen returned for requests rejected while the circuit breaker is open
+var ErrBreakerOpen = errors.New("circuit breaker open")
+
+// State of the circuit breaker
+type State int
+
+// circuit breaker states
+const (
+	StateClosed   State = iota // requests pass
+	StateOpen                  // requests rejected
+	StateHalfOpen              // single trial request passes
+)
+
+// String returns name of the state
+func (s State) String() string {
+	switch s {
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (s State) MarshalText() ([]byte, error) { return []byte(s.String()), nil }
+
+// Transport is http.RoundTripper retrying requests failed before reaching the remote server, i.e. on dial errors
+// and 502 or 503 responses, so writes are never duplicated. After Threshold consecutive failures the breaker
+// opens and rejects requests for Cooldown, then lets a single trial request through to decide if it should close.
+type Transport struct {
+	Name      string            // used in logs and stats, like "store"
+	Base      http.RoundTripper // http.DefaultTransport if not set
+	Retries   int               // retries of a failed request
+	Backoff   time.Duration     // delay before the first retry, doubled for each next one, with jitter
+	Threshold int               // consecutive failures opening the breaker, breaker disabled if 0
+	Cooldown  time.Duration     // time breaker stays open before a trial request
+
+	mu       sync.Mutex
+	state    State
+	failures int // consecutive failures
+	openedAt time.Time
+	trial    bool // trial request in flight
+	retried  int64
+	rejected int64
+}
+
+// Stats of the transport
+type Stats struct {
+	Name     string    `json:"name"`
+	State    State     `json:"state"`
+	Failures int       `json:"failures"` // consecutive failures
+	Retried  int64     `json:"retried"`
+	Rejected int64     `json:"rejected"` // by open breaker
+	OpenedAt time.Time `json:"opened_at,omitzero"`
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.allow(); err != nil {
+		return nil, fmt.Errorf("%s: %w", t.Name, err)
+	}
+	resp, err := t.send(req)
+	t.record(err != nil || resp.StatusCode >= http.StatusInternalServerError)
+	return resp, err
+}
+
+// Stats returns current state of the transport
+func (t *Transport) Stats() Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	res := Stats{Name: t.Name, State: t.state, Failures: t.failures, Retried: t.retried, Rejected: t.rejected}
+	if t.state != StateClosed {
+		res.OpenedAt = t.openedAt
+	}
+	return res
+}
+
+// send makes request, retrying it if it didn't reach the remote server
+func (t *Transport) send(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	backoff := t.Backoff
+	for attempt := 0; ; attempt++ {
+		resp, err := base.RoundTrip(req)
+		if attempt >= t.Retries || !replayable || !retryable(resp, err) {
+			return resp, err
+		}
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+
+		delay := backoff/2 + rand.N(backoff/2+1) //nolint:gosec // jitter doesn't need crypto rand
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+		backoff *= 2
+
+		if req.GetBody != nil {
+			body, e := req.GetBody()
+			if e != nil {
+				return nil, fmt.Errorf("can't get body for retry: %w", e)
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+		t.mu.Lock()
+		t.retried++
+		t.mu.Unlock()
+		log.Printf("[DEBUG] retry %d of %s request to %s", attempt+1, t.Name, req.URL.Host)
+	}
+}
+
+// allow checks if request can pass the breaker
+func (t *Transport) allow() error {
+	if t.Threshold <= 0 {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch t.state {
+	case StateOpen:
+		if time.Since(t.openedAt) < t.Cooldown {
+			t.rejected++
+			return ErrBreakerOpen
+		}
+		t.state, t.trial = StateHalfOpen, true
+	case StateHalfOpen:
+		if t.trial {
+			t.rejected++
+			return ErrBreakerOpen
+		}
+		t.trial = true
+	}
+	return nil
+}
+
+// record result of request and switch breaker state
+func (t *Transport) record(failed bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.trial = false
+	if !failed {
+		if t.state != StateClosed {
+			log.Printf("[INFO] %s circuit breaker closed", t.Name)
+		}
+		t.state, t.failures = StateClosed, 0
+		return
+	}
+	t.failures++
+	if t.Threshold > 0 && t.state != StateOpen && (t.state == StateHalfOpen || t.failures >= t.Threshold) {
+		t.state, t.openedAt = StateOpen, time.Now()
+		log.Printf("[WARN] %s circuit breaker open after %d failures, cooldown %v", t.Name, t.failures, t.Cooldown)
+	}
+}
+
+// retryable checks if request failed before reaching the remote server
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		var opErr *net.OpError
+		var dnsErr *net.DNSError
+		return (errors.As(err, &opErr) && opErr.Op == "dial") || errors.As(err, &dnsErr)
+	}
+	return resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusServiceUnavailable
+}
@@ -0,0 +1,149 @@
+package resilient
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransport_Retry(t *testing.T) {
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "payload", string(body), "body replayed")
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	tr := &Transport{Name: "store", Retries: 2, Backoff: time.Millisecond}
+	client := http.Client{Transport: tr}
+	resp, err := client.Post(ts.URL, "text/plain", bytes.NewBufferString("payload"))
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "ok", string(body))
+	assert.Equal(t, int32(3), calls.Load())
+	assert.Equal(t, Stats{Name: "store", State: StateClosed, Retried: 2}, tr.Stats())
+
+	// retries exhausted, the last response returned
+	calls.Store(-10)
+	resp, err = client.Post(ts.URL, "text/plain", bytes.NewBufferString("payload"))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, int32(-7), calls.Load())
+	assert.Equal(t, 1, tr.Stats().Failures)
+}
+
+func TestTransport_NoRetryAfterReached(t *testing.T) {
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	tr := &Transport{Name: "store", Retries: 3, Backoff: time.Millisecond}
+	resp, err := (&http.Client{Transport: tr}).Get(ts.URL)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Equal(t, int32(1), calls.Load(), "request processed by the server, not retried")
+}
+
+func TestTransport_RetryDialError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	require.NoError(t, ln.Close()) // nothing listens on the port
+
+	tr := &Transport{Name: "image", Retries: 2, Backoff: time.Millisecond}
+	_, err = (&http.Client{Transport: tr}).Get("http://" + addr)
+	require.Error(t, err)
+	assert.Equal(t, int64(2), tr.Stats().Retried)
+}
+
+func TestTransport_Breaker(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer ts.Close()
+
+	tr := &Transport{Name: "store", Threshold: 2, Cooldown: 50 * time.Millisecond}
+	client := http.Client{Transport: tr}
+	get := func() error {
+		resp, err := client.Get(ts.URL)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+
+	require.NoError(t, get())
+	assert.Equal(t, StateClosed, tr.Stats().State)
+	require.NoError(t, get())
+	assert.Equal(t, StateOpen, tr.Stats().State, "opened after 2 failures")
+	assert.False(t, tr.Stats().OpenedAt.IsZero())
+
+	err := get()
+	require.ErrorIs(t, err, ErrBreakerOpen)
+	assert.Equal(t, int32(2), calls.Load(), "rejected without a call")
+	assert.Equal(t, int64(1), tr.Stats().Rejected)
+
+	// trial request after cooldown fails and opens the breaker again
+	time.Sleep(60 * time.Millisecond)
+	require.NoError(t, get())
+	assert.Equal(t, StateOpen, tr.Stats().State)
+	require.ErrorIs(t, get(), ErrBreakerOpen)
+
+	// successful trial closes the breaker
+	failing.Store(false)
+	time.Sleep(60 * time.Millisecond)
+	require.NoError(t, get())
+	assert.Equal(t, Stats{Name: "store", State: StateClosed, Rejected: 2}, tr.Stats())
+	require.NoError(t, get())
+	assert.Equal(t, int32(5), calls.Load())
+}
+
+func TestTransport_HalfOpenSingleTrial(t *testing.T) {
+	tr := &Transport{Name: "store", Threshold: 1, Cooldown: time.Millisecond}
+	tr.record(true)
+	time.Sleep(5 * time.Millisecond)
+	require.NoError(t, tr.allow(), "trial passes")
+	assert.Equal(t, StateHalfOpen, tr.Stats().State)
+	require.ErrorIs(t, tr.allow(), ErrBreakerOpen, "only one trial at a time")
+	tr.record(false)
+	assert.Equal(t, StateClosed, tr.Stats().State)
+	require.NoError(t, tr.allow())
+}
+
+func TestStats_JSON(t *testing.T) {
+	b, err := json.Marshal(Stats{Name: "store", State: StateHalfOpen, OpenedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"name":"store","state":"half-open","failures":0,"retried":0,"rejected":0,"opened_at":"2024-01-01T00:00:00Z"}`, string(b))
+	b, err = json.Marshal(Stats{Name: "image"})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"name":"image","state":"closed","failures":0,"retried":0,"rejected":0}`, string(b))
+}
@@ -1,10 +1,17 @@
 package api
 
 import (
+	"cmp"
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"path"
+	"strconv"
 	"strings"
 	"time"
 
@@ -13,34 +20,193 @@ import (
 	cache "github.com/go-pkgz/lcw/v2"
 	log "github.com/go-pkgz/lgr"
 	R "github.com/go-pkgz/rest"
+	"github.com/skip2/go-qrcode"
 
+	"github.com/umputun/remark42/backend/app/notify"
+	"github.com/umputun/remark42/backend/app/resilient"
 	"github.com/umputun/remark42/backend/app/rest"
+	"github.com/umputun/remark42/backend/app/rest/cdn"
+	"github.com/umputun/remark42/backend/app/rest/shadow"
 	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/asset"
+	"github.com/umputun/remark42/backend/app/store/bot"
+	"github.com/umputun/remark42/backend/app/store/brigade"
+	"github.com/umputun/remark42/backend/app/store/cold"
 	"github.com/umputun/remark42/backend/app/store/engine"
+	"github.com/umputun/remark42/backend/app/store/event"
+	"github.com/umputun/remark42/backend/app/store/invite"
+	"github.com/umputun/remark42/backend/app/store/page"
+	"github.com/umputun/remark42/backend/app/store/poll"
+	"github.com/umputun/remark42/backend/app/store/quota"
+	"github.com/umputun/remark42/backend/app/store/schedule"
+	"github.com/umputun/remark42/backend/app/store/service"
+	"github.com/umputun/remark42/backend/app/store/suppress"
 )
 
 // admin provides router for all requests available for admin users only
 type admin struct {
-	dataService   adminStore
-	cache         LoadingCache
-	authenticator *auth.Service
-	readOnlyAge   int
-	migrator      *Migrator
+	dataService      adminStore
+	cache            LoadingCache
+	authenticator    *auth.Service
+	tokens           *rest.TokenRotation
+	readOnlyAge      int
+	migrator         *Migrator
+	commentFormatter *store.CommentFormatter
+	notifyService    *notify.Service
+	maintenance      *rest.Maintenance
+	shadow           *shadow.Mirror
+	cspReports       *rest.CSPReports
+	cors             *rest.CORSPolicies
+	remotes          []*resilient.Transport
+	remarkURL        string
+	totp             AdminTOTP
+	adminCert        AdminCertPolicy
+	sharedSecret     string
+
+	disableFancyTextFormatting bool // disables SmartyPants in the comment text rendering of the posted comments
 }
 
 type adminStore interface {
 	Delete(locator store.Locator, commentID string, mode store.DeleteMode) error
 	DeleteUser(siteID, userID string, mode store.DeleteMode) error
+	MergeUser(siteID, fromID, toID string) (engine.MergeResult, error)
 	DeleteUserDetail(siteID, userID string, detail engine.UserDetail) error
+	ResetUserProfile(siteID, userID string) error
 	User(siteID, userID string, limit, skip int, user store.User) ([]store.Comment, error)
 	IsBlocked(siteID, userID string) bool
 	SetBlock(siteID, userID string, status bool, ttl time.Duration) error
+	SetBlockReason(siteID, userID, reason string) error
 	BlockedUsers(siteID string) ([]store.BlockedUser, error)
 	Info(locator store.Locator, readonlyAge int) (store.PostInfo, error)
 	SetTitle(locator store.Locator, commentID string) (comment store.Comment, err error)
 	SetVerified(siteID, userID string, status bool) error
 	SetReadOnly(locator store.Locator, status bool) error
 	SetPin(locator store.Locator, commentID string, status bool) error
+	Approve(locator store.Locator, commentID string) error
+	Pending(siteID string) ([]store.Comment, error)
+	WelcomeMessage(c store.Comment) (string, error)
+	SuppressLateNotify(c store.Comment) bool
+	NotifyDestinations(c store.Comment) ([]string, error)
+	SiteEditPolicy(siteID string) service.EditPolicy
+	SetEditPolicy(siteID string, policy service.EditPolicy) error
+	ResetEditPolicy(siteID string) error
+	SiteCollapsePolicy(siteID string) service.CollapsePolicy
+	SetCollapsePolicy(siteID string, policy service.CollapsePolicy) error
+	ResetCollapsePolicy(siteID string) error
+	SiteExprPolicy(siteID string) service.ExprPolicy
+	SetExprPolicy(siteID string, policy service.ExprPolicy) error
+	ResetExprPolicy(siteID string) error
+	Get(locator store.Locator, commentID string, user store.User) (store.Comment, error)
+	Create(comment store.Comment) (commentID string, err error)
+	ImportComment(comment store.Comment, by string) (commentID string, err error)
+	ListCannedResponses(siteID string) []service.CannedResponse
+	GetCannedResponse(siteID, id string) (service.CannedResponse, error)
+	SetCannedResponse(siteID string, resp service.CannedResponse) error
+	DeleteCannedResponse(siteID, id string) error
+	SetPoll(p poll.Poll) (poll.Results, error)
+	DeletePoll(locator store.Locator) error
+	SetHighlight(locator store.Locator, commentID string, status bool, note string) error
+	ClientStatsReport(siteID string) (service.ClientStatsReport, error)
+	Users(req service.UsersRequest) (users []service.SiteUser, total int, err error)
+	UserSummary(siteID, userID string, recent int, user store.User) (service.SiteUserDetail, error)
+	ReencryptDetails(siteID string) (int, error)
+	StartReindex(siteID string, onDone func()) error
+	Assets(siteID string) ([]asset.Asset, error)
+	SaveAsset(siteID, name string, rd io.Reader) (asset.Asset, error)
+	DeleteAsset(siteID, name string) error
+	ArchiveThread(locator store.Locator, readOnlyAge int, remove bool) (asset.Asset, error)
+	ColdPosts(siteID string) ([]cold.Segment, error)
+	FreezePosts(siteID string, inactive time.Duration) (int, error)
+	ThawPost(locator store.Locator) error
+	Controversial(siteID string, since time.Time, limit int) ([]store.Comment, error)
+	BrigadeAlerts(siteID string) ([]brigade.Alert, error)
+	VoidBrigade(siteID, id string) (store.Comment, int, error)
+	DismissBrigade(siteID, id string) error
+	PagesSettings(siteID string) ([]page.Settings, error)
+	SetPageSort(locator store.Locator, sort string) error
+	SetPageLive(locator store.Locator, live bool) error
+	SetPageRegistered(locator store.Locator, registered bool) error
+	ReindexStatus(siteID string) (service.ReindexStatus, bool)
+	StartRerender(siteID string, onDone func()) error
+	RerenderStatus(siteID string) (service.RerenderStatus, bool)
+	CheckIntegrity(siteID string) (service.IntegrityReport, error)
+	RevokeTokens(siteID, userID string) (time.Time, error)
+	IntegrityReport(siteID string) (service.IntegrityReport, bool)
+	ModeratedUsers(siteID string) ([]service.ModeratedUser, error)
+	ImportModeratedUsers(siteID string, users []service.ModeratedUser) (int, error)
+	Events(siteID string, after uint64, limit int) ([]event.Event, error)
+	SiteQuota(siteID string) (service.QuotaInfo, error)
+	SetQuotaLimits(siteID string, limits quota.Limits) error
+	ResetQuotaLimits(siteID string) error
+	IsAdmin(siteID, userID string) bool
+	CreateInvite(createdBy, role string, sites []string, ttl time.Duration) (invite.Invitation, error)
+	Invites(siteID string) ([]invite.Invitation, error)
+	DeleteInvite(siteID, id string) error
+	CreateBot(siteID, name, picture, createdBy string) (bot.Bot, string, error)
+	Bots(siteID string) ([]bot.Bot, error)
+	DeleteBot(siteID, id string) error
+	Grants(siteID string) ([]invite.Grant, error)
+	RevokeGrant(siteID, userID string) error
+	Roles(siteID string) ([]service.RoleAssignment, error)
+	SetRole(siteID, userID, role string) error
+	ScheduleAction(a schedule.Action) (schedule.Action, error)
+	ScheduledActions(siteID string) ([]schedule.Action, error)
+	CancelAction(siteID, id string) error
+	EmailSuppressions() ([]suppress.Suppression, error)
+	ReinstateEmail(address string) error
+	TOTP(siteID, userID string) (service.TOTP, error)
+	SetTOTP(siteID, userID string, totp service.TOTP) error
+	CheckTOTP(siteID, userID, code string, at time.Time) (bool, error)
+}
+
+// AdminTOTP defines TOTP second factor required from admins. Admin API allowed for some time after the code
+// of admin's authenticator app verified, admins without enrolled authenticator allowed to enroll only.
+type AdminTOTP struct {
+	Enabled  bool
+	Issuer   string        // issuer shown by authenticator apps
+	TTL      time.Duration // admin API allowed for after verified code
+	SameSite http.SameSite // same site policy of step-up cookie
+}
+
+const totpCookieName, totpHeaderName = "TOTP-TOKEN", "X-Remark42-TOTP" // step-up token of verified totp code
+
+const (
+	defaultUsersLimit  = 50   // users per page if limit not set
+	maxUsersLimit      = 500  // max users per page
+	defaultUserRecent  = 10   // recent comments in user summary if limit not set
+	defaultEventsLimit = 100  // events per page if limit not set
+	maxEventsLimit     = 1000 // max events per page
+	defaultControLimit = 20   // controversial comments if limit not set
+	maxControLimit     = 200  // max controversial comments
+
+	maxAssetBody = 10 * 1024 * 1024 // hard limit of uploaded asset, site limits checked by the service
+
+	defaultTOTPTTL = 12 * time.Hour // admin API allowed for after verified totp code if ttl not set
+)
+
+// editPolicyInfo is the edit policy with durations in seconds, used by edit policy endpoints and config
+type editPolicyInfo struct {
+	Duration         int `json:"duration"`
+	VerifiedDuration int `json:"verified_duration"`
+	AdminDuration    int `json:"admin_duration"`
+}
+
+func newEditPolicyInfo(policy service.EditPolicy) editPolicyInfo {
+	return editPolicyInfo{
+		Duration:         int(policy.Duration.Seconds()),
+		VerifiedDuration: int(policy.VerifiedDuration.Seconds()),
+		AdminDuration:    int(policy.AdminDuration.Seconds()),
+	}
+}
+
+// collapseInfo is the collapse policy of low-score comments, used by collapse policy endpoints and config
+type collapseInfo struct {
+	Mode      string `json:"mode"` // "collapse", "hide" or empty if disabled
+	Threshold int    `json:"threshold"`
+}
+
+func newCollapseInfo(policy service.CollapsePolicy) collapseInfo {
+	return collapseInfo{Mode: string(policy.Mode), Threshold: policy.Threshold}
 }
 
 // DELETE /comment/{id}?site=siteID&url=post-url - removes comment
@@ -54,10 +220,51 @@ func (a *admin) deleteCommentCtrl(w http.ResponseWriter, r *http.Request) {
 		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't delete comment", rest.ErrInternal)
 		return
 	}
-	a.cache.Flush(cache.Flusher(locator.SiteID).Scopes(locator.SiteID, locator.URL, lastCommentsScope))
+	cdn.Flush(a.cache, locator.SiteID, locator.SiteID, locator.URL, lastCommentsScope)
 	R.RenderJSON(w, R.JSON{"id": id, "locator": locator})
 }
 
+// POST /comment/import?site=site-id - create comment with the author, time and parent from the body, for migrations and
+// bridging bots. The comment is marked as imported, its text is markdown formatted as the text of the posted comments.
+func (a *admin) importCommentCtrl(w http.ResponseWriter, r *http.Request) {
+	user := rest.MustGetUserInfo(r)
+	req := struct {
+		ID        string    `json:"id"`
+		ParentID  string    `json:"pid"`
+		URL       string    `json:"url"`
+		Title     string    `json:"title"`
+		Text      string    `json:"text"`
+		Timestamp time.Time `json:"time"`
+		User      struct {
+			ID      string `json:"id"`
+			Name    string `json:"name"`
+			Picture string `json:"picture"`
+		} `json:"user"`
+	}{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, hardBodyLimit)).Decode(&req); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't bind comment", rest.ErrDecode)
+		return
+	}
+
+	locator := store.Locator{SiteID: r.URL.Query().Get("site"), URL: req.URL}
+	comment := store.Comment{ID: req.ID, ParentID: req.ParentID, Text: req.Text, Orig: req.Text, PostTitle: req.Title,
+		Timestamp: req.Timestamp, Locator: locator, User: store.User{ID: req.User.ID, Name: req.User.Name, Picture: req.User.Picture}}
+	comment = a.commentFormatter.Format(comment, a.disableFancyTextFormatting)
+	commentID, err := a.dataService.ImportComment(comment, user.ID)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't import comment", rest.ErrCommentRejected)
+		return
+	}
+
+	res, err := a.dataService.Get(locator, commentID, user)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't load imported comment", rest.ErrInternal)
+		return
+	}
+	cdn.Flush(a.cache, locator.SiteID, locator.URL, lastCommentsScope, comment.User.ID, locator.SiteID)
+	_ = R.EncodeJSON(w, http.StatusCreated, &res)
+}
+
 // DELETE /user/{userid}?site=side-id - delete all user comments for requested userid
 func (a *admin) deleteUserCtrl(w http.ResponseWriter, r *http.Request) {
 	userID := r.PathValue("userid")
@@ -68,10 +275,399 @@ func (a *admin) deleteUserCtrl(w http.ResponseWriter, r *http.Request) {
 		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't delete user", rest.ErrInternal)
 		return
 	}
-	a.cache.Flush(cache.Flusher(siteID).Scopes(userID, siteID, lastCommentsScope))
+	cdn.Flush(a.cache, siteID, userID, siteID, lastCommentsScope)
+	R.RenderJSON(w, R.JSON{"user_id": userID, "site_id": siteID})
+}
+
+// POST /user/{userid}/merge?site=site-id&to=target-id - re-attributes all comments and votes of the user to the target user,
+// next logins of the merged user made as the target one
+func (a *admin) mergeUserCtrl(w http.ResponseWriter, r *http.Request) {
+	userID, siteID, toID := r.PathValue("userid"), r.URL.Query().Get("site"), r.URL.Query().Get("to")
+	if toID == "" {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, errors.New("missing target user"), "can't merge user", rest.ErrActionRejected)
+		return
+	}
+	res, err := a.dataService.MergeUser(siteID, userID, toID)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't merge user", rest.ErrActionRejected)
+		return
+	}
+	log.Printf("[INFO] user %s merged to %s on %s by %s", userID, toID, siteID, rest.MustGetUserInfo(r).ID)
+	cdn.Flush(a.cache, siteID, userID, toID, siteID, lastCommentsScope)
+	R.RenderJSON(w, R.JSON{"user_id": userID, "to": toID, "site_id": siteID, "merged": res})
+}
+
+// POST /user/{userid}/logout?site=site-id - revokes all tokens of the user, logging the user out on all devices
+func (a *admin) logoutUserCtrl(w http.ResponseWriter, r *http.Request) {
+	userID, siteID := r.PathValue("userid"), r.URL.Query().Get("site")
+	notBefore, err := a.dataService.RevokeTokens(siteID, userID)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't revoke tokens", rest.ErrInternal)
+		return
+	}
+	log.Printf("[INFO] user %s logged out on %s by %s", userID, siteID, rest.MustGetUserInfo(r).ID)
+	R.RenderJSON(w, R.JSON{"user_id": userID, "site_id": siteID, "not_before": notBefore})
+}
+
+// DELETE /user/{userid}/profile?site=side-id - resets user-selected display name and pronouns
+func (a *admin) resetUserProfileCtrl(w http.ResponseWriter, r *http.Request) {
+	userID := r.PathValue("userid")
+	siteID := r.URL.Query().Get("site")
+	log.Printf("[INFO] reset profile for %s, site %s", userID, siteID)
+
+	if err := a.dataService.ResetUserProfile(siteID, userID); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't reset user profile", rest.ErrInternal)
+		return
+	}
+	cdn.Flush(a.cache, siteID, userID, siteID, lastCommentsScope)
 	R.RenderJSON(w, R.JSON{"user_id": userID, "site_id": siteID})
 }
 
+// GET /edit-policy?site=site-id - get edit window policy for the site
+func (a *admin) getEditPolicyCtrl(w http.ResponseWriter, r *http.Request) {
+	R.RenderJSON(w, newEditPolicyInfo(a.dataService.SiteEditPolicy(r.URL.Query().Get("site"))))
+}
+
+// PUT /edit-policy?site=site-id - change edit window policy for the site, durations in seconds
+func (a *admin) setEditPolicyCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID := r.URL.Query().Get("site")
+	info := editPolicyInfo{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, hardBodyLimit)).Decode(&info); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't bind edit policy", rest.ErrDecode)
+		return
+	}
+	policy := service.EditPolicy{
+		Duration:         time.Duration(info.Duration) * time.Second,
+		VerifiedDuration: time.Duration(info.VerifiedDuration) * time.Second,
+		AdminDuration:    time.Duration(info.AdminDuration) * time.Second,
+	}
+	log.Printf("[INFO] set edit policy %+v for site %s", info, siteID)
+	if err := a.dataService.SetEditPolicy(siteID, policy); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't set edit policy", rest.ErrActionRejected)
+		return
+	}
+	R.RenderJSON(w, newEditPolicyInfo(a.dataService.SiteEditPolicy(siteID)))
+}
+
+// DELETE /edit-policy?site=site-id - reset edit window policy for the site to the default one
+func (a *admin) resetEditPolicyCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID := r.URL.Query().Get("site")
+	log.Printf("[INFO] reset edit policy for site %s", siteID)
+	if err := a.dataService.ResetEditPolicy(siteID); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't reset edit policy", rest.ErrActionRejected)
+		return
+	}
+	R.RenderJSON(w, newEditPolicyInfo(a.dataService.SiteEditPolicy(siteID)))
+}
+
+// GET /collapse-policy?site=site-id - get collapse policy of low-score comments for the site
+func (a *admin) getCollapsePolicyCtrl(w http.ResponseWriter, r *http.Request) {
+	R.RenderJSON(w, newCollapseInfo(a.dataService.SiteCollapsePolicy(r.URL.Query().Get("site"))))
+}
+
+// PUT /collapse-policy?site=site-id - change collapse policy of low-score comments for the site
+func (a *admin) setCollapsePolicyCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID := r.URL.Query().Get("site")
+	info := collapseInfo{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, hardBodyLimit)).Decode(&info); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't bind collapse policy", rest.ErrDecode)
+		return
+	}
+	log.Printf("[INFO] set collapse policy %+v for site %s", info, siteID)
+	policy := service.CollapsePolicy{Mode: service.CollapseMode(info.Mode), Threshold: info.Threshold}
+	if err := a.dataService.SetCollapsePolicy(siteID, policy); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't set collapse policy", rest.ErrActionRejected)
+		return
+	}
+	cdn.Flush(a.cache, siteID, siteID)
+	R.RenderJSON(w, newCollapseInfo(a.dataService.SiteCollapsePolicy(siteID)))
+}
+
+// DELETE /collapse-policy?site=site-id - reset collapse policy of low-score comments for the site to the default one
+func (a *admin) resetCollapsePolicyCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID := r.URL.Query().Get("site")
+	log.Printf("[INFO] reset collapse policy for site %s", siteID)
+	if err := a.dataService.ResetCollapsePolicy(siteID); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't reset collapse policy", rest.ErrActionRejected)
+		return
+	}
+	cdn.Flush(a.cache, siteID, siteID)
+	R.RenderJSON(w, newCollapseInfo(a.dataService.SiteCollapsePolicy(siteID)))
+}
+
+// GET /expr-policy?site=site-id - get moderation and notification routing expressions of the site
+func (a *admin) getExprPolicyCtrl(w http.ResponseWriter, r *http.Request) {
+	R.RenderJSON(w, a.dataService.SiteExprPolicy(r.URL.Query().Get("site")))
+}
+
+// PUT /expr-policy?site=site-id - change moderation and notification routing expressions of the site,
+// expressions are compiled and rejected if invalid
+func (a *admin) setExprPolicyCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID := r.URL.Query().Get("site")
+	policy := service.ExprPolicy{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, hardBodyLimit)).Decode(&policy); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't bind expression policy", rest.ErrDecode)
+		return
+	}
+	log.Printf("[INFO] set expression policy %+v for site %s", policy, siteID)
+	if err := a.dataService.SetExprPolicy(siteID, policy); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't set expression policy", rest.ErrActionRejected)
+		return
+	}
+	R.RenderJSON(w, a.dataService.SiteExprPolicy(siteID))
+}
+
+// DELETE /expr-policy?site=site-id - reset expressions of the site to the default ones
+func (a *admin) resetExprPolicyCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID := r.URL.Query().Get("site")
+	log.Printf("[INFO] reset expression policy for site %s", siteID)
+	if err := a.dataService.ResetExprPolicy(siteID); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't reset expression policy", rest.ErrActionRejected)
+		return
+	}
+	R.RenderJSON(w, a.dataService.SiteExprPolicy(siteID))
+}
+
+// POST /invite?site=site-id - make invitation for a new admin, body is {"sites": ["site-id"], "role": "admin", "ttl": 86400},
+// all optional. Sites are the current one if not set, ttl is in seconds. Admins can invite to their own sites only.
+func (a *admin) createInviteCtrl(w http.ResponseWriter, r *http.Request) {
+	user := rest.MustGetUserInfo(r)
+	siteID := r.URL.Query().Get("site")
+	req := struct {
+		Sites []string `json:"sites"`
+		Role  string   `json:"role"`
+		TTL   int      `json:"ttl"`
+	}{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, hardBodyLimit)).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't bind invitation", rest.ErrDecode)
+		return
+	}
+	if len(req.Sites) == 0 {
+		req.Sites = []string{siteID}
+	}
+	for _, site := range req.Sites {
+		if user.ID != "admin" && !a.dataService.IsAdmin(site, user.ID) { // basic auth admin can invite to any site
+			rest.SendErrorJSON(w, r, http.StatusForbidden, fmt.Errorf("%s is not admin of %s", user.ID, site),
+				"can't invite to the site", rest.ErrActionRejected)
+			return
+		}
+	}
+
+	inv, err := a.dataService.CreateInvite(user.ID, req.Role, req.Sites, time.Duration(req.TTL)*time.Second)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't make invitation", rest.ErrActionRejected)
+		return
+	}
+	log.Printf("[INFO] %s invited %s of %v, expires %s", user.ID, inv.Role, inv.Sites, inv.Expires.Format(time.RFC3339))
+	R.RenderJSON(w, R.JSON{"invitation": inv, "link": a.remarkURL + "/invite.html?id=" + inv.ID})
+}
+
+// GET /invites?site=site-id - list invitations to the site, newest first
+func (a *admin) listInvitesCtrl(w http.ResponseWriter, r *http.Request) {
+	invs, err := a.dataService.Invites(r.URL.Query().Get("site"))
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't list invitations", rest.ErrActionRejected)
+		return
+	}
+	R.RenderJSON(w, invs)
+}
+
+// DELETE /invite/{id}?site=site-id - cancel the invitation, roles already granted by it are kept
+func (a *admin) deleteInviteCtrl(w http.ResponseWriter, r *http.Request) {
+	id, siteID := r.PathValue("id"), r.URL.Query().Get("site")
+	if err := a.dataService.DeleteInvite(siteID, id); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't delete invitation", rest.ErrActionRejected)
+		return
+	}
+	log.Printf("[INFO] invitation %.8s... to %s deleted by %s", id, siteID, rest.MustGetUserInfo(r).ID)
+	R.RenderJSON(w, R.JSON{"id": id, "deleted": true})
+}
+
+// POST /bot?site=site-id - create bot account of the site, body is {"name":"bot name","picture":"avatar-url"}.
+// Returns the bot with api key, the key can't be retrieved later.
+func (a *admin) createBotCtrl(w http.ResponseWriter, r *http.Request) {
+	user := rest.MustGetUserInfo(r)
+	req := struct {
+		Name    string `json:"name"`
+		Picture string `json:"picture"`
+	}{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, hardBodyLimit)).Decode(&req); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't bind bot", rest.ErrDecode)
+		return
+	}
+	b, key, err := a.dataService.CreateBot(r.URL.Query().Get("site"), req.Name, req.Picture, user.ID)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't create bot", rest.ErrActionRejected)
+		return
+	}
+	R.RenderJSON(w, R.JSON{"bot": b, "key": key})
+}
+
+// GET /bots?site=site-id - list bot accounts of the site, oldest first
+func (a *admin) listBotsCtrl(w http.ResponseWriter, r *http.Request) {
+	bots, err := a.dataService.Bots(r.URL.Query().Get("site"))
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't list bots", rest.ErrActionRejected)
+		return
+	}
+	R.RenderJSON(w, bots)
+}
+
+// DELETE /bot/{id}?site=site-id - delete bot account, its api key stops working and comments are kept
+func (a *admin) deleteBotCtrl(w http.ResponseWriter, r *http.Request) {
+	id, siteID := r.PathValue("id"), r.URL.Query().Get("site")
+	if err := a.dataService.DeleteBot(siteID, id); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't delete bot", rest.ErrActionRejected)
+		return
+	}
+	log.Printf("[INFO] bot %s of %s deleted by %s", id, siteID, rest.MustGetUserInfo(r).ID)
+	R.RenderJSON(w, R.JSON{"id": id, "deleted": true})
+}
+
+// GET /grants?site=site-id - list roles on the site granted by accepted invitations
+func (a *admin) listGrantsCtrl(w http.ResponseWriter, r *http.Request) {
+	grants, err := a.dataService.Grants(r.URL.Query().Get("site"))
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't list grants", rest.ErrActionRejected)
+		return
+	}
+	R.RenderJSON(w, grants)
+}
+
+// DELETE /grant/{userid}?site=site-id - revoke role granted to the user on the site by invitation
+func (a *admin) revokeGrantCtrl(w http.ResponseWriter, r *http.Request) {
+	userID, siteID := r.PathValue("userid"), r.URL.Query().Get("site")
+	if err := a.dataService.RevokeGrant(siteID, userID); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't revoke grant", rest.ErrActionRejected)
+		return
+	}
+	log.Printf("[INFO] role of %s on %s revoked by %s", userID, siteID, rest.MustGetUserInfo(r).ID)
+	R.RenderJSON(w, R.JSON{"user_id": userID, "revoked": true})
+}
+
+// GET /roles?site=site-id - list roles assigned on the site
+func (a *admin) listRolesCtrl(w http.ResponseWriter, r *http.Request) {
+	roles, err := a.dataService.Roles(r.URL.Query().Get("site"))
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't list roles", rest.ErrActionRejected)
+		return
+	}
+	R.RenderJSON(w, roles)
+}
+
+// PUT /role/{userid}?site=site-id&role=moderator - assign admin or moderator role to the user on the site
+func (a *admin) setRoleCtrl(w http.ResponseWriter, r *http.Request) {
+	userID, siteID, role := r.PathValue("userid"), r.URL.Query().Get("site"), r.URL.Query().Get("role")
+	if role == "" {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, errors.New("missing role"), "can't set role", rest.ErrActionRejected)
+		return
+	}
+	if err := a.dataService.SetRole(siteID, userID, role); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't set role", rest.ErrActionRejected)
+		return
+	}
+	log.Printf("[INFO] %s role assigned to %s on %s by %s", role, userID, siteID, rest.MustGetUserInfo(r).ID)
+	R.RenderJSON(w, service.RoleAssignment{UserID: userID, Role: role})
+}
+
+// DELETE /role/{userid}?site=site-id - remove role assigned to the user on the site
+func (a *admin) deleteRoleCtrl(w http.ResponseWriter, r *http.Request) {
+	userID, siteID := r.PathValue("userid"), r.URL.Query().Get("site")
+	if err := a.dataService.SetRole(siteID, userID, ""); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't remove role", rest.ErrActionRejected)
+		return
+	}
+	log.Printf("[INFO] role of %s on %s removed by %s", userID, siteID, rest.MustGetUserInfo(r).ID)
+	R.RenderJSON(w, R.JSON{"user_id": userID, "removed": true})
+}
+
+// POST /schedule?site=site-id - schedule moderation action, body is {"type":"unblock","user_id":"github_123","notify":true,"delay":1209600}.
+// Due time set by "due" in RFC3339 or "delay" in seconds from now.
+func (a *admin) scheduleActionCtrl(w http.ResponseWriter, r *http.Request) {
+	req := struct {
+		schedule.Action
+		Delay int `json:"delay"`
+	}{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, hardBodyLimit)).Decode(&req); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't bind action", rest.ErrDecode)
+		return
+	}
+	act := req.Action
+	if req.Delay > 0 {
+		act.Due = time.Now().Add(time.Duration(req.Delay) * time.Second)
+	}
+	act.SiteID, act.CreatedBy = r.URL.Query().Get("site"), rest.MustGetUserInfo(r).ID
+	act, err := a.dataService.ScheduleAction(act)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't schedule action", rest.ErrActionRejected)
+		return
+	}
+	R.RenderJSON(w, act)
+}
+
+// GET /schedule?site=site-id - list upcoming moderation actions of the site, earliest due first
+func (a *admin) listScheduledCtrl(w http.ResponseWriter, r *http.Request) {
+	actions, err := a.dataService.ScheduledActions(r.URL.Query().Get("site"))
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't list scheduled actions", rest.ErrActionRejected)
+		return
+	}
+	R.RenderJSON(w, actions)
+}
+
+// DELETE /schedule/{id}?site=site-id - cancel scheduled moderation action
+func (a *admin) cancelScheduledCtrl(w http.ResponseWriter, r *http.Request) {
+	id, siteID := r.PathValue("id"), r.URL.Query().Get("site")
+	if err := a.dataService.CancelAction(siteID, id); err != nil {
+		code := http.StatusBadRequest
+		if errors.Is(err, schedule.ErrNotFound) {
+			code = http.StatusNotFound
+		}
+		rest.SendErrorJSON(w, r, code, err, "can't cancel scheduled action", rest.ErrActionRejected)
+		return
+	}
+	log.Printf("[INFO] scheduled action %s on %s canceled by %s", id, siteID, rest.MustGetUserInfo(r).ID)
+	R.RenderJSON(w, R.JSON{"id": id, "canceled": true})
+}
+
+// GET /quota?site=site-id - get quota of the site with its usage in the current month
+func (a *admin) getQuotaCtrl(w http.ResponseWriter, r *http.Request) {
+	info, err := a.dataService.SiteQuota(r.URL.Query().Get("site"))
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't get quota", rest.ErrActionRejected)
+		return
+	}
+	R.RenderJSON(w, info)
+}
+
+// PUT /quota?site=site-id - set own limits of the site, body is {"comments": 1000, "notifications": 5000, "storage": 1048576},
+// zero is unlimited
+func (a *admin) setQuotaCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID := r.URL.Query().Get("site")
+	limits := quota.Limits{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, hardBodyLimit)).Decode(&limits); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't bind quota limits", rest.ErrDecode)
+		return
+	}
+	log.Printf("[INFO] set quota limits %+v for site %s", limits, siteID)
+	if err := a.dataService.SetQuotaLimits(siteID, limits); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't set quota limits", rest.ErrActionRejected)
+		return
+	}
+	a.getQuotaCtrl(w, r)
+}
+
+// DELETE /quota?site=site-id - reset limits of the site to the default ones
+func (a *admin) resetQuotaCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID := r.URL.Query().Get("site")
+	log.Printf("[INFO] reset quota limits for site %s", siteID)
+	if err := a.dataService.ResetQuotaLimits(siteID); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't reset quota limits", rest.ErrActionRejected)
+		return
+	}
+	a.getQuotaCtrl(w, r)
+}
+
 // GET /user/{userid}?site=side-id - get user info for requested userid
 func (a *admin) getUserInfoCtrl(w http.ResponseWriter, r *http.Request) {
 	userID := r.PathValue("userid")
@@ -91,7 +687,7 @@ func (a *admin) getUserInfoCtrl(w http.ResponseWriter, r *http.Request) {
 func (a *admin) deleteMeRequestCtrl(w http.ResponseWriter, r *http.Request) {
 	token := r.URL.Query().Get("token")
 
-	claims, err := a.authenticator.TokenService().Parse(token)
+	claims, err := a.tokens.Parse(token)
 	if err != nil {
 		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't process token", rest.ErrActionRejected)
 		return
@@ -137,7 +733,7 @@ func (a *admin) deleteMeRequestCtrl(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	a.cache.Flush(cache.Flusher(audience).Scopes(audience, claims.User.ID, lastCommentsScope))
+	cdn.Flush(a.cache, audience, audience, claims.User.ID, lastCommentsScope)
 	R.RenderJSON(w, R.JSON{"user_id": claims.User.ID, "site_id": claims.Audience})
 }
 
@@ -152,7 +748,7 @@ func avatarIDFromPicture(picture string) string {
 	return ""
 }
 
-// PUT /user/{userid}?site=side-id&block=1&ttl=7d - block or unblock user
+// PUT /user/{userid}?site=side-id&block=1&ttl=7d&reason=spam - block or unblock user, reason is optional admin's note
 func (a *admin) setBlockCtrl(w http.ResponseWriter, r *http.Request) {
 	userID := r.PathValue("userid")
 	siteID := r.URL.Query().Get("site")
@@ -169,14 +765,22 @@ func (a *admin) setBlockCtrl(w http.ResponseWriter, r *http.Request) {
 		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't set blocking status", rest.ErrActionRejected)
 		return
 	}
-
 	// delete comments for permanently blocked user.
 	if blockStatus && ttl == time.Duration(0) {
 		if err := a.dataService.DeleteUser(siteID, userID, store.SoftDelete); err != nil {
 			log.Printf("[WARN] can't delete comments for blocked user %s on site %s, %v", userID, siteID, err)
 		}
 	}
-	a.cache.Flush(cache.Flusher(siteID).Scopes(userID, siteID, lastCommentsScope))
+
+	// reason kept for blocked users only, set after user deletion which drops user details
+	reason := ""
+	if blockStatus {
+		reason = r.URL.Query().Get("reason")
+	}
+	if err := a.dataService.SetBlockReason(siteID, userID, reason); err != nil {
+		log.Printf("[WARN] can't set block reason for %s on site %s, %v", userID, siteID, err)
+	}
+	cdn.Flush(a.cache, siteID, userID, siteID, lastCommentsScope)
 	R.RenderJSON(w, R.JSON{"user_id": userID, "site_id": siteID, "block": blockStatus})
 }
 
@@ -191,67 +795,897 @@ func (a *admin) blockedUsersCtrl(w http.ResponseWriter, r *http.Request) {
 	R.RenderJSON(w, users)
 }
 
-// PUT /readonly?site=siteID&url=post-url&ro=1 - set or reset read-only status for the post
-func (a *admin) setReadOnlyCtrl(w http.ResponseWriter, r *http.Request) {
-	locator := store.Locator{SiteID: r.URL.Query().Get("site"), URL: r.URL.Query().Get("url")}
-	roStatus := r.URL.Query().Get("ro") == "1"
+// moderatedCSVHeader is the header of blocked and verified users list in csv format
+var moderatedCSVHeader = []string{"id", "name", "blocked", "until", "reason", "verified"}
 
-	isRoByAge := func(info store.PostInfo) bool {
-		return a.readOnlyAge > 0 && !info.FirstTS.IsZero() &&
-			info.FirstTS.AddDate(0, 0, a.readOnlyAge).Before(time.Now())
+// GET /moderation/export?site=siteID&format=json - export blocked and verified users of the site, with block expiration
+// and reason, as json (default) or csv
+func (a *admin) exportModeratedCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID := r.URL.Query().Get("site")
+	users, err := a.dataService.ModeratedUsers(siteID)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't get moderated users", rest.ErrSiteNotFound)
+		return
 	}
 
-	// don't allow to reset ro for posts turned to ro by ReadOnlyAge
-	if !roStatus {
-		if info, e := a.dataService.Info(locator, a.readOnlyAge); e == nil && isRoByAge(info) {
-			rest.SendErrorJSON(w, r, http.StatusForbidden, fmt.Errorf("rejected"),
-				"read-only due the age", rest.ErrActionRejected)
-			return
-		}
+	if r.URL.Query().Get("format") != "csv" {
+		R.RenderJSON(w, users)
+		return
 	}
 
-	if err := a.dataService.SetReadOnly(locator, roStatus); err != nil {
-		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't set readonly status", rest.ErrPostNotFound)
-		return
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", siteID+"-moderated-users.csv"))
+	cw := csv.NewWriter(w)
+	records := [][]string{moderatedCSVHeader}
+	for _, u := range users {
+		until := ""
+		if !u.Until.IsZero() {
+			until = u.Until.UTC().Format(time.RFC3339)
+		}
+		records = append(records, []string{u.ID, u.Name, strconv.FormatBool(u.Blocked), until, u.Reason, strconv.FormatBool(u.Verified)})
+	}
+	if err = cw.WriteAll(records); err != nil {
+		log.Printf("[WARN] can't write moderated users of %s, %v", siteID, err)
 	}
-	a.cache.Flush(cache.Flusher(locator.SiteID).Scopes(locator.URL, locator.SiteID))
-	R.RenderJSON(w, R.JSON{"locator": locator, "read-only": roStatus})
 }
 
-// PUT /title/{id}?site=siteID&url=post-url - set comment PostTitle to page's title
-func (a *admin) setTitleCtrl(w http.ResponseWriter, r *http.Request) {
-	id := r.PathValue("id")
-	locator := store.Locator{SiteID: r.URL.Query().Get("site"), URL: r.URL.Query().Get("url")}
+// POST /moderation/import?site=siteID&format=json - import blocked and verified users as json (default) or csv,
+// in the export format. Users not in the list keep their status.
+func (a *admin) importModeratedCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID := r.URL.Query().Get("site")
+	body := http.MaxBytesReader(w, r.Body, hardBodyLimit)
 
-	c, err := a.dataService.SetTitle(locator, id)
+	var users []service.ModeratedUser
+	var err error
+	if r.URL.Query().Get("format") == "csv" || strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+		users, err = readModeratedCSV(body)
+	} else {
+		err = json.NewDecoder(body).Decode(&users)
+	}
 	if err != nil {
-		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't set title", rest.ErrInternal)
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't parse moderated users", rest.ErrDecode)
 		return
 	}
-	log.Printf("[INFO] set comment's title %s to %q", id, c.PostTitle)
 
-	a.cache.Flush(cache.Flusher(locator.SiteID).Scopes(locator.URL, lastCommentsScope))
-	R.RenderJSON(w, R.JSON{"id": id, "locator": locator})
+	count, err := a.dataService.ImportModeratedUsers(siteID, users)
+	cdn.Flush(a.cache, siteID, siteID, lastCommentsScope)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't import moderated users", rest.ErrActionRejected)
+		return
+	}
+	R.RenderJSON(w, R.JSON{"site": siteID, "imported": count})
 }
 
-// PUT /verify/{userid}?site=siteID&verified=1 - set or reset verified status for the user
-func (a *admin) setVerifyCtrl(w http.ResponseWriter, r *http.Request) {
-	userID := r.PathValue("userid")
-	siteID := r.URL.Query().Get("site")
-	verifyStatus := r.URL.Query().Get("verified") == "1"
+// readModeratedCSV reads blocked and verified users list in csv format, columns matched by the header
+func readModeratedCSV(rd io.Reader) ([]service.ModeratedUser, error) {
+	records, err := csv.NewReader(rd).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("can't read csv: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, errors.New("empty csv")
+	}
+	columns := map[string]int{}
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["id"]; !ok {
+		return nil, errors.New("no id column in csv header")
+	}
+	field := func(rec []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(rec) {
+			return strings.TrimSpace(rec[i])
+		}
+		return ""
+	}
 
-	if err := a.dataService.SetVerified(siteID, userID, verifyStatus); err != nil {
-		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't set verify status", rest.ErrActionRejected)
+	res := make([]service.ModeratedUser, 0, len(records)-1)
+	for n, rec := range records[1:] {
+		u := service.ModeratedUser{ID: field(rec, "id"), Name: field(rec, "name"), Reason: field(rec, "reason")}
+		u.Blocked, _ = strconv.ParseBool(field(rec, "blocked"))
+		u.Verified, _ = strconv.ParseBool(field(rec, "verified"))
+		if until := field(rec, "until"); until != "" {
+			if u.Until, err = time.Parse(time.RFC3339, until); err != nil {
+				return nil, fmt.Errorf("bad until in line %d: %w", n+2, err)
+			}
+		}
+		res = append(res, u)
+	}
+	return res, nil
+}
+
+// POST /reencrypt?site=siteID - encrypt sensitive user details with the current key, used after key rotation
+func (a *admin) reencryptCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID := r.URL.Query().Get("site")
+	count, err := a.dataService.ReencryptDetails(siteID)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't re-encrypt user details", rest.ErrInternal)
 		return
 	}
-	a.cache.Flush(cache.Flusher(siteID).Scopes(siteID, userID))
-	R.RenderJSON(w, R.JSON{"user": userID, "verified": verifyStatus})
+	R.RenderJSON(w, R.JSON{"site": siteID, "updated": count})
 }
 
-// PUT /pin/{id}?site=siteID&url=post-url&pin=1
-// mark/unmark comment as a special
-func (a *admin) setPinCtrl(w http.ResponseWriter, r *http.Request) {
-	commentID := r.PathValue("id")
+// GET /maintenance?site=siteID - read-only maintenance mode of the site and the global one
+func (a *admin) getMaintenanceCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID := r.URL.Query().Get("site")
+	R.RenderJSON(w, R.JSON{"site": a.maintenance.Status(siteID), "global": a.maintenance.Status("")})
+}
+
+// PUT /maintenance?site=siteID&global=1 - enable or disable read-only maintenance mode of the site, or the global one
+// with global=1, allowed for basic auth admin only. Body is {"enabled":true,"message":"text"}, message is optional.
+func (a *admin) setMaintenanceCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID := r.URL.Query().Get("site")
+	req := rest.MaintenanceStatus{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, hardBodyLimit)).Decode(&req); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't decode maintenance mode", rest.ErrDecode)
+		return
+	}
+
+	target := siteID
+	if r.URL.Query().Get("global") == "1" {
+		if user := rest.MustGetUserInfo(r); user.ID != "admin" || user.Name != "admin" {
+			rest.SendErrorJSON(w, r, http.StatusForbidden, errors.New("global maintenance change rejected"),
+				"global maintenance mode can be changed by basic auth admin only", rest.ErrActionRejected)
+			return
+		}
+		target = ""
+	}
+	a.maintenance.Set(target, req.Enabled, req.Message)
+	log.Printf("[INFO] maintenance mode of %q set to %v", target, req.Enabled)
+	R.RenderJSON(w, R.JSON{"site": a.maintenance.Status(siteID), "global": a.maintenance.Status("")})
+}
+
+// GET /shadow?site=siteID - stats and last differences of read requests mirrored to the secondary instance
+func (a *admin) shadowReportCtrl(w http.ResponseWriter, r *http.Request) {
+	if a.shadow == nil {
+		rest.SendErrorJSON(w, r, http.StatusNotFound, errors.New("shadowing disabled"), "requests shadowing is not enabled", rest.ErrActionRejected)
+		return
+	}
+	R.RenderJSON(w, a.shadow.Report(r.URL.Query().Get("site")))
+}
+
+// GET /controversial?site=siteID&since=168h&limit=20 - the most controversial comments of the site posted during
+// since period, i.e. with balanced up and down votes, to spot flame wars. Period is a week by default.
+func (a *admin) controversialCtrl(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	period, err := time.ParseDuration(cmp.Or(query.Get("since"), "168h"))
+	if err != nil || period <= 0 {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, fmt.Errorf("invalid since period %q", query.Get("since")),
+			"can't get controversial comments", rest.ErrDecode)
+		return
+	}
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	if limit <= 0 || limit > maxControLimit {
+		limit = defaultControLimit
+	}
+	comments, err := a.dataService.Controversial(query.Get("site"), time.Now().Add(-period), limit)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't get controversial comments", rest.ErrActionRejected)
+		return
+	}
+	R.RenderJSON(w, comments)
+}
+
+// GET /brigades?site=siteID - alerts of suspicious votes, like many votes for a comment from the same network
+// or by new users within a short time, the newest first
+func (a *admin) brigadesCtrl(w http.ResponseWriter, r *http.Request) {
+	alerts, err := a.dataService.BrigadeAlerts(r.URL.Query().Get("site"))
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't get vote alerts", rest.ErrActionRejected)
+		return
+	}
+	R.RenderJSON(w, alerts)
+}
+
+// POST /brigades/{id}/void?site=siteID - remove votes of the alert from the comment and the alert itself
+func (a *admin) voidBrigadeCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID := r.URL.Query().Get("site")
+	comment, voided, err := a.dataService.VoidBrigade(siteID, r.PathValue("id"))
+	if err != nil {
+		code := http.StatusBadRequest
+		if errors.Is(err, brigade.ErrNotFound) {
+			code = http.StatusNotFound
+		}
+		rest.SendErrorJSON(w, r, code, err, "can't void votes", rest.ErrActionRejected)
+		return
+	}
+	if voided > 0 {
+		cdn.Flush(a.cache, siteID, comment.Locator.URL, comment.User.ID, lastCommentsScope)
+	}
+	R.RenderJSON(w, R.JSON{"id": comment.ID, "score": comment.Score, "voided": voided})
+}
+
+// DELETE /brigades/{id}?site=siteID - dismiss the alert, votes are kept
+func (a *admin) dismissBrigadeCtrl(w http.ResponseWriter, r *http.Request) {
+	if err := a.dataService.DismissBrigade(r.URL.Query().Get("site"), r.PathValue("id")); err != nil {
+		code := http.StatusBadRequest
+		if errors.Is(err, brigade.ErrNotFound) {
+			code = http.StatusNotFound
+		}
+		rest.SendErrorJSON(w, r, code, err, "can't dismiss alert", rest.ErrActionRejected)
+		return
+	}
+	R.RenderJSON(w, R.JSON{"id": r.PathValue("id"), "deleted": true})
+}
+
+// GET /csp-reports - CSP violation reports collected from browsers, the most recently seen first
+func (a *admin) cspReportsCtrl(w http.ResponseWriter, r *http.Request) {
+	if a.cspReports == nil {
+		rest.SendErrorJSON(w, r, http.StatusNotFound, errors.New("csp reports disabled"), "csp reports collection is not enabled", rest.ErrActionRejected)
+		return
+	}
+	R.RenderJSON(w, a.cspReports.List())
+}
+
+// GET /email/suppressions?site=site-id - addresses suppressed after bounces and complaints reported by the email
+// provider, recently reported first. Suppression is global, emails to these addresses aren't sent for any site.
+func (a *admin) emailSuppressionsCtrl(w http.ResponseWriter, r *http.Request) {
+	res, err := a.dataService.EmailSuppressions()
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't list suppressed addresses", rest.ErrInternal)
+		return
+	}
+	R.RenderJSON(w, res)
+}
+
+// DELETE /email/suppression?site=site-id&address=email - reinstate suppressed address, emails to it are sent again
+func (a *admin) reinstateEmailCtrl(w http.ResponseWriter, r *http.Request) {
+	address := r.URL.Query().Get("address")
+	err := a.dataService.ReinstateEmail(address)
+	if errors.Is(err, suppress.ErrNotFound) {
+		rest.SendErrorJSON(w, r, http.StatusNotFound, err, "address is not suppressed", rest.ErrActionRejected)
+		return
+	}
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't reinstate address", rest.ErrActionRejected)
+		return
+	}
+	log.Printf("[INFO] suppressed address reinstated by %s", rest.MustGetUserInfo(r).ID)
+	R.RenderJSON(w, R.JSON{"address": address, "reinstated": true})
+}
+
+// GET /notify/deliveries?site=site-id&destination=telegram - recent notification deliveries of the site, newest first,
+// with status, latency and error of each. Optional destination filters by its name, like "email" or "telegram".
+func (a *admin) notifyDeliveriesCtrl(w http.ResponseWriter, r *http.Request) {
+	if a.notifyService == nil {
+		R.RenderJSON(w, []notify.Delivery{})
+		return
+	}
+	R.RenderJSON(w, a.notifyService.Deliveries(r.URL.Query().Get("site"), r.URL.Query().Get("destination")))
+}
+
+// POST /notify/deliveries/{id}/resend?site=site-id - send notification of the delivery to the same destination again,
+// returns the delivery updated with the result
+func (a *admin) resendDeliveryCtrl(w http.ResponseWriter, r *http.Request) {
+	if a.notifyService == nil {
+		rest.SendErrorJSON(w, r, http.StatusNotFound, notify.ErrDeliveryNotFound, "no such delivery", rest.ErrActionRejected)
+		return
+	}
+	res, err := a.notifyService.Resend(r.Context(), r.URL.Query().Get("site"), r.PathValue("id"))
+	if errors.Is(err, notify.ErrDeliveryNotFound) {
+		rest.SendErrorJSON(w, r, http.StatusNotFound, err, "no such delivery", rest.ErrActionRejected)
+		return
+	}
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadGateway, err, "can't resend notification", rest.ErrActionRejected)
+		return
+	}
+	R.RenderJSON(w, res)
+}
+
+// GET /cors?site=site-id - get CORS policy of the site
+func (a *admin) getCORSCtrl(w http.ResponseWriter, r *http.Request) {
+	R.RenderJSON(w, a.cors.Policy(r.URL.Query().Get("site")))
+}
+
+// PUT /cors?site=site-id - change CORS policy of the site, body is {"origins":["https://example.com"],"credentials":true,"max_age":300}
+func (a *admin) setCORSCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID := r.URL.Query().Get("site")
+	policy := rest.CORSPolicy{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, hardBodyLimit)).Decode(&policy); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't bind cors policy", rest.ErrDecode)
+		return
+	}
+	log.Printf("[INFO] set cors policy %+v for site %s", policy, siteID)
+	if err := a.cors.Set(siteID, policy); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't set cors policy", rest.ErrActionRejected)
+		return
+	}
+	R.RenderJSON(w, a.cors.Policy(siteID))
+}
+
+// DELETE /cors?site=site-id - reset CORS policy of the site to the configured one
+func (a *admin) resetCORSCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID := r.URL.Query().Get("site")
+	log.Printf("[INFO] reset cors policy for site %s", siteID)
+	if err := a.cors.Reset(siteID); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't reset cors policy", rest.ErrInternal)
+		return
+	}
+	R.RenderJSON(w, a.cors.Policy(siteID))
+}
+
+// GET /assets?site=siteID - list of site's branding assets
+func (a *admin) listAssetsCtrl(w http.ResponseWriter, r *http.Request) {
+	assets, err := a.dataService.Assets(r.URL.Query().Get("site"))
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't list assets", rest.ErrInternal)
+		return
+	}
+	R.RenderJSON(w, assets)
+}
+
+// PUT /asset/{name}?site=siteID - upload branding asset served at /web/custom/{site}/{name}, body is the file content
+func (a *admin) saveAssetCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID, name := r.URL.Query().Get("site"), r.PathValue("name")
+	res, err := a.dataService.SaveAsset(siteID, name, http.MaxBytesReader(w, r.Body, maxAssetBody))
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't save asset", rest.ErrActionRejected)
+		return
+	}
+	cdn.Flush(a.cache, siteID, siteID)
+	R.RenderJSON(w, res)
+}
+
+// POST /archive?site=siteID&url=post-url&remove=1 - render closed post to static html asset
+// served at /web/custom/{site}/{name}, comments removed from the store if remove set
+func (a *admin) archiveThreadCtrl(w http.ResponseWriter, r *http.Request) {
+	locator := store.Locator{SiteID: r.URL.Query().Get("site"), URL: r.URL.Query().Get("url")}
+	if locator.URL == "" {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, errors.New("missing url"), "can't archive post", rest.ErrActionRejected)
+		return
+	}
+	remove := r.URL.Query().Get("remove") == "1"
+	log.Printf("[INFO] archive post %s on %s, remove %v", locator.URL, locator.SiteID, remove)
+	res, err := a.dataService.ArchiveThread(locator, a.readOnlyAge, remove)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't archive post", rest.ErrActionRejected)
+		return
+	}
+	cdn.Flush(a.cache, locator.SiteID, locator.SiteID, locator.URL, lastCommentsScope)
+	R.RenderJSON(w, R.JSON{"asset": res, "link": a.remarkURL + "/web/custom/" + locator.SiteID + "/" + res.Name, "removed": remove})
+}
+
+// GET /cold?site=siteID - list of site's posts in cold storage
+func (a *admin) listColdCtrl(w http.ResponseWriter, r *http.Request) {
+	segments, err := a.dataService.ColdPosts(r.URL.Query().Get("site"))
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't list cold posts", rest.ErrActionRejected)
+		return
+	}
+	R.RenderJSON(w, segments)
+}
+
+// POST /cold/freeze?site=siteID&inactive=8760h - move posts without comments for inactive period to cold storage
+func (a *admin) freezeCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID := r.URL.Query().Get("site")
+	inactive, err := time.ParseDuration(r.URL.Query().Get("inactive"))
+	if err != nil || inactive <= 0 {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, fmt.Errorf("invalid inactive period %q", r.URL.Query().Get("inactive")),
+			"can't freeze posts", rest.ErrActionRejected)
+		return
+	}
+	count, err := a.dataService.FreezePosts(siteID, inactive)
+	if count > 0 {
+		cdn.Flush(a.cache, siteID, siteID)
+	}
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't freeze posts", rest.ErrActionRejected)
+		return
+	}
+	R.RenderJSON(w, R.JSON{"site": siteID, "frozen": count})
+}
+
+// POST /cold/thaw?site=siteID&url=post-url - move post from cold storage back to the store
+func (a *admin) thawCtrl(w http.ResponseWriter, r *http.Request) {
+	locator := store.Locator{SiteID: r.URL.Query().Get("site"), URL: r.URL.Query().Get("url")}
+	if err := a.dataService.ThawPost(locator); err != nil {
+		code := http.StatusBadRequest
+		if errors.Is(err, cold.ErrNotFound) {
+			code = http.StatusNotFound
+		}
+		rest.SendErrorJSON(w, r, code, err, "can't thaw post", rest.ErrActionRejected)
+		return
+	}
+	cdn.Flush(a.cache, locator.SiteID, locator.SiteID, locator.URL, lastCommentsScope)
+	R.RenderJSON(w, R.JSON{"locator": locator, "thawed": true})
+}
+
+// GET /pages?site=siteID - list of site's posts with settings
+func (a *admin) listPagesCtrl(w http.ResponseWriter, r *http.Request) {
+	pages, err := a.dataService.PagesSettings(r.URL.Query().Get("site"))
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't list page settings", rest.ErrActionRejected)
+		return
+	}
+	R.RenderJSON(w, pages)
+}
+
+// PUT /page/sort?site=siteID&url=post-url&sort=-score - pin default order of post's comments
+func (a *admin) setPageSortCtrl(w http.ResponseWriter, r *http.Request) {
+	sort := r.URL.Query().Get("sort")
+	if strings.HasPrefix(sort, " ") { // restore + replaced by " "
+		sort = "+" + sort[1:]
+	}
+	if sort == "" {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, errors.New("missing sort"), "can't pin sort", rest.ErrActionRejected)
+		return
+	}
+	a.updatePageSort(w, r, sort)
+}
+
+// DELETE /page/sort?site=siteID&url=post-url - unpin order of post's comments
+func (a *admin) deletePageSortCtrl(w http.ResponseWriter, r *http.Request) {
+	a.updatePageSort(w, r, "")
+}
+
+func (a *admin) updatePageSort(w http.ResponseWriter, r *http.Request, sort string) {
+	locator := store.Locator{SiteID: r.URL.Query().Get("site"), URL: r.URL.Query().Get("url")}
+	if locator.URL == "" {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, errors.New("missing url"), "can't pin sort", rest.ErrActionRejected)
+		return
+	}
+	if err := a.dataService.SetPageSort(locator, sort); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't pin sort", rest.ErrActionRejected)
+		return
+	}
+	log.Printf("[INFO] sort of %s on %s pinned to %q", locator.URL, locator.SiteID, sort)
+	cdn.Flush(a.cache, locator.SiteID, locator.URL)
+	R.RenderJSON(w, R.JSON{"locator": locator, "sort": sort})
+}
+
+// PUT /page/live?site=siteID&url=post-url - turn on live-blog mode of the post
+func (a *admin) setPageLiveCtrl(w http.ResponseWriter, r *http.Request) {
+	a.updatePageLive(w, r, true)
+}
+
+// DELETE /page/live?site=siteID&url=post-url - turn off live-blog mode of the post
+func (a *admin) deletePageLiveCtrl(w http.ResponseWriter, r *http.Request) {
+	a.updatePageLive(w, r, false)
+}
+
+func (a *admin) updatePageLive(w http.ResponseWriter, r *http.Request, live bool) {
+	locator := store.Locator{SiteID: r.URL.Query().Get("site"), URL: r.URL.Query().Get("url")}
+	if locator.URL == "" {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, errors.New("missing url"), "can't set live mode", rest.ErrActionRejected)
+		return
+	}
+	if err := a.dataService.SetPageLive(locator, live); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't set live mode", rest.ErrActionRejected)
+		return
+	}
+	log.Printf("[INFO] live mode of %s on %s set to %v", locator.URL, locator.SiteID, live)
+	cdn.Flush(a.cache, locator.SiteID, locator.URL)
+	R.RenderJSON(w, R.JSON{"locator": locator, "live": live})
+}
+
+// PUT /page/registered?site=siteID&url=post-url - register the post, accepting comments in strict mode
+func (a *admin) setPageRegisteredCtrl(w http.ResponseWriter, r *http.Request) {
+	a.updatePageRegistered(w, r, true)
+}
+
+// DELETE /page/registered?site=siteID&url=post-url - remove registration of the post
+func (a *admin) deletePageRegisteredCtrl(w http.ResponseWriter, r *http.Request) {
+	a.updatePageRegistered(w, r, false)
+}
+
+func (a *admin) updatePageRegistered(w http.ResponseWriter, r *http.Request, registered bool) {
+	locator := store.Locator{SiteID: r.URL.Query().Get("site"), URL: r.URL.Query().Get("url")}
+	if locator.URL == "" {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, errors.New("missing url"), "can't register page", rest.ErrActionRejected)
+		return
+	}
+	if err := a.dataService.SetPageRegistered(locator, registered); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't register page", rest.ErrActionRejected)
+		return
+	}
+	log.Printf("[INFO] registration of %s on %s set to %v", locator.URL, locator.SiteID, registered)
+	R.RenderJSON(w, R.JSON{"locator": locator, "registered": registered})
+}
+
+// DELETE /asset/{name}?site=siteID - remove branding asset
+func (a *admin) deleteAssetCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID, name := r.URL.Query().Get("site"), r.PathValue("name")
+	if err := a.dataService.DeleteAsset(siteID, name); err != nil {
+		code := http.StatusBadRequest
+		if errors.Is(err, asset.ErrNotFound) {
+			code = http.StatusNotFound
+		}
+		rest.SendErrorJSON(w, r, code, err, "can't delete asset", rest.ErrActionRejected)
+		return
+	}
+	cdn.Flush(a.cache, siteID, siteID)
+	R.RenderJSON(w, R.JSON{"site": siteID, "name": name, "deleted": true})
+}
+
+// GET /remotes - retries and circuit breaker state of remote stores
+func (a *admin) remotesCtrl(w http.ResponseWriter, _ *http.Request) {
+	res := make([]resilient.Stats, 0, len(a.remotes))
+	for _, tr := range a.remotes {
+		res = append(res, tr.Stats())
+	}
+	R.RenderJSON(w, res)
+}
+
+// POST /reindex?site=siteID - rebuild derived indexes of the site, like last comments and post counters, in background.
+// Progress reported by GET /reindex.
+func (a *admin) startReindexCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID := r.URL.Query().Get("site")
+	err := a.dataService.StartReindex(siteID, func() { cdn.Flush(a.cache, siteID, siteID) })
+	if errors.Is(err, service.ErrReindexRunning) {
+		rest.SendErrorJSON(w, r, http.StatusConflict, err, "reindex is already running", rest.ErrActionRejected)
+		return
+	}
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't start reindex", rest.ErrActionRejected)
+		return
+	}
+	status, _ := a.dataService.ReindexStatus(siteID)
+	_ = R.EncodeJSON(w, http.StatusAccepted, status)
+}
+
+// GET /reindex?site=siteID - status of the last reindex of the site
+func (a *admin) reindexStatusCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID := r.URL.Query().Get("site")
+	status, ok := a.dataService.ReindexStatus(siteID)
+	if !ok {
+		rest.SendErrorJSON(w, r, http.StatusNotFound, errors.New("no reindex for the site"), "reindex never started", rest.ErrActionRejected)
+		return
+	}
+	R.RenderJSON(w, status)
+}
+
+// POST /rerender?site=siteID - render all comments of the site again from the original markdown with the current
+// formatter in background, i.e. to fix comments rendered by the formatter with a bug. Progress reported by GET /rerender.
+func (a *admin) startRerenderCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID := r.URL.Query().Get("site")
+	err := a.dataService.StartRerender(siteID, func() { cdn.Flush(a.cache, siteID, siteID) })
+	if errors.Is(err, service.ErrRerenderRunning) {
+		rest.SendErrorJSON(w, r, http.StatusConflict, err, "rerender is already running", rest.ErrActionRejected)
+		return
+	}
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't start rerender", rest.ErrActionRejected)
+		return
+	}
+	status, _ := a.dataService.RerenderStatus(siteID)
+	_ = R.EncodeJSON(w, http.StatusAccepted, status)
+}
+
+// GET /rerender?site=siteID - status of the last re-rendering of the site
+func (a *admin) rerenderStatusCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID := r.URL.Query().Get("site")
+	status, ok := a.dataService.RerenderStatus(siteID)
+	if !ok {
+		rest.SendErrorJSON(w, r, http.StatusNotFound, errors.New("no rerender for the site"), "rerender never started", rest.ErrActionRejected)
+		return
+	}
+	R.RenderJSON(w, status)
+}
+
+// POST /integrity?site=siteID - check integrity of the site now and return the report
+func (a *admin) checkIntegrityCtrl(w http.ResponseWriter, r *http.Request) {
+	report, err := a.dataService.CheckIntegrity(r.URL.Query().Get("site"))
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't check integrity", rest.ErrActionRejected)
+		return
+	}
+	R.RenderJSON(w, report)
+}
+
+// GET /integrity?site=siteID - report of the last integrity check of the site
+func (a *admin) integrityReportCtrl(w http.ResponseWriter, r *http.Request) {
+	report, ok := a.dataService.IntegrityReport(r.URL.Query().Get("site"))
+	if !ok {
+		rest.SendErrorJSON(w, r, http.StatusNotFound, errors.New("no integrity check for the site"), "integrity never checked", rest.ErrActionRejected)
+		return
+	}
+	R.RenderJSON(w, report)
+}
+
+// GET /users?site=siteID&q=query&sort=-activity&limit=50&skip=0 - list site's users with activity summary and flags,
+// filtered by id or name and sorted by comments, activity or name
+func (a *admin) usersCtrl(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	req := service.UsersRequest{SiteID: query.Get("site"), Query: query.Get("q"), Sort: query.Get("sort")}
+	req.Limit, _ = strconv.Atoi(query.Get("limit"))
+	if req.Limit <= 0 || req.Limit > maxUsersLimit {
+		req.Limit = defaultUsersLimit
+	}
+	req.Skip, _ = strconv.Atoi(query.Get("skip"))
+
+	key := cache.NewKey(req.SiteID).ID(URLKey(r)).Scopes(req.SiteID)
+	data, err := a.cache.Get(key, func() ([]byte, error) {
+		users, total, e := a.dataService.Users(req)
+		if e != nil {
+			return nil, e
+		}
+		return encodeJSONWithHTML(R.JSON{"users": users, "total": total})
+	})
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't get users", rest.ErrSiteNotFound)
+		return
+	}
+	if err = R.RenderJSONFromBytes(w, r, data); err != nil {
+		log.Printf("[WARN] can't render users for site %s", req.SiteID)
+	}
+}
+
+// GET /users/{userid}?site=siteID&limit=10 - user's activity summary, flags, details and recent comments
+func (a *admin) userSummaryCtrl(w http.ResponseWriter, r *http.Request) {
+	userID, siteID := r.PathValue("userid"), r.URL.Query().Get("site")
+	recent, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || recent <= 0 {
+		recent = defaultUserRecent
+	}
+
+	key := cache.NewKey(siteID).ID(URLKey(r)).Scopes(siteID, userID)
+	data, err := a.cache.Get(key, func() ([]byte, error) {
+		summary, e := a.dataService.UserSummary(siteID, userID, recent, rest.GetUserOrEmpty(r))
+		if e != nil {
+			return nil, e
+		}
+		return encodeJSONWithHTML(summary)
+	})
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't get user summary", rest.ErrInternal)
+		return
+	}
+	if err = R.RenderJSONFromBytes(w, r, data); err != nil {
+		log.Printf("[WARN] can't render summary of %s for site %s", userID, siteID)
+	}
+}
+
+// GET /events?site=siteID&after=0&limit=100 - site's journal of domain events with id greater than after, oldest first.
+// Returns next to pass as after for the following page, the same as after if no new events.
+func (a *admin) eventsCtrl(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	after, err := strconv.ParseUint(cmp.Or(query.Get("after"), "0"), 10, 64)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "bad after value", rest.ErrDecode)
+		return
+	}
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	if limit <= 0 || limit > maxEventsLimit {
+		limit = defaultEventsLimit
+	}
+	events, err := a.dataService.Events(query.Get("site"), after, limit)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't get events", rest.ErrActionRejected)
+		return
+	}
+	next := after
+	if len(events) > 0 {
+		next = events[len(events)-1].ID
+	}
+	R.RenderJSON(w, R.JSON{"events": events, "next": next})
+}
+
+// PUT /readonly?site=siteID&url=post-url&ro=1 - set or reset read-only status for the post
+func (a *admin) setReadOnlyCtrl(w http.ResponseWriter, r *http.Request) {
+	locator := store.Locator{SiteID: r.URL.Query().Get("site"), URL: r.URL.Query().Get("url")}
+	roStatus := r.URL.Query().Get("ro") == "1"
+
+	isRoByAge := func(info store.PostInfo) bool {
+		return a.readOnlyAge > 0 && !info.FirstTS.IsZero() &&
+			info.FirstTS.AddDate(0, 0, a.readOnlyAge).Before(time.Now())
+	}
+
+	// don't allow to reset ro for posts turned to ro by ReadOnlyAge
+	if !roStatus {
+		if info, e := a.dataService.Info(locator, a.readOnlyAge); e == nil && isRoByAge(info) {
+			rest.SendErrorJSON(w, r, http.StatusForbidden, fmt.Errorf("rejected"),
+				"read-only due the age", rest.ErrActionRejected)
+			return
+		}
+	}
+
+	if err := a.dataService.SetReadOnly(locator, roStatus); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't set readonly status", rest.ErrPostNotFound)
+		return
+	}
+	cdn.Flush(a.cache, locator.SiteID, locator.URL, locator.SiteID)
+	R.RenderJSON(w, R.JSON{"locator": locator, "read-only": roStatus})
+}
+
+// PUT /title/{id}?site=siteID&url=post-url - set comment PostTitle to page's title
+func (a *admin) setTitleCtrl(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	locator := store.Locator{SiteID: r.URL.Query().Get("site"), URL: r.URL.Query().Get("url")}
+
+	c, err := a.dataService.SetTitle(locator, id)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't set title", rest.ErrInternal)
+		return
+	}
+	log.Printf("[INFO] set comment's title %s to %q", id, c.PostTitle)
+
+	cdn.Flush(a.cache, locator.SiteID, locator.URL, lastCommentsScope)
+	R.RenderJSON(w, R.JSON{"id": id, "locator": locator})
+}
+
+// PUT /verify/{userid}?site=siteID&verified=1 - set or reset verified status for the user
+func (a *admin) setVerifyCtrl(w http.ResponseWriter, r *http.Request) {
+	userID := r.PathValue("userid")
+	siteID := r.URL.Query().Get("site")
+	verifyStatus := r.URL.Query().Get("verified") == "1"
+
+	if err := a.dataService.SetVerified(siteID, userID, verifyStatus); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't set verify status", rest.ErrActionRejected)
+		return
+	}
+	cdn.Flush(a.cache, siteID, siteID, userID)
+	R.RenderJSON(w, R.JSON{"user": userID, "verified": verifyStatus})
+}
+
+// PUT /approve/{id}?site=siteID&url=post-url
+// publish comment held for review
+func (a *admin) approveCommentCtrl(w http.ResponseWriter, r *http.Request) {
+	commentID := r.PathValue("id")
+	locator := store.Locator{SiteID: r.URL.Query().Get("site"), URL: r.URL.Query().Get("url")}
+
+	if err := a.dataService.Approve(locator, commentID); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't approve comment", rest.ErrActionRejected)
+		return
+	}
+	cdn.Flush(a.cache, locator.SiteID, locator.URL, lastCommentsScope, locator.SiteID)
+
+	// notification held with the comment sent on publishing
+	if a.notifyService != nil {
+		comment, err := a.dataService.Get(locator, commentID, rest.MustGetUserInfo(r))
+		if err != nil {
+			log.Printf("[WARN] can't load approved comment %s, not notified, %v", commentID, err)
+		} else if comment.Visibility != store.VisibilityStaff {
+			submitNotification(a.notifyService, a.dataService, comment)
+		}
+	}
+	R.RenderJSON(w, R.JSON{"id": commentID, "locator": locator, "approved": true})
+}
+
+// GET /pending?site=siteID - comments of the site held for review, oldest first
+func (a *admin) pendingCtrl(w http.ResponseWriter, r *http.Request) {
+	comments, err := a.dataService.Pending(r.URL.Query().Get("site"))
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't get pending comments", rest.ErrActionRejected)
+		return
+	}
+	R.RenderJSON(w, comments)
+}
+
+// GET /canned?site=site-id - list canned responses of the site
+func (a *admin) listCannedCtrl(w http.ResponseWriter, r *http.Request) {
+	R.RenderJSON(w, a.dataService.ListCannedResponses(r.URL.Query().Get("site")))
+}
+
+// PUT /canned/{id}?site=site-id - add or replace canned response, body is {"text": "response text"}
+func (a *admin) setCannedCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID := r.URL.Query().Get("site")
+	resp := service.CannedResponse{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, hardBodyLimit)).Decode(&resp); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't bind canned response", rest.ErrDecode)
+		return
+	}
+	resp.ID = r.PathValue("id")
+	if err := a.dataService.SetCannedResponse(siteID, resp); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't set canned response", rest.ErrActionRejected)
+		return
+	}
+	R.RenderJSON(w, resp)
+}
+
+// DELETE /canned/{id}?site=site-id - remove canned response
+func (a *admin) deleteCannedCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID, id := r.URL.Query().Get("site"), r.PathValue("id")
+	if err := a.dataService.DeleteCannedResponse(siteID, id); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't delete canned response", rest.ErrActionRejected)
+		return
+	}
+	R.RenderJSON(w, R.JSON{"id": id, "deleted": true})
+}
+
+// POST /canned/{id}/reply?site=site-id&url=post-url&pid=comment-id - post canned response as a reply to the comment
+func (a *admin) replyCannedCtrl(w http.ResponseWriter, r *http.Request) {
+	user := rest.MustGetUserInfo(r)
+	locator := store.Locator{SiteID: r.URL.Query().Get("site"), URL: r.URL.Query().Get("url")}
+	id, parentID := r.PathValue("id"), r.URL.Query().Get("pid")
+
+	resp, err := a.dataService.GetCannedResponse(locator.SiteID, id)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't get canned response", rest.ErrActionRejected)
+		return
+	}
+	parent, err := a.dataService.Get(locator, parentID, user)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't find comment", rest.ErrCommentNotFound)
+		return
+	}
+
+	comment := store.Comment{ParentID: parent.ID, Text: resp.Text, Orig: resp.Text, Locator: locator, User: user}
+	comment.User.IP = extractIP(r.RemoteAddr)
+	comment = a.commentFormatter.Format(comment, a.disableFancyTextFormatting)
+	commentID, err := a.dataService.Create(comment)
+	if errors.Is(err, service.ErrQuotaExceeded) {
+		rest.SendErrorJSON(w, r, http.StatusTooManyRequests, err, "comment rejected", rest.ErrQuotaExceeded)
+		return
+	}
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't save comment", rest.ErrInternal)
+		return
+	}
+	log.Printf("[INFO] moderator %s posted canned response %q as %s, reply to %s by %s on %s",
+		user.ID, id, commentID, parent.ID, parent.User.ID, locator.URL)
+
+	finalComment, err := a.dataService.Get(locator, commentID, user)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't load created comment", rest.ErrInternal)
+		return
+	}
+	cdn.Flush(a.cache, locator.SiteID, locator.URL, lastCommentsScope, user.ID, locator.SiteID)
+	if a.notifyService != nil {
+		a.notifyService.Submit(notify.Request{Comment: finalComment})
+	}
+	R.RenderJSON(w, &finalComment)
+}
+
+// PUT /poll?site=siteID&url=post-url - attach poll to the post, replaces existing poll with its votes.
+// Body is {"question": "q?", "options": ["a", "b"], "close_at": "2026-01-02T15:04:05Z"}, close_at is optional
+func (a *admin) setPollCtrl(w http.ResponseWriter, r *http.Request) {
+	locator := store.Locator{SiteID: r.URL.Query().Get("site"), URL: r.URL.Query().Get("url")}
+	p := poll.Poll{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, hardBodyLimit)).Decode(&p); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't bind poll", rest.ErrDecode)
+		return
+	}
+	p.Locator = locator
+	res, err := a.dataService.SetPoll(p)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't set poll", rest.ErrActionRejected)
+		return
+	}
+	cdn.Flush(a.cache, locator.SiteID, locator.URL)
+	R.RenderJSON(w, res)
+}
+
+// DELETE /poll?site=siteID&url=post-url - remove poll from the post
+func (a *admin) deletePollCtrl(w http.ResponseWriter, r *http.Request) {
+	locator := store.Locator{SiteID: r.URL.Query().Get("site"), URL: r.URL.Query().Get("url")}
+	if err := a.dataService.DeletePoll(locator); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't delete poll", rest.ErrActionRejected)
+		return
+	}
+	cdn.Flush(a.cache, locator.SiteID, locator.URL)
+	R.RenderJSON(w, R.JSON{"locator": locator, "deleted": true})
+}
+
+// PUT /highlight/{id}?site=siteID&url=post-url&highlight=1&note=text
+// highlight comment with optional note, or remove highlight with highlight=0
+func (a *admin) setHighlightCtrl(w http.ResponseWriter, r *http.Request) {
+	commentID := r.PathValue("id")
+	locator := store.Locator{SiteID: r.URL.Query().Get("site"), URL: r.URL.Query().Get("url")}
+	status := r.URL.Query().Get("highlight") == "1"
+
+	if err := a.dataService.SetHighlight(locator, commentID, status, r.URL.Query().Get("note")); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't set highlight status", rest.ErrActionRejected)
+		return
+	}
+	cdn.Flush(a.cache, locator.SiteID, locator.SiteID)
+	R.RenderJSON(w, R.JSON{"id": commentID, "locator": locator, "highlight": status})
+}
+
+// GET /stats?site=siteID - aggregated stats of clients made comments, browser families, embed vs direct and referrer domains
+func (a *admin) clientStatsCtrl(w http.ResponseWriter, r *http.Request) {
+	res, err := a.dataService.ClientStatsReport(r.URL.Query().Get("site"))
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't get client stats", rest.ErrActionRejected)
+		return
+	}
+	R.RenderJSON(w, res)
+}
+
+// PUT /pin/{id}?site=siteID&url=post-url&pin=1
+// mark/unmark comment as a special
+func (a *admin) setPinCtrl(w http.ResponseWriter, r *http.Request) {
+	commentID := r.PathValue("id")
 	locator := store.Locator{SiteID: r.URL.Query().Get("site"), URL: r.URL.Query().Get("url")}
 	pinStatus := r.URL.Query().Get("pin") == "1"
 
@@ -259,6 +1693,166 @@ func (a *admin) setPinCtrl(w http.ResponseWriter, r *http.Request) {
 		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't set pin status", rest.ErrActionRejected)
 		return
 	}
-	a.cache.Flush(cache.Flusher(locator.SiteID).Scopes(locator.URL))
+	cdn.Flush(a.cache, locator.SiteID, locator.URL)
 	R.RenderJSON(w, R.JSON{"id": commentID, "locator": locator, "pin": pinStatus})
 }
+
+// POST /totp/enroll?site=siteID - makes new totp secret of the admin, returns it with provisioning uri and QR code.
+// Authenticator already confirmed by a code can be replaced with verified step-up only.
+func (a *admin) enrollTOTPCtrl(w http.ResponseWriter, r *http.Request) {
+	user, err := rest.GetUserInfo(r)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusUnauthorized, err, "can't get user info", rest.ErrNoAccess)
+		return
+	}
+	siteID := r.URL.Query().Get("site")
+
+	current, err := a.dataService.TOTP(siteID, user.ID)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't get totp", rest.ErrInternal)
+		return
+	}
+	if current.Confirmed && !a.checkTOTPToken(r, siteID, user.ID, current) {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, errors.New("enrolled"), "totp verification required", rest.ErrTOTPRequired)
+		return
+	}
+
+	secret, err := service.NewTOTPSecret()
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't make totp secret", rest.ErrInternal)
+		return
+	}
+	if err = a.dataService.SetTOTP(siteID, user.ID, service.TOTP{Secret: secret}); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't store totp", rest.ErrInternal)
+		return
+	}
+
+	uri := service.TOTPURI(cmp.Or(a.totp.Issuer, "Remark42"), user.Name, secret)
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't generate QR", rest.ErrInternal)
+		return
+	}
+	log.Printf("[INFO] totp enrolled by %s, site %s", user.ID, siteID)
+	R.RenderJSON(w, R.JSON{"secret": secret, "uri": uri, "qr": "data:image/png;base64," + base64.StdEncoding.EncodeToString(png)})
+}
+
+// POST /totp/verify?site=siteID - checks the code of admin's authenticator app, {"code": "123456"}.
+// Confirms enrollment and allows admin API for totp ttl, with step-up token set as cookie and returned.
+func (a *admin) verifyTOTPCtrl(w http.ResponseWriter, r *http.Request) {
+	user, err := rest.GetUserInfo(r)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusUnauthorized, err, "can't get user info", rest.ErrNoAccess)
+		return
+	}
+	siteID := r.URL.Query().Get("site")
+
+	req := struct {
+		Code string `json:"code"`
+	}{}
+	if err = R.DecodeJSON(r, &req); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't decode totp code", rest.ErrDecode)
+		return
+	}
+	ok, err := a.dataService.CheckTOTP(siteID, user.ID, strings.TrimSpace(req.Code), time.Now())
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't check totp code", rest.ErrInternal)
+		return
+	}
+	if !ok {
+		log.Printf("[WARN] wrong totp code of %s, site %s", user.ID, siteID)
+		rest.SendErrorJSON(w, r, http.StatusForbidden, errors.New("wrong code"), "wrong totp code", rest.ErrTOTPRequired)
+		return
+	}
+	totp, err := a.dataService.TOTP(siteID, user.ID)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't get totp", rest.ErrInternal)
+		return
+	}
+
+	expires := time.Now().Add(cmp.Or(a.totp.TTL, defaultTOTPTTL))
+	tkn := a.makeTOTPToken(siteID, user.ID, totp, expires)
+	http.SetCookie(w, &http.Cookie{Name: totpCookieName, Value: tkn, Path: "/", Expires: expires, HttpOnly: true,
+		Secure: strings.HasPrefix(a.remarkURL, "https://"), SameSite: a.totp.SameSite})
+	R.RenderJSON(w, R.JSON{"token": tkn, "expires": expires})
+}
+
+// DELETE /totp/{userid}?site=siteID - removes totp of the admin, i.e. after lost authenticator, to be enrolled again
+func (a *admin) deleteTOTPCtrl(w http.ResponseWriter, r *http.Request) {
+	userID, siteID := r.PathValue("userid"), r.URL.Query().Get("site")
+	if err := a.dataService.SetTOTP(siteID, userID, service.TOTP{}); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't delete totp", rest.ErrInternal)
+		return
+	}
+	log.Printf("[INFO] totp of %s removed, site %s", userID, siteID)
+	R.RenderJSON(w, R.JSON{"user_id": userID, "site_id": siteID})
+}
+
+// totpStepUp is a middleware requiring step-up token of verified totp code from admins, if enabled.
+// Basic auth admin and admins authenticated by client certificate are not affected.
+func (a *admin) totpStepUp(next http.Handler) http.Handler {
+	if !a.totp.Enabled {
+		return next
+	}
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		user, err := rest.GetUserInfo(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if (user.Name == "admin" && user.ID == "admin") || a.isCertUser(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		siteID := r.URL.Query().Get("site")
+		totp, err := a.dataService.TOTP(siteID, user.ID)
+		if err != nil {
+			rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't get totp", rest.ErrInternal)
+			return
+		}
+		if !totp.Confirmed {
+			rest.SendErrorJSON(w, r, http.StatusForbidden, errors.New("not enrolled"), "totp enrollment required", rest.ErrTOTPRequired)
+			return
+		}
+		if !a.checkTOTPToken(r, siteID, user.ID, totp) {
+			rest.SendErrorJSON(w, r, http.StatusForbidden, errors.New("not verified"), "totp verification required", rest.ErrTOTPRequired)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
+// isCertUser checks if the request authenticated by admin's client certificate
+func (a *admin) isCertUser(r *http.Request) bool {
+	cert := verifiedClientCert(r)
+	if cert == nil {
+		return false
+	}
+	_, ok := a.adminCert.Users[cert.Subject.CommonName]
+	return ok
+}
+
+// makeTOTPToken makes step-up token of the admin valid till expiration, "<expiration>.<signature>".
+// Signature covers the totp secret, so token can't be used after the totp removed or enrolled again.
+func (a *admin) makeTOTPToken(siteID, userID string, totp service.TOTP, expires time.Time) string {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	return exp + "." + store.HashValue(strings.Join([]string{"totp", siteID, userID, exp, totp.Secret}, "\n"), a.sharedSecret)
+}
+
+// checkTOTPToken checks step-up token of the request, from the cookie or the header
+func (a *admin) checkTOTPToken(r *http.Request, siteID, userID string, totp service.TOTP) bool {
+	tkn := r.Header.Get(totpHeaderName)
+	if c, err := r.Cookie(totpCookieName); err == nil && tkn == "" {
+		tkn = c.Value
+	}
+	exp, _, ok := strings.Cut(tkn, ".")
+	if !ok {
+		return false
+	}
+	expires, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+	return hmac.Equal([]byte(tkn), []byte(a.makeTOTPToken(siteID, userID, totp, time.Unix(expires, 0))))
+}
@@ -3,13 +3,17 @@ package api
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -19,9 +23,27 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
 
+	"github.com/umputun/remark42/backend/app/notify"
+	"github.com/umputun/remark42/backend/app/resilient"
+	"github.com/umputun/remark42/backend/app/rest"
+	"github.com/umputun/remark42/backend/app/rest/shadow"
 	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/asset"
+	"github.com/umputun/remark42/backend/app/store/bot"
+	"github.com/umputun/remark42/backend/app/store/brigade"
+	"github.com/umputun/remark42/backend/app/store/cold"
+	"github.com/umputun/remark42/backend/app/store/engine"
+	"github.com/umputun/remark42/backend/app/store/event"
+	"github.com/umputun/remark42/backend/app/store/highlight"
+	"github.com/umputun/remark42/backend/app/store/invite"
+	"github.com/umputun/remark42/backend/app/store/page"
+	"github.com/umputun/remark42/backend/app/store/poll"
+	"github.com/umputun/remark42/backend/app/store/quota"
+	"github.com/umputun/remark42/backend/app/store/schedule"
 	"github.com/umputun/remark42/backend/app/store/service"
+	"github.com/umputun/remark42/backend/app/store/suppress"
 )
 
 func TestAdmin_Delete(t *testing.T) {
@@ -205,6 +227,198 @@ func TestAdmin_DeleteUser(t *testing.T) {
 	assert.True(t, cmntWithInfo.Comments[2].Deleted)
 }
 
+func TestAdmin_MergeUser(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	c1 := store.Comment{Text: "test test #1", User: store.User{ID: "id1", Name: "name"},
+		Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}}
+	c2 := store.Comment{Text: "test test #2", User: store.User{ID: "id2", Name: "name"},
+		Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}}
+	_, err := srv.DataService.Create(c1)
+	require.NoError(t, err)
+	_, err = srv.DataService.Create(c2)
+	require.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/admin/user/id1/merge?site=remark42&to=id2", http.NoBody)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+	resp, err := sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+	assert.Contains(t, string(body), `"merged":{"comments":1,"votes":0,"dropped_votes":0}`)
+
+	comments, err := srv.DataService.User("remark42", "id2", 10, 0, store.User{})
+	require.NoError(t, err)
+	assert.Len(t, comments, 2)
+	linked, err := srv.DataService.LinkedUser("remark42", "id1")
+	require.NoError(t, err)
+	assert.Equal(t, "id2", linked)
+
+	req, err = http.NewRequest(http.MethodPost, ts.URL+"/api/v1/admin/user/id2/merge?site=remark42", http.NoBody)
+	require.NoError(t, err)
+	resp, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "no target")
+
+	req, err = http.NewRequest(http.MethodPost, ts.URL+"/api/v1/admin/user/id2/merge?site=remark42&to=id1", http.NoBody)
+	require.NoError(t, err)
+	resp, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "target linked")
+}
+
+func TestAdmin_LogoutUser(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/admin/user/provider1_dev/logout?site=remark42", http.NoBody)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+	resp, err := sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+	assert.Contains(t, string(body), `"site_id":"remark42","user_id":"provider1_dev"`)
+
+	assert.True(t, srv.DataService.IsTokenRevoked("remark42", "provider1_dev", time.Now().Add(-time.Minute)))
+	assert.False(t, srv.DataService.IsTokenRevoked("remark42", "provider1_dev2", time.Now().Add(-time.Minute)), "other user")
+}
+
+func TestAdmin_ImportComment(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	send := func(body, tkn string) (string, int) {
+		client := http.Client{}
+		defer client.CloseIdleConnections()
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/admin/comment/import?site=remark42", strings.NewReader(body))
+		require.NoError(t, err)
+		if tkn == "" {
+			req.SetBasicAuth("admin", "password")
+		} else {
+			req.Header.Set("X-JWT", tkn)
+		}
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return string(b), resp.StatusCode
+	}
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/admin/comment/import?site=remark42", http.NoBody)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+
+	body, code := send(`{"url":"https://radio-t.com/blah","text":"**bridged**","time":"2020-05-12T10:20:30Z",`+
+		`"user":{"id":"telegram_123","name":"tg user"}}`, "")
+	require.Equal(t, http.StatusCreated, code, body)
+	parent := store.Comment{}
+	require.NoError(t, json.Unmarshal([]byte(body), &parent))
+	assert.True(t, parent.Imported)
+	assert.Equal(t, "<p><strong>bridged</strong></p>\n", parent.Text)
+	assert.Equal(t, "telegram_123", parent.User.ID)
+	assert.Equal(t, time.Date(2020, 5, 12, 10, 20, 30, 0, time.UTC), parent.Timestamp.UTC())
+
+	body, code = send(`{"pid":"`+parent.ID+`","url":"https://radio-t.com/blah","text":"reply","user":{"id":"bot","name":"bot"}}`, "")
+	require.Equal(t, http.StatusCreated, code, body)
+	reply := store.Comment{}
+	require.NoError(t, json.Unmarshal([]byte(body), &reply))
+	assert.Equal(t, parent.ID, reply.ParentID)
+	comments, err := srv.DataService.Find(store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}, "time", store.User{})
+	require.NoError(t, err)
+	assert.Len(t, comments, 2)
+
+	_, code = send(`{"pid":"unknown","url":"https://radio-t.com/blah","text":"reply","user":{"id":"bot","name":"bot"}}`, "")
+	assert.Equal(t, http.StatusBadRequest, code, "unknown parent")
+	_, code = send(`{"url":"https://radio-t.com/blah","text":"no author"}`, "")
+	assert.Equal(t, http.StatusBadRequest, code)
+	_, code = send(`bad json`, "")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	require.NoError(t, srv.DataService.SetRole("remark42", "provider1_dev", service.RoleModerator))
+	_, code = send(`{"url":"https://radio-t.com/blah","text":"text","user":{"id":"bot","name":"bot"}}`, devToken)
+	assert.Equal(t, http.StatusForbidden, code, "moderators can't import")
+}
+
+func TestAdmin_Bots(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	send := func(method, url, body string, headers map[string]string) (string, int) {
+		client := http.Client{}
+		defer client.CloseIdleConnections()
+		req, err := http.NewRequest(method, ts.URL+url, strings.NewReader(body))
+		require.NoError(t, err)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		if len(headers) == 0 {
+			req.SetBasicAuth("admin", "password")
+		}
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return string(b), resp.StatusCode
+	}
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/bots?site=remark42", http.NoBody)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+	_, code := send(http.MethodGet, "/api/v1/admin/bots?site=remark42", "", nil)
+	assert.Equal(t, http.StatusBadRequest, code, "bots disabled")
+
+	srv.DataService.BotStore, err = bot.NewBoltStorage(t.TempDir()+"/bots.db", bolt.Options{})
+	require.NoError(t, err)
+
+	body, code := send(http.MethodPost, "/api/v1/admin/bot?site=remark42", `{"name":"bridge bot"}`, nil)
+	require.Equal(t, http.StatusOK, code, body)
+	created := struct {
+		Bot bot.Bot `json:"bot"`
+		Key string  `json:"key"`
+	}{}
+	require.NoError(t, json.Unmarshal([]byte(body), &created))
+	assert.Equal(t, "bridge bot", created.Bot.Name)
+	require.NotEmpty(t, created.Key)
+
+	body, code = send(http.MethodGet, "/api/v1/admin/bots?site=remark42", "", nil)
+	require.Equal(t, http.StatusOK, code, body)
+	assert.Contains(t, body, `"name":"bridge bot"`)
+	assert.NotContains(t, body, "key_hash")
+
+	botKey := map[string]string{"X-Bot-Key": created.Key}
+	body, code = send(http.MethodPost, "/api/v1/comment?site=remark42",
+		`{"text":"bridged message","locator":{"url":"https://radio-t.com/blah1","site":"remark42"}}`, botKey)
+	require.Equal(t, http.StatusCreated, code, body)
+	c := store.Comment{}
+	require.NoError(t, json.Unmarshal([]byte(body), &c))
+	assert.Equal(t, created.Bot.ID, c.User.ID)
+	assert.True(t, c.User.Bot, "bot marked in the comment")
+	assert.False(t, c.User.Admin)
+
+	_, code = send(http.MethodPut, "/api/v1/vote/"+c.ID+"?site=remark42&url=https://radio-t.com/blah1&vote=1", "", botKey)
+	assert.Equal(t, http.StatusForbidden, code, "bots can't vote")
+	_, code = send(http.MethodGet, "/api/v1/user?site=remark42", "", map[string]string{"X-Bot-Key": created.Key + "0"})
+	assert.Equal(t, http.StatusUnauthorized, code, "wrong key")
+	_, code = send(http.MethodGet, "/api/v1/user?site=other", "", botKey)
+	assert.Equal(t, http.StatusUnauthorized, code, "key of other site")
+
+	body, code = send(http.MethodDelete, "/api/v1/admin/bot/"+created.Bot.ID+"?site=remark42", "", nil)
+	require.Equal(t, http.StatusOK, code, body)
+	_, code = send(http.MethodGet, "/api/v1/user?site=remark42", "", botKey)
+	assert.Equal(t, http.StatusUnauthorized, code, "deleted bot")
+}
+
 func TestAdmin_Pin(t *testing.T) {
 	ts, _, teardown := startupT(t)
 	defer teardown()
@@ -364,638 +578,2802 @@ func TestAdmin_Block(t *testing.T) {
 	assert.False(t, srv.adminRest.dataService.IsBlocked("remark42", "user2"))
 }
 
-func TestAdmin_BlockedList(t *testing.T) {
+func TestAdmin_Users(t *testing.T) {
 	ts, srv, teardown := startupT(t)
 	defer teardown()
 
-	c1 := store.Comment{Text: "test test #1", Locator: store.Locator{SiteID: "remark42",
-		URL: "https://radio-t.com/blah"}, User: store.User{Name: "user1 name", ID: "user1"}}
-	c2 := store.Comment{Text: "test test #2", ParentID: "p1", Locator: store.Locator{SiteID: "remark42",
-		URL: "https://radio-t.com/blah"}, User: store.User{Name: "user2 name", ID: "user2"}}
-
-	// write comments for user1 and user2
-	_, err := srv.DataService.Create(c1)
-	assert.NoError(t, err)
-	_, err = srv.DataService.Create(c2)
-	assert.NoError(t, err)
-
-	// block user1
-	req, err := http.NewRequest(http.MethodPut,
-		fmt.Sprintf("%s/api/v1/admin/user/%s?site=remark42&block=%d", ts.URL, "user1", 1), http.NoBody)
-	assert.NoError(t, err)
-	res, err := sendReq(t, req, adminUmputunToken)
-	require.NoError(t, err)
-	require.NoError(t, res.Body.Close())
-	assert.Equal(t, http.StatusOK, res.StatusCode)
+	for i, u := range []store.User{{Name: "user1 name", ID: "user1"}, {Name: "user2 name", ID: "user2"}, {Name: "user1 name", ID: "user1"}} {
+		_, err := srv.DataService.Create(store.Comment{Text: fmt.Sprintf("test test #%d", i), User: u,
+			Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}})
+		require.NoError(t, err)
+	}
 
-	// block user2
-	req, err = http.NewRequest(http.MethodPut,
-		fmt.Sprintf("%s/api/v1/admin/user/%s?site=remark42&block=%d&ttl=150ms", ts.URL, "user2", 1), http.NoBody)
-	assert.NoError(t, err)
-	res, err = sendReq(t, req, adminUmputunToken)
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/users?site=remark42", http.NoBody)
 	require.NoError(t, err)
-	require.NoError(t, res.Body.Close())
-	assert.Equal(t, http.StatusOK, res.StatusCode)
+	requireAdminOnly(t, req)
 
-	req, err = http.NewRequest("GET", ts.URL+"/api/v1/admin/blocked?site=remark42", http.NoBody)
-	require.NoError(t, err)
-	res, err = sendReq(t, req, adminUmputunToken)
-	require.NoError(t, err)
-	require.Equal(t, http.StatusOK, res.StatusCode)
-	users := []store.BlockedUser{}
-	err = json.NewDecoder(res.Body).Decode(&users)
-	assert.NoError(t, err)
-	require.NoError(t, res.Body.Close())
-	require.Equal(t, 2, len(users), "two users blocked")
-	assert.Equal(t, "user1", users[0].ID)
-	assert.Equal(t, "user1 name", users[0].Name)
-	assert.Equal(t, "user2", users[1].ID)
-	assert.Equal(t, "user2 name", users[1].Name)
-	t.Logf("%+v", users)
-	time.Sleep(150 * time.Millisecond)
+	get := func(url string) (code int, body []byte) {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+url, http.NoBody)
+		require.NoError(t, err)
+		resp, err := sendReq(t, req, adminUmputunToken)
+		require.NoError(t, err)
+		body, err = io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp.StatusCode, body
+	}
 
-	req, err = http.NewRequest("GET", ts.URL+"/api/v1/admin/blocked?site=remark42", http.NoBody)
+	code, body := get("/api/v1/admin/users?site=remark42&sort=-comments")
+	require.Equal(t, http.StatusOK, code, string(body))
+	res := struct {
+		Users []service.SiteUser `json:"users"`
+		Total int                `json:"total"`
+	}{}
+	require.NoError(t, json.Unmarshal(body, &res))
+	assert.Equal(t, 2, res.Total)
+	require.Len(t, res.Users, 2)
+	assert.Equal(t, "user1", res.Users[0].ID)
+	assert.Equal(t, 2, res.Users[0].Comments)
+	assert.Equal(t, "user2", res.Users[1].ID)
+
+	code, body = get("/api/v1/admin/users?site=remark42&q=user2&limit=1")
+	require.Equal(t, http.StatusOK, code, string(body))
+	require.NoError(t, json.Unmarshal(body, &res))
+	assert.Equal(t, 1, res.Total)
+	require.Len(t, res.Users, 1)
+	assert.Equal(t, "user2", res.Users[0].ID)
+
+	// verified flag visible right away, cache flushed
+	req, err = http.NewRequest(http.MethodPut, ts.URL+"/api/v1/admin/verify/user2?site=remark42&verified=1", http.NoBody)
 	require.NoError(t, err)
-	res, err = sendReq(t, req, adminUmputunToken)
+	resp, err := sendReq(t, req, adminUmputunToken)
 	require.NoError(t, err)
-	require.Equal(t, http.StatusOK, res.StatusCode)
-	users = []store.BlockedUser{}
-	err = json.NewDecoder(res.Body).Decode(&users)
-	assert.NoError(t, err)
-	require.NoError(t, res.Body.Close())
-	assert.Equal(t, 1, len(users), "one user left blocked")
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	code, body = get("/api/v1/admin/users/user2?site=remark42&limit=5")
+	require.Equal(t, http.StatusOK, code, string(body))
+	summary := service.SiteUserDetail{}
+	require.NoError(t, json.Unmarshal(body, &summary))
+	assert.Equal(t, "user2", summary.ID)
+	assert.Equal(t, "user2 name", summary.Name)
+	assert.True(t, summary.Verified)
+	assert.Equal(t, "user2", summary.Details.UserID)
+	require.Len(t, summary.Recent, 1)
+	assert.Equal(t, "test test #1", summary.Recent[0].Text)
+
+	code, _ = get("/api/v1/admin/users/unknown?site=remark42")
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = get("/api/v1/admin/users?site=bad")
+	assert.Equal(t, http.StatusForbidden, code, "rejected by site match")
 }
 
-func TestAdmin_ReadOnly(t *testing.T) {
+func TestAdmin_Reencrypt(t *testing.T) {
 	ts, srv, teardown := startupT(t)
 	defer teardown()
 
-	c1 := store.Comment{Text: "test test #1", Locator: store.Locator{SiteID: "remark42",
-		URL: "https://radio-t.com/blah"}, User: store.User{Name: "user1 name", ID: "user1"}}
-	c2 := store.Comment{Text: "test test #2", ParentID: "p1", Locator: store.Locator{SiteID: "remark42",
-		URL: "https://radio-t.com/blah"}, User: store.User{Name: "user2", ID: "user2"}}
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/admin/reencrypt?site=remark42", http.NoBody)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
 
-	_, err := srv.DataService.Create(c1)
-	assert.NoError(t, err)
-	_, err = srv.DataService.Create(c2)
-	assert.NoError(t, err)
+	post := func() (code int, body []byte) {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/admin/reencrypt?site=remark42", http.NoBody)
+		require.NoError(t, err)
+		resp, err := sendReq(t, req, adminUmputunToken)
+		require.NoError(t, err)
+		body, err = io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp.StatusCode, body
+	}
 
-	info, err := srv.DataService.Info(store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}, 0)
-	assert.NoError(t, err)
-	assert.False(t, info.ReadOnly)
+	code, body := post()
+	assert.Equal(t, http.StatusBadRequest, code, "encryption disabled")
+	assert.Contains(t, string(body), "can't re-encrypt user details")
 
-	// set post to read-only
-	req, err := http.NewRequest(http.MethodPut,
-		fmt.Sprintf("%s/api/v1/admin/readonly?site=remark42&url=https://radio-t.com/blah&ro=1", ts.URL), http.NoBody)
-	assert.NoError(t, err)
-	resp, err := sendReq(t, req, "") // non-admin user
+	_, err = srv.DataService.SetUserEmail("remark42", "user1", "user1@example.com")
 	require.NoError(t, err)
-	require.NoError(t, resp.Body.Close())
-	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
-	resp, err = sendReq(t, req, adminUmputunToken)
+	srv.DataService.DetailCipher, err = service.NewDetailCipher("new-key", "old-key")
 	require.NoError(t, err)
-	require.NoError(t, resp.Body.Close())
-	assert.Equal(t, http.StatusOK, resp.StatusCode)
-	info, err = srv.DataService.Info(store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}, 0)
-	assert.NoError(t, err)
-	assert.True(t, info.ReadOnly)
 
-	// try to write comment
-	c := store.Comment{Text: "test test #2", ParentID: "p1",
-		Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}}
-	b, err := json.Marshal(c)
-	assert.NoError(t, err, "can't marshal comment %+v", c)
-	req, err = http.NewRequest("POST", ts.URL+"/api/v1/comment?site=remark42", bytes.NewBuffer(b))
-	require.NoError(t, err)
-	resp, err = sendReq(t, req, adminUmputunToken)
-	require.NoError(t, err)
-	require.NoError(t, resp.Body.Close())
-	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	code, body = post()
+	require.Equal(t, http.StatusOK, code, string(body))
+	assert.JSONEq(t, `{"site":"remark42","updated":1}`, string(body))
 
-	// reset post's read-only
-	req, err = http.NewRequest(http.MethodPut,
-		fmt.Sprintf("%s/api/v1/admin/readonly?site=remark42&url=https://radio-t.com/blah&ro=0", ts.URL), http.NoBody)
-	assert.NoError(t, err)
-	resp, err = sendReq(t, req, adminUmputunToken)
-	require.NoError(t, err)
-	require.NoError(t, resp.Body.Close())
-	assert.Equal(t, http.StatusOK, resp.StatusCode)
-	info, err = srv.DataService.Info(store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}, 0)
-	assert.NoError(t, err)
-	assert.False(t, info.ReadOnly)
+	code, body = post()
+	require.Equal(t, http.StatusOK, code, string(body))
+	assert.JSONEq(t, `{"site":"remark42","updated":0}`, string(body), "already encrypted with the current key")
 
-	// try to write comment
-	c = store.Comment{Text: "test test #2", ParentID: "p1",
-		Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}}
-	b, err = json.Marshal(c)
-	assert.NoError(t, err, "can't marshal comment %+v", c)
-	req, err = http.NewRequest("POST", ts.URL+"/api/v1/comment?site="+c.Locator.SiteID, bytes.NewBuffer(b))
-	require.NoError(t, err)
-	resp, err = sendReq(t, req, adminUmputunToken)
+	email, err := srv.DataService.GetUserEmail("remark42", "user1")
 	require.NoError(t, err)
-	require.NoError(t, resp.Body.Close())
-	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "user1@example.com", email)
 }
 
-func TestAdmin_ReadOnlyNoComments(t *testing.T) {
+func TestAdmin_ModerationExportImport(t *testing.T) {
 	ts, srv, teardown := startupT(t)
 	defer teardown()
 
-	// set post to read-only
-	req, err := http.NewRequest(http.MethodPut,
-		fmt.Sprintf("%s/api/v1/admin/readonly?site=remark42&url=https://radio-t.com/blah&ro=1", ts.URL), http.NoBody)
-	assert.NoError(t, err)
+	send := func(method, url, contentType, body string) (code int, respBody string) {
+		req, err := http.NewRequest(method, ts.URL+url, strings.NewReader(body))
+		require.NoError(t, err)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		resp, err := sendReq(t, req, adminUmputunToken)
+		require.NoError(t, err)
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp.StatusCode, string(b)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/moderation/export?site=remark42", http.NoBody)
+	require.NoError(t, err)
 	requireAdminOnly(t, req)
-	resp, err := sendReq(t, req, adminUmputunToken)
+	req, err = http.NewRequest(http.MethodPost, ts.URL+"/api/v1/admin/moderation/import?site=remark42", http.NoBody)
 	require.NoError(t, err)
-	require.NoError(t, resp.Body.Close())
-	assert.Equal(t, http.StatusOK, resp.StatusCode)
-	_, err = srv.DataService.Info(store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}, 0)
-	assert.Error(t, err)
-
-	// test format "tree"
-	res, code := get(t, ts.URL+"/api/v1/find?site=remark42&url=https://radio-t.com/blah&format=tree")
-	assert.Equal(t, http.StatusOK, code)
-	comments := commentsWithInfo{}
-	err = json.Unmarshal([]byte(res), &comments)
-	assert.NoError(t, err)
-	assert.Equal(t, 0, len(comments.Comments), "should have 0 comments")
-	assert.True(t, comments.Info.ReadOnly)
-	t.Logf("%+v", comments)
+	requireAdminOnly(t, req)
 
-	// test format "plain"
-	res, code = get(t, ts.URL+"/api/v1/find?site=remark42&url=https://radio-t.com/blah")
-	assert.Equal(t, http.StatusOK, code)
-	comments = commentsWithInfo{}
-	err = json.Unmarshal([]byte(res), &comments)
-	assert.NoError(t, err)
-	assert.Equal(t, 0, len(comments.Comments), "should have 0 comments")
-	assert.True(t, comments.Info.ReadOnly)
-	t.Logf("%+v", comments)
+	// block with reason, verify
+	code, body := send(http.MethodPut, "/api/v1/admin/user/user1?site=remark42&block=1&reason=spam", "", "")
+	require.Equal(t, http.StatusOK, code, body)
+	code, body = send(http.MethodPut, "/api/v1/admin/verify/user2?site=remark42&verified=1", "", "")
+	require.Equal(t, http.StatusOK, code, body)
+
+	code, body = send(http.MethodGet, "/api/v1/admin/moderation/export?site=remark42", "", "")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.JSONEq(t, `[{"id":"user1","blocked":true,"reason":"spam"},{"id":"user2","verified":true}]`, body)
+
+	code, body = send(http.MethodGet, "/api/v1/admin/moderation/export?site=remark42&format=csv", "", "")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.Equal(t, "id,name,blocked,until,reason,verified\nuser1,,true,,spam,false\nuser2,,false,,,true\n", body)
+
+	// unblock clears reason
+	code, body = send(http.MethodPut, "/api/v1/admin/user/user1?site=remark42&block=0", "", "")
+	require.Equal(t, http.StatusOK, code, body)
+	code, body = send(http.MethodGet, "/api/v1/admin/moderation/export?site=remark42", "", "")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.JSONEq(t, `[{"id":"user2","verified":true}]`, body)
+
+	// import json
+	until := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	code, body = send(http.MethodPost, "/api/v1/admin/moderation/import?site=remark42", "",
+		fmt.Sprintf(`[{"id":"user3","blocked":true,"until":%q,"reason":"flood"},{"id":"user4","verified":true}]`, until.Format(time.RFC3339)))
+	require.Equal(t, http.StatusOK, code, body)
+	assert.JSONEq(t, `{"site":"remark42","imported":2}`, body)
+	assert.True(t, srv.DataService.IsBlocked("remark42", "user3"))
+	assert.True(t, srv.DataService.IsVerified("remark42", "user4"))
+
+	// import csv with reordered columns, detected by content type
+	code, body = send(http.MethodPost, "/api/v1/admin/moderation/import?site=remark42", "text/csv",
+		"verified,id,blocked\ntrue,user5,false\nfalse,user6,true\n")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.JSONEq(t, `{"site":"remark42","imported":2}`, body)
+	assert.True(t, srv.DataService.IsVerified("remark42", "user5"))
+	assert.True(t, srv.DataService.IsBlocked("remark42", "user6"))
+
+	users, err := srv.DataService.ModeratedUsers("remark42")
+	require.NoError(t, err)
+	require.Len(t, users, 5)
+	assert.Equal(t, "user3", users[1].ID)
+	assert.Equal(t, "flood", users[1].Reason)
+	assert.WithinDuration(t, until, users[1].Until, time.Second)
+
+	// bad input
+	code, _ = send(http.MethodPost, "/api/v1/admin/moderation/import?site=remark42", "", "{bad")
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = send(http.MethodPost, "/api/v1/admin/moderation/import?site=remark42&format=csv", "", "name,blocked\nx,true\n")
+	assert.Equal(t, http.StatusBadRequest, code, "no id column")
+	code, _ = send(http.MethodPost, "/api/v1/admin/moderation/import?site=remark42&format=csv", "", "id,blocked,until\nx,true,tomorrow\n")
+	assert.Equal(t, http.StatusBadRequest, code, "bad until")
 }
 
-func TestAdmin_ReadOnlyWithAge(t *testing.T) {
-	ts, srv, teardown := startupT(t)
+func TestAdmin_Reindex(t *testing.T) {
+	ts, _, teardown := startupT(t)
 	defer teardown()
 
-	c1 := store.Comment{Text: "test test #1", Locator: store.Locator{SiteID: "remark42",
-		URL: "https://radio-t.com/blah"}, User: store.User{Name: "user1 name", ID: "user1"},
-		Timestamp: time.Date(2001, 1, 1, 1, 1, 1, 0, time.Local)}
-	_, err := srv.DataService.Create(c1)
-	assert.NoError(t, err)
-
-	info, err := srv.DataService.Info(store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}, 10)
-	assert.NoError(t, err)
-	assert.True(t, info.ReadOnly, "ro by age")
+	send := func(method string) (code int, body string) {
+		req, err := http.NewRequest(method, ts.URL+"/api/v1/admin/reindex?site=remark42", http.NoBody)
+		require.NoError(t, err)
+		resp, err := sendReq(t, req, adminUmputunToken)
+		require.NoError(t, err)
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp.StatusCode, string(b)
+	}
 
-	// set post to read-only
-	req, err := http.NewRequest(http.MethodPut,
-		fmt.Sprintf("%s/api/v1/admin/readonly?site=remark42&url=https://radio-t.com/blah&ro=1", ts.URL), http.NoBody)
-	assert.NoError(t, err)
-	requireAdminOnly(t, req)
-	resp, err := sendReq(t, req, adminUmputunToken)
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/reindex?site=remark42", http.NoBody)
 	require.NoError(t, err)
-	require.NoError(t, resp.Body.Close())
-	assert.Equal(t, http.StatusOK, resp.StatusCode)
-	info, err = srv.DataService.Info(store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}, 0)
-	assert.NoError(t, err)
-	assert.True(t, info.ReadOnly)
+	requireAdminOnly(t, req)
 
-	// reset post's read-only
-	req, err = http.NewRequest(http.MethodPut,
-		fmt.Sprintf("%s/api/v1/admin/readonly?site=remark42&url=https://radio-t.com/blah&ro=0", ts.URL), http.NoBody)
-	assert.NoError(t, err)
-	resp, err = sendReq(t, req, adminUmputunToken)
-	require.NoError(t, err)
-	require.NoError(t, resp.Body.Close())
-	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
-	info, err = srv.DataService.Info(store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}, 0)
-	assert.NoError(t, err)
-	assert.True(t, info.ReadOnly)
+	code, _ := send(http.MethodGet)
+	assert.Equal(t, http.StatusNotFound, code, "never started")
+
+	addComment(t, store.Comment{Text: "test test #1", Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}}, ts)
+
+	code, body := send(http.MethodPost)
+	require.Equal(t, http.StatusAccepted, code, body)
+	status := service.ReindexStatus{}
+	require.NoError(t, json.Unmarshal([]byte(body), &status))
+	assert.Equal(t, "remark42", status.SiteID)
+
+	require.Eventually(t, func() bool {
+		code, body = send(http.MethodGet)
+		require.Equal(t, http.StatusOK, code, body)
+		require.NoError(t, json.Unmarshal([]byte(body), &status))
+		return !status.Running
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, status.Done)
+	assert.Equal(t, 1, status.Total)
+	assert.Empty(t, status.Error)
+
+	res, code := get(t, ts.URL+"/api/v1/last/10?site=remark42")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, res, "test test #1")
 }
-func TestAdmin_Verify(t *testing.T) {
+
+func TestAdmin_Rerender(t *testing.T) {
 	ts, srv, teardown := startupT(t)
 	defer teardown()
 
-	c1 := store.Comment{Text: "test test #1", Locator: store.Locator{SiteID: "remark42",
-		URL: "https://radio-t.com/blah"}, User: store.User{Name: "user1 name", ID: "user1"}}
-	c2 := store.Comment{Text: "test test #2", ParentID: "p1", Locator: store.Locator{SiteID: "remark42",
-		URL: "https://radio-t.com/blah"}, User: store.User{Name: "user2", ID: "user2"}}
+	send := func(method string) (code int, body string) {
+		req, err := http.NewRequest(method, ts.URL+"/api/v1/admin/rerender?site=remark42", http.NoBody)
+		require.NoError(t, err)
+		resp, err := sendReq(t, req, adminUmputunToken)
+		require.NoError(t, err)
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp.StatusCode, string(b)
+	}
 
-	_, err := srv.DataService.Create(c1)
-	assert.NoError(t, err)
-	_, err = srv.DataService.Create(c2)
-	assert.NoError(t, err)
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/rerender?site=remark42", http.NoBody)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
 
-	verified := srv.DataService.IsVerified("remark42", "user1")
-	assert.False(t, verified)
+	code, _ := send(http.MethodGet)
+	assert.Equal(t, http.StatusNotFound, code, "never started")
+	code, _ = send(http.MethodPost)
+	assert.Equal(t, http.StatusBadRequest, code, "rendering not set")
 
-	req, err := http.NewRequest(http.MethodPut,
-		fmt.Sprintf("%s/api/v1/admin/verify/user1?site=remark42&verified=1", ts.URL), http.NoBody)
-	assert.NoError(t, err)
-	requireAdminOnly(t, req)
-	resp, err := sendReq(t, req, adminUmputunToken)
+	srv.DataService.Renderer = CommentRenderer{Formatter: srv.CommentFormatter}
+	id := addComment(t, store.Comment{Text: "test **test** #1", Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}}, ts)
+	comment, err := srv.DataService.Engine.Get(engine.GetRequest{Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}, CommentID: id})
 	require.NoError(t, err)
-	require.NoError(t, resp.Body.Close())
-	assert.Equal(t, http.StatusOK, resp.StatusCode)
-	verified = srv.DataService.IsVerified("remark42", "user1")
-	assert.True(t, verified)
+	comment.Text = "<p>buggy</p>"
+	require.NoError(t, srv.DataService.Engine.Update(comment))
+
+	code, body := send(http.MethodPost)
+	require.Equal(t, http.StatusAccepted, code, body)
+	status := service.RerenderStatus{}
+	require.NoError(t, json.Unmarshal([]byte(body), &status))
+	assert.Equal(t, "remark42", status.SiteID)
+
+	require.Eventually(t, func() bool {
+		code, body = send(http.MethodGet)
+		require.Equal(t, http.StatusOK, code, body)
+		require.NoError(t, json.Unmarshal([]byte(body), &status))
+		return !status.Running
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, status.Done)
+	assert.Equal(t, 1, status.Total)
+	assert.Equal(t, 1, status.Updated)
+	assert.Empty(t, status.Error)
+
+	comment, err = srv.DataService.Engine.Get(engine.GetRequest{Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}, CommentID: id})
+	require.NoError(t, err)
+	assert.Equal(t, "<p>test <strong>test</strong> #1</p>\n", comment.Text)
+}
 
-	res, code := get(t, ts.URL+"/api/v1/find?site=remark42&url=https://radio-t.com/blah&sort=+time")
-	assert.Equal(t, http.StatusOK, code)
-	comments := commentsWithInfo{}
-	err = json.Unmarshal([]byte(res), &comments)
-	assert.NoError(t, err)
-	require.Equal(t, 2, len(comments.Comments), "should have 2 comments")
-	assert.Equal(t, "test test #1", comments.Comments[0].Text)
-	assert.True(t, comments.Comments[0].User.Verified)
+func TestAdmin_Integrity(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
 
-	req, err = http.NewRequest(http.MethodPut,
-		fmt.Sprintf("%s/api/v1/admin/verify/user1?site=remark42&verified=0", ts.URL), http.NoBody)
-	assert.NoError(t, err)
-	resp, err = sendReq(t, req, adminUmputunToken)
+	send := func(method string) (code int, body string) {
+		req, err := http.NewRequest(method, ts.URL+"/api/v1/admin/integrity?site=remark42", http.NoBody)
+		require.NoError(t, err)
+		resp, err := sendReq(t, req, adminUmputunToken)
+		require.NoError(t, err)
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp.StatusCode, string(b)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/integrity?site=remark42", http.NoBody)
 	require.NoError(t, err)
-	require.NoError(t, resp.Body.Close())
-	assert.Equal(t, http.StatusOK, resp.StatusCode)
-	verified = srv.DataService.IsVerified("remark42", "user1")
-	assert.False(t, verified)
+	requireAdminOnly(t, req)
 
-	res, code = get(t, ts.URL+"/api/v1/find?site=remark42&url=https://radio-t.com/blah&sort=+time")
-	assert.Equal(t, http.StatusOK, code)
-	comments = commentsWithInfo{}
-	err = json.Unmarshal([]byte(res), &comments)
-	assert.NoError(t, err)
-	require.Equal(t, 2, len(comments.Comments), "should have 2 comments")
-	assert.Equal(t, "test test #1", comments.Comments[0].Text)
-	assert.False(t, comments.Comments[0].User.Verified)
+	code, _ := send(http.MethodGet)
+	assert.Equal(t, http.StatusNotFound, code, "never checked")
+
+	addComment(t, store.Comment{Text: "test test #1", Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}}, ts)
+	_, err = srv.DataService.Engine.Create(store.Comment{ID: "orphan", ParentID: "missing", Text: "orphan", Timestamp: time.Now(),
+		Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}, User: store.User{ID: "dev", Name: "dev"}})
+	require.NoError(t, err)
+
+	code, body := send(http.MethodPost)
+	require.Equal(t, http.StatusOK, code, body)
+	report := service.IntegrityReport{}
+	require.NoError(t, json.Unmarshal([]byte(body), &report))
+	assert.Equal(t, "remark42", report.SiteID)
+	assert.Equal(t, 2, report.Comments)
+	assert.Equal(t, map[string]int{service.IssueOrphan: 1}, report.Counts)
+
+	code, body = send(http.MethodGet)
+	require.Equal(t, http.StatusOK, code, body)
+	last := service.IntegrityReport{}
+	require.NoError(t, json.Unmarshal([]byte(body), &last))
+	assert.Equal(t, []service.IntegrityIssue{{Kind: service.IssueOrphan, URL: "https://radio-t.com/blah", CommentID: "orphan",
+		Details: "parent missing not found"}}, last.Issues)
 }
 
-func TestAdmin_ExportStream(t *testing.T) {
+func TestAdmin_Maintenance(t *testing.T) {
 	ts, _, teardown := startupT(t)
 	defer teardown()
 
-	c1 := store.Comment{Text: "test test #1",
-		Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah1"}}
-	c2 := store.Comment{Text: "test test #2", ParentID: "p1",
-		Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah2"}}
+	send := func(method, url, token, body string) (code int, respBody string) {
+		req, err := http.NewRequest(method, ts.URL+url, strings.NewReader(body))
+		require.NoError(t, err)
+		if token == "basic" {
+			req.SetBasicAuth("admin", "password")
+			token = ""
+		}
+		resp, err := sendReq(t, req, token)
+		require.NoError(t, err)
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp.StatusCode, string(b)
+	}
+	comment := `{"text": "test 123", "locator":{"url": "https://radio-t.com/blah1", "site": "remark42"}}`
 
-	addComment(t, c1, ts)
-	addComment(t, c2, ts)
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/maintenance?site=remark42", http.NoBody)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
 
-	body, code := getWithAdminAuth(t, ts.URL+"/api/v1/admin/export?site=remark42&mode=stream")
+	code, body := send(http.MethodGet, "/api/v1/admin/maintenance?site=remark42", adminUmputunToken, "")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.JSONEq(t, `{"site":{"enabled":false},"global":{"enabled":false}}`, body)
+
+	code, body = send(http.MethodPut, "/api/v1/admin/maintenance?site=remark42", adminUmputunToken, `{"enabled":true,"message":"restoring backup"}`)
+	require.Equal(t, http.StatusOK, code, body)
+	assert.Contains(t, body, `"message":"restoring backup"`)
+
+	// writes rejected, reads work
+	code, body = send(http.MethodPost, "/api/v1/comment?site=remark42", devToken, comment)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.JSONEq(t, `{"code":31,"details":"restoring backup","error":"maintenance mode"}`, body)
+	code, _ = send(http.MethodPut, "/api/v1/vote/123?site=remark42&url=https://radio-t.com/blah1&vote=1", devToken, "")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	code, _ = send(http.MethodGet, "/api/v1/find?site=remark42&url=https://radio-t.com/blah1", "", "")
 	assert.Equal(t, http.StatusOK, code)
-	assert.Equal(t, 3, strings.Count(body, "\n"))
-	assert.Equal(t, 2, strings.Count(body, "\"text\""))
-	t.Logf("%s", body)
+	code, body = send(http.MethodGet, "/api/v1/config?site=remark42", "", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, `"maintenance":"restoring backup"`)
+
+	// site admin can't change global mode
+	code, _ = send(http.MethodPut, "/api/v1/admin/maintenance?site=remark42&global=1", adminUmputunToken, `{"enabled":true}`)
+	assert.Equal(t, http.StatusForbidden, code)
+	code, _ = send(http.MethodPut, "/api/v1/admin/maintenance?site=remark42", adminUmputunToken, `{bad`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, body = send(http.MethodPut, "/api/v1/admin/maintenance?site=remark42", adminUmputunToken, `{"enabled":false}`)
+	require.Equal(t, http.StatusOK, code, body)
+	code, body = send(http.MethodPost, "/api/v1/comment?site=remark42", devToken, comment)
+	assert.Equal(t, http.StatusCreated, code, body)
+	code, body = send(http.MethodGet, "/api/v1/config?site=remark42", "", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.NotContains(t, body, `"maintenance"`)
+
+	// global mode set by basic auth admin
+	code, body = send(http.MethodPut, "/api/v1/admin/maintenance?site=remark42&global=1", "basic", `{"enabled":true}`)
+	require.Equal(t, http.StatusOK, code, body)
+	code, body = send(http.MethodPost, "/api/v1/comment?site=remark42", devToken, comment)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Contains(t, body, rest.DefaultMaintenanceMessage)
+	code, _ = send(http.MethodPost, "/api/v1/picture?site=remark42", devToken, "")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
 }
 
-func TestAdmin_ExportFile(t *testing.T) {
-	ts, _, teardown := startupT(t)
+func TestAdmin_Remotes(t *testing.T) {
+	tr := &resilient.Transport{Name: "store", Threshold: 1, Cooldown: time.Minute}
+	ts, _, teardown := startupT(t, func(srv *Rest) { srv.Remotes = []*resilient.Transport{tr, {Name: "image"}} })
 	defer teardown()
 
-	c1 := store.Comment{Text: "test test #1",
-		Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah1"}}
-	c2 := store.Comment{Text: "test test #2", ParentID: "p1",
-		Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah2"}}
-
-	addComment(t, c1, ts)
-	addComment(t, c2, ts)
+	_, err := (&http.Client{Transport: tr}).Get("http://127.0.0.1:1")
+	require.Error(t, err)
 
-	req, err := http.NewRequest("GET", ts.URL+"/api/v1/admin/export?site=remark42&mode=file", http.NoBody)
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/remotes", http.NoBody)
 	require.NoError(t, err)
 	requireAdminOnly(t, req)
-	resp, err := sendReq(t, req, adminUmputunToken)
+	body, code := getWithAdminAuth(t, ts.URL+"/api/v1/admin/remotes")
+	require.Equal(t, http.StatusOK, code, body)
+	res := []map[string]any{}
+	require.NoError(t, json.Unmarshal([]byte(body), &res))
+	require.Len(t, res, 2)
+	assert.Equal(t, "store", res[0]["name"])
+	assert.Equal(t, "open", res[0]["state"])
+	assert.InDelta(t, 1, res[0]["failures"], 0.1)
+	assert.NotEmpty(t, res[0]["opened_at"])
+	assert.Equal(t, map[string]any{"name": "image", "state": "closed", "failures": 0.0, "retried": 0.0, "rejected": 0.0}, res[1])
+}
+
+func TestAdmin_CSPReports(t *testing.T) {
+	ts, _, teardown := startupT(t)
+	defer teardown()
+	body, code := getWithAdminAuth(t, ts.URL+"/api/v1/admin/csp-reports")
+	assert.Equal(t, http.StatusNotFound, code, body)
+	resp, err := http.Post(ts.URL+"/api/v1/csp-report", "application/csp-report", strings.NewReader(`{"csp-report":{}}`))
 	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
 
-	assert.Equal(t, http.StatusOK, resp.StatusCode)
-	assert.Equal(t, "application/gzip", resp.Header.Get("Content-Type"))
+	ts2, _, teardown2 := startupT(t, func(srv *Rest) { srv.CSPReports = rest.NewCSPReports(10) })
+	defer teardown2()
+	req, err := http.NewRequest(http.MethodGet, ts2.URL+"/api/v1/admin/csp-reports", http.NoBody)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
 
-	ungzReader, err := gzip.NewReader(resp.Body)
-	assert.NoError(t, err)
-	assert.NoError(t, resp.Body.Close())
-	ungzBody, err := io.ReadAll(ungzReader)
-	assert.NoError(t, err)
-	assert.Equal(t, 3, strings.Count(string(ungzBody), "\n"))
-	assert.Equal(t, 2, strings.Count(string(ungzBody), "\"text\""))
-	t.Logf("%s", string(ungzBody))
+	report := `{"csp-report":{"document-uri":"https://remark42.example.com/web/iframe.html?site=remark42",
+		"violated-directive":"img-src 'self'","blocked-uri":"https://tracker.example.com/pixel.gif"}}`
+	for range 2 {
+		resp, err = http.Post(ts2.URL+"/api/v1/csp-report", "application/csp-report", strings.NewReader(report))
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	}
+	resp, err = http.Post(ts2.URL+"/api/v1/csp-report", "application/csp-report", strings.NewReader("bad"))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	body, code = getWithAdminAuth(t, ts2.URL+"/api/v1/admin/csp-reports")
+	require.Equal(t, http.StatusOK, code, body)
+	res := []rest.CSPReport{}
+	require.NoError(t, json.Unmarshal([]byte(body), &res))
+	require.Len(t, res, 1)
+	assert.Equal(t, "https://remark42.example.com/web/iframe.html", res[0].DocumentURI)
+	assert.Equal(t, "img-src", res[0].Directive)
+	assert.Equal(t, 2, res[0].Count)
 }
 
-func TestAdmin_DeleteMeRequest(t *testing.T) {
-	ts, srv, teardown := startupT(t)
+func TestAdmin_NotifyDeliveries(t *testing.T) {
+	failing := &failingDest{}
+	ts, srv, teardown := startupT(t, func(srv *Rest) { srv.NotifyService = notify.NewService(nil, 10, &notify.MockDest{}, failing) })
 	defer teardown()
+	defer srv.NotifyService.Close()
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/notify/deliveries?site=remark42", http.NoBody)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
 
-	c1 := store.Comment{Text: "test test #1", Locator: store.Locator{SiteID: "remark42",
-		URL: "https://radio-t.com/blah"}, User: store.User{Name: "user1 name", ID: "user1"}}
-	c2 := store.Comment{Text: "test test #2", ParentID: "p1", Locator: store.Locator{SiteID: "remark42",
-		URL: "https://radio-t.com/blah"}, User: store.User{Name: "user2", ID: "user2"}}
+	srv.NotifyService.Submit(notify.Request{Comment: store.Comment{ID: "c1", Locator: store.Locator{SiteID: "remark42"}}})
+	res := []notify.Delivery{}
+	require.Eventually(t, func() bool {
+		body, code := getWithAdminAuth(t, ts.URL+"/api/v1/admin/notify/deliveries?site=remark42")
+		require.Equal(t, http.StatusOK, code, body)
+		require.NoError(t, json.Unmarshal([]byte(body), &res))
+		return len(res) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	body, code := getWithAdminAuth(t, ts.URL+"/api/v1/admin/notify/deliveries?site=remark42&destination=failing")
+	require.Equal(t, http.StatusOK, code, body)
+	require.NoError(t, json.Unmarshal([]byte(body), &res))
+	require.Len(t, res, 1)
+	assert.Equal(t, "c1", res[0].CommentID)
+	assert.Equal(t, notify.DeliveryFailed, res[0].Status)
+	assert.Equal(t, "telegram api responded with 400: chat not found", res[0].Error)
+
+	resend := func(id string) (string, int) {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/admin/notify/deliveries/"+id+"/resend?site=remark42", http.NoBody)
+		require.NoError(t, err)
+		req.SetBasicAuth("admin", "password")
+		resp, err := sendReq(t, req, "")
+		require.NoError(t, err)
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return string(b), resp.StatusCode
+	}
+	body, code = resend(res[0].ID)
+	assert.Equal(t, http.StatusBadGateway, code, body)
+	body, code = resend("12345")
+	assert.Equal(t, http.StatusNotFound, code, body)
+
+	failing.ok.Store(true)
+	body, code = resend(res[0].ID)
+	require.Equal(t, http.StatusOK, code, body)
+	resent := notify.Delivery{}
+	require.NoError(t, json.Unmarshal([]byte(body), &resent))
+	assert.Equal(t, notify.DeliverySent, resent.Status)
+	assert.Equal(t, 2, resent.Retries)
+	assert.Empty(t, resent.Error)
+
+	body, code = getWithAdminAuth(t, ts.URL+"/api/v1/admin/notify/deliveries?site=other")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.Equal(t, "[]\n", body)
+}
 
-	_, err := srv.DataService.Create(c1)
-	assert.NoError(t, err)
-	_, err = srv.DataService.Create(c2)
-	assert.NoError(t, err)
+// failingDest is a notification destination failing to send till ok set
+type failingDest struct {
+	ok atomic.Bool
+}
 
-	comments, err := srv.DataService.User("remark42", "user1", 0, 0, store.User{})
-	assert.NoError(t, err)
-	assert.Equal(t, 1, len(comments), "a comment for user1")
+func (f *failingDest) Send(context.Context, notify.Request) error {
+	if f.ok.Load() {
+		return nil
+	}
+	return errors.New("telegram api responded with 400: chat not found")
+}
 
-	email, err := srv.DataService.SetUserEmail("remark42", "user1", "test@example.org")
-	assert.NoError(t, err)
-	assert.Equal(t, "test@example.org", email, "new email for user1")
+func (f *failingDest) SendVerification(context.Context, notify.VerificationRequest) error { return nil }
 
-	email, err = srv.DataService.GetUserEmail("remark42", "user1")
-	assert.NoError(t, err)
-	assert.Equal(t, "test@example.org", email, "new email for user1 is readable")
+func (f *failingDest) String() string { return "failing destination" }
 
-	claims := token.Claims{
-		SessionOnly: true,
-		RegisteredClaims: jwt.RegisteredClaims{
-			Audience:  jwt.ClaimStrings{"remark42"},
-			ID:        "1234567",
-			Issuer:    "remark42",
-			NotBefore: jwt.NewNumericDate(time.Now().Add(-1 * time.Minute)),
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(30 * time.Minute)),
-		},
-		User: &token.User{
-			ID:      "user1",
-			Picture: "https://demo.remark42.com/api/v1/avatar/pic.image", // production-shaped URL: removal must path.Base it to the avatar id
-			Attributes: map[string]any{
-				"delete_me": true,
-			},
-		},
+func TestAdmin_CORS(t *testing.T) {
+	ts, _, teardown := startupT(t)
+	defer teardown()
+
+	send := func(method, body string) (string, int) {
+		req, err := http.NewRequest(method, ts.URL+"/api/v1/admin/cors?site=remark42", strings.NewReader(body))
+		require.NoError(t, err)
+		req.SetBasicAuth("admin", "password")
+		resp, err := sendReq(t, req, "")
+		require.NoError(t, err)
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return string(b), resp.StatusCode
+	}
+	allowedOrigin := func(url, origin string) string {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+url, http.NoBody)
+		require.NoError(t, err)
+		req.SetBasicAuth("admin", "password")
+		req.Header.Set("Origin", origin)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		_, err = io.Copy(io.Discard, resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		return resp.Header.Get("Access-Control-Allow-Origin")
 	}
 
-	require.NoError(t, os.MkdirAll(os.TempDir()+"/ava-remark42/42", 0o700))
-	require.NoError(t, os.WriteFile(os.TempDir()+"/ava-remark42/42/pic.image", []byte("some image data"), 0o600))
+	req, err := http.NewRequest(http.MethodPut, ts.URL+"/api/v1/admin/cors?site=remark42", http.NoBody)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
 
-	tkn, err := srv.Authenticator.TokenService().Token(claims)
-	assert.NoError(t, err)
+	body, code := getWithAdminAuth(t, ts.URL+"/api/v1/admin/cors?site=remark42")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.JSONEq(t, `{"origins":["*"],"credentials":true,"max_age":300}`, body)
+	assert.Equal(t, "https://evil.example.com", allowedOrigin("/api/v1/find?site=remark42&url=https://radio-t.com/blah1", "https://evil.example.com"))
+
+	body, code = send(http.MethodPut, `{"origins":["https://blog.example.com"],"max_age":60}`)
+	require.Equal(t, http.StatusOK, code, body)
+	assert.JSONEq(t, `{"origins":["https://blog.example.com"],"credentials":false,"max_age":60}`, body)
+	assert.Empty(t, allowedOrigin("/api/v1/find?site=remark42&url=https://radio-t.com/blah1", "https://evil.example.com"))
+	assert.Equal(t, "https://blog.example.com", allowedOrigin("/api/v1/find?site=remark42&url=https://radio-t.com/blah1", "https://blog.example.com"))
+	assert.Empty(t, allowedOrigin("/api/v1/admin/export?site=remark42&mode=stream", "https://evil.example.com"), "streaming endpoint")
+	assert.Equal(t, "https://blog.example.com", allowedOrigin("/api/v1/admin/export?site=remark42&mode=stream", "https://blog.example.com"))
+
+	_, code = send(http.MethodPut, `{"origins":["blog.example.com"]}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	_, code = send(http.MethodPut, `bad json`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	body, code = send(http.MethodDelete, "")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.JSONEq(t, `{"origins":["*"],"credentials":true,"max_age":300}`, body)
+}
 
-	client := http.Client{}
-	defer client.CloseIdleConnections()
-	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/api/v1/admin/deleteme?token=%s", ts.URL, tkn), http.NoBody)
-	assert.NoError(t, err)
+func TestAdmin_Assets(t *testing.T) {
+	ts, _, teardown := startupT(t, func(srv *Rest) {
+		assetStore, err := asset.NewBoltStorage(path.Join(t.TempDir(), "assets.db"), bolt.Options{})
+		require.NoError(t, err)
+		srv.DataService.AssetStore = assetStore
+		srv.DataService.AssetLimits = service.AssetLimits{MaxSize: 100, MaxSiteSize: 1000}
+	})
+	defer teardown()
 
-	req.SetBasicAuth("admin", "password")
-	resp, err := client.Do(req)
+	send := func(method, url, body string) (string, int) {
+		req, err := http.NewRequest(method, ts.URL+url, strings.NewReader(body))
+		require.NoError(t, err)
+		req.SetBasicAuth("admin", "password")
+		resp, err := sendReq(t, req, "")
+		require.NoError(t, err)
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return string(b), resp.StatusCode
+	}
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/assets?site=remark42", http.NoBody)
 	require.NoError(t, err)
-	require.NoError(t, resp.Body.Close())
-	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	requireAdminOnly(t, req)
 
-	_, err = srv.DataService.User("remark42", "user1", 0, 0, store.User{})
-	assert.EqualError(t, err, "no comments for user user1 in store")
+	body, code := getWithAdminAuth(t, ts.URL+"/api/v1/admin/assets?site=remark42")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.Equal(t, "[]\n", body)
+	body, code = get(t, ts.URL+"/api/v1/config?site=remark42")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.NotContains(t, body, "custom_css")
+
+	body, code = send(http.MethodPut, "/api/v1/admin/asset/custom.css?site=remark42", "body{color:red}")
+	require.Equal(t, http.StatusOK, code, body)
+	saved := asset.Asset{}
+	require.NoError(t, json.Unmarshal([]byte(body), &saved))
+	assert.Equal(t, "custom.css", saved.Name)
+	assert.Equal(t, 15, saved.Size)
+	_, code = send(http.MethodPut, "/api/v1/admin/asset/script.js?site=remark42", "alert(1)")
+	assert.Equal(t, http.StatusBadRequest, code, "not allowed type")
+	_, code = send(http.MethodPut, "/api/v1/admin/asset/logo.png?site=remark42", strings.Repeat("x", 101))
+	assert.Equal(t, http.StatusBadRequest, code, "too large")
+
+	body, code = getWithAdminAuth(t, ts.URL+"/api/v1/admin/assets?site=remark42")
+	require.Equal(t, http.StatusOK, code, body)
+	list := []asset.Asset{}
+	require.NoError(t, json.Unmarshal([]byte(body), &list))
+	require.Len(t, list, 1)
+	assert.Equal(t, saved.Hash, list[0].Hash)
+
+	resp, err := http.Get(ts.URL + "/web/custom/remark42/custom.css")
+	require.NoError(t, err)
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "body{color:red}", string(b))
+	assert.Equal(t, "text/css; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Equal(t, `"`+saved.Hash+`"`, resp.Header.Get("ETag"))
+	assert.Equal(t, "public, max-age=3600", resp.Header.Get("Cache-Control"))
+	assert.Contains(t, resp.Header.Get("Content-Security-Policy"), "sandbox")
+
+	req, err = http.NewRequest(http.MethodGet, ts.URL+"/web/custom/remark42/custom.css", http.NoBody)
+	require.NoError(t, err)
+	req.Header.Set("If-None-Match", `"`+saved.Hash+`"`)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
 
-	email, err = srv.DataService.GetUserEmail("remark42", "user1")
-	assert.NoError(t, err)
-	assert.Empty(t, email, "user1 email was deleted")
+	body, code = get(t, ts.URL+"/api/v1/config?site=remark42")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.Contains(t, body, `"custom_css":"`)
+	assert.Contains(t, body, "/web/custom/remark42/custom.css?v="+saved.Hash[:8])
 
-	assert.NoFileExists(t, os.TempDir()+"/ava-remark42/42/pic.image", "user's avatar should be removed on deleteme")
+	resp, err = http.Get(ts.URL + "/web/custom/remark42/custom.css?v=" + saved.Hash[:8])
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "public, max-age=31536000, immutable", resp.Header.Get("Cache-Control"), "versioned link cached for long")
+	resp, err = http.Get(ts.URL + "/web/custom/remark42/custom.css?v=outdated")
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, "public, max-age=3600", resp.Header.Get("Cache-Control"))
+
+	body, code = send(http.MethodDelete, "/api/v1/admin/asset/custom.css?site=remark42", "")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.Contains(t, body, `"deleted":true`)
+	_, code = get(t, ts.URL+"/web/custom/remark42/custom.css")
+	assert.Equal(t, http.StatusNotFound, code)
+	_, code = send(http.MethodDelete, "/api/v1/admin/asset/custom.css?site=remark42", "")
+	assert.Equal(t, http.StatusNotFound, code)
 }
 
-// a delete_me request whose token carries a picture must still succeed when the avatar is
-// already gone from the store: the user data is deleted and a missing avatar is tolerated
-func TestAdmin_DeleteMeRequestMissingAvatar(t *testing.T) {
-	ts, srv, teardown := startupT(t)
+func TestAdmin_ArchiveThread(t *testing.T) {
+	ts, srv, teardown := startupT(t, func(srv *Rest) {
+		assetStore, err := asset.NewBoltStorage(path.Join(t.TempDir(), "assets.db"), bolt.Options{})
+		require.NoError(t, err)
+		srv.DataService.AssetStore = assetStore
+	})
 	defer teardown()
 
-	c1 := store.Comment{Text: "test test #1", Locator: store.Locator{SiteID: "remark42",
-		URL: "https://radio-t.com/blah"}, User: store.User{Name: "user3 name", ID: "user3"}}
-	_, err := srv.DataService.Create(c1)
-	require.NoError(t, err)
-
-	claims := token.Claims{
-		SessionOnly: true,
-		RegisteredClaims: jwt.RegisteredClaims{
-			Audience:  jwt.ClaimStrings{"remark42"},
-			ID:        "2345678",
-			Issuer:    "remark42",
-			NotBefore: jwt.NewNumericDate(time.Now().Add(-1 * time.Minute)),
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(30 * time.Minute)),
-		},
-		User: &token.User{
-			ID:      "user3",
-			Picture: "missing.image", // no avatar file exists for this picture in the store
-			Attributes: map[string]any{
-				"delete_me": true,
-			},
-		},
+	send := func(url string) (string, int) {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+url, http.NoBody)
+		require.NoError(t, err)
+		req.SetBasicAuth("admin", "password")
+		resp, err := sendReq(t, req, "")
+		require.NoError(t, err)
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return string(b), resp.StatusCode
 	}
 
-	tkn, err := srv.Authenticator.TokenService().Token(claims)
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/admin/archive?site=remark42&url=https://radio-t.com/blah", http.NoBody)
 	require.NoError(t, err)
+	requireAdminOnly(t, req)
 
-	client := http.Client{}
-	defer client.CloseIdleConnections()
-	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/api/v1/admin/deleteme?token=%s", ts.URL, tkn), http.NoBody)
-	require.NoError(t, err)
-	req.SetBasicAuth("admin", "password")
-	resp, err := client.Do(req)
-	require.NoError(t, err)
-	require.NoError(t, resp.Body.Close())
-	assert.Equal(t, http.StatusOK, resp.StatusCode, "a missing avatar must not fail the deletion")
+	c1 := store.Comment{Text: "first comment", Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}}
+	id1 := addComment(t, c1, ts)
+	addComment(t, store.Comment{Text: "reply", ParentID: id1, Locator: c1.Locator}, ts)
+
+	_, code := send("/api/v1/admin/archive?site=remark42")
+	assert.Equal(t, http.StatusBadRequest, code, "no url")
+	body, code := send("/api/v1/admin/archive?site=remark42&url=https://radio-t.com/blah")
+	assert.Equal(t, http.StatusBadRequest, code, "post not closed")
+	assert.Contains(t, body, "is not closed")
+
+	require.NoError(t, srv.DataService.SetReadOnly(c1.Locator, true))
+	body, code = send("/api/v1/admin/archive?site=remark42&url=https://radio-t.com/blah&remove=1")
+	require.Equal(t, http.StatusOK, code, body)
+	resp := struct {
+		Asset   asset.Asset `json:"asset"`
+		Link    string      `json:"link"`
+		Removed bool        `json:"removed"`
+	}{}
+	require.NoError(t, json.Unmarshal([]byte(body), &resp))
+	assert.True(t, resp.Removed)
+	assert.Equal(t, service.ArchiveName("https://radio-t.com/blah"), resp.Asset.Name)
+	assert.Equal(t, "https://demo.remark42.com/web/custom/remark42/"+resp.Asset.Name, resp.Link)
+
+	body, code = get(t, ts.URL+"/web/custom/remark42/"+resp.Asset.Name)
+	require.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "<p>first comment</p>")
+	assert.Contains(t, body, "<p>reply</p>")
 
-	_, err = srv.DataService.User("remark42", "user3", 0, 0, store.User{})
-	assert.EqualError(t, err, "no comments for user user3 in store", "user3 comments should be deleted")
+	body, code = get(t, ts.URL+"/api/v1/find?site=remark42&url=https://radio-t.com/blah&format=plain")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.NotContains(t, body, "first comment", "comments removed")
+	assert.NotContains(t, body, "reply")
 }
 
-// a genuine (non not-found) avatar-store failure must now surface, not be silently swallowed:
-// avatar.ErrNotFound lets deleteMeRequestCtrl tell an already-gone avatar from a real error
-func TestAdmin_DeleteMeRequestAvatarRemoveError(t *testing.T) {
+func TestAdmin_Cold(t *testing.T) {
 	ts, srv, teardown := startupT(t)
 	defer teardown()
 
-	c1 := store.Comment{Text: "test test #1", Locator: store.Locator{SiteID: "remark42",
-		URL: "https://radio-t.com/blah"}, User: store.User{Name: "user5 name", ID: "user5"}}
-	_, err := srv.DataService.Create(c1)
-	require.NoError(t, err)
+	send := func(url string) (string, int) {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+url, http.NoBody)
+		require.NoError(t, err)
+		req.SetBasicAuth("admin", "password")
+		resp, err := sendReq(t, req, "")
+		require.NoError(t, err)
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return string(b), resp.StatusCode
+	}
 
-	// put a non-empty directory where the avatar file is expected, so Store.Remove fails with a real
-	// error (directory not empty), not os.ErrNotExist - "pic" hashes to partition 42
-	require.NoError(t, os.MkdirAll(os.TempDir()+"/ava-remark42/42/pic.image", 0o700))
-	require.NoError(t, os.WriteFile(os.TempDir()+"/ava-remark42/42/pic.image/child", []byte("x"), 0o600))
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/cold?site=remark42", http.NoBody)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
 
-	claims := token.Claims{
-		SessionOnly: true,
-		RegisteredClaims: jwt.RegisteredClaims{
-			Audience:  jwt.ClaimStrings{"remark42"},
-			ID:        "4567890",
-			Issuer:    "remark42",
-			NotBefore: jwt.NewNumericDate(time.Now().Add(-1 * time.Minute)),
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(30 * time.Minute)),
-		},
-		User: &token.User{
-			ID:      "user5",
-			Picture: "https://demo.remark42.com/api/v1/avatar/pic.image",
-			Attributes: map[string]any{
-				"delete_me": true,
-			},
-		},
-	}
+	_, code := getWithAdminAuth(t, ts.URL+"/api/v1/admin/cold?site=remark42")
+	assert.Equal(t, http.StatusBadRequest, code, "cold storage disabled")
 
-	tkn, err := srv.Authenticator.TokenService().Token(claims)
+	srv.DataService.ColdStore, err = cold.NewBoltStorage(path.Join(t.TempDir(), "cold.db"), bolt.Options{})
 	require.NoError(t, err)
 
-	client := http.Client{}
-	defer client.CloseIdleConnections()
-	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/api/v1/admin/deleteme?token=%s", ts.URL, tkn), http.NoBody)
+	c1 := store.Comment{Text: "first comment", Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}}
+	addComment(t, c1, ts)
+	body, code := get(t, ts.URL+"/api/v1/find?site=remark42&url=https://radio-t.com/blah&format=plain")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.Contains(t, body, "first comment")
+
+	_, code = send("/api/v1/admin/cold/freeze?site=remark42&inactive=bad")
+	assert.Equal(t, http.StatusBadRequest, code)
+	body, code = send("/api/v1/admin/cold/freeze?site=remark42&inactive=1ns")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.JSONEq(t, `{"site":"remark42","frozen":1}`, body)
+
+	body, code = getWithAdminAuth(t, ts.URL+"/api/v1/admin/cold?site=remark42")
+	require.Equal(t, http.StatusOK, code, body)
+	segments := []cold.Segment{}
+	require.NoError(t, json.Unmarshal([]byte(body), &segments))
+	require.Len(t, segments, 1)
+	assert.Equal(t, "https://radio-t.com/blah", segments[0].URL)
+	assert.Equal(t, 1, segments[0].Count)
+
+	body, code = get(t, ts.URL+"/api/v1/find?site=remark42&url=https://radio-t.com/blah&format=plain")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.Contains(t, body, "first comment", "served from cold storage")
+
+	body, code = send("/api/v1/admin/cold/thaw?site=remark42&url=https://radio-t.com/blah")
+	require.Equal(t, http.StatusOK, code, body)
+	_, code = send("/api/v1/admin/cold/thaw?site=remark42&url=https://radio-t.com/blah")
+	assert.Equal(t, http.StatusNotFound, code)
+	segments, err = srv.DataService.ColdPosts("remark42")
 	require.NoError(t, err)
-	req.SetBasicAuth("admin", "password")
-	resp, err := client.Do(req)
+	assert.Empty(t, segments)
+	count, err := srv.DataService.Engine.Count(engine.FindRequest{Locator: c1.Locator})
 	require.NoError(t, err)
-	require.NoError(t, resp.Body.Close())
-	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode, "a real avatar-store failure must surface, not be swallowed")
-}
-
-func TestAvatarIDFromPicture(t *testing.T) {
-	tbl := []struct {
-		name    string
-		picture string
-		want    string
-	}{
-		{"local avatar url", "https://demo.remark42.com/api/v1/avatar/cb42ff493ade696d88a3a590f136ae9e34de7c1b.image", "cb42ff493ade696d88a3a590f136ae9e34de7c1b.image"},
-		{"bare avatar id", "pic.image", "pic.image"},
-		{"parent sentinel", "https://demo.remark42.com/api/v1/avatar/..", ""},
-		{"trailing slash", "https://demo.remark42.com/api/v1/avatar/", ""},
-		{"root", "/", ""},
-		{"dotdot", "..", ""},
-		{"empty", "", ""},
-		{"provider url without image suffix", "https://example.com/pic.png", ""},
-	}
-	for _, tc := range tbl {
-		t.Run(tc.name, func(t *testing.T) {
-			assert.Equal(t, tc.want, avatarIDFromPicture(tc.picture))
-		})
-	}
+	assert.Equal(t, 1, count, "restored to engine")
 }
 
-func TestAdmin_DeleteMeRequestFailed(t *testing.T) {
+func TestAdmin_PageSort(t *testing.T) {
 	ts, srv, teardown := startupT(t)
 	defer teardown()
 
-	c1 := store.Comment{Text: "test test #1", Locator: store.Locator{SiteID: "remark42",
-		URL: "https://radio-t.com/blah"}, User: store.User{Name: "user1 name", ID: "provider1_user1"}}
-	c2 := store.Comment{Text: "test test #2", ParentID: "p1", Locator: store.Locator{SiteID: "remark42",
-		URL: "https://radio-t.com/blah"}, User: store.User{Name: "user2", ID: "provider1_user2"}}
+	send := func(method, url string) (string, int) {
+		req, err := http.NewRequest(method, ts.URL+url, http.NoBody)
+		require.NoError(t, err)
+		req.SetBasicAuth("admin", "password")
+		resp, err := sendReq(t, req, "")
+		require.NoError(t, err)
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return string(b), resp.StatusCode
+	}
 
-	_, err := srv.DataService.Create(c1)
-	assert.NoError(t, err)
-	_, err = srv.DataService.Create(c2)
-	assert.NoError(t, err)
+	req, err := http.NewRequest(http.MethodPut, ts.URL+"/api/v1/admin/page/sort?site=remark42&url=https://radio-t.com/blah&sort=-time", http.NoBody)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
 
-	// try with bad token
-	client := http.Client{}
-	defer client.CloseIdleConnections()
-	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/api/v1/admin/deleteme?token=%s", ts.URL, "bad token"), http.NoBody)
-	assert.NoError(t, err)
-	req.SetBasicAuth("admin", "password")
-	resp, err := client.Do(req)
-	assert.NoError(t, err)
-	assert.NoError(t, resp.Body.Close())
-	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	_, code := send(http.MethodPut, "/api/v1/admin/page/sort?site=remark42&url=https://radio-t.com/blah&sort=-time")
+	assert.Equal(t, http.StatusBadRequest, code, "page settings disabled")
 
-	// try with bad auth
-	claims := token.Claims{
-		SessionOnly: true,
-		RegisteredClaims: jwt.RegisteredClaims{
-			Audience:  jwt.ClaimStrings{"remark42"},
-			ID:        "provider1_1234567",
-			Issuer:    "remark42",
-			NotBefore: jwt.NewNumericDate(time.Now().Add(-1 * time.Minute)),
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(30 * time.Minute)),
-		},
-		User: &token.User{
-			ID: "provider1_user1",
-			Attributes: map[string]any{
-				"delete_me": true,
-			},
-		},
+	srv.DataService.PageStore, err = page.NewBoltStorage(path.Join(t.TempDir(), "pages.db"), bolt.Options{})
+	require.NoError(t, err)
+
+	locator := store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}
+	addComment(t, store.Comment{Text: "first comment", Locator: locator}, ts)
+	addComment(t, store.Comment{Text: "second comment", Locator: locator}, ts)
+
+	findFirst := func() string {
+		body, code := get(t, ts.URL+"/api/v1/find?site=remark42&url=https://radio-t.com/blah&format=plain")
+		require.Equal(t, http.StatusOK, code, body)
+		comments := commentsWithInfo{}
+		require.NoError(t, json.Unmarshal([]byte(body), &comments))
+		require.Len(t, comments.Comments, 2)
+		return comments.Comments[0].Text
 	}
+	assert.Equal(t, "<p>first comment</p>\n", findFirst())
+
+	_, code = send(http.MethodPut, "/api/v1/admin/page/sort?site=remark42&url=https://radio-t.com/blah")
+	assert.Equal(t, http.StatusBadRequest, code, "no sort")
+	_, code = send(http.MethodPut, "/api/v1/admin/page/sort?site=remark42&sort=-time")
+	assert.Equal(t, http.StatusBadRequest, code, "no url")
+	_, code = send(http.MethodPut, "/api/v1/admin/page/sort?site=remark42&url=https://radio-t.com/blah&sort=votes")
+	assert.Equal(t, http.StatusBadRequest, code, "invalid sort")
+
+	body, code := send(http.MethodPut, "/api/v1/admin/page/sort?site=remark42&url=https://radio-t.com/blah&sort=-time")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.Equal(t, "<p>second comment</p>\n", findFirst(), "pinned sort applied")
+	body, code = get(t, ts.URL+"/api/v1/find?site=remark42&url=https://radio-t.com/blah&format=plain&sort=time")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.Less(t, strings.Index(body, "first comment"), strings.Index(body, "second comment"), "explicit sort wins")
+
+	body, code = get(t, ts.URL+"/api/v1/config?site=remark42&url=https://radio-t.com/blah")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.Contains(t, body, `"sort":"-time"`)
+	body, code = get(t, ts.URL+"/api/v1/config?site=remark42")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.NotContains(t, body, `"sort"`)
+
+	body, code = getWithAdminAuth(t, ts.URL+"/api/v1/admin/pages?site=remark42")
+	require.Equal(t, http.StatusOK, code, body)
+	pages := []page.Settings{}
+	require.NoError(t, json.Unmarshal([]byte(body), &pages))
+	require.Len(t, pages, 1)
+	assert.Equal(t, locator, pages[0].Locator)
+	assert.Equal(t, "-time", pages[0].Sort)
+
+	body, code = send(http.MethodDelete, "/api/v1/admin/page/sort?site=remark42&url=https://radio-t.com/blah")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.Equal(t, "<p>first comment</p>\n", findFirst(), "unpinned")
+	body, code = getWithAdminAuth(t, ts.URL+"/api/v1/admin/pages?site=remark42")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.Equal(t, "[]\n", body)
+}
 
-	tkn, err := srv.Authenticator.TokenService().Token(claims)
-	assert.NoError(t, err)
-	req, err = http.NewRequest(http.MethodGet, fmt.Sprintf("%s/api/v1/admin/deleteme?token=%s", ts.URL, tkn), http.NoBody)
-	assert.NoError(t, err)
-	req.SetBasicAuth("admin", "bad-password")
-	resp, err = client.Do(req)
-	assert.NoError(t, err)
-	assert.NoError(t, resp.Body.Close())
-	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+func TestAdmin_Shadow(t *testing.T) {
+	ts, _, teardown := startupT(t)
+	defer teardown()
+	body, code := getWithAdminAuth(t, ts.URL+"/api/v1/admin/shadow?site=remark42")
+	assert.Equal(t, http.StatusNotFound, code, body)
 
-	// unknown user: deletion is idempotent, so a valid (signed) delete_me token for a user with
-	// no stored data is a no-op success rather than an error
-	badClaimsUser := claims
-	badClaimsUser.User.ID = "no-such-id"
-	tkn, err = srv.Authenticator.TokenService().Token(badClaimsUser)
-	assert.NoError(t, err)
-	req, err = http.NewRequest(http.MethodGet, fmt.Sprintf("%s/api/v1/admin/deleteme?token=%s", ts.URL, tkn), http.NoBody)
-	assert.NoError(t, err)
-	req.SetBasicAuth("admin", "password")
-	resp, err = client.Do(req)
-	assert.NoError(t, err)
-	assert.NoError(t, resp.Body.Close())
-	assert.Equal(t, http.StatusOK, resp.StatusCode, resp.Status)
-	badClaimsUser.User.ID = "provider1_user1"
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"count":42}`))
+	}))
+	defer secondary.Close()
+	mirror := &shadow.Mirror{URL: secondary.URL, SampleRate: 1}
+	ts2, _, teardown2 := startupT(t, func(srv *Rest) { srv.Shadow = mirror })
+	defer teardown2()
 
-	// try without deleteme flag
-	badClaimsWithoutDeleteMe := claims
-	badClaimsWithoutDeleteMe.User.SetBoolAttr("delete_me", false)
-	tkn, err = srv.Authenticator.TokenService().Token(badClaimsWithoutDeleteMe)
-	assert.NoError(t, err)
-	req, err = http.NewRequest(http.MethodGet, fmt.Sprintf("%s/api/v1/admin/deleteme?token=%s", ts.URL, tkn), http.NoBody)
-	assert.NoError(t, err)
-	req.SetBasicAuth("admin", "password")
-	resp, err = client.Do(req)
-	assert.NoError(t, err)
-	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
-	b, err := io.ReadAll(resp.Body)
-	assert.NoError(t, err)
-	assert.NoError(t, resp.Body.Close())
-	assert.Contains(t, string(b), "can't use provided token")
-	badClaimsWithoutDeleteMe.User.SetBoolAttr("delete_me", true)
+	c1 := store.Comment{Text: "test test #1", Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah1"}}
+	addComment(t, c1, ts2)
 
-	// try with wrong audience
-	badClaimsMultipleAudience := claims
-	badClaimsMultipleAudience.Audience = jwt.ClaimStrings{"remark42", "something else"}
-	tkn, err = srv.Authenticator.TokenService().Token(badClaimsMultipleAudience)
-	assert.NoError(t, err)
-	req, err = http.NewRequest(http.MethodGet, fmt.Sprintf("%s/api/v1/admin/deleteme?token=%s", ts.URL, tkn), http.NoBody)
-	assert.NoError(t, err)
-	req.SetBasicAuth("admin", "password")
-	resp, err = client.Do(req)
-	assert.NoError(t, err)
-	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
-	b, err = io.ReadAll(resp.Body)
-	assert.NoError(t, err)
-	assert.NoError(t, resp.Body.Close())
-	assert.Contains(t, string(b), "can't process token, claims.Audience expected to be a single element but it's not")
-	badClaimsMultipleAudience.Audience = jwt.ClaimStrings{"remark42"}
+	body, code = get(t, ts2.URL+"/api/v1/count?site=remark42&url=https://radio-t.com/blah1")
+	require.Equal(t, http.StatusOK, code, body)
+	require.Eventually(t, func() bool { return mirror.Report("remark42").Mirrored == 1 }, time.Second, 10*time.Millisecond)
+
+	req, err := http.NewRequest(http.MethodGet, ts2.URL+"/api/v1/admin/shadow?site=remark42", http.NoBody)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+	body, code = getWithAdminAuth(t, ts2.URL+"/api/v1/admin/shadow?site=remark42")
+	require.Equal(t, http.StatusOK, code, body)
+	rep := shadow.Report{}
+	require.NoError(t, json.Unmarshal([]byte(body), &rep))
+	assert.Equal(t, shadow.Stats{Mirrored: 1, Mismatched: 1}, rep.Stats)
+	require.Len(t, rep.Diffs, 1)
+	assert.Equal(t, "$.count", rep.Diffs[0].Detail)
+	assert.Equal(t, "/api/v1/count?site=remark42&url=https://radio-t.com/blah1", rep.Diffs[0].Request)
 }
 
-func TestAdmin_GetUserInfo(t *testing.T) {
+func TestAdmin_BlockedList(t *testing.T) {
 	ts, srv, teardown := startupT(t)
 	defer teardown()
 
 	c1 := store.Comment{Text: "test test #1", Locator: store.Locator{SiteID: "remark42",
 		URL: "https://radio-t.com/blah"}, User: store.User{Name: "user1 name", ID: "user1"}}
 	c2 := store.Comment{Text: "test test #2", ParentID: "p1", Locator: store.Locator{SiteID: "remark42",
-		URL: "https://radio-t.com/blah"}, User: store.User{Name: "user2", ID: "user2"}}
+		URL: "https://radio-t.com/blah"}, User: store.User{Name: "user2 name", ID: "user2"}}
 
+	// write comments for user1 and user2
 	_, err := srv.DataService.Create(c1)
 	assert.NoError(t, err)
 	_, err = srv.DataService.Create(c2)
 	assert.NoError(t, err)
 
-	body, code := getWithAdminAuth(t, fmt.Sprintf("%s/api/v1/admin/user/user1?site=remark42&url=https://radio-t.com/blah",
-		ts.URL))
-	assert.Equal(t, http.StatusOK, code)
-	u := store.User{}
-	err = json.Unmarshal([]byte(body), &u)
+	// block user1
+	req, err := http.NewRequest(http.MethodPut,
+		fmt.Sprintf("%s/api/v1/admin/user/%s?site=remark42&block=%d", ts.URL, "user1", 1), http.NoBody)
 	assert.NoError(t, err)
-	assert.Equal(t, store.User{Name: "user1 name", ID: "user1", Picture: "", IP: "823688dafca7393d24c871a2da98a84d8732e927",
-		Admin: false, Blocked: false, Verified: false}, u)
+	res, err := sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	require.NoError(t, res.Body.Close())
+	assert.Equal(t, http.StatusOK, res.StatusCode)
 
-	_, code = get(t, fmt.Sprintf("%s/api/v1/admin/user/user1?site=remark42&url=https://radio-t.com/blah", ts.URL))
-	assert.Equal(t, http.StatusUnauthorized, code, "no auth")
+	// block user2
+	req, err = http.NewRequest(http.MethodPut,
+		fmt.Sprintf("%s/api/v1/admin/user/%s?site=remark42&block=%d&ttl=150ms", ts.URL, "user2", 1), http.NoBody)
+	assert.NoError(t, err)
+	res, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	require.NoError(t, res.Body.Close())
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	req, err = http.NewRequest("GET", ts.URL+"/api/v1/admin/blocked?site=remark42", http.NoBody)
+	require.NoError(t, err)
+	res, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	users := []store.BlockedUser{}
+	err = json.NewDecoder(res.Body).Decode(&users)
+	assert.NoError(t, err)
+	require.NoError(t, res.Body.Close())
+	require.Equal(t, 2, len(users), "two users blocked")
+	assert.Equal(t, "user1", users[0].ID)
+	assert.Equal(t, "user1 name", users[0].Name)
+	assert.Equal(t, "user2", users[1].ID)
+	assert.Equal(t, "user2 name", users[1].Name)
+	t.Logf("%+v", users)
+	time.Sleep(150 * time.Millisecond)
+
+	req, err = http.NewRequest("GET", ts.URL+"/api/v1/admin/blocked?site=remark42", http.NoBody)
+	require.NoError(t, err)
+	res, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	users = []store.BlockedUser{}
+	err = json.NewDecoder(res.Body).Decode(&users)
+	assert.NoError(t, err)
+	require.NoError(t, res.Body.Close())
+	assert.Equal(t, 1, len(users), "one user left blocked")
+}
+
+func TestAdmin_ReadOnly(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	c1 := store.Comment{Text: "test test #1", Locator: store.Locator{SiteID: "remark42",
+		URL: "https://radio-t.com/blah"}, User: store.User{Name: "user1 name", ID: "user1"}}
+	c2 := store.Comment{Text: "test test #2", ParentID: "p1", Locator: store.Locator{SiteID: "remark42",
+		URL: "https://radio-t.com/blah"}, User: store.User{Name: "user2", ID: "user2"}}
+
+	_, err := srv.DataService.Create(c1)
+	assert.NoError(t, err)
+	_, err = srv.DataService.Create(c2)
+	assert.NoError(t, err)
+
+	info, err := srv.DataService.Info(store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}, 0)
+	assert.NoError(t, err)
+	assert.False(t, info.ReadOnly)
+
+	// set post to read-only
+	req, err := http.NewRequest(http.MethodPut,
+		fmt.Sprintf("%s/api/v1/admin/readonly?site=remark42&url=https://radio-t.com/blah&ro=1", ts.URL), http.NoBody)
+	assert.NoError(t, err)
+	resp, err := sendReq(t, req, "") // non-admin user
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	info, err = srv.DataService.Info(store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}, 0)
+	assert.NoError(t, err)
+	assert.True(t, info.ReadOnly)
+
+	// try to write comment
+	c := store.Comment{Text: "test test #2", ParentID: "p1",
+		Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}}
+	b, err := json.Marshal(c)
+	assert.NoError(t, err, "can't marshal comment %+v", c)
+	req, err = http.NewRequest("POST", ts.URL+"/api/v1/comment?site=remark42", bytes.NewBuffer(b))
+	require.NoError(t, err)
+	resp, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// reset post's read-only
+	req, err = http.NewRequest(http.MethodPut,
+		fmt.Sprintf("%s/api/v1/admin/readonly?site=remark42&url=https://radio-t.com/blah&ro=0", ts.URL), http.NoBody)
+	assert.NoError(t, err)
+	resp, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	info, err = srv.DataService.Info(store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}, 0)
+	assert.NoError(t, err)
+	assert.False(t, info.ReadOnly)
+
+	// try to write comment
+	c = store.Comment{Text: "test test #2", ParentID: "p1",
+		Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}}
+	b, err = json.Marshal(c)
+	assert.NoError(t, err, "can't marshal comment %+v", c)
+	req, err = http.NewRequest("POST", ts.URL+"/api/v1/comment?site="+c.Locator.SiteID, bytes.NewBuffer(b))
+	require.NoError(t, err)
+	resp, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+}
+
+func TestAdmin_ReadOnlyNoComments(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	// set post to read-only
+	req, err := http.NewRequest(http.MethodPut,
+		fmt.Sprintf("%s/api/v1/admin/readonly?site=remark42&url=https://radio-t.com/blah&ro=1", ts.URL), http.NoBody)
+	assert.NoError(t, err)
+	requireAdminOnly(t, req)
+	resp, err := sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	_, err = srv.DataService.Info(store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}, 0)
+	assert.Error(t, err)
+
+	// test format "tree"
+	res, code := get(t, ts.URL+"/api/v1/find?site=remark42&url=https://radio-t.com/blah&format=tree")
+	assert.Equal(t, http.StatusOK, code)
+	comments := commentsWithInfo{}
+	err = json.Unmarshal([]byte(res), &comments)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(comments.Comments), "should have 0 comments")
+	assert.True(t, comments.Info.ReadOnly)
+	t.Logf("%+v", comments)
+
+	// test format "plain"
+	res, code = get(t, ts.URL+"/api/v1/find?site=remark42&url=https://radio-t.com/blah")
+	assert.Equal(t, http.StatusOK, code)
+	comments = commentsWithInfo{}
+	err = json.Unmarshal([]byte(res), &comments)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(comments.Comments), "should have 0 comments")
+	assert.True(t, comments.Info.ReadOnly)
+	t.Logf("%+v", comments)
+}
+
+func TestAdmin_ReadOnlyWithAge(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	c1 := store.Comment{Text: "test test #1", Locator: store.Locator{SiteID: "remark42",
+		URL: "https://radio-t.com/blah"}, User: store.User{Name: "user1 name", ID: "user1"},
+		Timestamp: time.Date(2001, 1, 1, 1, 1, 1, 0, time.Local)}
+	_, err := srv.DataService.Create(c1)
+	assert.NoError(t, err)
+
+	info, err := srv.DataService.Info(store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}, 10)
+	assert.NoError(t, err)
+	assert.True(t, info.ReadOnly, "ro by age")
+
+	// set post to read-only
+	req, err := http.NewRequest(http.MethodPut,
+		fmt.Sprintf("%s/api/v1/admin/readonly?site=remark42&url=https://radio-t.com/blah&ro=1", ts.URL), http.NoBody)
+	assert.NoError(t, err)
+	requireAdminOnly(t, req)
+	resp, err := sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	info, err = srv.DataService.Info(store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}, 0)
+	assert.NoError(t, err)
+	assert.True(t, info.ReadOnly)
+
+	// reset post's read-only
+	req, err = http.NewRequest(http.MethodPut,
+		fmt.Sprintf("%s/api/v1/admin/readonly?site=remark42&url=https://radio-t.com/blah&ro=0", ts.URL), http.NoBody)
+	assert.NoError(t, err)
+	resp, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	info, err = srv.DataService.Info(store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}, 0)
+	assert.NoError(t, err)
+	assert.True(t, info.ReadOnly)
+}
+func TestAdmin_Verify(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	c1 := store.Comment{Text: "test test #1", Locator: store.Locator{SiteID: "remark42",
+		URL: "https://radio-t.com/blah"}, User: store.User{Name: "user1 name", ID: "user1"}}
+	c2 := store.Comment{Text: "test test #2", ParentID: "p1", Locator: store.Locator{SiteID: "remark42",
+		URL: "https://radio-t.com/blah"}, User: store.User{Name: "user2", ID: "user2"}}
+
+	_, err := srv.DataService.Create(c1)
+	assert.NoError(t, err)
+	_, err = srv.DataService.Create(c2)
+	assert.NoError(t, err)
+
+	verified := srv.DataService.IsVerified("remark42", "user1")
+	assert.False(t, verified)
+
+	req, err := http.NewRequest(http.MethodPut,
+		fmt.Sprintf("%s/api/v1/admin/verify/user1?site=remark42&verified=1", ts.URL), http.NoBody)
+	assert.NoError(t, err)
+	requireAdminOnly(t, req)
+	resp, err := sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	verified = srv.DataService.IsVerified("remark42", "user1")
+	assert.True(t, verified)
+
+	res, code := get(t, ts.URL+"/api/v1/find?site=remark42&url=https://radio-t.com/blah&sort=+time")
+	assert.Equal(t, http.StatusOK, code)
+	comments := commentsWithInfo{}
+	err = json.Unmarshal([]byte(res), &comments)
+	assert.NoError(t, err)
+	require.Equal(t, 2, len(comments.Comments), "should have 2 comments")
+	assert.Equal(t, "test test #1", comments.Comments[0].Text)
+	assert.True(t, comments.Comments[0].User.Verified)
+
+	req, err = http.NewRequest(http.MethodPut,
+		fmt.Sprintf("%s/api/v1/admin/verify/user1?site=remark42&verified=0", ts.URL), http.NoBody)
+	assert.NoError(t, err)
+	resp, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	verified = srv.DataService.IsVerified("remark42", "user1")
+	assert.False(t, verified)
+
+	res, code = get(t, ts.URL+"/api/v1/find?site=remark42&url=https://radio-t.com/blah&sort=+time")
+	assert.Equal(t, http.StatusOK, code)
+	comments = commentsWithInfo{}
+	err = json.Unmarshal([]byte(res), &comments)
+	assert.NoError(t, err)
+	require.Equal(t, 2, len(comments.Comments), "should have 2 comments")
+	assert.Equal(t, "test test #1", comments.Comments[0].Text)
+	assert.False(t, comments.Comments[0].User.Verified)
+}
+
+func TestAdmin_ResetUserProfile(t *testing.T) {
+	ts, srv, teardown := startupT(t, func(srv *Rest) {
+		srv.DataService.ProfilePolicy = service.StaticProfilePolicyLister{ProfilePolicy: service.ProfilePolicy{Enabled: true}}
+	})
+	defer teardown()
+
+	c1 := store.Comment{Text: "test test #1", Locator: store.Locator{SiteID: "remark42",
+		URL: "https://radio-t.com/blah"}, User: store.User{Name: "user1 name", ID: "user1"}}
+	_, err := srv.DataService.Create(c1)
+	require.NoError(t, err)
+	_, err = srv.DataService.SetUserProfile("remark42", "user1", service.UserProfile{DisplayName: "bad name", Pronouns: "it"})
+	require.NoError(t, err)
+
+	res, code := get(t, ts.URL+"/api/v1/find?site=remark42&url=https://radio-t.com/blah")
+	require.Equal(t, http.StatusOK, code)
+	comments := commentsWithInfo{}
+	require.NoError(t, json.Unmarshal([]byte(res), &comments))
+	require.Equal(t, 1, len(comments.Comments))
+	assert.Equal(t, "bad name", comments.Comments[0].User.Name)
+
+	req, err := http.NewRequest(http.MethodDelete, ts.URL+"/api/v1/admin/user/user1/profile?site=remark42", http.NoBody)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+	resp, err := sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	profile, err := srv.DataService.GetUserProfile("remark42", "user1")
+	require.NoError(t, err)
+	assert.Equal(t, service.UserProfile{}, profile)
+
+	res, code = get(t, ts.URL+"/api/v1/find?site=remark42&url=https://radio-t.com/blah")
+	require.Equal(t, http.StatusOK, code)
+	comments = commentsWithInfo{}
+	require.NoError(t, json.Unmarshal([]byte(res), &comments))
+	require.Equal(t, 1, len(comments.Comments))
+	assert.Equal(t, "user1 name", comments.Comments[0].User.Name)
+	assert.Empty(t, comments.Comments[0].User.Pronouns)
+}
+
+func TestAdmin_ExportStream(t *testing.T) {
+	ts, _, teardown := startupT(t)
+	defer teardown()
+
+	c1 := store.Comment{Text: "test test #1",
+		Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah1"}}
+	c2 := store.Comment{Text: "test test #2", ParentID: "p1",
+		Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah2"}}
+
+	addComment(t, c1, ts)
+	addComment(t, c2, ts)
+
+	body, code := getWithAdminAuth(t, ts.URL+"/api/v1/admin/export?site=remark42&mode=stream")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 3, strings.Count(body, "\n"))
+	assert.Equal(t, 2, strings.Count(body, "\"text\""))
+	t.Logf("%s", body)
+}
+
+func TestAdmin_ExportFile(t *testing.T) {
+	ts, _, teardown := startupT(t)
+	defer teardown()
+
+	c1 := store.Comment{Text: "test test #1",
+		Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah1"}}
+	c2 := store.Comment{Text: "test test #2", ParentID: "p1",
+		Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah2"}}
+
+	addComment(t, c1, ts)
+	addComment(t, c2, ts)
+
+	req, err := http.NewRequest("GET", ts.URL+"/api/v1/admin/export?site=remark42&mode=file", http.NoBody)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+	resp, err := sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/gzip", resp.Header.Get("Content-Type"))
+
+	ungzReader, err := gzip.NewReader(resp.Body)
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+	ungzBody, err := io.ReadAll(ungzReader)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, strings.Count(string(ungzBody), "\n"))
+	assert.Equal(t, 2, strings.Count(string(ungzBody), "\"text\""))
+	t.Logf("%s", string(ungzBody))
+}
+
+func TestAdmin_DeleteMeRequest(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	c1 := store.Comment{Text: "test test #1", Locator: store.Locator{SiteID: "remark42",
+		URL: "https://radio-t.com/blah"}, User: store.User{Name: "user1 name", ID: "user1"}}
+	c2 := store.Comment{Text: "test test #2", ParentID: "p1", Locator: store.Locator{SiteID: "remark42",
+		URL: "https://radio-t.com/blah"}, User: store.User{Name: "user2", ID: "user2"}}
+
+	_, err := srv.DataService.Create(c1)
+	assert.NoError(t, err)
+	_, err = srv.DataService.Create(c2)
+	assert.NoError(t, err)
+
+	comments, err := srv.DataService.User("remark42", "user1", 0, 0, store.User{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(comments), "a comment for user1")
+
+	email, err := srv.DataService.SetUserEmail("remark42", "user1", "test@example.org")
+	assert.NoError(t, err)
+	assert.Equal(t, "test@example.org", email, "new email for user1")
+
+	email, err = srv.DataService.GetUserEmail("remark42", "user1")
+	assert.NoError(t, err)
+	assert.Equal(t, "test@example.org", email, "new email for user1 is readable")
+
+	claims := token.Claims{
+		SessionOnly: true,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{"remark42"},
+			ID:        "1234567",
+			Issuer:    "remark42",
+			NotBefore: jwt.NewNumericDate(time.Now().Add(-1 * time.Minute)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(30 * time.Minute)),
+		},
+		User: &token.User{
+			ID:      "user1",
+			Picture: "https://demo.remark42.com/api/v1/avatar/pic.image", // production-shaped URL: removal must path.Base it to the avatar id
+			Attributes: map[string]any{
+				"delete_me": true,
+			},
+		},
+	}
+
+	require.NoError(t, os.MkdirAll(os.TempDir()+"/ava-remark42/42", 0o700))
+	require.NoError(t, os.WriteFile(os.TempDir()+"/ava-remark42/42/pic.image", []byte("some image data"), 0o600))
+
+	tkn, err := srv.Authenticator.TokenService().Token(claims)
+	assert.NoError(t, err)
+
+	client := http.Client{}
+	defer client.CloseIdleConnections()
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/api/v1/admin/deleteme?token=%s", ts.URL, tkn), http.NoBody)
+	assert.NoError(t, err)
+
+	req.SetBasicAuth("admin", "password")
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	_, err = srv.DataService.User("remark42", "user1", 0, 0, store.User{})
+	assert.EqualError(t, err, "no comments for user user1 in store")
+
+	email, err = srv.DataService.GetUserEmail("remark42", "user1")
+	assert.NoError(t, err)
+	assert.Empty(t, email, "user1 email was deleted")
+
+	assert.NoFileExists(t, os.TempDir()+"/ava-remark42/42/pic.image", "user's avatar should be removed on deleteme")
+}
+
+// a delete_me request whose token carries a picture must still succeed when the avatar is
+// already gone from the store: the user data is deleted and a missing avatar is tolerated
+func TestAdmin_DeleteMeRequestMissingAvatar(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	c1 := store.Comment{Text: "test test #1", Locator: store.Locator{SiteID: "remark42",
+		URL: "https://radio-t.com/blah"}, User: store.User{Name: "user3 name", ID: "user3"}}
+	_, err := srv.DataService.Create(c1)
+	require.NoError(t, err)
+
+	claims := token.Claims{
+		SessionOnly: true,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{"remark42"},
+			ID:        "2345678",
+			Issuer:    "remark42",
+			NotBefore: jwt.NewNumericDate(time.Now().Add(-1 * time.Minute)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(30 * time.Minute)),
+		},
+		User: &token.User{
+			ID:      "user3",
+			Picture: "missing.image", // no avatar file exists for this picture in the store
+			Attributes: map[string]any{
+				"delete_me": true,
+			},
+		},
+	}
+
+	tkn, err := srv.Authenticator.TokenService().Token(claims)
+	require.NoError(t, err)
+
+	client := http.Client{}
+	defer client.CloseIdleConnections()
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/api/v1/admin/deleteme?token=%s", ts.URL, tkn), http.NoBody)
+	require.NoError(t, err)
+	req.SetBasicAuth("admin", "password")
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "a missing avatar must not fail the deletion")
+
+	_, err = srv.DataService.User("remark42", "user3", 0, 0, store.User{})
+	assert.EqualError(t, err, "no comments for user user3 in store", "user3 comments should be deleted")
+}
+
+// a genuine (non not-found) avatar-store failure must now surface, not be silently swallowed:
+// avatar.ErrNotFound lets deleteMeRequestCtrl tell an already-gone avatar from a real error
+func TestAdmin_DeleteMeRequestAvatarRemoveError(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	c1 := store.Comment{Text: "test test #1", Locator: store.Locator{SiteID: "remark42",
+		URL: "https://radio-t.com/blah"}, User: store.User{Name: "user5 name", ID: "user5"}}
+	_, err := srv.DataService.Create(c1)
+	require.NoError(t, err)
+
+	// put a non-empty directory where the avatar file is expected, so Store.Remove fails with a real
+	// error (directory not empty), not os.ErrNotExist - "pic" hashes to partition 42
+	require.NoError(t, os.MkdirAll(os.TempDir()+"/ava-remark42/42/pic.image", 0o700))
+	require.NoError(t, os.WriteFile(os.TempDir()+"/ava-remark42/42/pic.image/child", []byte("x"), 0o600))
+
+	claims := token.Claims{
+		SessionOnly: true,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{"remark42"},
+			ID:        "4567890",
+			Issuer:    "remark42",
+			NotBefore: jwt.NewNumericDate(time.Now().Add(-1 * time.Minute)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(30 * time.Minute)),
+		},
+		User: &token.User{
+			ID:      "user5",
+			Picture: "https://demo.remark42.com/api/v1/avatar/pic.image",
+			Attributes: map[string]any{
+				"delete_me": true,
+			},
+		},
+	}
+
+	tkn, err := srv.Authenticator.TokenService().Token(claims)
+	require.NoError(t, err)
+
+	client := http.Client{}
+	defer client.CloseIdleConnections()
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/api/v1/admin/deleteme?token=%s", ts.URL, tkn), http.NoBody)
+	require.NoError(t, err)
+	req.SetBasicAuth("admin", "password")
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode, "a real avatar-store failure must surface, not be swallowed")
+}
+
+func TestAvatarIDFromPicture(t *testing.T) {
+	tbl := []struct {
+		name    string
+		picture string
+		want    string
+	}{
+		{"local avatar url", "https://demo.remark42.com/api/v1/avatar/cb42ff493ade696d88a3a590f136ae9e34de7c1b.image", "cb42ff493ade696d88a3a590f136ae9e34de7c1b.image"},
+		{"bare avatar id", "pic.image", "pic.image"},
+		{"parent sentinel", "https://demo.remark42.com/api/v1/avatar/..", ""},
+		{"trailing slash", "https://demo.remark42.com/api/v1/avatar/", ""},
+		{"root", "/", ""},
+		{"dotdot", "..", ""},
+		{"empty", "", ""},
+		{"provider url without image suffix", "https://example.com/pic.png", ""},
+	}
+	for _, tc := range tbl {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, avatarIDFromPicture(tc.picture))
+		})
+	}
+}
+
+func TestAdmin_DeleteMeRequestFailed(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	c1 := store.Comment{Text: "test test #1", Locator: store.Locator{SiteID: "remark42",
+		URL: "https://radio-t.com/blah"}, User: store.User{Name: "user1 name", ID: "provider1_user1"}}
+	c2 := store.Comment{Text: "test test #2", ParentID: "p1", Locator: store.Locator{SiteID: "remark42",
+		URL: "https://radio-t.com/blah"}, User: store.User{Name: "user2", ID: "provider1_user2"}}
+
+	_, err := srv.DataService.Create(c1)
+	assert.NoError(t, err)
+	_, err = srv.DataService.Create(c2)
+	assert.NoError(t, err)
+
+	// try with bad token
+	client := http.Client{}
+	defer client.CloseIdleConnections()
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/api/v1/admin/deleteme?token=%s", ts.URL, "bad token"), http.NoBody)
+	assert.NoError(t, err)
+	req.SetBasicAuth("admin", "password")
+	resp, err := client.Do(req)
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// try with bad auth
+	claims := token.Claims{
+		SessionOnly: true,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{"remark42"},
+			ID:        "provider1_1234567",
+			Issuer:    "remark42",
+			NotBefore: jwt.NewNumericDate(time.Now().Add(-1 * time.Minute)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(30 * time.Minute)),
+		},
+		User: &token.User{
+			ID: "provider1_user1",
+			Attributes: map[string]any{
+				"delete_me": true,
+			},
+		},
+	}
+
+	tkn, err := srv.Authenticator.TokenService().Token(claims)
+	assert.NoError(t, err)
+	req, err = http.NewRequest(http.MethodGet, fmt.Sprintf("%s/api/v1/admin/deleteme?token=%s", ts.URL, tkn), http.NoBody)
+	assert.NoError(t, err)
+	req.SetBasicAuth("admin", "bad-password")
+	resp, err = client.Do(req)
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// unknown user: deletion is idempotent, so a valid (signed) delete_me token for a user with
+	// no stored data is a no-op success rather than an error
+	badClaimsUser := claims
+	badClaimsUser.User.ID = "no-such-id"
+	tkn, err = srv.Authenticator.TokenService().Token(badClaimsUser)
+	assert.NoError(t, err)
+	req, err = http.NewRequest(http.MethodGet, fmt.Sprintf("%s/api/v1/admin/deleteme?token=%s", ts.URL, tkn), http.NoBody)
+	assert.NoError(t, err)
+	req.SetBasicAuth("admin", "password")
+	resp, err = client.Do(req)
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode, resp.Status)
+	badClaimsUser.User.ID = "provider1_user1"
+
+	// try without deleteme flag
+	badClaimsWithoutDeleteMe := claims
+	badClaimsWithoutDeleteMe.User.SetBoolAttr("delete_me", false)
+	tkn, err = srv.Authenticator.TokenService().Token(badClaimsWithoutDeleteMe)
+	assert.NoError(t, err)
+	req, err = http.NewRequest(http.MethodGet, fmt.Sprintf("%s/api/v1/admin/deleteme?token=%s", ts.URL, tkn), http.NoBody)
+	assert.NoError(t, err)
+	req.SetBasicAuth("admin", "password")
+	resp, err = client.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	b, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+	assert.Contains(t, string(b), "can't use provided token")
+	badClaimsWithoutDeleteMe.User.SetBoolAttr("delete_me", true)
+
+	// try with wrong audience
+	badClaimsMultipleAudience := claims
+	badClaimsMultipleAudience.Audience = jwt.ClaimStrings{"remark42", "something else"}
+	tkn, err = srv.Authenticator.TokenService().Token(badClaimsMultipleAudience)
+	assert.NoError(t, err)
+	req, err = http.NewRequest(http.MethodGet, fmt.Sprintf("%s/api/v1/admin/deleteme?token=%s", ts.URL, tkn), http.NoBody)
+	assert.NoError(t, err)
+	req.SetBasicAuth("admin", "password")
+	resp, err = client.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	b, err = io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+	assert.Contains(t, string(b), "can't process token, claims.Audience expected to be a single element but it's not")
+	badClaimsMultipleAudience.Audience = jwt.ClaimStrings{"remark42"}
+}
+
+func TestAdmin_GetUserInfo(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	c1 := store.Comment{Text: "test test #1", Locator: store.Locator{SiteID: "remark42",
+		URL: "https://radio-t.com/blah"}, User: store.User{Name: "user1 name", ID: "user1"}}
+	c2 := store.Comment{Text: "test test #2", ParentID: "p1", Locator: store.Locator{SiteID: "remark42",
+		URL: "https://radio-t.com/blah"}, User: store.User{Name: "user2", ID: "user2"}}
+
+	_, err := srv.DataService.Create(c1)
+	assert.NoError(t, err)
+	_, err = srv.DataService.Create(c2)
+	assert.NoError(t, err)
+
+	body, code := getWithAdminAuth(t, fmt.Sprintf("%s/api/v1/admin/user/user1?site=remark42&url=https://radio-t.com/blah",
+		ts.URL))
+	assert.Equal(t, http.StatusOK, code)
+	u := store.User{}
+	err = json.Unmarshal([]byte(body), &u)
+	assert.NoError(t, err)
+	assert.Equal(t, store.User{Name: "user1 name", ID: "user1", Picture: "", IP: "823688dafca7393d24c871a2da98a84d8732e927",
+		Admin: false, Blocked: false, Verified: false}, u)
+
+	_, code = get(t, fmt.Sprintf("%s/api/v1/admin/user/user1?site=remark42&url=https://radio-t.com/blah", ts.URL))
+	assert.Equal(t, http.StatusUnauthorized, code, "no auth")
+
+	_, code = getWithAdminAuth(t, fmt.Sprintf("%s/api/v1/admin/user/userX?site=remark42&url=https://radio-t.com/blah", ts.URL))
+	assert.Equal(t, http.StatusBadRequest, code, "no info about user")
+}
+
+func TestAdmin_ApproveComment(t *testing.T) {
+	ts, srv, teardown := startupT(t, func(srv *Rest) {
+		srv.DataService.LanguagePolicy = service.StaticLanguagePolicyLister{
+			LanguagePolicy: service.LanguagePolicy{Allowed: []string{"en"}}}
+	})
+	defer teardown()
+
+	id := addComment(t, store.Comment{Text: "Это очень интересный выпуск, спасибо",
+		Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}}, ts)
+
+	body, code := get(t, fmt.Sprintf("%s/api/v1/id/%s?site=remark42&url=https://radio-t.com/blah", ts.URL, id))
+	assert.Equal(t, http.StatusBadRequest, code, "pending comment hidden from anonymous")
+	assert.Contains(t, body, "not found")
+	body, code = getWithDevAuth(t, fmt.Sprintf("%s/api/v1/id/%s?site=remark42&url=https://radio-t.com/blah", ts.URL, id))
+	require.Equal(t, http.StatusOK, code, "pending comment visible to the author")
+	cr := store.Comment{}
+	require.NoError(t, json.Unmarshal([]byte(body), &cr))
+	assert.Equal(t, store.VisibilityPending, cr.Visibility)
+	assert.Equal(t, "ru", cr.Lang)
+
+	mockDestination := &notify.MockDest{}
+	srv.adminRest.notifyService = notify.NewService(srv.DataService, 1, mockDestination)
+	defer srv.adminRest.notifyService.Close()
+
+	body, code = getWithAdminAuth(t, ts.URL+"/api/v1/admin/pending?site=remark42")
+	require.Equal(t, http.StatusOK, code, body)
+	pending := []store.Comment{}
+	require.NoError(t, json.Unmarshal([]byte(body), &pending))
+	require.Len(t, pending, 1)
+	assert.Equal(t, id, pending[0].ID)
+	_, code = get(t, ts.URL+"/api/v1/admin/pending?site=remark42")
+	assert.Equal(t, http.StatusUnauthorized, code, "no auth")
+
+	approve := func() int {
+		client := http.Client{}
+		defer client.CloseIdleConnections()
+		req, err := http.NewRequest(http.MethodPut,
+			fmt.Sprintf("%s/api/v1/admin/approve/%s?site=remark42&url=https://radio-t.com/blah", ts.URL, id), http.NoBody)
+		require.NoError(t, err)
+		requireAdminOnly(t, req)
+		req.SetBasicAuth("admin", "password")
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusOK, approve())
+	body, code = get(t, fmt.Sprintf("%s/api/v1/id/%s?site=remark42&url=https://radio-t.com/blah", ts.URL, id))
+	require.Equal(t, http.StatusOK, code)
+	cr = store.Comment{}
+	require.NoError(t, json.Unmarshal([]byte(body), &cr))
+	assert.Empty(t, cr.Visibility)
+	srv.adminRest.notifyService.Close() // flush notifications
+	require.Len(t, mockDestination.Get(), 1, "held notification sent on approve")
+	assert.Equal(t, id, mockDestination.Get()[0].Comment.ID)
+
+	body, code = getWithAdminAuth(t, ts.URL+"/api/v1/admin/pending?site=remark42")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.Equal(t, "[]\n", body)
+
+	assert.Equal(t, http.StatusBadRequest, approve(), "already approved")
+}
+
+func TestAdmin_EditPolicy(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	body, code := getWithAdminAuth(t, ts.URL+"/api/v1/admin/edit-policy?site=remark42")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.JSONEq(t, `{"duration":300,"verified_duration":0,"admin_duration":0}`, body)
+
+	send := func(method, body string) (string, int) {
+		client := http.Client{}
+		defer client.CloseIdleConnections()
+		req, err := http.NewRequest(method, ts.URL+"/api/v1/admin/edit-policy?site=remark42", strings.NewReader(body))
+		require.NoError(t, err)
+		req.SetBasicAuth("admin", "password")
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return string(b), resp.StatusCode
+	}
+
+	req, err := http.NewRequest(http.MethodPut, ts.URL+"/api/v1/admin/edit-policy?site=remark42", http.NoBody)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+
+	// static policy can't be changed
+	_, code = send(http.MethodPut, `{"duration":600}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	srv.DataService.EditPolicy = service.NewEditPolicies(service.EditPolicy{Duration: 5 * time.Minute})
+	body, code = send(http.MethodPut, `{"duration":600,"verified_duration":86400}`)
+	require.Equal(t, http.StatusOK, code, body)
+	assert.JSONEq(t, `{"duration":600,"verified_duration":86400,"admin_duration":0}`, body)
+
+	body, code = get(t, ts.URL+"/api/v1/config?site=remark42")
+	require.Equal(t, http.StatusOK, code)
+	j := R.JSON{}
+	require.NoError(t, json.Unmarshal([]byte(body), &j))
+	assert.Equal(t, 600.0, j["edit_duration"])
+	assert.Equal(t, map[string]any{"duration": 600.0, "verified_duration": 86400.0, "admin_duration": 0.0}, j["edit_policy"])
+
+	_, code = send(http.MethodPut, `{"duration":-1}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	_, code = send(http.MethodPut, `bad json`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	body, code = send(http.MethodDelete, "")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.JSONEq(t, `{"duration":300,"verified_duration":0,"admin_duration":0}`, body)
+}
+
+func TestAdmin_CollapsePolicy(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	body, code := getWithAdminAuth(t, ts.URL+"/api/v1/admin/collapse-policy?site=remark42")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.JSONEq(t, `{"mode":"","threshold":0}`, body)
+
+	send := func(method, body string) (string, int) {
+		client := http.Client{}
+		defer client.CloseIdleConnections()
+		req, err := http.NewRequest(method, ts.URL+"/api/v1/admin/collapse-policy?site=remark42", strings.NewReader(body))
+		require.NoError(t, err)
+		req.SetBasicAuth("admin", "password")
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return string(b), resp.StatusCode
+	}
+
+	req, err := http.NewRequest(http.MethodPut, ts.URL+"/api/v1/admin/collapse-policy?site=remark42", http.NoBody)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+
+	_, code = send(http.MethodPut, `{"mode":"hide","threshold":-1}`)
+	assert.Equal(t, http.StatusBadRequest, code, "policy is not set")
+
+	srv.DataService.CollapsePolicy = service.NewCollapsePolicies(service.CollapsePolicy{})
+	locator := store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}
+	id1 := addComment(t, store.Comment{Text: "bad comment", Locator: locator}, ts)
+	addComment(t, store.Comment{Text: "reply", ParentID: id1, Locator: locator}, ts)
+	addComment(t, store.Comment{Text: "good comment", Locator: locator}, ts)
+	_, err = srv.DataService.Vote(service.VoteReq{Locator: locator, CommentID: id1, UserID: "voter", Val: false})
+	require.NoError(t, err)
+
+	find := func() (res []store.Comment) {
+		body, code := get(t, ts.URL+"/api/v1/find?site=remark42&url=https://radio-t.com/blah&format=plain&sort=time")
+		require.Equal(t, http.StatusOK, code, body)
+		comments := commentsWithInfo{}
+		require.NoError(t, json.Unmarshal([]byte(body), &comments))
+		return comments.Comments
+	}
+	assert.Len(t, find(), 3)
+
+	body, code = send(http.MethodPut, `{"mode":"collapse","threshold":0}`)
+	require.Equal(t, http.StatusOK, code, body)
+	assert.JSONEq(t, `{"mode":"collapse","threshold":0}`, body)
+	comments := find()
+	require.Len(t, comments, 3)
+	assert.True(t, comments[0].Collapsed)
+	assert.Equal(t, 1, comments[0].HiddenCount)
+
+	body, code = send(http.MethodPut, `{"mode":"hide","threshold":0}`)
+	require.Equal(t, http.StatusOK, code, body)
+	comments = find()
+	require.Len(t, comments, 1)
+	assert.Equal(t, "<p>good comment</p>\n", comments[0].Text)
+
+	body, code = get(t, ts.URL+"/api/v1/config?site=remark42")
+	require.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, `"collapse_policy":{"mode":"hide","threshold":0}`)
+
+	_, code = send(http.MethodPut, `{"mode":"fold"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	_, code = send(http.MethodPut, `bad json`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	body, code = send(http.MethodDelete, "")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.JSONEq(t, `{"mode":"","threshold":0}`, body)
+	assert.Len(t, find(), 3)
+}
+
+func TestAdmin_Events(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/events?site=remark42", http.NoBody)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+
+	_, code := getWithAdminAuth(t, ts.URL+"/api/v1/admin/events?site=remark42")
+	assert.Equal(t, http.StatusBadRequest, code, "journal disabled")
+
+	srv.DataService.EventStore, err = event.NewBoltStorage(t.TempDir()+"/events.db", bolt.Options{})
+	require.NoError(t, err)
+	locator := store.Locator{URL: "https://radio-t.com/blah1", SiteID: "remark42"}
+	id1 := addComment(t, store.Comment{Text: "test 123", Locator: locator}, ts)
+	id2 := addComment(t, store.Comment{Text: "test 456", Locator: locator}, ts)
+	require.NoError(t, srv.DataService.SetPin(locator, id1, true))
+
+	type eventsResp struct {
+		Events []event.Event `json:"events"`
+		Next   uint64        `json:"next"`
+	}
+	body, code := getWithAdminAuth(t, ts.URL+"/api/v1/admin/events?site=remark42&limit=2")
+	require.Equal(t, http.StatusOK, code, body)
+	resp := eventsResp{}
+	require.NoError(t, json.Unmarshal([]byte(body), &resp))
+	require.Len(t, resp.Events, 2)
+	assert.Equal(t, event.CommentCreated, resp.Events[0].Type)
+	assert.Equal(t, id1, resp.Events[0].CommentID)
+	assert.Equal(t, "provider1_dev", resp.Events[0].UserID)
+	assert.Equal(t, id2, resp.Events[1].CommentID)
+	assert.Equal(t, uint64(2), resp.Next)
+
+	body, code = getWithAdminAuth(t, ts.URL+"/api/v1/admin/events?site=remark42&after=2")
+	require.Equal(t, http.StatusOK, code, body)
+	resp = eventsResp{}
+	require.NoError(t, json.Unmarshal([]byte(body), &resp))
+	require.Len(t, resp.Events, 1)
+	assert.Equal(t, event.CommentPinned, resp.Events[0].Type)
+	assert.Equal(t, uint64(3), resp.Next)
+
+	body, code = getWithAdminAuth(t, ts.URL+"/api/v1/admin/events?site=remark42&after=3")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.JSONEq(t, `{"events":[],"next":3}`, body)
+
+	_, code = getWithAdminAuth(t, ts.URL+"/api/v1/admin/events?site=remark42&after=-1")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestAdmin_Controversial(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/controversial?site=remark42", http.NoBody)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+
+	locator := store.Locator{URL: "https://radio-t.com/blah1", SiteID: "remark42"}
+	id1 := addComment(t, store.Comment{Text: "test 123", Locator: locator}, ts)
+	id2 := addComment(t, store.Comment{Text: "test 456", Locator: locator}, ts)
+	addComment(t, store.Comment{Text: "test 789", Locator: locator}, ts)
+
+	body, code := getWithAdminAuth(t, ts.URL+"/api/v1/admin/controversial?site=remark42")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.Equal(t, "[]\n", body, "no votes, nothing controversial")
+
+	vote := func(id, user string, val bool) {
+		_, e := srv.DataService.Vote(service.VoteReq{Locator: locator, CommentID: id, UserID: user, Val: val})
+		require.NoError(t, e)
+	}
+	vote(id1, "user1", true)
+	vote(id1, "user2", false)
+	vote(id2, "user1", true)
+	vote(id2, "user2", false)
+	vote(id2, "user3", false)
+	vote(id2, "user4", true)
+
+	body, code = getWithAdminAuth(t, ts.URL+"/api/v1/admin/controversial?site=remark42&since=1h")
+	require.Equal(t, http.StatusOK, code, body)
+	comments := []store.Comment{}
+	require.NoError(t, json.Unmarshal([]byte(body), &comments))
+	require.Len(t, comments, 2)
+	assert.Equal(t, id2, comments[0].ID)
+	assert.InDelta(t, 4, comments[0].Controversy, 0.01)
+	assert.Equal(t, id1, comments[1].ID)
+	assert.Empty(t, comments[0].Votes, "votes not exposed")
+
+	body, code = getWithAdminAuth(t, ts.URL+"/api/v1/admin/controversial?site=remark42&limit=1")
+	require.Equal(t, http.StatusOK, code, body)
+	comments = []store.Comment{}
+	require.NoError(t, json.Unmarshal([]byte(body), &comments))
+	require.Len(t, comments, 1)
+	assert.Equal(t, id2, comments[0].ID)
+
+	_, code = getWithAdminAuth(t, ts.URL+"/api/v1/admin/controversial?site=remark42&since=bad")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestAdmin_Brigades(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	send := func(method, path string) (string, int) {
+		client := http.Client{}
+		defer client.CloseIdleConnections()
+		req, err := http.NewRequest(method, ts.URL+"/api/v1/admin"+path, http.NoBody)
+		require.NoError(t, err)
+		req.SetBasicAuth("admin", "password")
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return string(b), resp.StatusCode
+	}
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/brigades?site=remark42", http.NoBody)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+	req, err = http.NewRequest(http.MethodPost, ts.URL+"/api/v1/admin/brigades/123/void?site=remark42", http.NoBody)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+
+	_, code := send(http.MethodGet, "/brigades?site=remark42")
+	assert.Equal(t, http.StatusBadRequest, code, "detection disabled")
+
+	srv.DataService.Brigades = &brigade.Detector{Window: time.Minute, MinVotes: 2}
+	locator := store.Locator{URL: "https://radio-t.com/blah1", SiteID: "remark42"}
+	id := addComment(t, store.Comment{Text: "test 123", Locator: locator}, ts)
+	for _, user := range []string{"user1", "user2", "user3"} {
+		_, err = srv.DataService.Vote(service.VoteReq{Locator: locator, CommentID: id, UserID: user, UserIP: "10.0.0.1", Val: true})
+		require.NoError(t, err)
+	}
+	_, err = srv.DataService.Vote(service.VoteReq{Locator: locator, CommentID: id, UserID: "user4", UserIP: "10.1.0.1", Val: true})
+	require.NoError(t, err)
+	require.Len(t, srv.DataService.Brigades.Analyze(time.Now()), 1)
+
+	body, code := send(http.MethodGet, "/brigades?site=remark42")
+	require.Equal(t, http.StatusOK, code, body)
+	alerts := []brigade.Alert{}
+	require.NoError(t, json.Unmarshal([]byte(body), &alerts))
+	require.Len(t, alerts, 1)
+	assert.Equal(t, id, alerts[0].CommentID)
+	assert.Equal(t, brigade.ReasonSubnet, alerts[0].Reason)
+	assert.Len(t, alerts[0].Votes, 3)
+	assert.NotContains(t, body, "10.0.0", "no network exposed")
+
+	_, code = send(http.MethodPost, "/brigades/bad-id/void?site=remark42")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	body, code = send(http.MethodPost, "/brigades/"+alerts[0].ID+"/void?site=remark42")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.JSONEq(t, fmt.Sprintf(`{"id":%q,"score":1,"voided":3}`, id), body)
+
+	body, code = send(http.MethodGet, "/brigades?site=remark42")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.Equal(t, "[]\n", body)
+
+	_, err = srv.DataService.Vote(service.VoteReq{Locator: locator, CommentID: id, UserID: "user5", UserIP: "10.1.0.2", Val: true})
+	require.NoError(t, err)
+	alerts = srv.DataService.Brigades.Analyze(time.Now())
+	require.Len(t, alerts, 1)
+	body, code = send(http.MethodDelete, "/brigades/"+alerts[0].ID+"?site=remark42")
+	require.Equal(t, http.StatusOK, code, body)
+	_, code = send(http.MethodDelete, "/brigades/"+alerts[0].ID+"?site=remark42")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	c, err := srv.DataService.Get(locator, id, store.User{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, c.Score, "dismissed alert keeps votes")
+}
+
+func TestAdmin_ExprPolicy(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
 
-	_, code = getWithAdminAuth(t, fmt.Sprintf("%s/api/v1/admin/user/userX?site=remark42&url=https://radio-t.com/blah", ts.URL))
-	assert.Equal(t, http.StatusBadRequest, code, "no info about user")
+	send := func(method, body string) (string, int) {
+		client := http.Client{}
+		defer client.CloseIdleConnections()
+		req, err := http.NewRequest(method, ts.URL+"/api/v1/admin/expr-policy?site=remark42", strings.NewReader(body))
+		require.NoError(t, err)
+		req.SetBasicAuth("admin", "password")
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return string(b), resp.StatusCode
+	}
+
+	req, err := http.NewRequest(http.MethodPut, ts.URL+"/api/v1/admin/expr-policy?site=remark42", http.NoBody)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+
+	// disabled without expression policies
+	_, code := send(http.MethodPut, `{"moderation":"\"hold\""}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	srv.DataService.ExprPolicy, err = service.NewExprPolicies(service.ExprPolicy{})
+	require.NoError(t, err)
+	body, code := getWithAdminAuth(t, ts.URL+"/api/v1/admin/expr-policy?site=remark42")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.JSONEq(t, `{"moderation":"","notify":""}`, body)
+
+	body, code = send(http.MethodPut, `{"moderation":"comment.text contains \"casino\" ? \"reject\" : \"\""}`)
+	require.Equal(t, http.StatusOK, code, body)
+	assert.JSONEq(t, `{"moderation":"comment.text contains \"casino\" ? \"reject\" : \"\"","notify":""}`, body)
+
+	body, code = send(http.MethodPut, `{"moderation":"comment.unknown"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Contains(t, body, "invalid moderation expression")
+	_, code = send(http.MethodPut, `bad json`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	resp, err := post(t, ts.URL+"/api/v1/comment?site=remark42", `{"text": "best casino", "locator":{"url": "https://radio-t.com/blah1", "site": "remark42"}}`)
+	require.NoError(t, err)
+	res := R.JSON{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "comment rejected by site policy", res["error"])
+	assert.InDelta(t, float64(rest.ErrCommentRejected), res["code"], 0)
+	addComment(t, store.Comment{Text: "test 123", Locator: store.Locator{URL: "https://radio-t.com/blah1", SiteID: "remark42"}}, ts)
+
+	body, code = send(http.MethodDelete, "")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.JSONEq(t, `{"moderation":"","notify":""}`, body)
+}
+
+func TestAdmin_Invites(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	send := func(method, url, body, tkn string) (string, int) {
+		client := http.Client{}
+		defer client.CloseIdleConnections()
+		req, err := http.NewRequest(method, ts.URL+url, strings.NewReader(body))
+		require.NoError(t, err)
+		if tkn == "" {
+			req.SetBasicAuth("admin", "password")
+		} else {
+			req.Header.Set("X-JWT", tkn)
+		}
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return string(b), resp.StatusCode
+	}
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/admin/invite?site=remark42", http.NoBody)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+
+	_, code := send(http.MethodPost, "/api/v1/admin/invite?site=remark42", "", "")
+	assert.Equal(t, http.StatusBadRequest, code, "invitations disabled")
+
+	srv.DataService.InviteStore, err = invite.NewBoltStorage(t.TempDir()+"/invites.db", bolt.Options{})
+	require.NoError(t, err)
+
+	type inviteResp struct {
+		Invitation invite.Invitation `json:"invitation"`
+		Link       string            `json:"link"`
+	}
+	body, code := send(http.MethodPost, "/api/v1/admin/invite?site=remark42", "", "")
+	require.Equal(t, http.StatusOK, code, body)
+	resp := inviteResp{}
+	require.NoError(t, json.Unmarshal([]byte(body), &resp))
+	assert.Equal(t, []string{"remark42"}, resp.Invitation.Sites, "current site by default")
+	assert.Equal(t, invite.RoleAdmin, resp.Invitation.Role)
+	assert.Equal(t, "admin", resp.Invitation.CreatedBy)
+	assert.Equal(t, "https://demo.remark42.com/invite.html?id="+resp.Invitation.ID, resp.Link)
+
+	body, code = send(http.MethodPost, "/api/v1/admin/invite?site=remark42", `{"sites":["remark42","blog"],"ttl":3600}`, "")
+	require.Equal(t, http.StatusOK, code, body)
+	resp2 := inviteResp{}
+	require.NoError(t, json.Unmarshal([]byte(body), &resp2))
+	assert.Equal(t, time.Hour, resp2.Invitation.Expires.Sub(resp2.Invitation.Created))
+
+	_, code = send(http.MethodPost, "/api/v1/admin/invite?site=remark42", `{"role":"owner"}`, "")
+	assert.Equal(t, http.StatusBadRequest, code)
+	_, code = send(http.MethodPost, "/api/v1/admin/invite?site=remark42", `bad json`, "")
+	assert.Equal(t, http.StatusBadRequest, code)
+	_, code = send(http.MethodPost, "/api/v1/admin/invite?site=remark42", `{"sites":["blog"]}`, adminUmputunToken)
+	assert.Equal(t, http.StatusForbidden, code, "token admin can't invite to other sites")
+
+	body, code = send(http.MethodGet, "/api/v1/admin/invites?site=remark42", "", "")
+	require.Equal(t, http.StatusOK, code, body)
+	invs := []invite.Invitation{}
+	require.NoError(t, json.Unmarshal([]byte(body), &invs))
+	require.Len(t, invs, 2)
+
+	_, code = send(http.MethodDelete, "/api/v1/admin/invite/"+resp2.Invitation.ID+"?site=remark42", "", "")
+	assert.Equal(t, http.StatusOK, code)
+	_, code = send(http.MethodDelete, "/api/v1/admin/invite/"+resp2.Invitation.ID+"?site=remark42", "", "")
+	assert.Equal(t, http.StatusBadRequest, code, "already deleted")
+
+	_, err = srv.DataService.AcceptInvite(resp.Invitation.ID, "provider1_dev")
+	require.NoError(t, err)
+	body, code = send(http.MethodGet, "/api/v1/admin/grants?site=remark42", "", "")
+	require.Equal(t, http.StatusOK, code, body)
+	grants := []invite.Grant{}
+	require.NoError(t, json.Unmarshal([]byte(body), &grants))
+	require.Len(t, grants, 1)
+	assert.Equal(t, "provider1_dev", grants[0].UserID)
+
+	body, code = get(t, ts.URL+"/api/v1/config?site=remark42")
+	require.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, `"admins":["a1","a2","provider1_dev"]`, "granted admin in config")
+
+	_, code = send(http.MethodDelete, "/api/v1/admin/grant/provider1_dev?site=remark42", "", "")
+	assert.Equal(t, http.StatusOK, code)
+	_, code = send(http.MethodDelete, "/api/v1/admin/grant/provider1_dev?site=remark42", "", "")
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.False(t, srv.DataService.IsAdmin("remark42", "provider1_dev"))
+}
+
+func TestAdmin_Quota(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	send := func(method, body string) (string, int) {
+		client := http.Client{}
+		defer client.CloseIdleConnections()
+		req, err := http.NewRequest(method, ts.URL+"/api/v1/admin/quota?site=remark42", strings.NewReader(body))
+		require.NoError(t, err)
+		req.SetBasicAuth("admin", "password")
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return string(b), resp.StatusCode
+	}
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/quota?site=remark42", http.NoBody)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+
+	_, code := getWithAdminAuth(t, ts.URL+"/api/v1/admin/quota?site=remark42")
+	assert.Equal(t, http.StatusBadRequest, code, "quotas disabled")
+
+	qs, err := quota.NewBoltStorage(t.TempDir()+"/quota.db", bolt.Options{})
+	require.NoError(t, err)
+	srv.DataService.Quotas = service.NewQuotas(qs, service.QuotaParams{Limits: quota.Limits{Comments: 100}, Mode: service.QuotaBlock})
+
+	body, code := send(http.MethodPut, `{"comments": 1}`)
+	require.Equal(t, http.StatusOK, code, body)
+	info := service.QuotaInfo{}
+	require.NoError(t, json.Unmarshal([]byte(body), &info))
+	assert.True(t, info.Own)
+	assert.Equal(t, quota.Limits{Comments: 1}, info.Limits)
+	_, code = send(http.MethodPut, `{"comments": -1}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	_, code = send(http.MethodPut, `bad json`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	addComment(t, store.Comment{Text: "test 123", Locator: store.Locator{URL: "https://radio-t.com/blah1", SiteID: "remark42"}}, ts)
+	resp, err := post(t, ts.URL+"/api/v1/comment?site=remark42", `{"text": "over quota", "locator":{"url": "https://radio-t.com/blah1", "site": "remark42"}}`)
+	require.NoError(t, err)
+	res := R.JSON{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.InDelta(t, float64(rest.ErrQuotaExceeded), res["code"], 0)
+
+	body, code = getWithAdminAuth(t, ts.URL+"/api/v1/admin/quota?site=remark42")
+	require.Equal(t, http.StatusOK, code, body)
+	info = service.QuotaInfo{}
+	require.NoError(t, json.Unmarshal([]byte(body), &info))
+	assert.Equal(t, "block", info.Mode)
+	assert.Equal(t, int64(1), info.Usage.Comments)
+	assert.Equal(t, time.Now().UTC().Format("2006-01"), info.Usage.Period)
+
+	body, code = send(http.MethodDelete, "")
+	require.Equal(t, http.StatusOK, code, body)
+	info = service.QuotaInfo{}
+	require.NoError(t, json.Unmarshal([]byte(body), &info))
+	assert.False(t, info.Own)
+	assert.Equal(t, quota.Limits{Comments: 100}, info.Limits)
+}
+
+func TestAdmin_CannedResponses(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+	srv.DataService.CannedResponses = service.NewCannedResponses([]service.CannedResponse{{ID: "civil", Text: "please keep it **civil**"}})
+
+	send := func(method, url, body string) (string, int) {
+		client := http.Client{}
+		defer client.CloseIdleConnections()
+		req, err := http.NewRequest(method, ts.URL+url, strings.NewReader(body))
+		require.NoError(t, err)
+		req.SetBasicAuth("admin", "password")
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return string(b), resp.StatusCode
+	}
+
+	for _, method := range []string{http.MethodPut, http.MethodDelete, http.MethodPost} {
+		url := ts.URL + "/api/v1/admin/canned/civil?site=remark42"
+		if method == http.MethodPost {
+			url = ts.URL + "/api/v1/admin/canned/civil/reply?site=remark42"
+		}
+		req, err := http.NewRequest(method, url, http.NoBody)
+		require.NoError(t, err)
+		requireAdminOnly(t, req)
+	}
+
+	body, code := getWithAdminAuth(t, ts.URL+"/api/v1/admin/canned?site=remark42")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.JSONEq(t, `[{"id":"civil","text":"please keep it **civil**"}]`, body)
+
+	body, code = send(http.MethodPut, "/api/v1/admin/canned/offtopic?site=remark42", `{"text":"off-topic"}`)
+	require.Equal(t, http.StatusOK, code, body)
+	assert.JSONEq(t, `{"id":"offtopic","text":"off-topic"}`, body)
+	_, code = send(http.MethodPut, "/api/v1/admin/canned/empty?site=remark42", `{"text":""}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	_, code = send(http.MethodPut, "/api/v1/admin/canned/bad?site=remark42", `bad json`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	body, code = getWithAdminAuth(t, ts.URL+"/api/v1/admin/canned?site=remark42")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.JSONEq(t, `[{"id":"civil","text":"please keep it **civil**"},{"id":"offtopic","text":"off-topic"}]`, body)
+
+	_, code = send(http.MethodDelete, "/api/v1/admin/canned/offtopic?site=remark42", "")
+	assert.Equal(t, http.StatusOK, code)
+	_, code = send(http.MethodDelete, "/api/v1/admin/canned/offtopic?site=remark42", "")
+	assert.Equal(t, http.StatusBadRequest, code, "already deleted")
+
+	// reply with canned response
+	id := addComment(t, store.Comment{Text: "rude comment", Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah1"}}, ts)
+	body, code = send(http.MethodPost, "/api/v1/admin/canned/civil/reply?site=remark42&url=https://radio-t.com/blah1&pid="+id, "")
+	require.Equal(t, http.StatusOK, code, body)
+	c := store.Comment{}
+	require.NoError(t, json.Unmarshal([]byte(body), &c))
+	assert.Equal(t, id, c.ParentID)
+	assert.Equal(t, "<p>please keep it <strong>civil</strong></p>\n", c.Text)
+	assert.Equal(t, "please keep it **civil**", c.Orig)
+	assert.Equal(t, "admin", c.User.ID)
+
+	_, code = send(http.MethodPost, "/api/v1/admin/canned/unknown/reply?site=remark42&url=https://radio-t.com/blah1&pid="+id, "")
+	assert.Equal(t, http.StatusBadRequest, code, "unknown response")
+	_, code = send(http.MethodPost, "/api/v1/admin/canned/civil/reply?site=remark42&url=https://radio-t.com/blah1&pid=bad", "")
+	assert.Equal(t, http.StatusBadRequest, code, "unknown comment")
+}
+
+func TestAdmin_Polls(t *testing.T) {
+	ts, _, teardown := startupT(t, func(srv *Rest) {
+		pollStore, err := poll.NewBoltStorage(path.Join(t.TempDir(), "polls.db"), bolt.Options{})
+		require.NoError(t, err)
+		srv.DataService.PollStore = pollStore
+	})
+	defer teardown()
+	postURL := "https://radio-t.com/blah1"
+
+	send := func(method, url, body, tkn string) (string, int) {
+		req, err := http.NewRequest(method, ts.URL+url, strings.NewReader(body))
+		require.NoError(t, err)
+		if tkn == "" {
+			req.SetBasicAuth("admin", "password")
+		}
+		resp, err := sendReq(t, req, tkn)
+		require.NoError(t, err)
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return string(b), resp.StatusCode
+	}
+
+	for _, method := range []string{http.MethodPut, http.MethodDelete} {
+		req, err := http.NewRequest(method, ts.URL+"/api/v1/admin/poll?site=remark42&url="+postURL, http.NoBody)
+		require.NoError(t, err)
+		requireAdminOnly(t, req)
+	}
+
+	body, code := get(t, ts.URL+"/api/v1/poll?site=remark42&url="+postURL)
+	assert.Equal(t, http.StatusNotFound, code, body)
+
+	_, code = send(http.MethodPut, "/api/v1/admin/poll?site=remark42&url="+postURL, `{"question":"q?","options":["a"]}`, "")
+	assert.Equal(t, http.StatusBadRequest, code, "one option")
+	body, code = send(http.MethodPut, "/api/v1/admin/poll?site=remark42&url="+postURL, `{"question":"q?","options":["a","b"]}`, "")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.JSONEq(t, `{"question":"q?","options":[{"text":"a","votes":0},{"text":"b","votes":0}],"total":0,
+		"closed":false,"voted":-1}`, body)
+
+	body, code = send(http.MethodPut, "/api/v1/poll/vote?site=remark42&url="+postURL+"&option=1", "", devToken)
+	require.Equal(t, http.StatusOK, code, body)
+	_, code = send(http.MethodPut, "/api/v1/poll/vote?site=remark42&url="+postURL+"&option=5", "", devToken)
+	assert.Equal(t, http.StatusBadRequest, code, "bad option")
+	_, code = send(http.MethodPut, "/api/v1/poll/vote?site=remark42&url="+postURL+"&option=x", "", devToken)
+	assert.Equal(t, http.StatusBadRequest, code, "not a number")
+
+	// poll returned with comments
+	addComment(t, store.Comment{Text: "test 123", Locator: store.Locator{SiteID: "remark42", URL: postURL}}, ts)
+	body, code = getWithDevAuth(t, ts.URL+"/api/v1/find?site=remark42&url="+postURL+"&format=tree")
+	require.Equal(t, http.StatusOK, code, body)
+	tree := struct {
+		Poll poll.Results `json:"poll"`
+	}{}
+	require.NoError(t, json.Unmarshal([]byte(body), &tree))
+	assert.Equal(t, 1, tree.Poll.Options[1].Votes)
+	assert.Equal(t, 1, tree.Poll.Voted)
+
+	body, code = get(t, ts.URL+"/api/v1/find?site=remark42&url="+postURL)
+	require.Equal(t, http.StatusOK, code, body)
+	plain := commentsWithInfo{}
+	require.NoError(t, json.Unmarshal([]byte(body), &plain))
+	require.NotNil(t, plain.Poll)
+	assert.Equal(t, 1, plain.Poll.Total)
+	assert.Equal(t, -1, plain.Poll.Voted, "anonymous user")
+
+	body, code = send(http.MethodDelete, "/api/v1/admin/poll?site=remark42&url="+postURL, "", "")
+	require.Equal(t, http.StatusOK, code, body)
+	body, code = get(t, ts.URL+"/api/v1/find?site=remark42&url="+postURL)
+	require.Equal(t, http.StatusOK, code, body)
+	assert.NotContains(t, body, `"poll"`)
+	_, code = send(http.MethodDelete, "/api/v1/admin/poll?site=remark42&url="+postURL, "", "")
+	assert.Equal(t, http.StatusBadRequest, code, "already deleted")
+}
+
+func TestAdmin_Highlights(t *testing.T) {
+	ts, _, teardown := startupT(t, func(srv *Rest) {
+		highlightStore, err := highlight.NewBoltStorage(path.Join(t.TempDir(), "highlights.db"), bolt.Options{})
+		require.NoError(t, err)
+		srv.DataService.HighlightStore = highlightStore
+	})
+	defer teardown()
+	postURL := "https://radio-t.com/blah1"
+
+	put := func(url string) (string, int) {
+		req, err := http.NewRequest(http.MethodPut, ts.URL+url, http.NoBody)
+		require.NoError(t, err)
+		req.SetBasicAuth("admin", "password")
+		resp, err := sendReq(t, req, "")
+		require.NoError(t, err)
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return string(b), resp.StatusCode
+	}
+
+	req, err := http.NewRequest(http.MethodPut, ts.URL+"/api/v1/admin/highlight/123?site=remark42&url="+postURL+"&highlight=1", http.NoBody)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+
+	id1 := addComment(t, store.Comment{Text: "test 123", Locator: store.Locator{SiteID: "remark42", URL: postURL}}, ts)
+	id2 := addComment(t, store.Comment{Text: "test 456", Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah2"}}, ts)
+
+	body, code := get(t, ts.URL+"/api/v1/highlights?site=remark42")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.Equal(t, "[]\n", body)
+
+	body, code = put("/api/v1/admin/highlight/" + id1 + "?site=remark42&url=" + postURL + "&highlight=1&note=best+comment")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.Contains(t, body, `"highlight":true`)
+	time.Sleep(time.Millisecond)
+	body, code = put("/api/v1/admin/highlight/" + id2 + "?site=remark42&url=https://radio-t.com/blah2&highlight=1")
+	require.Equal(t, http.StatusOK, code, body)
+	_, code = put("/api/v1/admin/highlight/bad-id?site=remark42&url=" + postURL + "&highlight=1")
+	assert.Equal(t, http.StatusBadRequest, code, "unknown comment")
+
+	body, code = get(t, ts.URL+"/api/v1/highlights?site=remark42")
+	require.Equal(t, http.StatusOK, code, body)
+	res := []service.HighlightedComment{}
+	require.NoError(t, json.Unmarshal([]byte(body), &res))
+	require.Len(t, res, 2)
+	assert.Equal(t, id2, res[0].Comment.ID)
+	assert.Equal(t, id1, res[1].Comment.ID)
+	assert.Equal(t, "best comment", res[1].Note)
+
+	body, code = get(t, ts.URL+"/api/v1/highlights?site=remark42&url="+postURL)
+	require.Equal(t, http.StatusOK, code, body)
+	res = []service.HighlightedComment{}
+	require.NoError(t, json.Unmarshal([]byte(body), &res))
+	require.Len(t, res, 1)
+	assert.Equal(t, id1, res[0].Comment.ID)
+
+	body, code = get(t, ts.URL+"/api/v1/highlights?site=remark42&limit=1")
+	require.Equal(t, http.StatusOK, code, body)
+	res = []service.HighlightedComment{}
+	require.NoError(t, json.Unmarshal([]byte(body), &res))
+	require.Len(t, res, 1)
+	assert.Equal(t, id2, res[0].Comment.ID)
+
+	body, code = put("/api/v1/admin/highlight/" + id2 + "?site=remark42&url=https://radio-t.com/blah2&highlight=0")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.Contains(t, body, `"highlight":false`)
+	body, code = get(t, ts.URL+"/api/v1/highlights?site=remark42")
+	require.Equal(t, http.StatusOK, code, body)
+	res = []service.HighlightedComment{}
+	require.NoError(t, json.Unmarshal([]byte(body), &res))
+	require.Len(t, res, 1, "highlights cache flushed")
+	assert.Equal(t, id1, res[0].Comment.ID)
+}
+
+func TestAdmin_ClientStats(t *testing.T) {
+	ts, _, teardown := startupT(t, func(srv *Rest) {
+		srv.DataService.ClientStats = service.NewClientStats()
+	})
+	defer teardown()
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/stats?site=remark42", http.NoBody)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+
+	create := func(ua, referrer string) {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/comment?site=remark42", strings.NewReader(
+			`{"text": "test 123", "locator":{"url": "https://radio-t.com/blah1", "site": "remark42"}}`))
+		require.NoError(t, err)
+		req.Header.Set("User-Agent", ua)
+		req.Header.Set("Referer", referrer)
+		resp, err := sendReq(t, req, devToken)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+	}
+	create("Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0",
+		"https://demo.remark42.com/web/iframe.html?site_id=remark42")
+	create("Mozilla/5.0 (Windows NT 10.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+		"https://radio-t.com/blah1")
+
+	body, code := getWithAdminAuth(t, ts.URL+"/api/v1/admin/stats?site=remark42")
+	require.Equal(t, http.StatusOK, code, body)
+	rep := service.ClientStatsReport{}
+	require.NoError(t, json.Unmarshal([]byte(body), &rep))
+	assert.Equal(t, 2, rep.Total)
+	assert.Equal(t, 1, rep.Embed)
+	assert.Equal(t, 1, rep.Direct)
+	assert.Equal(t, map[string]int{"firefox": 1, "chrome": 1}, rep.Browsers)
+	assert.Equal(t, map[string]int{"demo.remark42.com": 1, "radio-t.com": 1}, rep.Referrers)
+	assert.NotContains(t, body, "Mozilla", "no raw user agent")
+}
+
+func TestAdmin_Roles(t *testing.T) {
+	ts, _, teardown := startupT(t)
+	defer teardown()
+
+	send := func(method, url, tkn string) (string, int) {
+		client := http.Client{}
+		defer client.CloseIdleConnections()
+		req, err := http.NewRequest(method, ts.URL+url, http.NoBody)
+		require.NoError(t, err)
+		if tkn == "" {
+			req.SetBasicAuth("admin", "password")
+		} else {
+			req.Header.Set("X-JWT", tkn)
+		}
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return string(b), resp.StatusCode
+	}
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/roles?site=remark42", http.NoBody)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+
+	_, code := send(http.MethodGet, "/api/v1/admin/blocked?site=remark42", devToken)
+	assert.Equal(t, http.StatusForbidden, code, "regular user")
+
+	_, code = send(http.MethodPut, "/api/v1/admin/role/provider1_dev?site=remark42", "")
+	assert.Equal(t, http.StatusBadRequest, code, "no role")
+	_, code = send(http.MethodPut, "/api/v1/admin/role/provider1_dev?site=remark42&role=owner", "")
+	assert.Equal(t, http.StatusBadRequest, code, "unknown role")
+	body, code := send(http.MethodPut, "/api/v1/admin/role/provider1_dev?site=remark42&role=moderator", "")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.JSONEq(t, `{"user_id":"provider1_dev","role":"moderator"}`, body)
+
+	body, code = send(http.MethodGet, "/api/v1/admin/blocked?site=remark42", devToken)
+	assert.Equal(t, http.StatusOK, code, "moderator allowed without new token, %s", body)
+	_, code = send(http.MethodGet, "/api/v1/admin/roles?site=remark42", devToken)
+	assert.Equal(t, http.StatusForbidden, code, "moderator can't manage roles")
+	_, code = send(http.MethodPut, "/api/v1/admin/maintenance?site=remark42", devToken)
+	assert.Equal(t, http.StatusForbidden, code, "moderator can't manage site")
+
+	_, code = send(http.MethodPut, "/api/v1/admin/role/provider1_dev2?site=remark42&role=admin", adminUmputunToken)
+	require.Equal(t, http.StatusOK, code)
+	body, code = send(http.MethodGet, "/api/v1/admin/roles?site=remark42", dev2Token)
+	require.Equal(t, http.StatusOK, code, "admin role applied, %s", body)
+	roles := []service.RoleAssignment{}
+	require.NoError(t, json.Unmarshal([]byte(body), &roles))
+	assert.Equal(t, []service.RoleAssignment{{UserID: "provider1_dev", Role: "moderator"},
+		{UserID: "provider1_dev2", Role: "admin"}}, roles)
+
+	body, code = send(http.MethodDelete, "/api/v1/admin/role/provider1_dev?site=remark42", dev2Token)
+	require.Equal(t, http.StatusOK, code, body)
+	_, code = send(http.MethodGet, "/api/v1/admin/blocked?site=remark42", devToken)
+	assert.Equal(t, http.StatusForbidden, code, "role removed")
+}
+
+func TestAdmin_Schedule(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	send := func(method, url, body, tkn string) (string, int) {
+		client := http.Client{}
+		defer client.CloseIdleConnections()
+		req, err := http.NewRequest(method, ts.URL+url, strings.NewReader(body))
+		require.NoError(t, err)
+		if tkn == "" {
+			req.SetBasicAuth("admin", "password")
+		} else {
+			req.Header.Set("X-JWT", tkn)
+		}
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return string(b), resp.StatusCode
+	}
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/schedule?site=remark42", http.NoBody)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+
+	_, code := send(http.MethodGet, "/api/v1/admin/schedule?site=remark42", "", "")
+	assert.Equal(t, http.StatusBadRequest, code, "scheduled actions disabled")
+
+	srv.DataService.ScheduleStore, err = schedule.NewBoltStorage(t.TempDir()+"/schedule.db", bolt.Options{})
+	require.NoError(t, err)
+	require.NoError(t, srv.DataService.SetRole("remark42", "provider1_dev", service.RoleModerator))
+
+	_, code = send(http.MethodPost, "/api/v1/admin/schedule?site=remark42", `bad json`, "")
+	assert.Equal(t, http.StatusBadRequest, code)
+	_, code = send(http.MethodPost, "/api/v1/admin/schedule?site=remark42", `{"type":"unblock","delay":60}`, "")
+	assert.Equal(t, http.StatusBadRequest, code, "no user id")
+
+	body, code := send(http.MethodPost, "/api/v1/admin/schedule?site=remark42",
+		`{"type":"unblock","user_id":"user1","notify":true,"delay":1209600}`, devToken)
+	require.Equal(t, http.StatusOK, code, "moderator can schedule, %s", body)
+	unblock := schedule.Action{}
+	require.NoError(t, json.Unmarshal([]byte(body), &unblock))
+	assert.Equal(t, "remark42", unblock.SiteID)
+	assert.Equal(t, "provider1_dev", unblock.CreatedBy)
+	assert.True(t, unblock.Notify)
+	assert.InDelta(t, 14*24*time.Hour.Seconds(), time.Until(unblock.Due).Seconds(), 5)
+
+	due := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	body, code = send(http.MethodPost, "/api/v1/admin/schedule?site=remark42",
+		`{"type":"delete_thread","url":"https://radio-t.com/blah1","due":"`+due+`"}`, "")
+	require.Equal(t, http.StatusOK, code, body)
+	thread := schedule.Action{}
+	require.NoError(t, json.Unmarshal([]byte(body), &thread))
+
+	body, code = send(http.MethodGet, "/api/v1/admin/schedule?site=remark42", "", devToken)
+	require.Equal(t, http.StatusOK, code, body)
+	actions := []schedule.Action{}
+	require.NoError(t, json.Unmarshal([]byte(body), &actions))
+	require.Len(t, actions, 2)
+	assert.Equal(t, thread.ID, actions[0].ID, "earliest due first")
+	assert.Equal(t, unblock.ID, actions[1].ID)
+
+	body, code = send(http.MethodDelete, "/api/v1/admin/schedule/"+thread.ID+"?site=remark42", "", devToken)
+	require.Equal(t, http.StatusOK, code, body)
+	_, code = send(http.MethodDelete, "/api/v1/admin/schedule/"+thread.ID+"?site=remark42", "", "")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	body, code = send(http.MethodGet, "/api/v1/admin/schedule?site=remark42", "", "")
+	require.Equal(t, http.StatusOK, code, body)
+	require.NoError(t, json.Unmarshal([]byte(body), &actions))
+	require.Len(t, actions, 1)
+	assert.Equal(t, unblock.ID, actions[0].ID)
+}
+
+func TestAdmin_PageLive(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	send := func(method, url string) (string, int) {
+		req, err := http.NewRequest(method, ts.URL+url, http.NoBody)
+		require.NoError(t, err)
+		req.SetBasicAuth("admin", "password")
+		resp, err := sendReq(t, req, "")
+		require.NoError(t, err)
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return string(b), resp.StatusCode
+	}
+
+	req, err := http.NewRequest(http.MethodPut, ts.URL+"/api/v1/admin/page/live?site=remark42&url=https://radio-t.com/blah", http.NoBody)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+
+	_, code := send(http.MethodPut, "/api/v1/admin/page/live?site=remark42&url=https://radio-t.com/blah")
+	assert.Equal(t, http.StatusBadRequest, code, "page settings disabled")
+
+	srv.DataService.PageStore, err = page.NewBoltStorage(path.Join(t.TempDir(), "pages.db"), bolt.Options{})
+	require.NoError(t, err)
+
+	_, code = send(http.MethodPut, "/api/v1/admin/page/live?site=remark42")
+	assert.Equal(t, http.StatusBadRequest, code, "no url")
+
+	body, code := send(http.MethodPut, "/api/v1/admin/page/live?site=remark42&url=https://radio-t.com/blah")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.Contains(t, body, `"live":true`)
+	body, code = get(t, ts.URL+"/api/v1/config?site=remark42&url=https://radio-t.com/blah")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.Contains(t, body, `"live":true`)
+	body, code = get(t, ts.URL+"/api/v1/live?site=remark42&url=https://radio-t.com/blah")
+	assert.Equal(t, http.StatusOK, code, body)
+
+	body, code = send(http.MethodDelete, "/api/v1/admin/page/live?site=remark42&url=https://radio-t.com/blah")
+	require.Equal(t, http.StatusOK, code, body)
+	body, code = get(t, ts.URL+"/api/v1/config?site=remark42&url=https://radio-t.com/blah")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.NotContains(t, body, `"live"`)
+	_, code = get(t, ts.URL+"/api/v1/live?site=remark42&url=https://radio-t.com/blah")
+	assert.Equal(t, http.StatusNotFound, code, "live mode is off")
+}
+
+func TestAdmin_PageRegistered(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	send := func(method, url string) (string, int) {
+		req, err := http.NewRequest(method, ts.URL+url, http.NoBody)
+		require.NoError(t, err)
+		req.SetBasicAuth("admin", "password")
+		resp, err := sendReq(t, req, "")
+		require.NoError(t, err)
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return string(b), resp.StatusCode
+	}
+	postComment := func(url string) (string, int) {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/comment?site=remark42",
+			strings.NewReader(`{"text": "test 123", "locator":{"url": "`+url+`", "site": "remark42"}}`))
+		require.NoError(t, err)
+		resp, err := sendReq(t, req, devToken)
+		require.NoError(t, err)
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return string(b), resp.StatusCode
+	}
+
+	req, err := http.NewRequest(http.MethodPut, ts.URL+"/api/v1/admin/page/registered?site=remark42&url=https://radio-t.com/blah", http.NoBody)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+
+	_, code := send(http.MethodPut, "/api/v1/admin/page/registered?site=remark42&url=https://radio-t.com/blah")
+	assert.Equal(t, http.StatusBadRequest, code, "page settings disabled")
+
+	srv.DataService.PageStore, err = page.NewBoltStorage(path.Join(t.TempDir(), "pages.db"), bolt.Options{})
+	require.NoError(t, err)
+	srv.DataService.StrictPages = true
+
+	_, code = send(http.MethodPut, "/api/v1/admin/page/registered?site=remark42")
+	assert.Equal(t, http.StatusBadRequest, code, "no url")
+
+	body, code := postComment("https://radio-t.com/blah")
+	assert.Equal(t, http.StatusForbidden, code, body)
+	assert.Contains(t, body, `"code":5`)
+
+	body, code = send(http.MethodPut, "/api/v1/admin/page/registered?site=remark42&url=https://radio-t.com/blah")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.Contains(t, body, `"registered":true`)
+	body, code = send(http.MethodGet, "/api/v1/admin/pages?site=remark42")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.Contains(t, body, `"registered":true`)
+	body, code = postComment("https://radio-t.com/blah")
+	assert.Equal(t, http.StatusCreated, code, body)
+
+	body, code = send(http.MethodDelete, "/api/v1/admin/page/registered?site=remark42&url=https://radio-t.com/blah")
+	require.Equal(t, http.StatusOK, code, body)
+	body, code = postComment("https://radio-t.com/blah")
+	assert.Equal(t, http.StatusForbidden, code, body)
+}
+
+func TestAdmin_EmailSuppressions(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/email/suppressions?site=remark42", http.NoBody)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+
+	body, code := getWithAdminAuth(t, ts.URL+"/api/v1/admin/email/suppressions?site=remark42")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "[]\n", body, "suppression disabled")
+
+	srv.DataService.SuppressStore, err = suppress.NewBoltStorage(t.TempDir()+"/suppress.db", bolt.Options{})
+	require.NoError(t, err)
+	_, err = srv.DataService.SetUserEmail("remark42", "provider1_dev", "bounce@example.com")
+	require.NoError(t, err)
+	srv.EmailEvents = EmailEvents{Provider: notify.EmailProviderPostmark, Secret: "12345", Sites: []string{"remark42"}}
+
+	resp, err := http.Post(ts.URL+"/api/v1/email/events/postmark?secret=12345", "application/json",
+		strings.NewReader(`{"RecordType":"SpamComplaint","Email":"bounce@example.com"}`))
+	require.NoError(t, err)
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.JSONEq(t, `{"events":1,"suppressed":1,"unsubscribed":0}`, string(b))
+	assert.True(t, srv.DataService.EmailSuppressed("bounce@example.com"))
+	email, err := srv.DataService.GetUserEmail("remark42", "provider1_dev")
+	require.NoError(t, err)
+	assert.Equal(t, "bounce@example.com", email, "subscription kept for reinstating")
+
+	body, code = getWithAdminAuth(t, ts.URL+"/api/v1/admin/email/suppressions?site=remark42")
+	assert.Equal(t, http.StatusOK, code)
+	res := []suppress.Suppression{}
+	require.NoError(t, json.Unmarshal([]byte(body), &res))
+	require.Len(t, res, 1)
+	assert.Equal(t, "bounce@example.com", res[0].Address)
+	assert.Equal(t, notify.EmailComplaint, res[0].Kind)
+	assert.Equal(t, notify.EmailProviderPostmark, res[0].Source)
+
+	reinstate := func(address string) int {
+		req, e := http.NewRequest(http.MethodDelete, ts.URL+"/api/v1/admin/email/suppression?site=remark42&address="+address, http.NoBody)
+		require.NoError(t, e)
+		req.SetBasicAuth("admin", "password")
+		resp, e := http.DefaultClient.Do(req)
+		require.NoError(t, e)
+		require.NoError(t, resp.Body.Close())
+		return resp.StatusCode
+	}
+	assert.Equal(t, http.StatusOK, reinstate("Bounce@example.com"))
+	assert.False(t, srv.DataService.EmailSuppressed("bounce@example.com"))
+	assert.Equal(t, http.StatusNotFound, reinstate("bounce@example.com"))
+}
+
+func TestAdmin_TOTP(t *testing.T) {
+	ts, srv, teardown := startupT(t, func(srv *Rest) { srv.AdminTOTP = AdminTOTP{Enabled: true, Issuer: "Remark42 test"} })
+	defer teardown()
+
+	send := func(method, url, body string, hdrs map[string]string) (string, int, *http.Response) {
+		req, err := http.NewRequest(method, ts.URL+url, strings.NewReader(body))
+		require.NoError(t, err)
+		for k, v := range hdrs {
+			req.Header.Set(k, v)
+		}
+		resp, err := sendReq(t, req, adminUmputunToken)
+		require.NoError(t, err)
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return string(b), resp.StatusCode, resp
+	}
+
+	body, code, _ := send(http.MethodGet, "/api/v1/admin/users?site=remark42", "", nil)
+	assert.Equal(t, http.StatusForbidden, code, "not enrolled admin rejected")
+	assert.Contains(t, body, "totp enrollment required")
+	assert.Contains(t, body, `"code":34`)
+
+	_, code = getWithAdminAuth(t, ts.URL+"/api/v1/admin/users?site=remark42")
+	assert.Equal(t, http.StatusOK, code, "basic auth admin not affected")
+
+	body, code, _ = send(http.MethodPost, "/api/v1/admin/totp/enroll?site=remark42", "", nil)
+	require.Equal(t, http.StatusOK, code, body)
+	enroll := struct {
+		Secret string `json:"secret"`
+		URI    string `json:"uri"`
+		QR     string `json:"qr"`
+	}{}
+	require.NoError(t, json.Unmarshal([]byte(body), &enroll))
+	assert.Len(t, enroll.Secret, 32)
+	assert.Equal(t, "otpauth://totp/Remark42%20test:Umputun?algorithm=SHA1&digits=6&issuer=Remark42+test&period=30&secret="+enroll.Secret, enroll.URI)
+	assert.True(t, strings.HasPrefix(enroll.QR, "data:image/png;base64,"))
+
+	body, code, _ = send(http.MethodGet, "/api/v1/admin/users?site=remark42", "", nil)
+	assert.Equal(t, http.StatusForbidden, code, "enrollment not confirmed")
+	assert.Contains(t, body, "totp enrollment required")
+
+	_, code, _ = send(http.MethodPost, "/api/v1/admin/totp/verify?site=remark42", `{"code":"000000"}`, nil)
+	assert.Equal(t, http.StatusForbidden, code, "wrong code")
+	_, code, _ = send(http.MethodPost, "/api/v1/admin/totp/verify?site=remark42", `bad`, nil)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code6, err := service.TOTPCode(enroll.Secret, time.Now())
+	require.NoError(t, err)
+	body, code, resp := send(http.MethodPost, "/api/v1/admin/totp/verify?site=remark42", `{"code":"`+code6+`"}`, nil)
+	require.Equal(t, http.StatusOK, code, body)
+	verified := struct {
+		Token   string    `json:"token"`
+		Expires time.Time `json:"expires"`
+	}{}
+	require.NoError(t, json.Unmarshal([]byte(body), &verified))
+	assert.WithinDuration(t, time.Now().Add(12*time.Hour), verified.Expires, time.Minute, "default ttl")
+	require.Len(t, resp.Cookies(), 1)
+	assert.Equal(t, "TOTP-TOKEN", resp.Cookies()[0].Name)
+	assert.Equal(t, verified.Token, resp.Cookies()[0].Value)
+	assert.True(t, resp.Cookies()[0].HttpOnly)
+
+	_, code, _ = send(http.MethodPost, "/api/v1/admin/totp/verify?site=remark42", `{"code":"`+code6+`"}`, nil)
+	assert.Equal(t, http.StatusForbidden, code, "code can't be reused")
+
+	_, code, _ = send(http.MethodGet, "/api/v1/admin/users?site=remark42", "", nil)
+	assert.Equal(t, http.StatusForbidden, code, "no step-up token")
+	body, code, _ = send(http.MethodGet, "/api/v1/admin/users?site=remark42", "", map[string]string{"X-Remark42-TOTP": verified.Token})
+	assert.Equal(t, http.StatusOK, code, body)
+	_, code, _ = send(http.MethodGet, "/api/v1/admin/users?site=remark42", "", map[string]string{"Cookie": "TOTP-TOKEN=" + verified.Token})
+	assert.Equal(t, http.StatusOK, code, "token from cookie")
+	_, code, _ = send(http.MethodGet, "/api/v1/admin/users?site=remark42", "", map[string]string{"X-Remark42-TOTP": verified.Token + "x"})
+	assert.Equal(t, http.StatusForbidden, code, "bad token")
+
+	expired := srv.adminRest.makeTOTPToken("remark42", "github_ef0f706a7", service.TOTP{Secret: enroll.Secret}, time.Now().Add(-time.Minute))
+	_, code, _ = send(http.MethodGet, "/api/v1/admin/users?site=remark42", "", map[string]string{"X-Remark42-TOTP": expired})
+	assert.Equal(t, http.StatusForbidden, code, "expired token")
+
+	_, code, _ = send(http.MethodPost, "/api/v1/admin/totp/enroll?site=remark42", "", nil)
+	assert.Equal(t, http.StatusForbidden, code, "confirmed totp replaced with step-up only")
+
+	body, code, _ = send(http.MethodDelete, "/api/v1/admin/totp/github_ef0f706a7?site=remark42", "", map[string]string{"X-Remark42-TOTP": verified.Token})
+	require.Equal(t, http.StatusOK, code, body)
+	_, code, _ = send(http.MethodGet, "/api/v1/admin/users?site=remark42", "", map[string]string{"X-Remark42-TOTP": verified.Token})
+	assert.Equal(t, http.StatusForbidden, code, "token invalid after totp removed")
 }
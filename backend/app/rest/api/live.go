@@ -0,0 +1,68 @@
+package api
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/umputun/remark42/backend/app/store"
+)
+
+const (
+	// maxLiveSubscribers limits streams of the instance, each stream holds a slot of the global throttle
+	maxLiveSubscribers = 500
+	liveBuffer         = 16 // events buffered per subscriber, slow subscribers miss the rest
+)
+
+var errLiveFull = errors.New("too many live subscribers")
+
+// liveHub fans out new comments of live posts to subscribed streams of the instance
+type liveHub struct {
+	mu    sync.Mutex
+	subs  map[store.Locator]map[chan []byte]struct{}
+	count int
+}
+
+func newLiveHub() *liveHub {
+	return &liveHub{subs: map[store.Locator]map[chan []byte]struct{}{}}
+}
+
+// subscribe returns channel with events of the post and func to cancel subscription
+func (h *liveHub) subscribe(locator store.Locator) (events <-chan []byte, cancel func(), err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.count >= maxLiveSubscribers {
+		return nil, nil, errLiveFull
+	}
+	ch := make(chan []byte, liveBuffer)
+	if h.subs[locator] == nil {
+		h.subs[locator] = map[chan []byte]struct{}{}
+	}
+	h.subs[locator][ch] = struct{}{}
+	h.count++
+
+	var once sync.Once
+	cancel = func() {
+		once.Do(func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			delete(h.subs[locator], ch)
+			if len(h.subs[locator]) == 0 {
+				delete(h.subs, locator)
+			}
+			h.count--
+		})
+	}
+	return ch, cancel, nil
+}
+
+// publish sends event to all subscribers of the post without blocking
+func (h *liveHub) publish(locator store.Locator, data []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs[locator] {
+		select {
+		case ch <- data:
+		default: // subscriber is too slow, it will catch up with the feed
+		}
+	}
+}
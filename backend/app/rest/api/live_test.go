@@ -0,0 +1,55 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store"
+)
+
+func TestLiveHub(t *testing.T) {
+	h := newLiveHub()
+	post1 := store.Locator{SiteID: "remark42", URL: "https://radio-t.com/1"}
+	post2 := store.Locator{SiteID: "remark42", URL: "https://radio-t.com/2"}
+
+	ev1, cancel1, err := h.subscribe(post1)
+	require.NoError(t, err)
+	ev2, cancel2, err := h.subscribe(post2)
+	require.NoError(t, err)
+
+	h.publish(post1, []byte("c1"))
+	assert.Equal(t, []byte("c1"), <-ev1)
+	assert.Empty(t, ev2, "other post not notified")
+
+	for range liveBuffer + 5 {
+		h.publish(post2, []byte("c2"))
+	}
+	assert.Len(t, ev2, liveBuffer, "slow subscriber doesn't block publisher")
+
+	cancel1()
+	cancel1()
+	cancel2()
+	assert.Empty(t, h.subs)
+	assert.Equal(t, 0, h.count)
+	h.publish(post1, []byte("c3"))
+	assert.Empty(t, ev1, "cancelled subscriber not notified")
+}
+
+func TestLiveHub_Limit(t *testing.T) {
+	h := newLiveHub()
+	post := store.Locator{SiteID: "remark42", URL: "https://radio-t.com/1"}
+	cancels := []func(){}
+	for range maxLiveSubscribers {
+		_, cancel, err := h.subscribe(post)
+		require.NoError(t, err)
+		cancels = append(cancels, cancel)
+	}
+	_, _, err := h.subscribe(post)
+	require.ErrorIs(t, err, errLiveFull)
+
+	cancels[0]()
+	_, _, err = h.subscribe(post)
+	require.NoError(t, err, "slot released")
+}
@@ -2,6 +2,8 @@
 package api
 
 import (
+	"cmp"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
@@ -12,50 +14,98 @@ import (
 
 	"github.com/didip/tollbooth/v8"
 	"github.com/didip/tollbooth/v8/limiter"
+	"github.com/go-pkgz/auth/v2/token"
 	log "github.com/go-pkgz/lgr"
 	R "github.com/go-pkgz/rest"
 	"github.com/umputun/remark42/backend/app/rest"
 	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/bot"
+	"github.com/umputun/remark42/backend/app/store/service"
 )
 
 // ipForwardingHeaders are the request headers R.RealIP derives the client IP from.
 var ipForwardingHeaders = []string{"X-Real-IP", "X-Forwarded-For", "CF-Connecting-IP"}
 
 // realIPMiddleware derives the client IP from forwarding headers (X-Real-IP / X-Forwarded-For /
-// CF-Connecting-IP) via R.RealIP, but honors those headers only for requests whose direct peer
-// is one of the trusted proxies. For any other peer it drops those headers and pins RemoteAddr to
-// the real socket IP, so an untrusted client can't spoof the IP that per-IP controls (rate limiting,
-// vote dedup, comment IP, anonymous id) and the request log key on.
+// CF-Connecting-IP), but honors those headers only for requests whose direct peer is one of the
+// trusted proxies. For any other peer it drops those headers and pins RemoteAddr to the real socket
+// IP, so an untrusted client can't spoof the IP that per-IP controls (rate limiting, vote dedup,
+// comment IP, anonymous id) and the request log key on.
+//
+// For a trusted peer the client IP is taken from the given header only, or with empty header from
+// X-Real-IP, CF-Connecting-IP and X-Forwarded-For in that order. X-Forwarded-For is walked from
+// the right, skipping hops inside the trusted proxies, so a client-supplied value prepended to the
+// chain is never used. The resolved IP is written to RemoteAddr and the forwarding headers are
+// dropped, so everything downstream, including the request logger, sees the same IP.
 //
 // With no trusted proxies configured it falls back to trusting the headers from any client (the
 // historical behavior). That is spoofable by design, so operators running behind a reverse proxy
 // should set --trusted-proxy to the proxy's network — see the "trusted proxy" docs.
-func realIPMiddleware(trustedProxies []*net.IPNet) func(http.Handler) http.Handler {
+func realIPMiddleware(trustedProxies []*net.IPNet, header string) func(http.Handler) http.Handler {
 	if len(trustedProxies) == 0 {
 		return R.RealIP
 	}
 	return func(next http.Handler) http.Handler {
-		fromTrusted := R.RealIP(next) // rewrites RemoteAddr from the forwarding headers
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			peer := directPeerIP(r.RemoteAddr)
+			ip := peer
 			if peer != nil && cidrsContain(trustedProxies, peer) {
-				fromTrusted.ServeHTTP(w, r) // trusted proxy: honor the forwarding headers
-				return
+				if client := forwardedClientIP(r.Header, trustedProxies, header); client != nil {
+					ip = client
+				}
 			}
-			// untrusted peer: drop the forwarding headers and pin RemoteAddr to the real socket IP,
-			// so nothing downstream can be fooled by a spoofed header (R.RealIP normalizes
-			// RemoteAddr to a bare IP for trusted peers; do the same here for consistency)
+			// drop the forwarding headers and pin RemoteAddr to the resolved IP, so nothing
+			// downstream can be fooled by a spoofed header or re-derive a different IP from them
 			for _, h := range ipForwardingHeaders {
 				r.Header.Del(h)
 			}
-			if peer != nil {
-				r.RemoteAddr = peer.String()
+			if ip != nil {
+				r.RemoteAddr = ip.String()
 			}
 			next.ServeHTTP(w, r)
 		})
 	}
 }
 
+// forwardedClientIP returns the client IP reported by a trusted proxy in the given header, or in
+// the first of the forwarding headers set if header is empty. Returns nil if there is no usable value.
+func forwardedClientIP(h http.Header, trustedProxies []*net.IPNet, header string) net.IP {
+	headers := []string{"X-Real-IP", "CF-Connecting-IP", "X-Forwarded-For"}
+	if header != "" {
+		headers = []string{header}
+	}
+	for _, name := range headers {
+		if http.CanonicalHeaderKey(name) == "X-Forwarded-For" {
+			if values := h.Values(name); len(values) > 0 {
+				return forwardedForClientIP(strings.Join(values, ","), trustedProxies)
+			}
+			continue
+		}
+		if v := strings.TrimSpace(h.Get(name)); v != "" {
+			return net.ParseIP(v)
+		}
+	}
+	return nil
+}
+
+// forwardedForClientIP walks X-Forwarded-For chain from the right, as each proxy appends the address
+// it got the request from, and returns the first hop which is not a trusted proxy. If all hops are
+// trusted the leftmost one is the client. A malformed hop breaks the chain, so nil is returned and
+// the direct peer is used instead.
+func forwardedForClientIP(xff string, trustedProxies []*net.IPNet) net.IP {
+	hops := strings.Split(xff, ",")
+	var ip net.IP
+	for i := len(hops) - 1; i >= 0; i-- {
+		if ip = net.ParseIP(strings.TrimSpace(hops[i])); ip == nil {
+			return nil
+		}
+		if !cidrsContain(trustedProxies, ip) {
+			return ip
+		}
+	}
+	return ip
+}
+
 // directPeerIP extracts the IP from a "host:port" (or bare host) RemoteAddr, or nil if unparseable.
 func directPeerIP(remoteAddr string) net.IP {
 	host, _, err := net.SplitHostPort(remoteAddr)
@@ -119,19 +169,32 @@ func ParseTrustedProxies(entries []string) ([]*net.IPNet, error) {
 	return out, nil
 }
 
-// corsMiddleware builds the CORS middleware for the public API. With AllowedOrigins
-// "*" and credentials enabled, rest.CORS reflects the request Origin into
-// Access-Control-Allow-Origin (rather than a literal "*"), which browsers require
-// for credentialed cross-origin requests.
-func corsMiddleware() func(http.Handler) http.Handler {
-	return R.CORS(
-		R.CorsAllowedOrigins("*"),
-		R.CorsAllowedMethods("GET", "POST", "PUT", "DELETE", "OPTIONS"),
-		R.CorsAllowedHeaders("Accept", "Authorization", "Content-Type", "X-XSRF-Token", "X-JWT"),
-		R.CorsExposedHeaders("Authorization"),
-		R.CorsAllowCredentials(true),
-		R.CorsMaxAge(300),
-	)
+// corsMiddleware builds the CORS middleware for the public API with the policy of the site set by "site"
+// query param, the default policy for requests without it. With origins "*" and credentials enabled,
+// rest.CORS reflects the request Origin into Access-Control-Allow-Origin (rather than a literal "*"),
+// which browsers require for credentialed cross-origin requests.
+func corsMiddleware(policies *rest.CORSPolicies) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Origin") == "" { // same-origin or non-browser request
+				next.ServeHTTP(w, r)
+				return
+			}
+			policy := policies.Policy(r.URL.Query().Get("site"))
+			if len(policy.Origins) == 0 { // no cross-origin requests allowed
+				next.ServeHTTP(w, r)
+				return
+			}
+			R.CORS(
+				R.CorsAllowedOrigins(policy.Origins...),
+				R.CorsAllowedMethods("GET", "POST", "PUT", "DELETE", "OPTIONS"),
+				R.CorsAllowedHeaders("Accept", "Authorization", "Content-Type", "X-XSRF-Token", "X-JWT"),
+				R.CorsExposedHeaders("Authorization"),
+				R.CorsAllowCredentials(policy.Credentials),
+				R.CorsMaxAge(policy.MaxAge),
+			)(next).ServeHTTP(w, r)
+		})
+	}
 }
 
 // rejectHead rejects HEAD requests with 405, advertising the given allowed methods in
@@ -171,6 +234,112 @@ func rejectAnonUser(next http.Handler) http.Handler {
 	return http.HandlerFunc(fn)
 }
 
+// applyRoles is a middleware updating admin status of the user with the role on the site, so assigned and
+// removed roles take effect without waiting for the token refresh. Lookups are cached by userRole.
+// Token without a role and user without one left intact, as the admin status may be set by the token issuer.
+func applyRoles(userRole func(siteID, userID string) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			user, err := token.GetUserInfo(r)
+			if err != nil || (user.Name == "admin" && user.ID == "admin") { // not authenticated or basic auth user
+				next.ServeHTTP(w, r)
+				return
+			}
+			if role := userRole(user.Audience, user.ID); role != user.GetRole() {
+				user.SetRole(role)
+				user.SetAdmin(role != "")
+				r = token.SetUserInfo(r, user)
+			}
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// botKeyHeader carries api key of the bot account
+const botKeyHeader = "X-Bot-Key"
+
+// botAuth is a middleware authenticating bots by api key in X-Bot-Key header, for the site of the request.
+// Requests without the key passed to userAuth. Bots marked in user info and never get admin status.
+func botAuth(botFn func(siteID, key string) (bot.Bot, error), userAuth func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		withUser := userAuth(next)
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(botKeyHeader)
+			if key == "" {
+				withUser.ServeHTTP(w, r)
+				return
+			}
+			b, err := botFn(r.URL.Query().Get("site"), key)
+			if err != nil {
+				rest.SendErrorJSON(w, r, http.StatusUnauthorized, err, "bot auth failed", rest.ErrNoAccess)
+				return
+			}
+			user := store.User{ID: b.ID, Name: b.Name, Picture: b.Picture, SiteID: b.SiteID, Bot: true}
+			next.ServeHTTP(w, rest.SetUserInfo(r, user))
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// rejectBot is a middleware rejecting bots from actions left to people, like voting
+func rejectBot(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if user, err := rest.GetUserInfo(r); err == nil && user.Bot {
+			http.Error(w, "Access denied", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
+// adminOnly is a middleware allowing users with admin status only, moderators included
+func adminOnly(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		user, err := rest.GetUserInfo(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !user.Admin {
+			http.Error(w, "Access denied", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
+// basicAdminOnly is a middleware allowing basic auth admin only, for server-wide routes not bound to a site
+func basicAdminOnly(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		user, err := rest.GetUserInfo(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if user.Name != "admin" || user.ID != "admin" {
+			http.Error(w, "Access denied", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
+// rejectModerator is a middleware rejecting moderators from site management left to admins
+func rejectModerator(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if user, err := token.GetUserInfo(r); err == nil && user.GetRole() == service.RoleModerator {
+			http.Error(w, "Access denied", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
 // matchSiteID is a middleware rejecting users with mismatch between site param and and User.SiteID
 func matchSiteID(next http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
@@ -243,30 +412,57 @@ func apiCSPMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// SecurityHeaders defines configurable parts of security headers set for every response
+type SecurityHeaders struct {
+	SiteAncestors     map[string][]string // per-site sources allowed to embed comments, override the global ones
+	ReferrerPolicy    string              // Referrer-Policy, "strict-origin-when-cross-origin" if empty
+	PermissionsPolicy string              // Permissions-Policy, all features not needed by the widget disabled if empty
+	ReportURI         string              // url of CSP violation reports collection, no reports if empty
+	ImgSources        []string            // sources of images allowed besides 'self' with image proxy, like CDN in front of it
+}
+
+const defaultPermissionsPolicy = "accelerometer=(), autoplay=(), camera=(), cross-origin-isolated=(), display-capture=(), encrypted-media=(), fullscreen=(), geolocation=(), gyroscope=(), keyboard-map=(), magnetometer=(), microphone=(), midi=(), payment=(), picture-in-picture=(), publickey-credentials-get=(), screen-wake-lock=(), sync-xhr=(), usb=(), xr-spatial-tracking=(), clipboard-read=(), clipboard-write=(), gamepad=(), hid=(), idle-detection=(), interest-cohort=(), serial=(), unload=(), window-management=()"
+
 // securityHeadersMiddleware sets security-related headers:
-//   - Content-Security-Policy: controls which resources the browser is allowed to load
+//   - Content-Security-Policy: controls which resources the browser is allowed to load. Frame ancestors
+//     of the site set by "site" query param, as for widget pages, override the global allowed ones
 //   - Permissions-Policy: disables browser features (camera, mic, etc.) not needed by a comment widget
 //   - X-Content-Type-Options: prevents browsers from MIME-sniffing responses away from the declared type,
 //     stopping e.g. a user-uploaded image from being reinterpreted as executable HTML/JS
 //   - Referrer-Policy: controls how much URL information leaks in the Referer header on cross-origin
 //     requests; "strict-origin-when-cross-origin" sends only the origin (no path) to other domains
 //     and nothing at all on HTTPS→HTTP downgrades
-func securityHeadersMiddleware(imageProxyEnabled bool, allowedAncestors []string) func(http.Handler) http.Handler {
+//   - Reporting-Endpoints: where browsers send CSP violation reports, if enabled
+func securityHeadersMiddleware(imageProxyEnabled bool, allowedAncestors []string, opts SecurityHeaders) func(http.Handler) http.Handler {
+	imgSrc := "*"
+	if imageProxyEnabled {
+		imgSrc = strings.Join(append([]string{"'self'"}, opts.ImgSources...), " ")
+	}
+	referrerPolicy := cmp.Or(opts.ReferrerPolicy, "strict-origin-when-cross-origin")
+	permissionsPolicy := cmp.Or(opts.PermissionsPolicy, defaultPermissionsPolicy)
+	report := ""
+	if opts.ReportURI != "" {
+		report = fmt.Sprintf(" report-uri %s; report-to csp-endpoint;", opts.ReportURI)
+	}
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			imgSrc := "*"
-			if imageProxyEnabled {
-				imgSrc = "'self'"
+			ancestors := allowedAncestors
+			if siteAncestors, ok := opts.SiteAncestors[r.URL.Query().Get("site")]; ok {
+				ancestors = siteAncestors
 			}
 			frameAncestors := "*"
-			if len(allowedAncestors) > 0 {
-				frameAncestors = strings.Join(allowedAncestors, " ")
+			if len(ancestors) > 0 {
+				frameAncestors = strings.Join(ancestors, " ")
 			}
 			// font-src is set to 'none' (no @font-face / no base64 fonts in the bundle).
-			w.Header().Set("Content-Security-Policy", fmt.Sprintf("default-src 'none'; base-uri 'none'; form-action 'none'; connect-src 'self'; frame-src 'self' mailto:; img-src %s; script-src 'self' 'unsafe-inline'; style-src 'self' 'unsafe-inline'; font-src 'none'; object-src 'none'; frame-ancestors %s;", imgSrc, frameAncestors))
-			w.Header().Set("Permissions-Policy", "accelerometer=(), autoplay=(), camera=(), cross-origin-isolated=(), display-capture=(), encrypted-media=(), fullscreen=(), geolocation=(), gyroscope=(), keyboard-map=(), magnetometer=(), microphone=(), midi=(), payment=(), picture-in-picture=(), publickey-credentials-get=(), screen-wake-lock=(), sync-xhr=(), usb=(), xr-spatial-tracking=(), clipboard-read=(), clipboard-write=(), gamepad=(), hid=(), idle-detection=(), interest-cohort=(), serial=(), unload=(), window-management=()")
+			w.Header().Set("Content-Security-Policy", fmt.Sprintf("default-src 'none'; base-uri 'none'; form-action 'none'; connect-src 'self'; frame-src 'self' mailto:; img-src %s; script-src 'self' 'unsafe-inline'; style-src 'self' 'unsafe-inline'; font-src 'none'; object-src 'none'; frame-ancestors %s;%s", imgSrc, frameAncestors, report))
+			if opts.ReportURI != "" {
+				w.Header().Set("Reporting-Endpoints", fmt.Sprintf("csp-endpoint=%q", opts.ReportURI))
+			}
+			w.Header().Set("Permissions-Policy", permissionsPolicy)
 			w.Header().Set("X-Content-Type-Options", "nosniff")
-			w.Header().Set("Referrer-Policy", "strict-origin-when-cross-origin")
+			w.Header().Set("Referrer-Policy", referrerPolicy)
 			next.ServeHTTP(w, r)
 		})
 	}
@@ -351,3 +547,197 @@ func rateLimiter(maxReq float64) func(http.Handler) http.Handler {
 	})
 	return tollbooth.HTTPMiddleware(lmt)
 }
+
+// anonUserLimiter limits comments of each anonymous user to perMinute, keyed on user id, so users with device identity
+// limited individually regardless of IP. Does nothing if perMinute is 0.
+func anonUserLimiter(perMinute float64) func(http.Handler) http.Handler {
+	if perMinute <= 0 {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	lmt := tollbooth.NewLimiter(perMinute/60, &limiter.ExpirableOptions{DefaultExpirationTTL: time.Hour})
+	lmt.SetBurst(max(1, int(perMinute)))
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			user, err := rest.GetUserInfo(r)
+			if err != nil || !strings.HasPrefix(user.ID, "anonymous_") {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if httpErr := tollbooth.LimitByKeys(lmt, []string{user.ID}); httpErr != nil {
+				rest.SendErrorJSON(w, r, httpErr.StatusCode, fmt.Errorf("rejected"), "too many comments", rest.ErrActionRejected)
+				return
+			}
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// botLimiter limits requests of each bot to perMinute, keyed on bot id, separately from users sharing the IP with it.
+// Does nothing if perMinute is 0.
+func botLimiter(perMinute float64) func(http.Handler) http.Handler {
+	if perMinute <= 0 {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	lmt := tollbooth.NewLimiter(perMinute/60, &limiter.ExpirableOptions{DefaultExpirationTTL: time.Hour})
+	lmt.SetBurst(max(1, int(perMinute)))
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			user, err := rest.GetUserInfo(r)
+			if err != nil || !user.Bot {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if httpErr := tollbooth.LimitByKeys(lmt, []string{user.ID}); httpErr != nil {
+				rest.SendErrorJSON(w, r, httpErr.StatusCode, fmt.Errorf("rejected"), "too many bot requests", rest.ErrActionRejected)
+				return
+			}
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// userLimiter limits requests of each user to perMinute, keyed on user id, so guessing of codes can't be spread
+// over many IPs. Requests without user passed as is.
+func userLimiter(perMinute float64) func(http.Handler) http.Handler {
+	lmt := tollbooth.NewLimiter(perMinute/60, &limiter.ExpirableOptions{DefaultExpirationTTL: time.Hour})
+	lmt.SetBurst(max(1, int(perMinute)))
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			user, err := rest.GetUserInfo(r)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if httpErr := tollbooth.LimitByKeys(lmt, []string{user.ID}); httpErr != nil {
+				rest.SendErrorJSON(w, r, httpErr.StatusCode, fmt.Errorf("rejected"), "too many requests", rest.ErrActionRejected)
+				return
+			}
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// powCheck requires solved proof-of-work challenge for requests matched by needFn, all requests if needFn is nil.
+// Does nothing if pow is nil.
+func powCheck(pow *rest.PoW, needFn func(r *http.Request) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if pow == nil {
+			return next
+		}
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if needFn != nil && !needFn(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if err := pow.Verify(r.Header.Get(rest.PoWChallengeHeader), r.Header.Get(rest.PoWSolutionHeader)); err != nil {
+				rest.SendErrorJSON(w, r, http.StatusForbidden, err, "proof-of-work check failed", rest.ErrPoWRequired)
+				return
+			}
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// captchaCheck is a middleware requiring captcha response token verified by the provider, for requests needFn reports,
+// or for all requests if needFn is nil. Does nothing if captcha is nil.
+func captchaCheck(captcha *rest.Captcha, needFn func(r *http.Request) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if captcha == nil {
+			return next
+		}
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if needFn != nil && !needFn(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if err := captcha.Verify(r.Context(), r.Header.Get(rest.CaptchaHeader), extractIP(r.RemoteAddr)); err != nil {
+				rest.SendErrorJSON(w, r, http.StatusForbidden, err, "captcha check failed", rest.ErrCaptchaRequired)
+				return
+			}
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// maintenanceMode is a middleware rejecting writes with 503 while the site or the whole server is in read-only
+// maintenance mode. Read requests pass through.
+func maintenanceMode(m *rest.Maintenance) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if status, ok := m.Active(r.URL.Query().Get("site")); ok {
+				rest.SendErrorJSON(w, r, http.StatusServiceUnavailable, errors.New("maintenance mode"), status.Message, rest.ErrMaintenance)
+				return
+			}
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// isAnonUserRequest checks if request made by anonymous user
+func isAnonUserRequest(r *http.Request) bool {
+	user, err := rest.GetUserInfo(r)
+	return err == nil && strings.HasPrefix(user.ID, "anonymous_")
+}
+
+// isEmailLoginRequest checks if request is email login sending confirmation email, not the confirmation itself
+func isEmailLoginRequest(r *http.Request) bool {
+	return r.URL.Path == "/auth/email/login" && r.URL.Query().Get("token") == ""
+}
+
+// Limits defines max body sizes and timeouts of routes accepting uploads, separate for comment posting,
+// image upload and import, so a limit suitable for one can't block or expose others. Zero values are defaults.
+type Limits struct {
+	CommentBody       int64         // max body of comment posting, preview and edit, 64k by default
+	ImageBody         int64         // max body of image upload, 32M by default
+	ImportBody        int64         // max body of import and remap upload, 256M by default
+	CommentTimeout    time.Duration // max time to read comment request and write response, 10s by default
+	ImageTimeout      time.Duration // max time to read image upload and write response, 30s by default
+	ImportTimeout     time.Duration // max time to read import upload and write response, 30m by default
+	ReadHeaderTimeout time.Duration // max time to read request headers of any route, 5s by default
+	IdleTimeout       time.Duration // max time to keep idle keep-alive connection, 30s by default
+}
+
+// withDefaults returns limits with zero values replaced by defaults
+func (l Limits) withDefaults() Limits {
+	l.CommentBody = cmp.Or(l.CommentBody, hardBodyLimit)
+	l.ImageBody = cmp.Or(l.ImageBody, 32*1024*1024)
+	l.ImportBody = cmp.Or(l.ImportBody, 256*1024*1024)
+	l.CommentTimeout = cmp.Or(l.CommentTimeout, 10*time.Second)
+	l.ImageTimeout = cmp.Or(l.ImageTimeout, 30*time.Second)
+	l.ImportTimeout = cmp.Or(l.ImportTimeout, 30*time.Minute)
+	l.ReadHeaderTimeout = cmp.Or(l.ReadHeaderTimeout, 5*time.Second)
+	l.IdleTimeout = cmp.Or(l.IdleTimeout, 30*time.Second)
+	return l
+}
+
+// limitRequest is a middleware capping request body to maxBody and setting read and write deadlines of the
+// connection to timeout from now. Deadlines protect from slow clients trickling the body or reading the response,
+// which the server can't do globally as import and export need much longer time than the rest of routes.
+// Oversized body fails reading with "request body too large" error.
+func limitRequest(maxBody int64, timeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			rc := http.NewResponseController(w)
+			deadline := time.Now().Add(timeout)
+			if err := rc.SetReadDeadline(deadline); err != nil && !errors.Is(err, http.ErrNotSupported) {
+				log.Printf("[WARN] can't set read deadline for %s, %v", r.URL.Path, err)
+			}
+			if err := rc.SetWriteDeadline(deadline); err != nil && !errors.Is(err, http.ErrNotSupported) {
+				log.Printf("[WARN] can't set write deadline for %s, %v", r.URL.Path, err)
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, maxBody)
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
@@ -1,21 +1,26 @@
 package api
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/go-pkgz/auth/v2/token"
 	R "github.com/go-pkgz/rest"
+	"github.com/go-pkgz/rest/realip"
 	"github.com/go-pkgz/routegroup"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/umputun/remark42/backend/app/rest"
 	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/bot"
 )
 
 // routes() wraps bounded routes with the enforcing rest.Timeout and deliberately leaves the
@@ -70,31 +75,79 @@ func TestRealIPMiddleware(t *testing.T) {
 	require.NoError(t, err)
 
 	t.Run("no trusted proxies trusts the header from anyone (legacy)", func(t *testing.T) {
-		addr, _ := call(realIPMiddleware(nil), "203.0.113.9:1234", "8.8.8.8")
+		addr, _ := call(realIPMiddleware(nil, ""), "203.0.113.9:1234", "8.8.8.8")
 		assert.Equal(t, "8.8.8.8", addr)
 	})
 	t.Run("trusted v4 peer: forwarding header sets the client IP", func(t *testing.T) {
-		addr, _ := call(realIPMiddleware(trusted), "172.18.0.5:5555", "8.8.8.8")
+		addr, _ := call(realIPMiddleware(trusted, ""), "172.18.0.5:5555", "8.8.8.8")
 		assert.Equal(t, "8.8.8.8", addr)
 	})
 	t.Run("trusted v6 peer: forwarding header honored", func(t *testing.T) {
-		addr, _ := call(realIPMiddleware(trusted), "[2001:db8::5]:5555", "8.8.8.8")
+		addr, _ := call(realIPMiddleware(trusted, ""), "[2001:db8::5]:5555", "8.8.8.8")
 		assert.Equal(t, "8.8.8.8", addr)
 	})
 	t.Run("trusted peer without a forwarding header falls back to the socket IP", func(t *testing.T) {
-		addr, _ := call(realIPMiddleware(trusted), "172.18.0.5:5555", "")
+		addr, _ := call(realIPMiddleware(trusted, ""), "172.18.0.5:5555", "")
 		assert.Equal(t, "172.18.0.5", addr, "no header to honor, so the bare socket IP is used")
 	})
 	t.Run("untrusted peer: header stripped, RemoteAddr pinned to bare socket IP", func(t *testing.T) {
-		addr, hdr := call(realIPMiddleware(trusted), "203.0.113.9:1234", "8.8.8.8")
+		addr, hdr := call(realIPMiddleware(trusted, ""), "203.0.113.9:1234", "8.8.8.8")
 		assert.Equal(t, "203.0.113.9", addr, "real socket IP with the port stripped")
 		assert.Empty(t, hdr, "spoofed forwarding header removed so nothing downstream can read it")
 	})
 	t.Run("unparseable RemoteAddr is treated as untrusted, header stripped", func(t *testing.T) {
-		addr, hdr := call(realIPMiddleware(trusted), "garbage", "8.8.8.8")
+		addr, hdr := call(realIPMiddleware(trusted, ""), "garbage", "8.8.8.8")
 		assert.Equal(t, "garbage", addr, "unparseable peer left as-is, not overwritten")
 		assert.Empty(t, hdr, "forwarding header still stripped for a non-trusted peer")
 	})
+	t.Run("trusted peer: resolved IP pinned and headers dropped", func(t *testing.T) {
+		addr, hdr := call(realIPMiddleware(trusted, ""), "172.18.0.5:5555", "10.1.2.3")
+		assert.Equal(t, "10.1.2.3", addr, "private client IP reported by a trusted proxy is used")
+		assert.Empty(t, hdr, "nothing downstream can re-derive a different IP")
+	})
+}
+
+func TestRealIPMiddleware_ForwardedFor(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"172.16.0.0/12", "10.0.0.5"})
+	require.NoError(t, err)
+
+	call := func(header string, headers map[string]string) (addr, logged string) {
+		next := http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+			addr = r.RemoteAddr
+			logged, _ = realip.Get(r) // what the request logger reports
+		})
+		req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+		req.RemoteAddr = "172.18.0.5:5555"
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		realIPMiddleware(trusted, header)(next).ServeHTTP(httptest.NewRecorder(), req)
+		return addr, logged
+	}
+
+	tbl := []struct {
+		name, header string
+		headers      map[string]string
+		res          string
+	}{
+		{"single hop", "", map[string]string{"X-Forwarded-For": "8.8.8.8"}, "8.8.8.8"},
+		{"spoofed hop prepended by client", "", map[string]string{"X-Forwarded-For": "1.1.1.1, 8.8.8.8"}, "8.8.8.8"},
+		{"trusted hops skipped", "", map[string]string{"X-Forwarded-For": "1.1.1.1, 8.8.8.8, 10.0.0.5, 172.20.0.1"}, "8.8.8.8"},
+		{"all hops trusted, leftmost used", "", map[string]string{"X-Forwarded-For": "10.0.0.5, 172.20.0.1"}, "10.0.0.5"},
+		{"malformed hop, peer used", "", map[string]string{"X-Forwarded-For": "8.8.8.8, junk"}, "172.18.0.5"},
+		{"x-real-ip first", "", map[string]string{"X-Real-IP": "9.9.9.9", "X-Forwarded-For": "8.8.8.8"}, "9.9.9.9"},
+		{"cf before xff", "", map[string]string{"CF-Connecting-IP": "7.7.7.7", "X-Forwarded-For": "8.8.8.8"}, "7.7.7.7"},
+		{"configured header only", "X-Forwarded-For", map[string]string{"X-Real-IP": "9.9.9.9", "X-Forwarded-For": "8.8.8.8"}, "8.8.8.8"},
+		{"configured header missing, peer used", "CF-Connecting-IP", map[string]string{"X-Real-IP": "9.9.9.9"}, "172.18.0.5"},
+		{"bad x-real-ip, peer used", "", map[string]string{"X-Real-IP": "junk"}, "172.18.0.5"},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, logged := call(tt.header, tt.headers)
+			assert.Equal(t, tt.res, addr)
+			assert.Equal(t, tt.res, logged, "logger sees the same IP")
+		})
+	}
 }
 
 func TestParseTrustedProxies(t *testing.T) {
@@ -161,6 +214,142 @@ func TestRest_rejectAnonUser(t *testing.T) {
 	assert.Equal(t, http.StatusOK, resp.StatusCode, "real user")
 }
 
+func TestRest_anonUserLimiter(t *testing.T) {
+	ts := httptest.NewServer(fakeAuth(anonUserLimiter(2)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintln(w, "Hello")
+	}))))
+	defer ts.Close()
+
+	status := func(query string) int {
+		resp, err := http.Get(ts.URL + query)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp.StatusCode
+	}
+
+	for range 2 {
+		assert.Equal(t, http.StatusOK, status("?fake_id=anonymous_user1&fake_name=test"))
+	}
+	assert.Equal(t, http.StatusTooManyRequests, status("?fake_id=anonymous_user1&fake_name=test"), "over the limit")
+	assert.Equal(t, http.StatusOK, status("?fake_id=anonymous_user2&fake_name=test"), "limited per user")
+	for range 3 {
+		assert.Equal(t, http.StatusOK, status("?fake_id=real_user&fake_name=test"), "not anonymous")
+	}
+	assert.Equal(t, http.StatusOK, status(""), "not logged in")
+
+	h := anonUserLimiter(0)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	assert.NotNil(t, h, "no limit")
+}
+
+func TestRest_botAuthAndLimiter(t *testing.T) {
+	botFn := func(siteID, key string) (bot.Bot, error) {
+		if siteID != "site1" || !strings.HasPrefix(key, "bot_") {
+			return bot.Bot{}, errors.New("wrong bot key")
+		}
+		return bot.Bot{ID: key, SiteID: siteID, Name: "bot"}, nil
+	}
+	ts := httptest.NewServer(botAuth(botFn, fakeAuth)(botLimiter(2)(rejectBot(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintln(w, "Hello")
+	})))))
+	defer ts.Close()
+
+	status := func(query, key string) int {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+query, http.NoBody)
+		require.NoError(t, err)
+		req.Header.Set(botKeyHeader, key)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp.StatusCode
+	}
+
+	for range 2 {
+		assert.Equal(t, http.StatusForbidden, status("?site=site1", "bot_1"), "authenticated, rejected by rejectBot")
+	}
+	assert.Equal(t, http.StatusTooManyRequests, status("?site=site1", "bot_1"), "over the limit")
+	assert.Equal(t, http.StatusForbidden, status("?site=site1", "bot_2"), "limited per bot")
+	assert.Equal(t, http.StatusUnauthorized, status("?site=site2", "bot_1"))
+	assert.Equal(t, http.StatusUnauthorized, status("?site=site1", "bad"))
+	for range 3 {
+		assert.Equal(t, http.StatusOK, status("?site=site1&fake_id=real_user&fake_name=test", ""), "not a bot")
+	}
+
+	h := botLimiter(0)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	assert.NotNil(t, h, "no limit")
+}
+
+func TestRest_powCheck(t *testing.T) {
+	pow := rest.NewPoW("secret", 4, time.Minute)
+	ts := httptest.NewServer(fakeAuth(powCheck(pow, isAnonUserRequest)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintln(w, "Hello")
+	}))))
+	defer ts.Close()
+
+	status := func(query, challenge, solution string) int {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+query, http.NoBody)
+		require.NoError(t, err)
+		req.Header.Set(rest.PoWChallengeHeader, challenge)
+		req.Header.Set(rest.PoWSolutionHeader, solution)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusOK, status("?fake_id=real_user&fake_name=test", "", ""), "not anonymous")
+	assert.Equal(t, http.StatusForbidden, status("?fake_id=anonymous_user1&fake_name=test", "", ""), "no solution")
+	challenge, err := pow.Challenge()
+	require.NoError(t, err)
+	solution := rest.SolvePoW(challenge, 4)
+	assert.Equal(t, http.StatusOK, status("?fake_id=anonymous_user1&fake_name=test", challenge, solution))
+	assert.Equal(t, http.StatusForbidden, status("?fake_id=anonymous_user1&fake_name=test", challenge, solution), "reused")
+
+	h := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	assert.NotNil(t, powCheck(nil, nil)(h), "disabled")
+
+	assert.True(t, isEmailLoginRequest(httptest.NewRequest(http.MethodGet, "/auth/email/login?address=a@example.com&user=user", http.NoBody)))
+	assert.False(t, isEmailLoginRequest(httptest.NewRequest(http.MethodGet, "/auth/email/login?token=abc", http.NoBody)), "confirmation")
+	assert.False(t, isEmailLoginRequest(httptest.NewRequest(http.MethodGet, "/auth/github/login", http.NoBody)))
+
+	srv := Rest{}
+	anonLogin := httptest.NewRequest(http.MethodGet, "/auth/anonymous/login?user=user", http.NoBody)
+	assert.False(t, srv.needsLoginChallenge(anonLogin), "anonymous login challenge disabled")
+	srv.AnonLoginPoW = true
+	assert.True(t, srv.needsLoginChallenge(anonLogin))
+	assert.True(t, srv.needsLoginChallenge(httptest.NewRequest(http.MethodGet, "/auth/email/login?address=a@example.com", http.NoBody)))
+	assert.False(t, srv.needsLoginChallenge(httptest.NewRequest(http.MethodGet, "/auth/github/login", http.NoBody)))
+}
+
+func TestRest_captchaCheck(t *testing.T) {
+	verify := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `{"success":%v}`, r.FormValue("response") == "good")
+	}))
+	defer verify.Close()
+	captcha := &rest.Captcha{Type: "turnstile", Secret: "secret", VerifyURL: verify.URL}
+	ts := httptest.NewServer(fakeAuth(captchaCheck(captcha, isAnonUserRequest)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintln(w, "Hello")
+	}))))
+	defer ts.Close()
+
+	status := func(query, token string) int {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+query, http.NoBody)
+		require.NoError(t, err)
+		req.Header.Set(rest.CaptchaHeader, token)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusOK, status("?fake_id=real_user&fake_name=test", ""), "not anonymous")
+	assert.Equal(t, http.StatusForbidden, status("?fake_id=anonymous_user1&fake_name=test", ""), "no token")
+	assert.Equal(t, http.StatusForbidden, status("?fake_id=anonymous_user1&fake_name=test", "bad"))
+	assert.Equal(t, http.StatusOK, status("?fake_id=anonymous_user1&fake_name=test", "good"))
+
+	h := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	assert.NotNil(t, captchaCheck(nil, nil)(h), "disabled")
+}
+
 func TestRest_cacheControl(t *testing.T) {
 	tbl := []struct {
 		url     string
@@ -257,6 +446,45 @@ func TestRest_securityHeaders(t *testing.T) {
 	assert.Contains(t, resp.Header.Get("Content-Security-Policy"), "img-src 'self';")
 	assert.Equal(t, "nosniff", resp.Header.Get("X-Content-Type-Options"))
 	assert.Equal(t, "strict-origin-when-cross-origin", resp.Header.Get("Referrer-Policy"))
+
+	assert.Empty(t, resp.Header.Get("Reporting-Endpoints"))
+	assert.NotContains(t, resp.Header.Get("Content-Security-Policy"), "report-uri")
+	teardown()
+
+	// check CSP with proxy behind cdn
+	ts, _, teardown = startupT(t, func(srv *Rest) {
+		srv.ExternalImageProxy = true
+		srv.SecurityHeaders = SecurityHeaders{ImgSources: []string{"https://cdn.example.com"}}
+	})
+	resp, err = client.Get(ts.URL + "/web/index.html")
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Contains(t, resp.Header.Get("Content-Security-Policy"), "img-src 'self' https://cdn.example.com;")
+	teardown()
+
+	// check configured headers, per-site ancestors and reporting
+	ts, _, teardown = startupT(t, func(srv *Rest) {
+		srv.AllowedAncestors = []string{"https://example.com"}
+		srv.SecurityHeaders = SecurityHeaders{SiteAncestors: map[string][]string{"blog": {"'self'", "https://blog.example.com"}},
+			ReferrerPolicy: "no-referrer", PermissionsPolicy: "camera=()"}
+		srv.CSPReports = rest.NewCSPReports(10)
+		srv.RemarkURL = "https://remark42.example.com"
+	})
+	defer teardown()
+	resp, err = client.Get(ts.URL + "/web/index.html?site=blog")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	csp := resp.Header.Get("Content-Security-Policy")
+	assert.Contains(t, csp, "frame-ancestors 'self' https://blog.example.com;")
+	assert.Contains(t, csp, "report-uri https://remark42.example.com/api/v1/csp-report; report-to csp-endpoint;")
+	assert.Equal(t, `csp-endpoint="https://remark42.example.com/api/v1/csp-report"`, resp.Header.Get("Reporting-Endpoints"))
+	assert.Equal(t, "no-referrer", resp.Header.Get("Referrer-Policy"))
+	assert.Equal(t, "camera=()", resp.Header.Get("Permissions-Policy"))
+
+	resp, err = client.Get(ts.URL + "/web/index.html?site=other")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Contains(t, resp.Header.Get("Content-Security-Policy"), "frame-ancestors https://example.com;", "global ancestors for other sites")
 }
 
 func TestRest_subscribersOnly(t *testing.T) {
@@ -364,8 +592,75 @@ func TestRest_matchSiteID(t *testing.T) {
 	}
 }
 
+func TestRest_applyRoles(t *testing.T) {
+	roles := map[string]string{"mod": "moderator", "adm": "admin"}
+	var seen token.User
+	wrapped := applyRoles(func(siteID, userID string) string {
+		assert.Equal(t, "site-a", siteID)
+		return roles[userID]
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = token.GetUserInfo(r)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	cases := []struct {
+		name      string
+		id, role  string
+		admin     bool
+		wantRole  string
+		wantAdmin bool
+	}{
+		{name: "moderator assigned", id: "mod", wantRole: "moderator", wantAdmin: true},
+		{name: "admin assigned", id: "adm", wantRole: "admin", wantAdmin: true},
+		{name: "role removed", id: "user", role: "moderator", admin: true, wantRole: "", wantAdmin: false},
+		{name: "admin without role kept", id: "user", admin: true, wantRole: "", wantAdmin: true},
+		{name: "regular user kept", id: "user", wantRole: "", wantAdmin: false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			u := token.User{ID: c.id, Name: c.id, Audience: "site-a", Role: c.role}
+			u.SetAdmin(c.admin)
+			req := token.SetUserInfo(httptest.NewRequest(http.MethodGet, "/", http.NoBody), u)
+			wrapped.ServeHTTP(httptest.NewRecorder(), req)
+			assert.Equal(t, c.wantRole, seen.GetRole())
+			assert.Equal(t, c.wantAdmin, seen.IsAdmin())
+		})
+	}
+
+	seen = token.User{}
+	wrapped.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+	assert.Empty(t, seen.ID, "not authenticated request passed as is")
+}
+
+func TestRest_adminOnlyAndRejectModerator(t *testing.T) {
+	wrapped := adminOnly(rejectModerator(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+	check := func(u *token.User) int {
+		req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+		if u != nil {
+			req = token.SetUserInfo(req, *u)
+		}
+		rr := httptest.NewRecorder()
+		wrapped.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, check(nil))
+	assert.Equal(t, http.StatusForbidden, check(&token.User{ID: "user", Name: "user"}), "not admin")
+	admin := token.User{ID: "adm", Name: "adm"}
+	admin.SetAdmin(true)
+	assert.Equal(t, http.StatusOK, check(&admin))
+	moderator := token.User{ID: "mod", Name: "mod", Role: "moderator"}
+	moderator.SetAdmin(true)
+	assert.Equal(t, http.StatusForbidden, check(&moderator), "moderator rejected")
+}
+
 func TestCorsMiddleware(t *testing.T) {
-	h := corsMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+	policies, err := rest.NewCORSPolicies(rest.CORSPolicy{Origins: []string{"*"}, Credentials: true, MaxAge: 300},
+		map[string]rest.CORSPolicy{"blog": {Origins: []string{"https://blog.example.com"}, MaxAge: 60}, "closed": {}})
+	require.NoError(t, err)
+	h := corsMiddleware(policies)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	}))
 
@@ -403,4 +698,87 @@ func TestCorsMiddleware(t *testing.T) {
 		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", http.NoBody))
 		assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
 	})
+
+	t.Run("site policy allows only its origins", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodOptions, "/?site=blog", http.NoBody)
+		req.Header.Set("Origin", "https://blog.example.com")
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Equal(t, "https://blog.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+		assert.Empty(t, rec.Header().Get("Access-Control-Allow-Credentials"))
+		assert.Equal(t, "60", rec.Header().Get("Access-Control-Max-Age"))
+
+		req = httptest.NewRequest(http.MethodGet, "/?site=blog", http.NoBody)
+		req.Header.Set("Origin", "https://example.com")
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("site without origins gets no CORS headers", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/?site=closed", http.NoBody)
+		req.Header.Set("Origin", "https://example.com")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("policy changed at runtime", func(t *testing.T) {
+		require.NoError(t, policies.Set("news", rest.CORSPolicy{Origins: []string{"https://news.example.com"}, Credentials: true}))
+		req := httptest.NewRequest(http.MethodGet, "/?site=news", http.NoBody)
+		req.Header.Set("Origin", "https://news.example.com")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		assert.Equal(t, "https://news.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "true", rec.Header().Get("Access-Control-Allow-Credentials"))
+	})
+}
+
+func TestLimitRequest(t *testing.T) {
+	readErr := make(chan error, 1)
+	h := limitRequest(10, 100*time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		readErr <- err
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		_, _ = w.Write(body)
+	}))
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL, "text/plain", strings.NewReader("0123456789"))
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "0123456789", string(body))
+	assert.NoError(t, <-readErr)
+
+	resp, err = http.Post(ts.URL, "text/plain", strings.NewReader("0123456789a"))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+	assert.EqualError(t, <-readErr, "http: request body too large")
+
+	// slow client sends headers and stalls on the body
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = fmt.Fprintf(conn, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 10\r\n\r\n01234")
+	require.NoError(t, err)
+	select {
+	case err = <-readErr:
+		var netErr net.Error
+		require.ErrorAs(t, err, &netErr)
+		assert.True(t, netErr.Timeout(), "body read interrupted by deadline")
+	case <-time.After(time.Second):
+		t.Fatal("slow body read not interrupted")
+	}
 }
@@ -14,12 +14,12 @@ import (
 	"sync"
 	"time"
 
-	cache "github.com/go-pkgz/lcw/v2"
 	log "github.com/go-pkgz/lgr"
 	R "github.com/go-pkgz/rest"
 
 	"github.com/umputun/remark42/backend/app/migrator"
 	"github.com/umputun/remark42/backend/app/rest"
+	"github.com/umputun/remark42/backend/app/rest/cdn"
 	"github.com/umputun/remark42/backend/app/store/engine"
 )
 
@@ -76,7 +76,6 @@ func (m *Migrator) importFormCtrl(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	r.Body = http.MaxBytesReader(w, r.Body, 256*1024*1024) // hard cap on upload to prevent memory exhaustion
 	reader, err := r.MultipartReader()
 	if err != nil {
 		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't parse multipart form", rest.ErrDecode)
@@ -240,7 +239,7 @@ func (m *Migrator) remapCtrl(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		m.Cache.Flush(cache.Flusher(siteID).Scopes(siteID))
+		cdn.Flush(m.Cache, siteID, siteID)
 		log.Printf("[DEBUG] convert request completed. site=%s, comments=%d", siteID, size)
 	}()
 
@@ -282,7 +281,7 @@ func (m *Migrator) runImport(siteID, provider, tmpfile string) {
 		log.Printf("[WARN] import failed, %v", err)
 		return
 	}
-	m.Cache.Flush(cache.Flusher(siteID).Scopes(siteID))
+	cdn.Flush(m.Cache, siteID, siteID)
 	log.Printf("[DEBUG] import request completed. site=%s, provider=%s, comments=%d", siteID, provider, size)
 }
 
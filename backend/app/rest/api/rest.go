@@ -3,29 +3,42 @@ package api
 import (
 	"bytes"
 	"context"
+	"crypto/subtle"
 	"embed"
 	"encoding/json"
+	"errors"
+	"expvar"
 	"fmt"
+	"io"
 	"io/fs"
 	"net"
 	"net/http"
+	"net/http/pprof"
+	"net/url"
 	"os"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/go-pkgz/auth/v2"
+	"github.com/go-pkgz/auth/v2/token"
 	"github.com/go-pkgz/lcw/v2"
 	log "github.com/go-pkgz/lgr"
 	R "github.com/go-pkgz/rest"
 	"github.com/go-pkgz/rest/logger"
 	"github.com/go-pkgz/routegroup"
+	"github.com/quic-go/quic-go/http3"
 
 	"github.com/umputun/remark42/backend/app/notify"
+	"github.com/umputun/remark42/backend/app/plugin"
+	"github.com/umputun/remark42/backend/app/resilient"
 	"github.com/umputun/remark42/backend/app/rest"
+	"github.com/umputun/remark42/backend/app/rest/cdn"
 	"github.com/umputun/remark42/backend/app/rest/proxy"
+	"github.com/umputun/remark42/backend/app/rest/shadow"
 	"github.com/umputun/remark42/backend/app/store"
 	"github.com/umputun/remark42/backend/app/store/image"
+	"github.com/umputun/remark42/backend/app/store/poll"
 	"github.com/umputun/remark42/backend/app/store/service"
 )
 
@@ -35,24 +48,47 @@ type Rest struct {
 
 	DataService      *service.DataStore
 	Authenticator    *auth.Service
+	TokenRotation    *rest.TokenRotation // accepts tokens of the previous secret during rotation, current secret only if nil
 	Cache            LoadingCache
+	CDNMaxAge        time.Duration // time CDN keeps responses of anonymous read requests, no caching hints if 0
 	ImageProxy       *proxy.Image
 	CommentFormatter *store.CommentFormatter
 	Migrator         *Migrator
 	NotifyService    *notify.Service
 	TelegramService  telegramService
 	ImageService     *image.Service
+	Remotes          []*resilient.Transport
+	CORS             *rest.CORSPolicies
+	PoW              *rest.PoW         // proof-of-work for anonymous comments and verification emails, disabled if nil
+	Captcha          *rest.Captcha     // captcha for anonymous login and first comments of new users, disabled if nil
+	JWKS             *rest.JWKS        // signs tokens for other services with asymmetric keys, disabled if nil
+	Maintenance      *rest.Maintenance // read-only maintenance mode, toggled at runtime by admins
+	Shadow           *shadow.Mirror    // mirrors sample of read requests to the secondary instance, disabled if nil
+	CSPReports       *rest.CSPReports  // collected CSP violation reports, reporting disabled if nil
+	SecurityHeaders  SecurityHeaders   // configurable security headers of responses
+	Limits           Limits            // body sizes and timeouts of comment posting, image upload and import
+	Plugins          *plugin.Manager   // WASM plugins run at hooks of comment processing, disabled if nil
+	EmailEvents      EmailEvents       // webhook of the email provider reporting bounces and complaints
+	SAMLMetadata     http.Handler      // metadata of SAML service provider, disabled if nil
+	WebAuthnRegister http.Handler      // passkey registration of WebAuthn provider, disabled if nil
 
 	AnonVote        bool
+	AnonLoginPoW    bool    // require proof-of-work for anonymous login, with PoW set
+	AnonCaptcha     bool    // require captcha for anonymous login, with Captcha set
+	NewUserCaptcha  bool    // require captcha for the first comment of the user on the site, with Captcha set
+	AnonLimit       float64 // comments per minute allowed to each anonymous user, unlimited if 0
+	BotLimit        float64 // requests per minute allowed to each bot, unlimited if 0
 	WebRoot         string
 	WebFS           embed.FS
 	RemarkURL       string
 	ReadOnlyAge     int
 	SharedSecret    string
 	TrustedProxies  []*net.IPNet // reverse-proxy networks whose forwarding headers (X-Real-IP, X-Forwarded-For, ...) are trusted
+	TrustedHeader   string       // the only forwarding header read from trusted proxies, all of them if empty
 	ScoreThresholds struct {
-		Low      int
-		Critical int
+		Low         int
+		Critical    int
+		Controversy float64 // controversy of comments shown as controversial, 0 disables the indicator
 	}
 	UpdateLimiter              float64
 	EmailNotifications         bool
@@ -63,13 +99,21 @@ type Rest struct {
 	SendJWTHeader              bool
 	AllowedAncestors           []string // sets Content-Security-Policy "frame-ancestors ..."
 	SubscribersOnly            bool
+	PublishBlocklist           bool // publish users blocked by admins at /blocklist, as a feed for other instances
 	DisableSignature           bool // prevent signature from being added to headers
 	DisableFancyTextFormatting bool // disables SmartyPants in the comment text rendering of the posted comments
 	ExternalImageProxy         bool
 
 	SSLConfig         SSLConfig
+	AdminCert         AdminCertPolicy // client certificate requirements of admin API
+	AdminTOTP         AdminTOTP       // TOTP second factor required from admins, not required if not enabled
+	AdminListen       string          // address:port of separate admin server with admin API and profiler, admin API not public if set
+	AdminPprof        bool            // serve profiler on the admin server, to basic auth admin only
+	Listener          net.Listener    // listener of http server instead of address and port, i.e. unix socket; ssl mode None only
 	httpsServer       *http.Server
 	httpServer        *http.Server
+	adminServer       *http.Server
+	http3Server       *http3.Server
 	shutdownRequested bool
 	lock              sync.Mutex
 
@@ -94,11 +138,13 @@ const lastCommentsScope = "last"
 type commentsWithInfo struct {
 	Comments []store.Comment `json:"comments"`
 	Info     store.PostInfo  `json:"info"`
+	Poll     *poll.Results   `json:"poll,omitempty"`
 }
 
 type treeWithInfo struct {
 	*service.Tree
 	Info store.PostInfo `json:"info"`
+	Poll *poll.Results  `json:"poll,omitempty"`
 }
 
 // Run the lister and request's router, activate rest server
@@ -107,28 +153,62 @@ func (s *Rest) Run(address string, port int) {
 		address = ""
 	}
 
+	router := s.routes()
+	if s.AdminListen != "" {
+		log.Printf("[INFO] activate admin server on %s", s.AdminListen)
+		s.lock.Lock()
+		s.adminServer = s.makeHTTPServer("", 0, s.adminRouter())
+		s.adminServer.Addr = s.AdminListen
+		s.adminServer.ErrorLog = log.ToStdLogger(log.Default(), "WARN")
+		adminServer := s.adminServer
+		if s.shutdownRequested {
+			s.lock.Unlock()
+			log.Print("[WARN] rest server start canceled")
+			return
+		}
+		s.lock.Unlock()
+
+		go func() {
+			err := adminServer.ListenAndServe()
+			log.Printf("[WARN] admin server terminated, %s", err)
+		}()
+	}
+
 	switch s.SSLConfig.SSLMode {
 	case None:
-		log.Printf("[INFO] activate http rest server on %s:%d", address, port)
+		if s.Listener != nil {
+			log.Printf("[INFO] activate http rest server on %s", s.Listener.Addr())
+		} else {
+			log.Printf("[INFO] activate http rest server on %s:%d", address, port)
+		}
 
 		s.lock.Lock()
-		s.httpServer = s.makeHTTPServer(address, port, s.routes())
+		s.httpServer = s.makeHTTPServer(address, port, router)
 		s.httpServer.ErrorLog = log.ToStdLogger(log.Default(), "WARN")
 		if s.shutdownRequested {
 			s.lock.Unlock()
+			if s.Listener != nil {
+				_ = s.Listener.Close()
+			}
 			log.Print("[WARN] rest server start canceled")
 			return
 		}
 		s.lock.Unlock()
 
-		err := s.httpServer.ListenAndServe()
+		var err error
+		if s.Listener != nil {
+			err = s.httpServer.Serve(s.Listener)
+		} else {
+			err = s.httpServer.ListenAndServe()
+		}
 		log.Printf("[WARN] http server terminated, %s", err)
 	case Static:
 		log.Printf("[INFO] activate https server in 'static' mode on %s:%d", address, s.SSLConfig.Port)
 
 		s.lock.Lock()
-		s.httpsServer = s.makeHTTPSServer(address, s.SSLConfig.Port, s.routes())
+		s.httpsServer = s.makeHTTPSServer(address, s.SSLConfig.Port, router)
 		s.httpsServer.ErrorLog = log.ToStdLogger(log.Default(), "WARN")
+		s.http3Server = s.makeHTTP3(s.httpsServer)
 
 		s.httpServer = s.makeHTTPServer(address, port, s.httpToHTTPSRouter())
 		s.httpServer.ErrorLog = log.ToStdLogger(log.Default(), "WARN")
@@ -139,6 +219,7 @@ func (s *Rest) Run(address string, port int) {
 		}
 		s.lock.Unlock()
 
+		s.runHTTP3()
 		go func() {
 			log.Printf("[INFO] activate http redirect server on %s:%d", address, port)
 			err := s.httpServer.ListenAndServe()
@@ -152,8 +233,9 @@ func (s *Rest) Run(address string, port int) {
 
 		m := s.makeAutocertManager()
 		s.lock.Lock()
-		s.httpsServer = s.makeHTTPSAutocertServer(address, s.SSLConfig.Port, s.routes(), m)
+		s.httpsServer = s.makeHTTPSAutocertServer(address, s.SSLConfig.Port, router, m)
 		s.httpsServer.ErrorLog = log.ToStdLogger(log.Default(), "WARN")
+		s.http3Server = s.makeHTTP3(s.httpsServer)
 
 		s.httpServer = s.makeHTTPServer(address, port, s.httpChallengeRouter(m))
 		s.httpServer.ErrorLog = log.ToStdLogger(log.Default(), "WARN")
@@ -165,6 +247,7 @@ func (s *Rest) Run(address string, port int) {
 
 		s.lock.Unlock()
 
+		s.runHTTP3()
 		go func() {
 			log.Printf("[INFO] activate http challenge server on port %d", port)
 
@@ -198,16 +281,60 @@ func (s *Rest) Shutdown() {
 		}
 		log.Print("[DEBUG] shutdown https server completed")
 	}
+
+	if s.http3Server != nil {
+		log.Print("[WARN] shutdown http3 server")
+		if err := s.http3Server.Shutdown(ctx); err != nil {
+			log.Printf("[DEBUG] http3 shutdown error, %s", err)
+		}
+		log.Print("[DEBUG] shutdown http3 server completed")
+	}
+
+	if s.adminServer != nil {
+		log.Print("[WARN] shutdown admin server")
+		if err := s.adminServer.Shutdown(ctx); err != nil {
+			log.Printf("[DEBUG] admin shutdown error, %s", err)
+		}
+		log.Print("[DEBUG] shutdown admin server completed")
+	}
 	s.lock.Unlock()
 }
 
+// makeHTTP3 makes HTTP/3 server for https server if enabled, nil if disabled or can't be made
+func (s *Rest) makeHTTP3(server *http.Server) *http3.Server {
+	if !s.SSLConfig.HTTP3 {
+		return nil
+	}
+	res, err := s.makeHTTP3Server(server)
+	if err != nil {
+		log.Printf("[WARN] http3 server disabled, %v", err)
+		return nil
+	}
+	return res
+}
+
+// runHTTP3 starts HTTP/3 server in background if it is made
+func (s *Rest) runHTTP3() {
+	if s.http3Server == nil {
+		return
+	}
+	h3 := s.http3Server
+	go func() {
+		log.Printf("[INFO] activate http3 server on %s/udp", h3.Addr)
+		err := h3.ListenAndServe()
+		log.Printf("[WARN] http3 server terminated, %s", err)
+	}()
+}
+
 func (s *Rest) makeHTTPServer(address string, port int, router http.Handler) *http.Server {
+	limits := s.Limits.withDefaults()
 	return &http.Server{
 		Addr:              fmt.Sprintf("%s:%d", address, port),
 		Handler:           router,
-		ReadHeaderTimeout: 5 * time.Second,
-		// WriteTimeout:      120 * time.Second, // TODO: such a long timeout needed for blocking export (backup) request
-		IdleTimeout: 30 * time.Second,
+		ReadHeaderTimeout: limits.ReadHeaderTimeout,
+		// no global ReadTimeout and WriteTimeout, as import and export (backup) requests take long.
+		// upload routes set their own deadlines with limitRequest middleware
+		IdleTimeout: limits.IdleTimeout,
 	}
 }
 
@@ -216,9 +343,23 @@ func (s *Rest) routes() http.Handler {
 		// set the default open route limiter. Just a safety measure as it should be set by Run method anyway
 		s.openRouteLimiter = openRouteLimiter
 	}
+	if s.Maintenance == nil {
+		s.Maintenance = rest.NewMaintenance(false, "")
+	}
+	if s.CORS == nil {
+		s.CORS, _ = rest.NewCORSPolicies(rest.CORSPolicy{Origins: []string{"*"}, Credentials: true, MaxAge: 300}, nil)
+	}
+	if s.TokenRotation == nil {
+		s.TokenRotation = rest.NewTokenRotation(s.Authenticator.TokenService(), "", time.Time{})
+	}
 	router := routegroup.New(http.NewServeMux())
-	router.Use(R.Throttle(1000), realIPMiddleware(s.TrustedProxies), R.Recoverer(log.Default()))
-	router.Use(securityHeadersMiddleware(s.ExternalImageProxy, s.AllowedAncestors))
+	router.Use(R.Throttle(1000), realIPMiddleware(s.TrustedProxies, s.TrustedHeader), R.Recoverer(log.Default()))
+	router.Use(s.TokenRotation.Handler) // re-sign tokens of the previous secret before auth middlewares check them
+	securityHeaders := s.SecurityHeaders
+	if s.CSPReports != nil {
+		securityHeaders.ReportURI = s.RemarkURL + "/api/v1/csp-report"
+	}
+	router.Use(securityHeadersMiddleware(s.ExternalImageProxy, s.AllowedAncestors, securityHeaders))
 	if !s.DisableSignature {
 		router.Use(R.AppInfo("remark42", "umputun", s.Version))
 	}
@@ -229,19 +370,30 @@ func (s *Rest) routes() http.Handler {
 	if s.ProxyCORS {
 		log.Printf("[WARN] internal CORS disabled")
 	} else {
-		router.Use(corsMiddleware())
+		router.Use(corsMiddleware(s.CORS))
 	}
 
 	ipFn := func(ip string) string { return store.HashValue(ip, s.SharedSecret)[:12] } // logger uses it for anonymization
 	logInfoWithBody := logger.New(logger.Log(log.Default()), logger.WithBody, logger.IPfn(ipFn), logger.Prefix("[INFO]")).Handler
 
 	authHandler, avatarHandler := s.Authenticator.Handlers()
+	limits := s.Limits.withDefaults()
+	commentLimit := limitRequest(limits.CommentBody, limits.CommentTimeout)
+	importLimit := limitRequest(limits.ImportBody, limits.ImportTimeout)
 
 	router.Route(func(r *routegroup.Bundle) {
 		r.Use(R.Timeout(5 * time.Second))
 		r.Use(logInfoWithBody, rateLimiter(2), R.NoCache)
 		r.Use(validEmailAuth()) // reject suspicious email logins
+		r.Use(powCheck(s.PoW, s.needsLoginChallenge))
+		r.Use(captchaCheck(s.Captcha, s.needsLoginCaptcha))
 		r.Handle("/auth/", authHandler)
+		if s.SAMLMetadata != nil {
+			r.Handle("GET /auth/saml/metadata", s.SAMLMetadata)
+		}
+		if s.WebAuthnRegister != nil {
+			r.Handle("POST /auth/webauthn/register/{step}", s.WebAuthnRegister)
+		}
 	})
 
 	router.Route(func(r *routegroup.Bundle) {
@@ -266,8 +418,15 @@ func (s *Rest) routes() http.Handler {
 	rapi.Group().Route(func(ropen *routegroup.Bundle) {
 		ropen.Use(R.Timeout(30 * time.Second))
 		ropen.Use(rateLimiter(s.openRouteLimiter))
-		ropen.Use(authMiddleware.Trace, R.NoCache, logInfoWithBody)
+		ropen.Use(authMiddleware.Trace, applyRoles(s.DataService.UserRole), R.NoCache, logInfoWithBody)
+		if s.Shadow != nil {
+			ropen.Use(s.Shadow.Handler)
+		}
 		ropen.HandleFunc("GET /config", s.configCtrl)
+		ropen.HandleFunc("POST /anon/device", s.anonDeviceCtrl)
+		ropen.HandleFunc("GET /pow", s.powChallengeCtrl)
+		ropen.HandleFunc("POST /csp-report", s.cspReportCtrl)
+		ropen.HandleFunc("POST /email/events/{provider}", s.emailEventsCtrl)
 		ropen.HandleFunc("GET /find", s.pubRest.findCommentsCtrl)
 		ropen.HandleFunc("GET /id/{id}", s.pubRest.commentByIDCtrl)
 		ropen.HandleFunc("GET /comments", s.pubRest.findUserCommentsCtrl)
@@ -276,6 +435,12 @@ func (s *Rest) routes() http.Handler {
 		ropen.HandleFunc("POST /counts", s.pubRest.countMultiCtrl)
 		ropen.HandleFunc("GET /list", s.pubRest.listCtrl)
 		ropen.HandleFunc("GET /info", s.pubRest.infoCtrl)
+		ropen.HandleFunc("GET /poll", s.pubRest.pollCtrl)
+		ropen.HandleFunc("GET /highlights", s.pubRest.highlightsCtrl)
+		ropen.HandleFunc("GET /blocklist", s.pubRest.blocklistCtrl)
+		ropen.HandleFunc("GET /permissions", s.privRest.permissionsCtrl)
+		ropen.HandleFunc("GET /subscriptions", s.privRest.getSubscriptionsCtrl)
+		ropen.HandleFunc("PUT /subscriptions", s.privRest.setSubscriptionsCtrl)
 
 		ropen.Mount("/rss").Route(func(rrss *routegroup.Bundle) {
 			rrss.HandleFunc("GET /post", s.rssRest.postCommentsCtrl)
@@ -284,25 +449,40 @@ func (s *Rest) routes() http.Handler {
 		})
 	})
 
+	// live-blog routes. The feed is cached by clients and proxies for a few seconds, the stream of new comments
+	// is long-lived and deliberately runs without R.Timeout, which buffers the whole response until the handler returns
+	rapi.Group().Route(func(rlive *routegroup.Bundle) {
+		rlive.Use(rateLimiter(s.openRouteLimiter))
+		rlive.With(R.Timeout(30*time.Second), authMiddleware.Trace, applyRoles(s.DataService.UserRole), logInfoWithBody).
+			HandleFunc("GET /live", s.pubRest.liveCommentsCtrl)
+		rlive.HandleFunc("GET /live/stream", s.pubRest.liveStreamCtrl)
+	})
+
 	// open routes, cached. /img lives here (not in the NoCache group above) because
 	// R.NoCache strips If-None-Match from incoming requests, which would
 	// defeat the proxy handler's 304 short-circuit. The handler sets a 30-day
 	// max-age on validated success responses (with a versioned etag for cache
 	// invalidation on revalidation); error responses get Cache-Control: no-store
-	// so transient failures aren't pinned in the cache.
+	// so transient failures aren't pinned in the cache. In CDN origin mode images
+	// are served on immutable content-hash paths /img/{hash}/{src}.
 	rapi.Group().Route(func(ropen *routegroup.Bundle) {
 		ropen.Use(R.Timeout(30 * time.Second))
 		ropen.Use(rateLimiter(10))
-		ropen.Use(authMiddleware.Trace, logInfoWithBody)
+		ropen.Use(authMiddleware.Trace, applyRoles(s.DataService.UserRole), logInfoWithBody)
 		ropen.HandleFunc("GET /img", s.ImageProxy.Handler)
+		if s.ImageProxy.CDNOrigin {
+			ropen.HandleFunc("GET /img/{hash}/{src}", s.ImageProxy.CDNHandler)
+		}
 		ropen.HandleFunc("GET /picture/{user}/{id}", s.pubRest.loadPictureCtrl)
+		ropen.HandleFunc("GET /picture/{user}/{id}/{size}", s.pubRest.pictureThumbnailCtrl)
+		ropen.HandleFunc("GET /initials/{user}", s.pubRest.initialsAvatarCtrl)
 		ropen.HandleFunc("GET /qr/telegram", s.pubRest.telegramQrCtrl)
 	})
 
 	// protected routes, require auth
 	rapi.Group().Route(func(rauth *routegroup.Bundle) {
 		rauth.Use(rateLimiter(10))
-		rauth.Use(authMiddleware.Auth, matchSiteID, R.NoCache, logInfoWithBody)
+		rauth.Use(authMiddleware.Auth, applyRoles(s.DataService.UserRole), matchSiteID, R.NoCache, logInfoWithBody)
 
 		// GET /userdata streams a gzipped export of the user's data straight to the client, so it
 		// deliberately runs without R.Timeout: that middleware buffers the whole response in memory
@@ -312,66 +492,54 @@ func (s *Rest) routes() http.Handler {
 		rauth.Group().Route(func(r *routegroup.Bundle) {
 			r.Use(R.Timeout(30 * time.Second))
 			r.HandleFunc("GET /user", s.privRest.userInfoCtrl)
+			r.HandleFunc("GET /user/profile", s.privRest.getUserProfileCtrl)
+			r.HandleFunc("GET /token", s.serviceTokenCtrl)
+			r.With(rejectAnonUser).HandleFunc("GET /ignore", s.privRest.ignoredUsersCtrl)
 		})
 	})
 
-	// admin routes, require auth and admin users only
-	rapi.Mount("/admin").Route(func(radmin *routegroup.Bundle) {
-		radmin.Use(rateLimiter(10))
-		radmin.Use(authMiddleware.Auth, authMiddleware.AdminOnly, matchSiteID)
-		radmin.Use(R.NoCache, logInfoWithBody)
-
-		// bounded admin operations return small responses and get the enforcing request timeout
-		radmin.Group().Route(func(r *routegroup.Bundle) {
-			r.Use(R.Timeout(30 * time.Second))
-			r.HandleFunc("DELETE /comment/{id}", s.adminRest.deleteCommentCtrl)
-			r.HandleFunc("PUT /user/{userid}", s.adminRest.setBlockCtrl)
-			r.HandleFunc("DELETE /user/{userid}", s.adminRest.deleteUserCtrl)
-			r.HandleFunc("GET /user/{userid}", s.adminRest.getUserInfoCtrl)
-			r.With(rejectHead("GET")).HandleFunc("GET /deleteme", s.adminRest.deleteMeRequestCtrl)
-			r.HandleFunc("PUT /verify/{userid}", s.adminRest.setVerifyCtrl)
-			r.HandleFunc("PUT /pin/{id}", s.adminRest.setPinCtrl)
-			r.HandleFunc("GET /blocked", s.adminRest.blockedUsersCtrl)
-			r.HandleFunc("PUT /readonly", s.adminRest.setReadOnlyCtrl)
-			r.HandleFunc("PUT /title/{id}", s.adminRest.setTitleCtrl)
-		})
-
-		// migrator routes deliberately run without R.Timeout: GET /export streams a full-site
-		// backup, GET /wait long-polls for up to 15m, and import/remap ingest large uploads. The
-		// enforcing timeout buffers the whole response and aborts at the deadline, which would
-		// truncate backups, break waiting, and reject large imports.
-		radmin.HandleFunc("GET /export", s.adminRest.migrator.exportCtrl)
-		radmin.HandleFunc("POST /import", s.adminRest.migrator.importCtrl)
-		radmin.HandleFunc("POST /import/form", s.adminRest.migrator.importFormCtrl)
-		radmin.HandleFunc("POST /remap", s.adminRest.migrator.remapCtrl)
-		radmin.HandleFunc("GET /wait", s.adminRest.migrator.waitCtrl)
-	})
+	// admin routes, served by the separate admin server instead if AdminListen set
+	if s.AdminListen == "" {
+		rapi.Mount("/admin").Route(s.adminRoutes(authMiddleware.Auth, logInfoWithBody, importLimit))
+	}
 
 	// protected routes, throttled to 10/s by default, controlled by external UpdateLimiter param
 	rapi.Group().Route(func(rauth *routegroup.Bundle) {
 		rauth.Use(R.Timeout(10 * time.Second))
 		rauth.Use(rateLimiter(s.updateLimiter()))
-		rauth.Use(authMiddleware.Auth, matchSiteID, subscribersOnly(s.SubscribersOnly))
+		rauth.Use(botAuth(s.DataService.BotByKey, authMiddleware.Auth), applyRoles(s.DataService.UserRole), matchSiteID,
+			botLimiter(s.BotLimit), subscribersOnly(s.SubscribersOnly), maintenanceMode(s.Maintenance))
 		rauth.Use(R.NoCache, logInfoWithBody)
 
-		rauth.HandleFunc("PUT /comment/{id}", s.privRest.updateCommentCtrl)
-		rauth.HandleFunc("POST /preview", s.privRest.previewCommentCtrl)
-		rauth.HandleFunc("POST /comment", s.privRest.createCommentCtrl)
-		rauth.HandleFunc("PUT /vote/{id}", s.privRest.voteCtrl)
+		rauth.With(commentLimit).HandleFunc("PUT /comment/{id}", s.privRest.updateCommentCtrl)
+		rauth.HandleFunc("GET /comment/{id}/raw", s.privRest.rawCommentCtrl)
+		rauth.With(commentLimit).HandleFunc("POST /preview", s.privRest.previewCommentCtrl)
+		rauth.With(commentLimit, anonUserLimiter(s.AnonLimit), powCheck(s.PoW, s.needsChallenge),
+			captchaCheck(s.Captcha, s.needsCommentCaptcha)).HandleFunc("POST /comment", s.privRest.createCommentCtrl)
+		rauth.With(rejectBot).HandleFunc("PUT /vote/{id}", s.privRest.voteCtrl)
+		rauth.With(rejectAnonUser, rejectBot).HandleFunc("PUT /poll/vote", s.privRest.pollVoteCtrl)
+		rauth.With(rejectAnonUser).HandleFunc("PUT /user/profile", s.privRest.setUserProfileCtrl)
+		rauth.With(rejectAnonUser).HandleFunc("PUT /ignore/{userid}", s.privRest.setIgnoredCtrl)
 		rauth.With(rejectAnonUser).HandleFunc("POST /deleteme", s.privRest.deleteMeCtrl)
 		rauth.With(rejectAnonUser).HandleFunc("GET /email", s.privRest.getEmailCtrl)
-		rauth.With(rejectAnonUser).HandleFunc("POST /email/subscribe", s.privRest.sendEmailConfirmationCtrl)
+		rauth.With(rejectAnonUser, powCheck(s.PoW, nil)).HandleFunc("POST /email/subscribe", s.privRest.sendEmailConfirmationCtrl)
 		rauth.With(rejectAnonUser).HandleFunc("POST /email/confirm", s.privRest.setConfirmedEmailCtrl)
 		rauth.With(rejectAnonUser).HandleFunc("DELETE /email", s.privRest.deleteEmailCtrl)
 		rauth.With(rejectAnonUser, rejectHead("GET")).HandleFunc("GET /telegram/subscribe", s.privRest.telegramSubscribeCtrl)
 		rauth.With(rejectAnonUser).HandleFunc("DELETE /telegram", s.privRest.deleteTelegramCtrl)
+		rauth.With(rejectAnonUser).HandleFunc("POST /invite/accept", s.privRest.acceptInviteCtrl)
+		rauth.With(rejectAnonUser).HandleFunc("POST /link", s.privRest.linkTokenCtrl)
+		rauth.With(rejectAnonUser).HandleFunc("POST /link/confirm", s.privRest.confirmLinkCtrl)
+		rauth.With(rejectAnonUser).HandleFunc("GET /links", s.privRest.linksCtrl)
+		rauth.With(rejectAnonUser).HandleFunc("DELETE /link/{userid}", s.privRest.unlinkCtrl)
+		rauth.HandleFunc("POST /logout/all", s.privRest.logoutAllCtrl)
 	})
 
 	// protected routes, anonymous rejected
 	rapi.Group().Route(func(rauth *routegroup.Bundle) {
-		rauth.Use(R.Timeout(10 * time.Second))
+		rauth.Use(limitRequest(limits.ImageBody, limits.ImageTimeout), R.Timeout(limits.ImageTimeout))
 		rauth.Use(rateLimiter(s.updateLimiter()))
-		rauth.Use(authMiddleware.Auth, rejectAnonUser, matchSiteID)
+		rauth.Use(authMiddleware.Auth, applyRoles(s.DataService.UserRole), rejectAnonUser, matchSiteID, maintenanceMode(s.Maintenance))
 		rauth.Use(logger.New(logger.Log(log.Default()), logger.Prefix("[DEBUG]"), logger.IPfn(ipFn)).Handler)
 		rauth.HandleFunc("POST /picture", s.privRest.savePictureCtrl)
 	})
@@ -383,20 +551,200 @@ func (s *Rest) routes() http.Handler {
 		rroot.HandleFunc("GET /robots.txt", s.pubRest.robotsCtrl)
 		rroot.With(rejectHead("GET, POST")).HandleFunc("GET /email/unsubscribe.html", s.privRest.emailUnsubscribeCtrl)
 		rroot.HandleFunc("POST /email/unsubscribe.html", s.privRest.emailUnsubscribeCtrl)
+		rroot.With(rejectHead("GET")).HandleFunc("GET /invite.html", s.privRest.invitePageCtrl)
 	})
 
+	// public keys of tokens for other services, see GET /token
+	if s.JWKS != nil {
+		router.With(rateLimiter(50), R.Timeout(10*time.Second)).Handle("GET /.well-known/jwks.json", s.JWKS)
+	}
+
+	// branding assets of sites, managed by admins
+	router.With(rateLimiter(20), R.Timeout(10*time.Second)).HandleFunc("GET /web/custom/{site}/{name}", s.pubRest.assetCtrl)
+
+	// printable pages of threads, for archiving and saving as PDF
+	router.With(rateLimiter(10), R.Timeout(30*time.Second)).HandleFunc("GET /web/print", s.pubRest.printCtrl)
+
+	// subscriptions management page, linked from notification emails
+	router.With(rateLimiter(10), R.Timeout(10*time.Second)).HandleFunc("GET /web/unsubscribe", s.privRest.subscriptionsPageCtrl)
+
 	// file server for static content from s.WebRoot on path /web
 	addFileServer(router, s.WebFS, s.WebRoot, s.Version)
 	return router
 }
 
+// adminRouter makes router of the separate admin server with admin API and optional pprof profiler and metrics.
+// Should be called after routes, as it shares the controllers and token rotation made there.
+func (s *Rest) adminRouter() http.Handler {
+	router := routegroup.New(http.NewServeMux())
+	router.Use(R.Throttle(100), realIPMiddleware(s.TrustedProxies, s.TrustedHeader), R.Recoverer(log.Default()))
+	router.Use(s.TokenRotation.Handler) // re-sign tokens of the previous secret, the same as the public server
+	if !s.DisableSignature {
+		router.Use(R.AppInfo("remark42", "umputun", s.Version))
+	}
+	router.Use(R.Ping)
+
+	ipFn := func(ip string) string { return store.HashValue(ip, s.SharedSecret)[:12] }
+	logInfoWithBody := logger.New(logger.Log(log.Default()), logger.WithBody, logger.IPfn(ipFn), logger.Prefix("[INFO]")).Handler
+	limits := s.Limits.withDefaults()
+	authMiddleware := s.Authenticator.Middleware()
+
+	rapi := router.Mount("/api/v1")
+	rapi.Use(apiCSPMiddleware)
+	rapi.Mount("/admin").Route(s.adminRoutes(authMiddleware.Auth, logInfoWithBody, limitRequest(limits.ImportBody, limits.ImportTimeout)))
+
+	// profiler and runtime metrics expose the whole process, not a site, so they are left to basic auth admin
+	if s.AdminPprof {
+		router.Mount("/debug/pprof").Route(func(r *routegroup.Bundle) {
+			r.Use(rateLimiter(10), authMiddleware.Auth, basicAdminOnly, logInfoWithBody)
+			r.HandleFunc("GET /", pprof.Index)
+			r.HandleFunc("GET /cmdline", pprof.Cmdline)
+			r.HandleFunc("GET /profile", pprof.Profile)
+			r.HandleFunc("GET /symbol", pprof.Symbol)
+			r.HandleFunc("GET /trace", pprof.Trace)
+		})
+		router.With(rateLimiter(10), authMiddleware.Auth, basicAdminOnly).Handle("GET /metrics", expvar.Handler())
+	}
+	return router
+}
+
+// adminRoutes makes admin routes, require auth and admin users only, moderators rejected from site management
+func (s *Rest) adminRoutes(auth, logInfoWithBody, importLimit func(http.Handler) http.Handler) func(radmin *routegroup.Bundle) {
+	return func(radmin *routegroup.Bundle) {
+		radmin.Use(rateLimiter(10))
+		radmin.Use(adminCertAuth(s.AdminCert, auth), applyRoles(s.DataService.UserRole), adminOnly, matchSiteID)
+		radmin.Use(R.NoCache, logInfoWithBody)
+
+		// totp enrollment and verification allowed before totp step-up required from the rest of admin routes
+		radmin.Group().Route(func(r *routegroup.Bundle) {
+			r.Use(R.Timeout(30 * time.Second))
+			r.HandleFunc("POST /totp/enroll", s.adminRest.enrollTOTPCtrl)
+			r.With(userLimiter(5)).HandleFunc("POST /totp/verify", s.adminRest.verifyTOTPCtrl)
+		})
+		radmin = radmin.With(s.adminRest.totpStepUp)
+
+		// bounded admin operations return small responses and get the enforcing request timeout
+		radmin.Group().Route(func(r *routegroup.Bundle) {
+			r.Use(R.Timeout(30 * time.Second))
+			r.HandleFunc("DELETE /comment/{id}", s.adminRest.deleteCommentCtrl)
+			r.With(rejectModerator).HandleFunc("POST /comment/import", s.adminRest.importCommentCtrl)
+			r.HandleFunc("PUT /user/{userid}", s.adminRest.setBlockCtrl)
+			r.HandleFunc("DELETE /user/{userid}", s.adminRest.deleteUserCtrl)
+			r.HandleFunc("GET /user/{userid}", s.adminRest.getUserInfoCtrl)
+			r.HandleFunc("DELETE /user/{userid}/profile", s.adminRest.resetUserProfileCtrl)
+			r.With(rejectModerator).HandleFunc("POST /user/{userid}/merge", s.adminRest.mergeUserCtrl)
+			r.With(rejectModerator).HandleFunc("POST /user/{userid}/logout", s.adminRest.logoutUserCtrl)
+			r.With(rejectModerator, rejectHead("GET")).HandleFunc("GET /deleteme", s.adminRest.deleteMeRequestCtrl)
+			r.HandleFunc("PUT /verify/{userid}", s.adminRest.setVerifyCtrl)
+			r.HandleFunc("PUT /pin/{id}", s.adminRest.setPinCtrl)
+			r.HandleFunc("PUT /approve/{id}", s.adminRest.approveCommentCtrl)
+			r.HandleFunc("GET /pending", s.adminRest.pendingCtrl)
+			r.HandleFunc("GET /edit-policy", s.adminRest.getEditPolicyCtrl)
+			r.With(rejectModerator).HandleFunc("PUT /edit-policy", s.adminRest.setEditPolicyCtrl)
+			r.With(rejectModerator).HandleFunc("DELETE /edit-policy", s.adminRest.resetEditPolicyCtrl)
+			r.HandleFunc("GET /collapse-policy", s.adminRest.getCollapsePolicyCtrl)
+			r.With(rejectModerator).HandleFunc("PUT /collapse-policy", s.adminRest.setCollapsePolicyCtrl)
+			r.With(rejectModerator).HandleFunc("DELETE /collapse-policy", s.adminRest.resetCollapsePolicyCtrl)
+			r.HandleFunc("GET /expr-policy", s.adminRest.getExprPolicyCtrl)
+			r.HandleFunc("GET /events", s.adminRest.eventsCtrl)
+			r.With(rejectModerator).HandleFunc("PUT /expr-policy", s.adminRest.setExprPolicyCtrl)
+			r.With(rejectModerator).HandleFunc("DELETE /expr-policy", s.adminRest.resetExprPolicyCtrl)
+			r.With(rejectModerator).HandleFunc("POST /invite", s.adminRest.createInviteCtrl)
+			r.With(rejectModerator).HandleFunc("GET /invites", s.adminRest.listInvitesCtrl)
+			r.With(rejectModerator).HandleFunc("DELETE /invite/{id}", s.adminRest.deleteInviteCtrl)
+			r.With(rejectModerator).HandleFunc("GET /grants", s.adminRest.listGrantsCtrl)
+			r.With(rejectModerator).HandleFunc("DELETE /grant/{userid}", s.adminRest.revokeGrantCtrl)
+			r.With(rejectModerator).HandleFunc("POST /bot", s.adminRest.createBotCtrl)
+			r.With(rejectModerator).HandleFunc("GET /bots", s.adminRest.listBotsCtrl)
+			r.With(rejectModerator).HandleFunc("DELETE /bot/{id}", s.adminRest.deleteBotCtrl)
+			r.With(rejectModerator).HandleFunc("GET /roles", s.adminRest.listRolesCtrl)
+			r.With(rejectModerator).HandleFunc("PUT /role/{userid}", s.adminRest.setRoleCtrl)
+			r.With(rejectModerator).HandleFunc("DELETE /role/{userid}", s.adminRest.deleteRoleCtrl)
+			r.HandleFunc("POST /schedule", s.adminRest.scheduleActionCtrl)
+			r.HandleFunc("GET /schedule", s.adminRest.listScheduledCtrl)
+			r.HandleFunc("DELETE /schedule/{id}", s.adminRest.cancelScheduledCtrl)
+			r.HandleFunc("GET /quota", s.adminRest.getQuotaCtrl)
+			r.With(rejectModerator).HandleFunc("PUT /quota", s.adminRest.setQuotaCtrl)
+			r.With(rejectModerator).HandleFunc("DELETE /quota", s.adminRest.resetQuotaCtrl)
+			r.HandleFunc("GET /canned", s.adminRest.listCannedCtrl)
+			r.With(rejectModerator).HandleFunc("PUT /canned/{id}", s.adminRest.setCannedCtrl)
+			r.With(rejectModerator).HandleFunc("DELETE /canned/{id}", s.adminRest.deleteCannedCtrl)
+			r.HandleFunc("POST /canned/{id}/reply", s.adminRest.replyCannedCtrl)
+			r.HandleFunc("PUT /poll", s.adminRest.setPollCtrl)
+			r.HandleFunc("DELETE /poll", s.adminRest.deletePollCtrl)
+			r.HandleFunc("PUT /highlight/{id}", s.adminRest.setHighlightCtrl)
+			r.HandleFunc("GET /stats", s.adminRest.clientStatsCtrl)
+			r.HandleFunc("GET /blocked", s.adminRest.blockedUsersCtrl)
+			r.HandleFunc("GET /users", s.adminRest.usersCtrl)
+			r.HandleFunc("GET /users/{userid}", s.adminRest.userSummaryCtrl)
+			r.With(rejectModerator).HandleFunc("POST /reencrypt", s.adminRest.reencryptCtrl)
+			r.With(rejectModerator).HandleFunc("POST /reindex", s.adminRest.startReindexCtrl)
+			r.HandleFunc("GET /reindex", s.adminRest.reindexStatusCtrl)
+			r.With(rejectModerator).HandleFunc("POST /rerender", s.adminRest.startRerenderCtrl)
+			r.HandleFunc("GET /rerender", s.adminRest.rerenderStatusCtrl)
+			r.With(rejectModerator).HandleFunc("POST /integrity", s.adminRest.checkIntegrityCtrl)
+			r.HandleFunc("GET /integrity", s.adminRest.integrityReportCtrl)
+			r.HandleFunc("GET /moderation/export", s.adminRest.exportModeratedCtrl)
+			r.With(rejectModerator).HandleFunc("POST /moderation/import", s.adminRest.importModeratedCtrl)
+			r.HandleFunc("PUT /readonly", s.adminRest.setReadOnlyCtrl)
+			r.HandleFunc("GET /maintenance", s.adminRest.getMaintenanceCtrl)
+			r.With(rejectModerator).HandleFunc("PUT /maintenance", s.adminRest.setMaintenanceCtrl)
+			r.HandleFunc("GET /shadow", s.adminRest.shadowReportCtrl)
+			r.HandleFunc("GET /controversial", s.adminRest.controversialCtrl)
+			r.HandleFunc("GET /brigades", s.adminRest.brigadesCtrl)
+			r.HandleFunc("POST /brigades/{id}/void", s.adminRest.voidBrigadeCtrl)
+			r.HandleFunc("DELETE /brigades/{id}", s.adminRest.dismissBrigadeCtrl)
+			r.HandleFunc("GET /csp-reports", s.adminRest.cspReportsCtrl)
+			r.With(rejectModerator).HandleFunc("GET /email/suppressions", s.adminRest.emailSuppressionsCtrl)
+			r.With(rejectModerator).HandleFunc("DELETE /email/suppression", s.adminRest.reinstateEmailCtrl)
+			r.HandleFunc("GET /notify/deliveries", s.adminRest.notifyDeliveriesCtrl)
+			r.HandleFunc("POST /notify/deliveries/{id}/resend", s.adminRest.resendDeliveryCtrl)
+			r.HandleFunc("GET /cors", s.adminRest.getCORSCtrl)
+			r.With(rejectModerator).HandleFunc("PUT /cors", s.adminRest.setCORSCtrl)
+			r.With(rejectModerator).HandleFunc("DELETE /cors", s.adminRest.resetCORSCtrl)
+			r.HandleFunc("GET /remotes", s.adminRest.remotesCtrl)
+			r.HandleFunc("GET /assets", s.adminRest.listAssetsCtrl)
+			r.With(rejectModerator).HandleFunc("PUT /asset/{name}", s.adminRest.saveAssetCtrl)
+			r.With(rejectModerator).HandleFunc("DELETE /asset/{name}", s.adminRest.deleteAssetCtrl)
+			r.With(rejectModerator).HandleFunc("POST /archive", s.adminRest.archiveThreadCtrl)
+			r.HandleFunc("GET /cold", s.adminRest.listColdCtrl)
+			r.With(rejectModerator).HandleFunc("POST /cold/freeze", s.adminRest.freezeCtrl)
+			r.With(rejectModerator).HandleFunc("POST /cold/thaw", s.adminRest.thawCtrl)
+			r.HandleFunc("GET /pages", s.adminRest.listPagesCtrl)
+			r.With(rejectModerator).HandleFunc("PUT /page/sort", s.adminRest.setPageSortCtrl)
+			r.With(rejectModerator).HandleFunc("DELETE /page/sort", s.adminRest.deletePageSortCtrl)
+			r.With(rejectModerator).HandleFunc("PUT /page/live", s.adminRest.setPageLiveCtrl)
+			r.With(rejectModerator).HandleFunc("DELETE /page/live", s.adminRest.deletePageLiveCtrl)
+			r.With(rejectModerator).HandleFunc("PUT /page/registered", s.adminRest.setPageRegisteredCtrl)
+			r.With(rejectModerator).HandleFunc("DELETE /page/registered", s.adminRest.deletePageRegisteredCtrl)
+			r.HandleFunc("PUT /title/{id}", s.adminRest.setTitleCtrl)
+			r.With(rejectModerator).HandleFunc("DELETE /totp/{userid}", s.adminRest.deleteTOTPCtrl)
+		})
+
+		// migrator routes deliberately run without R.Timeout: GET /export streams a full-site
+		// backup, GET /wait long-polls for up to 15m, and import/remap ingest large uploads. The
+		// enforcing timeout buffers the whole response and aborts at the deadline, which would
+		// truncate backups, break waiting, and reject large imports.
+		radmin.With(rejectModerator).HandleFunc("GET /export", s.adminRest.migrator.exportCtrl)
+		radmin.With(rejectModerator, importLimit).HandleFunc("POST /import", s.adminRest.migrator.importCtrl)
+		radmin.With(rejectModerator, importLimit).HandleFunc("POST /import/form", s.adminRest.migrator.importFormCtrl)
+		radmin.With(rejectModerator, importLimit).HandleFunc("POST /remap", s.adminRest.migrator.remapCtrl)
+		radmin.With(rejectModerator).HandleFunc("GET /wait", s.adminRest.migrator.waitCtrl)
+	}
+}
+
 func (s *Rest) controllerGroups() (public, private, admin, rss) {
+	live := newLiveHub() // shared by streams of public group and comments created by private group
+
 	pubGrp := public{
 		dataService:      s.DataService,
 		cache:            s.Cache,
+		cdnMaxAge:        s.CDNMaxAge,
 		imageService:     s.ImageService,
 		commentFormatter: s.CommentFormatter,
 		readOnlyAge:      s.ReadOnlyAge,
+		publishBlocklist: s.PublishBlocklist,
+		live:             live,
 	}
 
 	privGrp := private{
@@ -406,24 +754,43 @@ func (s *Rest) controllerGroups() (public, private, admin, rss) {
 		commentFormatter:           s.CommentFormatter,
 		readOnlyAge:                s.ReadOnlyAge,
 		authenticator:              s.Authenticator,
+		tokens:                     s.TokenRotation,
 		notifyService:              s.NotifyService,
+		plugins:                    s.Plugins,
 		telegramService:            s.TelegramService,
 		remarkURL:                  s.RemarkURL,
 		anonVote:                   s.AnonVote,
+		subscribersOnly:            s.SubscribersOnly,
 		disableFancyTextFormatting: s.DisableFancyTextFormatting,
+		live:                       live,
 	}
 
 	admGrp := admin{
-		dataService:   s.DataService,
-		migrator:      s.Migrator,
-		cache:         s.Cache,
-		authenticator: s.Authenticator,
-		readOnlyAge:   s.ReadOnlyAge,
+		dataService:      s.DataService,
+		migrator:         s.Migrator,
+		cache:            s.Cache,
+		authenticator:    s.Authenticator,
+		tokens:           s.TokenRotation,
+		readOnlyAge:      s.ReadOnlyAge,
+		commentFormatter: s.CommentFormatter,
+		notifyService:    s.NotifyService,
+		maintenance:      s.Maintenance,
+		shadow:           s.Shadow,
+		cspReports:       s.CSPReports,
+		cors:             s.CORS,
+		remotes:          s.Remotes,
+		remarkURL:        s.RemarkURL,
+		totp:             s.AdminTOTP,
+		adminCert:        s.AdminCert,
+		sharedSecret:     s.SharedSecret,
+
+		disableFancyTextFormatting: s.DisableFancyTextFormatting,
 	}
 
 	rssGrp := rss{
 		dataService: s.DataService,
 		cache:       s.Cache,
+		cdnMaxAge:   s.CDNMaxAge,
 	}
 
 	return pubGrp, privGrp, admGrp, rssGrp
@@ -438,44 +805,116 @@ func (s *Rest) updateLimiter() float64 {
 	return lmt
 }
 
-// GET /config?site=siteID - returns configuration
+// needsChallenge checks if comment request made by anonymous user or from ip with bad reputation,
+// if site's policy requires proof-of-work for such ips
+func (s *Rest) needsChallenge(r *http.Request) bool {
+	if isAnonUserRequest(r) {
+		return true
+	}
+	user, err := rest.GetUserInfo(r)
+	if err != nil || user.Admin {
+		return false
+	}
+	return s.DataService.NeedsChallenge(user.SiteID, extractIP(r.RemoteAddr))
+}
+
+// needsLoginChallenge checks if login request requires proof-of-work, email login sending confirmation email always does,
+// anonymous login does with AnonLoginPoW enabled, so the challenge is solved before the token minted
+func (s *Rest) needsLoginChallenge(r *http.Request) bool {
+	return isEmailLoginRequest(r) || (s.AnonLoginPoW && r.URL.Path == "/auth/anonymous/login")
+}
+
+// needsLoginCaptcha checks if login request requires captcha, anonymous login does with AnonCaptcha enabled
+func (s *Rest) needsLoginCaptcha(r *http.Request) bool {
+	return s.AnonCaptcha && r.URL.Path == "/auth/anonymous/login"
+}
+
+// needsCommentCaptcha checks if comment request requires captcha, the first comment of the user on the site does
+// with NewUserCaptcha enabled. Admins and bots are never asked.
+func (s *Rest) needsCommentCaptcha(r *http.Request) bool {
+	if !s.NewUserCaptcha {
+		return false
+	}
+	user, err := rest.GetUserInfo(r)
+	if err != nil || user.Admin || user.Bot {
+		return false
+	}
+	// engine reports user without comments as an error
+	count, err := s.DataService.UserCount(r.URL.Query().Get("site"), user.ID)
+	return err != nil || count == 0
+}
+
+// GET /config?site=siteID&url=post-url - returns configuration, with settings of the post if url set
 func (s *Rest) configCtrl(w http.ResponseWriter, r *http.Request) {
 	siteID := r.URL.Query().Get("site")
 
-	admins, _ := s.DataService.AdminStore.Admins(siteID)
+	admins, _ := s.DataService.Admins(siteID)
 	emails, _ := s.DataService.AdminStore.Email(siteID)
+	editPolicy := s.DataService.SiteEditPolicy(siteID)
+	contentPolicy := s.DataService.SiteContentPolicy(siteID)
 
 	cnf := struct {
-		Version               string   `json:"version"`
-		EditDuration          int      `json:"edit_duration"`
-		AdminEdit             bool     `json:"admin_edit"`
-		MinCommentSize        int      `json:"min_comment_size"`
-		MaxCommentSize        int      `json:"max_comment_size"`
-		Admins                []string `json:"admins"`
-		AdminEmail            string   `json:"admin_email"`
-		Auth                  []string `json:"auth_providers"`
-		AnonVote              bool     `json:"anon_vote"`
-		LowScore              int      `json:"low_score"`
-		CriticalScore         int      `json:"critical_score"`
-		PositiveScore         bool     `json:"positive_score"`
-		ReadOnlyAge           int      `json:"readonly_age"`
-		MaxImageSize          int      `json:"max_image_size"`
-		EmailNotifications    bool     `json:"email_notifications"`
-		TelegramNotifications bool     `json:"telegram_notifications"`
-		EmojiEnabled          bool     `json:"emoji_enabled"`
-		SimpleView            bool     `json:"simple_view"`
-		SendJWTHeader         bool     `json:"send_jwt_header"`
-		SubscribersOnly       bool     `json:"subscribers_only"`
+		Version               string         `json:"version"`
+		EditDuration          int            `json:"edit_duration"`
+		EditPolicy            editPolicyInfo `json:"edit_policy"`
+		CollapsePolicy        collapseInfo   `json:"collapse_policy"`
+		AuthorDelete          string         `json:"author_delete"`
+		AdminEdit             bool           `json:"admin_edit"`
+		MinCommentSize        int            `json:"min_comment_size"`
+		MaxCommentSize        int            `json:"max_comment_size"`
+		MaxLinks              int            `json:"max_links"`
+		MaxImages             int            `json:"max_images"`
+		MaxQuoteRatio         float64        `json:"max_quote_ratio"`
+		NewMemberBadge        bool           `json:"new_member_badge"`
+		Timezone              string         `json:"timezone"`
+		PoWDifficulty         int            `json:"pow_difficulty"`
+		PoWAnonLogin          bool           `json:"pow_anon_login"`             // anonymous login requires proof-of-work
+		CaptchaType           string         `json:"captcha_type,omitempty"`     // turnstile or hcaptcha, if captcha enabled
+		CaptchaSiteKey        string         `json:"captcha_site_key,omitempty"` // public key of the captcha widget
+		CaptchaAnonLogin      bool           `json:"captcha_anon_login"`         // anonymous login requires captcha
+		CaptchaNewUser        bool           `json:"captcha_new_user"`           // first comment of the user requires captcha
+		Admins                []string       `json:"admins"`
+		AdminEmail            string         `json:"admin_email"`
+		Auth                  []string       `json:"auth_providers"`
+		AnonAllowed           bool           `json:"anon_allowed"`
+		AnonVote              bool           `json:"anon_vote"`
+		LowScore              int            `json:"low_score"`
+		CriticalScore         int            `json:"critical_score"`
+		ControversyScore      float64        `json:"controversy_score"`
+		PositiveScore         bool           `json:"positive_score"`
+		ReadOnlyAge           int            `json:"readonly_age"`
+		MaxImageSize          int            `json:"max_image_size"`
+		EmailNotifications    bool           `json:"email_notifications"`
+		TelegramNotifications bool           `json:"telegram_notifications"`
+		EmojiEnabled          bool           `json:"emoji_enabled"`
+		SimpleView            bool           `json:"simple_view"`
+		SendJWTHeader         bool           `json:"send_jwt_header"`
+		SubscribersOnly       bool           `json:"subscribers_only"`
+		ProfileEnabled        bool           `json:"profile_enabled"`
+		Languages             []string       `json:"languages"`             // allowed comment languages, empty if any
+		Maintenance           string         `json:"maintenance,omitempty"` // message of read-only maintenance mode, if enabled
+		CustomCSS             string         `json:"custom_css,omitempty"`  // url of site's custom.css asset, if uploaded
+		Sort                  string         `json:"sort,omitempty"`        // order of comments pinned for the post, if url set
+		Live                  bool           `json:"live,omitempty"`        // live-blog mode of the post, if url set
 	}{
 		Version:               s.Version,
-		EditDuration:          int(s.DataService.EditDuration.Seconds()),
+		EditDuration:          int(editPolicy.Duration.Seconds()),
+		EditPolicy:            newEditPolicyInfo(editPolicy),
+		CollapsePolicy:        newCollapseInfo(s.DataService.SiteCollapsePolicy(siteID)),
+		AuthorDelete:          string(s.DataService.SiteAuthorDeleteMode(siteID)),
 		AdminEdit:             s.DataService.AdminEdits,
-		MinCommentSize:        s.DataService.MinCommentSize,
-		MaxCommentSize:        s.DataService.MaxCommentSize,
+		MinCommentSize:        contentPolicy.MinLength,
+		MaxCommentSize:        contentPolicy.MaxLength,
+		MaxLinks:              contentPolicy.MaxLinks,
+		MaxImages:             contentPolicy.MaxImages,
+		MaxQuoteRatio:         contentPolicy.MaxQuoteRatio,
+		NewMemberBadge:        s.DataService.SiteWelcomePolicy(siteID).Enabled,
+		Timezone:              s.DataService.SiteLocation(siteID).String(),
 		Admins:                admins,
 		AdminEmail:            emails,
 		LowScore:              s.ScoreThresholds.Low,
 		CriticalScore:         s.ScoreThresholds.Critical,
+		ControversyScore:      s.ScoreThresholds.Controversy,
 		PositiveScore:         s.DataService.PositiveScore,
 		ReadOnlyAge:           s.ReadOnlyAge,
 		MaxImageSize:          s.ImageService.MaxSize,
@@ -488,9 +927,44 @@ func (s *Rest) configCtrl(w http.ResponseWriter, r *http.Request) {
 		SubscribersOnly:       s.SubscribersOnly,
 	}
 
+	if s.PoW != nil {
+		cnf.PoWDifficulty = s.PoW.Difficulty()
+		cnf.PoWAnonLogin = s.AnonLoginPoW
+	}
+	if s.Captcha != nil {
+		cnf.CaptchaType, cnf.CaptchaSiteKey = s.Captcha.Type, s.Captcha.SiteKey
+		cnf.CaptchaAnonLogin, cnf.CaptchaNewUser = s.AnonCaptcha, s.NewUserCaptcha
+	}
+	if status, ok := s.Maintenance.Active(siteID); ok {
+		cnf.Maintenance = status.Message
+	}
+	if postURL := r.URL.Query().Get("url"); postURL != "" {
+		settings := s.DataService.PageSettings(store.Locator{SiteID: siteID, URL: postURL})
+		cnf.Sort, cnf.Live = settings.Sort, settings.Live
+	}
+	if css, err := s.DataService.AssetInfo(siteID, "custom.css"); err == nil {
+		cnf.CustomCSS = fmt.Sprintf("%s/web/custom/%s/custom.css?v=%.8s", s.RemarkURL, url.PathEscape(siteID), css.Hash)
+	}
+
 	cnf.Auth = []string{}
 	for _, ap := range s.Authenticator.Providers() {
 		cnf.Auth = append(cnf.Auth, ap.Name())
+		if ap.Name() == "anonymous" {
+			cnf.AnonAllowed = true
+		}
+	}
+
+	if s.DataService.ProfilePolicy != nil {
+		if policy, err := s.DataService.ProfilePolicy.Policy(siteID); err == nil {
+			cnf.ProfileEnabled = policy.Enabled
+		}
+	}
+
+	cnf.Languages = []string{}
+	if s.DataService.LanguagePolicy != nil {
+		if policy, err := s.DataService.LanguagePolicy.Policy(siteID); err == nil && len(policy.Allowed) > 0 {
+			cnf.Languages = policy.Allowed
+		}
 	}
 
 	if cnf.Admins == nil { // prevent json serialization to nil
@@ -499,6 +973,163 @@ func (s *Rest) configCtrl(w http.ResponseWriter, r *http.Request) {
 	R.RenderJSON(w, cnf)
 }
 
+// POST /csp-report - collects Content-Security-Policy violation reports sent by browsers
+func (s *Rest) cspReportCtrl(w http.ResponseWriter, r *http.Request) {
+	if s.CSPReports == nil {
+		rest.SendErrorJSON(w, r, http.StatusNotFound, errors.New("csp reports disabled"), "csp reports collection is not enabled", rest.ErrActionRejected)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, hardBodyLimit))
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't read csp report", rest.ErrDecode)
+		return
+	}
+	n, err := s.CSPReports.Add(body)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't parse csp report", rest.ErrDecode)
+		return
+	}
+	log.Printf("[DEBUG] collected %d csp violation reports", n)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// EmailEvents configures webhook receiving bounces and complaints from the email provider
+type EmailEvents struct {
+	Provider string       // email provider, one of notify.EmailProvider* constants
+	Secret   string       // secret passed as "secret" query parameter of the webhook, webhook disabled if not set
+	Sites    []string     // sites to unsubscribe reported addresses from
+	Client   *http.Client // client confirming SES subscription of SNS topic, 10s timeout if not set
+}
+
+const maxEmailEventsBody = 1024 * 1024 // batches of events can be large
+
+// POST /email/events/{provider}?secret=secret - webhook of the email provider reporting permanent bounces
+// and spam complaints. Reported addresses are suppressed, or their email subscriptions are removed on all sites
+// if suppression is not enabled.
+func (s *Rest) emailEventsCtrl(w http.ResponseWriter, r *http.Request) {
+	provider := r.PathValue("provider")
+	if s.EmailEvents.Secret == "" || provider != s.EmailEvents.Provider {
+		rest.SendErrorJSON(w, r, http.StatusNotFound, errors.New("email events disabled"),
+			"email events webhook is not enabled for "+provider, rest.ErrActionRejected)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("secret")), []byte(s.EmailEvents.Secret)) != 1 {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, errors.New("bad secret"), "can't accept email events", rest.ErrActionRejected)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxEmailEventsBody))
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't read email events", rest.ErrDecode)
+		return
+	}
+	events, confirmURL, err := notify.ParseEmailEvents(provider, body)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't parse email events", rest.ErrDecode)
+		return
+	}
+
+	if confirmURL != "" {
+		if err = s.confirmEmailEvents(r.Context(), confirmURL); err != nil {
+			rest.SendErrorJSON(w, r, http.StatusBadGateway, err, "can't confirm subscription", rest.ErrInternal)
+			return
+		}
+		log.Printf("[INFO] confirmed subscription to %s events", provider)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	suppressed, unsubscribed := 0, 0
+	for _, event := range events {
+		if s.DataService.SuppressStore != nil {
+			if _, e := s.DataService.SuppressEmail(event.Address, event.Kind, provider); e != nil {
+				log.Printf("[WARN] can't suppress reported address, %v", e)
+				continue
+			}
+			suppressed++
+			continue
+		}
+		for _, siteID := range s.EmailEvents.Sites {
+			users, e := s.DataService.UnsubscribeEmail(siteID, event.Address)
+			if e != nil {
+				log.Printf("[WARN] can't unsubscribe reported address on %s, %v", siteID, e)
+			}
+			unsubscribed += len(users)
+		}
+	}
+	if len(events) > 0 {
+		log.Printf("[INFO] %s reported %d bounces and complaints, %d addresses suppressed, %d users unsubscribed",
+			provider, len(events), suppressed, unsubscribed)
+	}
+	R.RenderJSON(w, R.JSON{"events": len(events), "suppressed": suppressed, "unsubscribed": unsubscribed})
+}
+
+// confirmEmailEvents confirms subscription to the events, like SES notifications of SNS topic
+func (s *Rest) confirmEmailEvents(ctx context.Context, confirmURL string) error {
+	client := s.EmailEvents.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, confirmURL, http.NoBody)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck // read-only body
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("confirmation responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// POST /anon/device - issues signed device identity. Client keeps it and passes to anonymous login as "device" param
+// to keep the same anonymous user across logins and IP changes
+func (s *Rest) anonDeviceCtrl(w http.ResponseWriter, r *http.Request) {
+	tkn, err := rest.MakeDeviceToken(s.SharedSecret)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't make device identity", rest.ErrInternal)
+		return
+	}
+	R.RenderJSON(w, R.JSON{"device": tkn})
+}
+
+// GET /token?site=siteID - issues token of the current user signed with the asymmetric key, for other services
+// validating it with public keys from /.well-known/jwks.json
+func (s *Rest) serviceTokenCtrl(w http.ResponseWriter, r *http.Request) {
+	if s.JWKS == nil {
+		rest.SendErrorJSON(w, r, http.StatusNotFound, errors.New("asymmetric tokens disabled"), "no token", rest.ErrActionRejected)
+		return
+	}
+	user, err := token.GetUserInfo(r)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusUnauthorized, err, "can't get user info", rest.ErrNoAccess)
+		return
+	}
+	tkn, expires, err := s.JWKS.Token(user, r.URL.Query().Get("site"))
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't make token", rest.ErrInternal)
+		return
+	}
+	R.RenderJSON(w, R.JSON{"token": tkn, "expires": expires})
+}
+
+// GET /pow - issues proof-of-work challenge, solution required for anonymous comments and verification emails.
+// Client finds solution making sha256(challenge + ":" + solution) start with difficulty zero bits.
+func (s *Rest) powChallengeCtrl(w http.ResponseWriter, r *http.Request) {
+	if s.PoW == nil {
+		rest.SendErrorJSON(w, r, http.StatusNotFound, errors.New("proof-of-work disabled"), "no challenge", rest.ErrActionRejected)
+		return
+	}
+	challenge, err := s.PoW.Challenge()
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't make challenge", rest.ErrInternal)
+		return
+	}
+	R.RenderJSON(w, R.JSON{"challenge": challenge, "difficulty": s.PoW.Difficulty()})
+}
+
 // serves static files from the webRoot directory or files embedded into the compiled binary if that directory is absent
 func addFileServer(r *routegroup.Bundle, embedFS embed.FS, webRoot, version string) {
 	var webFS http.Handler
@@ -574,6 +1205,20 @@ func URLKeyWithUser(r *http.Request) string {
 	return key
 }
 
+// setCDNHeaders allows CDN to keep the response of anonymous read request for maxAge, tagged with the site scopes
+// of the cached response, so the response purged from CDN with the same scopes flushed from the cache.
+// Responses of authenticated users are never kept by CDN.
+func setCDNHeaders(w http.ResponseWriter, r *http.Request, maxAge time.Duration, siteID string, scopes ...string) {
+	if maxAge <= 0 {
+		return
+	}
+	if _, err := rest.GetUserInfo(r); err == nil {
+		return
+	}
+	cdn.SetHeaders(w, maxAge, siteID, scopes...)
+	w.Header().Set("Vary", "Authorization, Cookie, X-JWT")
+}
+
 func parseError(err error, defaultCode int) (code int) {
 	code = defaultCode
 
@@ -597,3 +1242,25 @@ func parseError(err error, defaultCode int) (code int) {
 
 	return code
 }
+
+// validationErrorCode returns error code for comment validation error, with content policy violations
+// reported by dedicated codes for UI to show localized limit messages
+func validationErrorCode(err error) int {
+	var contentErr *service.ContentError
+	if !errors.As(err, &contentErr) {
+		return rest.ErrCommentValidation
+	}
+	switch contentErr.Violation {
+	case service.ContentTooShort:
+		return rest.ErrCommentTooShort
+	case service.ContentTooLong:
+		return rest.ErrCommentTooLong
+	case service.ContentTooManyLinks:
+		return rest.ErrCommentTooManyLinks
+	case service.ContentTooManyImages:
+		return rest.ErrCommentTooManyImages
+	case service.ContentTooMuchQuote:
+		return rest.ErrCommentTooMuchQuote
+	}
+	return rest.ErrCommentValidation
+}
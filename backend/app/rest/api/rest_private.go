@@ -3,6 +3,7 @@ package api
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"crypto/rand"
 	"crypto/sha1" //nolint:gosec //not used for security
 	"encoding/json"
@@ -12,21 +13,28 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/go-pkgz/auth/v2"
 	"github.com/go-pkgz/auth/v2/token"
-	cache "github.com/go-pkgz/lcw/v2"
 	log "github.com/go-pkgz/lgr"
 	R "github.com/go-pkgz/rest"
 	"github.com/golang-jwt/jwt/v5"
 
 	"github.com/umputun/remark42/backend/app/notify"
+	"github.com/umputun/remark42/backend/app/plugin"
 	"github.com/umputun/remark42/backend/app/rest"
+	"github.com/umputun/remark42/backend/app/rest/cdn"
 	"github.com/umputun/remark42/backend/app/store"
 	"github.com/umputun/remark42/backend/app/store/engine"
 	"github.com/umputun/remark42/backend/app/store/image"
+	"github.com/umputun/remark42/backend/app/store/invite"
+	"github.com/umputun/remark42/backend/app/store/page"
+	"github.com/umputun/remark42/backend/app/store/poll"
 	"github.com/umputun/remark42/backend/app/store/service"
 	"github.com/umputun/remark42/backend/app/templates"
 )
@@ -38,11 +46,15 @@ type private struct {
 	commentFormatter           *store.CommentFormatter
 	imageService               *image.Service
 	notifyService              *notify.Service
+	plugins                    *plugin.Manager
 	authenticator              *auth.Service
+	tokens                     *rest.TokenRotation
 	telegramService            telegramService
 	remarkURL                  string
 	anonVote                   bool
+	subscribersOnly            bool
 	disableFancyTextFormatting bool // disables SmartyPants in the comment text rendering of the posted comments
+	live                       *liveHub
 }
 
 // telegramService is a subset of Telegram service used for setting up user telegram notifications
@@ -57,17 +69,39 @@ type privStore interface {
 	EditComment(locator store.Locator, commentID string, req service.EditRequest) (comment store.Comment, err error)
 	Vote(req service.VoteReq) (comment store.Comment, err error)
 	Get(locator store.Locator, commentID string, user store.User) (store.Comment, error)
+	PageSettings(locator store.Locator) page.Settings
+	Find(locator store.Locator, sortMethod string, user store.User) ([]store.Comment, error)
+	EditTimeLeft(comment store.Comment, admin bool) (left time.Duration, ok bool)
 	User(siteID, userID string, limit, skip int, user store.User) ([]store.Comment, error)
 	GetUserEmail(siteID, userID string) (string, error)
 	SetUserEmail(siteID, userID, value string) (string, error)
+	EmailToken(email string) string
 	GetUserTelegram(siteID, userID string) (string, error)
 	SetUserTelegram(siteID, userID, value string) (string, error)
 	DeleteUserDetail(siteID, userID string, detail engine.UserDetail) error
+	GetUserProfile(siteID, userID string) (service.UserProfile, error)
+	SetUserProfile(siteID, userID string, profile service.UserProfile) (service.UserProfile, error)
+	IgnoredUsers(siteID, userID string) ([]string, error)
+	SetIgnored(siteID, userID, ignoredID string, status bool) error
 	ValidateComment(c *store.Comment) error
+	WelcomeMessage(c store.Comment) (string, error)
+	RecordClient(siteID string, info service.ClientInfo)
+	SuppressLateNotify(c store.Comment) bool
+	NotifyDestinations(c store.Comment) ([]string, error)
+	VotePoll(locator store.Locator, user store.User, option int) (poll.Results, error)
 	IsVerified(siteID, userID string) bool
+	UserLevel(siteID, userID string) store.UserLevel
 	IsReadOnly(locator store.Locator) bool
 	IsBlocked(siteID, userID string) bool
 	Info(locator store.Locator, readonlyAge int) (store.PostInfo, error)
+	Invite(id string) (invite.Invitation, error)
+	AcceptInvite(id, userID string) ([]invite.Grant, error)
+	UserRole(siteID, userID string) string
+	LinkedUser(siteID, userID string) (string, error)
+	LinkedUsers(siteID, userID string) ([]string, error)
+	LinkUser(siteID, userID, canonicalID string) error
+	UnlinkUser(siteID, userID string) error
+	RevokeTokens(siteID, userID string) (time.Time, error)
 }
 
 // POST /preview, body is a comment, returns rendered html
@@ -75,19 +109,25 @@ func (s *private) previewCommentCtrl(w http.ResponseWriter, r *http.Request) {
 	user := rest.MustGetUserInfo(r)
 
 	comment := store.Comment{}
-	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, hardBodyLimit)).Decode(&comment); err != nil {
+	if err := json.NewDecoder(r.Body).Decode(&comment); err != nil {
 		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't bind comment", rest.ErrDecode)
 		return
 	}
 
 	comment.User = user
+	text, err := s.plugins.PreSave(r.Context(), pluginComment(comment))
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "comment rejected", rest.ErrCommentRejected)
+		return
+	}
+	comment.Text = text
 	comment.Orig = comment.Text
 	if err := s.dataService.ValidateComment(&comment); err != nil {
-		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "invalid comment", rest.ErrCommentValidation)
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "invalid comment", validationErrorCode(err))
 		return
 	}
 
-	comment = s.commentFormatter.Format(comment, s.disableFancyTextFormatting)
+	comment = s.render(r.Context(), comment)
 	comment.Sanitize()
 
 	// check if images are valid, omit proxied images as they are lazy-loaded
@@ -104,7 +144,7 @@ func (s *private) previewCommentCtrl(w http.ResponseWriter, r *http.Request) {
 // POST /comment - adds comment, resets all immutable fields
 func (s *private) createCommentCtrl(w http.ResponseWriter, r *http.Request) {
 	comment := store.Comment{}
-	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, hardBodyLimit)).Decode(&comment); err != nil {
+	if err := json.NewDecoder(r.Body).Decode(&comment); err != nil {
 		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't bind comment", rest.ErrDecode)
 		return
 	}
@@ -121,12 +161,18 @@ func (s *private) createCommentCtrl(w http.ResponseWriter, r *http.Request) {
 	comment.User = user
 	comment.User.IP = extractIP(r.RemoteAddr)
 
+	text, err := s.plugins.PreSave(r.Context(), pluginComment(comment))
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "comment rejected", rest.ErrCommentRejected)
+		return
+	}
+	comment.Text = text
 	comment.Orig = comment.Text // original comment text, prior to md render
 	if err := s.dataService.ValidateComment(&comment); err != nil {
-		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "invalid comment", rest.ErrCommentValidation)
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "invalid comment", validationErrorCode(err))
 		return
 	}
-	comment = s.commentFormatter.Format(comment, s.disableFancyTextFormatting)
+	comment = s.render(r.Context(), comment)
 
 	// check if images are valid, omit proxied images as they are lazy-loaded
 	for _, id := range s.imageService.ExtractNonProxiedPictures(comment.Text) {
@@ -153,10 +199,39 @@ func (s *private) createCommentCtrl(w http.ResponseWriter, r *http.Request) {
 		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "invalid comment", rest.ErrCommentRestrictWords)
 		return
 	}
+	if errors.Is(err, service.ErrLanguageNotAllowed) {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "invalid comment", rest.ErrCommentLanguage)
+		return
+	}
+	if errors.Is(err, service.ErrExprRejected) {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "comment rejected", rest.ErrCommentRejected)
+		return
+	}
+	if errors.Is(err, service.ErrQuotaExceeded) {
+		rest.SendErrorJSON(w, r, http.StatusTooManyRequests, err, "comment rejected", rest.ErrQuotaExceeded)
+		return
+	}
+	if errors.Is(err, service.ErrGeoBlocked) {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, err, "comment rejected", rest.ErrCommentGeoBlocked)
+		return
+	}
+	if errors.Is(err, service.ErrExitNodeBlocked) {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, err, "comment rejected", rest.ErrCommentExitNode)
+		return
+	}
+	if errors.Is(err, service.ErrRiskyIP) {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, err, "comment rejected", rest.ErrCommentRiskyIP)
+		return
+	}
+	if errors.Is(err, service.ErrPageNotCommentable) {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, err, "comment rejected", rest.ErrPostNotFound)
+		return
+	}
 	if err != nil {
 		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't save comment", rest.ErrInternal)
 		return
 	}
+	s.dataService.RecordClient(comment.Locator.SiteID, service.NewClientInfo(r.UserAgent(), r.Referer(), s.remarkURL))
 
 	// dataService modifies comment
 	finalComment, err := s.dataService.Get(comment.Locator, id, rest.GetUserOrEmpty(r))
@@ -164,18 +239,61 @@ func (s *private) createCommentCtrl(w http.ResponseWriter, r *http.Request) {
 		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't load created comment", rest.ErrInternal)
 		return
 	}
-	s.cache.Flush(cache.Flusher(comment.Locator.SiteID).
-		Scopes(comment.Locator.URL, lastCommentsScope, comment.User.ID, comment.Locator.SiteID))
+	cdn.Flush(s.cache, comment.Locator.SiteID, comment.Locator.URL, lastCommentsScope, comment.User.ID, comment.Locator.SiteID)
 
-	if s.notifyService != nil {
-		s.notifyService.Submit(notify.Request{Comment: finalComment})
+	// moderator notes and comments held for review are not announced, private replies notify the recipient only
+	if s.notifyService != nil && finalComment.Visibility != store.VisibilityStaff && finalComment.Visibility != store.VisibilityPending {
+		submitNotification(s.notifyService, s.dataService, finalComment)
 	}
 
+	s.publishLive(finalComment)
+
 	log.Printf("[DEBUG] created comment %+v", finalComment)
 
 	_ = R.EncodeJSON(w, http.StatusCreated, &finalComment)
 }
 
+// publishLive streams public comment to subscribers of the post in live-blog mode, as seen by anonymous reader
+func (s *private) publishLive(c store.Comment) {
+	if s.live == nil || c.Visibility != "" || !s.dataService.PageSettings(c.Locator).Live {
+		return
+	}
+	comment, err := s.dataService.Get(c.Locator, c.ID, store.User{})
+	if err != nil {
+		log.Printf("[WARN] can't load comment %s for live stream, %v", c.ID, err)
+		return
+	}
+	data, err := encodeJSONWithHTML(comment)
+	if err != nil {
+		log.Printf("[WARN] can't encode comment %s for live stream, %v", c.ID, err)
+		return
+	}
+	s.live.publish(c.Locator, data)
+}
+
+// PUT /poll/vote?site=siteID&url=post-url&option=1 - vote for the option of the post's poll, option is zero-based
+func (s *private) pollVoteCtrl(w http.ResponseWriter, r *http.Request) {
+	user := rest.MustGetUserInfo(r)
+	locator := store.Locator{SiteID: r.URL.Query().Get("site"), URL: r.URL.Query().Get("url")}
+	option, err := strconv.Atoi(r.URL.Query().Get("option"))
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "bad option value", rest.ErrDecode)
+		return
+	}
+	if s.dataService.IsBlocked(locator.SiteID, user.ID) {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, fmt.Errorf("rejected"), "user blocked", rest.ErrUserBlocked)
+		return
+	}
+
+	res, err := s.dataService.VotePoll(locator, user, option)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't vote in poll", rest.ErrVoteRejected)
+		return
+	}
+	cdn.Flush(s.cache, locator.SiteID, locator.URL)
+	R.RenderJSON(w, res)
+}
+
 // PUT /comment/{id}?site=siteID&url=post-url - update comment
 func (s *private) updateCommentCtrl(w http.ResponseWriter, r *http.Request) {
 	edit := struct {
@@ -184,7 +302,7 @@ func (s *private) updateCommentCtrl(w http.ResponseWriter, r *http.Request) {
 		Delete  bool
 	}{}
 
-	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, hardBodyLimit)).Decode(&edit); err != nil {
+	if err := json.NewDecoder(r.Body).Decode(&edit); err != nil {
 		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't read comment details from body", rest.ErrDecode)
 		return
 	}
@@ -208,12 +326,29 @@ func (s *private) updateCommentCtrl(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !edit.Delete {
+		pc := pluginComment(currComment)
+		pc.Text = edit.Text
+		if edit.Text, err = s.plugins.PreSave(r.Context(), pc); err != nil {
+			rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "comment rejected", rest.ErrCommentRejected)
+			return
+		}
+		// edited text is subject to the same content policy as the new one
+		check := store.Comment{Orig: edit.Text, User: user, Locator: currComment.Locator}
+		if err = s.dataService.ValidateComment(&check); err != nil {
+			rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "invalid comment", validationErrorCode(err))
+			return
+		}
+	}
+
+	rendered := s.render(r.Context(), store.Comment{ID: id, Text: edit.Text, User: user, Locator: locator})
 	editReq := service.EditRequest{
-		Text:    s.commentFormatter.FormatText(edit.Text, s.disableFancyTextFormatting),
-		Orig:    edit.Text,
-		Summary: edit.Summary,
-		Delete:  edit.Delete,
-		Admin:   user.Admin,
+		Text:      rendered.Text,
+		Orig:      edit.Text,
+		RenderKey: rendered.RenderKey,
+		Summary:   edit.Summary,
+		Delete:    edit.Delete,
+		Admin:     user.Admin,
 	}
 
 	res, err := s.dataService.EditComment(locator, id, editReq)
@@ -221,6 +356,10 @@ func (s *private) updateCommentCtrl(w http.ResponseWriter, r *http.Request) {
 		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "invalid comment", rest.ErrCommentValidation)
 		return
 	}
+	if errors.Is(err, service.ErrLanguageNotAllowed) {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "invalid comment", rest.ErrCommentLanguage)
+		return
+	}
 
 	if err != nil {
 		code := parseError(err, rest.ErrCommentRejected)
@@ -228,15 +367,44 @@ func (s *private) updateCommentCtrl(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.cache.Flush(cache.Flusher(locator.SiteID).Scopes(locator.SiteID, locator.URL, lastCommentsScope, user.ID))
+	cdn.Flush(s.cache, locator.SiteID, locator.SiteID, locator.URL, lastCommentsScope, user.ID)
 	R.RenderJSON(w, res)
 }
 
+// GET /comment/{id}/raw?site=siteID&url=post-url - returns original markdown of the comment for editing.
+// Allowed to the author while the comment is editable and to moderators.
+func (s *private) rawCommentCtrl(w http.ResponseWriter, r *http.Request) {
+	user := rest.MustGetUserInfo(r)
+	locator := store.Locator{SiteID: r.URL.Query().Get("site"), URL: r.URL.Query().Get("url")}
+
+	comment, err := s.dataService.Get(locator, r.PathValue("id"), user)
+	if err != nil || comment.Deleted {
+		rest.SendErrorJSON(w, r, http.StatusNotFound, err, "can't find comment", rest.ErrCommentNotFound)
+		return
+	}
+
+	if !user.Admin {
+		if comment.User.ID != user.ID {
+			rest.SendErrorJSON(w, r, http.StatusForbidden, fmt.Errorf("rejected"),
+				"can not get raw comments of other users", rest.ErrNoAccess)
+			return
+		}
+		if _, ok := s.dataService.EditTimeLeft(comment, false); !ok {
+			rest.SendErrorJSON(w, r, http.StatusForbidden, fmt.Errorf("rejected"),
+				"comment is not editable anymore", rest.ErrCommentRejected)
+			return
+		}
+	}
+
+	R.RenderJSON(w, R.JSON{"id": comment.ID, "orig": comment.Orig})
+}
+
 // GET /user?site=siteID - returns user info
 func (s *private) userInfoCtrl(w http.ResponseWriter, r *http.Request) {
 	user := rest.MustGetUserInfo(r)
 	if siteID := r.URL.Query().Get("site"); siteID != "" {
 		user.Verified = s.dataService.IsVerified(siteID, user.ID)
+		user.Level = string(s.dataService.UserLevel(siteID, user.ID))
 
 		email, err := s.dataService.GetUserEmail(siteID, user.ID)
 		if err != nil {
@@ -250,6 +418,80 @@ func (s *private) userInfoCtrl(w http.ResponseWriter, r *http.Request) {
 	R.RenderJSON(w, user)
 }
 
+// GET /user/profile?site=siteID - returns user-selected display name and pronouns
+func (s *private) getUserProfileCtrl(w http.ResponseWriter, r *http.Request) {
+	user := rest.MustGetUserInfo(r)
+	siteID := r.URL.Query().Get("site")
+	profile, err := s.dataService.GetUserProfile(siteID, user.ID)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't get user profile", rest.ErrInternal)
+		return
+	}
+	R.RenderJSON(w, profile)
+}
+
+// PUT /user/profile?site=siteID - sets user-selected display name and pronouns, body is UserProfile.
+// Empty values reset to the provider-supplied ones.
+func (s *private) setUserProfileCtrl(w http.ResponseWriter, r *http.Request) {
+	user := rest.MustGetUserInfo(r)
+	siteID := r.URL.Query().Get("site")
+
+	profile := service.UserProfile{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, hardBodyLimit)).Decode(&profile); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't bind profile", rest.ErrDecode)
+		return
+	}
+
+	if s.dataService.IsBlocked(siteID, user.ID) {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, fmt.Errorf("rejected"), "user blocked", rest.ErrUserBlocked)
+		return
+	}
+
+	res, err := s.dataService.SetUserProfile(siteID, user.ID, profile)
+	switch {
+	case errors.Is(err, service.ErrProfileDisabled):
+		rest.SendErrorJSON(w, r, http.StatusForbidden, err, "can't update user profile", rest.ErrActionRejected)
+		return
+	case errors.Is(err, service.ErrDisplayNameInvalid), errors.Is(err, service.ErrDisplayNameBanned),
+		errors.Is(err, service.ErrDisplayNameTaken), errors.Is(err, service.ErrPronounsInvalid):
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't update user profile", rest.ErrProfileRejected)
+		return
+	case err != nil:
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't update user profile", rest.ErrInternal)
+		return
+	}
+	cdn.Flush(s.cache, siteID, siteID, user.ID, lastCommentsScope)
+	R.RenderJSON(w, res)
+}
+
+// GET /ignore?site=siteID - returns list of user ids ignored by the user
+func (s *private) ignoredUsersCtrl(w http.ResponseWriter, r *http.Request) {
+	user := rest.MustGetUserInfo(r)
+	siteID := r.URL.Query().Get("site")
+	ignored, err := s.dataService.IgnoredUsers(siteID, user.ID)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't get ignored users", rest.ErrInternal)
+		return
+	}
+	R.RenderJSON(w, R.JSON{"ignored": ignored})
+}
+
+// PUT /ignore/{userid}?site=siteID&ignore=1 - adds user to the ignore list or removes from it.
+// Comments of ignored users marked with "ignored" flag in find responses for the user who ignores them.
+func (s *private) setIgnoredCtrl(w http.ResponseWriter, r *http.Request) {
+	user := rest.MustGetUserInfo(r)
+	siteID := r.URL.Query().Get("site")
+	ignoredID := r.PathValue("userid")
+	status := r.URL.Query().Get("ignore") == "1"
+
+	if err := s.dataService.SetIgnored(siteID, user.ID, ignoredID, status); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't change ignored users", rest.ErrActionRejected)
+		return
+	}
+	cdn.Flush(s.cache, siteID, siteID)
+	R.RenderJSON(w, R.JSON{"user_id": ignoredID, "ignored": status})
+}
+
 // PUT /vote/{id}?site=siteID&url=post-url&vote=1 - vote for/against comment
 func (s *private) voteCtrl(w http.ResponseWriter, r *http.Request) {
 	user := rest.MustGetUserInfo(r)
@@ -274,6 +516,12 @@ func (s *private) voteCtrl(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	pv := plugin.Vote{CommentID: id, SiteID: locator.SiteID, URL: locator.URL, UserID: user.ID, Value: vote}
+	if err := s.plugins.OnVote(r.Context(), pv); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "vote rejected", rest.ErrVoteRejected)
+		return
+	}
+
 	req := service.VoteReq{
 		Locator:   locator,
 		CommentID: id,
@@ -287,10 +535,77 @@ func (s *private) voteCtrl(w http.ResponseWriter, r *http.Request) {
 		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't vote for comment", code)
 		return
 	}
-	s.cache.Flush(cache.Flusher(locator.SiteID).Scopes(locator.URL, comment.User.ID))
+	cdn.Flush(s.cache, locator.SiteID, locator.URL, comment.User.ID)
 	R.RenderJSON(w, R.JSON{"id": comment.ID, "score": comment.Score})
 }
 
+// threadPermissions is what the current user may do on the thread
+type threadPermissions struct {
+	Authenticated bool           `json:"authenticated"`
+	Post          bool           `json:"post"`
+	Reason        string         `json:"reason,omitempty"` // why posting is not allowed
+	Vote          bool           `json:"vote"`
+	UploadImages  bool           `json:"upload_images"`
+	Moderate      bool           `json:"moderate"`
+	Editable      map[string]int `json:"editable"` // own comments still editable, id to seconds left, 0 for no time limit
+}
+
+// reasons for not allowed posting in threadPermissions
+const (
+	reasonAuth            = "auth"
+	reasonSubscribersOnly = "subscribers_only"
+	reasonBlocked         = "blocked"
+	reasonReadOnly        = "read_only"
+)
+
+// GET /permissions?site=siteID&url=post-url - returns what the current user may do on the thread, follows the same
+// checks as the posting, voting, editing and image upload handlers. Works without auth, with everything denied.
+func (s *private) permissionsCtrl(w http.ResponseWriter, r *http.Request) {
+	locator := store.Locator{SiteID: r.URL.Query().Get("site"), URL: r.URL.Query().Get("url")}
+	res := threadPermissions{Editable: map[string]int{}}
+
+	user, err := rest.GetUserInfo(r)
+	if err != nil || (user.ID != "admin" && user.SiteID != locator.SiteID) {
+		res.Reason = reasonAuth
+		R.RenderJSON(w, res)
+		return
+	}
+	res.Authenticated = true
+	res.Moderate = user.Admin
+	anonymous := strings.HasPrefix(user.ID, "anonymous_")
+	res.UploadImages = !anonymous && s.imageService != nil
+
+	switch {
+	case s.subscribersOnly && !user.PaidSub:
+		res.Reason = reasonSubscribersOnly
+	case s.dataService.IsBlocked(locator.SiteID, user.ID):
+		res.Reason = reasonBlocked
+	case s.isReadOnly(locator):
+		res.Reason = reasonReadOnly
+	default:
+		res.Post = true
+		res.Vote = !anonymous || s.anonVote
+	}
+
+	// editing is limited by subscription only, like in updateCommentCtrl
+	if res.Reason != reasonSubscribersOnly {
+		// no comments on a new thread, find fails for it
+		comments, err := s.dataService.Find(locator, "time", user)
+		if err != nil {
+			log.Printf("[DEBUG] no comments for %+v, %v", locator, err)
+		}
+		for _, c := range comments {
+			if c.User.ID != user.ID || c.Deleted {
+				continue
+			}
+			if left, ok := s.dataService.EditTimeLeft(c, user.Admin); ok {
+				res.Editable[c.ID] = int(left.Seconds())
+			}
+		}
+	}
+	R.RenderJSON(w, res)
+}
+
 // getEmailCtrl gets email address for authenticated user.
 // GET /email?site=siteID
 func (s *private) getEmailCtrl(w http.ResponseWriter, r *http.Request) {
@@ -467,7 +782,7 @@ func (s *private) setConfirmedEmailCtrl(w http.ResponseWriter, r *http.Request)
 		rest.SendErrorJSON(w, r, http.StatusBadRequest, fmt.Errorf("missing parameter"), "token parameter is required", rest.ErrInternal)
 		return
 	}
-	confClaims, err := s.authenticator.TokenService().Parse(confirm.Token)
+	confClaims, err := s.tokens.Parse(confirm.Token)
 	if err != nil {
 		rest.SendErrorJSON(w, r, http.StatusForbidden, err, "failed to verify confirmation token", rest.ErrInternal)
 		return
@@ -521,7 +836,7 @@ func (s *private) emailUnsubscribeCtrl(w http.ResponseWriter, r *http.Request) {
 	}
 	siteID := r.URL.Query().Get("site")
 
-	confClaims, err := s.authenticator.TokenService().Parse(tkn)
+	confClaims, err := s.tokens.Parse(tkn)
 	if err != nil {
 		rest.SendErrorHTML(w, r, http.StatusForbidden, err, "failed to verify confirmation token", rest.ErrInternal)
 		return
@@ -532,7 +847,7 @@ func (s *private) emailUnsubscribeCtrl(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// handshake.ID is user.ID + "::" + address
+	// handshake.ID is user.ID + "::" + address, or user.ID + "::" + address hash with PII minimization enabled
 	elems := strings.Split(confClaims.Handshake.ID, "::")
 	if len(elems) != 2 {
 		rest.SendErrorHTML(w, r, http.StatusBadRequest, fmt.Errorf("%s", confClaims.Handshake.ID), "invalid handshake token", rest.ErrInternal)
@@ -551,7 +866,7 @@ func (s *private) emailUnsubscribeCtrl(w http.ResponseWriter, r *http.Request) {
 		rest.SendErrorHTML(w, r, http.StatusConflict, fmt.Errorf("user is not subscribed"), "user does not have active email subscription", rest.ErrInternal)
 		return
 	}
-	if address != existingAddress {
+	if address != existingAddress && address != s.dataService.EmailToken(existingAddress) {
 		rest.SendErrorHTML(w, r, http.StatusBadRequest, fmt.Errorf("wrong email unsubscription"), "email address in request does not match known for this user", rest.ErrInternal)
 		return
 	}
@@ -596,6 +911,329 @@ func (s *private) emailUnsubscribeCtrl(w http.ResponseWriter, r *http.Request) {
 	rest.HTMLResponse(w, http.StatusOK, msg.String())
 }
 
+// subscriptions of the user managed with the token from notification email, false turns subscription off
+type subscriptionsInfo struct {
+	Email    bool `json:"email"`    // email notifications about replies
+	Telegram bool `json:"telegram"` // telegram notifications about replies
+}
+
+// subscriberFromToken returns site and id of the user from the unsubscribe token of the request.
+// The token must be issued for the site and the address in it must match the current email of the user, if any.
+func (s *private) subscriberFromToken(r *http.Request) (siteID, userID string, err error) {
+	tkn, siteID := r.URL.Query().Get("tkn"), r.URL.Query().Get("site")
+	if tkn == "" || siteID == "" {
+		return "", "", errors.New("missing token or site")
+	}
+	claims, err := s.tokens.Parse(tkn)
+	if err != nil {
+		return "", "", err
+	}
+	if s.authenticator.TokenService().IsExpired(claims) {
+		return "", "", errors.New("expired")
+	}
+	if !slices.Contains(claims.Audience, siteID) {
+		return "", "", fmt.Errorf("token is not for site %s", siteID)
+	}
+	if claims.Handshake == nil {
+		return "", "", errors.New("no handshake in token")
+	}
+	elems := strings.Split(claims.Handshake.ID, "::")
+	if len(elems) != 2 || elems[0] == "" {
+		return "", "", fmt.Errorf("invalid handshake %s", claims.Handshake.ID)
+	}
+	userID, address := elems[0], elems[1]
+	existingAddress, err := s.dataService.GetUserEmail(siteID, userID)
+	if err != nil {
+		return "", "", fmt.Errorf("can't read email for %s: %w", userID, err)
+	}
+	if existingAddress != "" && address != existingAddress && address != s.dataService.EmailToken(existingAddress) {
+		return "", "", errors.New("token issued for another email address")
+	}
+	return siteID, userID, nil
+}
+
+// subscriptions returns current subscriptions of the user
+func (s *private) subscriptions(siteID, userID string) (subscriptionsInfo, error) {
+	email, err := s.dataService.GetUserEmail(siteID, userID)
+	if err != nil {
+		return subscriptionsInfo{}, err
+	}
+	telegram, err := s.dataService.GetUserTelegram(siteID, userID)
+	if err != nil {
+		return subscriptionsInfo{}, err
+	}
+	return subscriptionsInfo{Email: email != "", Telegram: telegram != ""}, nil
+}
+
+// GET /subscriptions?site=siteID&tkn=jwt - lists subscriptions of the user in the unsubscribe token
+func (s *private) getSubscriptionsCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID, userID, err := s.subscriberFromToken(r)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, err, "failed to verify unsubscribe token", rest.ErrActionRejected)
+		return
+	}
+	res, err := s.subscriptions(siteID, userID)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't get subscriptions", rest.ErrInternal)
+		return
+	}
+	R.RenderJSON(w, res)
+}
+
+// PUT /subscriptions?site=siteID&tkn=jwt - turns off subscriptions of the user in the unsubscribe token.
+// Body is {"email": false, "telegram": false}, omitted fields kept as is. Subscriptions can't be turned on
+// with the token as they need confirmation of the address, true values are ignored.
+func (s *private) setSubscriptionsCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID, userID, err := s.subscriberFromToken(r)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, err, "failed to verify unsubscribe token", rest.ErrActionRejected)
+		return
+	}
+	req := struct {
+		Email    *bool `json:"email"`
+		Telegram *bool `json:"telegram"`
+	}{}
+	if err = R.DecodeJSON(r, &req); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't decode subscriptions", rest.ErrDecode)
+		return
+	}
+
+	if req.Telegram != nil && !*req.Telegram {
+		log.Printf("[DEBUG] unsubscribe user %s from telegram notifications", userID)
+		if err = s.dataService.DeleteUserDetail(siteID, userID, engine.UserTelegram); err != nil {
+			rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't delete telegram for user", parseError(err, rest.ErrInternal))
+			return
+		}
+	}
+	if req.Email != nil && !*req.Email {
+		log.Printf("[DEBUG] unsubscribe user %s from email notifications", userID)
+		if err = s.dataService.DeleteUserDetail(siteID, userID, engine.UserEmail); err != nil {
+			rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't delete email for user", parseError(err, rest.ErrInternal))
+			return
+		}
+		// clean User.Email from the token, if user has the token
+		if claims, _, e := s.authenticator.TokenService().Get(r); e == nil && claims.User != nil && claims.User.ID == userID && claims.User.Email != "" {
+			claims.User.Email = ""
+			if _, err = s.authenticator.TokenService().Set(w, claims); err != nil {
+				rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "failed to set token", rest.ErrInternal)
+				return
+			}
+		}
+	}
+
+	res, err := s.subscriptions(siteID, userID)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't get subscriptions", rest.ErrInternal)
+		return
+	}
+	R.RenderJSON(w, res)
+}
+
+// GET /web/unsubscribe?site=siteID&tkn=jwt - page managing all subscriptions of the user in the unsubscribe token
+func (s *private) subscriptionsPageCtrl(w http.ResponseWriter, r *http.Request) {
+	data := struct{ Site, Token string }{Site: r.URL.Query().Get("site"), Token: r.URL.Query().Get("tkn")}
+	tmplstr, err := templates.Read("subscriptions.html.tmpl")
+	if err != nil {
+		rest.SendErrorHTML(w, r, http.StatusInternalServerError, err, "can't read subscriptions template", rest.ErrInternal)
+		return
+	}
+	tmpl, err := template.New("subscriptions").Parse(string(tmplstr))
+	if err != nil {
+		rest.SendErrorHTML(w, r, http.StatusInternalServerError, err, "can't parse subscriptions template", rest.ErrInternal)
+		return
+	}
+	msg := bytes.Buffer{}
+	if err = tmpl.Execute(&msg, data); err != nil {
+		rest.SendErrorHTML(w, r, http.StatusInternalServerError, err, "can't render subscriptions", rest.ErrInternal)
+		return
+	}
+	w.Header().Set("Referrer-Policy", "no-referrer") // keep the token out of referrers
+	rest.HTMLResponse(w, http.StatusOK, msg.String())
+}
+
+// GET /invite.html?id=invitation-id - page of the invitation, accepting it for the user logged in to one of its sites
+func (s *private) invitePageCtrl(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		ID, Role, Expires, Error string
+		Sites                    []string
+	}{}
+	inv, err := s.dataService.Invite(r.URL.Query().Get("id"))
+	switch {
+	case err != nil:
+		data.Error = "Invitation not found"
+	case inv.AcceptedBy != "":
+		data.Error = "Invitation already accepted"
+	case !time.Now().Before(inv.Expires):
+		data.Error = "Invitation expired"
+	default:
+		data.ID, data.Role, data.Sites, data.Expires = inv.ID, inv.Role, inv.Sites, inv.Expires.UTC().Format("Jan 2, 2006 at 15:04 UTC")
+	}
+
+	tmplstr, err := templates.Read("invite.html.tmpl")
+	if err != nil {
+		rest.SendErrorHTML(w, r, http.StatusInternalServerError, err, "can't read invitation template", rest.ErrInternal)
+		return
+	}
+	tmpl, err := template.New("invite").Parse(string(tmplstr))
+	if err != nil {
+		rest.SendErrorHTML(w, r, http.StatusInternalServerError, err, "can't parse invitation template", rest.ErrInternal)
+		return
+	}
+	msg := bytes.Buffer{}
+	if err = tmpl.Execute(&msg, data); err != nil {
+		rest.SendErrorHTML(w, r, http.StatusInternalServerError, err, "can't render invitation", rest.ErrInternal)
+		return
+	}
+	rest.HTMLResponse(w, http.StatusOK, msg.String())
+}
+
+// POST /invite/accept?site=siteID&id=invitation-id - grants role of the invitation to the user,
+// token of the user updated with the new admin status on the site
+func (s *private) acceptInviteCtrl(w http.ResponseWriter, r *http.Request) {
+	user := rest.MustGetUserInfo(r)
+	grants, err := s.dataService.AcceptInvite(r.URL.Query().Get("id"), user.ID)
+	if errors.Is(err, invite.ErrNotFound) {
+		rest.SendErrorJSON(w, r, http.StatusNotFound, err, "can't accept invitation", rest.ErrActionRejected)
+		return
+	}
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't accept invitation", rest.ErrActionRejected)
+		return
+	}
+
+	claims, _, err := s.authenticator.TokenService().Get(r)
+	if err != nil || claims.User == nil {
+		log.Printf("[DEBUG] user %s accepted invitation without token to update, %v", user.ID, err)
+		R.RenderJSON(w, R.JSON{"grants": grants})
+		return
+	}
+	role := s.dataService.UserRole(user.SiteID, user.ID)
+	claims.User.SetRole(role)
+	claims.User.SetAdmin(role != "")
+	if _, err = s.authenticator.TokenService().Set(w, claims); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "failed to set token", rest.ErrInternal)
+		return
+	}
+	R.RenderJSON(w, R.JSON{"grants": grants})
+}
+
+// linkHandshakePrefix marks handshake of link token, followed by id of the user to link to
+const linkHandshakePrefix = "link::"
+
+// POST /link?site=siteID - makes token to link another login of the user to the current one. The token is confirmed
+// with POST /link/confirm after login with the other provider.
+func (s *private) linkTokenCtrl(w http.ResponseWriter, r *http.Request) {
+	user := rest.MustGetUserInfo(r)
+	claims := token.Claims{
+		Handshake: &token.Handshake{ID: linkHandshakePrefix + user.ID},
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{r.URL.Query().Get("site")},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(10 * time.Minute)),
+			NotBefore: jwt.NewNumericDate(time.Now().Add(-1 * time.Minute)),
+			Issuer:    "remark42",
+		},
+	}
+	tkn, err := s.authenticator.TokenService().Token(claims)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, err, "failed to make link token", rest.ErrInternal)
+		return
+	}
+	R.RenderJSON(w, R.JSON{"token": tkn})
+}
+
+// POST /link/confirm?site=siteID - links the current login to the user who made the token, body is {"token":"link-token"}.
+// The token of the current login updated to the linked user.
+func (s *private) confirmLinkCtrl(w http.ResponseWriter, r *http.Request) {
+	user, siteID := rest.MustGetUserInfo(r), r.URL.Query().Get("site")
+	confirm := struct {
+		Token string
+	}{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, hardBodyLimit)).Decode(&confirm); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't parse request body", rest.ErrDecode)
+		return
+	}
+	confClaims, err := s.tokens.Parse(confirm.Token)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, err, "failed to verify link token", rest.ErrNoAccess)
+		return
+	}
+	if s.authenticator.TokenService().IsExpired(confClaims) {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, errors.New("expired"), "failed to verify link token", rest.ErrNoAccess)
+		return
+	}
+	if confClaims.Handshake == nil || !strings.HasPrefix(confClaims.Handshake.ID, linkHandshakePrefix) ||
+		!slices.Contains(confClaims.Audience, siteID) {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, errors.New("not a link token"), "invalid link token", rest.ErrNoAccess)
+		return
+	}
+	canonicalID := strings.TrimPrefix(confClaims.Handshake.ID, linkHandshakePrefix)
+	if err = s.dataService.LinkUser(siteID, user.ID, canonicalID); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't link user", rest.ErrActionRejected)
+		return
+	}
+
+	claims, _, err := s.authenticator.TokenService().Get(r)
+	if err != nil || claims.User == nil {
+		log.Printf("[DEBUG] user %s linked to %s without token to update, %v", user.ID, canonicalID, err)
+		R.RenderJSON(w, R.JSON{"user_id": user.ID, "linked_to": canonicalID})
+		return
+	}
+	claims.User.ID = canonicalID
+	role := s.dataService.UserRole(siteID, canonicalID)
+	claims.User.SetRole(role)
+	claims.User.SetAdmin(role != "")
+	if _, err = s.authenticator.TokenService().Set(w, claims); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "failed to set token", rest.ErrInternal)
+		return
+	}
+	R.RenderJSON(w, R.JSON{"user_id": user.ID, "linked_to": canonicalID})
+}
+
+// GET /links?site=siteID - lists ids of other logins linked to the user
+func (s *private) linksCtrl(w http.ResponseWriter, r *http.Request) {
+	user := rest.MustGetUserInfo(r)
+	linked, err := s.dataService.LinkedUsers(r.URL.Query().Get("site"), user.ID)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't get linked users", rest.ErrActionRejected)
+		return
+	}
+	R.RenderJSON(w, linked)
+}
+
+// DELETE /link/{userid}?site=siteID - unlinks other login from the user
+func (s *private) unlinkCtrl(w http.ResponseWriter, r *http.Request) {
+	user := rest.MustGetUserInfo(r)
+	siteID, linkedID := r.URL.Query().Get("site"), r.PathValue("userid")
+	canonicalID, err := s.dataService.LinkedUser(siteID, linkedID)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't get linked user", rest.ErrActionRejected)
+		return
+	}
+	if canonicalID != user.ID {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, fmt.Errorf("%s is not linked to %s", linkedID, user.ID),
+			"can't unlink user", rest.ErrNoAccess)
+		return
+	}
+	if err = s.dataService.UnlinkUser(siteID, linkedID); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't unlink user", rest.ErrActionRejected)
+		return
+	}
+	R.RenderJSON(w, R.JSON{"user_id": linkedID, "unlinked": true})
+}
+
+// POST /logout/all?site=siteID - revokes all tokens of the user, logging the user out on all devices including this one
+func (s *private) logoutAllCtrl(w http.ResponseWriter, r *http.Request) {
+	user := rest.MustGetUserInfo(r)
+	siteID := r.URL.Query().Get("site")
+	notBefore, err := s.dataService.RevokeTokens(siteID, user.ID)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't revoke tokens", rest.ErrInternal)
+		return
+	}
+	s.authenticator.TokenService().Reset(w)
+	R.RenderJSON(w, R.JSON{"user_id": user.ID, "not_before": notBefore})
+}
+
 // DELETE /email?site=siteID - removes user's email
 func (s *private) deleteEmailCtrl(w http.ResponseWriter, r *http.Request) {
 	user := rest.MustGetUserInfo(r)
@@ -728,11 +1366,10 @@ func (s *private) deleteMeCtrl(w http.ResponseWriter, r *http.Request) {
 func (s *private) savePictureCtrl(w http.ResponseWriter, r *http.Request) {
 	user := rest.MustGetUserInfo(r)
 
-	r.Body = http.MaxBytesReader(w, r.Body, 32*1024*1024) // hard cap on upload to prevent memory exhaustion
-	// gosec G120: r.Body is already bounded by MaxBytesReader on the line above (32 MB),
-	// so ParseMultipartForm cannot read more than that regardless of the in-memory threshold.
+	// gosec G120: r.Body is already bounded by MaxBytesReader of limitRequest middleware on the route
+	// (Limits.ImageBody), so ParseMultipartForm cannot read more than that regardless of the in-memory threshold.
 	// The 5 MB argument is the soft threshold above which the form is spilled to disk.
-	if err := r.ParseMultipartForm(5 * 1024 * 1024); err != nil { //nolint:gosec // bounded by MaxBytesReader above
+	if err := r.ParseMultipartForm(5 * 1024 * 1024); err != nil { //nolint:gosec // bounded by limitRequest middleware
 		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't parse multipart form", rest.ErrDecode)
 		return
 	}
@@ -744,13 +1381,58 @@ func (s *private) savePictureCtrl(w http.ResponseWriter, r *http.Request) {
 	}
 	defer func() { _ = file.Close() }()
 
-	id, err := s.imageService.Save(user.ID, file)
+	alt := r.FormValue("alt")
+	if utf8.RuneCountInString(alt) > image.MaxAltLength {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, fmt.Errorf("alt text longer than %d characters", image.MaxAltLength),
+			"alt text is too long", rest.ErrDecode)
+		return
+	}
+
+	id, alt, err := s.imageService.SaveWithAlt(r.Context(), user.ID, file, alt)
 	if err != nil {
 		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't save image", rest.ErrInternal)
 		return
 	}
 
-	R.RenderJSON(w, R.JSON{"id": id})
+	R.RenderJSON(w, R.JSON{"id": id, "alt": alt})
+}
+
+// render formats comment's markdown to html and passes the html to post_render hooks of plugins
+func (s *private) render(ctx context.Context, comment store.Comment) store.Comment {
+	return CommentRenderer{Formatter: s.commentFormatter, Plugins: s.plugins, Raw: s.disableFancyTextFormatting}.Render(ctx, comment)
+}
+
+// CommentRenderer renders comments with formatter and post_render hooks of plugins. Used for new and edited
+// comments, and by data service to re-render stored comments with outdated rendering.
+type CommentRenderer struct {
+	Formatter *store.CommentFormatter
+	Plugins   *plugin.Manager
+	Raw       bool // fancy text formatting disabled
+}
+
+// Render formats comment's markdown to html and passes the html to post_render hooks of plugins
+func (r CommentRenderer) Render(ctx context.Context, comment store.Comment) store.Comment {
+	comment = r.Formatter.Format(comment, r.Raw)
+	if text := r.Plugins.PostRender(ctx, pluginComment(comment)); text != comment.Text {
+		comment.Text, comment.PlainText = text, store.PlainText(text)
+	}
+	comment.RenderKey = r.RenderKey()
+	return comment
+}
+
+// RenderKey returns formatter's render key, with post_render plugins if there are any
+func (r CommentRenderer) RenderKey() string {
+	key := r.Formatter.RenderKey(r.Raw)
+	if plugins := r.Plugins.PostRenderKey(); plugins != "" {
+		key += "-" + store.EncodeID(plugins)[:12]
+	}
+	return key
+}
+
+// pluginComment makes comment's data passed to plugins
+func pluginComment(c store.Comment) plugin.Comment {
+	return plugin.Comment{ID: c.ID, ParentID: c.ParentID, SiteID: c.Locator.SiteID, URL: c.Locator.URL,
+		UserID: c.User.ID, UserName: c.User.Name, Text: c.Text}
 }
 
 func (s *private) isReadOnly(locator store.Locator) bool {
@@ -784,3 +1466,23 @@ func extractIP(remoteAddr string) string {
 	}
 	return ip
 }
+
+// commentNotifier routes notifications of the published comments
+type commentNotifier interface {
+	WelcomeMessage(c store.Comment) (string, error)
+	SuppressLateNotify(c store.Comment) bool
+	NotifyDestinations(c store.Comment) ([]string, error)
+}
+
+// submitNotification sends notification of the published comment with the author's welcome message, if any
+func submitNotification(ns *notify.Service, ds commentNotifier, c store.Comment) {
+	welcome, err := ds.WelcomeMessage(c)
+	if err != nil {
+		log.Printf("[WARN] can't make welcome message for comment %s, %v", c.ID, err)
+	}
+	destinations, err := ds.NotifyDestinations(c)
+	if err != nil {
+		log.Printf("[WARN] can't route notification of comment %s, sent to all destinations, %v", c.ID, err)
+	}
+	ns.Submit(notify.Request{Comment: c, Welcome: welcome, SkipWatchers: ds.SuppressLateNotify(c), Destinations: destinations})
+}
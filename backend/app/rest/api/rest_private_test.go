@@ -4,14 +4,21 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -22,11 +29,18 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
 
+	"github.com/umputun/remark42/backend/app/geoip"
 	"github.com/umputun/remark42/backend/app/notify"
+	"github.com/umputun/remark42/backend/app/plugin"
+	"github.com/umputun/remark42/backend/app/rest"
 	"github.com/umputun/remark42/backend/app/rest/proxy"
 	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/engine"
 	"github.com/umputun/remark42/backend/app/store/image"
+	"github.com/umputun/remark42/backend/app/store/invite"
+	"github.com/umputun/remark42/backend/app/store/service"
 )
 
 // gopher png for test, from https://golang.org/src/image/png/example_test.go
@@ -228,6 +242,28 @@ func TestRest_CreateTooBig(t *testing.T) {
 	assert.Equal(t, "can't bind comment", c["details"])
 }
 
+func TestRest_CreateWithBodyLimit(t *testing.T) {
+	ts, _, teardown := startupT(t, func(srv *Rest) { srv.Limits.CommentBody = 1024 * 256 })
+	defer teardown()
+
+	veryLongComment := fmt.Sprintf(`{"text": "%70000s", "locator":{"url": "https://radio-t.com/blah1", "site": "remark42"}}`, "Щ")
+	resp, err := post(t, ts.URL+"/api/v1/comment?site=remark42", veryLongComment)
+	require.NoError(t, err)
+	c := R.JSON{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&c))
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "invalid comment", c["details"], "body fits configured limit, rejected by comment validation")
+
+	resp, err = post(t, ts.URL+"/api/v1/comment?site=remark42", fmt.Sprintf(`{"text": "%300000s"}`, "x"))
+	require.NoError(t, err)
+	c = R.JSON{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&c))
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "http: request body too large", c["error"])
+}
+
 func TestRest_CreateWithRestrictedWord(t *testing.T) {
 	ts, _, teardown := startupT(t)
 	defer teardown()
@@ -660,6 +696,44 @@ func TestRest_UpdateNotOwner(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, b.StatusCode, string(body), "update is not json")
 }
 
+func TestRest_RawComment(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	c1 := store.Comment{Text: "**bold** and `code`", Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah1"}}
+	id := addComment(t, c1, ts)
+	old, err := srv.DataService.Create(store.Comment{Text: "old", Orig: "old", Timestamp: time.Now().Add(-time.Hour),
+		Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah1"}, User: store.User{ID: "provider1_dev"}})
+	require.NoError(t, err)
+
+	get := func(id, tkn string) (int, string) {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/comment/"+id+"/raw?site=remark42&url=https://radio-t.com/blah1", http.NoBody)
+		require.NoError(t, err)
+		resp, err := sendReq(t, req, tkn)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp.StatusCode, string(body)
+	}
+
+	code, body := get(id, devToken)
+	require.Equal(t, http.StatusOK, code, body)
+	assert.Equal(t, `{"id":"`+id+`","orig":"**bold** and `+"`code`"+`"}`+"\n", body)
+
+	code, body = get(id, dev2Token)
+	assert.Equal(t, http.StatusForbidden, code, body)
+	code, body = get(old, devToken)
+	assert.Equal(t, http.StatusForbidden, code, "edit window is over")
+	assert.Contains(t, body, "comment is not editable anymore")
+	code, _ = get(old, adminUmputunToken)
+	assert.Equal(t, http.StatusOK, code, "moderators get raw comments any time")
+	code, _ = get("unknown", devToken)
+	assert.Equal(t, http.StatusNotFound, code)
+	code, _ = get(id, "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
+
 func TestRest_UpdateWrongAud(t *testing.T) {
 	ts, _, teardown := startupT(t)
 	defer teardown()
@@ -797,6 +871,76 @@ func TestRest_Vote(t *testing.T) {
 	assert.Equal(t, map[string]store.VotedIPInfo(nil), cr.VotedIPs, "hidden")
 }
 
+func TestRest_Plugins(t *testing.T) {
+	dir := t.TempDir()
+	cmd := exec.Command("go", "build", "-buildmode=c-shared", "-o", filepath.Join(dir, "test.wasm"), "main.go")
+	cmd.Dir = filepath.Join("..", "..", "plugin", "testdata", "plugin")
+	cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+	plugins, err := plugin.New(context.Background(), dir, plugin.Options{Timeout: time.Second})
+	require.NoError(t, err)
+	defer plugins.Close(context.Background())
+
+	ts, _, teardown := startupT(t, func(srv *Rest) { srv.Plugins = plugins })
+	defer teardown()
+
+	locator := store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}
+	id := addComment(t, store.Comment{Text: "some badword about remark42", Locator: locator}, ts)
+	body, code := get(t, fmt.Sprintf("%s/api/v1/id/%s?site=remark42&url=https://radio-t.com/blah", ts.URL, id))
+	require.Equal(t, http.StatusOK, code, body)
+	c := store.Comment{}
+	require.NoError(t, json.Unmarshal([]byte(body), &c))
+	assert.Equal(t, "some *** about remark42", c.Orig, "changed by pre_save")
+	assert.Equal(t, "<p>some *** about <b>remark42</b></p>\n", c.Text, "changed by post_render")
+
+	resp, err := post(t, ts.URL+"/api/v1/comment?site=remark42", `{"text": "buy spam", "locator":{"url": "https://radio-t.com/blah", "site": "remark42"}}`)
+	require.NoError(t, err)
+	res := R.JSON{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "comment rejected", res["details"])
+	assert.Equal(t, "rejected by plugin test: no spam", res["error"])
+	assert.InDelta(t, float64(rest.ErrCommentRejected), res["code"], 0)
+
+	resp, err = post(t, ts.URL+"/api/v1/preview", `{"text": "a badword", "locator":{"url": "https://radio-t.com/blah", "site": "remark42"}}`)
+	require.NoError(t, err)
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "<p>a ***</p>\n", string(b))
+
+	req, err := http.NewRequest(http.MethodPut, fmt.Sprintf("%s/api/v1/comment/%s?site=remark42&url=https://radio-t.com/blah", ts.URL, id),
+		strings.NewReader(`{"text": "edited badword"}`))
+	require.NoError(t, err)
+	resp, err = sendReq(t, req, devToken)
+	require.NoError(t, err)
+	c = store.Comment{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&c))
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "edited ***", c.Orig)
+
+	vote := func(val int) (int, R.JSON) {
+		req, err := http.NewRequest(http.MethodPut,
+			fmt.Sprintf("%s/api/v1/vote/%s?site=remark42&url=https://radio-t.com/blah&vote=%d", ts.URL, id, val), http.NoBody)
+		require.NoError(t, err)
+		resp, err := sendReq(t, req, dev2Token)
+		require.NoError(t, err)
+		res := R.JSON{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+		require.NoError(t, resp.Body.Close())
+		return resp.StatusCode, res
+	}
+	code, res = vote(-1)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "vote rejected", res["details"])
+	code, res = vote(1)
+	assert.Equal(t, http.StatusOK, code, res)
+}
+
 func TestRest_AnonVote(t *testing.T) {
 	ts, srv, teardown := startupT(t)
 	defer teardown()
@@ -947,6 +1091,131 @@ func TestRest_EmailAndTelegram(t *testing.T) {
 	}
 }
 
+func TestRest_EmailUnsubscribePII(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	vault, err := service.NewPIIVault("secret")
+	require.NoError(t, err)
+	srv.DataService.PII = vault
+	_, err = srv.DataService.SetUserEmail("remark42", "provider1_dev", "good@example.com")
+	require.NoError(t, err)
+
+	stored, err := srv.DataService.Engine.UserDetail(engine.UserDetailRequest{Locator: store.Locator{SiteID: "remark42"},
+		UserID: "provider1_dev", Detail: engine.UserEmail})
+	require.NoError(t, err)
+	require.Len(t, stored, 1)
+	assert.NotContains(t, stored[0].Email, "good@example.com", "plain email never stored")
+
+	makeToken := func(address string) string {
+		claims := token.Claims{
+			Handshake: &token.Handshake{ID: "provider1_dev::" + address},
+			RegisteredClaims: jwt.RegisteredClaims{
+				Audience:  jwt.ClaimStrings{"remark42"},
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(10 * time.Minute)),
+				NotBefore: jwt.NewNumericDate(time.Now().Add(-1 * time.Minute)),
+				Issuer:    "remark42",
+			},
+		}
+		tkn, e := srv.Authenticator.TokenService().Token(claims)
+		require.NoError(t, e)
+		return tkn
+	}
+
+	resp, err := post(t, ts.URL+"/email/unsubscribe.html?site=remark42&tkn="+makeToken(vault.Hash("bad@example.com")), "")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "hash of another address")
+	require.NoError(t, resp.Body.Close())
+
+	resp, err = post(t, ts.URL+"/email/unsubscribe.html?site=remark42&tkn="+makeToken(srv.DataService.EmailToken("good@example.com")), "")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, resp.Body.Close())
+
+	email, err := srv.DataService.GetUserEmail("remark42", "provider1_dev")
+	require.NoError(t, err)
+	assert.Empty(t, email)
+}
+
+func TestRest_Subscriptions(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	makeToken := func(id, site string) string {
+		claims := token.Claims{
+			Handshake: &token.Handshake{ID: id},
+			RegisteredClaims: jwt.RegisteredClaims{
+				Audience:  jwt.ClaimStrings{site},
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(10 * time.Minute)),
+				NotBefore: jwt.NewNumericDate(time.Now().Add(-1 * time.Minute)),
+				Issuer:    "remark42",
+			},
+		}
+		tkn, e := srv.Authenticator.TokenService().Token(claims)
+		require.NoError(t, e)
+		return tkn
+	}
+	request := func(method, tkn, site, body string) (int, string) {
+		req, e := http.NewRequest(method, ts.URL+"/api/v1/subscriptions?site="+site+"&tkn="+tkn, strings.NewReader(body))
+		require.NoError(t, e)
+		resp, e := http.DefaultClient.Do(req)
+		require.NoError(t, e)
+		defer resp.Body.Close()
+		b, e := io.ReadAll(resp.Body)
+		require.NoError(t, e)
+		return resp.StatusCode, string(b)
+	}
+
+	_, err := srv.DataService.SetUserEmail("remark42", "provider1_dev", "good@example.com")
+	require.NoError(t, err)
+	_, err = srv.DataService.SetUserTelegram("remark42", "provider1_dev", "good_telegram")
+	require.NoError(t, err)
+	goodToken := makeToken("provider1_dev::good@example.com", "remark42")
+
+	code, body := request(http.MethodGet, goodToken, "remark42", "")
+	assert.Equal(t, http.StatusOK, code, body)
+	assert.JSONEq(t, `{"email":true,"telegram":true}`, body)
+
+	code, _ = request(http.MethodGet, "", "remark42", "")
+	assert.Equal(t, http.StatusForbidden, code, "no token")
+	code, _ = request(http.MethodGet, "bad", "remark42", "")
+	assert.Equal(t, http.StatusForbidden, code, "bad token")
+	code, _ = request(http.MethodGet, goodToken, "other", "")
+	assert.Equal(t, http.StatusForbidden, code, "token for another site")
+	code, _ = request(http.MethodGet, makeToken("provider1_dev::old@example.com", "remark42"), "remark42", "")
+	assert.Equal(t, http.StatusForbidden, code, "token for another address")
+	code, _ = request(http.MethodPut, makeToken("provider1_dev::old@example.com", "remark42"), "remark42", `{"email":false}`)
+	assert.Equal(t, http.StatusForbidden, code, "can't unsubscribe with token for another address")
+
+	code, _ = request(http.MethodPut, goodToken, "remark42", `bad`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, body = request(http.MethodPut, goodToken, "remark42", `{"telegram":false}`)
+	assert.Equal(t, http.StatusOK, code, body)
+	assert.JSONEq(t, `{"email":true,"telegram":false}`, body, "email kept")
+
+	code, body = request(http.MethodPut, goodToken, "remark42", `{"email":false,"telegram":true}`)
+	assert.Equal(t, http.StatusOK, code, body)
+	assert.JSONEq(t, `{"email":false,"telegram":false}`, body, "subscription can't be turned on")
+	email, err := srv.DataService.GetUserEmail("remark42", "provider1_dev")
+	require.NoError(t, err)
+	assert.Empty(t, email)
+
+	code, body = request(http.MethodGet, goodToken, "remark42", "")
+	assert.Equal(t, http.StatusOK, code, "token still valid without subscriptions")
+	assert.JSONEq(t, `{"email":false,"telegram":false}`, body)
+
+	resp, err := http.Get(ts.URL + "/web/unsubscribe?site=remark42&tkn=" + goodToken)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "no-referrer", resp.Header.Get("Referrer-Policy"))
+	assert.Contains(t, string(b), "Remark42 subscriptions")
+	assert.Contains(t, string(b), `var site = "remark42", tkn = "`+goodToken+`"`)
+}
+
 func TestRest_EmailNotification(t *testing.T) {
 	ts, srv, teardown := startupT(t)
 	defer teardown()
@@ -1393,6 +1662,176 @@ func TestRest_TelegramNotification(t *testing.T) {
 	assert.Empty(t, mockDestination.Get()[3].Telegrams)
 }
 
+func TestRest_UserProfile(t *testing.T) {
+	ts, srv, teardown := startupT(t, func(srv *Rest) {
+		srv.DataService.ProfilePolicy = service.StaticProfilePolicyLister{
+			ProfilePolicy: service.ProfilePolicy{Enabled: true, UniqueNames: true, BannedNames: []string{"admin"}}}
+	})
+	defer teardown()
+
+	id := addComment(t, store.Comment{Text: "test 123", Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah1"}}, ts)
+
+	body, code := getWithDevAuth(t, ts.URL+"/api/v1/user/profile?site=remark42")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.JSONEq(t, `{"display_name":"","pronouns":""}`, body)
+
+	putProfile := func(tkn, profile string) (string, int) {
+		req, err := http.NewRequest(http.MethodPut, ts.URL+"/api/v1/user/profile?site=remark42", strings.NewReader(profile))
+		require.NoError(t, err)
+		resp, err := sendReq(t, req, tkn)
+		require.NoError(t, err)
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return string(b), resp.StatusCode
+	}
+
+	body, code = putProfile(devToken, `{"display_name":"Dev Nick","pronouns":"she/her"}`)
+	require.Equal(t, http.StatusOK, code, body)
+	assert.JSONEq(t, `{"display_name":"Dev Nick","pronouns":"she/her"}`, body)
+
+	body, code = getWithDevAuth(t, ts.URL+"/api/v1/id/"+id+"?site=remark42&url=https://radio-t.com/blah1")
+	require.Equal(t, http.StatusOK, code, body)
+	c := store.Comment{}
+	require.NoError(t, json.Unmarshal([]byte(body), &c))
+	assert.Equal(t, "Dev Nick", c.User.Name)
+	assert.Equal(t, "she/her", c.User.Pronouns)
+
+	body, code = putProfile(dev2Token, `{"display_name":"dev nick"}`)
+	assert.Equal(t, http.StatusBadRequest, code, body)
+	assert.Contains(t, body, `"code":21`)
+
+	body, code = putProfile(dev2Token, `{"display_name":"Admin"}`)
+	assert.Equal(t, http.StatusBadRequest, code, body)
+	assert.Contains(t, body, "display name is not allowed")
+
+	body, code = putProfile(dev2Token, `{"display_name":`)
+	assert.Equal(t, http.StatusBadRequest, code, body)
+
+	_, code = putProfile("", `{"display_name":"Some Name"}`)
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	srv.DataService.ProfilePolicy = service.StaticProfilePolicyLister{}
+	body, code = putProfile(dev2Token, `{"display_name":"Some Name"}`)
+	assert.Equal(t, http.StatusForbidden, code, body)
+}
+
+func TestRest_IgnoreUser(t *testing.T) {
+	ts, _, teardown := startupT(t)
+	defer teardown()
+
+	addComment(t, store.Comment{Text: "test 123", Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah1"}}, ts)
+
+	setIgnored := func(userID, ignore string) (string, int) {
+		req, err := http.NewRequest(http.MethodPut,
+			fmt.Sprintf("%s/api/v1/ignore/%s?site=remark42&ignore=%s", ts.URL, userID, ignore), http.NoBody)
+		require.NoError(t, err)
+		resp, err := sendReq(t, req, dev2Token)
+		require.NoError(t, err)
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return string(b), resp.StatusCode
+	}
+
+	body, code := setIgnored("provider1_dev", "1")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.JSONEq(t, `{"user_id":"provider1_dev","ignored":true}`, body)
+
+	body, code = getWithDev2Auth(t, ts.URL+"/api/v1/ignore?site=remark42")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.JSONEq(t, `{"ignored":["provider1_dev"]}`, body)
+
+	// ignored comment marked for the user who ignores
+	body, code = getWithDev2Auth(t, ts.URL+"/api/v1/find?site=remark42&url=https://radio-t.com/blah1&format=plain")
+	require.Equal(t, http.StatusOK, code, body)
+	comments := commentsWithInfo{}
+	require.NoError(t, json.Unmarshal([]byte(body), &comments))
+	require.Len(t, comments.Comments, 1)
+	assert.True(t, comments.Comments[0].Ignored)
+
+	// and not marked for others
+	body, code = getWithDevAuth(t, ts.URL+"/api/v1/find?site=remark42&url=https://radio-t.com/blah1&format=plain")
+	require.Equal(t, http.StatusOK, code, body)
+	comments = commentsWithInfo{}
+	require.NoError(t, json.Unmarshal([]byte(body), &comments))
+	require.Len(t, comments.Comments, 1)
+	assert.False(t, comments.Comments[0].Ignored)
+
+	body, code = setIgnored("provider1_dev2", "1")
+	assert.Equal(t, http.StatusBadRequest, code, body)
+
+	body, code = setIgnored("provider1_dev", "0")
+	require.Equal(t, http.StatusOK, code, body)
+	body, code = getWithDev2Auth(t, ts.URL+"/api/v1/ignore?site=remark42")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.JSONEq(t, `{"ignored":[]}`, body)
+
+	body, code = get(t, ts.URL+"/api/v1/ignore?site=remark42")
+	assert.Equal(t, http.StatusUnauthorized, code, body)
+}
+
+func TestRest_CreateStaffAndPrivate(t *testing.T) {
+	ts, _, teardown := startupT(t)
+	defer teardown()
+
+	parentID := addComment(t, store.Comment{Text: "test 123", Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah1"}}, ts)
+
+	create := func(tkn, body string) (store.Comment, int) {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/comment?site=remark42", strings.NewReader(body))
+		require.NoError(t, err)
+		resp, err := sendReq(t, req, tkn)
+		require.NoError(t, err)
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		c := store.Comment{}
+		if resp.StatusCode == http.StatusCreated {
+			require.NoError(t, json.Unmarshal(b, &c))
+		}
+		return c, resp.StatusCode
+	}
+
+	staff, code := create(adminUmputunToken, fmt.Sprintf(`{"text": "staff note", "pid": %q, "visibility": "staff",
+		"locator":{"url": "https://radio-t.com/blah1", "site": "remark42"}}`, parentID))
+	require.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, store.VisibilityStaff, staff.Visibility)
+
+	private, code := create(adminUmputunToken, fmt.Sprintf(`{"text": "private reply", "pid": %q, "visibility": "private",
+		"private_to": "someone", "locator":{"url": "https://radio-t.com/blah1", "site": "remark42"}}`, parentID))
+	require.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, "provider1_dev", private.PrivateTo, "private_to set from parent, not from request")
+
+	_, code = create(devToken, `{"text": "staff note", "visibility": "staff", "locator":{"url": "https://radio-t.com/blah1", "site": "remark42"}}`)
+	assert.Equal(t, http.StatusBadRequest, code, "non-admin can't post staff notes")
+
+	count := func(body string) int {
+		comments := commentsWithInfo{}
+		require.NoError(t, json.Unmarshal([]byte(body), &comments))
+		return len(comments.Comments)
+	}
+	url := ts.URL + "/api/v1/find?site=remark42&url=https://radio-t.com/blah1&format=plain"
+	body, code := get(t, url)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 1, count(body), "anonymous sees public only")
+	body, code = getWithDev2Auth(t, url)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 1, count(body), "other user sees public only")
+	body, code = getWithDevAuth(t, url)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 2, count(body), "parent author sees private reply")
+	body, code = getWithAdminAuth(t, url)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 3, count(body), "admin sees everything")
+
+	_, code = get(t, ts.URL+"/api/v1/id/"+staff.ID+"?site=remark42&url=https://radio-t.com/blah1")
+	assert.Equal(t, http.StatusBadRequest, code)
+	_, code = getWithDevAuth(t, ts.URL+"/api/v1/id/"+private.ID+"?site=remark42&url=https://radio-t.com/blah1")
+	assert.Equal(t, http.StatusOK, code)
+	_, code = getWithDev2Auth(t, ts.URL+"/api/v1/id/"+private.ID+"?site=remark42&url=https://radio-t.com/blah1")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
 func TestRest_UserAllData(t *testing.T) {
 	ts, srv, teardown := startupT(t)
 	defer teardown()
@@ -1596,6 +2035,51 @@ func TestRest_SavePictureCtrl(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
 }
 
+func TestRest_SavePictureCtrlWithAlt(t *testing.T) {
+	ts, _, teardown := startupT(t)
+	defer teardown()
+
+	savePic := func(alt string) (status int, m map[string]any) {
+		bodyBuf := &bytes.Buffer{}
+		bodyWriter := multipart.NewWriter(bodyBuf)
+		fileWriter, err := bodyWriter.CreateFormFile("file", "picture.png")
+		require.NoError(t, err)
+		_, err = io.Copy(fileWriter, gopherPNG())
+		require.NoError(t, err)
+		require.NoError(t, bodyWriter.WriteField("alt", alt))
+		require.NoError(t, bodyWriter.Close())
+
+		req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/api/v1/picture?site=remark42", ts.URL), bodyBuf)
+		require.NoError(t, err)
+		req.Header.Add("Content-Type", bodyWriter.FormDataContentType())
+		req.Header.Add("X-JWT", devToken)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		m = map[string]any{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&m))
+		return resp.StatusCode, m
+	}
+
+	status, m := savePic(" gopher  with\na hat ")
+	require.Equal(t, http.StatusOK, status)
+	assert.NotEmpty(t, m["id"])
+	assert.Equal(t, "gopher with a hat", m["alt"])
+	id, ok := m["id"].(string)
+	require.True(t, ok)
+
+	// alt text is not kept as a picture
+	resp, err := http.Get(fmt.Sprintf("%s/api/v1/picture/%s.alt", ts.URL, id))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.NotEqual(t, http.StatusOK, resp.StatusCode)
+
+	status, m = savePic(strings.Repeat("a", image.MaxAltLength+1))
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "alt text is too long", m["details"])
+	assert.EqualValues(t, rest.ErrDecode, m["code"])
+}
+
 func TestRest_CreateWithPictures(t *testing.T) {
 	ts, svc, teardown := startupT(t)
 	defer func() {
@@ -1719,3 +2203,637 @@ func TestExtractIP(t *testing.T) {
 		})
 	}
 }
+
+func TestRest_CreateNotAllowedLanguage(t *testing.T) {
+	ts, _, teardown := startupT(t, func(srv *Rest) {
+		srv.DataService.LanguagePolicy = service.StaticLanguagePolicyLister{
+			LanguagePolicy: service.LanguagePolicy{Allowed: []string{"en"}, Reject: true}}
+	})
+	defer teardown()
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/comment?site=remark42", strings.NewReader(
+		`{"text": "Это очень интересный выпуск, спасибо", "locator":{"url": "https://radio-t.com/blah1", "site": "remark42"}}`))
+	require.NoError(t, err)
+	resp, err := sendReq(t, req, devToken)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, string(body))
+	assert.Contains(t, string(body), `"code":22`)
+}
+
+func TestRest_UserLevel(t *testing.T) {
+	ts, _, teardown := startupT(t, func(srv *Rest) {
+		srv.DataService.LevelPolicy = service.StaticLevelPolicyLister{LevelPolicy: service.LevelPolicy{MemberComments: 1}}
+	})
+	defer teardown()
+
+	userLevel := func() string {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/user?site=remark42", http.NoBody)
+		require.NoError(t, err)
+		resp, err := sendReq(t, req, devToken)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		user := store.User{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&user))
+		return user.Level
+	}
+	assert.Equal(t, "new", userLevel())
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/comment?site=remark42", strings.NewReader(
+		`{"text": "test 123", "locator":{"url": "https://radio-t.com/blah1", "site": "remark42"}}`))
+	require.NoError(t, err)
+	resp, err := sendReq(t, req, devToken)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "member", userLevel())
+
+	body, code := get(t, ts.URL+"/api/v1/find?site=remark42&url=https://radio-t.com/blah1&format=plain")
+	require.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, `"level":"member"`)
+}
+
+func TestRest_Permissions(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	permissions := func(url, token string) (res threadPermissions) {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/permissions?site=remark42&url="+url, http.NoBody)
+		require.NoError(t, err)
+		client := &http.Client{Timeout: 5 * time.Second}
+		if token != "" {
+			req.Header.Add("X-JWT", token)
+		}
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+		return res
+	}
+
+	assert.Equal(t, threadPermissions{Reason: "auth", Editable: map[string]int{}}, permissions("https://radio-t.com/blah1", ""))
+
+	id := addComment(t, store.Comment{Text: "test 123", Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah1"}}, ts)
+	res := permissions("https://radio-t.com/blah1", devToken)
+	assert.True(t, res.Authenticated)
+	assert.True(t, res.Post)
+	assert.True(t, res.Vote)
+	assert.True(t, res.UploadImages)
+	assert.False(t, res.Moderate)
+	assert.Empty(t, res.Reason)
+	require.Contains(t, res.Editable, id)
+	assert.InDelta(t, 300, res.Editable[id], 5, "default 5m edit window")
+
+	res = permissions("https://radio-t.com/blah1", anonToken)
+	assert.True(t, res.Post)
+	assert.False(t, res.Vote, "anonymous votes disabled")
+	assert.False(t, res.UploadImages)
+	assert.Empty(t, res.Editable, "comment of another user")
+
+	res = permissions("https://radio-t.com/blah1", adminUmputunToken)
+	assert.True(t, res.Moderate)
+
+	require.NoError(t, srv.DataService.SetReadOnly(store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah1"}, true))
+	res = permissions("https://radio-t.com/blah1", devToken)
+	assert.False(t, res.Post)
+	assert.False(t, res.Vote)
+	assert.Equal(t, "read_only", res.Reason)
+	assert.Contains(t, res.Editable, id, "own comments editable in read-only thread")
+
+	require.NoError(t, srv.DataService.SetBlock("remark42", "provider1_dev", true, 0))
+	res = permissions("https://radio-t.com/blah2", devToken)
+	assert.False(t, res.Post)
+	assert.Equal(t, "blocked", res.Reason)
+
+	srv.privRest.subscribersOnly = true
+	res = permissions("https://radio-t.com/blah1", devToken)
+	assert.Equal(t, "subscribers_only", res.Reason)
+	assert.Empty(t, res.Editable)
+}
+
+func TestRest_CreateGeoBlocked(t *testing.T) {
+	ts, _, teardown := startupT(t, func(srv *Rest) {
+		srv.DataService.GeoLocator = geoLocatorMock{Country: "XX"}
+		srv.DataService.GeoPolicy = service.StaticGeoPolicyLister{Default: service.GeoPolicy{BlockCountries: []string{"XX"}}}
+	})
+	defer teardown()
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/comment?site=remark42", strings.NewReader(
+		`{"text": "test 123", "locator":{"url": "https://radio-t.com/blah1", "site": "remark42"}}`))
+	require.NoError(t, err)
+	resp, err := sendReq(t, req, devToken)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode, string(body))
+	assert.Contains(t, string(body), `"code":29`)
+}
+
+func TestRest_CreateExitNodeBlocked(t *testing.T) {
+	ts, _, teardown := startupT(t, func(srv *Rest) {
+		srv.DataService.TorExits = ipMatcherMock{}
+		srv.DataService.ExitNodePolicy = service.StaticExitNodePolicyLister{
+			Default: service.ExitNodePolicy{Tor: service.NetworkBlock}}
+	})
+	defer teardown()
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/comment?site=remark42", strings.NewReader(
+		`{"text": "test 123", "locator":{"url": "https://radio-t.com/blah1", "site": "remark42"}}`))
+	require.NoError(t, err)
+	resp, err := sendReq(t, req, devToken)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode, string(body))
+	assert.Contains(t, string(body), `"code":30`)
+}
+
+func TestRest_CreateRiskyIP(t *testing.T) {
+	pow := rest.NewPoW("secret", 4, time.Minute)
+	ts, srv, teardown := startupT(t, func(srv *Rest) {
+		srv.PoW = pow
+		srv.DataService.DNSBL = ipMatcherMock{}
+		srv.DataService.RiskPolicy = service.StaticRiskPolicyLister{RiskPolicy: service.RiskPolicy{Action: service.NetworkBlock}}
+	})
+	defer teardown()
+
+	post := func(challenge string) (string, int) {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/comment?site=remark42", strings.NewReader(
+			`{"text": "test 123", "locator":{"url": "https://radio-t.com/blah1", "site": "remark42"}}`))
+		require.NoError(t, err)
+		if challenge != "" {
+			req.Header.Set(rest.PoWChallengeHeader, challenge)
+			req.Header.Set(rest.PoWSolutionHeader, rest.SolvePoW(challenge, 4))
+		}
+		resp, err := sendReq(t, req, devToken)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return string(body), resp.StatusCode
+	}
+
+	body, code := post("")
+	assert.Equal(t, http.StatusForbidden, code, body)
+	assert.Contains(t, body, `"code":33`)
+
+	// proof-of-work required from risky ips
+	srv.DataService.RiskPolicy = service.StaticRiskPolicyLister{RiskPolicy: service.RiskPolicy{Challenge: true}}
+	body, code = post("")
+	assert.Equal(t, http.StatusForbidden, code, body)
+	assert.Contains(t, body, `"code":28`)
+
+	challenge, err := pow.Challenge()
+	require.NoError(t, err)
+	body, code = post(challenge)
+	assert.Equal(t, http.StatusCreated, code, body)
+
+	srv.DataService.DNSBL = nil
+	body, code = post("")
+	assert.Equal(t, http.StatusCreated, code, body, "ip not risky")
+}
+
+func TestRest_CreateNewUserCaptcha(t *testing.T) {
+	verify := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `{"success":%v}`, r.FormValue("response") == "good")
+	}))
+	defer verify.Close()
+	ts, srv, teardown := startupT(t, func(srv *Rest) {
+		srv.Captcha = &rest.Captcha{Type: "hcaptcha", Secret: "secret", VerifyURL: verify.URL}
+		srv.NewUserCaptcha = true
+	})
+	defer teardown()
+
+	post := func(token string) (string, int) {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/comment?site=remark42", strings.NewReader(
+			`{"text": "test 123", "locator":{"url": "https://radio-t.com/blah1", "site": "remark42"}}`))
+		require.NoError(t, err)
+		req.Header.Set(rest.CaptchaHeader, token)
+		resp, err := sendReq(t, req, devToken)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return string(body), resp.StatusCode
+	}
+
+	body, code := post("")
+	assert.Equal(t, http.StatusForbidden, code, body)
+	assert.Contains(t, body, `"code":35`)
+	body, code = post("bad")
+	assert.Equal(t, http.StatusForbidden, code, body)
+	body, code = post("good")
+	assert.Equal(t, http.StatusCreated, code, body, "first comment with captcha")
+	body, code = post("")
+	assert.Equal(t, http.StatusCreated, code, body, "not the first comment")
+
+	srv.NewUserCaptcha = false
+	srv.AnonCaptcha = true
+	resp, err := http.Get(ts.URL + "/auth/anonymous/login?user=blah123&aud=remark42")
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode, "anonymous login without captcha")
+}
+
+func TestRest_ServiceToken(t *testing.T) {
+	ts, _, teardown := startupT(t)
+	body, code := getWithDevAuth(t, ts.URL+"/api/v1/token?site=remark42")
+	assert.Equal(t, http.StatusNotFound, code, body, "disabled")
+	_, code = get(t, ts.URL+"/.well-known/jwks.json")
+	assert.Equal(t, http.StatusNotFound, code, "no keys published")
+	teardown()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	keyFile := filepath.Join(t.TempDir(), "jwt.pem")
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+	jwks, err := rest.NewJWKS(time.Minute, keyFile)
+	require.NoError(t, err)
+
+	ts, _, teardown = startupT(t, func(srv *Rest) { srv.JWKS = jwks })
+	defer teardown()
+
+	_, code = get(t, ts.URL+"/api/v1/token?site=remark42")
+	assert.Equal(t, http.StatusUnauthorized, code, "auth required")
+	body, code = getWithDevAuth(t, ts.URL+"/api/v1/token?site=remark42")
+	require.Equal(t, http.StatusOK, code, body)
+	res := struct {
+		Token   string    `json:"token"`
+		Expires time.Time `json:"expires"`
+	}{}
+	require.NoError(t, json.Unmarshal([]byte(body), &res))
+	assert.WithinDuration(t, time.Now().Add(time.Minute), res.Expires, 5*time.Second)
+	claims, err := jwks.Parse(res.Token)
+	require.NoError(t, err)
+	assert.Equal(t, "provider1_dev", claims.Subject)
+	assert.Equal(t, jwt.ClaimStrings{"remark42"}, claims.Audience)
+	assert.Equal(t, "developer one", claims.User.Name)
+
+	body, code = get(t, ts.URL+"/.well-known/jwks.json")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.Contains(t, body, `"alg":"ES256"`)
+}
+
+func TestRest_CreateWithPageCheck(t *testing.T) {
+	cms := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer cms.Close()
+	ts, _, teardown := startupT(t, func(srv *Rest) {
+		srv.DataService.PageChecker = service.NewPageWebhook(map[string]string{"remark42": cms.URL}, http.Client{Timeout: time.Second}, 0, false)
+	})
+	defer teardown()
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/comment?site=remark42", strings.NewReader(
+		`{"text": "test 123", "locator":{"url": "https://radio-t.com/nonexistent", "site": "remark42"}}`))
+	require.NoError(t, err)
+	resp, err := sendReq(t, req, devToken)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode, string(body))
+	assert.Contains(t, string(body), `"code":5`)
+}
+
+// ipMatcherMock matches any ip
+type ipMatcherMock struct{}
+
+func (ipMatcherMock) Contains(string) bool { return true }
+
+type geoLocatorMock geoip.Info
+
+func (m geoLocatorMock) Lookup(string) (geoip.Info, error) { return geoip.Info(m), nil }
+
+func TestRest_CreateAndUpdateWithContentPolicy(t *testing.T) {
+	ts, _, teardown := startupT(t, func(srv *Rest) {
+		srv.DataService.ContentPolicy = service.StaticContentPolicyLister{
+			ContentPolicy: service.ContentPolicy{MinLength: 5, MaxLength: 50, MaxLinks: 1, MaxImages: 1, MaxQuoteRatio: 0.5}}
+	})
+	defer teardown()
+
+	send := func(method, url, body string) (code int, respBody string) {
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		require.NoError(t, err)
+		resp, err := sendReq(t, req, devToken)
+		require.NoError(t, err)
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp.StatusCode, string(b)
+	}
+
+	tbl := []struct {
+		text    string
+		errCode int
+	}{
+		{"tiny", 23},
+		{strings.Repeat("long ", 11), 24},
+		{"[a](http://a.com) [b](http://b.com)", 25},
+		{"![a](http://a.com/1.png) ![b](http://b.com/2.png)", 26},
+		{"> long quoted text\n\nmy reply", 27},
+		{"[a](relative-url)", 4},
+	}
+	for _, tt := range tbl {
+		code, body := send(http.MethodPost, ts.URL+"/api/v1/comment?site=remark42",
+			fmt.Sprintf(`{"text": %q, "locator":{"url": "https://radio-t.com/blah1", "site": "remark42"}}`, tt.text))
+		assert.Equal(t, http.StatusBadRequest, code, body)
+		assert.Contains(t, body, fmt.Sprintf(`"code":%d`, tt.errCode), tt.text)
+	}
+
+	id := addComment(t, store.Comment{Text: "good comment", Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah1"}}, ts)
+	code, body := send(http.MethodPut, ts.URL+"/api/v1/comment/"+id+"?site=remark42&url=https://radio-t.com/blah1",
+		`{"text":"[a](http://a.com) [b](http://b.com)"}`)
+	assert.Equal(t, http.StatusBadRequest, code, body)
+	assert.Contains(t, body, `"code":25`)
+
+	code, body = send(http.MethodPut, ts.URL+"/api/v1/comment/"+id+"?site=remark42&url=https://radio-t.com/blah1",
+		`{"text":"updated comment"}`)
+	assert.Equal(t, http.StatusOK, code, body)
+
+	code, body = send(http.MethodPut, ts.URL+"/api/v1/comment/"+id+"?site=remark42&url=https://radio-t.com/blah1",
+		`{"delete":true}`)
+	assert.Equal(t, http.StatusOK, code, body)
+}
+
+func TestRest_CreateFirstCommentNewMember(t *testing.T) {
+	ts, _, teardown := startupT(t, func(srv *Rest) {
+		srv.DataService.WelcomePolicy = service.StaticWelcomePolicyLister{
+			WelcomePolicy: service.WelcomePolicy{Enabled: true, Message: "welcome, {{.UserName}}"}}
+	})
+	defer teardown()
+
+	create := func() store.Comment {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/comment?site=remark42", strings.NewReader(
+			`{"text": "test 123", "locator":{"url": "https://radio-t.com/blah1", "site": "remark42"}}`))
+		require.NoError(t, err)
+		resp, err := sendReq(t, req, devToken)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		require.Equal(t, http.StatusCreated, resp.StatusCode, string(body))
+		c := store.Comment{}
+		require.NoError(t, json.Unmarshal(body, &c))
+		return c
+	}
+
+	assert.True(t, create().NewMember, "first comment")
+	assert.False(t, create().NewMember, "second comment")
+}
+
+func TestRest_CreateLateComment(t *testing.T) {
+	ts, srv, teardown := startupT(t, func(srv *Rest) {
+		srv.DataService.LatePolicy = service.StaticLatePolicyLister{LatePolicy: service.LatePolicy{Months: 6, SuppressNotify: true}}
+		srv.ReadOnlyAge = 0 // allow comments on old posts
+	})
+	defer teardown()
+
+	_, err := srv.DataService.Create(store.Comment{Text: "old one", User: store.User{ID: "u1", Name: "u1"},
+		Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah1"}, Timestamp: time.Now().AddDate(-1, 0, 0)})
+	require.NoError(t, err)
+
+	create := func(url string) store.Comment {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/comment?site=remark42", strings.NewReader(
+			`{"text": "test 123", "locator":{"url": "`+url+`", "site": "remark42"}}`))
+		require.NoError(t, err)
+		resp, err := sendReq(t, req, devToken)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		require.Equal(t, http.StatusCreated, resp.StatusCode, string(body))
+		c := store.Comment{}
+		require.NoError(t, json.Unmarshal(body, &c))
+		return c
+	}
+
+	assert.True(t, create("https://radio-t.com/blah1").Late, "thread started a year ago")
+	assert.False(t, create("https://radio-t.com/blah2").Late, "new thread")
+}
+
+func TestRest_AcceptInvite(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	accept := func(id, tkn string) (*http.Response, string) {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/invite/accept?site=remark42&id="+id, http.NoBody)
+		require.NoError(t, err)
+		resp, err := sendReq(t, req, tkn)
+		require.NoError(t, err)
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp, string(b)
+	}
+
+	resp, _ := accept("id", devToken)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "invitations disabled")
+
+	var err error
+	srv.DataService.InviteStore, err = invite.NewBoltStorage(t.TempDir()+"/invites.db", bolt.Options{})
+	require.NoError(t, err)
+	inv, err := srv.DataService.CreateInvite("admin", "", []string{"remark42"}, time.Hour)
+	require.NoError(t, err)
+
+	resp, _ = accept(inv.ID, "")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp, _ = accept(inv.ID, anonToken)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode, "anonymous rejected")
+	resp, _ = accept("unknown", devToken)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, body := accept(inv.ID, devToken)
+	require.Equal(t, http.StatusOK, resp.StatusCode, body)
+	assert.Contains(t, body, `"user_id":"provider1_dev"`)
+	assert.True(t, srv.DataService.IsAdmin("remark42", "provider1_dev"))
+	var jwt string
+	for _, c := range resp.Cookies() {
+		if c.Name == "JWT" {
+			jwt = c.Value
+		}
+	}
+	require.NotEmpty(t, jwt, "token updated")
+	claims, err := srv.Authenticator.TokenService().Parse(jwt)
+	require.NoError(t, err)
+	assert.True(t, claims.User.IsAdmin())
+
+	resp, _ = accept(inv.ID, dev2Token)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "accepted once")
+	assert.False(t, srv.DataService.IsAdmin("remark42", "provider1_dev2"))
+}
+
+func TestRest_LinkUser(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	send := func(method, url, body, tkn string) (*http.Response, string) {
+		req, err := http.NewRequest(method, ts.URL+url, strings.NewReader(body))
+		require.NoError(t, err)
+		resp, err := sendReq(t, req, tkn)
+		require.NoError(t, err)
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp, string(b)
+	}
+
+	resp, _ := send(http.MethodPost, "/api/v1/link?site=remark42", "", "")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp, _ = send(http.MethodPost, "/api/v1/link?site=remark42", "", anonToken)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode, "anonymous rejected")
+
+	resp, body := send(http.MethodPost, "/api/v1/link?site=remark42", "", devToken)
+	require.Equal(t, http.StatusOK, resp.StatusCode, body)
+	linkToken := struct{ Token string }{}
+	require.NoError(t, json.Unmarshal([]byte(body), &linkToken))
+	require.NotEmpty(t, linkToken.Token)
+
+	resp, _ = send(http.MethodPost, "/api/v1/link/confirm?site=remark42", `{"token":"bad"}`, dev2Token)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp, _ = send(http.MethodPost, "/api/v1/link/confirm?site=other", `{"token":"`+linkToken.Token+`"}`, dev2Token)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode, "user of other site")
+	resp, _ = send(http.MethodPost, "/api/v1/link/confirm?site=remark42", `{"token":"`+linkToken.Token+`"}`, devToken)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "can't link to itself")
+
+	resp, body = send(http.MethodPost, "/api/v1/link/confirm?site=remark42", `{"token":"`+linkToken.Token+`"}`, dev2Token)
+	require.Equal(t, http.StatusOK, resp.StatusCode, body)
+	assert.Equal(t, `{"linked_to":"provider1_dev","user_id":"provider1_dev2"}`+"\n", body)
+	var jwt string
+	for _, c := range resp.Cookies() {
+		if c.Name == "JWT" {
+			jwt = c.Value
+		}
+	}
+	require.NotEmpty(t, jwt, "token updated")
+	claims, err := srv.Authenticator.TokenService().Parse(jwt)
+	require.NoError(t, err)
+	assert.Equal(t, "provider1_dev", claims.User.ID)
+
+	resp, body = send(http.MethodGet, "/api/v1/links?site=remark42", "", devToken)
+	require.Equal(t, http.StatusOK, resp.StatusCode, body)
+	assert.Equal(t, `["provider1_dev2"]`+"\n", body)
+
+	resp, _ = send(http.MethodDelete, "/api/v1/link/provider1_dev2?site=remark42", "", emailUserToken)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode, "not linked to the user")
+	resp, body = send(http.MethodDelete, "/api/v1/link/provider1_dev2?site=remark42", "", devToken)
+	require.Equal(t, http.StatusOK, resp.StatusCode, body)
+	linked, err := srv.DataService.LinkedUser("remark42", "provider1_dev2")
+	require.NoError(t, err)
+	assert.Empty(t, linked)
+}
+
+func TestRest_LogoutAll(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/logout/all?site=remark42", http.NoBody)
+	require.NoError(t, err)
+	resp, err := sendReq(t, req, "")
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	req, err = http.NewRequest(http.MethodPost, ts.URL+"/api/v1/logout/all?site=remark42", http.NoBody)
+	require.NoError(t, err)
+	resp, err = sendReq(t, req, devToken)
+	require.NoError(t, err)
+	res := struct {
+		UserID    string    `json:"user_id"`
+		NotBefore time.Time `json:"not_before"`
+	}{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "provider1_dev", res.UserID)
+	assert.WithinDuration(t, time.Now(), res.NotBefore, 2*time.Second)
+	reset := false
+	for _, c := range resp.Cookies() {
+		if c.Name == "JWT" && c.MaxAge < 0 {
+			reset = true
+		}
+	}
+	assert.True(t, reset, "token of this device reset")
+
+	notBefore, err := srv.DataService.TokensNotBefore("remark42", "provider1_dev")
+	require.NoError(t, err)
+	assert.True(t, res.NotBefore.Equal(notBefore))
+	assert.True(t, srv.DataService.IsTokenRevoked("remark42", "provider1_dev", time.Now().Add(-time.Minute)))
+}
+
+func TestRest_InvitePage(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	body, code := get(t, ts.URL+"/invite.html?id=unknown")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "Invitation not found")
+
+	var err error
+	srv.DataService.InviteStore, err = invite.NewBoltStorage(t.TempDir()+"/invites.db", bolt.Options{})
+	require.NoError(t, err)
+	inv, err := srv.DataService.CreateInvite("admin", "", []string{"remark42", "blog"}, time.Hour)
+	require.NoError(t, err)
+
+	body, code = get(t, ts.URL+"/invite.html?id="+inv.ID)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "You are invited as admin of <b>blog</b>, <b>remark42</b>.")
+	assert.Contains(t, body, `var id = "`+inv.ID+`", sites = ["blog","remark42"];`)
+
+	_, err = srv.DataService.AcceptInvite(inv.ID, "provider1_dev")
+	require.NoError(t, err)
+	body, code = get(t, ts.URL+"/invite.html?id="+inv.ID)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "Invitation already accepted")
+	assert.NotContains(t, body, "<script>")
+}
+
+func TestRest_TokenOfPreviousSecret(t *testing.T) {
+	previous := token.NewService(token.Opts{SecretReader: token.SecretFunc(func(string) (string, error) { return "old secret", nil }),
+		TokenDuration: time.Hour})
+	_, err := previous.Parse(devToken)
+	require.Error(t, err, "dev token signed with the current secret")
+	claims, err := token.NewService(token.Opts{SecretReader: token.SecretFunc(func(string) (string, error) { return "secret", nil })}).Parse(devToken)
+	require.NoError(t, err)
+	oldToken, err := previous.Token(claims)
+	require.NoError(t, err)
+
+	getUser := func(url string) (*http.Response, error) {
+		req, e := http.NewRequest("GET", url+"/api/v1/user?site=remark42", http.NoBody)
+		require.NoError(t, e)
+		return sendReq(t, req, oldToken)
+	}
+
+	ts, _, teardown := startupT(t)
+	resp, err := getUser(ts.URL)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "no rotation")
+	teardown()
+
+	ts, _, teardown = startupT(t, func(srv *Rest) {
+		srv.TokenRotation = rest.NewTokenRotation(srv.Authenticator.TokenService(), "old secret", time.Now().Add(time.Hour))
+	})
+	defer teardown()
+	resp, err = getUser(ts.URL)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "accepted during the grace window")
+	var jwtCookie string
+	for _, c := range resp.Cookies() {
+		if c.Name == "JWT" {
+			jwtCookie = c.Value
+		}
+	}
+	require.NotEmpty(t, jwtCookie, "re-signed token set")
+	_, err = previous.Parse(jwtCookie)
+	assert.Error(t, err, "signed with the current secret")
+}
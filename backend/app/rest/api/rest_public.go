@@ -5,6 +5,7 @@ import (
 	"crypto/sha1" // nolint
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -21,16 +22,22 @@ import (
 
 	"github.com/umputun/remark42/backend/app/rest"
 	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/asset"
 	"github.com/umputun/remark42/backend/app/store/image"
+	"github.com/umputun/remark42/backend/app/store/page"
+	"github.com/umputun/remark42/backend/app/store/poll"
 	"github.com/umputun/remark42/backend/app/store/service"
 )
 
 type public struct {
 	dataService      pubStore
 	cache            LoadingCache
+	cdnMaxAge        time.Duration
 	readOnlyAge      int
 	commentFormatter *store.CommentFormatter
 	imageService     *image.Service
+	publishBlocklist bool
+	live             *liveHub
 }
 
 type pubStore interface {
@@ -47,11 +54,22 @@ type pubStore interface {
 	ValidateComment(c *store.Comment) error
 	IsReadOnly(locator store.Locator) bool
 	Counts(siteID string, postIDs []string) ([]store.PostInfo, error)
+	PollResults(locator store.Locator, user store.User) (*poll.Results, error)
+	Highlights(siteID, url string, limit int, user store.User) ([]service.HighlightedComment, error)
+	PublishedBlocklist(siteID string) ([]service.ModeratedUser, error)
+	Asset(siteID, name string) (asset.Asset, error)
+	PageSettings(locator store.Locator) page.Settings
+	PrintThread(locator store.Locator, filter string) ([]byte, error)
+	CollapseComments(siteID string, comments []store.Comment, user store.User) []store.Comment
 }
 
-// GET /find?site=siteID&url=post-url&format=[tree|plain]&sort=[+/-time|+/-score|+/-controversy]&view=[user|all]&since=unix_ts_msec&limit=100&offset_id={id}
+// GET /find?site=siteID&url=post-url&format=[tree|plain]&sort=[+/-time|+/-score|+/-controversy|controversial]&view=[user|all]&since=unix_ts_msec&limit=100&offset_id={id}
 // find comments for given post. Returns in tree or plain formats, sorted.
 //
+// Optional filters: `until=unix_ts_msec` for comments created before, `top=1` for top-level comments only,
+// `verified=1` for comments of verified users only, `min_score=N` to exclude comments scored below N
+// and `user=userID` for comments of the user only. In tree format replies of filtered out comments are dropped.
+//
 // When `url` parameter is not set (e.g. request is for site-wide comments), does not return deleted comments.
 //
 // When `limit` is set, first {limit} comments are returned. When `offset_id` is set, comments are returned starting
@@ -67,6 +85,12 @@ func (s *public) findCommentsCtrl(w http.ResponseWriter, r *http.Request) {
 	if strings.HasPrefix(sort, " ") { // restore + replaced by " "
 		sort = "+" + sort[1:]
 	}
+	if sort == "" { // order pinned by site owner, if any
+		sort = s.dataService.PageSettings(locator).Sort
+	}
+	if sort == page.ControversialSort {
+		sort = "-controversy"
+	}
 
 	view := r.URL.Query().Get("view")
 	since, err := s.parseSince(r)
@@ -74,6 +98,11 @@ func (s *public) findCommentsCtrl(w http.ResponseWriter, r *http.Request) {
 		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't parse since", rest.ErrCommentNotFound)
 		return
 	}
+	filter, err := parseFindFilter(r)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't parse filter", rest.ErrCommentNotFound)
+		return
+	}
 	format := r.URL.Query().Get("format")
 	if format == "tree" {
 		since = time.Time{} // since doesn't make sense for tree
@@ -104,6 +133,7 @@ func (s *public) findCommentsCtrl(w http.ResponseWriter, r *http.Request) {
 		if e != nil {
 			comments = []store.Comment{} // error should clear comments and continue for post info
 		}
+		comments = s.dataService.CollapseComments(locator.SiteID, filter.apply(comments), rest.GetUserOrEmpty(r))
 		comments = s.applyView(comments, view)
 
 		var commentsInfo store.PostInfo
@@ -111,7 +141,7 @@ func (s *public) findCommentsCtrl(w http.ResponseWriter, r *http.Request) {
 			commentsInfo = info
 		}
 
-		if !since.IsZero() { // if since is set, number of comments can be different from total in the DB
+		if !since.IsZero() || filter.active() { // if since or filter set, number of comments can be different from total in the DB
 			commentsInfo.Count = 0
 			for _, c := range comments {
 				if !c.Deleted {
@@ -125,10 +155,17 @@ func (s *public) findCommentsCtrl(w http.ResponseWriter, r *http.Request) {
 			commentsInfo.ReadOnly = true
 		}
 
+		var pollResults *poll.Results
+		if locator.URL != "" {
+			if pollResults, e = s.dataService.PollResults(locator, rest.GetUserOrEmpty(r)); e != nil {
+				log.Printf("[WARN] can't get poll for %+v, %v", locator, e)
+			}
+		}
+
 		var b []byte
 		switch format {
 		case "tree":
-			withInfo := treeWithInfo{Tree: service.MakeTree(comments, sort, limit, offsetID), Info: commentsInfo}
+			withInfo := treeWithInfo{Tree: service.MakeTree(comments, sort, limit, offsetID), Info: commentsInfo, Poll: pollResults}
 			withInfo.Info.CountLeft = withInfo.CountLeft()
 			withInfo.Info.LastComment = withInfo.LastComment()
 			if withInfo.Nodes == nil { // eliminate json nil serialization
@@ -142,7 +179,7 @@ func (s *public) findCommentsCtrl(w http.ResponseWriter, r *http.Request) {
 			if limit > 0 && len(comments) > 0 {
 				commentsInfo.LastComment = comments[len(comments)-1].ID
 			}
-			withInfo := commentsWithInfo{Comments: comments, Info: commentsInfo}
+			withInfo := commentsWithInfo{Comments: comments, Info: commentsInfo, Poll: pollResults}
 			b, e = encodeJSONWithHTML(withInfo)
 		}
 		return b, e
@@ -153,11 +190,151 @@ func (s *public) findCommentsCtrl(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setCDNHeaders(w, r, s.cdnMaxAge, locator.SiteID, locator.URL)
 	if err = R.RenderJSONFromBytes(w, r, data); err != nil {
 		log.Printf("[WARN] can't render comments for post %+v", locator)
 	}
 }
 
+const (
+	defaultLiveLimit = 50  // comments of live feed if limit not set
+	maxLiveLimit     = 200 // max comments of live feed
+	liveMaxAge       = 5   // seconds the live feed can be cached by clients and proxies
+	liveKeepAlive    = 30 * time.Second
+)
+
+// GET /live?site=siteID&url=post-url&before=cursor&after=cursor&limit=50 - newest-first feed of the post in live-blog mode.
+// Cursors are timestamps of comments in unix nanoseconds, `before` pages to older comments and `after` returns
+// the oldest {limit} comments newer than the cursor, so frequent polling never skips comments.
+// Deleted comments are not returned. The response can be cached for a few seconds.
+func (s *public) liveCommentsCtrl(w http.ResponseWriter, r *http.Request) {
+	locator := store.Locator{SiteID: r.URL.Query().Get("site"), URL: r.URL.Query().Get("url")}
+	if !s.dataService.PageSettings(locator).Live {
+		rest.SendErrorJSON(w, r, http.StatusNotFound, errors.New("live mode is off"), "post is not live", rest.ErrPostNotFound)
+		return
+	}
+
+	parseCursor := func(name string) (time.Time, error) {
+		val := r.URL.Query().Get(name)
+		if val == "" {
+			return time.Time{}, nil
+		}
+		ts, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("bad %s cursor %q: %w", name, val, err)
+		}
+		return time.Unix(0, ts), nil
+	}
+	before, err := parseCursor("before")
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't parse cursor", rest.ErrCommentNotFound)
+		return
+	}
+	after, err := parseCursor("after")
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't parse cursor", rest.ErrCommentNotFound)
+		return
+	}
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultLiveLimit
+	}
+	limit = min(limit, maxLiveLimit)
+
+	key := cache.NewKey(locator.SiteID).ID(URLKeyWithUser(r)).Scopes(locator.SiteID, locator.URL)
+	data, err := s.cache.Get(key, func() ([]byte, error) {
+		comments, e := s.dataService.FindSince(locator, "-time", rest.GetUserOrEmpty(r), time.Time{})
+		if e != nil {
+			comments = []store.Comment{} // live post without comments yet
+		}
+		res := struct {
+			Comments []store.Comment `json:"comments"`
+			Newest   string          `json:"newest,omitempty"` // cursor to poll newer comments
+			Oldest   string          `json:"oldest,omitempty"` // cursor to load older comments
+			HasMore  bool            `json:"has_more"`         // more comments left in the requested direction
+		}{Comments: []store.Comment{}}
+
+		for _, c := range comments {
+			if c.Deleted || (!before.IsZero() && !c.Timestamp.Before(before)) || (!after.IsZero() && !c.Timestamp.After(after)) {
+				continue
+			}
+			res.Comments = append(res.Comments, c)
+		}
+		if len(res.Comments) > limit {
+			res.HasMore = true
+			if after.IsZero() {
+				res.Comments = res.Comments[:limit]
+			} else { // keep comments right after the cursor, the rest will be returned by the next poll
+				res.Comments = res.Comments[len(res.Comments)-limit:]
+			}
+		}
+		if len(res.Comments) > 0 {
+			res.Newest = strconv.FormatInt(res.Comments[0].Timestamp.UnixNano(), 10)
+			res.Oldest = strconv.FormatInt(res.Comments[len(res.Comments)-1].Timestamp.UnixNano(), 10)
+		}
+		return encodeJSONWithHTML(res)
+	})
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't get live comments", rest.ErrCommentNotFound)
+		return
+	}
+
+	cacheScope := "public"
+	if _, e := rest.GetUserInfo(r); e == nil {
+		cacheScope = "private" // response has votes of the user
+	}
+	w.Header().Set("Cache-Control", fmt.Sprintf("%s, max-age=%d", cacheScope, liveMaxAge))
+	w.Header().Set("Vary", "Authorization, Cookie, X-JWT")
+	if err = R.RenderJSONFromBytes(w, r, data); err != nil {
+		log.Printf("[WARN] can't render live comments for post %+v", locator)
+	}
+}
+
+// GET /live/stream?site=siteID&url=post-url - server-sent events with new comments of the post in live-blog mode.
+// Each new comment sent as "comment" event with the comment in data, as anonymous reader sees it.
+func (s *public) liveStreamCtrl(w http.ResponseWriter, r *http.Request) {
+	locator := store.Locator{SiteID: r.URL.Query().Get("site"), URL: r.URL.Query().Get("url")}
+	if !s.dataService.PageSettings(locator).Live {
+		rest.SendErrorJSON(w, r, http.StatusNotFound, errors.New("live mode is off"), "post is not live", rest.ErrPostNotFound)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, errors.New("streaming not supported"), "can't stream", rest.ErrInternal)
+		return
+	}
+	events, cancel, err := s.live.subscribe(locator)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusServiceUnavailable, err, "can't subscribe", rest.ErrInternal)
+		return
+	}
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // disable buffering of nginx
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, "retry: 5000\n\n")
+	flusher.Flush()
+
+	ticker := time.NewTicker(liveKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			_, err = fmt.Fprint(w, ": ping\n\n")
+		case data := <-events:
+			_, err = fmt.Fprintf(w, "event: comment\ndata: %s\n\n", bytes.TrimSpace(data))
+		}
+		if err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
 // GET /info?site=siteID&url=post-url - get info about the post
 func (s *public) infoCtrl(w http.ResponseWriter, r *http.Request) {
 	locator := store.Locator{SiteID: r.URL.Query().Get("site"), URL: r.URL.Query().Get("url")}
@@ -176,11 +353,99 @@ func (s *public) infoCtrl(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setCDNHeaders(w, r, s.cdnMaxAge, locator.SiteID, locator.URL)
 	if err = R.RenderJSONFromBytes(w, r, data); err != nil {
 		log.Printf("[WARN] can't render info for post %+v", locator)
 	}
 }
 
+// GET /poll?site=siteID&url=post-url - poll results of the post, with option voted by the current user
+func (s *public) pollCtrl(w http.ResponseWriter, r *http.Request) {
+	locator := store.Locator{SiteID: r.URL.Query().Get("site"), URL: r.URL.Query().Get("url")}
+	res, err := s.dataService.PollResults(locator, rest.GetUserOrEmpty(r))
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't get poll", rest.ErrPostNotFound)
+		return
+	}
+	if res == nil {
+		rest.SendErrorJSON(w, r, http.StatusNotFound, poll.ErrNotFound, "can't get poll", rest.ErrPostNotFound)
+		return
+	}
+	R.RenderJSON(w, res)
+}
+
+// GET /web/custom/{site}/{name} - branding asset of the site, like custom.css or logo.png
+func (s *public) assetCtrl(w http.ResponseWriter, r *http.Request) {
+	a, err := s.dataService.Asset(r.PathValue("site"), r.PathValue("name"))
+	if errors.Is(err, asset.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't get asset", rest.ErrInternal)
+		return
+	}
+	w.Header().Set("Content-Type", a.ContentType)
+	w.Header().Set("ETag", `"`+a.Hash+`"`)
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	if v := r.URL.Query().Get("v"); v != "" && strings.HasPrefix(a.Hash, v) { // versioned link, like custom_css of config
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	}
+	// assets are not pages, scripts of svg opened directly are not allowed to run
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+	http.ServeContent(w, r, a.Name, a.Timestamp, bytes.NewReader(a.Data))
+}
+
+// GET /web/print?site=siteID&url=post-url&filter=[top|highlighted] - printable html page of the post's public comments,
+// all comments if filter not set
+func (s *public) printCtrl(w http.ResponseWriter, r *http.Request) {
+	locator := store.Locator{SiteID: r.URL.Query().Get("site"), URL: r.URL.Query().Get("url")}
+	if locator.SiteID == "" || locator.URL == "" {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, errors.New("missing site or url"), "can't print comments", rest.ErrPostNotFound)
+		return
+	}
+	key := cache.NewKey(locator.SiteID).ID(URLKey(r)).Scopes(locator.SiteID, locator.URL)
+	data, err := s.cache.Get(key, func() ([]byte, error) {
+		return s.dataService.PrintThread(locator, r.URL.Query().Get("filter"))
+	})
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't print comments", rest.ErrPostNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// comments are sanitized, the page has no scripts and loads images of comments only
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; img-src * data:")
+	_, _ = w.Write(data)
+}
+
+// GET /highlights?site=siteID&url=post-url&limit=10 - comments highlighted by admin, from the newest.
+// Site-wide if url not set
+func (s *public) highlightsCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID, url := r.URL.Query().Get("site"), r.URL.Query().Get("url")
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil {
+		limit = 0
+	}
+
+	key := cache.NewKey(siteID).ID(URLKeyWithUser(r)).Scopes(siteID)
+	data, err := s.cache.Get(key, func() ([]byte, error) {
+		highlights, e := s.dataService.Highlights(siteID, url, limit, rest.GetUserOrEmpty(r))
+		if e != nil {
+			return nil, e
+		}
+		return encodeJSONWithHTML(highlights)
+	})
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't get highlights", rest.ErrInternal)
+		return
+	}
+
+	setCDNHeaders(w, r, s.cdnMaxAge, siteID)
+	if err = R.RenderJSONFromBytes(w, r, data); err != nil {
+		log.Printf("[WARN] can't render highlights for site %s", siteID)
+	}
+}
+
 // GET /last/{limit}?site=siteID&since=unix_ts_msec - last comments for the siteID, across all posts, sorted by time, optionally
 // limited with "since" param
 func (s *public) lastCommentsCtrl(w http.ResponseWriter, r *http.Request) {
@@ -214,6 +479,7 @@ func (s *public) lastCommentsCtrl(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setCDNHeaders(w, r, s.cdnMaxAge, siteID, lastCommentsScope)
 	if err = R.RenderJSONFromBytes(w, r, data); err != nil {
 		log.Printf("[WARN] can't render last comments for site %s", siteID)
 	}
@@ -227,7 +493,11 @@ func (s *public) commentByIDCtrl(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("[DEBUG] get comments by id %s, %s %s", id, siteID, url)
 
-	comment, err := s.dataService.Get(store.Locator{SiteID: siteID, URL: url}, id, rest.GetUserOrEmpty(r))
+	user := rest.GetUserOrEmpty(r)
+	comment, err := s.dataService.Get(store.Locator{SiteID: siteID, URL: url}, id, user)
+	if err == nil && !comment.VisibleTo(user) {
+		err = fmt.Errorf("comment %s not found", id) // don't disclose existence of restricted comments
+	}
 	if err != nil {
 		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't get comment by id", rest.ErrCommentNotFound)
 		return
@@ -283,6 +553,7 @@ func (s *public) findUserCommentsCtrl(w http.ResponseWriter, r *http.Request) {
 		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't get comment by user id", rest.ErrCommentNotFound)
 		return
 	}
+	setCDNHeaders(w, r, s.cdnMaxAge, siteID, userID)
 	if err = R.RenderJSONFromBytes(w, r, data); err != nil {
 		log.Printf("[WARN] can't render found comments for user %s", userID)
 	}
@@ -296,6 +567,7 @@ func (s *public) countCtrl(w http.ResponseWriter, r *http.Request) {
 		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't get count", rest.ErrPostNotFound)
 		return
 	}
+	setCDNHeaders(w, r, s.cdnMaxAge, locator.SiteID, locator.URL)
 	R.RenderJSON(w, R.JSON{"count": count, "locator": locator})
 }
 
@@ -333,6 +605,32 @@ func (s *public) countMultiCtrl(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// GET /blocklist?site=siteID - users blocked by the site admins, shared with other instances as a blocklist feed.
+// Available only with publishing enabled.
+func (s *public) blocklistCtrl(w http.ResponseWriter, r *http.Request) {
+	if !s.publishBlocklist {
+		rest.SendErrorJSON(w, r, http.StatusNotFound, errors.New("blocklist is not published"), "blocklist is not published", rest.ErrActionRejected)
+		return
+	}
+	siteID := r.URL.Query().Get("site")
+	key := cache.NewKey(siteID).ID(URLKey(r)).Scopes(siteID)
+	data, err := s.cache.Get(key, func() ([]byte, error) {
+		users, e := s.dataService.PublishedBlocklist(siteID)
+		if e != nil {
+			return nil, e
+		}
+		return encodeJSONWithHTML(users)
+	})
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't get blocklist for "+siteID, rest.ErrSiteNotFound)
+		return
+	}
+	setCDNHeaders(w, r, s.cdnMaxAge, siteID)
+	if err = R.RenderJSONFromBytes(w, r, data); err != nil {
+		log.Printf("[WARN] can't render blocklist for site %s", siteID)
+	}
+}
+
 // GET /list?site=siteID&limit=50&skip=10 - list posts with comments
 func (s *public) listCtrl(w http.ResponseWriter, r *http.Request) {
 	siteID := r.URL.Query().Get("site")
@@ -359,6 +657,7 @@ func (s *public) listCtrl(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setCDNHeaders(w, r, s.cdnMaxAge, siteID)
 	if err = R.RenderJSONFromBytes(w, r, data); err != nil {
 		log.Printf("[WARN] can't render posts list for site %s", siteID)
 	}
@@ -390,7 +689,7 @@ func safePictureSegment(seg string) bool {
 }
 
 // sendPictureError writes a no-store Cache-Control header and delegates to rest.SendErrorJSON.
-// Used by every rejection branch in loadPictureCtrl so error responses never inherit the
+// Used by every rejection branch of picture handlers so error responses never inherit the
 // 7-day client cache of the success path.
 func sendPictureError(w http.ResponseWriter, r *http.Request, status int, err error, details string, code int) {
 	w.Header().Set("Cache-Control", "no-store")
@@ -401,20 +700,59 @@ func sendPictureError(w http.ResponseWriter, r *http.Request, status int, err er
 func (s *public) loadPictureCtrl(w http.ResponseWriter, r *http.Request) {
 	rest.SetImageDefenseHeaders(w)
 
-	user, imgID := r.PathValue("user"), r.PathValue("id")
-	if user == "" || imgID == "" || !safePictureSegment(user) || !safePictureSegment(imgID) {
-		log.Printf("[WARN] rejected picture request with unsafe id segments user=%q id=%q", user, imgID)
-		sendPictureError(w, r, http.StatusBadRequest, fmt.Errorf("invalid picture id"), "invalid picture id", rest.ErrAssetNotFound)
+	id, ok := pictureID(w, r)
+	if !ok {
 		return
 	}
-	id := user + "/" + imgID
 	img, err := s.imageService.Load(id)
 	if err != nil {
 		log.Printf("[WARN] can't load image %s: %v", id, err)
 		sendPictureError(w, r, http.StatusBadRequest, fmt.Errorf("image not found"), "can't get image", rest.ErrAssetNotFound)
 		return
 	}
+	sendPicture(w, r, id, id, img)
+}
+
+// GET /picture/{user}/{id}/{size} - get thumbnail of the picture fitting size WIDTHxHEIGHT, like 320x240.
+// Size should be one of allowed thumbnail sizes, the picture is never upscaled.
+func (s *public) pictureThumbnailCtrl(w http.ResponseWriter, r *http.Request) {
+	rest.SetImageDefenseHeaders(w)
+
+	id, ok := pictureID(w, r)
+	if !ok {
+		return
+	}
+	size, err := image.ParseThumbnailSize(r.PathValue("size"))
+	if err != nil {
+		sendPictureError(w, r, http.StatusBadRequest, err, "bad thumbnail size", rest.ErrActionRejected)
+		return
+	}
+	img, err := s.imageService.Thumbnail(id, size)
+	if errors.Is(err, image.ErrThumbnailSize) {
+		sendPictureError(w, r, http.StatusBadRequest, err, "thumbnail size not allowed", rest.ErrActionRejected)
+		return
+	}
+	if err != nil {
+		log.Printf("[WARN] can't make thumbnail %s of image %s: %v", size, id, err)
+		sendPictureError(w, r, http.StatusBadRequest, fmt.Errorf("image not found"), "can't get image", rest.ErrAssetNotFound)
+		return
+	}
+	sendPicture(w, r, id, id+"/"+size.String(), img)
+}
+
+// pictureID returns id of the picture from user and id path segments, responds with error on unsafe segments
+func pictureID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	user, imgID := r.PathValue("user"), r.PathValue("id")
+	if user == "" || imgID == "" || !safePictureSegment(user) || !safePictureSegment(imgID) {
+		log.Printf("[WARN] rejected picture request with unsafe id segments user=%q id=%q", user, imgID)
+		sendPictureError(w, r, http.StatusBadRequest, fmt.Errorf("invalid picture id"), "invalid picture id", rest.ErrAssetNotFound)
+		return "", false
+	}
+	return user + "/" + imgID, true
+}
 
+// sendPicture validates the picture bytes and sends them with 7-day client cache and etag of the tag
+func sendPicture(w http.ResponseWriter, r *http.Request, id, tag string, img []byte) {
 	contentType, err := rest.SafeImgContentType(img)
 	if err != nil {
 		log.Printf("[WARN] rejecting non-image picture %s: %v", id, err)
@@ -430,7 +768,7 @@ func (s *public) loadPictureCtrl(w http.ResponseWriter, r *http.Request) {
 	// Content-Disposition: inline), not on byte normalization. Picture IDs are limited
 	// to safePictureSegment (alphanumeric xid-generated guids), so the comma split
 	// inside rest.EtagMatches cannot collide; if the ID format ever changes, revisit.
-	etag := `"` + id + `"`
+	etag := `"` + tag + `"`
 	w.Header().Set("Etag", etag)
 	w.Header().Set("Cache-Control", "max-age=604800") // 7 days
 	if match := r.Header.Get("If-None-Match"); match != "" && rest.EtagMatches(match, etag) {
@@ -446,10 +784,47 @@ func (s *public) loadPictureCtrl(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// GET /initials/{user}?name=John+Doe&size=48&theme=dark - generated avatar with initials of the name for users without
+// picture. Background color derived from user id, size should be one of rest.InitialsSizes, theme is light by default.
+func (s *public) initialsAvatarCtrl(w http.ResponseWriter, r *http.Request) {
+	rest.SetImageDefenseHeaders(w)
+
+	size := 48
+	if v := r.URL.Query().Get("size"); v != "" {
+		var err error
+		if size, err = strconv.Atoi(v); err != nil || !rest.ValidInitialsSize(size) {
+			sendPictureError(w, r, http.StatusBadRequest, fmt.Errorf("invalid size %q", v), "bad size value", rest.ErrActionRejected)
+			return
+		}
+	}
+	theme := r.URL.Query().Get("theme")
+	if theme != "" && theme != "light" && theme != "dark" {
+		sendPictureError(w, r, http.StatusBadRequest, fmt.Errorf("invalid theme %q", theme), "bad theme value", rest.ErrActionRejected)
+		return
+	}
+
+	img := rest.InitialsAvatar(r.URL.Query().Get("name"), r.PathValue("user"), size, theme == "dark")
+	h := sha1.Sum(img) // nolint
+	etag := `"` + base64.URLEncoding.EncodeToString(h[:]) + `"`
+	w.Header().Set("Etag", etag)
+	w.Header().Set("Cache-Control", "max-age=604800") // 7 days
+	if match := r.Header.Get("If-None-Match"); match != "" && rest.EtagMatches(match, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Content-Length", strconv.Itoa(len(img)))
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(img); err != nil {
+		log.Printf("[WARN] can't send response to %s, %s", r.RemoteAddr, err)
+	}
+}
+
 // GET /robots.txt
 func (s *public) robotsCtrl(w http.ResponseWriter, _ *http.Request) {
 	allowed := []string{"/find", "/last", "/id", "/count", "/counts", "/list", "/config", "/user",
-		"/img", "/avatar", "/picture"}
+		"/img", "/avatar", "/picture", "/initials"}
 	for i := range allowed {
 		allowed[i] = "Allow: /api/v1" + allowed[i]
 	}
@@ -491,6 +866,60 @@ func (s *public) telegramQrCtrl(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// findFilter defines server-side filters of comments, zero value keeps all comments
+type findFilter struct {
+	until    time.Time
+	topOnly  bool
+	verified bool
+	minScore *int
+	userID   string
+}
+
+// parseFindFilter makes filter from until, top, verified, min_score and user query params
+func parseFindFilter(r *http.Request) (res findFilter, err error) {
+	q := r.URL.Query()
+	if until := q.Get("until"); until != "" {
+		unixTS, e := strconv.ParseInt(until, 10, 64)
+		if e != nil {
+			return findFilter{}, fmt.Errorf("can't translate until parameter: %w", e)
+		}
+		res.until = time.UnixMilli(unixTS)
+	}
+	if minScore := q.Get("min_score"); minScore != "" {
+		score, e := strconv.Atoi(minScore)
+		if e != nil {
+			return findFilter{}, fmt.Errorf("can't translate min_score parameter: %w", e)
+		}
+		res.minScore = &score
+	}
+	res.topOnly, res.verified, res.userID = q.Get("top") == "1", q.Get("verified") == "1", q.Get("user")
+	return res, nil
+}
+
+func (f findFilter) active() bool {
+	return !f.until.IsZero() || f.topOnly || f.verified || f.minScore != nil || f.userID != ""
+}
+
+// apply returns comments passed the filter
+func (f findFilter) apply(comments []store.Comment) []store.Comment {
+	if !f.active() {
+		return comments
+	}
+	res := make([]store.Comment, 0, len(comments))
+	for _, c := range comments {
+		switch {
+		case !f.until.IsZero() && !c.Timestamp.Before(f.until):
+		case f.topOnly && c.ParentID != "":
+		case f.verified && !c.User.Verified:
+		case f.minScore != nil && c.Score < *f.minScore:
+		case f.userID != "" && c.User.ID != f.userID:
+		default:
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
 func (s *public) applyView(comments []store.Comment, view string) []store.Comment {
 	if strings.EqualFold(view, "user") {
 		projection := make([]store.Comment, 0, len(comments))
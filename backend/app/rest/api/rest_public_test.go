@@ -1,14 +1,21 @@
 package api
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	goimage "image"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path"
 	"strconv"
 	"strings"
 	"testing"
@@ -20,9 +27,14 @@ import (
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
 
+	"github.com/umputun/remark42/backend/app/rest"
+	"github.com/umputun/remark42/backend/app/rest/cdn"
+	"github.com/umputun/remark42/backend/app/rest/proxy"
 	"github.com/umputun/remark42/backend/app/store"
 	"github.com/umputun/remark42/backend/app/store/image"
+	"github.com/umputun/remark42/backend/app/store/page"
 	"github.com/umputun/remark42/backend/app/store/service"
 )
 
@@ -320,6 +332,66 @@ func TestRest_FindReadOnly(t *testing.T) {
 	assert.False(t, tree.Info.ReadOnly, "post is writable")
 }
 
+func TestRest_FindFilters(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	locator := store.Locator{SiteID: "remark42", URL: "https://radio-t.com/filters"}
+	base := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	for i, c := range []store.Comment{
+		{ID: "c1", Text: "first", User: store.User{ID: "u1", Name: "u1"}},
+		{ID: "c2", Text: "reply", ParentID: "c1", User: store.User{ID: "u2", Name: "u2"}},
+		{ID: "c3", Text: "second", User: store.User{ID: "u2", Name: "u2"}},
+		{ID: "c4", Text: "third", User: store.User{ID: "u3", Name: "u3"}},
+	} {
+		c.Locator, c.Timestamp = locator, base.Add(time.Duration(i)*time.Minute)
+		_, err := srv.DataService.Create(c)
+		require.NoError(t, err)
+	}
+	require.NoError(t, srv.DataService.SetVerified("remark42", "u2", true))
+	for _, voter := range []string{"v1", "v2"} {
+		_, err := srv.DataService.Vote(service.VoteReq{Locator: locator, CommentID: "c4", UserID: voter, Val: false})
+		require.NoError(t, err)
+	}
+
+	find := func(query string) (ids []string, count int) {
+		body, code := get(t, ts.URL+"/api/v1/find?site=remark42&url=https://radio-t.com/filters&format=plain&sort=time"+query)
+		require.Equal(t, http.StatusOK, code, body)
+		comments := commentsWithInfo{}
+		require.NoError(t, json.Unmarshal([]byte(body), &comments))
+		for _, c := range comments.Comments {
+			ids = append(ids, c.ID)
+		}
+		return ids, comments.Info.Count
+	}
+
+	ids, count := find("")
+	assert.Equal(t, []string{"c1", "c2", "c3", "c4"}, ids)
+	assert.Equal(t, 4, count)
+
+	ids, count = find("&top=1")
+	assert.Equal(t, []string{"c1", "c3", "c4"}, ids)
+	assert.Equal(t, 3, count, "count of filtered comments")
+	ids, _ = find("&verified=1")
+	assert.Equal(t, []string{"c2", "c3"}, ids)
+	ids, _ = find("&min_score=0")
+	assert.Equal(t, []string{"c1", "c2", "c3"}, ids)
+	ids, _ = find("&user=u2&top=1")
+	assert.Equal(t, []string{"c3"}, ids)
+	ids, _ = find(fmt.Sprintf("&since=%d&until=%d", base.Add(30*time.Second).UnixMilli(), base.Add(3*time.Minute).UnixMilli()))
+	assert.Equal(t, []string{"c2", "c3"}, ids)
+
+	body, code := get(t, ts.URL+"/api/v1/find?site=remark42&url=https://radio-t.com/filters&format=tree&verified=1")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.Contains(t, body, `"id":"c3"`)
+	assert.NotContains(t, body, `"id":"c2"`, "reply of filtered out comment dropped from tree")
+
+	_, code = get(t, ts.URL+"/api/v1/find?site=remark42&url=https://radio-t.com/filters&until=bad")
+	assert.Equal(t, http.StatusBadRequest, code)
+	_, code = get(t, ts.URL+"/api/v1/find?site=remark42&url=https://radio-t.com/filters&min_score=low")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
 func TestRest_FindUserView(t *testing.T) {
 	ts, srv, teardown := startupT(t)
 	defer teardown()
@@ -728,6 +800,7 @@ func TestPublic_FindCommentsCtrl_ConsistentCount(t *testing.T) {
 		{"limit=1&sort=-score&url=test-url", `"info":{"url":"test-url","count":6,"count_left":7,"last_comment":"` + ids[2]},
 		{"limit=1&sort=+controversy&url=test-url", `"info":{"url":"test-url","count":6,"count_left":7,"last_comment":"` + ids[0]},
 		{"limit=1&sort=-controversy&url=test-url", `"info":{"url":"test-url","count":6,"count_left":7,"last_comment":"` + ids[3]},
+		{"limit=1&sort=controversial&url=test-url", `"info":{"url":"test-url","count":6,"count_left":7,"last_comment":"` + ids[3]},
 
 		// test parameters limit, offset_id for format=tree
 		{"format=tree&limit=bad", `{"code":1,"details":"bad limit value","error":"strconv.Atoi: parsing \"bad\": invalid syntax"}`},
@@ -765,6 +838,7 @@ func TestPublic_FindCommentsCtrl_ConsistentCount(t *testing.T) {
 		{"format=tree&limit=1&sort=-score&url=test-url", `"info":{"url":"test-url","count":6,"count_left":4,"last_comment":"` + ids[1]},
 		{"format=tree&limit=1&sort=+controversy&url=test-url", `"info":{"url":"test-url","count":6,"count_left":3,"last_comment":"` + ids[0]},
 		{"format=tree&limit=1&sort=-controversy&url=test-url", `"info":{"url":"test-url","count":6,"count_left":5,"last_comment":"` + ids[6]},
+		{"format=tree&limit=1&sort=controversial&url=test-url", `"info":{"url":"test-url","count":6,"count_left":5,"last_comment":"` + ids[6]},
 	}
 
 	for _, tc := range testCases {
@@ -897,6 +971,26 @@ func TestRest_List(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, code)
 }
 
+func TestRest_Blocklist(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	require.NoError(t, srv.DataService.SetBlock("remark42", "user1", true, 0))
+	require.NoError(t, srv.DataService.SetBlockReason("remark42", "user1", "spam"))
+	require.NoError(t, srv.DataService.SetVerified("remark42", "user2", true))
+
+	_, code := get(t, ts.URL+"/api/v1/blocklist?site=remark42")
+	assert.Equal(t, http.StatusNotFound, code, "not published by default")
+
+	srv.pubRest.publishBlocklist = true
+	body, code := get(t, ts.URL+"/api/v1/blocklist?site=remark42")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.JSONEq(t, `[{"id":"user1","blocked":true}]`, body)
+
+	_, code = get(t, ts.URL+"/api/v1/blocklist?site=remark42-BLAH")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
 func TestRest_ListWithSkipAndLimit(t *testing.T) {
 	ts, _, teardown := startupT(t)
 	defer teardown()
@@ -928,6 +1022,69 @@ func TestRest_ListWithSkipAndLimit(t *testing.T) {
 	assert.Equal(t, 3, pi[1].Count)
 }
 
+func TestRest_AnonDevice(t *testing.T) {
+	ts, srv, teardown := startupT(t, func(srv *Rest) { srv.SharedSecret = "secret" })
+	defer teardown()
+
+	resp, err := http.Post(ts.URL+"/api/v1/anon/device", "application/json", http.NoBody)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+
+	res := struct {
+		Device string `json:"device"`
+	}{}
+	require.NoError(t, json.Unmarshal(body, &res))
+	_, ok := rest.DeviceID(res.Device, srv.SharedSecret)
+	assert.True(t, ok, "signed with shared secret")
+}
+
+func TestRest_PoW(t *testing.T) {
+	ts, _, teardown := startupT(t)
+	_, code := get(t, ts.URL+"/api/v1/pow")
+	assert.Equal(t, http.StatusNotFound, code, "disabled")
+	teardown()
+
+	pow := rest.NewPoW("secret", 4, time.Minute)
+	ts, _, teardown = startupT(t, func(srv *Rest) { srv.PoW, srv.AnonLoginPoW = pow, true })
+	defer teardown()
+
+	body, code := get(t, ts.URL+"/api/v1/pow")
+	require.Equal(t, http.StatusOK, code, body)
+	res := struct {
+		Challenge  string `json:"challenge"`
+		Difficulty int    `json:"difficulty"`
+	}{}
+	require.NoError(t, json.Unmarshal([]byte(body), &res))
+	assert.Equal(t, 4, res.Difficulty)
+	assert.NotEmpty(t, res.Challenge)
+
+	body, code = get(t, ts.URL+"/api/v1/config?site=remark42")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.Contains(t, body, `"pow_difficulty":4`)
+	assert.Contains(t, body, `"pow_anon_login":true`)
+
+	login := func(challenge, solution string) int {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/auth/anonymous/login?user=anon_user&aud=remark42", http.NoBody)
+		require.NoError(t, err)
+		req.Header.Set(rest.PoWChallengeHeader, challenge)
+		req.Header.Set(rest.PoWSolutionHeader, solution)
+		resp, err := sendReq(t, req, "")
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp.StatusCode
+	}
+	assert.Equal(t, http.StatusForbidden, login("", ""), "anonymous login without solution")
+	challenge, err := pow.Challenge()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, login(challenge, rest.SolvePoW(challenge, 4)))
+
+	// logged-in users don't need proof-of-work for comments
+	addComment(t, store.Comment{Text: "test 123", Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah1"}}, ts)
+}
+
 func TestRest_Config(t *testing.T) {
 	ts, _, teardown := startupT(t)
 	defer teardown()
@@ -938,9 +1095,15 @@ func TestRest_Config(t *testing.T) {
 	err := json.Unmarshal([]byte(body), &j)
 	assert.NoError(t, err)
 	assert.Equal(t, 300.0, j["edit_duration"])
+	assert.Equal(t, map[string]any{"duration": 300.0, "verified_duration": 0.0, "admin_duration": 0.0}, j["edit_policy"])
 	assert.EqualValues(t, []any{"a1", "a2"}, j["admins"])
 	assert.Equal(t, "admin@remark-42.com", j["admin_email"])
 	assert.Equal(t, 4000.0, j["max_comment_size"])
+	assert.Equal(t, 0.0, j["max_links"])
+	assert.Equal(t, 0.0, j["max_images"])
+	assert.Equal(t, 0.0, j["max_quote_ratio"])
+	assert.Equal(t, false, j["new_member_badge"])
+	assert.Equal(t, time.Local.String(), j["timezone"])
 	assert.Equal(t, -5.0, j["low_score"])
 	assert.Equal(t, -10.0, j["critical_score"])
 	assert.False(t, j["positive_score"].(bool))
@@ -948,6 +1111,20 @@ func TestRest_Config(t *testing.T) {
 	assert.Equal(t, 10000.0, j["max_image_size"])
 	assert.Equal(t, true, j["emoji_enabled"].(bool))
 	assert.Equal(t, false, j["admin_edit"].(bool))
+	assert.Equal(t, false, j["profile_enabled"].(bool))
+	assert.Equal(t, "edit-window", j["author_delete"])
+	assert.Equal(t, true, j["anon_allowed"].(bool))
+	assert.Equal(t, []any{}, j["languages"])
+
+	ts2, _, teardown2 := startupT(t, func(srv *Rest) {
+		srv.DataService.LanguagePolicy = service.StaticLanguagePolicyLister{LanguagePolicy: service.LanguagePolicy{Allowed: []string{"en", "de"}}}
+	})
+	defer teardown2()
+	body, code = get(t, ts2.URL+"/api/v1/config?site=remark42")
+	assert.Equal(t, http.StatusOK, code)
+	j = R.JSON{}
+	require.NoError(t, json.Unmarshal([]byte(body), &j))
+	assert.Equal(t, []any{"en", "de"}, j["languages"])
 }
 
 func TestRest_QR(t *testing.T) {
@@ -1034,7 +1211,43 @@ func TestRest_Robots(t *testing.T) {
 	assert.Equal(t, "User-agent: *\nDisallow: /auth/\nDisallow: /api/\nAllow: /api/v1/find\n"+
 		"Allow: /api/v1/last\nAllow: /api/v1/id\nAllow: /api/v1/count\nAllow: /api/v1/counts\n"+
 		"Allow: /api/v1/list\nAllow: /api/v1/config\nAllow: /api/v1/user\nAllow: /api/v1/img\n"+
-		"Allow: /api/v1/avatar\nAllow: /api/v1/picture\n", body)
+		"Allow: /api/v1/avatar\nAllow: /api/v1/picture\nAllow: /api/v1/initials\n", body)
+}
+
+func TestRest_InitialsAvatar(t *testing.T) {
+	ts, _, teardown := startupT(t)
+	defer teardown()
+
+	resp, err := http.Get(ts.URL + "/api/v1/initials/github_123?name=John+Doe")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, string(rest.InitialsAvatar("John Doe", "github_123", 48, false)), string(body))
+	assert.Equal(t, "image/svg+xml", resp.Header.Get("Content-Type"))
+	assert.Equal(t, rest.StrictImageCSP, resp.Header.Get("Content-Security-Policy"))
+	assert.Equal(t, "nosniff", resp.Header.Get("X-Content-Type-Options"))
+	assert.Equal(t, "max-age=604800", resp.Header.Get("Cache-Control"))
+	etag := resp.Header.Get("Etag")
+	require.NotEmpty(t, etag)
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/initials/github_123?name=John+Doe", http.NoBody)
+	require.NoError(t, err)
+	req.Header.Set("If-None-Match", etag)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+	b, code := get(t, ts.URL+"/api/v1/initials/github_123?name=John+Doe&size=96&theme=dark")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, string(rest.InitialsAvatar("John Doe", "github_123", 96, true)), b)
+
+	b, code = get(t, ts.URL+"/api/v1/initials/github_123?name=John&size=1000")
+	assert.Equal(t, http.StatusBadRequest, code, b)
+	b, code = get(t, ts.URL+"/api/v1/initials/github_123?name=John&theme=blue")
+	assert.Equal(t, http.StatusBadRequest, code, b)
 }
 
 // TestRest_LoadPictureRejectsPathTraversal reproduces the unauthenticated path-traversal
@@ -1230,3 +1443,290 @@ func TestRest_LoadPictureRejectsNonImage(t *testing.T) {
 	assert.Equal(t, "nosniff", resp.Header.Get("X-Content-Type-Options"))
 	assert.Equal(t, `inline; filename="image"`, resp.Header.Get("Content-Disposition"))
 }
+
+func TestRest_LiveComments(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+	var err error
+	srv.DataService.PageStore, err = page.NewBoltStorage(path.Join(t.TempDir(), "pages.db"), bolt.Options{})
+	require.NoError(t, err)
+
+	locator := store.Locator{SiteID: "remark42", URL: "https://radio-t.com/live"}
+	_, code := get(t, ts.URL+"/api/v1/live?site=remark42&url=https://radio-t.com/live")
+	assert.Equal(t, http.StatusNotFound, code, "not live")
+	require.NoError(t, srv.DataService.SetPageLive(locator, true))
+
+	for i := range 5 {
+		addComment(t, store.Comment{Text: fmt.Sprintf("update %d", i), Locator: locator}, ts)
+	}
+
+	type liveResp struct {
+		Comments []store.Comment `json:"comments"`
+		Newest   string          `json:"newest"`
+		Oldest   string          `json:"oldest"`
+		HasMore  bool            `json:"has_more"`
+	}
+	load := func(query string) (res liveResp) {
+		resp, err := http.Get(ts.URL + "/api/v1/live?site=remark42&url=https://radio-t.com/live" + query)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "public, max-age=5", resp.Header.Get("Cache-Control"))
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+		return res
+	}
+	texts := func(res liveResp) (texts []string) {
+		for _, c := range res.Comments {
+			texts = append(texts, strings.TrimSpace(c.Text))
+		}
+		return texts
+	}
+
+	res := load("&limit=2")
+	assert.Equal(t, []string{"<p>update 4</p>", "<p>update 3</p>"}, texts(res), "newest first")
+	assert.True(t, res.HasMore)
+
+	res = load("&limit=2&before=" + res.Oldest)
+	assert.Equal(t, []string{"<p>update 2</p>", "<p>update 1</p>"}, texts(res))
+	assert.True(t, res.HasMore)
+	res = load("&limit=2&before=" + res.Oldest)
+	assert.Equal(t, []string{"<p>update 0</p>"}, texts(res))
+	assert.False(t, res.HasMore)
+
+	res = load("&limit=3&after=" + res.Newest)
+	assert.Equal(t, []string{"<p>update 3</p>", "<p>update 2</p>", "<p>update 1</p>"}, texts(res), "oldest after cursor first")
+	assert.True(t, res.HasMore)
+	res = load("&limit=3&after=" + res.Newest)
+	assert.Equal(t, []string{"<p>update 4</p>"}, texts(res))
+	assert.False(t, res.HasMore)
+	res = load("&after=" + res.Newest)
+	assert.Empty(t, res.Comments, "nothing new")
+
+	_, code = get(t, ts.URL+"/api/v1/live?site=remark42&url=https://radio-t.com/live&after=bad")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestRest_CDNHeaders(t *testing.T) {
+	purged := make(chan []string, 10)
+	ts, _, teardown := startupT(t, func(srv *Rest) {
+		srv.CDNMaxAge = 10 * time.Minute
+		srv.Cache = &cdn.Cache{LoadingCache: srv.Cache, Purger: cdnPurgerFunc(func(_ context.Context, keys []string) error {
+			purged <- keys
+			return nil
+		})}
+	})
+	defer teardown()
+
+	locator := store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah1"}
+	addComment(t, store.Comment{Text: "test 123", Locator: locator}, ts)
+	select {
+	case keys := <-purged:
+		assert.ElementsMatch(t, cdn.Keys("remark42", locator.URL, lastCommentsScope, "provider1_dev", "remark42"), keys)
+	case <-time.After(time.Second):
+		t.Fatal("cdn not purged on new comment")
+	}
+
+	resp, err := http.Get(ts.URL + "/api/v1/find?site=remark42&url=https://radio-t.com/blah1")
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "public, max-age=0, s-maxage=600", resp.Header.Get("Cache-Control"))
+	assert.Equal(t, "max-age=600", resp.Header.Get("Surrogate-Control"))
+	assert.Equal(t, strings.Join(cdn.Keys("remark42", "remark42", locator.URL), " "), resp.Header.Get("Surrogate-Key"))
+	assert.Equal(t, "Authorization, Cookie, X-JWT", resp.Header.Get("Vary"))
+	assert.Empty(t, resp.Header.Get("Pragma"))
+
+	resp, err = http.Get(ts.URL + "/api/v1/last/10?site=remark42")
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, strings.Join(cdn.Keys("remark42", "remark42", lastCommentsScope), " "), resp.Header.Get("Surrogate-Key"))
+
+	// authenticated request not kept by cdn
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/find?site=remark42&url=https://radio-t.com/blah1", http.NoBody)
+	require.NoError(t, err)
+	req.Header.Add("X-JWT", devToken)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Cache-Control"), "private")
+	assert.Empty(t, resp.Header.Get("Surrogate-Key"))
+}
+
+func TestRest_CDNHeadersDisabled(t *testing.T) {
+	ts, _, teardown := startupT(t)
+	defer teardown()
+	resp, err := http.Get(ts.URL + "/api/v1/list?site=remark42")
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Cache-Control"), "no-cache")
+	assert.Empty(t, resp.Header.Get("Surrogate-Key"))
+}
+
+func TestRest_PictureThumbnail(t *testing.T) {
+	ts, srv, teardown := startupT(t, func(srv *Rest) {
+		srv.ImageService.ThumbnailSizes = []image.ThumbnailSize{{Width: 32, Height: 32}, {Width: 320, Height: 320}}
+	})
+	defer teardown()
+	id, err := srv.ImageService.Save("dev_user", gopherPNG()) // 75x60 px
+	require.NoError(t, err)
+
+	resp, err := http.Get(ts.URL + "/api/v1/picture/" + id + "/32x32")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+	assert.Equal(t, "image/png", resp.Header.Get("Content-Type"))
+	assert.Equal(t, `"`+id+`/32x32"`, resp.Header.Get("Etag"))
+	assert.Equal(t, "max-age=604800", resp.Header.Get("Cache-Control"))
+	assert.Equal(t, "nosniff", resp.Header.Get("X-Content-Type-Options"))
+	cfg, _, err := goimage.DecodeConfig(bytes.NewReader(body))
+	require.NoError(t, err)
+	assert.Equal(t, 32, cfg.Width)
+	assert.Equal(t, 25, cfg.Height)
+
+	resp, err = http.Get(ts.URL + "/api/v1/picture/" + id + "/320x320")
+	require.NoError(t, err)
+	body, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, body, 1462, "small picture not upscaled")
+
+	tbl := []struct {
+		path   string
+		status int
+		code   int
+	}{
+		{path: "/api/v1/picture/" + id + "/64x64", status: http.StatusBadRequest, code: rest.ErrActionRejected},
+		{path: "/api/v1/picture/" + id + "/big", status: http.StatusBadRequest, code: rest.ErrActionRejected},
+		{path: "/api/v1/picture/dev_user/missing/32x32", status: http.StatusBadRequest, code: rest.ErrAssetNotFound},
+		{path: "/api/v1/picture/dev_user/..%2Fremark.db/32x32", status: http.StatusBadRequest, code: rest.ErrAssetNotFound},
+	}
+	for _, tt := range tbl {
+		resp, err = http.Get(ts.URL + tt.path)
+		require.NoError(t, err)
+		body, err = io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		assert.Equal(t, tt.status, resp.StatusCode, tt.path)
+		assert.Equal(t, "no-store", resp.Header.Get("Cache-Control"), tt.path)
+		assert.Contains(t, string(body), fmt.Sprintf(`"code":%d`, tt.code), tt.path)
+	}
+}
+
+func TestRest_ImageCDNOrigin(t *testing.T) {
+	ts, srv, teardown := startupT(t, func(srv *Rest) {
+		srv.ImageProxy = &proxy.Image{CDNOrigin: true, RoutePath: "/api/v1/img", RemarkURL: srv.RemarkURL,
+			ImageService: srv.ImageService}
+	})
+	defer teardown()
+
+	imgURL := "https://example.com/pic.png"
+	imgID, err := image.CachedImgID(imgURL)
+	require.NoError(t, err)
+	require.NoError(t, srv.ImageService.SaveWithID(imgID, gopherPNG()))
+	stored, err := srv.ImageService.Load(imgID)
+	require.NoError(t, err)
+	h := sha256.Sum256(stored)
+	src := base64.URLEncoding.EncodeToString([]byte(imgURL))
+
+	client := http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(ts.URL + "/api/v1/img?src=" + src)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+	assert.Equal(t, "/api/v1/img/"+hex.EncodeToString(h[:])[:16]+"/"+src, resp.Header.Get("Location"))
+
+	resp, err = client.Get(ts.URL + resp.Header.Get("Location"))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "public, max-age=31536000, immutable", resp.Header.Get("Cache-Control"))
+}
+
+type cdnPurgerFunc func(ctx context.Context, keys []string) error
+
+func (f cdnPurgerFunc) Purge(ctx context.Context, keys []string) error { return f(ctx, keys) }
+
+func TestRest_LiveStream(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+	var err error
+	srv.DataService.PageStore, err = page.NewBoltStorage(path.Join(t.TempDir(), "pages.db"), bolt.Options{})
+	require.NoError(t, err)
+
+	locator := store.Locator{SiteID: "remark42", URL: "https://radio-t.com/live"}
+	_, code := get(t, ts.URL+"/api/v1/live/stream?site=remark42&url=https://radio-t.com/live")
+	assert.Equal(t, http.StatusNotFound, code, "not live")
+	require.NoError(t, srv.DataService.SetPageLive(locator, true))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/api/v1/live/stream?site=remark42&url=https://radio-t.com/live", http.NoBody)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	rd := bufio.NewReader(resp.Body)
+	line, err := rd.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "retry: 5000\n", line)
+
+	addComment(t, store.Comment{Text: "other post", Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/other"}}, ts)
+	addComment(t, store.Comment{Text: "live update", Locator: locator}, ts)
+
+	var event, data string
+	for data == "" {
+		line, err = rd.ReadString('\n')
+		require.NoError(t, err)
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event: "))
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+	assert.Equal(t, "comment", event)
+	c := store.Comment{}
+	require.NoError(t, json.Unmarshal([]byte(data), &c))
+	assert.Equal(t, "<p>live update</p>", strings.TrimSpace(c.Text))
+	assert.Equal(t, locator, c.Locator)
+	assert.Empty(t, c.User.IP, "anonymous view")
+}
+
+func TestRest_Print(t *testing.T) {
+	ts, _, teardown := startupT(t)
+	defer teardown()
+
+	locator := store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah1"}
+	id1 := addComment(t, store.Comment{Text: "first comment", Locator: locator}, ts)
+	addComment(t, store.Comment{Text: "reply to first", ParentID: id1, Locator: locator}, ts)
+
+	resp, err := http.Get(ts.URL + "/web/print?site=remark42&url=https://radio-t.com/blah1")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+	assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Contains(t, resp.Header.Get("Content-Security-Policy"), "default-src 'none'")
+	assert.Contains(t, string(body), "2 comments on remark42, printed")
+	assert.Contains(t, string(body), "first comment")
+	assert.Contains(t, string(body), "reply to first")
+
+	body2, code := get(t, ts.URL+"/web/print?site=remark42&url=https://radio-t.com/blah1&filter=top")
+	require.Equal(t, http.StatusOK, code, body2)
+	assert.Contains(t, body2, "first comment")
+	assert.NotContains(t, body2, "reply to first")
+
+	_, code = get(t, ts.URL+"/web/print?site=remark42&url=https://radio-t.com/blah1&filter=bad")
+	assert.Equal(t, http.StatusBadRequest, code)
+	_, code = get(t, ts.URL+"/web/print?site=remark42")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
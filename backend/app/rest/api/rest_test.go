@@ -2,6 +2,7 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
@@ -11,6 +12,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
@@ -22,6 +24,7 @@ import (
 	"github.com/go-pkgz/auth/v2/token"
 	cache "github.com/go-pkgz/lcw/v2"
 	R "github.com/go-pkgz/rest"
+	"github.com/quic-go/quic-go/http3"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	bolt "go.etcd.io/bbolt"
@@ -202,6 +205,154 @@ func TestRest_Shutdown(t *testing.T) {
 	<-done
 }
 
+func TestRest_AdminListen(t *testing.T) {
+	ts, srv, teardown := startupT(t, func(srv *Rest) { srv.AdminListen = "127.0.0.1:0" })
+	defer teardown()
+	adminTS := httptest.NewServer(srv.adminRouter())
+	defer adminTS.Close()
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/blocked?site=remark42", http.NoBody)
+	require.NoError(t, err)
+	resp, err := sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode, "admin api not served by public server")
+
+	req, err = http.NewRequest(http.MethodGet, adminTS.URL+"/api/v1/admin/blocked?site=remark42", http.NoBody)
+	require.NoError(t, err)
+	resp, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	req, err = http.NewRequest(http.MethodGet, adminTS.URL+"/api/v1/admin/blocked?site=remark42", http.NoBody)
+	require.NoError(t, err)
+	resp, err = sendReq(t, req, devToken)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode, "admin server still requires admin")
+
+	_, code := get(t, adminTS.URL+"/debug/pprof/cmdline")
+	assert.Equal(t, http.StatusNotFound, code, "profiler disabled")
+	_, code = getWithAdminAuth(t, adminTS.URL+"/metrics")
+	assert.Equal(t, http.StatusNotFound, code, "metrics disabled")
+	_, code = get(t, adminTS.URL+"/api/v1/find?site=remark42&url=https://radio-t.com/blah1")
+	assert.Equal(t, http.StatusNotFound, code, "public api not served by admin server")
+
+	// token of the previous secret accepted by the admin server too
+	previous := token.NewService(token.Opts{SecretReader: token.SecretFunc(func(string) (string, error) { return "old secret", nil }),
+		TokenDuration: time.Hour})
+	claims, err := token.NewService(token.Opts{SecretReader: token.SecretFunc(func(string) (string, error) { return "secret", nil })}).
+		Parse(adminUmputunToken)
+	require.NoError(t, err)
+	oldToken, err := previous.Token(claims)
+	require.NoError(t, err)
+	req, err = http.NewRequest(http.MethodGet, adminTS.URL+"/api/v1/admin/blocked?site=remark42", http.NoBody)
+	require.NoError(t, err)
+	resp, err = sendReq(t, req, oldToken)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "no rotation")
+
+	srv.TokenRotation = rest.NewTokenRotation(srv.Authenticator.TokenService(), "old secret", time.Now().Add(time.Hour))
+	rotatedTS := httptest.NewServer(srv.adminRouter())
+	defer rotatedTS.Close()
+	req, err = http.NewRequest(http.MethodGet, rotatedTS.URL+"/api/v1/admin/blocked?site=remark42", http.NoBody)
+	require.NoError(t, err)
+	resp, err = sendReq(t, req, oldToken)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "rotated token accepted")
+}
+
+func TestRest_AdminPprof(t *testing.T) {
+	ts, srv, teardown := startupT(t, func(srv *Rest) { srv.AdminListen, srv.AdminPprof = "127.0.0.1:0", true })
+	defer teardown()
+	adminTS := httptest.NewServer(srv.adminRouter())
+	defer adminTS.Close()
+
+	_, code := get(t, adminTS.URL+"/debug/pprof/cmdline")
+	assert.Equal(t, http.StatusUnauthorized, code, "no auth")
+	_, code = getWithAdminAuth(t, adminTS.URL+"/debug/pprof/cmdline")
+	assert.Equal(t, http.StatusOK, code, "basic auth admin")
+	body, code := getWithAdminAuth(t, adminTS.URL+"/debug/pprof/")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "goroutine")
+
+	req, err := http.NewRequest(http.MethodGet, adminTS.URL+"/debug/pprof/cmdline", http.NoBody)
+	require.NoError(t, err)
+	resp, err := sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode, "site admin rejected")
+
+	_, code = getWithAdminAuth(t, ts.URL+"/debug/pprof/cmdline")
+	assert.Equal(t, http.StatusNotFound, code, "profiler not served by public server")
+
+	_, code = get(t, adminTS.URL+"/metrics")
+	assert.Equal(t, http.StatusUnauthorized, code, "no auth")
+	body, code = getWithAdminAuth(t, adminTS.URL+"/metrics")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, `"memstats"`)
+	_, code = getWithAdminAuth(t, ts.URL+"/metrics")
+	assert.Equal(t, http.StatusNotFound, code, "metrics not served by public server")
+}
+
+func TestRest_RunAdminListen(t *testing.T) {
+	adminPort := chooseRandomUnusedPort()
+	srv := Rest{Authenticator: &auth.Service{}, ImageProxy: &proxy.Image{}, AdminListen: fmt.Sprintf("127.0.0.1:%d", adminPort)}
+	done := make(chan struct{})
+	go func() {
+		srv.Run("127.0.0.1", chooseRandomUnusedPort())
+		close(done)
+	}()
+	waitForHTTPSServerStart(adminPort)
+
+	body, code := get(t, fmt.Sprintf("http://127.0.0.1:%d/ping", adminPort))
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "pong", body)
+
+	srv.Shutdown()
+	<-done
+	_, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/ping", adminPort))
+	assert.Error(t, err, "admin server stopped")
+}
+
+func TestRest_RunListener(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "remark42.sock")
+	listener, err := net.Listen("unix", sock)
+	require.NoError(t, err)
+	srv := Rest{Authenticator: &auth.Service{}, ImageProxy: &proxy.Image{}, Listener: listener}
+	done := make(chan struct{})
+	go func() {
+		srv.Run("127.0.0.1", 0)
+		close(done)
+	}()
+
+	client := http.Client{Timeout: time.Second, Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", sock)
+		}}}
+	defer client.CloseIdleConnections()
+	var resp *http.Response
+	for range 100 { // wait for server start
+		if resp, err = client.Get("http://remark42/ping"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, "pong", string(body))
+
+	srv.Shutdown()
+	<-done
+	_, err = os.Stat(sock)
+	assert.True(t, os.IsNotExist(err), "socket removed on shutdown")
+}
+
 func TestRest_filterComments(t *testing.T) {
 	user := store.User{ID: "user1", Name: "user name 1"}
 	c1 := store.Comment{User: user, Text: "test test #1", Locator: store.Locator{SiteID: "radio-t",
@@ -272,6 +423,53 @@ func TestRest_RunStaticSSLMode(t *testing.T) {
 	srv.Shutdown()
 }
 
+func TestRest_RunStaticSSLModeHTTP3(t *testing.T) {
+	sslPort := chooseRandomUnusedPort()
+	srv := Rest{
+		Authenticator: &auth.Service{},
+		ImageProxy:    &proxy.Image{},
+		SSLConfig: SSLConfig{
+			SSLMode: Static,
+			Port:    sslPort,
+			Key:     "../../cmd/testdata/key.pem",
+			Cert:    "../../cmd/testdata/cert.pem",
+			HTTP3:   true,
+		},
+		RemarkURL: fmt.Sprintf("https://localhost:%d", sslPort),
+	}
+	done := make(chan struct{})
+	go func() {
+		srv.Run("127.0.0.1", chooseRandomUnusedPort())
+		close(done)
+	}()
+	waitForHTTPSServerStart(sslPort)
+
+	client := http.Client{Timeout: 5 * time.Second, Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, //nolint:gosec // self-signed test certificate
+	}}
+	defer client.CloseIdleConnections()
+	resp, err := client.Get(fmt.Sprintf("https://127.0.0.1:%d/ping", sslPort))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, fmt.Sprintf(`h3=":%d"; ma=2592000`, sslPort), resp.Header.Get("Alt-Svc"))
+
+	h3 := &http3.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}} //nolint:gosec // self-signed test certificate
+	defer h3.Close()
+	client3 := http.Client{Timeout: 5 * time.Second, Transport: h3}
+	resp, err = client3.Get(fmt.Sprintf("https://127.0.0.1:%d/ping", sslPort))
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, "HTTP/3.0", resp.Proto)
+	assert.Equal(t, "pong", string(body))
+	assert.Empty(t, resp.Header.Get("Alt-Svc"), "not advertised over HTTP/3")
+
+	srv.Shutdown()
+	<-done
+}
+
 func TestRest_RunAutocertModeHTTPOnly(t *testing.T) {
 	sslPort := chooseRandomUnusedPort()
 	srv := Rest{
@@ -404,6 +602,65 @@ func TestRest_frameAncestors(t *testing.T) {
 	assert.Contains(t, resp.Header.Get("Content-Security-Policy"), "frame-ancestors *;")
 }
 
+func TestRest_EmailEvents(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	post := func(path, body string) (int, string) {
+		resp, err := http.Post(ts.URL+path, "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(b)
+	}
+	bounce := `{"RecordType":"Bounce","Type":"HardBounce","Email":"Good@Example.com"}`
+
+	code, _ := post("/api/v1/email/events/postmark?secret=", bounce)
+	assert.Equal(t, http.StatusNotFound, code, "disabled without secret")
+
+	_, err := srv.DataService.SetUserEmail("remark42", "provider1_dev", "good@example.com")
+	require.NoError(t, err)
+	srv.EmailEvents = EmailEvents{Provider: notify.EmailProviderPostmark, Secret: "12345", Sites: []string{"remark42"}}
+
+	code, _ = post("/api/v1/email/events/sendgrid?secret=12345", bounce)
+	assert.Equal(t, http.StatusNotFound, code, "another provider")
+	code, _ = post("/api/v1/email/events/postmark?secret=bad", bounce)
+	assert.Equal(t, http.StatusForbidden, code, "bad secret")
+	code, _ = post("/api/v1/email/events/postmark?secret=12345", "bad")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, body := post("/api/v1/email/events/postmark?secret=12345", `{"RecordType":"Bounce","Type":"SoftBounce","Email":"good@example.com"}`)
+	assert.Equal(t, http.StatusOK, code, body)
+	assert.JSONEq(t, `{"events":0,"suppressed":0,"unsubscribed":0}`, body, "soft bounce ignored")
+
+	code, body = post("/api/v1/email/events/postmark?secret=12345", bounce)
+	assert.Equal(t, http.StatusOK, code, body)
+	assert.JSONEq(t, `{"events":1,"suppressed":0,"unsubscribed":1}`, body, "unsubscribed without suppression")
+	email, err := srv.DataService.GetUserEmail("remark42", "provider1_dev")
+	require.NoError(t, err)
+	assert.Empty(t, email)
+
+	// SES subscription confirmation goes to SNS
+	var confirmed string
+	srv.EmailEvents = EmailEvents{Provider: notify.EmailProviderSES, Secret: "12345", Sites: []string{"remark42"},
+		Client: &http.Client{Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			confirmed = r.URL.String()
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("")), Request: r}, nil
+		})}}
+	code, body = post("/api/v1/email/events/ses?secret=12345",
+		`{"Type":"SubscriptionConfirmation","SubscribeURL":"https://sns.us-east-1.amazonaws.com/?Action=ConfirmSubscription&Token=123"}`)
+	assert.Equal(t, http.StatusNoContent, code, body)
+	assert.Equal(t, "https://sns.us-east-1.amazonaws.com/?Action=ConfirmSubscription&Token=123", confirmed)
+
+	code, _ = post("/api/v1/email/events/ses?secret=12345", `{"Type":"SubscriptionConfirmation","SubscribeURL":"https://example.com/confirm"}`)
+	assert.Equal(t, http.StatusBadRequest, code, "confirmation only with sns")
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
 // randomPath pick a file or folder name which is not in use for sure
 func randomPath(tempDir, basename, suffix string) (string, error) {
 	for range 10 {
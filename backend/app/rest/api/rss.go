@@ -16,6 +16,7 @@ import (
 type rss struct {
 	dataService rssStore
 	cache       LoadingCache
+	cdnMaxAge   time.Duration
 }
 
 type rssStore interface {
@@ -23,6 +24,7 @@ type rssStore interface {
 	Last(siteID string, limit int, since time.Time, user store.User) ([]store.Comment, error)
 	Get(locator store.Locator, commentID string, user store.User) (store.Comment, error)
 	UserReplies(siteID, userID string, limit int, duration time.Duration) ([]store.Comment, string, error)
+	SiteLocation(siteID string) *time.Location
 }
 
 const maxRssItems = 20
@@ -42,7 +44,8 @@ func (s *rss) postCommentsCtrl(w http.ResponseWriter, r *http.Request) {
 		if e != nil {
 			return nil, e
 		}
-		feed, e := s.toRssFeed(locator.URL, comments, "post comments for "+r.URL.Query().Get("url"))
+		feed, e := s.toRssFeed(locator.URL, comments, "post comments for "+r.URL.Query().Get("url"),
+			s.dataService.SiteLocation(locator.SiteID))
 		if e != nil {
 			return nil, e
 		}
@@ -54,6 +57,7 @@ func (s *rss) postCommentsCtrl(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setCDNHeaders(w, r, s.cdnMaxAge, locator.SiteID, locator.URL)
 	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 	if _, err = w.Write(data); err != nil { //nolint:gosec // xml feed bytes from gorilla/feeds, not HTML
@@ -73,7 +77,7 @@ func (s *rss) siteCommentsCtrl(w http.ResponseWriter, r *http.Request) {
 			return nil, e
 		}
 
-		feed, e := s.toRssFeed(r.URL.Query().Get("site"), comments, "site comment for "+siteID)
+		feed, e := s.toRssFeed(r.URL.Query().Get("site"), comments, "site comment for "+siteID, s.dataService.SiteLocation(siteID))
 		if e != nil {
 			return nil, e
 		}
@@ -85,6 +89,7 @@ func (s *rss) siteCommentsCtrl(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setCDNHeaders(w, r, s.cdnMaxAge, siteID, lastCommentsScope)
 	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 	if _, err = w.Write(data); err != nil { //nolint:gosec // xml feed bytes from gorilla/feeds, not HTML
@@ -105,7 +110,7 @@ func (s *rss) repliesCtrl(w http.ResponseWriter, r *http.Request) {
 			return nil, fmt.Errorf("can't get last comments: %w", e)
 		}
 
-		feed, e := s.toRssFeed(siteID, replies, "replies to "+userName)
+		feed, e := s.toRssFeed(siteID, replies, "replies to "+userName, s.dataService.SiteLocation(siteID))
 		if e != nil {
 			return nil, e
 		}
@@ -117,6 +122,7 @@ func (s *rss) repliesCtrl(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setCDNHeaders(w, r, s.cdnMaxAge, siteID, lastCommentsScope)
 	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 	if _, err = w.Write(data); err != nil { //nolint:gosec // xml feed bytes from gorilla/feeds, not HTML
@@ -124,13 +130,14 @@ func (s *rss) repliesCtrl(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (s *rss) toRssFeed(url string, comments []store.Comment, description string) (string, error) {
+// toRssFeed makes feed from comments, with dates in the given timezone
+func (s *rss) toRssFeed(url string, comments []store.Comment, description string, loc *time.Location) (string, error) {
 	if description == "" {
 		description = "comment updates"
 	}
 	lastCommentTS := time.Unix(0, 0)
 	if len(comments) > 0 {
-		lastCommentTS = comments[0].Timestamp
+		lastCommentTS = comments[0].Timestamp.In(loc)
 	}
 
 	feed := &feeds.Feed{
@@ -146,7 +153,7 @@ func (s *rss) toRssFeed(url string, comments []store.Comment, description string
 			Title:       c.User.Name,
 			Link:        &feeds.Link{Href: c.Locator.URL + uiNav + c.ID},
 			Description: c.Text,
-			Created:     c.Timestamp,
+			Created:     c.Timestamp.In(loc),
 			Author:      &feeds.Author{Name: c.User.Name},
 			Id:          c.ID,
 		}
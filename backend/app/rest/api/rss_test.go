@@ -12,6 +12,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/service"
 )
 
 func TestServer_RssPost(t *testing.T) {
@@ -59,6 +60,24 @@ func TestServer_RssPost(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, code)
 }
 
+func TestServer_RssWithSiteTimezone(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	require.NoError(t, err)
+	ts, rst, teardown := startupT(t, func(srv *Rest) {
+		srv.DataService.Timezone = service.StaticTimezoneLister{Sites: map[string]*time.Location{"remark42": tokyo}}
+	})
+	defer teardown()
+
+	ts1 := time.Date(2026, 1, 2, 10, 30, 0, 0, time.UTC)
+	_, err = rst.DataService.Create(store.Comment{Text: "test 123", Timestamp: ts1, User: store.User{ID: "u1", Name: "developer one"},
+		Locator: store.Locator{URL: "https://radio-t.com/blah1", SiteID: "remark42"}})
+	require.NoError(t, err)
+
+	res, code := get(t, ts.URL+"/api/v1/rss/site?site=remark42")
+	require.Equal(t, http.StatusOK, code, res)
+	assert.Contains(t, res, "<pubDate>Fri, 02 Jan 2026 19:30:00 +0900</pubDate>")
+}
+
 func TestServer_RssSite(t *testing.T) {
 	ts, rst, teardown := startupT(t)
 	defer teardown()
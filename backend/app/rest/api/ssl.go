@@ -2,15 +2,18 @@ package api
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"net/http"
 	"net/url"
 	"strings"
 	"time"
 
+	"github.com/go-pkgz/auth/v2/token"
 	log "github.com/go-pkgz/lgr"
 	R "github.com/go-pkgz/rest"
 	"github.com/go-pkgz/routegroup"
+	"github.com/quic-go/quic-go/http3"
 	"golang.org/x/crypto/acme/autocert"
 )
 
@@ -36,6 +39,15 @@ type SSLConfig struct {
 	Port         int
 	ACMELocation string
 	ACMEEmail    string
+	ClientCAs    *x509.CertPool // CAs of client certificates, certificates requested and verified if set
+	HTTP3        bool           // serve HTTP/3 on the same port over UDP, advertised by https server with Alt-Svc
+}
+
+// AdminCertPolicy defines client certificate (mTLS) requirements of admin API. Only certificates verified
+// by https server against SSLConfig.ClientCAs are considered.
+type AdminCertPolicy struct {
+	Required bool              // reject admin requests without verified client certificate
+	Users    map[string]string // certificate's subject common name to id of the user it authenticates as, without token
 }
 
 // httpToHTTPSRouter creates new router which does redirect from http to https server
@@ -118,6 +130,72 @@ func (s *Rest) makeHTTPSServer(address string, port int, router http.Handler) *h
 	return server
 }
 
+// makeHTTP3Server makes HTTP/3 server on the address of https server, with the same handler and TLS config.
+// Handler of https server is wrapped to advertise HTTP/3 with Alt-Svc header.
+func (s *Rest) makeHTTP3Server(server *http.Server) (*http3.Server, error) {
+	cfg := http3.ConfigureTLSConfig(server.TLSConfig)
+	if s.SSLConfig.SSLMode == Static {
+		// https server loads certificate on start, HTTP/3 one needs it in config
+		cert, err := tls.LoadX509KeyPair(s.SSLConfig.Cert, s.SSLConfig.Key)
+		if err != nil {
+			return nil, fmt.Errorf("can't load certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	res := &http3.Server{
+		Addr:        server.Addr,
+		Handler:     server.Handler,
+		TLSConfig:   cfg,
+		IdleTimeout: server.IdleTimeout,
+	}
+	server.Handler = altSvcMiddleware(res)(server.Handler)
+	return res, nil
+}
+
+// altSvcMiddleware sets Alt-Svc header announcing HTTP/3 server, skipped until the server listens
+func altSvcMiddleware(h3 *http3.Server) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ProtoMajor < 3 {
+				_ = h3.SetQUICHeaders(w.Header())
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// adminCertAuth authenticates admin requests per client certificate policy. Certificate mapped to a user
+// authenticates the request as this user for the requested site, other requests are passed to auth
+// middleware. Roles are applied later, so the user gets admin access only if it is admin of the site.
+func adminCertAuth(policy AdminCertPolicy, auth func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		withAuth := auth(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cert := verifiedClientCert(r)
+			if cert == nil && policy.Required {
+				http.Error(w, "Client certificate required", http.StatusForbidden)
+				return
+			}
+			if cert != nil {
+				if userID, ok := policy.Users[cert.Subject.CommonName]; ok {
+					user := token.User{ID: userID, Name: cert.Subject.CommonName, Audience: r.URL.Query().Get("site")}
+					next.ServeHTTP(w, token.SetUserInfo(r, user))
+					return
+				}
+			}
+			withAuth.ServeHTTP(w, r)
+		})
+	}
+}
+
+// verifiedClientCert returns client certificate verified by https server, nil if there is no such certificate
+func verifiedClientCert(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return r.TLS.VerifiedChains[0][0]
+}
+
 // getRemarkHost returns hostname for remark server.
 // For example for remarkURL https://remark.com:443 it should return remark.com
 func (s *Rest) getRemarkHost() string {
@@ -129,7 +207,7 @@ func (s *Rest) getRemarkHost() string {
 }
 
 func (s *Rest) makeTLSConfig() *tls.Config {
-	return &tls.Config{
+	cfg := &tls.Config{
 		CipherSuites: []uint16{
 			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
 			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
@@ -143,4 +221,10 @@ func (s *Rest) makeTLSConfig() *tls.Config {
 			tls.CurveP384,
 		},
 	}
+	if s.SSLConfig.ClientCAs != nil {
+		// certificate is optional on handshake, as only admin API requires it
+		cfg.ClientCAs = s.SSLConfig.ClientCAs
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return cfg
 }
@@ -2,13 +2,21 @@ package api
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"io"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/go-pkgz/auth/v2/token"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -99,3 +107,128 @@ func TestSSL_ACME_HTTPChallengeRouter(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, "token", string(body))
 }
+
+func TestSSL_AdminCertAuth(t *testing.T) {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "ops"}}
+	withCert := func(r *http.Request) *http.Request {
+		r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		return r
+	}
+	unverified := func(r *http.Request) *http.Request {
+		r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}} // presented but not verified
+		return r
+	}
+	tokenAuth := func(next http.Handler) http.Handler { // stands for jwt auth, accepts requests with token header only
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-JWT") == "" {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, token.SetUserInfo(r, token.User{ID: "jwt_user", Audience: "remark"}))
+		})
+	}
+	call := func(policy AdminCertPolicy, r *http.Request) (code int, user token.User) {
+		next := http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+			user, _ = token.GetUserInfo(r)
+		})
+		rr := httptest.NewRecorder()
+		adminCertAuth(policy, tokenAuth)(next).ServeHTTP(rr, r)
+		return rr.Code, user
+	}
+	req := func(hdr string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/admin/users?site=remark", http.NoBody)
+		if hdr != "" {
+			r.Header.Set("X-JWT", hdr)
+		}
+		return r
+	}
+
+	t.Run("no policy, token auth only", func(t *testing.T) {
+		code, user := call(AdminCertPolicy{}, req("tkn"))
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "jwt_user", user.ID)
+		code, _ = call(AdminCertPolicy{}, withCert(req("")))
+		assert.Equal(t, http.StatusUnauthorized, code, "unmapped certificate doesn't authenticate")
+	})
+	t.Run("required certificate", func(t *testing.T) {
+		code, _ := call(AdminCertPolicy{Required: true}, req("tkn"))
+		assert.Equal(t, http.StatusForbidden, code, "token without certificate rejected")
+		code, _ = call(AdminCertPolicy{Required: true}, unverified(req("tkn")))
+		assert.Equal(t, http.StatusForbidden, code, "unverified certificate ignored")
+		code, user := call(AdminCertPolicy{Required: true}, withCert(req("tkn")))
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "jwt_user", user.ID, "token still required")
+		code, _ = call(AdminCertPolicy{Required: true}, withCert(req("")))
+		assert.Equal(t, http.StatusUnauthorized, code)
+	})
+	t.Run("certificate mapped to user", func(t *testing.T) {
+		policy := AdminCertPolicy{Required: true, Users: map[string]string{"ops": "github_ops"}}
+		code, user := call(policy, withCert(req("")))
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, token.User{ID: "github_ops", Name: "ops", Audience: "remark"}, user)
+		assert.False(t, user.IsAdmin(), "admin status is set by roles of the site")
+		code, _ = call(policy, unverified(req("")))
+		assert.Equal(t, http.StatusForbidden, code)
+	})
+}
+
+func TestSSL_ClientCertHandshake(t *testing.T) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTmpl := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "test ca"}, IsCA: true,
+		BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign, NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour)}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	clientCert := func(signer *x509.Certificate, signerKey *ecdsa.PrivateKey, cn string) tls.Certificate {
+		key, e := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, e)
+		tmpl := &x509.Certificate{SerialNumber: big.NewInt(2), Subject: pkix.Name{CommonName: cn},
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour)}
+		if signer == nil {
+			signer, signerKey = tmpl, key // self-signed
+		}
+		der, e := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+		require.NoError(t, e)
+		return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	srv := Rest{SSLConfig: SSLConfig{ClientCAs: pool}}
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cert := verifiedClientCert(r); cert != nil {
+			_, _ = w.Write([]byte(cert.Subject.CommonName))
+		}
+	}))
+	ts.TLS = srv.makeTLSConfig()
+	assert.Equal(t, tls.VerifyClientCertIfGiven, ts.TLS.ClientAuth)
+	ts.StartTLS()
+	defer ts.Close()
+
+	get := func(certs ...tls.Certificate) (string, error) {
+		client := http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true, Certificates: certs}}} //nolint:gosec // test server
+		defer client.CloseIdleConnections()
+		resp, e := client.Get(ts.URL)
+		if e != nil {
+			return "", e
+		}
+		defer resp.Body.Close()
+		body, e := io.ReadAll(resp.Body)
+		return string(body), e
+	}
+
+	body, err := get()
+	require.NoError(t, err, "certificate is optional")
+	assert.Empty(t, body)
+
+	body, err = get(clientCert(ca, caKey, "ops"))
+	require.NoError(t, err)
+	assert.Equal(t, "ops", body)
+
+	body, err = get(clientCert(nil, nil, "ops"))
+	require.NoError(t, err)
+	assert.Empty(t, body, "certificate of unknown ca is not sent nor verified")
+}
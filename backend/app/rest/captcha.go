@@ -0,0 +1,85 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// CaptchaHeader is the header client sends the captcha response token in with the protected request
+const CaptchaHeader = "X-Captcha-Token"
+
+// captcha providers verification endpoints, both accept the same form and respond the same way
+var captchaVerifyURLs = map[string]string{
+	"turnstile": "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+	"hcaptcha":  "https://api.hcaptcha.com/siteverify",
+}
+
+// Captcha verifies captcha response tokens made by Cloudflare Turnstile or hCaptcha widget on the client
+type Captcha struct {
+	Type      string       // provider, turnstile or hcaptcha
+	Secret    string       // secret key of the provider
+	SiteKey   string       // public key of the widget, passed to the frontend
+	Client    *http.Client // client of verification requests, with 10s timeout if nil
+	VerifyURL string       // verification endpoint, the default one of the provider if empty
+}
+
+// NewCaptcha makes Captcha of the provider with the keys
+func NewCaptcha(captchaType, secret, siteKey string) (*Captcha, error) {
+	if _, ok := captchaVerifyURLs[captchaType]; !ok {
+		return nil, fmt.Errorf("unknown captcha type %q", captchaType)
+	}
+	if secret == "" {
+		return nil, errors.New("captcha secret is required")
+	}
+	return &Captcha{Type: captchaType, Secret: secret, SiteKey: siteKey}, nil
+}
+
+// Verify checks the response token with the provider, remoteIP is optional
+func (c *Captcha) Verify(ctx context.Context, token, remoteIP string) error {
+	if token == "" {
+		return errors.New("captcha required")
+	}
+	form := url.Values{"secret": {c.Secret}, "response": {token}}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+	verifyURL := c.VerifyURL
+	if verifyURL == "" {
+		verifyURL = captchaVerifyURLs[c.Type]
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, verifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("can't make %s request: %w", c.Type, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	client := c.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s request failed: %w", c.Type, err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // nothing to do with the error
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s responded with status %d", c.Type, resp.StatusCode)
+	}
+	res := struct {
+		Success    bool     `json:"success"`
+		ErrorCodes []string `json:"error-codes"`
+	}{}
+	if err = json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&res); err != nil {
+		return fmt.Errorf("can't decode %s response: %w", c.Type, err)
+	}
+	if !res.Success {
+		return fmt.Errorf("captcha rejected: %s", strings.Join(res.ErrorCodes, ", "))
+	}
+	return nil
+}
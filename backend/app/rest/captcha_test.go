@@ -0,0 +1,44 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCaptcha(t *testing.T) {
+	_, err := NewCaptcha("recaptcha", "secret", "")
+	assert.EqualError(t, err, `unknown captcha type "recaptcha"`)
+	_, err = NewCaptcha("turnstile", "", "")
+	assert.EqualError(t, err, "captcha secret is required")
+	c, err := NewCaptcha("hcaptcha", "secret", "site-key")
+	require.NoError(t, err)
+	assert.Equal(t, &Captcha{Type: "hcaptcha", Secret: "secret", SiteKey: "site-key"}, c)
+}
+
+func TestCaptcha_Verify(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "secret", r.PostForm.Get("secret"))
+		switch r.PostForm.Get("response") {
+		case "good":
+			assert.Equal(t, "10.0.0.1", r.PostForm.Get("remoteip"))
+			_, _ = w.Write([]byte(`{"success":true}`))
+		case "broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			_, _ = w.Write([]byte(`{"success":false,"error-codes":["invalid-input-response"]}`))
+		}
+	}))
+	defer ts.Close()
+
+	c := Captcha{Type: "turnstile", Secret: "secret", VerifyURL: ts.URL}
+	assert.EqualError(t, c.Verify(context.Background(), "", ""), "captcha required")
+	assert.NoError(t, c.Verify(context.Background(), "good", "10.0.0.1"))
+	assert.EqualError(t, c.Verify(context.Background(), "bad", ""), "captcha rejected: invalid-input-response")
+	assert.EqualError(t, c.Verify(context.Background(), "broken", ""), "turnstile responded with status 500")
+}
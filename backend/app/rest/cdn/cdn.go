@@ -0,0 +1,99 @@
+// Package cdn makes caching hints for CDN in front of read endpoints and purges CDN on invalidation.
+// Responses are tagged with surrogate keys made of the site and the scopes of the cache, the same scopes
+// flushed from the cache are purged from CDN, so CDN can keep responses for a long time safely.
+package cdn
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	lcw "github.com/go-pkgz/lcw/v2"
+	log "github.com/go-pkgz/lgr"
+)
+
+const defaultPurgeTimeout = 10 * time.Second
+
+// LoadingCache defines interface of the cache of responses
+type LoadingCache interface {
+	Get(key lcw.Key, fn func() ([]byte, error)) (data []byte, err error)
+	Flush(req lcw.FlusherRequest)
+	Close() error
+}
+
+// Purger purges responses tagged with any of surrogate keys from CDN
+type Purger interface {
+	Purge(ctx context.Context, keys []string) error
+}
+
+// Cache wraps the cache of responses, purging flushed scopes from CDN as well
+type Cache struct {
+	LoadingCache
+	Purger  Purger
+	Timeout time.Duration // timeout of purge request, 10s if not set
+}
+
+// FlushScopes evicts cached records in scopes and purges responses of the site with them from CDN.
+// Purge made in background, failed purge logged only.
+func (c *Cache) FlushScopes(siteID string, scopes ...string) {
+	c.LoadingCache.Flush(lcw.Flusher(siteID).Scopes(scopes...))
+	if c.Purger == nil {
+		return
+	}
+	keys := Keys(siteID, scopes...)
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = defaultPurgeTimeout
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err := c.Purger.Purge(ctx, keys); err != nil {
+			log.Printf("[WARN] can't purge cdn for site %s, %v", siteID, err)
+		}
+	}()
+}
+
+// Flush evicts cached records of the site in scopes, purging them from CDN if the cache is wrapped with Cache.
+// Scope of the site itself covers all responses of the site.
+func Flush(c LoadingCache, siteID string, scopes ...string) {
+	if cc, ok := c.(*Cache); ok {
+		cc.FlushScopes(siteID, scopes...)
+		return
+	}
+	c.Flush(lcw.Flusher(siteID).Scopes(scopes...))
+}
+
+// Keys makes surrogate keys of the site scopes. Scopes are urls, user ids and other values not allowed
+// in keys, so keys are hashed.
+func Keys(siteID string, scopes ...string) []string {
+	res := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		h := sha256.Sum256([]byte(siteID + "\x00" + scope))
+		key := "r42-" + hex.EncodeToString(h[:12])
+		if !slices.Contains(res, key) {
+			res = append(res, key)
+		}
+	}
+	return res
+}
+
+// SetHeaders sets headers allowing CDN to keep the response for maxAge, tagged with keys of the site scopes.
+// The response is tagged with the key of the site too. Browsers revalidate the response every time,
+// as they are not purged on invalidation.
+func SetHeaders(w http.ResponseWriter, maxAge time.Duration, siteID string, scopes ...string) {
+	keys := strings.Join(Keys(siteID, append([]string{siteID}, scopes...)...), " ")
+	h := w.Header()
+	h.Set("Cache-Control", fmt.Sprintf("public, max-age=0, s-maxage=%d", int(maxAge.Seconds())))
+	h.Set("Surrogate-Control", fmt.Sprintf("max-age=%d", int(maxAge.Seconds())))
+	h.Set("Surrogate-Key", keys)                           // fastly and others
+	h.Set("Cache-Tag", strings.ReplaceAll(keys, " ", ",")) // cloudflare
+	h.Del("Expires")
+	h.Del("Pragma")
+	h.Del("X-Accel-Expires")
+}
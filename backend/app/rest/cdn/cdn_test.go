@@ -0,0 +1,75 @@
+package cdn
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	lcw "github.com/go-pkgz/lcw/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeys(t *testing.T) {
+	keys := Keys("site1", "site1", "https://example.com/post?a=1 b", "site1")
+	require.Len(t, keys, 2, "duplicates removed")
+	for _, k := range keys {
+		assert.Regexp(t, `^r42-[0-9a-f]{24}$`, k)
+	}
+	assert.Equal(t, keys[:1], Keys("site1", "site1"))
+	assert.NotEqual(t, Keys("site1", "url"), Keys("site2", "url"), "keys of the same scope differ by site")
+	assert.Empty(t, Keys("site1"))
+}
+
+func TestSetHeaders(t *testing.T) {
+	rr := httptest.NewRecorder()
+	rr.Header().Set("Cache-Control", "no-cache, no-store")
+	rr.Header().Set("Expires", "Thu, 01 Jan 1970 00:00:00 UTC")
+	rr.Header().Set("Pragma", "no-cache")
+	SetHeaders(rr, 10*time.Minute, "site1", "https://example.com/post")
+
+	keys := Keys("site1", "site1", "https://example.com/post")
+	assert.Equal(t, "public, max-age=0, s-maxage=600", rr.Header().Get("Cache-Control"))
+	assert.Equal(t, "max-age=600", rr.Header().Get("Surrogate-Control"))
+	assert.Equal(t, strings.Join(keys, " "), rr.Header().Get("Surrogate-Key"))
+	assert.Equal(t, strings.Join(keys, ","), rr.Header().Get("Cache-Tag"))
+	assert.Empty(t, rr.Header().Get("Expires"))
+	assert.Empty(t, rr.Header().Get("Pragma"))
+}
+
+func TestFlush(t *testing.T) {
+	lru, err := lcw.NewLruCache(lcw.NewOpts[[]byte]().MaxKeys(10))
+	require.NoError(t, err)
+	backend := lcw.NewScache[[]byte](lru)
+	load := func(key lcw.Key, val string) {
+		_, err := backend.Get(key, func() ([]byte, error) { return []byte(val), nil })
+		require.NoError(t, err)
+	}
+	load(lcw.NewKey("site1").ID("k1").Scopes("site1", "url1"), "v1")
+	load(lcw.NewKey("site1").ID("k2").Scopes("site1", "url2"), "v2")
+
+	purged := make(chan []string, 1)
+	c := &Cache{LoadingCache: backend, Purger: purgerFunc(func(_ context.Context, keys []string) error {
+		purged <- keys
+		return errors.New("failed") // logged only
+	})}
+	Flush(c, "site1", "url1")
+	select {
+	case keys := <-purged:
+		assert.Equal(t, Keys("site1", "url1"), keys)
+	case <-time.After(time.Second):
+		t.Fatal("cdn not purged")
+	}
+	assert.Equal(t, 1, backend.Stat().Keys)
+
+	// not wrapped cache flushed only
+	Flush(backend, "site1", "site1")
+	assert.Equal(t, 0, backend.Stat().Keys)
+}
+
+type purgerFunc func(ctx context.Context, keys []string) error
+
+func (f purgerFunc) Purge(ctx context.Context, keys []string) error { return f(ctx, keys) }
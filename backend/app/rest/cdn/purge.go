@@ -0,0 +1,103 @@
+package cdn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+const (
+	fastlyAPI          = "https://api.fastly.com"
+	cloudflareAPI      = "https://api.cloudflare.com/client/v4"
+	fastlyMaxKeys      = 256 // keys purged by one request of fastly
+	cloudflareMaxTags  = 30  // tags purged by one request of cloudflare
+	maxErrResponseSize = 1024
+)
+
+// Fastly purges responses by surrogate keys with Fastly API
+type Fastly struct {
+	ServiceID string
+	Token     string       // API token with purge_select scope
+	Client    *http.Client // http.DefaultClient if not set
+	API       string       // base url of API, https://api.fastly.com if not set
+}
+
+// Purge purges responses tagged with any of keys
+func (f *Fastly) Purge(ctx context.Context, keys []string) error {
+	api := f.API
+	if api == "" {
+		api = fastlyAPI
+	}
+	for chunk := range slices.Chunk(keys, fastlyMaxKeys) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, api+"/service/"+f.ServiceID+"/purge", http.NoBody)
+		if err != nil {
+			return fmt.Errorf("can't make fastly purge request: %w", err)
+		}
+		req.Header.Set("Fastly-Key", f.Token)
+		req.Header.Set("Surrogate-Key", strings.Join(chunk, " "))
+		req.Header.Set("Accept", "application/json")
+		if err = send(client(f.Client), req); err != nil {
+			return fmt.Errorf("fastly purge: %w", err)
+		}
+	}
+	return nil
+}
+
+// Cloudflare purges responses by cache tags with Cloudflare API
+type Cloudflare struct {
+	ZoneID string
+	Token  string       // API token with cache purge permission of the zone
+	Client *http.Client // http.DefaultClient if not set
+	API    string       // base url of API, https://api.cloudflare.com/client/v4 if not set
+}
+
+// Purge purges responses tagged with any of keys
+func (c *Cloudflare) Purge(ctx context.Context, keys []string) error {
+	api := c.API
+	if api == "" {
+		api = cloudflareAPI
+	}
+	for chunk := range slices.Chunk(keys, cloudflareMaxTags) {
+		body, err := json.Marshal(struct {
+			Tags []string `json:"tags"`
+		}{Tags: chunk})
+		if err != nil {
+			return fmt.Errorf("can't marshal cloudflare purge request: %w", err)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, api+"/zones/"+c.ZoneID+"/purge_cache", bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("can't make cloudflare purge request: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+		req.Header.Set("Content-Type", "application/json")
+		if err = send(client(c.Client), req); err != nil {
+			return fmt.Errorf("cloudflare purge: %w", err)
+		}
+	}
+	return nil
+}
+
+func send(cl *http.Client, req *http.Request) error {
+	resp, err := cl.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck // nothing to do with the error
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrResponseSize))
+		return fmt.Errorf("responded with status %d, %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+func client(cl *http.Client) *http.Client {
+	if cl == nil {
+		return http.DefaultClient
+	}
+	return cl
+}
@@ -0,0 +1,79 @@
+package cdn
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFastly_Purge(t *testing.T) {
+	var purged [][]string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/service/svc1/purge", r.URL.Path)
+		if r.Header.Get("Fastly-Key") != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"msg":"Provided credentials are missing or invalid"}`))
+			return
+		}
+		purged = append(purged, strings.Split(r.Header.Get("Surrogate-Key"), " "))
+		_, _ = w.Write([]byte(`{"k1":"108-1391560174-974124"}`))
+	}))
+	defer ts.Close()
+
+	keys := make([]string, fastlyMaxKeys+1)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("k%d", i)
+	}
+	f := &Fastly{ServiceID: "svc1", Token: "token", API: ts.URL}
+	require.NoError(t, f.Purge(context.Background(), keys))
+	require.Len(t, purged, 2, "keys purged in chunks")
+	assert.Equal(t, keys[:fastlyMaxKeys], purged[0])
+	assert.Equal(t, keys[fastlyMaxKeys:], purged[1])
+
+	f.Token = "bad"
+	err := f.Purge(context.Background(), []string{"k1"})
+	assert.EqualError(t, err, `fastly purge: responded with status 401, {"msg":"Provided credentials are missing or invalid"}`)
+}
+
+func TestCloudflare_Purge(t *testing.T) {
+	var purged [][]string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/zones/zone1/purge_cache", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"success":false,"errors":[{"code":10000,"message":"Authentication error"}]}`))
+			return
+		}
+		req := struct {
+			Tags []string `json:"tags"`
+		}{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		purged = append(purged, req.Tags)
+		_, _ = w.Write([]byte(`{"success":true,"errors":[],"result":{"id":"zone1"}}`))
+	}))
+	defer ts.Close()
+
+	keys := make([]string, cloudflareMaxTags+5)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("k%d", i)
+	}
+	c := &Cloudflare{ZoneID: "zone1", Token: "token", API: ts.URL}
+	require.NoError(t, c.Purge(context.Background(), keys))
+	require.Len(t, purged, 2, "tags purged in chunks")
+	assert.Equal(t, keys[:cloudflareMaxTags], purged[0])
+	assert.Equal(t, keys[cloudflareMaxTags:], purged[1])
+
+	c.Token = "bad"
+	err := c.Purge(context.Background(), []string{"k1"})
+	assert.ErrorContains(t, err, "cloudflare purge: responded with status 403")
+}
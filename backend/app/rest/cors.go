@@ -0,0 +1,137 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"sync"
+
+	"github.com/umputun/remark42/backend/app/store/settings"
+)
+
+// CORSPolicy defines cross-origin requests allowed for the site
+type CORSPolicy struct {
+	Origins     []string `json:"origins"`     // allowed origins, like https://example.com, or "*" for any
+	Credentials bool     `json:"credentials"` // allow requests with cookies and auth headers
+	MaxAge      int      `json:"max_age"`     // time browsers cache preflight responses, in seconds
+}
+
+// Validate checks origins are "*" or scheme://host[:port] without path, and max age is in range
+func (p CORSPolicy) Validate() error {
+	if p.MaxAge < 0 || p.MaxAge > 86400 {
+		return fmt.Errorf("max age %d out of range 0..86400", p.MaxAge)
+	}
+	for _, origin := range p.Origins {
+		if origin == "*" {
+			if len(p.Origins) > 1 {
+				return errors.New(`"*" should be the only origin`)
+			}
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+			u.Path != "" || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+			return fmt.Errorf("invalid origin %q, expected scheme://host[:port]", origin)
+		}
+	}
+	return nil
+}
+
+// CORSPolicies keeps default CORS policy with per-site overrides changeable at runtime.
+// Runtime changes saved to the settings store once restored from it. Thread safe.
+type CORSPolicies struct {
+	mu            sync.RWMutex
+	defaultPolicy CORSPolicy
+	configured    map[string]CORSPolicy
+	sites         map[string]CORSPolicy // runtime changes
+	store         settings.Store
+}
+
+const corsSetting = "cors_policy" // name of the setting in the store
+
+// NewCORSPolicies makes CORSPolicies with default policy and configured per-site ones, all validated
+func NewCORSPolicies(defaultPolicy CORSPolicy, sites map[string]CORSPolicy) (*CORSPolicies, error) {
+	if err := defaultPolicy.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid default cors policy: %w", err)
+	}
+	res := &CORSPolicies{defaultPolicy: defaultPolicy, configured: map[string]CORSPolicy{}, sites: map[string]CORSPolicy{}}
+	for siteID, policy := range sites {
+		if err := policy.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid cors policy of site %s: %w", siteID, err)
+		}
+		res.configured[siteID] = policy
+	}
+	return res, nil
+}
+
+// Restore loads runtime changes saved in the settings store and saves further changes there
+func (c *CORSPolicies) Restore(store settings.Store) error {
+	saved, err := store.All(corsSetting)
+	if err != nil {
+		return fmt.Errorf("can't load cors policies: %w", err)
+	}
+	sites := make(map[string]CORSPolicy, len(saved))
+	for siteID, data := range saved {
+		policy := CORSPolicy{}
+		if err = json.Unmarshal(data, &policy); err != nil {
+			return fmt.Errorf("can't unmarshal cors policy of %s: %w", siteID, err)
+		}
+		if err = policy.Validate(); err != nil {
+			return fmt.Errorf("invalid cors policy of %s: %w", siteID, err)
+		}
+		sites[siteID] = policy
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sites, c.store = sites, store
+	return nil
+}
+
+// Policy returns CORS policy of the site, changed at runtime, configured or default one
+func (c *CORSPolicies) Policy(siteID string) CORSPolicy {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if policy, ok := c.sites[siteID]; ok {
+		return policy
+	}
+	if policy, ok := c.configured[siteID]; ok {
+		return policy
+	}
+	return c.defaultPolicy
+}
+
+// Set validates and sets CORS policy of the site
+func (c *CORSPolicies) Set(siteID string, policy CORSPolicy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	policy.Origins = slices.Clone(policy.Origins)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.store != nil {
+		data, err := json.Marshal(policy)
+		if err != nil {
+			return fmt.Errorf("can't marshal cors policy of %s: %w", siteID, err)
+		}
+		if err = c.store.Set(corsSetting, siteID, data); err != nil {
+			return fmt.Errorf("can't save cors policy of %s: %w", siteID, err)
+		}
+	}
+	c.sites[siteID] = policy
+	return nil
+}
+
+// Reset removes runtime changes of the site's CORS policy, back to the configured one
+func (c *CORSPolicies) Reset(siteID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.store != nil {
+		if err := c.store.Delete(corsSetting, siteID); err != nil {
+			return fmt.Errorf("can't remove cors policy of %s: %w", siteID, err)
+		}
+	}
+	delete(c.sites, siteID)
+	return nil
+}
@@ -0,0 +1,91 @@
+package rest
+
+import (
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/umputun/remark42/backend/app/store/settings"
+)
+
+func TestCORSPolicy_Validate(t *testing.T) {
+	tbl := []struct {
+		policy CORSPolicy
+		err    string
+	}{
+		{CORSPolicy{Origins: []string{"*"}, Credentials: true, MaxAge: 300}, ""},
+		{CORSPolicy{Origins: []string{"https://example.com", "http://localhost:8080"}}, ""},
+		{CORSPolicy{}, ""},
+		{CORSPolicy{Origins: []string{"*", "https://example.com"}}, `"*" should be the only origin`},
+		{CORSPolicy{Origins: []string{"example.com"}}, `invalid origin "example.com", expected scheme://host[:port]`},
+		{CORSPolicy{Origins: []string{"https://example.com/"}}, `invalid origin "https://example.com/", expected scheme://host[:port]`},
+		{CORSPolicy{Origins: []string{"ftp://example.com"}}, `invalid origin "ftp://example.com", expected scheme://host[:port]`},
+		{CORSPolicy{Origins: []string{"https://user@example.com"}}, `invalid origin "https://user@example.com", expected scheme://host[:port]`},
+		{CORSPolicy{MaxAge: -1}, "max age -1 out of range 0..86400"},
+		{CORSPolicy{MaxAge: 86401}, "max age 86401 out of range 0..86400"},
+	}
+	for _, tt := range tbl {
+		err := tt.policy.Validate()
+		if tt.err == "" {
+			assert.NoError(t, err, tt.policy)
+			continue
+		}
+		assert.EqualError(t, err, tt.err)
+	}
+}
+
+func TestCORSPolicies(t *testing.T) {
+	def := CORSPolicy{Origins: []string{"*"}, Credentials: true, MaxAge: 300}
+	_, err := NewCORSPolicies(CORSPolicy{Origins: []string{"bad"}}, nil)
+	require.EqualError(t, err, `invalid default cors policy: invalid origin "bad", expected scheme://host[:port]`)
+	_, err = NewCORSPolicies(def, map[string]CORSPolicy{"blog": {MaxAge: -5}})
+	require.EqualError(t, err, "invalid cors policy of site blog: max age -5 out of range 0..86400")
+
+	blog := CORSPolicy{Origins: []string{"https://blog.example.com"}, MaxAge: 60}
+	c, err := NewCORSPolicies(def, map[string]CORSPolicy{"blog": blog})
+	require.NoError(t, err)
+	assert.Equal(t, def, c.Policy("news"))
+	assert.Equal(t, blog, c.Policy("blog"))
+
+	news := CORSPolicy{Origins: []string{"https://news.example.com"}, Credentials: true}
+	require.NoError(t, c.Set("news", news))
+	require.NoError(t, c.Set("blog", CORSPolicy{}))
+	assert.Equal(t, news, c.Policy("news"))
+	assert.Equal(t, CORSPolicy{}, c.Policy("blog"))
+	require.Error(t, c.Set("news", CORSPolicy{Origins: []string{"news.example.com"}}))
+	assert.Equal(t, news, c.Policy("news"), "invalid policy not set")
+
+	require.NoError(t, c.Reset("news"))
+	require.NoError(t, c.Reset("blog"))
+	assert.Equal(t, def, c.Policy("news"), "back to default")
+	assert.Equal(t, blog, c.Policy("blog"), "back to configured")
+}
+
+func TestCORSPolicies_Restore(t *testing.T) {
+	settingsStore, err := settings.NewBoltStorage(path.Join(t.TempDir(), "settings.db"), bolt.Options{})
+	require.NoError(t, err)
+	defer settingsStore.Close()
+
+	def := CORSPolicy{Origins: []string{"*"}, MaxAge: 300}
+	blog := CORSPolicy{Origins: []string{"https://blog.example.com"}, MaxAge: 60}
+	c, err := NewCORSPolicies(def, map[string]CORSPolicy{"blog": blog})
+	require.NoError(t, err)
+	require.NoError(t, c.Restore(settingsStore))
+	news := CORSPolicy{Origins: []string{"https://news.example.com"}, Credentials: true}
+	require.NoError(t, c.Set("news", news))
+	require.NoError(t, c.Set("blog", CORSPolicy{}))
+	require.NoError(t, c.Reset("blog"))
+
+	c, err = NewCORSPolicies(def, map[string]CORSPolicy{"blog": blog}) // restart
+	require.NoError(t, err)
+	require.NoError(t, c.Restore(settingsStore))
+	assert.Equal(t, news, c.Policy("news"), "runtime change kept")
+	assert.Equal(t, blog, c.Policy("blog"), "reset kept")
+	assert.Equal(t, def, c.Policy("other"))
+
+	require.NoError(t, settingsStore.Set(corsSetting, "bad", []byte(`{"max_age":-1}`)))
+	assert.EqualError(t, c.Restore(settingsStore), "invalid cors policy of bad: max age -1 out of range 0..86400")
+}
@@ -0,0 +1,140 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CSPReport is a Content-Security-Policy violation reported by browsers, repeated ones counted
+type CSPReport struct {
+	DocumentURI string    `json:"document_uri"`
+	Directive   string    `json:"directive"`
+	BlockedURI  string    `json:"blocked_uri"`
+	Count       int       `json:"count"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+}
+
+// CSPReports keeps distinct CSP violation reports, evicting the least recently seen above the limit. Thread safe.
+type CSPReports struct {
+	mu      sync.Mutex
+	limit   int
+	reports []CSPReport // sorted by LastSeen, oldest first
+}
+
+// NewCSPReports makes CSPReports keeping up to limit distinct reports
+func NewCSPReports(limit int) *CSPReports {
+	return &CSPReports{limit: max(limit, 1)}
+}
+
+// Add parses violation reports from the body sent by browser and keeps them. Both legacy report-uri
+// format (application/csp-report) and Reporting API one (application/reports+json) are supported.
+// Query and fragment are stripped from reported URIs, as they may contain user's data.
+func (c *CSPReports) Add(body []byte) (int, error) {
+	reports, err := parseCSPReports(body)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, r := range reports {
+		r.DocumentURI, r.BlockedURI = stripURIQuery(r.DocumentURI), stripURIQuery(r.BlockedURI)
+		idx := slices.IndexFunc(c.reports, func(v CSPReport) bool {
+			return v.DocumentURI == r.DocumentURI && v.Directive == r.Directive && v.BlockedURI == r.BlockedURI
+		})
+		if idx >= 0 {
+			r = c.reports[idx]
+			c.reports = slices.Delete(c.reports, idx, idx+1)
+		} else {
+			r.FirstSeen = now
+		}
+		r.Count++
+		r.LastSeen = now
+		c.reports = append(c.reports, r)
+		if len(c.reports) > c.limit {
+			c.reports = slices.Delete(c.reports, 0, len(c.reports)-c.limit)
+		}
+	}
+	return len(reports), nil
+}
+
+// List returns kept reports, the most recently seen first
+func (c *CSPReports) List() []CSPReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	res := slices.Clone(c.reports)
+	slices.Reverse(res)
+	if res == nil {
+		res = []CSPReport{}
+	}
+	return res
+}
+
+// parseCSPReports decodes reports in either legacy or Reporting API format
+func parseCSPReports(body []byte) ([]CSPReport, error) {
+	body = []byte(strings.TrimSpace(string(body)))
+	if len(body) == 0 {
+		return nil, errors.New("empty report")
+	}
+
+	if body[0] == '[' { // Reporting API, application/reports+json
+		var batch []struct {
+			Type string `json:"type"`
+			Body struct {
+				DocumentURL        string `json:"documentURL"`
+				EffectiveDirective string `json:"effectiveDirective"`
+				BlockedURL         string `json:"blockedURL"`
+			} `json:"body"`
+		}
+		if err := json.Unmarshal(body, &batch); err != nil {
+			return nil, fmt.Errorf("can't decode reports: %w", err)
+		}
+		res := []CSPReport{}
+		for _, r := range batch {
+			if r.Type != "csp-violation" {
+				continue
+			}
+			res = append(res, CSPReport{DocumentURI: r.Body.DocumentURL, Directive: r.Body.EffectiveDirective,
+				BlockedURI: r.Body.BlockedURL})
+		}
+		return res, nil
+	}
+
+	var legacy struct {
+		Report struct {
+			DocumentURI        string `json:"document-uri"`
+			ViolatedDirective  string `json:"violated-directive"`
+			EffectiveDirective string `json:"effective-directive"`
+			BlockedURI         string `json:"blocked-uri"`
+		} `json:"csp-report"`
+	}
+	if err := json.Unmarshal(body, &legacy); err != nil {
+		return nil, fmt.Errorf("can't decode report: %w", err)
+	}
+	directive := legacy.Report.EffectiveDirective
+	if directive == "" {
+		directive, _, _ = strings.Cut(legacy.Report.ViolatedDirective, " ")
+	}
+	if legacy.Report.DocumentURI == "" && directive == "" {
+		return nil, errors.New("no csp-report in body")
+	}
+	return []CSPReport{{DocumentURI: legacy.Report.DocumentURI, Directive: directive, BlockedURI: legacy.Report.BlockedURI}}, nil
+}
+
+// stripURIQuery drops query and fragment of the uri, keeps non-url values like "inline" as is
+func stripURIQuery(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme == "" {
+		return uri
+	}
+	u.RawQuery, u.Fragment, u.RawFragment, u.User = "", "", "", nil
+	return u.String()
+}
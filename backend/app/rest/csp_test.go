@@ -0,0 +1,42 @@
+package rest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCSPReports_Add(t *testing.T) {
+	c := NewCSPReports(2)
+	assert.Equal(t, []CSPReport{}, c.List())
+
+	n, err := c.Add([]byte(`{"csp-report":{"document-uri":"https://remark42.example.com/web/iframe.html?site=s1&url=https://blog/p1#c1",
+		"violated-directive":"img-src 'self'","blocked-uri":"https://tracker.example.com/pixel.gif?u=123"}}`))
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	n, err = c.Add([]byte(`[{"type":"csp-violation","body":{"documentURL":"https://remark42.example.com/web/iframe.html?site=s2",
+		"effectiveDirective":"img-src","blockedURL":"https://tracker.example.com/pixel.gif"}},
+		{"type":"deprecation","body":{}},
+		{"type":"csp-violation","body":{"documentURL":"https://remark42.example.com/web/iframe.html",
+		"effectiveDirective":"script-src-elem","blockedURL":"inline"}}]`))
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	res := c.List()
+	require.Len(t, res, 2, "limited to 2 reports")
+	assert.Equal(t, "script-src-elem", res[0].Directive)
+	assert.Equal(t, "inline", res[0].BlockedURI)
+	assert.Equal(t, "https://remark42.example.com/web/iframe.html", res[1].DocumentURI, "query and fragment stripped")
+	assert.Equal(t, "img-src", res[1].Directive)
+	assert.Equal(t, "https://tracker.example.com/pixel.gif", res[1].BlockedURI)
+	assert.Equal(t, 2, res[1].Count, "repeated report counted")
+	assert.False(t, res[1].FirstSeen.IsZero())
+	assert.False(t, res[1].LastSeen.Before(res[1].FirstSeen))
+
+	for i, body := range []string{"", "not json", `{"foo":"bar"}`, `[{"type":"csp-violation","body":"bad"}]`} {
+		_, err = c.Add([]byte(body))
+		assert.Error(t, err, fmt.Sprintf("case %d", i))
+	}
+}
@@ -0,0 +1,45 @@
+package rest
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DeviceParam is anonymous login parameter with device token, issued by the server and kept by the client
+const DeviceParam = "device"
+
+// MakeDeviceToken makes random device identity signed with the secret, as "id.signature"
+func MakeDeviceToken(secret string) (string, error) {
+	if secret == "" {
+		return "", errors.New("no secret to sign device id")
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("can't make device id: %w", err)
+	}
+	id := hex.EncodeToString(b)
+	return id + "." + deviceSignature(id, secret), nil
+}
+
+// DeviceID returns device identity from the token, false if the token is not signed with the secret
+func DeviceID(token, secret string) (string, bool) {
+	id, sig, ok := strings.Cut(token, ".")
+	if !ok || id == "" || secret == "" {
+		return "", false
+	}
+	if !hmac.Equal([]byte(sig), []byte(deviceSignature(id, secret))) {
+		return "", false
+	}
+	return id, true
+}
+
+func deviceSignature(id, secret string) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte("device:" + id))
+	return hex.EncodeToString(h.Sum(nil))
+}
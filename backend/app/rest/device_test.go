@@ -0,0 +1,34 @@
+package rest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeviceToken(t *testing.T) {
+	tkn, err := MakeDeviceToken("secret")
+	require.NoError(t, err)
+	id, ok := DeviceID(tkn, "secret")
+	require.True(t, ok)
+	assert.Len(t, id, 32)
+	assert.True(t, len(tkn) > len(id))
+
+	tkn2, err := MakeDeviceToken("secret")
+	require.NoError(t, err)
+	assert.NotEqual(t, tkn, tkn2, "new device id every time")
+
+	_, ok = DeviceID(tkn, "other secret")
+	assert.False(t, ok, "signed with another secret")
+	_, ok = DeviceID(id+".bad", "secret")
+	assert.False(t, ok, "bad signature")
+	_, ok = DeviceID(id, "secret")
+	assert.False(t, ok, "no signature")
+	_, ok = DeviceID("", "secret")
+	assert.False(t, ok)
+	_, ok = DeviceID(tkn, "")
+	assert.False(t, ok, "no secret")
+	_, err = MakeDeviceToken("")
+	assert.Error(t, err)
+}
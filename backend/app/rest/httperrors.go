@@ -39,6 +39,21 @@ const (
 	ErrAssetNotFound        = 18 // requested file not found
 	ErrCommentRestrictWords = 19 // restricted words in a comment
 	ErrImgNotFound          = 20 // posted image not found in the storage
+	ErrProfileRejected      = 21 // user profile change rejected by site's policy
+	ErrCommentLanguage      = 22 // comment language not allowed on the site
+	ErrCommentTooShort      = 23 // comment text shorter than site's min length
+	ErrCommentTooLong       = 24 // comment text longer than site's max length
+	ErrCommentTooManyLinks  = 25 // comment has more links than allowed on the site
+	ErrCommentTooManyImages = 26 // comment has more images than allowed on the site
+	ErrCommentTooMuchQuote  = 27 // comment quoted text share exceeds site's limit
+	ErrPoWRequired          = 28 // proof-of-work solution missing or invalid
+	ErrCommentGeoBlocked    = 29 // comments not allowed from commenter's country or network
+	ErrCommentExitNode      = 30 // comments not allowed from Tor or VPN
+	ErrMaintenance          = 31 // writes rejected while the site is in read-only maintenance mode
+	ErrQuotaExceeded        = 32 // site's usage over quota
+	ErrCommentRiskyIP       = 33 // comments not allowed from commenter's ip with bad reputation
+	ErrTOTPRequired         = 34 // admin api requires verified totp second factor
+	ErrCaptchaRequired      = 35 // captcha response missing or rejected by the provider
 )
 
 // errTmplData store data for error message
@@ -0,0 +1,52 @@
+package rest
+
+import (
+	"fmt"
+	"hash/fnv"
+	"html"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// InitialsSizes lists allowed sizes of initials avatars, in pixels
+var InitialsSizes = []int{24, 32, 48, 64, 96, 128}
+
+// InitialsAvatar makes svg avatar with up to two initials of the name, drawn on a background color
+// derived from the seed, so the same user always gets the same color. Dark variant uses deeper
+// background with lighter letters to fit dark pages.
+func InitialsAvatar(name, seed string, size int, dark bool) []byte {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(seed))
+	hue := h.Sum32() % 360
+
+	bg, fg := fmt.Sprintf("hsl(%d,55%%,45%%)", hue), "#fff"
+	if dark {
+		bg, fg = fmt.Sprintf("hsl(%d,40%%,28%%)", hue), fmt.Sprintf("hsl(%d,70%%,88%%)", hue)
+	}
+
+	return fmt.Appendf(nil, `<svg xmlns="http://www.w3.org/2000/svg" width="%[1]d" height="%[1]d" viewBox="0 0 %[1]d %[1]d">`+
+		`<rect width="%[1]d" height="%[1]d" fill="%[2]s"/>`+
+		`<text x="50%%" y="50%%" dy=".35em" text-anchor="middle" fill="%[3]s" font-size="%[4]d" font-weight="600" `+
+		`font-family="-apple-system,BlinkMacSystemFont,'Segoe UI',Helvetica,Arial,sans-serif">%[5]s</text></svg>`,
+		size, bg, fg, size*2/5, html.EscapeString(initials(name)))
+}
+
+// ValidInitialsSize checks if size is one of InitialsSizes
+func ValidInitialsSize(size int) bool {
+	return slices.Contains(InitialsSizes, size)
+}
+
+// initials returns uppercase first letters of the first and the last words of the name, "?" if none
+func initials(name string) string {
+	words := strings.FieldsFunc(name, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+	if len(words) == 0 {
+		return "?"
+	}
+	first := []rune(words[0])[0]
+	if len(words) == 1 {
+		return string(unicode.ToUpper(first))
+	}
+	last := []rune(words[len(words)-1])[0]
+	return string([]rune{unicode.ToUpper(first), unicode.ToUpper(last)})
+}
@@ -0,0 +1,52 @@
+package rest
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInitialsAvatar(t *testing.T) {
+	light := InitialsAvatar("John Doe", "github_123", 48, false)
+	assert.Contains(t, string(light), `width="48" height="48"`)
+	assert.Contains(t, string(light), `>JD</text>`)
+	assert.Contains(t, string(light), `fill="#fff"`)
+	assert.Equal(t, light, InitialsAvatar("John Doe", "github_123", 48, false), "deterministic")
+	assert.NoError(t, xml.Unmarshal(light, new(any)), "valid xml")
+
+	dark := InitialsAvatar("John Doe", "github_123", 48, true)
+	assert.NotEqual(t, light, dark)
+	assert.NotContains(t, string(dark), `fill="#fff"`)
+
+	other := InitialsAvatar("John Doe", "github_456", 48, false)
+	assert.NotEqual(t, light, other, "color depends on seed")
+
+	escaped := InitialsAvatar("<b", "x", 24, false)
+	assert.Contains(t, string(escaped), `>B</text>`)
+	amp := InitialsAvatar("&", "x", 24, false)
+	require.NoError(t, xml.Unmarshal(amp, new(any)))
+	assert.Contains(t, string(amp), `>?</text>`)
+}
+
+func TestInitials(t *testing.T) {
+	tbl := []struct {
+		name, res string
+	}{
+		{"John Doe", "JD"},
+		{"john", "J"},
+		{"John Ronald Reuel Tolkien", "JT"},
+		{"  mary-jane   watson ", "MW"},
+		{"Иван Петров", "ИП"},
+		{"anonymous_123", "A1"},
+		{"李小龙", "李"},
+		{"!!!", "?"},
+		{"", "?"},
+	}
+	for _, tt := range tbl {
+		assert.Equal(t, tt.res, initials(tt.name), tt.name)
+	}
+	assert.True(t, ValidInitialsSize(48))
+	assert.False(t, ValidInitialsSize(50))
+}
@@ -0,0 +1,171 @@
+package rest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/go-pkgz/auth/v2/token"
+	"github.com/go-pkgz/rest"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWKS signs tokens of users for other services with asymmetric keys, RS256 for RSA and ES256 for P-256 ECDSA keys,
+// and publishes public keys as JSON Web Key Set, so the services validate the tokens without the shared secret.
+// The first key signs, the rest are published only, for tokens signed before the key rotation.
+type JWKS struct {
+	keys []signingKey
+	ttl  time.Duration
+}
+
+type signingKey struct {
+	id     string
+	method jwt.SigningMethod
+	key    crypto.Signer
+}
+
+// NewJWKS makes JWKS with PEM private keys from the files, tokens signed with the first key live for ttl
+func NewJWKS(ttl time.Duration, files ...string) (*JWKS, error) {
+	if len(files) == 0 {
+		return nil, errors.New("no signing keys")
+	}
+	res := JWKS{ttl: ttl}
+	for _, file := range files {
+		data, err := os.ReadFile(file) //nolint:gosec // file set by server options
+		if err != nil {
+			return nil, fmt.Errorf("can't read signing key: %w", err)
+		}
+		k, err := parseSigningKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("can't parse signing key %s: %w", file, err)
+		}
+		res.keys = append(res.keys, k)
+	}
+	return &res, nil
+}
+
+// Token makes token of the user for the site, signed with the current key, and returns it with expiration time
+func (j *JWKS) Token(user token.User, siteID string) (tkn string, expires time.Time, err error) {
+	now := time.Now()
+	expires = now.Add(j.ttl)
+	claims := token.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "remark42",
+			Subject:   user.ID,
+			Audience:  jwt.ClaimStrings{siteID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now.Add(-time.Minute)),
+			ExpiresAt: jwt.NewNumericDate(expires),
+		},
+		User: &user,
+	}
+	current := j.keys[0]
+	t := jwt.NewWithClaims(current.method, claims)
+	t.Header["kid"] = current.id
+	if tkn, err = t.SignedString(current.key); err != nil {
+		return "", time.Time{}, fmt.Errorf("can't sign token: %w", err)
+	}
+	return tkn, expires, nil
+}
+
+// Parse checks the token signed by one of the keys and returns its claims
+func (j *JWKS) Parse(tkn string) (token.Claims, error) {
+	claims := token.Claims{}
+	keyFn := func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		for _, k := range j.keys {
+			if k.id == kid && k.method.Alg() == t.Method.Alg() {
+				return k.key.Public(), nil
+			}
+		}
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if _, err := jwt.ParseWithClaims(tkn, &claims, keyFn, jwt.WithIssuer("remark42"), jwt.WithExpirationRequired()); err != nil {
+		return token.Claims{}, fmt.Errorf("can't parse token: %w", err)
+	}
+	return claims, nil
+}
+
+// ServeHTTP renders public keys as JSON Web Key Set
+func (j *JWKS) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	keys := make([]map[string]string, 0, len(j.keys))
+	for _, k := range j.keys {
+		jwk := map[string]string{"kid": k.id, "alg": k.method.Alg(), "use": "sig"}
+		switch pub := k.key.Public().(type) {
+		case *rsa.PublicKey:
+			jwk["kty"], jwk["n"] = "RSA", b64(pub.N.Bytes())
+			jwk["e"] = b64(big.NewInt(int64(pub.E)).Bytes())
+		case *ecdsa.PublicKey:
+			ecdhKey, err := pub.ECDH()
+			if err != nil {
+				continue
+			}
+			point := ecdhKey.Bytes() // uncompressed, 0x04 followed by x and y of 32 bytes each
+			jwk["kty"], jwk["crv"] = "EC", "P-256"
+			jwk["x"], jwk["y"] = b64(point[1:33]), b64(point[33:])
+		}
+		keys = append(keys, jwk)
+	}
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	rest.RenderJSON(w, rest.JSON{"keys": keys})
+}
+
+// parseSigningKey parses PEM private key in PKCS#8, PKCS#1 or SEC 1 form, RSA of 2048 bits or more and P-256 ECDSA
+// are supported. Key id is made from the hash of the public key.
+func parseSigningKey(data []byte) (signingKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return signingKey{}, errors.New("no PEM data")
+	}
+	var key any
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return signingKey{}, err
+	}
+
+	res := signingKey{}
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < 2048 {
+			return signingKey{}, fmt.Errorf("rsa key of %d bits too short", k.N.BitLen())
+		}
+		res.method, res.key = jwt.SigningMethodRS256, k
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return signingKey{}, fmt.Errorf("unsupported curve %s", k.Curve.Params().Name)
+		}
+		res.method, res.key = jwt.SigningMethodES256, k
+	default:
+		return signingKey{}, fmt.Errorf("unsupported key type %T", key)
+	}
+	der, err := x509.MarshalPKIXPublicKey(res.key.Public())
+	if err != nil {
+		return signingKey{}, fmt.Errorf("can't marshal public key: %w", err)
+	}
+	h := sha256.Sum256(der)
+	res.id = b64(h[:12])
+	return res, nil
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
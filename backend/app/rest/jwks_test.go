@@ -0,0 +1,128 @@
+package rest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-pkgz/auth/v2/token"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWKS(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	rsaFile := writeKey(t, dir, "rsa.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	require.NoError(t, err)
+	ecFile := writeKey(t, dir, "ec.pem", "PRIVATE KEY", der)
+
+	_, err = NewJWKS(time.Minute)
+	assert.EqualError(t, err, "no signing keys")
+	_, err = NewJWKS(time.Minute, filepath.Join(dir, "missing.pem"))
+	assert.Error(t, err)
+
+	// tokens signed by the old key are accepted after rotation
+	old, err := NewJWKS(time.Minute, rsaFile)
+	require.NoError(t, err)
+	user := token.User{ID: "github_123", Name: "user1", Email: "user1@example.com"}
+	oldToken, expires, err := old.Token(user, "remark42")
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), expires, time.Second)
+
+	j, err := NewJWKS(time.Minute, ecFile, rsaFile)
+	require.NoError(t, err)
+	claims, err := j.Parse(oldToken)
+	require.NoError(t, err)
+	assert.Equal(t, "github_123", claims.Subject)
+	assert.Equal(t, jwt.ClaimStrings{"remark42"}, claims.Audience)
+	assert.Equal(t, "user1@example.com", claims.User.Email)
+
+	newToken, _, err := j.Token(user, "remark42")
+	require.NoError(t, err)
+	_, err = old.Parse(newToken)
+	assert.Error(t, err, "unknown key")
+	claims, err = j.Parse(newToken)
+	require.NoError(t, err)
+	assert.Equal(t, "user1", claims.User.Name)
+
+	expired, err := NewJWKS(-time.Minute, ecFile)
+	require.NoError(t, err)
+	expiredToken, _, err := expired.Token(user, "remark42")
+	require.NoError(t, err)
+	_, err = j.Parse(expiredToken)
+	assert.ErrorIs(t, err, jwt.ErrTokenExpired)
+
+	// public keys from the set validate the tokens
+	rr := httptest.NewRecorder()
+	j.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", http.NoBody))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	set := struct {
+		Keys []map[string]string `json:"keys"`
+	}{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &set))
+	require.Len(t, set.Keys, 2)
+	assert.Equal(t, "ES256", set.Keys[0]["alg"])
+	assert.Equal(t, "RS256", set.Keys[1]["alg"])
+
+	num := func(s string) *big.Int {
+		b, e := base64.RawURLEncoding.DecodeString(s)
+		require.NoError(t, e)
+		return new(big.Int).SetBytes(b)
+	}
+	ecPub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: num(set.Keys[0]["x"]), Y: num(set.Keys[0]["y"])}
+	_, err = jwt.Parse(newToken, func(*jwt.Token) (any, error) { return ecPub, nil }, jwt.WithValidMethods([]string{"ES256"}))
+	assert.NoError(t, err)
+	rsaPub := &rsa.PublicKey{N: num(set.Keys[1]["n"]), E: int(num(set.Keys[1]["e"]).Int64())}
+	_, err = jwt.Parse(oldToken, func(*jwt.Token) (any, error) { return rsaPub, nil }, jwt.WithValidMethods([]string{"RS256"}))
+	assert.NoError(t, err)
+}
+
+func TestJWKS_parseSigningKey(t *testing.T) {
+	_, err := parseSigningKey([]byte("not a key"))
+	assert.EqualError(t, err, "no PEM data")
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalECPrivateKey(ecKey)
+	require.NoError(t, err)
+	k, err := parseSigningKey(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+	require.NoError(t, err)
+	assert.Equal(t, jwt.SigningMethodES256, k.method)
+	assert.NotEmpty(t, k.id)
+
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	der, err = x509.MarshalECPrivateKey(p384)
+	require.NoError(t, err)
+	_, err = parseSigningKey(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+	assert.EqualError(t, err, "unsupported curve P-384")
+
+	short, err := rsa.GenerateKey(rand.Reader, 1024) //nolint:gosec // short key rejected in the test
+	require.NoError(t, err)
+	_, err = parseSigningKey(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(short)}))
+	assert.EqualError(t, err, "rsa key of 1024 bits too short")
+}
+
+func writeKey(t *testing.T, dir, name, blockType string, der []byte) string {
+	file := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600))
+	return file
+}
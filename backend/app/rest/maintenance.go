@@ -0,0 +1,72 @@
+package rest
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultMaintenanceMessage shown to users when maintenance mode set without a message
+const DefaultMaintenanceMessage = "comments are temporarily read-only due to maintenance, please try again later"
+
+// MaintenanceStatus is the state of read-only maintenance mode
+type MaintenanceStatus struct {
+	Enabled bool      `json:"enabled"`
+	Message string    `json:"message,omitempty"`
+	Since   time.Time `json:"since,omitzero"`
+}
+
+// Maintenance keeps read-only maintenance mode, global and per site, toggled at runtime. Thread safe.
+type Maintenance struct {
+	mu     sync.RWMutex
+	global MaintenanceStatus
+	sites  map[string]MaintenanceStatus
+}
+
+// NewMaintenance makes Maintenance, optionally with global maintenance mode enabled from the start
+func NewMaintenance(enabled bool, message string) *Maintenance {
+	res := &Maintenance{sites: map[string]MaintenanceStatus{}}
+	if enabled {
+		res.Set("", true, message)
+	}
+	return res
+}
+
+// Set enables or disables maintenance mode of the site, empty siteID for global mode.
+// Default message used if enabled without one.
+func (m *Maintenance) Set(siteID string, enabled bool, message string) {
+	status := MaintenanceStatus{}
+	if enabled {
+		if message == "" {
+			message = DefaultMaintenanceMessage
+		}
+		status = MaintenanceStatus{Enabled: true, Message: message, Since: time.Now()}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if siteID == "" {
+		m.global = status
+		return
+	}
+	m.sites[siteID] = status
+}
+
+// Status returns maintenance mode set for the site, empty siteID for global mode
+func (m *Maintenance) Status(siteID string) MaintenanceStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if siteID == "" {
+		return m.global
+	}
+	return m.sites[siteID]
+}
+
+// Active returns maintenance mode in effect for the site, global mode takes precedence
+func (m *Maintenance) Active(siteID string) (MaintenanceStatus, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.global.Enabled {
+		return m.global, true
+	}
+	status := m.sites[siteID]
+	return status, status.Enabled
+}
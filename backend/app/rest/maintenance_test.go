@@ -0,0 +1,44 @@
+package rest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaintenance(t *testing.T) {
+	m := NewMaintenance(false, "")
+	_, ok := m.Active("site1")
+	assert.False(t, ok)
+
+	m.Set("site1", true, "")
+	status, ok := m.Active("site1")
+	assert.True(t, ok)
+	assert.Equal(t, DefaultMaintenanceMessage, status.Message)
+	assert.WithinDuration(t, time.Now(), status.Since, time.Second)
+	_, ok = m.Active("site2")
+	assert.False(t, ok, "other site not affected")
+	assert.False(t, m.Status("").Enabled)
+
+	m.Set("", true, "restoring backup")
+	status, ok = m.Active("site2")
+	assert.True(t, ok)
+	assert.Equal(t, "restoring backup", status.Message)
+	status, _ = m.Active("site1")
+	assert.Equal(t, "restoring backup", status.Message, "global mode takes precedence")
+	assert.Equal(t, DefaultMaintenanceMessage, m.Status("site1").Message)
+
+	m.Set("", false, "ignored")
+	assert.Equal(t, MaintenanceStatus{}, m.Status(""))
+	_, ok = m.Active("site2")
+	assert.False(t, ok)
+	m.Set("site1", false, "")
+	_, ok = m.Active("site1")
+	assert.False(t, ok)
+
+	m = NewMaintenance(true, "migration")
+	status, ok = m.Active("site1")
+	assert.True(t, ok)
+	assert.Equal(t, "migration", status.Message)
+}
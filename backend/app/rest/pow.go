@@ -0,0 +1,123 @@
+package rest
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// proof-of-work headers, client sends challenge and its solution with the protected request
+const (
+	PoWChallengeHeader = "X-PoW-Challenge"
+	PoWSolutionHeader  = "X-PoW-Solution"
+)
+
+// PoW issues and verifies stateless proof-of-work challenges. Challenge signed with the secret, solution is a string
+// making sha256(challenge + ":" + solution) start with Difficulty zero bits. Each challenge accepted once.
+type PoW struct {
+	secret     string
+	difficulty int
+	ttl        time.Duration
+
+	mu   sync.Mutex
+	used map[string]time.Time // solved challenges to expiration time
+}
+
+// NewPoW makes PoW with difficulty in leading zero bits and challenge lifetime
+func NewPoW(secret string, difficulty int, ttl time.Duration) *PoW {
+	return &PoW{secret: secret, difficulty: difficulty, ttl: ttl, used: map[string]time.Time{}}
+}
+
+// Difficulty returns number of leading zero bits required from the solution hash
+func (p *PoW) Difficulty() int {
+	return p.difficulty
+}
+
+// Challenge makes new signed challenge, as "timestamp.difficulty.nonce.signature"
+func (p *PoW) Challenge() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("can't make challenge nonce: %w", err)
+	}
+	payload := fmt.Sprintf("%d.%d.%s", time.Now().Unix(), p.difficulty, hex.EncodeToString(b))
+	return payload + "." + p.sign(payload), nil
+}
+
+// Verify checks the solution of the challenge issued by this PoW
+func (p *PoW) Verify(challenge, solution string) error {
+	if challenge == "" || solution == "" {
+		return errors.New("proof-of-work required")
+	}
+	idx := strings.LastIndex(challenge, ".")
+	if idx < 0 || !hmac.Equal([]byte(challenge[idx+1:]), []byte(p.sign(challenge[:idx]))) {
+		return errors.New("invalid proof-of-work challenge")
+	}
+	elems := strings.Split(challenge[:idx], ".")
+	if len(elems) != 3 {
+		return errors.New("invalid proof-of-work challenge")
+	}
+	ts, err := strconv.ParseInt(elems[0], 10, 64)
+	if err != nil {
+		return errors.New("invalid proof-of-work challenge")
+	}
+	expires := time.Unix(ts, 0).Add(p.ttl)
+	if time.Now().After(expires) {
+		return errors.New("proof-of-work challenge expired")
+	}
+	difficulty, err := strconv.Atoi(elems[1])
+	if err != nil || difficulty < p.difficulty {
+		return errors.New("invalid proof-of-work challenge")
+	}
+	if leadingZeroBits(sha256.Sum256([]byte(challenge+":"+solution))) < difficulty {
+		return errors.New("invalid proof-of-work solution")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	for k, exp := range p.used {
+		if now.After(exp) {
+			delete(p.used, k)
+		}
+	}
+	if _, ok := p.used[challenge]; ok {
+		return errors.New("proof-of-work challenge already used")
+	}
+	p.used[challenge] = expires
+	return nil
+}
+
+func (p *PoW) sign(payload string) string {
+	h := hmac.New(sha256.New, []byte(p.secret))
+	h.Write([]byte("pow:" + payload))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func leadingZeroBits(hash [sha256.Size]byte) int {
+	res := 0
+	for _, b := range hash {
+		if b != 0 {
+			return res + bits.LeadingZeros8(b)
+		}
+		res += 8
+	}
+	return res
+}
+
+// SolvePoW finds solution of the challenge with given difficulty, the same way clients do
+func SolvePoW(challenge string, difficulty int) string {
+	for i := 0; ; i++ {
+		solution := strconv.Itoa(i)
+		if leadingZeroBits(sha256.Sum256([]byte(challenge+":"+solution))) >= difficulty {
+			return solution
+		}
+	}
+}
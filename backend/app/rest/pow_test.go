@@ -0,0 +1,48 @@
+package rest
+
+import (
+	"crypto/sha256"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPoW(t *testing.T) {
+	p := NewPoW("secret", 8, time.Minute)
+	assert.Equal(t, 8, p.Difficulty())
+	challenge, err := p.Challenge()
+	require.NoError(t, err)
+
+	assert.EqualError(t, p.Verify(challenge, ""), "proof-of-work required")
+	assert.EqualError(t, p.Verify("", "1"), "proof-of-work required")
+	solution := SolvePoW(challenge, 8)
+	assert.EqualError(t, p.Verify(challenge+"bad", solution), "invalid proof-of-work challenge")
+	assert.EqualError(t, NewPoW("other", 8, time.Minute).Verify(challenge, solution), "invalid proof-of-work challenge")
+	assert.EqualError(t, NewPoW("secret", 9, time.Minute).Verify(challenge, solution), "invalid proof-of-work challenge",
+		"issued with lower difficulty")
+	for i := 0; ; i++ { // find wrong solution
+		s := strconv.Itoa(i)
+		if leadingZeroBits(sha256.Sum256([]byte(challenge+":"+s))) < 8 {
+			assert.EqualError(t, p.Verify(challenge, s), "invalid proof-of-work solution")
+			break
+		}
+	}
+
+	require.NoError(t, p.Verify(challenge, solution))
+	assert.EqualError(t, p.Verify(challenge, solution), "proof-of-work challenge already used")
+
+	expired := NewPoW("secret", 8, -time.Second)
+	challenge, err = expired.Challenge()
+	require.NoError(t, err)
+	assert.EqualError(t, expired.Verify(challenge, SolvePoW(challenge, 8)), "proof-of-work challenge expired")
+}
+
+func TestLeadingZeroBits(t *testing.T) {
+	assert.Equal(t, 0, leadingZeroBits([sha256.Size]byte{0xff}))
+	assert.Equal(t, 3, leadingZeroBits([sha256.Size]byte{0x10}))
+	assert.Equal(t, 12, leadingZeroBits([sha256.Size]byte{0, 0x08}))
+	assert.Equal(t, 256, leadingZeroBits([sha256.Size]byte{}))
+}
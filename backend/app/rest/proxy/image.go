@@ -3,7 +3,9 @@ package proxy
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -25,6 +27,16 @@ import (
 // it into a 400 (input rejected) instead of the generic 404 (fetch failed).
 var errInvalidUpstreamContentType = errors.New("invalid upstream content type")
 
+// errNotImage is returned by loadImage when the loaded bytes are not an image
+var errNotImage = errors.New("not an image")
+
+const (
+	cdnImmutableCacheControl = "public, max-age=31536000, immutable" // content-hash paths never change
+	cdnRedirectCacheControl  = "public, max-age=86400"               // src may point to another image after store cleanup
+	cdnErrorCacheControl     = "public, max-age=60"                  // keeps CDN from hammering origin with failed images
+	cdnHashLen               = 16                                    // hex chars of sha256 of the image used in the path
+)
+
 // Image extracts image src from comment's html and provides proxy for them
 // this is needed to keep remark42 running behind of HTTPS serve all images via https
 type Image struct {
@@ -34,6 +46,11 @@ type Image struct {
 	CacheExternal bool
 	Timeout       time.Duration
 	ImageService  *image.Service
+	// CDNOrigin makes the proxy an origin of CDN in front of it. All external images are proxied
+	// and kept in the store, proxied links redirect to immutable paths with hash of the image content
+	// served by CDNHandler, so CDN never gets an uncacheable response from the origin.
+	CDNOrigin bool
+	CDNURL    string // base url of CDN used in proxied links in CDNOrigin mode, RemarkURL if empty
 	// Transport, if non-nil, is used as-is for outbound image fetches and is the
 	// caller's responsibility to make SSRF-safe. When nil, safehttp.Transport()
 	// is installed, which blocks dialing any private/reserved IP and resolves
@@ -41,10 +58,18 @@ type Image struct {
 	Transport http.RoundTripper
 }
 
+// Key identifies options changing links made by Convert, used as a part of comment's render key
+func (p Image) Key() string {
+	return fmt.Sprintf("image proxy %s%s, http2https %v, cache %v, cdn %v %s", p.RemarkURL, p.RoutePath, p.HTTP2HTTPS,
+		p.CacheExternal, p.CDNOrigin, p.CDNURL)
+}
+
 // Convert img src links to proxied links depends on enabled options
 func (p Image) Convert(commentHTML string) string {
-	if p.CacheExternal {
-		imgs, err := p.extract(commentHTML, func(img string) bool { return !strings.HasPrefix(img, p.RemarkURL) })
+	if p.CacheExternal || p.CDNOrigin {
+		imgs, err := p.extract(commentHTML, func(img string) bool {
+			return !strings.HasPrefix(img, p.RemarkURL) && !strings.HasPrefix(img, p.baseURL())
+		})
 		if err != nil {
 			return commentHTML
 		}
@@ -83,13 +108,21 @@ func (p Image) extract(commentHTML string, imgSrcPred func(string) bool) ([]stri
 func (p Image) replace(commentHTML string, imgs []string) string {
 	for _, img := range imgs {
 		encodedImgURL := base64.URLEncoding.EncodeToString([]byte(img))
-		resImgURL := p.RemarkURL + p.RoutePath + "?src=" + encodedImgURL
+		resImgURL := p.baseURL() + p.RoutePath + "?src=" + encodedImgURL
 		commentHTML = strings.ReplaceAll(commentHTML, img, resImgURL)
 	}
 
 	return commentHTML
 }
 
+// baseURL returns url of proxied links, CDN url in CDNOrigin mode
+func (p Image) baseURL() string {
+	if p.CDNOrigin && p.CDNURL != "" {
+		return strings.TrimSuffix(p.CDNURL, "/")
+	}
+	return p.RemarkURL
+}
+
 // etagVersionPrefix is the security-version tag bumped whenever cached responses for the
 // same src need to be invalidated. Pre-fix responses were served as text/html and cached
 // by browsers/proxies under ETag `"<base64(src)>"`; the prefix invalidates those validators
@@ -123,6 +156,18 @@ func (p Image) Handler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if p.CDNOrigin {
+		// redirect to the content-hash path, the only one served with long-lived cache headers
+		img, err := p.loadImage(r.Context(), imgURL, imgID)
+		if err != nil {
+			sendLoadError(w, r, imgURL, err, sendImageProxyError)
+			return
+		}
+		w.Header().Set("Cache-Control", cdnRedirectCacheControl)
+		http.Redirect(w, r, p.cdnPath(img, srcParam), http.StatusFound)
+		return
+	}
+
 	// compute the current-version etag once. We don't set it as a response header yet
 	// because error paths below must NOT inherit it — otherwise transient failures
 	// (4xx) would get cached alongside the 30-day Cache-Control of the success path.
@@ -140,31 +185,12 @@ func (p Image) Handler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// try to load from cache for case it was saved when CacheExternal was enabled
-	img, _ := p.ImageService.Load(imgID)
-	if img == nil {
-		img, err = p.downloadImage(r.Context(), imgURL)
-		if err != nil {
-			log.Printf("[WARN] failed to download image: %v", err)
-			if errors.Is(err, errInvalidUpstreamContentType) {
-				sendImageProxyError(w, r, http.StatusBadRequest, fmt.Errorf("invalid content type"), "invalid content type", rest.ErrImgNotFound)
-				return
-			}
-			sendImageProxyError(w, r, http.StatusNotFound, fmt.Errorf("failed to fetch"), "can't get image", rest.ErrAssetNotFound)
-			return
-		}
-		if p.CacheExternal {
-			p.cacheImage(bytes.NewReader(img), imgID)
-		}
-	}
-
-	// validate body bytes are actually an image — never trust upstream Content-Type or cache
-	contentType, err := rest.SafeImgContentType(img)
+	img, err := p.loadImage(r.Context(), imgURL, imgID)
 	if err != nil {
-		log.Printf("[WARN] rejecting non-image content from %s: %v", imgURL, err)
-		sendImageProxyError(w, r, http.StatusUnsupportedMediaType, err, "invalid image content", rest.ErrImgNotFound)
+		sendLoadError(w, r, imgURL, err, sendImageProxyError)
 		return
 	}
+	contentType, _ := rest.SafeImgContentType(img) // validated by loadImage
 
 	// success path: long-lived client cache with etag for cheap revalidation. 30-day
 	// TTL keeps the proxy efficient for hot pages; when clients DO revalidate
@@ -180,6 +206,111 @@ func (p Image) Handler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// CDNHandler serves images on immutable content-hash paths {hash}/{src} in CDNOrigin mode. Responses
+// are cacheable for a year by CDN and browsers, as the hash changes with the image. Requests with
+// query or outdated hash are redirected to the current path, so CDN keeps a single copy of each image.
+func (p Image) CDNHandler(w http.ResponseWriter, r *http.Request) {
+	rest.SetImageDefenseHeaders(w)
+
+	srcParam := r.PathValue("src")
+	src, err := base64.URLEncoding.DecodeString(srcParam)
+	if err != nil {
+		sendCDNError(w, r, http.StatusBadRequest, err, "can't decode image url", rest.ErrDecode)
+		return
+	}
+	imgURL := string(src)
+	imgID, err := image.CachedImgID(imgURL)
+	if err != nil {
+		sendCDNError(w, r, http.StatusBadRequest, fmt.Errorf("invalid image url"), "can't parse image url", rest.ErrAssetNotFound)
+		return
+	}
+
+	img, err := p.loadImage(r.Context(), imgURL, imgID)
+	if err != nil {
+		sendLoadError(w, r, imgURL, err, sendCDNError)
+		return
+	}
+
+	if path := p.cdnPath(img, srcParam); r.PathValue("hash") != imgHash(img) || r.URL.RawQuery != "" {
+		w.Header().Set("Cache-Control", cdnRedirectCacheControl)
+		http.Redirect(w, r, path, http.StatusMovedPermanently)
+		return
+	}
+
+	etag := `"` + imgHash(img) + `"`
+	w.Header().Set("Etag", etag)
+	w.Header().Set("Cache-Control", cdnImmutableCacheControl)
+	if match := r.Header.Get("If-None-Match"); match != "" && rest.EtagMatches(match, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	contentType, _ := rest.SafeImgContentType(img) // validated by loadImage
+	w.Header().Set("Content-Type", contentType)
+	if _, err = io.Copy(w, bytes.NewReader(img)); err != nil {
+		log.Printf("[WARN] can't copy image stream, %s", err)
+	}
+}
+
+// cdnPath returns content-hash path of the image served by CDNHandler
+func (p Image) cdnPath(img []byte, srcParam string) string {
+	return p.RoutePath + "/" + imgHash(img) + "/" + srcParam
+}
+
+// imgHash returns truncated hex sha256 of the image content
+func imgHash(img []byte) string {
+	h := sha256.Sum256(img)
+	return hex.EncodeToString(h[:])[:cdnHashLen]
+}
+
+// loadImage loads the image from the store, or downloads it if not stored yet. Downloaded images are
+// stored with CacheExternal or CDNOrigin enabled. Loaded bytes are validated to be an image, never
+// trusting upstream Content-Type or the store.
+func (p Image) loadImage(ctx context.Context, imgURL, imgID string) ([]byte, error) {
+	// try to load from cache for case it was saved when CacheExternal was enabled
+	img, _ := p.ImageService.Load(imgID)
+	if img == nil {
+		var err error
+		if img, err = p.downloadImage(ctx, imgURL); err != nil {
+			return nil, err
+		}
+		if p.CacheExternal || p.CDNOrigin {
+			p.cacheImage(bytes.NewReader(img), imgID)
+		}
+		if p.CDNOrigin {
+			// serve the stored image, it may be resized on save, so the content hash is stable from the first request
+			if stored, _ := p.ImageService.Load(imgID); stored != nil {
+				img = stored
+			}
+		}
+	}
+	if _, err := rest.SafeImgContentType(img); err != nil {
+		return nil, fmt.Errorf("%w: %w", errNotImage, err)
+	}
+	return img, nil
+}
+
+// sendLoadError responds with the error of loadImage by send, not revealing details of upstream failure
+func sendLoadError(w http.ResponseWriter, r *http.Request, imgURL string, err error,
+	send func(w http.ResponseWriter, r *http.Request, status int, err error, details string, errCode int)) {
+	switch {
+	case errors.Is(err, errNotImage):
+		log.Printf("[WARN] rejecting non-image content from %s: %v", imgURL, err)
+		send(w, r, http.StatusUnsupportedMediaType, err, "invalid image content", rest.ErrImgNotFound)
+	case errors.Is(err, errInvalidUpstreamContentType):
+		log.Printf("[WARN] failed to download image: %v", err)
+		send(w, r, http.StatusBadRequest, fmt.Errorf("invalid content type"), "invalid content type", rest.ErrImgNotFound)
+	default:
+		log.Printf("[WARN] failed to download image: %v", err)
+		send(w, r, http.StatusNotFound, fmt.Errorf("failed to fetch"), "can't get image", rest.ErrAssetNotFound)
+	}
+}
+
+// sendCDNError writes an error response CDN may keep for a short time
+func sendCDNError(w http.ResponseWriter, r *http.Request, status int, err error, details string, errCode int) {
+	w.Header().Set("Cache-Control", cdnErrorCacheControl)
+	rest.SendErrorJSON(w, r, status, err, details, errCode)
+}
+
 // sendImageProxyError writes a no-store error response so a transient failure (4xx)
 // cannot inherit the success path's 30-day Cache-Control or the versioned ETag, which
 // would otherwise pin the error in the browser/intermediary cache for that TTL.
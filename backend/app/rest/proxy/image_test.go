@@ -334,6 +334,113 @@ func TestImage_ConvertCachingMode(t *testing.T) {
 	assert.Equal(t, `<img src="https://remark42.com/img?src=aHR0cDovL3JhZGlvLXQuY29tL2ltZzMucG5n"/> xyz <img src="https://remark42.com/img?src=aHR0cDovL2ltYWdlcy5wZXhlbHMuY29tLzY3NjM2L2ltZzQuanBlZw==">`, r)
 }
 
+func TestImage_ConvertCDNOrigin(t *testing.T) {
+	img := Image{CDNOrigin: true, CDNURL: "https://cdn.remark42.com/", RoutePath: "/img", RemarkURL: "https://remark42.com"}
+	r := img.Convert(`<img src="https://radio-t.com/img3.png"/> <img src="https://remark42.com/pictures/1.png"/> <img src="https://cdn.remark42.com/img/1.png"/>`)
+	assert.Equal(t, `<img src="https://cdn.remark42.com/img?src=aHR0cHM6Ly9yYWRpby10LmNvbS9pbWczLnBuZw=="/> <img src="https://remark42.com/pictures/1.png"/> <img src="https://cdn.remark42.com/img/1.png"/>`, r,
+		"external images proxied via cdn without CacheExternal")
+
+	img.CDNURL = ""
+	r = img.Convert(`<img src="https://radio-t.com/img3.png"/>`)
+	assert.Equal(t, `<img src="https://remark42.com/img?src=aHR0cHM6Ly9yYWRpby10LmNvbS9pbWczLnBuZw=="/>`, r, "remark url used without cdn url")
+}
+
+func TestImage_Key(t *testing.T) {
+	img := Image{RoutePath: "/api/v1/img", RemarkURL: "https://remark42.com"}
+	assert.Equal(t, "image proxy https://remark42.com/api/v1/img, http2https false, cache false, cdn false ", img.Key())
+	img2 := img
+	img2.HTTP2HTTPS = true
+	assert.NotEqual(t, img.Key(), img2.Key())
+	img2 = img
+	img2.CDNOrigin, img2.CDNURL = true, "https://cdn.remark42.com"
+	assert.NotEqual(t, img.Key(), img2.Key())
+}
+
+func TestImage_CDNOrigin(t *testing.T) {
+	stored := map[string][]byte{}
+	imageStore := image.StoreMock{
+		LoadFunc: func(id string) ([]byte, error) { return stored[id], nil },
+		SaveFunc: func(id string, img []byte) error {
+			stored[id] = img
+			return nil
+		},
+	}
+	img := Image{
+		CDNOrigin:    true,
+		CDNURL:       "https://cdn.remark42.com",
+		RemarkURL:    "https://demo.remark42.com",
+		RoutePath:    "/api/v1/img",
+		ImageService: image.NewService(&imageStore, image.ServiceParams{MaxSize: 1500}),
+		Transport:    http.DefaultTransport,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/img", img.Handler)
+	mux.HandleFunc("GET /api/v1/img/{hash}/{src}", img.CDNHandler)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	httpSrv := imgHTTPTestsServer(t)
+	defer httpSrv.Close()
+	client := http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	imgURL := httpSrv.URL + "/image/img1.png"
+	encodedImgURL := base64.URLEncoding.EncodeToString([]byte(imgURL))
+	hashPath := "/api/v1/img/" + imgHash(gopherPNGBytes()) + "/" + encodedImgURL
+
+	// proxied link redirects to the content-hash path, image stored
+	resp, err := client.Get(ts.URL + "/api/v1/img?src=" + encodedImgURL)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	assert.Equal(t, hashPath, resp.Header.Get("Location"))
+	assert.Equal(t, "public, max-age=86400", resp.Header.Get("Cache-Control"))
+	assert.Len(t, imageStore.SaveCalls(), 1, "stored without CacheExternal")
+
+	// content-hash path served from the store as immutable
+	resp, err = client.Get(ts.URL + hashPath)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, gopherPNGBytes(), body)
+	assert.Equal(t, "image/png", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "public, max-age=31536000, immutable", resp.Header.Get("Cache-Control"))
+	assert.Equal(t, `"`+imgHash(gopherPNGBytes())+`"`, resp.Header.Get("Etag"))
+	assert.Equal(t, "nosniff", resp.Header.Get("X-Content-Type-Options"))
+	assert.Len(t, imageStore.SaveCalls(), 1, "not downloaded again")
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+hashPath, http.NoBody)
+	require.NoError(t, err)
+	req.Header.Set("If-None-Match", resp.Header.Get("Etag"))
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+	// outdated hash and query redirected to the current path
+	for _, path := range []string{"/api/v1/img/0123456789abcdef/" + encodedImgURL, hashPath + "?w=100"} {
+		resp, err = client.Get(ts.URL + path)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode, path)
+		assert.Equal(t, hashPath, resp.Header.Get("Location"), path)
+	}
+
+	// failed image cached by cdn for a short time
+	missing := base64.URLEncoding.EncodeToString([]byte(httpSrv.URL + "/image/missing.png"))
+	resp, err = client.Get(ts.URL + "/api/v1/img/0123456789abcdef/" + missing)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, "public, max-age=60", resp.Header.Get("Cache-Control"))
+
+	resp, err = client.Get(ts.URL + "/api/v1/img/0123456789abcdef/bad-src")
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "public, max-age=60", resp.Header.Get("Cache-Control"))
+}
+
 func TestImage_PrivateIPBlocking(t *testing.T) {
 	imageStore := image.StoreMock{LoadFunc: func(string) ([]byte, error) { return nil, nil }}
 	img := Image{
@@ -0,0 +1,128 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-pkgz/auth/v2/token"
+	log "github.com/go-pkgz/lgr"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// TokenRotation accepts tokens signed with the previous secret until the end of the grace window of secret rotation,
+// so users stay logged in while the secret changes. Without the previous secret only the current one is accepted.
+type TokenRotation struct {
+	current  *token.Service
+	previous *token.Service
+	resign   *token.Service // current service keeping issue time of re-signed tokens, for revocation checks
+	until    time.Time
+}
+
+// NewTokenRotation makes TokenRotation of the current token service, accepting tokens signed with previousSecret
+// until the time, the rotation is off if previousSecret is empty
+func NewTokenRotation(current *token.Service, previousSecret string, until time.Time) *TokenRotation {
+	res := TokenRotation{current: current, until: until}
+	if previousSecret != "" {
+		res.previous = token.NewService(current.Opts)
+		res.previous.SecretReader = token.SecretFunc(func(string) (string, error) { return previousSecret, nil })
+		opts := current.Opts
+		opts.DisableIAT = true
+		res.resign = token.NewService(opts)
+	}
+	return &res
+}
+
+// Active checks if tokens signed with the previous secret are still accepted
+func (t *TokenRotation) Active() bool {
+	return t.previous != nil && time.Now().Before(t.until)
+}
+
+// Parse parses the token signed with the current secret, or with the previous one during the grace window.
+// Not checking for expiration, as token.Service.Parse.
+func (t *TokenRotation) Parse(tkn string) (token.Claims, error) {
+	claims, err := t.current.Parse(tkn)
+	if err == nil || !t.Active() || !errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+		return claims, err
+	}
+	if prevClaims, e := t.previous.Parse(tkn); e == nil {
+		return prevClaims, nil
+	}
+	return claims, err
+}
+
+// Handler is a middleware re-signing the token of the request signed with the previous secret during the grace window.
+// New token replaces the old one in the request for the rest of handlers and is set in cookies of the response.
+// The original issue time is kept, so tokens revoked before re-signing stay revoked.
+func (t *TokenRotation) Handler(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if !t.Active() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		tkn, source := t.requestToken(r)
+		if tkn == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if _, err := t.current.Parse(tkn); err == nil || !errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		claims, err := t.previous.Parse(tkn)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if claims, err = t.resign.Set(w, claims); err != nil {
+			log.Printf("[WARN] can't re-sign token of rotated secret, %v", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+		newTkn, err := t.resign.Token(claims)
+		if err != nil {
+			log.Printf("[WARN] can't re-sign token of rotated secret, %v", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, t.replaceToken(r, source, newTkn))
+	}
+	return http.HandlerFunc(fn)
+}
+
+// requestToken returns the token of the request and where it was found, in the same order token.Service.Get looks
+func (t *TokenRotation) requestToken(r *http.Request) (tkn, source string) {
+	if tkn = r.URL.Query().Get(t.current.JWTQuery); tkn != "" {
+		return tkn, "query"
+	}
+	if tkn = r.Header.Get(t.current.JWTHeaderKey); tkn != "" {
+		return tkn, "header"
+	}
+	if c, err := r.Cookie(t.current.JWTCookieName); err == nil && c.Value != "" {
+		return c.Value, "cookie"
+	}
+	return "", ""
+}
+
+// replaceToken returns copy of the request with the token in the source replaced
+func (t *TokenRotation) replaceToken(r *http.Request, source, tkn string) *http.Request {
+	res := r.Clone(r.Context())
+	switch source {
+	case "query":
+		q := res.URL.Query()
+		q.Set(t.current.JWTQuery, tkn)
+		res.URL.RawQuery = q.Encode()
+	case "header":
+		res.Header.Set(t.current.JWTHeaderKey, tkn)
+	case "cookie":
+		cookies := res.Cookies()
+		res.Header.Del("Cookie")
+		for _, c := range cookies {
+			if c.Name == t.current.JWTCookieName {
+				c.Value = tkn
+			}
+			res.AddCookie(c)
+		}
+	}
+	return res
+}
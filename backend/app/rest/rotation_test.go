@@ -0,0 +1,114 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-pkgz/auth/v2/token"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenRotation_Parse(t *testing.T) {
+	current, previous := tokenService("new secret"), tokenService("old secret")
+	oldTkn := makeToken(t, previous)
+	newTkn := makeToken(t, current)
+
+	r := NewTokenRotation(current, "", time.Now().Add(time.Hour))
+	assert.False(t, r.Active(), "no previous secret")
+	_, err := r.Parse(oldTkn)
+	assert.ErrorIs(t, err, jwt.ErrTokenSignatureInvalid)
+
+	r = NewTokenRotation(current, "old secret", time.Now().Add(time.Hour))
+	assert.True(t, r.Active())
+	claims, err := r.Parse(oldTkn)
+	require.NoError(t, err)
+	assert.Equal(t, "user1", claims.User.ID)
+	claims, err = r.Parse(newTkn)
+	require.NoError(t, err)
+	assert.Equal(t, "user1", claims.User.ID)
+	_, err = r.Parse(makeToken(t, tokenService("other secret")))
+	assert.ErrorIs(t, err, jwt.ErrTokenSignatureInvalid)
+
+	r = NewTokenRotation(current, "old secret", time.Now().Add(-time.Second))
+	assert.False(t, r.Active(), "grace window over")
+	_, err = r.Parse(oldTkn)
+	assert.ErrorIs(t, err, jwt.ErrTokenSignatureInvalid)
+}
+
+func TestTokenRotation_Handler(t *testing.T) {
+	current, previous := tokenService("new secret"), tokenService("old secret")
+	oldTkn := makeToken(t, previous)
+	r := NewTokenRotation(current, "old secret", time.Now().Add(time.Hour))
+
+	var seen string
+	h := r.Handler(http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+		_, seen, _ = current.Get(req)
+	}))
+
+	// token in cookie re-signed for the request and set in the response
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/user", http.NoBody)
+	req.AddCookie(&http.Cookie{Name: "other", Value: "keep"})
+	req.AddCookie(&http.Cookie{Name: "JWT", Value: oldTkn})
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	require.NotEmpty(t, seen, "accepted by the current secret")
+	assert.NotEqual(t, oldTkn, seen)
+	cookies := rr.Result().Cookies()
+	require.Len(t, cookies, 2)
+	assert.Equal(t, "JWT", cookies[0].Name)
+	claims, err := current.Parse(cookies[0].Value)
+	require.NoError(t, err)
+	require.NotNil(t, claims.IssuedAt)
+	assert.InDelta(t, time.Now().Add(-time.Hour).Unix(), claims.IssuedAt.Unix(), 1, "issue time kept")
+	seenClaims, err := current.Parse(seen)
+	require.NoError(t, err)
+	assert.Equal(t, claims.IssuedAt, seenClaims.IssuedAt)
+
+	// token in header
+	seen = ""
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/user", http.NoBody)
+	req.Header.Set("X-JWT", oldTkn)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	assert.NotEmpty(t, seen)
+
+	// token of the current secret untouched
+	seen = ""
+	newTkn := makeToken(t, current)
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/user?token="+newTkn, http.NoBody)
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	assert.Equal(t, newTkn, seen)
+	assert.Empty(t, rr.Result().Cookies())
+
+	// not re-signed after the grace window
+	seen = ""
+	h = NewTokenRotation(current, "old secret", time.Now().Add(-time.Second)).Handler(http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+		_, seen, _ = current.Get(req)
+	}))
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/user", http.NoBody)
+	req.Header.Set("X-JWT", oldTkn)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Empty(t, seen)
+}
+
+func tokenService(secret string) *token.Service {
+	return token.NewService(token.Opts{
+		SecretReader:  token.SecretFunc(func(string) (string, error) { return secret, nil }),
+		TokenDuration: time.Hour,
+		DisableXSRF:   true,
+	})
+}
+
+func makeToken(t *testing.T, ts *token.Service) string {
+	tkn, err := ts.Token(token.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Audience: jwt.ClaimStrings{"remark42"}, ID: "id1",
+			IssuedAt: jwt.NewNumericDate(time.Now().Add(-time.Hour)), ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+		User: &token.User{ID: "user1", Name: "user one"},
+	})
+	require.NoError(t, err)
+	return tkn
+}
@@ -0,0 +1,272 @@
+// Package shadow mirrors a sample of read requests to a secondary instance, like a new version or an instance
+// with another storage engine, and reports differences of its responses from the primary ones.
+package shadow
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark42/backend/app/rest"
+)
+
+const (
+	maxBodySize     = 1024 * 1024 // responses larger than this are not compared
+	maxInFlight     = 10          // mirrored requests in flight, the rest skipped
+	defaultMaxDiffs = 100
+)
+
+// Mirror sends a sample of anonymous GET requests to the secondary instance after the primary response served,
+// and compares status and body of both responses. JSON bodies compared by value. Thread safe.
+type Mirror struct {
+	URL        string       // base url of the secondary instance, like http://remark42-next:8080
+	SampleRate float64      // share of requests mirrored, 0..1
+	Client     *http.Client // http.DefaultClient if not set
+	MaxDiffs   int          // last diffs kept, 100 if not set
+
+	once     sync.Once
+	inFlight chan struct{}
+	mu       sync.Mutex
+	stats    map[string]*Stats // by site
+	diffs    []Diff
+}
+
+// Stats of mirrored requests
+type Stats struct {
+	Mirrored   int `json:"mirrored"`
+	Matched    int `json:"matched"`
+	Mismatched int `json:"mismatched"`
+	Failed     int `json:"failed"` // secondary instance not responded
+}
+
+// Diff describes mismatch of the primary and secondary responses
+type Diff struct {
+	Time          time.Time `json:"time"`
+	SiteID        string    `json:"site"`
+	Request       string    `json:"request"` // path with query
+	PrimaryStatus int       `json:"primary_status"`
+	ShadowStatus  int       `json:"shadow_status"`
+	Detail        string    `json:"detail"` // first difference, like "$.comments[2].score"
+}
+
+// Report of mirrored requests for a site
+type Report struct {
+	Stats
+	Diffs []Diff `json:"diffs"`
+}
+
+// Handler is a middleware mirroring sampled requests
+func (m *Mirror) Handler(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || !m.sampled(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		if rec.overflow {
+			return
+		}
+		siteID, uri := r.URL.Query().Get("site"), r.URL.RequestURI()
+		select {
+		case m.slots() <- struct{}{}:
+			go func() {
+				defer func() { <-m.inFlight }()
+				m.compare(siteID, uri, rec.status, rec.body.Bytes())
+			}()
+		default:
+			log.Printf("[DEBUG] shadow request for %s skipped, too many in flight", r.URL.Path)
+		}
+	}
+	return http.HandlerFunc(fn)
+}
+
+// Report returns stats and last diffs of mirrored requests for the site
+func (m *Mirror) Report(siteID string) Report {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := Report{Diffs: []Diff{}}
+	if st, ok := m.stats[siteID]; ok {
+		res.Stats = *st
+	}
+	for _, d := range m.diffs {
+		if d.SiteID == siteID {
+			res.Diffs = append(res.Diffs, d)
+		}
+	}
+	return res
+}
+
+// sampled checks if the request should be mirrored, only anonymous requests are as the secondary gets no credentials
+func (m *Mirror) sampled(r *http.Request) bool {
+	if _, err := rest.GetUserInfo(r); err == nil {
+		return false
+	}
+	return m.SampleRate > 0 && rand.Float64() < m.SampleRate //nolint:gosec // sampling doesn't need crypto rand
+}
+
+// compare sends request to the secondary instance and records result
+func (m *Mirror) compare(siteID, uri string, status int, body []byte) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	shadowStatus, shadowBody, err := m.fetch(ctx, uri)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stats == nil {
+		m.stats = map[string]*Stats{}
+	}
+	st, ok := m.stats[siteID]
+	if !ok {
+		st = &Stats{}
+		m.stats[siteID] = st
+	}
+	st.Mirrored++
+	if err != nil {
+		st.Failed++
+		log.Printf("[WARN] shadow request %s failed, %v", uri, err)
+		return
+	}
+
+	detail := ""
+	if status != shadowStatus {
+		detail = fmt.Sprintf("status %d != %d", status, shadowStatus)
+	} else {
+		detail = diffBody(body, shadowBody)
+	}
+	if detail == "" {
+		st.Matched++
+		return
+	}
+	st.Mismatched++
+	log.Printf("[WARN] shadow response for %s differs, %s", uri, detail)
+	maxDiffs := m.MaxDiffs
+	if maxDiffs <= 0 {
+		maxDiffs = defaultMaxDiffs
+	}
+	m.diffs = append(m.diffs, Diff{Time: time.Now(), SiteID: siteID, Request: uri, PrimaryStatus: status,
+		ShadowStatus: shadowStatus, Detail: detail})
+	if len(m.diffs) > maxDiffs {
+		m.diffs = m.diffs[len(m.diffs)-maxDiffs:]
+	}
+}
+
+// fetch makes request to the secondary instance
+func (m *Mirror) fetch(ctx context.Context, uri string) (status int, body []byte, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(m.URL, "/")+uri, http.NoBody)
+	if err != nil {
+		return 0, nil, err
+	}
+	client := m.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	if body, err = io.ReadAll(io.LimitReader(resp.Body, maxBodySize)); err != nil {
+		return 0, nil, fmt.Errorf("can't read body: %w", err)
+	}
+	return resp.StatusCode, body, nil
+}
+
+func (m *Mirror) slots() chan struct{} {
+	m.once.Do(func() { m.inFlight = make(chan struct{}, maxInFlight) })
+	return m.inFlight
+}
+
+// diffBody returns the first difference of two bodies, empty if same. JSON compared by value.
+func diffBody(a, b []byte) string {
+	var va, vb any
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		if bytes.Equal(a, b) {
+			return ""
+		}
+		return "body differs"
+	}
+	return diffValue("$", va, vb)
+}
+
+// diffValue returns path of the first difference of two decoded json values, empty if same
+func diffValue(path string, a, b any) string {
+	switch va := a.(type) {
+	case map[string]any:
+		vb, ok := b.(map[string]any)
+		if !ok {
+			return path
+		}
+		keys := make([]string, 0, len(va)+len(vb))
+		for k := range va {
+			keys = append(keys, k)
+		}
+		for k := range vb {
+			if _, ok := va[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if d := diffValue(path+"."+k, va[k], vb[k]); d != "" {
+				return d
+			}
+		}
+		return ""
+	case []any:
+		vb, ok := b.([]any)
+		if !ok {
+			return path
+		}
+		for i := range min(len(va), len(vb)) {
+			if d := diffValue(fmt.Sprintf("%s[%d]", path, i), va[i], vb[i]); d != "" {
+				return d
+			}
+		}
+		if len(va) != len(vb) {
+			return fmt.Sprintf("%s length %d != %d", path, len(va), len(vb))
+		}
+		return ""
+	default:
+		if !reflect.DeepEqual(a, b) {
+			return path
+		}
+		return ""
+	}
+}
+
+// recorder passes response through, keeping status and a copy of the body up to maxBodySize
+type recorder struct {
+	http.ResponseWriter
+	status   int
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (r *recorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	if !r.overflow {
+		if r.body.Len()+len(b) > maxBodySize {
+			r.overflow = true
+			r.body.Reset()
+		} else {
+			r.body.Write(b)
+		}
+	}
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,158 @@
+package shadow
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/rest"
+	"github.com/umputun/remark42/backend/app/store"
+)
+
+func TestMirror_Handler(t *testing.T) {
+	var shadowCalls atomic.Int32
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		shadowCalls.Add(1)
+		switch r.URL.Path {
+		case "/api/v1/find":
+			_, _ = w.Write([]byte(`{"comments":[{"id":"1","text":"abc"}],"info":{"count":1}}`))
+		case "/api/v1/count":
+			_, _ = w.Write([]byte(`{"count":2}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer secondary.Close()
+
+	m := &Mirror{URL: secondary.URL + "/", SampleRate: 1}
+	primary := httptest.NewServer(m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/find":
+			_, _ = w.Write([]byte(`{"info":{"count":1},"comments":[{"text":"abc","id":"1"}]}`)) // same value, other order
+		case "/api/v1/count":
+			_, _ = w.Write([]byte(`{"count":1}`))
+		default:
+			_, _ = w.Write([]byte("ok"))
+		}
+	})))
+	defer primary.Close()
+
+	for _, path := range []string{"/api/v1/find?site=remark&url=u1", "/api/v1/count?site=remark&url=u1", "/api/v1/other?site=blog"} {
+		resp, err := http.Get(primary.URL + path)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.NotEmpty(t, body, "primary response passed through")
+	}
+
+	require.Eventually(t, func() bool { return m.Report("remark").Mirrored == 2 && m.Report("blog").Mirrored == 1 },
+		time.Second, 10*time.Millisecond)
+
+	rep := m.Report("remark")
+	assert.Equal(t, Stats{Mirrored: 2, Matched: 1, Mismatched: 1}, rep.Stats)
+	require.Len(t, rep.Diffs, 1)
+	assert.Equal(t, "/api/v1/count?site=remark&url=u1", rep.Diffs[0].Request)
+	assert.Equal(t, "$.count", rep.Diffs[0].Detail)
+	assert.Equal(t, "remark", rep.Diffs[0].SiteID)
+
+	rep = m.Report("blog")
+	assert.Equal(t, Stats{Mirrored: 1, Mismatched: 1}, rep.Stats)
+	require.Len(t, rep.Diffs, 1)
+	assert.Equal(t, "status 200 != 404", rep.Diffs[0].Detail)
+
+	assert.Equal(t, Report{Diffs: []Diff{}}, m.Report("unknown"))
+
+	// post and authenticated requests not mirrored
+	resp, err := http.Post(primary.URL+"/api/v1/find?site=remark", "application/json", http.NoBody)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/find?site=remark", http.NoBody)
+	req = rest.SetUserInfo(req, store.User{ID: "user1", Name: "user1"})
+	m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(httptest.NewRecorder(), req)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(3), shadowCalls.Load())
+}
+
+func TestMirror_Failed(t *testing.T) {
+	m := &Mirror{URL: "http://127.0.0.1:1", SampleRate: 1}
+	h := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("{}")) }))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/find?site=remark", http.NoBody))
+	require.Eventually(t, func() bool { return m.Report("remark").Mirrored == 1 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, Stats{Mirrored: 1, Failed: 1}, m.Report("remark").Stats)
+}
+
+func TestMirror_Sampling(t *testing.T) {
+	var calls atomic.Int32
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { calls.Add(1) }))
+	defer secondary.Close()
+
+	m := &Mirror{URL: secondary.URL, SampleRate: 0}
+	h := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for range 10 {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/find?site=remark", http.NoBody))
+	}
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(0), calls.Load())
+}
+
+func TestMirror_MaxDiffs(t *testing.T) {
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("other"))
+	}))
+	defer secondary.Close()
+
+	m := &Mirror{URL: secondary.URL, SampleRate: 1, MaxDiffs: 3}
+	for range 5 {
+		m.compare("remark", "/api/v1/find?site=remark", http.StatusOK, []byte("same"))
+	}
+	rep := m.Report("remark")
+	assert.Equal(t, Stats{Mirrored: 5, Mismatched: 5}, rep.Stats)
+	require.Len(t, rep.Diffs, 3)
+	assert.Equal(t, "body differs", rep.Diffs[0].Detail)
+}
+
+func TestMirror_LargeResponseSkipped(t *testing.T) {
+	var calls atomic.Int32
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { calls.Add(1) }))
+	defer secondary.Close()
+
+	m := &Mirror{URL: secondary.URL, SampleRate: 1}
+	h := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(make([]byte, maxBodySize))
+		_, _ = w.Write([]byte("x"))
+	}))
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/find?site=remark", http.NoBody))
+	assert.Equal(t, maxBodySize+1, rr.Body.Len(), "response passed through")
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(0), calls.Load())
+}
+
+func TestDiffBody(t *testing.T) {
+	tbl := []struct {
+		a, b string
+		res  string
+	}{
+		{`{"a":1,"b":[1,2]}`, `{"b":[1,2],"a":1}`, ""},
+		{`{"a":1}`, `{"a":2}`, "$.a"},
+		{`{"a":1}`, `{"a":1,"b":2}`, "$.b"},
+		{`{"a":{"b":[{"c":1},{"c":2}]}}`, `{"a":{"b":[{"c":1},{"c":3}]}}`, "$.a.b[1].c"},
+		{`[1,2]`, `[1,2,3]`, "$ length 2 != 3"},
+		{`{"a":[1]}`, `{"a":{"x":1}}`, "$.a"},
+		{`{"a":{"x":1}}`, `{"a":"x"}`, "$.a"},
+		{"plain text", "plain text", ""},
+		{"plain text", "other text", "body differs"},
+		{`{"a":1}`, "not json", "body differs"},
+	}
+	for i, tt := range tbl {
+		assert.Equal(t, tt.res, diffBody([]byte(tt.a), []byte(tt.b)), "case #%d", i)
+	}
+}
@@ -36,6 +36,7 @@ func GetUserInfo(r *http.Request) (user store.User, err error) {
 		Blocked:  u.BoolAttr("blocked"),
 		SiteID:   u.Audience,
 		PaidSub:  u.IsPaidSub(),
+		Bot:      u.BoolAttr("bot"),
 	}, nil
 }
 
@@ -59,6 +60,7 @@ func SetUserInfo(r *http.Request, user store.User) *http.Request {
 		Attributes: map[string]any{
 			"blocked":  user.Blocked,
 			"verified": user.Verified,
+			"bot":      user.Bot,
 		},
 	}
 	u.SetAdmin(user.Admin)
@@ -0,0 +1,136 @@
+// Package scheduler executes moderation actions scheduled for later, like deletion of a thread or unblocking
+// of a user, when they are due, and runs registered maintenance jobs, like the nightly integrity check.
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark42/backend/app/notify"
+	"github.com/umputun/remark42/backend/app/store/schedule"
+)
+
+// Store runs scheduled actions
+type Store interface {
+	RunScheduledActions(ts time.Time) ([]schedule.Action, error)
+}
+
+// Notifier sends messages to users
+type Notifier interface {
+	SubmitMessage(msg notify.UserMessage)
+}
+
+// Scheduler runs due actions of Store and registered jobs periodically
+type Scheduler struct {
+	Store    Store               // no scheduled actions if not set
+	Notifier Notifier            // notifies unblocked users, optional
+	OnUpdate func(siteID string) // called for sites changed by executed actions, optional
+
+	jobs []*job
+}
+
+// Job is a task run by Scheduler when due
+type Job struct {
+	Name  string
+	Next  func(ts time.Time) time.Time // time of the run following ts, the start of scheduler or the previous run
+	Run   func(ctx context.Context)
+	Start bool // run on start of the scheduler too
+}
+
+type job struct {
+	Job
+	next time.Time
+}
+
+// Daily returns Next of the job run every day at the time of day, offset from the local midnight
+func Daily(at time.Duration) func(ts time.Time) time.Time {
+	return func(ts time.Time) time.Time {
+		y, m, d := ts.Date()
+		res := time.Date(y, m, d, 0, 0, 0, 0, ts.Location()).Add(at)
+		if !res.After(ts) {
+			res = time.Date(y, m, d+1, 0, 0, 0, 0, ts.Location()).Add(at)
+		}
+		return res
+	}
+}
+
+// Every returns Next of the job run every period
+func Every(period time.Duration) func(ts time.Time) time.Time {
+	return func(ts time.Time) time.Time { return ts.Add(period) }
+}
+
+// Add registers the job, should be called before Run
+func (s *Scheduler) Add(j Job) {
+	s.jobs = append(s.jobs, &job{Job: j})
+}
+
+// HasJobs checks if any job registered
+func (s *Scheduler) HasJobs() bool {
+	return len(s.jobs) > 0
+}
+
+// Do runs actions due at ts
+func (s *Scheduler) Do(ts time.Time) {
+	if s.Store == nil {
+		return
+	}
+	actions, err := s.Store.RunScheduledActions(ts)
+	if err != nil {
+		log.Printf("[WARN] %v", err)
+	}
+	updated := map[string]bool{}
+	for _, a := range actions {
+		if !updated[a.SiteID] && s.OnUpdate != nil {
+			s.OnUpdate(a.SiteID)
+		}
+		updated[a.SiteID] = true
+		if a.Type == schedule.Unblock && a.Notify && s.Notifier != nil {
+			s.Notifier.SubmitMessage(notify.UserMessage{SiteID: a.SiteID, UserID: a.UserID,
+				Subject: "Your account is unblocked",
+				Text:    "Your account is unblocked on " + a.SiteID + ", you can comment again."})
+		}
+	}
+}
+
+// Run executes due actions immediately and then every period, along with the jobs due by then, until ctx canceled.
+// Jobs run one by one, in the order of registration.
+func (s *Scheduler) Run(ctx context.Context, period time.Duration) {
+	log.Printf("[INFO] activate scheduled actions, period %s, %d jobs", period, len(s.jobs))
+	now := time.Now()
+	for _, j := range s.jobs {
+		j.next = j.Next(now)
+		log.Printf("[INFO] job %q scheduled at %s", j.Name, j.next.Format(time.RFC3339))
+	}
+	s.Do(now)
+	for _, j := range s.jobs {
+		if j.Start {
+			j.Run(ctx)
+		}
+	}
+	tick := time.NewTicker(period)
+	defer tick.Stop()
+	for {
+		select {
+		case ts := <-tick.C:
+			s.Do(ts)
+			s.runJobs(ctx, ts)
+		case <-ctx.Done():
+			log.Print("[DEBUG] terminated scheduled actions")
+			return
+		}
+	}
+}
+
+// runJobs runs jobs due at ts and schedules their next runs
+func (s *Scheduler) runJobs(ctx context.Context, ts time.Time) {
+	for _, j := range s.jobs {
+		if j.next.After(ts) {
+			continue
+		}
+		log.Printf("[DEBUG] run job %q", j.Name)
+		j.Run(ctx)
+		j.next = j.Next(ts)
+	}
+}
@@ -0,0 +1,128 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/umputun/remark42/backend/app/notify"
+	"github.com/umputun/remark42/backend/app/store/schedule"
+)
+
+type mockStore struct {
+	mu      sync.Mutex
+	calls   []time.Time
+	actions []schedule.Action
+	err     error
+}
+
+func (m *mockStore) RunScheduledActions(ts time.Time) ([]schedule.Action, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, ts)
+	res := m.actions
+	m.actions = nil
+	return res, m.err
+}
+
+type mockNotifier struct{ msgs []notify.UserMessage }
+
+func (m *mockNotifier) SubmitMessage(msg notify.UserMessage) { m.msgs = append(m.msgs, msg) }
+
+func TestScheduler_Do(t *testing.T) {
+	st := &mockStore{err: errors.New("failed to run delete_comment action"), actions: []schedule.Action{
+		{ID: "1", SiteID: "site1", Type: schedule.Unblock, UserID: "user1", Notify: true},
+		{ID: "2", SiteID: "site1", Type: schedule.Unblock, UserID: "user2"},
+		{ID: "3", SiteID: "site2", Type: schedule.DeleteThread, URL: "https://example.com/post"},
+	}}
+	ntf := &mockNotifier{}
+	updated := []string{}
+	s := Scheduler{Store: st, Notifier: ntf, OnUpdate: func(siteID string) { updated = append(updated, siteID) }}
+
+	s.Do(time.Now())
+	assert.Equal(t, []string{"site1", "site2"}, updated, "each site updated once")
+	assert.Equal(t, []notify.UserMessage{{SiteID: "site1", UserID: "user1", Subject: "Your account is unblocked",
+		Text: "Your account is unblocked on site1, you can comment again."}}, ntf.msgs, "notify requested only")
+
+	s.Do(time.Now())
+	assert.Len(t, st.calls, 2)
+	assert.Len(t, ntf.msgs, 1)
+}
+
+func TestScheduler_Run(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		st := &mockStore{}
+		s := Scheduler{Store: st}
+		ctx, cancel := context.WithTimeout(context.Background(), 150*time.Second)
+		defer cancel()
+		s.Run(ctx, time.Minute)
+		st.mu.Lock()
+		defer st.mu.Unlock()
+		assert.Len(t, st.calls, 3, "immediately and two ticks")
+	})
+}
+
+func TestScheduler_Jobs(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		start := time.Now()
+		s := Scheduler{} // jobs only, without scheduled actions
+		var mu sync.Mutex
+		runs := []time.Duration{}
+		s.Add(Job{Name: "nightly", Next: Daily(start.Sub(midnight(start)) + 3*time.Hour),
+			Run: func(context.Context) {
+				mu.Lock()
+				defer mu.Unlock()
+				runs = append(runs, time.Since(start))
+			}})
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Hour)
+		defer cancel()
+		s.Run(ctx, time.Minute)
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, []time.Duration{3 * time.Hour, 27 * time.Hour}, runs, "not on start, daily at the time")
+	})
+}
+
+func TestScheduler_StartJobs(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		start := time.Now()
+		st := &mockStore{}
+		s := Scheduler{Store: st}
+		var mu sync.Mutex
+		runs := []time.Duration{}
+		s.Add(Job{Name: "refresh", Next: Every(time.Hour), Start: true, Run: func(context.Context) {
+			mu.Lock()
+			defer mu.Unlock()
+			runs = append(runs, time.Since(start))
+		}})
+		ctx, cancel := context.WithTimeout(context.Background(), 150*time.Minute)
+		defer cancel()
+		s.Run(ctx, time.Minute)
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, []time.Duration{0, time.Hour, 2 * time.Hour}, runs, "on start and every hour")
+		st.mu.Lock()
+		defer st.mu.Unlock()
+		assert.Len(t, st.calls, 151, "scheduled actions run along")
+	})
+}
+
+func TestDaily(t *testing.T) {
+	next := Daily(3*time.Hour + 30*time.Minute)
+	ts := time.Date(2026, 10, 15, 1, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2026, 10, 15, 3, 30, 0, 0, time.UTC), next(ts), "later today")
+	ts = time.Date(2026, 10, 15, 3, 30, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2026, 10, 16, 3, 30, 0, 0, time.UTC), next(ts), "tomorrow")
+	ts = time.Date(2026, 12, 31, 23, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2027, 1, 1, 3, 30, 0, 0, time.UTC), next(ts), "next year")
+}
+
+func midnight(ts time.Time) time.Time {
+	y, m, d := ts.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, ts.Location())
+}
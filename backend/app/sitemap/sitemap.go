@@ -0,0 +1,144 @@
+// Package sitemap syncs posts listed in sitemaps of the sites into registered pages, used by strict page
+// registration mode to accept comments only on known posts.
+package sitemap
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+)
+
+// maxSitemapSize limits size of a single sitemap, the limit of sitemaps protocol
+const maxSitemapSize = 50 * 1024 * 1024
+
+// maxChildSitemaps limits sitemaps loaded from a sitemap index
+const maxChildSitemaps = 100
+
+// Store registers pages of the site
+type Store interface {
+	RegisterPages(siteID string, urls []string) (int, error)
+}
+
+// Syncer loads sitemaps of the sites and registers listed posts. Both urlset sitemaps and sitemap indexes
+// are supported, sitemaps listed by the index loaded one level deep. Posts removed from the sitemap stay registered.
+type Syncer struct {
+	Sitemaps map[string]string // sitemap url per site
+	Store    Store
+	Client   *http.Client // http.DefaultClient if not set
+}
+
+// document is either urlset or sitemapindex, both list locations
+type document struct {
+	XMLName  xml.Name
+	URLs     []location `xml:"url"`
+	Sitemaps []location `xml:"sitemap"`
+}
+
+type location struct {
+	Loc string `xml:"loc"`
+}
+
+// Sync loads sitemaps of all sites and registers listed posts. Sites with sitemaps failed to load are skipped.
+func (s *Syncer) Sync(ctx context.Context) error {
+	var errs []error
+	for siteID, sitemapURL := range s.Sitemaps {
+		urls, err := s.urls(ctx, sitemapURL)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("can't load sitemap of %s: %w", siteID, err))
+			continue
+		}
+		added, err := s.Store.RegisterPages(siteID, urls)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("can't register pages of %s: %w", siteID, err))
+		}
+		log.Printf("[DEBUG] sitemap of %s synced, %d posts listed, %d registered", siteID, len(urls), added)
+	}
+	return errors.Join(errs...)
+}
+
+// Run syncs sitemaps immediately and then every period, until ctx canceled
+func (s *Syncer) Run(ctx context.Context, period time.Duration) {
+	log.Printf("[INFO] activate sitemap sync, %d sites, period %s", len(s.Sitemaps), period)
+	if err := s.Sync(ctx); err != nil {
+		log.Printf("[WARN] %v", err)
+	}
+	tick := time.NewTicker(period)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			if err := s.Sync(ctx); err != nil {
+				log.Printf("[WARN] %v", err)
+			}
+		case <-ctx.Done():
+			log.Print("[DEBUG] terminated sitemap sync")
+			return
+		}
+	}
+}
+
+// urls returns posts listed by the sitemap, or by sitemaps of the index
+func (s *Syncer) urls(ctx context.Context, sitemapURL string) ([]string, error) {
+	doc, err := s.load(ctx, sitemapURL)
+	if err != nil {
+		return nil, err
+	}
+	res := locs(doc.URLs)
+	if doc.XMLName.Local != "sitemapindex" {
+		return res, nil
+	}
+	if len(doc.Sitemaps) > maxChildSitemaps {
+		return nil, fmt.Errorf("too many sitemaps in the index, %d", len(doc.Sitemaps))
+	}
+	for _, child := range locs(doc.Sitemaps) {
+		childDoc, err := s.load(ctx, child)
+		if err != nil {
+			return nil, fmt.Errorf("can't load sitemap %s: %w", child, err)
+		}
+		res = append(res, locs(childDoc.URLs)...)
+	}
+	return res, nil
+}
+
+// load reads and decodes the sitemap
+func (s *Syncer) load(ctx context.Context, sitemapURL string) (document, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sitemapURL, http.NoBody)
+	if err != nil {
+		return document{}, err
+	}
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return document{}, err
+	}
+	defer resp.Body.Close() //nolint:errcheck // nothing to do with the error
+	if resp.StatusCode != http.StatusOK {
+		return document{}, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	doc := document{}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, maxSitemapSize)).Decode(&doc); err != nil {
+		return document{}, fmt.Errorf("can't decode sitemap: %w", err)
+	}
+	return doc, nil
+}
+
+// locs returns non-empty locations
+func locs(list []location) []string {
+	res := make([]string, 0, len(list))
+	for _, l := range list {
+		if loc := strings.TrimSpace(l.Loc); loc != "" {
+			res = append(res, loc)
+		}
+	}
+	return res
+}
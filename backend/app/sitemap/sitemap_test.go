@@ -0,0 +1,97 @@
+package sitemap
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type storeMock struct {
+	mu    sync.Mutex
+	pages map[string][]string // by site
+	err   error
+}
+
+func (m *storeMock) RegisterPages(siteID string, urls []string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.pages == nil {
+		m.pages = map[string][]string{}
+	}
+	m.pages[siteID] = urls
+	return len(urls), m.err
+}
+
+func TestSyncer_Sync(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sitemap.xml":
+			_, _ = w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>https://example.com/p/1</loc><lastmod>2026-10-01</lastmod></url>
+  <url><loc>
+    https://example.com/p/2
+  </loc></url>
+  <url><loc></loc></url>
+</urlset>`))
+		case "/index.xml":
+			_, _ = w.Write([]byte(`<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>` + ts.URL + `/posts.xml</loc></sitemap>
+  <sitemap><loc>` + ts.URL + `/pages.xml</loc></sitemap>
+</sitemapindex>`))
+		case "/posts.xml":
+			_, _ = w.Write([]byte(`<urlset><url><loc>https://blog.example.com/post</loc></url></urlset>`))
+		case "/pages.xml":
+			_, _ = w.Write([]byte(`<urlset><url><loc>https://blog.example.com/about</loc></url></urlset>`))
+		case "/broken.xml":
+			_, _ = w.Write([]byte(`not xml`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	st := &storeMock{}
+	s := Syncer{Sitemaps: map[string]string{"site1": ts.URL + "/sitemap.xml", "site2": ts.URL + "/index.xml"}, Store: st}
+	require.NoError(t, s.Sync(context.Background()))
+	assert.Equal(t, []string{"https://example.com/p/1", "https://example.com/p/2"}, st.pages["site1"])
+	assert.Equal(t, []string{"https://blog.example.com/post", "https://blog.example.com/about"}, st.pages["site2"], "from sitemap index")
+
+	st = &storeMock{}
+	s = Syncer{Sitemaps: map[string]string{"site1": ts.URL + "/missing.xml", "site2": ts.URL + "/broken.xml",
+		"site3": ts.URL + "/sitemap.xml"}, Store: st}
+	err := s.Sync(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "can't load sitemap of site1: unexpected status 404")
+	assert.Contains(t, err.Error(), "can't load sitemap of site2: can't decode sitemap")
+	assert.Len(t, st.pages, 1, "failed sites skipped")
+	assert.Len(t, st.pages["site3"], 2)
+
+	st = &storeMock{err: errors.New("store error")}
+	s = Syncer{Sitemaps: map[string]string{"site1": ts.URL + "/sitemap.xml"}, Store: st}
+	assert.EqualError(t, s.Sync(context.Background()), "can't register pages of site1: store error")
+}
+
+func TestSyncer_Run(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`<urlset><url><loc>https://example.com/p/1</loc></url></urlset>`))
+	}))
+	defer ts.Close()
+
+	st := &storeMock{}
+	s := Syncer{Sitemaps: map[string]string{"site1": ts.URL}, Store: st}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	s.Run(ctx, 10*time.Millisecond)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	assert.Equal(t, []string{"https://example.com/p/1"}, st.pages["site1"])
+}
@@ -0,0 +1,56 @@
+// Package asset provides admin-managed branding assets of sites, like custom CSS and logos, served to embeds.
+package asset
+
+import (
+	"errors"
+	"path"
+	"regexp"
+	"time"
+)
+
+// ErrNotFound returned if asset doesn't exist
+var ErrNotFound = errors.New("asset not found")
+
+// Asset is a small file of the site
+type Asset struct {
+	SiteID      string    `json:"site"`
+	Name        string    `json:"name"`
+	ContentType string    `json:"content_type"`
+	Size        int       `json:"size"`
+	Hash        string    `json:"hash"` // sha256 of data, used as etag
+	Timestamp   time.Time `json:"time"`
+	Data        []byte    `json:"-"`
+}
+
+// Store defines interface to keep assets
+type Store interface {
+	Save(a Asset) error
+	Load(siteID, name string) (Asset, error)
+	Info(siteID, name string) (Asset, error) // asset without data
+	List(siteID string) ([]Asset, error)     // assets without data, sorted by name
+	Delete(siteID, name string) error
+	Close() error
+}
+
+var reName = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+var contentTypes = map[string]string{
+	".css":  "text/css; charset=utf-8",
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".svg":  "image/svg+xml",
+	".ico":  "image/x-icon",
+}
+
+// ContentType returns content type of the asset by its name, false if name is invalid or type not allowed.
+// Names are lowercase letters, digits, dots, dashes and underscores, up to 64 characters.
+func ContentType(name string) (string, bool) {
+	if !reName.MatchString(name) {
+		return "", false
+	}
+	ct, ok := contentTypes[path.Ext(name)]
+	return ct, ok
+}
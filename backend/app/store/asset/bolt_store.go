@@ -0,0 +1,157 @@
+package asset
+
+import (
+	"encoding/json"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	metaBucketName = "meta" // nested per-site buckets of assets without data, keyed by asset name
+	dataBucketName = "data" // nested per-site buckets of assets data, keyed by asset name
+)
+
+// Bolt implements Store with assets kept in bolt DB. Data kept apart from the rest of the asset,
+// so listing and Info don't read it.
+type Bolt struct {
+	fileName string
+	db       *bolt.DB
+}
+
+// NewBoltStorage makes bolt asset store
+func NewBoltStorage(fileName string, options bolt.Options) (*Bolt, error) {
+	db, err := bolt.Open(fileName, 0o600, &options) //nolint:gocritic //octalLiteral is OK as FileMode
+	if err != nil {
+		return nil, fmt.Errorf("failed to make boltdb for %s: %w", fileName, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bktName := range []string{metaBucketName, dataBucketName} {
+			if _, e := tx.CreateBucketIfNotExists([]byte(bktName)); e != nil {
+				return fmt.Errorf("failed to create top-level bucket %s: %w", bktName, e)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to create top level buckets: %w", err)
+	}
+	return &Bolt{db: db, fileName: fileName}, nil
+}
+
+// Save asset, replaces existing asset with the same name
+func (b *Bolt) Save(a Asset) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		metaBkt, err := tx.Bucket([]byte(metaBucketName)).CreateBucketIfNotExists([]byte(a.SiteID))
+		if err != nil {
+			return fmt.Errorf("failed to create bucket %s: %w", a.SiteID, err)
+		}
+		dataBkt, err := tx.Bucket([]byte(dataBucketName)).CreateBucketIfNotExists([]byte(a.SiteID))
+		if err != nil {
+			return fmt.Errorf("failed to create data bucket %s: %w", a.SiteID, err)
+		}
+		meta, err := json.Marshal(a)
+		if err != nil {
+			return fmt.Errorf("failed to marshal asset %s: %w", a.Name, err)
+		}
+		if err = metaBkt.Put([]byte(a.Name), meta); err != nil {
+			return fmt.Errorf("failed to put asset %s: %w", a.Name, err)
+		}
+		return dataBkt.Put([]byte(a.Name), a.Data)
+	})
+}
+
+// Load asset with data
+func (b *Bolt) Load(siteID, name string) (res Asset, err error) {
+	err = b.db.View(func(tx *bolt.Tx) error {
+		if res, err = info(tx, siteID, name); err != nil {
+			return err
+		}
+		if dataBkt := tx.Bucket([]byte(dataBucketName)).Bucket([]byte(siteID)); dataBkt != nil {
+			res.Data = append([]byte{}, dataBkt.Get([]byte(name))...)
+		}
+		return nil
+	})
+	if err != nil {
+		return Asset{}, err
+	}
+	return res, nil
+}
+
+// Info returns asset without data
+func (b *Bolt) Info(siteID, name string) (res Asset, err error) {
+	err = b.db.View(func(tx *bolt.Tx) error {
+		res, err = info(tx, siteID, name)
+		return err
+	})
+	if err != nil {
+		return Asset{}, err
+	}
+	return res, nil
+}
+
+// List returns site's assets without data, sorted by name
+func (b *Bolt) List(siteID string) ([]Asset, error) {
+	res := []Asset{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(metaBucketName)).Bucket([]byte(siteID))
+		if bkt == nil {
+			return nil
+		}
+		return bkt.ForEach(func(k, v []byte) error {
+			a := Asset{}
+			if err := json.Unmarshal(v, &a); err != nil {
+				return fmt.Errorf("failed to unmarshal asset %s: %w", string(k), err)
+			}
+			res = append(res, a)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Delete asset
+func (b *Bolt) Delete(siteID, name string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(metaBucketName)).Bucket([]byte(siteID))
+		if bkt == nil || bkt.Get([]byte(name)) == nil {
+			return ErrNotFound
+		}
+		if err := bkt.Delete([]byte(name)); err != nil {
+			return fmt.Errorf("failed to delete asset %s: %w", name, err)
+		}
+		if dataBkt := tx.Bucket([]byte(dataBucketName)).Bucket([]byte(siteID)); dataBkt != nil {
+			return dataBkt.Delete([]byte(name))
+		}
+		return nil
+	})
+}
+
+// Close bolt store
+func (b *Bolt) Close() error {
+	if err := b.db.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", b.fileName, err)
+	}
+	return nil
+}
+
+// info reads the asset without data
+func info(tx *bolt.Tx, siteID, name string) (Asset, error) {
+	bkt := tx.Bucket([]byte(metaBucketName)).Bucket([]byte(siteID))
+	if bkt == nil {
+		return Asset{}, ErrNotFound
+	}
+	v := bkt.Get([]byte(name))
+	if v == nil {
+		return Asset{}, ErrNotFound
+	}
+	res := Asset{}
+	if err := json.Unmarshal(v, &res); err != nil {
+		return Asset{}, fmt.Errorf("failed to unmarshal asset %s: %w", name, err)
+	}
+	return res, nil
+}
@@ -0,0 +1,104 @@
+package asset
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestBolt_Assets(t *testing.T) {
+	svc, teardown := prepareBoltAssetStorageTest(t)
+	defer teardown()
+	ts := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	res, err := svc.List("site1")
+	require.NoError(t, err)
+	assert.Empty(t, res)
+	_, err = svc.Load("site1", "custom.css")
+	require.ErrorIs(t, err, ErrNotFound)
+	require.ErrorIs(t, svc.Delete("site1", "custom.css"), ErrNotFound)
+
+	css := Asset{SiteID: "site1", Name: "custom.css", ContentType: "text/css; charset=utf-8", Size: 10, Hash: "h1",
+		Timestamp: ts, Data: []byte("body{a:b;}")}
+	require.NoError(t, svc.Save(css))
+	require.NoError(t, svc.Save(Asset{SiteID: "site1", Name: "a-logo.png", ContentType: "image/png", Size: 3, Data: []byte{1, 2, 3}}))
+	require.NoError(t, svc.Save(Asset{SiteID: "site2", Name: "custom.css", Size: 1, Data: []byte("x")}))
+
+	a, err := svc.Load("site1", "custom.css")
+	require.NoError(t, err)
+	assert.Equal(t, css, a)
+	a, err = svc.Info("site1", "custom.css")
+	require.NoError(t, err)
+	assert.Nil(t, a.Data, "info without data")
+	assert.Equal(t, "h1", a.Hash)
+	_, err = svc.Info("site1", "missing.css")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	res, err = svc.List("site1")
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	assert.Equal(t, "a-logo.png", res[0].Name, "sorted by name")
+	assert.Equal(t, "custom.css", res[1].Name)
+	assert.Nil(t, res[1].Data, "listed without data")
+	assert.Equal(t, 10, res[1].Size)
+
+	// replace
+	css.Data, css.Size, css.Hash = []byte("p{}"), 3, "h2"
+	require.NoError(t, svc.Save(css))
+	a, err = svc.Load("site1", "custom.css")
+	require.NoError(t, err)
+	assert.Equal(t, "p{}", string(a.Data))
+
+	require.NoError(t, svc.Delete("site1", "custom.css"))
+	_, err = svc.Load("site1", "custom.css")
+	require.ErrorIs(t, err, ErrNotFound)
+	_, err = svc.Info("site1", "custom.css")
+	require.ErrorIs(t, err, ErrNotFound)
+	_, err = svc.Load("site2", "custom.css")
+	require.NoError(t, err, "other site not affected")
+}
+
+func TestContentType(t *testing.T) {
+	tbl := []struct {
+		name string
+		ct   string
+		ok   bool
+	}{
+		{"custom.css", "text/css; charset=utf-8", true},
+		{"logo.png", "image/png", true},
+		{"logo-2_dark.svg", "image/svg+xml", true},
+		{"font.woff2", "", false},
+		{"script.js", "", false},
+		{"page.html", "", false},
+		{"Logo.png", "", false},
+		{".hidden.css", "", false},
+		{"dir/logo.png", "", false},
+		{"../logo.png", "", false},
+		{"logo", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tbl {
+		ct, ok := ContentType(tt.name)
+		assert.Equal(t, tt.ok, ok, tt.name)
+		assert.Equal(t, tt.ct, ct, tt.name)
+	}
+}
+
+func prepareBoltAssetStorageTest(t *testing.T) (svc *Bolt, teardown func()) {
+	loc, err := os.MkdirTemp("", "test_asset_r42")
+	require.NoError(t, err, "failed to make temp dir")
+
+	svc, err = NewBoltStorage(path.Join(loc, "assets.db"), bolt.Options{})
+	require.NoError(t, err, "new bolt storage")
+
+	teardown = func() {
+		assert.NoError(t, svc.Close())
+		assert.NoError(t, os.RemoveAll(loc))
+	}
+	return svc, teardown
+}
@@ -0,0 +1,113 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const botsBucket = "bots" // nested bucket per site, bot id -> bot
+
+// Bolt implements Store with bots kept in bolt DB
+type Bolt struct {
+	fileName string
+	db       *bolt.DB
+}
+
+// NewBoltStorage makes bolt bot store
+func NewBoltStorage(fileName string, options bolt.Options) (*Bolt, error) {
+	db, err := bolt.Open(fileName, 0o600, &options) //nolint:gocritic //octalLiteral is OK as FileMode
+	if err != nil {
+		return nil, fmt.Errorf("failed to make boltdb for %s: %w", fileName, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, e := tx.CreateBucketIfNotExists([]byte(botsBucket)); e != nil {
+			return fmt.Errorf("failed to create bucket %s: %w", botsBucket, e)
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &Bolt{db: db, fileName: fileName}, nil
+}
+
+// Create adds the bot to its site
+func (b *Bolt) Create(bt Bot) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bkt, err := tx.Bucket([]byte(botsBucket)).CreateBucketIfNotExists([]byte(bt.SiteID))
+		if err != nil {
+			return fmt.Errorf("failed to create bucket %s: %w", bt.SiteID, err)
+		}
+		data, err := json.Marshal(bt)
+		if err != nil {
+			return fmt.Errorf("failed to marshal bot %s: %w", bt.ID, err)
+		}
+		return bkt.Put([]byte(bt.ID), data)
+	})
+}
+
+// Get returns the bot of the site by id
+func (b *Bolt) Get(siteID, id string) (res Bot, err error) {
+	err = b.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(botsBucket)).Bucket([]byte(siteID))
+		if bkt == nil {
+			return ErrNotFound
+		}
+		v := bkt.Get([]byte(id))
+		if v == nil {
+			return ErrNotFound
+		}
+		if e := json.Unmarshal(v, &res); e != nil {
+			return fmt.Errorf("failed to unmarshal bot %s: %w", id, e)
+		}
+		return nil
+	})
+	return res, err
+}
+
+// List returns bots of the site, oldest first
+func (b *Bolt) List(siteID string) ([]Bot, error) {
+	res := []Bot{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(botsBucket)).Bucket([]byte(siteID))
+		if bkt == nil {
+			return nil
+		}
+		return bkt.ForEach(func(k, v []byte) error {
+			bt := Bot{}
+			if err := json.Unmarshal(v, &bt); err != nil {
+				return fmt.Errorf("failed to unmarshal bot %s: %w", k, err)
+			}
+			res = append(res, bt)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(res, func(a, b Bot) int { return a.Created.Compare(b.Created) })
+	return res, nil
+}
+
+// Delete removes the bot of the site
+func (b *Bolt) Delete(siteID, id string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(botsBucket)).Bucket([]byte(siteID))
+		if bkt == nil || bkt.Get([]byte(id)) == nil {
+			return ErrNotFound
+		}
+		return bkt.Delete([]byte(id))
+	})
+}
+
+// Close bolt store
+func (b *Bolt) Close() error {
+	if err := b.db.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", b.fileName, err)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package bot
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestBolt_Bots(t *testing.T) {
+	svc, teardown := prepareBoltBotStorageTest(t)
+	defer teardown()
+	ts := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	res, err := svc.List("site1")
+	require.NoError(t, err)
+	assert.Empty(t, res)
+	_, err = svc.Get("site1", "bot_1")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	bot1 := Bot{ID: "bot_1", SiteID: "site1", Name: "bridge", KeyHash: "hash1", CreatedBy: "admin", Created: ts.Add(time.Minute)}
+	bot2 := Bot{ID: "bot_2", SiteID: "site1", Name: "feed", KeyHash: "hash2", CreatedBy: "admin", Created: ts}
+	bot3 := Bot{ID: "bot_3", SiteID: "site2", Name: "other", KeyHash: "hash3", CreatedBy: "admin", Created: ts}
+	for _, b := range []Bot{bot1, bot2, bot3} {
+		require.NoError(t, svc.Create(b))
+	}
+
+	b, err := svc.Get("site1", "bot_1")
+	require.NoError(t, err)
+	assert.Equal(t, bot1, b)
+	_, err = svc.Get("site2", "bot_1")
+	assert.ErrorIs(t, err, ErrNotFound, "bot of other site")
+
+	res, err = svc.List("site1")
+	require.NoError(t, err)
+	assert.Equal(t, []Bot{bot2, bot1}, res, "oldest first")
+
+	require.NoError(t, svc.Delete("site1", "bot_1"))
+	assert.ErrorIs(t, svc.Delete("site1", "bot_1"), ErrNotFound)
+	assert.ErrorIs(t, svc.Delete("unknown", "bot_1"), ErrNotFound)
+	res, err = svc.List("site1")
+	require.NoError(t, err)
+	assert.Equal(t, []Bot{bot2}, res)
+}
+
+func prepareBoltBotStorageTest(t *testing.T) (svc *Bolt, teardown func()) {
+	loc, err := os.MkdirTemp("", "test_bot_r42")
+	require.NoError(t, err, "failed to make temp dir")
+	svc, err = NewBoltStorage(path.Join(loc, "bots.db"), bolt.Options{})
+	require.NoError(t, err, "new bolt storage")
+	teardown = func() {
+		assert.NoError(t, svc.Close())
+		assert.NoError(t, os.RemoveAll(loc))
+	}
+	return svc, teardown
+}
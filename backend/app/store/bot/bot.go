@@ -0,0 +1,31 @@
+// Package bot provides bot accounts of the sites, authenticated by api keys, for bridges and integrations
+package bot
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNotFound returned by Store for unknown bot
+var ErrNotFound = errors.New("bot not found")
+
+// Bot is an account of the site used by integrations, authenticated by api key instead of login
+type Bot struct {
+	ID        string    `json:"id"` // user id of the bot, with bot_ prefix
+	SiteID    string    `json:"site"`
+	Name      string    `json:"name"`
+	Picture   string    `json:"picture,omitempty"`
+	KeyHash   string    `json:"key_hash,omitempty"` // sha256 of the api key secret, the key itself is not stored
+	CreatedBy string    `json:"created_by"`
+	Created   time.Time `json:"created"`
+}
+
+// Store defines interface to keep bots of the sites
+type Store interface {
+	Create(b Bot) error
+	Get(siteID, id string) (Bot, error)
+	// List returns bots of the site, oldest first
+	List(siteID string) ([]Bot, error)
+	Delete(siteID, id string) error
+	Close() error
+}
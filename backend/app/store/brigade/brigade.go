@@ -0,0 +1,227 @@
+// Package brigade detects vote brigading, i.e. coordinated voting for a comment. Votes are kept in memory for a short
+// window and analyzed periodically, groups of suspicious votes become alerts for admins to review.
+package brigade
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark42/backend/app/store"
+)
+
+// ErrNotFound is returned when alert not found
+var ErrNotFound = errors.New("alert not found")
+
+// alert reasons
+const (
+	ReasonSubnet   = "subnet"    // votes from the same /24 (ipv4) or /64 (ipv6) network
+	ReasonNewUsers = "new_users" // votes of users with new level
+)
+
+const maxAlerts = 100 // alerts kept per site, the oldest dropped
+
+// Vote is a vote for comment recorded for analysis
+type Vote struct {
+	Locator   store.Locator `json:"-"`
+	CommentID string        `json:"-"`
+	UserID    string        `json:"user_id"`
+	IPHash    string        `json:"-"` // hash of voter's ip, the key of comment's VotedIPs
+	Subnet    string        `json:"-"` // hash of voter's network, empty if ip unknown
+	NewUser   bool          `json:"new_user,omitempty"`
+	Value     bool          `json:"value"`
+	Time      time.Time     `json:"time"`
+}
+
+// Alert is a group of suspicious votes for the comment made within the detection window
+type Alert struct {
+	ID        string        `json:"id"`
+	Locator   store.Locator `json:"locator"`
+	CommentID string        `json:"comment_id"`
+	Reason    string        `json:"reason"`
+	Value     bool          `json:"value"` // direction of votes, true for upvotes
+	Votes     []Vote        `json:"votes"`
+	Time      time.Time     `json:"time"`
+}
+
+// Detector records votes and makes alerts for groups of at least MinVotes votes for the same comment in the same
+// direction, made within Window from the same network or by new users
+type Detector struct {
+	Window   time.Duration
+	MinVotes int
+
+	mu     sync.Mutex
+	votes  []Vote
+	alerts map[string][]Alert // alerts by site, the oldest first
+}
+
+// Record adds vote for analysis
+func (d *Detector) Record(v Vote) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.votes = append(d.votes, v)
+}
+
+// Analyze makes alerts from votes recorded within window before now and returns them.
+// Votes of alerts are not analyzed again, votes older than window dropped.
+func (d *Detector) Analyze(now time.Time) []Alert {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	recent := d.votes[:0]
+	for _, v := range d.votes {
+		if v.Time.After(now.Add(-d.Window)) {
+			recent = append(recent, v)
+		}
+	}
+	d.votes = recent
+
+	type target struct {
+		locator   store.Locator
+		commentID string
+		value     bool
+	}
+	groups := map[target][]int{} // indexes of votes for the same comment in the same direction
+	var targets []target
+	for i, v := range d.votes {
+		t := target{locator: v.Locator, commentID: v.CommentID, value: v.Value}
+		if _, ok := groups[t]; !ok {
+			targets = append(targets, t)
+		}
+		groups[t] = append(groups[t], i)
+	}
+
+	used := make([]bool, len(d.votes))
+	var res []Alert
+	makeAlert := func(t target, reason string, idxs []int) {
+		if len(idxs) < d.MinVotes {
+			return
+		}
+		a := Alert{ID: newID(), Locator: t.locator, CommentID: t.commentID, Reason: reason, Value: t.value, Time: now}
+		for _, i := range idxs {
+			used[i] = true
+			a.Votes = append(a.Votes, d.votes[i])
+		}
+		res = append(res, a)
+	}
+	for _, t := range targets {
+		bySubnet := map[string][]int{}
+		var subnets []string
+		for _, i := range groups[t] {
+			if subnet := d.votes[i].Subnet; subnet != "" {
+				if _, ok := bySubnet[subnet]; !ok {
+					subnets = append(subnets, subnet)
+				}
+				bySubnet[subnet] = append(bySubnet[subnet], i)
+			}
+		}
+		for _, subnet := range subnets {
+			makeAlert(t, ReasonSubnet, bySubnet[subnet])
+		}
+		var newUsers []int
+		for _, i := range groups[t] {
+			if d.votes[i].NewUser && !used[i] {
+				newUsers = append(newUsers, i)
+			}
+		}
+		makeAlert(t, ReasonNewUsers, newUsers)
+	}
+
+	left := d.votes[:0]
+	for i, v := range d.votes {
+		if !used[i] {
+			left = append(left, v)
+		}
+	}
+	d.votes = left
+
+	if d.alerts == nil {
+		d.alerts = map[string][]Alert{}
+	}
+	for _, a := range res {
+		alerts := append(d.alerts[a.Locator.SiteID], a)
+		if len(alerts) > maxAlerts {
+			alerts = alerts[len(alerts)-maxAlerts:]
+		}
+		d.alerts[a.Locator.SiteID] = alerts
+		log.Printf("[INFO] suspicious votes for comment %s of %s, %d votes by %s", a.CommentID, a.Locator.URL, len(a.Votes), a.Reason)
+	}
+	return res
+}
+
+// Alerts returns alerts of the site, the newest first
+func (d *Detector) Alerts(siteID string) []Alert {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	alerts := d.alerts[siteID]
+	res := make([]Alert, 0, len(alerts))
+	for i := len(alerts) - 1; i >= 0; i-- {
+		res = append(res, alerts[i])
+	}
+	return res
+}
+
+// Alert returns alert of the site by id
+func (d *Detector) Alert(siteID, id string) (Alert, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, a := range d.alerts[siteID] {
+		if a.ID == id {
+			return a, nil
+		}
+	}
+	return Alert{}, ErrNotFound
+}
+
+// Dismiss removes alert of the site by id
+func (d *Detector) Dismiss(siteID, id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i, a := range d.alerts[siteID] {
+		if a.ID == id {
+			d.alerts[siteID] = append(d.alerts[siteID][:i], d.alerts[siteID][i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// Run analyzes recorded votes every period, until ctx canceled
+func (d *Detector) Run(ctx context.Context, period time.Duration) {
+	log.Printf("[INFO] activate vote brigading detector, %d votes within %s, period %s", d.MinVotes, d.Window, period)
+	tick := time.NewTicker(period)
+	defer tick.Stop()
+	for {
+		select {
+		case ts := <-tick.C:
+			d.Analyze(ts)
+		case <-ctx.Done():
+			log.Print("[DEBUG] terminated vote brigading detector")
+			return
+		}
+	}
+}
+
+// Subnet returns network of ip, /24 for ipv4 and /64 for ipv6, empty if ip invalid
+func Subnet(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return (&net.IPNet{IP: v4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+	return (&net.IPNet{IP: parsed.Mask(net.CIDRMask(64, 128)), Mask: net.CIDRMask(64, 128)}).String()
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,121 @@
+package brigade
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store"
+)
+
+func TestDetector_Analyze(t *testing.T) {
+	d := Detector{Window: 10 * time.Minute, MinVotes: 3}
+	locator := store.Locator{SiteID: "site", URL: "https://example.com/post"}
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	vote := func(commentID, user, subnet string, newUser, value bool, ago time.Duration) {
+		d.Record(Vote{Locator: locator, CommentID: commentID, UserID: user, IPHash: "ip-" + user, Subnet: subnet,
+			NewUser: newUser, Value: value, Time: now.Add(-ago)})
+	}
+
+	vote("c1", "u1", "net1", false, false, time.Minute)
+	vote("c1", "u2", "net1", false, false, 2*time.Minute)
+	vote("c1", "u3", "net1", false, true, 3*time.Minute)  // opposite direction
+	vote("c1", "u4", "net1", false, false, time.Hour)     // out of window
+	vote("c2", "u5", "net1", false, false, time.Minute)   // other comment
+	vote("c1", "u6", "net2", true, false, time.Minute)    // new users
+	vote("c1", "u7", "net3", true, false, time.Minute)    //
+	vote("c1", "u8", "", true, false, 2*time.Minute)      //
+	vote("c1", "u9", "net2", false, false, 2*time.Minute) // regular
+
+	alerts := d.Analyze(now)
+	require.Len(t, alerts, 1)
+	a := alerts[0]
+	assert.Equal(t, ReasonNewUsers, a.Reason)
+	assert.Equal(t, "c1", a.CommentID)
+	assert.False(t, a.Value)
+	assert.Equal(t, locator, a.Locator)
+	require.Len(t, a.Votes, 3)
+	assert.Equal(t, []string{"u6", "u7", "u8"}, []string{a.Votes[0].UserID, a.Votes[1].UserID, a.Votes[2].UserID})
+	assert.NotEmpty(t, a.ID)
+
+	vote("c1", "u10", "net1", false, false, 0)
+	alerts = d.Analyze(now)
+	require.Len(t, alerts, 1)
+	assert.Equal(t, ReasonSubnet, alerts[0].Reason)
+	require.Len(t, alerts[0].Votes, 3)
+	assert.Equal(t, []string{"u1", "u2", "u10"},
+		[]string{alerts[0].Votes[0].UserID, alerts[0].Votes[1].UserID, alerts[0].Votes[2].UserID})
+
+	assert.Empty(t, d.Analyze(now), "alerted votes not analyzed again")
+	assert.Len(t, d.votes, 3, "c1 by u3 and u9, c2 by u5 left")
+	d.Analyze(now.Add(time.Hour))
+	assert.Empty(t, d.votes, "old votes dropped")
+
+	res := d.Alerts("site")
+	require.Len(t, res, 2)
+	assert.Equal(t, ReasonSubnet, res[0].Reason, "the newest first")
+	assert.Empty(t, d.Alerts("other"))
+
+	got, err := d.Alert("site", a.ID)
+	require.NoError(t, err)
+	assert.Equal(t, a, got)
+	_, err = d.Alert("other", a.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, d.Dismiss("site", a.ID))
+	assert.ErrorIs(t, d.Dismiss("site", a.ID), ErrNotFound)
+	res = d.Alerts("site")
+	require.Len(t, res, 1)
+	assert.Equal(t, ReasonSubnet, res[0].Reason)
+}
+
+func TestDetector_AlertsLimit(t *testing.T) {
+	d := Detector{Window: time.Minute, MinVotes: 1}
+	now := time.Now()
+	for i := range maxAlerts + 10 {
+		d.Record(Vote{Locator: store.Locator{SiteID: "site", URL: "url"}, CommentID: fmt.Sprintf("c%d", i),
+			UserID: "u1", NewUser: true, Time: now})
+	}
+	assert.Len(t, d.Analyze(now), maxAlerts+10)
+	alerts := d.Alerts("site")
+	require.Len(t, alerts, maxAlerts)
+	assert.Equal(t, "c109", alerts[0].CommentID, "the newest first")
+	assert.Equal(t, "c10", alerts[len(alerts)-1].CommentID, "the oldest alerts dropped")
+}
+
+func TestDetector_Run(t *testing.T) {
+	d := Detector{Window: time.Minute, MinVotes: 2}
+	for _, user := range []string{"u1", "u2"} {
+		d.Record(Vote{Locator: store.Locator{SiteID: "site", URL: "url"}, CommentID: "c1", UserID: user,
+			Subnet: "net1", Time: time.Now()})
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		d.Run(ctx, 10*time.Millisecond)
+		close(done)
+	}()
+	require.Eventually(t, func() bool { return len(d.Alerts("site")) == 1 }, time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+}
+
+func TestSubnet(t *testing.T) {
+	tbl := []struct {
+		ip, res string
+	}{
+		{"192.168.1.25", "192.168.1.0/24"},
+		{"10.0.0.1", "10.0.0.0/24"},
+		{"2001:db8:1:2:3:4:5:6", "2001:db8:1:2::/64"},
+		{"::ffff:192.168.1.25", "192.168.1.0/24"},
+		{"", ""},
+		{"bad", ""},
+	}
+	for _, tt := range tbl {
+		assert.Equal(t, tt.res, Subnet(tt.ip), tt.ip)
+	}
+}
@@ -0,0 +1,131 @@
+package cold
+
+import (
+	"encoding/json"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Bolt implements Store with segments kept in bolt DB. Each site has a bucket with nested "meta" bucket
+// of segments and "data" bucket of compressed comments, both keyed by post url, so listing doesn't read data.
+type Bolt struct {
+	fileName string
+	db       *bolt.DB
+}
+
+const (
+	metaBucketName = "meta"
+	dataBucketName = "data"
+)
+
+// NewBoltStorage makes bolt cold store
+func NewBoltStorage(fileName string, options bolt.Options) (*Bolt, error) {
+	db, err := bolt.Open(fileName, 0o600, &options) //nolint:gocritic //octalLiteral is OK as FileMode
+	if err != nil {
+		return nil, fmt.Errorf("failed to make boltdb for %s: %w", fileName, err)
+	}
+	return &Bolt{db: db, fileName: fileName}, nil
+}
+
+// Save segment, replaces existing segment of the same post
+func (b *Bolt) Save(s Segment) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		siteBkt, err := tx.CreateBucketIfNotExists([]byte(s.SiteID))
+		if err != nil {
+			return fmt.Errorf("failed to create bucket %s: %w", s.SiteID, err)
+		}
+		meta, err := json.Marshal(s)
+		if err != nil {
+			return fmt.Errorf("failed to marshal segment %s: %w", s.URL, err)
+		}
+		for name, val := range map[string][]byte{metaBucketName: meta, dataBucketName: s.Data} {
+			bkt, e := siteBkt.CreateBucketIfNotExists([]byte(name))
+			if e != nil {
+				return fmt.Errorf("failed to create bucket %s: %w", name, e)
+			}
+			if e = bkt.Put([]byte(s.URL), val); e != nil {
+				return fmt.Errorf("failed to put %s to %s: %w", s.URL, name, e)
+			}
+		}
+		return nil
+	})
+}
+
+// Load segment with data
+func (b *Bolt) Load(siteID, url string) (Segment, error) {
+	res := Segment{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		meta, data := b.buckets(tx, siteID)
+		if meta == nil || data == nil {
+			return ErrNotFound
+		}
+		v := meta.Get([]byte(url))
+		if v == nil {
+			return ErrNotFound
+		}
+		if err := json.Unmarshal(v, &res); err != nil {
+			return fmt.Errorf("failed to unmarshal segment %s: %w", url, err)
+		}
+		res.Data = append([]byte(nil), data.Get([]byte(url))...) // copy, value is valid in transaction only
+		return nil
+	})
+	if err != nil {
+		return Segment{}, err
+	}
+	return res, nil
+}
+
+// List returns site's segments without data, sorted by url
+func (b *Bolt) List(siteID string) ([]Segment, error) {
+	res := []Segment{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		meta, _ := b.buckets(tx, siteID)
+		if meta == nil {
+			return nil
+		}
+		return meta.ForEach(func(k, v []byte) error {
+			s := Segment{}
+			if err := json.Unmarshal(v, &s); err != nil {
+				return fmt.Errorf("failed to unmarshal segment %s: %w", string(k), err)
+			}
+			res = append(res, s)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Delete segment
+func (b *Bolt) Delete(siteID, url string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		meta, data := b.buckets(tx, siteID)
+		if meta == nil || data == nil || meta.Get([]byte(url)) == nil {
+			return ErrNotFound
+		}
+		if err := meta.Delete([]byte(url)); err != nil {
+			return fmt.Errorf("failed to delete %s from %s: %w", url, metaBucketName, err)
+		}
+		return data.Delete([]byte(url))
+	})
+}
+
+// Close bolt store
+func (b *Bolt) Close() error {
+	if err := b.db.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", b.fileName, err)
+	}
+	return nil
+}
+
+// buckets returns meta and data buckets of the site, nil if site has no segments
+func (b *Bolt) buckets(tx *bolt.Tx, siteID string) (meta, data *bolt.Bucket) {
+	siteBkt := tx.Bucket([]byte(siteID))
+	if siteBkt == nil {
+		return nil, nil
+	}
+	return siteBkt.Bucket([]byte(metaBucketName)), siteBkt.Bucket([]byte(dataBucketName))
+}
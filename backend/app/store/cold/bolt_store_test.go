@@ -0,0 +1,71 @@
+package cold
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestBolt_Segments(t *testing.T) {
+	svc, teardown := prepareBoltColdStorageTest(t)
+	defer teardown()
+	ts := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	res, err := svc.List("site1")
+	require.NoError(t, err)
+	assert.Empty(t, res)
+	_, err = svc.Load("site1", "https://example.com/1")
+	require.ErrorIs(t, err, ErrNotFound)
+	require.ErrorIs(t, svc.Delete("site1", "https://example.com/1"), ErrNotFound)
+
+	s1 := Segment{SiteID: "site1", URL: "https://example.com/1", Count: 2, FirstTS: ts, LastTS: ts.Add(time.Hour),
+		Size: 3, Frozen: ts.Add(24 * time.Hour), Data: []byte{1, 2, 3}}
+	require.NoError(t, svc.Save(s1))
+	require.NoError(t, svc.Save(Segment{SiteID: "site1", URL: "https://example.com/0", Count: 1, Size: 1, Data: []byte{1}}))
+	require.NoError(t, svc.Save(Segment{SiteID: "site2", URL: "https://example.com/1", Count: 1, Size: 1, Data: []byte{1}}))
+
+	s, err := svc.Load("site1", "https://example.com/1")
+	require.NoError(t, err)
+	assert.Equal(t, s1, s)
+
+	res, err = svc.List("site1")
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	assert.Equal(t, "https://example.com/0", res[0].URL, "sorted by url")
+	assert.Equal(t, "https://example.com/1", res[1].URL)
+	assert.Nil(t, res[1].Data, "listed without data")
+	assert.Equal(t, 2, res[1].Count)
+
+	// replace
+	s1.Data, s1.Size, s1.Count = []byte{4, 5}, 2, 3
+	require.NoError(t, svc.Save(s1))
+	s, err = svc.Load("site1", "https://example.com/1")
+	require.NoError(t, err)
+	assert.Equal(t, []byte{4, 5}, s.Data)
+	assert.Equal(t, 3, s.Count)
+
+	require.NoError(t, svc.Delete("site1", "https://example.com/1"))
+	_, err = svc.Load("site1", "https://example.com/1")
+	require.ErrorIs(t, err, ErrNotFound)
+	_, err = svc.Load("site2", "https://example.com/1")
+	require.NoError(t, err, "other site not affected")
+}
+
+func prepareBoltColdStorageTest(t *testing.T) (svc *Bolt, teardown func()) {
+	loc, err := os.MkdirTemp("", "test_cold_r42")
+	require.NoError(t, err, "failed to make temp dir")
+
+	svc, err = NewBoltStorage(path.Join(loc, "cold.db"), bolt.Options{})
+	require.NoError(t, err, "new bolt storage")
+
+	teardown = func() {
+		assert.NoError(t, svc.Close())
+		assert.NoError(t, os.RemoveAll(loc))
+	}
+	return svc, teardown
+}
@@ -0,0 +1,92 @@
+// Package cold provides cold storage of inactive posts. Comments of a post are kept compressed
+// in a single segment, out of the main store, and loaded on demand.
+package cold
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/umputun/remark42/backend/app/store"
+)
+
+// ErrNotFound returned if post has no segment
+var ErrNotFound = errors.New("segment not found")
+
+// Segment is a frozen post with compressed comments in Data
+type Segment struct {
+	SiteID   string    `json:"site"`
+	URL      string    `json:"url"`
+	Count    int       `json:"count"` // number of comments, excluding deleted
+	FirstTS  time.Time `json:"first_time"`
+	LastTS   time.Time `json:"last_time"`
+	ReadOnly bool      `json:"read_only"` // read-only status set manually
+	Size     int       `json:"size"`      // size of compressed data
+	Frozen   time.Time `json:"frozen"`
+	Users    []string  `json:"users,omitempty"` // authors of comments, sorted
+	Data     []byte    `json:"-"`
+}
+
+// Store defines interface to keep segments
+type Store interface {
+	Save(s Segment) error                     // saves segment, replaces existing one of the same post
+	Load(siteID, url string) (Segment, error) // segment with data
+	List(siteID string) ([]Segment, error)    // segments without data, sorted by url
+	Delete(siteID, url string) error
+	Close() error
+}
+
+// NewSegment makes segment of post's comments, sorted by time
+func NewSegment(locator store.Locator, comments []store.Comment, ts time.Time) (Segment, error) {
+	if len(comments) == 0 {
+		return Segment{}, fmt.Errorf("no comments for %s", locator.URL)
+	}
+	buf := bytes.Buffer{}
+	gz := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(gz).Encode(comments); err != nil {
+		return Segment{}, fmt.Errorf("failed to encode comments: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return Segment{}, fmt.Errorf("failed to compress comments: %w", err)
+	}
+	count := 0
+	users := []string{}
+	for _, c := range comments {
+		if !c.Deleted {
+			count++
+		}
+		users = append(users, c.User.ID)
+	}
+	slices.Sort(users)
+	return Segment{SiteID: locator.SiteID, URL: locator.URL, Count: count, FirstTS: comments[0].Timestamp,
+		LastTS: comments[len(comments)-1].Timestamp, Size: buf.Len(), Frozen: ts, Users: slices.Compact(users),
+		Data: buf.Bytes()}, nil
+}
+
+// HasUser checks if the user may have comments in the segment, always true for segments made without authors
+func (s Segment) HasUser(userID string) bool {
+	return s.Users == nil || slices.Contains(s.Users, userID)
+}
+
+// Comments returns comments of the segment
+func (s Segment) Comments() ([]store.Comment, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(s.Data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress segment %s: %w", s.URL, err)
+	}
+	defer gz.Close()
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress segment %s: %w", s.URL, err)
+	}
+	res := []store.Comment{}
+	if err = json.Unmarshal(data, &res); err != nil {
+		return nil, fmt.Errorf("failed to decode segment %s: %w", s.URL, err)
+	}
+	return res, nil
+}
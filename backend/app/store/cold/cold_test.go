@@ -0,0 +1,45 @@
+package cold
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store"
+)
+
+func TestSegment(t *testing.T) {
+	locator := store.Locator{SiteID: "site1", URL: "https://example.com/1"}
+	_, err := NewSegment(locator, nil, time.Now())
+	require.EqualError(t, err, "no comments for https://example.com/1")
+
+	ts := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	comments := []store.Comment{
+		{ID: "c1", Text: strings.Repeat("some text ", 100), Locator: locator, Timestamp: ts, User: store.User{ID: "u1"}},
+		{ID: "c2", ParentID: "c1", Text: "reply", Locator: locator, Timestamp: ts.Add(time.Hour), Deleted: true},
+	}
+	s, err := NewSegment(locator, comments, ts.Add(24*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, "site1", s.SiteID)
+	assert.Equal(t, "https://example.com/1", s.URL)
+	assert.Equal(t, 1, s.Count, "deleted comment not counted")
+	assert.Equal(t, ts, s.FirstTS)
+	assert.Equal(t, ts.Add(time.Hour), s.LastTS)
+	assert.Equal(t, ts.Add(24*time.Hour), s.Frozen)
+	assert.Equal(t, len(s.Data), s.Size)
+	assert.Less(t, s.Size, 500, "compressed")
+	assert.Equal(t, []string{"", "u1"}, s.Users)
+	assert.True(t, s.HasUser("u1"))
+	assert.False(t, s.HasUser("u2"))
+	assert.True(t, Segment{}.HasUser("u2"), "segment without authors")
+
+	res, err := s.Comments()
+	require.NoError(t, err)
+	assert.Equal(t, comments, res)
+
+	_, err = Segment{URL: "https://example.com/1", Data: []byte("bad")}.Comments()
+	require.Error(t, err)
+}
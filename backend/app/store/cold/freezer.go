@@ -0,0 +1,51 @@
+package cold
+
+import (
+	"context"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+)
+
+// PostsFreezer moves inactive posts of the site to cold storage
+type PostsFreezer interface {
+	FreezePosts(siteID string, inactive time.Duration) (int, error)
+}
+
+// Freezer moves posts inactive for a period to cold storage periodically
+type Freezer struct {
+	Store    PostsFreezer
+	Sites    []string
+	Inactive time.Duration       // posts without comments for this long are frozen
+	OnUpdate func(siteID string) // called for sites with frozen posts, optional
+}
+
+// Do freezes inactive posts of all sites
+func (f *Freezer) Do() {
+	for _, siteID := range f.Sites {
+		count, err := f.Store.FreezePosts(siteID, f.Inactive)
+		if err != nil {
+			log.Printf("[WARN] failed to freeze posts of %s, %v", siteID, err)
+		}
+		if count > 0 && f.OnUpdate != nil {
+			f.OnUpdate(siteID)
+		}
+	}
+}
+
+// Run freezes inactive posts immediately and then every period, until ctx canceled
+func (f *Freezer) Run(ctx context.Context, period time.Duration) {
+	log.Printf("[INFO] activate cold storage of posts inactive for %s, period %s", f.Inactive, period)
+	f.Do()
+	tick := time.NewTicker(period)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			f.Do()
+		case <-ctx.Done():
+			log.Print("[DEBUG] terminated cold storage")
+			return
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package cold
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockFreezer struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (m *mockFreezer) FreezePosts(siteID string, inactive time.Duration) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, siteID+" "+inactive.String())
+	switch siteID {
+	case "site1":
+		return 2, nil
+	case "site2":
+		return 0, nil
+	}
+	return 1, errors.New("failed")
+}
+
+func TestFreezer_Do(t *testing.T) {
+	st := &mockFreezer{}
+	updated := []string{}
+	f := Freezer{Store: st, Sites: []string{"site1", "site2", "site3"}, Inactive: time.Hour,
+		OnUpdate: func(siteID string) { updated = append(updated, siteID) }}
+	f.Do()
+	assert.Equal(t, []string{"site1 1h0m0s", "site2 1h0m0s", "site3 1h0m0s"}, st.calls)
+	assert.Equal(t, []string{"site1", "site3"}, updated, "sites with frozen posts updated, even on error")
+}
+
+func TestFreezer_Run(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		st := &mockFreezer{}
+		f := Freezer{Store: st, Sites: []string{"site2"}, Inactive: time.Hour}
+		ctx, cancel := context.WithTimeout(context.Background(), 150*time.Minute)
+		defer cancel()
+		f.Run(ctx, time.Hour)
+		st.mu.Lock()
+		defer st.mu.Unlock()
+		assert.Len(t, st.calls, 3, "immediately and two ticks")
+	})
+}
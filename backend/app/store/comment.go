@@ -1,6 +1,7 @@
 package store
 
 import (
+	"crypto/sha256"
 	"fmt"
 	"html/template"
 	"regexp"
@@ -15,22 +16,42 @@ type Comment struct {
 	ID          string                 `json:"id" bson:"_id"`
 	ParentID    string                 `json:"pid"`
 	Text        string                 `json:"text"`
-	Orig        string                 `json:"orig,omitempty"` // important: never render this as HTML! It's not sanitized.
+	Orig        string                 `json:"orig,omitempty"`                                   // important: never render this as HTML! It's not sanitized.
+	PlainText   string                 `json:"plain_text,omitempty" bson:"plain_text,omitempty"` // text without markup, made from Text by formatter
+	RenderKey   string                 `json:"render_key,omitempty" bson:"render_key,omitempty"` // key of rendering Text made with, see CommentFormatter.RenderKey
 	User        User                   `json:"user"`
 	Locator     Locator                `json:"locator"`
 	Score       int                    `json:"score"`
 	Votes       map[string]bool        `json:"votes,omitempty"`
-	VotedIPs    map[string]VotedIPInfo `json:"voted_ips,omitempty"` // voted ips (hashes) with TS
-	Vote        int                    `json:"vote"`                // vote for the current user, -1/1/0.
+	VotedIPs    map[string]VotedIPInfo `json:"voted_ips,omitempty"`    // voted ips (hashes) with TS
+	VoteWeights map[string]float64     `json:"vote_weights,omitempty"` // weights of votes in Votes, 1 if not set
+	Vote        int                    `json:"vote"`                   // vote for the current user, -1/1/0.
 	Controversy float64                `json:"controversy,omitempty"`
 	Timestamp   time.Time              `json:"time" bson:"time"`
 	Edit        *Edit                  `json:"edit,omitempty" bson:"edit,omitempty"` // pointer to have empty default in json response
+	Edited      bool                   `json:"edited,omitempty" bson:"-"`            // comment changed after creation, last edit time in Edit
 	Pin         bool                   `json:"pin,omitempty" bson:"pin,omitempty"`
 	Deleted     bool                   `json:"delete,omitempty" bson:"delete"`
+	SelfDeleted bool                   `json:"self_deleted,omitempty" bson:"self_deleted,omitempty"` // "removed by author" tombstone
 	Imported    bool                   `json:"imported,omitempty" bson:"imported"`
 	PostTitle   string                 `json:"title,omitempty" bson:"title"`
+	Ignored     bool                   `json:"ignored,omitempty" bson:"-"`                       // author ignored by the current user, set on find only
+	Collapsed   bool                   `json:"collapsed,omitempty" bson:"-"`                     // scored below collapse threshold of the site, set on find only
+	HiddenCount int                    `json:"hidden_replies,omitempty" bson:"-"`                // replies collapsed or hidden by collapse policy, set on find only
+	Visibility  string                 `json:"visibility,omitempty" bson:"visibility,omitempty"` // empty for public comments
+	PrivateTo   string                 `json:"private_to,omitempty" bson:"private_to,omitempty"` // user id private reply addressed to
+	Lang        string                 `json:"lang,omitempty" bson:"lang,omitempty"`             // detected language, ISO 639-1
+	NewMember   bool                   `json:"new_member,omitempty" bson:"new_member,omitempty"` // first comment of the user on the site
+	Late        bool                   `json:"late,omitempty" bson:"late,omitempty"`             // made on the thread older than late policy allows
 }
 
+// comment visibility values, public comments have empty visibility
+const (
+	VisibilityStaff   = "staff"   // moderator notes, visible to admins only
+	VisibilityPrivate = "private" // private reply, visible to admins, comment author and author of the parent comment
+	VisibilityPending = "pending" // held for review, visible to admins and comment author until approved
+)
+
 // Locator keeps site and url of the post
 type Locator struct {
 	SiteID string `json:"site,omitempty" bson:"site"`
@@ -87,22 +108,44 @@ func (c *Comment) PrepareUntrusted() {
 	c.Timestamp = time.Time{} // reset time, force auto-gen
 	c.Votes = make(map[string]bool)
 	c.VotedIPs = make(map[string]VotedIPInfo)
+	c.VoteWeights = nil
 	c.Score = 0
 	c.Controversy = 0
 	c.Edit = nil
 	c.Pin = false
 	c.Deleted = false
+	c.SelfDeleted = false
 	c.Imported = false
+	c.PrivateTo = "" // set from the parent comment
+	c.Lang = ""      // detected on creation
+	c.PlainText = "" // made from the rendered text
+	c.NewMember = false
+	c.Late = false
+}
+
+// VisibleTo checks if comment can be seen by the user
+func (c *Comment) VisibleTo(user User) bool {
+	switch c.Visibility {
+	case VisibilityStaff:
+		return user.Admin
+	case VisibilityPrivate:
+		return user.Admin || (user.ID != "" && (user.ID == c.User.ID || user.ID == c.PrivateTo))
+	case VisibilityPending:
+		return user.Admin || (user.ID != "" && user.ID == c.User.ID)
+	}
+	return true
 }
 
 // SetDeleted clears comment info, reset to deleted state. hard flag will clear all user info as well
 func (c *Comment) SetDeleted(mode DeleteMode) {
 	c.Text = ""
 	c.Orig = ""
+	c.PlainText = ""
 	c.Score = 0
 	c.Controversy = 0
 	c.Votes = map[string]bool{}
 	c.VotedIPs = make(map[string]VotedIPInfo)
+	c.VoteWeights = nil
 	c.Edit = nil
 	c.Deleted = true
 	c.Pin = false
@@ -115,22 +158,38 @@ func (c *Comment) SetDeleted(mode DeleteMode) {
 	}
 }
 
-// Sanitize clean dangerous html/js from the comment.
-// Comment.Orig which is used to store the original comment text is not sanitized
-// as we expect to never render it as HTML and render Comment.Text instead
-func (c *Comment) Sanitize() {
-	p := bluemonday.UGCPolicy()
-	p.AllowAttrs("class").Matching(regexp.MustCompile("^chroma$")).OnElements("pre")
+// sanitizeAttrs are attributes allowed in comment html on top of bluemonday's UGC policy
+var sanitizeAttrs = []struct{ elem, attr, pattern string }{
+	{"pre", "class", "^chroma$"},
 	// special case for embedding the quotes from Twitter
-	p.AllowAttrs("class").Matching(regexp.MustCompile("^twitter-tweet$")).OnElements("blockquote")
+	{"blockquote", "class", "^twitter-tweet$"},
 	// this is list of <span> tag classes which could be produced by chroma code renderer
 	// source: https://github.com/alecthomas/chroma/blob/c263f6f/types.go#L209-L306
-	const codeSpanClassRegex = "^(bg|chroma|line|ln|lnt|hl|lntable|lntd|lnlinks|cl|w|err|x|k|kc" +
+	{"span", "class", "^(bg|chroma|line|ln|lnt|hl|lntable|lntd|lnlinks|cl|w|err|x|k|kc" +
 		"|kd|kn|kp|kr|kt|n|na|nb|bp|nc|no|nd|ni|ne|nf|fm|py|nl|nn|nx|nt|nv|vc|vg" +
 		"|vi|vm|l|ld|s|sa|sb|sc|dl|sd|s2|se|sh|si|sx|sr|s1|ss|m|mb|mf|mh|mi|il" +
-		"|mo|o|ow|p|c|ch|cm|cp|cpf|c1|cs|g|gd|ge|gr|gh|gi|go|gp|gs|gu|gt|gl)$"
-	p.AllowAttrs("class").Matching(regexp.MustCompile(codeSpanClassRegex)).OnElements("span")
-	p.AllowAttrs("loading").Matching(regexp.MustCompile("^(lazy|eager)$")).OnElements("img")
+		"|mo|o|ow|p|c|ch|cm|cp|cpf|c1|cs|g|gd|ge|gr|gh|gi|go|gp|gs|gu|gt|gl)$"},
+	{"img", "loading", "^(lazy|eager)$"},
+}
+
+// SanitizePolicyHash returns hash of the policy of Sanitize, changed with allowed attributes
+func SanitizePolicyHash() string {
+	h := sha256.New()
+	_, _ = h.Write([]byte("ugc\n"))
+	for _, a := range sanitizeAttrs {
+		_, _ = fmt.Fprintf(h, "%s %s %s\n", a.elem, a.attr, a.pattern)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)[:6])
+}
+
+// Sanitize clean dangerous html/js from the comment.
+// Comment.Orig which is used to store the original comment text is not sanitized
+// as we expect to never render it as HTML and render Comment.Text instead
+func (c *Comment) Sanitize() {
+	p := bluemonday.UGCPolicy()
+	for _, a := range sanitizeAttrs {
+		p.AllowAttrs(a.attr).Matching(regexp.MustCompile(a.pattern)).OnElements(a.elem)
+	}
 	c.Text = p.Sanitize(c.Text)
 	c.User.ID = template.HTMLEscapeString(c.User.ID)
 	c.User.Name = c.SanitizeText(c.User.Name)
@@ -124,6 +124,13 @@ func TestComment_PrepareUntrusted(t *testing.T) {
 		Votes:       map[string]bool{"uu": true},
 		Controversy: 123,
 		Imported:    true,
+		Visibility:  VisibilityPrivate,
+		PrivateTo:   "someone",
+		Lang:        "en",
+		PlainText:   "blah",
+		SelfDeleted: true,
+		NewMember:   true,
+		Late:        true,
 	}
 
 	comment.PrepareUntrusted()
@@ -134,11 +141,45 @@ func TestComment_PrepareUntrusted(t *testing.T) {
 	assert.Equal(t, false, comment.Pin)
 	assert.Equal(t, time.Time{}, comment.Timestamp)
 	assert.Equal(t, false, comment.Deleted)
+	assert.Equal(t, false, comment.SelfDeleted)
 	assert.Equal(t, make(map[string]bool), comment.Votes)
 	assert.Equal(t, make(map[string]VotedIPInfo), comment.VotedIPs)
 	assert.Equal(t, User{ID: "username"}, comment.User)
 	assert.Equal(t, 0., comment.Controversy)
 	assert.Equal(t, false, comment.Imported)
+	assert.Equal(t, VisibilityPrivate, comment.Visibility)
+	assert.Equal(t, "", comment.PrivateTo)
+	assert.Equal(t, "", comment.Lang)
+	assert.Equal(t, "", comment.PlainText)
+	assert.False(t, comment.NewMember)
+	assert.False(t, comment.Late)
+}
+
+func TestComment_VisibleTo(t *testing.T) {
+	tbl := []struct {
+		visibility string
+		user       User
+		visible    bool
+	}{
+		{"", User{}, true},
+		{"", User{ID: "u1"}, true},
+		{VisibilityStaff, User{}, false},
+		{VisibilityStaff, User{ID: "author"}, false},
+		{VisibilityStaff, User{ID: "a1", Admin: true}, true},
+		{VisibilityPrivate, User{}, false},
+		{VisibilityPrivate, User{ID: "u1"}, false},
+		{VisibilityPrivate, User{ID: "author"}, true},
+		{VisibilityPrivate, User{ID: "target"}, true},
+		{VisibilityPrivate, User{ID: "a1", Admin: true}, true},
+		{VisibilityPending, User{}, false},
+		{VisibilityPending, User{ID: "target"}, false},
+		{VisibilityPending, User{ID: "author"}, true},
+		{VisibilityPending, User{ID: "a1", Admin: true}, true},
+	}
+	for i, tt := range tbl {
+		c := Comment{User: User{ID: "author"}, Visibility: tt.visibility, PrivateTo: "target"}
+		assert.Equal(t, tt.visible, c.VisibleTo(tt.user), "case #%d", i)
+	}
 }
 
 func TestComment_SetDeleted(t *testing.T) {
@@ -153,12 +194,14 @@ func TestComment_SetDeleted(t *testing.T) {
 		Timestamp: time.Date(2018, 1, 1, 9, 30, 0, 0, time.UTC),
 		Votes:     map[string]bool{"uu": true},
 		Pin:       true,
+		PlainText: "blah",
 	}
 
 	comment.SetDeleted(SoftDelete)
 
 	assert.Equal(t, "", comment.Text)
 	assert.Equal(t, "", comment.Orig)
+	assert.Equal(t, "", comment.PlainText)
 	assert.Equal(t, map[string]bool{}, comment.Votes)
 	assert.Equal(t, map[string]VotedIPInfo{}, comment.VotedIPs)
 	assert.Equal(t, 0, comment.Score)
@@ -280,3 +323,9 @@ func TestComment_sanitizeText(t *testing.T) {
 		})
 	}
 }
+
+func TestSanitizePolicyHash(t *testing.T) {
+	h := SanitizePolicyHash()
+	assert.Regexp(t, `^[0-9a-f]{12}$`, h)
+	assert.Equal(t, h, SanitizePolicyHash())
+}
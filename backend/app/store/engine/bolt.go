@@ -40,6 +40,8 @@ const (
 	infoBucketName        = "info"
 	readonlyBucketName    = "readonly"
 	verifiedBucketName    = "verified"
+	adminsBucketName      = "admins"
+	moderatorsBucketName  = "moderators"
 
 	tsNano = "2006-01-02T15:04:05.000000000Z07:00"
 )
@@ -62,7 +64,7 @@ func NewBoltDB(options bolt.Options, sites ...BoltSite) (*BoltDB, error) {
 
 		// make top-level buckets
 		topBuckets := []string{postsBucketName, lastBucketName, userBucketName, userDetailsBucketName,
-			blocksBucketName, infoBucketName, readonlyBucketName, verifiedBucketName}
+			blocksBucketName, infoBucketName, readonlyBucketName, verifiedBucketName, adminsBucketName, moderatorsBucketName}
 		err = db.Update(func(tx *bolt.Tx) error {
 			for _, bktName := range topBuckets {
 				if _, e := tx.CreateBucketIfNotExists([]byte(bktName)); e != nil {
@@ -209,7 +211,8 @@ func (b *BoltDB) Flag(req FlagRequest) (val bool, err error) {
 // and all site's details listing under the same function (and not to extend interface by two separate functions).
 func (b *BoltDB) UserDetail(req UserDetailRequest) ([]UserDetailEntry, error) {
 	switch req.Detail {
-	case UserEmail, UserTelegram:
+	case UserEmail, UserTelegram, UserDisplayName, UserPronouns, UserIgnored, UserLevel, UserBlockReason, UserPasskeys,
+		UserTOTP, UserLinkedTo, UserNotBefore:
 		if req.UserID == "" {
 			return nil, fmt.Errorf("userid cannot be empty in request for single detail")
 		}
@@ -355,9 +358,12 @@ func (b *BoltDB) ListFlags(req FlagRequest) (res []any, err error) {
 
 	res = []any{}
 	switch req.Flag {
-	case Verified:
+	case Verified, Admin, Moderator:
 		err = bdb.View(func(tx *bolt.Tx) error {
-			usersBkt := tx.Bucket([]byte(verifiedBucketName))
+			usersBkt, e := b.flagBucket(tx, req.Flag)
+			if e != nil {
+				return e
+			}
 			_ = usersBkt.ForEach(func(k, _ []byte) error {
 				res = append(res, string(k))
 				return nil
@@ -403,6 +409,8 @@ func (b *BoltDB) Delete(req DeleteRequest) error {
 		return b.deleteUserDetail(bdb, req.UserID, req.UserDetail)
 	case req.Locator.URL != "" && req.CommentID != "" && req.UserDetail == "": // delete comment
 		return b.deleteComment(bdb, req.Locator, req.CommentID, req.DeleteMode)
+	case req.Locator.URL != "" && req.CommentID == "" && req.UserID == "" && req.UserDetail == "": // delete post
+		return b.deletePost(bdb, req.Locator)
 	case req.Locator.SiteID != "" && req.UserID != "" && req.CommentID == "" && req.UserDetail == "": // delete user
 		return b.deleteUser(bdb, req.Locator.SiteID, req.UserID, req.DeleteMode)
 	case req.Locator.SiteID != "" && req.Locator.URL == "" && req.CommentID == "" && req.UserID == "" && req.UserDetail == "": // delete site
@@ -412,6 +420,197 @@ func (b *BoltDB) Delete(req DeleteRequest) error {
 	return fmt.Errorf("invalid delete request %+v", req)
 }
 
+// Reindex rebuilds "last", "users" and "info" buckets from comments in "posts". The buckets are reset first
+// and rebuilt in a transaction per post, so writes are not blocked for the whole rebuild, while the indexes stay
+// partial until it is finished. Deleted comments are counted in post's time range and kept in user's references,
+// as on deletion. Posts with all comments deleted keep their info.
+func (b *BoltDB) Reindex(siteID string, progress func(done, total int)) error {
+	bdb, err := b.db(siteID)
+	if err != nil {
+		return err
+	}
+
+	urls := []string{}
+	err = bdb.Update(func(tx *bolt.Tx) error {
+		for _, bktName := range []string{lastBucketName, userBucketName, infoBucketName} {
+			if e := tx.DeleteBucket([]byte(bktName)); e != nil && !errors.Is(e, berrors.ErrBucketNotFound) {
+				return fmt.Errorf("failed to delete bucket %s: %w", bktName, e)
+			}
+			if _, e := tx.CreateBucket([]byte(bktName)); e != nil {
+				return fmt.Errorf("failed to create bucket %s: %w", bktName, e)
+			}
+		}
+		if e := tx.Bucket([]byte(postsBucketName)).ForEachBucket(func(k []byte) error {
+			urls = append(urls, string(k))
+			return nil
+		}); e != nil {
+			return fmt.Errorf("failed to list posts: %w", e)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for i, url := range urls {
+		if err = bdb.Update(func(tx *bolt.Tx) error { return b.reindexPost(tx, url) }); err != nil {
+			return fmt.Errorf("failed to reindex post %s: %w", url, err)
+		}
+		if progress != nil {
+			progress(i+1, len(urls))
+		}
+	}
+	return nil
+}
+
+// reindexPost puts references to post's comments into "last" and "users" buckets and sets post's info.
+// Post removed since the rebuild started is skipped.
+func (b *BoltDB) reindexPost(tx *bolt.Tx, url string) error {
+	postBkt := tx.Bucket([]byte(postsBucketName)).Bucket([]byte(url))
+	if postBkt == nil {
+		return nil
+	}
+	lastBkt, infoBkt := tx.Bucket([]byte(lastBucketName)), tx.Bucket([]byte(infoBucketName))
+	info := store.PostInfo{URL: url}
+	err := postBkt.ForEach(func(_, v []byte) error {
+		comment := store.Comment{}
+		if e := json.Unmarshal(v, &comment); e != nil {
+			return fmt.Errorf("failed to unmarshal: %w", e)
+		}
+		ref, commentTS := b.makeRef(comment), []byte(comment.Timestamp.Format(tsNano))
+		userBkt, e := b.getUserBucket(tx, comment.User.ID)
+		if e != nil {
+			return fmt.Errorf("can't get bucket %s: %w", comment.User.ID, e)
+		}
+		if e = userBkt.Put(commentTS, ref); e != nil {
+			return fmt.Errorf("failed to put user comment %s for %s: %w", comment.ID, comment.User.ID, e)
+		}
+		if info.FirstTS.IsZero() || comment.Timestamp.Before(info.FirstTS) {
+			info.FirstTS = comment.Timestamp
+		}
+		if comment.Timestamp.After(info.LastTS) {
+			info.LastTS = comment.Timestamp
+		}
+		if comment.Deleted {
+			return nil
+		}
+		info.Count++
+		if e = lastBkt.Put(commentTS, ref); e != nil {
+			return fmt.Errorf("can't put reference %s to %s: %w", ref, lastBucketName, e)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// info kept for every post, listing of the site's posts expects it
+	if err = b.save(infoBkt, url, &info); err != nil {
+		return fmt.Errorf("failed to set info for %s: %w", url, err)
+	}
+	return nil
+}
+
+// MergeUser re-attributes comments and votes of fromID user to toID user in a single transaction.
+// References to comments in "users" bucket moved to the bucket of toID user.
+func (b *BoltDB) MergeUser(siteID, fromID, toID string, update func(prev store.Comment, c *store.Comment)) (MergeResult, error) {
+	res := MergeResult{}
+	if fromID == "" || toID == "" || fromID == toID {
+		return res, fmt.Errorf("can't merge user %q to %q", fromID, toID)
+	}
+	bdb, err := b.db(siteID)
+	if err != nil {
+		return res, err
+	}
+
+	err = bdb.Update(func(tx *bolt.Tx) error {
+		postsBkt := tx.Bucket([]byte(postsBucketName))
+		urls := []string{}
+		if e := postsBkt.ForEachBucket(func(k []byte) error {
+			urls = append(urls, string(k))
+			return nil
+		}); e != nil {
+			return fmt.Errorf("failed to list posts: %w", e)
+		}
+
+		for _, url := range urls {
+			postBkt := postsBkt.Bucket([]byte(url))
+			changed := []store.Comment{}
+			err := postBkt.ForEach(func(_, v []byte) error {
+				prev, comment := store.Comment{}, store.Comment{}
+				if e := json.Unmarshal(v, &prev); e != nil {
+					return fmt.Errorf("failed to unmarshal: %w", e)
+				}
+				_ = json.Unmarshal(v, &comment) // separate copy of the maps, decoded successfully above
+				if !mergeComment(&comment, fromID, toID, &res) {
+					return nil
+				}
+				if update != nil {
+					update(prev, &comment)
+				}
+				changed = append(changed, comment)
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("failed to merge user in post %s: %w", url, err)
+			}
+			// bucket can't be modified inside ForEach, changed comments saved after it
+			for _, comment := range changed {
+				if e := b.save(postBkt, comment.ID, comment); e != nil {
+					return fmt.Errorf("failed to save comment %s: %w", comment.ID, e)
+				}
+			}
+		}
+
+		usersBkt := tx.Bucket([]byte(userBucketName))
+		fromBkt := usersBkt.Bucket([]byte(fromID))
+		if fromBkt == nil {
+			return nil
+		}
+		toBkt, e := b.getUserBucket(tx, toID)
+		if e != nil {
+			return fmt.Errorf("can't get bucket %s: %w", toID, e)
+		}
+		if e = fromBkt.ForEach(func(k, v []byte) error { return toBkt.Put(k, v) }); e != nil {
+			return fmt.Errorf("failed to move references of %s: %w", fromID, e)
+		}
+		if e = usersBkt.DeleteBucket([]byte(fromID)); e != nil {
+			return fmt.Errorf("failed to delete user bucket for %s: %w", fromID, e)
+		}
+		return nil
+	})
+	return res, err
+}
+
+// mergeComment changes author and vote of fromID user in the comment to toID user, returns true if the comment changed
+func mergeComment(comment *store.Comment, fromID, toID string, res *MergeResult) (changed bool) {
+	if comment.User.ID == fromID {
+		comment.User.ID = toID
+		res.Comments++
+		changed = true
+		if _, ok := comment.Votes[toID]; ok { // vote of the target user for the comment became the vote for own comment
+			delete(comment.Votes, toID)
+			delete(comment.VoteWeights, toID)
+			res.DroppedVotes++
+		}
+	}
+	if v, ok := comment.Votes[fromID]; ok {
+		weight, weighted := comment.VoteWeights[fromID]
+		delete(comment.Votes, fromID)
+		delete(comment.VoteWeights, fromID)
+		changed = true
+		if _, dup := comment.Votes[toID]; dup || comment.User.ID == toID {
+			res.DroppedVotes++
+			return changed
+		}
+		comment.Votes[toID] = v
+		if weighted {
+			comment.VoteWeights[toID] = weight
+		}
+		res.Votes++
+	}
+	return changed
+}
+
 // Close boltdb store
 func (b *BoltDB) Close() error {
 	var errs []error
@@ -632,6 +831,10 @@ func (b *BoltDB) flagBucket(tx *bolt.Tx, flag Flag) (bkt *bolt.Bucket, err error
 		bkt = tx.Bucket([]byte(blocksBucketName))
 	case Verified:
 		bkt = tx.Bucket([]byte(verifiedBucketName))
+	case Admin:
+		bkt = tx.Bucket([]byte(adminsBucketName))
+	case Moderator:
+		bkt = tx.Bucket([]byte(moderatorsBucketName))
 	default:
 		return nil, fmt.Errorf("unsupported flag %v", flag)
 	}
@@ -660,6 +863,24 @@ func (b *BoltDB) getUserDetail(req UserDetailRequest) (result []UserDetailEntry,
 				result = []UserDetailEntry{{UserID: req.UserID, Email: entry.Email}}
 			case UserTelegram:
 				result = []UserDetailEntry{{UserID: req.UserID, Telegram: entry.Telegram}}
+			case UserDisplayName:
+				result = []UserDetailEntry{{UserID: req.UserID, DisplayName: entry.DisplayName}}
+			case UserPronouns:
+				result = []UserDetailEntry{{UserID: req.UserID, Pronouns: entry.Pronouns}}
+			case UserIgnored:
+				result = []UserDetailEntry{{UserID: req.UserID, Ignored: entry.Ignored}}
+			case UserLevel:
+				result = []UserDetailEntry{{UserID: req.UserID, Level: entry.Level}}
+			case UserBlockReason:
+				result = []UserDetailEntry{{UserID: req.UserID, BlockReason: entry.BlockReason}}
+			case UserPasskeys:
+				result = []UserDetailEntry{{UserID: req.UserID, Passkeys: entry.Passkeys}}
+			case UserTOTP:
+				result = []UserDetailEntry{{UserID: req.UserID, TOTP: entry.TOTP}}
+			case UserLinkedTo:
+				result = []UserDetailEntry{{UserID: req.UserID, LinkedTo: entry.LinkedTo}}
+			case UserNotBefore:
+				result = []UserDetailEntry{{UserID: req.UserID, NotBefore: entry.NotBefore}}
 			}
 		}
 		return nil
@@ -702,6 +923,24 @@ func (b *BoltDB) setUserDetail(req UserDetailRequest) (result []UserDetailEntry,
 		entry.Email = req.Update
 	case UserTelegram:
 		entry.Telegram = req.Update
+	case UserDisplayName:
+		entry.DisplayName = req.Update
+	case UserPronouns:
+		entry.Pronouns = req.Update
+	case UserIgnored:
+		entry.Ignored = req.Update
+	case UserLevel:
+		entry.Level = req.Update
+	case UserBlockReason:
+		entry.BlockReason = req.Update
+	case UserPasskeys:
+		entry.Passkeys = req.Update
+	case UserTOTP:
+		entry.TOTP = req.Update
+	case UserLinkedTo:
+		entry.LinkedTo = req.Update
+	case UserNotBefore:
+		entry.NotBefore = req.Update
 	}
 
 	err = bdb.Update(func(tx *bolt.Tx) error {
@@ -723,9 +962,9 @@ func (b *BoltDB) listDetails(loc store.Locator) (result []UserDetailEntry, err e
 	}
 
 	err = bdb.View(func(tx *bolt.Tx) error {
-		var entry UserDetailEntry
 		bucket := tx.Bucket([]byte(userDetailsBucketName))
 		return bucket.ForEach(func(_, value []byte) error {
+			var entry UserDetailEntry // fresh entry each time, fields omitted in json must not leak from the previous one
 			if err = json.Unmarshal(value, &entry); err != nil {
 				return fmt.Errorf("failed to unmarshal entry: %w", e)
 			}
@@ -764,6 +1003,24 @@ func (b *BoltDB) deleteUserDetail(bdb *bolt.DB, userID string, userDetail UserDe
 		entry.Email = ""
 	case UserTelegram:
 		entry.Telegram = ""
+	case UserDisplayName:
+		entry.DisplayName = ""
+	case UserPronouns:
+		entry.Pronouns = ""
+	case UserIgnored:
+		entry.Ignored = ""
+	case UserLevel:
+		entry.Level = ""
+	case UserBlockReason:
+		entry.BlockReason = ""
+	case UserPasskeys:
+		entry.Passkeys = ""
+	case UserTOTP:
+		entry.TOTP = ""
+	case UserLinkedTo:
+		entry.LinkedTo = ""
+	case UserNotBefore:
+		entry.NotBefore = ""
 	case AllUserDetails:
 		entry = UserDetailEntry{UserID: userID}
 	}
@@ -825,6 +1082,49 @@ func (b *BoltDB) deleteComment(bdb *bolt.DB, locator store.Locator, commentID st
 	})
 }
 
+// deletePost removes post's bucket with all comments, references to them from last and user buckets,
+// and post's info and read-only status
+func (b *BoltDB) deletePost(bdb *bolt.DB, locator store.Locator) error {
+	return bdb.Update(func(tx *bolt.Tx) error {
+		postBkt, e := b.getPostBucket(tx, locator.URL)
+		if e != nil {
+			return e
+		}
+
+		lastBkt := tx.Bucket([]byte(lastBucketName))
+		usersBkt := tx.Bucket([]byte(userBucketName))
+		e = postBkt.ForEach(func(_, v []byte) error {
+			comment := store.Comment{}
+			if err := json.Unmarshal(v, &comment); err != nil {
+				return fmt.Errorf("failed to unmarshal: %w", err)
+			}
+			commentTS := []byte(comment.Timestamp.Format(tsNano))
+			if err := lastBkt.Delete(commentTS); err != nil {
+				return fmt.Errorf("can't delete key %s from bucket %s: %w", commentTS, lastBucketName, err)
+			}
+			if userBkt := usersBkt.Bucket([]byte(comment.User.ID)); userBkt != nil {
+				if err := userBkt.Delete(commentTS); err != nil {
+					return fmt.Errorf("can't delete key %s from bucket %s: %w", commentTS, comment.User.ID, err)
+				}
+			}
+			return nil
+		})
+		if e != nil {
+			return e
+		}
+
+		if e = tx.Bucket([]byte(postsBucketName)).DeleteBucket([]byte(locator.URL)); e != nil {
+			return fmt.Errorf("can't delete bucket %s: %w", locator.URL, e)
+		}
+		for _, bktName := range []string{infoBucketName, readonlyBucketName} {
+			if e = tx.Bucket([]byte(bktName)).Delete([]byte(locator.URL)); e != nil {
+				return fmt.Errorf("can't delete key %s from bucket %s: %w", locator.URL, bktName, e)
+			}
+		}
+		return nil
+	})
+}
+
 // deleteAll removes all top-level buckets for given siteID
 func (b *BoltDB) deleteAll(bdb *bolt.DB, siteID string) error {
 	// delete all buckets except blocked users
@@ -571,6 +571,40 @@ func TestBolt_FlagListVerified(t *testing.T) {
 	assert.Error(t, err, "site \"radio-t-bad\" not found", "fail on wrong site")
 }
 
+func TestBolt_FlagRoles(t *testing.T) {
+	b, teardown := prep(t)
+	defer teardown()
+
+	setRole := func(flag Flag, user string, status FlagStatus) {
+		_, err := b.Flag(FlagRequest{Flag: flag, Locator: store.Locator{SiteID: "radio-t"}, UserID: user, Update: status})
+		require.NoError(t, err)
+	}
+	listRole := func(flag Flag) []any {
+		ids, err := b.ListFlags(FlagRequest{Flag: flag, Locator: store.Locator{SiteID: "radio-t"}})
+		require.NoError(t, err)
+		return ids
+	}
+
+	assert.Empty(t, listRole(Admin))
+	assert.Empty(t, listRole(Moderator))
+
+	setRole(Admin, "u1", FlagTrue)
+	setRole(Moderator, "u2", FlagTrue)
+	setRole(Moderator, "u3", FlagTrue)
+	assert.Equal(t, []any{"u1"}, listRole(Admin))
+	assert.Equal(t, []any{"u2", "u3"}, listRole(Moderator))
+
+	v, err := b.Flag(FlagRequest{Flag: Moderator, Locator: store.Locator{SiteID: "radio-t"}, UserID: "u2"})
+	require.NoError(t, err)
+	assert.True(t, v)
+	v, err = b.Flag(FlagRequest{Flag: Admin, Locator: store.Locator{SiteID: "radio-t"}, UserID: "u2"})
+	require.NoError(t, err)
+	assert.False(t, v, "roles kept separately")
+
+	setRole(Moderator, "u2", FlagFalse)
+	assert.Equal(t, []any{"u3"}, listRole(Moderator))
+}
+
 func TestBolt_FlagListBlocked(t *testing.T) {
 	synctest.Test(t, func(t *testing.T) {
 		b, teardown := prep(t)
@@ -665,6 +699,110 @@ func TestBoltDB_UserDetail(t *testing.T) {
 		}
 		assert.ElementsMatch(t, x.expected, result, "Result should match expected for case %d", i)
 	}
+
+	// profile details stored along with the email
+	result, err = b.UserDetail(UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "u1", Detail: UserDisplayName, Update: "Nick"})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []UserDetailEntry{{UserID: "u1", Email: "test@example.com", DisplayName: "Nick"}}, result)
+	result, err = b.UserDetail(UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "u1", Detail: UserPronouns, Update: "they/them"})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []UserDetailEntry{{UserID: "u1", Email: "test@example.com", DisplayName: "Nick", Pronouns: "they/them"}}, result)
+	result, err = b.UserDetail(UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "u1", Detail: UserDisplayName})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []UserDetailEntry{{UserID: "u1", DisplayName: "Nick"}}, result)
+	result, err = b.UserDetail(UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "u1", Detail: UserPronouns})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []UserDetailEntry{{UserID: "u1", Pronouns: "they/them"}}, result)
+
+	result, err = b.UserDetail(UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "u2", Detail: UserIgnored, Update: "u1,u3"})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []UserDetailEntry{{UserID: "u2", Email: "other@example.com", Ignored: "u1,u3"}}, result)
+	result, err = b.UserDetail(UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "u2", Detail: UserIgnored})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []UserDetailEntry{{UserID: "u2", Ignored: "u1,u3"}}, result)
+
+	result, err = b.UserDetail(UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "u2", Detail: UserLevel, Update: "member"})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []UserDetailEntry{{UserID: "u2", Email: "other@example.com", Ignored: "u1,u3", Level: "member"}}, result)
+	result, err = b.UserDetail(UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "u2", Detail: UserLevel})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []UserDetailEntry{{UserID: "u2", Level: "member"}}, result)
+	err = b.Delete(DeleteRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "u2", UserDetail: UserLevel})
+	assert.NoError(t, err)
+	result, err = b.UserDetail(UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "u2", Detail: UserLevel})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []UserDetailEntry{{UserID: "u2"}}, result)
+
+	result, err = b.UserDetail(UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "u2", Detail: UserBlockReason, Update: "spam"})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []UserDetailEntry{{UserID: "u2", Email: "other@example.com", Ignored: "u1,u3", BlockReason: "spam"}}, result)
+	result, err = b.UserDetail(UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "u2", Detail: UserBlockReason})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []UserDetailEntry{{UserID: "u2", BlockReason: "spam"}}, result)
+	err = b.Delete(DeleteRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "u2", UserDetail: UserBlockReason})
+	assert.NoError(t, err)
+	result, err = b.UserDetail(UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "u2", Detail: UserBlockReason})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []UserDetailEntry{{UserID: "u2"}}, result)
+
+	result, err = b.UserDetail(UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "u2", Detail: UserPasskeys, Update: `{"name":"u2"}`})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []UserDetailEntry{{UserID: "u2", Email: "other@example.com", Ignored: "u1,u3", Passkeys: `{"name":"u2"}`}}, result)
+	result, err = b.UserDetail(UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "u2", Detail: UserPasskeys})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []UserDetailEntry{{UserID: "u2", Passkeys: `{"name":"u2"}`}}, result)
+	err = b.Delete(DeleteRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "u2", UserDetail: UserPasskeys})
+	assert.NoError(t, err)
+	result, err = b.UserDetail(UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "u2", Detail: UserPasskeys})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []UserDetailEntry{{UserID: "u2"}}, result)
+
+	_, err = b.UserDetail(UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "u2", Detail: UserTOTP, Update: `{"secret":"abc"}`})
+	assert.NoError(t, err)
+	result, err = b.UserDetail(UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "u2", Detail: UserTOTP})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []UserDetailEntry{{UserID: "u2", TOTP: `{"secret":"abc"}`}}, result)
+	err = b.Delete(DeleteRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "u2", UserDetail: UserTOTP})
+	assert.NoError(t, err)
+	result, err = b.UserDetail(UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "u2", Detail: UserTOTP})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []UserDetailEntry{{UserID: "u2"}}, result)
+
+	_, err = b.UserDetail(UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "u2", Detail: UserLinkedTo, Update: "u1"})
+	assert.NoError(t, err)
+	result, err = b.UserDetail(UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "u2", Detail: UserLinkedTo})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []UserDetailEntry{{UserID: "u2", LinkedTo: "u1"}}, result)
+	err = b.Delete(DeleteRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "u2", UserDetail: UserLinkedTo})
+	assert.NoError(t, err)
+	result, err = b.UserDetail(UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "u2", Detail: UserLinkedTo})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []UserDetailEntry{{UserID: "u2"}}, result)
+
+	_, err = b.UserDetail(UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "u2", Detail: UserNotBefore, Update: "2026-10-15T10:00:00Z"})
+	assert.NoError(t, err)
+	result, err = b.UserDetail(UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "u2", Detail: UserNotBefore})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []UserDetailEntry{{UserID: "u2", NotBefore: "2026-10-15T10:00:00Z"}}, result)
+	err = b.Delete(DeleteRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "u2", UserDetail: UserNotBefore})
+	assert.NoError(t, err)
+	result, err = b.UserDetail(UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "u2", Detail: UserNotBefore})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []UserDetailEntry{{UserID: "u2"}}, result)
+
+	err = b.Delete(DeleteRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "u1", UserDetail: UserDisplayName})
+	assert.NoError(t, err)
+	result, err = b.UserDetail(UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "u1", Detail: UserDisplayName})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []UserDetailEntry{{UserID: "u1"}}, result)
+
+	// details of one user don't leak into the next one in the list
+	_, err = b.UserDetail(UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "u3", Detail: UserTelegram, Update: "tg3"})
+	require.NoError(t, err)
+	result, err = b.UserDetail(UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, Detail: AllUserDetails})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []UserDetailEntry{{UserID: "u1", Email: "test@example.com", Pronouns: "they/them"},
+		{UserID: "u2", Email: "other@example.com", Ignored: "u1,u3"}, {UserID: "u3", Telegram: "tg3"}}, result)
 }
 
 func TestBolt_DeleteComment(t *testing.T) {
@@ -744,6 +882,42 @@ func TestBolt_DeleteHard(t *testing.T) {
 	assert.Equal(t, store.User{Name: "deleted", ID: "deleted", Picture: "", Admin: false, Blocked: false, IP: ""}, res[0].User)
 }
 
+func TestBolt_DeletePost(t *testing.T) {
+	b, teardown := prep(t)
+	defer teardown()
+
+	other := store.Comment{ID: "id-3", Text: "other post", Timestamp: time.Date(2017, 12, 20, 15, 18, 24, 0, time.UTC),
+		Locator: store.Locator{URL: "https://radio-t.com/2", SiteID: "radio-t"}, User: store.User{ID: "user1", Name: "user name"}}
+	_, err := b.Create(other)
+	require.NoError(t, err)
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	_, err = b.Flag(FlagRequest{Flag: ReadOnly, Locator: locator, Update: FlagTrue})
+	require.NoError(t, err)
+
+	require.NoError(t, b.Delete(DeleteRequest{Locator: locator}))
+
+	_, err = b.Find(FindRequest{Locator: locator, Sort: "time"})
+	require.Error(t, err, "post removed")
+	_, err = b.Info(InfoRequest{Locator: locator})
+	require.Error(t, err, "post info removed")
+	assert.False(t, b.checkFlag(FlagRequest{Flag: ReadOnly, Locator: locator}), "read-only status removed")
+
+	last, err := b.Find(FindRequest{Locator: store.Locator{SiteID: "radio-t"}, Sort: "-time", Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, last, 1, "removed from last comments")
+	assert.Equal(t, "id-3", last[0].ID)
+	user, err := b.Find(FindRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "user1", Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, user, 1, "removed from user comments")
+	assert.Equal(t, "id-3", user[0].ID)
+
+	_, err = b.Create(store.Comment{ID: "id-1", Text: "new", Timestamp: time.Now(), Locator: locator,
+		User: store.User{ID: "user2"}})
+	require.NoError(t, err, "post can be made again")
+
+	assert.Error(t, b.Delete(DeleteRequest{Locator: store.Locator{URL: "https://radio-t.com/unknown", SiteID: "radio-t"}}))
+}
+
 func TestBolt_DeleteAll(t *testing.T) {
 	b, teardown := prep(t)
 	defer teardown()
@@ -945,6 +1119,165 @@ func TestBoltAdmin_DeleteUserSoft(t *testing.T) {
 	assert.EqualError(t, err, `site "radio-t-bad" not found`)
 }
 
+func TestBoltDB_Reindex(t *testing.T) {
+	b, teardown := prep(t)
+	defer teardown()
+
+	c := store.Comment{ID: "id-3", Text: "other post", Timestamp: time.Date(2017, 12, 21, 10, 0, 0, 0, time.UTC),
+		Locator: store.Locator{URL: "https://radio-t.com/2", SiteID: "radio-t"}, User: store.User{ID: "user2", Name: "user2"}}
+	_, err := b.Create(c)
+	require.NoError(t, err)
+	require.NoError(t, b.Delete(DeleteRequest{Locator: store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"},
+		CommentID: "id-2", DeleteMode: store.SoftDelete}))
+
+	infoBefore, err := b.Info(InfoRequest{Locator: store.Locator{SiteID: "radio-t"}})
+	require.NoError(t, err)
+	lastBefore, err := b.Find(FindRequest{Locator: store.Locator{SiteID: "radio-t"}, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, lastBefore, 2)
+
+	// break derived indexes
+	bdb, err := b.db("radio-t")
+	require.NoError(t, err)
+	err = bdb.Update(func(tx *bolt.Tx) error {
+		if e := tx.DeleteBucket([]byte(lastBucketName)); e != nil {
+			return e
+		}
+		if _, e := tx.CreateBucket([]byte(lastBucketName)); e != nil {
+			return e
+		}
+		if e := tx.Bucket([]byte(userBucketName)).DeleteBucket([]byte("user2")); e != nil {
+			return e
+		}
+		return b.save(tx.Bucket([]byte(infoBucketName)), "https://radio-t.com", store.PostInfo{URL: "https://radio-t.com", Count: 42})
+	})
+	require.NoError(t, err)
+	last, err := b.Find(FindRequest{Locator: store.Locator{SiteID: "radio-t"}, Limit: 10})
+	require.NoError(t, err)
+	assert.Empty(t, last)
+
+	progress := [][2]int{}
+	require.NoError(t, b.Reindex("radio-t", func(done, total int) { progress = append(progress, [2]int{done, total}) }))
+	assert.Equal(t, [][2]int{{1, 2}, {2, 2}}, progress)
+
+	info, err := b.Info(InfoRequest{Locator: store.Locator{SiteID: "radio-t"}})
+	require.NoError(t, err)
+	assert.Equal(t, infoBefore, info)
+	assert.Equal(t, 1, info[1].Count, "deleted comment not counted")
+	last, err = b.Find(FindRequest{Locator: store.Locator{SiteID: "radio-t"}, Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, lastBefore, last)
+	count, err := b.Count(FindRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "user2"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, count, "user's references restored")
+
+	assert.EqualError(t, b.Reindex("bad", nil), `site "bad" not found`)
+}
+
+func TestBoltDB_ReindexDeletedPost(t *testing.T) {
+	b, teardown := prep(t)
+	defer teardown()
+	loc := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	for _, id := range []string{"id-1", "id-2"} {
+		require.NoError(t, b.Delete(DeleteRequest{Locator: loc, CommentID: id, DeleteMode: store.HardDelete}))
+	}
+	bdb, err := b.db("radio-t")
+	require.NoError(t, err)
+	require.NoError(t, bdb.Update(func(tx *bolt.Tx) error { // post without comments
+		_, e := tx.Bucket([]byte(postsBucketName)).CreateBucket([]byte("https://radio-t.com/empty"))
+		return e
+	}))
+
+	require.NoError(t, b.Reindex("radio-t", nil))
+	info, err := b.Info(InfoRequest{Locator: store.Locator{SiteID: "radio-t"}})
+	require.NoError(t, err, "all posts have info")
+	require.Len(t, info, 2)
+	assert.Equal(t, store.PostInfo{URL: "https://radio-t.com/empty"}, info[0])
+	assert.Equal(t, "https://radio-t.com", info[1].URL)
+	assert.Equal(t, 0, info[1].Count, "deleted comments not counted")
+	assert.False(t, info[1].FirstTS.IsZero(), "time range kept")
+	last, err := b.Find(FindRequest{Locator: store.Locator{SiteID: "radio-t"}, Limit: 10})
+	require.NoError(t, err)
+	assert.Empty(t, last)
+}
+
+func TestBoltDB_MergeUser(t *testing.T) {
+	b, teardown := prep(t)
+	defer teardown()
+
+	loc := store.Locator{URL: "https://radio-t.com/2", SiteID: "radio-t"}
+	_, err := b.Create(store.Comment{ID: "id-3", Text: "other post", Timestamp: time.Date(2017, 12, 21, 10, 0, 0, 0, time.UTC),
+		Locator: loc, User: store.User{ID: "user2", Name: "user2"}})
+	require.NoError(t, err)
+	_, err = b.Create(store.Comment{ID: "id-4", Text: "third user", Timestamp: time.Date(2017, 12, 21, 11, 0, 0, 0, time.UTC),
+		Locator: loc, User: store.User{ID: "user3", Name: "user3"}})
+	require.NoError(t, err)
+
+	// user1 voted for comment of user2, both user1 and user2 voted for comment of user3
+	c3, err := b.Get(getReq(loc, "id-3"))
+	require.NoError(t, err)
+	c3.Votes, c3.VoteWeights, c3.Score = map[string]bool{"user1": true}, map[string]float64{"user1": 2}, 2
+	require.NoError(t, b.Update(c3))
+	c4, err := b.Get(getReq(loc, "id-4"))
+	require.NoError(t, err)
+	c4.Votes, c4.Score = map[string]bool{"user1": false, "user2": false}, -2
+	require.NoError(t, b.Update(c4))
+	// user2 voted for comment of user1
+	c2, err := b.Get(getReq(store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}, "id-2"))
+	require.NoError(t, err)
+	require.Equal(t, "user1", c2.User.ID)
+	c2.Votes, c2.VoteWeights, c2.Score = map[string]bool{"user2": true}, map[string]float64{"user2": 1.5}, 1
+	require.NoError(t, b.Update(c2))
+
+	updated := map[string]int{}
+	res, err := b.MergeUser("radio-t", "user1", "user2", func(prev store.Comment, c *store.Comment) {
+		updated[c.ID] = len(prev.Votes) - len(c.Votes)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, MergeResult{Comments: 2, Votes: 0, DroppedVotes: 3}, res)
+	assert.Equal(t, map[string]int{"id-1": 0, "id-2": 1, "id-3": 1, "id-4": 1}, updated)
+
+	c, err := b.Get(getReq(store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}, "id-1"))
+	require.NoError(t, err)
+	assert.Equal(t, "user2", c.User.ID)
+	assert.Equal(t, "user name", c.User.Name, "name kept as it was")
+	c, err = b.Get(getReq(store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}, "id-2"))
+	require.NoError(t, err)
+	assert.Equal(t, "user2", c.User.ID)
+	assert.Empty(t, c.Votes, "target's vote for now own comment dropped")
+	assert.Empty(t, c.VoteWeights)
+	c, err = b.Get(getReq(loc, "id-3"))
+	require.NoError(t, err)
+	assert.Empty(t, c.Votes, "vote for own comment dropped")
+	assert.Empty(t, c.VoteWeights)
+	c, err = b.Get(getReq(loc, "id-4"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"user2": false}, c.Votes, "duplicate vote dropped")
+
+	count, err := b.Count(FindRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "user2"})
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+	_, err = b.Count(FindRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "user1"})
+	assert.Error(t, err, "references of merged user removed")
+
+	// vote moved to the user without own vote
+	res, err = b.MergeUser("radio-t", "user3", "user4", nil)
+	require.NoError(t, err)
+	assert.Equal(t, MergeResult{Comments: 1}, res)
+	res, err = b.MergeUser("radio-t", "user2", "user5", nil)
+	require.NoError(t, err)
+	assert.Equal(t, MergeResult{Comments: 3, Votes: 1}, res)
+	c, err = b.Get(getReq(loc, "id-4"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"user5": false}, c.Votes)
+	assert.Equal(t, "user4", c.User.ID)
+
+	_, err = b.MergeUser("radio-t", "user1", "user1", nil)
+	assert.EqualError(t, err, `can't merge user "user1" to "user1"`)
+	_, err = b.MergeUser("bad", "user1", "user2", nil)
+	assert.EqualError(t, err, `site "bad" not found`)
+}
+
 func TestBoltDB_ref(t *testing.T) {
 	b := BoltDB{}
 	comment := store.Comment{
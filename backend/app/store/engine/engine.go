@@ -39,6 +39,27 @@ type Interface interface {
 	Close() error // close storage engine
 }
 
+// Reindexer is implemented by engines able to rebuild derived indexes, like last comments, user's comments
+// and post counters, from the stored comments. Progress called with number of processed and total posts.
+type Reindexer interface {
+	Reindex(siteID string, progress func(done, total int)) error
+}
+
+// UserMerger is implemented by engines able to re-attribute all comments and votes of one user to another one,
+// in a single transaction. Vote of the source user is dropped if the target user voted for the same comment as well,
+// or if the comment is the target user's own. Update func, if set, called for each changed comment before it is saved,
+// with the comment as it was before the merge, i.e. to recalculate the score.
+type UserMerger interface {
+	MergeUser(siteID, fromID, toID string, update func(prev store.Comment, c *store.Comment)) (MergeResult, error)
+}
+
+// MergeResult is the number of re-attributed comments and votes of the merged user
+type MergeResult struct {
+	Comments     int `json:"comments"`
+	Votes        int `json:"votes"`
+	DroppedVotes int `json:"dropped_votes"`
+}
+
 // GetRequest is the input for Get func
 type GetRequest struct {
 	Locator   store.Locator `json:"locator"`
@@ -87,9 +108,11 @@ const (
 
 // Enum of all flags
 const (
-	ReadOnly = Flag("readonly")
-	Verified = Flag("verified")
-	Blocked  = Flag("blocked")
+	ReadOnly  = Flag("readonly")
+	Verified  = Flag("verified")
+	Blocked   = Flag("blocked")
+	Admin     = Flag("admin")     // admin role of the user on the site
+	Moderator = Flag("moderator") // moderator role of the user on the site
 )
 
 // All possible user details
@@ -98,6 +121,24 @@ const (
 	UserEmail = UserDetail("email")
 	// UserTelegram is a user telegram
 	UserTelegram = UserDetail("telegram")
+	// UserDisplayName is a user-selected display name, overrides provider-supplied one
+	UserDisplayName = UserDetail("display_name")
+	// UserPronouns is a user-selected pronouns
+	UserPronouns = UserDetail("pronouns")
+	// UserIgnored is a comma-separated list of user ids ignored by the user
+	UserIgnored = UserDetail("ignored")
+	// UserLevel is a trust level the user promoted to automatically
+	UserLevel = UserDetail("level")
+	// UserBlockReason is admin's note why the user is blocked
+	UserBlockReason = UserDetail("block_reason")
+	// UserPasskeys is a json of the user's webauthn credentials
+	UserPasskeys = UserDetail("passkeys")
+	// UserTOTP is a json of the user's TOTP second factor
+	UserTOTP = UserDetail("totp")
+	// UserLinkedTo is an id of the canonical user this user id is linked to
+	UserLinkedTo = UserDetail("linked_to")
+	// UserNotBefore is a time in RFC3339, tokens of the user issued before it are revoked
+	UserNotBefore = UserDetail("not_before")
 	// AllUserDetails used for listing and deletion requests
 	AllUserDetails = UserDetail("all")
 )
@@ -116,9 +157,18 @@ type UserDetail string
 
 // UserDetailEntry contains single user details entry
 type UserDetailEntry struct {
-	UserID   string `json:"user_id"`            // duplicate user's id to use this structure not only embedded but separately
-	Email    string `json:"email,omitempty"`    // UserEmail
-	Telegram string `json:"telegram,omitempty"` // UserTelegram
+	UserID      string `json:"user_id"`                // duplicate user's id to use this structure not only embedded but separately
+	Email       string `json:"email,omitempty"`        // UserEmail
+	Telegram    string `json:"telegram,omitempty"`     // UserTelegram
+	DisplayName string `json:"display_name,omitempty"` // UserDisplayName
+	Pronouns    string `json:"pronouns,omitempty"`     // UserPronouns
+	Ignored     string `json:"ignored,omitempty"`      // UserIgnored
+	Level       string `json:"level,omitempty"`        // UserLevel
+	BlockReason string `json:"block_reason,omitempty"` // UserBlockReason
+	Passkeys    string `json:"passkeys,omitempty"`     // UserPasskeys
+	TOTP        string `json:"totp,omitempty"`         // UserTOTP
+	LinkedTo    string `json:"linked_to,omitempty"`    // UserLinkedTo
+	NotBefore   string `json:"not_before,omitempty"`   // UserNotBefore
 }
 
 // UserDetailRequest is the input for both get/set for details, like email
@@ -0,0 +1,154 @@
+package event
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Bolt implements Store with events kept in bolt DB, in a bucket per site keyed by big-endian ID
+type Bolt struct {
+	fileName string
+	db       *bolt.DB
+}
+
+// NewBoltStorage makes bolt event store
+func NewBoltStorage(fileName string, options bolt.Options) (*Bolt, error) {
+	db, err := bolt.Open(fileName, 0o600, &options) //nolint:gocritic //octalLiteral is OK as FileMode
+	if err != nil {
+		return nil, fmt.Errorf("failed to make boltdb for %s: %w", fileName, err)
+	}
+	return &Bolt{db: db, fileName: fileName}, nil
+}
+
+// Append adds the event to the site's journal, ID is the next sequence of the site's bucket
+func (b *Bolt) Append(e Event) (Event, error) {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bkt, err := tx.CreateBucketIfNotExists([]byte(e.SiteID))
+		if err != nil {
+			return fmt.Errorf("failed to create bucket %s: %w", e.SiteID, err)
+		}
+		if e.ID, err = bkt.NextSequence(); err != nil {
+			return fmt.Errorf("failed to get next id in %s: %w", e.SiteID, err)
+		}
+		data, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("failed to marshal event %s: %w", e.Type, err)
+		}
+		return bkt.Put(itob(e.ID), data)
+	})
+	if err != nil {
+		return Event{}, err
+	}
+	return e, nil
+}
+
+// List returns site's events with ID greater than after, oldest first, up to limit
+func (b *Bolt) List(siteID string, after uint64, limit int) ([]Event, error) {
+	res := []Event{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(siteID))
+		if bkt == nil {
+			return nil
+		}
+		c := bkt.Cursor()
+		for k, v := c.Seek(itob(after + 1)); k != nil && len(res) < limit; k, v = c.Next() {
+			e := Event{}
+			if err := json.Unmarshal(v, &e); err != nil {
+				return fmt.Errorf("failed to unmarshal event %d: %w", binary.BigEndian.Uint64(k), err)
+			}
+			res = append(res, e)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// DeleteUser removes site's events of the user
+func (b *Bolt) DeleteUser(siteID, userID string) (int, error) {
+	count := 0
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(siteID))
+		if bkt == nil {
+			return nil
+		}
+		keys := [][]byte{}
+		err := bkt.ForEach(func(k, v []byte) error {
+			e := Event{}
+			if err := json.Unmarshal(v, &e); err != nil {
+				return fmt.Errorf("failed to unmarshal event %d: %w", binary.BigEndian.Uint64(k), err)
+			}
+			if e.UserID == userID {
+				keys = append(keys, append([]byte{}, k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		count = len(keys)
+		return deleteKeys(bkt, keys)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// Cleanup removes events made before the time. Events are appended in time order, so the scan of the site's
+// journal stops on the first newer event.
+func (b *Bolt) Cleanup(before time.Time) (int, error) {
+	count := 0
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, bkt *bolt.Bucket) error {
+			keys := [][]byte{}
+			c := bkt.Cursor()
+			for k, v := c.First(); k != nil; k, v = c.Next() {
+				e := Event{}
+				if err := json.Unmarshal(v, &e); err != nil {
+					return fmt.Errorf("failed to unmarshal event %d of %s: %w", binary.BigEndian.Uint64(k), name, err)
+				}
+				if !e.Timestamp.Before(before) {
+					break
+				}
+				keys = append(keys, append([]byte{}, k...))
+			}
+			count += len(keys)
+			return deleteKeys(bkt, keys)
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// Close bolt store
+func (b *Bolt) Close() error {
+	if err := b.db.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", b.fileName, err)
+	}
+	return nil
+}
+
+// deleteKeys removes events by keys collected beforehand, as deletion under the cursor skips the next key
+func deleteKeys(bkt *bolt.Bucket, keys [][]byte) error {
+	for _, k := range keys {
+		if err := bkt.Delete(k); err != nil {
+			return fmt.Errorf("failed to delete event %d: %w", binary.BigEndian.Uint64(k), err)
+		}
+	}
+	return nil
+}
+
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
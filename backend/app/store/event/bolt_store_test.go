@@ -0,0 +1,130 @@
+package event
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestBolt_Events(t *testing.T) {
+	svc, teardown := prepareBoltEventStorageTest(t)
+	defer teardown()
+	ts := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	res, err := svc.List("site1", 0, 10)
+	require.NoError(t, err)
+	assert.Empty(t, res)
+
+	for i := range 5 {
+		e, err := svc.Append(Event{Type: CommentCreated, SiteID: "site1", CommentID: "c" + string(rune('1'+i)), Timestamp: ts})
+		require.NoError(t, err)
+		assert.Equal(t, uint64(i+1), e.ID)
+	}
+	e, err := svc.Append(Event{Type: CommentVoted, SiteID: "site2", CommentID: "c1", UserID: "u1",
+		Data: map[string]any{"value": true}, Timestamp: ts})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), e.ID, "separate sequence per site")
+
+	res, err = svc.List("site1", 0, 3)
+	require.NoError(t, err)
+	require.Len(t, res, 3)
+	assert.Equal(t, []uint64{1, 2, 3}, []uint64{res[0].ID, res[1].ID, res[2].ID}, "oldest first")
+	assert.Equal(t, "c1", res[0].CommentID)
+
+	res, err = svc.List("site1", 3, 10)
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	assert.Equal(t, uint64(4), res[0].ID)
+	assert.Equal(t, "c5", res[1].CommentID)
+
+	res, err = svc.List("site1", 5, 10)
+	require.NoError(t, err)
+	assert.Empty(t, res, "nothing after the last one")
+
+	res, err = svc.List("site2", 0, 10)
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	assert.Equal(t, Event{ID: 1, Type: CommentVoted, SiteID: "site2", CommentID: "c1", UserID: "u1",
+		Data: map[string]any{"value": true}, Timestamp: ts}, res[0])
+
+	res, err = svc.List("site3", 0, 10)
+	require.NoError(t, err)
+	assert.Empty(t, res, "unknown site")
+}
+
+func TestBolt_DeleteUser(t *testing.T) {
+	svc, teardown := prepareBoltEventStorageTest(t)
+	defer teardown()
+	ts := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, u := range []string{"u1", "u2", "u1", "u1", "u3"} {
+		_, err := svc.Append(Event{Type: CommentCreated, SiteID: "site1", UserID: u, Timestamp: ts})
+		require.NoError(t, err)
+	}
+	_, err := svc.Append(Event{Type: CommentCreated, SiteID: "site2", UserID: "u1", Timestamp: ts})
+	require.NoError(t, err)
+
+	removed, err := svc.DeleteUser("site1", "u1")
+	require.NoError(t, err)
+	assert.Equal(t, 3, removed)
+	res, err := svc.List("site1", 0, 10)
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	assert.Equal(t, []uint64{2, 5}, []uint64{res[0].ID, res[1].ID})
+	res, err = svc.List("site2", 0, 10)
+	require.NoError(t, err)
+	assert.Len(t, res, 1, "other site kept")
+
+	e, err := svc.Append(Event{Type: UserDeleted, SiteID: "site1", UserID: "u1", Timestamp: ts})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(6), e.ID, "ids not reused")
+
+	removed, err = svc.DeleteUser("site3", "u1")
+	require.NoError(t, err)
+	assert.Zero(t, removed, "unknown site")
+}
+
+func TestBolt_Cleanup(t *testing.T) {
+	svc, teardown := prepareBoltEventStorageTest(t)
+	defer teardown()
+	ts := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for i := range 5 {
+		_, err := svc.Append(Event{Type: CommentCreated, SiteID: "site1", Timestamp: ts.Add(time.Duration(i) * time.Hour)})
+		require.NoError(t, err)
+	}
+	_, err := svc.Append(Event{Type: CommentCreated, SiteID: "site2", Timestamp: ts})
+	require.NoError(t, err)
+
+	removed, err := svc.Cleanup(ts.Add(3 * time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 4, removed)
+	res, err := svc.List("site1", 0, 10)
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	assert.Equal(t, []uint64{4, 5}, []uint64{res[0].ID, res[1].ID})
+	res, err = svc.List("site2", 0, 10)
+	require.NoError(t, err)
+	assert.Empty(t, res)
+
+	removed, err = svc.Cleanup(ts)
+	require.NoError(t, err)
+	assert.Zero(t, removed)
+}
+
+func prepareBoltEventStorageTest(t *testing.T) (svc *Bolt, teardown func()) {
+	loc, err := os.MkdirTemp("", "test_event_r42")
+	require.NoError(t, err, "failed to make temp dir")
+	svc, err = NewBoltStorage(path.Join(loc, "events.db"), bolt.Options{})
+	require.NoError(t, err, "new bolt storage")
+	teardown = func() {
+		assert.NoError(t, svc.Close())
+		assert.NoError(t, os.RemoveAll(loc))
+	}
+	return svc, teardown
+}
@@ -0,0 +1,50 @@
+// Package event provides append-only journal of domain events, like comment lifecycle, votes and moderation,
+// for external analytics and rebuilding projections.
+package event
+
+import (
+	"time"
+)
+
+// Event types
+const (
+	CommentCreated  = "comment.created"
+	CommentUpdated  = "comment.updated"
+	CommentDeleted  = "comment.deleted"
+	CommentApproved = "comment.approved"
+	CommentPinned   = "comment.pinned"
+	CommentVoted    = "comment.voted"
+	CommentImported = "comment.imported"
+	UserBlocked     = "user.blocked"
+	UserVerified    = "user.verified"
+	UserDeleted     = "user.deleted"
+	UserRole        = "user.role"
+	UserMerged      = "user.merged"
+	PostReadOnly    = "post.read_only"
+	PostArchived    = "post.archived"
+)
+
+// Event is a domain event of the site. Data keeps type specific details, like vote's value or block's ttl.
+type Event struct {
+	ID        uint64         `json:"id"` // sequence number of the event on the site, increasing, gaps left by removed events
+	Type      string         `json:"type"`
+	SiteID    string         `json:"site"`
+	URL       string         `json:"url,omitempty"`
+	CommentID string         `json:"comment_id,omitempty"`
+	UserID    string         `json:"user_id,omitempty"` // subject of the event, like author, voter or blocked user
+	Data      map[string]any `json:"data,omitempty"`
+	Timestamp time.Time      `json:"time"`
+}
+
+// Store defines interface to keep events
+type Store interface {
+	// Append adds the event to the site's journal and returns it with assigned ID
+	Append(e Event) (Event, error)
+	// List returns site's events with ID greater than after, oldest first, up to limit
+	List(siteID string, after uint64, limit int) ([]Event, error)
+	// DeleteUser removes site's events of the user and returns number of removed events
+	DeleteUser(siteID, userID string) (int, error)
+	// Cleanup removes events of all sites made before the time and returns number of removed events
+	Cleanup(before time.Time) (int, error)
+	Close() error
+}
@@ -1,15 +1,23 @@
 package store
 
 import (
+	"crypto/sha256"
+	"fmt"
 	"net/url"
+	"regexp"
 	"strings"
 
 	"github.com/Depado/bfchroma/v2"
 	"github.com/PuerkitoBio/goquery"
 	"github.com/alecthomas/chroma/v2/formatters/html"
 	bf "github.com/russross/blackfriday/v2"
+	xhtml "golang.org/x/net/html"
 )
 
+// FormatterVersion is the version of markdown rendering. Increase it on any change of rendered html, like new
+// markdown extensions, so comments stored with html of the previous version are re-rendered.
+const FormatterVersion = 1
+
 // CommentFormatter implements all generic formatting ops on comment
 type CommentFormatter struct {
 	converters []CommentConverter
@@ -21,6 +29,12 @@ type CommentConverter interface {
 	Convert(text string) string
 }
 
+// CommentConverterKey is implemented by converters with output depending on their options, like image proxy.
+// The key is a part of RenderKey, so comments are re-rendered after change of the options.
+type CommentConverterKey interface {
+	Key() string
+}
+
 // CommentConverterFunc functional struct implementing CommentConverter
 type CommentConverterFunc func(text string) string
 
@@ -34,12 +48,109 @@ func NewCommentFormatter(converters ...CommentConverter) *CommentFormatter {
 	return &CommentFormatter{converters: converters}
 }
 
-// Format comment fields
+// Format comment fields, RenderKey set to the key of the formatter
 func (f *CommentFormatter) Format(c Comment, raw bool) Comment {
 	c.Text = f.FormatText(c.Text, raw)
+	c.PlainText = PlainText(c.Text)
+	c.RenderKey = f.RenderKey(raw)
 	return c
 }
 
+// RenderKey returns key of the rendering: formatter version, sanitizer policy, raw mode and converters.
+// Comments rendered with another key are outdated and have to be rendered again from the original markdown.
+func (f *CommentFormatter) RenderKey(raw bool) string {
+	h := sha256.New()
+	_, _ = fmt.Fprintf(h, "sanitizer:%s\nraw:%v\n", SanitizePolicyHash(), raw)
+	for _, conv := range f.converters {
+		if k, ok := conv.(CommentConverterKey); ok {
+			_, _ = fmt.Fprintf(h, "converter:%s\n", k.Key())
+			continue
+		}
+		_, _ = fmt.Fprintf(h, "converter:%T\n", conv)
+	}
+	return fmt.Sprintf("%d-%x", FormatterVersion, h.Sum(nil)[:6])
+}
+
+// PlainText makes plain text version of the comment HTML, for screen readers, notifications and indexing.
+// Markup and scripts dropped, paragraphs and line breaks kept as new lines, images replaced by their alt text.
+func PlainText(commentHTML string) string {
+	doc, err := xhtml.Parse(strings.NewReader(commentHTML))
+	if err != nil {
+		return ""
+	}
+
+	var sb strings.Builder
+	var walk func(n *xhtml.Node, pre bool)
+	walk = func(n *xhtml.Node, pre bool) {
+		switch n.Type {
+		case xhtml.TextNode:
+			if pre {
+				sb.WriteString(n.Data)
+				return
+			}
+			sb.WriteString(plainTextSpaces.ReplaceAllString(n.Data, " ")) // html collapses whitespace
+			return
+		case xhtml.ElementNode:
+			switch n.Data {
+			case "script", "style", "iframe", "object", "embed", "noscript", "template":
+				return
+			case "br":
+				if !lastInBlock(n) { // trailing line break doesn't make a new line
+					sb.WriteString("\n")
+				}
+				return
+			case "img":
+				for _, a := range n.Attr {
+					if a.Key == "alt" && strings.TrimSpace(a.Val) != "" {
+						sb.WriteString("[" + strings.TrimSpace(a.Val) + "]")
+					}
+				}
+				return
+			case "li":
+				sb.WriteString("\n- ")
+			case "td", "th":
+				sb.WriteString(" ")
+			case "pre":
+				pre = true
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c, pre)
+		}
+		if n.Type == xhtml.ElementNode && plainTextBlocks[n.Data] {
+			sb.WriteString("\n\n")
+		}
+	}
+	walk(doc, false)
+
+	// trim lines and drop repeated empty lines
+	lines := []string{}
+	for _, line := range strings.Split(sb.String(), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" && (len(lines) == 0 || lines[len(lines)-1] == "") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// lastInBlock checks if node followed by whitespace only within its parent
+func lastInBlock(n *xhtml.Node) bool {
+	for next := n.NextSibling; next != nil; next = next.NextSibling {
+		if next.Type != xhtml.TextNode || strings.TrimSpace(next.Data) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+var plainTextSpaces = regexp.MustCompile(`\s+`)
+
+// plainTextBlocks are html elements separated by empty line in plain text
+var plainTextBlocks = map[string]bool{"p": true, "div": true, "pre": true, "blockquote": true, "ul": true, "ol": true,
+	"table": true, "tr": true, "hr": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true}
+
 // FormatText converts text with markdown processor, applies external converters and shortens links
 //
 // raw=true disables SmartyPants for HTML rendering (replacement of quotes, dashes, fractions, etc).
@@ -86,9 +86,53 @@ func TestFormatter_FormatComment(t *testing.T) {
 	f := NewCommentFormatter(mockConverter{})
 	exp := comment
 	exp.Text = "<p>blah</p>\n\n<p>xyz</p>\n!converted"
+	exp.PlainText = "blah\n\nxyz\n\n!converted"
+	exp.RenderKey = f.RenderKey(false)
 	assert.Equal(t, exp, f.Format(comment, false))
 }
 
+type mockKeyConverter struct{ key string }
+
+func (m mockKeyConverter) Convert(text string) string { return text }
+func (m mockKeyConverter) Key() string                { return m.key }
+
+func TestFormatter_RenderKey(t *testing.T) {
+	f := NewCommentFormatter(mockConverter{})
+	key := f.RenderKey(false)
+	assert.Regexp(t, `^`+strconv.Itoa(FormatterVersion)+`-[0-9a-f]{12}$`, key)
+	assert.Equal(t, key, f.RenderKey(false), "stable")
+	assert.NotEqual(t, key, f.RenderKey(true), "raw mode")
+	assert.NotEqual(t, key, NewCommentFormatter().RenderKey(false), "no converters")
+	assert.NotEqual(t, key, NewCommentFormatter(mockConverter{}, mockConverter{}).RenderKey(false), "more converters")
+
+	withKey := NewCommentFormatter(mockKeyConverter{key: "k1"})
+	assert.Equal(t, withKey.RenderKey(false), NewCommentFormatter(mockKeyConverter{key: "k1"}).RenderKey(false))
+	assert.NotEqual(t, withKey.RenderKey(false), NewCommentFormatter(mockKeyConverter{key: "k2"}).RenderKey(false),
+		"converter's settings changed")
+}
+
+func TestPlainText(t *testing.T) {
+	tbl := []struct {
+		in, out string
+		name    string
+	}{
+		{"", "", "empty"},
+		{"<p>12345 abc</p>\n", "12345 abc", "simple"},
+		{"<p><strong>xyz</strong> <em>aaa</em>   bbb\n ccc</p>", "xyz aaa bbb ccc", "inline markup"},
+		{"<p>line 1<br/>\nline 2</p>\n\n<p>para 2</p>\n", "line 1\nline 2\n\npara 2", "line breaks and paragraphs"},
+		{"<ul>\n<li>one<br/>\n</li>\n<li>two<br/>\n</li>\n</ul>\n<p>after</p>", "- one\n- two\n\nafter", "list"},
+		{`<p>see <a href="http://example.com">link</a> <img src="some.png" alt="a cat"/><img src="other.png"/></p>`,
+			"see link [a cat]", "links and images"},
+		{"<p><script>alert(1)</script>text &amp; more &lt;b&gt;</p><style>p {}</style>", "text & more <b>", "scripts and entities"},
+		{"<blockquote>\n<p>quoted</p>\n</blockquote>\n\n<p>reply</p>", "quoted\n\nreply", "quote"},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.out, PlainText(tt.in))
+		})
+	}
+}
+
 func TestFormatter_ShortenAutoLinks(t *testing.T) {
 	f := NewCommentFormatter(nil)
 	tbl := []struct {
@@ -0,0 +1,89 @@
+package highlight
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/umputun/remark42/backend/app/store"
+)
+
+// Bolt implements Store with highlights kept in bolt DB, in a bucket per site keyed by comment id
+type Bolt struct {
+	fileName string
+	db       *bolt.DB
+}
+
+// NewBoltStorage makes bolt highlight store
+func NewBoltStorage(fileName string, options bolt.Options) (*Bolt, error) {
+	db, err := bolt.Open(fileName, 0o600, &options) //nolint:gocritic //octalLiteral is OK as FileMode
+	if err != nil {
+		return nil, fmt.Errorf("failed to make boltdb for %s: %w", fileName, err)
+	}
+	return &Bolt{db: db, fileName: fileName}, nil
+}
+
+// Add highlights the comment, replaces existing highlight of the same comment
+func (b *Bolt) Add(h Highlight) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bkt, err := tx.CreateBucketIfNotExists([]byte(h.Locator.SiteID))
+		if err != nil {
+			return fmt.Errorf("failed to create bucket %s: %w", h.Locator.SiteID, err)
+		}
+		data, err := json.Marshal(h)
+		if err != nil {
+			return fmt.Errorf("failed to marshal highlight %s: %w", h.CommentID, err)
+		}
+		return bkt.Put([]byte(h.CommentID), data)
+	})
+}
+
+// Remove drops highlight of the comment
+func (b *Bolt) Remove(locator store.Locator, commentID string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(locator.SiteID))
+		if bkt == nil || bkt.Get([]byte(commentID)) == nil {
+			return ErrNotFound
+		}
+		return bkt.Delete([]byte(commentID))
+	})
+}
+
+// List returns site's highlights sorted from the newest, for the post only if url set, all if limit is zero
+func (b *Bolt) List(siteID, url string, limit int) ([]Highlight, error) {
+	res := []Highlight{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(siteID))
+		if bkt == nil {
+			return nil
+		}
+		return bkt.ForEach(func(k, v []byte) error {
+			h := Highlight{}
+			if err := json.Unmarshal(v, &h); err != nil {
+				return fmt.Errorf("failed to unmarshal highlight %s: %w", string(k), err)
+			}
+			if url == "" || h.Locator.URL == url {
+				res = append(res, h)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Timestamp.After(res[j].Timestamp) })
+	if limit > 0 && len(res) > limit {
+		res = res[:limit]
+	}
+	return res, nil
+}
+
+// Close bolt store
+func (b *Bolt) Close() error {
+	if err := b.db.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", b.fileName, err)
+	}
+	return nil
+}
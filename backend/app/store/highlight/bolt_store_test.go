@@ -0,0 +1,71 @@
+package highlight
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/umputun/remark42/backend/app/store"
+)
+
+func TestBolt_Highlights(t *testing.T) {
+	svc, teardown := prepareBoltHighlightStorageTest(t)
+	defer teardown()
+	post1 := store.Locator{SiteID: "site1", URL: "https://example.com/post1"}
+	post2 := store.Locator{SiteID: "site1", URL: "https://example.com/post2"}
+	ts := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	res, err := svc.List("site1", "", 0)
+	require.NoError(t, err)
+	assert.Empty(t, res)
+	assert.ErrorIs(t, svc.Remove(post1, "c1"), ErrNotFound)
+
+	require.NoError(t, svc.Add(Highlight{Locator: post1, CommentID: "c1", Timestamp: ts}))
+	require.NoError(t, svc.Add(Highlight{Locator: post2, CommentID: "c2", Timestamp: ts.Add(time.Hour), Note: "best"}))
+	require.NoError(t, svc.Add(Highlight{Locator: post1, CommentID: "c3", Timestamp: ts.Add(2 * time.Hour)}))
+	require.NoError(t, svc.Add(Highlight{Locator: store.Locator{SiteID: "site2", URL: post1.URL}, CommentID: "c4", Timestamp: ts}))
+
+	res, err = svc.List("site1", "", 0)
+	require.NoError(t, err)
+	require.Len(t, res, 3)
+	assert.Equal(t, []string{"c3", "c2", "c1"}, []string{res[0].CommentID, res[1].CommentID, res[2].CommentID}, "newest first")
+	assert.Equal(t, "best", res[1].Note)
+
+	res, err = svc.List("site1", "", 2)
+	require.NoError(t, err)
+	assert.Len(t, res, 2, "limited")
+
+	res, err = svc.List("site1", post1.URL, 0)
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	assert.Equal(t, "c3", res[0].CommentID)
+
+	require.NoError(t, svc.Remove(post1, "c3"))
+	res, err = svc.List("site1", post1.URL, 0)
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	assert.Equal(t, "c1", res[0].CommentID)
+
+	res, err = svc.List("site3", "", 0)
+	require.NoError(t, err)
+	assert.Empty(t, res, "unknown site")
+}
+
+func prepareBoltHighlightStorageTest(t *testing.T) (svc *Bolt, teardown func()) {
+	loc, err := os.MkdirTemp("", "test_highlight_r42")
+	require.NoError(t, err, "failed to make temp dir")
+
+	svc, err = NewBoltStorage(path.Join(loc, "highlights.db"), bolt.Options{})
+	require.NoError(t, err, "new bolt storage")
+
+	teardown = func() {
+		assert.NoError(t, svc.Close())
+		assert.NoError(t, os.RemoveAll(loc))
+	}
+	return svc, teardown
+}
@@ -0,0 +1,29 @@
+// Package highlight provides admin-curated highlights, i.e. comments featured on the site or post.
+package highlight
+
+import (
+	"errors"
+	"time"
+
+	"github.com/umputun/remark42/backend/app/store"
+)
+
+// ErrNotFound returned if comment is not highlighted
+var ErrNotFound = errors.New("highlight not found")
+
+// Highlight is a reference to the highlighted comment
+type Highlight struct {
+	Locator   store.Locator `json:"locator"`
+	CommentID string        `json:"id"`
+	Note      string        `json:"note,omitempty"` // admin's note, like "comment of the day"
+	Timestamp time.Time     `json:"time"`
+}
+
+// Store defines interface to keep highlights
+type Store interface {
+	Add(h Highlight) error
+	Remove(locator store.Locator, commentID string) error
+	// List returns site's highlights sorted from the newest, for the post only if url set, all if limit is zero
+	List(siteID, url string, limit int) ([]Highlight, error)
+	Close() error
+}
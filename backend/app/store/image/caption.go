@@ -0,0 +1,75 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Captioner generates alt text describing the image
+type Captioner interface {
+	Caption(ctx context.Context, img []byte) (string, error)
+}
+
+// CaptionerFunc is an adapter to allow the use of an ordinary functions as Captioner
+type CaptionerFunc func(ctx context.Context, img []byte) (string, error)
+
+// Caption calls f(ctx, img)
+func (f CaptionerFunc) Caption(ctx context.Context, img []byte) (string, error) {
+	return f(ctx, img)
+}
+
+// CaptionWebhook generates alt text with external captioning service. The image is posted as request body
+// with its content type, and the service responds with JSON {"alt": "description of the image"}.
+type CaptionWebhook struct {
+	URL     string
+	Timeout time.Duration
+	Client  *http.Client // http.DefaultClient if nil
+}
+
+// Caption posts the image to the webhook and returns alt text from the response
+func (c *CaptionWebhook) Caption(ctx context.Context, img []byte) (string, error) {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(img))
+	if err != nil {
+		return "", fmt.Errorf("can't make caption request: %w", err)
+	}
+	req.Header.Set("Content-Type", http.DetectContentType(img))
+
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("caption request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return "", fmt.Errorf("can't read caption response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("caption service responded with status %d", resp.StatusCode)
+	}
+
+	res := struct {
+		Alt string `json:"alt"`
+	}{}
+	if err = json.Unmarshal(body, &res); err != nil {
+		return "", fmt.Errorf("can't decode caption response: %w", err)
+	}
+	if res.Alt == "" {
+		return "", errors.New("empty caption")
+	}
+	return res.Alt, nil
+}
@@ -0,0 +1,49 @@
+package image
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCaptionWebhook_Caption(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		switch string(body) {
+		case "\x89PNG\r\n\x1a\nimage":
+			assert.Equal(t, "image/png", r.Header.Get("Content-Type"))
+			_, _ = w.Write([]byte(`{"alt": "a gopher"}`))
+		case "empty":
+			_, _ = w.Write([]byte(`{"alt": ""}`))
+		case "bad":
+			_, _ = w.Write([]byte(`not json`))
+		case "slow":
+			time.Sleep(100 * time.Millisecond)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer ts.Close()
+
+	c := CaptionWebhook{URL: ts.URL, Timeout: 50 * time.Millisecond}
+	alt, err := c.Caption(context.Background(), []byte("\x89PNG\r\n\x1a\nimage"))
+	require.NoError(t, err)
+	assert.Equal(t, "a gopher", alt)
+
+	_, err = c.Caption(context.Background(), []byte("empty"))
+	assert.EqualError(t, err, "empty caption")
+	_, err = c.Caption(context.Background(), []byte("bad"))
+	assert.ErrorContains(t, err, "can't decode caption response")
+	_, err = c.Caption(context.Background(), []byte("other"))
+	assert.EqualError(t, err, "caption service responded with status 500")
+	_, err = c.Caption(context.Background(), []byte("slow"))
+	assert.ErrorContains(t, err, "caption request failed")
+}
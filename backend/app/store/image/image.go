@@ -27,6 +27,7 @@ import (
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
+	lcw "github.com/go-pkgz/lcw/v2"
 	log "github.com/go-pkgz/lgr"
 	"github.com/rs/xid"
 	"golang.org/x/image/draw"
@@ -45,6 +46,10 @@ type Service struct {
 	once        sync.Once
 	term        int32 // term value used atomically to detect emergency termination
 	submitCount int32 // atomic increment for counting submitted images
+	thumbs      struct {
+		once  sync.Once
+		cache lcw.LoadingCache[thumbnail]
+	}
 }
 
 // ServiceParams contains externally adjustable parameters of Service
@@ -55,6 +60,10 @@ type ServiceParams struct {
 	MaxSize      int
 	MaxHeight    int
 	MaxWidth     int
+	Captioner    Captioner // generates alt text of uploaded images without one, disabled if nil
+
+	ThumbnailSizes     []ThumbnailSize // allowed sizes of thumbnails, no thumbnails if empty
+	ThumbnailCacheSize int64           // max size of cached thumbnails in bytes, 64MB if not set
 }
 
 // StoreInfo contains image store meta information
@@ -79,6 +88,9 @@ type Store interface {
 
 const submitQueueSize = 5000
 
+// MaxAltLength is max length of image's alt text in runes
+const MaxAltLength = 300
+
 type submitReq struct {
 	idsFn func() (ids []string)
 	TS    time.Time
@@ -217,9 +229,13 @@ func (s *Service) Load(id string) ([]byte, error) {
 	return s.store.Load(id)
 }
 
-// Delete wraps storage Delete function.
+// Delete wraps storage Delete function, thumbnails of the image deleted as well.
 func (s *Service) Delete(id string) error {
-	return s.store.Delete(id)
+	if err := s.store.Delete(id); err != nil {
+		return err
+	}
+	s.dropThumbnails(id)
+	return nil
 }
 
 // Save wraps storage Save function, validating and resizing the image before calling it.
@@ -228,6 +244,40 @@ func (s *Service) Save(userID string, r io.Reader) (id string, err error) {
 	return id, s.SaveWithID(id, r)
 }
 
+// SaveWithAlt saves image same as Save and returns its alt text, generated by Captioner if empty.
+// Failed captioning doesn't fail the upload. Alt text is not stored with the image, the client puts it
+// into the comment, like ![alt](url), so it's kept with the comment.
+func (s *Service) SaveWithAlt(ctx context.Context, userID string, r io.Reader, alt string) (id, resAlt string, err error) {
+	img, err := s.prepareImage(r)
+	if err != nil {
+		return "", "", err
+	}
+	id = path.Join(userID, guid())
+	if err = s.store.Save(id, img); err != nil {
+		return "", "", err
+	}
+
+	alt = normalizeAlt(alt)
+	if alt == "" && s.Captioner != nil {
+		caption, e := s.Captioner.Caption(ctx, img)
+		if e != nil {
+			log.Printf("[WARN] can't caption image %s, %v", id, e)
+			return id, "", nil
+		}
+		alt = normalizeAlt(caption)
+	}
+	return id, alt, nil
+}
+
+// normalizeAlt collapses whitespace of alt text and cuts it to MaxAltLength
+func normalizeAlt(alt string) string {
+	alt = strings.Join(strings.Fields(alt), " ")
+	if r := []rune(alt); len(r) > MaxAltLength {
+		alt = strings.TrimSpace(string(r[:MaxAltLength]))
+	}
+	return alt
+}
+
 // SaveWithID wraps storage Save function, validating and resizing the image before calling it.
 func (s *Service) SaveWithID(id string, r io.Reader) error {
 	img, err := s.prepareImage(r)
@@ -246,12 +296,8 @@ func (s *Service) extractImageIDs(commentHTML string, includeProxied bool) (ids
 	}
 	doc.Find("img").Each(func(_ int, sl *goquery.Selection) {
 		if im, ok := sl.Attr("src"); ok {
-			if strings.Contains(im, s.ImageAPI) {
-				elems := strings.Split(im, "/")
-				if len(elems) >= 2 {
-					id := elems[len(elems)-2] + "/" + elems[len(elems)-1]
-					ids = append(ids, id)
-				}
+			if id, ok := s.pictureID(im); ok {
+				ids = append(ids, id)
 			}
 			if includeProxied && strings.Contains(im, s.ProxyAPI) {
 				proxiedURL, err := url.Parse(im)
@@ -274,6 +320,18 @@ func (s *Service) extractImageIDs(commentHTML string, includeProxied bool) (ids
 	return ids
 }
 
+// pictureID returns id of uploaded image from its url, i.e. user/pic.png
+func (s *Service) pictureID(src string) (string, bool) {
+	if !strings.Contains(src, s.ImageAPI) {
+		return "", false
+	}
+	elems := strings.Split(src, "/")
+	if len(elems) < 2 {
+		return "", false
+	}
+	return elems[len(elems)-2] + "/" + elems[len(elems)-1], true
+}
+
 // maxImagePixels caps the declared pixel count of an image before any raster decode
 // is allowed. Without this, a tiny compressed "decompression bomb" image declaring
 // e.g. 65535x65535 px would force image.Decode to allocate gigabytes of pixel memory
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"image"
 	"io"
@@ -41,6 +42,53 @@ func TestService_SaveAndLoad(t *testing.T) {
 	assert.Equal(t, "test_id", store.LoadCalls()[0].ID)
 }
 
+func TestService_SaveWithAlt(t *testing.T) {
+	store := StoreMock{SaveFunc: func(string, []byte) error { return nil }}
+	svc := NewService(&store, ServiceParams{MaxSize: 1500, MaxWidth: 32, MaxHeight: 32})
+
+	id, alt, err := svc.SaveWithAlt(context.Background(), "user1", gopherPNG(), "  a   gopher\n\tpicture ")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(id, "user1/"))
+	assert.Equal(t, "a gopher picture", alt)
+	require.Equal(t, 1, len(store.SaveCalls()), "alt text not saved with the image")
+	assert.Equal(t, id, store.SaveCalls()[0].ID)
+
+	_, alt, err = svc.SaveWithAlt(context.Background(), "user1", gopherPNG(), "")
+	require.NoError(t, err)
+	assert.Empty(t, alt)
+
+	_, alt, err = svc.SaveWithAlt(context.Background(), "user1", gopherPNG(), strings.Repeat("ж", MaxAltLength+10))
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("ж", MaxAltLength), alt)
+
+	_, _, err = svc.SaveWithAlt(context.Background(), "user1", strings.NewReader("not an image"), "alt")
+	assert.Error(t, err)
+	assert.Equal(t, 3, len(store.SaveCalls()))
+}
+
+func TestService_SaveWithAltCaptioner(t *testing.T) {
+	store := StoreMock{SaveFunc: func(string, []byte) error { return nil }}
+	captionErr := error(nil)
+	svc := NewService(&store, ServiceParams{MaxSize: 1500, MaxWidth: 32, MaxHeight: 32,
+		Captioner: CaptionerFunc(func(_ context.Context, img []byte) (string, error) {
+			assert.NotEmpty(t, img)
+			return "generated caption", captionErr
+		})})
+
+	_, alt, err := svc.SaveWithAlt(context.Background(), "user1", gopherPNG(), "")
+	require.NoError(t, err)
+	assert.Equal(t, "generated caption", alt)
+
+	_, alt, err = svc.SaveWithAlt(context.Background(), "user1", gopherPNG(), "user alt")
+	require.NoError(t, err)
+	assert.Equal(t, "user alt", alt, "captioner not used if alt text set")
+
+	captionErr = errors.New("failed")
+	_, alt, err = svc.SaveWithAlt(context.Background(), "user1", gopherPNG(), "")
+	require.NoError(t, err, "captioning failure doesn't fail upload")
+	assert.Empty(t, alt)
+}
+
 func TestService_Resize(t *testing.T) {
 	img, err := readAndValidateImage(gopherPNG(), 1500)
 	assert.NoError(t, err)
@@ -0,0 +1,94 @@
+package image
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	lcw "github.com/go-pkgz/lcw/v2"
+	log "github.com/go-pkgz/lgr"
+)
+
+// ErrThumbnailSize is returned by Thumbnail for size not listed in ServiceParams.ThumbnailSizes
+var ErrThumbnailSize = errors.New("thumbnail size not allowed")
+
+const defaultThumbnailCacheSize = 64 * 1024 * 1024
+
+// thumbnail is cached thumbnail, sized for cache limits
+type thumbnail []byte
+
+// Size returns size of the thumbnail in bytes
+func (t thumbnail) Size() int { return len(t) }
+
+// ThumbnailSize defines the box thumbnail fits into, in pixels
+type ThumbnailSize struct {
+	Width  int
+	Height int
+}
+
+// ParseThumbnailSize parses size in WIDTHxHEIGHT format, like 320x240
+func ParseThumbnailSize(s string) (ThumbnailSize, error) {
+	w, h, ok := strings.Cut(s, "x")
+	if !ok {
+		return ThumbnailSize{}, fmt.Errorf("invalid thumbnail size %q, expected WIDTHxHEIGHT", s)
+	}
+	width, errW := strconv.Atoi(w)
+	height, errH := strconv.Atoi(h)
+	if errW != nil || errH != nil || width <= 0 || height <= 0 {
+		return ThumbnailSize{}, fmt.Errorf("invalid thumbnail size %q, expected positive WIDTHxHEIGHT", s)
+	}
+	return ThumbnailSize{Width: width, Height: height}, nil
+}
+
+// String returns size in WIDTHxHEIGHT format
+func (t ThumbnailSize) String() string {
+	return strconv.Itoa(t.Width) + "x" + strconv.Itoa(t.Height)
+}
+
+// Thumbnail returns the image resized to fit into the size, keeping proportions. Images fitting the size
+// are returned as is, never upscaled. Thumbnails are made on demand and kept in memory cache limited
+// by ThumbnailCacheSize, they are not stored as they can be made again from the image any time.
+func (s *Service) Thumbnail(id string, size ThumbnailSize) ([]byte, error) {
+	if !slices.Contains(s.ThumbnailSizes, size) {
+		return nil, ErrThumbnailSize
+	}
+	res, err := s.thumbnails().Get(id+"/"+size.String(), func() (thumbnail, error) {
+		img, err := s.store.Load(id)
+		if err != nil {
+			return nil, err
+		}
+		res := resize(img, size.Width, size.Height)
+		if res == nil {
+			return nil, fmt.Errorf("can't make thumbnail of %s", id)
+		}
+		return res, nil
+	})
+	return res, err
+}
+
+// thumbnails returns cache of thumbnails, made on first use. Switches to no-cache if memory cache failed.
+func (s *Service) thumbnails() lcw.LoadingCache[thumbnail] {
+	s.thumbs.once.Do(func() {
+		maxSize := s.ThumbnailCacheSize
+		if maxSize <= 0 {
+			maxSize = defaultThumbnailCacheSize
+		}
+		o := lcw.NewOpts[thumbnail]()
+		var err error
+		if s.thumbs.cache, err = lcw.NewLruCache(o.MaxCacheSize(maxSize), o.MaxValSize(int(maxSize/10))); err != nil {
+			log.Printf("[WARN] failed to make thumbnails cache, caching disabled, %v", err)
+			s.thumbs.cache = &lcw.Nop[thumbnail]{}
+		}
+	})
+	return s.thumbs.cache
+}
+
+// dropThumbnails removes cached thumbnails of the image
+func (s *Service) dropThumbnails(id string) {
+	if len(s.ThumbnailSizes) == 0 {
+		return
+	}
+	s.thumbnails().Invalidate(func(key string) bool { return strings.HasPrefix(key, id+"/") })
+}
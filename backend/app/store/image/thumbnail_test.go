@@ -0,0 +1,61 @@
+package image
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseThumbnailSize(t *testing.T) {
+	size, err := ParseThumbnailSize("320x240")
+	require.NoError(t, err)
+	assert.Equal(t, ThumbnailSize{Width: 320, Height: 240}, size)
+	assert.Equal(t, "320x240", size.String())
+
+	for _, s := range []string{"", "320", "320x", "x240", "0x240", "320x-1", "ax240", "320X240"} {
+		_, err = ParseThumbnailSize(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestService_Thumbnail(t *testing.T) {
+	png, err := os.ReadFile("testdata/circles.png") // 800x600 px
+	require.NoError(t, err)
+	store := &StoreMock{LoadFunc: func(id string) ([]byte, error) {
+		if id == "user1/pic" {
+			return png, nil
+		}
+		return nil, errors.New("not found")
+	}, DeleteFunc: func(string) error { return nil }}
+	svc := NewService(store, ServiceParams{ThumbnailSizes: []ThumbnailSize{{Width: 200, Height: 200}, {Width: 1000, Height: 1000}}})
+
+	thumb, err := svc.Thumbnail("user1/pic", ThumbnailSize{Width: 200, Height: 200})
+	require.NoError(t, err)
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(thumb))
+	require.NoError(t, err)
+	assert.Equal(t, 200, cfg.Width)
+	assert.Equal(t, 150, cfg.Height, "proportions kept")
+
+	_, err = svc.Thumbnail("user1/pic", ThumbnailSize{Width: 200, Height: 200})
+	require.NoError(t, err)
+	assert.Len(t, store.LoadCalls(), 1, "thumbnail cached")
+
+	thumb, err = svc.Thumbnail("user1/pic", ThumbnailSize{Width: 1000, Height: 1000})
+	require.NoError(t, err)
+	assert.Equal(t, png, thumb, "not upscaled")
+
+	_, err = svc.Thumbnail("user1/pic", ThumbnailSize{Width: 100, Height: 100})
+	assert.ErrorIs(t, err, ErrThumbnailSize)
+	_, err = svc.Thumbnail("user1/missing", ThumbnailSize{Width: 200, Height: 200})
+	assert.EqualError(t, err, "not found")
+
+	require.NoError(t, svc.Delete("user1/pic"))
+	_, err = svc.Thumbnail("user1/pic", ThumbnailSize{Width: 200, Height: 200})
+	require.NoError(t, err)
+	assert.Len(t, store.LoadCalls(), 4, "thumbnail of deleted image dropped from cache")
+}
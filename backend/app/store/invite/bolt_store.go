@@ -0,0 +1,188 @@
+package invite
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	invitationsBucket = "invitations" // invitation id -> invitation
+	grantsBucket      = "grants"      // nested bucket per site, user id -> grant
+)
+
+// Bolt implements Store with invitations and grants kept in bolt DB
+type Bolt struct {
+	fileName string
+	db       *bolt.DB
+}
+
+// NewBoltStorage makes bolt invite store
+func NewBoltStorage(fileName string, options bolt.Options) (*Bolt, error) {
+	db, err := bolt.Open(fileName, 0o600, &options) //nolint:gocritic //octalLiteral is OK as FileMode
+	if err != nil {
+		return nil, fmt.Errorf("failed to make boltdb for %s: %w", fileName, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bkt := range []string{invitationsBucket, grantsBucket} {
+			if _, e := tx.CreateBucketIfNotExists([]byte(bkt)); e != nil {
+				return fmt.Errorf("failed to create bucket %s: %w", bkt, e)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &Bolt{db: db, fileName: fileName}, nil
+}
+
+// Create adds the invitation
+func (b *Bolt) Create(inv Invitation) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket([]byte(invitationsBucket)), inv.ID, inv)
+	})
+}
+
+// Get returns the invitation by id
+func (b *Bolt) Get(id string) (res Invitation, err error) {
+	err = b.db.View(func(tx *bolt.Tx) error {
+		res, err = getInvitation(tx, id)
+		return err
+	})
+	return res, err
+}
+
+// List returns all invitations, newest first
+func (b *Bolt) List() ([]Invitation, error) {
+	res := []Invitation{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(invitationsBucket)).ForEach(func(k, v []byte) error {
+			inv := Invitation{}
+			if err := json.Unmarshal(v, &inv); err != nil {
+				return fmt.Errorf("failed to unmarshal invitation %s: %w", k, err)
+			}
+			res = append(res, inv)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(res, func(a, b Invitation) int { return b.Created.Compare(a.Created) })
+	return res, nil
+}
+
+// Delete removes the invitation, grants made by it are kept
+func (b *Bolt) Delete(id string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(invitationsBucket))
+		if bkt.Get([]byte(id)) == nil {
+			return ErrNotFound
+		}
+		return bkt.Delete([]byte(id))
+	})
+}
+
+// Accept marks the invitation accepted by the user and grants its role on its sites, in a single transaction
+func (b *Bolt) Accept(id, userID string, ts time.Time) ([]Grant, error) {
+	res := []Grant{}
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		inv, err := getInvitation(tx, id)
+		if err != nil {
+			return err
+		}
+		if inv.AcceptedBy != "" {
+			return ErrAccepted
+		}
+		if !ts.Before(inv.Expires) {
+			return ErrExpired
+		}
+		inv.AcceptedBy, inv.Accepted = userID, ts
+		if err = putJSON(tx.Bucket([]byte(invitationsBucket)), inv.ID, inv); err != nil {
+			return err
+		}
+		for _, siteID := range inv.Sites {
+			bkt, e := tx.Bucket([]byte(grantsBucket)).CreateBucketIfNotExists([]byte(siteID))
+			if e != nil {
+				return fmt.Errorf("failed to create bucket %s: %w", siteID, e)
+			}
+			grant := Grant{SiteID: siteID, UserID: userID, Role: inv.Role, InvitedBy: inv.CreatedBy, InvitationID: inv.ID, Time: ts}
+			if e = putJSON(bkt, userID, grant); e != nil {
+				return e
+			}
+			res = append(res, grant)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Grants returns roles granted on the site, ordered by user id
+func (b *Bolt) Grants(siteID string) ([]Grant, error) {
+	res := []Grant{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(grantsBucket)).Bucket([]byte(siteID))
+		if bkt == nil {
+			return nil
+		}
+		return bkt.ForEach(func(k, v []byte) error {
+			grant := Grant{}
+			if err := json.Unmarshal(v, &grant); err != nil {
+				return fmt.Errorf("failed to unmarshal grant %s: %w", k, err)
+			}
+			res = append(res, grant)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Revoke removes role of the user on the site
+func (b *Bolt) Revoke(siteID, userID string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(grantsBucket)).Bucket([]byte(siteID))
+		if bkt == nil || bkt.Get([]byte(userID)) == nil {
+			return fmt.Errorf("no role granted to %s on %s", userID, siteID)
+		}
+		return bkt.Delete([]byte(userID))
+	})
+}
+
+// Close bolt store
+func (b *Bolt) Close() error {
+	if err := b.db.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", b.fileName, err)
+	}
+	return nil
+}
+
+func getInvitation(tx *bolt.Tx, id string) (Invitation, error) {
+	v := tx.Bucket([]byte(invitationsBucket)).Get([]byte(id))
+	if v == nil {
+		return Invitation{}, ErrNotFound
+	}
+	res := Invitation{}
+	if err := json.Unmarshal(v, &res); err != nil {
+		return Invitation{}, fmt.Errorf("failed to unmarshal invitation %s: %w", id, err)
+	}
+	return res, nil
+}
+
+func putJSON(bkt *bolt.Bucket, key string, val any) error {
+	data, err := json.Marshal(val)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", key, err)
+	}
+	return bkt.Put([]byte(key), data)
+}
@@ -0,0 +1,106 @@
+package invite
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestBolt_Invitations(t *testing.T) {
+	svc, teardown := prepareBoltInviteStorageTest(t)
+	defer teardown()
+	ts := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	res, err := svc.List()
+	require.NoError(t, err)
+	assert.Empty(t, res)
+
+	inv1 := Invitation{ID: "id1", Role: RoleAdmin, Sites: []string{"site1"}, CreatedBy: "admin", Created: ts,
+		Expires: ts.Add(time.Hour)}
+	inv2 := Invitation{ID: "id2", Role: RoleAdmin, Sites: []string{"site1", "site2"}, CreatedBy: "admin",
+		Created: ts.Add(time.Minute), Expires: ts.Add(time.Hour)}
+	require.NoError(t, svc.Create(inv1))
+	require.NoError(t, svc.Create(inv2))
+
+	inv, err := svc.Get("id1")
+	require.NoError(t, err)
+	assert.Equal(t, inv1, inv)
+	_, err = svc.Get("unknown")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	res, err = svc.List()
+	require.NoError(t, err)
+	assert.Equal(t, []Invitation{inv2, inv1}, res, "newest first")
+
+	require.NoError(t, svc.Delete("id1"))
+	require.ErrorIs(t, svc.Delete("id1"), ErrNotFound)
+	res, err = svc.List()
+	require.NoError(t, err)
+	assert.Equal(t, []Invitation{inv2}, res)
+}
+
+func TestBolt_Accept(t *testing.T) {
+	svc, teardown := prepareBoltInviteStorageTest(t)
+	defer teardown()
+	ts := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	require.NoError(t, svc.Create(Invitation{ID: "id1", Role: RoleAdmin, Sites: []string{"site1", "site2"},
+		CreatedBy: "admin", Created: ts, Expires: ts.Add(time.Hour)}))
+	require.NoError(t, svc.Create(Invitation{ID: "id2", Role: RoleAdmin, Sites: []string{"site1"},
+		CreatedBy: "admin", Created: ts, Expires: ts.Add(time.Hour)}))
+
+	_, err := svc.Accept("unknown", "user1", ts)
+	require.ErrorIs(t, err, ErrNotFound)
+	_, err = svc.Accept("id2", "user2", ts.Add(time.Hour))
+	require.ErrorIs(t, err, ErrExpired)
+
+	grants, err := svc.Accept("id1", "user1", ts.Add(time.Minute))
+	require.NoError(t, err)
+	require.Len(t, grants, 2)
+	assert.Equal(t, Grant{SiteID: "site1", UserID: "user1", Role: RoleAdmin, InvitedBy: "admin", InvitationID: "id1",
+		Time: ts.Add(time.Minute)}, grants[0])
+	assert.Equal(t, "site2", grants[1].SiteID)
+	_, err = svc.Accept("id1", "user3", ts.Add(time.Minute))
+	require.ErrorIs(t, err, ErrAccepted, "accepted once")
+
+	inv, err := svc.Get("id1")
+	require.NoError(t, err)
+	assert.Equal(t, "user1", inv.AcceptedBy)
+	assert.Equal(t, ts.Add(time.Minute), inv.Accepted)
+
+	res, err := svc.Grants("site1")
+	require.NoError(t, err)
+	assert.Equal(t, grants[:1], res)
+	res, err = svc.Grants("site3")
+	require.NoError(t, err)
+	assert.Empty(t, res)
+
+	require.NoError(t, svc.Delete("id1"))
+	res, err = svc.Grants("site2")
+	require.NoError(t, err)
+	assert.Len(t, res, 1, "grants kept with invitation deleted")
+
+	require.NoError(t, svc.Revoke("site1", "user1"))
+	require.EqualError(t, svc.Revoke("site1", "user1"), "no role granted to user1 on site1")
+	require.EqualError(t, svc.Revoke("site3", "user1"), "no role granted to user1 on site3")
+	res, err = svc.Grants("site1")
+	require.NoError(t, err)
+	assert.Empty(t, res)
+}
+
+func prepareBoltInviteStorageTest(t *testing.T) (svc *Bolt, teardown func()) {
+	loc, err := os.MkdirTemp("", "test_invite_r42")
+	require.NoError(t, err, "failed to make temp dir")
+	svc, err = NewBoltStorage(path.Join(loc, "invites.db"), bolt.Options{})
+	require.NoError(t, err, "new bolt storage")
+	teardown = func() {
+		assert.NoError(t, svc.Close())
+		assert.NoError(t, os.RemoveAll(loc))
+	}
+	return svc, teardown
+}
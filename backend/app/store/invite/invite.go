@@ -0,0 +1,57 @@
+// Package invite provides invitations of new admins and the roles granted by accepted ones
+package invite
+
+import (
+	"errors"
+	"time"
+)
+
+// Roles granted by invitations
+const (
+	RoleAdmin = "admin"
+)
+
+// Errors returned by Store
+var (
+	ErrNotFound = errors.New("invitation not found")
+	ErrExpired  = errors.New("invitation expired")
+	ErrAccepted = errors.New("invitation already accepted")
+)
+
+// Invitation grants the role on the sites to the user accepting it, once and before it expires
+type Invitation struct {
+	ID         string    `json:"id"` // random token, kept secret by the inviting admin and the invitee
+	Role       string    `json:"role"`
+	Sites      []string  `json:"sites"`
+	CreatedBy  string    `json:"created_by"`
+	Created    time.Time `json:"created"`
+	Expires    time.Time `json:"expires"`
+	AcceptedBy string    `json:"accepted_by,omitempty"`
+	Accepted   time.Time `json:"accepted,omitzero"`
+}
+
+// Grant is the role of the user on the site, granted by the invitation
+type Grant struct {
+	SiteID       string    `json:"site"`
+	UserID       string    `json:"user_id"`
+	Role         string    `json:"role"`
+	InvitedBy    string    `json:"invited_by"`
+	InvitationID string    `json:"invitation_id"`
+	Time         time.Time `json:"time"`
+}
+
+// Store defines interface to keep invitations and grants
+type Store interface {
+	Create(inv Invitation) error
+	Get(id string) (Invitation, error)
+	// List returns all invitations, newest first
+	List() ([]Invitation, error)
+	Delete(id string) error
+	// Accept marks the invitation accepted by the user and grants its role on its sites, in a single transaction
+	Accept(id, userID string, ts time.Time) ([]Grant, error)
+	// Grants returns roles granted on the site
+	Grants(siteID string) ([]Grant, error)
+	// Revoke removes role of the user on the site
+	Revoke(siteID, userID string) error
+	Close() error
+}
@@ -0,0 +1,102 @@
+package page
+
+import (
+	"encoding/json"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/umputun/remark42/backend/app/store"
+)
+
+// Bolt implements Store with settings kept in bolt DB, in a bucket per site keyed by post url
+type Bolt struct {
+	fileName string
+	db       *bolt.DB
+}
+
+// NewBoltStorage makes bolt page settings store
+func NewBoltStorage(fileName string, options bolt.Options) (*Bolt, error) {
+	db, err := bolt.Open(fileName, 0o600, &options) //nolint:gocritic //octalLiteral is OK as FileMode
+	if err != nil {
+		return nil, fmt.Errorf("failed to make boltdb for %s: %w", fileName, err)
+	}
+	return &Bolt{db: db, fileName: fileName}, nil
+}
+
+// Get settings of the post
+func (b *Bolt) Get(locator store.Locator) (Settings, error) {
+	res := Settings{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(locator.SiteID))
+		if bkt == nil {
+			return ErrNotFound
+		}
+		v := bkt.Get([]byte(locator.URL))
+		if v == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(v, &res)
+	})
+	if err != nil {
+		return Settings{}, err
+	}
+	return res, nil
+}
+
+// Set settings of the post, replaces existing ones
+func (b *Bolt) Set(s Settings) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bkt, err := tx.CreateBucketIfNotExists([]byte(s.Locator.SiteID))
+		if err != nil {
+			return fmt.Errorf("failed to create bucket %s: %w", s.Locator.SiteID, err)
+		}
+		data, err := json.Marshal(s)
+		if err != nil {
+			return fmt.Errorf("failed to marshal settings of %s: %w", s.Locator.URL, err)
+		}
+		return bkt.Put([]byte(s.Locator.URL), data)
+	})
+}
+
+// Delete settings of the post
+func (b *Bolt) Delete(locator store.Locator) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(locator.SiteID))
+		if bkt == nil || bkt.Get([]byte(locator.URL)) == nil {
+			return ErrNotFound
+		}
+		return bkt.Delete([]byte(locator.URL))
+	})
+}
+
+// List returns settings of the site's posts, sorted by url
+func (b *Bolt) List(siteID string) ([]Settings, error) {
+	res := []Settings{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(siteID))
+		if bkt == nil {
+			return nil
+		}
+		return bkt.ForEach(func(k, v []byte) error {
+			s := Settings{}
+			if err := json.Unmarshal(v, &s); err != nil {
+				return fmt.Errorf("failed to unmarshal settings of %s: %w", string(k), err)
+			}
+			res = append(res, s)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Close bolt store
+func (b *Bolt) Close() error {
+	if err := b.db.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", b.fileName, err)
+	}
+	return nil
+}
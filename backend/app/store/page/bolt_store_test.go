@@ -0,0 +1,69 @@
+package page
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/umputun/remark42/backend/app/store"
+)
+
+func TestBolt_Settings(t *testing.T) {
+	svc, teardown := prepareBoltPageStorageTest(t)
+	defer teardown()
+	ts := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	loc1 := store.Locator{SiteID: "site1", URL: "https://example.com/1"}
+
+	res, err := svc.List("site1")
+	require.NoError(t, err)
+	assert.Empty(t, res)
+	_, err = svc.Get(loc1)
+	require.ErrorIs(t, err, ErrNotFound)
+	require.ErrorIs(t, svc.Delete(loc1), ErrNotFound)
+
+	s1 := Settings{Locator: loc1, Sort: "-score", Updated: ts}
+	require.NoError(t, svc.Set(s1))
+	require.NoError(t, svc.Set(Settings{Locator: store.Locator{SiteID: "site1", URL: "https://example.com/0"}, Sort: "time"}))
+	require.NoError(t, svc.Set(Settings{Locator: store.Locator{SiteID: "site2", URL: "https://example.com/1"}, Sort: "time"}))
+
+	s, err := svc.Get(loc1)
+	require.NoError(t, err)
+	assert.Equal(t, s1, s)
+
+	res, err = svc.List("site1")
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	assert.Equal(t, "https://example.com/0", res[0].Locator.URL, "sorted by url")
+	assert.Equal(t, s1, res[1])
+
+	s1.Sort = "+time"
+	require.NoError(t, svc.Set(s1))
+	s, err = svc.Get(loc1)
+	require.NoError(t, err)
+	assert.Equal(t, "+time", s.Sort, "replaced")
+
+	require.NoError(t, svc.Delete(loc1))
+	_, err = svc.Get(loc1)
+	require.ErrorIs(t, err, ErrNotFound)
+	_, err = svc.Get(store.Locator{SiteID: "site2", URL: "https://example.com/1"})
+	require.NoError(t, err, "other site not affected")
+}
+
+func prepareBoltPageStorageTest(t *testing.T) (svc *Bolt, teardown func()) {
+	loc, err := os.MkdirTemp("", "test_page_r42")
+	require.NoError(t, err, "failed to make temp dir")
+
+	svc, err = NewBoltStorage(path.Join(loc, "pages.db"), bolt.Options{})
+	require.NoError(t, err, "new bolt storage")
+
+	teardown = func() {
+		assert.NoError(t, svc.Close())
+		assert.NoError(t, os.RemoveAll(loc))
+	}
+	return svc, teardown
+}
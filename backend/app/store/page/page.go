@@ -0,0 +1,52 @@
+// Package page provides settings of posts made by site owners, like pinned order of comments.
+package page
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/umputun/remark42/backend/app/store"
+)
+
+// ErrNotFound returned if post has no settings
+var ErrNotFound = errors.New("page settings not found")
+
+// Settings of the post, overriding site defaults
+type Settings struct {
+	Locator    store.Locator `json:"locator"`
+	Sort       string        `json:"sort,omitempty"`       // default order of comments, like "-score"
+	Live       bool          `json:"live,omitempty"`       // live-blog mode, newest-first with streaming of new comments
+	Registered bool          `json:"registered,omitempty"` // post registered by admin or sitemap, for strict mode
+	Updated    time.Time     `json:"updated"`
+}
+
+// Store defines interface to keep settings, one per post
+type Store interface {
+	Get(locator store.Locator) (Settings, error)
+	Set(s Settings) error // replaces existing settings of the post
+	Delete(locator store.Locator) error
+	List(siteID string) ([]Settings, error) // settings of the site, sorted by url
+	Close() error
+}
+
+var sorts = []string{"time", "active", "score", "controversy"}
+
+// ControversialSort is alias of "-controversy" sort, the most controversial comments first
+const ControversialSort = "controversial"
+
+// ValidSort checks if sort is supported by engines, with optional "+" or "-" prefix
+func ValidSort(sort string) bool {
+	if sort == ControversialSort {
+		return true
+	}
+	if sort != "" && (sort[0] == '+' || sort[0] == '-') {
+		sort = sort[1:]
+	}
+	return slices.Contains(sorts, sort)
+}
+
+// IsEmpty checks if settings don't override anything
+func (s Settings) IsEmpty() bool {
+	return s.Sort == "" && !s.Live && !s.Registered
+}
@@ -0,0 +1,23 @@
+package page
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidSort(t *testing.T) {
+	for _, s := range []string{"time", "+time", "-time", "active", "-active", "score", "-score", "+controversy", "controversial"} {
+		assert.True(t, ValidSort(s), s)
+	}
+	for _, s := range []string{"", "-", "+", "votes", "--time", "time-", "Score", "-controversial"} {
+		assert.False(t, ValidSort(s), s)
+	}
+}
+
+func TestSettings_IsEmpty(t *testing.T) {
+	assert.True(t, Settings{}.IsEmpty())
+	assert.False(t, Settings{Sort: "-score"}.IsEmpty())
+	assert.False(t, Settings{Live: true}.IsEmpty())
+	assert.False(t, Settings{Registered: true}.IsEmpty())
+}
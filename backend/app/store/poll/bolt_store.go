@@ -0,0 +1,102 @@
+package poll
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/umputun/remark42/backend/app/store"
+)
+
+// Bolt implements Store with polls kept in bolt DB, in a bucket per site keyed by post url
+type Bolt struct {
+	fileName string
+	db       *bolt.DB
+}
+
+// NewBoltStorage makes bolt poll store
+func NewBoltStorage(fileName string, options bolt.Options) (*Bolt, error) {
+	db, err := bolt.Open(fileName, 0o600, &options) //nolint:gocritic //octalLiteral is OK as FileMode
+	if err != nil {
+		return nil, fmt.Errorf("failed to make boltdb for %s: %w", fileName, err)
+	}
+	return &Bolt{db: db, fileName: fileName}, nil
+}
+
+// Get returns poll of the post
+func (b *Bolt) Get(locator store.Locator) (p Poll, err error) {
+	err = b.db.View(func(tx *bolt.Tx) error {
+		p, err = b.load(tx, locator)
+		return err
+	})
+	return p, err
+}
+
+// Set adds or replaces poll of the post
+func (b *Bolt) Set(p Poll) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return b.save(tx, p)
+	})
+}
+
+// Delete removes poll of the post
+func (b *Bolt) Delete(locator store.Locator) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(locator.SiteID))
+		if bkt == nil || bkt.Get([]byte(locator.URL)) == nil {
+			return ErrNotFound
+		}
+		return bkt.Delete([]byte(locator.URL))
+	})
+}
+
+// Vote sets user's vote in the poll of the post and returns updated poll
+func (b *Bolt) Vote(locator store.Locator, userID string, option int, ts time.Time) (p Poll, err error) {
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		if p, err = b.load(tx, locator); err != nil {
+			return err
+		}
+		if err = p.vote(userID, option, ts); err != nil {
+			return err
+		}
+		return b.save(tx, p)
+	})
+	return p, err
+}
+
+// Close bolt store
+func (b *Bolt) Close() error {
+	if err := b.db.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", b.fileName, err)
+	}
+	return nil
+}
+
+func (b *Bolt) load(tx *bolt.Tx, locator store.Locator) (p Poll, err error) {
+	bkt := tx.Bucket([]byte(locator.SiteID))
+	if bkt == nil {
+		return p, ErrNotFound
+	}
+	data := bkt.Get([]byte(locator.URL))
+	if data == nil {
+		return p, ErrNotFound
+	}
+	if err = json.Unmarshal(data, &p); err != nil {
+		return p, fmt.Errorf("failed to unmarshal poll for %+v: %w", locator, err)
+	}
+	return p, nil
+}
+
+func (b *Bolt) save(tx *bolt.Tx, p Poll) error {
+	bkt, err := tx.CreateBucketIfNotExists([]byte(p.Locator.SiteID))
+	if err != nil {
+		return fmt.Errorf("failed to create bucket %s: %w", p.Locator.SiteID, err)
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("failed to marshal poll for %+v: %w", p.Locator, err)
+	}
+	return bkt.Put([]byte(p.Locator.URL), data)
+}
@@ -0,0 +1,62 @@
+package poll
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/umputun/remark42/backend/app/store"
+)
+
+func TestBolt_Polls(t *testing.T) {
+	svc, teardown := prepareBoltPollStorageTest(t)
+	defer teardown()
+	locator := store.Locator{SiteID: "site1", URL: "https://example.com/post1"}
+	now := time.Now()
+
+	_, err := svc.Get(locator)
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = svc.Vote(locator, "u1", 0, now)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, svc.Delete(locator), ErrNotFound)
+
+	require.NoError(t, svc.Set(Poll{Locator: locator, Question: "q?", Options: []string{"a", "b"}, Created: now}))
+	p, err := svc.Vote(locator, "u1", 1, now)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"u1": 1}, p.Votes)
+	_, err = svc.Vote(locator, "u2", 5, now)
+	assert.EqualError(t, err, "invalid poll option 5")
+
+	p, err = svc.Get(locator)
+	require.NoError(t, err)
+	assert.Equal(t, "q?", p.Question)
+	assert.Equal(t, map[string]int{"u1": 1}, p.Votes)
+
+	_, err = svc.Get(store.Locator{SiteID: "site1", URL: "https://example.com/post2"})
+	assert.ErrorIs(t, err, ErrNotFound, "other post")
+	_, err = svc.Get(store.Locator{SiteID: "site2", URL: locator.URL})
+	assert.ErrorIs(t, err, ErrNotFound, "other site")
+
+	require.NoError(t, svc.Delete(locator))
+	_, err = svc.Get(locator)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func prepareBoltPollStorageTest(t *testing.T) (svc *Bolt, teardown func()) {
+	loc, err := os.MkdirTemp("", "test_poll_r42")
+	require.NoError(t, err, "failed to make temp dir")
+
+	svc, err = NewBoltStorage(path.Join(loc, "polls.db"), bolt.Options{})
+	require.NoError(t, err, "new bolt storage")
+
+	teardown = func() {
+		assert.NoError(t, svc.Close())
+		assert.NoError(t, os.RemoveAll(loc))
+	}
+	return svc, teardown
+}
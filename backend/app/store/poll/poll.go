@@ -0,0 +1,110 @@
+// Package poll provides polls attached to posts, with per-user votes and results aggregation.
+package poll
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/umputun/remark42/backend/app/store"
+)
+
+// ErrNotFound returned if post has no poll
+var ErrNotFound = errors.New("poll not found")
+
+const maxOptions = 20
+
+// Poll is a question with options attached to the post
+type Poll struct {
+	Locator  store.Locator  `json:"locator"`
+	Question string         `json:"question"`
+	Options  []string       `json:"options"`
+	CloseAt  time.Time      `json:"close_at,omitzero"` // voting closed after that time, never if zero
+	Created  time.Time      `json:"created"`
+	Votes    map[string]int `json:"votes,omitempty"` // user id to voted option index
+}
+
+// Store defines interface to keep polls, one poll per post
+type Store interface {
+	Get(locator store.Locator) (Poll, error)
+	Set(p Poll) error
+	Delete(locator store.Locator) error
+	Vote(locator store.Locator, userID string, option int, ts time.Time) (Poll, error)
+	Close() error
+}
+
+// Results is aggregated poll state for the user, without votes of other users
+type Results struct {
+	Question string    `json:"question"`
+	Options  []Option  `json:"options"`
+	Total    int       `json:"total"`
+	CloseAt  time.Time `json:"close_at,omitzero"`
+	Closed   bool      `json:"closed"`
+	Voted    int       `json:"voted"` // option index voted by the user, -1 if not voted
+}
+
+// Option is a poll option with number of votes
+type Option struct {
+	Text  string `json:"text"`
+	Votes int    `json:"votes"`
+}
+
+// Validate checks poll question and options
+func (p Poll) Validate() error {
+	if strings.TrimSpace(p.Question) == "" {
+		return errors.New("poll question can't be empty")
+	}
+	if len(p.Options) < 2 || len(p.Options) > maxOptions {
+		return fmt.Errorf("poll should have from 2 to %d options", maxOptions)
+	}
+	for _, o := range p.Options {
+		if strings.TrimSpace(o) == "" {
+			return errors.New("poll option can't be empty")
+		}
+	}
+	return nil
+}
+
+// Closed checks if voting closed at the given time
+func (p Poll) Closed(ts time.Time) bool {
+	return !p.CloseAt.IsZero() && !ts.Before(p.CloseAt)
+}
+
+// Results aggregates votes, with option voted by the user
+func (p Poll) Results(userID string, ts time.Time) Results {
+	res := Results{Question: p.Question, Options: make([]Option, len(p.Options)), CloseAt: p.CloseAt,
+		Closed: p.Closed(ts), Voted: -1}
+	for i, o := range p.Options {
+		res.Options[i].Text = o
+	}
+	for uid, v := range p.Votes {
+		if v < 0 || v >= len(res.Options) {
+			continue
+		}
+		res.Options[v].Votes++
+		res.Total++
+		if userID != "" && uid == userID {
+			res.Voted = v
+		}
+	}
+	return res
+}
+
+// vote sets user's vote, changes previous vote of the user if any
+func (p *Poll) vote(userID string, option int, ts time.Time) error {
+	if userID == "" {
+		return errors.New("anonymous vote not allowed")
+	}
+	if p.Closed(ts) {
+		return errors.New("poll closed")
+	}
+	if option < 0 || option >= len(p.Options) {
+		return fmt.Errorf("invalid poll option %d", option)
+	}
+	if p.Votes == nil {
+		p.Votes = map[string]int{}
+	}
+	p.Votes[userID] = option
+	return nil
+}
@@ -0,0 +1,51 @@
+package poll
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPoll_Validate(t *testing.T) {
+	tbl := []struct {
+		poll Poll
+		err  string
+	}{
+		{Poll{Question: "q?", Options: []string{"a", "b"}}, ""},
+		{Poll{Question: " ", Options: []string{"a", "b"}}, "poll question can't be empty"},
+		{Poll{Question: "q?", Options: []string{"a"}}, "poll should have from 2 to 20 options"},
+		{Poll{Question: "q?", Options: make([]string, 21)}, "poll should have from 2 to 20 options"},
+		{Poll{Question: "q?", Options: []string{"a", ""}}, "poll option can't be empty"},
+	}
+	for i, tt := range tbl {
+		err := tt.poll.Validate()
+		if tt.err == "" {
+			assert.NoError(t, err, "check #%d", i)
+			continue
+		}
+		assert.EqualError(t, err, tt.err, "check #%d", i)
+	}
+}
+
+func TestPoll_VoteAndResults(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	p := Poll{Question: "q?", Options: []string{"a", "b", "c"}, CloseAt: now.Add(time.Hour)}
+
+	require.NoError(t, p.vote("u1", 0, now))
+	require.NoError(t, p.vote("u2", 2, now))
+	require.NoError(t, p.vote("u3", 2, now))
+	require.NoError(t, p.vote("u1", 1, now), "vote changed")
+	assert.EqualError(t, p.vote("u4", 3, now), "invalid poll option 3")
+	assert.EqualError(t, p.vote("u4", -1, now), "invalid poll option -1")
+	assert.EqualError(t, p.vote("", 0, now), "anonymous vote not allowed")
+	assert.EqualError(t, p.vote("u4", 0, now.Add(time.Hour)), "poll closed")
+
+	assert.Equal(t, Results{Question: "q?", Options: []Option{{"a", 0}, {"b", 1}, {"c", 2}}, Total: 3,
+		CloseAt: now.Add(time.Hour), Voted: 1}, p.Results("u1", now))
+	res := p.Results("", now.Add(2*time.Hour))
+	assert.Equal(t, -1, res.Voted)
+	assert.True(t, res.Closed)
+	assert.False(t, Poll{}.Closed(now), "never closed without close time")
+}
@@ -0,0 +1,174 @@
+package quota
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	usagePrefix = "usage:"  // key prefix of period's usage
+	storageKey  = "storage" // total storage of the site, big-endian
+	limitsKey   = "limits"
+)
+
+// Bolt implements Store with usage kept in bolt DB, in a bucket per site
+type Bolt struct {
+	fileName string
+	db       *bolt.DB
+}
+
+// NewBoltStorage makes bolt quota store
+func NewBoltStorage(fileName string, options bolt.Options) (*Bolt, error) {
+	db, err := bolt.Open(fileName, 0o600, &options) //nolint:gocritic //octalLiteral is OK as FileMode
+	if err != nil {
+		return nil, fmt.Errorf("failed to make boltdb for %s: %w", fileName, err)
+	}
+	return &Bolt{db: db, fileName: fileName}, nil
+}
+
+// Add adds counters of delta to the site's usage in the period and returns updated usage.
+// Storage is not bound to the period and accumulated over all of them.
+func (b *Bolt) Add(siteID, period string, delta Usage) (res Usage, err error) {
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		bkt, e := tx.CreateBucketIfNotExists([]byte(siteID))
+		if e != nil {
+			return fmt.Errorf("failed to create bucket %s: %w", siteID, e)
+		}
+		if res, e = readUsage(bkt, period); e != nil {
+			return e
+		}
+		res.Comments += delta.Comments
+		res.Notifications += delta.Notifications
+		res.Storage = max(res.Storage+delta.Storage, 0)
+		return writeUsage(bkt, res)
+	})
+	if err != nil {
+		return Usage{}, err
+	}
+	return res, nil
+}
+
+// Usage returns the site's usage in the period, empty if nothing used
+func (b *Bolt) Usage(siteID, period string) (res Usage, err error) {
+	err = b.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(siteID))
+		if bkt == nil {
+			res = Usage{Period: period}
+			return nil
+		}
+		res, err = readUsage(bkt, period)
+		return err
+	})
+	return res, err
+}
+
+// SetAlerted marks threshold of the resource alerted in the period, false if it or a higher one was already alerted
+func (b *Bolt) SetAlerted(siteID, period, resource string, threshold int) (updated bool, err error) {
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		bkt, e := tx.CreateBucketIfNotExists([]byte(siteID))
+		if e != nil {
+			return fmt.Errorf("failed to create bucket %s: %w", siteID, e)
+		}
+		usage, e := readUsage(bkt, period)
+		if e != nil {
+			return e
+		}
+		if usage.Alerted[resource] >= threshold {
+			return nil
+		}
+		if usage.Alerted == nil {
+			usage.Alerted = map[string]int{}
+		}
+		usage.Alerted[resource] = threshold
+		updated = true
+		return writeUsage(bkt, usage)
+	})
+	return updated, err
+}
+
+// Limits returns own limits of the site, false if not set
+func (b *Bolt) Limits(siteID string) (res Limits, found bool, err error) {
+	err = b.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(siteID))
+		if bkt == nil {
+			return nil
+		}
+		v := bkt.Get([]byte(limitsKey))
+		if v == nil {
+			return nil
+		}
+		found = true
+		if e := json.Unmarshal(v, &res); e != nil {
+			return fmt.Errorf("failed to unmarshal limits of %s: %w", siteID, e)
+		}
+		return nil
+	})
+	return res, found, err
+}
+
+// SetLimits sets own limits of the site
+func (b *Bolt) SetLimits(siteID string, limits Limits) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bkt, err := tx.CreateBucketIfNotExists([]byte(siteID))
+		if err != nil {
+			return fmt.Errorf("failed to create bucket %s: %w", siteID, err)
+		}
+		data, err := json.Marshal(limits)
+		if err != nil {
+			return fmt.Errorf("failed to marshal limits of %s: %w", siteID, err)
+		}
+		return bkt.Put([]byte(limitsKey), data)
+	})
+}
+
+// ResetLimits removes own limits of the site
+func (b *Bolt) ResetLimits(siteID string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(siteID))
+		if bkt == nil {
+			return nil
+		}
+		return bkt.Delete([]byte(limitsKey))
+	})
+}
+
+// Close bolt store
+func (b *Bolt) Close() error {
+	if err := b.db.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", b.fileName, err)
+	}
+	return nil
+}
+
+// readUsage reads usage of the period with total storage from the site's bucket
+func readUsage(bkt *bolt.Bucket, period string) (Usage, error) {
+	res := Usage{Period: period}
+	if v := bkt.Get([]byte(usagePrefix + period)); v != nil {
+		if err := json.Unmarshal(v, &res); err != nil {
+			return Usage{}, fmt.Errorf("failed to unmarshal usage of %s: %w", period, err)
+		}
+	}
+	res.Storage = 0
+	if v := bkt.Get([]byte(storageKey)); len(v) == 8 {
+		res.Storage = int64(binary.BigEndian.Uint64(v)) //nolint:gosec // written from non-negative int64
+	}
+	return res, nil
+}
+
+// writeUsage writes usage of the period and total storage to the site's bucket
+func writeUsage(bkt *bolt.Bucket, usage Usage) error {
+	storage := make([]byte, 8)
+	binary.BigEndian.PutUint64(storage, uint64(usage.Storage)) //nolint:gosec // never negative
+	if err := bkt.Put([]byte(storageKey), storage); err != nil {
+		return fmt.Errorf("failed to put storage: %w", err)
+	}
+	usage.Storage = 0
+	data, err := json.Marshal(usage)
+	if err != nil {
+		return fmt.Errorf("failed to marshal usage of %s: %w", usage.Period, err)
+	}
+	return bkt.Put([]byte(usagePrefix+usage.Period), data)
+}
@@ -0,0 +1,103 @@
+package quota
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestBolt_Usage(t *testing.T) {
+	svc, teardown := prepareBoltQuotaStorageTest(t)
+	defer teardown()
+
+	res, err := svc.Usage("site1", "2026-10")
+	require.NoError(t, err)
+	assert.Equal(t, Usage{Period: "2026-10"}, res, "unknown site")
+
+	_, err = svc.Add("site1", "2026-10", Usage{Comments: 1, Storage: 100})
+	require.NoError(t, err)
+	res, err = svc.Add("site1", "2026-10", Usage{Comments: 1, Notifications: 2, Storage: 50})
+	require.NoError(t, err)
+	assert.Equal(t, Usage{Period: "2026-10", Comments: 2, Notifications: 2, Storage: 150}, res)
+
+	res, err = svc.Add("site1", "2026-11", Usage{Comments: 1, Storage: 10})
+	require.NoError(t, err)
+	assert.Equal(t, Usage{Period: "2026-11", Comments: 1, Storage: 160}, res, "storage accumulated over periods")
+
+	res, err = svc.Add("site1", "2026-11", Usage{Storage: -500})
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), res.Storage, "never negative")
+
+	res, err = svc.Usage("site1", "2026-10")
+	require.NoError(t, err)
+	assert.Equal(t, Usage{Period: "2026-10", Comments: 2, Notifications: 2}, res)
+
+	res, err = svc.Usage("site2", "2026-10")
+	require.NoError(t, err)
+	assert.Equal(t, Usage{Period: "2026-10"}, res, "separate usage per site")
+}
+
+func TestBolt_SetAlerted(t *testing.T) {
+	svc, teardown := prepareBoltQuotaStorageTest(t)
+	defer teardown()
+
+	ok, err := svc.SetAlerted("site1", "2026-10", Comments, 80)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = svc.SetAlerted("site1", "2026-10", Comments, 80)
+	require.NoError(t, err)
+	assert.False(t, ok, "already alerted")
+	ok, err = svc.SetAlerted("site1", "2026-10", Comments, 50)
+	require.NoError(t, err)
+	assert.False(t, ok, "higher one alerted")
+	ok, err = svc.SetAlerted("site1", "2026-10", Comments, 100)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = svc.SetAlerted("site1", "2026-11", Comments, 80)
+	require.NoError(t, err)
+	assert.True(t, ok, "new period")
+
+	res, err := svc.Add("site1", "2026-10", Usage{Comments: 1})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{Comments: 100}, res.Alerted)
+	assert.Equal(t, int64(1), res.Comments)
+}
+
+func TestBolt_Limits(t *testing.T) {
+	svc, teardown := prepareBoltQuotaStorageTest(t)
+	defer teardown()
+
+	_, found, err := svc.Limits("site1")
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	require.NoError(t, svc.SetLimits("site1", Limits{Comments: 100, Storage: 1000}))
+	res, found, err := svc.Limits("site1")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, Limits{Comments: 100, Storage: 1000}, res)
+	assert.Equal(t, int64(1000), res.Get(Storage))
+	assert.Equal(t, int64(0), res.Get("unknown"))
+
+	require.NoError(t, svc.ResetLimits("site1"))
+	_, found, err = svc.Limits("site1")
+	require.NoError(t, err)
+	assert.False(t, found)
+	require.NoError(t, svc.ResetLimits("site2"), "unknown site")
+}
+
+func prepareBoltQuotaStorageTest(t *testing.T) (svc *Bolt, teardown func()) {
+	loc, err := os.MkdirTemp("", "test_quota_r42")
+	require.NoError(t, err, "failed to make temp dir")
+	svc, err = NewBoltStorage(path.Join(loc, "quota.db"), bolt.Options{})
+	require.NoError(t, err, "new bolt storage")
+	teardown = func() {
+		assert.NoError(t, svc.Close())
+		assert.NoError(t, os.RemoveAll(loc))
+	}
+	return svc, teardown
+}
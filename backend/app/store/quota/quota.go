@@ -0,0 +1,59 @@
+// Package quota keeps usage of hosted resources by the sites, like comments and notification sends per month,
+// and sites' own usage limits.
+package quota
+
+// Resources tracked by quota
+const (
+	Comments      = "comments"
+	Notifications = "notifications"
+	Storage       = "storage"
+)
+
+// Usage is the site's usage in the period
+type Usage struct {
+	Period        string         `json:"period"` // month, like "2026-10"
+	Comments      int64          `json:"comments"`
+	Notifications int64          `json:"notifications"`
+	Storage       int64          `json:"storage"`           // bytes of comments text, total for all periods
+	Alerted       map[string]int `json:"alerted,omitempty"` // resource -> highest threshold alerted in the period, percent
+}
+
+// Get returns the counter of resource
+func (u Usage) Get(resource string) int64 {
+	switch resource {
+	case Comments:
+		return u.Comments
+	case Notifications:
+		return u.Notifications
+	case Storage:
+		return u.Storage
+	}
+	return 0
+}
+
+// Limits of the site's usage, zero is unlimited
+type Limits struct {
+	Comments      int64 `json:"comments"`      // comments per month
+	Notifications int64 `json:"notifications"` // notification sends per month
+	Storage       int64 `json:"storage"`       // bytes of comments text
+}
+
+// Get returns the limit of resource
+func (l Limits) Get(resource string) int64 {
+	return Usage{Comments: l.Comments, Notifications: l.Notifications, Storage: l.Storage}.Get(resource)
+}
+
+// Store defines interface to keep usage and limits of the sites
+type Store interface {
+	// Add adds counters of delta to the site's usage in the period and returns updated usage
+	Add(siteID, period string, delta Usage) (Usage, error)
+	// Usage returns the site's usage in the period
+	Usage(siteID, period string) (Usage, error)
+	// SetAlerted marks threshold of the resource alerted in the period, false if it or a higher one was already alerted
+	SetAlerted(siteID, period, resource string, threshold int) (bool, error)
+	// Limits returns own limits of the site, false if not set
+	Limits(siteID string) (Limits, bool, error)
+	SetLimits(siteID string, limits Limits) error
+	ResetLimits(siteID string) error
+	Close() error
+}
@@ -0,0 +1,110 @@
+package schedule
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Bolt implements Store with a bucket per site, keyed by action id
+type Bolt struct {
+	fileName string
+	db       *bolt.DB
+}
+
+// NewBoltStorage makes bolt schedule store
+func NewBoltStorage(fileName string, options bolt.Options) (*Bolt, error) {
+	db, err := bolt.Open(fileName, 0o600, &options) //nolint:gocritic //octalLiteral is OK as FileMode
+	if err != nil {
+		return nil, fmt.Errorf("failed to make boltdb for %s: %w", fileName, err)
+	}
+	return &Bolt{db: db, fileName: fileName}, nil
+}
+
+// Add saves the action, replacing one with the same id
+func (b *Bolt) Add(a Action) error {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return fmt.Errorf("failed to marshal action %s: %w", a.ID, err)
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bkt, e := tx.CreateBucketIfNotExists([]byte(a.SiteID))
+		if e != nil {
+			return fmt.Errorf("failed to create bucket %s: %w", a.SiteID, e)
+		}
+		return bkt.Put([]byte(a.ID), data)
+	})
+}
+
+// List returns actions of the site, earliest due first
+func (b *Bolt) List(siteID string) ([]Action, error) {
+	res := []Action{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(siteID))
+		if bkt == nil {
+			return nil
+		}
+		return forEachAction(bkt, func(a Action) { res = append(res, a) })
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortByDue(res)
+	return res, nil
+}
+
+// Due returns actions of all sites due at ts, earliest due first
+func (b *Bolt) Due(ts time.Time) ([]Action, error) {
+	res := []Action{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(_ []byte, bkt *bolt.Bucket) error {
+			return forEachAction(bkt, func(a Action) {
+				if !a.Due.After(ts) {
+					res = append(res, a)
+				}
+			})
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortByDue(res)
+	return res, nil
+}
+
+// Delete removes the action of the site
+func (b *Bolt) Delete(siteID, id string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(siteID))
+		if bkt == nil || bkt.Get([]byte(id)) == nil {
+			return ErrNotFound
+		}
+		return bkt.Delete([]byte(id))
+	})
+}
+
+// Close bolt store
+func (b *Bolt) Close() error {
+	if err := b.db.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", b.fileName, err)
+	}
+	return nil
+}
+
+func forEachAction(bkt *bolt.Bucket, fn func(a Action)) error {
+	return bkt.ForEach(func(k, v []byte) error {
+		a := Action{}
+		if err := json.Unmarshal(v, &a); err != nil {
+			return fmt.Errorf("failed to unmarshal action %s: %w", k, err)
+		}
+		fn(a)
+		return nil
+	})
+}
+
+func sortByDue(actions []Action) {
+	slices.SortStableFunc(actions, func(a, b Action) int { return a.Due.Compare(b.Due) })
+}
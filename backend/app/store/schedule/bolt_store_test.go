@@ -0,0 +1,63 @@
+package schedule
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestBolt_Actions(t *testing.T) {
+	svc, teardown := prepareBoltScheduleStorageTest(t)
+	defer teardown()
+	ts := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	res, err := svc.List("site1")
+	require.NoError(t, err)
+	assert.Empty(t, res)
+
+	a1 := Action{ID: "id1", SiteID: "site1", Type: Unblock, UserID: "user1", Notify: true, Due: ts.Add(2 * time.Hour),
+		CreatedBy: "admin", Created: ts}
+	a2 := Action{ID: "id2", SiteID: "site1", Type: DeleteThread, URL: "https://example.com/post", Due: ts.Add(time.Hour),
+		CreatedBy: "admin", Created: ts}
+	a3 := Action{ID: "id3", SiteID: "site2", Type: ReadOnly, URL: "https://example.com/post2", Due: ts.Add(90 * time.Minute),
+		CreatedBy: "admin", Created: ts}
+	require.NoError(t, svc.Add(a1))
+	require.NoError(t, svc.Add(a2))
+	require.NoError(t, svc.Add(a3))
+
+	res, err = svc.List("site1")
+	require.NoError(t, err)
+	assert.Equal(t, []Action{a2, a1}, res, "earliest due first")
+
+	res, err = svc.Due(ts.Add(30 * time.Minute))
+	require.NoError(t, err)
+	assert.Empty(t, res)
+	res, err = svc.Due(ts.Add(90 * time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, []Action{a2, a3}, res, "due on all sites")
+
+	require.NoError(t, svc.Delete("site1", "id2"))
+	require.ErrorIs(t, svc.Delete("site1", "id2"), ErrNotFound)
+	require.ErrorIs(t, svc.Delete("site1", "id3"), ErrNotFound, "other site's action")
+	require.ErrorIs(t, svc.Delete("site3", "id1"), ErrNotFound)
+	res, err = svc.Due(ts.Add(3 * time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []Action{a3, a1}, res)
+}
+
+func prepareBoltScheduleStorageTest(t *testing.T) (svc *Bolt, teardown func()) {
+	loc, err := os.MkdirTemp("", "test_schedule_r42")
+	require.NoError(t, err, "failed to make temp dir")
+	svc, err = NewBoltStorage(path.Join(loc, "schedule.db"), bolt.Options{})
+	require.NoError(t, err, "new bolt storage")
+	teardown = func() {
+		assert.NoError(t, svc.Close())
+		assert.NoError(t, os.RemoveAll(loc))
+	}
+	return svc, teardown
+}
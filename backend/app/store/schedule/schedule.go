@@ -0,0 +1,43 @@
+// Package schedule provides moderation actions scheduled for later, like deletion of a thread or unblocking of a user
+package schedule
+
+import (
+	"errors"
+	"time"
+)
+
+// Types of scheduled actions
+const (
+	DeleteThread  = "delete_thread"  // delete all comments of the post
+	DeleteComment = "delete_comment" // delete the comment
+	ReadOnly      = "readonly"       // make the post read-only
+	Unblock       = "unblock"        // unblock the user, notifying them if Notify set
+)
+
+// ErrNotFound returned for unknown action
+var ErrNotFound = errors.New("scheduled action not found")
+
+// Action is a moderation action on the site, executed when it's due
+type Action struct {
+	ID        string    `json:"id"`
+	SiteID    string    `json:"site"`
+	Type      string    `json:"type"`
+	URL       string    `json:"url,omitempty"`
+	CommentID string    `json:"comment_id,omitempty"`
+	UserID    string    `json:"user_id,omitempty"`
+	Notify    bool      `json:"notify,omitempty"`
+	Due       time.Time `json:"due"`
+	CreatedBy string    `json:"created_by"`
+	Created   time.Time `json:"created"`
+}
+
+// Store defines interface to keep scheduled actions
+type Store interface {
+	Add(a Action) error
+	// List returns actions of the site, earliest due first
+	List(siteID string) ([]Action, error)
+	// Due returns actions of all sites due at ts, earliest due first
+	Due(ts time.Time) ([]Action, error)
+	Delete(siteID, id string) error
+	Close() error
+}
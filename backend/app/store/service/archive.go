@@ -0,0 +1,124 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha1" //nolint:gosec // used for asset name only
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/asset"
+	"github.com/umputun/remark42/backend/app/store/engine"
+	"github.com/umputun/remark42/backend/app/store/event"
+	"github.com/umputun/remark42/backend/app/templates"
+)
+
+const (
+	maxArchiveIndent   = 10 // limits nesting of replies on the archive page
+	archiveContentType = "text/html; charset=utf-8"
+)
+
+// ArchiveName returns name of the asset with static archive of the post
+func ArchiveName(url string) string {
+	h := sha1.Sum([]byte(url)) //nolint:gosec // not a security hash
+	return "archive-" + hex.EncodeToString(h[:]) + ".html"
+}
+
+// ArchiveThread renders comments of the closed post to a static html page saved as site's asset named by
+// ArchiveName, html type allowed for archives only. The archive is public, so only comments visible to anonymous
+// users are rendered. Archived comments are hard-deleted from the engine after that if remove is set, hidden ones
+// are kept. The post is closed if it's read-only or older than readOnlyAge days.
+func (s *DataStore) ArchiveThread(locator store.Locator, readOnlyAge int, remove bool) (asset.Asset, error) {
+	if s.AssetStore == nil {
+		return asset.Asset{}, errAssetsDisabled
+	}
+	info, err := s.Info(locator, readOnlyAge)
+	if err != nil {
+		return asset.Asset{}, fmt.Errorf("can't get post info: %w", err)
+	}
+	if !info.ReadOnly {
+		return asset.Asset{}, fmt.Errorf("post %s is not closed", locator.URL)
+	}
+	comments, err := s.Engine.Find(engine.FindRequest{Locator: locator, Sort: "time"})
+	if err != nil {
+		return asset.Asset{}, fmt.Errorf("can't get comments of %s: %w", locator.URL, err)
+	}
+	comments = visibleComments(comments, store.User{})
+	page, err := renderArchive(locator, comments, "archived "+time.Now().UTC().Format("Jan 2, 2006"))
+	if err != nil {
+		return asset.Asset{}, err
+	}
+	a, err := s.saveAsset(locator.SiteID, ArchiveName(locator.URL), archiveContentType, bytes.NewReader(page))
+	if err != nil {
+		return asset.Asset{}, err
+	}
+	log.Printf("[INFO] post %s on %s archived to %s, %d comments", locator.URL, locator.SiteID, a.Name, len(comments))
+
+	if remove {
+		for _, c := range comments {
+			if c.Deleted {
+				continue
+			}
+			if err = s.Delete(locator, c.ID, store.HardDelete); err != nil {
+				return a, fmt.Errorf("archived, but can't remove comment %s: %w", c.ID, err)
+			}
+		}
+		log.Printf("[INFO] comments of archived post %s on %s removed", locator.URL, locator.SiteID)
+	}
+	s.emit(event.Event{Type: event.PostArchived, SiteID: locator.SiteID, URL: locator.URL,
+		Data: map[string]any{"asset": a.Name, "removed": remove}})
+	return a, nil
+}
+
+// renderArchive makes self-contained html page of comments sorted by time, replies indented under parents.
+// The note is shown in the page header after number of comments.
+func renderArchive(locator store.Locator, comments []store.Comment, note string) ([]byte, error) {
+	type archiveComment struct {
+		ID, Name, Time string
+		Text           template.HTML
+		Score, Indent  int
+		Deleted        bool
+	}
+	data := struct {
+		Site, URL, Title, Note string
+		Count                  int
+		Comments               []archiveComment
+	}{Site: locator.SiteID, URL: locator.URL, Note: note}
+
+	levels := map[string]int{}
+	for _, c := range comments {
+		level := 0
+		if l, ok := levels[c.ParentID]; ok && c.ParentID != "" {
+			level = l + 1
+		}
+		levels[c.ID] = level
+		if data.Title == "" {
+			data.Title = c.PostTitle
+		}
+		if !c.Deleted {
+			data.Count++
+		}
+		data.Comments = append(data.Comments, archiveComment{ID: c.ID, Name: c.User.Name, Score: c.Score,
+			Time: c.Timestamp.UTC().Format("Jan 2, 2006 at 15:04 UTC"), Deleted: c.Deleted,
+			Text:   template.HTML(c.Text), //nolint:gosec // text sanitized on comment creation
+			Indent: min(level, maxArchiveIndent) * 2})
+	}
+
+	tmplstr, err := templates.Read("archive.html.tmpl")
+	if err != nil {
+		return nil, fmt.Errorf("can't read archive template: %w", err)
+	}
+	tmpl, err := template.New("archive").Parse(string(tmplstr))
+	if err != nil {
+		return nil, fmt.Errorf("can't parse archive template: %w", err)
+	}
+	buf := bytes.Buffer{}
+	if err = tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("can't render archive: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/asset"
+)
+
+func TestService_ArchiveThread(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+	locator := store.Locator{SiteID: "radio-t", URL: "https://radio-t.com"}
+
+	_, err := b.ArchiveThread(locator, 0, false)
+	require.EqualError(t, err, "assets disabled")
+
+	b.AssetStore, err = asset.NewBoltStorage(path.Join(t.TempDir(), "assets.db"), bolt.Options{})
+	require.NoError(t, err)
+	defer b.AssetStore.Close()
+
+	_, err = b.ArchiveThread(locator, 0, false)
+	require.EqualError(t, err, "post https://radio-t.com is not closed")
+	_, err = b.ArchiveThread(store.Locator{SiteID: "radio-t", URL: "https://radio-t.com/unknown"}, 10, false)
+	require.Error(t, err)
+
+	_, err = b.Create(store.Comment{ID: "id-3", ParentID: "id-1", Text: "reply <b>text</b>", Locator: locator,
+		User: store.User{ID: "user2", Name: "user2"}})
+	require.NoError(t, err)
+	require.NoError(t, b.Delete(locator, "id-2", store.SoftDelete))
+	for _, c := range []store.Comment{
+		{ID: "staff", Text: "staff only text", Visibility: store.VisibilityStaff},
+		{ID: "private", Text: "private text", Visibility: store.VisibilityPrivate, PrivateTo: "user1"},
+		{ID: "pending", Text: "pending text", Visibility: store.VisibilityPending},
+	} {
+		c.Locator, c.User = locator, store.User{ID: "user2", Name: "user2"}
+		_, err = eng.Create(c)
+		require.NoError(t, err)
+	}
+
+	a, err := b.ArchiveThread(locator, 1, false) // old enough to be closed
+	require.NoError(t, err)
+	assert.Equal(t, ArchiveName("https://radio-t.com"), a.Name)
+	assert.Equal(t, "archive-35f85561efa1dcfa224238b1292c7debd37d4d17.html", a.Name)
+	assert.Equal(t, "text/html; charset=utf-8", a.ContentType)
+
+	a, err = b.Asset("radio-t", a.Name)
+	require.NoError(t, err)
+	page := string(a.Data)
+	assert.Contains(t, page, `<a href="https://radio-t.com">https://radio-t.com</a>`)
+	assert.Contains(t, page, "2 comments on radio-t")
+	assert.Contains(t, page, `some text, <a href="http://radio-t.com">link</a>`)
+	assert.Contains(t, page, "This comment was deleted")
+	assert.NotContains(t, page, "some text2")
+	assert.Contains(t, page, `<div class="comment" id="id-3" style="margin-left: 2em">`, "reply indented")
+	assert.Contains(t, page, "reply <b>text</b>")
+	assert.Contains(t, page, "<b>user2</b>")
+	for _, hidden := range []string{"staff only text", "private text", "pending text", `id="staff"`, `id="private"`, `id="pending"`} {
+		assert.NotContains(t, page, hidden)
+	}
+
+	comments, err := b.Find(locator, "time", store.User{})
+	require.NoError(t, err)
+	assert.Len(t, comments, 3, "comments kept")
+	comments, err = b.Find(locator, "time", store.User{Admin: true})
+	require.NoError(t, err)
+	assert.Len(t, comments, 6, "hidden comments kept")
+
+	require.NoError(t, b.SetReadOnly(locator, true))
+	_, err = b.ArchiveThread(locator, 0, true)
+	require.NoError(t, err)
+	comments, err = b.Find(locator, "time", store.User{})
+	require.NoError(t, err)
+	require.Len(t, comments, 3)
+	for _, c := range comments {
+		assert.True(t, c.Deleted)
+		assert.Empty(t, c.Text)
+	}
+	comments, err = b.Find(locator, "time", store.User{Admin: true})
+	require.NoError(t, err)
+	require.Len(t, comments, 6)
+	for _, c := range comments {
+		assert.Equal(t, c.Visibility == "", c.Deleted, "hidden comments not archived and not removed, %s", c.ID)
+	}
+	a, err = b.Asset("radio-t", ArchiveName("https://radio-t.com"))
+	require.NoError(t, err)
+	assert.Contains(t, string(a.Data), "reply <b>text</b>", "archive made before removal")
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/umputun/remark42/backend/app/store/asset"
+)
+
+var errAssetsDisabled = errors.New("assets disabled")
+
+// AssetLimits caps sizes of site assets, unlimited if zero
+type AssetLimits struct {
+	MaxSize     int // max size of a single asset
+	MaxSiteSize int // max total size of site's assets
+}
+
+// SaveAsset validates and saves site's asset read from rd, replaces existing asset with the same name
+func (s *DataStore) SaveAsset(siteID, name string, rd io.Reader) (asset.Asset, error) {
+	if s.AssetStore == nil {
+		return asset.Asset{}, errAssetsDisabled
+	}
+	contentType, ok := asset.ContentType(name)
+	if !ok {
+		return asset.Asset{}, fmt.Errorf("invalid asset name %q", name)
+	}
+	return s.saveAsset(siteID, name, contentType, rd)
+}
+
+// saveAsset checks limits and saves the asset of given content type
+func (s *DataStore) saveAsset(siteID, name, contentType string, rd io.Reader) (asset.Asset, error) {
+	if s.AssetLimits.MaxSize > 0 {
+		rd = io.LimitReader(rd, int64(s.AssetLimits.MaxSize)+1) // one byte over the limit is enough to reject
+	}
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		return asset.Asset{}, fmt.Errorf("can't read asset: %w", err)
+	}
+	if len(data) == 0 {
+		return asset.Asset{}, errors.New("empty asset")
+	}
+	if s.AssetLimits.MaxSize > 0 && len(data) > s.AssetLimits.MaxSize {
+		return asset.Asset{}, fmt.Errorf("asset size exceeds limit %d", s.AssetLimits.MaxSize)
+	}
+	if s.AssetLimits.MaxSiteSize > 0 {
+		assets, e := s.AssetStore.List(siteID)
+		if e != nil {
+			return asset.Asset{}, fmt.Errorf("can't list assets of %s: %w", siteID, e)
+		}
+		total := len(data)
+		for _, a := range assets {
+			if a.Name != name { // replaced asset not counted
+				total += a.Size
+			}
+		}
+		if total > s.AssetLimits.MaxSiteSize {
+			return asset.Asset{}, fmt.Errorf("total size of site assets %d exceeds limit %d", total, s.AssetLimits.MaxSiteSize)
+		}
+	}
+
+	hash := sha256.Sum256(data)
+	a := asset.Asset{SiteID: siteID, Name: name, ContentType: contentType, Size: len(data),
+		Hash: hex.EncodeToString(hash[:]), Timestamp: time.Now(), Data: data}
+	if err = s.AssetStore.Save(a); err != nil {
+		return asset.Asset{}, fmt.Errorf("can't save asset %s: %w", name, err)
+	}
+	a.Data = nil
+	return a, nil
+}
+
+// Asset returns site's asset with data
+func (s *DataStore) Asset(siteID, name string) (asset.Asset, error) {
+	if s.AssetStore == nil {
+		return asset.Asset{}, asset.ErrNotFound
+	}
+	return s.AssetStore.Load(siteID, name)
+}
+
+// AssetInfo returns site's asset without data
+func (s *DataStore) AssetInfo(siteID, name string) (asset.Asset, error) {
+	if s.AssetStore == nil {
+		return asset.Asset{}, asset.ErrNotFound
+	}
+	return s.AssetStore.Info(siteID, name)
+}
+
+// Assets returns site's assets without data, sorted by name
+func (s *DataStore) Assets(siteID string) ([]asset.Asset, error) {
+	if s.AssetStore == nil {
+		return []asset.Asset{}, nil
+	}
+	return s.AssetStore.List(siteID)
+}
+
+// DeleteAsset removes site's asset
+func (s *DataStore) DeleteAsset(siteID, name string) error {
+	if s.AssetStore == nil {
+		return errAssetsDisabled
+	}
+	return s.AssetStore.Delete(siteID, name)
+}
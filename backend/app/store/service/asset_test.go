@@ -0,0 +1,71 @@
+package service
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/asset"
+)
+
+func TestService_Assets(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+
+	_, err := b.SaveAsset("radio-t", "custom.css", strings.NewReader("body{}"))
+	require.EqualError(t, err, "assets disabled")
+	_, err = b.Asset("radio-t", "custom.css")
+	require.ErrorIs(t, err, asset.ErrNotFound)
+	res, err := b.Assets("radio-t")
+	require.NoError(t, err)
+	assert.Empty(t, res)
+
+	loc, err := os.MkdirTemp("", "test_asset_r42")
+	require.NoError(t, err)
+	defer os.RemoveAll(loc)
+	b.AssetStore, err = asset.NewBoltStorage(path.Join(loc, "assets.db"), bolt.Options{})
+	require.NoError(t, err)
+	defer b.AssetStore.Close()
+	b.AssetLimits = AssetLimits{MaxSize: 10, MaxSiteSize: 15}
+
+	a, err := b.SaveAsset("radio-t", "custom.css", strings.NewReader("body{}"))
+	require.NoError(t, err)
+	assert.Equal(t, "text/css; charset=utf-8", a.ContentType)
+	assert.Equal(t, 6, a.Size)
+	assert.Equal(t, "7c98040a541657584690ae2a1cc3b42a8b53b159cc60c5d3abbfecbaeac6c94a", a.Hash)
+	assert.Nil(t, a.Data)
+
+	a, err = b.Asset("radio-t", "custom.css")
+	require.NoError(t, err)
+	assert.Equal(t, "body{}", string(a.Data))
+
+	_, err = b.SaveAsset("radio-t", "logo.exe", strings.NewReader("x"))
+	require.EqualError(t, err, `invalid asset name "logo.exe"`)
+	_, err = b.SaveAsset("radio-t", "logo.png", strings.NewReader(""))
+	require.EqualError(t, err, "empty asset")
+	_, err = b.SaveAsset("radio-t", "logo.png", strings.NewReader("12345678901"))
+	require.EqualError(t, err, "asset size exceeds limit 10")
+	_, err = b.SaveAsset("radio-t", "logo.png", strings.NewReader("1234567890"))
+	require.EqualError(t, err, "total size of site assets 16 exceeds limit 15")
+	_, err = b.SaveAsset("radio-t", "custom.css", strings.NewReader("1234567890"))
+	require.NoError(t, err, "replaced asset not counted in total")
+	_, err = b.SaveAsset("radio-t", "logo.png", strings.NewReader("12345"))
+	require.NoError(t, err)
+
+	res, err = b.Assets("radio-t")
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	assert.Equal(t, "custom.css", res[0].Name)
+	assert.Equal(t, 10, res[0].Size)
+	assert.Equal(t, "logo.png", res[1].Name)
+
+	require.NoError(t, b.DeleteAsset("radio-t", "logo.png"))
+	require.ErrorIs(t, b.DeleteAsset("radio-t", "logo.png"), asset.ErrNotFound)
+}
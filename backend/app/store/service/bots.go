@@ -0,0 +1,103 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark42/backend/app/store/bot"
+)
+
+// botIDPrefix starts user ids of bots, so bots can't be confused with users of auth providers
+const botIDPrefix = "bot_"
+
+var errBotsDisabled = errors.New("bots disabled")
+
+// CreateBot makes bot account of the site and returns it with the api key. The key is returned once,
+// only its hash is stored, and has the bot id as prefix, "bot_id.secret", to find the bot without scanning.
+func (s *DataStore) CreateBot(siteID, name, picture, createdBy string) (res bot.Bot, key string, err error) {
+	if s.BotStore == nil {
+		return bot.Bot{}, "", errBotsDisabled
+	}
+	if strings.TrimSpace(name) == "" {
+		return bot.Bot{}, "", errors.New("bot name can't be empty")
+	}
+	id, secret := make([]byte, 8), make([]byte, 32)
+	for _, b := range [][]byte{id, secret} {
+		if _, err = rand.Read(b); err != nil {
+			return bot.Bot{}, "", fmt.Errorf("failed to make bot key: %w", err)
+		}
+	}
+	res = bot.Bot{ID: botIDPrefix + hex.EncodeToString(id), SiteID: siteID, Name: strings.TrimSpace(name), Picture: picture,
+		KeyHash: botKeyHash(hex.EncodeToString(secret)), CreatedBy: createdBy, Created: time.Now()}
+	if err = s.BotStore.Create(res); err != nil {
+		return bot.Bot{}, "", fmt.Errorf("failed to save bot: %w", err)
+	}
+	log.Printf("[INFO] bot %s %q created on %s by %s", res.ID, res.Name, siteID, createdBy)
+	res.KeyHash = ""
+	return res, res.ID + "." + hex.EncodeToString(secret), nil
+}
+
+// Bots returns bots of the site, oldest first, without key hashes
+func (s *DataStore) Bots(siteID string) ([]bot.Bot, error) {
+	if s.BotStore == nil {
+		return nil, errBotsDisabled
+	}
+	bots, err := s.BotStore.List(siteID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range bots {
+		bots[i].KeyHash = ""
+	}
+	return bots, nil
+}
+
+// DeleteBot removes the bot of the site, its api key stops working. Comments of the bot are kept.
+func (s *DataStore) DeleteBot(siteID, id string) error {
+	if s.BotStore == nil {
+		return errBotsDisabled
+	}
+	if err := s.BotStore.Delete(siteID, id); err != nil {
+		return err
+	}
+	log.Printf("[INFO] bot %s deleted on %s", id, siteID)
+	return nil
+}
+
+// BotByKey returns the bot of the site authenticated by the api key
+func (s *DataStore) BotByKey(siteID, key string) (bot.Bot, error) {
+	if s.BotStore == nil {
+		return bot.Bot{}, errBotsDisabled
+	}
+	id, secret, ok := strings.Cut(key, ".")
+	if !ok || !strings.HasPrefix(id, botIDPrefix) || secret == "" {
+		return bot.Bot{}, errors.New("malformed bot key")
+	}
+	res, err := s.BotStore.Get(siteID, id)
+	if err != nil {
+		return bot.Bot{}, err
+	}
+	if subtle.ConstantTimeCompare([]byte(res.KeyHash), []byte(botKeyHash(secret))) != 1 {
+		return bot.Bot{}, errors.New("wrong bot key")
+	}
+	res.KeyHash = ""
+	return res, nil
+}
+
+// IsBot checks if the user id belongs to a bot
+func IsBot(userID string) bool {
+	return strings.HasPrefix(userID, botIDPrefix)
+}
+
+func botKeyHash(secret string) string {
+	h := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(h[:])
+}
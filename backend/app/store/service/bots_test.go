@@ -0,0 +1,70 @@
+package service
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/bot"
+)
+
+func TestService_Bots(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+
+	_, _, err := b.CreateBot("radio-t", "bridge", "", "admin")
+	require.EqualError(t, err, "bots disabled")
+	_, err = b.Bots("radio-t")
+	require.EqualError(t, err, "bots disabled")
+	_, err = b.BotByKey("radio-t", "key")
+	require.EqualError(t, err, "bots disabled")
+	require.EqualError(t, b.DeleteBot("radio-t", "bot_1"), "bots disabled")
+
+	loc, err := os.MkdirTemp("", "test_bots_r42")
+	require.NoError(t, err)
+	defer os.RemoveAll(loc)
+	b.BotStore, err = bot.NewBoltStorage(path.Join(loc, "bots.db"), bolt.Options{})
+	require.NoError(t, err)
+	defer b.Close()
+
+	_, _, err = b.CreateBot("radio-t", " ", "", "admin")
+	require.EqualError(t, err, "bot name can't be empty")
+	bt, key, err := b.CreateBot("radio-t", " bridge ", "https://example.com/bot.png", "admin")
+	require.NoError(t, err)
+	assert.True(t, IsBot(bt.ID))
+	assert.Equal(t, "bridge", bt.Name)
+	assert.Empty(t, bt.KeyHash, "hash not returned")
+	assert.True(t, strings.HasPrefix(key, bt.ID+"."))
+
+	res, err := b.BotByKey("radio-t", key)
+	require.NoError(t, err)
+	assert.Equal(t, bt.ID, res.ID)
+	assert.Equal(t, "https://example.com/bot.png", res.Picture)
+	assert.Empty(t, res.KeyHash)
+	_, err = b.BotByKey("radio-t", key+"0")
+	assert.EqualError(t, err, "wrong bot key")
+	_, err = b.BotByKey("other", key)
+	assert.ErrorIs(t, err, bot.ErrNotFound, "key of other site")
+	_, err = b.BotByKey("radio-t", "github_123.secret")
+	assert.EqualError(t, err, "malformed bot key")
+
+	bots, err := b.Bots("radio-t")
+	require.NoError(t, err)
+	require.Len(t, bots, 1)
+	assert.Equal(t, bt.ID, bots[0].ID)
+	assert.Empty(t, bots[0].KeyHash)
+
+	assert.EqualError(t, b.SetRole("radio-t", bt.ID, RoleModerator), "bot "+bt.ID+" can't have a role")
+
+	require.NoError(t, b.DeleteBot("radio-t", bt.ID))
+	_, err = b.BotByKey("radio-t", key)
+	assert.ErrorIs(t, err, bot.ErrNotFound)
+	assert.False(t, IsBot("github_123"))
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/brigade"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+var errBrigadesDisabled = errors.New("vote brigading detection disabled")
+
+// recordVote passes new vote to brigading detector, if enabled. Voter's network is hashed the same way as ip.
+func (s *DataStore) recordVote(req VoteReq, ipHash, secret string) {
+	if s.Brigades == nil {
+		return
+	}
+	subnet := brigade.Subnet(req.UserIP)
+	if subnet != "" {
+		subnet = store.HashValue(subnet, secret)
+	}
+	s.Brigades.Record(brigade.Vote{Locator: req.Locator, CommentID: req.CommentID, UserID: req.UserID, IPHash: ipHash,
+		Subnet: subnet, NewUser: s.UserLevel(req.Locator.SiteID, req.UserID) == store.LevelNew, Value: req.Val, Time: time.Now()})
+}
+
+// BrigadeAlerts returns alerts of suspicious votes of the site, the newest first
+func (s *DataStore) BrigadeAlerts(siteID string) ([]brigade.Alert, error) {
+	if s.Brigades == nil {
+		return nil, errBrigadesDisabled
+	}
+	return s.Brigades.Alerts(siteID), nil
+}
+
+// DismissBrigade removes alert of the site, keeping its votes
+func (s *DataStore) DismissBrigade(siteID, id string) error {
+	if s.Brigades == nil {
+		return errBrigadesDisabled
+	}
+	return s.Brigades.Dismiss(siteID, id)
+}
+
+// VoidBrigade removes votes of the alert from the comment, updates its score and removes the alert.
+// Votes changed since the alert are kept. Returns the updated comment and number of removed votes.
+func (s *DataStore) VoidBrigade(siteID, id string) (comment store.Comment, voided int, err error) {
+	if s.Brigades == nil {
+		return store.Comment{}, 0, errBrigadesDisabled
+	}
+	alert, err := s.Brigades.Alert(siteID, id)
+	if err != nil {
+		return store.Comment{}, 0, err
+	}
+
+	cLock := s.getScopedLocks(alert.Locator.URL)
+	cLock.Lock()
+	defer cLock.Unlock()
+
+	comment, err = s.Engine.Get(engine.GetRequest{Locator: alert.Locator, CommentID: alert.CommentID})
+	if err != nil {
+		return store.Comment{}, 0, fmt.Errorf("can't get comment %s: %w", alert.CommentID, err)
+	}
+	prevWeighted := weightedVotes(comment)
+	for _, v := range alert.Votes {
+		if val, ok := comment.Votes[v.UserID]; !ok || val != v.Value {
+			continue
+		}
+		delete(comment.Votes, v.UserID)
+		delete(comment.VoteWeights, v.UserID)
+		if ip, ok := comment.VotedIPs[v.IPHash]; ok && ip.Value == v.Value {
+			delete(comment.VotedIPs, v.IPHash)
+		}
+		voided++
+	}
+	if voided > 0 {
+		comment.Score += int(math.Round(weightedVotes(comment)) - math.Round(prevWeighted))
+		comment.Controversy = s.controversy(s.upsAndDowns(comment))
+		comment.Locator = alert.Locator
+		if err = s.Engine.Update(comment); err != nil {
+			return store.Comment{}, 0, fmt.Errorf("can't update comment %s: %w", alert.CommentID, err)
+		}
+	}
+	if err = s.Brigades.Dismiss(siteID, id); err != nil {
+		log.Printf("[WARN] failed to dismiss alert %s of %s, %v", id, siteID, err)
+	}
+	log.Printf("[INFO] voided %d %s votes for comment %s of %s", voided, alert.Reason, alert.CommentID, alert.Locator.URL)
+	return comment, voided, nil
+}
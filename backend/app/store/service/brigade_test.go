@@ -0,0 +1,85 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/brigade"
+)
+
+func TestService_Brigades(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123"), MaxVotes: -1}
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	id, err := b.Create(store.Comment{Text: "text", Locator: locator, User: store.User{ID: "author", Name: "author"}})
+	require.NoError(t, err)
+
+	_, err = b.BrigadeAlerts("radio-t")
+	assert.ErrorIs(t, err, errBrigadesDisabled)
+	_, _, err = b.VoidBrigade("radio-t", "some-id")
+	assert.ErrorIs(t, err, errBrigadesDisabled)
+	assert.ErrorIs(t, b.DismissBrigade("radio-t", "some-id"), errBrigadesDisabled)
+
+	b.Brigades = &brigade.Detector{Window: time.Minute, MinVotes: 3}
+	vote := func(userID, ip string, val bool) {
+		_, e := b.Vote(VoteReq{Locator: locator, CommentID: id, UserID: userID, UserIP: ip, Val: val})
+		require.NoError(t, e)
+	}
+	vote("u1", "10.0.0.1", false)
+	vote("u2", "10.0.0.2", false)
+	vote("u3", "10.0.0.3", false)
+	vote("u4", "10.0.1.1", false)
+	vote("u5", "10.0.2.1", true)
+
+	c, err := b.Get(locator, id, store.User{Admin: true})
+	require.NoError(t, err)
+	assert.Equal(t, -3, c.Score)
+
+	alerts := b.Brigades.Analyze(time.Now())
+	require.Len(t, alerts, 1)
+	assert.Equal(t, brigade.ReasonSubnet, alerts[0].Reason)
+	assert.False(t, alerts[0].Value)
+	require.Len(t, alerts[0].Votes, 3)
+	assert.NotEqual(t, "10.0.0.0/24", alerts[0].Votes[0].Subnet, "network hashed")
+
+	res, err := b.BrigadeAlerts("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, alerts, res)
+
+	vote("u3", "10.0.0.3", true) // reset of the vote since the alert
+	c, voided, err := b.VoidBrigade("radio-t", alerts[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, voided)
+	assert.Equal(t, 0, c.Score, "u4 down and u5 up left")
+	assert.Equal(t, map[string]bool{"u4": false, "u5": true}, c.Votes)
+	assert.Len(t, c.VotedIPs, 2)
+	assert.InDelta(t, 2, c.Controversy, 0.01, "one up and one down")
+
+	c, err = b.Get(locator, id, store.User{Admin: true})
+	require.NoError(t, err)
+	assert.Equal(t, 0, c.Score, "stored")
+
+	res, err = b.BrigadeAlerts("radio-t")
+	require.NoError(t, err)
+	assert.Empty(t, res, "voided alert removed")
+	_, _, err = b.VoidBrigade("radio-t", alerts[0].ID)
+	assert.ErrorIs(t, err, brigade.ErrNotFound)
+
+	b.LevelPolicy = StaticLevelPolicyLister{LevelPolicy: LevelPolicy{MemberComments: 10}}
+	vote("n1", "", true)
+	vote("n2", "", true)
+	vote("n3", "", true)
+	alerts = b.Brigades.Analyze(time.Now())
+	require.Len(t, alerts, 1)
+	assert.Equal(t, brigade.ReasonNewUsers, alerts[0].Reason)
+	require.NoError(t, b.DismissBrigade("radio-t", alerts[0].ID))
+	c, err = b.Get(locator, id, store.User{Admin: true})
+	require.NoError(t, err)
+	assert.Equal(t, 3, c.Score, "dismissed alert keeps votes")
+}
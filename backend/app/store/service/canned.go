@@ -0,0 +1,121 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/umputun/remark42/backend/app/store/settings"
+)
+
+var errCannedResponsesDisabled = errors.New("canned responses disabled")
+
+// CannedResponse is a reusable moderator response, like "please keep it civil"
+type CannedResponse struct {
+	ID   string `json:"id"`   // short name of the response
+	Text string `json:"text"` // response text, markdown
+}
+
+// CannedResponses keeps canned responses per site, sites start with the default set.
+// Changes saved to the settings store once restored from it.
+type CannedResponses struct {
+	defaults []CannedResponse
+	mu       sync.Mutex // serializes changes
+	sites    siteSettings[[]CannedResponse]
+}
+
+// NewCannedResponses makes CannedResponses with default responses for all sites
+func NewCannedResponses(defaults []CannedResponse) *CannedResponses {
+	return &CannedResponses{defaults: defaults, sites: siteSettings[[]CannedResponse]{name: "canned_responses"}}
+}
+
+// Restore loads changed sets saved in the settings store and saves further changes there
+func (c *CannedResponses) Restore(store settings.Store) error {
+	return c.sites.restore(store, nil)
+}
+
+// List returns canned responses for the site
+func (c *CannedResponses) List(siteID string) []CannedResponse {
+	return append([]CannedResponse{}, c.siteResponses(siteID)...)
+}
+
+// Get returns canned response by id
+func (c *CannedResponses) Get(siteID, id string) (CannedResponse, error) {
+	for _, r := range c.siteResponses(siteID) {
+		if r.ID == id {
+			return r, nil
+		}
+	}
+	return CannedResponse{}, fmt.Errorf("canned response %q not found", id)
+}
+
+// Set adds canned response to the site or replaces existing one with the same id
+func (c *CannedResponses) Set(siteID string, resp CannedResponse) error {
+	resp.ID = strings.TrimSpace(resp.ID)
+	if resp.ID == "" || strings.TrimSpace(resp.Text) == "" {
+		return errors.New("canned response id and text can't be empty")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	responses := slices.Clone(c.siteResponses(siteID))
+	if i := slices.IndexFunc(responses, func(r CannedResponse) bool { return r.ID == resp.ID }); i >= 0 {
+		responses[i] = resp
+	} else {
+		responses = append(responses, resp)
+	}
+	return c.sites.set(siteID, responses)
+}
+
+// Delete removes canned response from the site
+func (c *CannedResponses) Delete(siteID, id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	responses := c.siteResponses(siteID)
+	i := slices.IndexFunc(responses, func(r CannedResponse) bool { return r.ID == id })
+	if i < 0 {
+		return fmt.Errorf("canned response %q not found", id)
+	}
+	return c.sites.set(siteID, slices.Delete(slices.Clone(responses), i, i+1))
+}
+
+// siteResponses returns responses of the site, default ones if site not changed. Returned slice is not modified.
+func (c *CannedResponses) siteResponses(siteID string) []CannedResponse {
+	if responses, ok := c.sites.get(siteID); ok {
+		return responses
+	}
+	return c.defaults
+}
+
+// ListCannedResponses returns canned responses for the site, empty if canned responses not set
+func (s *DataStore) ListCannedResponses(siteID string) []CannedResponse {
+	if s.CannedResponses == nil {
+		return []CannedResponse{}
+	}
+	return s.CannedResponses.List(siteID)
+}
+
+// GetCannedResponse returns site's canned response by id
+func (s *DataStore) GetCannedResponse(siteID, id string) (CannedResponse, error) {
+	if s.CannedResponses == nil {
+		return CannedResponse{}, errCannedResponsesDisabled
+	}
+	return s.CannedResponses.Get(siteID, id)
+}
+
+// SetCannedResponse adds or replaces site's canned response
+func (s *DataStore) SetCannedResponse(siteID string, resp CannedResponse) error {
+	if s.CannedResponses == nil {
+		return errCannedResponsesDisabled
+	}
+	return s.CannedResponses.Set(siteID, resp)
+}
+
+// DeleteCannedResponse removes site's canned response
+func (s *DataStore) DeleteCannedResponse(siteID, id string) error {
+	if s.CannedResponses == nil {
+		return errCannedResponsesDisabled
+	}
+	return s.CannedResponses.Delete(siteID, id)
+}
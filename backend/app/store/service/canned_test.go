@@ -0,0 +1,48 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCannedResponses(t *testing.T) {
+	c := NewCannedResponses([]CannedResponse{{ID: "civil", Text: "please keep it civil"}})
+
+	assert.Equal(t, []CannedResponse{{ID: "civil", Text: "please keep it civil"}}, c.List("site1"), "defaults")
+	r, err := c.Get("site1", "civil")
+	require.NoError(t, err)
+	assert.Equal(t, "please keep it civil", r.Text)
+	_, err = c.Get("site1", "unknown")
+	assert.EqualError(t, err, `canned response "unknown" not found`)
+
+	require.NoError(t, c.Set("site1", CannedResponse{ID: "offtopic", Text: "off-topic"}))
+	require.NoError(t, c.Set("site1", CannedResponse{ID: "civil", Text: "be civil"}))
+	assert.Equal(t, []CannedResponse{{ID: "civil", Text: "be civil"}, {ID: "offtopic", Text: "off-topic"}}, c.List("site1"))
+	assert.Equal(t, []CannedResponse{{ID: "civil", Text: "please keep it civil"}}, c.List("site2"), "other sites not affected")
+	assert.EqualError(t, c.Set("site1", CannedResponse{ID: " ", Text: "text"}), "canned response id and text can't be empty")
+	assert.EqualError(t, c.Set("site1", CannedResponse{ID: "id"}), "canned response id and text can't be empty")
+
+	require.NoError(t, c.Delete("site2", "civil"))
+	assert.Equal(t, []CannedResponse{}, c.List("site2"))
+	assert.EqualError(t, c.Delete("site2", "civil"), `canned response "civil" not found`)
+	assert.Equal(t, []CannedResponse{{ID: "civil", Text: "please keep it civil"}}, c.List("site3"), "defaults not changed")
+}
+
+func TestService_CannedResponses(t *testing.T) {
+	b := DataStore{}
+	assert.Equal(t, []CannedResponse{}, b.ListCannedResponses("radio-t"))
+	_, err := b.GetCannedResponse("radio-t", "civil")
+	assert.EqualError(t, err, "canned responses disabled")
+	assert.EqualError(t, b.SetCannedResponse("radio-t", CannedResponse{ID: "civil", Text: "text"}), "canned responses disabled")
+	assert.EqualError(t, b.DeleteCannedResponse("radio-t", "civil"), "canned responses disabled")
+
+	b.CannedResponses = NewCannedResponses(nil)
+	assert.Equal(t, []CannedResponse{}, b.ListCannedResponses("radio-t"))
+	require.NoError(t, b.SetCannedResponse("radio-t", CannedResponse{ID: "civil", Text: "text"}))
+	r, err := b.GetCannedResponse("radio-t", "civil")
+	require.NoError(t, err)
+	assert.Equal(t, CannedResponse{ID: "civil", Text: "text"}, r)
+	require.NoError(t, b.DeleteCannedResponse("radio-t", "civil"))
+}
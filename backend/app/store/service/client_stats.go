@@ -0,0 +1,146 @@
+package service
+
+import (
+	"errors"
+	"maps"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark42/backend/app/store/settings"
+)
+
+var errClientStatsDisabled = errors.New("client stats disabled")
+
+const maxStatsReferrers = 500 // referrer domains above the limit counted as "other"
+
+// ClientInfo is a coarse description of the client made a comment, no raw identifiers kept
+type ClientInfo struct {
+	Browser  string // browser family, like "chrome" or "firefox"
+	Embed    bool   // comment made from the embedded widget
+	Referrer string // referrer domain, empty if not set
+}
+
+// NewClientInfo makes ClientInfo from user agent and referrer, remarkURL used to detect embedded widget
+func NewClientInfo(userAgent, referrer, remarkURL string) ClientInfo {
+	res := ClientInfo{Browser: browserFamily(userAgent)}
+	u, err := url.Parse(referrer)
+	if err != nil || u.Hostname() == "" {
+		return res
+	}
+	res.Referrer = strings.ToLower(strings.TrimPrefix(u.Hostname(), "www."))
+	if r, e := url.Parse(remarkURL); e == nil && strings.EqualFold(r.Hostname(), u.Hostname()) {
+		res.Embed = strings.HasSuffix(u.Path, "/web/iframe.html")
+	}
+	return res
+}
+
+// browserFamily detects browser family from user agent, order matters as most browsers mimic others
+func browserFamily(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	switch {
+	case ua == "":
+		return "unknown"
+	case strings.Contains(ua, "bot") || strings.Contains(ua, "crawler") || strings.Contains(ua, "spider"):
+		return "bot"
+	case strings.Contains(ua, "edg/") || strings.Contains(ua, "edge/"):
+		return "edge"
+	case strings.Contains(ua, "opr/") || strings.Contains(ua, "opera"):
+		return "opera"
+	case strings.Contains(ua, "firefox/") || strings.Contains(ua, "fxios/"):
+		return "firefox"
+	case strings.Contains(ua, "chrome/") || strings.Contains(ua, "crios/") || strings.Contains(ua, "chromium/"):
+		return "chrome"
+	case strings.Contains(ua, "safari/"):
+		return "safari"
+	}
+	return "other"
+}
+
+// ClientStatsReport is aggregated client stats of the site
+type ClientStatsReport struct {
+	Since     time.Time      `json:"since"` // stats collected from
+	Total     int            `json:"total"`
+	Embed     int            `json:"embed"`
+	Direct    int            `json:"direct"`
+	Browsers  map[string]int `json:"browsers"`
+	Referrers map[string]int `json:"referrers"`
+}
+
+// ClientStats aggregates client stats per site. Stats saved to the settings store once restored from it.
+type ClientStats struct {
+	since time.Time
+	mu    sync.Mutex // serializes changes, reports are changed in place
+	sites siteSettings[*ClientStatsReport]
+}
+
+// NewClientStats makes empty ClientStats
+func NewClientStats() *ClientStats {
+	return &ClientStats{since: time.Now(), sites: siteSettings[*ClientStatsReport]{name: "client_stats"}}
+}
+
+// Restore loads stats saved in the settings store and saves further changes there
+func (c *ClientStats) Restore(store settings.Store) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sites.restore(store, nil)
+}
+
+// Record adds client of the comment to site's stats
+func (c *ClientStats) Record(siteID string, info ClientInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	rep, ok := c.sites.get(siteID)
+	if !ok {
+		rep = &ClientStatsReport{Since: c.since, Browsers: map[string]int{}, Referrers: map[string]int{}}
+	}
+	rep.Total++
+	if info.Embed {
+		rep.Embed++
+	} else {
+		rep.Direct++
+	}
+	rep.Browsers[info.Browser]++
+	switch _, known := rep.Referrers[info.Referrer]; {
+	case info.Referrer == "":
+	case !known && len(rep.Referrers) >= maxStatsReferrers:
+		rep.Referrers["other"]++
+	default:
+		rep.Referrers[info.Referrer]++
+	}
+	if err := c.sites.set(siteID, rep); err != nil {
+		log.Printf("[WARN] %v", err)
+	}
+}
+
+// Report returns copy of site's stats
+func (c *ClientStats) Report(siteID string) ClientStatsReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	rep, ok := c.sites.get(siteID)
+	if !ok {
+		return ClientStatsReport{Since: c.since, Browsers: map[string]int{}, Referrers: map[string]int{}}
+	}
+	res := *rep
+	res.Browsers, res.Referrers = maps.Clone(rep.Browsers), maps.Clone(rep.Referrers)
+	return res
+}
+
+// RecordClient adds client of the comment to site's stats, does nothing if stats disabled
+func (s *DataStore) RecordClient(siteID string, info ClientInfo) {
+	if s.ClientStats == nil {
+		return
+	}
+	s.ClientStats.Record(siteID, info)
+}
+
+// ClientStatsReport returns aggregated client stats of the site
+func (s *DataStore) ClientStatsReport(siteID string) (ClientStatsReport, error) {
+	if s.ClientStats == nil {
+		return ClientStatsReport{}, errClientStatsDisabled
+	}
+	return s.ClientStats.Report(siteID), nil
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewClientInfo(t *testing.T) {
+	const remarkURL = "https://remark.example.com"
+	tbl := []struct {
+		ua, referrer string
+		res          ClientInfo
+	}{
+		{"", "", ClientInfo{Browser: "unknown"}},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			"https://remark.example.com/web/iframe.html?site_id=remark", ClientInfo{Browser: "chrome", Embed: true, Referrer: "remark.example.com"}},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.0.0",
+			"https://www.Blog.com/post1", ClientInfo{Browser: "edge", Referrer: "blog.com"}},
+		{"Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0", "bad url %", ClientInfo{Browser: "firefox"}},
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 14_2) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Safari/605.1.15",
+			"https://remark.example.com/web/", ClientInfo{Browser: "safari", Referrer: "remark.example.com"}},
+		{"Mozilla/5.0 (Windows NT 10.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 OPR/105.0.0.0", "",
+			ClientInfo{Browser: "opera"}},
+		{"Googlebot/2.1 (+http://www.google.com/bot.html)", "", ClientInfo{Browser: "bot"}},
+		{"curl/8.4.0", "", ClientInfo{Browser: "other"}},
+	}
+	for i, tt := range tbl {
+		assert.Equal(t, tt.res, NewClientInfo(tt.ua, tt.referrer, remarkURL), "check #%d", i)
+	}
+}
+
+func TestClientStats(t *testing.T) {
+	b := DataStore{}
+	b.RecordClient("site1", ClientInfo{Browser: "chrome"})
+	_, err := b.ClientStatsReport("site1")
+	assert.EqualError(t, err, "client stats disabled")
+
+	b.ClientStats = NewClientStats()
+	b.RecordClient("site1", ClientInfo{Browser: "chrome", Embed: true, Referrer: "remark.example.com"})
+	b.RecordClient("site1", ClientInfo{Browser: "chrome", Referrer: "blog.com"})
+	b.RecordClient("site1", ClientInfo{Browser: "firefox"})
+	b.RecordClient("site2", ClientInfo{Browser: "safari"})
+
+	rep, err := b.ClientStatsReport("site1")
+	require.NoError(t, err)
+	assert.False(t, rep.Since.IsZero())
+	assert.Equal(t, 3, rep.Total)
+	assert.Equal(t, 1, rep.Embed)
+	assert.Equal(t, 2, rep.Direct)
+	assert.Equal(t, map[string]int{"chrome": 2, "firefox": 1}, rep.Browsers)
+	assert.Equal(t, map[string]int{"remark.example.com": 1, "blog.com": 1}, rep.Referrers)
+
+	rep.Browsers["chrome"] = 100
+	rep, err = b.ClientStatsReport("site1")
+	require.NoError(t, err)
+	assert.Equal(t, 2, rep.Browsers["chrome"], "report is a copy")
+
+	rep, err = b.ClientStatsReport("site3")
+	require.NoError(t, err)
+	assert.Equal(t, 0, rep.Total)
+	assert.Empty(t, rep.Browsers)
+
+	for i := range maxStatsReferrers + 10 {
+		b.RecordClient("site2", ClientInfo{Browser: "safari", Referrer: fmt.Sprintf("blog%d.com", i)})
+	}
+	rep, err = b.ClientStatsReport("site2")
+	require.NoError(t, err)
+	assert.Len(t, rep.Referrers, maxStatsReferrers+1)
+	assert.Equal(t, 10, rep.Referrers["other"])
+}
@@ -0,0 +1,352 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/cold"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+var errColdDisabled = errors.New("cold storage disabled")
+
+// FreezePosts moves posts of the site without comments since inactive period to cold storage.
+// Comments of each post are saved to a compressed segment and removed from the engine.
+// Returns number of frozen posts.
+func (s *DataStore) FreezePosts(siteID string, inactive time.Duration) (int, error) {
+	if s.ColdStore == nil {
+		return 0, errColdDisabled
+	}
+	posts, err := s.Engine.Info(engine.InfoRequest{Locator: store.Locator{SiteID: siteID}})
+	if err != nil {
+		return 0, fmt.Errorf("can't get list of posts for %s: %w", siteID, err)
+	}
+	threshold := time.Now().Add(-inactive)
+	count := 0
+	for _, p := range posts {
+		if !p.LastTS.Before(threshold) {
+			continue
+		}
+		if err = s.freezePost(store.Locator{SiteID: siteID, URL: p.URL}); err != nil {
+			return count, err
+		}
+		count++
+	}
+	if count > 0 {
+		log.Printf("[INFO] %d posts of %s inactive since %s moved to cold storage", count, siteID, threshold.Format(time.RFC3339))
+	}
+	return count, nil
+}
+
+// ColdPosts returns segments of the site's posts in cold storage, without data
+func (s *DataStore) ColdPosts(siteID string) ([]cold.Segment, error) {
+	if s.ColdStore == nil {
+		return nil, errColdDisabled
+	}
+	return s.ColdStore.List(siteID)
+}
+
+// ThawPost moves post from cold storage back to the engine
+func (s *DataStore) ThawPost(locator store.Locator) error {
+	if s.ColdStore == nil {
+		return errColdDisabled
+	}
+	lock := s.getScopedLocks(coldLockKey(locator))
+	lock.Lock()
+	defer lock.Unlock()
+	seg, err := s.ColdStore.Load(locator.SiteID, locator.URL)
+	if err != nil {
+		return err
+	}
+	return s.thawSegment(seg)
+}
+
+func (s *DataStore) freezePost(locator store.Locator) error {
+	lock := s.getScopedLocks(coldLockKey(locator))
+	lock.Lock()
+	defer lock.Unlock()
+
+	comments, err := s.Engine.Find(engine.FindRequest{Locator: locator, Sort: "time"})
+	if err != nil {
+		return fmt.Errorf("can't get comments of %s: %w", locator.URL, err)
+	}
+	seg, err := cold.NewSegment(locator, comments, time.Now())
+	if err != nil {
+		return err
+	}
+	seg.ReadOnly = s.IsReadOnly(locator)
+	if err = s.ColdStore.Save(seg); err != nil {
+		return fmt.Errorf("can't save segment of %s: %w", locator.URL, err)
+	}
+	if err = s.Engine.Delete(engine.DeleteRequest{Locator: locator}); err != nil {
+		return fmt.Errorf("can't remove frozen post %s: %w", locator.URL, err)
+	}
+	log.Printf("[DEBUG] post %s of %s frozen, %d comments, %d bytes", locator.URL, locator.SiteID, seg.Count, seg.Size)
+	return nil
+}
+
+// thawSegment restores comments and read-only status of the post, and removes the segment
+func (s *DataStore) thawSegment(seg cold.Segment) error {
+	comments, err := seg.Comments()
+	if err != nil {
+		return err
+	}
+	for _, c := range comments {
+		if _, err = s.Engine.Create(c); err != nil {
+			return fmt.Errorf("can't restore comment %s of %s: %w", c.ID, seg.URL, err)
+		}
+	}
+	locator := store.Locator{SiteID: seg.SiteID, URL: seg.URL}
+	if seg.ReadOnly {
+		if err = s.SetReadOnly(locator, true); err != nil {
+			return fmt.Errorf("can't restore read-only status of %s: %w", seg.URL, err)
+		}
+	}
+	if err = s.ColdStore.Delete(seg.SiteID, seg.URL); err != nil {
+		return fmt.Errorf("can't remove segment of %s: %w", seg.URL, err)
+	}
+	log.Printf("[INFO] post %s of %s restored from cold storage, %d comments", seg.URL, seg.SiteID, len(comments))
+	return nil
+}
+
+// createComment saves the comment to the engine. Post in cold storage is restored first,
+// under the lock preventing its freezing meanwhile.
+func (s *DataStore) createComment(comment store.Comment) (string, error) {
+	if s.ColdStore == nil {
+		return s.Engine.Create(comment)
+	}
+	lock := s.getScopedLocks(coldLockKey(comment.Locator))
+	lock.Lock()
+	defer lock.Unlock()
+	seg, err := s.ColdStore.Load(comment.Locator.SiteID, comment.Locator.URL)
+	switch {
+	case err == nil:
+		if err = s.thawSegment(seg); err != nil {
+			return "", err
+		}
+	case !errors.Is(err, cold.ErrNotFound):
+		return "", fmt.Errorf("can't check cold storage for %s: %w", comment.Locator.URL, err)
+	}
+	return s.Engine.Create(comment)
+}
+
+// findPost returns comments of the post from the engine, or from cold storage if the post is frozen.
+// Cold comments are filtered by since and sorted the same way as engine does.
+func (s *DataStore) findPost(req engine.FindRequest) ([]store.Comment, error) {
+	comments, err := s.Engine.Find(req)
+	if (err == nil && len(comments) > 0) || s.ColdStore == nil || req.Locator.URL == "" {
+		return comments, err
+	}
+	seg, e := s.ColdStore.Load(req.Locator.SiteID, req.Locator.URL)
+	if e != nil {
+		return comments, err
+	}
+	frozen, e := seg.Comments()
+	if e != nil {
+		return nil, e
+	}
+	res := make([]store.Comment, 0, len(frozen))
+	for _, c := range frozen {
+		if req.Since.IsZero() || c.Timestamp.After(req.Since) {
+			res = append(res, c)
+		}
+	}
+	return engine.SortComments(res, req.Sort), nil
+}
+
+// listPosts returns posts of the engine followed by frozen posts, skip and limit applied to both
+func (s *DataStore) listPosts(req engine.InfoRequest) ([]store.PostInfo, error) {
+	if s.ColdStore == nil {
+		return s.Engine.Info(req)
+	}
+	posts, err := s.Engine.Info(engine.InfoRequest{Locator: req.Locator})
+	if err != nil {
+		return nil, err
+	}
+	frozen, err := s.coldPosts(req.Locator.SiteID)
+	if err != nil {
+		return nil, err
+	}
+	posts = append(posts, frozen...)
+	posts = posts[min(req.Skip, len(posts)):]
+	if req.Limit > 0 && len(posts) > req.Limit {
+		posts = posts[:req.Limit]
+	}
+	return posts, nil
+}
+
+// coldPosts returns info of the site's frozen posts, read-only if frozen so, empty if cold storage disabled
+func (s *DataStore) coldPosts(siteID string) ([]store.PostInfo, error) {
+	if s.ColdStore == nil {
+		return nil, nil
+	}
+	segments, err := s.ColdStore.List(siteID)
+	if err != nil {
+		return nil, fmt.Errorf("can't list cold posts of %s: %w", siteID, err)
+	}
+	res := make([]store.PostInfo, 0, len(segments))
+	for _, seg := range segments {
+		res = append(res, segmentInfo(seg))
+	}
+	return res, nil
+}
+
+// findUser returns comments of the user from the engine and frozen posts, sorted, skipped and limited as engine does
+func (s *DataStore) findUser(req engine.FindRequest) ([]store.Comment, error) {
+	if s.ColdStore == nil {
+		return s.Engine.Find(req)
+	}
+	frozen, err := s.coldUserComments(req.Locator.SiteID, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if len(frozen) == 0 {
+		return s.Engine.Find(req)
+	}
+	all := req
+	all.Skip, all.Limit = 0, 0
+	if req.Limit > 0 {
+		all.Limit = req.Skip + req.Limit
+	}
+	comments, err := s.Engine.Find(all)
+	if err != nil { // engine fails for user without comments in it
+		log.Printf("[DEBUG] no comments of %s in engine, %v", req.UserID, err)
+	}
+	comments = engine.SortComments(append(comments, frozen...), req.Sort)
+	comments = comments[min(req.Skip, len(comments)):]
+	if req.Limit > 0 && len(comments) > req.Limit {
+		comments = comments[:req.Limit]
+	}
+	return comments, nil
+}
+
+// coldUserComments returns comments of the user in frozen posts of the site, empty if cold storage disabled
+func (s *DataStore) coldUserComments(siteID, userID string) ([]store.Comment, error) {
+	res := []store.Comment{}
+	segments, err := s.userSegments(siteID, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, seg := range segments {
+		comments, e := seg.Comments()
+		if e != nil {
+			return nil, e
+		}
+		for _, c := range comments {
+			if c.User.ID == userID {
+				res = append(res, c)
+			}
+		}
+	}
+	return res, nil
+}
+
+// thawUser moves frozen posts with comments of the user back to the engine
+func (s *DataStore) thawUser(siteID, userID string) error {
+	segments, err := s.userSegments(siteID, userID)
+	if err != nil {
+		return err
+	}
+	for _, seg := range segments {
+		if err = s.ThawPost(store.Locator{SiteID: siteID, URL: seg.URL}); err != nil && !errors.Is(err, cold.ErrNotFound) {
+			return fmt.Errorf("can't thaw post %s with comments of %s: %w", seg.URL, userID, err)
+		}
+	}
+	return nil
+}
+
+// thawVotes moves frozen posts with votes of the user back to the engine. Voters are not listed in segments,
+// so comments of all frozen posts of the site are checked.
+func (s *DataStore) thawVotes(siteID, userID string) error {
+	if s.ColdStore == nil {
+		return nil
+	}
+	segments, err := s.ColdStore.List(siteID)
+	if err != nil {
+		return fmt.Errorf("can't list cold posts of %s: %w", siteID, err)
+	}
+	for _, seg := range segments {
+		full, e := s.ColdStore.Load(siteID, seg.URL)
+		if errors.Is(e, cold.ErrNotFound) { // thawed meanwhile
+			continue
+		}
+		if e != nil {
+			return fmt.Errorf("can't load cold post %s: %w", seg.URL, e)
+		}
+		comments, e := full.Comments()
+		if e != nil {
+			return e
+		}
+		if !slices.ContainsFunc(comments, func(c store.Comment) bool { _, ok := c.Votes[userID]; return ok }) {
+			continue
+		}
+		if e = s.ThawPost(store.Locator{SiteID: siteID, URL: seg.URL}); e != nil && !errors.Is(e, cold.ErrNotFound) {
+			return fmt.Errorf("can't thaw post %s with votes of %s: %w", seg.URL, userID, e)
+		}
+	}
+	return nil
+}
+
+// userSegments returns loaded segments of the site with comments of the user, empty if cold storage disabled
+func (s *DataStore) userSegments(siteID, userID string) ([]cold.Segment, error) {
+	if s.ColdStore == nil {
+		return nil, nil
+	}
+	segments, err := s.ColdStore.List(siteID)
+	if err != nil {
+		return nil, fmt.Errorf("can't list cold posts of %s: %w", siteID, err)
+	}
+	res := []cold.Segment{}
+	for _, seg := range segments {
+		if !seg.HasUser(userID) {
+			continue
+		}
+		full, e := s.ColdStore.Load(siteID, seg.URL)
+		if errors.Is(e, cold.ErrNotFound) { // thawed meanwhile
+			continue
+		}
+		if e != nil {
+			return nil, fmt.Errorf("can't load cold post %s: %w", seg.URL, e)
+		}
+		if full.Users == nil { // segment made without authors
+			comments, e := full.Comments()
+			if e != nil {
+				return nil, e
+			}
+			if !slices.ContainsFunc(comments, func(c store.Comment) bool { return c.User.ID == userID }) {
+				continue
+			}
+		}
+		res = append(res, full)
+	}
+	return res, nil
+}
+
+// coldInfo returns info of the frozen post, read-only if frozen so or older than readonlyAge days
+func (s *DataStore) coldInfo(locator store.Locator, readonlyAge int) (store.PostInfo, bool) {
+	if s.ColdStore == nil || locator.URL == "" {
+		return store.PostInfo{}, false
+	}
+	seg, err := s.ColdStore.Load(locator.SiteID, locator.URL)
+	if err != nil {
+		return store.PostInfo{}, false
+	}
+	info := segmentInfo(seg)
+	if readonlyAge > 0 && seg.FirstTS.AddDate(0, 0, readonlyAge).Before(time.Now()) {
+		info.ReadOnly = true
+	}
+	return info, true
+}
+
+func segmentInfo(seg cold.Segment) store.PostInfo {
+	return store.PostInfo{URL: seg.URL, Count: seg.Count, FirstTS: seg.FirstTS, LastTS: seg.LastTS, ReadOnly: seg.ReadOnly}
+}
+
+func coldLockKey(locator store.Locator) string {
+	return locator.SiteID + "!!cold!!" + locator.URL
+}
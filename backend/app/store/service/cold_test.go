@@ -0,0 +1,145 @@
+package service
+
+import (
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/cold"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+func TestService_ColdPosts(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+	locator := store.Locator{SiteID: "radio-t", URL: "https://radio-t.com"}
+
+	_, err := b.FreezePosts("radio-t", time.Hour)
+	require.EqualError(t, err, "cold storage disabled")
+	require.EqualError(t, b.ThawPost(locator), "cold storage disabled")
+
+	b.ColdStore, err = cold.NewBoltStorage(path.Join(t.TempDir(), "cold.db"), bolt.Options{})
+	require.NoError(t, err)
+	defer b.ColdStore.Close()
+
+	_, err = b.Create(store.Comment{Text: "recent", Locator: store.Locator{SiteID: "radio-t", URL: "https://radio-t.com/2"},
+		User: store.User{ID: "user2", Name: "user2"}})
+	require.NoError(t, err)
+
+	frozen, err := b.FreezePosts("radio-t", 365*24*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 1, frozen, "only old post frozen")
+	frozen, err = b.FreezePosts("radio-t", 365*24*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 0, frozen, "nothing left to freeze")
+
+	_, err = eng.Find(engine.FindRequest{Locator: locator})
+	require.Error(t, err, "post removed from engine")
+	segments, err := b.ColdPosts("radio-t")
+	require.NoError(t, err)
+	require.Len(t, segments, 1)
+	assert.Equal(t, "https://radio-t.com", segments[0].URL)
+	assert.Equal(t, 2, segments[0].Count)
+
+	comments, err := b.Find(locator, "-time", store.User{})
+	require.NoError(t, err, "loaded from cold storage")
+	require.Len(t, comments, 2)
+	assert.Equal(t, "id-2", comments[0].ID, "sorted")
+	comments, err = b.FindSince(locator, "time", store.User{}, time.Date(2017, 12, 20, 15, 18, 22, 0, time.UTC))
+	require.NoError(t, err)
+	require.Len(t, comments, 1)
+	assert.Equal(t, "id-2", comments[0].ID)
+
+	info, err := b.Info(locator, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 2, info.Count)
+	assert.True(t, info.ReadOnly, "older than read-only age")
+	count, err := b.Count(locator)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	counts, err := b.Counts("radio-t", []string{"https://radio-t.com", "https://radio-t.com/2"})
+	require.NoError(t, err)
+	assert.Equal(t, []store.PostInfo{{URL: "https://radio-t.com", Count: 2}, {URL: "https://radio-t.com/2", Count: 1}}, counts)
+
+	// frozen post listed and its comments found for the user
+	posts, err := b.List("radio-t", 0, 0)
+	require.NoError(t, err)
+	require.Len(t, posts, 2)
+	assert.Equal(t, "https://radio-t.com/2", posts[0].URL)
+	assert.Equal(t, "https://radio-t.com", posts[1].URL, "frozen post listed after active ones")
+	assert.Equal(t, 2, posts[1].Count)
+	posts, err = b.List("radio-t", 1, 1)
+	require.NoError(t, err)
+	require.Len(t, posts, 1)
+	assert.Equal(t, "https://radio-t.com", posts[0].URL)
+	userComments, err := b.User("radio-t", "user1", 0, 0, store.User{})
+	require.NoError(t, err)
+	require.Len(t, userComments, 2)
+	assert.Equal(t, "id-2", userComments[0].ID, "sorted by time desc")
+	userComments, err = b.User("radio-t", "user1", 1, 1, store.User{})
+	require.NoError(t, err)
+	require.Len(t, userComments, 1)
+	assert.Equal(t, "id-1", userComments[0].ID)
+	userComments, err = b.User("radio-t", "user2", 0, 0, store.User{})
+	require.NoError(t, err)
+	require.Len(t, userComments, 1)
+	assert.Equal(t, "recent", userComments[0].Text)
+	count, err = b.UserCount("radio-t", "user1")
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	count, err = b.UserCount("radio-t", "user2")
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	// new comment restores the post
+	_, err = b.Create(store.Comment{Text: "new", Locator: locator, User: store.User{ID: "user2", Name: "user2"}})
+	require.NoError(t, err)
+	segments, err = b.ColdPosts("radio-t")
+	require.NoError(t, err)
+	assert.Empty(t, segments)
+	comments, err = eng.Find(engine.FindRequest{Locator: locator, Sort: "time"})
+	require.NoError(t, err)
+	require.Len(t, comments, 3)
+	assert.Equal(t, "id-1", comments[0].ID)
+	assert.Equal(t, `some text, <a href="http://radio-t.com">link</a>`, comments[0].Text)
+	assert.Equal(t, "new", comments[2].Text)
+
+	// read-only status kept
+	require.NoError(t, b.SetReadOnly(locator, true))
+	frozen, err = b.FreezePosts("radio-t", -time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 2, frozen)
+	assert.False(t, b.IsReadOnly(locator))
+	_, pmetas, err := b.Metas("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, []PostMetaData{{URL: "https://radio-t.com", ReadOnly: true}}, pmetas, "read-only status of frozen post kept")
+	require.NoError(t, b.ThawPost(locator))
+	assert.True(t, b.IsReadOnly(locator))
+	require.ErrorIs(t, b.ThawPost(locator), cold.ErrNotFound)
+	count, err = b.Count(locator)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	// posts with comments of deleted user restored to delete them
+	frozen, err = b.FreezePosts("radio-t", -time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 1, frozen, "the other post still frozen")
+	require.NoError(t, b.DeleteUser("radio-t", "user1", store.SoftDelete))
+	segments, err = b.ColdPosts("radio-t")
+	require.NoError(t, err)
+	require.Len(t, segments, 1, "post without comments of the user kept frozen")
+	assert.Equal(t, "https://radio-t.com/2", segments[0].URL)
+	comments, err = eng.Find(engine.FindRequest{Locator: locator, Sort: "time"})
+	require.NoError(t, err)
+	require.Len(t, comments, 3)
+	for _, c := range comments {
+		assert.Equal(t, c.User.ID == "user1", c.Deleted, c.ID)
+	}
+}
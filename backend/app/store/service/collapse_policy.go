@@ -0,0 +1,187 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/settings"
+)
+
+var errCollapsePolicyStatic = errors.New("collapse policy can't be changed at runtime")
+
+// CollapseMode defines how comments scored below the threshold are shown
+type CollapseMode string
+
+// collapse modes
+const (
+	CollapseOff      CollapseMode = ""         // low-score comments shown as usual
+	CollapseCollapse CollapseMode = "collapse" // low-score comments marked as collapsed, with count of their replies
+	CollapseHide     CollapseMode = "hide"     // low-score comments removed with their replies, parent gets count of hidden replies
+)
+
+// CollapsePolicy defines handling of low-score comments for the site
+type CollapsePolicy struct {
+	Mode      CollapseMode `json:"mode"`
+	Threshold int          `json:"threshold"` // comments with score below it are collapsed or hidden
+}
+
+// CollapsePolicyLister provides collapse policy per site
+type CollapsePolicyLister interface {
+	Policy(siteID string) (CollapsePolicy, error)
+}
+
+// StaticCollapsePolicyLister provides same collapse policy for every site
+type StaticCollapsePolicyLister struct {
+	CollapsePolicy
+}
+
+// Policy returns collapse policy (ignores siteID)
+func (l StaticCollapsePolicyLister) Policy(_ string) (CollapsePolicy, error) {
+	return l.CollapsePolicy, nil
+}
+
+// CollapsePolicies keeps default collapse policy with per-site overrides changeable at runtime,
+// saved to the settings store once restored from it.
+type CollapsePolicies struct {
+	defaultPolicy CollapsePolicy
+	sites         siteSettings[CollapsePolicy]
+}
+
+// NewCollapsePolicies makes CollapsePolicies with default policy for all sites
+func NewCollapsePolicies(defaultPolicy CollapsePolicy) *CollapsePolicies {
+	return &CollapsePolicies{defaultPolicy: defaultPolicy, sites: siteSettings[CollapsePolicy]{name: "collapse_policy"}}
+}
+
+// Restore loads overrides saved in the settings store and saves further changes there
+func (p *CollapsePolicies) Restore(store settings.Store) error {
+	return p.sites.restore(store, CollapsePolicy.validate)
+}
+
+// Policy returns collapse policy for the site, default one if not overridden
+func (p *CollapsePolicies) Policy(siteID string) (CollapsePolicy, error) {
+	if policy, ok := p.sites.get(siteID); ok {
+		return policy, nil
+	}
+	return p.defaultPolicy, nil
+}
+
+// SetPolicy overrides collapse policy for the site
+func (p *CollapsePolicies) SetPolicy(siteID string, policy CollapsePolicy) error {
+	if err := policy.validate(); err != nil {
+		return err
+	}
+	return p.sites.set(siteID, policy)
+}
+
+// ResetPolicy removes site's override, i.e. site gets default policy back
+func (p *CollapsePolicies) ResetPolicy(siteID string) error {
+	return p.sites.reset(siteID)
+}
+
+// validate checks collapse mode of the policy
+func (p CollapsePolicy) validate() error {
+	switch p.Mode {
+	case CollapseOff, CollapseCollapse, CollapseHide:
+		return nil
+	}
+	return fmt.Errorf("invalid collapse mode %q", p.Mode)
+}
+
+// SiteCollapsePolicy returns collapse policy for the site, off if no collapse policy set
+func (s *DataStore) SiteCollapsePolicy(siteID string) CollapsePolicy {
+	if s.CollapsePolicy == nil {
+		return CollapsePolicy{}
+	}
+	policy, err := s.CollapsePolicy.Policy(siteID)
+	if err != nil {
+		log.Printf("[WARN] failed to get collapse policy for site %s: %v", siteID, err)
+		return CollapsePolicy{}
+	}
+	return policy
+}
+
+// SetCollapsePolicy changes collapse policy for the site at runtime
+func (s *DataStore) SetCollapsePolicy(siteID string, policy CollapsePolicy) error {
+	policies, ok := s.CollapsePolicy.(*CollapsePolicies)
+	if !ok {
+		return errCollapsePolicyStatic
+	}
+	return policies.SetPolicy(siteID, policy)
+}
+
+// ResetCollapsePolicy resets collapse policy for the site to the default one
+func (s *DataStore) ResetCollapsePolicy(siteID string) error {
+	policies, ok := s.CollapsePolicy.(*CollapsePolicies)
+	if !ok {
+		return errCollapsePolicyStatic
+	}
+	return policies.ResetPolicy(siteID)
+}
+
+// CollapseComments applies collapse policy of the site to comments of the post. Low-score comments are marked
+// as collapsed with number of their replies in HiddenCount, or removed with all their replies, counted in
+// HiddenCount of the parent. Admins never get comments removed, only collapsed.
+func (s *DataStore) CollapseComments(siteID string, comments []store.Comment, user store.User) []store.Comment {
+	policy := s.SiteCollapsePolicy(siteID)
+	if policy.Mode == CollapseOff || len(comments) == 0 {
+		return comments
+	}
+	mode := policy.Mode
+	if user.Admin {
+		mode = CollapseCollapse
+	}
+
+	children := map[string][]int{} // parent id to indexes of replies
+	for i, c := range comments {
+		if c.ParentID != "" {
+			children[c.ParentID] = append(children[c.ParentID], i)
+		}
+	}
+	var descendants func(id string, fn func(i int)) int
+	descendants = func(id string, fn func(i int)) (count int) {
+		for _, i := range children[id] {
+			if fn != nil {
+				fn(i)
+			}
+			count += 1 + descendants(comments[i].ID, fn)
+		}
+		return count
+	}
+	index := map[string]int{} // comment id to its index
+	for i, c := range comments {
+		index[c.ID] = i
+	}
+
+	low := func(c store.Comment) bool { return !c.Deleted && c.Score < policy.Threshold }
+	if mode == CollapseCollapse {
+		for i, c := range comments {
+			if low(c) {
+				comments[i].Collapsed = true
+				comments[i].HiddenCount = descendants(c.ID, nil)
+			}
+		}
+		return comments
+	}
+
+	hidden := make([]bool, len(comments))
+	for i, c := range comments {
+		if hidden[i] || !low(c) {
+			continue
+		}
+		hidden[i] = true
+		count := 1 + descendants(c.ID, func(j int) { hidden[j] = true })
+		if pi, ok := index[c.ParentID]; ok && c.ParentID != "" {
+			comments[pi].HiddenCount += count
+		}
+	}
+	res := make([]store.Comment, 0, len(comments))
+	for i, c := range comments {
+		if !hidden[i] {
+			res = append(res, c)
+		}
+	}
+	return res
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store"
+)
+
+func TestCollapsePolicies(t *testing.T) {
+	p := NewCollapsePolicies(CollapsePolicy{Mode: CollapseCollapse, Threshold: -5})
+	policy, err := p.Policy("site1")
+	require.NoError(t, err)
+	assert.Equal(t, CollapsePolicy{Mode: CollapseCollapse, Threshold: -5}, policy)
+
+	require.NoError(t, p.SetPolicy("site1", CollapsePolicy{Mode: CollapseHide, Threshold: -2}))
+	require.EqualError(t, p.SetPolicy("site1", CollapsePolicy{Mode: "fold"}), `invalid collapse mode "fold"`)
+	policy, err = p.Policy("site1")
+	require.NoError(t, err)
+	assert.Equal(t, CollapsePolicy{Mode: CollapseHide, Threshold: -2}, policy)
+	policy, err = p.Policy("site2")
+	require.NoError(t, err)
+	assert.Equal(t, CollapseCollapse, policy.Mode, "other sites keep default")
+
+	require.NoError(t, p.ResetPolicy("site1"))
+	policy, err = p.Policy("site1")
+	require.NoError(t, err)
+	assert.Equal(t, CollapseCollapse, policy.Mode)
+}
+
+func TestService_CollapsePolicyStatic(t *testing.T) {
+	b := DataStore{}
+	assert.Equal(t, CollapsePolicy{}, b.SiteCollapsePolicy("site1"))
+	b.CollapsePolicy = StaticCollapsePolicyLister{CollapsePolicy: CollapsePolicy{Mode: CollapseHide, Threshold: 0}}
+	assert.Equal(t, CollapseHide, b.SiteCollapsePolicy("site1").Mode)
+	require.EqualError(t, b.SetCollapsePolicy("site1", CollapsePolicy{}), "collapse policy can't be changed at runtime")
+	require.EqualError(t, b.ResetCollapsePolicy("site1"), "collapse policy can't be changed at runtime")
+}
+
+func TestService_CollapseComments(t *testing.T) {
+	// c1 (-6) <- c2 (1) <- c3 (0); c4 (0) <- c5 (-7) <- c6 (2); c7 (-10, deleted)
+	comments := func() []store.Comment {
+		return []store.Comment{
+			{ID: "c1", Score: -6}, {ID: "c2", ParentID: "c1", Score: 1}, {ID: "c3", ParentID: "c2"},
+			{ID: "c4"}, {ID: "c5", ParentID: "c4", Score: -7}, {ID: "c6", ParentID: "c5", Score: 2},
+			{ID: "c7", Score: -10, Deleted: true},
+		}
+	}
+	b := DataStore{CollapsePolicy: NewCollapsePolicies(CollapsePolicy{Threshold: -5})}
+	assert.Equal(t, comments(), b.CollapseComments("site1", comments(), store.User{}), "disabled")
+
+	require.NoError(t, b.SetCollapsePolicy("site1", CollapsePolicy{Mode: CollapseCollapse, Threshold: -5}))
+	res := b.CollapseComments("site1", comments(), store.User{})
+	require.Len(t, res, 7)
+	assert.True(t, res[0].Collapsed)
+	assert.Equal(t, 2, res[0].HiddenCount)
+	assert.False(t, res[1].Collapsed)
+	assert.True(t, res[4].Collapsed)
+	assert.Equal(t, 1, res[4].HiddenCount)
+	assert.False(t, res[6].Collapsed, "deleted not collapsed")
+
+	require.NoError(t, b.SetCollapsePolicy("site1", CollapsePolicy{Mode: CollapseHide, Threshold: -5}))
+	res = b.CollapseComments("site1", comments(), store.User{})
+	ids := []string{}
+	for _, c := range res {
+		ids = append(ids, c.ID)
+	}
+	assert.Equal(t, []string{"c4", "c7"}, ids)
+	assert.Equal(t, 2, res[0].HiddenCount, "hidden reply with its own reply")
+
+	res = b.CollapseComments("site1", comments(), store.User{Admin: true})
+	require.Len(t, res, 7, "admin gets collapsed comments instead of hidden")
+	assert.True(t, res[0].Collapsed)
+}
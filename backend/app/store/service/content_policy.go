@@ -0,0 +1,155 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	log "github.com/go-pkgz/lgr"
+	bf "github.com/russross/blackfriday/v2"
+)
+
+// ContentPolicy defines comment length and content limits for the site, zero value means no limit.
+// Zero length limits are taken from DataStore's MinCommentSize and MaxCommentSize.
+type ContentPolicy struct {
+	MinLength     int     // min comment length in runes
+	MaxLength     int     // max comment length in runes
+	MaxLinks      int     // max number of links
+	MaxImages     int     // max number of images
+	MaxQuoteRatio float64 // max share of quoted text, 0..1
+}
+
+// ContentPolicyLister provides content policy per site
+type ContentPolicyLister interface {
+	Policy(siteID string) (ContentPolicy, error)
+}
+
+// StaticContentPolicyLister provides same content policy for every site
+type StaticContentPolicyLister struct {
+	ContentPolicy
+}
+
+// Policy returns content policy (ignores siteID)
+func (l StaticContentPolicyLister) Policy(_ string) (ContentPolicy, error) {
+	return l.ContentPolicy, nil
+}
+
+// ContentViolation is a machine-readable reason of comment rejection by content policy
+type ContentViolation string
+
+// content policy violations
+const (
+	ContentTooShort      ContentViolation = "too_short"
+	ContentTooLong       ContentViolation = "too_long"
+	ContentTooManyLinks  ContentViolation = "too_many_links"
+	ContentTooManyImages ContentViolation = "too_many_images"
+	ContentTooMuchQuote  ContentViolation = "too_much_quote"
+)
+
+// ContentError returned for comments violating site's content policy
+type ContentError struct {
+	Violation ContentViolation
+	Limit     int // violated limit, percents for quote ratio
+	Actual    int // actual value, percents for quote ratio
+}
+
+// Error returns human-readable description of violation
+func (e *ContentError) Error() string {
+	switch e.Violation {
+	case ContentTooShort:
+		return fmt.Sprintf("comment text is smaller than min allowed size %d (%d)", e.Limit, e.Actual)
+	case ContentTooLong:
+		return fmt.Sprintf("comment text exceeded max allowed size %d (%d)", e.Limit, e.Actual)
+	case ContentTooManyLinks:
+		return fmt.Sprintf("comment has more links than allowed %d (%d)", e.Limit, e.Actual)
+	case ContentTooManyImages:
+		return fmt.Sprintf("comment has more images than allowed %d (%d)", e.Limit, e.Actual)
+	case ContentTooMuchQuote:
+		return fmt.Sprintf("comment quoted text exceeded max allowed share %d%% (%d%%)", e.Limit, e.Actual)
+	}
+	return fmt.Sprintf("comment rejected by content policy, %s", e.Violation)
+}
+
+// SiteContentPolicy returns content policy for the site, with length limits defaulted to DataStore's ones
+func (s *DataStore) SiteContentPolicy(siteID string) ContentPolicy {
+	policy := ContentPolicy{}
+	if s.ContentPolicy != nil {
+		p, err := s.ContentPolicy.Policy(siteID)
+		if err != nil {
+			log.Printf("[WARN] failed to get content policy for site %s: %v", siteID, err)
+		} else {
+			policy = p
+		}
+	}
+	if policy.MinLength <= 0 {
+		policy.MinLength = s.MinCommentSize
+	}
+	if policy.MaxLength <= 0 {
+		policy.MaxLength = s.MaxCommentSize
+	}
+	if policy.MaxLength <= 0 {
+		policy.MaxLength = defaultCommentMaxSize
+	}
+	return policy
+}
+
+// checkLength checks comment length in runes against policy limits
+func (p ContentPolicy) checkLength(text string) error {
+	length := utf8.RuneCountInString(text)
+	if length > p.MaxLength {
+		return &ContentError{Violation: ContentTooLong, Limit: p.MaxLength, Actual: length}
+	}
+	if p.MinLength > 0 && length < p.MinLength {
+		return &ContentError{Violation: ContentTooShort, Limit: p.MinLength, Actual: length}
+	}
+	return nil
+}
+
+// checkContent checks links, images and quotes of parsed markdown against policy limits
+func (p ContentPolicy) checkContent(doc *bf.Node) error {
+	links, images, quoted, total := 0, 0, 0, 0
+	doc.Walk(func(node *bf.Node, entering bool) bf.WalkStatus {
+		if !entering {
+			return bf.GoToNext
+		}
+		switch node.Type {
+		case bf.Link:
+			links++
+		case bf.Image:
+			images++
+		case bf.HTMLSpan, bf.HTMLBlock: // raw html allowed in markdown
+			lower := strings.ToLower(string(node.Literal))
+			links += strings.Count(lower, "<a ")
+			images += strings.Count(lower, "<img")
+		case bf.Text, bf.Code, bf.CodeBlock:
+			size := utf8.RuneCount(node.Literal)
+			total += size
+			if inBlockQuote(node) {
+				quoted += size
+			}
+		}
+		return bf.GoToNext
+	})
+
+	if p.MaxLinks > 0 && links > p.MaxLinks {
+		return &ContentError{Violation: ContentTooManyLinks, Limit: p.MaxLinks, Actual: links}
+	}
+	if p.MaxImages > 0 && images > p.MaxImages {
+		return &ContentError{Violation: ContentTooManyImages, Limit: p.MaxImages, Actual: images}
+	}
+	if p.MaxQuoteRatio > 0 && total > 0 && float64(quoted)/float64(total) > p.MaxQuoteRatio {
+		return &ContentError{Violation: ContentTooMuchQuote, Limit: int(math.Round(p.MaxQuoteRatio * 100)),
+			Actual: int(math.Round(float64(quoted) * 100 / float64(total)))}
+	}
+	return nil
+}
+
+func inBlockQuote(node *bf.Node) bool {
+	for n := node.Parent; n != nil; n = n.Parent {
+		if n.Type == bf.BlockQuote {
+			return true
+		}
+	}
+	return false
+}
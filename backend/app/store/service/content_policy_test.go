@@ -0,0 +1,88 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+)
+
+type failingContentPolicyLister struct{}
+
+func (failingContentPolicyLister) Policy(string) (ContentPolicy, error) {
+	return ContentPolicy{}, errors.New("failed")
+}
+
+func TestService_SiteContentPolicy(t *testing.T) {
+	b := DataStore{}
+	assert.Equal(t, ContentPolicy{MaxLength: defaultCommentMaxSize}, b.SiteContentPolicy("radio-t"), "defaults")
+
+	b = DataStore{MinCommentSize: 5, MaxCommentSize: 100}
+	assert.Equal(t, ContentPolicy{MinLength: 5, MaxLength: 100}, b.SiteContentPolicy("radio-t"), "made from comment sizes")
+
+	b.ContentPolicy = StaticContentPolicyLister{ContentPolicy{MaxLength: 50, MaxLinks: 2, MaxQuoteRatio: 0.5}}
+	assert.Equal(t, ContentPolicy{MinLength: 5, MaxLength: 50, MaxLinks: 2, MaxQuoteRatio: 0.5}, b.SiteContentPolicy("radio-t"))
+
+	b.ContentPolicy = failingContentPolicyLister{}
+	assert.Equal(t, ContentPolicy{MinLength: 5, MaxLength: 100}, b.SiteContentPolicy("radio-t"), "lister error")
+}
+
+func TestContentPolicy_checkContent(t *testing.T) {
+	b := DataStore{AdminStore: admin.NewStaticKeyStore("secret 123"), ContentPolicy: StaticContentPolicyLister{ContentPolicy{
+		MaxLinks: 2, MaxImages: 1, MaxQuoteRatio: 0.5}}}
+	user := store.User{ID: "myid", Name: "name"}
+
+	tbl := []struct {
+		text string
+		err  *ContentError
+	}{
+		{"no links at all", nil},
+		{"two links [a](http://a.com) and [b](https://b.com)", nil},
+		{"three links [a](http://a.com), [b](https://b.com) and [c](https://c.com)",
+			&ContentError{Violation: ContentTooManyLinks, Limit: 2, Actual: 3}},
+		{"two links [a](http://a.com) and <a href=\"http://b.com\">b</a>, autolink http://c.com",
+			&ContentError{Violation: ContentTooManyLinks, Limit: 2, Actual: 3}},
+		{"image ![pic](https://example.com/1.png)", nil},
+		{"images ![pic](https://example.com/1.png) ![pic](https://example.com/2.png)",
+			&ContentError{Violation: ContentTooManyImages, Limit: 1, Actual: 2}},
+		{"image ![pic](https://example.com/1.png) <img src=\"https://example.com/2.png\">",
+			&ContentError{Violation: ContentTooManyImages, Limit: 1, Actual: 2}},
+		{"> short quote\n\nwith a longer answer to it", nil},
+		{"> a very long quote of the previous comment\n\nok",
+			&ContentError{Violation: ContentTooMuchQuote, Limit: 50, Actual: 95}},
+	}
+
+	for _, tt := range tbl {
+		t.Run(tt.text, func(t *testing.T) {
+			err := b.ValidateComment(&store.Comment{Orig: tt.text, User: user})
+			if tt.err == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var contentErr *ContentError
+			require.ErrorAs(t, err, &contentErr)
+			assert.Equal(t, tt.err, contentErr)
+		})
+	}
+}
+
+func TestContentError_Error(t *testing.T) {
+	tbl := []struct {
+		err ContentError
+		msg string
+	}{
+		{ContentError{Violation: ContentTooShort, Limit: 6, Actual: 5}, "comment text is smaller than min allowed size 6 (5)"},
+		{ContentError{Violation: ContentTooLong, Limit: 10, Actual: 11}, "comment text exceeded max allowed size 10 (11)"},
+		{ContentError{Violation: ContentTooManyLinks, Limit: 1, Actual: 2}, "comment has more links than allowed 1 (2)"},
+		{ContentError{Violation: ContentTooManyImages, Limit: 1, Actual: 3}, "comment has more images than allowed 1 (3)"},
+		{ContentError{Violation: ContentTooMuchQuote, Limit: 50, Actual: 90}, "comment quoted text exceeded max allowed share 50% (90%)"},
+		{ContentError{Violation: "other"}, "comment rejected by content policy, other"},
+	}
+	for _, tt := range tbl {
+		assert.Equal(t, tt.msg, tt.err.Error())
+	}
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"fmt"
+
+	log "github.com/go-pkgz/lgr"
+)
+
+// AuthorDeleteMode defines when authors allowed to delete own comments
+type AuthorDeleteMode string
+
+// author delete modes
+const (
+	AuthorDeleteInEditWindow AuthorDeleteMode = "edit-window" // within edit window and without replies only, default
+	AuthorDeleteAlways       AuthorDeleteMode = "always"      // any time, even with replies
+	AuthorDeleteTombstone    AuthorDeleteMode = "tombstone"   // any time, comment kept as "removed by author" tombstone with replies
+)
+
+// AuthorDeletePolicy defines author deletions for the site
+type AuthorDeletePolicy struct {
+	Mode AuthorDeleteMode
+}
+
+// AuthorDeletePolicyLister provides author delete policy per site
+type AuthorDeletePolicyLister interface {
+	Policy(siteID string) (AuthorDeletePolicy, error)
+}
+
+// StaticAuthorDeletePolicyLister provides same author delete policy for every site
+type StaticAuthorDeletePolicyLister struct {
+	AuthorDeletePolicy
+}
+
+// Policy returns author delete policy (ignores siteID)
+func (l StaticAuthorDeletePolicyLister) Policy(_ string) (AuthorDeletePolicy, error) {
+	return l.AuthorDeletePolicy, nil
+}
+
+// parseAuthorDeleteMode checks mode is known, empty mode is the default edit-window one
+func parseAuthorDeleteMode(mode string) (AuthorDeleteMode, error) {
+	switch m := AuthorDeleteMode(mode); m {
+	case "":
+		return AuthorDeleteInEditWindow, nil
+	case AuthorDeleteInEditWindow, AuthorDeleteAlways, AuthorDeleteTombstone:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown author delete mode %q", mode)
+}
+
+// SiteAuthorDeleteMode returns author delete mode for the site, edit-window if not set
+func (s *DataStore) SiteAuthorDeleteMode(siteID string) AuthorDeleteMode {
+	if s.AuthorDeletePolicy == nil {
+		return AuthorDeleteInEditWindow
+	}
+	policy, err := s.AuthorDeletePolicy.Policy(siteID)
+	if err != nil {
+		log.Printf("[WARN] failed to get author delete policy for site %s: %v", siteID, err)
+		return AuthorDeleteInEditWindow
+	}
+	mode, err := parseAuthorDeleteMode(string(policy.Mode))
+	if err != nil {
+		log.Printf("[WARN] bad author delete policy for site %s: %v", siteID, err)
+		return AuthorDeleteInEditWindow
+	}
+	return mode
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+)
+
+func TestService_SiteAuthorDeleteMode(t *testing.T) {
+	b := DataStore{}
+	assert.Equal(t, AuthorDeleteInEditWindow, b.SiteAuthorDeleteMode("radio-t"), "default")
+
+	b.AuthorDeletePolicy = StaticAuthorDeletePolicyLister{AuthorDeletePolicy{Mode: AuthorDeleteTombstone}}
+	assert.Equal(t, AuthorDeleteTombstone, b.SiteAuthorDeleteMode("radio-t"))
+
+	b.AuthorDeletePolicy = StaticAuthorDeletePolicyLister{AuthorDeletePolicy{Mode: "bad"}}
+	assert.Equal(t, AuthorDeleteInEditWindow, b.SiteAuthorDeleteMode("radio-t"), "unknown mode")
+}
+
+func TestService_DeleteByAuthor(t *testing.T) {
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+
+	prep := func(t *testing.T, mode AuthorDeleteMode) *DataStore {
+		eng, teardown := prepStoreEngine(t)
+		t.Cleanup(teardown)
+		b := &DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123"), EditDuration: time.Minute,
+			AuthorDeletePolicy: StaticAuthorDeletePolicyLister{AuthorDeletePolicy{Mode: mode}}}
+		t.Cleanup(func() { _ = b.Close() })
+
+		// old comment with reply
+		_, err := b.Create(store.Comment{ID: "old-1", Text: "old comment", Timestamp: time.Now().Add(-time.Hour),
+			Locator: locator, User: store.User{ID: "user2", Name: "user2"}})
+		require.NoError(t, err)
+		_, err = b.Create(store.Comment{ID: "reply-1", ParentID: "old-1", Text: "reply", Locator: locator,
+			User: store.User{ID: "user3", Name: "user3"}})
+		require.NoError(t, err)
+		return b
+	}
+
+	t.Run("edit-window", func(t *testing.T) {
+		b := prep(t, AuthorDeleteInEditWindow)
+		_, err := b.EditComment(locator, "old-1", EditRequest{Delete: true})
+		assert.EqualError(t, err, "too late to edit old-1")
+		_, err = b.EditComment(locator, "reply-1", EditRequest{Delete: true})
+		require.NoError(t, err)
+	})
+
+	t.Run("always", func(t *testing.T) {
+		b := prep(t, AuthorDeleteAlways)
+		_, err := b.EditComment(locator, "old-1", EditRequest{Delete: true})
+		require.NoError(t, err)
+		c, err := b.Engine.Get(getReq(locator, "old-1"))
+		require.NoError(t, err)
+		assert.True(t, c.Deleted)
+		assert.False(t, c.SelfDeleted)
+		assert.Empty(t, c.Text)
+
+		_, err = b.EditComment(locator, "reply-1", EditRequest{Orig: "edit", Text: "edit"})
+		require.NoError(t, err)
+		c, err = b.Engine.Get(getReq(locator, "reply-1"))
+		require.NoError(t, err)
+		assert.Equal(t, "edit", c.Text, "edits not affected")
+	})
+
+	t.Run("tombstone", func(t *testing.T) {
+		b := prep(t, AuthorDeleteTombstone)
+		_, err := b.EditComment(locator, "old-1", EditRequest{Delete: true})
+		require.NoError(t, err)
+		c, err := b.Engine.Get(getReq(locator, "old-1"))
+		require.NoError(t, err)
+		assert.True(t, c.Deleted)
+		assert.True(t, c.SelfDeleted)
+		assert.Empty(t, c.Text)
+		assert.Equal(t, "user2", c.User.ID, "author kept")
+
+		comments, err := b.Find(locator, "time", store.User{})
+		require.NoError(t, err)
+		tree := MakeTree(comments, "time", 0, "")
+		require.Len(t, tree.Nodes, 3)
+		assert.Equal(t, "old-1", tree.Nodes[2].Comment.ID, "tombstone kept in the tree")
+		require.Len(t, tree.Nodes[2].Replies, 1)
+		assert.Equal(t, "reply-1", tree.Nodes[2].Replies[0].Comment.ID)
+
+		_, err = b.EditComment(locator, "old-1", EditRequest{Orig: "edit", Text: "edit"})
+		assert.EqualError(t, err, "too late to edit old-1", "edits not affected")
+	})
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/settings"
+)
+
+var errEditPolicyStatic = errors.New("edit policy can't be changed at runtime")
+
+// EditPolicy defines comment edit window for the site, with overrides for user roles.
+// Zero role duration means the same window as for regular users.
+type EditPolicy struct {
+	Duration         time.Duration `json:"duration"`          // edit window for regular users, zero for unlimited
+	VerifiedDuration time.Duration `json:"verified_duration"` // edit window for verified users
+	AdminDuration    time.Duration `json:"admin_duration"`    // edit window for admins editing own comments
+}
+
+// EditPolicyLister provides edit policy per site
+type EditPolicyLister interface {
+	Policy(siteID string) (EditPolicy, error)
+}
+
+// StaticEditPolicyLister provides same edit policy for every site
+type StaticEditPolicyLister struct {
+	EditPolicy
+}
+
+// Policy returns edit policy (ignores siteID)
+func (l StaticEditPolicyLister) Policy(_ string) (EditPolicy, error) {
+	return l.EditPolicy, nil
+}
+
+// EditPolicies keeps default edit policy with per-site overrides changeable at runtime,
+// saved to the settings store once restored from it.
+type EditPolicies struct {
+	defaultPolicy EditPolicy
+	sites         siteSettings[EditPolicy]
+}
+
+// NewEditPolicies makes EditPolicies with default policy for all sites
+func NewEditPolicies(defaultPolicy EditPolicy) *EditPolicies {
+	return &EditPolicies{defaultPolicy: defaultPolicy, sites: siteSettings[EditPolicy]{name: "edit_policy"}}
+}
+
+// Restore loads overrides saved in the settings store and saves further changes there
+func (p *EditPolicies) Restore(store settings.Store) error {
+	return p.sites.restore(store, EditPolicy.validate)
+}
+
+// Policy returns edit policy for the site, default one if not overridden
+func (p *EditPolicies) Policy(siteID string) (EditPolicy, error) {
+	if policy, ok := p.sites.get(siteID); ok {
+		return policy, nil
+	}
+	return p.defaultPolicy, nil
+}
+
+// SetPolicy overrides edit policy for the site
+func (p *EditPolicies) SetPolicy(siteID string, policy EditPolicy) error {
+	if err := policy.validate(); err != nil {
+		return err
+	}
+	return p.sites.set(siteID, policy)
+}
+
+// ResetPolicy removes site's override, i.e. site gets default policy back
+func (p *EditPolicies) ResetPolicy(siteID string) error {
+	return p.sites.reset(siteID)
+}
+
+// validate rejects negative edit windows
+func (p EditPolicy) validate() error {
+	if p.Duration < 0 || p.VerifiedDuration < 0 || p.AdminDuration < 0 {
+		return errors.New("edit duration can't be negative")
+	}
+	return nil
+}
+
+// window returns edit window for the user role, zero for unlimited
+func (p EditPolicy) window(verified, admin bool) time.Duration {
+	switch {
+	case admin && p.AdminDuration > 0:
+		return p.AdminDuration
+	case verified && p.VerifiedDuration > 0:
+		return p.VerifiedDuration
+	}
+	return p.Duration
+}
+
+// SiteEditPolicy returns edit policy for the site, made from EditDuration if no edit policy set
+func (s *DataStore) SiteEditPolicy(siteID string) EditPolicy {
+	if s.EditPolicy == nil {
+		return EditPolicy{Duration: s.EditDuration}
+	}
+	policy, err := s.EditPolicy.Policy(siteID)
+	if err != nil {
+		log.Printf("[WARN] failed to get edit policy for site %s: %v", siteID, err)
+		return EditPolicy{Duration: s.EditDuration}
+	}
+	return policy
+}
+
+// SetEditPolicy changes edit policy for the site at runtime
+func (s *DataStore) SetEditPolicy(siteID string, policy EditPolicy) error {
+	policies, ok := s.EditPolicy.(*EditPolicies)
+	if !ok {
+		return errEditPolicyStatic
+	}
+	return policies.SetPolicy(siteID, policy)
+}
+
+// ResetEditPolicy removes runtime changes of the site's edit policy
+func (s *DataStore) ResetEditPolicy(siteID string) error {
+	policies, ok := s.EditPolicy.(*EditPolicies)
+	if !ok {
+		return errEditPolicyStatic
+	}
+	return policies.ResetPolicy(siteID)
+}
+
+// EditTimeLeft returns how long the comment can still be edited by its author, ok is false if it can't be edited anymore.
+// Zero duration with ok true means no time limit. Follows EditComment rules, i.e. comments with replies are not editable.
+func (s *DataStore) EditTimeLeft(comment store.Comment, admin bool) (left time.Duration, ok bool) {
+	if admin && s.AdminEdits {
+		return 0, true
+	}
+	window := s.SiteEditPolicy(comment.Locator.SiteID).window(s.IsVerified(comment.Locator.SiteID, comment.User.ID), admin)
+	if window > 0 {
+		if left = time.Until(comment.Timestamp.Add(window)); left <= 0 {
+			return 0, false
+		}
+	}
+	if s.HasReplies(comment) {
+		return 0, false
+	}
+	return left, true
+}
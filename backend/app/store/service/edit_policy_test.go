@@ -0,0 +1,143 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+)
+
+func TestEditPolicies(t *testing.T) {
+	p := NewEditPolicies(EditPolicy{Duration: time.Minute})
+
+	policy, err := p.Policy("site1")
+	require.NoError(t, err)
+	assert.Equal(t, EditPolicy{Duration: time.Minute}, policy, "default policy")
+
+	require.NoError(t, p.SetPolicy("site1", EditPolicy{Duration: time.Hour, VerifiedDuration: 24 * time.Hour}))
+	policy, err = p.Policy("site1")
+	require.NoError(t, err)
+	assert.Equal(t, EditPolicy{Duration: time.Hour, VerifiedDuration: 24 * time.Hour}, policy)
+	policy, err = p.Policy("site2")
+	require.NoError(t, err)
+	assert.Equal(t, EditPolicy{Duration: time.Minute}, policy, "other sites not affected")
+
+	assert.EqualError(t, p.SetPolicy("site1", EditPolicy{AdminDuration: -time.Second}), "edit duration can't be negative")
+
+	require.NoError(t, p.ResetPolicy("site1"))
+	policy, err = p.Policy("site1")
+	require.NoError(t, err)
+	assert.Equal(t, EditPolicy{Duration: time.Minute}, policy)
+}
+
+func TestEditPolicy_window(t *testing.T) {
+	p := EditPolicy{Duration: time.Minute, VerifiedDuration: time.Hour}
+	assert.Equal(t, time.Minute, p.window(false, false))
+	assert.Equal(t, time.Hour, p.window(true, false))
+	assert.Equal(t, time.Minute, p.window(false, true), "admin window not set")
+
+	p.AdminDuration = 2 * time.Hour
+	assert.Equal(t, 2*time.Hour, p.window(true, true))
+}
+
+func TestService_SiteEditPolicy(t *testing.T) {
+	b := DataStore{EditDuration: 5 * time.Minute}
+	assert.Equal(t, EditPolicy{Duration: 5 * time.Minute}, b.SiteEditPolicy("radio-t"), "made from EditDuration")
+	assert.EqualError(t, b.SetEditPolicy("radio-t", EditPolicy{Duration: time.Hour}), "edit policy can't be changed at runtime")
+	assert.EqualError(t, b.ResetEditPolicy("radio-t"), "edit policy can't be changed at runtime")
+
+	b.EditPolicy = StaticEditPolicyLister{EditPolicy{Duration: time.Minute}}
+	assert.Equal(t, EditPolicy{Duration: time.Minute}, b.SiteEditPolicy("radio-t"))
+	assert.Error(t, b.SetEditPolicy("radio-t", EditPolicy{Duration: time.Hour}), "static policy")
+
+	b.EditPolicy = NewEditPolicies(EditPolicy{Duration: time.Minute})
+	require.NoError(t, b.SetEditPolicy("radio-t", EditPolicy{Duration: time.Hour}))
+	assert.Equal(t, EditPolicy{Duration: time.Hour}, b.SiteEditPolicy("radio-t"))
+	require.NoError(t, b.ResetEditPolicy("radio-t"))
+	assert.Equal(t, EditPolicy{Duration: time.Minute}, b.SiteEditPolicy("radio-t"))
+}
+
+func TestService_EditCommentWithEditPolicy(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	policies := NewEditPolicies(EditPolicy{Duration: time.Minute})
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123"), EditPolicy: policies}
+	defer b.Close()
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+
+	// comment made two hours ago
+	c := store.Comment{ID: "old-1", Text: "old comment", Timestamp: time.Now().Add(-2 * time.Hour), Locator: locator,
+		User: store.User{ID: "user2", Name: "user2"}}
+	_, err := b.Create(c)
+	require.NoError(t, err)
+
+	_, err = b.EditComment(locator, "old-1", EditRequest{Orig: "edit", Text: "edit"})
+	assert.EqualError(t, err, "too late to edit old-1")
+
+	require.NoError(t, policies.SetPolicy("radio-t", EditPolicy{Duration: time.Minute, VerifiedDuration: 24 * time.Hour}))
+	_, err = b.EditComment(locator, "old-1", EditRequest{Orig: "edit", Text: "edit"})
+	assert.EqualError(t, err, "too late to edit old-1", "not verified")
+
+	require.NoError(t, b.SetVerified("radio-t", "user2", true))
+	res, err := b.EditComment(locator, "old-1", EditRequest{Orig: "edit", Text: "edit"})
+	require.NoError(t, err, "verified user gets longer window")
+	assert.True(t, res.Edited)
+
+	require.NoError(t, policies.SetPolicy("radio-t", EditPolicy{Duration: time.Minute, AdminDuration: 3 * time.Hour}))
+	_, err = b.EditComment(locator, "old-1", EditRequest{Orig: "edit", Text: "edit", Admin: true})
+	require.NoError(t, err, "admin window")
+
+	comments, err := b.Find(locator, "time", store.User{})
+	require.NoError(t, err)
+	require.Len(t, comments, 3)
+	for _, c := range comments {
+		assert.Equal(t, c.ID == "old-1", c.Edited, "edited marker for %s", c.ID)
+		assert.Equal(t, c.ID == "old-1", c.Edit != nil, "last edit info for %s", c.ID)
+	}
+}
+
+func TestService_EditTimeLeft(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123"),
+		EditPolicy: StaticEditPolicyLister{EditPolicy{Duration: time.Hour, VerifiedDuration: 3 * time.Hour}}}
+	defer b.Close()
+	locator := store.Locator{URL: "https://radio-t.com/new", SiteID: "radio-t"}
+
+	c := store.Comment{ID: "c1", Text: "comment", Timestamp: time.Now().Add(-30 * time.Minute), Locator: locator,
+		User: store.User{ID: "user2", Name: "user2"}}
+	_, err := b.Create(c)
+	require.NoError(t, err)
+
+	left, ok := b.EditTimeLeft(c, false)
+	assert.True(t, ok)
+	assert.InDelta(t, 30*time.Minute, left, float64(time.Minute))
+
+	require.NoError(t, b.SetVerified("radio-t", "user2", true))
+	left, ok = b.EditTimeLeft(c, false)
+	assert.True(t, ok)
+	assert.InDelta(t, 150*time.Minute, left, float64(time.Minute), "verified window")
+
+	c.Timestamp = time.Now().Add(-4 * time.Hour)
+	_, ok = b.EditTimeLeft(c, false)
+	assert.False(t, ok, "window is over")
+	b.AdminEdits = true
+	left, ok = b.EditTimeLeft(c, true)
+	assert.True(t, ok, "admin edits allowed any time")
+	assert.Zero(t, left)
+
+	b.AdminEdits = false
+	b.EditPolicy = StaticEditPolicyLister{EditPolicy{}}
+	left, ok = b.EditTimeLeft(c, false)
+	assert.True(t, ok, "no time limit")
+	assert.Zero(t, left)
+
+	_, err = b.Create(store.Comment{ID: "c2", ParentID: "c1", Text: "reply", Locator: locator, User: store.User{ID: "user3", Name: "user3"}})
+	require.NoError(t, err)
+	_, ok = b.EditTimeLeft(c, false)
+	assert.False(t, ok, "comment with reply")
+}
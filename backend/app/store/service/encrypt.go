@@ -0,0 +1,176 @@
+package service
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+// encryptedPrefix marks values encrypted by DetailCipher
+const encryptedPrefix = "enc:"
+
+// DetailCipher encrypts sensitive user details at rest. Values are encrypted with the current key and
+// decrypted with any known key, old keys kept to read values until they are re-encrypted after rotation.
+// Encrypted value is "enc:<key id>:<data>", key id allows to find values not encrypted with the current key.
+type DetailCipher struct {
+	current string                 // id of the key used for encryption
+	keys    map[string]cipher.AEAD // all known keys by id
+}
+
+// NewDetailCipher makes DetailCipher encrypting with the key, old keys used for decryption only
+func NewDetailCipher(key string, oldKeys ...string) (*DetailCipher, error) {
+	res := &DetailCipher{keys: map[string]cipher.AEAD{}}
+	for i, k := range append([]string{key}, oldKeys...) {
+		if k == "" {
+			return nil, errors.New("empty encryption key")
+		}
+		block, err := aes.NewCipher(deriveKey(k, "detail"))
+		if err != nil {
+			return nil, fmt.Errorf("can't make cipher: %w", err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("can't make gcm: %w", err)
+		}
+		id := hex.EncodeToString(deriveKey(k, "id")[:4])
+		if i == 0 {
+			res.current = id
+		}
+		res.keys[id] = aead
+	}
+	return res, nil
+}
+
+// Encrypt returns the value encrypted with the current key. Empty and already encrypted values returned as is.
+func (c *DetailCipher) Encrypt(val string) (string, error) {
+	if val == "" || IsEncrypted(val) {
+		return val, nil
+	}
+	aead := c.keys[c.current]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("can't make nonce: %w", err)
+	}
+	data := aead.Seal(nonce, nonce, []byte(val), nil)
+	return encryptedPrefix + c.current + ":" + base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// Decrypt returns the original value. Values not encrypted by the cipher returned as is.
+func (c *DetailCipher) Decrypt(val string) (string, error) {
+	if !IsEncrypted(val) {
+		return val, nil
+	}
+	id, encoded, ok := strings.Cut(strings.TrimPrefix(val, encryptedPrefix), ":")
+	if !ok {
+		return "", errors.New("malformed encrypted value")
+	}
+	aead, ok := c.keys[id]
+	if !ok {
+		return "", fmt.Errorf("unknown encryption key %s", id)
+	}
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("can't decode encrypted value: %w", err)
+	}
+	if len(data) < aead.NonceSize() {
+		return "", errors.New("encrypted value too short")
+	}
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	res, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("can't decrypt value: %w", err)
+	}
+	return string(res), nil
+}
+
+// IsCurrent checks if the value is empty or encrypted with the current key, i.e. doesn't need re-encryption
+func (c *DetailCipher) IsCurrent(val string) bool {
+	return val == "" || strings.HasPrefix(val, encryptedPrefix+c.current+":")
+}
+
+// IsEncrypted checks if value was encrypted by DetailCipher
+func IsEncrypted(val string) bool {
+	return strings.HasPrefix(val, encryptedPrefix)
+}
+
+// ReencryptDetails encrypts sensitive details of all site users with the current key, the ones stored in
+// plain form or encrypted with an old key. Returns number of updated details.
+func (s *DataStore) ReencryptDetails(siteID string) (int, error) {
+	if s.DetailCipher == nil {
+		return 0, errors.New("encryption is not enabled")
+	}
+	entries, err := s.Engine.UserDetail(engine.UserDetailRequest{Locator: store.Locator{SiteID: siteID}, Detail: engine.AllUserDetails})
+	if err != nil {
+		return 0, fmt.Errorf("can't get user details for %s: %w", siteID, err)
+	}
+
+	count := 0
+	var errs []error
+	update := func(userID string, detail engine.UserDetail, val string) {
+		req := engine.UserDetailRequest{Locator: store.Locator{SiteID: siteID}, UserID: userID, Detail: detail, Update: val}
+		if _, err := s.Engine.UserDetail(req); err != nil {
+			errs = append(errs, fmt.Errorf("can't update %s of %s: %w", detail, userID, err))
+			return
+		}
+		count++
+	}
+	for _, entry := range entries {
+		if !s.DetailCipher.IsCurrent(entry.Email) {
+			email, err := s.storedEmail(entry.Email)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("can't re-encrypt email of %s: %w", entry.UserID, err))
+			} else {
+				update(entry.UserID, engine.UserEmail, email)
+			}
+		}
+		if !s.DetailCipher.IsCurrent(entry.Telegram) {
+			telegram, err := s.storedDetail(entry.Telegram)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("can't re-encrypt telegram of %s: %w", entry.UserID, err))
+			} else {
+				update(entry.UserID, engine.UserTelegram, telegram)
+			}
+		}
+		if !s.DetailCipher.IsCurrent(entry.TOTP) {
+			totp, err := s.storedDetail(entry.TOTP)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("can't re-encrypt totp of %s: %w", entry.UserID, err))
+			} else {
+				update(entry.UserID, engine.UserTOTP, totp)
+			}
+		}
+	}
+	log.Printf("[INFO] re-encrypted %d user details for %s", count, siteID)
+	return count, errors.Join(errs...)
+}
+
+// storedDetail returns the detail value to persist, encrypted with the current key if encryption enabled.
+// Accepts both plain and stored values.
+func (s *DataStore) storedDetail(val string) (string, error) {
+	if s.DetailCipher == nil {
+		return val, nil
+	}
+	plain, err := s.DetailCipher.Decrypt(val)
+	if err != nil {
+		return "", err
+	}
+	return s.DetailCipher.Encrypt(plain)
+}
+
+// readDetail returns the plain detail value from the stored one
+func (s *DataStore) readDetail(val string) (string, error) {
+	if s.DetailCipher == nil {
+		return val, nil
+	}
+	return s.DetailCipher.Decrypt(val)
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+func TestDetailCipher(t *testing.T) {
+	_, err := NewDetailCipher("")
+	require.Error(t, err)
+	_, err = NewDetailCipher("key", "")
+	require.Error(t, err)
+
+	oldCipher, err := NewDetailCipher("old-key")
+	require.NoError(t, err)
+	c, err := NewDetailCipher("new-key", "old-key")
+	require.NoError(t, err)
+
+	enc, err := c.Encrypt("12345")
+	require.NoError(t, err)
+	assert.True(t, IsEncrypted(enc))
+	assert.NotContains(t, enc, "12345")
+	assert.True(t, c.IsCurrent(enc))
+	again, err := c.Encrypt(enc)
+	require.NoError(t, err)
+	assert.Equal(t, enc, again, "encrypted value kept")
+	empty, err := c.Encrypt("")
+	require.NoError(t, err)
+	assert.Empty(t, empty)
+	assert.True(t, c.IsCurrent(""))
+	assert.False(t, c.IsCurrent("12345"))
+
+	val, err := c.Decrypt(enc)
+	require.NoError(t, err)
+	assert.Equal(t, "12345", val)
+	val, err = c.Decrypt("plain")
+	require.NoError(t, err)
+	assert.Equal(t, "plain", val, "plain value returned as is")
+
+	// value encrypted with the old key readable, but not current
+	oldEnc, err := oldCipher.Encrypt("12345")
+	require.NoError(t, err)
+	assert.False(t, c.IsCurrent(oldEnc))
+	val, err = c.Decrypt(oldEnc)
+	require.NoError(t, err)
+	assert.Equal(t, "12345", val)
+	_, err = oldCipher.Decrypt(enc)
+	require.Error(t, err, "new key unknown to old cipher")
+
+	id := strings.Split(enc, ":")[1]
+	for _, bad := range []string{"enc:abc", "enc:" + id + ":!!!", "enc:" + id + ":AAAA", "enc:" + id + ":" + strings.Repeat("A", 40)} {
+		_, err = c.Decrypt(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestService_ReencryptDetails(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+	defer b.Close()
+
+	_, err := b.ReencryptDetails("radio-t")
+	require.Error(t, err, "encryption disabled")
+
+	// details stored in plain form
+	_, err = b.SetUserEmail("radio-t", "user1", "user1@example.com")
+	require.NoError(t, err)
+	_, err = b.SetUserTelegram("radio-t", "user1", "tg1")
+	require.NoError(t, err)
+
+	// details encrypted with the old key
+	b.DetailCipher, err = NewDetailCipher("old-key")
+	require.NoError(t, err)
+	_, err = b.SetUserTelegram("radio-t", "user2", "tg2")
+	require.NoError(t, err)
+	stored, err := eng.UserDetail(engine.UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "user2", Detail: engine.UserTelegram})
+	require.NoError(t, err)
+	require.Len(t, stored, 1)
+	assert.True(t, IsEncrypted(stored[0].Telegram))
+
+	b.DetailCipher, err = NewDetailCipher("new-key", "old-key")
+	require.NoError(t, err)
+	count, err := b.ReencryptDetails("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+	count, err = b.ReencryptDetails("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, 0, count, "all details encrypted with the current key")
+
+	all, err := eng.UserDetail(engine.UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, Detail: engine.AllUserDetails})
+	require.NoError(t, err)
+	for _, entry := range all {
+		assert.True(t, b.DetailCipher.IsCurrent(entry.Email), entry.Email)
+		assert.True(t, b.DetailCipher.IsCurrent(entry.Telegram), entry.Telegram)
+	}
+
+	// old key not needed anymore
+	b.DetailCipher, err = NewDetailCipher("new-key")
+	require.NoError(t, err)
+	email, err := b.GetUserEmail("radio-t", "user1")
+	require.NoError(t, err)
+	assert.Equal(t, "user1@example.com", email)
+	telegram, err := b.GetUserTelegram("radio-t", "user1")
+	require.NoError(t, err)
+	assert.Equal(t, "tg1", telegram)
+	telegram, err = b.GetUserTelegram("radio-t", "user2")
+	require.NoError(t, err)
+	assert.Equal(t, "tg2", telegram)
+
+	// exported details encrypted, imported ones encrypted too
+	umetas, _, err := b.Metas("radio-t")
+	require.NoError(t, err)
+	for _, um := range umetas {
+		assert.False(t, strings.Contains(um.Details.Email, "@"), um.Details.Email)
+	}
+	require.NoError(t, b.SetMetas("radio-t", []UserMetaData{{ID: "user3", Details: engine.UserDetailEntry{Email: "user3@example.com"}}}, nil))
+	stored, err = eng.UserDetail(engine.UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "user3", Detail: engine.UserEmail})
+	require.NoError(t, err)
+	require.Len(t, stored, 1)
+	assert.True(t, IsEncrypted(stored[0].Email))
+}
+
+func TestService_EncryptedPIIEmail(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+	defer b.Close()
+
+	var err error
+	b.PII, err = NewPIIVault("secret")
+	require.NoError(t, err)
+	b.DetailCipher, err = NewDetailCipher("key")
+	require.NoError(t, err)
+
+	_, err = b.SetUserEmail("radio-t", "user1", "user1@example.com")
+	require.NoError(t, err)
+	stored, err := eng.UserDetail(engine.UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "user1", Detail: engine.UserEmail})
+	require.NoError(t, err)
+	require.Len(t, stored, 1)
+	assert.True(t, IsEncrypted(stored[0].Email))
+	sealed, err := b.DetailCipher.Decrypt(stored[0].Email)
+	require.NoError(t, err)
+	assert.True(t, IsSealed(sealed), "sealed email encrypted")
+
+	email, err := b.GetUserEmail("radio-t", "user1")
+	require.NoError(t, err)
+	assert.Equal(t, "user1@example.com", email)
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/event"
+)
+
+var errEventsDisabled = errors.New("events journal disabled")
+
+// EventPublisher publishes events to external consumers, like message bus
+type EventPublisher interface {
+	Submit(e event.Event)
+	Close() error
+}
+
+// Events returns site's events with ID greater than after, oldest first, up to limit
+func (s *DataStore) Events(siteID string, after uint64, limit int) ([]event.Event, error) {
+	if s.EventStore == nil {
+		return nil, errEventsDisabled
+	}
+	return s.EventStore.List(siteID, after, limit)
+}
+
+// emit appends the event to the journal and submits it to the publisher, if enabled.
+// Failure is logged only, as the change is already made. Events not journaled are published with zero ID.
+func (s *DataStore) emit(e event.Event) {
+	if s.EventStore == nil && s.EventPublisher == nil {
+		return
+	}
+	e.Timestamp = time.Now()
+	if s.EventStore != nil {
+		journaled, err := s.EventStore.Append(e)
+		if err != nil {
+			log.Printf("[WARN] failed to journal event %s of %s, %v", e.Type, e.SiteID, err)
+		}
+		e.ID = journaled.ID
+	}
+	if s.EventPublisher != nil {
+		s.EventPublisher.Submit(e)
+	}
+}
+
+// emitComment appends the event of the comment to the journal
+func (s *DataStore) emitComment(eventType string, c store.Comment, data map[string]any) {
+	s.emit(event.Event{Type: eventType, SiteID: c.Locator.SiteID, URL: c.Locator.URL, CommentID: c.ID,
+		UserID: c.User.ID, Data: data})
+}
+
+// deleteModeName returns name of the delete mode for events, "soft" or "hard"
+func deleteModeName(mode store.DeleteMode) string {
+	if mode == store.HardDelete {
+		return "hard"
+	}
+	return "soft"
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/event"
+)
+
+func TestService_Events(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123"), MaxVotes: -1}
+	defer b.Close()
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+
+	_, err := b.Events("radio-t", 0, 10)
+	require.EqualError(t, err, "events journal disabled")
+	_, err = b.Create(store.Comment{Text: "not journaled", Locator: locator, User: store.User{ID: "user1", Name: "user1"}})
+	require.NoError(t, err)
+
+	b.EventStore, err = event.NewBoltStorage(path.Join(t.TempDir(), "events.db"), bolt.Options{})
+	require.NoError(t, err)
+
+	id, err := b.Create(store.Comment{Text: "text", Locator: locator, User: store.User{ID: "user2", Name: "user2"}})
+	require.NoError(t, err)
+	_, err = b.Create(store.Comment{Text: "imported", Locator: locator, User: store.User{ID: "user2"}, Imported: true})
+	require.NoError(t, err)
+	_, err = b.Vote(VoteReq{Locator: locator, CommentID: id, UserID: "user3", Val: true})
+	require.NoError(t, err)
+	_, err = b.EditComment(locator, id, EditRequest{Orig: "edited", Text: "edited", Summary: "typo"})
+	require.NoError(t, err)
+	require.NoError(t, b.SetPin(locator, id, true))
+	require.NoError(t, b.SetReadOnly(locator, true))
+	require.NoError(t, b.SetVerified("radio-t", "user2", true))
+	require.NoError(t, b.SetBlock("radio-t", "user3", true, time.Hour))
+	require.NoError(t, b.Delete(locator, id, store.HardDelete))
+	require.NoError(t, b.DeleteUser("radio-t", "user4", store.SoftDelete))
+
+	events, err := b.Events("radio-t", 0, 100)
+	require.NoError(t, err)
+	types := []string{}
+	for i, e := range events {
+		assert.Equal(t, uint64(i+1), e.ID)
+		assert.Equal(t, "radio-t", e.SiteID)
+		assert.False(t, e.Timestamp.IsZero())
+		types = append(types, e.Type)
+	}
+	assert.Equal(t, []string{event.CommentCreated, event.CommentVoted, event.CommentUpdated, event.CommentPinned,
+		event.PostReadOnly, event.UserVerified, event.UserBlocked, event.CommentDeleted, event.UserDeleted}, types,
+		"imported comment not journaled")
+
+	assert.Equal(t, id, events[0].CommentID)
+	assert.Equal(t, "user2", events[0].UserID)
+	assert.Equal(t, locator.URL, events[0].URL)
+	assert.Equal(t, map[string]any{"parent_id": "", "visibility": ""}, events[0].Data, "only ids kept, no text")
+	assert.Equal(t, map[string]any{"value": true, "score": 1.0}, events[1].Data)
+	assert.Equal(t, "user3", events[1].UserID, "voter")
+	assert.Equal(t, map[string]any{"summary": "typo"}, events[2].Data)
+	assert.Equal(t, map[string]any{"status": true, "ttl": 3600.0}, events[6].Data)
+	assert.Equal(t, map[string]any{"mode": "hard"}, events[7].Data)
+	assert.Equal(t, map[string]any{"mode": "soft"}, events[8].Data)
+
+	events, err = b.Events("radio-t", 7, 1)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, event.CommentDeleted, events[0].Type)
+
+	_, err = b.Vote(VoteReq{Locator: locator, CommentID: "unknown", UserID: "user3", Val: true})
+	require.Error(t, err)
+	events, err = b.Events("radio-t", 9, 10)
+	require.NoError(t, err)
+	assert.Empty(t, events, "failed change not journaled")
+
+	// deleted user's events purged, the deletion journaled
+	require.NoError(t, b.DeleteUser("radio-t", "user3", store.SoftDelete))
+	events, err = b.Events("radio-t", 0, 100)
+	require.NoError(t, err)
+	ids := []uint64{}
+	for _, e := range events {
+		ids = append(ids, e.ID)
+		if e.ID < 10 {
+			assert.NotEqual(t, "user3", e.UserID)
+		}
+	}
+	assert.Equal(t, []uint64{1, 3, 4, 5, 6, 8, 9, 10}, ids)
+	assert.Equal(t, event.UserDeleted, events[7].Type)
+	assert.Equal(t, "user3", events[7].UserID)
+}
+
+func TestService_EventPublisher(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	pub := &mockEventPublisher{}
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123"), EventPublisher: pub}
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+
+	id, err := b.Create(store.Comment{Text: "text", Locator: locator, User: store.User{ID: "user2", Name: "user2"}})
+	require.NoError(t, err)
+	require.Len(t, pub.events, 1)
+	assert.Equal(t, event.CommentCreated, pub.events[0].Type)
+	assert.Equal(t, id, pub.events[0].CommentID)
+	assert.Zero(t, pub.events[0].ID, "not journaled")
+
+	b.EventStore, err = event.NewBoltStorage(path.Join(t.TempDir(), "events.db"), bolt.Options{})
+	require.NoError(t, err)
+	require.NoError(t, b.SetPin(locator, id, true))
+	require.Len(t, pub.events, 2)
+	assert.Equal(t, event.CommentPinned, pub.events[1].Type)
+	assert.Equal(t, uint64(1), pub.events[1].ID, "journaled")
+
+	require.NoError(t, b.Close())
+	assert.True(t, pub.closed)
+}
+
+type mockEventPublisher struct {
+	events []event.Event
+	closed bool
+}
+
+func (m *mockEventPublisher) Submit(e event.Event) { m.events = append(m.events, e) }
+
+func (m *mockEventPublisher) Close() error {
+	m.closed = true
+	return nil
+}
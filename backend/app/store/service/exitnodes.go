@@ -0,0 +1,111 @@
+package service
+
+import (
+	"errors"
+
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark42/backend/app/store"
+)
+
+// IPMatcher checks if ip is in the list, i.e. in Tor exit nodes
+type IPMatcher interface {
+	Contains(ip string) bool
+}
+
+// NetworkAction defines handling of comments from anonymizing networks
+type NetworkAction string
+
+// enum of all network actions
+const (
+	NetworkAllow    NetworkAction = "allow"
+	NetworkModerate NetworkAction = "moderate"
+	NetworkBlock    NetworkAction = "block"
+)
+
+// ExitNodePolicy defines handling of comments from Tor exit nodes and known VPNs, empty actions allow comments
+type ExitNodePolicy struct {
+	Tor NetworkAction
+	VPN NetworkAction
+}
+
+// ExitNodePolicyLister provides exit nodes policy per site
+type ExitNodePolicyLister interface {
+	Policy(siteID string) (ExitNodePolicy, error)
+}
+
+// StaticExitNodePolicyLister provides exit nodes policy set for sites, with default one for all other sites
+type StaticExitNodePolicyLister struct {
+	Default ExitNodePolicy
+	Sites   map[string]ExitNodePolicy // site id to policy, actions set for the site replace default ones
+}
+
+// Policy returns exit nodes policy of the site, default actions used for networks not set for the site
+func (l StaticExitNodePolicyLister) Policy(siteID string) (ExitNodePolicy, error) {
+	res := l.Default
+	site, ok := l.Sites[siteID]
+	if !ok {
+		return res, nil
+	}
+	if site.Tor != "" {
+		res.Tor = site.Tor
+	}
+	if site.VPN != "" {
+		res.VPN = site.VPN
+	}
+	return res, nil
+}
+
+// Uses checks if any site, or default policy, holds or blocks comments from the network, "tor" or "vpn"
+func (l StaticExitNodePolicyLister) Uses(network string) bool {
+	restricts := func(p ExitNodePolicy) bool {
+		a := p.Tor
+		if network == "vpn" {
+			a = p.VPN
+		}
+		return a != "" && a != NetworkAllow
+	}
+	if restricts(l.Default) {
+		return true
+	}
+	for siteID := range l.Sites {
+		if p, _ := l.Policy(siteID); restricts(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrExitNodeBlocked returned in case comments are not allowed from Tor or VPN the commenter uses
+var ErrExitNodeBlocked = errors.New("comments are not allowed from anonymizing networks")
+
+// applyExitNodePolicy rejects or holds for review comments made from Tor exit nodes or known VPNs.
+// Should be called before ip hashed. Admins and imported comments are exempt.
+func (s *DataStore) applyExitNodePolicy(c *store.Comment) error {
+	if s.ExitNodePolicy == nil || c.Imported || c.User.Admin || c.User.IP == "" {
+		return nil
+	}
+	policy, err := s.ExitNodePolicy.Policy(c.Locator.SiteID)
+	if err != nil {
+		log.Printf("[WARN] failed to get exit nodes policy for site %s: %v", c.Locator.SiteID, err)
+		return nil
+	}
+
+	actions := []NetworkAction{}
+	if policy.Tor != "" && policy.Tor != NetworkAllow && s.TorExits != nil && s.TorExits.Contains(c.User.IP) {
+		actions = append(actions, policy.Tor)
+	}
+	if policy.VPN != "" && policy.VPN != NetworkAllow && s.VPNs != nil && s.VPNs.Contains(c.User.IP) {
+		actions = append(actions, policy.VPN)
+	}
+	for _, a := range actions {
+		if a == NetworkBlock {
+			log.Printf("[INFO] comment from %s rejected, anonymizing network", c.User.ID)
+			return ErrExitNodeBlocked
+		}
+	}
+	if len(actions) > 0 && c.Visibility == "" {
+		c.Visibility = store.VisibilityPending
+	}
+	return nil
+}
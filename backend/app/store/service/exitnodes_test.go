@@ -0,0 +1,97 @@
+package service
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+)
+
+func TestService_CreateWithExitNodePolicy(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123"),
+		TorExits: ipMatcherMock{"1.1.1.1", "3.3.3.3"}, VPNs: ipMatcherMock{"2.2.2.2", "3.3.3.3"}}
+	defer b.Close()
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	comment := func(ip string) store.Comment {
+		return store.Comment{Text: "text", Locator: locator, User: store.User{ID: "user2", Name: "user2", IP: ip}}
+	}
+
+	_, err := b.Create(comment("1.1.1.1"))
+	require.NoError(t, err, "policy disabled")
+
+	tbl := []struct {
+		policy  ExitNodePolicy
+		ip      string
+		err     error
+		pending bool
+	}{
+		{ExitNodePolicy{Tor: NetworkBlock}, "1.1.1.1", ErrExitNodeBlocked, false},
+		{ExitNodePolicy{Tor: NetworkBlock}, "2.2.2.2", nil, false},
+		{ExitNodePolicy{Tor: NetworkModerate}, "1.1.1.1", nil, true},
+		{ExitNodePolicy{Tor: NetworkAllow, VPN: NetworkModerate}, "1.1.1.1", nil, false},
+		{ExitNodePolicy{Tor: NetworkAllow, VPN: NetworkModerate}, "2.2.2.2", nil, true},
+		{ExitNodePolicy{Tor: NetworkModerate, VPN: NetworkBlock}, "3.3.3.3", ErrExitNodeBlocked, false},
+		{ExitNodePolicy{Tor: NetworkBlock, VPN: NetworkBlock}, "4.4.4.4", nil, false},
+	}
+	for i, tt := range tbl {
+		b.ExitNodePolicy = StaticExitNodePolicyLister{Default: tt.policy}
+		id, err := b.Create(comment(tt.ip))
+		if tt.err != nil {
+			assert.ErrorIs(t, err, tt.err, "case #%d", i)
+			continue
+		}
+		require.NoError(t, err, "case #%d", i)
+		c, err := b.Engine.Get(getReq(locator, id))
+		require.NoError(t, err)
+		assert.Equal(t, tt.pending, c.Visibility == store.VisibilityPending, "case #%d", i)
+	}
+
+	b.ExitNodePolicy = StaticExitNodePolicyLister{Default: ExitNodePolicy{Tor: NetworkBlock}}
+	c := comment("1.1.1.1")
+	c.User.Admin = true
+	_, err = b.Create(c)
+	require.NoError(t, err, "admin exempt")
+
+	c = comment("1.1.1.1")
+	c.Imported = true
+	_, err = b.Create(c)
+	require.NoError(t, err, "imported comment exempt")
+
+	b.TorExits = nil
+	_, err = b.Create(comment("1.1.1.1"))
+	require.NoError(t, err, "no tor list")
+}
+
+func TestStaticExitNodePolicyLister(t *testing.T) {
+	l := StaticExitNodePolicyLister{Default: ExitNodePolicy{Tor: NetworkModerate},
+		Sites: map[string]ExitNodePolicy{"blog": {Tor: NetworkAllow}, "forum": {VPN: NetworkBlock}}}
+	tbl := []struct {
+		siteID string
+		policy ExitNodePolicy
+	}{
+		{"radio-t", ExitNodePolicy{Tor: NetworkModerate}},
+		{"blog", ExitNodePolicy{Tor: NetworkAllow}},
+		{"forum", ExitNodePolicy{Tor: NetworkModerate, VPN: NetworkBlock}},
+	}
+	for _, tt := range tbl {
+		policy, err := l.Policy(tt.siteID)
+		require.NoError(t, err)
+		assert.Equal(t, tt.policy, policy, tt.siteID)
+	}
+	assert.True(t, l.Uses("tor"))
+	assert.True(t, l.Uses("vpn"), "used by forum only")
+
+	l = StaticExitNodePolicyLister{Default: ExitNodePolicy{Tor: NetworkAllow}, Sites: map[string]ExitNodePolicy{"blog": {VPN: NetworkAllow}}}
+	assert.False(t, l.Uses("tor"))
+	assert.False(t, l.Uses("vpn"))
+}
+
+type ipMatcherMock []string
+
+func (m ipMatcherMock) Contains(ip string) bool { return slices.Contains(m, ip) }
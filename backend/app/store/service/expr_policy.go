@@ -0,0 +1,275 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/settings"
+)
+
+// ErrExprRejected returned by Create for comment rejected by the site's moderation expression
+var ErrExprRejected = errors.New("comment rejected by site policy")
+
+var errExprPolicyDisabled = errors.New("expression policies disabled")
+
+// Moderation outcomes returned by moderation expression, empty result is the same as publish
+const (
+	ExprPublish = "publish"
+	ExprHold    = "hold"
+	ExprReject  = "reject"
+)
+
+// ExprPolicy defines expressions deciding moderation outcome and notification routing of new comments,
+// by comment's and user's attributes. Empty expression disables the decision. Expressions use expr language,
+// see https://expr-lang.org, with comment and user variables of exprEnv, for example:
+//
+//	moderation: user.level == "new" && comment.links > 1 ? "hold" : ""
+//	notify: comment.reply ? ["email", "telegram"] : ["telegram"]
+type ExprPolicy struct {
+	Moderation string `json:"moderation"` // returns "publish", "hold" or "reject"
+	Notify     string `json:"notify"`     // returns list of notification destinations, like "email" or "telegram", or one name
+}
+
+// exprEnv is the environment of policy expressions
+type exprEnv struct {
+	Comment exprComment `expr:"comment"`
+	User    exprUser    `expr:"user"`
+}
+
+type exprComment struct {
+	Text   string `expr:"text"`   // plain text, without markup
+	Length int    `expr:"length"` // length of plain text, in characters
+	Links  int    `expr:"links"`
+	Images int    `expr:"images"`
+	Reply  bool   `expr:"reply"`
+	Site   string `expr:"site"`
+	URL    string `expr:"url"`
+}
+
+type exprUser struct {
+	ID        string `expr:"id"`
+	Name      string `expr:"name"`
+	Level     string `expr:"level"` // empty if user levels disabled
+	Verified  bool   `expr:"verified"`
+	Admin     bool   `expr:"admin"`
+	Anonymous bool   `expr:"anonymous"`
+}
+
+// exprPrograms is the policy with its compiled expressions, nil for empty ones.
+// Saved as the policy and compiled again on load.
+type exprPrograms struct {
+	policy     ExprPolicy
+	moderation *vm.Program
+	notify     *vm.Program
+}
+
+// MarshalJSON saves the policy only
+func (p exprPrograms) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.policy)
+}
+
+// UnmarshalJSON loads and compiles the policy
+func (p *exprPrograms) UnmarshalJSON(data []byte) (err error) {
+	var policy ExprPolicy
+	if err = json.Unmarshal(data, &policy); err != nil {
+		return err
+	}
+	*p, err = compileExprPolicy(policy)
+	return err
+}
+
+// ExprPolicies keeps default expression policy with per-site overrides changeable at runtime,
+// saved to the settings store once restored from it. Thread safe.
+type ExprPolicies struct {
+	defaultPolicy exprPrograms
+	sites         siteSettings[exprPrograms]
+}
+
+// NewExprPolicies makes ExprPolicies with default policy for all sites, returns error if it can't be compiled
+func NewExprPolicies(defaultPolicy ExprPolicy) (*ExprPolicies, error) {
+	programs, err := compileExprPolicy(defaultPolicy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid default expression policy: %w", err)
+	}
+	return &ExprPolicies{defaultPolicy: programs, sites: siteSettings[exprPrograms]{name: "expr_policy"}}, nil
+}
+
+// Restore loads overrides saved in the settings store and saves further changes there
+func (p *ExprPolicies) Restore(store settings.Store) error {
+	return p.sites.restore(store, nil)
+}
+
+// Policy returns expression policy for the site, default one if not overridden
+func (p *ExprPolicies) Policy(siteID string) ExprPolicy {
+	return p.programs(siteID).policy
+}
+
+// SetPolicy compiles and overrides expression policy for the site
+func (p *ExprPolicies) SetPolicy(siteID string, policy ExprPolicy) error {
+	programs, err := compileExprPolicy(policy)
+	if err != nil {
+		return err
+	}
+	return p.sites.set(siteID, programs)
+}
+
+// ResetPolicy removes site's override, i.e. site gets default policy back
+func (p *ExprPolicies) ResetPolicy(siteID string) error {
+	return p.sites.reset(siteID)
+}
+
+func (p *ExprPolicies) programs(siteID string) exprPrograms {
+	if programs, ok := p.sites.get(siteID); ok {
+		return programs
+	}
+	return p.defaultPolicy
+}
+
+// compileExprPolicy compiles expressions of the policy, checking result types against exprEnv
+func compileExprPolicy(policy ExprPolicy) (res exprPrograms, err error) {
+	res.policy = policy
+	if strings.TrimSpace(policy.Moderation) != "" {
+		if res.moderation, err = expr.Compile(policy.Moderation, expr.Env(exprEnv{}), expr.AsKind(reflect.String)); err != nil {
+			return exprPrograms{}, fmt.Errorf("invalid moderation expression: %w", err)
+		}
+	}
+	if strings.TrimSpace(policy.Notify) != "" {
+		if res.notify, err = expr.Compile(policy.Notify, expr.Env(exprEnv{})); err != nil {
+			return exprPrograms{}, fmt.Errorf("invalid notify expression: %w", err)
+		}
+		// list or single name of destination, type of some expressions is known at run time only
+		if t := res.notify.Node().Type(); t != nil && t.Kind() != reflect.Slice && t.Kind() != reflect.String &&
+			t.Kind() != reflect.Interface {
+			return exprPrograms{}, fmt.Errorf("invalid notify expression: expected list or string, got %s", t)
+		}
+	}
+	return res, nil
+}
+
+// SiteExprPolicy returns expression policy for the site, empty if expression policies disabled
+func (s *DataStore) SiteExprPolicy(siteID string) ExprPolicy {
+	if s.ExprPolicy == nil {
+		return ExprPolicy{}
+	}
+	return s.ExprPolicy.Policy(siteID)
+}
+
+// SetExprPolicy changes expression policy for the site at runtime
+func (s *DataStore) SetExprPolicy(siteID string, policy ExprPolicy) error {
+	if s.ExprPolicy == nil {
+		return errExprPolicyDisabled
+	}
+	return s.ExprPolicy.SetPolicy(siteID, policy)
+}
+
+// ResetExprPolicy removes runtime changes of the site's expression policy
+func (s *DataStore) ResetExprPolicy(siteID string) error {
+	if s.ExprPolicy == nil {
+		return errExprPolicyDisabled
+	}
+	return s.ExprPolicy.ResetPolicy(siteID)
+}
+
+// NotifyDestinations returns names of notification destinations for the comment decided by the site's
+// notify expression, nil for all destinations if the expression not set. The expression may return a list
+// of names or a single name, error returned for failed expression and any other result.
+func (s *DataStore) NotifyDestinations(comment store.Comment) ([]string, error) {
+	if s.ExprPolicy == nil {
+		return nil, nil
+	}
+	program := s.ExprPolicy.programs(comment.Locator.SiteID).notify
+	if program == nil {
+		return nil, nil
+	}
+	out, err := expr.Run(program, s.exprEnv(comment))
+	if err != nil {
+		return nil, fmt.Errorf("notify expression failed for comment %s: %w", comment.ID, err)
+	}
+	var names []string
+	switch v := out.(type) {
+	case []string:
+		names = v
+	case string:
+		names = []string{v}
+	case []any:
+		for _, n := range v {
+			name, ok := n.(string)
+			if !ok {
+				return nil, fmt.Errorf("notify expression returned non-string destination %v for comment %s", n, comment.ID)
+			}
+			names = append(names, name)
+		}
+	default:
+		return nil, fmt.Errorf("notify expression returned %T instead of destinations for comment %s", out, comment.ID)
+	}
+	res := make([]string, 0, len(names))
+	for _, name := range names {
+		res = append(res, strings.ToLower(name))
+	}
+	return res, nil
+}
+
+// applyExprPolicy runs the site's moderation expression, holds the comment for review or rejects it.
+// Imported comments are exempt, failed expression doesn't change the comment.
+func (s *DataStore) applyExprPolicy(c *store.Comment) error {
+	if s.ExprPolicy == nil || c.Imported {
+		return nil
+	}
+	program := s.ExprPolicy.programs(c.Locator.SiteID).moderation
+	if program == nil {
+		return nil
+	}
+	out, err := expr.Run(program, s.exprEnv(*c))
+	if err != nil {
+		log.Printf("[WARN] moderation expression failed for %s on %s, %v", c.User.ID, c.Locator.URL, err)
+		return nil
+	}
+	switch out {
+	case "", ExprPublish:
+	case ExprHold:
+		if c.Visibility == "" {
+			c.Visibility = store.VisibilityPending
+		}
+	case ExprReject:
+		return ErrExprRejected
+	default:
+		log.Printf("[WARN] moderation expression returned unknown outcome %q for %s on %s", out, c.User.ID, c.Locator.URL)
+	}
+	return nil
+}
+
+// exprEnv makes environment of policy expressions for the comment and its author
+func (s *DataStore) exprEnv(c store.Comment) exprEnv {
+	text := c.PlainText
+	if text == "" {
+		text = store.PlainText(c.Text)
+	}
+	lowerHTML := strings.ToLower(c.Text)
+	return exprEnv{
+		Comment: exprComment{
+			Text:   text,
+			Length: len([]rune(text)),
+			Links:  strings.Count(lowerHTML, "<a "),
+			Images: strings.Count(lowerHTML, "<img "),
+			Reply:  c.ParentID != "",
+			Site:   c.Locator.SiteID,
+			URL:    c.Locator.URL,
+		},
+		User: exprUser{
+			ID:        c.User.ID,
+			Name:      c.User.Name,
+			Level:     string(s.UserLevel(c.Locator.SiteID, c.User.ID)),
+			Verified:  s.IsVerified(c.Locator.SiteID, c.User.ID),
+			Admin:     c.User.Admin,
+			Anonymous: strings.HasPrefix(c.User.ID, "anonymous_"),
+		},
+	}
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+)
+
+func TestExprPolicies(t *testing.T) {
+	_, err := NewExprPolicies(ExprPolicy{Moderation: "1 + 2"})
+	require.ErrorContains(t, err, "invalid default expression policy: invalid moderation expression")
+	_, err = NewExprPolicies(ExprPolicy{Notify: `1 + 2`})
+	require.ErrorContains(t, err, "invalid default expression policy: invalid notify expression")
+
+	def := ExprPolicy{Moderation: `comment.links > 2 ? "hold" : ""`}
+	p, err := NewExprPolicies(def)
+	require.NoError(t, err)
+	assert.Equal(t, def, p.Policy("site1"))
+
+	site := ExprPolicy{Moderation: `user.anonymous ? "reject" : "publish"`, Notify: `["email"]`}
+	require.NoError(t, p.SetPolicy("site1", site))
+	assert.Equal(t, site, p.Policy("site1"))
+	assert.Equal(t, def, p.Policy("site2"))
+
+	err = p.SetPolicy("site1", ExprPolicy{Moderation: `user.unknown ? "hold" : ""`})
+	require.ErrorContains(t, err, "invalid moderation expression")
+	assert.Equal(t, site, p.Policy("site1"), "invalid policy not set")
+
+	require.NoError(t, p.SetPolicy("site1", ExprPolicy{}))
+	assert.Equal(t, ExprPolicy{}, p.Policy("site1"), "empty policy overrides default")
+	require.NoError(t, p.ResetPolicy("site1"))
+	assert.Equal(t, def, p.Policy("site1"))
+}
+
+func TestService_ExprPolicy(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+	defer b.Close()
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	user := store.User{ID: "user2", Name: "user2"}
+
+	assert.Equal(t, ExprPolicy{}, b.SiteExprPolicy("radio-t"))
+	require.EqualError(t, b.SetExprPolicy("radio-t", ExprPolicy{}), "expression policies disabled")
+	require.EqualError(t, b.ResetExprPolicy("radio-t"), "expression policies disabled")
+	dest, err := b.NotifyDestinations(store.Comment{Locator: locator, User: user})
+	require.NoError(t, err)
+	assert.Nil(t, dest)
+
+	b.ExprPolicy, err = NewExprPolicies(ExprPolicy{})
+	require.NoError(t, err)
+	require.NoError(t, b.SetExprPolicy("radio-t", ExprPolicy{
+		Moderation: `comment.text contains "casino" ? "reject" : comment.links > 1 && !user.verified ? "hold" : ""`,
+		Notify:     `comment.reply ? ["Email", "telegram"] : comment.length > 10 ? ["telegram"] : []`,
+	}))
+
+	id, err := b.Create(store.Comment{Text: "just text", Locator: locator, User: user})
+	require.NoError(t, err)
+	c, err := b.Engine.Get(getReq(locator, id))
+	require.NoError(t, err)
+	assert.Empty(t, c.Visibility)
+
+	_, err = b.Create(store.Comment{Text: "best casino here", Locator: locator, User: user})
+	require.ErrorIs(t, err, ErrExprRejected)
+
+	links := `<a href="https://example.com/1">one</a> <a href="https://example.com/2">two</a>`
+	id, err = b.Create(store.Comment{Text: links, Locator: locator, User: user})
+	require.NoError(t, err)
+	c, err = b.Engine.Get(getReq(locator, id))
+	require.NoError(t, err)
+	assert.Equal(t, store.VisibilityPending, c.Visibility, "held for review")
+
+	require.NoError(t, b.SetVerified("radio-t", "user2", true))
+	id, err = b.Create(store.Comment{Text: links, Locator: locator, User: user})
+	require.NoError(t, err)
+	c, err = b.Engine.Get(getReq(locator, id))
+	require.NoError(t, err)
+	assert.Empty(t, c.Visibility, "verified user published")
+
+	_, err = b.Create(store.Comment{Text: "casino", Locator: locator, User: user, Imported: true})
+	require.NoError(t, err, "imported comments exempt")
+
+	notifyDest := func(c store.Comment) []string {
+		res, e := b.NotifyDestinations(c)
+		require.NoError(t, e)
+		return res
+	}
+	assert.Equal(t, []string{"email", "telegram"}, notifyDest(store.Comment{Text: "hi", ParentID: "p1", Locator: locator, User: user}))
+	assert.Equal(t, []string{"telegram"}, notifyDest(store.Comment{Text: "long enough text", Locator: locator, User: user}))
+	assert.Equal(t, []string{}, notifyDest(store.Comment{Text: "hi", Locator: locator, User: user}), "no destinations")
+	assert.Nil(t, notifyDest(store.Comment{Text: "hi", Locator: store.Locator{SiteID: "other"}, User: user}),
+		"all destinations without expression")
+
+	// single destination name, unexpected results and failures
+	reply := store.Comment{Text: "hi", ParentID: "p1", Locator: locator, User: user}
+	require.NoError(t, b.SetExprPolicy("radio-t", ExprPolicy{Notify: `comment.reply ? "Telegram" : 1`}))
+	assert.Equal(t, []string{"telegram"}, notifyDest(reply))
+	_, err = b.NotifyDestinations(store.Comment{Text: "hi", Locator: locator, User: user})
+	require.EqualError(t, err, "notify expression returned int instead of destinations for comment ")
+	require.NoError(t, b.SetExprPolicy("radio-t", ExprPolicy{Notify: `["email", comment.length]`}))
+	_, err = b.NotifyDestinations(reply)
+	require.EqualError(t, err, "notify expression returned non-string destination 2 for comment ")
+	require.NoError(t, b.SetExprPolicy("radio-t", ExprPolicy{Notify: `[string(int(comment.text))]`}))
+	_, err = b.NotifyDestinations(reply)
+	require.ErrorContains(t, err, "notify expression failed for comment")
+
+	// runtime failure and unknown outcome don't change the comment
+	require.NoError(t, b.SetExprPolicy("radio-t", ExprPolicy{Moderation: `int(comment.text) > 0 ? "hold" : "bad"`}))
+	for _, text := range []string{"test", "0"} {
+		id, err = b.Create(store.Comment{Text: text, Locator: locator, User: user})
+		require.NoError(t, err)
+		c, err = b.Engine.Get(getReq(locator, id))
+		require.NoError(t, err)
+		assert.Empty(t, c.Visibility)
+	}
+
+	require.NoError(t, b.ResetExprPolicy("radio-t"))
+	assert.Equal(t, ExprPolicy{}, b.SiteExprPolicy("radio-t"))
+}
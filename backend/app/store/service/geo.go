@@ -0,0 +1,101 @@
+package service
+
+import (
+	"errors"
+	"slices"
+	"strings"
+
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark42/backend/app/geoip"
+	"github.com/umputun/remark42/backend/app/store"
+)
+
+// GeoLocator resolves country and autonomous system of the ip
+type GeoLocator interface {
+	Lookup(ip string) (geoip.Info, error)
+}
+
+// GeoPolicy defines per-site posting restrictions by country and autonomous system (ASN) of the commenter's ip
+type GeoPolicy struct {
+	BlockCountries    []string // ISO 3166-1 alpha-2 codes of countries comments are rejected from
+	ModerateCountries []string // ISO 3166-1 alpha-2 codes of countries comments are held for review from
+	BlockASNs         []uint   // autonomous systems comments are rejected from, i.e. hosting providers
+	ModerateASNs      []uint   // autonomous systems comments are held for review from
+}
+
+// GeoPolicyLister provides geo policy per site
+type GeoPolicyLister interface {
+	Policy(siteID string) (GeoPolicy, error)
+}
+
+// StaticGeoPolicyLister provides geo policy set for sites, with default one for all other sites
+type StaticGeoPolicyLister struct {
+	Default GeoPolicy
+	Sites   map[string]GeoPolicy // site id to policy, rules of the site replace default rules of the same kind
+}
+
+// Policy returns geo policy of the site, default rules used for kinds not set for the site
+func (l StaticGeoPolicyLister) Policy(siteID string) (GeoPolicy, error) {
+	res := l.Default
+	site, ok := l.Sites[siteID]
+	if !ok {
+		return res, nil
+	}
+	if site.BlockCountries != nil {
+		res.BlockCountries = site.BlockCountries
+	}
+	if site.ModerateCountries != nil {
+		res.ModerateCountries = site.ModerateCountries
+	}
+	if site.BlockASNs != nil {
+		res.BlockASNs = site.BlockASNs
+	}
+	if site.ModerateASNs != nil {
+		res.ModerateASNs = site.ModerateASNs
+	}
+	return res, nil
+}
+
+// ErrGeoBlocked returned in case comments are not allowed from the commenter's country or network
+var ErrGeoBlocked = errors.New("comments are not allowed from this location")
+
+// blocked checks if info matches block rules
+func (p GeoPolicy) blocked(info geoip.Info) bool {
+	return matchCountry(p.BlockCountries, info.Country) || (info.ASN != 0 && slices.Contains(p.BlockASNs, info.ASN))
+}
+
+// moderated checks if info matches moderation rules
+func (p GeoPolicy) moderated(info geoip.Info) bool {
+	return matchCountry(p.ModerateCountries, info.Country) || (info.ASN != 0 && slices.Contains(p.ModerateASNs, info.ASN))
+}
+
+func matchCountry(countries []string, country string) bool {
+	return country != "" && slices.ContainsFunc(countries, func(c string) bool { return strings.EqualFold(c, country) })
+}
+
+// applyGeoPolicy looks up the commenter's ip and rejects or holds the comment for review per site's geo rules.
+// Should be called before ip hashed. Admins, imported comments and failed lookups are exempt.
+func (s *DataStore) applyGeoPolicy(c *store.Comment) error {
+	if s.GeoPolicy == nil || s.GeoLocator == nil || c.Imported || c.User.Admin || c.User.IP == "" {
+		return nil
+	}
+	policy, err := s.GeoPolicy.Policy(c.Locator.SiteID)
+	if err != nil {
+		log.Printf("[WARN] failed to get geo policy for site %s: %v", c.Locator.SiteID, err)
+		return nil
+	}
+	info, err := s.GeoLocator.Lookup(c.User.IP)
+	if err != nil {
+		log.Printf("[WARN] failed to lookup location of %s: %v", c.User.ID, err)
+		return nil
+	}
+	if policy.blocked(info) {
+		log.Printf("[INFO] comment from %s rejected, country %q, asn %d", c.User.ID, info.Country, info.ASN)
+		return ErrGeoBlocked
+	}
+	if policy.moderated(info) && c.Visibility == "" {
+		c.Visibility = store.VisibilityPending
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/geoip"
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+)
+
+func TestService_CreateWithGeoPolicy(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123"), GeoLocator: geoLocatorMock{
+		"1.1.1.1": {Country: "DE", ASN: 100},
+		"2.2.2.2": {Country: "XX", ASN: 200},
+		"3.3.3.3": {Country: "YY", ASN: 300},
+		"4.4.4.4": {Country: "US", ASN: 400},
+	}}
+	defer b.Close()
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	comment := func(ip string) store.Comment {
+		return store.Comment{Text: "text", Locator: locator, User: store.User{ID: "user2", Name: "user2", IP: ip}}
+	}
+
+	_, err := b.Create(comment("2.2.2.2"))
+	require.NoError(t, err, "geo policy disabled")
+
+	b.GeoPolicy = StaticGeoPolicyLister{Default: GeoPolicy{BlockCountries: []string{"xx"}, ModerateCountries: []string{"YY"},
+		BlockASNs: []uint{100}, ModerateASNs: []uint{400}}}
+
+	tbl := []struct {
+		ip      string
+		err     error
+		pending bool
+	}{
+		{"1.1.1.1", ErrGeoBlocked, false},
+		{"2.2.2.2", ErrGeoBlocked, false},
+		{"3.3.3.3", nil, true},
+		{"4.4.4.4", nil, true},
+		{"5.5.5.5", nil, false},
+		{"bad", nil, false},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.ip, func(t *testing.T) {
+			id, err := b.Create(comment(tt.ip))
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			c, err := b.Engine.Get(getReq(locator, id))
+			require.NoError(t, err)
+			assert.Equal(t, tt.pending, c.Visibility == store.VisibilityPending)
+			assert.NotEqual(t, tt.ip, c.User.IP, "ip hashed")
+		})
+	}
+
+	c := comment("1.1.1.1")
+	c.User.Admin = true
+	_, err = b.Create(c)
+	require.NoError(t, err, "admin exempt")
+
+	c = comment("1.1.1.1")
+	c.Imported = true
+	_, err = b.Create(c)
+	require.NoError(t, err, "imported comment exempt")
+
+	b.GeoPolicy = geoPolicyListerErr{}
+	_, err = b.Create(comment("1.1.1.1"))
+	require.NoError(t, err, "policy error ignored")
+}
+
+func TestStaticGeoPolicyLister(t *testing.T) {
+	l := StaticGeoPolicyLister{
+		Default: GeoPolicy{BlockCountries: []string{"XX"}, ModerateASNs: []uint{100}},
+		Sites: map[string]GeoPolicy{
+			"blog":  {BlockCountries: []string{}, ModerateCountries: []string{"YY"}},
+			"forum": {BlockASNs: []uint{200}, ModerateASNs: []uint{300}},
+		},
+	}
+	policy, err := l.Policy("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, l.Default, policy, "default for site without own rules")
+
+	policy, err = l.Policy("blog")
+	require.NoError(t, err)
+	assert.Equal(t, GeoPolicy{BlockCountries: []string{}, ModerateCountries: []string{"YY"}, ModerateASNs: []uint{100}}, policy,
+		"blocked countries replaced, moderated asn kept")
+
+	policy, err = l.Policy("forum")
+	require.NoError(t, err)
+	assert.Equal(t, GeoPolicy{BlockCountries: []string{"XX"}, BlockASNs: []uint{200}, ModerateASNs: []uint{300}}, policy)
+}
+
+type geoLocatorMock map[string]geoip.Info
+
+func (m geoLocatorMock) Lookup(ip string) (geoip.Info, error) {
+	if ip == "bad" {
+		return geoip.Info{}, errors.New("invalid ip")
+	}
+	return m[ip], nil
+}
+
+type geoPolicyListerErr struct{}
+
+func (geoPolicyListerErr) Policy(string) (GeoPolicy, error) { return GeoPolicy{}, errors.New("failed") }
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/engine"
+	"github.com/umputun/remark42/backend/app/store/highlight"
+)
+
+var errHighlightsDisabled = errors.New("highlights disabled")
+
+// HighlightedComment is a comment featured by admin, with admin's note
+type HighlightedComment struct {
+	Comment   store.Comment `json:"comment"`
+	Note      string        `json:"note,omitempty"`
+	Timestamp time.Time     `json:"time"` // highlighted at
+}
+
+// SetHighlight highlights the comment with optional note, or removes the highlight if status is false
+func (s *DataStore) SetHighlight(locator store.Locator, commentID string, status bool, note string) error {
+	if s.HighlightStore == nil {
+		return errHighlightsDisabled
+	}
+	if !status {
+		return s.HighlightStore.Remove(locator, commentID)
+	}
+	c, err := s.Engine.Get(engine.GetRequest{Locator: locator, CommentID: commentID})
+	if err != nil {
+		return fmt.Errorf("can't get comment %s to highlight: %w", commentID, err)
+	}
+	if c.Deleted || c.Visibility != "" {
+		return fmt.Errorf("comment %s can't be highlighted", commentID)
+	}
+	return s.HighlightStore.Add(highlight.Highlight{Locator: c.Locator, CommentID: c.ID, Note: note, Timestamp: time.Now()})
+}
+
+// Highlights returns site's highlighted comments from the newest, for the post only if url set.
+// Comments deleted or hidden after highlighting are skipped.
+func (s *DataStore) Highlights(siteID, url string, limit int, user store.User) ([]HighlightedComment, error) {
+	res := []HighlightedComment{}
+	if s.HighlightStore == nil {
+		return res, nil
+	}
+	highlights, err := s.HighlightStore.List(siteID, url, 0)
+	if err != nil {
+		return nil, err
+	}
+	flags := s.newUserFlagCache()
+	for _, h := range highlights {
+		if limit > 0 && len(res) >= limit {
+			break
+		}
+		c, e := s.Engine.Get(engine.GetRequest{Locator: h.Locator, CommentID: h.CommentID})
+		if e != nil {
+			log.Printf("[WARN] can't get highlighted comment %s, %v", h.CommentID, e)
+			continue
+		}
+		if c.Deleted || !c.VisibleTo(user) {
+			continue
+		}
+		res = append(res, HighlightedComment{Comment: s.alterCommentCached(c, user, flags), Note: h.Note, Timestamp: h.Timestamp})
+	}
+	return res, nil
+}
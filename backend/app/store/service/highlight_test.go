@@ -0,0 +1,68 @@
+package service
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/highlight"
+)
+
+func TestService_Highlights(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+
+	assert.EqualError(t, b.SetHighlight(locator, "id-1", true, ""), "highlights disabled")
+	res, err := b.Highlights("radio-t", "", 0, store.User{})
+	require.NoError(t, err)
+	assert.Empty(t, res)
+
+	loc, err := os.MkdirTemp("", "test_highlight_r42")
+	require.NoError(t, err)
+	defer os.RemoveAll(loc)
+	b.HighlightStore, err = highlight.NewBoltStorage(path.Join(loc, "highlights.db"), bolt.Options{})
+	require.NoError(t, err)
+	defer b.HighlightStore.Close()
+
+	require.NoError(t, b.SetHighlight(locator, "id-1", true, "comment of the day"))
+	time.Sleep(time.Millisecond)
+	require.NoError(t, b.SetHighlight(locator, "id-2", true, ""))
+	assert.Error(t, b.SetHighlight(locator, "id-bad", true, ""), "no such comment")
+
+	res, err = b.Highlights("radio-t", "", 0, store.User{})
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	assert.Equal(t, "id-2", res[0].Comment.ID, "newest first")
+	assert.Equal(t, "id-1", res[1].Comment.ID)
+	assert.Equal(t, "comment of the day", res[1].Note)
+
+	res, err = b.Highlights("radio-t", "https://radio-t.com", 1, store.User{})
+	require.NoError(t, err)
+	require.Len(t, res, 1, "limited")
+	res, err = b.Highlights("radio-t", "https://radio-t.com/other", 0, store.User{})
+	require.NoError(t, err)
+	assert.Empty(t, res, "other post")
+
+	// deleted comment skipped
+	require.NoError(t, b.Delete(locator, "id-2", store.SoftDelete))
+	res, err = b.Highlights("radio-t", "", 0, store.User{})
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	assert.Equal(t, "id-1", res[0].Comment.ID)
+	assert.Error(t, b.SetHighlight(locator, "id-2", true, ""), "deleted comment can't be highlighted")
+
+	require.NoError(t, b.SetHighlight(locator, "id-1", false, ""))
+	res, err = b.Highlights("radio-t", "", 0, store.User{})
+	require.NoError(t, err)
+	assert.Empty(t, res)
+	assert.ErrorIs(t, b.SetHighlight(locator, "id-1", false, ""), highlight.ErrNotFound)
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/engine"
+	"github.com/umputun/remark42/backend/app/store/event"
+)
+
+// ImportComment creates the comment with the author, time and parent set by the caller, for migrations and bridging bots.
+// The comment is marked as imported, so policies and quotas of the posted comments are not applied to it.
+// Unlike the bulk import, it is journaled as comment.imported with the id of the admin made it.
+func (s *DataStore) ImportComment(comment store.Comment, by string) (commentID string, err error) {
+	if comment.User.ID == "" || comment.User.Name == "" {
+		return "", errors.New("author of imported comment is required")
+	}
+	if comment.Locator.SiteID == "" || comment.Locator.URL == "" {
+		return "", errors.New("site and url of imported comment are required")
+	}
+	if comment.Timestamp.After(time.Now()) {
+		return "", fmt.Errorf("time of imported comment %s is in the future", comment.Timestamp.Format(time.RFC3339))
+	}
+	if comment.ParentID != "" {
+		if _, err = s.Engine.Get(engine.GetRequest{Locator: comment.Locator, CommentID: comment.ParentID}); err != nil {
+			return "", fmt.Errorf("can't get parent comment %s: %w", comment.ParentID, err)
+		}
+	}
+
+	comment.Imported = true
+	if commentID, err = s.Create(comment); err != nil {
+		return "", fmt.Errorf("failed to import comment: %w", err)
+	}
+	comment.ID = commentID
+	log.Printf("[INFO] comment %s of %s imported to %s by %s", commentID, comment.User.ID, comment.Locator.URL, by)
+	s.emitComment(event.CommentImported, comment, map[string]any{"by": by, "parent_id": comment.ParentID,
+		"time": comment.Timestamp})
+	return commentID, nil
+}
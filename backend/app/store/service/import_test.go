@@ -0,0 +1,62 @@
+package service
+
+import (
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/event"
+)
+
+func TestService_ImportComment(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+	defer b.Close()
+	var err error
+	b.EventStore, err = event.NewBoltStorage(path.Join(t.TempDir(), "events.db"), bolt.Options{})
+	require.NoError(t, err)
+	locator := store.Locator{URL: "https://radio-t.com/p1", SiteID: "radio-t"}
+	ts := time.Date(2020, 5, 12, 10, 20, 30, 0, time.UTC)
+
+	parentID, err := b.ImportComment(store.Comment{Text: "parent", Locator: locator, Timestamp: ts,
+		User: store.User{ID: "bot_1", Name: "bridge bot"}}, "admin1")
+	require.NoError(t, err)
+	id, err := b.ImportComment(store.Comment{Text: "reply", ParentID: parentID, Locator: locator, Timestamp: ts.Add(time.Hour),
+		User: store.User{ID: "github_123", Name: "user1"}}, "admin1")
+	require.NoError(t, err)
+
+	c, err := b.Get(locator, id, store.User{})
+	require.NoError(t, err)
+	assert.True(t, c.Imported)
+	assert.Equal(t, parentID, c.ParentID)
+	assert.Equal(t, "github_123", c.User.ID)
+	assert.Equal(t, ts.Add(time.Hour), c.Timestamp.UTC())
+
+	events, err := b.Events("radio-t", 0, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, event.CommentImported, events[1].Type)
+	assert.Equal(t, id, events[1].CommentID)
+	assert.Equal(t, "github_123", events[1].UserID)
+	assert.Equal(t, "admin1", events[1].Data["by"])
+	assert.Equal(t, parentID, events[1].Data["parent_id"])
+
+	_, err = b.ImportComment(store.Comment{Text: "text", Locator: locator, User: store.User{ID: "id1"}}, "admin1")
+	assert.EqualError(t, err, "author of imported comment is required")
+	_, err = b.ImportComment(store.Comment{Text: "text", Locator: store.Locator{SiteID: "radio-t"},
+		User: store.User{ID: "id1", Name: "name"}}, "admin1")
+	assert.EqualError(t, err, "site and url of imported comment are required")
+	_, err = b.ImportComment(store.Comment{Text: "text", Locator: locator, Timestamp: time.Now().Add(time.Hour),
+		User: store.User{ID: "id1", Name: "name"}}, "admin1")
+	assert.ErrorContains(t, err, "is in the future")
+	_, err = b.ImportComment(store.Comment{Text: "text", Locator: locator, ParentID: "unknown",
+		User: store.User{ID: "id1", Name: "name"}}, "admin1")
+	assert.ErrorContains(t, err, "can't get parent comment unknown")
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/cold"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+// integrity issue kinds
+const (
+	IssueOrphan = "orphan" // parent of the comment doesn't exist
+	IssueUser   = "user"   // comment without user, or references to user's comments don't match them
+	IssueCount  = "count"  // post's comments counter doesn't match its comments
+	IssueImage  = "image"  // image referenced by the comment doesn't exist
+)
+
+// maxIntegrityIssues limits issues kept in the report, all issues counted
+const maxIntegrityIssues = 1000
+
+// IntegrityIssue is a single inconsistency found by the integrity check
+type IntegrityIssue struct {
+	Kind      string `json:"kind"`
+	URL       string `json:"url,omitempty"`
+	CommentID string `json:"comment_id,omitempty"`
+	UserID    string `json:"user_id,omitempty"`
+	Details   string `json:"details"`
+}
+
+// IntegrityReport is the result of the site's integrity check
+type IntegrityReport struct {
+	SiteID   string           `json:"site"`
+	Started  time.Time        `json:"started"`
+	Finished time.Time        `json:"finished"`
+	Posts    int              `json:"posts"`
+	Comments int              `json:"comments"`
+	Counts   map[string]int   `json:"counts"` // number of issues by kind
+	Issues   []IntegrityIssue `json:"issues"` // first maxIntegrityIssues issues
+}
+
+// Total returns number of all issues found
+func (r IntegrityReport) Total() int {
+	res := 0
+	for _, c := range r.Counts {
+		res += c
+	}
+	return res
+}
+
+// add counts the issue and keeps it in the report below the limit
+func (r *IntegrityReport) add(issue IntegrityIssue) {
+	r.Counts[issue.Kind]++
+	if len(r.Issues) < maxIntegrityIssues {
+		r.Issues = append(r.Issues, issue)
+	}
+}
+
+// CheckIntegrity verifies referential integrity of the site's comments: parents exist, comments have users and
+// user's references match the comments, post counters match the comments and referenced images exist.
+// Posts in cold storage are checked the same way, except of user's references removed on freezing.
+// The report is kept as the last one of the site.
+func (s *DataStore) CheckIntegrity(siteID string) (IntegrityReport, error) {
+	report := IntegrityReport{SiteID: siteID, Started: time.Now(), Counts: map[string]int{}, Issues: []IntegrityIssue{}}
+	posts, err := s.Engine.Info(engine.InfoRequest{Locator: store.Locator{SiteID: siteID}})
+	if err != nil {
+		return IntegrityReport{}, fmt.Errorf("can't get posts for %s: %w", siteID, err)
+	}
+
+	userComments := map[string]int{} // including deleted, as user's references kept on deletion
+	for _, p := range posts {
+		comments, err := s.Engine.Find(engine.FindRequest{Locator: store.Locator{SiteID: siteID, URL: p.URL}, Sort: "time"})
+		if err != nil {
+			return IntegrityReport{}, fmt.Errorf("can't get comments of %s: %w", p.URL, err)
+		}
+		for _, c := range s.checkPost(&report, p, comments) {
+			userComments[c.User.ID]++
+		}
+	}
+
+	frozen, err := s.coldPosts(siteID)
+	if err != nil {
+		return IntegrityReport{}, err
+	}
+	for _, p := range frozen {
+		seg, err := s.ColdStore.Load(siteID, p.URL)
+		if errors.Is(err, cold.ErrNotFound) { // thawed meanwhile
+			continue
+		}
+		if err != nil {
+			return IntegrityReport{}, fmt.Errorf("can't load cold post %s: %w", p.URL, err)
+		}
+		comments, err := seg.Comments()
+		if err != nil {
+			return IntegrityReport{}, err
+		}
+		s.checkPost(&report, p, comments)
+	}
+
+	users := make([]string, 0, len(userComments))
+	for userID := range userComments {
+		users = append(users, userID)
+	}
+	slices.Sort(users)
+	for _, userID := range users {
+		refs, err := s.Engine.Count(engine.FindRequest{Locator: store.Locator{SiteID: siteID}, UserID: userID})
+		if err != nil {
+			return IntegrityReport{}, fmt.Errorf("can't count comments of %s: %w", userID, err)
+		}
+		if refs != userComments[userID] {
+			report.add(IntegrityIssue{Kind: IssueUser, UserID: userID,
+				Details: fmt.Sprintf("user references %d, comments %d", refs, userComments[userID])})
+		}
+	}
+
+	report.Finished = time.Now()
+	s.integrityReports.Lock()
+	if s.integrityReports.reports == nil {
+		s.integrityReports.reports = map[string]IntegrityReport{}
+	}
+	s.integrityReports.reports[siteID] = report
+	s.integrityReports.Unlock()
+	log.Printf("[INFO] integrity check of %s completed, %d posts, %d comments, %d issues", siteID, report.Posts, report.Comments, report.Total())
+	return report, nil
+}
+
+// checkPost checks comments of the post and adds found issues to the report, returns comments with users
+func (s *DataStore) checkPost(report *IntegrityReport, p store.PostInfo, comments []store.Comment) []store.Comment {
+	report.Posts++
+	report.Comments += len(comments)
+
+	ids := make(map[string]bool, len(comments))
+	for _, c := range comments {
+		ids[c.ID] = true
+	}
+	res := make([]store.Comment, 0, len(comments))
+	active := 0
+	for _, c := range comments {
+		if c.ParentID != "" && !ids[c.ParentID] {
+			report.add(IntegrityIssue{Kind: IssueOrphan, URL: p.URL, CommentID: c.ID,
+				Details: fmt.Sprintf("parent %s not found", c.ParentID)})
+		}
+		if c.User.ID == "" {
+			report.add(IntegrityIssue{Kind: IssueUser, URL: p.URL, CommentID: c.ID, Details: "comment without user"})
+		} else {
+			res = append(res, c)
+		}
+		if c.Deleted {
+			continue
+		}
+		active++
+		for _, img := range s.missingImages(c) {
+			report.add(IntegrityIssue{Kind: IssueImage, URL: p.URL, CommentID: c.ID, Details: fmt.Sprintf("image %s not found", img)})
+		}
+	}
+	if active != p.Count {
+		report.add(IntegrityIssue{Kind: IssueCount, URL: p.URL,
+			Details: fmt.Sprintf("counter %d, comments %d", p.Count, active)})
+	}
+	return res
+}
+
+// IntegrityReport returns the last integrity check of the site, false if the site never checked
+func (s *DataStore) IntegrityReport(siteID string) (IntegrityReport, bool) {
+	s.integrityReports.Lock()
+	defer s.integrityReports.Unlock()
+	report, ok := s.integrityReports.reports[siteID]
+	return report, ok
+}
+
+// missingImages returns ids of images stored by the site and referenced by the comment, which can't be loaded.
+// Proxied images are loaded on demand and not checked.
+func (s *DataStore) missingImages(c store.Comment) []string {
+	if s.ImageService == nil {
+		return nil
+	}
+	var res []string
+	for _, id := range s.ImageService.ExtractNonProxiedPictures(c.Text) {
+		if _, err := s.ImageService.Load(id); err != nil {
+			res = append(res, id)
+		}
+	}
+	return res
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/cold"
+	"github.com/umputun/remark42/backend/app/store/engine"
+	"github.com/umputun/remark42/backend/app/store/image"
+)
+
+func TestService_CheckIntegrity(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+
+	_, ok := b.IntegrityReport("radio-t")
+	assert.False(t, ok, "never checked")
+	report, err := b.CheckIntegrity("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, "radio-t", report.SiteID)
+	assert.Equal(t, 1, report.Posts)
+	assert.Equal(t, 2, report.Comments)
+	assert.Zero(t, report.Total(), "consistent")
+	assert.Empty(t, report.Issues)
+	assert.False(t, report.Finished.Before(report.Started))
+
+	imgSvc := image.NewService(&image.StoreMock{
+		LoadFunc: func(id string) ([]byte, error) {
+			if id == "dev/pic2.png" {
+				return nil, errors.New("not found")
+			}
+			return []byte("img"), nil
+		},
+	}, image.ServiceParams{ImageAPI: "/images/", ProxyAPI: "/proxy"})
+	defer imgSvc.Close(context.TODO())
+	broken := &brokenIndexEngine{Interface: eng}
+	b = DataStore{Engine: broken, AdminStore: admin.NewStaticKeyStore("secret 123"), ImageService: imgSvc}
+
+	locator := store.Locator{URL: "https://radio-t.com/2", SiteID: "radio-t"}
+	for _, c := range []store.Comment{
+		{ID: "id-3", ParentID: "missing", Text: "orphan", Locator: locator, User: store.User{ID: "user2", Name: "user2"}},
+		{ID: "id-4", Text: `<img src="/images/dev/pic1.png"/> <img src="/images/dev/pic2.png"/>`, Locator: locator,
+			User: store.User{ID: "user2", Name: "user2"}},
+		{ID: "id-5", Text: "deleted", Locator: locator, User: store.User{ID: "user2", Name: "user2"}},
+	} {
+		c.Timestamp = time.Now()
+		_, err = eng.Create(c)
+		require.NoError(t, err)
+	}
+	require.NoError(t, eng.Delete(engine.DeleteRequest{Locator: locator, CommentID: "id-5", DeleteMode: store.SoftDelete}))
+
+	report, err = b.CheckIntegrity("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Posts)
+	assert.Equal(t, 5, report.Comments)
+	assert.Equal(t, map[string]int{IssueOrphan: 1, IssueImage: 1, IssueCount: 1, IssueUser: 1}, report.Counts)
+	assert.Equal(t, 4, report.Total())
+	assert.Equal(t, []IntegrityIssue{ // posts in order of last comment
+		{Kind: IssueOrphan, URL: "https://radio-t.com/2", CommentID: "id-3", Details: "parent missing not found"},
+		{Kind: IssueImage, URL: "https://radio-t.com/2", CommentID: "id-4", Details: "image dev/pic2.png not found"},
+		{Kind: IssueCount, URL: "https://radio-t.com", Details: "counter 3, comments 2"},
+		{Kind: IssueUser, UserID: "user2", Details: "user references 2, comments 3"},
+	}, report.Issues)
+
+	last, ok := b.IntegrityReport("radio-t")
+	require.True(t, ok)
+	assert.Equal(t, report, last)
+
+	_, err = b.CheckIntegrity("bad")
+	assert.Error(t, err, "unknown site")
+}
+
+func TestService_CheckIntegrityCold(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+	var err error
+	b.ColdStore, err = cold.NewBoltStorage(path.Join(t.TempDir(), "cold.db"), bolt.Options{})
+	require.NoError(t, err)
+	defer b.ColdStore.Close()
+
+	frozen, err := b.FreezePosts("radio-t", time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, 1, frozen)
+	report, err := b.CheckIntegrity("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Posts, "frozen post checked")
+	assert.Equal(t, 2, report.Comments)
+	assert.Zero(t, report.Total(), "user's references of frozen post not expected")
+
+	locator := store.Locator{URL: "https://radio-t.com/2", SiteID: "radio-t"}
+	seg, err := cold.NewSegment(locator, []store.Comment{{ID: "id-3", ParentID: "missing", Text: "orphan", Locator: locator,
+		User: store.User{ID: "user2", Name: "user2"}, Timestamp: time.Now()}}, time.Now())
+	require.NoError(t, err)
+	require.NoError(t, b.ColdStore.Save(seg))
+
+	report, err = b.CheckIntegrity("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Posts)
+	assert.Equal(t, 3, report.Comments)
+	assert.Equal(t, []IntegrityIssue{
+		{Kind: IssueOrphan, URL: "https://radio-t.com/2", CommentID: "id-3", Details: "parent missing not found"},
+	}, report.Issues)
+}
+
+// brokenIndexEngine reports wrong counter of the first post and wrong number of user2's comments
+type brokenIndexEngine struct {
+	engine.Interface
+}
+
+func (e *brokenIndexEngine) Info(req engine.InfoRequest) ([]store.PostInfo, error) {
+	res, err := e.Interface.Info(req)
+	for i := range res {
+		if res[i].URL == "https://radio-t.com" {
+			res[i].Count++
+		}
+	}
+	return res, err
+}
+
+func (e *brokenIndexEngine) Count(req engine.FindRequest) (int, error) {
+	res, err := e.Interface.Count(req)
+	if req.UserID == "user2" {
+		res--
+	}
+	return res, err
+}
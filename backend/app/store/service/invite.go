@@ -0,0 +1,160 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/engine"
+	"github.com/umputun/remark42/backend/app/store/invite"
+)
+
+const defaultInviteTTL = 72 * time.Hour
+
+var errInvitesDisabled = errors.New("invitations disabled")
+
+// CreateInvite makes invitation granting the role on the sites, expiring after ttl, InviteTTL if not set
+func (s *DataStore) CreateInvite(createdBy, role string, sites []string, ttl time.Duration) (invite.Invitation, error) {
+	if s.InviteStore == nil {
+		return invite.Invitation{}, errInvitesDisabled
+	}
+	if role == "" {
+		role = invite.RoleAdmin
+	}
+	if role != invite.RoleAdmin {
+		return invite.Invitation{}, fmt.Errorf("unknown role %q", role)
+	}
+	if len(sites) == 0 {
+		return invite.Invitation{}, errors.New("no sites to invite to")
+	}
+	if ttl <= 0 {
+		ttl = s.InviteTTL
+	}
+	if ttl <= 0 {
+		ttl = defaultInviteTTL
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return invite.Invitation{}, fmt.Errorf("failed to make invitation id: %w", err)
+	}
+	now := time.Now()
+	inv := invite.Invitation{ID: hex.EncodeToString(b), Role: role, Sites: slices.Compact(slices.Sorted(slices.Values(sites))),
+		CreatedBy: createdBy, Created: now, Expires: now.Add(ttl)}
+	if err := s.InviteStore.Create(inv); err != nil {
+		return invite.Invitation{}, fmt.Errorf("failed to save invitation: %w", err)
+	}
+	return inv, nil
+}
+
+// Invite returns the invitation by id
+func (s *DataStore) Invite(id string) (invite.Invitation, error) {
+	if s.InviteStore == nil {
+		return invite.Invitation{}, errInvitesDisabled
+	}
+	return s.InviteStore.Get(id)
+}
+
+// Invites returns invitations to the site, newest first
+func (s *DataStore) Invites(siteID string) ([]invite.Invitation, error) {
+	if s.InviteStore == nil {
+		return nil, errInvitesDisabled
+	}
+	invs, err := s.InviteStore.List()
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(invs, func(inv invite.Invitation) bool { return !slices.Contains(inv.Sites, siteID) }), nil
+}
+
+// DeleteInvite removes the invitation to the site, roles granted by it are kept
+func (s *DataStore) DeleteInvite(siteID, id string) error {
+	if s.InviteStore == nil {
+		return errInvitesDisabled
+	}
+	inv, err := s.InviteStore.Get(id)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(inv.Sites, siteID) { // admin of one site can't see or cancel invitations to other sites
+		return invite.ErrNotFound
+	}
+	return s.InviteStore.Delete(id)
+}
+
+// AcceptInvite grants the invitation's role on its sites to the user
+func (s *DataStore) AcceptInvite(id, userID string) ([]invite.Grant, error) {
+	if s.InviteStore == nil {
+		return nil, errInvitesDisabled
+	}
+	grants, err := s.InviteStore.Accept(id, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range grants {
+		s.resetRolesCache(g.SiteID)
+		log.Printf("[INFO] user %s granted %s on %s, invited by %s", userID, g.Role, g.SiteID, g.InvitedBy)
+	}
+	return grants, nil
+}
+
+// Grants returns roles granted on the site by invitations
+func (s *DataStore) Grants(siteID string) ([]invite.Grant, error) {
+	if s.InviteStore == nil {
+		return nil, errInvitesDisabled
+	}
+	return s.InviteStore.Grants(siteID)
+}
+
+// RevokeGrant removes role granted to the user on the site by invitation
+func (s *DataStore) RevokeGrant(siteID, userID string) error {
+	if s.InviteStore == nil {
+		return errInvitesDisabled
+	}
+	if err := s.InviteStore.Revoke(siteID, userID); err != nil {
+		return err
+	}
+	s.resetRolesCache(siteID)
+	return nil
+}
+
+// Admins returns ids of the site's admins, set by admin store, granted by invitations and assigned in the store
+func (s *DataStore) Admins(siteID string) ([]string, error) {
+	admins, err := s.AdminStore.Admins(siteID)
+	if err != nil {
+		return nil, err
+	}
+	res := slices.Clone(admins)
+	add := func(userID string) {
+		if !slices.Contains(res, userID) {
+			res = append(res, userID)
+		}
+	}
+	if s.InviteStore != nil {
+		grants, err := s.InviteStore.Grants(siteID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get granted admins of %s: %w", siteID, err)
+		}
+		for _, g := range grants {
+			if g.Role == invite.RoleAdmin {
+				add(g.UserID)
+			}
+		}
+	}
+	// failed engine doesn't take away admins set by other sources
+	assigned, err := s.Engine.ListFlags(engine.FlagRequest{Flag: engine.Admin, Locator: store.Locator{SiteID: siteID}})
+	if err != nil {
+		log.Printf("[WARN] can't get assigned admins of %s, %v", siteID, err)
+	}
+	for _, id := range assigned {
+		if userID, ok := id.(string); ok {
+			add(userID)
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/invite"
+)
+
+func TestService_Invites(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticStore("secret 123", nil, []string{"admin1"}, "")}
+
+	_, err := b.CreateInvite("admin1", "", []string{"radio-t"}, 0)
+	require.EqualError(t, err, "invitations disabled")
+	_, err = b.Invites("radio-t")
+	require.EqualError(t, err, "invitations disabled")
+	_, err = b.AcceptInvite("id", "user1")
+	require.EqualError(t, err, "invitations disabled")
+	admins, err := b.Admins("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"admin1"}, admins)
+
+	b.InviteStore, err = invite.NewBoltStorage(path.Join(t.TempDir(), "invites.db"), bolt.Options{})
+	require.NoError(t, err)
+	defer b.Close()
+
+	_, err = b.CreateInvite("admin1", "moderator", []string{"radio-t"}, 0)
+	require.EqualError(t, err, `unknown role "moderator"`)
+	_, err = b.CreateInvite("admin1", "", nil, 0)
+	require.EqualError(t, err, "no sites to invite to")
+
+	inv, err := b.CreateInvite("admin1", "", []string{"radio-t", "blog", "radio-t"}, 0)
+	require.NoError(t, err)
+	assert.Len(t, inv.ID, 32)
+	assert.Equal(t, invite.RoleAdmin, inv.Role)
+	assert.Equal(t, []string{"blog", "radio-t"}, inv.Sites)
+	assert.InDelta(t, defaultInviteTTL.Seconds(), inv.Expires.Sub(inv.Created).Seconds(), 1)
+	inv2, err := b.CreateInvite("admin1", invite.RoleAdmin, []string{"blog"}, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, time.Hour, inv2.Expires.Sub(inv2.Created))
+
+	invs, err := b.Invites("radio-t")
+	require.NoError(t, err)
+	require.Len(t, invs, 1)
+	assert.Equal(t, inv.ID, invs[0].ID)
+	invs, err = b.Invites("blog")
+	require.NoError(t, err)
+	assert.Len(t, invs, 2)
+
+	require.ErrorIs(t, b.DeleteInvite("radio-t", inv2.ID), invite.ErrNotFound, "other site's invitation")
+	require.NoError(t, b.DeleteInvite("blog", inv2.ID))
+	_, err = b.Invite(inv2.ID)
+	require.ErrorIs(t, err, invite.ErrNotFound)
+
+	assert.False(t, b.IsAdmin("radio-t", "user1"))
+	grants, err := b.AcceptInvite(inv.ID, "user1")
+	require.NoError(t, err)
+	assert.Len(t, grants, 2)
+	_, err = b.AcceptInvite(inv.ID, "user2")
+	require.ErrorIs(t, err, invite.ErrAccepted)
+	assert.True(t, b.IsAdmin("radio-t", "user1"))
+	assert.True(t, b.IsAdmin("blog", "user1"))
+	assert.False(t, b.IsAdmin("other", "user1"))
+	admins, err = b.Admins("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"admin1", "user1"}, admins)
+
+	grants, err = b.Grants("radio-t")
+	require.NoError(t, err)
+	require.Len(t, grants, 1)
+	assert.Equal(t, "admin1", grants[0].InvitedBy)
+
+	require.NoError(t, b.RevokeGrant("radio-t", "user1"))
+	assert.False(t, b.IsAdmin("radio-t", "user1"))
+	assert.True(t, b.IsAdmin("blog", "user1"))
+}
@@ -0,0 +1,196 @@
+package service
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"unicode"
+
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark42/backend/app/store"
+)
+
+// LanguagePolicy defines per-language moderation rules for the site
+type LanguagePolicy struct {
+	Allowed         []string            // allowed languages, comments in other detected languages are held or rejected
+	Reject          bool                // reject comments in not allowed languages instead of holding them for review
+	RestrictedWords map[string][]string // restricted words per language, in addition to the site-wide ones
+}
+
+// LanguagePolicyLister provides language policy per site
+type LanguagePolicyLister interface {
+	Policy(siteID string) (LanguagePolicy, error)
+}
+
+// StaticLanguagePolicyLister provides same language policy for every site
+type StaticLanguagePolicyLister struct {
+	LanguagePolicy
+}
+
+// Policy returns language policy (ignores siteID)
+func (l StaticLanguagePolicyLister) Policy(_ string) (LanguagePolicy, error) {
+	return l.LanguagePolicy, nil
+}
+
+// ErrLanguageNotAllowed returned in case comment language is not allowed on the site
+var ErrLanguageNotAllowed = errors.New("comment language is not allowed")
+
+// allowed checks if comment in the lang is allowed by the policy. Undetected language is always allowed.
+func (p LanguagePolicy) allowed(lang string) bool {
+	if lang == "" || len(p.Allowed) == 0 {
+		return true
+	}
+	for _, l := range p.Allowed {
+		if strings.EqualFold(l, lang) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyLanguagePolicy detects comment language and applies site's language rules to the comment.
+// Comments in not allowed languages are either rejected or held for review, admins and imported comments are exempt.
+func (s *DataStore) applyLanguagePolicy(c *store.Comment) error {
+	text := c.Orig
+	if text == "" {
+		text = c.Text
+	}
+	if c.Lang == "" {
+		c.Lang = DetectLanguage(text)
+	}
+	if s.LanguagePolicy == nil || c.Imported {
+		return nil
+	}
+
+	policy, err := s.LanguagePolicy.Policy(c.Locator.SiteID)
+	if err != nil {
+		log.Printf("[WARN] failed to get language policy for site %s: %v", c.Locator.SiteID, err)
+		return nil
+	}
+
+	if words := policy.RestrictedWords[c.Lang]; len(words) > 0 {
+		if NewRestrictedWordsMatcher(StaticRestrictedWordsLister{Words: words}).Match(c.Locator.SiteID, text) {
+			return ErrRestrictedWordsFound
+		}
+	}
+
+	if c.User.Admin || policy.allowed(c.Lang) {
+		return nil
+	}
+	if policy.Reject {
+		return ErrLanguageNotAllowed
+	}
+	if c.Visibility == "" {
+		c.Visibility = store.VisibilityPending
+	}
+	return nil
+}
+
+const (
+	minLangDetectLetters = 10 // too short texts are not reliable for detection
+	minLangStopWords     = 2  // single common word match is not reliable for latin-script languages
+)
+
+// scriptLangs maps unicode scripts to the languages, used for non-latin texts
+var scriptLangs = []struct {
+	script *unicode.RangeTable
+	lang   string
+}{
+	{unicode.Greek, "el"}, {unicode.Arabic, "ar"}, {unicode.Hebrew, "he"}, {unicode.Devanagari, "hi"},
+	{unicode.Thai, "th"}, {unicode.Hangul, "ko"}, {unicode.Hiragana, "ja"}, {unicode.Katakana, "ja"},
+	{unicode.Han, "zh"}, {unicode.Armenian, "hy"}, {unicode.Georgian, "ka"},
+}
+
+// latinStopWords are the most common words of latin-script languages
+var latinStopWords = map[string][]string{
+	"en": {"the", "and", "is", "are", "of", "to", "in", "that", "it", "you", "this", "was", "for", "with", "not", "have"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "ich", "es", "ein", "eine", "zu", "mit", "sie", "auf", "auch", "den"},
+	"fr": {"le", "la", "les", "et", "est", "un", "une", "des", "pas", "je", "que", "qui", "dans", "pour", "ce", "du"},
+	"es": {"el", "la", "los", "las", "y", "es", "un", "una", "que", "de", "no", "en", "por", "con", "para", "muy"},
+	"it": {"il", "la", "di", "che", "e", "non", "un", "una", "per", "sono", "con", "è", "mi", "questo", "gli", "anche"},
+	"pt": {"o", "a", "os", "as", "e", "não", "um", "uma", "que", "de", "do", "da", "em", "para", "com", "é"},
+	"nl": {"de", "het", "een", "en", "is", "niet", "ik", "van", "dat", "op", "zijn", "met", "voor", "je", "ook", "maar"},
+}
+
+// DetectLanguage returns ISO 639-1 code of the text's language or empty string if language can't be detected.
+// It is a lightweight heuristic based on unicode scripts and common words, good enough for moderation rules.
+func DetectLanguage(text string) string {
+	letters, latin, cyrillic := 0, 0, 0
+	scripts := map[string]int{}
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		switch {
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+		default:
+			for _, sl := range scriptLangs {
+				if unicode.Is(sl.script, r) {
+					scripts[sl.lang]++
+					break
+				}
+			}
+		}
+	}
+	if letters < minLangDetectLetters {
+		return ""
+	}
+
+	// pick the dominant script
+	best, bestCount := "", 0
+	for lang, count := range scripts {
+		if count > bestCount || (count == bestCount && lang < best) {
+			best, bestCount = lang, count
+		}
+	}
+	if scripts["ja"] > 0 && best == "zh" { // japanese texts mix kana with kanji
+		best, bestCount = "ja", scripts["zh"]+scripts["ja"]
+	}
+	switch {
+	case cyrillic > latin && cyrillic > bestCount:
+		return detectCyrillic(text)
+	case latin >= cyrillic && latin > bestCount:
+		return detectLatin(text)
+	}
+	return best
+}
+
+// detectCyrillic distinguishes cyrillic languages by their specific letters, russian is the default
+func detectCyrillic(text string) string {
+	lower := strings.ToLower(text)
+	switch {
+	case strings.ContainsAny(lower, "їієґ"):
+		return "uk"
+	case strings.ContainsAny(lower, "ў"):
+		return "be"
+	case strings.ContainsAny(lower, "љњџђћ"):
+		return "sr"
+	}
+	return "ru"
+}
+
+// detectLatin picks the latin-script language with the most matching common words
+func detectLatin(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) })
+	best, bestScore := "", 0
+	for lang, stopWords := range latinStopWords {
+		score := 0
+		for _, w := range words {
+			if slices.Contains(stopWords, w) {
+				score++
+			}
+		}
+		if score > bestScore || (score == bestScore && score > 0 && lang < best) {
+			best, bestScore = lang, score
+		}
+	}
+	if bestScore < minLangStopWords {
+		return ""
+	}
+	return best
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	tbl := []struct {
+		text string
+		lang string
+	}{
+		{"", ""},
+		{"short", ""},
+		{"12345678901234567890 !!!", ""},
+		{"This is a comment about the show and it was great", "en"},
+		{"Das ist nicht gut, ich mag es nicht", "de"},
+		{"Je pense que le podcast est pour les gens qui aiment la tech", "fr"},
+		{"Me gusta mucho el programa, es muy bueno para los oyentes", "es"},
+		{"Dit is een goed programma en ik vind het ook leuk", "nl"},
+		{"Это очень интересный выпуск, спасибо", "ru"},
+		{"Це дуже цікавий випуск, дякую їм", "uk"},
+		{"Αυτό είναι ένα πολύ καλό σχόλιο", "el"},
+		{"これはとても面白いエピソードです", "ja"},
+		{"这是一个非常有趣的节目谢谢你们", "zh"},
+		{"이것은 매우 흥미로운 에피소드입니다", "ko"},
+		{"Lorem ipsum dolor sit amet consectetur", ""},
+		{"comment to post 2", ""},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.text, func(t *testing.T) {
+			assert.Equal(t, tt.lang, DetectLanguage(tt.text))
+		})
+	}
+}
+
+func TestLanguagePolicy_allowed(t *testing.T) {
+	assert.True(t, LanguagePolicy{}.allowed("en"), "all languages allowed by default")
+	p := LanguagePolicy{Allowed: []string{"EN", "de"}}
+	assert.True(t, p.allowed("en"))
+	assert.True(t, p.allowed("de"))
+	assert.True(t, p.allowed(""), "undetected language allowed")
+	assert.False(t, p.allowed("ru"))
+}
+
+func TestService_CreateWithLanguagePolicy(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123"),
+		LanguagePolicy: StaticLanguagePolicyLister{LanguagePolicy{Allowed: []string{"en"},
+			RestrictedWords: map[string][]string{"de": {"schrott"}}}}}
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	user := store.User{ID: "user2", Name: "user2"}
+
+	id, err := b.Create(store.Comment{Text: "This is a comment about the show and it was great", Locator: locator, User: user})
+	require.NoError(t, err)
+	c, err := b.Engine.Get(getReq(locator, id))
+	require.NoError(t, err)
+	assert.Equal(t, "en", c.Lang)
+	assert.Empty(t, c.Visibility)
+
+	id, err = b.Create(store.Comment{Text: "Это очень интересный выпуск, спасибо", Locator: locator, User: user})
+	require.NoError(t, err)
+	c, err = b.Engine.Get(getReq(locator, id))
+	require.NoError(t, err)
+	assert.Equal(t, "ru", c.Lang)
+	assert.Equal(t, store.VisibilityPending, c.Visibility, "held for review")
+
+	comments, err := b.Find(locator, "time", store.User{ID: "user3"})
+	require.NoError(t, err)
+	assert.Len(t, comments, 3, "pending comment hidden from other users")
+	comments, err = b.Find(locator, "time", user)
+	require.NoError(t, err)
+	assert.Len(t, comments, 4, "pending comment visible to the author")
+
+	_, err = b.Create(store.Comment{Text: "Das ist nicht gut, ich mag es nicht, schrott", Locator: locator, User: user})
+	assert.ErrorIs(t, err, ErrRestrictedWordsFound)
+
+	adminID, err := b.Create(store.Comment{Text: "Это очень интересный выпуск, спасибо", Locator: locator,
+		User: store.User{ID: "admin1", Name: "admin", Admin: true}})
+	require.NoError(t, err)
+	c, err = b.Engine.Get(getReq(locator, adminID))
+	require.NoError(t, err)
+	assert.Empty(t, c.Visibility, "admins are exempt")
+
+	// approve pending comment
+	require.NoError(t, b.Approve(locator, id))
+	c, err = b.Engine.Get(getReq(locator, id))
+	require.NoError(t, err)
+	assert.Empty(t, c.Visibility)
+	comments, err = b.Last("radio-t", 10, time.Time{}, store.User{})
+	require.NoError(t, err)
+	assert.Len(t, comments, 5)
+	assert.EqualError(t, b.Approve(locator, id), "comment "+id+" is not pending review")
+
+	// pending queue
+	pending, err := b.Pending("radio-t")
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+
+	// edit into not allowed language holds approved comment again
+	enID, err := b.Create(store.Comment{Text: "This is a comment about the show and it was great", Locator: locator, User: user})
+	require.NoError(t, err)
+	c, err = b.EditComment(locator, enID, EditRequest{Text: "Это очень интересный выпуск, спасибо"})
+	require.NoError(t, err)
+	assert.Equal(t, "ru", c.Lang)
+	assert.Equal(t, store.VisibilityPending, c.Visibility, "held for review after edit")
+	_, err = b.EditComment(locator, enID, EditRequest{Text: "Das ist nicht gut, ich mag es nicht, schrott"})
+	assert.ErrorIs(t, err, ErrRestrictedWordsFound, "per-language restricted words checked on edit")
+
+	heldID, err := b.Create(store.Comment{Text: "Это ещё один интересный выпуск, спасибо", Locator: locator, User: user})
+	require.NoError(t, err)
+	require.NoError(t, b.Delete(locator, heldID, store.SoftDelete))
+	pending, err = b.Pending("radio-t")
+	require.NoError(t, err)
+	require.Len(t, pending, 1, "deleted comment skipped")
+	assert.Equal(t, enID, pending[0].ID)
+	_, err = b.Pending("bad")
+	assert.Error(t, err)
+
+	// reject mode
+	b.LanguagePolicy = StaticLanguagePolicyLister{LanguagePolicy{Allowed: []string{"en"}, Reject: true}}
+	_, err = b.Create(store.Comment{Text: "Это очень интересный выпуск, спасибо", Locator: locator, User: user})
+	assert.ErrorIs(t, err, ErrLanguageNotAllowed)
+	_, err = b.Create(store.Comment{Text: "Это очень интересный выпуск, спасибо", Locator: locator, User: user, Imported: true})
+	assert.NoError(t, err, "imported comments are exempt")
+	_, err = b.EditComment(locator, adminID, EditRequest{Text: "Это очень интересный выпуск, спасибо!"})
+	assert.NoError(t, err, "admins are exempt on edit")
+	_, err = b.EditComment(locator, id, EditRequest{Text: "Это очень интересный выпуск, спасибо!"})
+	assert.ErrorIs(t, err, ErrLanguageNotAllowed, "rejected on edit")
+}
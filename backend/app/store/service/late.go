@@ -0,0 +1,61 @@
+package service
+
+import (
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+// LatePolicy defines handling of comments on old threads
+type LatePolicy struct {
+	Months         int  // comments on threads older than that are marked as late, disabled if 0
+	SuppressNotify bool // don't notify thread watchers about late comments
+}
+
+// LatePolicyLister provides late comments policy per site
+type LatePolicyLister interface {
+	Policy(siteID string) (LatePolicy, error)
+}
+
+// StaticLatePolicyLister provides same late comments policy for every site
+type StaticLatePolicyLister struct {
+	LatePolicy
+}
+
+// Policy returns late comments policy (ignores siteID)
+func (l StaticLatePolicyLister) Policy(_ string) (LatePolicy, error) {
+	return l.LatePolicy, nil
+}
+
+// SiteLatePolicy returns late comments policy for the site, disabled if not set
+func (s *DataStore) SiteLatePolicy(siteID string) LatePolicy {
+	if s.LatePolicy == nil {
+		return LatePolicy{}
+	}
+	policy, err := s.LatePolicy.Policy(siteID)
+	if err != nil {
+		log.Printf("[WARN] failed to get late policy for site %s: %v", siteID, err)
+		return LatePolicy{}
+	}
+	return policy
+}
+
+// markLate sets Late for the comment made on the thread started more than policy's months before the comment
+func (s *DataStore) markLate(c *store.Comment) {
+	policy := s.SiteLatePolicy(c.Locator.SiteID)
+	if c.Imported || policy.Months <= 0 {
+		return
+	}
+	// engine reports post without comments as an error, such a thread is a new one
+	info, err := s.Engine.Info(engine.InfoRequest{Locator: c.Locator})
+	if err != nil || len(info) == 0 || info[0].FirstTS.IsZero() {
+		return
+	}
+	c.Late = info[0].FirstTS.AddDate(0, policy.Months, 0).Before(c.Timestamp)
+}
+
+// SuppressLateNotify checks if thread watchers should not be notified about the comment
+func (s *DataStore) SuppressLateNotify(c store.Comment) bool {
+	return c.Late && s.SiteLatePolicy(c.Locator.SiteID).SuppressNotify
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+)
+
+func TestService_CreateWithLatePolicy(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+	defer b.Close()
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	user := store.User{ID: "user2", Name: "user2"}
+
+	id, err := b.Create(store.Comment{Text: "necro", Locator: locator, User: user})
+	require.NoError(t, err)
+	c, err := b.Engine.Get(getReq(locator, id))
+	require.NoError(t, err)
+	assert.False(t, c.Late, "late policy disabled")
+	assert.False(t, b.SuppressLateNotify(c))
+
+	// thread started in 2017
+	b.LatePolicy = StaticLatePolicyLister{LatePolicy{Months: 12}}
+	id, err = b.Create(store.Comment{Text: "necro", Locator: locator, User: user})
+	require.NoError(t, err)
+	c, err = b.Engine.Get(getReq(locator, id))
+	require.NoError(t, err)
+	assert.True(t, c.Late, "old thread")
+	assert.False(t, b.SuppressLateNotify(c), "suppression disabled")
+
+	b.LatePolicy = StaticLatePolicyLister{LatePolicy{Months: 12, SuppressNotify: true}}
+	assert.True(t, b.SuppressLateNotify(c))
+
+	id, err = b.Create(store.Comment{Text: "in time", Locator: locator, User: user,
+		Timestamp: time.Date(2018, 6, 1, 0, 0, 0, 0, time.UTC)})
+	require.NoError(t, err)
+	c, err = b.Engine.Get(getReq(locator, id))
+	require.NoError(t, err)
+	assert.False(t, c.Late, "comment made within 12 months")
+	assert.False(t, b.SuppressLateNotify(c))
+
+	newPost := store.Locator{URL: "https://radio-t.com/new", SiteID: "radio-t"}
+	id, err = b.Create(store.Comment{Text: "first", Locator: newPost, User: user})
+	require.NoError(t, err)
+	c, err = b.Engine.Get(getReq(newPost, id))
+	require.NoError(t, err)
+	assert.False(t, c.Late, "new thread")
+
+	id, err = b.Create(store.Comment{Text: "imported", Locator: locator, User: user, Imported: true})
+	require.NoError(t, err)
+	c, err = b.Engine.Get(getReq(locator, id))
+	require.NoError(t, err)
+	assert.False(t, c.Late, "imported comments not marked")
+}
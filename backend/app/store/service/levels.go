@@ -0,0 +1,141 @@
+package service
+
+import (
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+// LevelPolicy defines automatic promotion of users to member and trusted levels. A level is reached
+// with enough approved comments made and the first comment made long enough ago, both thresholds 0 disable the level.
+// Verified level is set by admins only.
+type LevelPolicy struct {
+	MemberComments  int           // approved comments required for member level
+	MemberAge       time.Duration // time since the first comment required for member level
+	TrustedComments int           // approved comments required for trusted level
+	TrustedAge      time.Duration // time since the first comment required for trusted level
+	ModerateNew     bool          // hold comments of users with new level for review
+}
+
+// LevelPolicyLister provides user levels policy per site
+type LevelPolicyLister interface {
+	Policy(siteID string) (LevelPolicy, error)
+}
+
+// StaticLevelPolicyLister provides same user levels policy for every site
+type StaticLevelPolicyLister struct {
+	LevelPolicy
+}
+
+// Policy returns user levels policy (ignores siteID)
+func (l StaticLevelPolicyLister) Policy(_ string) (LevelPolicy, error) {
+	return l.LevelPolicy, nil
+}
+
+// Enabled checks if user levels used by the policy
+func (p LevelPolicy) Enabled() bool {
+	return p.MemberComments > 0 || p.MemberAge > 0 || p.TrustedComments > 0 || p.TrustedAge > 0 || p.ModerateNew
+}
+
+// level returns the level reached with approved comments, the first one made age ago
+func (p LevelPolicy) level(approved int, age time.Duration) store.UserLevel {
+	reached := func(comments int, minAge time.Duration) bool {
+		return (comments > 0 || minAge > 0) && approved >= comments && age >= minAge
+	}
+	switch {
+	case reached(p.TrustedComments, p.TrustedAge):
+		return store.LevelTrusted
+	case reached(p.MemberComments, p.MemberAge):
+		return store.LevelMember
+	}
+	return store.LevelNew
+}
+
+// SiteLevelPolicy returns user levels policy for the site, disabled if not set
+func (s *DataStore) SiteLevelPolicy(siteID string) LevelPolicy {
+	if s.LevelPolicy == nil {
+		return LevelPolicy{}
+	}
+	policy, err := s.LevelPolicy.Policy(siteID)
+	if err != nil {
+		log.Printf("[WARN] failed to get level policy for site %s: %v", siteID, err)
+		return LevelPolicy{}
+	}
+	return policy
+}
+
+// UserLevel returns level of the user on the site, empty if levels disabled for the site.
+// Verified users have verified level, others the level they promoted to.
+func (s *DataStore) UserLevel(siteID, userID string) store.UserLevel {
+	if !s.SiteLevelPolicy(siteID).Enabled() {
+		return ""
+	}
+	if s.IsVerified(siteID, userID) {
+		return store.LevelVerified
+	}
+	return s.storedLevel(siteID, userID)
+}
+
+// storedLevel returns the level user promoted to, new if not promoted
+func (s *DataStore) storedLevel(siteID, userID string) store.UserLevel {
+	res, err := s.Engine.UserDetail(engine.UserDetailRequest{Locator: store.Locator{SiteID: siteID}, UserID: userID, Detail: engine.UserLevel})
+	if err != nil || len(res) != 1 || store.UserLevel(res[0].Level).Rank() == 0 {
+		return store.LevelNew
+	}
+	return store.UserLevel(res[0].Level)
+}
+
+// applyLevelPolicy holds comments of new users for review if required by the site's policy.
+// Admins, verified users and imported comments are exempt.
+func (s *DataStore) applyLevelPolicy(c *store.Comment) {
+	if c.Imported || c.User.Admin || c.Visibility != "" || !s.SiteLevelPolicy(c.Locator.SiteID).ModerateNew {
+		return
+	}
+	if s.UserLevel(c.Locator.SiteID, c.User.ID) == store.LevelNew {
+		c.Visibility = store.VisibilityPending
+	}
+}
+
+// promoteUser checks user's approved comments and tenure and raises the stored level if the next one reached.
+// Levels are never lowered automatically.
+func (s *DataStore) promoteUser(siteID, userID string) {
+	policy := s.SiteLevelPolicy(siteID)
+	if !policy.Enabled() {
+		return
+	}
+	current := s.storedLevel(siteID, userID)
+	if current.Rank() >= store.LevelTrusted.Rank() {
+		return
+	}
+
+	// up to the engine's limit of the last user comments, enough for the promotion thresholds
+	comments, err := s.Engine.Find(engine.FindRequest{Locator: store.Locator{SiteID: siteID}, UserID: userID})
+	if err != nil {
+		log.Printf("[WARN] can't get comments of %s for promotion, %v", userID, err)
+		return
+	}
+	approved, first := 0, time.Now()
+	for _, c := range comments {
+		if c.Deleted || c.Visibility == store.VisibilityPending {
+			continue
+		}
+		approved++
+		if c.Timestamp.Before(first) {
+			first = c.Timestamp
+		}
+	}
+
+	level := policy.level(approved, time.Since(first))
+	if level.Rank() <= current.Rank() {
+		return
+	}
+	req := engine.UserDetailRequest{Locator: store.Locator{SiteID: siteID}, UserID: userID, Detail: engine.UserLevel, Update: string(level)}
+	if _, err = s.Engine.UserDetail(req); err != nil {
+		log.Printf("[WARN] can't promote %s to %s, %v", userID, level, err)
+		return
+	}
+	log.Printf("[INFO] user %s promoted to %s on site %s", userID, level, siteID)
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+)
+
+func TestLevelPolicy_Level(t *testing.T) {
+	p := LevelPolicy{MemberComments: 2, TrustedComments: 10, TrustedAge: 30 * 24 * time.Hour}
+	assert.True(t, p.Enabled())
+	assert.Equal(t, store.LevelNew, p.level(1, time.Hour))
+	assert.Equal(t, store.LevelMember, p.level(2, time.Hour))
+	assert.Equal(t, store.LevelMember, p.level(20, time.Hour), "too young for trusted")
+	assert.Equal(t, store.LevelMember, p.level(5, 60*24*time.Hour), "not enough comments for trusted")
+	assert.Equal(t, store.LevelTrusted, p.level(10, 30*24*time.Hour))
+
+	p = LevelPolicy{MemberAge: time.Hour}
+	assert.Equal(t, store.LevelNew, p.level(100, time.Minute))
+	assert.Equal(t, store.LevelMember, p.level(0, time.Hour))
+
+	assert.False(t, LevelPolicy{}.Enabled())
+	assert.Equal(t, store.LevelNew, LevelPolicy{}.level(100, 1000*time.Hour), "all levels disabled")
+	assert.True(t, LevelPolicy{ModerateNew: true}.Enabled())
+}
+
+func TestService_UserLevels(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+	defer b.Close()
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	user := store.User{ID: "user2", Name: "user2"}
+
+	_, err := b.Create(store.Comment{Text: "text", Locator: locator, User: user})
+	require.NoError(t, err)
+	assert.Equal(t, store.UserLevel(""), b.UserLevel("radio-t", "user2"), "levels disabled")
+	comments, err := b.Find(locator, "time", store.User{})
+	require.NoError(t, err)
+	assert.Empty(t, comments[0].User.Level)
+
+	b.LevelPolicy = StaticLevelPolicyLister{LevelPolicy{MemberComments: 2, TrustedComments: 3, TrustedAge: time.Hour, ModerateNew: true}}
+	assert.Equal(t, store.LevelNew, b.UserLevel("radio-t", "user2"), "not promoted before the policy enabled")
+
+	// held for review as new user, not counted until approved
+	id, err := b.Create(store.Comment{Text: "text", Locator: locator, User: user})
+	require.NoError(t, err)
+	c, err := b.Engine.Get(getReq(locator, id))
+	require.NoError(t, err)
+	assert.Equal(t, store.VisibilityPending, c.Visibility)
+	assert.Equal(t, store.LevelNew, b.UserLevel("radio-t", "user2"))
+
+	require.NoError(t, b.Approve(locator, id))
+	assert.Equal(t, store.LevelMember, b.UserLevel("radio-t", "user2"), "two approved comments")
+
+	id, err = b.Create(store.Comment{Text: "text", Locator: locator, User: user})
+	require.NoError(t, err)
+	c, err = b.Engine.Get(getReq(locator, id))
+	require.NoError(t, err)
+	assert.Empty(t, c.Visibility, "member comments published")
+	assert.Equal(t, store.LevelMember, b.UserLevel("radio-t", "user2"), "too young for trusted")
+
+	// user1 has two comments made in 2017
+	_, err = b.Create(store.Comment{Text: "text", Locator: locator, User: store.User{ID: "user1", Name: "user1", Admin: true}})
+	require.NoError(t, err)
+	assert.Equal(t, store.LevelTrusted, b.UserLevel("radio-t", "user1"))
+
+	comments, err = b.Find(locator, "time", store.User{})
+	require.NoError(t, err)
+	levels := map[string]string{}
+	for _, c := range comments {
+		levels[c.User.ID] = c.User.Level
+	}
+	assert.Equal(t, map[string]string{"user1": "trusted", "user2": "member"}, levels)
+
+	require.NoError(t, b.SetVerified("radio-t", "user2", true))
+	assert.Equal(t, store.LevelVerified, b.UserLevel("radio-t", "user2"))
+
+	users, _, err := b.Users(UsersRequest{SiteID: "radio-t", Sort: "name"})
+	require.NoError(t, err)
+	require.Len(t, users, 2)
+	assert.Equal(t, "trusted", users[0].Level)
+	assert.Equal(t, "verified", users[1].Level)
+
+	// exported and imported with metas
+	umetas, pmetas, err := b.Metas("radio-t")
+	require.NoError(t, err)
+	require.NoError(t, b.DeleteUserDetail("radio-t", "user1", "all"))
+	assert.Equal(t, store.LevelNew, b.UserLevel("radio-t", "user1"))
+	require.NoError(t, b.SetMetas("radio-t", umetas, pmetas))
+	assert.Equal(t, store.LevelTrusted, b.UserLevel("radio-t", "user1"))
+}
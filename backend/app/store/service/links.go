@@ -0,0 +1,125 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/engine"
+	"github.com/umputun/remark42/backend/app/store/event"
+)
+
+// LinkedUser returns id of the canonical user the user id is linked to, empty if the user id isn't linked.
+// Logins with the linked id are made as the canonical user.
+func (s *DataStore) LinkedUser(siteID, userID string) (string, error) {
+	res, err := s.Engine.UserDetail(engine.UserDetailRequest{Locator: store.Locator{SiteID: siteID}, UserID: userID,
+		Detail: engine.UserLinkedTo})
+	if err != nil || len(res) != 1 {
+		return "", err
+	}
+	return res[0].LinkedTo, nil
+}
+
+// LinkedUsers returns ids linked to the canonical user, sorted
+func (s *DataStore) LinkedUsers(siteID, userID string) ([]string, error) {
+	details, err := s.Engine.UserDetail(engine.UserDetailRequest{Locator: store.Locator{SiteID: siteID}, Detail: engine.AllUserDetails})
+	if err != nil {
+		return nil, fmt.Errorf("can't list user details of %s: %w", siteID, err)
+	}
+	res := []string{}
+	for _, d := range details {
+		if d.LinkedTo == userID {
+			res = append(res, d.UserID)
+		}
+	}
+	slices.Sort(res)
+	return res, nil
+}
+
+// LinkUser links the user id to the canonical user, so the next logins with it made as the canonical user.
+// Links are one level deep: the canonical user can't be linked itself, and the linked id can't have ids linked to it.
+// Comments of the linked id are left as they are, MergeUser moves them.
+func (s *DataStore) LinkUser(siteID, userID, canonicalID string) error {
+	if userID == "" || canonicalID == "" || userID == canonicalID {
+		return fmt.Errorf("can't link user %q to %q", userID, canonicalID)
+	}
+	linked, err := s.LinkedUser(siteID, canonicalID)
+	if err != nil {
+		return err
+	}
+	if linked != "" {
+		return fmt.Errorf("user %s is linked to %s and can't be canonical", canonicalID, linked)
+	}
+	linkedToUser, err := s.LinkedUsers(siteID, userID)
+	if err != nil {
+		return err
+	}
+	if len(linkedToUser) > 0 {
+		return fmt.Errorf("user %s has linked ids and can't be linked", userID)
+	}
+	_, err = s.Engine.UserDetail(engine.UserDetailRequest{Locator: store.Locator{SiteID: siteID}, UserID: userID,
+		Detail: engine.UserLinkedTo, Update: canonicalID})
+	if err != nil {
+		return fmt.Errorf("failed to link %s to %s: %w", userID, canonicalID, err)
+	}
+	log.Printf("[INFO] user %s linked to %s on %s", userID, canonicalID, siteID)
+	return nil
+}
+
+// UnlinkUser removes link of the user id to the canonical user
+func (s *DataStore) UnlinkUser(siteID, userID string) error {
+	return s.Engine.Delete(engine.DeleteRequest{Locator: store.Locator{SiteID: siteID}, UserID: userID, UserDetail: engine.UserLinkedTo})
+}
+
+// MergeUser re-attributes all comments and votes of fromID user to toID user and links fromID to toID,
+// so the next logins of the merged user made as the target one. Ids linked to the merged user relinked to the target.
+// Duplicate votes and votes for own comments after the merge are dropped, with the score recalculated.
+// Frozen posts with comments or votes of the merged user are restored from cold storage first.
+func (s *DataStore) MergeUser(siteID, fromID, toID string) (engine.MergeResult, error) {
+	merger, ok := s.Engine.(engine.UserMerger)
+	if !ok {
+		return engine.MergeResult{}, errors.New("merge of users is not supported by the store engine")
+	}
+	target, err := s.LinkedUser(siteID, toID)
+	if err != nil {
+		return engine.MergeResult{}, err
+	}
+	if target != "" {
+		return engine.MergeResult{}, fmt.Errorf("user %s is linked to %s and can't be merge target", toID, target)
+	}
+	// frozen posts with comments and votes of the merged user restored to merge them
+	if err = s.thawUser(siteID, fromID); err != nil {
+		return engine.MergeResult{}, err
+	}
+	if err = s.thawVotes(siteID, fromID); err != nil {
+		return engine.MergeResult{}, err
+	}
+
+	res, err := merger.MergeUser(siteID, fromID, toID, func(prev store.Comment, c *store.Comment) {
+		c.Score += int(math.Round(weightedVotes(*c)) - math.Round(weightedVotes(prev)))
+		c.Controversy = s.controversy(s.upsAndDowns(*c))
+	})
+	if err != nil {
+		return res, fmt.Errorf("failed to merge %s to %s: %w", fromID, toID, err)
+	}
+
+	linked, err := s.LinkedUsers(siteID, fromID)
+	if err != nil {
+		return res, err
+	}
+	for _, id := range append(linked, fromID) {
+		_, err = s.Engine.UserDetail(engine.UserDetailRequest{Locator: store.Locator{SiteID: siteID}, UserID: id,
+			Detail: engine.UserLinkedTo, Update: toID})
+		if err != nil {
+			return res, fmt.Errorf("failed to link %s to %s: %w", id, toID, err)
+		}
+	}
+	log.Printf("[INFO] user %s merged to %s on %s, %+v", fromID, toID, siteID, res)
+	s.emit(event.Event{Type: event.UserMerged, SiteID: siteID, UserID: fromID, Data: map[string]any{"to": toID,
+		"comments": res.Comments, "votes": res.Votes}})
+	return res, nil
+}
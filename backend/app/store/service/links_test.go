@@ -0,0 +1,129 @@
+package service
+
+import (
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/cold"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+func TestService_LinkUser(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+
+	res, err := b.LinkedUser("radio-t", "github_1")
+	require.NoError(t, err)
+	assert.Empty(t, res, "not linked")
+
+	require.NoError(t, b.LinkUser("radio-t", "github_1", "user1"))
+	require.NoError(t, b.LinkUser("radio-t", "email_1", "user1"))
+	res, err = b.LinkedUser("radio-t", "github_1")
+	require.NoError(t, err)
+	assert.Equal(t, "user1", res)
+	linked, err := b.LinkedUsers("radio-t", "user1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"email_1", "github_1"}, linked)
+
+	assert.EqualError(t, b.LinkUser("radio-t", "user1", "user1"), `can't link user "user1" to "user1"`)
+	assert.EqualError(t, b.LinkUser("radio-t", "google_1", "github_1"), "user github_1 is linked to user1 and can't be canonical")
+	assert.EqualError(t, b.LinkUser("radio-t", "user1", "google_1"), "user user1 has linked ids and can't be linked")
+	assert.Error(t, b.LinkUser("other-site", "github_1", "user1"))
+
+	require.NoError(t, b.UnlinkUser("radio-t", "github_1"))
+	res, err = b.LinkedUser("radio-t", "github_1")
+	require.NoError(t, err)
+	assert.Empty(t, res)
+	linked, err = b.LinkedUsers("radio-t", "user1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"email_1"}, linked)
+}
+
+func TestService_MergeUser(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123"), MaxVotes: -1}
+
+	loc := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	_, err := b.Create(store.Comment{Text: "comment of user2", Locator: loc, User: store.User{ID: "user2", Name: "user2"}})
+	require.NoError(t, err)
+	user3, err := b.Create(store.Comment{Text: "comment of user3", Locator: loc, User: store.User{ID: "user3", Name: "user3"}})
+	require.NoError(t, err)
+	for _, id := range []string{"user1", "user2"} {
+		_, err = b.Vote(VoteReq{Locator: loc, CommentID: user3, UserID: id, Val: true})
+		require.NoError(t, err)
+	}
+	c, err := b.Get(loc, user3, store.User{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, c.Score)
+	require.NoError(t, b.LinkUser("radio-t", "github_1", "user1"))
+
+	res, err := b.MergeUser("radio-t", "user1", "user2")
+	require.NoError(t, err)
+	assert.Equal(t, engine.MergeResult{Comments: 2, DroppedVotes: 1}, res)
+
+	c, err = eng.Get(engine.GetRequest{Locator: loc, CommentID: user3})
+	require.NoError(t, err)
+	assert.Equal(t, 1, c.Score, "score of dropped duplicate vote removed")
+	assert.Equal(t, map[string]bool{"user2": true}, c.Votes)
+	comments, err := b.User("radio-t", "user2", 10, 0, store.User{})
+	require.NoError(t, err)
+	assert.Len(t, comments, 3)
+
+	for _, id := range []string{"user1", "github_1"} {
+		linked, e := b.LinkedUser("radio-t", id)
+		require.NoError(t, e)
+		assert.Equal(t, "user2", linked, "merged user and its links linked to the target")
+	}
+
+	_, err = b.MergeUser("radio-t", "user3", "user1")
+	assert.EqualError(t, err, "user user1 is linked to user2 and can't be merge target")
+	_, err = b.MergeUser("radio-t", "user2", "user2")
+	assert.ErrorContains(t, err, "can't merge user")
+}
+
+func TestService_MergeUserCold(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123"), MaxVotes: -1}
+	var err error
+	b.ColdStore, err = cold.NewBoltStorage(path.Join(t.TempDir(), "cold.db"), bolt.Options{})
+	require.NoError(t, err)
+	defer b.ColdStore.Close()
+
+	// user1 has comments on the first post and only voted on the second one
+	loc := store.Locator{URL: "https://radio-t.com/2", SiteID: "radio-t"}
+	user3, err := b.Create(store.Comment{Text: "comment of user3", Locator: loc, User: store.User{ID: "user3", Name: "user3"}})
+	require.NoError(t, err)
+	_, err = b.Vote(VoteReq{Locator: loc, CommentID: user3, UserID: "user1", Val: true})
+	require.NoError(t, err)
+	_, err = b.Create(store.Comment{Text: "untouched", Locator: store.Locator{URL: "https://radio-t.com/3", SiteID: "radio-t"},
+		User: store.User{ID: "user3", Name: "user3"}})
+	require.NoError(t, err)
+	frozen, err := b.FreezePosts("radio-t", -time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, 3, frozen)
+
+	res, err := b.MergeUser("radio-t", "user1", "user2")
+	require.NoError(t, err)
+	assert.Equal(t, engine.MergeResult{Comments: 2, Votes: 1}, res, "comments and votes of frozen posts merged")
+
+	segments, err := b.ColdPosts("radio-t")
+	require.NoError(t, err)
+	require.Len(t, segments, 1, "post without comments and votes of the user kept frozen")
+	assert.Equal(t, "https://radio-t.com/3", segments[0].URL)
+	c, err := eng.Get(engine.GetRequest{Locator: loc, CommentID: user3})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"user2": true}, c.Votes)
+	comments, err := eng.Find(engine.FindRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "user2", Limit: 10})
+	require.NoError(t, err)
+	assert.Len(t, comments, 2)
+}
@@ -0,0 +1,216 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+// permanentBlockAfter is the block expiration treated as permanent, the engine keeps permanent blocks for 100 years
+const permanentBlockAfter = 50 * 365 * 24 * time.Hour
+
+// ModeratedUser is an entry of site's blocked and verified users list, used to move moderation state between sites
+type ModeratedUser struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name,omitempty"`
+	Blocked  bool      `json:"blocked,omitempty"`
+	Until    time.Time `json:"until,omitzero"` // block expiration, zero for permanent block
+	Reason   string    `json:"reason,omitempty"`
+	Verified bool      `json:"verified,omitempty"`
+}
+
+// SetBlockReason sets admin's note why the user is blocked, empty reason removes it
+func (s *DataStore) SetBlockReason(siteID, userID, reason string) error {
+	if reason == "" {
+		return s.Engine.Delete(engine.DeleteRequest{Locator: store.Locator{SiteID: siteID}, UserID: userID, UserDetail: engine.UserBlockReason})
+	}
+	_, err := s.Engine.UserDetail(engine.UserDetailRequest{Locator: store.Locator{SiteID: siteID}, UserID: userID,
+		Detail: engine.UserBlockReason, Update: reason})
+	return err
+}
+
+// ModeratedUsers returns blocked and verified users of the site, sorted by id
+func (s *DataStore) ModeratedUsers(siteID string) ([]ModeratedUser, error) {
+	users := map[string]*ModeratedUser{}
+	get := func(id string) *ModeratedUser {
+		if u, ok := users[id]; ok {
+			return u
+		}
+		users[id] = &ModeratedUser{ID: id}
+		return users[id]
+	}
+
+	blocked, err := s.BlockedUsers(siteID)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range blocked {
+		u := get(b.ID)
+		u.Name, u.Blocked = b.Name, true
+		if time.Until(b.Until) < permanentBlockAfter {
+			u.Until = b.Until
+		}
+	}
+
+	verified, err := s.Engine.ListFlags(engine.FlagRequest{Locator: store.Locator{SiteID: siteID}, Flag: engine.Verified})
+	if err != nil {
+		return nil, fmt.Errorf("can't get list of verified users for %s: %w", siteID, err)
+	}
+	for _, v := range verified {
+		id, ok := v.(string)
+		if !ok {
+			log.Printf("[WARN] unexpected verified user %v of %s, skipped", v, siteID)
+			continue
+		}
+		get(id).Verified = true
+	}
+
+	details, err := s.Engine.UserDetail(engine.UserDetailRequest{Locator: store.Locator{SiteID: siteID}, Detail: engine.AllUserDetails})
+	if err != nil {
+		return nil, fmt.Errorf("can't get user details for %s: %w", siteID, err)
+	}
+	for _, d := range details {
+		if u, ok := users[d.UserID]; ok && u.Blocked {
+			u.Reason = d.BlockReason
+		}
+	}
+
+	res := make([]ModeratedUser, 0, len(users))
+	for _, u := range users {
+		res = append(res, *u)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res, nil
+}
+
+// ImportModeratedUsers blocks and verifies users from the list, merged with the current state of the site:
+// users not in the list keep their status. Blocks expired already are skipped, comments of blocked users kept.
+// Returns number of imported entries.
+func (s *DataStore) ImportModeratedUsers(siteID string, users []ModeratedUser) (int, error) {
+	count := 0
+	var errs []error
+	for _, u := range users {
+		if u.ID == "" {
+			errs = append(errs, errors.New("empty user id"))
+			continue
+		}
+		imported := false
+		if u.Blocked {
+			var ttl time.Duration // permanent by default
+			if !u.Until.IsZero() {
+				ttl = time.Until(u.Until)
+			}
+			if ttl >= 0 {
+				if err := s.SetBlock(siteID, u.ID, true, ttl); err != nil {
+					errs = append(errs, fmt.Errorf("can't block %s: %w", u.ID, err))
+					continue
+				}
+				if err := s.SetBlockReason(siteID, u.ID, u.Reason); err != nil {
+					errs = append(errs, fmt.Errorf("can't set block reason for %s: %w", u.ID, err))
+				}
+				imported = true
+			}
+		}
+		if u.Verified {
+			if err := s.SetVerified(siteID, u.ID, true); err != nil {
+				errs = append(errs, fmt.Errorf("can't verify %s: %w", u.ID, err))
+				continue
+			}
+			imported = true
+		}
+		if imported {
+			count++
+		}
+	}
+	return count, errors.Join(errs...)
+}
+
+// feedBlockPrefix marks block reason of users blocked by a shared blocklist feed, followed by the feed source
+const feedBlockPrefix = "blocklist "
+
+// PublishedBlocklist returns users blocked on the site by its admins, to be shared with other instances.
+// Blocks made by blocklist feeds are not republished, reasons and verified status are not shared.
+func (s *DataStore) PublishedBlocklist(siteID string) ([]ModeratedUser, error) {
+	users, err := s.ModeratedUsers(siteID)
+	if err != nil {
+		return nil, err
+	}
+	res := []ModeratedUser{}
+	for _, u := range users {
+		if !u.Blocked || strings.HasPrefix(u.Reason, feedBlockPrefix) {
+			continue
+		}
+		res = append(res, ModeratedUser{ID: u.ID, Name: u.Name, Blocked: true, Until: u.Until})
+	}
+	return res, nil
+}
+
+// SyncBlocklistFeed applies blocklist feed to the site. Users blocked by the feed are blocked with the feed
+// as the reason, and the ones removed from the feed unblocked. Local decisions take precedence: users from
+// allow list, verified users and users blocked by admins or by other feeds are left as is.
+// Comments of blocked users are kept. Returns number of blocked and unblocked users.
+func (s *DataStore) SyncBlocklistFeed(siteID, feed string, users []ModeratedUser, allow []string) (blocked, unblocked int, err error) {
+	current, err := s.ModeratedUsers(siteID)
+	if err != nil {
+		return 0, 0, err
+	}
+	reason := feedBlockPrefix + feed
+	state := make(map[string]ModeratedUser, len(current))
+	for _, u := range current {
+		state[u.ID] = u
+	}
+	skip := make(map[string]bool, len(allow))
+	for _, id := range allow {
+		skip[id] = true
+	}
+
+	var errs []error
+	inFeed := map[string]bool{}
+	for _, u := range users {
+		if u.ID == "" || !u.Blocked || skip[u.ID] || (!u.Until.IsZero() && time.Until(u.Until) <= 0) {
+			continue
+		}
+		inFeed[u.ID] = true
+		local := state[u.ID]
+		if local.Verified || (local.Blocked && local.Reason != reason) {
+			continue
+		}
+		if local.Blocked && local.Until.Sub(u.Until).Abs() < time.Minute {
+			continue // already blocked by the feed, expiration may differ slightly as stored by ttl
+		}
+		var ttl time.Duration // permanent by default
+		if !u.Until.IsZero() {
+			ttl = time.Until(u.Until)
+		}
+		if e := s.SetBlock(siteID, u.ID, true, ttl); e != nil {
+			errs = append(errs, fmt.Errorf("can't block %s: %w", u.ID, e))
+			continue
+		}
+		if e := s.SetBlockReason(siteID, u.ID, reason); e != nil {
+			errs = append(errs, fmt.Errorf("can't set block reason for %s: %w", u.ID, e))
+		}
+		blocked++
+	}
+
+	for _, u := range current {
+		if !u.Blocked || u.Reason != reason || inFeed[u.ID] {
+			continue
+		}
+		if e := s.SetBlock(siteID, u.ID, false, 0); e != nil {
+			errs = append(errs, fmt.Errorf("can't unblock %s: %w", u.ID, e))
+			continue
+		}
+		if e := s.SetBlockReason(siteID, u.ID, ""); e != nil {
+			errs = append(errs, fmt.Errorf("can't clear block reason for %s: %w", u.ID, e))
+		}
+		unblocked++
+	}
+	return blocked, unblocked, errors.Join(errs...)
+}
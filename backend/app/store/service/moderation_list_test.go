@@ -0,0 +1,203 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+func TestService_ModeratedUsers(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+
+	res, err := b.ModeratedUsers("radio-t")
+	require.NoError(t, err)
+	assert.Empty(t, res)
+
+	require.NoError(t, b.SetBlock("radio-t", "user1", true, 0))
+	require.NoError(t, b.SetBlockReason("radio-t", "user1", "spam"))
+	require.NoError(t, b.SetBlock("radio-t", "user2", true, time.Hour))
+	require.NoError(t, b.SetVerified("radio-t", "user2", true))
+	require.NoError(t, b.SetVerified("radio-t", "user3", true))
+
+	res, err = b.ModeratedUsers("radio-t")
+	require.NoError(t, err)
+	require.Len(t, res, 3)
+	assert.Equal(t, "user1", res[0].ID)
+	assert.True(t, res[0].Blocked)
+	assert.True(t, res[0].Until.IsZero(), "permanent block")
+	assert.Equal(t, "spam", res[0].Reason)
+	assert.False(t, res[0].Verified)
+
+	assert.Equal(t, "user2", res[1].ID)
+	assert.True(t, res[1].Blocked)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), res[1].Until, time.Minute)
+	assert.True(t, res[1].Verified)
+
+	assert.Equal(t, ModeratedUser{ID: "user3", Verified: true}, res[2])
+
+	// reason removed with empty value
+	require.NoError(t, b.SetBlockReason("radio-t", "user1", ""))
+	res, err = b.ModeratedUsers("radio-t")
+	require.NoError(t, err)
+	assert.Empty(t, res[0].Reason)
+
+	_, err = b.ModeratedUsers("bad")
+	assert.Error(t, err)
+
+	// bad entries of verified users skipped
+	b.Engine = &badFlagsEngine{Interface: eng}
+	res, err = b.ModeratedUsers("radio-t")
+	require.NoError(t, err)
+	require.Len(t, res, 3)
+	assert.Equal(t, ModeratedUser{ID: "user3", Verified: true}, res[2])
+}
+
+// badFlagsEngine adds non-string entry to the list of verified users
+type badFlagsEngine struct {
+	engine.Interface
+}
+
+func (e *badFlagsEngine) ListFlags(req engine.FlagRequest) ([]any, error) {
+	res, err := e.Interface.ListFlags(req)
+	if req.Flag == engine.Verified {
+		res = append(res, 42)
+	}
+	return res, err
+}
+
+func TestService_ImportModeratedUsers(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+
+	require.NoError(t, b.SetVerified("radio-t", "user5", true))
+
+	count, err := b.ImportModeratedUsers("radio-t", []ModeratedUser{
+		{ID: "user1", Blocked: true, Reason: "spam"},
+		{ID: "user2", Blocked: true, Until: time.Now().Add(time.Hour), Verified: true},
+		{ID: "user3", Blocked: true, Until: time.Now().Add(-time.Hour)},
+		{ID: "user4", Verified: true},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, count, "expired block skipped")
+
+	assert.True(t, b.IsBlocked("radio-t", "user1"))
+	assert.True(t, b.IsBlocked("radio-t", "user2"))
+	assert.False(t, b.IsBlocked("radio-t", "user3"))
+	assert.True(t, b.IsVerified("radio-t", "user2"))
+	assert.True(t, b.IsVerified("radio-t", "user4"))
+	assert.True(t, b.IsVerified("radio-t", "user5"), "not listed user keeps status")
+
+	res, err := b.ModeratedUsers("radio-t")
+	require.NoError(t, err)
+	require.Len(t, res, 4)
+	assert.Equal(t, "spam", res[0].Reason)
+	assert.True(t, res[0].Until.IsZero())
+	assert.WithinDuration(t, time.Now().Add(time.Hour), res[1].Until, time.Minute)
+
+	count, err = b.ImportModeratedUsers("radio-t", []ModeratedUser{{ID: "", Blocked: true}, {ID: "user6", Blocked: true}})
+	assert.EqualError(t, err, "empty user id")
+	assert.Equal(t, 1, count)
+	assert.True(t, b.IsBlocked("radio-t", "user6"))
+}
+
+func TestService_PublishedBlocklist(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+
+	require.NoError(t, b.SetBlock("radio-t", "user1", true, 0))
+	require.NoError(t, b.SetBlockReason("radio-t", "user1", "spam"))
+	require.NoError(t, b.SetBlock("radio-t", "user2", true, time.Hour))
+	require.NoError(t, b.SetVerified("radio-t", "user2", true))
+	require.NoError(t, b.SetVerified("radio-t", "user3", true))
+	require.NoError(t, b.SetBlock("radio-t", "user4", true, 0))
+	require.NoError(t, b.SetBlockReason("radio-t", "user4", "blocklist https://example.com/feed"))
+
+	res, err := b.PublishedBlocklist("radio-t")
+	require.NoError(t, err)
+	require.Len(t, res, 2, "not blocked and blocked by feed users skipped")
+	assert.Equal(t, ModeratedUser{ID: "user1", Name: "user name", Blocked: true}, res[0], "reason not published")
+	assert.Equal(t, "user2", res[1].ID)
+	assert.False(t, res[1].Verified)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), res[1].Until, time.Minute)
+
+	_, err = b.PublishedBlocklist("bad")
+	assert.Error(t, err)
+}
+
+func TestService_SyncBlocklistFeed(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+
+	require.NoError(t, b.SetBlock("radio-t", "local", true, 0))
+	require.NoError(t, b.SetBlockReason("radio-t", "local", "spam"))
+	require.NoError(t, b.SetVerified("radio-t", "trusted", true))
+
+	feed := []ModeratedUser{
+		{ID: "spammer1", Blocked: true},
+		{ID: "spammer2", Blocked: true, Until: time.Now().Add(time.Hour)},
+		{ID: "expired", Blocked: true, Until: time.Now().Add(-time.Hour)},
+		{ID: "local", Blocked: true, Until: time.Now().Add(time.Hour)},
+		{ID: "trusted", Blocked: true},
+		{ID: "friend", Blocked: true},
+		{ID: "not-blocked", Verified: true},
+	}
+	blocked, unblocked, err := b.SyncBlocklistFeed("radio-t", "https://example.com/feed", feed, []string{"friend"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, blocked)
+	assert.Equal(t, 0, unblocked)
+	for id, status := range map[string]bool{"spammer1": true, "spammer2": true, "expired": false, "local": true,
+		"trusted": false, "friend": false, "not-blocked": false} {
+		assert.Equal(t, status, b.IsBlocked("radio-t", id), id)
+	}
+	assert.False(t, b.IsVerified("radio-t", "not-blocked"), "verified status not imported from feeds")
+
+	users, err := b.ModeratedUsers("radio-t")
+	require.NoError(t, err)
+	reasons := map[string]string{}
+	for _, u := range users {
+		reasons[u.ID] = u.Reason
+		if u.ID == "local" {
+			assert.True(t, u.Until.IsZero(), "local permanent block kept")
+		}
+	}
+	assert.Equal(t, map[string]string{"local": "spam", "spammer1": "blocklist https://example.com/feed",
+		"spammer2": "blocklist https://example.com/feed", "trusted": ""}, reasons)
+
+	// repeated sync changes nothing
+	blocked, unblocked, err = b.SyncBlocklistFeed("radio-t", "https://example.com/feed", feed, []string{"friend"})
+	require.NoError(t, err)
+	assert.Equal(t, 0, blocked+unblocked)
+
+	// other feed doesn't touch users blocked by the first one
+	blocked, unblocked, err = b.SyncBlocklistFeed("radio-t", "https://example.com/other", nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0, blocked+unblocked)
+
+	// user removed from the feed and user added to allow list unblocked
+	blocked, unblocked, err = b.SyncBlocklistFeed("radio-t", "https://example.com/feed", feed[:2], []string{"spammer1"})
+	require.NoError(t, err)
+	assert.Equal(t, 0, blocked)
+	assert.Equal(t, 1, unblocked)
+	assert.False(t, b.IsBlocked("radio-t", "spammer1"))
+	assert.True(t, b.IsBlocked("radio-t", "spammer2"))
+
+	blocked, unblocked, err = b.SyncBlocklistFeed("radio-t", "https://example.com/feed", nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0, blocked)
+	assert.Equal(t, 1, unblocked)
+	assert.False(t, b.IsBlocked("radio-t", "spammer2"))
+	assert.True(t, b.IsBlocked("radio-t", "local"), "local block kept")
+
+	_, _, err = b.SyncBlocklistFeed("bad", "https://example.com/feed", feed, nil)
+	assert.Error(t, err)
+}
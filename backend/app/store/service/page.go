@@ -0,0 +1,105 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/page"
+)
+
+var errPagesDisabled = errors.New("page settings disabled")
+
+// PageSettings returns settings of the post, empty if not set or page settings disabled
+func (s *DataStore) PageSettings(locator store.Locator) page.Settings {
+	if s.PageStore == nil {
+		return page.Settings{Locator: locator}
+	}
+	res, err := s.PageStore.Get(locator)
+	if err != nil {
+		if !errors.Is(err, page.ErrNotFound) {
+			log.Printf("[WARN] can't get settings of %s, %v", locator.URL, err)
+		}
+		return page.Settings{Locator: locator}
+	}
+	return res
+}
+
+// PagesSettings returns settings of the site's posts, sorted by url
+func (s *DataStore) PagesSettings(siteID string) ([]page.Settings, error) {
+	if s.PageStore == nil {
+		return nil, errPagesDisabled
+	}
+	return s.PageStore.List(siteID)
+}
+
+// SetPageSort pins default order of the post's comments, empty sort unpins it
+func (s *DataStore) SetPageSort(locator store.Locator, sort string) error {
+	if s.PageStore == nil {
+		return errPagesDisabled
+	}
+	if sort != "" && !page.ValidSort(sort) {
+		return fmt.Errorf("invalid sort %q", sort)
+	}
+	return s.updatePage(locator, func(p *page.Settings) { p.Sort = sort })
+}
+
+// SetPageLive toggles live-blog mode of the post
+func (s *DataStore) SetPageLive(locator store.Locator, live bool) error {
+	if s.PageStore == nil {
+		return errPagesDisabled
+	}
+	return s.updatePage(locator, func(p *page.Settings) { p.Live = live })
+}
+
+// SetPageRegistered registers the post, or removes registration. In strict mode comments accepted only on registered posts.
+func (s *DataStore) SetPageRegistered(locator store.Locator, registered bool) error {
+	if s.PageStore == nil {
+		return errPagesDisabled
+	}
+	return s.updatePage(locator, func(p *page.Settings) { p.Registered = registered })
+}
+
+// RegisterPages registers the site's posts not registered yet, like ones listed in the sitemap.
+// Returns number of newly registered posts.
+func (s *DataStore) RegisterPages(siteID string, urls []string) (int, error) {
+	if s.PageStore == nil {
+		return 0, errPagesDisabled
+	}
+	count := 0
+	for _, u := range urls {
+		locator := store.Locator{SiteID: siteID, URL: u}
+		if s.PageSettings(locator).Registered {
+			continue
+		}
+		if err := s.SetPageRegistered(locator, true); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// updatePage changes settings of the post, settings without overrides removed
+func (s *DataStore) updatePage(locator store.Locator, fn func(p *page.Settings)) error {
+	lock := s.getScopedLocks(locator.SiteID + "!!page!!" + locator.URL)
+	lock.Lock()
+	defer lock.Unlock()
+
+	p := s.PageSettings(locator)
+	fn(&p)
+	if p.IsEmpty() {
+		if err := s.PageStore.Delete(locator); err != nil && !errors.Is(err, page.ErrNotFound) {
+			return fmt.Errorf("can't remove settings of %s: %w", locator.URL, err)
+		}
+		return nil
+	}
+	p.Locator, p.Updated = locator, time.Now()
+	if err := s.PageStore.Set(p); err != nil {
+		return fmt.Errorf("can't save settings of %s: %w", locator.URL, err)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-pkgz/lcw/v2"
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark42/backend/app/store"
+)
+
+// PageInfo is the state of the page in the site's CMS
+type PageInfo struct {
+	Commentable bool   `json:"commentable"`
+	Title       string `json:"title,omitempty"`
+}
+
+// ErrPageNotCommentable returned in case the site's CMS doesn't know the page or doesn't allow comments on it
+var ErrPageNotCommentable = errors.New("page can't be commented")
+
+// applyPageCheck rejects comments on pages the site's CMS doesn't confirm, and sets post title reported by the CMS.
+// The CMS check replaces registration of strict mode: for sites with the page-check endpoint the CMS decides alone,
+// registered pages not confirmed by it are rejected and confirmed ones need no registration. Strict mode applies
+// to sites without the endpoint only. Imported comments are exempt.
+func (s *DataStore) applyPageCheck(c *store.Comment) error {
+	if c.Imported {
+		return nil
+	}
+	if s.PageChecker == nil || s.PageChecker.URLs[c.Locator.SiteID] == "" {
+		return s.applyStrictPages(c)
+	}
+	// strict mode not applied, the CMS check replaces registration
+	info, err := s.PageChecker.Check(c.Locator.SiteID, c.Locator.URL)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrPageNotCommentable, err)
+	}
+	if !info.Commentable {
+		log.Printf("[INFO] comment from %s on %s rejected, page not commentable", c.User.ID, c.Locator.URL)
+		return ErrPageNotCommentable
+	}
+	if c.PostTitle == "" {
+		c.PostTitle = info.Title
+	}
+	return nil
+}
+
+// applyStrictPages rejects comments on posts not registered, in strict mode
+func (s *DataStore) applyStrictPages(c *store.Comment) error {
+	if !s.StrictPages || s.PageSettings(c.Locator).Registered {
+		return nil
+	}
+	log.Printf("[INFO] comment from %s on %s rejected, page not registered", c.User.ID, c.Locator.URL)
+	return fmt.Errorf("%w: not registered", ErrPageNotCommentable)
+}
+
+// PageWebhook checks pages with endpoints of the sites. Endpoint gets GET request with site and url params
+// and responds with PageInfo json, or 404 for unknown page. Responses cached for TTL.
+type PageWebhook struct {
+	URLs     map[string]string // endpoint per site, pages of other sites are not checked
+	Client   http.Client
+	FailOpen bool // accept comments if the endpoint fails, rejected otherwise
+
+	cache lcw.LoadingCache[PageInfo]
+}
+
+// NewPageWebhook makes PageWebhook with endpoints per site and cache of responses
+func NewPageWebhook(urls map[string]string, client http.Client, ttl time.Duration, failOpen bool) *PageWebhook {
+	res := PageWebhook{URLs: urls, Client: client, FailOpen: failOpen}
+	res.cache = &lcw.Nop[PageInfo]{}
+	if ttl > 0 {
+		o := lcw.NewOpts[PageInfo]()
+		cache, err := lcw.NewExpirableCache(o.TTL(ttl), o.MaxKeys(1000))
+		if err != nil {
+			log.Printf("[WARN] failed to make cache, caching disabled for page checks, %v", err)
+			return &res
+		}
+		res.cache = cache
+	}
+	return &res
+}
+
+// Check calls endpoint of the site for the page, all pages commentable if the site has no endpoint
+func (p *PageWebhook) Check(siteID, pageURL string) (PageInfo, error) {
+	endpoint, ok := p.URLs[siteID]
+	if !ok {
+		return PageInfo{Commentable: true}, nil
+	}
+	res, err := p.cache.Get(siteID+"!!"+pageURL, func() (PageInfo, error) { return p.call(endpoint, siteID, pageURL) })
+	if err != nil {
+		if p.FailOpen {
+			log.Printf("[WARN] page check of %s failed, accepted, %v", pageURL, err)
+			return PageInfo{Commentable: true}, nil
+		}
+		return PageInfo{}, err
+	}
+	return res, nil
+}
+
+// Close page webhook
+func (p *PageWebhook) Close() error {
+	p.Client.CloseIdleConnections()
+	return p.cache.Close()
+}
+
+func (p *PageWebhook) call(endpoint, siteID, pageURL string) (PageInfo, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return PageInfo{}, fmt.Errorf("bad page check endpoint of %s: %w", siteID, err)
+	}
+	q := u.Query()
+	q.Set("site", siteID)
+	q.Set("url", pageURL)
+	u.RawQuery = q.Encode()
+	resp, err := p.Client.Get(u.String())
+	if err != nil {
+		return PageInfo{}, fmt.Errorf("page check failed: %w", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // nothing to do with the error
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return PageInfo{}, nil
+	default:
+		return PageInfo{}, fmt.Errorf("page check responded with status %d", resp.StatusCode)
+	}
+	res := PageInfo{}
+	if err = json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&res); err != nil {
+		return PageInfo{}, fmt.Errorf("can't decode page check response: %w", err)
+	}
+	return res, nil
+}
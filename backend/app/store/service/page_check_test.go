@@ -0,0 +1,148 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/page"
+)
+
+func TestPageWebhook_Check(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		assert.Equal(t, "radio-t", r.URL.Query().Get("site"))
+		assert.Equal(t, "secret", r.URL.Query().Get("key"), "endpoint params kept")
+		switch r.URL.Query().Get("url") {
+		case "https://radio-t.com/p/1":
+			_, _ = w.Write([]byte(`{"commentable":true,"title":"Podcast 1"}`))
+		case "https://radio-t.com/p/2":
+			_, _ = w.Write([]byte(`{"commentable":false}`))
+		case "https://radio-t.com/broken":
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	p := NewPageWebhook(map[string]string{"radio-t": ts.URL + "?key=secret"}, http.Client{Timeout: time.Second}, time.Minute, false)
+	defer p.Close()
+
+	res, err := p.Check("radio-t", "https://radio-t.com/p/1")
+	require.NoError(t, err)
+	assert.Equal(t, PageInfo{Commentable: true, Title: "Podcast 1"}, res)
+	_, err = p.Check("radio-t", "https://radio-t.com/p/1")
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "cached")
+
+	res, err = p.Check("radio-t", "https://radio-t.com/p/2")
+	require.NoError(t, err)
+	assert.False(t, res.Commentable)
+	res, err = p.Check("radio-t", "https://radio-t.com/unknown")
+	require.NoError(t, err)
+	assert.False(t, res.Commentable, "not found")
+	_, err = p.Check("radio-t", "https://radio-t.com/broken")
+	assert.EqualError(t, err, "page check responded with status 502")
+
+	res, err = p.Check("other", "https://other.com/unknown")
+	require.NoError(t, err)
+	assert.True(t, res.Commentable, "site without endpoint")
+
+	p.FailOpen = true
+	res, err = p.Check("radio-t", "https://radio-t.com/broken")
+	require.NoError(t, err)
+	assert.True(t, res.Commentable, "failed check accepted")
+}
+
+func TestService_CreateWithPageCheck(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("url") == "https://radio-t.com/p/1" {
+			_, _ = w.Write([]byte(`{"commentable":true,"title":"Podcast 1"}`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123"),
+		PageChecker: NewPageWebhook(map[string]string{"radio-t": ts.URL}, http.Client{Timeout: time.Second}, 0, false)}
+	defer b.Close()
+	comment := func(url string) store.Comment {
+		return store.Comment{Text: "text", Locator: store.Locator{URL: url, SiteID: "radio-t"}, User: store.User{ID: "user1", Name: "user1"}}
+	}
+
+	id, err := b.Create(comment("https://radio-t.com/p/1"))
+	require.NoError(t, err)
+	c, err := b.Engine.Get(getReq(store.Locator{URL: "https://radio-t.com/p/1", SiteID: "radio-t"}, id))
+	require.NoError(t, err)
+	assert.Equal(t, "Podcast 1", c.PostTitle, "title from the cms")
+
+	_, err = b.Create(comment("https://radio-t.com/p/nonexistent"))
+	assert.ErrorIs(t, err, ErrPageNotCommentable)
+
+	imported := comment("https://radio-t.com/p/nonexistent")
+	imported.Imported = true
+	_, err = b.Create(imported)
+	require.NoError(t, err, "imported exempt")
+}
+
+func TestService_CreateWithStrictPages(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("url") == "https://radio-t.com/p/1" {
+			_, _ = w.Write([]byte(`{"commentable":true}`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	pageStore, err := page.NewBoltStorage(path.Join(t.TempDir(), "pages.db"), bolt.Options{})
+	require.NoError(t, err)
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123"), PageStore: pageStore, StrictPages: true,
+		PageChecker: NewPageWebhook(map[string]string{"radio-t": ts.URL}, http.Client{Timeout: time.Second}, 0, false)}
+	defer b.Close()
+	comment := func(url string) store.Comment {
+		return store.Comment{Text: "text", Locator: store.Locator{URL: url, SiteID: "radio-t"}, User: store.User{ID: "user1", Name: "user1"}}
+	}
+
+	_, err = b.Create(comment("https://radio-t.com/p/1"))
+	require.NoError(t, err, "confirmed by the cms, no registration needed")
+	assert.False(t, b.PageSettings(store.Locator{SiteID: "radio-t", URL: "https://radio-t.com/p/1"}).Registered)
+
+	require.NoError(t, b.SetPageRegistered(store.Locator{SiteID: "radio-t", URL: "https://radio-t.com/p/4"}, true))
+	_, err = b.Create(comment("https://radio-t.com/p/4"))
+	require.ErrorIs(t, err, ErrPageNotCommentable, "registered, but rejected by the cms")
+
+	b.PageChecker.URLs = map[string]string{"other": ts.URL} // site without cms endpoint
+	_, err = b.Create(comment("https://radio-t.com/p/2"))
+	assert.ErrorIs(t, err, ErrPageNotCommentable, "not registered")
+	assert.EqualError(t, err, "page can't be commented: not registered")
+
+	require.NoError(t, b.SetPageRegistered(store.Locator{SiteID: "radio-t", URL: "https://radio-t.com/p/2"}, true))
+	_, err = b.Create(comment("https://radio-t.com/p/2"))
+	require.NoError(t, err, "registered")
+
+	imported := comment("https://radio-t.com/p/3")
+	imported.Imported = true
+	_, err = b.Create(imported)
+	require.NoError(t, err, "imported exempt")
+
+	b.StrictPages = false
+	_, err = b.Create(comment("https://radio-t.com/p/3"))
+	require.NoError(t, err, "strict mode off")
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/page"
+)
+
+func TestService_PageSort(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+	locator := store.Locator{SiteID: "radio-t", URL: "https://radio-t.com"}
+
+	assert.Equal(t, page.Settings{Locator: locator}, b.PageSettings(locator), "disabled")
+	require.EqualError(t, b.SetPageSort(locator, "-score"), "page settings disabled")
+	_, err := b.PagesSettings("radio-t")
+	require.EqualError(t, err, "page settings disabled")
+
+	b.PageStore, err = page.NewBoltStorage(path.Join(t.TempDir(), "pages.db"), bolt.Options{})
+	require.NoError(t, err)
+	defer b.Close()
+
+	assert.Empty(t, b.PageSettings(locator).Sort)
+	require.EqualError(t, b.SetPageSort(locator, "votes"), `invalid sort "votes"`)
+	require.NoError(t, b.SetPageSort(locator, "-score"))
+	p := b.PageSettings(locator)
+	assert.Equal(t, "-score", p.Sort)
+	assert.Equal(t, locator, p.Locator)
+	assert.False(t, p.Updated.IsZero())
+
+	list, err := b.PagesSettings("radio-t")
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, "-score", list[0].Sort)
+
+	require.NoError(t, b.SetPageSort(locator, ""))
+	assert.Empty(t, b.PageSettings(locator).Sort)
+	list, err = b.PagesSettings("radio-t")
+	require.NoError(t, err)
+	assert.Empty(t, list, "empty settings removed")
+	require.NoError(t, b.SetPageSort(locator, ""), "nothing to unpin")
+}
+
+func TestService_PageLive(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+	locator := store.Locator{SiteID: "radio-t", URL: "https://radio-t.com/live"}
+	require.EqualError(t, b.SetPageLive(locator, true), "page settings disabled")
+
+	var err error
+	b.PageStore, err = page.NewBoltStorage(path.Join(t.TempDir(), "pages.db"), bolt.Options{})
+	require.NoError(t, err)
+	defer b.Close()
+
+	require.NoError(t, b.SetPageLive(locator, true))
+	require.NoError(t, b.SetPageSort(locator, "-score"))
+	p := b.PageSettings(locator)
+	assert.True(t, p.Live)
+	assert.Equal(t, "-score", p.Sort)
+
+	require.NoError(t, b.SetPageSort(locator, ""))
+	assert.True(t, b.PageSettings(locator).Live, "live mode kept without pinned sort")
+
+	require.NoError(t, b.SetPageLive(locator, false))
+	list, err := b.PagesSettings("radio-t")
+	require.NoError(t, err)
+	assert.Empty(t, list)
+}
+
+func TestService_PageRegistered(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+	locator := store.Locator{SiteID: "radio-t", URL: "https://radio-t.com/p/1"}
+	require.EqualError(t, b.SetPageRegistered(locator, true), "page settings disabled")
+	_, err := b.RegisterPages("radio-t", []string{locator.URL})
+	require.EqualError(t, err, "page settings disabled")
+
+	b.PageStore, err = page.NewBoltStorage(path.Join(t.TempDir(), "pages.db"), bolt.Options{})
+	require.NoError(t, err)
+	defer b.Close()
+
+	require.NoError(t, b.SetPageRegistered(locator, true))
+	require.NoError(t, b.SetPageLive(locator, true))
+	assert.True(t, b.PageSettings(locator).Registered)
+
+	added, err := b.RegisterPages("radio-t", []string{locator.URL, "https://radio-t.com/p/2", "https://radio-t.com/p/3"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, added, "registered before skipped")
+	assert.True(t, b.PageSettings(locator).Live, "settings of registered post kept")
+	list, err := b.PagesSettings("radio-t")
+	require.NoError(t, err)
+	assert.Len(t, list, 3)
+
+	require.NoError(t, b.SetPageRegistered(store.Locator{SiteID: "radio-t", URL: "https://radio-t.com/p/2"}, false))
+	list, err = b.PagesSettings("radio-t")
+	require.NoError(t, err)
+	assert.Len(t, list, 2, "empty settings removed")
+}
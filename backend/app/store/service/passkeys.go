@@ -0,0 +1,26 @@
+package service
+
+import (
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+// Passkeys returns stored webauthn credentials of the user, opaque to the store. Empty for unknown user.
+func (s *DataStore) Passkeys(siteID, userID string) (string, error) {
+	res, err := s.Engine.UserDetail(engine.UserDetailRequest{Locator: store.Locator{SiteID: siteID}, UserID: userID,
+		Detail: engine.UserPasskeys})
+	if err != nil || len(res) != 1 {
+		return "", err
+	}
+	return res[0].Passkeys, nil
+}
+
+// SetPasskeys stores webauthn credentials of the user, empty value removes them
+func (s *DataStore) SetPasskeys(siteID, userID, passkeys string) error {
+	if passkeys == "" {
+		return s.Engine.Delete(engine.DeleteRequest{Locator: store.Locator{SiteID: siteID}, UserID: userID, UserDetail: engine.UserPasskeys})
+	}
+	_, err := s.Engine.UserDetail(engine.UserDetailRequest{Locator: store.Locator{SiteID: siteID}, UserID: userID,
+		Detail: engine.UserPasskeys, Update: passkeys})
+	return err
+}
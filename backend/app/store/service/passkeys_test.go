@@ -0,0 +1,33 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store/admin"
+)
+
+func TestService_Passkeys(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+
+	res, err := b.Passkeys("radio-t", "webauthn_1")
+	require.NoError(t, err)
+	assert.Empty(t, res, "no passkeys of unknown user")
+
+	require.NoError(t, b.SetPasskeys("radio-t", "webauthn_1", `{"name":"user1"}`))
+	res, err = b.Passkeys("radio-t", "webauthn_1")
+	require.NoError(t, err)
+	assert.Equal(t, `{"name":"user1"}`, res)
+
+	_, err = b.Passkeys("other-site", "webauthn_1")
+	assert.Error(t, err, "unknown site")
+
+	require.NoError(t, b.SetPasskeys("radio-t", "webauthn_1", ""))
+	res, err = b.Passkeys("radio-t", "webauthn_1")
+	require.NoError(t, err)
+	assert.Empty(t, res)
+}
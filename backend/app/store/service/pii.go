@@ -0,0 +1,131 @@
+package service
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// sealedPrefix marks email values sealed by PIIVault
+const sealedPrefix = "pii:"
+
+// PIIVault keeps email addresses out of the store in plain form. Addresses are persisted as a salted
+// hash, used to match them without decryption, and the address encrypted with AES-GCM, used to send
+// notifications. Both keys are derived from the single secret.
+type PIIVault struct {
+	hashKey []byte
+	aead    cipher.AEAD
+}
+
+// NewPIIVault makes PIIVault with keys derived from the secret
+func NewPIIVault(secret string) (*PIIVault, error) {
+	if secret == "" {
+		return nil, errors.New("empty pii secret")
+	}
+	block, err := aes.NewCipher(deriveKey(secret, "encrypt"))
+	if err != nil {
+		return nil, fmt.Errorf("can't make cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("can't make gcm: %w", err)
+	}
+	return &PIIVault{hashKey: deriveKey(secret, "hash"), aead: aead}, nil
+}
+
+// Hash returns salted hash of the email address, case and surrounding spaces ignored
+func (v *PIIVault) Hash(email string) string {
+	mac := hmac.New(sha256.New, v.hashKey)
+	mac.Write([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Seal returns the value to persist instead of email, "pii:<hash>:<encrypted address>".
+// Empty and already sealed values returned as is.
+func (v *PIIVault) Seal(email string) (string, error) {
+	if email == "" || IsSealed(email) {
+		return email, nil
+	}
+	nonce := make([]byte, v.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("can't make nonce: %w", err)
+	}
+	data := v.aead.Seal(nonce, nonce, []byte(email), nil)
+	return sealedPrefix + v.Hash(email) + ":" + base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// Open returns email address from the sealed value. Values not sealed by the vault returned as is.
+func (v *PIIVault) Open(val string) (string, error) {
+	if !IsSealed(val) {
+		return val, nil
+	}
+	_, encoded, ok := strings.Cut(strings.TrimPrefix(val, sealedPrefix), ":")
+	if !ok {
+		return "", errors.New("malformed sealed email")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("can't decode sealed email: %w", err)
+	}
+	if len(data) < v.aead.NonceSize() {
+		return "", errors.New("sealed email too short")
+	}
+	nonce, ciphertext := data[:v.aead.NonceSize()], data[v.aead.NonceSize():]
+	res, err := v.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("can't decrypt sealed email: %w", err)
+	}
+	return string(res), nil
+}
+
+// IsSealed checks if value was sealed by PIIVault
+func IsSealed(val string) bool {
+	return strings.HasPrefix(val, sealedPrefix)
+}
+
+// deriveKey makes 32 bytes key for the given purpose from the secret
+func deriveKey(secret, purpose string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("remark42-pii-" + purpose))
+	return mac.Sum(nil)
+}
+
+// EmailToken returns value identifying the email address in notification tokens, such as unsubscribe
+// links. It is the salted hash of the address with PII minimization enabled and the address itself otherwise.
+func (s *DataStore) EmailToken(email string) string {
+	if s.PII == nil || email == "" {
+		return email
+	}
+	return s.PII.Hash(email)
+}
+
+// storedEmail returns email value to persist, sealed with PII minimization enabled and encrypted with
+// encryption enabled. Accepts both plain and stored values.
+func (s *DataStore) storedEmail(val string) (string, error) {
+	email, err := s.readEmail(val)
+	if err != nil {
+		return "", err
+	}
+	if s.PII != nil {
+		if email, err = s.PII.Seal(email); err != nil {
+			return "", err
+		}
+	}
+	return s.storedDetail(email)
+}
+
+// readEmail returns email address from the stored value
+func (s *DataStore) readEmail(val string) (string, error) {
+	email, err := s.readDetail(val)
+	if err != nil || s.PII == nil {
+		return email, err
+	}
+	return s.PII.Open(email)
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+func TestPIIVault(t *testing.T) {
+	_, err := NewPIIVault("")
+	require.Error(t, err)
+
+	v, err := NewPIIVault("secret")
+	require.NoError(t, err)
+
+	assert.Equal(t, v.Hash("user@example.com"), v.Hash(" User@Example.com "), "hash normalized")
+	assert.NotEqual(t, v.Hash("user@example.com"), v.Hash("other@example.com"))
+	other, err := NewPIIVault("other-secret")
+	require.NoError(t, err)
+	assert.NotEqual(t, v.Hash("user@example.com"), other.Hash("user@example.com"), "hash salted with secret")
+
+	sealed, err := v.Seal("user@example.com")
+	require.NoError(t, err)
+	assert.True(t, IsSealed(sealed))
+	assert.NotContains(t, sealed, "user@example.com")
+	assert.True(t, strings.HasPrefix(sealed, "pii:"+v.Hash("user@example.com")+":"), sealed)
+	sealed2, err := v.Seal("user@example.com")
+	require.NoError(t, err)
+	assert.NotEqual(t, sealed, sealed2, "random nonce")
+
+	resealed, err := v.Seal(sealed)
+	require.NoError(t, err)
+	assert.Equal(t, sealed, resealed, "sealed value kept")
+	empty, err := v.Seal("")
+	require.NoError(t, err)
+	assert.Empty(t, empty)
+
+	email, err := v.Open(sealed)
+	require.NoError(t, err)
+	assert.Equal(t, "user@example.com", email)
+	email, err = v.Open("plain@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "plain@example.com", email, "plain value returned as is")
+
+	_, err = other.Open(sealed)
+	require.Error(t, err, "wrong key")
+	_, err = v.Open("pii:abc")
+	require.Error(t, err)
+	_, err = v.Open("pii:abc:!!!")
+	require.Error(t, err)
+	_, err = v.Open("pii:abc:AAAA")
+	require.Error(t, err)
+}
+
+func TestService_EmailPII(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+	defer b.Close()
+
+	// email stored before pii minimization enabled
+	_, err := b.SetUserEmail("radio-t", "user1", "old@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "old@example.com", b.EmailToken("old@example.com"))
+
+	b.PII, err = NewPIIVault("secret")
+	require.NoError(t, err)
+
+	email, err := b.SetUserEmail("radio-t", "user2", "new@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "new@example.com", email)
+	stored, err := eng.UserDetail(engine.UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "user2", Detail: engine.UserEmail})
+	require.NoError(t, err)
+	require.Len(t, stored, 1)
+	assert.True(t, IsSealed(stored[0].Email), stored[0].Email)
+
+	email, err = b.GetUserEmail("radio-t", "user2")
+	require.NoError(t, err)
+	assert.Equal(t, "new@example.com", email)
+	email, err = b.GetUserEmail("radio-t", "user1")
+	require.NoError(t, err)
+	assert.Equal(t, "old@example.com", email, "plain email still readable")
+	assert.Equal(t, b.PII.Hash("new@example.com"), b.EmailToken("new@example.com"))
+
+	// export never has plain emails
+	umetas, _, err := b.Metas("radio-t")
+	require.NoError(t, err)
+	require.Len(t, umetas, 2)
+	for _, um := range umetas {
+		assert.True(t, IsSealed(um.Details.Email), um.Details.Email)
+	}
+
+	// import seals plain emails and keeps sealed ones
+	umetas = append(umetas, UserMetaData{ID: "user3", Details: engine.UserDetailEntry{Email: "imported@example.com"}})
+	require.NoError(t, b.SetMetas("radio-t", umetas, nil))
+	for user, expected := range map[string]string{"user1": "old@example.com", "user2": "new@example.com", "user3": "imported@example.com"} {
+		stored, err = eng.UserDetail(engine.UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: user, Detail: engine.UserEmail})
+		require.NoError(t, err)
+		require.Len(t, stored, 1)
+		assert.True(t, IsSealed(stored[0].Email), stored[0].Email)
+		email, err = b.GetUserEmail("radio-t", user)
+		require.NoError(t, err)
+		assert.Equal(t, expected, email)
+	}
+}
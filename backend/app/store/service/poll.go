@@ -0,0 +1,63 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/poll"
+)
+
+var errPollsDisabled = errors.New("polls disabled")
+
+// PollResults returns results of the post's poll for the user, nil if post has no poll
+func (s *DataStore) PollResults(locator store.Locator, user store.User) (*poll.Results, error) {
+	if s.PollStore == nil {
+		return nil, nil
+	}
+	p, err := s.PollStore.Get(locator)
+	if errors.Is(err, poll.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	res := p.Results(user.ID, time.Now())
+	return &res, nil
+}
+
+// SetPoll attaches poll to the post, replaces existing poll and drops its votes
+func (s *DataStore) SetPoll(p poll.Poll) (poll.Results, error) {
+	if s.PollStore == nil {
+		return poll.Results{}, errPollsDisabled
+	}
+	if err := p.Validate(); err != nil {
+		return poll.Results{}, err
+	}
+	p.Created, p.Votes = time.Now(), nil
+	if err := s.PollStore.Set(p); err != nil {
+		return poll.Results{}, err
+	}
+	return p.Results("", p.Created), nil
+}
+
+// DeletePoll removes poll from the post
+func (s *DataStore) DeletePoll(locator store.Locator) error {
+	if s.PollStore == nil {
+		return errPollsDisabled
+	}
+	return s.PollStore.Delete(locator)
+}
+
+// VotePoll sets user's vote in the post's poll, changes previous vote of the user if any
+func (s *DataStore) VotePoll(locator store.Locator, user store.User, option int) (poll.Results, error) {
+	if s.PollStore == nil {
+		return poll.Results{}, errPollsDisabled
+	}
+	ts := time.Now()
+	p, err := s.PollStore.Vote(locator, user.ID, option, ts)
+	if err != nil {
+		return poll.Results{}, err
+	}
+	return p.Results(user.ID, ts), nil
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/poll"
+)
+
+func TestService_Polls(t *testing.T) {
+	b := DataStore{}
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	res, err := b.PollResults(locator, store.User{})
+	require.NoError(t, err)
+	assert.Nil(t, res, "polls disabled")
+	_, err = b.SetPoll(poll.Poll{Locator: locator, Question: "q?", Options: []string{"a", "b"}})
+	assert.EqualError(t, err, "polls disabled")
+	_, err = b.VotePoll(locator, store.User{ID: "user1"}, 0)
+	assert.EqualError(t, err, "polls disabled")
+	assert.EqualError(t, b.DeletePoll(locator), "polls disabled")
+
+	loc, err := os.MkdirTemp("", "test_poll_r42")
+	require.NoError(t, err)
+	defer os.RemoveAll(loc)
+	b.PollStore, err = poll.NewBoltStorage(path.Join(loc, "polls.db"), bolt.Options{})
+	require.NoError(t, err)
+	defer b.PollStore.Close()
+
+	res, err = b.PollResults(locator, store.User{})
+	require.NoError(t, err)
+	assert.Nil(t, res, "no poll for the post")
+
+	_, err = b.SetPoll(poll.Poll{Locator: locator, Question: "q?", Options: []string{"a"}})
+	assert.Error(t, err, "invalid poll")
+
+	created, err := b.SetPoll(poll.Poll{Locator: locator, Question: "q?", Options: []string{"a", "b"},
+		CloseAt: time.Now().Add(time.Hour), Votes: map[string]int{"fake": 1}})
+	require.NoError(t, err)
+	assert.Equal(t, 0, created.Total, "votes can't be set")
+
+	voted, err := b.VotePoll(locator, store.User{ID: "user1"}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, voted.Voted)
+	_, err = b.VotePoll(locator, store.User{ID: "user2"}, 1)
+	require.NoError(t, err)
+
+	res, err = b.PollResults(locator, store.User{ID: "user1"})
+	require.NoError(t, err)
+	require.NotNil(t, res)
+	assert.Equal(t, []poll.Option{{Text: "a"}, {Text: "b", Votes: 2}}, res.Options)
+	assert.Equal(t, 2, res.Total)
+	assert.Equal(t, 1, res.Voted)
+	assert.False(t, res.Closed)
+
+	require.NoError(t, b.DeletePoll(locator))
+	res, err = b.PollResults(locator, store.User{})
+	require.NoError(t, err)
+	assert.Nil(t, res)
+}
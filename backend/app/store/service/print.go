@@ -0,0 +1,62 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/umputun/remark42/backend/app/store"
+)
+
+// filters of printable thread
+const (
+	PrintAll         = ""            // all comments
+	PrintTop         = "top"         // top-level comments only
+	PrintHighlighted = "highlighted" // comments highlighted by admins only
+)
+
+// PrintThread renders public comments of the post to a printable html page, the same as archived one.
+// Comments are shown as anonymous reader sees them, optionally filtered to top-level or highlighted ones.
+func (s *DataStore) PrintThread(locator store.Locator, filter string) ([]byte, error) {
+	var highlighted map[string]bool
+	switch filter {
+	case PrintAll, PrintTop:
+	case PrintHighlighted:
+		if s.HighlightStore == nil {
+			return nil, errHighlightsDisabled
+		}
+		highlights, err := s.HighlightStore.List(locator.SiteID, locator.URL, 0)
+		if err != nil {
+			return nil, fmt.Errorf("can't get highlights of %s: %w", locator.URL, err)
+		}
+		highlighted = make(map[string]bool, len(highlights))
+		for _, h := range highlights {
+			highlighted[h.CommentID] = true
+		}
+	default:
+		return nil, fmt.Errorf("invalid filter %q", filter)
+	}
+
+	comments, err := s.FindSince(locator, "time", store.User{}, time.Time{})
+	if err != nil {
+		return nil, fmt.Errorf("can't get comments of %s: %w", locator.URL, err)
+	}
+	res := make([]store.Comment, 0, len(comments))
+	for _, c := range comments {
+		switch {
+		case filter == PrintTop && c.ParentID != "":
+			continue
+		case filter == PrintHighlighted && (c.Deleted || !highlighted[c.ID]):
+			continue
+		}
+		res = append(res, c)
+	}
+
+	note := "printed " + time.Now().UTC().Format("Jan 2, 2006")
+	switch filter {
+	case PrintTop:
+		note += ", top-level comments only"
+	case PrintHighlighted:
+		note += ", highlighted comments only"
+	}
+	return renderArchive(locator, res, note)
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/highlight"
+)
+
+func TestService_PrintThread(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+	locator := store.Locator{SiteID: "radio-t", URL: "https://radio-t.com"}
+
+	_, err := b.Create(store.Comment{ID: "id-3", ParentID: "id-1", Text: "reply text", Locator: locator,
+		User: store.User{ID: "user2", Name: "user2"}})
+	require.NoError(t, err)
+	_, err = b.Create(store.Comment{ID: "id-4", Text: "staff note", Locator: locator, Visibility: store.VisibilityStaff,
+		User: store.User{ID: "user1", Name: "user1"}})
+	require.NoError(t, err)
+
+	page, err := b.PrintThread(locator, PrintAll)
+	require.NoError(t, err)
+	assert.Contains(t, string(page), "3 comments on radio-t, printed")
+	assert.Contains(t, string(page), "reply text")
+	assert.Contains(t, string(page), "some text2")
+	assert.NotContains(t, string(page), "staff note", "only public comments")
+	assert.Contains(t, string(page), "@media print")
+
+	page, err = b.PrintThread(locator, PrintTop)
+	require.NoError(t, err)
+	assert.Contains(t, string(page), "2 comments on radio-t, printed")
+	assert.Contains(t, string(page), "top-level comments only")
+	assert.NotContains(t, string(page), "reply text")
+
+	_, err = b.PrintThread(locator, PrintHighlighted)
+	require.EqualError(t, err, "highlights disabled")
+	_, err = b.PrintThread(locator, "best")
+	require.EqualError(t, err, `invalid filter "best"`)
+
+	b.HighlightStore, err = highlight.NewBoltStorage(path.Join(t.TempDir(), "highlights.db"), bolt.Options{})
+	require.NoError(t, err)
+	defer b.HighlightStore.Close()
+	require.NoError(t, b.SetHighlight(locator, "id-3", true, ""))
+	page, err = b.PrintThread(locator, PrintHighlighted)
+	require.NoError(t, err)
+	assert.Contains(t, string(page), "1 comments on radio-t, printed")
+	assert.Contains(t, string(page), "highlighted comments only")
+	assert.Contains(t, string(page), `<div class="comment" id="id-3" style="margin-left: 0em">`, "parent not shown")
+	assert.NotContains(t, string(page), "some text2")
+}
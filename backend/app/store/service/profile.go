@@ -0,0 +1,187 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+const (
+	defaultDisplayNameMaxLen = 64
+	pronounsMaxLen           = 32
+)
+
+// ProfilePolicy defines what users allowed to change in their profile on the site
+type ProfilePolicy struct {
+	Enabled       bool     // allow users to set display name and pronouns
+	UniqueNames   bool     // reject display name used by another user of the site
+	MaxNameLength int      // max display name length in runes, default is 64
+	BannedNames   []string // banned display names, wildcards supported the same way as for restricted words
+}
+
+// ProfilePolicyLister provides profile policy per site
+type ProfilePolicyLister interface {
+	Policy(siteID string) (ProfilePolicy, error)
+}
+
+// StaticProfilePolicyLister provides same profile policy for every site
+type StaticProfilePolicyLister struct {
+	ProfilePolicy
+}
+
+// Policy returns profile policy (ignores siteID)
+func (l StaticProfilePolicyLister) Policy(_ string) (ProfilePolicy, error) {
+	return l.ProfilePolicy, nil
+}
+
+// UserProfile contains user-selected overrides of provider-supplied user info
+type UserProfile struct {
+	DisplayName string `json:"display_name"`
+	Pronouns    string `json:"pronouns"`
+}
+
+// profile errors, returned by SetUserProfile
+var (
+	ErrProfileDisabled     = errors.New("profile changes disabled")
+	ErrDisplayNameInvalid  = errors.New("invalid display name")
+	ErrDisplayNameBanned   = errors.New("display name is not allowed")
+	ErrDisplayNameTaken    = errors.New("display name is already taken")
+	ErrPronounsInvalid     = errors.New("invalid pronouns")
+	errProfilePolicyNotSet = errors.New("profile policy not set")
+)
+
+// GetUserProfile gets user-selected display name and pronouns
+func (s *DataStore) GetUserProfile(siteID, userID string) (UserProfile, error) {
+	res := UserProfile{}
+	for _, detail := range []engine.UserDetail{engine.UserDisplayName, engine.UserPronouns} {
+		entries, err := s.Engine.UserDetail(engine.UserDetailRequest{
+			Detail:  detail,
+			Locator: store.Locator{SiteID: siteID},
+			UserID:  userID,
+		})
+		if err != nil {
+			return UserProfile{}, err
+		}
+		if len(entries) != 1 {
+			continue
+		}
+		switch detail {
+		case engine.UserDisplayName:
+			res.DisplayName = entries[0].DisplayName
+		case engine.UserPronouns:
+			res.Pronouns = entries[0].Pronouns
+		}
+	}
+	return res, nil
+}
+
+// SetUserProfile validates profile against site's policy and stores it. Empty values remove
+// the corresponding override, i.e. user gets the provider-supplied name back.
+func (s *DataStore) SetUserProfile(siteID, userID string, profile UserProfile) (UserProfile, error) {
+	policy, err := s.profilePolicy(siteID)
+	if err != nil {
+		return UserProfile{}, err
+	}
+	if !policy.Enabled {
+		return UserProfile{}, ErrProfileDisabled
+	}
+
+	profile.DisplayName = strings.Join(strings.Fields(profile.DisplayName), " ")
+	profile.Pronouns = strings.TrimSpace(profile.Pronouns)
+
+	maxLen := policy.MaxNameLength
+	if maxLen <= 0 {
+		maxLen = defaultDisplayNameMaxLen
+	}
+	if utf8.RuneCountInString(profile.DisplayName) > maxLen || !validProfileValue(profile.DisplayName) {
+		return UserProfile{}, ErrDisplayNameInvalid
+	}
+	if utf8.RuneCountInString(profile.Pronouns) > pronounsMaxLen || !validProfileValue(profile.Pronouns) {
+		return UserProfile{}, ErrPronounsInvalid
+	}
+
+	if profile.DisplayName != "" {
+		banned := NewRestrictedWordsMatcher(StaticRestrictedWordsLister{Words: policy.BannedNames})
+		if banned.Match(siteID, profile.DisplayName) {
+			return UserProfile{}, ErrDisplayNameBanned
+		}
+		if policy.UniqueNames {
+			taken, e := s.displayNameTaken(siteID, userID, profile.DisplayName)
+			if e != nil {
+				return UserProfile{}, e
+			}
+			if taken {
+				return UserProfile{}, ErrDisplayNameTaken
+			}
+		}
+	}
+
+	if err = s.setProfileDetail(siteID, userID, engine.UserDisplayName, profile.DisplayName); err != nil {
+		return UserProfile{}, err
+	}
+	if err = s.setProfileDetail(siteID, userID, engine.UserPronouns, profile.Pronouns); err != nil {
+		return UserProfile{}, err
+	}
+	return profile, nil
+}
+
+// ResetUserProfile removes user-selected display name and pronouns, used by moderators
+func (s *DataStore) ResetUserProfile(siteID, userID string) error {
+	if err := s.DeleteUserDetail(siteID, userID, engine.UserDisplayName); err != nil {
+		return fmt.Errorf("can't reset display name for %s: %w", userID, err)
+	}
+	if err := s.DeleteUserDetail(siteID, userID, engine.UserPronouns); err != nil {
+		return fmt.Errorf("can't reset pronouns for %s: %w", userID, err)
+	}
+	return nil
+}
+
+func (s *DataStore) profilePolicy(siteID string) (ProfilePolicy, error) {
+	if s.ProfilePolicy == nil {
+		return ProfilePolicy{}, errProfilePolicyNotSet
+	}
+	return s.ProfilePolicy.Policy(siteID)
+}
+
+// setProfileDetail sets user detail or deletes it for empty value, as empty update means read for engine
+func (s *DataStore) setProfileDetail(siteID, userID string, detail engine.UserDetail, value string) error {
+	if value == "" {
+		return s.DeleteUserDetail(siteID, userID, detail)
+	}
+	_, err := s.Engine.UserDetail(engine.UserDetailRequest{
+		Detail:  detail,
+		Locator: store.Locator{SiteID: siteID},
+		UserID:  userID,
+		Update:  value,
+	})
+	return err
+}
+
+// displayNameTaken checks if any other user of the site uses the same display name, case-insensitive
+func (s *DataStore) displayNameTaken(siteID, userID, name string) (bool, error) {
+	entries, err := s.Engine.UserDetail(engine.UserDetailRequest{Detail: engine.AllUserDetails, Locator: store.Locator{SiteID: siteID}})
+	if err != nil {
+		return false, fmt.Errorf("can't list user details for %s: %w", siteID, err)
+	}
+	for _, e := range entries {
+		if e.UserID != userID && strings.EqualFold(e.DisplayName, name) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// validProfileValue rejects control characters and html markup in profile values
+func validProfileValue(v string) bool {
+	for _, r := range v {
+		if unicode.IsControl(r) || r == '<' || r == '>' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+func TestService_UserProfile(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticStore("secret", nil, nil, ""),
+		ProfilePolicy: StaticProfilePolicyLister{ProfilePolicy{Enabled: true, UniqueNames: true, BannedNames: []string{"admin*"}}}}
+
+	profile, err := b.GetUserProfile("radio-t", "user1")
+	require.NoError(t, err)
+	assert.Equal(t, UserProfile{}, profile)
+
+	profile, err = b.SetUserProfile("radio-t", "user1", UserProfile{DisplayName: "  Nick   Name ", Pronouns: " they/them "})
+	require.NoError(t, err)
+	assert.Equal(t, UserProfile{DisplayName: "Nick Name", Pronouns: "they/them"}, profile)
+
+	profile, err = b.GetUserProfile("radio-t", "user1")
+	require.NoError(t, err)
+	assert.Equal(t, UserProfile{DisplayName: "Nick Name", Pronouns: "they/them"}, profile)
+
+	// display name and pronouns applied to comments
+	comments, err := b.Find(store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}, "time", store.User{})
+	require.NoError(t, err)
+	require.Len(t, comments, 2)
+	assert.Equal(t, "Nick Name", comments[0].User.Name)
+	assert.Equal(t, "they/them", comments[0].User.Pronouns)
+
+	// same user can keep own name
+	_, err = b.SetUserProfile("radio-t", "user1", UserProfile{DisplayName: "nick name"})
+	require.NoError(t, err)
+	profile, err = b.GetUserProfile("radio-t", "user1")
+	require.NoError(t, err)
+	assert.Equal(t, UserProfile{DisplayName: "nick name"}, profile, "pronouns removed")
+
+	_, err = b.SetUserProfile("radio-t", "user2", UserProfile{DisplayName: "NICK NAME"})
+	assert.ErrorIs(t, err, ErrDisplayNameTaken)
+	_, err = b.SetUserProfile("radio-t", "user2", UserProfile{DisplayName: "the Administrator"})
+	assert.ErrorIs(t, err, ErrDisplayNameBanned)
+	_, err = b.SetUserProfile("radio-t", "user2", UserProfile{DisplayName: "<b>bold</b>"})
+	assert.ErrorIs(t, err, ErrDisplayNameInvalid)
+	_, err = b.SetUserProfile("radio-t", "user2", UserProfile{DisplayName: strings.Repeat("a", 65)})
+	assert.ErrorIs(t, err, ErrDisplayNameInvalid)
+	_, err = b.SetUserProfile("radio-t", "user2", UserProfile{DisplayName: "ok", Pronouns: "very long pronouns value exceeding the limit"})
+	assert.ErrorIs(t, err, ErrPronounsInvalid)
+	_, err = b.SetUserProfile("bad", "user2", UserProfile{DisplayName: "other"})
+	assert.EqualError(t, err, `can't list user details for bad: site "bad" not found`)
+
+	require.NoError(t, b.ResetUserProfile("radio-t", "user1"))
+	profile, err = b.GetUserProfile("radio-t", "user1")
+	require.NoError(t, err)
+	assert.Equal(t, UserProfile{}, profile)
+	comments, err = b.Find(store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}, "time", store.User{})
+	require.NoError(t, err)
+	assert.Equal(t, "user name", comments[0].User.Name)
+	assert.Empty(t, comments[0].User.Pronouns)
+}
+
+func TestService_UserProfileDisabled(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticStore("secret", nil, nil, "")}
+	_, err := b.SetUserProfile("radio-t", "user1", UserProfile{DisplayName: "name"})
+	assert.EqualError(t, err, "profile policy not set")
+
+	b.ProfilePolicy = StaticProfilePolicyLister{ProfilePolicy{Enabled: false}}
+	_, err = b.SetUserProfile("radio-t", "user1", UserProfile{DisplayName: "name"})
+	assert.ErrorIs(t, err, ErrProfileDisabled)
+
+	// profile set while enabled is not applied to comments after disabling
+	require.NoError(t, b.setProfileDetail("radio-t", "user1", engine.UserDisplayName, "Nick Name"))
+	comments, err := b.Find(store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}, "time", store.User{})
+	require.NoError(t, err)
+	require.Len(t, comments, 2)
+	assert.Equal(t, "user name", comments[0].User.Name)
+}
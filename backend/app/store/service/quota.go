@@ -0,0 +1,366 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/engine"
+	"github.com/umputun/remark42/backend/app/store/quota"
+)
+
+// ErrQuotaExceeded returned when the site's usage is over its quota and the quota enforced
+var ErrQuotaExceeded = errors.New("site quota exceeded")
+
+var errQuotaDisabled = errors.New("quotas disabled")
+
+// Quota enforcement modes
+const (
+	QuotaWarn     = "warn"     // usage over quota is allowed, only alerted
+	QuotaThrottle = "throttle" // usage over quota is allowed once per throttle interval
+	QuotaBlock    = "block"    // usage over quota is rejected
+)
+
+// QuotaParams defines default limits and enforcement of the sites quotas
+type QuotaParams struct {
+	Limits     quota.Limits  // limits of sites without own ones
+	Mode       string        // enforcement mode, warn if not set
+	Throttle   time.Duration // interval between allowed actions over quota in throttle mode, 1m if not set
+	Thresholds []int         // percents of limit to alert at, 100 if not set
+	Webhook    string        // url alerts posted to, alerts only logged if not set
+	Client     *http.Client
+}
+
+// QuotaAlert is posted to the webhook once a period when the site's usage reaches the threshold of the limit
+type QuotaAlert struct {
+	SiteID    string    `json:"site"`
+	Period    string    `json:"period"`
+	Resource  string    `json:"resource"`  // comments, notifications or storage
+	Threshold int       `json:"threshold"` // percent of the limit
+	Used      int64     `json:"used"`
+	Limit     int64     `json:"limit"`
+	Mode      string    `json:"mode"`
+	Timestamp time.Time `json:"time"`
+}
+
+// QuotaInfo is the site's quota with the current usage
+type QuotaInfo struct {
+	Mode   string       `json:"mode"`
+	Own    bool         `json:"own"` // limits set for the site, not the default ones
+	Limits quota.Limits `json:"limits"`
+	Usage  quota.Usage  `json:"usage"`
+}
+
+// Quotas tracks usage of the sites, enforces their limits and alerts at thresholds. Thread safe.
+type Quotas struct {
+	QuotaParams
+	store quota.Store
+	now   func() time.Time
+
+	mu        sync.Mutex
+	throttled map[string]time.Time // site and resource -> last action allowed over quota
+}
+
+// NewQuotas makes Quotas with usage kept in the store
+func NewQuotas(qs quota.Store, params QuotaParams) *Quotas {
+	res := &Quotas{QuotaParams: params, store: qs, now: time.Now, throttled: map[string]time.Time{}}
+	if res.Mode == "" {
+		res.Mode = QuotaWarn
+	}
+	if res.Throttle <= 0 {
+		res.Throttle = time.Minute
+	}
+	if len(res.Thresholds) == 0 {
+		res.Thresholds = []int{100}
+	}
+	res.Thresholds = slices.Clone(res.Thresholds)
+	slices.Sort(res.Thresholds)
+	if res.Client == nil {
+		res.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return res
+}
+
+// Limits returns own limits of the site or the default ones
+func (q *Quotas) Limits(siteID string) (limits quota.Limits, own bool, err error) {
+	limits, own, err = q.store.Limits(siteID)
+	if err != nil {
+		return quota.Limits{}, false, fmt.Errorf("failed to get limits of %s: %w", siteID, err)
+	}
+	if !own {
+		return q.QuotaParams.Limits, false, nil
+	}
+	return limits, true, nil
+}
+
+// Info returns the site's quota with usage in the current period
+func (q *Quotas) Info(siteID string) (QuotaInfo, error) {
+	limits, own, err := q.Limits(siteID)
+	if err != nil {
+		return QuotaInfo{}, err
+	}
+	usage, err := q.store.Usage(siteID, q.period())
+	if err != nil {
+		return QuotaInfo{}, fmt.Errorf("failed to get usage of %s: %w", siteID, err)
+	}
+	return QuotaInfo{Mode: q.Mode, Own: own, Limits: limits, Usage: usage}, nil
+}
+
+// Allow checks if usage of the site's resources by delta is within the limits, or allowed over them by the mode
+func (q *Quotas) Allow(siteID string, delta quota.Usage) error {
+	info, err := q.Info(siteID)
+	if err != nil {
+		return err
+	}
+	for _, resource := range []string{quota.Comments, quota.Notifications, quota.Storage} {
+		limit, add := info.Limits.Get(resource), delta.Get(resource)
+		if limit <= 0 || add <= 0 || info.Usage.Get(resource)+add <= limit {
+			continue
+		}
+		if err := q.enforce(siteID, resource); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Record adds delta to the site's usage and alerts at thresholds reached by it
+func (q *Quotas) Record(siteID string, delta quota.Usage) error {
+	period := q.period()
+	usage, err := q.store.Add(siteID, period, delta)
+	if err != nil {
+		return fmt.Errorf("failed to record usage of %s: %w", siteID, err)
+	}
+	limits, _, err := q.Limits(siteID)
+	if err != nil {
+		return err
+	}
+	for _, resource := range []string{quota.Comments, quota.Notifications, quota.Storage} {
+		limit, used := limits.Get(resource), usage.Get(resource)
+		if limit <= 0 || delta.Get(resource) <= 0 {
+			continue
+		}
+		threshold := 0
+		for _, t := range q.Thresholds {
+			if used*100 >= limit*int64(t) {
+				threshold = t
+			}
+		}
+		if threshold == 0 || usage.Alerted[resource] >= threshold {
+			continue
+		}
+		updated, err := q.store.SetAlerted(siteID, period, resource, threshold)
+		if err != nil {
+			return fmt.Errorf("failed to mark alert of %s: %w", siteID, err)
+		}
+		if updated {
+			q.alert(QuotaAlert{SiteID: siteID, Period: period, Resource: resource, Threshold: threshold,
+				Used: used, Limit: limit, Mode: q.Mode, Timestamp: q.now()})
+		}
+	}
+	return nil
+}
+
+// SetLimits sets own limits of the site
+func (q *Quotas) SetLimits(siteID string, limits quota.Limits) error {
+	if limits.Comments < 0 || limits.Notifications < 0 || limits.Storage < 0 {
+		return errors.New("negative limit")
+	}
+	return q.store.SetLimits(siteID, limits)
+}
+
+// ResetLimits resets limits of the site to the default ones
+func (q *Quotas) ResetLimits(siteID string) error {
+	return q.store.ResetLimits(siteID)
+}
+
+// Close quota store
+func (q *Quotas) Close() error {
+	return q.store.Close()
+}
+
+// enforce decides on the resource's usage over quota by the mode
+func (q *Quotas) enforce(siteID, resource string) error {
+	switch q.Mode {
+	case QuotaBlock:
+		return ErrQuotaExceeded
+	case QuotaThrottle:
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		key := siteID + "/" + resource
+		if last, ok := q.throttled[key]; ok && q.now().Sub(last) < q.Throttle {
+			return ErrQuotaExceeded
+		}
+		q.throttled[key] = q.now()
+	}
+	log.Printf("[WARN] %s of site %s over quota, allowed by %s mode", resource, siteID, q.Mode)
+	return nil
+}
+
+// alert logs the alert and posts it to the webhook in background
+func (q *Quotas) alert(a QuotaAlert) {
+	log.Printf("[WARN] site %s reached %d%% of %s quota, %d of %d", a.SiteID, a.Threshold, a.Resource, a.Used, a.Limit)
+	if q.Webhook == "" {
+		return
+	}
+	go func() {
+		if err := q.post(a); err != nil {
+			log.Printf("[WARN] failed to send quota alert of %s to webhook, %v", a.SiteID, err)
+		}
+	}()
+}
+
+func (q *Quotas) post(a QuotaAlert) error {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return fmt.Errorf("failed to marshal alert: %w", err)
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, q.Webhook, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to make request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := q.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post: %w", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // read-only body
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// period returns the current period, month in UTC
+func (q *Quotas) period() string {
+	return q.now().UTC().Format("2006-01")
+}
+
+// SiteQuota returns the site's quota with the current usage
+func (s *DataStore) SiteQuota(siteID string) (QuotaInfo, error) {
+	if s.Quotas == nil {
+		return QuotaInfo{}, errQuotaDisabled
+	}
+	return s.Quotas.Info(siteID)
+}
+
+// SetQuotaLimits sets own limits of the site
+func (s *DataStore) SetQuotaLimits(siteID string, limits quota.Limits) error {
+	if s.Quotas == nil {
+		return errQuotaDisabled
+	}
+	return s.Quotas.SetLimits(siteID, limits)
+}
+
+// ResetQuotaLimits resets limits of the site to the default ones
+func (s *DataStore) ResetQuotaLimits(siteID string) error {
+	if s.Quotas == nil {
+		return errQuotaDisabled
+	}
+	return s.Quotas.ResetLimits(siteID)
+}
+
+// UseNotifyQuota checks quota of notification sends for the site and counts the send, called by notifier
+// for each send. Returns false if the send is over quota and rejected by the mode. Failures are logged and allow the send.
+func (s *DataStore) UseNotifyQuota(siteID string) bool {
+	if s.Quotas == nil {
+		return true
+	}
+	delta := quota.Usage{Notifications: 1}
+	if err := s.Quotas.Allow(siteID, delta); err != nil {
+		if errors.Is(err, ErrQuotaExceeded) {
+			log.Printf("[WARN] notification of site %s not sent, %v", siteID, err)
+			return false
+		}
+		log.Printf("[WARN] failed to check notification quota of %s, %v", siteID, err)
+	}
+	if err := s.Quotas.Record(siteID, delta); err != nil {
+		log.Printf("[WARN] %v", err)
+	}
+	return true
+}
+
+// checkCommentQuota checks quota of comments and storage for the new comment, imported comments are not limited.
+// Failures of the check are logged and allow the comment.
+func (s *DataStore) checkCommentQuota(c store.Comment) error {
+	if s.Quotas == nil || c.Imported {
+		return nil
+	}
+	err := s.Quotas.Allow(c.Locator.SiteID, commentUsage(c))
+	if err != nil && !errors.Is(err, ErrQuotaExceeded) {
+		log.Printf("[WARN] failed to check comment quota of %s, %v", c.Locator.SiteID, err)
+		return nil
+	}
+	return err
+}
+
+// recordCommentQuota counts the new comment and its text in the site's usage
+func (s *DataStore) recordCommentQuota(c store.Comment) {
+	if s.Quotas == nil || c.Imported {
+		return
+	}
+	if err := s.Quotas.Record(c.Locator.SiteID, commentUsage(c)); err != nil {
+		log.Printf("[WARN] %v", err)
+	}
+}
+
+// recordStorageQuota adds delta of comments text size, negative for removed or shortened text, to the site's storage usage
+func (s *DataStore) recordStorageQuota(siteID string, delta int64) {
+	if s.Quotas == nil || delta == 0 {
+		return
+	}
+	if err := s.Quotas.Record(siteID, quota.Usage{Storage: delta}); err != nil {
+		log.Printf("[WARN] %v", err)
+	}
+}
+
+// userStorage returns text size of the user's comments counted in the site's storage usage, imported ones excluded
+func (s *DataStore) userStorage(siteID, userID string) int64 {
+	if s.Quotas == nil {
+		return 0
+	}
+	const page = 500 // engine's limit of user's comments per request
+	res := int64(0)
+	for skip := 0; ; skip += page {
+		comments, err := s.Engine.Find(engine.FindRequest{Locator: store.Locator{SiteID: siteID}, UserID: userID,
+			Limit: page, Skip: skip})
+		if err != nil {
+			log.Printf("[DEBUG] no comments of %s counted in storage quota, %v", userID, err)
+			return res
+		}
+		for _, c := range comments {
+			if !c.Imported {
+				res += int64(len(c.Text))
+			}
+		}
+		if len(comments) < page {
+			return res
+		}
+	}
+}
+
+// releaseSiteQuota resets storage usage of the site with all comments removed
+func (s *DataStore) releaseSiteQuota(siteID string) {
+	if s.Quotas == nil {
+		return
+	}
+	info, err := s.Quotas.Info(siteID)
+	if err != nil {
+		log.Printf("[WARN] %v", err)
+		return
+	}
+	s.recordStorageQuota(siteID, -info.Usage.Storage)
+}
+
+func commentUsage(c store.Comment) quota.Usage {
+	return quota.Usage{Comments: 1, Storage: int64(len(c.Text))}
+}
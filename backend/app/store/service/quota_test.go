@@ -0,0 +1,222 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/quota"
+)
+
+func TestQuotas_Allow(t *testing.T) {
+	tbl := []struct {
+		mode string
+		errs []bool // results of consecutive comments over quota
+	}{
+		{QuotaWarn, []bool{false, false, false}},
+		{QuotaBlock, []bool{true, true, true}},
+		{QuotaThrottle, []bool{false, true, false}}, // third one after throttle interval
+	}
+	for _, tt := range tbl {
+		t.Run(tt.mode, func(t *testing.T) {
+			q := NewQuotas(prepQuotaStore(t), QuotaParams{Limits: quota.Limits{Comments: 2}, Mode: tt.mode})
+			ts := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+			q.now = func() time.Time { return ts }
+			for range 2 {
+				require.NoError(t, q.Allow("site1", quota.Usage{Comments: 1}))
+				require.NoError(t, q.Record("site1", quota.Usage{Comments: 1}))
+			}
+			for i, isErr := range tt.errs {
+				if i == 2 {
+					ts = ts.Add(time.Minute)
+				}
+				err := q.Allow("site1", quota.Usage{Comments: 1})
+				if isErr {
+					require.ErrorIs(t, err, ErrQuotaExceeded, "comment %d", i)
+					continue
+				}
+				require.NoError(t, err, "comment %d", i)
+			}
+			require.NoError(t, q.Allow("site2", quota.Usage{Comments: 1}), "other site")
+			require.NoError(t, q.Allow("site1", quota.Usage{Notifications: 1}), "other resource")
+		})
+	}
+}
+
+func TestQuotas_Limits(t *testing.T) {
+	q := NewQuotas(prepQuotaStore(t), QuotaParams{Limits: quota.Limits{Comments: 1}, Mode: QuotaBlock})
+	require.NoError(t, q.Record("site1", quota.Usage{Comments: 1, Storage: 10}))
+	require.ErrorIs(t, q.Allow("site1", quota.Usage{Comments: 1, Storage: 10}), ErrQuotaExceeded)
+
+	require.NoError(t, q.SetLimits("site1", quota.Limits{Comments: 10, Storage: 15}))
+	require.ErrorIs(t, q.Allow("site1", quota.Usage{Comments: 1, Storage: 10}), ErrQuotaExceeded, "storage limit")
+	require.NoError(t, q.Allow("site1", quota.Usage{Comments: 1, Storage: 5}))
+	info, err := q.Info("site1")
+	require.NoError(t, err)
+	assert.True(t, info.Own)
+	assert.Equal(t, QuotaBlock, info.Mode)
+	assert.Equal(t, quota.Limits{Comments: 10, Storage: 15}, info.Limits)
+	assert.Equal(t, int64(1), info.Usage.Comments)
+	assert.Equal(t, int64(10), info.Usage.Storage)
+
+	require.EqualError(t, q.SetLimits("site1", quota.Limits{Comments: -1}), "negative limit")
+	require.NoError(t, q.ResetLimits("site1"))
+	info, err = q.Info("site1")
+	require.NoError(t, err)
+	assert.False(t, info.Own)
+	assert.Equal(t, quota.Limits{Comments: 1}, info.Limits)
+}
+
+func TestQuotas_Alerts(t *testing.T) {
+	var mu sync.Mutex
+	alerts := []QuotaAlert{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		a := QuotaAlert{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&a))
+		mu.Lock()
+		alerts = append(alerts, a)
+		mu.Unlock()
+	}))
+	defer ts.Close()
+	getAlerts := func() []QuotaAlert {
+		mu.Lock()
+		defer mu.Unlock()
+		return alerts
+	}
+
+	q := NewQuotas(prepQuotaStore(t), QuotaParams{Limits: quota.Limits{Comments: 10, Notifications: 100},
+		Thresholds: []int{100, 50}, Webhook: ts.URL})
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	q.now = func() time.Time { return now }
+
+	for range 4 {
+		require.NoError(t, q.Record("site1", quota.Usage{Comments: 1}))
+	}
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, getAlerts(), "below thresholds")
+
+	require.NoError(t, q.Record("site1", quota.Usage{Comments: 1}))
+	require.Eventually(t, func() bool { return len(getAlerts()) == 1 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, QuotaAlert{SiteID: "site1", Period: "2026-10", Resource: quota.Comments, Threshold: 50, Used: 5,
+		Limit: 10, Mode: QuotaWarn, Timestamp: now}, getAlerts()[0])
+
+	for range 6 { // crosses 100%, alerted once
+		require.NoError(t, q.Record("site1", quota.Usage{Comments: 1}))
+	}
+	require.Eventually(t, func() bool { return len(getAlerts()) == 2 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 100, getAlerts()[1].Threshold)
+	assert.Equal(t, int64(10), getAlerts()[1].Used)
+
+	now = now.AddDate(0, 1, 0)
+	for range 5 {
+		require.NoError(t, q.Record("site1", quota.Usage{Comments: 1}))
+	}
+	require.Eventually(t, func() bool { return len(getAlerts()) == 3 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "2026-11", getAlerts()[2].Period, "alerted again in the new period")
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(t, getAlerts(), 3)
+}
+
+func TestService_Quota(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+
+	_, err := b.SiteQuota("radio-t")
+	require.EqualError(t, err, "quotas disabled")
+	require.EqualError(t, b.SetQuotaLimits("radio-t", quota.Limits{}), "quotas disabled")
+	require.EqualError(t, b.ResetQuotaLimits("radio-t"), "quotas disabled")
+	assert.True(t, b.UseNotifyQuota("radio-t"))
+
+	b.Quotas = NewQuotas(prepQuotaStore(t), QuotaParams{Limits: quota.Limits{Comments: 1, Notifications: 1},
+		Mode: QuotaBlock})
+	_, err = b.Create(store.Comment{Text: "text", Locator: locator, User: store.User{ID: "user1", Name: "user1"}})
+	require.NoError(t, err)
+	_, err = b.Create(store.Comment{Text: "over", Locator: locator, User: store.User{ID: "user1", Name: "user1"}})
+	require.ErrorIs(t, err, ErrQuotaExceeded)
+	_, err = b.Create(store.Comment{Text: "imported", Locator: locator, User: store.User{ID: "user1"}, Imported: true})
+	require.NoError(t, err, "imported comments not limited")
+
+	assert.True(t, b.UseNotifyQuota("radio-t"))
+	assert.False(t, b.UseNotifyQuota("radio-t"))
+
+	info, err := b.SiteQuota("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), info.Usage.Comments)
+	assert.Equal(t, int64(1), info.Usage.Notifications)
+	assert.Equal(t, int64(len("text")), info.Usage.Storage)
+
+	require.NoError(t, b.SetQuotaLimits("radio-t", quota.Limits{Comments: 5}))
+	_, err = b.Create(store.Comment{Text: "allowed", Locator: locator, User: store.User{ID: "user1", Name: "user1"}})
+	require.NoError(t, err)
+	require.NoError(t, b.ResetQuotaLimits("radio-t"))
+	info, err = b.SiteQuota("radio-t")
+	require.NoError(t, err)
+	assert.False(t, info.Own)
+	assert.Equal(t, int64(2), info.Usage.Comments)
+	require.NoError(t, b.Close())
+}
+
+func TestService_QuotaStorage(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123"), AdminEdits: true,
+		Quotas: NewQuotas(prepQuotaStore(t), QuotaParams{})}
+	defer b.Close()
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	storage := func() int64 {
+		info, err := b.SiteQuota("radio-t")
+		require.NoError(t, err)
+		return info.Usage.Storage
+	}
+
+	id1, err := b.Create(store.Comment{Text: "0123456789", Locator: locator, User: store.User{ID: "user1", Name: "user1"}})
+	require.NoError(t, err)
+	id2, err := b.Create(store.Comment{Text: "01234", Locator: locator, User: store.User{ID: "user1", Name: "user1"}})
+	require.NoError(t, err)
+	_, err = b.Create(store.Comment{Text: "012", Locator: locator, User: store.User{ID: "user2", Name: "user2"}})
+	require.NoError(t, err)
+	_, err = b.Create(store.Comment{Text: "imported", Locator: locator, User: store.User{ID: "user2"}, Imported: true})
+	require.NoError(t, err)
+	assert.Equal(t, int64(18), storage())
+
+	c, err := b.EditComment(locator, id1, EditRequest{Text: "01234567", Admin: true})
+	require.NoError(t, err)
+	require.Equal(t, "01234567", c.Text)
+	assert.Equal(t, int64(16), storage(), "edited text shorter by 2")
+
+	_, err = b.EditComment(locator, id2, EditRequest{Delete: true, Admin: true})
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), storage(), "deleted by author")
+	require.NoError(t, b.Delete(locator, id2, store.HardDelete))
+	assert.Equal(t, int64(11), storage(), "already deleted comment not counted")
+
+	require.NoError(t, b.DeleteUser("radio-t", "user2", store.SoftDelete))
+	assert.Equal(t, int64(8), storage(), "imported comment not counted")
+	require.NoError(t, b.Delete(locator, id1, store.SoftDelete))
+	assert.Equal(t, int64(0), storage())
+
+	_, err = b.Create(store.Comment{Text: "012", Locator: locator, User: store.User{ID: "user3", Name: "user3"}})
+	require.NoError(t, err)
+	require.NoError(t, b.DeleteAll("radio-t"))
+	assert.Equal(t, int64(0), storage())
+}
+
+func prepQuotaStore(t *testing.T) quota.Store {
+	qs, err := quota.NewBoltStorage(path.Join(t.TempDir(), "quota.db"), bolt.Options{})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = qs.Close() })
+	return qs
+}
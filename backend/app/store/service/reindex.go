@@ -0,0 +1,87 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+// ErrReindexRunning returned on attempt to start reindex for the site while the previous one is not finished
+var ErrReindexRunning = errors.New("reindex is already running")
+
+// ReindexStatus is the state of the site's derived indexes rebuild
+type ReindexStatus struct {
+	SiteID   string    `json:"site"`
+	Running  bool      `json:"running"`
+	Done     int       `json:"done"`  // processed posts
+	Total    int       `json:"total"` // all posts, set once the rebuild started
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished,omitzero"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// StartReindex rebuilds derived indexes of the site, last comments, user's comments and post counters,
+// in background. The onDone func, if set, called after successful rebuild, i.e. to flush caches.
+func (s *DataStore) StartReindex(siteID string, onDone func()) error {
+	reindexer, ok := s.Engine.(engine.Reindexer)
+	if !ok {
+		return errors.New("reindex is not supported by the store engine")
+	}
+	if _, err := s.Engine.Info(engine.InfoRequest{Locator: store.Locator{SiteID: siteID}, Limit: 1}); err != nil {
+		return fmt.Errorf("can't get posts for %s: %w", siteID, err)
+	}
+
+	s.reindexJobs.Lock()
+	defer s.reindexJobs.Unlock()
+	if s.reindexJobs.jobs == nil {
+		s.reindexJobs.jobs = map[string]*ReindexStatus{}
+	}
+	if job, ok := s.reindexJobs.jobs[siteID]; ok && job.Running {
+		return ErrReindexRunning
+	}
+	s.reindexJobs.jobs[siteID] = &ReindexStatus{SiteID: siteID, Running: true, Started: time.Now()}
+
+	go func() {
+		log.Printf("[INFO] reindex started for %s", siteID)
+		err := reindexer.Reindex(siteID, func(done, total int) {
+			s.reindexJobs.Lock()
+			s.reindexJobs.jobs[siteID].Done, s.reindexJobs.jobs[siteID].Total = done, total
+			s.reindexJobs.Unlock()
+		})
+
+		s.reindexJobs.Lock()
+		job := s.reindexJobs.jobs[siteID]
+		job.Running, job.Finished = false, time.Now()
+		if err != nil {
+			job.Error = err.Error()
+		}
+		total := job.Total
+		s.reindexJobs.Unlock()
+
+		if err != nil {
+			log.Printf("[WARN] reindex failed for %s, %v", siteID, err)
+			return
+		}
+		log.Printf("[INFO] reindex completed for %s, %d posts", siteID, total)
+		if onDone != nil {
+			onDone()
+		}
+	}()
+	return nil
+}
+
+// ReindexStatus returns the state of the last reindex of the site, false if reindex never started
+func (s *DataStore) ReindexStatus(siteID string) (ReindexStatus, bool) {
+	s.reindexJobs.Lock()
+	defer s.reindexJobs.Unlock()
+	job, ok := s.reindexJobs.jobs[siteID]
+	if !ok {
+		return ReindexStatus{}, false
+	}
+	return *job, true
+}
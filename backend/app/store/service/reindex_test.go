@@ -0,0 +1,86 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+// blockingReindexer reindexes once released
+type blockingReindexer struct {
+	engine.Interface
+	release chan struct{}
+	err     error
+}
+
+func (r *blockingReindexer) Reindex(_ string, progress func(done, total int)) error {
+	progress(1, 3)
+	<-r.release
+	return r.err
+}
+
+func TestService_Reindex(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+
+	_, ok := b.ReindexStatus("radio-t")
+	assert.False(t, ok, "never started")
+
+	done := make(chan struct{})
+	require.NoError(t, b.StartReindex("radio-t", func() { close(done) }))
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("reindex not completed")
+	}
+	status, ok := b.ReindexStatus("radio-t")
+	require.True(t, ok)
+	assert.False(t, status.Running)
+	assert.Equal(t, "radio-t", status.SiteID)
+	assert.Equal(t, 1, status.Done)
+	assert.Equal(t, 1, status.Total)
+	assert.Empty(t, status.Error)
+	assert.False(t, status.Finished.Before(status.Started))
+
+	comments, err := b.Last("radio-t", 10, time.Time{}, store.User{Admin: true})
+	require.NoError(t, err)
+	assert.Len(t, comments, 2, "indexes are in place")
+
+	assert.Error(t, b.StartReindex("bad", nil), "unknown site")
+}
+
+func TestService_ReindexRunning(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	reindexer := &blockingReindexer{Interface: eng, release: make(chan struct{}), err: errors.New("broken post")}
+	b := DataStore{Engine: reindexer, AdminStore: admin.NewStaticKeyStore("secret 123")}
+
+	require.NoError(t, b.StartReindex("radio-t", func() { t.Error("not expected to be called on error") }))
+	require.Eventually(t, func() bool {
+		status, _ := b.ReindexStatus("radio-t")
+		return status.Done == 1
+	}, time.Second, 10*time.Millisecond)
+	status, _ := b.ReindexStatus("radio-t")
+	assert.True(t, status.Running)
+	assert.Equal(t, 3, status.Total)
+	assert.ErrorIs(t, b.StartReindex("radio-t", nil), ErrReindexRunning)
+
+	close(reindexer.release)
+	require.Eventually(t, func() bool {
+		status, _ := b.ReindexStatus("radio-t")
+		return !status.Running
+	}, time.Second, 10*time.Millisecond)
+	status, _ = b.ReindexStatus("radio-t")
+	assert.Equal(t, "broken post", status.Error)
+
+	b.Engine = struct{ engine.Interface }{eng}
+	assert.EqualError(t, b.StartReindex("radio-t", nil), "reindex is not supported by the store engine")
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+// CommentRenderer renders comment's markdown to html, the same way as for new comments
+type CommentRenderer interface {
+	Render(ctx context.Context, c store.Comment) store.Comment // renders markdown of c.Text, sets Text, PlainText and RenderKey
+	RenderKey() string                                         // key of the current rendering
+}
+
+// ErrRerenderRunning returned on attempt to start re-rendering of the site while the previous one is not finished
+var ErrRerenderRunning = errors.New("rerender is already running")
+
+// RerenderStatus is the state of the site's comments re-rendering
+type RerenderStatus struct {
+	SiteID   string    `json:"site"`
+	Running  bool      `json:"running"`
+	Done     int       `json:"done"`             // processed posts
+	Total    int       `json:"total"`            // all posts, set once the re-rendering started
+	Updated  int       `json:"updated"`          // comments with changed html
+	Failed   int       `json:"failed,omitempty"` // comments failed to store
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished,omitzero"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// rerender renders the comment again from the original markdown if its html was made with another render key,
+// i.e. before upgrade of the formatter or change of the sanitizer policy, and stores the result, so each comment
+// is rendered once after the change. Comments without markdown, like imported ones, are kept as is.
+func (s *DataStore) rerender(c store.Comment) store.Comment {
+	if s.Renderer == nil || c.Orig == "" || c.Deleted || c.RenderKey == s.Renderer.RenderKey() {
+		return c
+	}
+	c = s.renderOrig(c)
+	if _, err := s.storeRendered(c, false); err != nil {
+		log.Printf("[WARN] can't store re-rendered comment %s, %v", c.ID, err)
+	}
+	return c
+}
+
+// StartRerender renders all comments of the site again from the original markdown with the current formatter in
+// background, regardless of render key, i.e. to fix comments rendered by the formatter with a bug. Comments without
+// markdown and deleted ones are kept as is. The onDone func, if set, called after re-rendering, i.e. to flush caches.
+func (s *DataStore) StartRerender(siteID string, onDone func()) error {
+	if s.Renderer == nil {
+		return errors.New("rendering is not set")
+	}
+	posts, err := s.Engine.Info(engine.InfoRequest{Locator: store.Locator{SiteID: siteID}})
+	if err != nil {
+		return fmt.Errorf("can't get posts for %s: %w", siteID, err)
+	}
+
+	s.rerenderJobs.Lock()
+	defer s.rerenderJobs.Unlock()
+	if s.rerenderJobs.jobs == nil {
+		s.rerenderJobs.jobs = map[string]*RerenderStatus{}
+	}
+	if job, ok := s.rerenderJobs.jobs[siteID]; ok && job.Running {
+		return ErrRerenderRunning
+	}
+	s.rerenderJobs.jobs[siteID] = &RerenderStatus{SiteID: siteID, Running: true, Total: len(posts), Started: time.Now()}
+
+	go func() {
+		log.Printf("[INFO] rerender started for %s, %d posts", siteID, len(posts))
+		var errs []error
+		for _, post := range posts {
+			updated, failed, err := s.rerenderPost(store.Locator{SiteID: siteID, URL: post.URL})
+			if err != nil {
+				errs = append(errs, err)
+			}
+			s.rerenderJobs.Lock()
+			job := s.rerenderJobs.jobs[siteID]
+			job.Done++
+			job.Updated += updated
+			job.Failed += failed
+			s.rerenderJobs.Unlock()
+		}
+
+		s.rerenderJobs.Lock()
+		job := s.rerenderJobs.jobs[siteID]
+		job.Running, job.Finished = false, time.Now()
+		if err := errors.Join(errs...); err != nil {
+			job.Error = err.Error()
+			log.Printf("[WARN] rerender of %s finished with errors, %v", siteID, err)
+		}
+		updated := job.Updated
+		s.rerenderJobs.Unlock()
+
+		log.Printf("[INFO] rerender completed for %s, %d comments updated", siteID, updated)
+		if onDone != nil {
+			onDone()
+		}
+	}()
+	return nil
+}
+
+// RerenderStatus returns the state of the last re-rendering of the site, false if re-rendering never started
+func (s *DataStore) RerenderStatus(siteID string) (RerenderStatus, bool) {
+	s.rerenderJobs.Lock()
+	defer s.rerenderJobs.Unlock()
+	job, ok := s.rerenderJobs.jobs[siteID]
+	if !ok {
+		return RerenderStatus{}, false
+	}
+	return *job, true
+}
+
+// rerenderPost renders all comments of the post again, returns number of updated comments and failed ones
+func (s *DataStore) rerenderPost(locator store.Locator) (updated, failed int, err error) {
+	comments, err := s.Engine.Find(engine.FindRequest{Locator: locator, Sort: "time"})
+	if err != nil {
+		return 0, 0, fmt.Errorf("can't get comments of %s: %w", locator.URL, err)
+	}
+	for _, c := range comments {
+		if c.Orig == "" || c.Deleted {
+			continue
+		}
+		ok, err := s.storeRendered(s.renderOrig(c), true)
+		if err != nil {
+			log.Printf("[WARN] can't store re-rendered comment %s, %v", c.ID, err)
+			failed++
+			continue
+		}
+		if ok {
+			updated++
+		}
+	}
+	return updated, failed, nil
+}
+
+// renderOrig renders the original markdown of the comment with the current formatter
+func (s *DataStore) renderOrig(c store.Comment) store.Comment {
+	rendered := c
+	rendered.Text = c.Orig
+	rendered = s.Renderer.Render(context.Background(), rendered)
+	rendered.Sanitize()
+	c.Text, c.PlainText, c.RenderKey = rendered.Text, store.PlainText(rendered.Text), s.Renderer.RenderKey()
+	return c
+}
+
+// storeRendered updates html of the stored comment with the rendered one. The stored comment is updated under
+// its lock, as it could be changed since it was loaded, i.e. voted, and kept if edited or, unless forced,
+// already rendered with the same key. Returns true if the comment updated.
+func (s *DataStore) storeRendered(c store.Comment, force bool) (bool, error) {
+	lock := s.getScopedLocks(c.ID)
+	lock.Lock()
+	defer lock.Unlock()
+	stored, err := s.Engine.Get(engine.GetRequest{Locator: c.Locator, CommentID: c.ID})
+	if err != nil {
+		return false, fmt.Errorf("can't load comment: %w", err)
+	}
+	if stored.Orig != c.Orig || (!force && stored.RenderKey == c.RenderKey) {
+		return false, nil
+	}
+	if stored.Text == c.Text && stored.PlainText == c.PlainText && stored.RenderKey == c.RenderKey {
+		return false, nil
+	}
+	stored.Text, stored.PlainText, stored.RenderKey = c.Text, c.PlainText, c.RenderKey
+	if err = s.Engine.Update(stored); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+)
+
+type mockRenderer struct {
+	key   string
+	calls int
+}
+
+func (m *mockRenderer) Render(_ context.Context, c store.Comment) store.Comment {
+	m.calls++
+	c.Text = "<p>" + strings.ToUpper(c.Text) + "</p>"
+	c.RenderKey = m.key
+	return c
+}
+
+func (m *mockRenderer) RenderKey() string { return m.key }
+
+func TestService_Rerender(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	renderer := &mockRenderer{key: "2-abc"}
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123"), Renderer: renderer}
+
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	_, err := eng.Create(store.Comment{ID: "id-3", Text: "<p>old</p>", Orig: "new text", RenderKey: "1-abc",
+		Locator: locator, Timestamp: time.Date(2017, 12, 20, 15, 18, 24, 0, time.UTC), User: store.User{ID: "user1", Name: "user name"}})
+	require.NoError(t, err)
+
+	c, err := b.Get(locator, "id-3", store.User{})
+	require.NoError(t, err)
+	assert.Equal(t, "<p>NEW TEXT</p>", c.Text)
+	assert.Equal(t, "NEW TEXT", c.PlainText)
+	assert.Equal(t, "2-abc", c.RenderKey)
+	assert.Equal(t, 1, renderer.calls)
+
+	stored, err := eng.Get(getReq(locator, "id-3"))
+	require.NoError(t, err)
+	assert.Equal(t, "<p>NEW TEXT</p>", stored.Text, "re-rendered text stored")
+	assert.Equal(t, "2-abc", stored.RenderKey)
+
+	_, err = b.Get(locator, "id-3", store.User{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, renderer.calls, "current rendering not rendered again")
+
+	c, err = b.Get(locator, "id-2", store.User{})
+	require.NoError(t, err)
+	assert.Equal(t, "some text2", c.Text, "comment without markdown kept as is")
+	assert.Equal(t, 1, renderer.calls)
+
+	b.Renderer = nil
+	renderer.key = "3-abc"
+	c, err = b.Get(locator, "id-3", store.User{})
+	require.NoError(t, err)
+	assert.Equal(t, "2-abc", c.RenderKey, "re-rendering disabled")
+}
+
+func TestService_StartRerender(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	renderer := &mockRenderer{key: "2-abc"}
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+	assert.Error(t, b.StartRerender("radio-t", nil), "no renderer")
+	b.Renderer = renderer
+
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	ts := time.Date(2017, 12, 20, 15, 18, 24, 0, time.UTC)
+	user := store.User{ID: "user1", Name: "user name"}
+	_, err := eng.Create(store.Comment{ID: "id-3", Text: "<p>buggy</p>", Orig: "new text", RenderKey: "2-abc",
+		Locator: locator, Timestamp: ts, User: user})
+	require.NoError(t, err)
+	_, err = eng.Create(store.Comment{ID: "id-4", Text: "<p>OTHER</p>", PlainText: "OTHER", Orig: "other", RenderKey: "2-abc",
+		Locator: locator, Timestamp: ts.Add(time.Second), User: user})
+	require.NoError(t, err)
+
+	_, ok := b.RerenderStatus("radio-t")
+	assert.False(t, ok, "never started")
+
+	done := make(chan struct{})
+	require.NoError(t, b.StartRerender("radio-t", func() { close(done) }))
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("rerender not completed")
+	}
+	status, ok := b.RerenderStatus("radio-t")
+	require.True(t, ok)
+	assert.False(t, status.Running)
+	assert.Equal(t, "radio-t", status.SiteID)
+	assert.Equal(t, 1, status.Done)
+	assert.Equal(t, 1, status.Total)
+	assert.Equal(t, 1, status.Updated, "only comment with changed html updated")
+	assert.Empty(t, status.Error)
+	assert.Equal(t, 2, renderer.calls, "comments with markdown rendered regardless of the key")
+
+	c, err := eng.Get(getReq(locator, "id-3"))
+	require.NoError(t, err)
+	assert.Equal(t, "<p>NEW TEXT</p>", c.Text)
+	c, err = eng.Get(getReq(locator, "id-1"))
+	require.NoError(t, err)
+	assert.Equal(t, `some text, <a href="http://radio-t.com">link</a>`, c.Text, "comment without markdown kept")
+
+	assert.Error(t, b.StartRerender("bad", nil), "unknown site")
+}
+
+func TestService_StartRerenderRunning(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123"), Renderer: &mockRenderer{key: "1"}}
+	b.rerenderJobs.jobs = map[string]*RerenderStatus{"radio-t": {SiteID: "radio-t", Running: true}}
+	assert.ErrorIs(t, b.StartRerender("radio-t", nil), ErrRerenderRunning)
+}
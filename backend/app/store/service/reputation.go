@@ -0,0 +1,161 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+// risks of commenter's ip
+const (
+	RiskNone   = ""      // nothing known about the ip
+	RiskListed = "dnsbl" // ip listed by DNS-based block lists
+	RiskAbuse  = "abuse" // ip recently used by a blocked user
+)
+
+const (
+	maxAbuseIPs      = 10000 // ip hashes kept in the abuse table, the table is cleaned when reached
+	abuseUserRecents = 10    // last comments of a blocked user whose ips added to the abuse table
+)
+
+// RiskPolicy defines handling of comments from ips with bad reputation, empty action allows comments
+type RiskPolicy struct {
+	Action    NetworkAction // moderate or block comments from risky ips
+	Challenge bool          // require proof-of-work challenge for comments from risky ips
+}
+
+// RiskPolicyLister provides ip reputation policy per site
+type RiskPolicyLister interface {
+	Policy(siteID string) (RiskPolicy, error)
+}
+
+// StaticRiskPolicyLister provides same ip reputation policy for every site
+type StaticRiskPolicyLister struct {
+	RiskPolicy
+}
+
+// Policy returns ip reputation policy (ignores siteID)
+func (l StaticRiskPolicyLister) Policy(_ string) (RiskPolicy, error) {
+	return l.RiskPolicy, nil
+}
+
+// ErrRiskyIP returned in case comments are not allowed from ip with bad reputation
+var ErrRiskyIP = errors.New("comments are not allowed from this address")
+
+// AbuseTable keeps hashed ips recently used by blocked users, entries expire after TTL
+type AbuseTable struct {
+	TTL time.Duration
+
+	mu  sync.Mutex
+	ips map[string]time.Time // ip hash to expiration time
+}
+
+// Add puts hashed ip to the table
+func (t *AbuseTable) Add(ipHash string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	if t.ips == nil {
+		t.ips = map[string]time.Time{}
+	}
+	if len(t.ips) >= maxAbuseIPs {
+		for k, exp := range t.ips {
+			if !now.Before(exp) {
+				delete(t.ips, k)
+			}
+		}
+		if len(t.ips) >= maxAbuseIPs {
+			t.ips = map[string]time.Time{}
+		}
+	}
+	t.ips[ipHash] = now.Add(t.TTL)
+}
+
+// Contains checks if hashed ip is in the table and not expired
+func (t *AbuseTable) Contains(ipHash string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	exp, ok := t.ips[ipHash]
+	return ok && time.Now().Before(exp)
+}
+
+// SiteRiskPolicy returns ip reputation policy for the site, allowing everything if not set
+func (s *DataStore) SiteRiskPolicy(siteID string) RiskPolicy {
+	if s.RiskPolicy == nil {
+		return RiskPolicy{}
+	}
+	policy, err := s.RiskPolicy.Policy(siteID)
+	if err != nil {
+		log.Printf("[WARN] failed to get risk policy for site %s: %v", siteID, err)
+		return RiskPolicy{}
+	}
+	return policy
+}
+
+// IPRisk classifies the plain (not hashed) ip of the commenter on the site, RiskNone if nothing known about it
+func (s *DataStore) IPRisk(siteID, ip string) string {
+	if ip == "" {
+		return RiskNone
+	}
+	if s.AbuseIPs != nil {
+		secret, err := s.getSecret(siteID)
+		if err == nil && s.AbuseIPs.Contains(store.HashValue(ip, secret)) {
+			return RiskAbuse
+		}
+	}
+	if s.DNSBL != nil && s.DNSBL.Contains(ip) {
+		return RiskListed
+	}
+	return RiskNone
+}
+
+// NeedsChallenge checks if the site's policy requires proof-of-work from the commenter with the plain ip
+func (s *DataStore) NeedsChallenge(siteID, ip string) bool {
+	return s.SiteRiskPolicy(siteID).Challenge && s.IPRisk(siteID, ip) != RiskNone
+}
+
+// applyRiskPolicy rejects or holds for review comments made from ips with bad reputation.
+// Should be called before ip hashed. Admins and imported comments are exempt.
+func (s *DataStore) applyRiskPolicy(c *store.Comment) error {
+	if s.RiskPolicy == nil || c.Imported || c.User.Admin || c.User.IP == "" {
+		return nil
+	}
+	policy := s.SiteRiskPolicy(c.Locator.SiteID)
+	if policy.Action == "" || policy.Action == NetworkAllow {
+		return nil
+	}
+	risk := s.IPRisk(c.Locator.SiteID, c.User.IP)
+	if risk == RiskNone {
+		return nil
+	}
+	if policy.Action == NetworkBlock {
+		log.Printf("[INFO] comment from %s rejected, %s ip", c.User.ID, risk)
+		return ErrRiskyIP
+	}
+	if c.Visibility == "" {
+		c.Visibility = store.VisibilityPending
+	}
+	return nil
+}
+
+// reportAbuse adds ips of the last comments of the blocked user to the abuse table
+func (s *DataStore) reportAbuse(siteID, userID string) {
+	if s.AbuseIPs == nil {
+		return
+	}
+	comments, err := s.Engine.Find(engine.FindRequest{Locator: store.Locator{SiteID: siteID}, UserID: userID, Limit: abuseUserRecents})
+	if err != nil {
+		log.Printf("[WARN] can't get comments of %s for abuse table, %v", userID, err)
+		return
+	}
+	for _, c := range comments {
+		if c.User.IP != "" {
+			s.AbuseIPs.Add(c.User.IP)
+		}
+	}
+}
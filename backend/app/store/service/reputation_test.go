@@ -0,0 +1,103 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+)
+
+func TestService_CreateWithRiskPolicy(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123"), DNSBL: ipMatcherMock{"1.1.1.1"},
+		AbuseIPs: &AbuseTable{TTL: time.Hour}}
+	defer b.Close()
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	comment := func(userID, ip string) store.Comment {
+		return store.Comment{Text: "text", Locator: locator, User: store.User{ID: userID, Name: userID, IP: ip}}
+	}
+
+	_, err := b.Create(comment("user2", "1.1.1.1"))
+	require.NoError(t, err, "policy disabled")
+
+	// ips of blocked user's comments get into abuse table
+	_, err = b.Create(comment("spammer", "2.2.2.2"))
+	require.NoError(t, err)
+	assert.Equal(t, RiskNone, b.IPRisk("radio-t", "2.2.2.2"))
+	require.NoError(t, b.SetBlock("radio-t", "spammer", true, 0))
+	assert.Equal(t, RiskAbuse, b.IPRisk("radio-t", "2.2.2.2"))
+	assert.Equal(t, RiskListed, b.IPRisk("radio-t", "1.1.1.1"))
+	assert.Equal(t, RiskNone, b.IPRisk("radio-t", "3.3.3.3"))
+	assert.Equal(t, RiskNone, b.IPRisk("radio-t", ""))
+
+	tbl := []struct {
+		policy  RiskPolicy
+		ip      string
+		err     error
+		pending bool
+	}{
+		{RiskPolicy{Action: NetworkBlock}, "1.1.1.1", ErrRiskyIP, false},
+		{RiskPolicy{Action: NetworkBlock}, "2.2.2.2", ErrRiskyIP, false},
+		{RiskPolicy{Action: NetworkBlock}, "3.3.3.3", nil, false},
+		{RiskPolicy{Action: NetworkModerate}, "1.1.1.1", nil, true},
+		{RiskPolicy{Action: NetworkModerate}, "2.2.2.2", nil, true},
+		{RiskPolicy{Action: NetworkAllow, Challenge: true}, "1.1.1.1", nil, false},
+	}
+	for i, tt := range tbl {
+		b.RiskPolicy = StaticRiskPolicyLister{tt.policy}
+		id, err := b.Create(comment("user2", tt.ip))
+		if tt.err != nil {
+			assert.ErrorIs(t, err, tt.err, "case #%d", i)
+			continue
+		}
+		require.NoError(t, err, "case #%d", i)
+		c, err := b.Engine.Get(getReq(locator, id))
+		require.NoError(t, err)
+		assert.Equal(t, tt.pending, c.Visibility == store.VisibilityPending, "case #%d", i)
+	}
+
+	b.RiskPolicy = StaticRiskPolicyLister{RiskPolicy{Action: NetworkBlock}}
+	c := comment("user2", "1.1.1.1")
+	c.User.Admin = true
+	_, err = b.Create(c)
+	require.NoError(t, err, "admin exempt")
+
+	c = comment("user2", "1.1.1.1")
+	c.Imported = true
+	_, err = b.Create(c)
+	require.NoError(t, err, "imported comment exempt")
+}
+
+func TestService_NeedsChallenge(t *testing.T) {
+	b := DataStore{AdminStore: admin.NewStaticKeyStore("secret 123"), DNSBL: ipMatcherMock{"1.1.1.1"}}
+	assert.False(t, b.NeedsChallenge("radio-t", "1.1.1.1"), "no policy")
+	b.RiskPolicy = StaticRiskPolicyLister{RiskPolicy{Action: NetworkModerate}}
+	assert.False(t, b.NeedsChallenge("radio-t", "1.1.1.1"), "challenge not required")
+	b.RiskPolicy = StaticRiskPolicyLister{RiskPolicy{Challenge: true}}
+	assert.True(t, b.NeedsChallenge("radio-t", "1.1.1.1"))
+	assert.False(t, b.NeedsChallenge("radio-t", "2.2.2.2"))
+}
+
+func TestAbuseTable(t *testing.T) {
+	tbl := AbuseTable{TTL: time.Hour}
+	assert.False(t, tbl.Contains("hash1"))
+	tbl.Add("hash1")
+	assert.True(t, tbl.Contains("hash1"))
+	assert.False(t, tbl.Contains("hash2"))
+
+	tbl.ips["hash1"] = time.Now().Add(-time.Second)
+	assert.False(t, tbl.Contains("hash1"), "expired")
+
+	for i := range maxAbuseIPs {
+		tbl.ips[fmt.Sprintf("h%d", i)] = time.Now().Add(time.Hour)
+	}
+	tbl.Add("hash2")
+	assert.Len(t, tbl.ips, 1, "table reset when full of valid entries")
+	assert.True(t, tbl.Contains("hash2"))
+}
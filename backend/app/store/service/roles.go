@@ -0,0 +1,131 @@
+package service
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/go-pkgz/lcw/v2"
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/engine"
+	"github.com/umputun/remark42/backend/app/store/event"
+)
+
+// Roles assignable to users of the site
+const (
+	RoleAdmin     = "admin"
+	RoleModerator = "moderator"
+)
+
+// rolesCacheTTL limits how long other instances sharing the engine may see a changed role
+const rolesCacheTTL = time.Minute
+
+// RoleAssignment is a role of the user on the site, assigned in the store
+type RoleAssignment struct {
+	UserID string `json:"user_id"`
+	Role   string `json:"role"`
+}
+
+// Roles returns roles assigned on the site in the store, ordered by user id.
+// Admins set by admin store and granted by invitations are not included.
+func (s *DataStore) Roles(siteID string) ([]RoleAssignment, error) {
+	res := []RoleAssignment{}
+	for _, role := range []string{RoleAdmin, RoleModerator} {
+		ids, err := s.Engine.ListFlags(engine.FlagRequest{Flag: roleFlag(role), Locator: store.Locator{SiteID: siteID}})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s role on %s: %w", role, siteID, err)
+		}
+		for _, id := range ids {
+			if userID, ok := id.(string); ok {
+				res = append(res, RoleAssignment{UserID: userID, Role: role})
+			}
+		}
+	}
+	slices.SortFunc(res, func(a, b RoleAssignment) int {
+		return cmp.Or(cmp.Compare(a.UserID, b.UserID), cmp.Compare(a.Role, b.Role))
+	})
+	return res, nil
+}
+
+// SetRole assigns the role to the user on the site, replacing the one assigned before. Empty role removes the assignment.
+func (s *DataStore) SetRole(siteID, userID, role string) error {
+	if role != "" && role != RoleAdmin && role != RoleModerator {
+		return fmt.Errorf("unknown role %q", role)
+	}
+	if role != "" && IsBot(userID) {
+		return fmt.Errorf("bot %s can't have a role", userID)
+	}
+	for _, r := range []string{RoleAdmin, RoleModerator} {
+		update := engine.FlagFalse
+		if r == role {
+			update = engine.FlagTrue
+		}
+		req := engine.FlagRequest{Flag: roleFlag(r), Locator: store.Locator{SiteID: siteID}, UserID: userID, Update: update}
+		if _, err := s.Engine.Flag(req); err != nil {
+			return fmt.Errorf("failed to set %s role of %s on %s: %w", r, userID, siteID, err)
+		}
+	}
+	s.resetRolesCache(siteID)
+	log.Printf("[INFO] role of %s on %s set to %q", userID, siteID, role)
+	s.emit(event.Event{Type: event.UserRole, SiteID: siteID, UserID: userID, Data: map[string]any{"role": role}})
+	return nil
+}
+
+// UserRole returns role of the user on the site, empty if the user has none. Admins set by admin store
+// and granted by invitations have admin role. Roles of the site are cached, changes made by this
+// instance applied immediately.
+func (s *DataStore) UserRole(siteID, userID string) string {
+	s.rolesCache.once.Do(func() {
+		o := lcw.NewOpts[map[string]string]()
+		s.rolesCache.LoadingCache, _ = lcw.NewExpirableCache[map[string]string](o.TTL(rolesCacheTTL))
+	})
+	roles, err := s.rolesCache.Get(siteID, func() (map[string]string, error) { return s.siteRoles(siteID) })
+	if err != nil {
+		log.Printf("[WARN] can't get roles for %s, %v", siteID, err)
+		return ""
+	}
+	return roles[userID]
+}
+
+// IsModerator checks if the user has moderator role on the site
+func (s *DataStore) IsModerator(siteID, userID string) bool {
+	return s.UserRole(siteID, userID) == RoleModerator
+}
+
+// siteRoles collects roles of the site from all sources, admin role overrides moderator one
+func (s *DataStore) siteRoles(siteID string) (map[string]string, error) {
+	res := map[string]string{}
+	moderators, err := s.Engine.ListFlags(engine.FlagRequest{Flag: engine.Moderator, Locator: store.Locator{SiteID: siteID}})
+	if err != nil {
+		log.Printf("[WARN] can't get moderators of %s, %v", siteID, err)
+	}
+	for _, id := range moderators {
+		if userID, ok := id.(string); ok {
+			res[userID] = RoleModerator
+		}
+	}
+	admins, err := s.Admins(siteID)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range admins {
+		res[id] = RoleAdmin
+	}
+	return res, nil
+}
+
+func (s *DataStore) resetRolesCache(siteID string) {
+	if s.rolesCache.LoadingCache != nil {
+		s.rolesCache.Delete(siteID)
+	}
+}
+
+func roleFlag(role string) engine.Flag {
+	if role == RoleModerator {
+		return engine.Moderator
+	}
+	return engine.Admin
+}
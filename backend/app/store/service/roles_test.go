@@ -0,0 +1,54 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store/admin"
+)
+
+func TestService_Roles(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticStore("secret 123", nil, []string{"admin1"}, "")}
+	defer b.Close()
+
+	roles, err := b.Roles("radio-t")
+	require.NoError(t, err)
+	assert.Empty(t, roles)
+	assert.Equal(t, RoleAdmin, b.UserRole("radio-t", "admin1"), "admin from admin store")
+	assert.Empty(t, b.UserRole("radio-t", "user1"))
+
+	require.EqualError(t, b.SetRole("radio-t", "user1", "owner"), `unknown role "owner"`)
+	require.NoError(t, b.SetRole("radio-t", "user1", RoleModerator))
+	require.NoError(t, b.SetRole("radio-t", "user2", RoleAdmin))
+	assert.True(t, b.IsModerator("radio-t", "user1"), "cache reset on change")
+	assert.False(t, b.IsAdmin("radio-t", "user1"))
+	assert.True(t, b.IsAdmin("radio-t", "user2"))
+	assert.False(t, b.IsModerator("radio-t", "user2"))
+	assert.Empty(t, b.UserRole("radio-t-bad", "user1"), "roles scoped by site")
+
+	roles, err = b.Roles("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, []RoleAssignment{{UserID: "user1", Role: RoleModerator}, {UserID: "user2", Role: RoleAdmin}}, roles)
+	admins, err := b.Admins("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"admin1", "user2"}, admins)
+
+	require.NoError(t, b.SetRole("radio-t", "user1", RoleAdmin))
+	assert.True(t, b.IsAdmin("radio-t", "user1"))
+	roles, err = b.Roles("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, []RoleAssignment{{UserID: "user1", Role: RoleAdmin}, {UserID: "user2", Role: RoleAdmin}}, roles,
+		"role replaced")
+
+	require.NoError(t, b.SetRole("radio-t", "user1", ""))
+	require.NoError(t, b.SetRole("radio-t", "admin1", ""))
+	assert.Empty(t, b.UserRole("radio-t", "user1"))
+	assert.Equal(t, RoleAdmin, b.UserRole("radio-t", "admin1"), "admin store not affected")
+	roles, err = b.Roles("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, []RoleAssignment{{UserID: "user2", Role: RoleAdmin}}, roles)
+}
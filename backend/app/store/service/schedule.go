@@ -0,0 +1,127 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/engine"
+	"github.com/umputun/remark42/backend/app/store/schedule"
+)
+
+var errScheduleDisabled = errors.New("scheduled actions disabled")
+
+// ScheduleAction validates the moderation action and keeps it until it's due.
+// Returns the action with assigned id and creation time.
+func (s *DataStore) ScheduleAction(a schedule.Action) (schedule.Action, error) {
+	if s.ScheduleStore == nil {
+		return schedule.Action{}, errScheduleDisabled
+	}
+	switch a.Type {
+	case schedule.DeleteThread, schedule.ReadOnly:
+		if a.URL == "" {
+			return schedule.Action{}, fmt.Errorf("no url for %s action", a.Type)
+		}
+		a.CommentID, a.UserID, a.Notify = "", "", false
+	case schedule.DeleteComment:
+		if a.URL == "" || a.CommentID == "" {
+			return schedule.Action{}, fmt.Errorf("no url or comment id for %s action", a.Type)
+		}
+		a.UserID, a.Notify = "", false
+	case schedule.Unblock:
+		if a.UserID == "" {
+			return schedule.Action{}, fmt.Errorf("no user id for %s action", a.Type)
+		}
+		a.URL, a.CommentID = "", ""
+	default:
+		return schedule.Action{}, fmt.Errorf("unknown action type %q", a.Type)
+	}
+	now := time.Now()
+	if !a.Due.After(now) {
+		return schedule.Action{}, fmt.Errorf("action due %s is not in the future", a.Due.Format(time.RFC3339))
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return schedule.Action{}, fmt.Errorf("failed to make action id: %w", err)
+	}
+	a.ID, a.Due, a.Created = hex.EncodeToString(b), a.Due.UTC(), now.UTC()
+	if err := s.ScheduleStore.Add(a); err != nil {
+		return schedule.Action{}, fmt.Errorf("failed to save scheduled action: %w", err)
+	}
+	log.Printf("[INFO] %s action %s on %s scheduled for %s by %s", a.Type, a.ID, a.SiteID, a.Due.Format(time.RFC3339), a.CreatedBy)
+	return a, nil
+}
+
+// ScheduledActions returns upcoming actions of the site, earliest due first
+func (s *DataStore) ScheduledActions(siteID string) ([]schedule.Action, error) {
+	if s.ScheduleStore == nil {
+		return nil, errScheduleDisabled
+	}
+	return s.ScheduleStore.List(siteID)
+}
+
+// CancelAction removes the scheduled action of the site
+func (s *DataStore) CancelAction(siteID, id string) error {
+	if s.ScheduleStore == nil {
+		return errScheduleDisabled
+	}
+	return s.ScheduleStore.Delete(siteID, id)
+}
+
+// RunScheduledActions executes actions due at ts and removes them. Failed action is removed as well,
+// as it fails the same way on retry, like the one for deleted post. Returns executed actions.
+func (s *DataStore) RunScheduledActions(ts time.Time) ([]schedule.Action, error) {
+	if s.ScheduleStore == nil {
+		return nil, errScheduleDisabled
+	}
+	due, err := s.ScheduleStore.Due(ts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get due actions: %w", err)
+	}
+	res := []schedule.Action{}
+	var errs []error
+	for _, a := range due {
+		if e := s.runAction(a); e != nil {
+			errs = append(errs, fmt.Errorf("failed to run %s action %s on %s: %w", a.Type, a.ID, a.SiteID, e))
+		} else {
+			log.Printf("[INFO] scheduled %s action %s on %s executed", a.Type, a.ID, a.SiteID)
+			res = append(res, a)
+		}
+		if e := s.ScheduleStore.Delete(a.SiteID, a.ID); e != nil {
+			errs = append(errs, fmt.Errorf("failed to remove action %s: %w", a.ID, e))
+		}
+	}
+	return res, errors.Join(errs...)
+}
+
+func (s *DataStore) runAction(a schedule.Action) error {
+	locator := store.Locator{SiteID: a.SiteID, URL: a.URL}
+	switch a.Type {
+	case schedule.DeleteThread:
+		comments, err := s.Engine.Find(engine.FindRequest{Locator: locator, Sort: "time"})
+		if err != nil {
+			return err
+		}
+		for _, c := range comments {
+			if c.Deleted {
+				continue
+			}
+			if err := s.Delete(locator, c.ID, store.SoftDelete); err != nil {
+				return err
+			}
+		}
+		return nil
+	case schedule.DeleteComment:
+		return s.Delete(locator, a.CommentID, store.SoftDelete)
+	case schedule.ReadOnly:
+		return s.SetReadOnly(locator, true)
+	case schedule.Unblock:
+		return s.SetBlock(a.SiteID, a.UserID, false, 0)
+	}
+	return fmt.Errorf("unknown action type %q", a.Type)
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/schedule"
+)
+
+func TestService_ScheduledActions(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticStore("secret 123", nil, []string{"admin1"}, "")}
+
+	_, err := b.ScheduleAction(schedule.Action{SiteID: "radio-t", Type: schedule.Unblock, UserID: "user1"})
+	require.EqualError(t, err, "scheduled actions disabled")
+	_, err = b.RunScheduledActions(time.Now())
+	require.EqualError(t, err, "scheduled actions disabled")
+
+	b.ScheduleStore, err = schedule.NewBoltStorage(path.Join(t.TempDir(), "schedule.db"), bolt.Options{})
+	require.NoError(t, err)
+	defer b.Close()
+
+	due := time.Now().Add(time.Hour)
+	for _, a := range []schedule.Action{
+		{Type: "archive", Due: due},
+		{Type: schedule.DeleteThread, Due: due},
+		{Type: schedule.DeleteComment, URL: "https://radio-t.com", Due: due},
+		{Type: schedule.Unblock, Due: due},
+		{Type: schedule.Unblock, UserID: "user1", Due: time.Now().Add(-time.Minute)},
+	} {
+		_, err = b.ScheduleAction(a)
+		require.Error(t, err, a)
+	}
+
+	require.NoError(t, b.SetBlock("radio-t", "user1", true, 0))
+	unblock, err := b.ScheduleAction(schedule.Action{SiteID: "radio-t", Type: schedule.Unblock, UserID: "user1",
+		URL: "https://radio-t.com", Notify: true, Due: due, CreatedBy: "admin1"})
+	require.NoError(t, err)
+	assert.Len(t, unblock.ID, 32)
+	assert.Empty(t, unblock.URL, "url cleared for unblock")
+	assert.True(t, unblock.Notify)
+	thread, err := b.ScheduleAction(schedule.Action{SiteID: "radio-t", Type: schedule.DeleteThread, URL: "https://radio-t.com",
+		Notify: true, Due: due.Add(time.Hour), CreatedBy: "admin1"})
+	require.NoError(t, err)
+	assert.False(t, thread.Notify, "notify for unblock only")
+	ro, err := b.ScheduleAction(schedule.Action{SiteID: "radio-t", Type: schedule.ReadOnly, URL: "https://radio-t.com",
+		Due: due.Add(2 * time.Hour)})
+	require.NoError(t, err)
+
+	actions, err := b.ScheduledActions("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, []schedule.Action{unblock, thread, ro}, actions)
+	require.NoError(t, b.CancelAction("radio-t", ro.ID))
+	require.ErrorIs(t, b.CancelAction("radio-t", ro.ID), schedule.ErrNotFound)
+
+	done, err := b.RunScheduledActions(time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, done, "nothing due yet")
+	assert.True(t, b.IsBlocked("radio-t", "user1"))
+
+	done, err = b.RunScheduledActions(due.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []schedule.Action{unblock, thread}, done)
+	assert.False(t, b.IsBlocked("radio-t", "user1"))
+	comments, err := b.Find(store.Locator{SiteID: "radio-t", URL: "https://radio-t.com"}, "time", store.User{})
+	require.NoError(t, err)
+	require.Len(t, comments, 2)
+	assert.True(t, comments[0].Deleted)
+	assert.True(t, comments[1].Deleted)
+	assert.False(t, b.IsReadOnly(store.Locator{SiteID: "radio-t", URL: "https://radio-t.com"}), "canceled action not run")
+
+	actions, err = b.ScheduledActions("radio-t")
+	require.NoError(t, err)
+	assert.Empty(t, actions, "executed actions removed")
+
+	_, err = b.ScheduleAction(schedule.Action{SiteID: "radio-t", Type: schedule.DeleteComment, URL: "https://radio-t.com",
+		CommentID: "unknown", Due: time.Now().Add(time.Millisecond)})
+	require.NoError(t, err)
+	done, err = b.RunScheduledActions(time.Now().Add(time.Second))
+	require.Error(t, err)
+	assert.Empty(t, done)
+	actions, err = b.ScheduledActions("radio-t")
+	require.NoError(t, err)
+	assert.Empty(t, actions, "failed action removed")
+}
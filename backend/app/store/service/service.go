@@ -19,8 +19,20 @@ import (
 
 	"github.com/umputun/remark42/backend/app/store"
 	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/asset"
+	"github.com/umputun/remark42/backend/app/store/bot"
+	"github.com/umputun/remark42/backend/app/store/brigade"
+	"github.com/umputun/remark42/backend/app/store/cold"
 	"github.com/umputun/remark42/backend/app/store/engine"
+	"github.com/umputun/remark42/backend/app/store/event"
+	"github.com/umputun/remark42/backend/app/store/highlight"
 	"github.com/umputun/remark42/backend/app/store/image"
+	"github.com/umputun/remark42/backend/app/store/invite"
+	"github.com/umputun/remark42/backend/app/store/page"
+	"github.com/umputun/remark42/backend/app/store/poll"
+	"github.com/umputun/remark42/backend/app/store/schedule"
+	"github.com/umputun/remark42/backend/app/store/settings"
+	"github.com/umputun/remark42/backend/app/store/suppress"
 )
 
 // DataStore wraps store.Interface with additional methods
@@ -40,6 +52,50 @@ type DataStore struct {
 	RestrictedWordsMatcher *RestrictedWordsMatcher
 	ImageService           *image.Service
 	AdminEdits             bool // allow admin unlimited edits
+	ProfilePolicy          ProfilePolicyLister
+	LanguagePolicy         LanguagePolicyLister
+	EditPolicy             EditPolicyLister // per-site edit window, EditDuration used if not set
+	AuthorDeletePolicy     AuthorDeletePolicyLister
+	ContentPolicy          ContentPolicyLister // per-site content limits, MinCommentSize and MaxCommentSize used if not set
+	WelcomePolicy          WelcomePolicyLister
+	LatePolicy             LatePolicyLister // marks comments on old threads, disabled if not set
+	Timezone               TimezoneLister   // site timezone for dates in emails and feeds, local if not set
+	CannedResponses        *CannedResponses // moderator responses, disabled if not set
+	ClientStats            *ClientStats     // aggregated client stats, disabled if not set
+	PollStore              poll.Store       // polls attached to posts, disabled if not set
+	HighlightStore         highlight.Store  // admin-curated highlights, disabled if not set
+	EventStore             event.Store      // journal of domain events, disabled if not set
+	EventPublisher         EventPublisher   // publishes domain events to message bus, disabled if not set
+	AssetStore             asset.Store      // branding assets of sites, disabled if not set
+	AssetLimits            AssetLimits      // size caps of AssetStore
+	GeoPolicy              GeoPolicyLister  // posting restrictions by country and network, disabled if not set
+	GeoLocator             GeoLocator       // resolves location of commenter's ip for GeoPolicy
+
+	ExitNodePolicy ExitNodePolicyLister // handling of comments from Tor and VPNs, disabled if not set
+	CollapsePolicy CollapsePolicyLister // handling of low-score comments on find, disabled if not set
+	TorExits       IPMatcher            // Tor exit nodes for ExitNodePolicy
+	VPNs           IPMatcher            // known VPN addresses for ExitNodePolicy
+	RiskPolicy     RiskPolicyLister     // handling of comments from ips with bad reputation, disabled if not set
+	DNSBL          IPMatcher            // ips listed by DNS-based block lists for RiskPolicy
+	AbuseIPs       *AbuseTable          // ips recently used by blocked users for RiskPolicy
+	LevelPolicy    LevelPolicyLister    // automatic user levels, disabled if not set
+	VoteWeights    VoteWeights          // weights of votes by voter's level, all votes weigh 1 if not set
+	Brigades       *brigade.Detector    // detector of vote brigading, disabled if not set
+	PII            *PIIVault            // seals stored emails, plain emails stored if not set
+	DetailCipher   *DetailCipher        // encrypts emails, telegram ids and totp secrets at rest, plain if not set
+	ExprPolicy     *ExprPolicies        // moderation and notification routing expressions, disabled if not set
+	Quotas         *Quotas              // per-site usage quotas, disabled if not set
+	InviteStore    invite.Store         // admin invitations and roles granted by them, disabled if not set
+	InviteTTL      time.Duration        // lifetime of invitations, 72h if not set
+	BotStore       bot.Store            // bot accounts authenticated by api keys, disabled if not set
+	ScheduleStore  schedule.Store       // moderation actions scheduled for later, disabled if not set
+	ColdStore      cold.Store           // inactive posts moved out of the engine, disabled if not set
+	PageStore      page.Store           // per-post settings like pinned order of comments, disabled if not set
+	SuppressStore  suppress.Store       // addresses suppressed after bounces and complaints, disabled if not set
+	SettingsStore  settings.Store       // per-site settings changed at runtime, see RestoreSettings
+	Renderer       CommentRenderer      // re-renders comments with outdated html on read, disabled if not set
+	PageChecker    *PageWebhook         // confirms pages of new comments with the site's CMS, disabled if not set
+	StrictPages    bool                 // comments accepted only on posts registered in PageStore or confirmed by PageChecker
 
 	// granular locks
 	scopedLocks struct {
@@ -52,6 +108,31 @@ type DataStore struct {
 		lcw.LoadingCache[struct{}]
 		once sync.Once
 	}
+
+	rolesCache struct {
+		lcw.LoadingCache[map[string]string]
+		once sync.Once
+	}
+
+	notBeforeCache struct {
+		lcw.LoadingCache[time.Time]
+		once sync.Once
+	}
+
+	reindexJobs struct {
+		sync.Mutex
+		jobs map[string]*ReindexStatus
+	}
+
+	rerenderJobs struct {
+		sync.Mutex
+		jobs map[string]*RerenderStatus
+	}
+
+	integrityReports struct {
+		sync.Mutex
+		reports map[string]IntegrityReport
+	}
 }
 
 // UserMetaData keeps info about user flags and details
@@ -73,6 +154,7 @@ type PostMetaData struct {
 
 const defaultCommentMaxSize = 2048
 const maxLastCommentsReply = 5000
+const maxIgnoredUsers = 500
 
 // UnlimitedVotes doesn't restrict MaxVotes
 const UnlimitedVotes = -1
@@ -84,6 +166,20 @@ var ErrRestrictedWordsFound = fmt.Errorf("comment contains restricted words")
 
 // Create prepares comment and forward to Interface.Create
 func (s *DataStore) Create(comment store.Comment) (commentID string, err error) {
+	// both before prepareNewComment, it replaces ip by hash
+	if err = s.applyGeoPolicy(&comment); err != nil {
+		return "", err
+	}
+	if err = s.applyExitNodePolicy(&comment); err != nil {
+		return "", err
+	}
+	if err = s.applyRiskPolicy(&comment); err != nil {
+		return "", err
+	}
+	if err = s.applyPageCheck(&comment); err != nil {
+		return "", err
+	}
+
 	if comment, err = s.prepareNewComment(comment); err != nil {
 		return "", fmt.Errorf("failed to prepare comment: %w", err)
 	}
@@ -92,6 +188,22 @@ func (s *DataStore) Create(comment store.Comment) (commentID string, err error)
 		return "", ErrRestrictedWordsFound
 	}
 
+	if err = s.applyLanguagePolicy(&comment); err != nil {
+		return "", err
+	}
+	s.applyLevelPolicy(&comment)
+	if err = s.applyExprPolicy(&comment); err != nil {
+		return "", err
+	}
+
+	if comment.Visibility == store.VisibilityPrivate && comment.PrivateTo == "" { // private reply addressed to the author of the parent comment
+		parent, e := s.Engine.Get(engine.GetRequest{Locator: comment.Locator, CommentID: comment.ParentID})
+		if e != nil {
+			return "", fmt.Errorf("can't get parent comment for private reply: %w", e)
+		}
+		comment.PrivateTo = parent.User.ID
+	}
+
 	func() { // keep input title and set to extracted if missing
 		if s.TitleExtractor == nil || comment.PostTitle != "" {
 			return
@@ -104,8 +216,23 @@ func (s *DataStore) Create(comment store.Comment) (commentID string, err error)
 		comment.PostTitle = title
 	}()
 
-	commentID, err = s.Engine.Create(comment)
+	if err = s.checkCommentQuota(comment); err != nil {
+		return "", err
+	}
+
+	s.markNewMember(&comment)
+	s.markLate(&comment)
+	commentID, err = s.createComment(comment)
+	if err == nil {
+		s.recordCommentQuota(comment)
+	}
 	s.submitImages(comment)
+	if err == nil && !comment.Imported && comment.Visibility != store.VisibilityPending {
+		s.promoteUser(comment.Locator.SiteID, comment.User.ID)
+	}
+	if err == nil && !comment.Imported {
+		s.emitComment(event.CommentCreated, comment, map[string]any{"parent_id": comment.ParentID, "visibility": comment.Visibility})
+	}
 
 	if e := s.AdminStore.OnEvent(comment.Locator.SiteID, admin.EvCreate); e != nil {
 		log.Printf("[WARN] failed to send create event, %s", e)
@@ -122,11 +249,13 @@ func (s *DataStore) Find(locator store.Locator, sortMethod string, user store.Us
 // FindSince wraps engine's Find call and alter results if needed. Returns comments after since tx
 func (s *DataStore) FindSince(locator store.Locator, sortMethod string, user store.User, since time.Time) ([]store.Comment, error) {
 	req := engine.FindRequest{Locator: locator, Sort: sortMethod, Since: since}
-	comments, err := s.Engine.Find(req)
+	comments, err := s.findPost(req)
 	if err != nil {
 		return comments, err
 	}
 
+	comments = visibleComments(comments, user)
+
 	changedSort := false
 	flags := s.newUserFlagCache()
 	// sets votes controversy for comments added prior to #274
@@ -146,6 +275,10 @@ func (s *DataStore) FindSince(locator store.Locator, sortMethod string, user sto
 		comments = engine.SortComments(comments, sortMethod)
 	}
 
+	if user.ID != "" {
+		s.markIgnored(comments, locator.SiteID, user.ID)
+	}
+
 	return comments, nil
 }
 
@@ -175,24 +308,28 @@ func (s *DataStore) GetUserEmail(siteID, userID string) (string, error) {
 		return "", err
 	}
 	if len(res) == 1 {
-		return res[0].Email, nil
+		return s.readEmail(res[0].Email)
 	}
 	return "", nil
 }
 
-// SetUserEmail sets user email
+// SetUserEmail sets user email, sealed with PII minimization enabled and encrypted with encryption enabled
 func (s *DataStore) SetUserEmail(siteID, userID, value string) (string, error) {
+	sealed, err := s.storedEmail(value)
+	if err != nil {
+		return "", fmt.Errorf("can't seal email for %s: %w", userID, err)
+	}
 	res, err := s.Engine.UserDetail(engine.UserDetailRequest{
 		Detail:  engine.UserEmail,
 		Locator: store.Locator{SiteID: siteID},
 		UserID:  userID,
-		Update:  value,
+		Update:  sealed,
 	})
 	if err != nil {
 		return "", err
 	}
 	if len(res) == 1 {
-		return res[0].Email, nil
+		return s.readEmail(res[0].Email)
 	}
 	return "", nil
 }
@@ -208,24 +345,28 @@ func (s *DataStore) GetUserTelegram(siteID, userID string) (string, error) {
 		return "", err
 	}
 	if len(res) == 1 {
-		return res[0].Telegram, nil
+		return s.readDetail(res[0].Telegram)
 	}
 	return "", nil
 }
 
-// SetUserTelegram sets user telegram
+// SetUserTelegram sets user telegram, encrypted with encryption enabled
 func (s *DataStore) SetUserTelegram(siteID, userID, value string) (string, error) {
+	stored, err := s.storedDetail(value)
+	if err != nil {
+		return "", fmt.Errorf("can't encrypt telegram for %s: %w", userID, err)
+	}
 	res, err := s.Engine.UserDetail(engine.UserDetailRequest{
 		Detail:  engine.UserTelegram,
 		Locator: store.Locator{SiteID: siteID},
 		UserID:  userID,
-		Update:  value,
+		Update:  stored,
 	})
 	if err != nil {
 		return "", err
 	}
 	if len(res) == 1 {
-		return res[0].Telegram, nil
+		return s.readDetail(res[0].Telegram)
 	}
 	return "", nil
 }
@@ -239,6 +380,65 @@ func (s *DataStore) DeleteUserDetail(siteID, userID string, detail engine.UserDe
 	})
 }
 
+// IgnoredUsers returns ids of users ignored by the user
+func (s *DataStore) IgnoredUsers(siteID, userID string) ([]string, error) {
+	res, err := s.Engine.UserDetail(engine.UserDetailRequest{
+		Detail:  engine.UserIgnored,
+		Locator: store.Locator{SiteID: siteID},
+		UserID:  userID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(res) != 1 || res[0].Ignored == "" {
+		return []string{}, nil
+	}
+	return strings.Split(res[0].Ignored, ","), nil
+}
+
+// SetIgnored adds ignoredID to the user's ignore list or removes it from there
+func (s *DataStore) SetIgnored(siteID, userID, ignoredID string, status bool) error {
+	if ignoredID == "" || strings.Contains(ignoredID, ",") {
+		return fmt.Errorf("invalid user id %q", ignoredID)
+	}
+	if ignoredID == userID {
+		return fmt.Errorf("user %s can't ignore himself", userID)
+	}
+
+	lock := s.getScopedLocks(siteID + "!!ignored!!" + userID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	ignored, err := s.IgnoredUsers(siteID, userID)
+	if err != nil {
+		return fmt.Errorf("can't get ignored users for %s: %w", userID, err)
+	}
+
+	idx := slices.Index(ignored, ignoredID)
+	switch {
+	case status == (idx >= 0): // nothing to change
+		return nil
+	case status:
+		if len(ignored) >= maxIgnoredUsers {
+			return fmt.Errorf("too many ignored users, max %d", maxIgnoredUsers)
+		}
+		ignored = append(ignored, ignoredID)
+	default:
+		ignored = slices.Delete(ignored, idx, idx+1)
+	}
+
+	if len(ignored) == 0 {
+		return s.DeleteUserDetail(siteID, userID, engine.UserIgnored)
+	}
+	_, err = s.Engine.UserDetail(engine.UserDetailRequest{
+		Detail:  engine.UserIgnored,
+		Locator: store.Locator{SiteID: siteID},
+		UserID:  userID,
+		Update:  strings.Join(ignored, ","),
+	})
+	return err
+}
+
 // ResubmitStagingImages retrieves timestamp of the oldest image in staging and
 // calls s.submitImages on all comments newer than it
 func (s *DataStore) ResubmitStagingImages(sites []string) error {
@@ -253,7 +453,7 @@ func (s *DataStore) ResubmitStagingImages(sites []string) error {
 	var errs []error
 	for _, site := range sites {
 		locator := store.Locator{SiteID: site}
-		comments, err := s.FindSince(locator, "time", store.User{}, ts)
+		comments, err := s.FindSince(locator, "time", store.User{Admin: true}, ts) // admin sees restricted comments too
 		if err != nil {
 			errs = append(errs, fmt.Errorf("problem finding comments for site %s: %w", site, err))
 		}
@@ -307,6 +507,11 @@ func (s *DataStore) prepareNewComment(comment store.Comment) (store.Comment, err
 	}
 	comment.Sanitize() // clear potentially dangerous js from all parts of comment
 
+	// comments not formatted by the caller, i.e. imported ones, get plain text here
+	if comment.PlainText == "" {
+		comment.PlainText = store.PlainText(comment.Text)
+	}
+
 	secret, err := s.getSecret(comment.Locator.SiteID)
 	if err != nil {
 		return store.Comment{}, fmt.Errorf("can't get secret for site %s: %w", comment.Locator.SiteID, err)
@@ -315,10 +520,55 @@ func (s *DataStore) prepareNewComment(comment store.Comment) (store.Comment, err
 	return comment, nil
 }
 
+// Approve publishes comment held for review
+func (s *DataStore) Approve(locator store.Locator, commentID string) error {
+	comment, err := s.Engine.Get(engine.GetRequest{Locator: locator, CommentID: commentID})
+	if err != nil {
+		return err
+	}
+	if comment.Visibility != store.VisibilityPending {
+		return fmt.Errorf("comment %s is not pending review", commentID)
+	}
+	comment.Visibility = ""
+	comment.Locator = locator
+	if err = s.Engine.Update(comment); err != nil {
+		return err
+	}
+	s.promoteUser(locator.SiteID, comment.User.ID)
+	s.emitComment(event.CommentApproved, comment, nil)
+	return nil
+}
+
+// Pending returns comments of the site held for review, oldest first. Deleted comments skipped.
+func (s *DataStore) Pending(siteID string) ([]store.Comment, error) {
+	posts, err := s.listPosts(engine.InfoRequest{Locator: store.Locator{SiteID: siteID}})
+	if err != nil {
+		return nil, fmt.Errorf("can't list posts of %s: %w", siteID, err)
+	}
+	res := []store.Comment{}
+	for _, p := range posts {
+		comments, e := s.findPost(engine.FindRequest{Locator: store.Locator{SiteID: siteID, URL: p.URL}, Sort: "time"})
+		if e != nil {
+			return nil, fmt.Errorf("can't get comments of %s: %w", p.URL, e)
+		}
+		for _, c := range comments {
+			if c.Visibility == store.VisibilityPending && !c.Deleted {
+				res = append(res, c)
+			}
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].Timestamp.Before(res[j].Timestamp) })
+	return s.alterComments(res, store.User{Admin: true}), nil
+}
+
 // DeleteAll removes all data from site
 func (s *DataStore) DeleteAll(siteID string) error {
 	req := engine.DeleteRequest{Locator: store.Locator{SiteID: siteID}}
-	return s.Engine.Delete(req)
+	if err := s.Engine.Delete(req); err != nil {
+		return err
+	}
+	s.releaseSiteQuota(siteID)
+	return nil
 }
 
 // SetPin pin/un-pin comment as special
@@ -329,7 +579,11 @@ func (s *DataStore) SetPin(locator store.Locator, commentID string, status bool)
 	}
 	comment.Pin = status
 	comment.Locator = locator
-	return s.Engine.Update(comment)
+	if err = s.Engine.Update(comment); err != nil {
+		return err
+	}
+	s.emitComment(event.CommentPinned, comment, map[string]any{"status": status})
+	return nil
 }
 
 // VoteReq is the request ot make a vote
@@ -393,23 +647,28 @@ func (s *DataStore) Vote(req VoteReq) (comment store.Comment, err error) {
 	}
 	comment.VotedIPs[userIPHash] = store.VotedIPInfo{Timestamp: time.Now(), Value: req.Val}
 
+	prevWeighted := weightedVotes(comment)
+
 	// reset vote if user changed to opposite. Effectively it is "forget about prev votes" to allow "+ - -" or "- + +" corrections
 	if voted && v != req.Val {
 		delete(comment.Votes, req.UserID)
 		delete(comment.VotedIPs, userIPHash)
+		delete(comment.VoteWeights, req.UserID)
 	}
 
 	// add to voted map if first vote
 	if !voted {
 		comment.Votes[req.UserID] = req.Val
+		if weight := s.voteWeight(req.Locator.SiteID, req.UserID); weight != 1 {
+			if comment.VoteWeights == nil {
+				comment.VoteWeights = map[string]float64{}
+			}
+			comment.VoteWeights[req.UserID] = weight
+		}
 	}
 
-	// update score
-	if req.Val {
-		comment.Score++
-	} else {
-		comment.Score--
-	}
+	// update score by the change of weighted votes, keeps score of imported comments without votes
+	comment.Score += int(math.Round(weightedVotes(comment)) - math.Round(prevWeighted))
 
 	comment.Vote = 0
 	if vv, ok := comment.Votes[req.UserID]; ok {
@@ -426,7 +685,15 @@ func (s *DataStore) Vote(req VoteReq) (comment store.Comment, err error) {
 
 	comment.Controversy = s.controversy(s.upsAndDowns(comment))
 	comment.Locator = req.Locator
-	return comment, s.Engine.Update(comment)
+	if err = s.Engine.Update(comment); err != nil {
+		return comment, err
+	}
+	if !voted {
+		s.recordVote(req, userIPHash, secret)
+	}
+	s.emit(event.Event{Type: event.CommentVoted, SiteID: req.Locator.SiteID, URL: req.Locator.URL, CommentID: comment.ID,
+		UserID: req.UserID, Data: map[string]any{"value": req.Val, "score": comment.Score}})
+	return comment, nil
 }
 
 func (s *DataStore) isSameIPVote(req VoteReq, userIPHash string, comment store.Comment) bool {
@@ -462,22 +729,31 @@ func (s *DataStore) controversy(ups, downs int) float64 {
 
 // EditRequest contains fields needed for comment update
 type EditRequest struct {
-	Text    string
-	Orig    string
-	Summary string
-	Delete  bool
-	Admin   bool
+	Text      string
+	Orig      string
+	RenderKey string // key of rendering Text made with
+	Summary   string
+	Delete    bool
+	Admin     bool
 }
 
 // EditComment to edit text and update Edit info
 func (s *DataStore) EditComment(locator store.Locator, commentID string, req EditRequest) (comment store.Comment, err error) {
+	deleteMode := s.SiteAuthorDeleteMode(locator.SiteID)
 	editAllowed := func(comment store.Comment) error {
 		if req.Admin && s.AdminEdits {
 			return nil
 		}
 
-		// edit allowed in editDuration window only
-		if s.EditDuration > 0 && time.Now().After(comment.Timestamp.Add(s.EditDuration)) {
+		// deletion allowed any time by site's policy
+		if req.Delete && deleteMode != AuthorDeleteInEditWindow {
+			return nil
+		}
+
+		// edit allowed in site's edit window for the user role only
+		policy := s.SiteEditPolicy(locator.SiteID)
+		window := policy.window(s.IsVerified(locator.SiteID, comment.User.ID), req.Admin)
+		if window > 0 && time.Now().After(comment.Timestamp.Add(window)) {
 			return fmt.Errorf("too late to edit %s", commentID)
 		}
 
@@ -506,27 +782,55 @@ func (s *DataStore) EditComment(locator store.Locator, commentID string, req Edi
 			s.repliesCache.Delete(commentID)
 			s.repliesCache.Delete(comment.ParentID)
 		}
-		comment.Deleted = true
+		if deleteMode == AuthorDeleteTombstone { // marked before deletion, as delete keeps the flag
+			comment.SelfDeleted = true
+			comment.Locator = locator
+			if err = s.Engine.Update(comment); err != nil {
+				return comment, fmt.Errorf("can't mark comment %s removed by author: %w", commentID, err)
+			}
+		}
 		delReq := engine.DeleteRequest{Locator: locator, CommentID: commentID, DeleteMode: store.SoftDelete}
-		return comment, s.Engine.Delete(delReq)
+		if err = s.Engine.Delete(delReq); err != nil {
+			return comment, err
+		}
+		if !comment.Imported && !comment.Deleted {
+			s.recordStorageQuota(locator.SiteID, -int64(len(comment.Text)))
+		}
+		comment.Deleted = true
+		s.emitComment(event.CommentDeleted, comment, map[string]any{"mode": "soft", "by_author": true})
+		return comment, nil
 	}
 
 	if s.RestrictedWordsMatcher != nil && s.RestrictedWordsMatcher.Match(comment.Locator.SiteID, req.Text) {
 		return comment, ErrRestrictedWordsFound
 	}
 
+	oldSize := len(comment.Text)
 	comment.Text = req.Text
 	comment.Orig = req.Orig
+	comment.RenderKey = req.RenderKey
 	comment.Edit = &store.Edit{Timestamp: time.Now(), Summary: req.Summary}
+	comment.Edited = true
 	comment.Locator = locator
 	comment.Sanitize()
+	comment.PlainText = store.PlainText(comment.Text)
+	comment.Lang = "" // edited text detected again
+	if err = s.applyLanguagePolicy(&comment); err != nil {
+		return comment, err
+	}
 
 	if e := s.AdminStore.OnEvent(comment.Locator.SiteID, admin.EvUpdate); e != nil {
 		log.Printf("[WARN] failed to send update event, %s", e)
 	}
 
-	err = s.Engine.Update(comment)
-	return comment, err
+	if err = s.Engine.Update(comment); err != nil {
+		return comment, err
+	}
+	if !comment.Imported {
+		s.recordStorageQuota(locator.SiteID, int64(len(comment.Text)-oldSize))
+	}
+	s.emitComment(event.CommentUpdated, comment, map[string]any{"summary": req.Summary})
+	return comment, nil
 }
 
 // HasReplies checks if there is any reply to the comments
@@ -624,42 +928,47 @@ func (s *DataStore) SetTitle(locator store.Locator, commentID string) (comment s
 func (s *DataStore) Counts(siteID string, postIDs []string) ([]store.PostInfo, error) {
 	res := []store.PostInfo{}
 	for _, p := range postIDs {
-		req := engine.FindRequest{Locator: store.Locator{SiteID: siteID, URL: p}}
-		if c, err := s.Engine.Count(req); err == nil {
+		if c, err := s.Count(store.Locator{SiteID: siteID, URL: p}); err == nil {
 			res = append(res, store.PostInfo{URL: p, Count: c})
 		}
 	}
 	return res, nil
 }
 
-// ValidateComment checks if comment size below max and user fields set.
+// ValidateComment checks if comment matches site's content policy and user fields set.
 // It also validates the absence of relative links as they are almost never the intention of the commenter,
 // usually added by mistakes and only create confusion.
 func (s *DataStore) ValidateComment(c *store.Comment) error {
-	maxSize := s.MaxCommentSize
-	if s.MaxCommentSize <= 0 {
-		maxSize = defaultCommentMaxSize
-	}
 	if c.Orig == "" {
 		return fmt.Errorf("empty comment text")
 	}
-	commentLength := len([]rune(c.Orig))
-	if commentLength > maxSize {
-		return fmt.Errorf("comment text exceeded max allowed size %d (%d)", maxSize, commentLength)
-	}
-	if s.MinCommentSize > 0 && commentLength < s.MinCommentSize {
-		return fmt.Errorf("comment text is smaller than min allowed size %d (%d)", s.MinCommentSize, commentLength)
+	policy := s.SiteContentPolicy(c.Locator.SiteID)
+	if err := policy.checkLength(c.Orig); err != nil {
+		return err
 	}
 	if c.User.ID == "" || c.User.Name == "" {
 		return fmt.Errorf("empty user info")
 	}
+	switch c.Visibility {
+	case "", store.VisibilityStaff:
+	case store.VisibilityPrivate:
+		if c.ParentID == "" {
+			return fmt.Errorf("private comment should be a reply")
+		}
+	default:
+		return fmt.Errorf("unknown comment visibility %q", c.Visibility)
+	}
+	if c.Visibility != "" && !c.User.Admin {
+		return fmt.Errorf("only admins can post %s comments", c.Visibility)
+	}
 
 	// for validation purposes it's not important if SmartyPants formatting is disabled or enabled,
 	// while for storing the comment that flag is set based on user preference
 	mdExt, rend := store.GetMdExtensionsAndRenderer(false)
 	parser := bf.New(bf.WithRenderer(rend), bf.WithExtensions(bf.CommonExtensions), bf.WithExtensions(mdExt))
 	var wrongLinkError error
-	parser.Parse([]byte(c.Orig)).Walk(func(node *bf.Node, _ bool) bf.WalkStatus {
+	doc := parser.Parse([]byte(c.Orig))
+	doc.Walk(func(node *bf.Node, _ bool) bf.WalkStatus {
 		if len(node.Destination) != 0 &&
 			(!strings.HasPrefix(string(node.Destination), "http://") && !strings.HasPrefix(string(node.Destination), "https://") && !strings.HasPrefix(string(node.Destination), "mailto:")) {
 			wrongLinkError = fmt.Errorf("links should start with mailto:, http:// or https://")
@@ -667,17 +976,15 @@ func (s *DataStore) ValidateComment(c *store.Comment) error {
 		}
 		return bf.GoToNext
 	})
-	return wrongLinkError
+	if wrongLinkError != nil {
+		return wrongLinkError
+	}
+	return policy.checkContent(doc)
 }
 
-// IsAdmin checks if usesID in the list of admins
+// IsAdmin checks if usesID in the list of admins, see UserRole
 func (s *DataStore) IsAdmin(siteID, userID string) bool {
-	admins, err := s.AdminStore.Admins(siteID)
-	if err != nil {
-		log.Printf("[WARN] can't get admins for %s, %v", siteID, err)
-		return false
-	}
-	return slices.Contains(admins, userID)
+	return s.UserRole(siteID, userID) == RoleAdmin
 }
 
 // IsReadOnly checks if post read-only
@@ -694,8 +1001,11 @@ func (s *DataStore) SetReadOnly(locator store.Locator, status bool) error {
 		roStatus = engine.FlagTrue
 	}
 	req := engine.FlagRequest{Locator: locator, Flag: engine.ReadOnly, Update: roStatus}
-	_, err := s.Engine.Flag(req)
-	return err
+	if _, err := s.Engine.Flag(req); err != nil {
+		return err
+	}
+	s.emit(event.Event{Type: event.PostReadOnly, SiteID: locator.SiteID, URL: locator.URL, Data: map[string]any{"status": status}})
+	return nil
 }
 
 // IsVerified checks if user verified
@@ -712,8 +1022,11 @@ func (s *DataStore) SetVerified(siteID, userID string, status bool) error {
 		roStatus = engine.FlagTrue
 	}
 	req := engine.FlagRequest{Locator: store.Locator{SiteID: siteID}, UserID: userID, Flag: engine.Verified, Update: roStatus}
-	_, err := s.Engine.Flag(req)
-	return err
+	if _, err := s.Engine.Flag(req); err != nil {
+		return err
+	}
+	s.emit(event.Event{Type: event.UserVerified, SiteID: siteID, UserID: userID, Data: map[string]any{"status": status}})
+	return nil
 }
 
 // IsBlocked checks if user blocked
@@ -731,8 +1044,18 @@ func (s *DataStore) SetBlock(siteID, userID string, status bool, ttl time.Durati
 	}
 	req := engine.FlagRequest{Locator: store.Locator{SiteID: siteID}, UserID: userID,
 		Flag: engine.Blocked, Update: roStatus, TTL: ttl}
-	_, err := s.Engine.Flag(req)
-	return err
+	if _, err := s.Engine.Flag(req); err != nil {
+		return err
+	}
+	if status {
+		s.reportAbuse(siteID, userID)
+	}
+	data := map[string]any{"status": status}
+	if status && ttl > 0 {
+		data["ttl"] = int(ttl.Seconds())
+	}
+	s.emit(event.Event{Type: event.UserBlocked, SiteID: siteID, UserID: userID, Data: data})
+	return nil
 }
 
 // BlockedUsers returns list with all blocked users for given siteID
@@ -752,6 +1075,9 @@ func (s *DataStore) Info(locator store.Locator, readonlyAge int) (store.PostInfo
 	req := engine.InfoRequest{Locator: locator, ReadOnlyAge: readonlyAge}
 	res, err := s.Engine.Info(req)
 	if err != nil {
+		if info, ok := s.coldInfo(locator, readonlyAge); ok {
+			return info, nil
+		}
 		return store.PostInfo{}, err
 	}
 	if len(res) == 0 {
@@ -821,25 +1147,53 @@ func (s *DataStore) Delete(locator store.Locator, commentID string, mode store.D
 	log.Printf("[DEBUG] commentImgIDs: %v, pageImgIDs: %v", commentImgIDs, pageImgIDs)
 
 	req := engine.DeleteRequest{Locator: locator, CommentID: commentID, DeleteMode: mode}
-	return s.Engine.Delete(req)
+	if err = s.Engine.Delete(req); err != nil {
+		return err
+	}
+	if !comment.Imported && !comment.Deleted {
+		s.recordStorageQuota(locator.SiteID, -int64(len(comment.Text)))
+	}
+	comment.Locator = locator
+	s.emitComment(event.CommentDeleted, comment, map[string]any{"mode": deleteModeName(mode)})
+	return nil
 }
 
 // DeleteUser removes all comments from user
 func (s *DataStore) DeleteUser(siteID, userID string, mode store.DeleteMode) error {
+	if err := s.thawUser(siteID, userID); err != nil {
+		return err
+	}
+	size := s.userStorage(siteID, userID)
 	req := engine.DeleteRequest{Locator: store.Locator{SiteID: siteID}, UserID: userID, DeleteMode: mode}
-	return s.Engine.Delete(req)
+	if err := s.Engine.Delete(req); err != nil {
+		return err
+	}
+	s.recordStorageQuota(siteID, -size)
+	if s.EventStore != nil { // user's activity not kept, the deletion itself journaled
+		if _, err := s.EventStore.DeleteUser(siteID, userID); err != nil {
+			log.Printf("[WARN] failed to remove events of %s on %s, %v", userID, siteID, err)
+		}
+	}
+	s.emit(event.Event{Type: event.UserDeleted, SiteID: siteID, UserID: userID, Data: map[string]any{"mode": deleteModeName(mode)}})
+	return nil
 }
 
 // List of commented posts
 func (s *DataStore) List(siteID string, limit, skip int) ([]store.PostInfo, error) {
 	req := engine.InfoRequest{Locator: store.Locator{SiteID: siteID}, Limit: limit, Skip: skip}
-	return s.Engine.Info(req)
+	return s.listPosts(req)
 }
 
 // Count gets number of comments for the post
 func (s *DataStore) Count(locator store.Locator) (int, error) {
 	req := engine.FindRequest{Locator: locator}
-	return s.Engine.Count(req)
+	c, err := s.Engine.Count(req)
+	if err != nil || c == 0 { // missing post has no comments for engine
+		if info, ok := s.coldInfo(locator, 0); ok {
+			return info.Count, nil
+		}
+	}
+	return c, err
 }
 
 // Metas returns metadata for users and posts
@@ -858,6 +1212,15 @@ func (s *DataStore) Metas(siteID string) (umetas []UserMetaData, pmetas []PostMe
 			pmetas = append(pmetas, PostMetaData{URL: p.URL, ReadOnly: true})
 		}
 	}
+	frozen, err := s.coldPosts(siteID)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, p := range frozen {
+		if p.ReadOnly {
+			pmetas = append(pmetas, PostMetaData{URL: p.URL, ReadOnly: true})
+		}
+	}
 
 	// set users meta, key is userID
 	m := map[string]UserMetaData{}
@@ -902,6 +1265,13 @@ func (s *DataStore) Metas(siteID string) (umetas []UserMetaData, pmetas []PostMe
 		if !ok {
 			val = UserMetaData{ID: entry.UserID}
 		}
+		// details stored before PII minimization or encryption was enabled are not exported in plain form
+		if entry.Email, err = s.storedEmail(entry.Email); err != nil {
+			return nil, nil, fmt.Errorf("can't seal email of %s: %w", entry.UserID, err)
+		}
+		if entry.Telegram, err = s.storedDetail(entry.Telegram); err != nil {
+			return nil, nil, fmt.Errorf("can't encrypt telegram of %s: %w", entry.UserID, err)
+		}
 		val.Details = entry
 		m[entry.UserID] = val
 	}
@@ -935,10 +1305,21 @@ func (s *DataStore) SetMetas(siteID string, umetas []UserMetaData, pmetas []Post
 		}
 		// this code doesn't delete user details in case they are not set in import but present in DB already
 		if um.Details.Email != "" {
-			req := engine.UserDetailRequest{Locator: store.Locator{SiteID: siteID}, UserID: um.ID, Detail: engine.UserEmail, Update: um.Details.Email}
+			email, err := s.storedEmail(um.Details.Email)
+			if err == nil {
+				req := engine.UserDetailRequest{Locator: store.Locator{SiteID: siteID}, UserID: um.ID, Detail: engine.UserEmail, Update: email}
+				_, err = s.Engine.UserDetail(req)
+			}
+			errs = append(errs, err)
+		}
+		if um.Details.Level != "" {
+			req := engine.UserDetailRequest{Locator: store.Locator{SiteID: siteID}, UserID: um.ID, Detail: engine.UserLevel, Update: um.Details.Level}
 			_, err := s.Engine.UserDetail(req)
 			errs = append(errs, err)
 		}
+		if um.Blocked.Status && um.Details.BlockReason != "" {
+			errs = append(errs, s.SetBlockReason(siteID, um.ID, um.Details.BlockReason))
+		}
 	}
 
 	return errors.Join(errs...)
@@ -948,17 +1329,25 @@ func (s *DataStore) SetMetas(siteID string, umetas []UserMetaData, pmetas []Post
 func (s *DataStore) User(siteID, userID string, limit, skip int, user store.User) ([]store.Comment, error) {
 	req := engine.FindRequest{Locator: store.Locator{SiteID: siteID}, UserID: userID,
 		Limit: limit, Skip: skip, Sort: "-time"}
-	comments, err := s.Engine.Find(req)
+	comments, err := s.findUser(req)
 	if err != nil {
 		return comments, err
 	}
-	return s.alterComments(comments, user), nil
+	return s.alterComments(visibleComments(comments, user), user), nil
 }
 
 // UserCount is comments count by user
 func (s *DataStore) UserCount(siteID, userID string) (int, error) {
 	req := engine.FindRequest{Locator: store.Locator{SiteID: siteID}, UserID: userID}
-	return s.Engine.Count(req)
+	count, err := s.Engine.Count(req)
+	frozen, e := s.coldUserComments(siteID, userID)
+	if e != nil {
+		return 0, e
+	}
+	if err != nil && len(frozen) > 0 { // engine fails for user without comments in it
+		return len(frozen), nil
+	}
+	return count + len(frozen), err
 }
 
 // Last gets last comments for site, cross-post. Limited by count and optional since ts
@@ -968,7 +1357,29 @@ func (s *DataStore) Last(siteID string, limit int, since time.Time, user store.U
 	if err != nil {
 		return comments, err
 	}
-	return s.alterComments(comments, user), nil
+	// last comments shared by all non-admin users, so private replies are not shown here even to their recipients
+	return s.alterComments(visibleComments(comments, store.User{Admin: user.Admin}), user), nil
+}
+
+// Controversial returns the most controversial comments of the site among the last ones posted after since,
+// i.e. comments with both up and down votes, sorted by controversy. Deleted comments skipped.
+func (s *DataStore) Controversial(siteID string, since time.Time, limit int) ([]store.Comment, error) {
+	req := engine.FindRequest{Locator: store.Locator{SiteID: siteID}, Since: since, Sort: "-controversy"}
+	comments, err := s.Engine.Find(req)
+	if err != nil {
+		return nil, err
+	}
+	res := []store.Comment{}
+	for _, c := range comments {
+		if c.Deleted || c.Controversy <= 0 {
+			continue
+		}
+		res = append(res, c)
+		if limit > 0 && len(res) >= limit {
+			break
+		}
+	}
+	return s.alterComments(res, store.User{Admin: true}), nil
 }
 
 // Close store service
@@ -977,9 +1388,54 @@ func (s *DataStore) Close() error {
 	if s.repliesCache.LoadingCache != nil {
 		errs = append(errs, s.repliesCache.Close())
 	}
+	if s.rolesCache.LoadingCache != nil {
+		errs = append(errs, s.rolesCache.Close())
+	}
 	if s.TitleExtractor != nil {
 		errs = append(errs, s.TitleExtractor.Close())
 	}
+	if s.PageChecker != nil {
+		errs = append(errs, s.PageChecker.Close())
+	}
+	if s.PollStore != nil {
+		errs = append(errs, s.PollStore.Close())
+	}
+	if s.EventPublisher != nil {
+		errs = append(errs, s.EventPublisher.Close())
+	}
+	if s.EventStore != nil {
+		errs = append(errs, s.EventStore.Close())
+	}
+	if s.HighlightStore != nil {
+		errs = append(errs, s.HighlightStore.Close())
+	}
+	if s.AssetStore != nil {
+		errs = append(errs, s.AssetStore.Close())
+	}
+	if s.Quotas != nil {
+		errs = append(errs, s.Quotas.Close())
+	}
+	if s.InviteStore != nil {
+		errs = append(errs, s.InviteStore.Close())
+	}
+	if s.BotStore != nil {
+		errs = append(errs, s.BotStore.Close())
+	}
+	if s.ScheduleStore != nil {
+		errs = append(errs, s.ScheduleStore.Close())
+	}
+	if s.ColdStore != nil {
+		errs = append(errs, s.ColdStore.Close())
+	}
+	if s.PageStore != nil {
+		errs = append(errs, s.PageStore.Close())
+	}
+	if s.SuppressStore != nil {
+		errs = append(errs, s.SuppressStore.Close())
+	}
+	if s.SettingsStore != nil {
+		errs = append(errs, s.SettingsStore.Close())
+	}
 	errs = append(errs, s.Engine.Close())
 	return errors.Join(errs...)
 }
@@ -1010,6 +1466,17 @@ func (s *DataStore) getScopedLocks(id string) (lock sync.Locker) {
 	return lock
 }
 
+// visibleComments filters out comments user not allowed to see, like moderator notes and private replies
+func visibleComments(cc []store.Comment, user store.User) []store.Comment {
+	res := make([]store.Comment, 0, len(cc))
+	for _, c := range cc {
+		if c.VisibleTo(user) {
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
 func (s *DataStore) alterComments(cc []store.Comment, user store.User) (res []store.Comment) {
 	res = make([]store.Comment, len(cc))
 	flags := s.newUserFlagCache()
@@ -1026,6 +1493,8 @@ func (s *DataStore) alterComment(c store.Comment, user store.User) (res store.Co
 // alterCommentCached is alterComment sharing a userFlagCache so that block/verified
 // lookups for a user repeated across a listing hit the engine only once.
 func (s *DataStore) alterCommentCached(c store.Comment, user store.User, flags *userFlagCache) (res store.Comment) {
+	c = s.rerender(c)
+
 	// mark user blocked
 	if flags.blocked(c.Locator.SiteID, c.User.ID) {
 		c.User.Blocked = true
@@ -1036,23 +1505,60 @@ func (s *DataStore) alterCommentCached(c store.Comment, user store.User, flags *
 		c.User.Verified = flags.verified(c.Locator.SiteID, c.User.ID)
 	}
 
+	// set user level for sites with levels enabled
+	c.User.Level = string(flags.level(c.Locator.SiteID, c.User.ID))
+
+	// apply user-selected display name and pronouns
+	if flags.profileEnabled(c.Locator.SiteID) {
+		profile := flags.profile(c.Locator.SiteID, c.User.ID)
+		if profile.DisplayName != "" {
+			c.User.Name = profile.DisplayName
+		}
+		c.User.Pronouns = profile.Pronouns
+	}
+
 	// hide info from non-admins
 	if !user.Admin {
 		c.User.IP = ""
 	}
 
+	c.Edited = c.Edit != nil
+
+	// comments stored before plain text support
+	if c.PlainText == "" && c.Text != "" {
+		c.PlainText = store.PlainText(c.Text)
+	}
+
 	c = s.prepVotes(c, user)
 	c.Locator.URL = c.SanitizeAsURL(c.Locator.URL) // urls prior to #927
 	c.PostTitle = c.SanitizeText(c.PostTitle)
 	return c
 }
 
-// userFlagCache memoises engine block/verified flag lookups by site and user within
+// markIgnored sets Ignored for comments written by users ignored by the given user
+func (s *DataStore) markIgnored(comments []store.Comment, siteID, userID string) {
+	ignored, err := s.IgnoredUsers(siteID, userID)
+	if err != nil {
+		log.Printf("[WARN] can't get ignored users for %s, %v", userID, err)
+		return
+	}
+	if len(ignored) == 0 {
+		return
+	}
+	for i := range comments {
+		comments[i].Ignored = slices.Contains(ignored, comments[i].User.ID)
+	}
+}
+
+// userFlagCache memoises engine block/verified flag, profile and level lookups by site and user within
 // a single listing, avoiding two engine.Flag calls per comment for repeated users.
 type userFlagCache struct {
 	s         *DataStore
 	blockedM  map[flagKey]bool
 	verifiedM map[flagKey]bool
+	profileM  map[flagKey]UserProfile
+	levelM    map[flagKey]store.UserLevel
+	profileOn map[string]bool // profile policy enabled, by site
 }
 
 type flagKey struct {
@@ -1061,7 +1567,8 @@ type flagKey struct {
 }
 
 func (s *DataStore) newUserFlagCache() *userFlagCache {
-	return &userFlagCache{s: s, blockedM: map[flagKey]bool{}, verifiedM: map[flagKey]bool{}}
+	return &userFlagCache{s: s, blockedM: map[flagKey]bool{}, verifiedM: map[flagKey]bool{}, profileM: map[flagKey]UserProfile{},
+		levelM: map[flagKey]store.UserLevel{}, profileOn: map[string]bool{}}
 }
 
 func (f *userFlagCache) blocked(siteID, userID string) bool {
@@ -1092,6 +1599,44 @@ func (f *userFlagCache) verified(siteID, userID string) bool {
 	return v
 }
 
+func (f *userFlagCache) level(siteID, userID string) store.UserLevel {
+	key := flagKey{siteID: siteID, userID: userID}
+	if v, ok := f.levelM[key]; ok {
+		return v
+	}
+	if !f.s.SiteLevelPolicy(siteID).Enabled() {
+		return ""
+	}
+	v := store.LevelVerified
+	if !f.verified(siteID, userID) {
+		v = f.s.storedLevel(siteID, userID)
+	}
+	f.levelM[key] = v
+	return v
+}
+
+func (f *userFlagCache) profileEnabled(siteID string) bool {
+	if v, ok := f.profileOn[siteID]; ok {
+		return v
+	}
+	policy, err := f.s.profilePolicy(siteID)
+	f.profileOn[siteID] = err == nil && policy.Enabled
+	return f.profileOn[siteID]
+}
+
+func (f *userFlagCache) profile(siteID, userID string) UserProfile {
+	key := flagKey{siteID: siteID, userID: userID}
+	if v, ok := f.profileM[key]; ok {
+		return v
+	}
+	v, err := f.s.GetUserProfile(siteID, userID)
+	if err != nil {
+		return UserProfile{} // don't cache on error, retry on the next comment for this user
+	}
+	f.profileM[key] = v
+	return v
+}
+
 // prepare vote info for client view
 func (s *DataStore) prepVotes(c store.Comment, user store.User) store.Comment {
 	c.Vote = 0 // default is "none" (not voted)
@@ -1104,8 +1649,9 @@ func (s *DataStore) prepVotes(c store.Comment, user store.User) store.Comment {
 		}
 	}
 
-	c.Votes = nil    // hide voters list
-	c.VotedIPs = nil // hide voted ips (hashes)
+	c.Votes = nil       // hide voters list
+	c.VotedIPs = nil    // hide voted ips (hashes)
+	c.VoteWeights = nil // hide weights of voters
 	return c
 }
 
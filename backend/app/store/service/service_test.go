@@ -173,6 +173,58 @@ func TestService_CreateFromPartialWithTitle(t *testing.T) {
 	assert.Equal(t, "post blah", res.PostTitle, "keep comment title")
 }
 
+func TestService_CommentVisibility(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+
+	_, err := b.Create(store.Comment{ID: "staff-1", ParentID: "id-1", Text: "staff note", Locator: locator,
+		User: store.User{ID: "admin1", Name: "admin", Admin: true}, Visibility: store.VisibilityStaff})
+	require.NoError(t, err)
+	_, err = b.Create(store.Comment{ID: "private-1", ParentID: "id-1", Text: "private reply", Locator: locator,
+		User: store.User{ID: "admin1", Name: "admin", Admin: true}, Visibility: store.VisibilityPrivate})
+	require.NoError(t, err)
+	_, err = b.Create(store.Comment{ID: "private-2", ParentID: "bad-id", Text: "private reply", Locator: locator,
+		User: store.User{ID: "admin1", Name: "admin", Admin: true}, Visibility: store.VisibilityPrivate})
+	require.Error(t, err, "private reply without existing parent")
+
+	c, err := b.Engine.Get(getReq(locator, "private-1"))
+	require.NoError(t, err)
+	assert.Equal(t, "user1", c.PrivateTo, "addressed to the author of the parent comment")
+
+	ids := func(cc []store.Comment) (res []string) {
+		for _, c := range cc {
+			res = append(res, c.ID)
+		}
+		return res
+	}
+
+	tbl := []struct {
+		user store.User
+		find []string
+		last []string
+	}{
+		{store.User{}, []string{"id-1", "id-2"}, []string{"id-2", "id-1"}},
+		{store.User{ID: "user2"}, []string{"id-1", "id-2"}, []string{"id-2", "id-1"}},
+		{store.User{ID: "user1"}, []string{"id-1", "id-2", "private-1"}, []string{"id-2", "id-1"}},
+		{store.User{ID: "admin1", Admin: true}, []string{"id-1", "id-2", "staff-1", "private-1"},
+			[]string{"private-1", "staff-1", "id-2", "id-1"}},
+	}
+	for i, tt := range tbl {
+		comments, err := b.Find(locator, "time", tt.user)
+		require.NoError(t, err)
+		assert.Equal(t, tt.find, ids(comments), "find, case #%d", i)
+		comments, err = b.Last("radio-t", 10, time.Time{}, tt.user)
+		require.NoError(t, err)
+		assert.Equal(t, tt.last, ids(comments), "last, case #%d", i)
+	}
+
+	comments, err := b.User("radio-t", "admin1", 10, 0, store.User{ID: "user1"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"private-1"}, ids(comments))
+}
+
 func TestService_Put(t *testing.T) {
 	ks := admin.NewStaticKeyStore("secret 123")
 	eng, teardown := prepStoreEngine(t)
@@ -773,6 +825,51 @@ func TestService_Controversy(t *testing.T) {
 	}
 }
 
+func TestService_Controversial(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123"), MaxVotes: -1}
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+
+	res, err := b.Controversial("radio-t", time.Time{}, 10)
+	require.NoError(t, err)
+	assert.Empty(t, res, "no votes, nothing controversial")
+
+	vote := func(id, user string, val bool) {
+		_, e := b.Vote(VoteReq{Locator: locator, CommentID: id, UserID: user, Val: val})
+		require.NoError(t, e)
+	}
+	vote("id-1", "user2", true)
+	vote("id-1", "user3", false)
+	vote("id-2", "user2", true)
+	vote("id-2", "user3", false)
+	vote("id-2", "user4", true)
+	vote("id-2", "user5", false)
+
+	res, err = b.Controversial("radio-t", time.Time{}, 10)
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	assert.Equal(t, "id-2", res[0].ID, "more votes, more controversial")
+	assert.InDelta(t, 4, res[0].Controversy, 0.01)
+	assert.Equal(t, "id-1", res[1].ID)
+	assert.InDelta(t, 2, res[1].Controversy, 0.01)
+
+	res, err = b.Controversial("radio-t", time.Time{}, 1)
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	assert.Equal(t, "id-2", res[0].ID)
+
+	require.NoError(t, b.Delete(locator, "id-2", store.SoftDelete))
+	res, err = b.Controversial("radio-t", time.Time{}, 10)
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	assert.Equal(t, "id-1", res[0].ID, "deleted comment skipped")
+
+	res, err = b.Controversial("radio-t", time.Date(2017, 12, 20, 15, 18, 22, 0, time.UTC), 10)
+	require.NoError(t, err)
+	assert.Empty(t, res, "comments before since skipped")
+}
+
 func TestService_Pin(t *testing.T) {
 	eng, teardown := prepStoreEngine(t)
 	defer teardown()
@@ -827,6 +924,41 @@ func TestService_EditComment(t *testing.T) {
 	assert.NoError(t, err, "allow second edit")
 }
 
+func TestService_PlainText(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+	defer b.Close()
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+
+	// comments stored without plain text get it on read
+	comments, err := b.Find(locator, "time", store.User{})
+	require.NoError(t, err)
+	require.Len(t, comments, 2)
+	assert.Equal(t, "some text, link", comments[0].PlainText)
+
+	// set from rendered text on creation, unless provided by the formatter
+	id, err := b.Create(store.Comment{Text: "<p>imported <b>comment</b></p>", Locator: locator, User: store.User{ID: "user1"}})
+	require.NoError(t, err)
+	c, err := b.Engine.Get(getReq(locator, id))
+	require.NoError(t, err)
+	assert.Equal(t, "imported comment", c.PlainText)
+
+	id, err = b.Create(store.Comment{Text: "<p>formatted</p>", PlainText: "formatted", Locator: locator, User: store.User{ID: "user1"}})
+	require.NoError(t, err)
+	c, err = b.Engine.Get(getReq(locator, id))
+	require.NoError(t, err)
+	assert.Equal(t, "formatted", c.PlainText)
+
+	// updated on edit
+	c, err = b.EditComment(locator, id, EditRequest{Orig: "edited **text**", Text: "<p>edited <strong>text</strong></p>"})
+	require.NoError(t, err)
+	assert.Equal(t, "edited text", c.PlainText)
+	c, err = b.Engine.Get(getReq(locator, id))
+	require.NoError(t, err)
+	assert.Equal(t, "edited text", c.PlainText)
+}
+
 func TestService_DeleteComment(t *testing.T) {
 	eng, teardown := prepStoreEngine(t)
 	defer teardown()
@@ -930,6 +1062,11 @@ func TestService_ValidateComment(t *testing.T) {
 		{inp: store.Comment{Orig: "here is a link with relative URL: [google.com](url)", User: store.User{ID: "myid", Name: "name"}}, err: "links should start with mailto:, http:// or https://"},
 		{inp: store.Comment{Orig: "here is a link with relative URL: [google.com](url)", User: store.User{ID: "myid", Name: "name"}}, err: "links should start with mailto:, http:// or https://"},
 		{inp: store.Comment{Orig: "multiple links, one is bad: [test](http://test) [test2](bad_url) [test3](https://test3)", User: store.User{ID: "myid", Name: "name"}}, err: "links should start with mailto:, http:// or https://"},
+		{inp: store.Comment{Orig: "staff note", Visibility: store.VisibilityStaff, User: store.User{ID: "myid", Name: "name", Admin: true}}, err: ""},
+		{inp: store.Comment{Orig: "staff note", Visibility: store.VisibilityStaff, User: store.User{ID: "myid", Name: "name"}}, err: "only admins can post staff comments"},
+		{inp: store.Comment{Orig: "private reply", Visibility: store.VisibilityPrivate, ParentID: "p1", User: store.User{ID: "myid", Name: "name", Admin: true}}, err: ""},
+		{inp: store.Comment{Orig: "private reply", Visibility: store.VisibilityPrivate, User: store.User{ID: "myid", Name: "name", Admin: true}}, err: "private comment should be a reply"},
+		{inp: store.Comment{Orig: "some comment", Visibility: "bad", User: store.User{ID: "myid", Name: "name", Admin: true}}, err: `unknown comment visibility "bad"`},
 	}
 
 	for n, tt := range tbl {
@@ -1099,6 +1236,51 @@ func TestService_UserDetailsOperations(t *testing.T) {
 	assert.Empty(t, result)
 }
 
+func TestService_IgnoredUsers(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+
+	ignored, err := b.IgnoredUsers("radio-t", "user2")
+	require.NoError(t, err)
+	assert.Empty(t, ignored)
+
+	require.NoError(t, b.SetIgnored("radio-t", "user2", "user1", true))
+	require.NoError(t, b.SetIgnored("radio-t", "user2", "user3", true))
+	require.NoError(t, b.SetIgnored("radio-t", "user2", "user1", true), "repeated ignore")
+	ignored, err = b.IgnoredUsers("radio-t", "user2")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user1", "user3"}, ignored)
+
+	assert.EqualError(t, b.SetIgnored("radio-t", "user2", "user2", true), "user user2 can't ignore himself")
+	assert.EqualError(t, b.SetIgnored("radio-t", "user2", "a,b", true), `invalid user id "a,b"`)
+	assert.EqualError(t, b.SetIgnored("bad", "user2", "user1", true), `can't get ignored users for user2: site "bad" not found`)
+
+	// comments of ignored user marked for the user who ignores only
+	comments, err := b.Find(store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}, "time", store.User{ID: "user2"})
+	require.NoError(t, err)
+	require.Len(t, comments, 2)
+	assert.True(t, comments[0].Ignored)
+	assert.True(t, comments[1].Ignored)
+	comments, err = b.Find(store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}, "time", store.User{ID: "user3"})
+	require.NoError(t, err)
+	assert.False(t, comments[0].Ignored)
+
+	require.NoError(t, b.SetIgnored("radio-t", "user2", "user1", false))
+	require.NoError(t, b.SetIgnored("radio-t", "user2", "user1", false), "repeated unignore")
+	ignored, err = b.IgnoredUsers("radio-t", "user2")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user3"}, ignored)
+	comments, err = b.Find(store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}, "time", store.User{ID: "user2"})
+	require.NoError(t, err)
+	assert.False(t, comments[0].Ignored)
+
+	require.NoError(t, b.SetIgnored("radio-t", "user2", "user3", false))
+	ignored, err = b.IgnoredUsers("radio-t", "user2")
+	require.NoError(t, err)
+	assert.Empty(t, ignored)
+}
+
 func TestService_IsAdmin(t *testing.T) {
 	// two comments for https://radio-t.com
 	eng, teardown := prepStoreEngine(t)
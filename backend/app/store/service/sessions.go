@@ -0,0 +1,61 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-pkgz/lcw/v2"
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+// notBeforeCacheTTL limits how long other instances sharing the engine may accept revoked tokens
+const notBeforeCacheTTL = time.Minute
+
+// RevokeTokens revokes all tokens of the user issued so far, logging the user out on all devices.
+// Returns the time tokens issued before are rejected, the user can log in again right away.
+func (s *DataStore) RevokeTokens(siteID, userID string) (time.Time, error) {
+	if userID == "" {
+		return time.Time{}, fmt.Errorf("can't revoke tokens of empty user on %s", siteID)
+	}
+	// token's issue time has seconds precision, tokens issued in the same second are kept
+	notBefore := time.Now().UTC().Truncate(time.Second)
+	_, err := s.Engine.UserDetail(engine.UserDetailRequest{Locator: store.Locator{SiteID: siteID}, UserID: userID,
+		Detail: engine.UserNotBefore, Update: notBefore.Format(time.RFC3339)})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("can't revoke tokens of %s on %s: %w", userID, siteID, err)
+	}
+	if s.notBeforeCache.LoadingCache != nil {
+		s.notBeforeCache.Delete(siteID + "/" + userID)
+	}
+	log.Printf("[INFO] tokens of %s on %s issued before %s revoked", userID, siteID, notBefore.Format(time.RFC3339))
+	return notBefore, nil
+}
+
+// TokensNotBefore returns the time tokens of the user issued before are revoked, zero if never revoked
+func (s *DataStore) TokensNotBefore(siteID, userID string) (time.Time, error) {
+	res, err := s.Engine.UserDetail(engine.UserDetailRequest{Locator: store.Locator{SiteID: siteID}, UserID: userID,
+		Detail: engine.UserNotBefore})
+	if err != nil || len(res) != 1 || res[0].NotBefore == "" {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339, res[0].NotBefore)
+}
+
+// IsTokenRevoked checks if the token of the user issued at the time is revoked. Called on each authenticated
+// request, so revocations are cached, changes made by this instance applied immediately.
+// Tokens are accepted if the revocation can't be read, to keep the site working with the engine down.
+func (s *DataStore) IsTokenRevoked(siteID, userID string, issued time.Time) bool {
+	s.notBeforeCache.once.Do(func() {
+		o := lcw.NewOpts[time.Time]()
+		s.notBeforeCache.LoadingCache, _ = lcw.NewExpirableCache[time.Time](o.TTL(notBeforeCacheTTL), o.MaxKeys(10000))
+	})
+	notBefore, err := s.notBeforeCache.Get(siteID+"/"+userID, func() (time.Time, error) { return s.TokensNotBefore(siteID, userID) })
+	if err != nil {
+		log.Printf("[WARN] can't get revoked tokens of %s on %s, %v", userID, siteID, err)
+		return false
+	}
+	return issued.Before(notBefore)
+}
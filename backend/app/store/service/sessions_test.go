@@ -0,0 +1,50 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+func TestService_RevokeTokens(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+
+	notBefore, err := b.TokensNotBefore("radio-t", "user1")
+	require.NoError(t, err)
+	assert.True(t, notBefore.IsZero(), "never revoked")
+	issued := time.Now().Add(-time.Hour)
+	assert.False(t, b.IsTokenRevoked("radio-t", "user1", issued))
+
+	notBefore, err = b.RevokeTokens("radio-t", "user1")
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), notBefore, 2*time.Second)
+	stored, err := b.TokensNotBefore("radio-t", "user1")
+	require.NoError(t, err)
+	assert.True(t, notBefore.Equal(stored))
+
+	assert.True(t, b.IsTokenRevoked("radio-t", "user1", issued), "cached value reset by revocation")
+	assert.True(t, b.IsTokenRevoked("radio-t", "user1", time.Time{}), "token without issue time")
+	assert.False(t, b.IsTokenRevoked("radio-t", "user1", notBefore), "issued in the same second")
+	assert.False(t, b.IsTokenRevoked("radio-t", "user1", time.Now().Add(time.Second)))
+	assert.False(t, b.IsTokenRevoked("radio-t", "user2", issued), "other user")
+
+	_, err = b.RevokeTokens("radio-t", "")
+	assert.EqualError(t, err, "can't revoke tokens of empty user on radio-t")
+
+	// revocation made by other instance seen after the cache expired
+	require.NoError(t, eng.Delete(engine.DeleteRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "user1",
+		UserDetail: engine.UserNotBefore}))
+	assert.True(t, b.IsTokenRevoked("radio-t", "user1", issued), "cached")
+	b.notBeforeCache.Purge()
+	assert.False(t, b.IsTokenRevoked("radio-t", "user1", issued))
+
+	assert.False(t, b.IsTokenRevoked("bad", "user1", issued), "accepted on engine error")
+}
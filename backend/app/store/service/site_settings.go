@@ -0,0 +1,117 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/umputun/remark42/backend/app/store/settings"
+)
+
+// RestoreSettings loads runtime changes of edit, collapse and expression policies, canned responses and client stats
+// saved in SettingsStore, further changes saved there. Policies set with static listers are not changeable and skipped.
+func (s *DataStore) RestoreSettings() error {
+	if s.SettingsStore == nil {
+		return nil
+	}
+	if policies, ok := s.EditPolicy.(*EditPolicies); ok {
+		if err := policies.Restore(s.SettingsStore); err != nil {
+			return err
+		}
+	}
+	if policies, ok := s.CollapsePolicy.(*CollapsePolicies); ok {
+		if err := policies.Restore(s.SettingsStore); err != nil {
+			return err
+		}
+	}
+	if s.ExprPolicy != nil {
+		if err := s.ExprPolicy.Restore(s.SettingsStore); err != nil {
+			return err
+		}
+	}
+	if s.CannedResponses != nil {
+		if err := s.CannedResponses.Restore(s.SettingsStore); err != nil {
+			return err
+		}
+	}
+	if s.ClientStats != nil {
+		return s.ClientStats.Restore(s.SettingsStore)
+	}
+	return nil
+}
+
+// siteSettings keeps per-site values changed at runtime, saved to the settings store once it is set.
+// Without the store values are kept in memory only. Thread safe.
+type siteSettings[T any] struct {
+	name  string // name of the setting in the store
+	mu    sync.RWMutex
+	sites map[string]T
+	store settings.Store
+}
+
+// get returns the site's value, false if not set
+func (s *siteSettings[T]) get(siteID string) (res T, ok bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	res, ok = s.sites[siteID]
+	return res, ok
+}
+
+// set saves the site's value to the store, if any, and keeps it
+func (s *siteSettings[T]) set(siteID string, v T) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.store != nil {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("can't marshal %s of %s: %w", s.name, siteID, err)
+		}
+		if err = s.store.Set(s.name, siteID, data); err != nil {
+			return fmt.Errorf("can't save %s of %s: %w", s.name, siteID, err)
+		}
+	}
+	if s.sites == nil {
+		s.sites = map[string]T{}
+	}
+	s.sites[siteID] = v
+	return nil
+}
+
+// reset removes the site's value from the store, if any, and from memory
+func (s *siteSettings[T]) reset(siteID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.store != nil {
+		if err := s.store.Delete(s.name, siteID); err != nil {
+			return fmt.Errorf("can't remove %s of %s: %w", s.name, siteID, err)
+		}
+	}
+	delete(s.sites, siteID)
+	return nil
+}
+
+// restore replaces values with ones saved in the store and keeps further changes there.
+// Saved values are checked by the check func, if set, and rejected ones fail the restore.
+func (s *siteSettings[T]) restore(store settings.Store, check func(v T) error) error {
+	saved, err := store.All(s.name)
+	if err != nil {
+		return fmt.Errorf("can't load %s: %w", s.name, err)
+	}
+	sites := make(map[string]T, len(saved))
+	for siteID, data := range saved {
+		var v T
+		if err = json.Unmarshal(data, &v); err != nil {
+			return fmt.Errorf("can't unmarshal %s of %s: %w", s.name, siteID, err)
+		}
+		if check != nil {
+			if err = check(v); err != nil {
+				return fmt.Errorf("invalid %s of %s: %w", s.name, siteID, err)
+			}
+		}
+		sites[siteID] = v
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sites, s.store = sites, store
+	return nil
+}
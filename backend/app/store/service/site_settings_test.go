@@ -0,0 +1,71 @@
+package service
+
+import (
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/umputun/remark42/backend/app/store/settings"
+)
+
+func TestService_RestoreSettings(t *testing.T) {
+	file := path.Join(t.TempDir(), "settings.db")
+	newStore := func() *DataStore {
+		settingsStore, err := settings.NewBoltStorage(file, bolt.Options{})
+		require.NoError(t, err)
+		exprPolicies, err := NewExprPolicies(ExprPolicy{})
+		require.NoError(t, err)
+		b := &DataStore{
+			SettingsStore:   settingsStore,
+			EditPolicy:      NewEditPolicies(EditPolicy{Duration: time.Minute}),
+			CollapsePolicy:  NewCollapsePolicies(CollapsePolicy{Mode: CollapseOff}),
+			ExprPolicy:      exprPolicies,
+			CannedResponses: NewCannedResponses([]CannedResponse{{ID: "civil", Text: "keep it civil"}}),
+			ClientStats:     NewClientStats(),
+		}
+		require.NoError(t, b.RestoreSettings())
+		return b
+	}
+
+	b := newStore()
+	require.NoError(t, b.SetEditPolicy("site1", EditPolicy{Duration: time.Hour, AdminDuration: 2 * time.Hour}))
+	require.NoError(t, b.SetCollapsePolicy("site1", CollapsePolicy{Mode: CollapseHide, Threshold: -3}))
+	require.NoError(t, b.SetCollapsePolicy("site2", CollapsePolicy{Mode: CollapseCollapse}))
+	require.NoError(t, b.ResetCollapsePolicy("site2"))
+	require.NoError(t, b.SetExprPolicy("site1", ExprPolicy{Moderation: `comment.links > 1 ? "hold" : ""`}))
+	require.NoError(t, b.DeleteCannedResponse("site1", "civil"))
+	require.NoError(t, b.SetCannedResponse("site1", CannedResponse{ID: "spam", Text: "no spam"}))
+	b.RecordClient("site1", ClientInfo{Browser: "firefox", Embed: true, Referrer: "example.com"})
+	since := b.ClientStats.Report("site1").Since
+	require.NoError(t, b.SettingsStore.Close())
+
+	b = newStore() // restart
+	defer b.SettingsStore.Close()
+	assert.Equal(t, EditPolicy{Duration: time.Hour, AdminDuration: 2 * time.Hour}, b.SiteEditPolicy("site1"))
+	assert.Equal(t, EditPolicy{Duration: time.Minute}, b.SiteEditPolicy("site2"))
+	assert.Equal(t, CollapsePolicy{Mode: CollapseHide, Threshold: -3}, b.SiteCollapsePolicy("site1"))
+	assert.Equal(t, CollapsePolicy{Mode: CollapseOff}, b.SiteCollapsePolicy("site2"), "reset kept")
+	assert.Equal(t, ExprPolicy{Moderation: `comment.links > 1 ? "hold" : ""`}, b.SiteExprPolicy("site1"))
+	assert.NotNil(t, b.ExprPolicy.programs("site1").moderation, "compiled on load")
+	assert.Equal(t, []CannedResponse{{ID: "spam", Text: "no spam"}}, b.ListCannedResponses("site1"))
+	assert.Equal(t, []CannedResponse{{ID: "civil", Text: "keep it civil"}}, b.ListCannedResponses("site2"))
+	stats, err := b.ClientStatsReport("site1")
+	require.NoError(t, err)
+	assert.True(t, since.Equal(stats.Since), "since kept")
+	stats.Since = since
+	assert.Equal(t, ClientStatsReport{Since: since, Total: 1, Embed: 1, Browsers: map[string]int{"firefox": 1},
+		Referrers: map[string]int{"example.com": 1}}, stats)
+
+	// saved policy rejected on load fails the restore
+	require.NoError(t, b.SettingsStore.Set("edit_policy", "site3", []byte(`{"duration":-1}`)))
+	require.NoError(t, b.SettingsStore.Set("expr_policy", "site3", []byte(`{"moderation":"1 +"}`)))
+	assert.EqualError(t, b.EditPolicy.(*EditPolicies).Restore(b.SettingsStore),
+		"invalid edit_policy of site3: edit duration can't be negative")
+	assert.ErrorContains(t, b.ExprPolicy.Restore(b.SettingsStore), "can't unmarshal expr_policy of site3")
+
+	assert.NoError(t, (&DataStore{}).RestoreSettings(), "no settings store")
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/engine"
+	"github.com/umputun/remark42/backend/app/store/suppress"
+)
+
+// SuppressEmail stops all emails to the address reported by the email provider for a permanent bounce
+// or a spam complaint. The address is stored sealed or encrypted same as users' emails.
+func (s *DataStore) SuppressEmail(address, kind, source string) (suppress.Suppression, error) {
+	if s.SuppressStore == nil {
+		return suppress.Suppression{}, errors.New("email suppression is not enabled")
+	}
+	address = strings.TrimSpace(address)
+	if address == "" {
+		return suppress.Suppression{}, errors.New("empty address")
+	}
+	stored, err := s.storedEmail(address)
+	if err != nil {
+		return suppress.Suppression{}, fmt.Errorf("can't store suppressed address: %w", err)
+	}
+	res, err := s.SuppressStore.Add(s.suppressionKey(address),
+		suppress.Suppression{Address: stored, Kind: kind, Source: source, Updated: time.Now()})
+	if err != nil {
+		return suppress.Suppression{}, fmt.Errorf("can't suppress address: %w", err)
+	}
+	res.Address = address
+	return res, nil
+}
+
+// EmailSuppressed checks if emails to the address are suppressed. Failed check doesn't suppress the address.
+func (s *DataStore) EmailSuppressed(address string) bool {
+	if s.SuppressStore == nil || strings.TrimSpace(address) == "" {
+		return false
+	}
+	_, err := s.SuppressStore.Get(s.suppressionKey(address))
+	if err != nil && !errors.Is(err, suppress.ErrNotFound) {
+		log.Printf("[WARN] can't check email suppression, %v", err)
+	}
+	return err == nil
+}
+
+// EmailSuppressions returns suppressed addresses, recently reported first
+func (s *DataStore) EmailSuppressions() ([]suppress.Suppression, error) {
+	if s.SuppressStore == nil {
+		return []suppress.Suppression{}, nil
+	}
+	res, err := s.SuppressStore.List()
+	if err != nil {
+		return nil, fmt.Errorf("can't list suppressions: %w", err)
+	}
+	for i := range res {
+		if res[i].Address, err = s.readEmail(res[i].Address); err != nil {
+			return nil, fmt.Errorf("can't read suppressed address: %w", err)
+		}
+	}
+	return res, nil
+}
+
+// ReinstateEmail removes suppression of the address, emails to it are sent again
+func (s *DataStore) ReinstateEmail(address string) error {
+	if s.SuppressStore == nil {
+		return errors.New("email suppression is not enabled")
+	}
+	if err := s.SuppressStore.Delete(s.suppressionKey(address)); err != nil {
+		return fmt.Errorf("can't reinstate address: %w", err)
+	}
+	return nil
+}
+
+// suppressionKey identifies suppressed address, its salted hash with PII minimization enabled
+func (s *DataStore) suppressionKey(address string) string {
+	return s.EmailToken(strings.ToLower(strings.TrimSpace(address)))
+}
+
+// UnsubscribeEmail removes email subscription of all users of the site subscribed with the address,
+// used when the address bounces or its owner complains about notifications. Returns ids of unsubscribed users.
+func (s *DataStore) UnsubscribeEmail(siteID, address string) ([]string, error) {
+	address = strings.TrimSpace(address)
+	if address == "" {
+		return nil, nil
+	}
+	details, err := s.Engine.UserDetail(engine.UserDetailRequest{Locator: store.Locator{SiteID: siteID}, Detail: engine.AllUserDetails})
+	if err != nil {
+		return nil, fmt.Errorf("can't get user details of %s: %w", siteID, err)
+	}
+	res := []string{}
+	for _, d := range details {
+		if d.Email == "" {
+			continue
+		}
+		email, e := s.readEmail(d.Email)
+		if e != nil {
+			log.Printf("[WARN] can't read email of %s, %v", d.UserID, e)
+			continue
+		}
+		if !strings.EqualFold(strings.TrimSpace(email), address) {
+			continue
+		}
+		if err = s.DeleteUserDetail(siteID, d.UserID, engine.UserEmail); err != nil {
+			return res, fmt.Errorf("can't unsubscribe %s: %w", d.UserID, err)
+		}
+		res = append(res, d.UserID)
+	}
+	return res, nil
+}
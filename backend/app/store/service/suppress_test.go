@@ -0,0 +1,100 @@
+package service
+
+import (
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/suppress"
+)
+
+func TestService_UnsubscribeEmail(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	vault, err := NewPIIVault("secret")
+	require.NoError(t, err)
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123"), PII: vault}
+
+	_, err = b.SetUserEmail("radio-t", "user1", "bounce@example.com")
+	require.NoError(t, err)
+	_, err = b.SetUserEmail("radio-t", "user2", "Bounce@Example.com")
+	require.NoError(t, err)
+	_, err = b.SetUserEmail("radio-t", "user3", "good@example.com")
+	require.NoError(t, err)
+	_, err = b.SetUserTelegram("radio-t", "user1", "tg1")
+	require.NoError(t, err)
+
+	res, err := b.UnsubscribeEmail("radio-t", " bounce@example.com ")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"user1", "user2"}, res)
+
+	for user, expected := range map[string]string{"user1": "", "user2": "", "user3": "good@example.com"} {
+		email, e := b.GetUserEmail("radio-t", user)
+		require.NoError(t, e)
+		assert.Equal(t, expected, email, user)
+	}
+	tg, err := b.GetUserTelegram("radio-t", "user1")
+	require.NoError(t, err)
+	assert.Equal(t, "tg1", tg, "other details kept")
+
+	res, err = b.UnsubscribeEmail("radio-t", "bounce@example.com")
+	require.NoError(t, err)
+	assert.Empty(t, res)
+	res, err = b.UnsubscribeEmail("radio-t", "")
+	require.NoError(t, err)
+	assert.Empty(t, res)
+}
+
+func TestService_SuppressEmail(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	vault, err := NewPIIVault("secret")
+	require.NoError(t, err)
+	suppressStore, err := suppress.NewBoltStorage(path.Join(t.TempDir(), "suppress.db"), bolt.Options{})
+	require.NoError(t, err)
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123"), PII: vault, SuppressStore: suppressStore}
+	defer suppressStore.Close()
+
+	assert.False(t, b.EmailSuppressed("bounce@example.com"))
+	s, err := b.SuppressEmail(" Bounce@Example.com ", "bounce", "ses")
+	require.NoError(t, err)
+	assert.Equal(t, "Bounce@Example.com", s.Address)
+	assert.Equal(t, 1, s.Count)
+	s, err = b.SuppressEmail("bounce@example.com", "complaint", "ses")
+	require.NoError(t, err)
+	assert.Equal(t, 2, s.Count, "same address")
+	_, err = b.SuppressEmail("", "bounce", "ses")
+	require.Error(t, err)
+
+	assert.True(t, b.EmailSuppressed("bounce@example.com"))
+	assert.True(t, b.EmailSuppressed("BOUNCE@example.com"))
+	assert.False(t, b.EmailSuppressed("good@example.com"))
+	assert.False(t, b.EmailSuppressed(""))
+
+	stored, err := suppressStore.List()
+	require.NoError(t, err)
+	require.Len(t, stored, 1)
+	assert.True(t, IsSealed(stored[0].Address), "address sealed with PII minimization")
+
+	res, err := b.EmailSuppressions()
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	assert.Equal(t, "bounce@example.com", res[0].Address)
+	assert.Equal(t, "complaint", res[0].Kind)
+
+	require.NoError(t, b.ReinstateEmail("Bounce@example.com"))
+	assert.False(t, b.EmailSuppressed("bounce@example.com"))
+	require.ErrorIs(t, b.ReinstateEmail("bounce@example.com"), suppress.ErrNotFound)
+
+	disabled := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+	assert.False(t, disabled.EmailSuppressed("bounce@example.com"))
+	_, err = disabled.SuppressEmail("bounce@example.com", "bounce", "ses")
+	require.EqualError(t, err, "email suppression is not enabled")
+	res, err = disabled.EmailSuppressions()
+	require.NoError(t, err)
+	assert.Empty(t, res)
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+)
+
+// TimezoneLister provides timezone per site
+type TimezoneLister interface {
+	Location(siteID string) (*time.Location, error)
+}
+
+// StaticTimezoneLister provides timezones set for sites, with default one for all other sites
+type StaticTimezoneLister struct {
+	Default *time.Location            // server's local timezone if not set
+	Sites   map[string]*time.Location // site id to timezone
+}
+
+// Location returns timezone of the site, default one if not set for the site
+func (l StaticTimezoneLister) Location(siteID string) (*time.Location, error) {
+	if loc, ok := l.Sites[siteID]; ok && loc != nil {
+		return loc, nil
+	}
+	if l.Default != nil {
+		return l.Default, nil
+	}
+	return time.Local, nil
+}
+
+// SiteLocation returns timezone used for dates shown to users of the site, server's local timezone if not set
+func (s *DataStore) SiteLocation(siteID string) *time.Location {
+	if s.Timezone == nil {
+		return time.Local
+	}
+	loc, err := s.Timezone.Location(siteID)
+	if err != nil || loc == nil {
+		log.Printf("[WARN] failed to get timezone for site %s: %v", siteID, err)
+		return time.Local
+	}
+	return loc
+}
@@ -0,0 +1,34 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type errTimezoneLister struct{}
+
+func (errTimezoneLister) Location(string) (*time.Location, error) { return nil, errors.New("failed") }
+
+func TestDataStore_SiteLocation(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	require.NoError(t, err)
+
+	b := DataStore{}
+	assert.Equal(t, time.Local, b.SiteLocation("site1"), "not set")
+
+	b.Timezone = StaticTimezoneLister{}
+	assert.Equal(t, time.Local, b.SiteLocation("site1"), "no default")
+
+	b.Timezone = StaticTimezoneLister{Default: berlin, Sites: map[string]*time.Location{"site2": tokyo}}
+	assert.Equal(t, berlin, b.SiteLocation("site1"))
+	assert.Equal(t, tokyo, b.SiteLocation("site2"))
+
+	b.Timezone = errTimezoneLister{}
+	assert.Equal(t, time.Local, b.SiteLocation("site1"), "lister error")
+}
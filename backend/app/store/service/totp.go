@@ -0,0 +1,143 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1" //nolint:gosec // RFC 6238 default, supported by all authenticator apps
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+// TOTP is the second factor of the user, time-based one-time passwords (RFC 6238) of an authenticator app
+type TOTP struct {
+	Secret    string `json:"secret"`              // base32 secret shared with the authenticator app
+	Confirmed bool   `json:"confirmed,omitempty"` // code of the authenticator app accepted at least once
+	LastStep  int64  `json:"last_step,omitempty"` // time step of the last accepted code, earlier codes rejected as replayed
+}
+
+const (
+	totpPeriod = 30 // seconds of a single code
+	totpDigits = 6
+	totpSkew   = 1 // codes of adjacent periods accepted to allow clock drift
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewTOTPSecret makes random secret of TOTP, base32 encoded as expected by authenticator apps
+func NewTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("can't make totp secret: %w", err)
+	}
+	return totpEncoding.EncodeToString(b), nil
+}
+
+// TOTPCode returns code of the secret at the given time
+func TOTPCode(secret string, t time.Time) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return "", fmt.Errorf("bad totp secret: %w", err)
+	}
+	return totpCode(key, t.Unix()/totpPeriod), nil
+}
+
+// TOTPURI returns provisioning URI of the secret, shown as QR code to be scanned by authenticator apps
+func TOTPURI(issuer, account, secret string) string {
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", strconv.Itoa(totpDigits))
+	params.Set("period", strconv.Itoa(totpPeriod))
+	return "otpauth://totp/" + url.PathEscape(issuer) + ":" + url.PathEscape(account) + "?" + params.Encode()
+}
+
+// totpCode makes HOTP code (RFC 4226) of the counter
+func totpCode(key []byte, counter int64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(counter)) //nolint:gosec // unix time steps are positive
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, code%1_000_000)
+}
+
+// TOTP returns second factor of the user, empty if the user is not enrolled
+func (s *DataStore) TOTP(siteID, userID string) (TOTP, error) {
+	res, err := s.Engine.UserDetail(engine.UserDetailRequest{Locator: store.Locator{SiteID: siteID}, UserID: userID,
+		Detail: engine.UserTOTP})
+	if err != nil || len(res) != 1 || res[0].TOTP == "" {
+		return TOTP{}, err
+	}
+	val, err := s.readDetail(res[0].TOTP)
+	if err != nil {
+		return TOTP{}, fmt.Errorf("can't read totp of %s: %w", userID, err)
+	}
+	var totp TOTP
+	if err = json.Unmarshal([]byte(val), &totp); err != nil {
+		return TOTP{}, fmt.Errorf("can't unmarshal totp of %s: %w", userID, err)
+	}
+	return totp, nil
+}
+
+// SetTOTP stores second factor of the user, encrypted with encryption enabled. Empty secret removes it.
+func (s *DataStore) SetTOTP(siteID, userID string, totp TOTP) error {
+	if totp.Secret == "" {
+		return s.Engine.Delete(engine.DeleteRequest{Locator: store.Locator{SiteID: siteID}, UserID: userID, UserDetail: engine.UserTOTP})
+	}
+	data, err := json.Marshal(totp)
+	if err != nil {
+		return fmt.Errorf("can't marshal totp of %s: %w", userID, err)
+	}
+	val, err := s.storedDetail(string(data))
+	if err != nil {
+		return fmt.Errorf("can't encrypt totp of %s: %w", userID, err)
+	}
+	_, err = s.Engine.UserDetail(engine.UserDetailRequest{Locator: store.Locator{SiteID: siteID}, UserID: userID,
+		Detail: engine.UserTOTP, Update: val})
+	return err
+}
+
+// CheckTOTP checks the code of the user's authenticator app at the given time. Accepted code confirms enrollment
+// and can't be used again. Returns false for wrong or reused code and for the user without second factor.
+func (s *DataStore) CheckTOTP(siteID, userID, code string, at time.Time) (bool, error) {
+	lock := s.getScopedLocks("totp:" + siteID + ":" + userID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	totp, err := s.TOTP(siteID, userID)
+	if err != nil || totp.Secret == "" {
+		return false, err
+	}
+	key, err := totpEncoding.DecodeString(totp.Secret)
+	if err != nil {
+		return false, fmt.Errorf("bad totp secret of %s: %w", userID, err)
+	}
+
+	step := at.Unix() / totpPeriod
+	for i := -totpSkew; i <= totpSkew; i++ {
+		if step+int64(i) <= totp.LastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step+int64(i))), []byte(code)) == 1 {
+			totp.Confirmed, totp.LastStep = true, step+int64(i)
+			if err = s.SetTOTP(siteID, userID, totp); err != nil {
+				return false, fmt.Errorf("can't store totp of %s: %w", userID, err)
+			}
+			return true, nil
+		}
+	}
+	return false, nil
+}
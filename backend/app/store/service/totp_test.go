@@ -0,0 +1,112 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+func TestTOTPCode(t *testing.T) {
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ" // "12345678901234567890" of RFC 6238 test vectors
+	tbl := []struct {
+		ts   int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tbl {
+		code, err := TOTPCode(secret, time.Unix(tt.ts, 0))
+		require.NoError(t, err)
+		assert.Equal(t, tt.code, code, "time %d", tt.ts)
+	}
+
+	_, err := TOTPCode("not base32!", time.Now())
+	assert.Error(t, err)
+
+	s1, err := NewTOTPSecret()
+	require.NoError(t, err)
+	s2, err := NewTOTPSecret()
+	require.NoError(t, err)
+	assert.Len(t, s1, 32)
+	assert.NotEqual(t, s1, s2)
+}
+
+func TestTOTPURI(t *testing.T) {
+	assert.Equal(t, "otpauth://totp/Remark42%20demo:user%20one?algorithm=SHA1&digits=6&issuer=Remark42+demo&period=30&secret=ABC",
+		TOTPURI("Remark42 demo", "user one", "ABC"))
+}
+
+func TestService_TOTP(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+
+	totp, err := b.TOTP("radio-t", "user1")
+	require.NoError(t, err)
+	assert.Empty(t, totp, "not enrolled")
+	ok, err := b.CheckTOTP("radio-t", "user1", "123456", time.Now())
+	require.NoError(t, err)
+	assert.False(t, ok, "no code of not enrolled user")
+
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	require.NoError(t, b.SetTOTP("radio-t", "user1", TOTP{Secret: secret}))
+	totp, err = b.TOTP("radio-t", "user1")
+	require.NoError(t, err)
+	assert.Equal(t, TOTP{Secret: secret}, totp)
+
+	at := time.Unix(1111111109, 0)
+	ok, err = b.CheckTOTP("radio-t", "user1", "000000", at)
+	require.NoError(t, err)
+	assert.False(t, ok, "wrong code")
+
+	prev, err := TOTPCode(secret, at.Add(-30*time.Second))
+	require.NoError(t, err)
+	ok, err = b.CheckTOTP("radio-t", "user1", prev, at)
+	require.NoError(t, err)
+	assert.True(t, ok, "code of previous period accepted")
+	totp, err = b.TOTP("radio-t", "user1")
+	require.NoError(t, err)
+	assert.True(t, totp.Confirmed)
+	assert.Equal(t, at.Unix()/30-1, totp.LastStep)
+
+	ok, err = b.CheckTOTP("radio-t", "user1", prev, at)
+	require.NoError(t, err)
+	assert.False(t, ok, "code can't be reused")
+
+	ok, err = b.CheckTOTP("radio-t", "user1", "081804", at)
+	require.NoError(t, err)
+	assert.True(t, ok, "code of current period accepted")
+
+	require.NoError(t, b.SetTOTP("radio-t", "user1", TOTP{}))
+	totp, err = b.TOTP("radio-t", "user1")
+	require.NoError(t, err)
+	assert.Empty(t, totp, "removed")
+}
+
+func TestService_TOTPEncrypted(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	cipher, err := NewDetailCipher("key1")
+	require.NoError(t, err)
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123"), DetailCipher: cipher}
+
+	require.NoError(t, b.SetTOTP("radio-t", "user1", TOTP{Secret: "ABCDEFGH"}))
+	res, err := eng.UserDetail(engine.UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "user1", Detail: engine.UserTOTP})
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	assert.True(t, IsEncrypted(res[0].TOTP))
+	assert.NotContains(t, res[0].TOTP, "ABCDEFGH")
+
+	totp, err := b.TOTP("radio-t", "user1")
+	require.NoError(t, err)
+	assert.Equal(t, "ABCDEFGH", totp.Secret)
+}
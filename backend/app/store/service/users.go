@@ -0,0 +1,220 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+// SiteUser is the summary of user's activity on the site
+type SiteUser struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Picture      string    `json:"picture,omitempty"`
+	Admin        bool      `json:"admin,omitempty"`
+	Comments     int       `json:"comments"`          // not deleted comments
+	Pending      int       `json:"pending,omitempty"` // comments held for review
+	FirstComment time.Time `json:"first_comment"`
+	LastActivity time.Time `json:"last_activity"` // time of the last comment or edit
+	Verified     bool      `json:"verified,omitempty"`
+	Blocked      bool      `json:"blocked,omitempty"`
+	BlockedUntil time.Time `json:"blocked_until,omitzero"`
+	Level        string    `json:"level,omitempty"` // store.UserLevel, set for sites with user levels enabled
+
+	lastComment time.Time // name and picture taken from the last comment
+}
+
+// SiteUserDetail is the site user with details and recent comments
+type SiteUserDetail struct {
+	SiteUser
+	Details engine.UserDetailEntry `json:"details"`
+	Recent  []store.Comment        `json:"recent"`
+}
+
+// UsersRequest is the input for Users
+type UsersRequest struct {
+	SiteID string
+	Query  string // case-insensitive substring of user id or name
+	Sort   string // comments, activity or name, with optional +/- prefix, -activity by default
+	Limit  int
+	Skip   int
+}
+
+// Users returns site's users filtered, sorted and paginated per request and total number of matched users.
+// Users collected from all comments of the site, which is expensive for big sites.
+func (s *DataStore) Users(req UsersRequest) (users []SiteUser, total int, err error) {
+	all, err := s.siteUsers(req.SiteID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	users = []SiteUser{}
+	query := strings.ToLower(req.Query)
+	for _, u := range all {
+		if query == "" || strings.Contains(strings.ToLower(u.ID), query) || strings.Contains(strings.ToLower(u.Name), query) {
+			users = append(users, *u)
+		}
+	}
+	sortSiteUsers(users, req.Sort)
+
+	total = len(users)
+	if req.Skip >= total {
+		return []SiteUser{}, total, nil
+	}
+	users = users[max(req.Skip, 0):]
+	if req.Limit > 0 && req.Limit < len(users) {
+		users = users[:req.Limit]
+	}
+	return users, total, nil
+}
+
+// UserSummary returns site user with details and up to recent last comments, as seen by the user
+func (s *DataStore) UserSummary(siteID, userID string, recent int, user store.User) (SiteUserDetail, error) {
+	all, err := s.siteUsers(siteID)
+	if err != nil {
+		return SiteUserDetail{}, err
+	}
+	u, ok := all[userID]
+	if !ok {
+		return SiteUserDetail{}, fmt.Errorf("user %s not found on site %s", userID, siteID)
+	}
+	res := SiteUserDetail{SiteUser: *u, Details: engine.UserDetailEntry{UserID: userID}}
+
+	details, err := s.Engine.UserDetail(engine.UserDetailRequest{Locator: store.Locator{SiteID: siteID}, Detail: engine.AllUserDetails})
+	if err != nil {
+		return SiteUserDetail{}, fmt.Errorf("can't get user details for %s: %w", siteID, err)
+	}
+	for _, d := range details {
+		if d.UserID == userID {
+			res.Details = d
+			break
+		}
+	}
+	if res.Details.Email, err = s.readDetail(res.Details.Email); err != nil {
+		log.Printf("[WARN] can't decrypt email of %s, %v", userID, err)
+	}
+	if res.Details.Telegram, err = s.readDetail(res.Details.Telegram); err != nil {
+		log.Printf("[WARN] can't decrypt telegram of %s, %v", userID, err)
+	}
+
+	if res.Recent, err = s.User(siteID, userID, recent, 0, user); err != nil {
+		return SiteUserDetail{}, fmt.Errorf("can't get comments of %s: %w", userID, err)
+	}
+	return res, nil
+}
+
+// siteUsers collects users of all not deleted comments of the site, with verified and blocked flags and levels
+func (s *DataStore) siteUsers(siteID string) (map[string]*SiteUser, error) {
+	posts, err := s.Engine.Info(engine.InfoRequest{Locator: store.Locator{SiteID: siteID}})
+	if err != nil {
+		return nil, fmt.Errorf("can't get list of posts for %s: %w", siteID, err)
+	}
+
+	users := map[string]*SiteUser{}
+	for _, p := range posts {
+		comments, e := s.Engine.Find(engine.FindRequest{Locator: store.Locator{SiteID: siteID, URL: p.URL}})
+		if e != nil {
+			return nil, fmt.Errorf("can't get comments for %s: %w", p.URL, e)
+		}
+		for _, c := range comments {
+			if c.Deleted {
+				continue
+			}
+			u, ok := users[c.User.ID]
+			if !ok {
+				u = &SiteUser{ID: c.User.ID, FirstComment: c.Timestamp}
+				users[c.User.ID] = u
+			}
+			u.Comments++
+			if c.Visibility == store.VisibilityPending {
+				u.Pending++
+			}
+			if c.Timestamp.Before(u.FirstComment) {
+				u.FirstComment = c.Timestamp
+			}
+			activity := c.Timestamp
+			if c.Edit != nil && c.Edit.Timestamp.After(activity) {
+				activity = c.Edit.Timestamp
+			}
+			if activity.After(u.LastActivity) {
+				u.LastActivity = activity
+			}
+			if !c.Timestamp.Before(u.lastComment) {
+				u.lastComment, u.Name, u.Picture, u.Admin = c.Timestamp, c.User.Name, c.User.Picture, c.User.Admin
+			}
+		}
+	}
+
+	blocked, err := s.BlockedUsers(siteID)
+	if err != nil {
+		return nil, fmt.Errorf("can't get list of blocked users for %s: %w", siteID, err)
+	}
+	for _, b := range blocked {
+		if u, ok := users[b.ID]; ok {
+			u.Blocked, u.BlockedUntil = true, b.Until
+		}
+	}
+
+	verified, err := s.Engine.ListFlags(engine.FlagRequest{Locator: store.Locator{SiteID: siteID}, Flag: engine.Verified})
+	if err != nil {
+		return nil, fmt.Errorf("can't get list of verified users for %s: %w", siteID, err)
+	}
+	for _, v := range verified {
+		if id, ok := v.(string); ok && users[id] != nil {
+			users[id].Verified = true
+		}
+	}
+
+	if s.SiteLevelPolicy(siteID).Enabled() {
+		details, e := s.Engine.UserDetail(engine.UserDetailRequest{Locator: store.Locator{SiteID: siteID}, Detail: engine.AllUserDetails})
+		if e != nil {
+			return nil, fmt.Errorf("can't get user details for %s: %w", siteID, e)
+		}
+		levels := map[string]string{}
+		for _, d := range details {
+			levels[d.UserID] = d.Level
+		}
+		for _, u := range users {
+			switch {
+			case u.Verified:
+				u.Level = string(store.LevelVerified)
+			case store.UserLevel(levels[u.ID]).Rank() > 0:
+				u.Level = levels[u.ID]
+			default:
+				u.Level = string(store.LevelNew)
+			}
+		}
+	}
+	return users, nil
+}
+
+// sortSiteUsers sorts users by field with optional +/- prefix, ties sorted by id
+func sortSiteUsers(users []SiteUser, sortFld string) {
+	if sortFld == "" {
+		sortFld = "-activity"
+	}
+	desc := strings.HasPrefix(sortFld, "-")
+	fld := strings.TrimLeft(sortFld, "+-")
+
+	sort.Slice(users, func(i, j int) bool {
+		a, b := users[i], users[j]
+		if desc {
+			a, b = b, a
+		}
+		switch {
+		case fld == "comments" && a.Comments != b.Comments:
+			return a.Comments < b.Comments
+		case fld == "name" && !strings.EqualFold(a.Name, b.Name):
+			return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+		case fld == "activity" && !a.LastActivity.Equal(b.LastActivity):
+			return a.LastActivity.Before(b.LastActivity)
+		}
+		return users[i].ID < users[j].ID
+	})
+}
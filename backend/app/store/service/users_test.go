@@ -0,0 +1,106 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+func TestService_Users(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+	defer b.Close()
+
+	ts := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, c := range []store.Comment{
+		{ID: "c1", Text: "1", Timestamp: ts, User: store.User{ID: "user2", Name: "Bob"}},
+		{ID: "c2", Text: "2", Timestamp: ts.Add(time.Hour), User: store.User{ID: "user2", Name: "Bobby", Picture: "pic"},
+			Locator: store.Locator{URL: "https://radio-t.com/2"}},
+		{ID: "c3", Text: "3", Timestamp: ts.Add(time.Minute), User: store.User{ID: "user3", Name: "alice"}, Visibility: store.VisibilityPending},
+		{ID: "c4", Text: "4", Timestamp: ts.Add(2 * time.Hour), User: store.User{ID: "user4", Name: "gone"}},
+	} {
+		if c.Locator.URL == "" {
+			c.Locator.URL = "https://radio-t.com"
+		}
+		c.Locator.SiteID = "radio-t"
+		_, err := b.Engine.Create(c)
+		require.NoError(t, err)
+	}
+	require.NoError(t, b.Delete(store.Locator{SiteID: "radio-t", URL: "https://radio-t.com"}, "c4", store.SoftDelete))
+	require.NoError(t, b.SetVerified("radio-t", "user3", true))
+	require.NoError(t, b.SetBlock("radio-t", "user1", true, time.Hour))
+
+	users, total, err := b.Users(UsersRequest{SiteID: "radio-t"})
+	require.NoError(t, err)
+	assert.Equal(t, 3, total, "user with deleted comments only not listed")
+	require.Len(t, users, 3)
+	assert.Equal(t, []string{"user2", "user3", "user1"}, []string{users[0].ID, users[1].ID, users[2].ID}, "by last activity")
+	assert.Equal(t, "Bobby", users[0].Name, "name from the last comment")
+	assert.Equal(t, "pic", users[0].Picture)
+	assert.Equal(t, 2, users[0].Comments)
+	assert.Equal(t, ts, users[0].FirstComment)
+	assert.Equal(t, ts.Add(time.Hour), users[0].LastActivity)
+	assert.Equal(t, 1, users[1].Pending)
+	assert.True(t, users[1].Verified)
+	assert.True(t, users[2].Blocked)
+	assert.False(t, users[2].BlockedUntil.IsZero())
+
+	tbl := []struct {
+		req   UsersRequest
+		ids   []string
+		total int
+	}{
+		{UsersRequest{Sort: "-comments"}, []string{"user1", "user2", "user3"}, 3},
+		{UsersRequest{Sort: "+comments"}, []string{"user3", "user1", "user2"}, 3},
+		{UsersRequest{Sort: "name"}, []string{"user3", "user2", "user1"}, 3},
+		{UsersRequest{Sort: "activity"}, []string{"user1", "user3", "user2"}, 3},
+		{UsersRequest{Sort: "activity", Limit: 2}, []string{"user1", "user3"}, 3},
+		{UsersRequest{Sort: "activity", Limit: 2, Skip: 2}, []string{"user2"}, 3},
+		{UsersRequest{Sort: "activity", Skip: 5}, []string{}, 3},
+		{UsersRequest{Query: "BOB"}, []string{"user2"}, 1},
+		{UsersRequest{Query: "user1"}, []string{"user1"}, 1},
+		{UsersRequest{Query: "nobody"}, []string{}, 0},
+	}
+	for i, tt := range tbl {
+		tt.req.SiteID = "radio-t"
+		users, total, err := b.Users(tt.req)
+		require.NoError(t, err)
+		ids := []string{}
+		for _, u := range users {
+			ids = append(ids, u.ID)
+		}
+		assert.Equal(t, tt.ids, ids, "case #%d", i)
+		assert.Equal(t, tt.total, total, "case #%d", i)
+	}
+
+	_, _, err = b.Users(UsersRequest{SiteID: "bad"})
+	assert.Error(t, err)
+}
+
+func TestService_UserSummary(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+	defer b.Close()
+
+	_, err := b.SetUserEmail("radio-t", "user1", "user1@example.com")
+	require.NoError(t, err)
+
+	res, err := b.UserSummary("radio-t", "user1", 1, store.User{ID: "admin", Admin: true})
+	require.NoError(t, err)
+	assert.Equal(t, "user name", res.Name)
+	assert.Equal(t, 2, res.Comments)
+	assert.Equal(t, engine.UserDetailEntry{UserID: "user1", Email: "user1@example.com"}, res.Details)
+	require.Len(t, res.Recent, 1)
+	assert.Equal(t, "id-2", res.Recent[0].ID, "last comment")
+
+	_, err = b.UserSummary("radio-t", "user2", 1, store.User{})
+	assert.EqualError(t, err, "user user2 not found on site radio-t")
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"github.com/umputun/remark42/backend/app/store"
+)
+
+// VoteWeights defines weights of votes by voter's level, votes of unlisted levels weigh 1.
+// Verified users have verified level even if user levels disabled.
+type VoteWeights map[store.UserLevel]float64
+
+// voteWeight returns weight of the user's vote on the site
+func (s *DataStore) voteWeight(siteID, userID string) float64 {
+	if len(s.VoteWeights) == 0 {
+		return 1
+	}
+	level := s.UserLevel(siteID, userID)
+	if level == "" && s.IsVerified(siteID, userID) {
+		level = store.LevelVerified
+	}
+	if weight, ok := s.VoteWeights[level]; ok {
+		return weight
+	}
+	return 1
+}
+
+// weightedVotes returns sum of the comment's votes with their weights
+func weightedVotes(c store.Comment) (res float64) {
+	for userID, v := range c.Votes {
+		weight := 1.0
+		if w, ok := c.VoteWeights[userID]; ok {
+			weight = w
+		}
+		if v {
+			res += weight
+		} else {
+			res -= weight
+		}
+	}
+	return res
+}
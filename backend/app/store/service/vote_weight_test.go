@@ -0,0 +1,73 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+)
+
+func TestService_VoteWeights(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123"), MaxVotes: -1,
+		VoteWeights: VoteWeights{store.LevelVerified: 3, store.LevelNew: 0.5}}
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	id, err := b.Create(store.Comment{Text: "text", Locator: locator, User: store.User{ID: "author", Name: "author"}})
+	require.NoError(t, err)
+	require.NoError(t, b.SetVerified("radio-t", "v1", true))
+
+	vote := func(userID string, val bool) store.Comment {
+		c, e := b.Vote(VoteReq{Locator: locator, CommentID: id, UserID: userID, Val: val})
+		require.NoError(t, e)
+		return c
+	}
+
+	c := vote("u1", true)
+	assert.Equal(t, 1, c.Score, "levels disabled, regular vote")
+	assert.Empty(t, c.VoteWeights)
+	c = vote("v1", true)
+	assert.Equal(t, 4, c.Score, "verified vote weighs 3 without levels")
+	assert.Equal(t, map[string]float64{"v1": 3}, c.VoteWeights)
+
+	b.LevelPolicy = StaticLevelPolicyLister{LevelPolicy: LevelPolicy{MemberComments: 100}}
+	c = vote("n1", false)
+	assert.Equal(t, 4, c.Score, "3.5 rounded")
+	c = vote("n2", false)
+	assert.Equal(t, 3, c.Score)
+	assert.Equal(t, map[string]bool{"u1": true, "v1": true, "n1": false, "n2": false}, c.Votes, "raw votes kept")
+	ups, downs := b.upsAndDowns(c)
+	assert.Equal(t, 2, ups)
+	assert.Equal(t, 2, downs)
+
+	c = vote("n1", true) // reset of the vote
+	assert.Equal(t, 4, c.Score)
+	assert.Equal(t, map[string]float64{"v1": 3, "n2": 0.5}, c.VoteWeights)
+
+	b.VoteWeights = nil
+	c = vote("v1", false) // reset of the vote, weight recorded with the vote used
+	assert.Equal(t, 1, c.Score)
+
+	c, err = b.Get(locator, id, store.User{ID: "u1"})
+	require.NoError(t, err)
+	assert.Nil(t, c.VoteWeights, "weights hidden")
+}
+
+func TestService_VoteWeightsImported(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123"), MaxVotes: -1,
+		VoteWeights: VoteWeights{store.LevelVerified: 2}}
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	id, err := b.Create(store.Comment{Text: "text", Locator: locator, User: store.User{ID: "author", Name: "author"},
+		Score: 10, Imported: true})
+	require.NoError(t, err)
+	require.NoError(t, b.SetVerified("radio-t", "v1", true))
+
+	c, err := b.Vote(VoteReq{Locator: locator, CommentID: id, UserID: "v1", Val: false})
+	require.NoError(t, err)
+	assert.Equal(t, 8, c.Score, "imported score kept")
+}
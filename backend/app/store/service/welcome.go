@@ -0,0 +1,98 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark42/backend/app/store"
+)
+
+// WelcomePolicy defines first-comment welcome workflow for the site
+type WelcomePolicy struct {
+	Enabled bool   // mark first comment of the user on the site with "new member" badge
+	Message string // welcome message template sent to the user, no message if empty
+}
+
+// WelcomePolicyLister provides welcome policy per site
+type WelcomePolicyLister interface {
+	Policy(siteID string) (WelcomePolicy, error)
+}
+
+// StaticWelcomePolicyLister provides same welcome policy for every site
+type StaticWelcomePolicyLister struct {
+	WelcomePolicy
+}
+
+// Policy returns welcome policy (ignores siteID)
+func (l StaticWelcomePolicyLister) Policy(_ string) (WelcomePolicy, error) {
+	return l.WelcomePolicy, nil
+}
+
+// welcomeTmplData is data available for welcome message template
+type welcomeTmplData struct {
+	UserName   string
+	SiteID     string
+	PostURL    string
+	PostTitle  string
+	CommentURL string
+}
+
+// SiteWelcomePolicy returns welcome policy for the site, disabled if not set
+func (s *DataStore) SiteWelcomePolicy(siteID string) WelcomePolicy {
+	if s.WelcomePolicy == nil {
+		return WelcomePolicy{}
+	}
+	policy, err := s.WelcomePolicy.Policy(siteID)
+	if err != nil {
+		log.Printf("[WARN] failed to get welcome policy for site %s: %v", siteID, err)
+		return WelcomePolicy{}
+	}
+	return policy
+}
+
+// markNewMember sets NewMember for the first comment of the user on the site, if welcome enabled for the site
+func (s *DataStore) markNewMember(c *store.Comment) {
+	if c.Imported || !s.SiteWelcomePolicy(c.Locator.SiteID).Enabled {
+		return
+	}
+	count, err := s.UserCount(c.Locator.SiteID, c.User.ID)
+	switch {
+	case err == nil:
+		c.NewMember = count == 0
+	case strings.Contains(err.Error(), "no comments for user"): // engine reports user without comments as an error
+		c.NewMember = true
+	default:
+		log.Printf("[WARN] can't count comments of %s, not marked as new member, %v", c.User.ID, err)
+	}
+}
+
+// WelcomeMessage returns welcome message for the first comment of the user, empty if nothing to send
+func (s *DataStore) WelcomeMessage(c store.Comment) (string, error) {
+	if !c.NewMember {
+		return "", nil
+	}
+	policy := s.SiteWelcomePolicy(c.Locator.SiteID)
+	if !policy.Enabled || strings.TrimSpace(policy.Message) == "" {
+		return "", nil
+	}
+	tmpl, err := template.New("welcome").Parse(policy.Message)
+	if err != nil {
+		return "", fmt.Errorf("can't parse welcome message template: %w", err)
+	}
+	msg := bytes.Buffer{}
+	err = tmpl.Execute(&msg, welcomeTmplData{
+		UserName:   c.User.Name,
+		SiteID:     c.Locator.SiteID,
+		PostURL:    c.Locator.URL,
+		PostTitle:  c.PostTitle,
+		CommentURL: c.Locator.URL + "#remark42__comment-" + c.ID,
+	})
+	if err != nil {
+		return "", fmt.Errorf("can't execute welcome message template: %w", err)
+	}
+	return msg.String(), nil
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+func TestService_CreateWithWelcomePolicy(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+	defer b.Close()
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+
+	id, err := b.Create(store.Comment{Text: "first comment", Locator: locator, User: store.User{ID: "user2", Name: "user2"}})
+	require.NoError(t, err)
+	c, err := b.Engine.Get(getReq(locator, id))
+	require.NoError(t, err)
+	assert.False(t, c.NewMember, "welcome disabled")
+
+	b.WelcomePolicy = StaticWelcomePolicyLister{WelcomePolicy{Enabled: true,
+		Message: "Hi {{.UserName}}, thanks for the comment on {{.PostTitle}}, see it at {{.CommentURL}}"}}
+
+	id, err = b.Create(store.Comment{Text: "first comment", Locator: locator, User: store.User{ID: "user3", Name: "user3"},
+		PostTitle: "post"})
+	require.NoError(t, err)
+	c, err = b.Engine.Get(getReq(locator, id))
+	require.NoError(t, err)
+	assert.True(t, c.NewMember, "first comment of user3")
+	msg, err := b.WelcomeMessage(c)
+	require.NoError(t, err)
+	assert.Equal(t, "Hi user3, thanks for the comment on post, see it at https://radio-t.com#remark42__comment-"+id, msg)
+
+	id, err = b.Create(store.Comment{Text: "second comment", Locator: locator, User: store.User{ID: "user3", Name: "user3"}})
+	require.NoError(t, err)
+	c, err = b.Engine.Get(getReq(locator, id))
+	require.NoError(t, err)
+	assert.False(t, c.NewMember, "second comment of user3")
+	msg, err = b.WelcomeMessage(c)
+	require.NoError(t, err)
+	assert.Empty(t, msg)
+
+	id, err = b.Create(store.Comment{Text: "not a first comment", Locator: locator, User: store.User{ID: "user1", Name: "user1"}})
+	require.NoError(t, err)
+	c, err = b.Engine.Get(getReq(locator, id))
+	require.NoError(t, err)
+	assert.False(t, c.NewMember, "user1 has comments already")
+
+	id, err = b.Create(store.Comment{Text: "imported", Locator: locator, User: store.User{ID: "user4", Name: "user4"}, Imported: true})
+	require.NoError(t, err)
+	c, err = b.Engine.Get(getReq(locator, id))
+	require.NoError(t, err)
+	assert.False(t, c.NewMember, "imported comments not marked")
+
+	b.Engine = &countErrEngine{Interface: eng}
+	c = store.Comment{Text: "first comment", Locator: locator, User: store.User{ID: "user5", Name: "user5"}}
+	b.markNewMember(&c)
+	assert.False(t, c.NewMember, "not marked on engine error")
+}
+
+// countErrEngine fails to count comments
+type countErrEngine struct {
+	engine.Interface
+}
+
+func (e *countErrEngine) Count(engine.FindRequest) (int, error) {
+	return 0, errors.New("engine failed")
+}
+
+func TestService_WelcomeMessage(t *testing.T) {
+	b := DataStore{}
+	c := store.Comment{ID: "c1", NewMember: true, User: store.User{Name: "user1"}, Locator: store.Locator{SiteID: "radio-t"}}
+
+	msg, err := b.WelcomeMessage(c)
+	require.NoError(t, err)
+	assert.Empty(t, msg, "no policy")
+
+	b.WelcomePolicy = StaticWelcomePolicyLister{WelcomePolicy{Enabled: true}}
+	msg, err = b.WelcomeMessage(c)
+	require.NoError(t, err)
+	assert.Empty(t, msg, "badge only")
+
+	b.WelcomePolicy = StaticWelcomePolicyLister{WelcomePolicy{Enabled: true, Message: "welcome to {{.SiteID}}, {{.UserName}}"}}
+	msg, err = b.WelcomeMessage(c)
+	require.NoError(t, err)
+	assert.Equal(t, "welcome to radio-t, user1", msg)
+
+	b.WelcomePolicy = StaticWelcomePolicyLister{WelcomePolicy{Enabled: true, Message: "welcome {{.Bad"}}
+	_, err = b.WelcomeMessage(c)
+	assert.Error(t, err)
+}
@@ -0,0 +1,86 @@
+package settings
+
+import (
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Bolt implements Store with settings kept in bolt DB, in a bucket per setting keyed by site id
+type Bolt struct {
+	fileName string
+	db       *bolt.DB
+}
+
+// NewBoltStorage makes bolt settings store
+func NewBoltStorage(fileName string, options bolt.Options) (*Bolt, error) {
+	db, err := bolt.Open(fileName, 0o600, &options) //nolint:gocritic //octalLiteral is OK as FileMode
+	if err != nil {
+		return nil, fmt.Errorf("failed to make boltdb for %s: %w", fileName, err)
+	}
+	return &Bolt{db: db, fileName: fileName}, nil
+}
+
+// Get returns value of the site's setting, nil if not set
+func (b *Bolt) Get(name, siteID string) (res []byte, err error) {
+	err = b.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(name))
+		if bkt == nil {
+			return nil
+		}
+		if v := bkt.Get([]byte(siteID)); v != nil {
+			res = append([]byte{}, v...)
+		}
+		return nil
+	})
+	return res, err
+}
+
+// All returns values of the setting for all sites it is set for
+func (b *Bolt) All(name string) (map[string][]byte, error) {
+	res := map[string][]byte{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(name))
+		if bkt == nil {
+			return nil
+		}
+		return bkt.ForEach(func(k, v []byte) error {
+			res[string(k)] = append([]byte{}, v...)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Set sets value of the site's setting
+func (b *Bolt) Set(name, siteID string, value []byte) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bkt, err := tx.CreateBucketIfNotExists([]byte(name))
+		if err != nil {
+			return fmt.Errorf("failed to create bucket %s: %w", name, err)
+		}
+		return bkt.Put([]byte(siteID), value)
+	})
+}
+
+// Delete removes the site's setting
+func (b *Bolt) Delete(name, siteID string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(name))
+		if bkt == nil {
+			return nil
+		}
+		return bkt.Delete([]byte(siteID))
+	})
+}
+
+// Close bolt store
+func (b *Bolt) Close() error {
+	if err := b.db.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", b.fileName, err)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package settings
+
+import (
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestBolt_Settings(t *testing.T) {
+	svc, err := NewBoltStorage(path.Join(t.TempDir(), "settings.db"), bolt.Options{})
+	require.NoError(t, err)
+	defer svc.Close()
+
+	v, err := svc.Get("edit_policy", "site1")
+	require.NoError(t, err)
+	assert.Nil(t, v, "not set")
+	all, err := svc.All("edit_policy")
+	require.NoError(t, err)
+	assert.Empty(t, all)
+
+	require.NoError(t, svc.Set("edit_policy", "site1", []byte(`{"duration":60}`)))
+	require.NoError(t, svc.Set("edit_policy", "site2", []byte(`{"duration":120}`)))
+	require.NoError(t, svc.Set("collapse_policy", "site1", []byte(`{"mode":"hide"}`)))
+	require.NoError(t, svc.Set("edit_policy", "site1", []byte(`{"duration":30}`)))
+
+	v, err = svc.Get("edit_policy", "site1")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"duration":30}`, string(v), "replaced")
+	all, err = svc.All("edit_policy")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"site1": []byte(`{"duration":30}`), "site2": []byte(`{"duration":120}`)}, all)
+
+	require.NoError(t, svc.Delete("edit_policy", "site1"))
+	require.NoError(t, svc.Delete("edit_policy", "site1"), "already deleted")
+	require.NoError(t, svc.Delete("unknown", "site1"), "unknown setting")
+	v, err = svc.Get("edit_policy", "site1")
+	require.NoError(t, err)
+	assert.Nil(t, v)
+	v, err = svc.Get("collapse_policy", "site1")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"mode":"hide"}`, string(v), "other setting kept")
+}
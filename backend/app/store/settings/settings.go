@@ -0,0 +1,16 @@
+// Package settings keeps per-site settings changed by admins at runtime, like policy overrides,
+// so they survive restarts. Values are stored as JSON, encoded and decoded by the owners of the settings.
+package settings
+
+// Store defines interface to keep per-site settings
+type Store interface {
+	// Get returns value of the site's setting, nil if not set
+	Get(name, siteID string) ([]byte, error)
+	// All returns values of the setting for all sites it is set for
+	All(name string) (map[string][]byte, error)
+	// Set sets value of the site's setting
+	Set(name, siteID string, value []byte) error
+	// Delete removes the site's setting, no error if not set
+	Delete(name, siteID string) error
+	Close() error
+}
@@ -0,0 +1,124 @@
+package suppress
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const suppressionsBucket = "suppressions" // key -> suppression
+
+// Bolt implements Store with suppressions kept in bolt DB
+type Bolt struct {
+	fileName string
+	db       *bolt.DB
+}
+
+// NewBoltStorage makes bolt suppression store
+func NewBoltStorage(fileName string, options bolt.Options) (*Bolt, error) {
+	db, err := bolt.Open(fileName, 0o600, &options) //nolint:gocritic //octalLiteral is OK as FileMode
+	if err != nil {
+		return nil, fmt.Errorf("failed to make boltdb for %s: %w", fileName, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, e := tx.CreateBucketIfNotExists([]byte(suppressionsBucket)); e != nil {
+			return fmt.Errorf("failed to create bucket %s: %w", suppressionsBucket, e)
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &Bolt{db: db, fileName: fileName}, nil
+}
+
+// Add suppresses the address, repeated reports of suppressed one update its kind and increase the count
+func (b *Bolt) Add(key string, s Suppression) (res Suppression, err error) {
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(suppressionsBucket))
+		res, err = getSuppression(bkt, key)
+		switch {
+		case errors.Is(err, ErrNotFound):
+			res = s
+			res.Count, res.Created = 1, s.Updated
+		case err != nil:
+			return err
+		default:
+			res.Address, res.Kind, res.Source, res.Updated = s.Address, s.Kind, s.Source, s.Updated
+			res.Count++
+		}
+		data, e := json.Marshal(res)
+		if e != nil {
+			return fmt.Errorf("failed to marshal suppression %s: %w", key, e)
+		}
+		return bkt.Put([]byte(key), data)
+	})
+	if err != nil {
+		return Suppression{}, err
+	}
+	return res, nil
+}
+
+// Get returns suppression by key
+func (b *Bolt) Get(key string) (res Suppression, err error) {
+	err = b.db.View(func(tx *bolt.Tx) error {
+		res, err = getSuppression(tx.Bucket([]byte(suppressionsBucket)), key)
+		return err
+	})
+	return res, err
+}
+
+// List returns all suppressions, recently updated first
+func (b *Bolt) List() ([]Suppression, error) {
+	res := []Suppression{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(suppressionsBucket)).ForEach(func(k, v []byte) error {
+			s := Suppression{}
+			if err := json.Unmarshal(v, &s); err != nil {
+				return fmt.Errorf("failed to unmarshal suppression %s: %w", k, err)
+			}
+			res = append(res, s)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(res, func(a, b Suppression) int { return b.Updated.Compare(a.Updated) })
+	return res, nil
+}
+
+// Delete removes suppression by key, reinstating the address
+func (b *Bolt) Delete(key string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(suppressionsBucket))
+		if bkt.Get([]byte(key)) == nil {
+			return ErrNotFound
+		}
+		return bkt.Delete([]byte(key))
+	})
+}
+
+// Close bolt store
+func (b *Bolt) Close() error {
+	if err := b.db.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", b.fileName, err)
+	}
+	return nil
+}
+
+func getSuppression(bkt *bolt.Bucket, key string) (Suppression, error) {
+	v := bkt.Get([]byte(key))
+	if v == nil {
+		return Suppression{}, ErrNotFound
+	}
+	res := Suppression{}
+	if err := json.Unmarshal(v, &res); err != nil {
+		return Suppression{}, fmt.Errorf("failed to unmarshal suppression %s: %w", key, err)
+	}
+	return res, nil
+}
@@ -0,0 +1,65 @@
+package suppress
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestBolt_Suppressions(t *testing.T) {
+	svc, teardown := prepareBoltSuppressStorageTest(t)
+	defer teardown()
+	ts := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	res, err := svc.List()
+	require.NoError(t, err)
+	assert.Empty(t, res)
+
+	s1, err := svc.Add("key1", Suppression{Address: "a1@example.com", Kind: "bounce", Source: "ses", Updated: ts})
+	require.NoError(t, err)
+	assert.Equal(t, Suppression{Address: "a1@example.com", Kind: "bounce", Source: "ses", Count: 1, Created: ts, Updated: ts}, s1)
+	_, err = svc.Add("key2", Suppression{Address: "a2@example.com", Kind: "bounce", Source: "ses", Updated: ts.Add(time.Minute)})
+	require.NoError(t, err)
+
+	s1, err = svc.Add("key1", Suppression{Address: "a1@example.com", Kind: "complaint", Source: "ses", Updated: ts.Add(time.Hour)})
+	require.NoError(t, err)
+	assert.Equal(t, Suppression{Address: "a1@example.com", Kind: "complaint", Source: "ses", Count: 2, Created: ts,
+		Updated: ts.Add(time.Hour)}, s1, "repeated report")
+
+	s, err := svc.Get("key1")
+	require.NoError(t, err)
+	assert.Equal(t, s1, s)
+	_, err = svc.Get("unknown")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	res, err = svc.List()
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	assert.Equal(t, "a1@example.com", res[0].Address, "recently updated first")
+	assert.Equal(t, "a2@example.com", res[1].Address)
+
+	require.NoError(t, svc.Delete("key1"))
+	require.ErrorIs(t, svc.Delete("key1"), ErrNotFound)
+	_, err = svc.Get("key1")
+	require.ErrorIs(t, err, ErrNotFound)
+	res, err = svc.List()
+	require.NoError(t, err)
+	assert.Len(t, res, 1)
+}
+
+func prepareBoltSuppressStorageTest(t *testing.T) (svc *Bolt, teardown func()) {
+	loc, err := os.MkdirTemp("", "test_suppress_r42")
+	require.NoError(t, err, "failed to make temp dir")
+	svc, err = NewBoltStorage(path.Join(loc, "suppress.db"), bolt.Options{})
+	require.NoError(t, err, "new bolt storage")
+	teardown = func() {
+		assert.NoError(t, svc.Close())
+		assert.NoError(t, os.RemoveAll(loc))
+	}
+	return svc, teardown
+}
@@ -0,0 +1,31 @@
+// Package suppress keeps email addresses suppressed after permanent bounces and spam complaints
+package suppress
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNotFound returned for addresses not suppressed
+var ErrNotFound = errors.New("suppression not found")
+
+// Suppression stops all emails to the address, until an admin reinstates it
+type Suppression struct {
+	Address string    `json:"address"` // address as stored by the caller, sealed or encrypted if required
+	Kind    string    `json:"kind"`    // "bounce" or "complaint" of the latest report
+	Source  string    `json:"source"`  // email provider reported the address
+	Count   int       `json:"count"`   // number of reports
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+}
+
+// Store defines interface to keep suppressions by key identifying the address, like lowercased address or its hash
+type Store interface {
+	// Add suppresses the address, repeated reports of suppressed one update its kind and increase the count
+	Add(key string, s Suppression) (Suppression, error)
+	Get(key string) (Suppression, error)
+	// List returns all suppressions, recently updated first
+	List() ([]Suppression, error)
+	Delete(key string) error
+	Close() error
+}
@@ -25,6 +25,35 @@ type User struct {
 	EmailSubscription bool   `json:"email_subscription,omitempty"`
 	SiteID            string `json:"site_id,omitempty"`
 	PaidSub           bool   `json:"paid_sub,omitempty"`
+	Pronouns          string `json:"pronouns,omitempty"`
+	Level             string `json:"level,omitempty"` // UserLevel, set for sites with user levels enabled
+	Bot               bool   `json:"bot,omitempty"`   // bot account of integration, authenticated by api key
+}
+
+// UserLevel is the trust level of the user on the site
+type UserLevel string
+
+// enum of all user levels, from the lowest to the highest
+const (
+	LevelNew      UserLevel = "new"
+	LevelMember   UserLevel = "member"
+	LevelTrusted  UserLevel = "trusted"
+	LevelVerified UserLevel = "verified"
+)
+
+// Rank returns position of the level, higher for more trusted levels and 0 for unknown
+func (l UserLevel) Rank() int {
+	switch l {
+	case LevelNew:
+		return 1
+	case LevelMember:
+		return 2
+	case LevelTrusted:
+		return 3
+	case LevelVerified:
+		return 4
+	}
+	return 0
 }
 
 var reValidSha = regexp.MustCompile("^[a-fA-F0-9]{40}$")
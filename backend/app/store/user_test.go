@@ -64,3 +64,11 @@ func (mock mockHash) Reset()                            {}
 func (mock mockHash) Size() int                         { return 0 }
 func (mock mockHash) BlockSize() int                    { return 0 }
 func (mock mockHash) Write(_ []byte) (n int, err error) { return 0, fmt.Errorf("error") }
+
+func TestUser_LevelRank(t *testing.T) {
+	assert.Equal(t, 0, UserLevel("").Rank())
+	assert.Equal(t, 0, UserLevel("blah").Rank())
+	assert.Less(t, LevelNew.Rank(), LevelMember.Rank())
+	assert.Less(t, LevelMember.Rank(), LevelTrusted.Rank())
+	assert.Less(t, LevelTrusted.Rank(), LevelVerified.Rank())
+}
@@ -16,7 +16,8 @@ import { clearAuthCookie } from './cookies';
 
 /* API methods */
 
-export const getConfig = (): Promise<Config> => apiFetcher.get('/config');
+/** fetches config of the site, with settings of the post, like pinned order of comments */
+export const getConfig = (): Promise<Config> => apiFetcher.get('/config', url ? { url } : {});
 
 export const getPostComments = (sort: Sorting) => apiFetcher.get<Tree>('/find', { url, sort, format: 'tree' });
 
@@ -77,15 +78,19 @@ export async function getUser(): Promise<User | null> {
   return apiFetcher.get<User | null>('/user').catch(() => null);
 }
 
-export const uploadImage = (image: File): Promise<Image> => {
+export const uploadImage = (image: File, alt?: string): Promise<Image> => {
   const data = new FormData();
   data.append('file', image);
+  if (alt) {
+    data.append('alt', alt);
+  }
 
-  return apiFetcher.post<{ id: string }>('/picture', {}, data).then((resp) => ({
+  return apiFetcher.post<{ id: string; alt?: string }>('/picture', {}, data).then((resp) => ({
     name: image.name,
     size: image.size,
     type: image.type,
     url: `${BASE_URL + API_BASE}/picture/${resp.id}`,
+    alt: resp.alt,
   }));
 };
 
@@ -97,13 +97,20 @@ export type DefaultOAuthProvider =
   | 'google'
   | 'yandex'
   | 'github'
+  | 'gitlab'
   | 'microsoft'
   | 'patreon'
   | 'discord'
+  | 'mastodon'
+  | 'steam'
+  | 'twitch'
+  | 'reddit'
+  | 'vk'
+  | 'wechat'
   | 'telegram'
   | 'dev';
 export type OAuthProvider = DefaultOAuthProvider | (string & {});
-export type FormProvider = 'email' | 'anonymous';
+export type FormProvider = 'email' | 'anonymous' | 'ldap';
 export type Provider = OAuthProvider | FormProvider;
 
 export interface Config {
@@ -124,6 +131,10 @@ export interface Config {
   email_notifications: boolean;
   telegram_notifications: boolean;
   emoji_enabled: boolean;
+  /** order of comments pinned for the post by site owner */
+  sort?: Sorting;
+  /** url of site's custom styles uploaded by admin */
+  custom_css?: string;
 }
 
 export type Sorting = '-time' | '+time' | '-active' | '+active' | '-score' | '+score' | '-controversy' | '+controversy';
@@ -149,6 +160,8 @@ export interface Image {
   /** mime type of an image */
   type: string;
   url: string;
+  /** alt text kept by the server, provided by user or generated by captioning service */
+  alt?: string;
 }
 
 /** error struct returned in case of api call error */
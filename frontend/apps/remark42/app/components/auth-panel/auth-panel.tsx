@@ -66,7 +66,7 @@ class AuthPanelComponent extends Component<Props, State> {
           title={this.props.intl.formatMessage(messages.openProfile)}
         >
           <div className={styles.userAvatar}>
-            <Avatar url={user.picture} />
+            <Avatar url={user.picture} userId={user.id} name={user.name} theme={this.props.theme} />
           </div>
           {user.name}
         </button>{' '}
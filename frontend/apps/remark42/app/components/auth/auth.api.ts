@@ -11,6 +11,13 @@ export function anonymousSignin(user: string): Promise<User> {
   return authFetcher.get<User>('/anonymous/login', { user, aud: siteId });
 }
 
+/**
+ * Sign in with LDAP directory account, credentials are posted in the body to keep the password out of urls
+ */
+export function ldapSignin(user: string, passwd: string): Promise<User> {
+  return authFetcher.post<User>('/ldap/login', {}, { user, passwd, aud: siteId });
+}
+
 /**
  * First step of two of `email` authorization
  */
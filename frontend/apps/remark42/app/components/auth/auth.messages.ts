@@ -13,6 +13,10 @@ export const messages = defineMessages<string>({
     id: 'auth.username',
     defaultMessage: 'Username',
   },
+  password: {
+    id: 'auth.password',
+    defaultMessage: 'Password',
+  },
   usernameRestriction: {
     id: 'auth.symbols-restriction',
     defaultMessage: 'Username must contain only letters, numbers, underscores or spaces',
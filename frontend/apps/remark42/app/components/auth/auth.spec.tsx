@@ -215,6 +215,23 @@ describe('<Auth/>', () => {
     await waitFor(() => expect(api.anonymousSignin).toBeCalled());
   });
 
+  it('should send ldap form with password', async () => {
+    StaticStore.config.auth_providers = ['ldap'];
+    jest.spyOn(api, 'ldapSignin').mockImplementationOnce(async () => ({} as User));
+
+    render(<Auth />);
+
+    fireEvent.click(screen.getByText('Sign In'));
+    expect(screen.getByText('ldap')).toHaveClass('auth-form-title');
+    expect(screen.getByPlaceholderText('Username')).not.toHaveAttribute('pattern');
+    expect(screen.getByPlaceholderText('Password')).toHaveAttribute('type', 'password');
+    fireEvent.change(screen.getByPlaceholderText('Username'), { target: { value: 'john.doe' } });
+    fireEvent.change(screen.getByPlaceholderText('Password'), { target: { value: 'secret' } });
+    fireEvent.click(screen.getByText('Submit'));
+    await waitFor(() => expect(api.ldapSignin).toBeCalled());
+    expect(api.ldapSignin).toBeCalledWith('john.doe', 'secret');
+  });
+
   it.each`
     value           | expected
     ${'username '}  | ${'username'}
@@ -22,6 +22,7 @@ import {
   emailSignin,
   verifyEmailSignin,
   anonymousSignin,
+  ldapSignin,
   verifyTelegramSignin,
   getTelegramSigninParams,
 } from './auth.api';
@@ -118,6 +119,14 @@ export function Auth() {
           dispatch(setUser(user));
           break;
         }
+        case 'ldap': {
+          const username = data.get('username') as string;
+          const password = data.get('password') as string;
+          const user = await ldapSignin(username, password);
+
+          dispatch(setUser(user));
+          break;
+        }
         case 'email': {
           const email = data.get('email') as string;
           const username = data.get('username') as string;
@@ -328,9 +337,9 @@ export function Auth() {
                         className="auth-input-username"
                         required
                         name="username"
-                        minLength={3}
-                        pattern="[\p{L}\d\s_]+"
-                        title={intl.formatMessage(messages.usernameRestriction)}
+                        minLength={view === 'ldap' ? undefined : 3}
+                        pattern={view === 'ldap' ? undefined : '[\\p{L}\\d\\s_]+'}
+                        title={view === 'ldap' ? undefined : intl.formatMessage(messages.usernameRestriction)}
                         placeholder={intl.formatMessage(messages.username)}
                         disabled={isLoading}
                         onBlur={(evt) => {
@@ -340,6 +349,19 @@ export function Auth() {
                         dir="auto"
                       />
                     </div>
+                    {view === 'ldap' && (
+                      <div className={clsx('auth-row', styles.row)}>
+                        <Input
+                          className="auth-input-password"
+                          required
+                          name="password"
+                          type="password"
+                          autoComplete="current-password"
+                          placeholder={intl.formatMessage(messages.password)}
+                          disabled={isLoading}
+                        />
+                      </div>
+                    )}
                     {view === 'email' && (
                       <div className={clsx('auth-row', styles.row)}>
                         <Input
@@ -11,7 +11,7 @@ export function getProviders(): [OAuthProvider[], FormProvider[]] {
   const formProviders: FormProvider[] = [];
 
   StaticStore.config.auth_providers.forEach((p) => {
-    p === 'email' || p === 'anonymous'
+    p === 'email' || p === 'anonymous' || p === 'ldap'
       ? formProviders.push(p as FormProvider)
       : oauthProviders.push(p as OAuthProvider);
   });
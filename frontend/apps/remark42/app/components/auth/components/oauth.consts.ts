@@ -16,6 +16,9 @@ export const OAUTH_DATA = {
   },
   patreon: require('assets/social/patreon.svg').default as string,
   discord: require('assets/social/discord.svg').default as string,
+  mastodon: require('assets/social/mastodon.svg').default as string,
+  twitch: require('assets/social/twitch.svg').default as string,
+  reddit: require('assets/social/reddit.svg').default as string,
   google: require('assets/social/google.svg').default as string,
   microsoft: require('assets/social/microsoft.svg').default as string,
   yandex: require('assets/social/yandex.svg').default as string,
@@ -28,6 +31,34 @@ export const OAUTH_DATA = {
       dark: require('assets/social/github-dark.svg').default as string,
     },
   },
+  gitlab: {
+    name: 'GitLab',
+    icons: {
+      light: require('assets/social/gitlab.svg').default as string,
+      dark: require('assets/social/gitlab.svg').default as string,
+    },
+  },
+  steam: {
+    name: 'Steam',
+    icons: {
+      light: require('assets/social/steam-light.svg').default as string,
+      dark: require('assets/social/steam-dark.svg').default as string,
+    },
+  },
+  vk: {
+    name: 'VK',
+    icons: {
+      light: require('assets/social/vk.svg').default as string,
+      dark: require('assets/social/vk.svg').default as string,
+    },
+  },
+  wechat: {
+    name: 'WeChat',
+    icons: {
+      light: require('assets/social/wechat.svg').default as string,
+      dark: require('assets/social/wechat.svg').default as string,
+    },
+  },
   telegram: require('assets/social/telegram.svg').default as string,
 } as const;
 
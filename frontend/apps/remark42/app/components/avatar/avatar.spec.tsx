@@ -2,7 +2,7 @@ import '@testing-library/jest-dom';
 import { render } from '@testing-library/preact';
 
 import { Avatar } from './avatar';
-import { BASE_URL } from 'common/constants.config';
+import { API_BASE, BASE_URL } from 'common/constants.config';
 
 describe('<Avatar/>', () => {
   it('should have correct url', () => {
@@ -11,6 +11,21 @@ describe('<Avatar/>', () => {
     expect(container.querySelector('img')).toHaveAttribute('src', `${BASE_URL}/image.svg`);
   });
 
+  it('should use picture when set', () => {
+    const { container } = render(<Avatar url="https://example.com/pic.png" userId="user_1" name="John Doe" />);
+
+    expect(container.querySelector('img')).toHaveAttribute('src', 'https://example.com/pic.png');
+  });
+
+  it('should use initials avatar for user without picture', () => {
+    const { container } = render(<Avatar userId="github_1" name="John Doe" theme="dark" />);
+
+    expect(container.querySelector('img')).toHaveAttribute(
+      'src',
+      `${BASE_URL}${API_BASE}/initials/github_1?name=John%20Doe&theme=dark`
+    );
+  });
+
   it("shouldn't be accessible with screen reader", () => {
     const { container } = render(<Avatar />);
 
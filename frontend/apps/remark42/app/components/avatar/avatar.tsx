@@ -1,20 +1,34 @@
 import clsx from 'clsx';
 import { h } from 'preact';
 
-import { BASE_URL } from 'common/constants.config';
+import { API_BASE, BASE_URL } from 'common/constants.config';
+import type { Theme } from 'common/types';
 
 import ghostIconUrl from './assets/ghost.svg';
 import styles from './avatar.module.css';
 
 type Props = {
   url?: string;
+  // user id and name are used to render initials avatar for users without picture
+  userId?: string;
+  name?: string;
+  theme?: Theme;
 };
 
-export function Avatar({ url }: Props) {
-  const avatarUrl = url || `${BASE_URL}${ghostIconUrl}`;
+function getInitialsUrl(userId: string, name: string, theme: Theme = 'light') {
+  return `${BASE_URL}${API_BASE}/initials/${encodeURIComponent(userId)}?name=${encodeURIComponent(name)}&theme=${theme}`;
+}
+
+export function Avatar({ url, userId, name, theme }: Props) {
+  const fallbackUrl = userId && name ? getInitialsUrl(userId, name, theme) : `${BASE_URL}${ghostIconUrl}`;
+  const avatarUrl = url || fallbackUrl;
 
   return (
     // eslint-disable-next-line jsx-a11y/alt-text
-    <img className={clsx('avatar', styles.avatar, !url && styles.avatarGhost)} src={avatarUrl} aria-hidden="true" />
+    <img
+      className={clsx('avatar', styles.avatar, !url && !(userId && name) && styles.avatarGhost)}
+      src={avatarUrl}
+      aria-hidden="true"
+    />
   );
 }
@@ -340,7 +340,8 @@ export class CommentForm extends Component<Props, State> {
         continue;
       }
 
-      const markdownString = `${placeholderStart}![${result.name}](${result.url})`;
+      const altText = (result.alt || result.name).replace(/[[\]]/g, '\\$&');
+      const markdownString = `${placeholderStart}![${altText}](${result.url})`;
       this.setState(
         {
           text: replaceSelection(
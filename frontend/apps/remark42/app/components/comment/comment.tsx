@@ -395,7 +395,7 @@ export class Comment extends Component<CommentProps, State> {
         <div className={styles.info}>
           {props.view !== 'user' && !props.collapsed && (
             <div className={styles.avatar}>
-              <Avatar url={o.user.picture} />
+              <Avatar url={o.user.picture} userId={o.user.id} name={o.user.name} theme={props.theme} />
             </div>
           )}
 
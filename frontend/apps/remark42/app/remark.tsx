@@ -13,6 +13,7 @@ import { StaticStore } from 'common/static-store';
 import { getConfig } from 'common/api';
 import { fetchHiddenUsers } from 'store/user/actions';
 import { restoreCollapsedThreads } from 'store/thread/actions';
+import { setPinnedSorting } from 'store/comments/actions';
 import { locale, theme, rawParams } from 'common/settings';
 
 if (document.readyState === 'loading') {
@@ -31,7 +32,10 @@ async function init(): Promise<void> {
   }
 
   const messages = await loadLocale(locale).catch(() => ({}));
-  const boundActions = bindActionCreators({ fetchHiddenUsers, restoreCollapsedThreads }, store.dispatch);
+  const boundActions = bindActionCreators(
+    { fetchHiddenUsers, restoreCollapsedThreads, setPinnedSorting },
+    store.dispatch
+  );
 
   node.innerHTML = '';
 
@@ -64,6 +68,17 @@ async function init(): Promise<void> {
     ...config,
     simple_view: config.simple_view || rawParams.simple_view === 'true',
   };
+  // site's custom styles go after the widget's own ones to override them
+  if (config.custom_css) {
+    const link = document.createElement('link');
+    link.rel = 'stylesheet';
+    link.href = config.custom_css;
+    document.head.appendChild(link);
+  }
+  // order pinned by site owner takes precedence over the one last picked by user
+  if (config.sort) {
+    boundActions.setPinnedSorting(config.sort);
+  }
 
   render(
     <IntlProvider locale={locale} messages={messages}>
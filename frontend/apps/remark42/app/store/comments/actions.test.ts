@@ -1,7 +1,7 @@
 import { mockStore } from '__stubs__/store';
 import { LS_SORT_KEY } from 'common/constants';
 
-import { updateSorting } from './actions';
+import { setPinnedSorting, updateSorting } from './actions';
 import { COMMENTS_SET_SORT } from './types';
 
 describe('Store comments actions', () => {
@@ -21,4 +21,13 @@ describe('Store comments actions', () => {
     expect(setCommentAction).toEqual({ type: COMMENTS_SET_SORT, payload: newSort });
     expect(localStorage.setItem).toHaveBeenCalledWith(LS_SORT_KEY, newSort);
   });
+
+  it('should not save pinned sort to localstorage', () => {
+    const store = mockStore({ comments: { sort: '+active' }, hiddenUsers: {} });
+
+    store.dispatch(setPinnedSorting('-score'));
+
+    expect(store.getActions()).toEqual([{ type: COMMENTS_SET_SORT, payload: '-score' }]);
+    expect(localStorage.setItem).not.toHaveBeenCalledWith(LS_SORT_KEY, '-score');
+  });
 });
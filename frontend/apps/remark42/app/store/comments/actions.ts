@@ -11,6 +11,7 @@ import {
   COMMENTS_EDIT,
   COMMENT_MODE_SET_ACTION,
   COMMENTS_SET_SORT,
+  COMMENTS_SET_SORT_ACTION,
   COMMENTS_REQUEST_FETCHING,
   COMMENTS_REQUEST_SUCCESS,
   COMMENT_PATCH,
@@ -121,6 +122,14 @@ export function unsetCommentMode(mode: StoreState['comments']['activeComment'] =
   } as COMMENT_MODE_SET_ACTION;
 }
 
+/** sets order of comments pinned for the post by site owner, not saved as user's choice */
+export function setPinnedSorting(sort: Sorting) {
+  return {
+    type: COMMENTS_SET_SORT,
+    payload: sort,
+  } as COMMENTS_SET_SORT_ACTION;
+}
+
 export function updateSorting(sort: Sorting): StoreAction {
   return async (dispatch, getState) => {
     const { sort: prevSort } = getState().comments;